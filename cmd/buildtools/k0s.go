@@ -80,6 +80,8 @@ var updateK0sImagesCommand = &cli.Command{
 			Images: make(map[string]release.AddonImage),
 		}
 
+		// the metadata is shared by every release, whatever components it disables, so
+		// the images of all the components are listed.
 		k0sImages := config.ListK0sImages(k0sv1beta1.DefaultClusterConfig())
 
 		metaImages, err := UpdateImages(c.Context, k0sImageComponents, config.Metadata.Images, k0sImages)
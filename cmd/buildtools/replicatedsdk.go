@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/addons/replicatedsdk"
+	"github.com/replicatedhq/embedded-cluster/pkg/release"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+var replicatedSDKImageComponents = map[string]addonComponent{
+	"docker.io/replicated/replicated-sdk": {
+		name:             "replicated-sdk",
+		useUpstreamImage: true,
+	},
+}
+
+var updateReplicatedSDKAddonCommand = &cli.Command{
+	Name:      "replicatedsdk",
+	Usage:     "Updates the Replicated SDK addon",
+	UsageText: environmentUsageText,
+	Action: func(c *cli.Context) error {
+		logrus.Infof("updating replicated sdk addon")
+
+		logrus.Infof("getting replicated sdk latest tag")
+		latest, err := GetLatestGitHubTag(c.Context, "replicatedhq", "replicated-sdk")
+		if err != nil {
+			return fmt.Errorf("failed to get replicated sdk latest tag: %w", err)
+		}
+		logrus.Infof("latest tag found: %s", latest)
+		latest = strings.TrimPrefix(latest, "v")
+
+		current := replicatedsdk.Metadata
+		if current.Version == latest && !c.Bool("force") {
+			logrus.Infof("replicated sdk chart version is already up-to-date")
+			return nil
+		}
+
+		upstream := "registry.replicated.com/library/replicated"
+		newmeta := release.AddonMetadata{
+			Version:  latest,
+			Location: fmt.Sprintf("oci://proxy.replicated.com/anonymous/%s", upstream),
+			Images:   make(map[string]release.AddonImage),
+		}
+
+		values, err := release.GetValuesWithOriginalImages("replicatedsdk")
+		if err != nil {
+			return fmt.Errorf("unable to get replicated sdk values: %v", err)
+		}
+
+		logrus.Infof("extracting images from chart")
+		withproto := fmt.Sprintf("oci://%s", upstream)
+		images, err := GetImagesFromOCIChart(withproto, "replicatedsdk", latest, values)
+		if err != nil {
+			return fmt.Errorf("failed to get images from replicated sdk chart: %w", err)
+		}
+
+		metaImages, err := UpdateImages(c.Context, replicatedSDKImageComponents, replicatedsdk.Metadata.Images, images)
+		if err != nil {
+			return fmt.Errorf("failed to update images: %w", err)
+		}
+		newmeta.Images = metaImages
+
+		logrus.Infof("saving addon manifest")
+		if err := newmeta.Save("replicatedsdk"); err != nil {
+			return fmt.Errorf("failed to save replicated sdk metadata: %w", err)
+		}
+
+		logrus.Infof("replicated sdk addon updated")
+		return nil
+	},
+}
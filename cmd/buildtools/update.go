@@ -29,6 +29,7 @@ var updateAddonCommand = &cli.Command{
 		updateRegistryAddonCommand,
 		updateVeleroAddonCommand,
 		updateSeaweedFSAddonCommand,
+		updateReplicatedSDKAddonCommand,
 	},
 }
 
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/certs"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/encryption"
+	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
+	"github.com/replicatedhq/embedded-cluster/pkg/prompts"
+	"github.com/replicatedhq/embedded-cluster/pkg/spinner"
+)
+
+var adminCommands = &cli.Command{
+	Name:  "admin",
+	Usage: "Run administrative tasks on the cluster",
+	Before: func(c *cli.Context) error {
+		os.Setenv("KUBECONFIG", defaults.PathToKubeConfig())
+		return nil
+	},
+	Subcommands: []*cli.Command{
+		adminRotateEncryptionKeyCommand,
+		adminRotateCertsCommand,
+		adminEtcdSnapshotsCommand,
+		adminWatchdogCommand,
+	},
+}
+
+var adminRotateEncryptionKeyCommand = &cli.Command{
+	Name:  "rotate-encryption-key",
+	Usage: "Rotate the key used to encrypt secrets at rest and re-encrypt existing secrets",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "no-prompt",
+			Usage: "Do not prompt user when it is not necessary",
+			Value: false,
+		},
+	},
+	Before: func(c *cli.Context) error {
+		if err := privileges.Check("rotate-encryption-key", hostPrivileges()...); err != nil {
+			return err
+		}
+		if _, err := os.Stat(defaults.PathToEncryptionConfig()); err != nil {
+			return fmt.Errorf("encryption at rest is not configured on this node")
+		}
+		return nil
+	},
+	Action: func(c *cli.Context) error {
+		kcli, err := kubeutils.KubeClient()
+		if err != nil {
+			return fmt.Errorf("unable to create kube client: %w", err)
+		}
+
+		// all controllers must share the same keys. the configuration is stored in the
+		// cluster and the host repair agents install it on the controllers.
+		ncps, err := kubeutils.NumOfControlPlaneNodes(c.Context, kcli)
+		if err != nil {
+			return fmt.Errorf("unable to count controller nodes: %w", err)
+		}
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("unable to get hostname: %w", err)
+		}
+
+		if !c.Bool("no-prompt") {
+			if ncps > 1 {
+				logrus.Warn("The Kubernetes API of each controller will restart three times during the rotation, one controller at a time.")
+			} else {
+				logrus.Warn("The Kubernetes API will be unavailable while it restarts (twice) during the rotation.")
+			}
+			if !prompts.New().Confirm("Do you want to continue?", false) {
+				return ErrNothingElseToAdd
+			}
+		}
+
+		loading := spinner.Start()
+		defer loading.Close()
+
+		loading.Infof("Generating a new encryption key")
+		var name string
+		// the api servers of all the controllers must be able to decrypt with the new key
+		// before any of them encrypts with it.
+		if ncps > 1 {
+			if err := rolloutEncryptionConfig(c.Context, kcli, hostname, func() (err error) {
+				name, err = encryption.AddKey()
+				return err
+			}); err != nil {
+				return fmt.Errorf("unable to add encryption key: %w", err)
+			}
+			loading.Infof("Encrypting with key %s", name)
+			if err := rolloutEncryptionConfig(c.Context, kcli, hostname, func() error {
+				return encryption.PromoteKey(name)
+			}); err != nil {
+				return fmt.Errorf("unable to promote encryption key: %w", err)
+			}
+		} else {
+			if err := rolloutEncryptionConfig(c.Context, kcli, hostname, func() (err error) {
+				name, err = encryption.RotateKey()
+				return err
+			}); err != nil {
+				return fmt.Errorf("unable to rotate encryption key: %w", err)
+			}
+		}
+
+		loading.Infof("Re-encrypting secrets with key %s", name)
+		count, err := encryption.ReencryptSecrets(c.Context, kcli)
+		if err != nil {
+			return fmt.Errorf("unable to re-encrypt secrets: %w", err)
+		}
+		logrus.Debugf("re-encrypted %d secrets", count)
+
+		loading.Infof("Removing previous encryption keys")
+		if err := rolloutEncryptionConfig(c.Context, kcli, hostname, encryption.PruneKeys); err != nil {
+			return fmt.Errorf("unable to remove previous encryption keys: %w", err)
+		}
+
+		loading.Closef("Encryption key rotated, %d secrets re-encrypted", count)
+		return nil
+	},
+}
+
+var adminRotateCertsCommand = &cli.Command{
+	Name:  "rotate-certs",
+	Usage: "Renew the certificates of the control plane components on this node",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "no-prompt",
+			Usage: "Do not prompt user when it is not necessary",
+			Value: false,
+		},
+	},
+	Before: func(c *cli.Context) error {
+		if err := privileges.Check("rotate-certs", hostPrivileges()...); err != nil {
+			return err
+		}
+		if _, err := os.Stat(certs.PKIDir); err != nil {
+			return fmt.Errorf("rotate-certs command must be run on a controller node")
+		}
+		return nil
+	},
+	Action: func(c *cli.Context) error {
+		current, err := certs.FromDir(certs.PKIDir)
+		if err != nil {
+			return fmt.Errorf("unable to read certificates: %w", err)
+		}
+		printCertificates(current)
+		for _, cert := range certs.Expiring(current, time.Now(), certs.ExpiryWarningThreshold) {
+			if cert.IsCA {
+				logrus.Warnf("Certificate authority %s is about to expire, rotating authorities is not supported.", cert)
+			}
+		}
+
+		if !c.Bool("no-prompt") {
+			logrus.Warn("Certificates other than the certificate authorities will be renewed and the Kubernetes API restarted.")
+			if !prompts.New().Confirm("Do you want to continue?", false) {
+				return ErrNothingElseToAdd
+			}
+		}
+
+		loading := spinner.Start()
+		defer loading.Close()
+
+		loading.Infof("Backing up certificates")
+		backupDir := filepath.Join(
+			defaults.EmbeddedClusterHomeDirectory(), "pki-backup", time.Now().UTC().Format("20060102150405"),
+		)
+		moved, err := certs.BackupLeafCertificates(certs.PKIDir, backupDir)
+		if err != nil {
+			return fmt.Errorf("unable to backup certificates: %w", err)
+		}
+		logrus.Debugf("moved %d certificates to %s", len(moved), backupDir)
+
+		loading.Infof("Restarting the control plane")
+		if err := restartAPIServer(c.Context); err != nil {
+			return err
+		}
+		loading.Closef("Certificates renewed, previous certificates saved to %s", backupDir)
+
+		renewed, err := certs.FromDir(certs.PKIDir)
+		if err != nil {
+			return fmt.Errorf("unable to read certificates: %w", err)
+		}
+		printCertificates(renewed)
+		return nil
+	},
+}
+
+// printCertificates prints a table with the certificates and their expiration date.
+func printCertificates(list []certs.Certificate) {
+	writer := table.NewWriter()
+	writer.AppendHeader(table.Row{"certificate", "subject", "expires"})
+	for _, cert := range list {
+		writer.AppendRow(table.Row{cert.Name, cert.Subject, cert.NotAfter.UTC().Format(time.RFC3339)})
+	}
+	fmt.Printf("%s\n", writer.Render())
+}
+
+// encryptionRolloutTimeout bounds the wait for the controllers to run with a new
+// encryption configuration. The host repair agents restart them one at a time.
+const encryptionRolloutTimeout = 30 * time.Minute
+
+// rolloutEncryptionConfig changes the encryption configuration of this controller and
+// stores it in the cluster, the host repair agents then install it on the other controllers
+// and restart the controllers, this one included, one at a time. The cluster lock is held
+// until the configuration is stored so the agent of this node does not install the
+// previous one back. Returns once all the controllers record they run with it.
+func rolloutEncryptionConfig(ctx context.Context, kcli client.Client, hostname string, change func() error) error {
+	lock, err := acquireClusterLock(ctx, kcli, "encryption key rotation")
+	if err != nil {
+		return err
+	}
+	hash, err := func() (string, error) {
+		defer releaseClusterLock(lock)
+		// the agent restarts k0s when the configuration on disk is not the one recorded.
+		current, err := encryptionConfigHash()
+		if err != nil {
+			return "", err
+		}
+		if err := recordEncryptionConfig(ctx, kcli, hostname, current); err != nil {
+			return "", err
+		}
+		if err := change(); err != nil {
+			return "", err
+		}
+		if err := encryption.StoreConfig(ctx, kcli, "embedded-cluster"); err != nil {
+			return "", fmt.Errorf("unable to store encryption config: %w", err)
+		}
+		return encryptionConfigHash()
+	}()
+	if err != nil {
+		return err
+	}
+
+	var pending []string
+	err = wait.PollUntilContextTimeout(ctx, 10*time.Second, encryptionRolloutTimeout, true, func(ctx context.Context) (bool, error) {
+		var nodes corev1.NodeList
+		// the api server of this node restarts in the meantime.
+		if err := kcli.List(ctx, &nodes, client.MatchingLabels{"node-role.kubernetes.io/control-plane": "true"}); err != nil {
+			logrus.Debugf("unable to list controller nodes: %v", err)
+			return false, nil
+		}
+		pending = nil
+		for _, node := range nodes.Items {
+			if node.Annotations[encryption.ConfigAnnotation] != hash {
+				pending = append(pending, node.Name)
+			}
+		}
+		return len(pending) == 0, nil
+	})
+	if err != nil {
+		return fmt.Errorf("timed out waiting for controllers %s to restart with the new encryption config: %w", strings.Join(pending, ", "), err)
+	}
+	return nil
+}
+
+// encryptionConfigHash returns the hash of the encryption configuration of this node.
+func encryptionConfigHash() (string, error) {
+	data, err := os.ReadFile(defaults.PathToEncryptionConfig())
+	if err != nil {
+		return "", fmt.Errorf("unable to read encryption config: %w", err)
+	}
+	return encryption.Hash(data)
+}
+
+// recordEncryptionConfig records on the node the hash of the encryption configuration its
+// api server runs with.
+func recordEncryptionConfig(ctx context.Context, kcli client.Client, hostname, hash string) error {
+	var node corev1.Node
+	if err := kcli.Get(ctx, client.ObjectKey{Name: hostname}, &node); err != nil {
+		return fmt.Errorf("unable to get node %s: %w", hostname, err)
+	}
+	patch := client.MergeFrom(node.DeepCopy())
+	if node.Annotations == nil {
+		node.Annotations = map[string]string{}
+	}
+	node.Annotations[encryption.ConfigAnnotation] = hash
+	if err := kcli.Patch(ctx, &node, patch); err != nil {
+		return fmt.Errorf("unable to record encryption config on node %s: %w", hostname, err)
+	}
+	return nil
+}
+
+// restartAPIServer restarts k0s so the control plane picks up changes to its
+// configuration or certificates and waits for the API to become available again.
+func restartAPIServer(ctx context.Context) error {
+	if _, err := helpers.RunCommand("systemctl", "restart", "k0scontroller"); err != nil {
+		return fmt.Errorf("unable to restart k0s: %w", err)
+	}
+	// a new client is created on every attempt as the kubeconfig may be rewritten by
+	// k0s during the restart.
+	if err := wait.PollUntilContextTimeout(ctx, 2*time.Second, 5*time.Minute, true, func(ctx context.Context) (bool, error) {
+		kcli, err := kubeutils.KubeClient()
+		if err != nil {
+			return false, nil
+		}
+		var secrets corev1.SecretList
+		return kcli.List(ctx, &secrets, client.InNamespace("kube-system"), client.Limit(1)) == nil, nil
+	}); err != nil {
+		return fmt.Errorf("timed out waiting for the kubernetes api: %w", err)
+	}
+	return nil
+}
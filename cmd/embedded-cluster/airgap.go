@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/airgap"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/kotscli"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
+	"github.com/replicatedhq/embedded-cluster/pkg/release"
+	"github.com/replicatedhq/embedded-cluster/pkg/spinner"
+)
+
+var airgapCommands = &cli.Command{
+	Name:  "airgap",
+	Usage: "Manage air gap bundles",
+	Subcommands: []*cli.Command{
+		airgapImportCommand,
+	},
+}
+
+// parseRateLimit parses a rate limit in bytes per second expressed as a kubernetes
+// quantity, e.g. 100M or 50Mi. Zero is returned for an empty rate limit.
+func parseRateLimit(limit string) (int64, error) {
+	if limit == "" {
+		return 0, nil
+	}
+	q, err := resource.ParseQuantity(limit)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate limit %q: %w", limit, err)
+	}
+	if q.Sign() <= 0 {
+		return 0, fmt.Errorf("invalid rate limit %q: must be positive", limit)
+	}
+	return q.Value(), nil
+}
+
+var airgapImportCommand = &cli.Command{
+	Name:  "import",
+	Usage: "Import an air gap bundle from removable or network storage into the cluster",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "source",
+			Usage:    "Path to the air gap bundle, e.g. on a mounted USB drive or NFS share",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "rate-limit",
+			Usage: "Maximum rate the bundle is read from the source at, in bytes per second (e.g. 100M or 50Mi). Unlimited by default.",
+		},
+		&cli.StringFlag{
+			Name:  "sha256",
+			Usage: "Expected sha256 checksum of the bundle, the import fails if the copy does not match",
+		},
+	},
+	Before: func(c *cli.Context) error {
+		if err := privileges.Check("airgap import", hostAdminPrivileges()...); err != nil {
+			return err
+		}
+		if _, err := parseRateLimit(c.String("rate-limit")); err != nil {
+			return err
+		}
+		os.Setenv("KUBECONFIG", defaults.PathToKubeConfig())
+		return nil
+	},
+	Action: func(c *cli.Context) error {
+		source := c.String("source")
+		logrus.Debugf("checking airgap bundle matches binary")
+		if err := checkAirgapBundleMatches(source); err != nil {
+			return err // we want the user to see the error message without a prefix
+		}
+		rel, err := release.GetChannelRelease()
+		if err != nil {
+			return fmt.Errorf("unable to get channel release: %w", err)
+		}
+
+		// the bundle is read once from the source, throttled, and imported from a local
+		// copy so the source link is not held for the duration of the import.
+		staging, err := os.MkdirTemp(defaults.EmbeddedClusterHomeDirectory(), "airgap-import-")
+		if err != nil {
+			return fmt.Errorf("unable to create staging directory: %w", err)
+		}
+		defer os.RemoveAll(staging)
+		bundle := filepath.Join(staging, filepath.Base(source))
+		if err := copyAirgapBundle(c, bundle, source); err != nil {
+			return err
+		}
+
+		loading := spinner.Start()
+		loading.Infof("Importing air gap bundle")
+		if err := kotscli.AirgapUpdate(kotscli.AirgapUpdateOptions{
+			AppSlug:      rel.AppSlug,
+			Namespace:    defaults.KotsadmNamespace,
+			AirgapBundle: bundle,
+		}); err != nil {
+			loading.CloseWithError()
+			return err
+		}
+		loading.Infof("Air gap bundle imported!")
+		loading.Close()
+		return nil
+	},
+}
+
+// copyAirgapBundle copies the bundle from the source to dst at the rate limit, showing
+// the progress, and verifies the checksum of the copy.
+func copyAirgapBundle(c *cli.Context, dst, source string) error {
+	limit, err := parseRateLimit(c.String("rate-limit"))
+	if err != nil {
+		return err
+	}
+	loading := spinner.Start()
+	loading.Infof("Copying air gap bundle from %s", source)
+	checksum, err := airgap.CopyBundle(c.Context, dst, source, airgap.CopyOptions{
+		RateLimit: limit,
+		Progress: func(copied, total int64) {
+			loading.Infof("Copying air gap bundle from %s (%s)", source, copyProgress(copied, total))
+		},
+	})
+	if err != nil {
+		loading.CloseWithError()
+		return err
+	}
+	if expected := c.String("sha256"); expected != "" && !strings.EqualFold(expected, checksum) {
+		loading.CloseWithError()
+		return fmt.Errorf("air gap bundle checksum %s does not match the expected %s, the source may be corrupted", checksum, expected)
+	}
+	loading.Infof("Air gap bundle copied, sha256 %s", checksum)
+	loading.Close()
+	return nil
+}
+
+// copyProgress formats the progress of a copy.
+func copyProgress(copied, total int64) string {
+	if total <= 0 {
+		return fmt.Sprintf("%d MiB", copied>>20)
+	}
+	return fmt.Sprintf("%d%%, %d of %d MiB", copied*100/total, copied>>20, total>>20)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	for _, tt := range []struct {
+		limit   string
+		want    int64
+		wantErr string
+	}{
+		{limit: "", want: 0},
+		{limit: "100M", want: 100000000},
+		{limit: "50Mi", want: 50 << 20},
+		{limit: "0", wantErr: `invalid rate limit "0": must be positive`},
+		{limit: "fast", wantErr: `invalid rate limit "fast"`},
+	} {
+		t.Run(tt.limit, func(t *testing.T) {
+			got, err := parseRateLimit(tt.limit)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCopyProgress(t *testing.T) {
+	assert.Equal(t, "25%, 256 of 1024 MiB", copyProgress(256<<20, 1<<30))
+	assert.Equal(t, "3 MiB", copyProgress(3<<20, 0))
+}
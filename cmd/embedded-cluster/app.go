@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/addons/embeddedclusteroperator"
+	"github.com/replicatedhq/embedded-cluster/pkg/appmigrate"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
+	"github.com/replicatedhq/embedded-cluster/pkg/prompts"
+)
+
+var appCommands = &cli.Command{
+	Name:  "app",
+	Usage: "Move the application state between clusters",
+	Before: func(c *cli.Context) error {
+		if err := privileges.Check("app", hostPrivileges()...); err != nil {
+			return err
+		}
+		os.Setenv("KUBECONFIG", defaults.PathToKubeConfig())
+		return nil
+	},
+	Subcommands: []*cli.Command{
+		appExportCommand,
+		appImportCommand,
+	},
+}
+
+var appExportCommand = &cli.Command{
+	Name:      "export",
+	Usage:     "Export the application secrets, config and volume data to an archive",
+	ArgsUsage: "<archive>",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "namespace",
+			Usage: fmt.Sprintf("Namespace holding application state to export, in addition to %s", defaults.KotsadmNamespace),
+		},
+	},
+	Before: func(c *cli.Context) error {
+		if c.Args().Len() != 1 {
+			return fmt.Errorf("export requires the path to the archive to write")
+		}
+		return nil
+	},
+	Action: func(c *cli.Context) error {
+		namespaces := []string{defaults.KotsadmNamespace}
+		for _, ns := range c.StringSlice("namespace") {
+			if ns != defaults.KotsadmNamespace {
+				namespaces = append(namespaces, ns)
+			}
+		}
+
+		path := c.Args().First()
+		migrator, err := newAppMigrator(filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		out, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("unable to create archive: %w", err)
+		}
+		defer out.Close()
+
+		logrus.Info("The application is scaled down while the data in its volumes is exported.")
+		manifest, err := migrator.Export(c.Context, namespaces, out)
+		if err != nil {
+			os.Remove(path)
+			return fmt.Errorf("unable to export application: %w", err)
+		}
+		if err := out.Close(); err != nil {
+			return fmt.Errorf("unable to write archive: %w", err)
+		}
+		logrus.Infof("Exported %d resources and %d volumes to %s", manifest.Resources, len(manifest.Volumes), path)
+		return nil
+	},
+}
+
+var appImportCommand = &cli.Command{
+	Name:      "import",
+	Usage:     "Import the application secrets, config and volume data from an archive",
+	ArgsUsage: "<archive>",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "no-prompt",
+			Usage: "Do not prompt user when it is not necessary",
+			Value: false,
+		},
+	},
+	Before: func(c *cli.Context) error {
+		if c.Args().Len() != 1 {
+			return fmt.Errorf("import requires the path to the archive to read")
+		}
+		return nil
+	},
+	Action: func(c *cli.Context) error {
+		in, err := os.Open(c.Args().First())
+		if err != nil {
+			return fmt.Errorf("unable to open archive: %w", err)
+		}
+		defer in.Close()
+
+		if !c.Bool("no-prompt") {
+			logrus.Warn("Existing secrets, config and volume data of the application in this cluster will be replaced.")
+			if !prompts.New().Confirm("Do you want to continue?", false) {
+				return ErrNothingElseToAdd
+			}
+		}
+
+		migrator, err := newAppMigrator("")
+		if err != nil {
+			return err
+		}
+		manifest, err := migrator.Import(c.Context, in)
+		if err != nil {
+			return fmt.Errorf("unable to import application: %w", err)
+		}
+		logrus.Infof("Imported %d resources and %d volumes exported on %s", manifest.Resources, len(manifest.Volumes), manifest.CreatedAt.Format("2006-01-02 15:04:05 MST"))
+		return nil
+	},
+}
+
+// newAppMigrator returns a migrator for the cluster, volume data is staged in tmpdir
+// while exporting.
+func newAppMigrator(tmpdir string) (*appmigrate.Migrator, error) {
+	kcli, err := kubeutils.KubeClient()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create kube client: %w", err)
+	}
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to process kubernetes config: %w", err)
+	}
+	exec, err := appmigrate.NewExecFunc(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &appmigrate.Migrator{
+		Client: kcli,
+		Exec:   exec,
+		// the utils image is part of every installation, airgap ones included.
+		Image:   embeddedclusteroperator.Metadata.Images["utils"].String(),
+		TempDir: tmpdir,
+	}, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/artifactmirror"
+	"github.com/replicatedhq/embedded-cluster/pkg/clusterlock"
+	ecerrors "github.com/replicatedhq/embedded-cluster/pkg/errors"
+	"github.com/replicatedhq/embedded-cluster/pkg/joincheck"
+)
+
+// clusterLockReleaseTimeout is how long we try to release the cluster lock for, it is
+// released even if the command was interrupted.
+const clusterLockReleaseTimeout = 10 * time.Second
+
+// acquireClusterLock acquires the cluster lock for the operation. The error names who
+// holds it when another node is running an operation.
+func acquireClusterLock(ctx context.Context, kcli client.Client, operation string) (*clusterlock.Lock, error) {
+	logrus.Debugf("acquiring cluster lock for %s", operation)
+	lock, err := clusterlock.Acquire(ctx, kcli, operation)
+	var held *clusterlock.HeldError
+	if errors.As(err, &held) {
+		return nil, ecerrors.WithKind(ecerrors.Locked, err)
+	}
+	return lock, err
+}
+
+// releaseClusterLock releases the cluster lock. Failures are only logged, the lock
+// expires on its own.
+func releaseClusterLock(lock *clusterlock.Lock) {
+	ctx, cancel := context.WithTimeout(context.Background(), clusterLockReleaseTimeout)
+	defer cancel()
+	if err := lock.Release(ctx); err != nil {
+		logrus.Debugf("unable to release cluster lock: %v", err)
+	}
+}
+
+// joinLock is the cluster lock held for a joining controller by the artifact mirror of the
+// controller the join token points to, until the node joined and takes it over.
+type joinLock struct {
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// holdJoinLock has the cluster lock held for this node before the join changes the host
+// or the etcd cluster, and keeps it held in the background. The error names who holds it
+// when another node is running an operation.
+func holdJoinLock(c *cli.Context, jcmd *JoinCommandResponse) (*joinLock, error) {
+	addr, err := artifactMirrorAddress(c, jcmd)
+	if err != nil {
+		return nil, err
+	}
+	token, err := joincheck.DecodeToken(jcmd.K0sToken)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read join token: %w", err)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get hostname: %w", err)
+	}
+	mirrorURL := fmt.Sprintf("http://%s", addr)
+	logrus.Debugf("holding cluster lock through the artifact mirror at %s", addr)
+	err = artifactmirror.HoldJoinLock(c.Context, mirrorURL, token.BearerToken, hostname)
+	var held *clusterlock.HeldError
+	if errors.As(err, &held) {
+		return nil, ecerrors.WithKind(ecerrors.Locked, err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lock := &joinLock{cancel: cancel}
+	lock.wg.Add(1)
+	go func() {
+		defer lock.wg.Done()
+		ticker := time.NewTicker(clusterlock.DefaultDuration / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := artifactmirror.HoldJoinLock(ctx, mirrorURL, token.BearerToken, hostname); err != nil {
+				logrus.Debugf("unable to renew cluster lock: %v", err)
+			}
+		}
+	}()
+	return lock, nil
+}
+
+// stop stops holding the lock through the artifact mirror, the lock expires unless the
+// node took it over. Stopping a nil joinLock is a no-op.
+func (l *joinLock) stop() {
+	if l == nil {
+		return
+	}
+	l.cancel()
+	l.wg.Wait()
+}
@@ -0,0 +1,37 @@
+//go:build !agent
+
+package main
+
+import "github.com/urfave/cli/v2"
+
+// commands returns the commands of the full installer.
+func commands() []*cli.Command {
+	return []*cli.Command{
+		installCommand,
+		shellCommand,
+		kubectlCommand,
+		nodeCommands,
+		versionCommand,
+		joinCommand,
+		resetCommand,
+		materializeCommand,
+		updateCommand,
+		restoreCommand,
+		hardeningCommands,
+		adminCommands,
+		appCommands,
+		preflightsCommands,
+		statusCommand,
+		networkCommands,
+		completionCommand,
+		verifyCommand,
+		pullCommand,
+		devCommands,
+		renderCommand,
+		airgapCommands,
+		validateConfigCommand,
+		haCommands,
+		configCommands,
+		pluginCommands,
+	}
+}
@@ -0,0 +1,17 @@
+//go:build agent
+
+package main
+
+import "github.com/urfave/cli/v2"
+
+// commands returns the commands of the agent build, distributed to the worker nodes of
+// large fleets. It embeds neither the binaries nor the release, joins fetch the binaries
+// from the artifact mirror of a controller.
+func commands() []*cli.Command {
+	return []*cli.Command{
+		joinCommand,
+		statusCommand,
+		resetCommand,
+		versionCommand,
+	}
+}
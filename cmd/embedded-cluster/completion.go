@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	veleroclientv1 "github.com/vmware-tanzu/velero/pkg/generated/clientset/versioned/typed/velero/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sconfig "sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+)
+
+// completionTimeout bounds the time spent querying the cluster while completing, the
+// shell is blocked until we answer.
+const completionTimeout = 3 * time.Second
+
+// The completion scripts ask the binary for the candidates of the word being completed
+// with the --generate-bash-completion flag, candidates are then computed by the command
+// being completed, including dynamic ones such as node and backup names.
+const bashCompletionScript = `# bash completion for %[1]s
+_%[2]s_completion() {
+  local cur words cword
+  COMPREPLY=()
+  cur="${COMP_WORDS[COMP_CWORD]}"
+  if declare -F _init_completion >/dev/null 2>&1; then
+    _init_completion -n "=:" || return
+  else
+    words=("${COMP_WORDS[@]}")
+    cword=$COMP_CWORD
+  fi
+  words=("${words[@]:0:$cword}")
+  local opts
+  if [[ "$cur" == "-"* ]]; then
+    opts=$("${words[@]}" "$cur" --generate-bash-completion 2>/dev/null)
+  else
+    opts=$("${words[@]}" --generate-bash-completion 2>/dev/null)
+  fi
+  COMPREPLY=($(compgen -W "${opts}" -- "${cur}"))
+}
+complete -o bashdefault -o default -F _%[2]s_completion %[1]s
+`
+
+const zshCompletionScript = `#compdef %[1]s
+# zsh completion for %[1]s
+_%[2]s_completion() {
+  local -a opts
+  local cur=${words[-1]}
+  if [[ "$cur" == "-"* ]]; then
+    opts=("${(@f)$(${words[@]:0:#words[@]-1} ${cur} --generate-bash-completion 2>/dev/null)}")
+  else
+    opts=("${(@f)$(${words[@]:0:#words[@]-1} --generate-bash-completion 2>/dev/null)}")
+  fi
+  if [[ "${opts[1]}" != "" ]]; then
+    compadd -a opts
+  else
+    _files
+  fi
+}
+compdef _%[2]s_completion %[1]s
+`
+
+const fishCompletionScript = `# fish completion for %[1]s
+function __%[2]s_completion
+  set -l args (commandline -opc)
+  set -l cur (commandline -ct)
+  if string match -q -- '-*' $cur
+    $args $cur --generate-bash-completion 2>/dev/null
+  else
+    $args --generate-bash-completion 2>/dev/null
+  end
+end
+complete -c %[1]s -f -a '(__%[2]s_completion)'
+`
+
+var completionCommand = &cli.Command{
+	Name:      "completion",
+	Usage:     "Output the shell completion script for bash, zsh or fish",
+	ArgsUsage: "<bash|zsh|fish>",
+	Description: fmt.Sprintf(`Load the completion script in the current shell with, for example:
+
+  source <(%[1]s completion bash)
+
+To load completions for every session install the script in the completion
+directory of your shell, e.g. /etc/bash_completion.d/%[1]s.`, binName),
+	BashComplete: func(c *cli.Context) {
+		if c.NArg() == 0 {
+			fmt.Fprintln(c.App.Writer, "bash\nzsh\nfish")
+		}
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return fmt.Errorf("usage: %s completion <bash|zsh|fish>", binName)
+		}
+		script, err := completionScript(c.Args().First(), c.App.Name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(c.App.Writer, script)
+		return nil
+	},
+}
+
+// completionScript returns the completion script for the provided shell and program.
+func completionScript(shell, prog string) (string, error) {
+	// the program name is used in shell function names.
+	fn := strings.NewReplacer("-", "_", ".", "_").Replace(prog)
+	switch shell {
+	case "bash":
+		return fmt.Sprintf(bashCompletionScript, prog, fn), nil
+	case "zsh":
+		return fmt.Sprintf(zshCompletionScript, prog, fn), nil
+	case "fish":
+		return fmt.Sprintf(fishCompletionScript, prog, fn), nil
+	}
+	return "", fmt.Errorf("unsupported shell %q, must be one of bash, zsh or fish", shell)
+}
+
+// completeFlagValue returns a completion function printing the candidates returned by
+// values when the value of the provided flag is being completed. Completion falls back
+// to the default behavior otherwise.
+func completeFlagValue(flag string, values func(context.Context) []string) cli.BashCompleteFunc {
+	return func(c *cli.Context) {
+		if len(os.Args) > 2 && os.Args[len(os.Args)-2] == "--"+flag {
+			for _, value := range values(c.Context) {
+				fmt.Fprintln(c.App.Writer, value)
+			}
+			return
+		}
+		cli.DefaultCompleteWithFlags(c.Command)(c)
+	}
+}
+
+// completeArgs returns a completion function printing the candidates returned by values
+// while the command positional arguments are being completed.
+func completeArgs(values func(context.Context) []string) cli.BashCompleteFunc {
+	return func(c *cli.Context) {
+		if len(os.Args) > 2 && strings.HasPrefix(os.Args[len(os.Args)-2], "-") {
+			cli.DefaultCompleteWithFlags(c.Command)(c)
+			return
+		}
+		for _, value := range values(c.Context) {
+			fmt.Fprintln(c.App.Writer, value)
+		}
+	}
+}
+
+// completionKubeConfigAvailable points the kubernetes clients at the cluster
+// kubeconfig. Returns false if this host has no kubeconfig or it can't be read, dynamic
+// completions are skipped in that case.
+func completionKubeConfigAvailable() bool {
+	if _, err := os.Stat(defaults.PathToKubeConfig()); err != nil {
+		return false
+	}
+	os.Setenv("KUBECONFIG", defaults.PathToKubeConfig())
+	return true
+}
+
+// completeNodeNames returns the names of the cluster nodes.
+func completeNodeNames(ctx context.Context) []string {
+	if !completionKubeConfigAvailable() {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, completionTimeout)
+	defer cancel()
+	kcli, err := kubeutils.KubeClient()
+	if err != nil {
+		return nil
+	}
+	var nodes corev1.NodeList
+	if err := kcli.List(ctx, &nodes); err != nil {
+		return nil
+	}
+	var names []string
+	for _, node := range nodes.Items {
+		names = append(names, node.Name)
+	}
+	return names
+}
+
+// completeBackupNames returns the names of the velero backups.
+func completeBackupNames(ctx context.Context) []string {
+	if !completionKubeConfigAvailable() {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, completionTimeout)
+	defer cancel()
+	cfg, err := k8sconfig.GetConfig()
+	if err != nil {
+		return nil
+	}
+	veleroClient, err := veleroclientv1.NewForConfig(cfg)
+	if err != nil {
+		return nil
+	}
+	backups, err := veleroClient.Backups(defaults.VeleroNamespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, backup := range backups.Items {
+		names = append(names, backup.Name)
+	}
+	return names
+}
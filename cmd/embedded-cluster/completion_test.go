@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompletionScript(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		script, err := completionScript(shell, "my-app")
+		require.NoError(t, err)
+		assert.Contains(t, script, "my_app_completion")
+		assert.Contains(t, script, "--generate-bash-completion")
+	}
+
+	script, err := completionScript("bash", "my-app")
+	require.NoError(t, err)
+	assert.Contains(t, script, "complete -o bashdefault -o default -F _my_app_completion my-app")
+
+	_, err = completionScript("powershell", "my-app")
+	assert.Error(t, err)
+}
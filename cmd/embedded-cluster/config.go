@@ -0,0 +1,305 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	corev1 "k8s.io/api/core/v1"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+	"github.com/replicatedhq/embedded-cluster/pkg/hostconfig"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
+	"github.com/replicatedhq/embedded-cluster/pkg/prompts"
+	"github.com/replicatedhq/embedded-cluster/pkg/spinner"
+)
+
+var configCommands = &cli.Command{
+	Name:  "config",
+	Usage: "Change the configuration of the cluster after install",
+	Subcommands: []*cli.Command{
+		configSetProxyCommand,
+		configSetPortsCommand,
+		configSetPrestageCommand,
+		configRenderCommand,
+	},
+}
+
+var configSetProxyCommand = &cli.Command{
+	Name:  "set-proxy",
+	Usage: "Change the proxy used by the cluster and restart the components using it",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "http-proxy",
+			Usage: "Proxy server to use for HTTP, keeps the current one if not set",
+		},
+		&cli.StringFlag{
+			Name:  "https-proxy",
+			Usage: "Proxy server to use for HTTPS, keeps the current one if not set",
+		},
+		&cli.StringFlag{
+			Name:  "no-proxy",
+			Usage: "Comma-separated list of hosts for which not to use a proxy, keeps the current one if not set",
+		},
+		&cli.BoolFlag{
+			Name:  "clear",
+			Usage: "Remove the proxy configuration",
+		},
+		&cli.BoolFlag{
+			Name:  "host-only",
+			Usage: "Only configure this node, using the no proxy list as provided. Used on the nodes other than the one the proxy was changed from",
+		},
+		&cli.BoolFlag{
+			Name:  "no-prompt",
+			Usage: "Do not prompt user when it is not necessary",
+			Value: false,
+		},
+	},
+	Before: func(c *cli.Context) error {
+		if err := privileges.Check("config set-proxy", hostPrivileges()...); err != nil {
+			return err
+		}
+		if c.Bool("clear") && (c.IsSet("http-proxy") || c.IsSet("https-proxy") || c.IsSet("no-proxy")) {
+			return fmt.Errorf("--clear can not be used with --http-proxy, --https-proxy or --no-proxy")
+		}
+		if c.Bool("host-only") {
+			return nil
+		}
+		if _, err := os.Stat(defaults.PathToKubeConfig()); err != nil {
+			return fmt.Errorf("config set-proxy must be run on a controller node, use --host-only on workers")
+		}
+		os.Setenv("KUBECONFIG", defaults.PathToKubeConfig())
+		return nil
+	},
+	Action: func(c *cli.Context) error {
+		if c.Bool("host-only") {
+			proxy := proxySpecFromSetProxyFlags(c, nil)
+			if proxy != nil {
+				proxy.NoProxy = proxy.ProvidedNoProxy
+			}
+			return applyHostProxy(proxy)
+		}
+
+		kcli, err := kubeutils.KubeClient()
+		if err != nil {
+			return fmt.Errorf("unable to create kube client: %w", err)
+		}
+		in, err := kubeutils.GetLatestInstallation(c.Context, kcli)
+		if err != nil {
+			return fmt.Errorf("unable to get latest installation: %w", err)
+		}
+		var nodes corev1.NodeList
+		if err := kcli.List(c.Context, &nodes); err != nil {
+			return fmt.Errorf("unable to list nodes: %w", err)
+		}
+		proxy := proxySpecFromSetProxyFlags(c, in.Spec.Proxy)
+		if proxy != nil {
+			proxy.NoProxy = clusterNoProxy(proxy.ProvidedNoProxy, nodeInternalIPs(nodes.Items), in.Spec.Network)
+		}
+
+		printProxySpec(proxy)
+		logrus.Warnf("The cluster services of this node are restarted and the cluster components using the proxy are rolled out again.")
+		if !c.Bool("no-prompt") && !prompts.New().Confirm("Do you want to continue?", false) {
+			return ErrNothingElseToAdd
+		}
+
+		// the host services are restarted first so the images of the components rolled
+		// out next are pulled through the new proxy.
+		if err := applyHostProxy(proxy); err != nil {
+			return err
+		}
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("unable to get hostname: %w", err)
+		}
+		if err := waitForNodeReady(c.Context, hostname, 5*time.Minute); err != nil {
+			return err
+		}
+
+		loading := spinner.Start()
+		loading.Infof("Updating the cluster components")
+		if kcli, err = kubeutils.KubeClient(); err != nil {
+			loading.CloseWithError()
+			return fmt.Errorf("unable to create kube client: %w", err)
+		}
+		if in, err = kubeutils.GetLatestInstallation(c.Context, kcli); err != nil {
+			loading.CloseWithError()
+			return fmt.Errorf("unable to get latest installation: %w", err)
+		}
+		in.Spec.Proxy = proxy
+		if err := kcli.Update(c.Context, in); err != nil {
+			loading.CloseWithError()
+			return fmt.Errorf("unable to update installation: %w", err)
+		}
+		if err := kubeutils.WaitForInstallation(c.Context, kcli, loading); err != nil {
+			loading.CloseWithError()
+			return fmt.Errorf("unable to wait for installation: %w", err)
+		}
+		if err := kubeutils.WaitForDeployment(c.Context, kcli, defaults.KotsadmNamespace, "kotsadm"); err != nil {
+			loading.CloseWithError()
+			return fmt.Errorf("unable to wait for the admin console: %w", err)
+		}
+		loading.Infof("Cluster components updated")
+		loading.Close()
+
+		if others := len(nodes.Items) - 1; others > 0 {
+			logrus.Infof("Run the following command on the other %d nodes of the cluster:", others)
+			logrus.Infof("  sudo ./%s config set-proxy --host-only %s", binName, hostOnlyProxyFlags(proxy))
+		}
+		return nil
+	},
+}
+
+// proxySpecFromSetProxyFlags returns the proxy set by the flags, the values not set are
+// kept from the current proxy. Returns nil if the proxy is cleared.
+func proxySpecFromSetProxyFlags(c *cli.Context, current *ecv1beta1.ProxySpec) *ecv1beta1.ProxySpec {
+	if c.Bool("clear") {
+		return nil
+	}
+	proxy := &ecv1beta1.ProxySpec{}
+	if current != nil {
+		proxy.HTTPProxy = current.HTTPProxy
+		proxy.HTTPSProxy = current.HTTPSProxy
+		proxy.ProvidedNoProxy = current.ProvidedNoProxy
+	}
+	if c.IsSet("http-proxy") {
+		proxy.HTTPProxy = c.String("http-proxy")
+	}
+	if c.IsSet("https-proxy") {
+		proxy.HTTPSProxy = c.String("https-proxy")
+	}
+	if c.IsSet("no-proxy") {
+		proxy.ProvidedNoProxy = c.String("no-proxy")
+	}
+	if proxy.HTTPProxy == "" && proxy.HTTPSProxy == "" {
+		return nil
+	}
+	return proxy
+}
+
+// clusterNoProxy returns the hosts not reached through the proxy: the defaults, the ones
+// provided by the user, the addresses of the nodes not covered by them and the pod and
+// service networks.
+func clusterNoProxy(provided string, nodeIPs []string, network *ecv1beta1.NetworkSpec) string {
+	podCIDR, serviceCIDR := k0sv1beta1.DefaultNetwork().PodCIDR, k0sv1beta1.DefaultNetwork().ServiceCIDR
+	if network != nil && network.PodCIDR != "" {
+		podCIDR = network.PodCIDR
+	}
+	if network != nil && network.ServiceCIDR != "" {
+		serviceCIDR = network.ServiceCIDR
+	}
+
+	entries := append([]string{}, defaults.DefaultNoProxy...)
+	for _, entry := range strings.Split(provided, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	for _, ip := range nodeIPs {
+		if covered, err := validateNoProxy(strings.Join(entries, ","), ip); err == nil && !covered {
+			entries = append(entries, ip)
+		}
+	}
+	entries = append(entries, podCIDR, serviceCIDR)
+
+	seen := map[string]bool{}
+	result := []string{}
+	for _, entry := range entries {
+		if !seen[entry] {
+			seen[entry] = true
+			result = append(result, entry)
+		}
+	}
+	return strings.Join(result, ",")
+}
+
+// nodeInternalIPs returns the internal addresses of the nodes.
+func nodeInternalIPs(nodes []corev1.Node) []string {
+	ips := []string{}
+	for _, node := range nodes {
+		for _, addr := range node.Status.Addresses {
+			if addr.Type == corev1.NodeInternalIP {
+				ips = append(ips, addr.Address)
+			}
+		}
+	}
+	return ips
+}
+
+// applyHostProxy writes the proxy drop-ins of the k0s and local artifact mirror services of
+// this node, or removes them if the proxy is nil, and restarts the services.
+func applyHostProxy(proxy *ecv1beta1.ProxySpec) error {
+	k0sService, k0sDropIn := k0sUnit(), hostconfig.ControllerProxyDropInPath
+	if k0sService == "k0sworker" {
+		k0sDropIn = hostconfig.WorkerProxyDropInPath
+	}
+	for _, path := range []string{k0sDropIn, hostconfig.LocalArtifactMirrorProxyDropInPath} {
+		if proxy == nil {
+			if err := helpers.RemoveAll(path); err != nil {
+				return fmt.Errorf("unable to remove %s: %w", path, err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("unable to create directory: %w", err)
+		}
+		if err := os.WriteFile(path, []byte(hostconfig.ProxyDropIn(proxy)), 0644); err != nil {
+			return fmt.Errorf("unable to write %s: %w", path, err)
+		}
+	}
+
+	logrus.Info("Restarting the cluster services of this node...")
+	if _, err := helpers.RunCommand("systemctl", "daemon-reload"); err != nil {
+		return fmt.Errorf("unable to reload systemctl daemon: %w", err)
+	}
+	if _, err := helpers.RunCommand("systemctl", "restart", "local-artifact-mirror"); err != nil {
+		return fmt.Errorf("unable to restart the local artifact mirror: %w", err)
+	}
+	if _, err := helpers.RunCommand("systemctl", "restart", k0sService); err != nil {
+		return fmt.Errorf("unable to restart %s: %w", k0sService, err)
+	}
+	return nil
+}
+
+// hostOnlyProxyFlags returns the flags configuring the same proxy on the other nodes.
+func hostOnlyProxyFlags(proxy *ecv1beta1.ProxySpec) string {
+	if proxy == nil {
+		return "--clear"
+	}
+	flags := []string{}
+	if proxy.HTTPProxy != "" {
+		flags = append(flags, fmt.Sprintf("--http-proxy %q", proxy.HTTPProxy))
+	}
+	if proxy.HTTPSProxy != "" {
+		flags = append(flags, fmt.Sprintf("--https-proxy %q", proxy.HTTPSProxy))
+	}
+	flags = append(flags, fmt.Sprintf("--no-proxy %q", proxy.NoProxy))
+	return strings.Join(flags, " ")
+}
+
+// printProxySpec prints the proxy about to be configured.
+func printProxySpec(proxy *ecv1beta1.ProxySpec) {
+	if proxy == nil {
+		logrus.Infof("The proxy configuration is going to be removed.")
+		return
+	}
+	logrus.Infof("HTTP proxy:  %s", proxy.HTTPProxy)
+	logrus.Infof("HTTPS proxy: %s", proxy.HTTPSProxy)
+	logrus.Infof("No proxy:    %s", proxy.NoProxy)
+}
+
+// k0sUnit returns the systemd unit k0s runs as on this node, k0scontroller or k0sworker.
+func k0sUnit() string {
+	if _, err := os.Stat("/etc/systemd/system/k0scontroller.service"); err != nil {
+		return "k0sworker"
+	}
+	return "k0scontroller"
+}
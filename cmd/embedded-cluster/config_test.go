@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"testing"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+)
+
+func TestProxySpecFromSetProxyFlags(t *testing.T) {
+	current := &ecv1beta1.ProxySpec{
+		HTTPProxy:       "http://old-proxy",
+		HTTPSProxy:      "https://old-proxy",
+		ProvidedNoProxy: "10.0.0.0/24",
+		NoProxy:         "localhost,10.0.0.0/24",
+	}
+	for _, tt := range []struct {
+		name    string
+		args    []string
+		current *ecv1beta1.ProxySpec
+		want    *ecv1beta1.ProxySpec
+	}{
+		{
+			name:    "keeps the values not set",
+			args:    []string{"--https-proxy", "https://new-proxy"},
+			current: current,
+			want: &ecv1beta1.ProxySpec{
+				HTTPProxy:       "http://old-proxy",
+				HTTPSProxy:      "https://new-proxy",
+				ProvidedNoProxy: "10.0.0.0/24",
+			},
+		},
+		{
+			name: "proxy set after install",
+			args: []string{"--http-proxy", "http://proxy", "--no-proxy", "example.com"},
+			want: &ecv1beta1.ProxySpec{
+				HTTPProxy:       "http://proxy",
+				ProvidedNoProxy: "example.com",
+			},
+		},
+		{
+			name:    "clear",
+			args:    []string{"--clear"},
+			current: current,
+			want:    nil,
+		},
+		{
+			name:    "unset both proxies",
+			args:    []string{"--http-proxy", "", "--https-proxy", ""},
+			current: current,
+			want:    nil,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			flagSet := flag.NewFlagSet("test", 0)
+			for _, f := range configSetProxyCommand.Flags {
+				f.Apply(flagSet)
+			}
+			assert.NoError(t, flagSet.Parse(tt.args))
+			c := cli.NewContext(cli.NewApp(), flagSet, nil)
+			assert.Equal(t, tt.want, proxySpecFromSetProxyFlags(c, tt.current))
+		})
+	}
+}
+
+func TestClusterNoProxy(t *testing.T) {
+	network := &ecv1beta1.NetworkSpec{PodCIDR: "10.244.0.0/16", ServiceCIDR: "10.96.0.0/12"}
+	got := clusterNoProxy("10.0.0.0/24, example.com,localhost", []string{"10.0.0.1", "192.168.1.5"}, network)
+	assert.Equal(t, "localhost,127.0.0.1,.cluster.local,.svc,10.0.0.0/24,example.com,192.168.1.5,10.244.0.0/16,10.96.0.0/12", got)
+}
+
+func TestHostOnlyProxyFlags(t *testing.T) {
+	assert.Equal(t, "--clear", hostOnlyProxyFlags(nil))
+	proxy := &ecv1beta1.ProxySpec{HTTPSProxy: "https://proxy", NoProxy: "localhost,10.0.0.0/24"}
+	assert.Equal(t, `--https-proxy "https://proxy" --no-proxy "localhost,10.0.0.0/24"`, hostOnlyProxyFlags(proxy))
+}
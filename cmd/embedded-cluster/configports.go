@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	corev1 "k8s.io/api/core/v1"
+	k8snet "k8s.io/utils/net"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/firewall"
+	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+	"github.com/replicatedhq/embedded-cluster/pkg/hostconfig"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
+	"github.com/replicatedhq/embedded-cluster/pkg/prompts"
+	"github.com/replicatedhq/embedded-cluster/pkg/spinner"
+)
+
+// lamPortEnvRegex matches the port setting of the local artifact mirror drop-in.
+var lamPortEnvRegex = regexp.MustCompile(`LOCAL_ARTIFACT_MIRROR_PORT=\d+`)
+
+// clusterPorts are the ports of the admin console and the local artifact mirror.
+type clusterPorts struct {
+	AdminConsole        int
+	LocalArtifactMirror int
+}
+
+var configSetPortsCommand = &cli.Command{
+	Name:  "set-ports",
+	Usage: "Change the admin console and local artifact mirror ports of a running cluster",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "admin-console-port",
+			Usage: "Port on which the Admin Console will be served, keeps the current one if not set",
+		},
+		&cli.StringFlag{
+			Name:  "local-artifact-mirror-port",
+			Usage: "Port on which the Local Artifact Mirror will be served, keeps the current one if not set",
+		},
+		&cli.BoolFlag{
+			Name:  "host-only",
+			Usage: "Only configure this node, both ports must be provided. Used on the nodes other than the one the ports were changed from",
+		},
+		&cli.BoolFlag{
+			Name:  "no-prompt",
+			Usage: "Do not prompt user when it is not necessary",
+			Value: false,
+		},
+	},
+	Before: func(c *cli.Context) error {
+		if err := privileges.Check("config set-ports", hostPrivileges()...); err != nil {
+			return err
+		}
+		if !c.IsSet("admin-console-port") && !c.IsSet("local-artifact-mirror-port") {
+			return fmt.Errorf("at least one of --admin-console-port or --local-artifact-mirror-port must be set")
+		}
+		if c.Bool("host-only") {
+			if !c.IsSet("admin-console-port") || !c.IsSet("local-artifact-mirror-port") {
+				return fmt.Errorf("--host-only requires both --admin-console-port and --local-artifact-mirror-port")
+			}
+			return nil
+		}
+		if _, err := os.Stat(defaults.PathToKubeConfig()); err != nil {
+			return fmt.Errorf("config set-ports must be run on a controller node, use --host-only on workers")
+		}
+		os.Setenv("KUBECONFIG", defaults.PathToKubeConfig())
+		return nil
+	},
+	Action: func(c *cli.Context) error {
+		if c.Bool("host-only") {
+			ports, err := portsFromSetPortsFlags(c, clusterPorts{})
+			if err != nil {
+				return err
+			}
+			return applyHostPorts(c, ports)
+		}
+
+		kcli, err := kubeutils.KubeClient()
+		if err != nil {
+			return fmt.Errorf("unable to create kube client: %w", err)
+		}
+		in, err := kubeutils.GetLatestInstallation(c.Context, kcli)
+		if err != nil {
+			return fmt.Errorf("unable to get latest installation: %w", err)
+		}
+		current := installationPorts(in.Spec)
+		ports, err := portsFromSetPortsFlags(c, current)
+		if err != nil {
+			return err
+		}
+		if ports == current {
+			logrus.Infof("The ports are already set to %d and %d, there is nothing to change.", ports.AdminConsole, ports.LocalArtifactMirror)
+			return nil
+		}
+		if ports.AdminConsole != current.AdminConsole {
+			if err := checkPortAvailable(ports.AdminConsole); err != nil {
+				return err
+			}
+		}
+		if ports.LocalArtifactMirror != current.LocalArtifactMirror {
+			if err := checkPortAvailable(ports.LocalArtifactMirror); err != nil {
+				return err
+			}
+		}
+
+		logrus.Infof("Admin Console port:          %d -> %d", current.AdminConsole, ports.AdminConsole)
+		logrus.Infof("Local Artifact Mirror port:  %d -> %d", current.LocalArtifactMirror, ports.LocalArtifactMirror)
+		logrus.Warnf("The Admin Console and the Local Artifact Mirror are restarted.")
+		if !c.Bool("no-prompt") && !prompts.New().Confirm("Do you want to continue?", false) {
+			return ErrNothingElseToAdd
+		}
+
+		if err := applyHostPorts(c, ports); err != nil {
+			return err
+		}
+
+		loading := spinner.Start()
+		loading.Infof("Updating the Admin Console")
+		if in.Spec.AdminConsole == nil {
+			in.Spec.AdminConsole = &ecv1beta1.AdminConsoleSpec{}
+		}
+		in.Spec.AdminConsole.Port = ports.AdminConsole
+		if in.Spec.LocalArtifactMirror == nil {
+			in.Spec.LocalArtifactMirror = &ecv1beta1.LocalArtifactMirrorSpec{}
+		}
+		in.Spec.LocalArtifactMirror.Port = ports.LocalArtifactMirror
+		if err := kcli.Update(c.Context, in); err != nil {
+			loading.CloseWithError()
+			return fmt.Errorf("unable to update installation: %w", err)
+		}
+		if err := kubeutils.WaitForInstallation(c.Context, kcli, loading); err != nil {
+			loading.CloseWithError()
+			return fmt.Errorf("unable to wait for installation: %w", err)
+		}
+		loading.Infof("Admin Console available on port %d", ports.AdminConsole)
+		loading.Close()
+
+		var nodes corev1.NodeList
+		if err := kcli.List(c.Context, &nodes); err != nil {
+			return fmt.Errorf("unable to list nodes: %w", err)
+		}
+		if others := len(nodes.Items) - 1; others > 0 {
+			logrus.Infof("Run the following command on the other %d nodes of the cluster:", others)
+			logrus.Infof(
+				"  sudo ./%s config set-ports --host-only --admin-console-port %d --local-artifact-mirror-port %d",
+				binName, ports.AdminConsole, ports.LocalArtifactMirror,
+			)
+		}
+		return nil
+	},
+}
+
+// installationPorts returns the ports the installation is configured with.
+func installationPorts(spec ecv1beta1.InstallationSpec) clusterPorts {
+	ports := clusterPorts{
+		AdminConsole:        defaults.AdminConsolePort,
+		LocalArtifactMirror: defaults.LocalArtifactMirrorPort,
+	}
+	if spec.AdminConsole != nil && spec.AdminConsole.Port > 0 {
+		ports.AdminConsole = spec.AdminConsole.Port
+	}
+	if spec.LocalArtifactMirror != nil && spec.LocalArtifactMirror.Port > 0 {
+		ports.LocalArtifactMirror = spec.LocalArtifactMirror.Port
+	}
+	return ports
+}
+
+// portsFromSetPortsFlags returns the ports set by the flags, the ones not set are kept
+// from the current ports.
+func portsFromSetPortsFlags(c *cli.Context, current clusterPorts) (clusterPorts, error) {
+	ports := current
+	if c.IsSet("admin-console-port") {
+		port, err := k8snet.ParsePort(c.String("admin-console-port"), false)
+		if err != nil {
+			return ports, fmt.Errorf("invalid admin console port: %w", err)
+		}
+		ports.AdminConsole = port
+	}
+	if c.IsSet("local-artifact-mirror-port") {
+		port, err := k8snet.ParsePort(c.String("local-artifact-mirror-port"), false)
+		if err != nil {
+			return ports, fmt.Errorf("invalid local artifact mirror port: %w", err)
+		}
+		ports.LocalArtifactMirror = port
+	}
+	if ports.AdminConsole == ports.LocalArtifactMirror {
+		return ports, fmt.Errorf("local artifact mirror port cannot be the same as admin console port")
+	}
+	return ports, nil
+}
+
+// checkPortAvailable returns an error if the port is already in use on this node.
+func checkPortAvailable(port int) error {
+	ln, err := net.Listen("tcp", net.JoinHostPort("", strconv.Itoa(port)))
+	if err != nil {
+		return fmt.Errorf("port %d is already in use on this node", port)
+	}
+	return ln.Close()
+}
+
+// applyHostPorts opens the ports in the host firewall, if it was configured at install or
+// join, and restarts the local artifact mirror of this node on its new port.
+func applyHostPorts(c *cli.Context, ports clusterPorts) error {
+	unit := k0sUnit()
+	if firewall.Configured(unit) {
+		required := firewall.RequiredPorts(ports.AdminConsole, ports.LocalArtifactMirror)
+		// the firewalld zone the ports were opened in at install or join is kept.
+		if _, err := firewall.Configure(c.Context, required, unit, ""); err != nil {
+			return fmt.Errorf("unable to update the firewall: %w", err)
+		}
+	}
+
+	data, err := os.ReadFile(hostconfig.LocalArtifactMirrorDropInPath)
+	if err != nil {
+		return fmt.Errorf("unable to read local artifact mirror configuration: %w", err)
+	}
+	data = setLocalArtifactMirrorPort(data, ports.LocalArtifactMirror)
+	if err := os.WriteFile(hostconfig.LocalArtifactMirrorDropInPath, data, 0644); err != nil {
+		return fmt.Errorf("unable to write local artifact mirror configuration: %w", err)
+	}
+	if _, err := helpers.RunCommand("systemctl", "daemon-reload"); err != nil {
+		return fmt.Errorf("unable to reload systemctl daemon: %w", err)
+	}
+	if _, err := helpers.RunCommand("systemctl", "restart", "local-artifact-mirror"); err != nil {
+		return fmt.Errorf("unable to restart the local artifact mirror: %w", err)
+	}
+	return nil
+}
+
+// setLocalArtifactMirrorPort changes the port in the local artifact mirror drop-in,
+// keeping its other settings.
+func setLocalArtifactMirrorPort(dropin []byte, port int) []byte {
+	return lamPortEnvRegex.ReplaceAll(dropin, []byte(fmt.Sprintf("LOCAL_ARTIFACT_MIRROR_PORT=%d", port)))
+}
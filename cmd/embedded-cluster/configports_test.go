@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"testing"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestPortsFromSetPortsFlags(t *testing.T) {
+	current := installationPorts(ecv1beta1.InstallationSpec{
+		AdminConsole: &ecv1beta1.AdminConsoleSpec{Port: 30001},
+	})
+	assert.Equal(t, clusterPorts{AdminConsole: 30001, LocalArtifactMirror: 50000}, current)
+
+	for _, tt := range []struct {
+		name    string
+		args    []string
+		want    clusterPorts
+		wantErr string
+	}{
+		{
+			name: "admin console port only",
+			args: []string{"--admin-console-port", "30005"},
+			want: clusterPorts{AdminConsole: 30005, LocalArtifactMirror: 50000},
+		},
+		{
+			name: "both ports",
+			args: []string{"--admin-console-port", "30005", "--local-artifact-mirror-port", "50005"},
+			want: clusterPorts{AdminConsole: 30005, LocalArtifactMirror: 50005},
+		},
+		{
+			name:    "invalid port",
+			args:    []string{"--local-artifact-mirror-port", "70000"},
+			wantErr: "invalid local artifact mirror port",
+		},
+		{
+			name:    "same ports",
+			args:    []string{"--local-artifact-mirror-port", "30001"},
+			wantErr: "local artifact mirror port cannot be the same as admin console port",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			flagSet := flag.NewFlagSet("test", 0)
+			for _, f := range configSetPortsCommand.Flags {
+				f.Apply(flagSet)
+			}
+			require.NoError(t, flagSet.Parse(tt.args))
+			c := cli.NewContext(cli.NewApp(), flagSet, nil)
+			got, err := portsFromSetPortsFlags(c, current)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSetLocalArtifactMirrorPort(t *testing.T) {
+	dropin := "[Service]\nEnvironment=\"LOCAL_ARTIFACT_MIRROR_PORT=50000\"\nEnvironment=\"LOCAL_ARTIFACT_MIRROR_DISK_QUOTA=10Gi\""
+	assert.Equal(t,
+		"[Service]\nEnvironment=\"LOCAL_ARTIFACT_MIRROR_PORT=50005\"\nEnvironment=\"LOCAL_ARTIFACT_MIRROR_DISK_QUOTA=10Gi\"",
+		string(setLocalArtifactMirrorPort([]byte(dropin), 50005)),
+	)
+}
+
+func TestCheckPortAvailable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+	assert.EqualError(t, checkPortAvailable(port), fmt.Sprintf("port %d is already in use on this node", port))
+}
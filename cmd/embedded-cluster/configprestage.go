@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/prestage"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
+)
+
+var configSetPrestageCommand = &cli.Command{
+	Name:  "set-prestage",
+	Usage: "Download the artifacts of the next release on all nodes ahead of its upgrade",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "version",
+			Usage: "Embedded cluster version whose artifacts are downloaded, keeps the current one if not set",
+		},
+		&cli.StringFlag{
+			Name:  "window",
+			Usage: "Daily window, in UTC and the HH:MM-HH:MM format, the downloads start in. Set to an empty string to start them at any time. Keeps the current one if not set",
+		},
+		&cli.BoolFlag{
+			Name:  "cancel",
+			Usage: "Stop downloading the artifacts of the next release, the window is kept",
+		},
+	},
+	Before: func(c *cli.Context) error {
+		if err := privileges.Check("config set-prestage", hostPrivileges()...); err != nil {
+			return err
+		}
+		if !c.IsSet("version") && !c.IsSet("window") && !c.Bool("cancel") {
+			return fmt.Errorf("at least one of --version, --window or --cancel must be set")
+		}
+		if c.IsSet("version") && c.Bool("cancel") {
+			return fmt.Errorf("--version and --cancel can not be set together")
+		}
+		if _, err := os.Stat(defaults.PathToKubeConfig()); err != nil {
+			return fmt.Errorf("config set-prestage must be run on a controller node")
+		}
+		os.Setenv("KUBECONFIG", defaults.PathToKubeConfig())
+		return nil
+	},
+	Action: func(c *cli.Context) error {
+		kcli, err := kubeutils.KubeClient()
+		if err != nil {
+			return fmt.Errorf("unable to create kube client: %w", err)
+		}
+		in, err := kubeutils.GetLatestInstallation(c.Context, kcli)
+		if err != nil {
+			return fmt.Errorf("unable to get latest installation: %w", err)
+		}
+		if in.Spec.AirGap {
+			return fmt.Errorf("artifacts are only prestaged for online installations, air gap installations read them from the bundle")
+		}
+		spec, err := prestageFromFlags(c, in.Spec.Prestage)
+		if err != nil {
+			return err
+		}
+		in.Spec.Prestage = spec
+		if err := kcli.Update(c.Context, in); err != nil {
+			return fmt.Errorf("unable to update installation: %w", err)
+		}
+
+		switch {
+		case spec.Version == "":
+			logrus.Info("No artifacts will be prestaged.")
+		case spec.Window == "":
+			logrus.Infof("The artifacts of version %s are being downloaded on all nodes.", spec.Version)
+		default:
+			logrus.Infof("The artifacts of version %s will be downloaded on all nodes during the %s UTC window.", spec.Version, spec.Window)
+		}
+		return nil
+	},
+}
+
+// prestageFromFlags returns the prestage configuration set by the flags, the settings not
+// set are kept from the current configuration.
+func prestageFromFlags(c *cli.Context, current *ecv1beta1.PrestageSpec) (*ecv1beta1.PrestageSpec, error) {
+	spec := &ecv1beta1.PrestageSpec{}
+	if current != nil {
+		spec = current.DeepCopy()
+	}
+	if c.IsSet("version") {
+		if c.String("version") == "" {
+			return nil, fmt.Errorf("version can not be empty, use --cancel to stop prestaging")
+		}
+		spec.Version = c.String("version")
+	}
+	if c.Bool("cancel") {
+		spec.Version = ""
+	}
+	if c.IsSet("window") {
+		if _, err := prestage.ParseWindow(c.String("window")); err != nil {
+			return nil, err
+		}
+		spec.Window = c.String("window")
+	}
+	return spec, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"testing"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestPrestageFromFlags(t *testing.T) {
+	current := &ecv1beta1.PrestageSpec{Version: "1.1.0", Window: "22:00-06:00"}
+
+	for _, tt := range []struct {
+		name    string
+		current *ecv1beta1.PrestageSpec
+		args    []string
+		want    *ecv1beta1.PrestageSpec
+		wantErr string
+	}{
+		{
+			name: "version without a current configuration",
+			args: []string{"--version", "1.2.0"},
+			want: &ecv1beta1.PrestageSpec{Version: "1.2.0"},
+		},
+		{
+			name:    "version keeps the window",
+			current: current,
+			args:    []string{"--version", "1.2.0"},
+			want:    &ecv1beta1.PrestageSpec{Version: "1.2.0", Window: "22:00-06:00"},
+		},
+		{
+			name:    "window keeps the version",
+			current: current,
+			args:    []string{"--window", "01:00-03:00"},
+			want:    &ecv1beta1.PrestageSpec{Version: "1.1.0", Window: "01:00-03:00"},
+		},
+		{
+			name:    "empty window",
+			current: current,
+			args:    []string{"--window", ""},
+			want:    &ecv1beta1.PrestageSpec{Version: "1.1.0"},
+		},
+		{
+			name:    "cancel keeps the window",
+			current: current,
+			args:    []string{"--cancel"},
+			want:    &ecv1beta1.PrestageSpec{Window: "22:00-06:00"},
+		},
+		{
+			name:    "invalid window",
+			args:    []string{"--window", "22:00"},
+			wantErr: `invalid window "22:00"`,
+		},
+		{
+			name:    "empty version",
+			args:    []string{"--version", ""},
+			wantErr: "version can not be empty",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			flagSet := flag.NewFlagSet("test", 0)
+			for _, f := range configSetPrestageCommand.Flags {
+				f.Apply(flagSet)
+			}
+			require.NoError(t, flagSet.Parse(tt.args))
+			c := cli.NewContext(cli.NewApp(), flagSet, nil)
+			got, err := prestageFromFlags(c, tt.current)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	assert.Equal(t, "1.1.0", current.Version, "the current configuration is not modified")
+}
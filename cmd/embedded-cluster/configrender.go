@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jedib0t/go-pretty/v6/table"
+	k0sconfig "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/charts"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/release"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/metrics"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
+	"github.com/replicatedhq/embedded-cluster/pkg/rendersnapshot"
+	"github.com/replicatedhq/embedded-cluster/pkg/versions"
+)
+
+// renderSnapshotSecretFlags are the flags never recorded in the render snapshots.
+var renderSnapshotSecretFlags = []string{"admin-console-password"}
+
+// renderReplayFileFlags are the flags pointing to files. They are only replayed if the
+// file is still found at the same path.
+var renderReplayFileFlags = []string{"install-config", "private-ca", "tls-cert", "tls-key", "airgap-registry-auth"}
+
+// renderReplaySkippedFlags are the flags replayed from somewhere else: the overrides are
+// stored in the snapshot, the license is provided with --license and the proxy is read
+// from the installation.
+var renderReplaySkippedFlags = []string{"overrides", "license", "http-proxy", "https-proxy", "no-proxy"}
+
+var configRenderCommand = &cli.Command{
+	Name:  "render",
+	Usage: "Replay the rendering of the k0s configuration and of the helm values in use at a given time, and check it matches what was recorded",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "at",
+			Usage: "Time the configuration was in use, in RFC3339 format (e.g. 2024-05-01T10:00:00Z). Defaults to now",
+		},
+		&cli.BoolFlag{
+			Name:  "list",
+			Usage: "List the recorded renderings instead of replaying one",
+		},
+		&cli.StringFlag{
+			Name:    "license",
+			Aliases: []string{"l"},
+			Usage:   "Path to the license file the cluster was installed with, required to replay an installation with a license",
+		},
+		&cli.StringFlag{
+			Name:  "output-dir",
+			Usage: "Directory k0s.yaml and the values of each chart, under values/, are written to instead of stdout",
+		},
+	},
+	Before: func(c *cli.Context) error {
+		if err := privileges.Check("config render", hostPrivileges()...); err != nil {
+			return err
+		}
+		if _, err := os.Stat(defaults.PathToKubeConfig()); err != nil {
+			return fmt.Errorf("config render must be run on a controller node")
+		}
+		os.Setenv("KUBECONFIG", defaults.PathToKubeConfig())
+		return nil
+	},
+	Action: func(c *cli.Context) error {
+		// stdout only holds the configuration, everything else is written to stderr.
+		stdout := os.Stdout
+		os.Stdout = os.Stderr
+		defer func() { os.Stdout = stdout }()
+
+		kcli, err := kubeutils.KubeClient()
+		if err != nil {
+			return fmt.Errorf("unable to create kube client: %w", err)
+		}
+		snapshots, err := rendersnapshot.List(c.Context, kcli)
+		if err != nil {
+			return err
+		}
+		if len(snapshots) == 0 {
+			return fmt.Errorf("no rendering of the configuration was recorded in this cluster")
+		}
+		if c.Bool("list") {
+			fmt.Fprintf(stdout, "%s\n", renderSnapshotsTable(snapshots))
+			return nil
+		}
+
+		at := time.Now()
+		if value := c.String("at"); value != "" {
+			if at, err = time.Parse(time.RFC3339, value); err != nil {
+				return fmt.Errorf("invalid time %q, use the RFC3339 format: %w", value, err)
+			}
+		}
+		snap, err := rendersnapshot.At(snapshots, at)
+		if err != nil {
+			return err
+		}
+		logrus.Infof("Replaying the %s rendering of version %s recorded at %s.", snap.Source, snap.Version, snap.Time.UTC().Format(time.RFC3339))
+
+		var cfg *k0sconfig.ClusterConfig
+		switch snap.Source {
+		case rendersnapshot.SourceInstall:
+			cfg, err = replayInstallRender(c, kcli, *snap)
+		case rendersnapshot.SourceUpgrade:
+			cfg, err = replayUpgradeRender(c.Context, kcli, *snap)
+		default:
+			err = fmt.Errorf("unable to replay a rendering from %s", snap.Source)
+		}
+		if err != nil {
+			return err
+		}
+
+		var replay rendersnapshot.Snapshot
+		if err := replay.SetOutputs(cfg); err != nil {
+			return err
+		}
+		if diff := snap.Diff(replay); len(diff) > 0 {
+			logrus.Warnf("The replay does not match the recorded rendering, these differ: %s.", strings.Join(diff, ", "))
+		} else {
+			logrus.Infof("The replay matches the recorded rendering.")
+		}
+
+		if dir := c.String("output-dir"); dir != "" {
+			return writeRenderedConfig(dir, cfg)
+		}
+		return printRenderedConfig(stdout, cfg)
+	},
+}
+
+// renderSnapshotsTable returns a table with the recorded renderings.
+func renderSnapshotsTable(snapshots []rendersnapshot.Snapshot) string {
+	writer := table.NewWriter()
+	writer.AppendHeader(table.Row{"time", "source", "version", "installation"})
+	for _, snap := range snapshots {
+		writer.AppendRow(table.Row{snap.Time.UTC().Format(time.RFC3339), snap.Source, snap.Version, snap.Installation})
+	}
+	return writer.Render()
+}
+
+// recordRenderSnapshot records the inputs of the rendering of the k0s configuration the
+// cluster was installed with, and a hash of it, so support can reproduce it. Failing to
+// do so does not fail the installation.
+func recordRenderSnapshot(c *cli.Context, cfg *k0sconfig.ClusterConfig) {
+	kcli, err := kubeutils.KubeClient()
+	if err != nil {
+		logrus.Warnf("Unable to create kube client, the rendered configuration is not recorded: %v", err)
+		return
+	}
+	snap, err := installRenderSnapshot(c, cfg)
+	if err != nil {
+		logrus.Warnf("Unable to record the rendered configuration: %v", err)
+		return
+	}
+	if in, err := kubeutils.GetLatestInstallation(c.Context, kcli); err != nil {
+		logrus.Debugf("unable to get the installation: %v", err)
+	} else {
+		snap.Installation = in.Name
+	}
+	if err := rendersnapshot.Record(c.Context, kcli, *snap); err != nil {
+		logrus.Warnf("Unable to record the rendered configuration: %v", err)
+	}
+}
+
+// installRenderSnapshot returns the snapshot of the rendering of the k0s configuration
+// by the install command.
+func installRenderSnapshot(c *cli.Context, cfg *k0sconfig.ClusterConfig) (*rendersnapshot.Snapshot, error) {
+	snap := &rendersnapshot.Snapshot{
+		Time:    metav1.Now(),
+		Source:  rendersnapshot.SourceInstall,
+		Version: versions.Version,
+		Flags:   renderSnapshotFlags(c),
+		Address: cfg.Spec.API.Address,
+	}
+	if path := c.String("overrides"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read overrides file: %w", err)
+		}
+		snap.Overrides = string(data)
+	}
+	if path := c.String("license"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read license file: %w", err)
+		}
+		snap.LicenseChecksum = rendersnapshot.Hash(data)
+	}
+	if err := snap.SetOutputs(cfg); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// renderSnapshotFlags returns the flags set on the command, by name. Secrets are left out
+// and the credentials of the proxies are redacted.
+func renderSnapshotFlags(c *cli.Context) map[string]string {
+	flags := map[string]string{}
+	for _, f := range c.Command.Flags {
+		name := f.Names()[0]
+		if !c.IsSet(name) || slices.Contains(renderSnapshotSecretFlags, name) {
+			continue
+		}
+		if _, ok := f.(*cli.StringSliceFlag); ok {
+			flags[name] = strings.Join(c.StringSlice(name), ",")
+			continue
+		}
+		flags[name] = fmt.Sprint(c.Value(name))
+	}
+	for _, name := range []string{"http-proxy", "https-proxy"} {
+		if u, err := url.Parse(flags[name]); err == nil && u.User != nil {
+			flags[name] = u.Redacted()
+		}
+	}
+	return flags
+}
+
+// replayInstallRender renders the k0s configuration again from the inputs recorded by the
+// install command.
+func replayInstallRender(c *cli.Context, kcli client.Client, snap rendersnapshot.Snapshot) (*k0sconfig.ClusterConfig, error) {
+	if snap.Version != versions.Version {
+		logrus.Warnf("The configuration was rendered by version %s, this is version %s. Use the binary of version %s to reproduce it.", snap.Version, versions.Version, snap.Version)
+	}
+	in, err := renderSnapshotInstallation(c.Context, kcli, snap)
+	if err != nil {
+		return nil, err
+	}
+	if id, err := uuid.Parse(in.Spec.ClusterID); err == nil {
+		metrics.SetClusterID(id)
+	}
+
+	dir, err := os.MkdirTemp("", "config-render-*")
+	if err != nil {
+		return nil, fmt.Errorf("unable to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	rc, err := renderReplayContext(c, snap, dir)
+	if err != nil {
+		return nil, err
+	}
+	applier, err := getAddonsApplier(rc, "", in.Spec.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	return renderK0sConfigForAddress(rc, applier, snap.Address)
+}
+
+// renderReplayContext returns a context of the install command with the flags recorded
+// in the snapshot. The overrides are written to dir.
+func renderReplayContext(c *cli.Context, snap rendersnapshot.Snapshot, dir string) (*cli.Context, error) {
+	set := flag.NewFlagSet(installCommand.Name, flag.ContinueOnError)
+	flags := map[string]cli.Flag{}
+	for _, f := range installCommand.Flags {
+		if err := f.Apply(set); err != nil {
+			return nil, fmt.Errorf("unable to apply flag %s: %w", f.Names()[0], err)
+		}
+		flags[f.Names()[0]] = f
+	}
+
+	for name, value := range snap.Flags {
+		if slices.Contains(renderReplaySkippedFlags, name) {
+			continue
+		}
+		f, ok := flags[name]
+		if !ok {
+			logrus.Warnf("Flag --%s is not known by this version, it is not replayed.", name)
+			continue
+		}
+		values := []string{value}
+		if _, ok := f.(*cli.StringSliceFlag); ok {
+			values = strings.Split(value, ",")
+		}
+		if slices.Contains(renderReplayFileFlags, name) && !filesExist(values) {
+			logrus.Warnf("The file of flag --%s was not found, it is not replayed.", name)
+			continue
+		}
+		for _, value := range values {
+			if err := set.Set(name, value); err != nil {
+				return nil, fmt.Errorf("unable to set flag %s: %w", name, err)
+			}
+		}
+	}
+
+	if snap.Overrides != "" {
+		path := filepath.Join(dir, "overrides.yaml")
+		if err := os.WriteFile(path, []byte(snap.Overrides), 0600); err != nil {
+			return nil, fmt.Errorf("unable to write overrides file: %w", err)
+		}
+		if err := set.Set("overrides", path); err != nil {
+			return nil, fmt.Errorf("unable to set flag overrides: %w", err)
+		}
+	}
+
+	if snap.LicenseChecksum != "" {
+		path := c.String("license")
+		if path == "" {
+			return nil, fmt.Errorf("the cluster was installed with a license, provide it with --license")
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read license file: %w", err)
+		}
+		if rendersnapshot.Hash(data) != snap.LicenseChecksum {
+			return nil, fmt.Errorf("the license %s is not the one the cluster was installed with", path)
+		}
+		if err := set.Set("license", path); err != nil {
+			return nil, fmt.Errorf("unable to set flag license: %w", err)
+		}
+	}
+
+	rc := cli.NewContext(c.App, set, nil)
+	rc.Context = c.Context
+	return rc, nil
+}
+
+// filesExist returns true if all the paths exist.
+func filesExist(paths []string) bool {
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// replayUpgradeRender renders the values of the charts again from the installation the
+// operator rendered them from. The values are returned in the current k0s configuration.
+func replayUpgradeRender(ctx context.Context, kcli client.Client, snap rendersnapshot.Snapshot) (*k0sconfig.ClusterConfig, error) {
+	in, err := renderSnapshotInstallation(ctx, kcli, snap)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := release.MetadataFor(ctx, in, kcli)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the metadata of version %s: %w", in.Spec.Config.Version, err)
+	}
+	var clusterConfig k0sconfig.ClusterConfig
+	if err := kcli.Get(ctx, client.ObjectKey{Name: "k0s", Namespace: "kube-system"}, &clusterConfig); err != nil {
+		return nil, fmt.Errorf("unable to get cluster config: %w", err)
+	}
+	helm, err := charts.K0sHelmExtensionsFromInstallation(ctx, in, meta, &clusterConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to render the helm charts: %w", err)
+	}
+	exts, err := ecv1beta1.ConvertTo(*helm, &k0sconfig.HelmExtensions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to convert chart types: %w", err)
+	}
+
+	cfg := &k0sconfig.ClusterConfig{
+		TypeMeta:   clusterConfig.TypeMeta,
+		ObjectMeta: metav1.ObjectMeta{Name: clusterConfig.Name, Namespace: clusterConfig.Namespace},
+		Spec:       clusterConfig.Spec,
+	}
+	if cfg.Spec == nil {
+		cfg.Spec = &k0sconfig.ClusterSpec{}
+	}
+	if cfg.Spec.Extensions == nil {
+		cfg.Spec.Extensions = &k0sconfig.ClusterExtensions{}
+	}
+	cfg.Spec.Extensions.Helm = exts
+	return cfg, nil
+}
+
+// renderSnapshotInstallation returns the installation the snapshot was taken with, the
+// latest one if it is not known or no longer exists.
+func renderSnapshotInstallation(ctx context.Context, kcli client.Client, snap rendersnapshot.Snapshot) (*ecv1beta1.Installation, error) {
+	if snap.Installation != "" {
+		var in ecv1beta1.Installation
+		err := kcli.Get(ctx, client.ObjectKey{Name: snap.Installation}, &in)
+		if err == nil {
+			return &in, nil
+		} else if !k8serrors.IsNotFound(err) {
+			return nil, fmt.Errorf("unable to get installation %s: %w", snap.Installation, err)
+		}
+		logrus.Warnf("Installation %s no longer exists, the latest installation is used instead.", snap.Installation)
+	}
+	in, err := kubeutils.GetLatestInstallation(ctx, kcli)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get latest installation: %w", err)
+	}
+	return in, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/devcluster"
+)
+
+var devCommands = &cli.Command{
+	Name:  "dev",
+	Usage: "Run a throwaway single node cluster in a docker or podman container, for development",
+	Subcommands: []*cli.Command{
+		devUpCommand,
+		devDownCommand,
+	},
+}
+
+// withDevClusterFlags adds the flags selecting the dev cluster and its runtime.
+func withDevClusterFlags(flags []cli.Flag) []cli.Flag {
+	return append(flags,
+		&cli.StringFlag{
+			Name:  "name",
+			Usage: "Name of the dev cluster container",
+			Value: fmt.Sprintf("%s-dev", binName),
+		},
+		&cli.StringFlag{
+			Name:  "runtime",
+			Usage: "Container runtime, docker or podman. Defaults to the first one found.",
+		},
+	)
+}
+
+func validateDevRuntime(c *cli.Context) error {
+	if rt := c.String("runtime"); rt != "" && rt != "docker" && rt != "podman" {
+		return fmt.Errorf("invalid runtime %q, must be one of docker or podman", rt)
+	}
+	return nil
+}
+
+var devUpCommand = &cli.Command{
+	Name:  "up",
+	Usage: "Install a dev cluster in a new container, the host itself is left untouched",
+	Flags: withDevClusterFlags([]cli.Flag{
+		&cli.StringFlag{
+			Name:     "license",
+			Aliases:  []string{"l"},
+			Usage:    "Path to the license file",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "image",
+			Usage: "Image of the container, it must run systemd",
+			Value: devcluster.DefaultImage,
+		},
+		&cli.IntFlag{
+			Name:  "admin-console-port",
+			Usage: "Port the Admin Console is published on",
+			Value: defaults.AdminConsolePort,
+		},
+		&cli.BoolFlag{
+			Name:  "skip-host-preflights",
+			Usage: "Skip the host preflight checks in the container.",
+		},
+	}),
+	Before: func(c *cli.Context) error {
+		if err := validateDevRuntime(c); err != nil {
+			return err
+		}
+		if _, err := os.Stat(c.String("license")); err != nil {
+			return fmt.Errorf("unable to read license: %w", err)
+		}
+		return nil
+	},
+	Action: func(c *cli.Context) error {
+		rt, err := devcluster.FindRuntime(c.String("runtime"))
+		if err != nil {
+			return err
+		}
+		binary, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("unable to get executable path: %w", err)
+		}
+		opts := devcluster.Options{
+			Name:             c.String("name"),
+			Image:            c.String("image"),
+			Binary:           binary,
+			License:          c.String("license"),
+			AdminConsolePort: c.Int("admin-console-port"),
+		}
+		if c.Bool("skip-host-preflights") {
+			opts.InstallArgs = append(opts.InstallArgs, "--skip-host-preflights")
+		}
+		logrus.Infof("Starting dev cluster %s", opts.Name)
+		if err := rt.Up(opts); err != nil {
+			logrus.Infof("Inspect the container with %s exec -it %s bash, remove it with %s dev down.", rt.Bin, opts.Name, binName)
+			return err
+		}
+		logrus.Infof("Dev cluster %s is up, the Admin Console is at http://localhost:%d.", opts.Name, opts.AdminConsolePort)
+		logrus.Infof("Open a shell in it with %s exec -it %s /ec/bin/%s shell.", rt.Bin, opts.Name, binName)
+		return nil
+	},
+}
+
+var devDownCommand = &cli.Command{
+	Name:   "down",
+	Usage:  "Remove a dev cluster with its container",
+	Flags:  withDevClusterFlags(nil),
+	Before: validateDevRuntime,
+	Action: func(c *cli.Context) error {
+		rt, err := devcluster.FindRuntime(c.String("runtime"))
+		if err != nil {
+			return err
+		}
+		name := c.String("name")
+		if err := rt.Down(name); err != nil {
+			return err
+		}
+		logrus.Infof("Dev cluster %s removed.", name)
+		return nil
+	},
+}
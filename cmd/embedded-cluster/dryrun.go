@@ -0,0 +1,285 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/conntrack"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/etcdsnapshot"
+	"github.com/replicatedhq/embedded-cluster/pkg/firewall"
+	"github.com/replicatedhq/embedded-cluster/pkg/goods"
+	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/localvolumes"
+	"github.com/replicatedhq/embedded-cluster/pkg/prereqs"
+	"github.com/replicatedhq/embedded-cluster/pkg/selinux"
+	"github.com/replicatedhq/embedded-cluster/pkg/timesync"
+	"github.com/replicatedhq/embedded-cluster/pkg/watchdog"
+)
+
+// runJoinDryRun runs the host preflights and prints the changes the join command would
+// make to the host. The join command has already been fetched and validated against
+// this binary and the host network configuration. The files needed to run the host
+// preflights are materialized in a temporary directory, nothing is changed on the host.
+func runJoinDryRun(h *joinHost) error {
+	if len(h.state.MissingPrereqs) > 0 && !h.c.Bool("install-prereqs") {
+		names := strings.Join(prereqs.Names(h.state.MissingPrereqs), ", ")
+		logrus.Warnf("The following prerequisites are missing: %s. Use --install-prereqs to install them.", names)
+	}
+
+	// the changes are listed before the home directory is moved so they point to the
+	// locations used by the join.
+	changes := joinStepDescriptions(h.preflightSteps(), h.hostSteps())
+	if err := withTemporaryHome(func() error {
+		// the air gap images are imported from outside the home directory, they are not
+		// materialized and the space needed to import them is not checked.
+		if err := h.materializeFiles(false); err != nil {
+			return err
+		}
+		_, err := h.runHostPreflights()
+		return err
+	}); err != nil {
+		if errors.Is(err, ErrPreflightsHaveFail) {
+			return errPreflightsReported
+		}
+		return err
+	}
+
+	printJoinDryRun(changes)
+	return nil
+}
+
+// withTemporaryHome runs fn with the embedded cluster home directory, where the files
+// are materialized, moved to a temporary directory removed once fn returns.
+func withTemporaryHome(fn func() error) error {
+	tmpdir, err := os.MkdirTemp("", "embedded-cluster-dry-run-")
+	if err != nil {
+		return fmt.Errorf("unable to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	previous := defaults.DefaultProvider
+	defaults.DefaultProvider = defaults.NewProvider(tmpdir)
+	goods.UseBaseDir(tmpdir)
+	defer func() {
+		defaults.DefaultProvider = previous
+		goods.UseBaseDir(previous.Base)
+	}()
+	return fn()
+}
+
+// joinHostState holds the parts of the host state that determine the changes a join
+// makes to the host.
+type joinHostState struct {
+	Distro           prereqs.Distro
+	MissingPrereqs   []prereqs.Prereq
+	NetworkManager   bool
+	Firewall         firewall.Backend
+	SELinuxEnforcing bool
+	TimeSyncService  string
+}
+
+// detectJoinHostState inspects the host without changing it.
+func detectJoinHostState(c *cli.Context) joinHostState {
+	state := joinHostState{
+		Firewall:         firewall.Detect(c.Context),
+		SELinuxEnforcing: selinux.Enforcing(),
+		TimeSyncService:  timesync.ActiveService(c.Context),
+	}
+	if active, err := helpers.IsSystemdServiceActive(c.Context, "NetworkManager"); err == nil {
+		state.NetworkManager = active
+	}
+	if distro, err := prereqs.DetectDistro(); err != nil {
+		logrus.Debugf("unable to detect distribution: %v", err)
+	} else {
+		state.Distro = distro
+		state.MissingPrereqs = prereqs.Missing(distro)
+	}
+	return state
+}
+
+// printJoinDryRun prints the changes the join command would make to the host.
+func printJoinDryRun(changes []string) {
+	logrus.Info("")
+	logrus.Info("Dry run complete, no changes were made to the host. Joining would:")
+	logrus.Info("")
+	for i, change := range changes {
+		logrus.Infof("  %d. %s", i+1, change)
+	}
+	logrus.Info("")
+}
+
+// runResetDryRun runs the reset safety checks and prints what the reset command would
+// remove from the host, nothing is changed. Failed checks are reported as warnings.
+func runResetDryRun(c *cli.Context) error {
+	currentHost, err := newHostInfo(c)
+	if err != nil {
+		logrus.Warnf("Unable to get the k0s status of this node, it may not be running: %v", err)
+	}
+	if currentHost.Status.Role == "controller" {
+		safe, reason, err := currentHost.checkResetSafety(c)
+		switch {
+		case err != nil:
+			logrus.Warnf("Unable to check if resetting this node is safe: %v", err)
+		case !safe:
+			logrus.Warnf("The reset would be refused: %s", reason)
+			logrus.Warn("Run reset command with --force to ignore this.")
+		}
+	}
+	var numControllerNodes int
+	if currentHost.KclientError == nil {
+		numControllerNodes, _ = kubeutils.NumOfControlPlaneNodes(c.Context, currentHost.Kclient)
+	}
+	state := detectResetHostState(c, &currentHost)
+	if volumes, err := currentHost.localVolumesOnNode(c.Context); err != nil {
+		logrus.Warnf("Unable to find the persistent volumes stored on this node: %v", err)
+	} else if len(volumes) > 0 {
+		state.LocalVolumes = volumes
+		state.Backup = c.Bool("backup")
+		if !state.Backup && !c.Bool("force") {
+			logrus.Warn("This node holds the only copy of the data of persistent volumes, the reset would ask for confirmation.")
+			logrus.Warn("Run reset command with --backup to create a backup with Velero first.")
+		}
+	}
+	printResetDryRun(resetDryRunChanges(&currentHost, state, numControllerNodes))
+	return nil
+}
+
+// resetHostState holds the parts of the host state that determine what a reset removes.
+type resetHostState struct {
+	K0sUnit             string
+	DataDir             string
+	Containers          int
+	IptablesRules       int
+	LocalArtifactMirror bool
+	EtcdSnapshotTimer   bool
+	Watchdog            bool
+	Firewall            bool
+	// LocalVolumes holds the persistent volumes whose only copy is on the host.
+	LocalVolumes []localvolumes.Volume
+	// Backup tells if a backup is created before the volumes are deleted.
+	Backup bool
+	// Paths holds the files and directories removed that exist on the host.
+	Paths []string
+}
+
+// detectResetHostState inspects the host without changing it.
+func detectResetHostState(c *cli.Context, h *hostInfo) resetHostState {
+	state := resetHostState{
+		K0sUnit:             k0sUnit(),
+		DataDir:             h.Status.Vars.DataDir,
+		LocalArtifactMirror: pathExists(localArtifactMirrorUnitPath),
+		EtcdSnapshotTimer:   etcdsnapshot.TimerInstalled(),
+		Watchdog:            watchdog.Installed(),
+	}
+	if state.DataDir == "" {
+		state.DataDir = defaults.K0sDataDir
+	}
+	state.Firewall = firewall.Configured(state.K0sUnit)
+	out, err := exec.CommandContext(c.Context, k0s, "ctr", "--namespace", "k8s.io", "containers", "list", "--quiet").Output()
+	if err != nil {
+		logrus.Debugf("unable to list containers: %v", err)
+	} else {
+		state.Containers = len(strings.Fields(string(out)))
+	}
+	if out, err := exec.CommandContext(c.Context, "iptables-save").Output(); err != nil {
+		logrus.Debugf("unable to list iptables rules: %v", err)
+	} else {
+		state.IptablesRules = countClusterIptablesRules(string(out))
+	}
+	paths := append([]string{conntrack.SysctlPath, conntrack.ModprobePath, conntrack.ModulesLoadPath}, resetPaths()...)
+	for _, path := range paths {
+		if pathExists(path) {
+			state.Paths = append(state.Paths, path)
+		}
+	}
+	return state
+}
+
+// countClusterIptablesRules returns the number of rules created by kube-proxy and Calico
+// in the output of iptables-save.
+func countClusterIptablesRules(out string) int {
+	var count int
+	for _, line := range strings.Split(out, "\n") {
+		if !strings.HasPrefix(line, "-A ") {
+			continue
+		}
+		if strings.Contains(line, "KUBE-") || strings.Contains(line, "cali-") {
+			count++
+		}
+	}
+	return count
+}
+
+// resetDryRunChanges returns, in order, the changes the reset command would make to the
+// cluster and the host. The node is only drained and removed from the cluster when it is
+// not the only controller.
+func resetDryRunChanges(h *hostInfo, state resetHostState, numControllerNodes int) []string {
+	isController := h.Status.Role == "controller"
+	var changes []string
+	if state.Backup {
+		changes = append(changes, "Create a backup of the cluster and the application with Velero")
+	}
+	if !isController || numControllerNodes != 1 {
+		changes = append(changes, fmt.Sprintf("Run the pre-drain hooks, drain node %s and run the post-drain hooks", h.Hostname))
+		changes = append(changes, fmt.Sprintf("Delete the Node %s from the cluster", h.Hostname))
+		if isController {
+			changes = append(changes, fmt.Sprintf("Delete the ControlNode %s from the cluster", h.Hostname))
+			changes = append(changes, "Remove this node from the etcd cluster")
+		}
+	}
+	changes = append(changes, fmt.Sprintf("Stop the %s service and run k0s reset, removing %s", state.K0sUnit, state.DataDir))
+	if state.Containers > 0 {
+		changes = append(changes, fmt.Sprintf("Remove the %d containers run by k0s", state.Containers))
+	}
+	if state.IptablesRules > 0 {
+		changes = append(changes, fmt.Sprintf("Flush the %d iptables rules created by kube-proxy and Calico", state.IptablesRules))
+	}
+	if state.LocalArtifactMirror {
+		changes = append(changes, "Stop the local-artifact-mirror service")
+	}
+	if state.EtcdSnapshotTimer {
+		changes = append(changes, "Disable and remove the etcd snapshot timer")
+	}
+	if state.Watchdog {
+		changes = append(changes, "Disarm the watchdog and remove its timer")
+	}
+	if state.Firewall {
+		changes = append(changes, "Remove the firewall rules opening the cluster ports")
+	}
+	if len(state.LocalVolumes) > 0 {
+		var volumes []string
+		for _, volume := range state.LocalVolumes {
+			volumes = append(volumes, volume.String())
+		}
+		changes = append(changes, fmt.Sprintf("Delete the only copy of the persistent volumes %s", strings.Join(volumes, ", ")))
+	}
+	for _, path := range state.Paths {
+		changes = append(changes, fmt.Sprintf("Remove %s", path))
+	}
+	return append(changes, "Reboot the host")
+}
+
+// printResetDryRun prints the changes the reset command would make.
+func printResetDryRun(changes []string) {
+	logrus.Info("")
+	logrus.Info("Dry run complete, no changes were made. Resetting this node would:")
+	logrus.Info("")
+	for i, change := range changes {
+		logrus.Infof("  %d. %s", i+1, change)
+	}
+	logrus.Info("")
+}
+
+// pathExists returns true if a file or directory exists at path.
+func pathExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
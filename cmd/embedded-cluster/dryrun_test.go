@@ -0,0 +1,179 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/firewall"
+	"github.com/replicatedhq/embedded-cluster/pkg/localvolumes"
+	"github.com/replicatedhq/embedded-cluster/pkg/prereqs"
+)
+
+func TestJoinStepDescriptions(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		flags    map[string]string
+		jcmd     JoinCommandResponse
+		state    joinHostState
+		contains []string
+		excludes []string
+	}{
+		{
+			name: "worker with defaults",
+			jcmd: JoinCommandResponse{K0sJoinCommand: "/usr/local/bin/k0s install worker"},
+			state: joinHostState{
+				MissingPrereqs: []prereqs.Prereq{{Name: "tar"}},
+				Firewall:       firewall.NFTables,
+			},
+			contains: []string{
+				"Write the join token to /etc/k0s/join-token",
+				"install and start the local artifact mirror service on port 50000",
+				"Install and start the k0sworker service, joining the node as a worker",
+			},
+			excludes: []string{
+				"Install missing packages",
+				"Open ports",
+				"NetworkManager",
+				"SELinux",
+				"audit policy",
+				"high availability",
+				"Wait for the node to be ready",
+			},
+		},
+		{
+			name: "controller with host changes",
+			flags: map[string]string{
+				"install-prereqs":    "true",
+				"configure-firewall": "true",
+				"enable-chrony":      "true",
+				"enable-ha":          "true",
+				"encryption-config":  "/tmp/encryption.yaml",
+			},
+			jcmd: JoinCommandResponse{
+				K0sJoinCommand:        "/usr/local/bin/k0s install controller",
+				AirgapRegistryAddress: "10.96.0.11:5000",
+				InstallationSpec: ecv1beta1.InstallationSpec{
+					Proxy:            &ecv1beta1.ProxySpec{HTTPSProxy: "http://proxy:3128"},
+					EncryptionAtRest: true,
+					Hardening:        "cis",
+				},
+			},
+			state: joinHostState{
+				Distro:           prereqs.Distro{ID: "ubuntu", Family: prereqs.Debian},
+				MissingPrereqs:   []prereqs.Prereq{{Name: "tar"}},
+				NetworkManager:   true,
+				Firewall:         firewall.Firewalld,
+				SELinuxEnforcing: true,
+			},
+			contains: []string{
+				"Install missing packages: apt-get install -y tar",
+				"Enable and start chrony to synchronize the clock",
+				"Configure NetworkManager to ignore the Calico interfaces and restart it",
+				"Open ports 6443/tcp, 9443/tcp, 2380/tcp, 10250/tcp, 4789/udp, 30000/tcp, 50000/tcp using firewalld",
+				"Install the SELinux policy module and file contexts",
+				"Allow insecure access to the registry 10.96.0.11:5000 in containerd",
+				"to the k0scontroller service, configure its proxy",
+				"Copy /tmp/encryption.yaml to",
+				"Write the kube-apiserver audit policy to /etc/k0s/audit-policy.yaml",
+				"Install and start the k0scontroller service, joining the node as a controller",
+				"Wait for the node to be ready, and offer to enable high availability if this is the third controller",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			flagSet := flag.NewFlagSet("test", 0)
+			for _, flag := range joinCommand.Flags {
+				flag.Apply(flagSet)
+			}
+			for name, value := range tt.flags {
+				require.NoError(t, flagSet.Set(name, value))
+			}
+			c := cli.NewContext(cli.NewApp(), flagSet, nil)
+
+			h := &joinHost{c: c, jcmd: &tt.jcmd, state: tt.state, adminConsolePort: 30000, localArtifactMirrorPort: 50000}
+			changes := joinStepDescriptions(h.preflightSteps(), h.hostSteps())
+			for _, want := range tt.contains {
+				assert.True(t, containsChange(changes, want), "missing change %q in %v", want, changes)
+			}
+			for _, unwanted := range tt.excludes {
+				for _, change := range changes {
+					assert.NotContains(t, change, unwanted)
+				}
+			}
+		})
+	}
+}
+
+func containsChange(changes []string, want string) bool {
+	for _, change := range changes {
+		if strings.Contains(change, want) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestResetDryRunChanges(t *testing.T) {
+	state := resetHostState{
+		K0sUnit:             "k0scontroller",
+		DataDir:             "/var/lib/k0s",
+		Containers:          12,
+		IptablesRules:       40,
+		LocalArtifactMirror: true,
+		Watchdog:            true,
+		LocalVolumes:        []localvolumes.Volume{{Name: "pvc-a", Claim: "app/data", Capacity: "10Gi"}, {Name: "pvc-b"}},
+		Backup:              true,
+		Paths:               []string{"/var/lib/embedded-cluster", "/usr/local/bin/k0s"},
+	}
+	controller := &hostInfo{Hostname: "node1", Status: k0sStatus{Role: "controller"}}
+
+	changes := resetDryRunChanges(controller, state, 3)
+	assert.Equal(t, []string{
+		"Create a backup of the cluster and the application with Velero",
+		"Run the pre-drain hooks, drain node node1 and run the post-drain hooks",
+		"Delete the Node node1 from the cluster",
+		"Delete the ControlNode node1 from the cluster",
+		"Remove this node from the etcd cluster",
+		"Stop the k0scontroller service and run k0s reset, removing /var/lib/k0s",
+		"Remove the 12 containers run by k0s",
+		"Flush the 40 iptables rules created by kube-proxy and Calico",
+		"Stop the local-artifact-mirror service",
+		"Disarm the watchdog and remove its timer",
+		"Delete the only copy of the persistent volumes app/data (10Gi), pvc-b",
+		"Remove /var/lib/embedded-cluster",
+		"Remove /usr/local/bin/k0s",
+		"Reboot the host",
+	}, changes)
+
+	// the only controller is not drained nor removed from the cluster.
+	changes = resetDryRunChanges(controller, state, 1)
+	assert.Equal(t, "Stop the k0scontroller service and run k0s reset, removing /var/lib/k0s", changes[1])
+
+	worker := &hostInfo{Hostname: "node2", Status: k0sStatus{Role: "worker"}}
+	changes = resetDryRunChanges(worker, resetHostState{K0sUnit: "k0sworker", DataDir: "/var/lib/k0s"}, 1)
+	assert.Equal(t, []string{
+		"Run the pre-drain hooks, drain node node2 and run the post-drain hooks",
+		"Delete the Node node2 from the cluster",
+		"Stop the k0sworker service and run k0s reset, removing /var/lib/k0s",
+		"Reboot the host",
+	}, changes)
+}
+
+func TestCountClusterIptablesRules(t *testing.T) {
+	out := `*filter
+:INPUT ACCEPT [0:0]
+:KUBE-FORWARD - [0:0]
+-A INPUT -j KUBE-FIREWALL
+-A FORWARD -m comment --comment "cali:wUHhoiAYhphO9Mso" -j cali-FORWARD
+-A KUBE-FORWARD -m conntrack --ctstate INVALID -j DROP
+-A INPUT -p tcp --dport 22 -j ACCEPT
+COMMIT
+`
+	assert.Equal(t, 3, countClusterIptablesRules(out))
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/urfave/cli/v2"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	veleroclientv1 "github.com/vmware-tanzu/velero/pkg/generated/clientset/versioned/typed/velero/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sconfig "sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/egress"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
+)
+
+var networkCommands = &cli.Command{
+	Name:  "network",
+	Usage: "Inspect the cluster network requirements",
+	Subcommands: []*cli.Command{
+		networkEgressReportCommand,
+	},
+}
+
+var networkEgressReportCommand = &cli.Command{
+	Name:  "egress-report",
+	Usage: "List the external endpoints the cluster components connect to",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "output",
+			Aliases: []string{"o"},
+			Usage:   "Output format, one of text or json.",
+			Value:   "text",
+		},
+	},
+	Before: func(c *cli.Context) error {
+		if err := privileges.Check("egress-report", clusterPrivileges()...); err != nil {
+			return err
+		}
+		if output := c.String("output"); output != "text" && output != "json" {
+			return fmt.Errorf("invalid output %q, must be one of text or json", output)
+		}
+		os.Setenv("KUBECONFIG", defaults.PathToKubeConfig())
+		return nil
+	},
+	Action: func(c *cli.Context) error {
+		kcli, err := kubeutils.KubeClient()
+		if err != nil {
+			return fmt.Errorf("unable to create kube client: %w", err)
+		}
+		in, err := kubeutils.GetLatestInstallation(c.Context, kcli)
+		if err != nil {
+			return fmt.Errorf("unable to get installation: %w", err)
+		}
+		if in.Spec.ConfigSecret != nil {
+			var secret corev1.Secret
+			nsn := types.NamespacedName{Namespace: in.Spec.ConfigSecret.Namespace, Name: in.Spec.ConfigSecret.Name}
+			if err := kcli.Get(c.Context, nsn, &secret); err != nil {
+				return fmt.Errorf("unable to get config secret: %w", err)
+			}
+			if err := in.Spec.ParseConfigSpecFromSecret(secret); err != nil {
+				return fmt.Errorf("unable to parse config spec from secret: %w", err)
+			}
+		}
+
+		cfg, err := k8sconfig.GetConfig()
+		if err != nil {
+			return fmt.Errorf("unable to process kubernetes config: %w", err)
+		}
+		veleroClient, err := veleroclientv1.NewForConfig(cfg)
+		if err != nil {
+			return fmt.Errorf("unable to create velero client: %w", err)
+		}
+		var locations []velerov1.BackupStorageLocation
+		list, err := veleroClient.BackupStorageLocations(defaults.VeleroNamespace).List(c.Context, metav1.ListOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return fmt.Errorf("unable to list backup storage locations: %w", err)
+		} else if err == nil {
+			locations = list.Items
+		}
+
+		report, err := egress.Generate(in, locations)
+		if err != nil {
+			return fmt.Errorf("unable to generate egress report: %w", err)
+		}
+
+		if c.String("output") == "json" {
+			out, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return fmt.Errorf("unable to marshal egress report: %w", err)
+			}
+			fmt.Println(string(out))
+			return nil
+		}
+		printEgressReport(report)
+		return nil
+	},
+}
+
+// printEgressReport prints the egress report in a human readable format.
+func printEgressReport(report *egress.Report) {
+	if report.AirGap {
+		fmt.Println("The cluster was installed in air gap mode.")
+	}
+	if report.Proxy != "" {
+		fmt.Printf("Http and https endpoints are reached through the proxy %s.\n", report.Proxy)
+		if report.NoProxy != "" {
+			fmt.Printf("Destinations not reached through the proxy: %s\n", report.NoProxy)
+		}
+	}
+	if len(report.Endpoints) == 0 {
+		fmt.Println("The cluster components do not connect to any external endpoint.")
+		return
+	}
+	writer := table.NewWriter()
+	writer.AppendHeader(table.Row{"host", "port", "protocol", "components", "purpose"})
+	for _, endpoint := range report.Endpoints {
+		writer.AppendRow(table.Row{
+			endpoint.Host, endpoint.Port, endpoint.Protocol,
+			strings.Join(endpoint.Components, ", "), endpoint.Purpose,
+		})
+	}
+	fmt.Printf("%s\n", writer.Render())
+}
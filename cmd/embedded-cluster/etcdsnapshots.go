@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/etcdsnapshot"
+	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
+	"github.com/replicatedhq/embedded-cluster/pkg/prompts"
+)
+
+// k0sEtcdDataDir is where k0s keeps the etcd database.
+const k0sEtcdDataDir = "/var/lib/k0s/etcd"
+
+func etcdSnapshotsDir() string {
+	return filepath.Join(defaults.EmbeddedClusterHomeDirectory(), "etcd-snapshots")
+}
+
+func etcdSnapshotsConfigPath() string {
+	return filepath.Join(defaults.EmbeddedClusterHomeDirectory(), "etcd-snapshots.json")
+}
+
+func withEtcdSnapshotFlags(flags []cli.Flag) []cli.Flag {
+	return append(flags,
+		&cli.StringFlag{
+			Name:  "etcd-snapshot-schedule",
+			Usage: fmt.Sprintf("Take etcd snapshots on this systemd calendar schedule, %q for instance. Snapshots are disabled if empty.", etcdsnapshot.DefaultSchedule),
+		},
+		&cli.IntFlag{
+			Name:  "etcd-snapshot-retention",
+			Usage: "Number of etcd snapshots kept in each location",
+			Value: etcdsnapshot.DefaultRetention,
+		},
+		&cli.StringFlag{
+			Name:  "etcd-snapshot-s3",
+			Usage: "Also upload the etcd snapshots to s3://bucket/prefix?region=...&endpoint=..., the credentials are read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY",
+		},
+	)
+}
+
+// getEtcdSnapshotConfig returns the snapshot configuration from the flags, nil if snapshots
+// are not enabled.
+func getEtcdSnapshotConfig(c *cli.Context) (*etcdsnapshot.Config, error) {
+	schedule := c.String("etcd-snapshot-schedule")
+	if schedule == "" {
+		if c.String("etcd-snapshot-s3") != "" {
+			return nil, fmt.Errorf("--etcd-snapshot-s3 requires --etcd-snapshot-schedule")
+		}
+		return nil, nil
+	}
+	if c.Int("etcd-snapshot-retention") < 1 {
+		return nil, fmt.Errorf("--etcd-snapshot-retention must be at least 1")
+	}
+	cfg := &etcdsnapshot.Config{Schedule: schedule, Retention: c.Int("etcd-snapshot-retention")}
+	if raw := c.String("etcd-snapshot-s3"); raw != "" {
+		target, err := etcdsnapshot.ParseS3URL(raw)
+		if err != nil {
+			return nil, err
+		}
+		cfg.S3 = target
+	}
+	return cfg, nil
+}
+
+// configureEtcdSnapshots saves the snapshot configuration and installs the systemd timer
+// taking the snapshots, nothing is done if snapshots are not enabled.
+func configureEtcdSnapshots(c *cli.Context) error {
+	cfg, err := getEtcdSnapshotConfig(c)
+	if err != nil || cfg == nil {
+		return err
+	}
+	if err := etcdsnapshot.ValidateSchedule(cfg.Schedule); err != nil {
+		return err
+	}
+	if err := etcdsnapshot.WriteConfig(etcdSnapshotsConfigPath(), *cfg); err != nil {
+		return err
+	}
+	binary := defaults.PathToEmbeddedClusterBinary(binName)
+	if err := etcdsnapshot.InstallTimer(binary, cfg.Schedule); err != nil {
+		return err
+	}
+	logrus.Debugf("etcd snapshots scheduled %q, keeping %d", cfg.Schedule, cfg.Retention)
+	return nil
+}
+
+// newEtcdSnapshotManager returns a manager for the configured snapshots. Snapshots kept
+// locally can be managed even if the schedule was not configured.
+func newEtcdSnapshotManager() (*etcdsnapshot.Manager, error) {
+	cfg, err := etcdsnapshot.ReadConfig(etcdSnapshotsConfigPath())
+	if err != nil {
+		return nil, err
+	}
+	mgr := &etcdsnapshot.Manager{K0s: k0s, Dir: etcdSnapshotsDir()}
+	if cfg != nil {
+		mgr.Config = *cfg
+	}
+	return mgr, nil
+}
+
+var adminEtcdSnapshotsCommand = &cli.Command{
+	Name:  "etcd-snapshots",
+	Usage: "Manage the etcd snapshots of this controller",
+	Before: func(c *cli.Context) error {
+		if err := privileges.Check("etcd-snapshots", hostPrivileges()...); err != nil {
+			return err
+		}
+		if _, err := os.Stat(defaults.PathToKubeConfig()); err != nil {
+			return fmt.Errorf("etcd-snapshots command must be run on a controller node")
+		}
+		return nil
+	},
+	Subcommands: []*cli.Command{
+		adminEtcdSnapshotsListCommand,
+		adminEtcdSnapshotsTakeCommand,
+		adminEtcdSnapshotsRestoreCommand,
+	},
+}
+
+var adminEtcdSnapshotsListCommand = &cli.Command{
+	Name:  "list",
+	Usage: "List the etcd snapshots, the most recent first",
+	Flags: []cli.Flag{getOutputFlag()},
+	Before: func(c *cli.Context) error {
+		return validateOutputFlag(c)
+	},
+	Action: func(c *cli.Context) error {
+		mgr, err := newEtcdSnapshotManager()
+		if err != nil {
+			return err
+		}
+		snapshots, err := mgr.List(c.Context)
+		if err != nil {
+			return err
+		}
+		if c.String("output") == "json" {
+			return printJSON(snapshots)
+		}
+		if len(snapshots) == 0 {
+			logrus.Info("No etcd snapshots found.")
+			return nil
+		}
+		writer := table.NewWriter()
+		writer.AppendHeader(table.Row{"name", "location", "size", "created"})
+		for _, snapshot := range snapshots {
+			writer.AppendRow(table.Row{
+				snapshot.Name,
+				snapshot.Location,
+				resource.NewQuantity(snapshot.Size, resource.BinarySI).String(),
+				snapshot.CreatedAt.Format(time.RFC3339),
+			})
+		}
+		fmt.Printf("%s\n", writer.Render())
+		return nil
+	},
+}
+
+var adminEtcdSnapshotsTakeCommand = &cli.Command{
+	Name:  "take",
+	Usage: "Take an etcd snapshot now, the oldest snapshots above the retention are deleted",
+	Action: func(c *cli.Context) error {
+		mgr, err := newEtcdSnapshotManager()
+		if err != nil {
+			return err
+		}
+		snapshot, err := mgr.Take(c.Context)
+		if err != nil {
+			return fmt.Errorf("unable to take etcd snapshot: %w", err)
+		}
+		logrus.Infof("Snapshot %s taken.", snapshot.Name)
+		return nil
+	},
+}
+
+var adminEtcdSnapshotsRestoreCommand = &cli.Command{
+	Name:      "restore",
+	Usage:     "Restore the cluster datastore from an etcd snapshot",
+	ArgsUsage: "<snapshot>",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "no-prompt",
+			Usage: "Do not prompt user when it is not necessary",
+			Value: false,
+		},
+	},
+	Before: func(c *cli.Context) error {
+		if c.Args().Len() != 1 {
+			return fmt.Errorf("restore requires the name of the snapshot to restore")
+		}
+		return nil
+	},
+	Action: func(c *cli.Context) error {
+		// a snapshot brings back a single member cluster, other controllers would keep
+		// the state it replaces.
+		os.Setenv("KUBECONFIG", defaults.PathToKubeConfig())
+		if kcli, err := kubeutils.KubeClient(); err == nil {
+			if ncps, err := kubeutils.NumOfControlPlaneNodes(c.Context, kcli); err == nil && ncps > 1 {
+				return fmt.Errorf("the cluster has %d controllers, reset the other controllers before restoring a snapshot", ncps)
+			}
+		}
+
+		mgr, err := newEtcdSnapshotManager()
+		if err != nil {
+			return err
+		}
+		path, err := mgr.Fetch(c.Context, c.Args().First())
+		if err != nil {
+			return err
+		}
+		if !c.Bool("no-prompt") {
+			logrus.Warn("The cluster services are stopped and the cluster state is replaced by the one in the snapshot.")
+			if !prompts.New().Confirm("Do you want to continue?", false) {
+				return ErrNothingElseToAdd
+			}
+		}
+
+		logrus.Info("Stopping the cluster services...")
+		if _, err := helpers.RunCommand(k0s, "stop"); err != nil {
+			return fmt.Errorf("unable to stop k0s: %w", err)
+		}
+		// the current database is kept aside, etcd refuses to restore over it.
+		aside := fmt.Sprintf("%s.pre-restore-%d", k0sEtcdDataDir, time.Now().Unix())
+		if err := os.Rename(k0sEtcdDataDir, aside); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to move the etcd database aside: %w", err)
+		}
+		tmpdir, err := os.MkdirTemp("", "etcd-snapshot-restore-")
+		if err != nil {
+			return fmt.Errorf("unable to create temporary directory: %w", err)
+		}
+		defer os.RemoveAll(tmpdir)
+		logrus.Infof("Restoring snapshot %s...", filepath.Base(path))
+		if _, err := helpers.RunCommand(k0s, "restore", path, "--config-out", filepath.Join(tmpdir, "k0s.yaml")); err != nil {
+			return fmt.Errorf("unable to restore snapshot, the previous database is in %s: %w", aside, err)
+		}
+		logrus.Info("Starting the cluster services...")
+		if _, err := helpers.RunCommand(k0s, "start"); err != nil {
+			return fmt.Errorf("unable to start k0s: %w", err)
+		}
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("unable to get hostname: %w", err)
+		}
+		if err := waitForNodeReady(c.Context, hostname, 5*time.Minute); err != nil {
+			return err
+		}
+		logrus.Infof("Snapshot restored, the previous database is kept in %s.", aside)
+		return nil
+	},
+}
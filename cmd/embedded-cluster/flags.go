@@ -2,9 +2,15 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strconv"
 
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/addons/adminconsole"
 	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/k0sready"
+	"github.com/replicatedhq/embedded-cluster/pkg/storageplan"
 	"github.com/urfave/cli/v2"
 	k8snet "k8s.io/utils/net"
 )
@@ -31,6 +37,19 @@ func getAdminConsolePortFromFlag(c *cli.Context) (int, error) {
 	return port, nil
 }
 
+func getAdminConsoleAuthFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name: "admin-console-auth",
+		Usage: fmt.Sprintf(
+			"How users authenticate to the Admin Console. One of %s (shared password), %s (identity providers from the config) or %s (no Admin Console UI).",
+			ecv1beta1.AdminConsoleAuthModePassword,
+			ecv1beta1.AdminConsoleAuthModeIdentityProvider,
+			ecv1beta1.AdminConsoleAuthModeDisabled,
+		),
+		Value: ecv1beta1.AdminConsoleAuthModePassword,
+	}
+}
+
 func getLocalArtifactMirrorPortFlag() cli.Flag {
 	return &cli.StringFlag{
 		Name:   "local-artifact-mirror-port",
@@ -56,3 +75,177 @@ func getLocalArtifactMirrorPortFromFlag(c *cli.Context) (int, error) {
 	}
 	return port, nil
 }
+
+func getLocalArtifactMirrorDiskQuotaFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "local-artifact-mirror-disk-quota",
+		Usage: "Maximum disk space used by the artifacts of the Local Artifact Mirror (e.g. 20Gi). Only the most recent versions are kept if not set.",
+	}
+}
+
+func withStorageFlags(flags []cli.Flag) []cli.Flag {
+	return append(flags,
+		&cli.StringFlag{
+			Name:  "openebs-data-dir",
+			Usage: fmt.Sprintf("Directory where the persistent volumes are stored, it can be the mount point of a separate filesystem (default %s)", defaults.OpenEBSDataDir),
+		},
+		&cli.StringFlag{
+			Name:  "openebs-storage-reservation",
+			Usage: "Free space required on the filesystem of the persistent volumes (e.g. 100Gi), checked by the host preflights",
+		},
+		&cli.StringFlag{
+			Name:  "registry-storage-size",
+			Usage: fmt.Sprintf("Size of the volume of the embedded registry on air gap installations (default %s)", storageplan.DefaultRegistryStorageSize),
+		},
+	)
+}
+
+// getStorageSpecFromFlags returns the storage plan set with the flags, nil if none of them
+// were set.
+func getStorageSpecFromFlags(c *cli.Context) (*ecv1beta1.StorageSpec, error) {
+	spec := &ecv1beta1.StorageSpec{
+		OpenEBSDataDir:      c.String("openebs-data-dir"),
+		OpenEBSReservation:  c.String("openebs-storage-reservation"),
+		RegistryStorageSize: c.String("registry-storage-size"),
+	}
+	if *spec == (ecv1beta1.StorageSpec{}) {
+		return nil, nil
+	}
+	if spec.OpenEBSDataDir != "" {
+		spec.OpenEBSDataDir = filepath.Clean(spec.OpenEBSDataDir)
+	}
+	if err := storageplan.Validate(spec); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+func getHardeningFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "hardening",
+		Usage: "Hardening profile applied to the cluster. Supported profiles: cis.",
+	}
+}
+
+func getExcludeHostCollectorsFlag() cli.Flag {
+	return &cli.StringSliceFlag{
+		Name:  "exclude-host-collectors",
+		Usage: "Host collectors, by type (e.g. run) or collector name, excluded from host preflights and support bundles.",
+	}
+}
+
+func getDiskBenchmarkFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "disk-benchmark",
+		Usage: "Benchmark the etcd disk under load during the host preflights, measuring its fsync latency and IOPS. Adds about a minute to the preflights.",
+		Value: false,
+	}
+}
+
+func withAdminConsoleTLSFlags(flags []cli.Flag) []cli.Flag {
+	return append(flags,
+		&cli.StringFlag{
+			Name:  "tls-cert",
+			Usage: "Path to the TLS certificate the Admin Console is served with. Requires --tls-key.",
+		},
+		&cli.StringFlag{
+			Name:  "tls-key",
+			Usage: "Path to the private key of the Admin Console TLS certificate. Requires --tls-cert.",
+		},
+		&cli.StringFlag{
+			Name:  "hostname",
+			Usage: "Hostname the Admin Console is accessed with. The TLS certificate must be valid for it.",
+		},
+	)
+}
+
+// getAdminConsoleTLSFromFlags reads and validates the Admin Console certificate, key and
+// hostname provided by the user. Nothing is returned if no certificate was provided.
+func getAdminConsoleTLSFromFlags(c *cli.Context) ([]byte, []byte, string, error) {
+	certPath, keyPath, hostname := c.String("tls-cert"), c.String("tls-key"), c.String("hostname")
+	if certPath == "" && keyPath == "" {
+		if hostname != "" {
+			return nil, nil, "", fmt.Errorf("--hostname requires --tls-cert and --tls-key")
+		}
+		return nil, nil, "", nil
+	}
+	if certPath == "" || keyPath == "" {
+		return nil, nil, "", fmt.Errorf("--tls-cert and --tls-key must be provided together")
+	}
+	cert, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("unable to read tls certificate: %w", err)
+	}
+	key, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("unable to read tls key: %w", err)
+	}
+	if err := adminconsole.ValidateTLS(cert, key, hostname); err != nil {
+		return nil, nil, "", err
+	}
+	return cert, key, hostname, nil
+}
+
+func getConfigureFirewallFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "configure-firewall",
+		Usage: "Open the ports required by the cluster in the host firewall (firewalld, ufw or nftables).",
+		Value: false,
+	}
+}
+
+func getInstallPrereqsFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "install-prereqs",
+		Usage: "Install missing operating system prerequisites (curl, tar, iptables, container-selinux) using the system package manager.",
+		Value: false,
+	}
+}
+
+func getIgnoreUnsupportedOSFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "ignore-unsupported-os",
+		Usage: "Continue when the operating system, kernel or cgroup version is not supported. This is not recommended.",
+		Value: false,
+	}
+}
+
+func getEnableChronyFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "enable-chrony",
+		Usage: "Enable and start chrony if no time synchronization service is active. Chrony must be installed.",
+		Value: false,
+	}
+}
+
+func getFIPSFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "fips",
+		Usage: "Install in FIPS mode. Requires the FIPS build of the binary and a FIPS enabled kernel.",
+		Value: false,
+	}
+}
+
+func getNodeReadyTimeoutFlag() cli.Flag {
+	return &cli.DurationFlag{
+		Name:  "node-ready-timeout",
+		Usage: "Maximum time to wait for the node services to become ready. Increase it on hosts with slow disks.",
+		Value: k0sready.DefaultTimeout,
+	}
+}
+
+func getTimeoutFlag() cli.Flag {
+	return &cli.DurationFlag{
+		Name:  "timeout",
+		Usage: "Stop the command if it has not finished after this duration, after the step in progress. 0 never stops it.",
+	}
+}
+
+func getOutputFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "output",
+		Aliases: []string{"o"},
+		Usage:   "Output format, one of text or json. With json a result document is printed to stdout once the command finishes, everything else is written to stderr.",
+		Value:   "text",
+	}
+}
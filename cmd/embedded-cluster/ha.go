@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlconfig "sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+	"github.com/replicatedhq/embedded-cluster/pkg/highavailability"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
+	"github.com/replicatedhq/embedded-cluster/pkg/prompts"
+)
+
+// haVerifyProbeInterval is how often the services are probed while the controller is down.
+const haVerifyProbeInterval = 5 * time.Second
+
+var haCommands = &cli.Command{
+	Name:  "ha",
+	Usage: "Manage high availability",
+	Subcommands: []*cli.Command{
+		haVerifyCommand,
+	},
+}
+
+var haVerifyCommand = &cli.Command{
+	Name:  "verify",
+	Usage: "Verify the cluster stays available without this controller, by stopping its cluster services for a while",
+	Flags: []cli.Flag{
+		&cli.DurationFlag{
+			Name:  "duration",
+			Usage: "How long the cluster services of this node are stopped for",
+			Value: 2 * time.Minute,
+		},
+		&cli.DurationFlag{
+			Name:  "max-outage",
+			Usage: "Longest a service can be unavailable for the verification to pass",
+			Value: 30 * time.Second,
+		},
+		&cli.BoolFlag{
+			Name:  "no-prompt",
+			Usage: "Do not prompt user when it is not necessary",
+			Value: false,
+		},
+	},
+	Before: func(c *cli.Context) error {
+		if err := privileges.Check("ha verify", hostPrivileges()...); err != nil {
+			return err
+		}
+		if _, err := os.Stat(defaults.PathToKubeConfig()); err != nil {
+			return fmt.Errorf("ha verify must be run on a controller node")
+		}
+		os.Setenv("KUBECONFIG", defaults.PathToKubeConfig())
+		return nil
+	},
+	Action: func(c *cli.Context) error {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("unable to get hostname: %w", err)
+		}
+		kcli, err := kubeutils.KubeClient()
+		if err != nil {
+			return fmt.Errorf("unable to create kube client: %w", err)
+		}
+		in, err := kubeutils.GetLatestInstallation(c.Context, kcli)
+		if err != nil {
+			return fmt.Errorf("unable to get latest installation: %w", err)
+		}
+		if !in.Spec.HighAvailability {
+			return fmt.Errorf("high availability is not enabled, there is nothing to verify")
+		}
+		peers, err := haPeerAddresses(c.Context, kcli, hostname)
+		if err != nil {
+			return err
+		}
+
+		adminConsolePort := defaults.AdminConsolePort
+		if in.Spec.AdminConsole != nil && in.Spec.AdminConsole.Port > 0 {
+			adminConsolePort = in.Spec.AdminConsole.Port
+		}
+		checks, err := haVerifyChecks(peers, adminConsolePort, in.Spec.AirGap)
+		if err != nil {
+			return err
+		}
+		for _, check := range checks {
+			if err := check.Probe(c.Context); err != nil {
+				return fmt.Errorf("%s is not available before stopping this node: %w", check.Name, err)
+			}
+		}
+
+		logrus.Warnf("The cluster services of this node are going to be stopped for %s.", c.Duration("duration"))
+		logrus.Warnf("Pods running on it are unavailable until they are started again.")
+		if !c.Bool("no-prompt") && !prompts.New().Confirm("Do you want to continue?", false) {
+			return ErrNothingElseToAdd
+		}
+
+		if err := stopControllerForVerify(hostname); err != nil {
+			return errors.Join(err, restartControllerAfterVerify(c.Context, hostname))
+		}
+		logrus.Infof("Cluster services stopped, probing the cluster for %s...", c.Duration("duration"))
+		results := highavailability.Monitor(c.Context, checks, haVerifyProbeInterval, c.Duration("duration"))
+		if err := restartControllerAfterVerify(c.Context, hostname); err != nil {
+			return err
+		}
+
+		printHAVerifyResults(results, c.Duration("max-outage"))
+		for _, result := range results {
+			if !result.Passed(c.Duration("max-outage")) {
+				return fmt.Errorf("the cluster was not available while this node was down")
+			}
+		}
+		logrus.Infof("The cluster stayed available while this node was down.")
+		return nil
+	},
+}
+
+// haPeerAddresses returns the addresses of the other controllers. All controllers must
+// be ready, and this node must be one of them.
+func haPeerAddresses(ctx context.Context, kcli client.Client, hostname string) ([]string, error) {
+	var nodes corev1.NodeList
+	if err := kcli.List(ctx, &nodes, client.MatchingLabels{"node-role.kubernetes.io/control-plane": "true"}); err != nil {
+		return nil, fmt.Errorf("unable to list controller nodes: %w", err)
+	}
+	local := false
+	peers := []string{}
+	for _, node := range nodes.Items {
+		if !newNodeInfo(node, 0).Ready {
+			return nil, fmt.Errorf("controller %s is not ready, all controllers must be ready", node.Name)
+		}
+		if node.Name == hostname {
+			local = true
+			continue
+		}
+		for _, addr := range node.Status.Addresses {
+			if addr.Type == corev1.NodeInternalIP {
+				peers = append(peers, addr.Address)
+				break
+			}
+		}
+	}
+	if !local {
+		return nil, fmt.Errorf("node %s is not a controller", hostname)
+	}
+	if len(peers) < 2 {
+		return nil, fmt.Errorf("at least 3 controllers are needed, found %d", len(peers)+1)
+	}
+	return peers, nil
+}
+
+// haVerifyChecks returns the checks run through the other controllers: the kubernetes
+// api, the admin console and, in air gap installations, the registry.
+func haVerifyChecks(peers []string, adminConsolePort int, airgap bool) ([]highavailability.Check, error) {
+	clients := []client.Client{}
+	for _, peer := range peers {
+		kcli, err := peerKubeClient(peer)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, kcli)
+	}
+	anyClient := func(probe func(client.Client) func(context.Context) error) func(context.Context) error {
+		return func(ctx context.Context) error {
+			errs := []error{}
+			for _, kcli := range clients {
+				err := probe(kcli)(ctx)
+				if err == nil {
+					return nil
+				}
+				errs = append(errs, err)
+			}
+			return errors.Join(errs...)
+		}
+	}
+
+	urls := []string{}
+	for _, peer := range peers {
+		urls = append(urls, fmt.Sprintf("https://%s", net.JoinHostPort(peer, strconv.Itoa(adminConsolePort))))
+	}
+	checks := []highavailability.Check{
+		{Name: "Kubernetes API", Probe: anyClient(highavailability.APIProbe)},
+		{Name: "Admin Console", Probe: highavailability.HTTPProbe(urls)},
+	}
+	if airgap {
+		cfg, err := peerRestConfig(peers[0])
+		if err != nil {
+			return nil, err
+		}
+		hc, err := rest.HTTPClientFor(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create registry probe client: %w", err)
+		}
+		servers := []string{}
+		for _, peer := range peers {
+			servers = append(servers, peerAPIServer(peer))
+		}
+		checks = append(checks, highavailability.Check{
+			Name:  "Registry",
+			Probe: highavailability.RegistryProbe(hc, servers, defaults.RegistryNamespace, "registry", 5000),
+		})
+	}
+	return checks, nil
+}
+
+// peerKubeClient returns a client talking to the kubernetes api of another controller,
+// the api of this node is down during the verification.
+func peerKubeClient(address string) (client.Client, error) {
+	cfg, err := peerRestConfig(address)
+	if err != nil {
+		return nil, err
+	}
+	kcli, err := client.New(cfg, client.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create kube client for %s: %w", address, err)
+	}
+	return kcli, nil
+}
+
+// peerRestConfig returns the configuration of a client talking to the kubernetes api of
+// another controller.
+func peerRestConfig(address string) (*rest.Config, error) {
+	cfg, err := ctrlconfig.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to process kubernetes config: %w", err)
+	}
+	cfg.Host = peerAPIServer(address)
+	cfg.Timeout = haVerifyProbeInterval
+	return cfg, nil
+}
+
+// peerAPIServer returns the url of the kubernetes api of another controller.
+func peerAPIServer(address string) string {
+	return fmt.Sprintf("https://%s", net.JoinHostPort(address, "6443"))
+}
+
+// stopControllerForVerify cordons the node and stops its cluster services. The node is
+// recorded as in maintenance so node uncordon brings it back if the verification is
+// interrupted.
+func stopControllerForVerify(node string) error {
+	if out, err := exec.Command(k0s, "kubectl", "cordon", node).CombinedOutput(); err != nil {
+		return fmt.Errorf("could not cordon node: %w, %s", err, out)
+	}
+	state := maintenanceState{Node: node, K0sStopped: true, DrainedAt: time.Now().UTC()}
+	if err := writeMaintenanceState(maintenanceStatePath(), state); err != nil {
+		return err
+	}
+	if _, err := helpers.RunCommand(k0s, "stop"); err != nil {
+		return fmt.Errorf("unable to stop k0s: %w", err)
+	}
+	return nil
+}
+
+// restartControllerAfterVerify starts the cluster services of the node again, waits for
+// it to be ready and uncordons it.
+func restartControllerAfterVerify(ctx context.Context, node string) error {
+	logrus.Info("Starting the cluster services...")
+	if _, err := helpers.RunCommand(k0s, "start"); err != nil {
+		return fmt.Errorf("unable to start k0s, run node uncordon once fixed: %w", err)
+	}
+	if err := waitForNodeReady(ctx, node, 5*time.Minute); err != nil {
+		return fmt.Errorf("%w, run node uncordon once it is", err)
+	}
+	if out, err := exec.Command(k0s, "kubectl", "uncordon", node).CombinedOutput(); err != nil {
+		return fmt.Errorf("could not uncordon node: %w, %s", err, out)
+	}
+	if err := os.Remove(maintenanceStatePath()); err != nil {
+		return fmt.Errorf("unable to remove maintenance state: %w", err)
+	}
+	return nil
+}
+
+// printHAVerifyResults prints a table with the availability of each service.
+func printHAVerifyResults(results []highavailability.CheckResult, maxOutage time.Duration) {
+	writer := table.NewWriter()
+	writer.AppendHeader(table.Row{"service", "result", "failed probes", "longest outage", "last error"})
+	for _, result := range results {
+		status := "Passed"
+		if !result.Passed(maxOutage) {
+			status = "Failed"
+		}
+		writer.AppendRow(table.Row{
+			result.Name,
+			status,
+			fmt.Sprintf("%d/%d", result.Failures, result.Probes),
+			result.LongestOutage.Round(time.Second).String(),
+			result.LastError,
+		})
+	}
+	fmt.Printf("%s\n", writer.Render())
+}
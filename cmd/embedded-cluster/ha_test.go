@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestHAPeerAddresses(t *testing.T) {
+	ready := corev1.NodeCondition{Type: corev1.NodeReady, Status: corev1.ConditionTrue}
+	notReady := corev1.NodeCondition{Type: corev1.NodeReady, Status: corev1.ConditionFalse}
+	withAddress := func(node *corev1.Node, addr string) *corev1.Node {
+		node.Status.Addresses = []corev1.NodeAddress{
+			{Type: corev1.NodeHostName, Address: node.Name},
+			{Type: corev1.NodeInternalIP, Address: addr},
+		}
+		return node
+	}
+
+	for _, tt := range []struct {
+		name     string
+		hostname string
+		objects  []client.Object
+		want     []string
+		wantErr  string
+	}{
+		{
+			name:     "three controllers",
+			hostname: "controller-1",
+			objects: []client.Object{
+				withAddress(testNode("controller-1", true, "v1.30.1+k0s", ready), "10.0.0.1"),
+				withAddress(testNode("controller-2", true, "v1.30.1+k0s", ready), "10.0.0.2"),
+				withAddress(testNode("controller-3", true, "v1.30.1+k0s", ready), "10.0.0.3"),
+				withAddress(testNode("worker-1", false, "v1.30.1+k0s", notReady), "10.0.0.4"),
+			},
+			want: []string{"10.0.0.2", "10.0.0.3"},
+		},
+		{
+			name:     "controller not ready",
+			hostname: "controller-1",
+			objects: []client.Object{
+				withAddress(testNode("controller-1", true, "v1.30.1+k0s", ready), "10.0.0.1"),
+				withAddress(testNode("controller-2", true, "v1.30.1+k0s", notReady), "10.0.0.2"),
+				withAddress(testNode("controller-3", true, "v1.30.1+k0s", ready), "10.0.0.3"),
+			},
+			wantErr: "controller controller-2 is not ready, all controllers must be ready",
+		},
+		{
+			name:     "run from a worker",
+			hostname: "worker-1",
+			objects: []client.Object{
+				withAddress(testNode("controller-1", true, "v1.30.1+k0s", ready), "10.0.0.1"),
+				withAddress(testNode("worker-1", false, "v1.30.1+k0s", ready), "10.0.0.4"),
+			},
+			wantErr: "node worker-1 is not a controller",
+		},
+		{
+			name:     "two controllers",
+			hostname: "controller-1",
+			objects: []client.Object{
+				withAddress(testNode("controller-1", true, "v1.30.1+k0s", ready), "10.0.0.1"),
+				withAddress(testNode("controller-2", true, "v1.30.1+k0s", ready), "10.0.0.2"),
+			},
+			wantErr: "at least 3 controllers are needed, found 2",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			kcli := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(tt.objects...).Build()
+			peers, err := haPeerAddresses(context.Background(), kcli, tt.hostname)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, peers)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/urfave/cli/v2"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/hardening"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
+)
+
+var hardeningCommands = &cli.Command{
+	Name:  "hardening",
+	Usage: "Manage the cluster hardening profile",
+	Subcommands: []*cli.Command{
+		hardeningCheckCommand,
+	},
+}
+
+var hardeningCheckCommand = &cli.Command{
+	Name:  "check",
+	Usage: "Validate this node against the CIS Kubernetes Benchmark hardening profile",
+	Before: func(c *cli.Context) error {
+		if err := privileges.Check("hardening check", hostPrivileges()...); err != nil {
+			return err
+		}
+		return nil
+	},
+	Action: func(c *cli.Context) error {
+		results := hardening.Check()
+
+		writer := table.NewWriter()
+		writer.AppendHeader(table.Row{"id", "status", "check", "reason"})
+		var failed int
+		for _, res := range results {
+			status := "PASS"
+			if !res.Pass {
+				status = "FAIL"
+				failed++
+			}
+			writer.AppendRow(table.Row{res.ID, status, res.Text, res.Reason})
+		}
+		fmt.Printf("%s\n", writer.Render())
+		fmt.Printf("%d checks PASS, %d checks FAIL\n", len(results)-failed, failed)
+
+		if failed > 0 {
+			return ErrNothingElseToAdd
+		}
+		return nil
+	},
+}
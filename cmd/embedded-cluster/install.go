@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -13,20 +14,47 @@ import (
 	kotsv1beta1 "github.com/replicatedhq/kotskinds/apis/kots/v1beta1"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
+	"k8s.io/client-go/util/retry"
 	k8syaml "sigs.k8s.io/yaml"
 
 	"github.com/replicatedhq/embedded-cluster/pkg/addons"
+	"github.com/replicatedhq/embedded-cluster/pkg/addons/adminconsole"
 	"github.com/replicatedhq/embedded-cluster/pkg/airgap"
+	"github.com/replicatedhq/embedded-cluster/pkg/artifactmirror"
 	"github.com/replicatedhq/embedded-cluster/pkg/config"
+	"github.com/replicatedhq/embedded-cluster/pkg/conntrack"
+	"github.com/replicatedhq/embedded-cluster/pkg/containerhost"
 	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/encryption"
+	ecerrors "github.com/replicatedhq/embedded-cluster/pkg/errors"
+	"github.com/replicatedhq/embedded-cluster/pkg/fips"
+	"github.com/replicatedhq/embedded-cluster/pkg/firewall"
 	"github.com/replicatedhq/embedded-cluster/pkg/goods"
+	"github.com/replicatedhq/embedded-cluster/pkg/hardening"
 	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+	"github.com/replicatedhq/embedded-cluster/pkg/hostcollectors"
+	"github.com/replicatedhq/embedded-cluster/pkg/hostconfig"
+	"github.com/replicatedhq/embedded-cluster/pkg/imagepull"
+	"github.com/replicatedhq/embedded-cluster/pkg/k0sready"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
 	"github.com/replicatedhq/embedded-cluster/pkg/metrics"
 	"github.com/replicatedhq/embedded-cluster/pkg/netutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/osmatrix"
 	"github.com/replicatedhq/embedded-cluster/pkg/preflights"
+	"github.com/replicatedhq/embedded-cluster/pkg/prereqs"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
 	"github.com/replicatedhq/embedded-cluster/pkg/prompts"
+	"github.com/replicatedhq/embedded-cluster/pkg/pullsecrets"
+	"github.com/replicatedhq/embedded-cluster/pkg/registrymirror"
 	"github.com/replicatedhq/embedded-cluster/pkg/release"
+	"github.com/replicatedhq/embedded-cluster/pkg/remote"
+	"github.com/replicatedhq/embedded-cluster/pkg/selinux"
+	"github.com/replicatedhq/embedded-cluster/pkg/signatures"
 	"github.com/replicatedhq/embedded-cluster/pkg/spinner"
+	"github.com/replicatedhq/embedded-cluster/pkg/storagecheck"
+	"github.com/replicatedhq/embedded-cluster/pkg/storageplan"
+	"github.com/replicatedhq/embedded-cluster/pkg/timesync"
+	"github.com/replicatedhq/embedded-cluster/pkg/versions"
 	"github.com/replicatedhq/troubleshoot/pkg/apis/troubleshoot/v1beta2"
 )
 
@@ -42,16 +70,21 @@ var ErrNothingElseToAdd = fmt.Errorf("")
 // ErrPreflightsHaveFail is an error returned when we managed to execute the
 // host preflights but they contain failures. We use this to differentiate the
 // way we provide user feedback.
-var ErrPreflightsHaveFail = fmt.Errorf("host preflight failures detected")
+var ErrPreflightsHaveFail = ecerrors.WithKind(ecerrors.Preflight, fmt.Errorf("host preflight failures detected"))
+
+// errPreflightsReported is returned once the host preflight failures were printed, it
+// keeps the classification of ErrPreflightsHaveFail without adding to the screen.
+var errPreflightsReported = ecerrors.WithKind(ecerrors.Preflight, ErrNothingElseToAdd)
 
 // installAndEnableLocalArtifactMirror installs and enables the local artifact mirror. This
 // service is responsible for serving on localhost, through http, all files that are used
-// during a cluster upgrade.
-func installAndEnableLocalArtifactMirror(port int) error {
+// during a cluster upgrade. Controllers also serve them to the other nodes on their node
+// address, workers provide no address.
+func installAndEnableLocalArtifactMirror(spec ecv1beta1.LocalArtifactMirrorSpec, nodeIP string) error {
 	if err := goods.MaterializeLocalArtifactMirrorUnitFile(); err != nil {
 		return fmt.Errorf("failed to materialize artifact mirror unit: %w", err)
 	}
-	if err := writeLocalArtifactMirrorEnvironmentFile(port); err != nil {
+	if err := writeLocalArtifactMirrorEnvironmentFile(spec, nodeIP); err != nil {
 		return fmt.Errorf("failed to write local artifact mirror environment file: %w", err)
 	}
 	if _, err := helpers.RunCommand("systemctl", "daemon-reload"); err != nil {
@@ -66,9 +99,14 @@ func installAndEnableLocalArtifactMirror(port int) error {
 	return nil
 }
 
-// updateLocalArtifactMirrorService updates the port on which the local artifact mirror is served.
-func updateLocalArtifactMirrorService(port int) error {
-	if err := writeLocalArtifactMirrorEnvironmentFile(port); err != nil {
+// updateLocalArtifactMirrorService updates the configuration of the local artifact mirror
+// of a controller, it keeps listening on the node address of the k0s configuration.
+func updateLocalArtifactMirrorService(spec ecv1beta1.LocalArtifactMirrorSpec) error {
+	cfg, err := getK0sConfigFromDisk()
+	if err != nil {
+		return fmt.Errorf("unable to get k0s config: %w", err)
+	}
+	if err := writeLocalArtifactMirrorEnvironmentFile(spec, k0sNodeIP(cfg)); err != nil {
 		return fmt.Errorf("failed to write local artifact mirror environment file: %w", err)
 	}
 	if _, err := helpers.RunCommand("systemctl", "daemon-reload"); err != nil {
@@ -80,20 +118,14 @@ func updateLocalArtifactMirrorService(port int) error {
 	return nil
 }
 
-const (
-	localArtifactMirrorSystemdConfFile         = "/etc/systemd/system/local-artifact-mirror.service.d/embedded-cluster.conf"
-	localArtifactMirrorEnvironmentFileContents = `[Service]
-Environment="LOCAL_ARTIFACT_MIRROR_PORT=%d"`
-)
-
-func writeLocalArtifactMirrorEnvironmentFile(port int) error {
-	dir := filepath.Dir(localArtifactMirrorSystemdConfFile)
+func writeLocalArtifactMirrorEnvironmentFile(spec ecv1beta1.LocalArtifactMirrorSpec, nodeIP string) error {
+	dir := filepath.Dir(hostconfig.LocalArtifactMirrorDropInPath)
 	err := os.MkdirAll(dir, 0755)
 	if err != nil {
 		return fmt.Errorf("create directory: %w", err)
 	}
-	contents := fmt.Sprintf(localArtifactMirrorEnvironmentFileContents, port)
-	err = os.WriteFile(localArtifactMirrorSystemdConfFile, []byte(contents), 0644)
+	contents := hostconfig.LocalArtifactMirrorDropIn(spec, nodeIP)
+	err = os.WriteFile(hostconfig.LocalArtifactMirrorDropInPath, []byte(contents), 0644)
 	if err != nil {
 		return fmt.Errorf("write file: %w", err)
 	}
@@ -129,51 +161,239 @@ func configureNetworkManager(c *cli.Context) error {
 	return nil
 }
 
+// configureFirewall opens the ports required by the cluster in the host firewall if
+// the user requested it. The firewall active on the host (firewalld, ufw or nftables) is
+// used.
+func configureFirewall(c *cli.Context, adminConsolePort, localArtifactMirrorPort int, isWorker bool) error {
+	if !c.Bool("configure-firewall") {
+		return nil
+	}
+	unit := "k0scontroller"
+	if isWorker {
+		unit = "k0sworker"
+	}
+	iface, err := netutils.FirstValidInterface(c.String("network-interface"))
+	if err != nil {
+		return fmt.Errorf("unable to find network interface: %w", err)
+	}
+	ports := firewall.RequiredPorts(adminConsolePort, localArtifactMirrorPort)
+	backend, err := firewall.Configure(c.Context, ports, unit, iface)
+	if err != nil {
+		return err
+	}
+	if backend == firewall.None {
+		logrus.Warn("No supported firewall (firewalld, ufw or nftables) found, the firewall was not configured.")
+		return nil
+	}
+	logrus.Debugf("opened ports %v using %s", ports, backend)
+	return nil
+}
+
+// maybeInstallPrereqs installs, if requested by the user, the operating system packages
+// required by the cluster that are missing on the host. Nothing can be installed in air
+// gap environments, missing packages are reported along with the command to install them.
+func maybeInstallPrereqs(c *cli.Context, isAirgap bool) error {
+	if !c.Bool("install-prereqs") {
+		return nil
+	}
+	distro, err := prereqs.DetectDistro()
+	if err != nil {
+		return fmt.Errorf("unable to detect distribution: %w", err)
+	}
+	missing := prereqs.Missing(distro)
+	if len(missing) == 0 {
+		logrus.Debugf("all prerequisites are installed")
+		return nil
+	}
+	names := strings.Join(prereqs.Names(missing), ", ")
+	if isAirgap {
+		logrus.Errorf("The following prerequisites are missing and cannot be installed in air gap mode: %s", names)
+		logrus.Infof("Install them from your local package repositories and run the command again:")
+		logrus.Infof("\n  sudo %s\n", prereqs.InstallCommand(distro, missing))
+		return ErrNothingElseToAdd
+	}
+	loading := spinner.Start()
+	loading.Infof("Installing prerequisites: %s", names)
+	if err := prereqs.Install(distro, missing); err != nil {
+		loading.CloseWithError()
+		return fmt.Errorf("unable to install prerequisites: %w", err)
+	}
+	loading.Closef("Prerequisites installed!")
+	return nil
+}
+
+// maybeEnableChrony enables chrony, if requested by the user, so the clock of the node
+// is synchronized before host preflights check it.
+func maybeEnableChrony(c *cli.Context) error {
+	if !c.Bool("enable-chrony") {
+		return nil
+	}
+	if err := timesync.EnableChrony(c.Context); err != nil {
+		return fmt.Errorf("unable to enable chrony: %w", err)
+	}
+	return nil
+}
+
+// configureSELinux installs the SELinux policy module and file contexts needed by the
+// cluster. Nothing is done if SELinux is not in enforcing mode.
+func configureSELinux() error {
+	if !selinux.Enforcing() {
+		logrus.Debugf("SELinux is not enforcing, skipping configuration")
+		return nil
+	}
+
+	logrus.Debugf("materializing SELinux policy module")
+	module, err := goods.MaterializeSELinuxPolicyModule()
+	if err != nil {
+		return fmt.Errorf("unable to materialize policy module: %w", err)
+	}
+	if err := selinux.Configure(module); err != nil {
+		return fmt.Errorf("unable to configure selinux: %w", err)
+	}
+	return nil
+}
+
+// checkOSCompatibility checks the host against the operating systems supported by this
+// release. Returns ErrPreflightsHaveFail if the host is not supported, unless the user
+// chose to ignore it or to skip the host preflights, it is then reported as a warning.
+func checkOSCompatibility(c *cli.Context) error {
+	host, err := osmatrix.Detect()
+	if err != nil {
+		logrus.Debugf("unable to detect operating system, skipping compatibility check: %v", err)
+		return nil
+	}
+	if err := osmatrix.Check(host, osmatrix.Supported); err != nil {
+		for _, flag := range []string{"ignore-unsupported-os", "skip-host-preflights"} {
+			if c.Bool(flag) {
+				logrus.Warnf("%v.", err)
+				logrus.Warnf("Continuing because --%s is set, this is not supported.", flag)
+				return nil
+			}
+		}
+		logrus.Errorf("%v.", err)
+		logrus.Infof("Use --ignore-unsupported-os to continue anyway, this is not supported.")
+		return ErrPreflightsHaveFail
+	}
+	logrus.Debugf("operating system %s %s (kernel %s, cgroup v%d) is supported", host.ID, host.Version, host.Kernel, host.CgroupVersion)
+	return nil
+}
+
 // RunHostPreflights runs the host preflights we found embedded in the binary
 // on all configured hosts. We attempt to read HostPreflights from all the
 // embedded Helm Charts and from the Kots Application Release files.
-func RunHostPreflights(c *cli.Context, applier *addons.Applier, replicatedAPIURL, proxyRegistryURL string, isAirgap bool, proxy *ecv1beta1.ProxySpec, adminConsolePort int, localArtifactMirrorPort int) error {
+func RunHostPreflights(c *cli.Context, applier *addons.Applier, replicatedAPIURL, proxyRegistryURL string, isAirgap bool, isFIPS bool, proxy *ecv1beta1.ProxySpec, adminConsolePort int, localArtifactMirrorPort int, clockSkew *time.Duration, k0sCfg *k0sconfig.ClusterConfig) ([]string, error) {
+	hpf, err := getHostPreflightSpec(c, applier, replicatedAPIURL, proxyRegistryURL, isAirgap, isFIPS, adminConsolePort, localArtifactMirrorPort, clockSkew, k0sCfg)
+	if err != nil {
+		return nil, err
+	}
+	return runHostPreflights(c, hpf, proxy)
+}
+
+// getHostPreflightSpec returns the host preflights embedded in the add-ons merged with the
+// built-in cluster host preflights. The clock skew with the cluster is only known, and
+// checked, when joining a node. Only the kernel modules needed by the provided k0s
+// configuration, and the cpu features the application declares, are checked. On airgap
+// installations the space needed to import the materialized images is checked as well.
+func getHostPreflightSpec(c *cli.Context, applier *addons.Applier, replicatedAPIURL, proxyRegistryURL string, isAirgap bool, isFIPS bool, adminConsolePort int, localArtifactMirrorPort int, clockSkew *time.Duration, k0sCfg *k0sconfig.ClusterConfig) (*v1beta2.HostPreflightSpec, error) {
 	hpf, err := applier.HostPreflights()
 	if err != nil {
-		return fmt.Errorf("unable to read host preflights: %w", err)
+		return nil, fmt.Errorf("unable to read host preflights: %w", err)
+	}
+
+	embcfg, err := release.GetEmbeddedClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get embedded cluster config: %w", err)
+	}
+	var embspec *ecv1beta1.ConfigSpec
+	if embcfg != nil {
+		embspec = &embcfg.Spec
+	}
+	microarch, cpuFeatures, err := preflights.RequiredCPUFeatures(embspec, runtime.GOARCH)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get required cpu features: %w", err)
+	}
+	var airgapImagesDiskSpace string
+	if isAirgap {
+		airgapImagesDiskSpace, err = preflights.AirgapImagesDiskSpace(airgap.K0sImagePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	storage, err := storageplan.Read(defaults.PathToStorageSpec())
+	if err != nil {
+		return nil, err
+	}
+	// the embedded registry is installed with the cluster, joining nodes don't host it
+	// when the cluster is created.
+	withRegistry := isAirgap && clockSkew == nil && c.String("airgap-registry") == ""
+	openEBSRequiredSpace, err := storageplan.RequiredSpace(storage, withRegistry)
+	if err != nil {
+		return nil, err
 	}
 
 	data := preflights.TemplateData{
 		ReplicatedAPIURL:        replicatedAPIURL,
 		ProxyRegistryURL:        proxyRegistryURL,
 		IsAirgap:                isAirgap,
+		IsFIPS:                  isFIPS,
+		IsSELinuxEnforcing:      selinux.Enforcing(),
 		AdminConsolePort:        adminConsolePort,
 		LocalArtifactMirrorPort: localArtifactMirrorPort,
 		SystemArchitecture:      runtime.GOARCH,
+		Container:               containerhost.Detect(),
+		KernelModules:           preflights.RequiredKernelModules(k0sCfg),
+		CPUMicroarchitecture:    microarch,
+		CPUFeatures:             cpuFeatures,
+		AirgapImagesDiskSpace:   airgapImagesDiskSpace,
+		ConntrackMax:            conntrack.Max(conntrackConfig(embspec), runtime.NumCPU()),
+		OpenEBSDataDir:          storageplan.DataDir(storage),
+		OpenEBSRequiredSpace:    openEBSRequiredSpace,
+		DiskBenchmark:           c.Bool("disk-benchmark"),
+	}
+	if clockSkew != nil {
+		data.IsJoin = true
+		data.ClockSkewSeconds = int64(clockSkew.Abs().Round(time.Second).Seconds())
 	}
 	chpfs, err := preflights.GetClusterHostPreflights(c.Context, data)
 	if err != nil {
-		return fmt.Errorf("unable to get cluster host preflights: %w", err)
+		return nil, fmt.Errorf("unable to get cluster host preflights: %w", err)
 	}
 
 	for _, h := range chpfs {
 		hpf.Collectors = append(hpf.Collectors, h.Spec.Collectors...)
 		hpf.Analyzers = append(hpf.Analyzers, h.Spec.Analyzers...)
 	}
-
-	return runHostPreflights(c, hpf, proxy)
+	return hpf, nil
 }
 
-func runHostPreflights(c *cli.Context, hpf *v1beta2.HostPreflightSpec, proxy *ecv1beta1.ProxySpec) error {
+// runHostPreflights runs the host preflights. Warnings are accepted with --no-prompt or
+// when the user confirms, the titles of the warnings proceeded past are returned.
+func runHostPreflights(c *cli.Context, hpf *v1beta2.HostPreflightSpec, proxy *ecv1beta1.ProxySpec) ([]string, error) {
+	if err := checkOSCompatibility(c); err != nil {
+		return nil, err
+	}
+
+	excluded, err := hostcollectors.ReadExcluded(defaults.PathToExcludedHostCollectors())
+	if err != nil {
+		return nil, fmt.Errorf("unable to read excluded host collectors: %w", err)
+	}
+	hostcollectors.FilterHostPreflightSpec(hpf, excluded)
+
 	if len(hpf.Collectors) == 0 && len(hpf.Analyzers) == 0 {
-		return nil
+		return nil, nil
 	}
 	pb := spinner.Start()
 	if c.Bool("skip-host-preflights") {
 		pb.Infof("Host preflights skipped")
 		pb.Close()
-		return nil
+		return nil, nil
 	}
 	pb.Infof("Running host preflights")
 	output, stderr, err := preflights.Run(c.Context, hpf, proxy)
 	if err != nil {
 		pb.CloseWithError()
-		return fmt.Errorf("host preflights failed to run: %w", err)
+		return nil, fmt.Errorf("host preflights failed to run: %w", err)
 	}
 	if stderr != "" {
 		logrus.Debugf("preflight stderr: %s", stderr)
@@ -203,7 +423,7 @@ func runHostPreflights(c *cli.Context, hpf *v1beta2.HostPreflightSpec, proxy *ec
 
 		pb.CloseWithError()
 		output.PrintTableWithoutInfo()
-		return ErrPreflightsHaveFail
+		return nil, ErrPreflightsHaveFail
 	}
 
 	// Warnings found
@@ -218,21 +438,97 @@ func runHostPreflights(c *cli.Context, hpf *v1beta2.HostPreflightSpec, proxy *ec
 			// so we just print the warnings and continue
 			pb.Close()
 			output.PrintTableWithoutInfo()
-			return nil
+			return output.WarnTitles(), nil
 		}
 		pb.CloseWithError()
 		output.PrintTableWithoutInfo()
 		if !prompts.New().Confirm("Do you want to continue ?", false) {
-			return fmt.Errorf("user aborted")
+			return nil, fmt.Errorf("user aborted")
 		}
+		return output.WarnTitles(), nil
 	}
 
 	// No failures or warnings
 	pb.Infof("Host preflights succeeded!")
 	pb.Close()
+	return nil, nil
+}
+
+// verifyImageSignatures verifies the signatures of all images that are going to be
+// deployed in the cluster. Verification only happens if the embedded cluster config
+// contains an image verification configuration.
+func verifyImageSignatures(c *cli.Context, applier *addons.Applier) error {
+	embcfg, err := release.GetEmbeddedClusterConfig()
+	if err != nil {
+		return fmt.Errorf("unable to get embedded cluster config: %w", err)
+	}
+	if embcfg == nil || embcfg.Spec.ImageVerification == nil {
+		return nil
+	}
+
+	k0sCfg, disabled, err := renderReleaseK0sConfig()
+	if err != nil {
+		return err
+	}
+	images := config.ListK0sImages(k0sCfg, disabled...)
+	addonImages, err := applier.GetImages()
+	if err != nil {
+		return fmt.Errorf("unable to get addon images: %w", err)
+	}
+	images = append(images, addonImages...)
+	images = append(images, versions.LocalArtifactMirrorImage)
+	images = helpers.UniqueStringSlice(images)
+
+	return verifyImages(*embcfg.Spec.ImageVerification, images, c.String("airgap-bundle"))
+}
+
+// verifyImages verifies the signatures of the images. Air gapped installations can not
+// reach the registries, the signatures shipped in the airgap bundle are verified instead.
+func verifyImages(cfg ecv1beta1.ImageVerification, images []string, airgapBundle string) error {
+	loading := spinner.Start()
+	loading.Infof("Verifying image signatures")
+	verifier := signatures.NewVerifier(defaults.PathToEmbeddedClusterBinary("cosign"), cfg, airgapBundle != "")
+	if airgapBundle != "" {
+		dir, err := materializeSignatures(airgapBundle)
+		if err != nil {
+			loading.CloseWithError()
+			return err
+		}
+		defer os.RemoveAll(dir)
+		verifier.WithLocalImages(dir)
+	}
+	if err := verifier.VerifyImages(images); err != nil {
+		loading.CloseWithError()
+		return fmt.Errorf("image signature verification failed: %w", err)
+	}
+	loading.Closef("Image signatures verified")
 	return nil
 }
 
+// materializeSignatures extracts the image signatures shipped in the airgap bundle into a
+// temporary directory. The caller removes it.
+func materializeSignatures(airgapBundle string) (string, error) {
+	f, err := os.Open(airgapBundle)
+	if err != nil {
+		return "", fmt.Errorf("unable to open airgap bundle: %w", err)
+	}
+	defer f.Close()
+	dir, err := os.MkdirTemp("", "signatures-*")
+	if err != nil {
+		return "", fmt.Errorf("unable to create temp dir: %w", err)
+	}
+	found, err := airgap.MaterializeSignatures(f, dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("unable to read image signatures from the airgap bundle: %w", err)
+	}
+	if !found {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("image signature verification is required but the airgap bundle does not ship the image signatures (%s)", airgap.SignaturesFileName)
+	}
+	return dir, nil
+}
+
 // isAlreadyInstalled checks if the embedded cluster is already installed by looking for
 // the k0s configuration file existence.
 func isAlreadyInstalled() (bool, error) {
@@ -304,6 +600,12 @@ func getLicenseFromFilepath(licenseFile string) (*kotsv1beta1.License, error) {
 }
 
 func checkAirgapMatches(c *cli.Context) error {
+	return checkAirgapBundleMatches(c.String("airgap-bundle"))
+}
+
+// checkAirgapBundleMatches makes sure the airgap bundle at the path is for the release
+// embedded in the binary.
+func checkAirgapBundleMatches(path string) error {
 	rel, err := release.GetChannelRelease()
 	if err != nil {
 		return fmt.Errorf("failed to get release from binary: %w", err) // this should only be if the release is malformed
@@ -313,7 +615,7 @@ func checkAirgapMatches(c *cli.Context) error {
 	}
 
 	// read file from path
-	rawfile, err := os.Open(c.String("airgap-bundle"))
+	rawfile, err := os.Open(path)
 	if err != nil {
 		return fmt.Errorf("failed to open airgap file: %w", err)
 	}
@@ -341,7 +643,29 @@ func checkAirgapMatches(c *cli.Context) error {
 	return nil
 }
 
-func materializeFiles(c *cli.Context) error {
+// writeExcludedHostCollectors persists the host collectors excluded on this node. This must
+// happen before materializing files so the excluded collectors are removed from the
+// support bundles.
+func writeExcludedHostCollectors(excluded []string) error {
+	if err := hostcollectors.WriteExcluded(defaults.PathToExcludedHostCollectors(), excluded); err != nil {
+		return fmt.Errorf("unable to write excluded host collectors: %w", err)
+	}
+	return nil
+}
+
+// writeStorageSpec persists the storage plan of this node so host operations and the
+// preflights know where the persistent volumes are stored.
+func writeStorageSpec(spec *ecv1beta1.StorageSpec) error {
+	if err := storageplan.Write(defaults.PathToStorageSpec(), spec); err != nil {
+		return fmt.Errorf("unable to write storage plan: %w", err)
+	}
+	return nil
+}
+
+// materializeFiles places the binaries and, on airgap installations, the airgap files on
+// disk. The airgap images are left in the bundle if airgapImages is false, nodes pulling
+// them from a registry don't need them.
+func materializeFiles(c *cli.Context, airgapImages bool) error {
 	mat := spinner.Start()
 	defer mat.Close()
 	mat.Infof("Materializing files")
@@ -359,7 +683,7 @@ func materializeFiles(c *cli.Context) error {
 		}
 		defer rawfile.Close()
 
-		if err := airgap.MaterializeAirgap(rawfile); err != nil {
+		if err := airgap.MaterializeAirgap(rawfile, airgapImages); err != nil {
 			err = fmt.Errorf("unable to materialize airgap files: %w", err)
 			return err
 		}
@@ -370,9 +694,57 @@ func materializeFiles(c *cli.Context) error {
 	return nil
 }
 
+// validateVendorChartImages makes sure all images referenced by the vendor charts are
+// present in the airgap bundle. We rather fail here than have pods failing to pull their
+// images once the installation is well underway.
+func validateVendorChartImages(c *cli.Context) error {
+	cfg, err := release.GetEmbeddedClusterConfig()
+	if err != nil {
+		return fmt.Errorf("unable to get embedded cluster config: %w", err)
+	}
+	if cfg == nil || cfg.Spec.Extensions.Helm == nil || len(cfg.Spec.Extensions.Helm.Charts) == 0 {
+		return nil
+	}
+
+	images, err := airgap.VendorChartImages(cfg.Spec.Extensions.Helm.Charts)
+	if err != nil {
+		return fmt.Errorf("unable to list vendor chart images: %w", err)
+	}
+
+	rawfile, err := os.Open(c.String("airgap-bundle"))
+	if err != nil {
+		return fmt.Errorf("failed to open airgap file: %w", err)
+	}
+	defer rawfile.Close()
+	saved, err := airgap.SavedImages(rawfile)
+	if err != nil {
+		return fmt.Errorf("unable to read airgap bundle images: %w", err)
+	}
+
+	missing := airgap.MissingImages(images, saved, defaults.ProxyRegistryAddress)
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf(
+		"the following images are referenced by the application but are missing from the airgap bundle:\n  %s",
+		strings.Join(missing, "\n  "),
+	)
+}
+
+// applyEncryptionAtRest configures the provided k0s config to encrypt secrets at rest
+// and generates the encryption key.
+func applyEncryptionAtRest(cfg *k0sconfig.ClusterConfig) error {
+	if err := encryption.WriteConfig(); err != nil {
+		return fmt.Errorf("unable to write encryption config: %w", err)
+	}
+	config.ApplyEncryption(cfg)
+	return nil
+}
+
 // createK0sConfig creates a new k0s.yaml configuration file. The file is saved in the
 // global location (as returned by defaults.PathToK0sConfig()). If a file already sits
-// there, this function returns an error.
+// there, this function returns an error. The encryption key and the audit policy the
+// configuration refers to are written too.
 func ensureK0sConfig(c *cli.Context, applier *addons.Applier) (*k0sconfig.ClusterConfig, error) {
 	cfgpath := defaults.PathToK0sConfig()
 	if _, err := os.Stat(cfgpath); err == nil {
@@ -381,40 +753,102 @@ func ensureK0sConfig(c *cli.Context, applier *addons.Applier) (*k0sconfig.Cluste
 	if err := os.MkdirAll(filepath.Dir(cfgpath), 0755); err != nil {
 		return nil, fmt.Errorf("unable to create directory: %w", err)
 	}
-	cfg := config.RenderK0sConfig()
+	if err := encryption.WriteConfig(); err != nil {
+		return nil, fmt.Errorf("unable to write encryption config: %w", err)
+	}
+	if c.String("hardening") != "" {
+		if err := hardening.WriteAuditPolicy(); err != nil {
+			return nil, fmt.Errorf("unable to write audit policy: %w", err)
+		}
+	}
+	cfg, err := renderInstallK0sConfig(c, applier)
+	if err != nil {
+		return nil, err
+	}
+	data, err := k8syaml.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal config: %w", err)
+	}
+	fp, err := os.OpenFile(cfgpath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create config file: %w", err)
+	}
+	defer fp.Close()
+	if _, err := fp.Write(data); err != nil {
+		return nil, fmt.Errorf("unable to write config file: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// renderInstallK0sConfig renders the k0s configuration the node is installed with, the
+// helm charts of the addons included and the unsupported overrides applied. Nothing is
+// written to the host.
+func renderInstallK0sConfig(c *cli.Context, applier *addons.Applier) (*k0sconfig.ClusterConfig, error) {
 	address, err := netutils.FirstValidAddress(c.String("network-interface"))
 	if err != nil {
 		return nil, fmt.Errorf("unable to find first valid address: %w", err)
 	}
+	return renderK0sConfigForAddress(c, applier, address)
+}
+
+// renderK0sConfigForAddress renders the k0s configuration of a controller listening on
+// the address, see renderInstallK0sConfig.
+func renderK0sConfigForAddress(c *cli.Context, applier *addons.Applier, address string) (*k0sconfig.ClusterConfig, error) {
+	cfg := config.RenderK0sConfig()
 	cfg.Spec.API.Address = address
 	cfg.Spec.Storage.Etcd.PeerAddress = address
 	cfg.Spec.Network.PodCIDR = c.String("pod-cidr")
 	cfg.Spec.Network.ServiceCIDR = c.String("service-cidr")
+	if c.Bool("fips") {
+		if err := config.ApplyFIPSSettings(cfg); err != nil {
+			return nil, fmt.Errorf("unable to apply fips settings: %w", err)
+		}
+	}
+	config.ApplyEncryption(cfg)
+	if profile := c.String("hardening"); profile != "" {
+		if err := config.ApplyHardening(cfg, profile); err != nil {
+			return nil, fmt.Errorf("unable to apply hardening profile: %w", err)
+		}
+	}
 	if err := config.UpdateHelmConfigs(applier, cfg); err != nil {
 		return nil, fmt.Errorf("unable to update helm configs: %w", err)
 	}
-	cfg, err = applyUnsupportedOverrides(c, cfg)
+	cfg, err := applyUnsupportedOverrides(c, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("unable to apply unsupported overrides: %w", err)
 	}
+	embcfg, err := release.GetEmbeddedClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get embedded cluster config: %w", err)
+	}
+	if embcfg != nil {
+		if err := config.ApplyComponents(cfg, &embcfg.Spec); err != nil {
+			return nil, err
+		}
+	}
 	if c.String("airgap-bundle") != "" {
 		// update the k0s config to install with airgap
 		airgap.RemapHelm(cfg)
 		airgap.SetAirgapConfig(cfg)
+		reg, err := getAirgapRegistry(c)
+		if err != nil {
+			return nil, err
+		}
+		if reg != nil {
+			airgap.RewriteK0sImages(cfg, reg.Address)
+		}
 	}
-	data, err := k8syaml.Marshal(cfg)
-	if err != nil {
-		return nil, fmt.Errorf("unable to marshal config: %w", err)
-	}
-	fp, err := os.OpenFile(cfgpath, os.O_RDWR|os.O_CREATE, 0600)
+	return cfg, nil
+}
+
+// preflightK0sConfig returns the k0s configuration the node is going to be installed
+// with, as far as the host preflights are concerned.
+func preflightK0sConfig(c *cli.Context) (*k0sconfig.ClusterConfig, error) {
+	cfg, err := applyUnsupportedOverrides(c, config.RenderK0sConfig())
 	if err != nil {
-		return nil, fmt.Errorf("unable to create config file: %w", err)
-	}
-	defer fp.Close()
-	if _, err := fp.Write(data); err != nil {
-		return nil, fmt.Errorf("unable to write config file: %w", err)
+		return nil, fmt.Errorf("unable to apply unsupported overrides: %w", err)
 	}
-
 	return cfg, nil
 }
 
@@ -422,20 +856,9 @@ func ensureK0sConfig(c *cli.Context, applier *addons.Applier) (*k0sconfig.Cluste
 // overrides embedded into the binary and after the ones provided by the user (--overrides).
 // we first apply the k0s config override and then apply the built in overrides.
 func applyUnsupportedOverrides(c *cli.Context, cfg *k0sconfig.ClusterConfig) (*k0sconfig.ClusterConfig, error) {
-	embcfg, err := release.GetEmbeddedClusterConfig()
+	cfg, err := applyReleaseOverrides(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("unable to get embedded cluster config: %w", err)
-	}
-	if embcfg != nil {
-		overrides := embcfg.Spec.UnsupportedOverrides.K0s
-		cfg, err = config.PatchK0sConfig(cfg, overrides)
-		if err != nil {
-			return nil, fmt.Errorf("unable to patch k0s config: %w", err)
-		}
-		cfg, err = config.ApplyBuiltInExtensionsOverrides(cfg, embcfg)
-		if err != nil {
-			return nil, fmt.Errorf("unable to release built in overrides: %w", err)
-		}
+		return nil, err
 	}
 
 	eucfg, err := helpers.ParseEndUserConfig(c.String("overrides"))
@@ -443,8 +866,12 @@ func applyUnsupportedOverrides(c *cli.Context, cfg *k0sconfig.ClusterConfig) (*k
 		return nil, fmt.Errorf("unable to process overrides file: %w", err)
 	}
 	if eucfg != nil {
+		allowed, err := allowedK0sOverrideFields()
+		if err != nil {
+			return nil, err
+		}
 		overrides := eucfg.Spec.UnsupportedOverrides.K0s
-		cfg, err = config.PatchK0sConfig(cfg, overrides)
+		cfg, err = config.PatchK0sConfig(cfg, overrides, config.WithAllowedFields(allowed))
 		if err != nil {
 			return nil, fmt.Errorf("unable to apply overrides: %w", err)
 		}
@@ -457,6 +884,40 @@ func applyUnsupportedOverrides(c *cli.Context, cfg *k0sconfig.ClusterConfig) (*k
 	return cfg, nil
 }
 
+// allowedK0sOverrideFields returns the k0s configuration fields the release allows end
+// users to override, any field can be overridden when empty.
+func allowedK0sOverrideFields() ([]string, error) {
+	embcfg, err := release.GetEmbeddedClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get embedded cluster config: %w", err)
+	}
+	if embcfg == nil {
+		return nil, nil
+	}
+	return embcfg.Spec.UnsupportedOverrides.AllowedK0sFields, nil
+}
+
+// applyReleaseOverrides applies the overrides embedded into the binary to the k0s
+// configuration.
+func applyReleaseOverrides(cfg *k0sconfig.ClusterConfig) (*k0sconfig.ClusterConfig, error) {
+	embcfg, err := release.GetEmbeddedClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get embedded cluster config: %w", err)
+	}
+	if embcfg == nil {
+		return cfg, nil
+	}
+	cfg, err = config.PatchK0sConfig(cfg, embcfg.Spec.UnsupportedOverrides.K0s)
+	if err != nil {
+		return nil, fmt.Errorf("unable to patch k0s config: %w", err)
+	}
+	cfg, err = config.ApplyBuiltInExtensionsOverrides(cfg, embcfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to release built in overrides: %w", err)
+	}
+	return cfg, nil
+}
+
 // installK0s runs the k0s install command and waits for it to finish. If no configuration
 // is found one is generated.
 func installK0s(c *cli.Context) error {
@@ -469,37 +930,201 @@ func installK0s(c *cli.Context) error {
 	if err != nil {
 		return fmt.Errorf("unable to find first valid address: %w", err)
 	}
-	if _, err := helpers.RunCommand(hstbin, config.InstallFlags(nodeIP)...); err != nil {
-		return fmt.Errorf("unable to install: %w", err)
+	labels, err := getTopologyLabels(c)
+	if err != nil {
+		return err
 	}
-	if _, err := helpers.RunCommand(hstbin, "start"); err != nil {
-		return fmt.Errorf("unable to start: %w", err)
+	if err := writeTopologyFiles(c); err != nil {
+		return err
 	}
-	return nil
-}
-
-// waitForK0s waits for the k0s API to be available. We wait for the k0s socket to
-// appear in the system and until the k0s status command to finish.
-func waitForK0s() error {
-	var success bool
-	for i := 0; i < 30; i++ {
-		time.Sleep(2 * time.Second)
-		spath := defaults.PathToK0sStatusSocket()
-		if _, err := os.Stat(spath); err != nil {
-			continue
-		}
-		success = true
-		break
+	embcfg, err := release.GetEmbeddedClusterConfig()
+	if err != nil {
+		return fmt.Errorf("unable to get embedded cluster config: %w", err)
 	}
-	if !success {
-		return fmt.Errorf("timeout waiting for %s", defaults.BinaryName())
+	var imagePull *ecv1beta1.ImagePull
+	var embspec *ecv1beta1.ConfigSpec
+	if embcfg != nil {
+		imagePull = embcfg.Spec.ImagePull
+		embspec = &embcfg.Spec
 	}
-	if _, err := helpers.RunCommand(defaults.K0sBinaryPath(), "status"); err != nil {
-		return fmt.Errorf("unable to get status: %w", err)
+	kubeletArgs, err := configureImagePull(c, imagePull)
+	if err != nil {
+		return err
 	}
+	kubeletArgs = append(kubeletArgs, containerHostKubeletArgs()...)
+	mirrors, err := getRegistryMirrors(c)
+	if err != nil {
+		return err
+	}
+	if err := registrymirror.Write(mirrors); err != nil {
+		return fmt.Errorf("unable to configure registry mirrors: %w", err)
+	}
+	configureConntrack(embspec)
+	if _, err := helpers.RunCommand(hstbin, config.InstallFlags(nodeIP, labels, kubeletArgs, config.DisabledComponents(embspec))...); err != nil {
+		return fmt.Errorf("unable to install: %w", err)
+	}
+	if err := writeDefaultNodeConfigDropIn(); err != nil {
+		return err
+	}
+	if _, err := helpers.RunCommand(hstbin, "start"); err != nil {
+		return fmt.Errorf("unable to start: %w", err)
+	}
+	return nil
+}
+
+// configureConntrack sizes the connection tracking table of this node for the workload
+// profile of the provided configuration. Failing to do so does not stop the installation,
+// the host preflights already warned about it and kube-proxy still sizes the table.
+func configureConntrack(cfg *ecv1beta1.ConfigSpec) {
+	size := conntrack.Max(conntrackConfig(cfg), runtime.NumCPU())
+	logrus.Debugf("sizing the connection tracking table to %d entries", size)
+	if err := conntrack.Configure(size); err != nil {
+		logrus.Warnf("Unable to size the connection tracking table: %v", err)
+	}
+}
+
+// conntrackConfig returns the connection tracking configuration, nil if there is none.
+func conntrackConfig(cfg *ecv1beta1.ConfigSpec) *ecv1beta1.Conntrack {
+	if cfg == nil {
+		return nil
+	}
+	return cfg.Conntrack
+}
+
+// configureImagePull tunes the image pulls on this node for the speed of its network
+// interface, values set in the provided configuration take precedence. The containerd
+// configuration is written to disk, the kubelet flags are returned.
+func configureImagePull(c *cli.Context, cfg *ecv1beta1.ImagePull) ([]string, error) {
+	iface, err := netutils.FirstValidInterface(c.String("network-interface"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to find network interface: %w", err)
+	}
+	speed := imagepull.InterfaceSpeed(iface)
+	settings := imagepull.Resolve(cfg, speed)
+	logrus.Debugf("tuning image pulls for interface %s at %d Mbps: %+v", iface, speed, settings)
+	if err := imagepull.WriteContainerdConfig(settings); err != nil {
+		return nil, fmt.Errorf("unable to configure image pulls: %w", err)
+	}
+	return imagepull.KubeletArgs(settings), nil
+}
+
+// containerHostKubeletArgs returns the kubelet flags needed when the node is itself an
+// LXC or systemd-nspawn container.
+func containerHostKubeletArgs() []string {
+	container := containerhost.Detect()
+	if container == "" {
+		return nil
+	}
+	userns := containerhost.InUserNamespace()
+	logrus.Debugf("node runs in a %s container (user namespace: %v)", container, userns)
+	return containerhost.KubeletArgs(container, userns)
+}
+
+// getRegistryMirrors returns the registry mirrors set in the install config file. The
+// credentials of the airgap registry are configured as a mirror of the registry itself,
+// unless the registry is already mirrored.
+func getRegistryMirrors(c *cli.Context) ([]ecv1beta1.RegistryMirror, error) {
+	var mirrors []ecv1beta1.RegistryMirror
+	if path := c.String("install-config"); path != "" {
+		cfg, err := readInstallConfig(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := registrymirror.Validate(cfg.RegistryMirrors); err != nil {
+			return nil, fmt.Errorf("invalid registry mirrors in %s: %w", path, err)
+		}
+		mirrors = cfg.RegistryMirrors
+	}
+	reg, err := getAirgapRegistry(c)
+	if err != nil || reg == nil || reg.Mirror() == nil {
+		return mirrors, err
+	}
+	for _, mirror := range mirrors {
+		if mirror.Registry == reg.Host() {
+			return mirrors, nil
+		}
+	}
+	return append(mirrors, *reg.Mirror()), nil
+}
+
+// getImagePullSecrets returns the registry credentials set in the install config file, the
+// operator copies them to the namespaces of the application.
+func getImagePullSecrets(c *cli.Context) ([]pullsecrets.Credential, error) {
+	path := c.String("install-config")
+	if path == "" {
+		return nil, nil
+	}
+	cfg, err := readInstallConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := pullsecrets.Validate(cfg.ImagePullSecrets); err != nil {
+		return nil, fmt.Errorf("invalid image pull secrets in %s: %w", path, err)
+	}
+	return cfg.ImagePullSecrets, nil
+}
+
+// getAirgapRegistry returns the existing registry the airgap images are pushed to, nil if
+// the images are hosted in the embedded registry.
+func getAirgapRegistry(c *cli.Context) (*airgap.Registry, error) {
+	address := strings.TrimSuffix(c.String("airgap-registry"), "/")
+	if address == "" {
+		if c.String("airgap-registry-auth") != "" {
+			return nil, fmt.Errorf("--airgap-registry-auth requires --airgap-registry")
+		}
+		return nil, nil
+	}
+	if c.String("airgap-bundle") == "" {
+		return nil, fmt.Errorf("--airgap-registry requires --airgap-bundle")
+	}
+	if err := airgap.ValidateRegistryAddress(address); err != nil {
+		return nil, err
+	}
+	reg := &airgap.Registry{Address: address}
+	if path := c.String("airgap-registry-auth"); path != "" {
+		username, password, err := airgap.ReadRegistryAuth(path, reg.Host())
+		if err != nil {
+			return nil, err
+		}
+		reg.Username, reg.Password = username, password
+	}
+	return reg, nil
+}
+
+// pushAirgapImages pushes the images of the airgap bundle to the airgap registry, nothing
+// is done if the images are hosted in the embedded registry. The images are streamed out
+// of the airgap bundle, they are pulled from the registry under their new names so they
+// are never extracted for containerd to import.
+func pushAirgapImages(c *cli.Context) error {
+	reg, err := getAirgapRegistry(c)
+	if err != nil || reg == nil {
+		return err
+	}
+	loading := spinner.Start()
+	loading.Infof("Pushing images to %s", reg.Address)
+	progress := func(image string) {
+		loading.Infof("Pushing %s to %s", image, reg.Address)
+	}
+	images := airgap.AirgapBundleImages(c.String("airgap-bundle"), runtime.GOARCH)
+	if err := airgap.PushImages(c.Context, images, *reg, progress); err != nil {
+		loading.CloseWithError()
+		return fmt.Errorf("unable to push images to %s: %w", reg.Address, err)
+	}
+	loading.Infof("Images pushed to %s!", reg.Address)
+	loading.Close()
 	return nil
 }
 
+// waitForK0s waits for the k0s services on the node to be ready. Controllers also wait
+// for etcd and the api server to be healthy. The wait is bounded by --node-ready-timeout.
+func waitForK0s(c *cli.Context, controller bool) error {
+	timeout := c.Duration("node-ready-timeout")
+	if timeout <= 0 {
+		timeout = k0sready.DefaultTimeout
+	}
+	return k0sready.Wait(c.Context, controller, timeout)
+}
+
 // installAndWaitForK0s installs the k0s binary and waits for it to be ready
 func installAndWaitForK0s(c *cli.Context, applier *addons.Applier, proxy *ecv1beta1.ProxySpec) (*k0sconfig.ClusterConfig, error) {
 	loading := spinner.Start()
@@ -508,27 +1133,31 @@ func installAndWaitForK0s(c *cli.Context, applier *addons.Applier, proxy *ecv1be
 	logrus.Debugf("creating k0s configuration file")
 	cfg, err := ensureK0sConfig(c, applier)
 	if err != nil {
-		err := fmt.Errorf("unable to create config file: %w", err)
+		err := ecerrors.Errorf(ecerrors.K0s, "unable to create config file: %w", err)
+		metrics.ReportApplyFinished(c, err)
+		return nil, err
+	}
+	if err := checkInterrupted(c.Context); err != nil {
 		metrics.ReportApplyFinished(c, err)
 		return nil, err
 	}
 	logrus.Debugf("creating systemd unit files")
-	if err := createSystemdUnitFiles(false, proxy, applier.GetLocalArtifactMirrorPort()); err != nil {
-		err := fmt.Errorf("unable to create systemd unit files: %w", err)
+	if err := createSystemdUnitFiles(false, k0sNodeIP(cfg), proxy, applier.GetLocalArtifactMirror()); err != nil {
+		err := ecerrors.Errorf(ecerrors.HostConfig, "unable to create systemd unit files: %w", err)
 		metrics.ReportApplyFinished(c, err)
 		return nil, err
 	}
 
 	logrus.Debugf("installing k0s")
 	if err := installK0s(c); err != nil {
-		err := fmt.Errorf("unable update cluster: %w", err)
+		err := ecerrors.Errorf(ecerrors.K0s, "unable update cluster: %w", err)
 		metrics.ReportApplyFinished(c, err)
 		return nil, err
 	}
 	loading.Infof("Waiting for %s node to be ready", defaults.BinaryName())
 	logrus.Debugf("waiting for k0s to be ready")
-	if err := waitForK0s(); err != nil {
-		err := fmt.Errorf("unable to wait for node: %w", err)
+	if err := waitForK0s(c, true); err != nil {
+		err := ecerrors.Errorf(ecerrors.K0s, "unable to wait for node: %w", err)
 		metrics.ReportApplyFinished(c, err)
 		return nil, err
 	}
@@ -536,11 +1165,85 @@ func installAndWaitForK0s(c *cli.Context, applier *addons.Applier, proxy *ecv1be
 	return cfg, nil
 }
 
+// scanAddonConflicts resolves the conflicts with the add-ons in the cluster of a previous run
+// before k0s applies the add-on charts again. When reconciling an installation that got to
+// create its installation object, the add-on charts in the cluster are its own and nothing
+// conflicts with them, the add-ons then converge in their outro.
+func scanAddonConflicts(c *cli.Context, reconciling bool, since time.Time) error {
+	if reconciling {
+		if created, err := installationCreated(c.Context); err != nil {
+			return err
+		} else if created {
+			return nil
+		}
+	}
+	cfg, err := getK0sConfigFromDisk()
+	if err != nil {
+		return err
+	}
+	logrus.Debugf("scanning for conflicting resources")
+	if err := resolveAddonConflicts(c, cfg, since); err != nil {
+		return ecerrors.WithKind(ecerrors.Addon, err)
+	}
+	return nil
+}
+
+// resolveAddonConflicts looks for resources left by a previous partial install or by other
+// tooling that would make the add-ons fail to install, and offers to remove them. Resources
+// created since the installation started are not considered.
+func resolveAddonConflicts(c *cli.Context, cfg *k0sconfig.ClusterConfig, since time.Time) error {
+	os.Setenv("KUBECONFIG", defaults.PathToKubeConfig())
+	kcli, err := kubeutils.KubeClient()
+	if err != nil {
+		return fmt.Errorf("unable to create kube client: %w", err)
+	}
+	var charts []k0sconfig.Chart
+	if cfg.Spec.Extensions != nil && cfg.Spec.Extensions.Helm != nil {
+		charts = cfg.Spec.Extensions.Helm.Charts
+	}
+	conflicts, err := addons.ScanConflicts(c.Context, kcli, charts, since)
+	if err != nil {
+		return fmt.Errorf("unable to scan for conflicting resources: %w", err)
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	logrus.Warn("The following resources conflict with the installation:")
+	cleanable := true
+	for _, conflict := range conflicts {
+		logrus.Warnf("  %s", conflict)
+		cleanable = cleanable && conflict.Cleanable()
+	}
+	if !cleanable {
+		return fmt.Errorf("found conflicting resources that can not be removed automatically")
+	}
+	if c.Bool("no-prompt") {
+		return fmt.Errorf("found %d conflicting resources, run the installation without --no-prompt to remove them", len(conflicts))
+	}
+	if !prompts.New().Confirm("Do you want to remove them?", false) {
+		return ErrNothingElseToAdd
+	}
+	if err := addons.CleanupConflicts(c.Context, kcli, conflicts); err != nil {
+		return fmt.Errorf("unable to remove conflicting resources: %w", err)
+	}
+	logrus.Info("Conflicting resources removed.")
+	return nil
+}
+
 // runOutro calls Outro() in all enabled addons by means of Applier.
 func runOutro(c *cli.Context, applier *addons.Applier, cfg *k0sconfig.ClusterConfig) error {
 	os.Setenv("KUBECONFIG", defaults.PathToKubeConfig())
 
-	metadata, err := gatherVersionMetadata(cfg)
+	embcfg, err := release.GetEmbeddedClusterConfig()
+	if err != nil {
+		return fmt.Errorf("unable to get embedded cluster config: %w", err)
+	}
+	var spec *ecv1beta1.ConfigSpec
+	if embcfg != nil {
+		spec = &embcfg.Spec
+	}
+	metadata, err := gatherVersionMetadata(cfg, config.DisabledComponents(spec))
 	if err != nil {
 		return fmt.Errorf("unable to gather release metadata: %w", err)
 	}
@@ -553,9 +1256,95 @@ func runOutro(c *cli.Context, applier *addons.Applier, cfg *k0sconfig.ClusterCon
 	return applier.Outro(c.Context, cfg, eucfg, metadata, c.String("network-interface"))
 }
 
+// validateStorage exercises the default storage class and records its capabilities in the
+// installation status for the application to consume. Failures only produce a warning,
+// the cluster is usable without the capabilities that could not be validated.
+func validateStorage(c *cli.Context, cfg *k0sconfig.ClusterConfig) error {
+	loading := spinner.Start()
+	loading.Infof("Validating storage")
+	kcli, err := kubeutils.KubeClient()
+	if err != nil {
+		loading.CloseWithError()
+		return fmt.Errorf("unable to create kube client: %w", err)
+	}
+	caps := storagecheck.Run(c.Context, kcli, storagecheck.Options{
+		Namespace: "kube-system",
+		Image:     cfg.Spec.Images.Pause.URI(),
+	})
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		in, err := kubeutils.GetLatestInstallation(c.Context, kcli)
+		if err != nil {
+			return err
+		}
+		in.Status.Storage = caps
+		return kcli.Status().Update(c.Context, in)
+	})
+	if err != nil {
+		loading.CloseWithError()
+		return fmt.Errorf("unable to record storage capabilities: %w", err)
+	}
+	loading.Closef(
+		"Storage validated (provisioning: %t, expansion: %t, snapshots: %t)",
+		caps.Provisioning, caps.Expansion, caps.Snapshots,
+	)
+	if caps.Reason != "" {
+		logrus.Warnf("Storage capabilities not available: %s", caps.Reason)
+	}
+	return nil
+}
+
+// validateAdminConsoleIdentity verifies the Admin Console identity configuration, from
+// the overrides file or the embedded cluster config, and the authentication mode before
+// the installation starts.
+func validateAdminConsoleIdentity(c *cli.Context) error {
+	eucfg, err := helpers.ParseEndUserConfig(c.String("overrides"))
+	if err != nil {
+		return fmt.Errorf("unable to process overrides file: %w", err)
+	}
+	identity, err := addons.AdminConsoleIdentity(eucfg)
+	if err != nil {
+		return err
+	}
+	return adminconsole.ValidateAuthMode(c.String("admin-console-auth"), identity)
+}
+
+// validateNodePlacement verifies the admin console and registry placement, from the
+// overrides file or the embedded cluster config, before the installation starts.
+func validateNodePlacement(c *cli.Context) error {
+	eucfg, err := helpers.ParseEndUserConfig(c.String("overrides"))
+	if err != nil {
+		return fmt.Errorf("unable to process overrides file: %w", err)
+	}
+	_, err = addons.NodePlacement(eucfg)
+	return err
+}
+
+// adminConsolePassword returns the Admin Console password provided by the user, read from
+// the file set with --admin-console-password-file if any.
+func adminConsolePassword(c *cli.Context) (string, error) {
+	path := c.String("admin-console-password-file")
+	if path == "" {
+		return c.String("admin-console-password"), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read the Admin Console password: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
 func maybeAskAdminConsolePassword(c *cli.Context) (string, error) {
+	userProvidedPassword, err := adminConsolePassword(c)
+	if err != nil {
+		return "", err
+	}
+	if mode := c.String("admin-console-auth"); mode != "" && mode != ecv1beta1.AdminConsoleAuthModePassword {
+		if userProvidedPassword != "" {
+			logrus.Warnf("Ignoring the Admin Console password, password authentication is not used with the %s authentication mode.", mode)
+		}
+		return "", nil
+	}
 	defaultPassword := "password"
-	userProvidedPassword := c.String("admin-console-password")
 	// If there's a user provided password we'll try that first
 	if userProvidedPassword != "" {
 		// Password isn't retyped so we provided it twice
@@ -603,26 +1392,59 @@ var installCommand = &cli.Command{
 		installRunPreflightsCommand,
 	},
 	Before: func(c *cli.Context) error {
-		if os.Getuid() != 0 {
-			return fmt.Errorf("install command must be run as root")
+		if target := c.String("target"); target != "" {
+			// the installation runs on the target, only validate the target here.
+			if _, err := remote.ParseTarget(target); err != nil {
+				return err
+			}
+			_, err := remote.ParseJumpHosts(c.StringSlice("ssh-jump"))
+			return err
+		}
+		if err := privileges.Check("install", hostAdminPrivileges()...); err != nil {
+			return err
+		}
+		if _, err := getTopologyLabels(c); err != nil {
+			return err
 		}
 		if c.String("airgap-bundle") != "" {
 			metrics.DisableMetrics()
 		}
-		return nil
+		if c.Bool("interactive") && c.Bool("no-prompt") {
+			return fmt.Errorf("--interactive and --no-prompt cannot be used together")
+		}
+		if c.Bool("interactive") && c.Bool("ui") {
+			return fmt.Errorf("--interactive and --ui cannot be used together")
+		}
+		if _, err := getInstallPhases(c); err != nil {
+			return err
+		}
+		return validateOutputFlag(c)
 	},
-	Flags: withProxyFlags(withSubnetCIDRFlags(
+	Flags: withInstallPhaseFlags(withEtcdSnapshotFlags(withProxyFlags(withSubnetCIDRFlags(withTopologyFlags(withAdminConsoleTLSFlags(withStorageFlags(
 		[]cli.Flag{
 			&cli.StringFlag{
 				Name:   "admin-console-password",
 				Usage:  fmt.Sprintf("Password for the Admin Console (minimum %d characters)", minAdminPasswordLength),
 				Hidden: false,
 			},
+			&cli.StringFlag{
+				Name:   "admin-console-password-file",
+				Usage:  "Path to a file holding the password for the Admin Console. Takes precedence over --admin-console-password.",
+				Hidden: true,
+			},
 			&cli.StringFlag{
 				Name:   "airgap-bundle",
 				Usage:  "Path to the air gap bundle. If set, the installation will complete without internet access.",
 				Hidden: true,
 			},
+			&cli.StringFlag{
+				Name:  "airgap-registry",
+				Usage: "Push the air gap images to this existing registry, host with an optional port and namespace, and pull them from there instead of deploying the embedded registry. Requires --airgap-bundle.",
+			},
+			&cli.StringFlag{
+				Name:  "airgap-registry-auth",
+				Usage: "Path to a docker config.json file with the credentials of the --airgap-registry",
+			},
 			&cli.StringFlag{
 				Name:    "license",
 				Aliases: []string{"l"},
@@ -639,9 +1461,40 @@ var installCommand = &cli.Command{
 				Usage: "Disable interactive prompts. The Admin Console password will be set to password.",
 				Value: false,
 			},
+			&cli.BoolFlag{
+				Name:  "interactive",
+				Usage: "Walk through the installation settings interactively. The settings can be saved for repeatable installs with --install-config.",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "ui",
+				Usage: "Serve a web interface guiding through the installation settings and showing the installation progress.",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:  "ui-address",
+				Usage: "Address the installation web interface listens on. Use the address or the name of a network interface to reach it from another machine, e.g. eth0:8800.",
+				Value: "127.0.0.1:8800",
+			},
+			&cli.StringFlag{
+				Name:  "target",
+				Usage: "Install on a remote machine, e.g. ssh://user@host:22. The binary and the files provided with flags are copied over ssh and the installation output is streamed back.",
+			},
+			&cli.StringFlag{
+				Name:  "ssh-identity",
+				Usage: "Private key used to authenticate to the --target machine. The ssh configuration and agent are used by default.",
+			},
+			&cli.StringSliceFlag{
+				Name:  "ssh-jump",
+				Usage: "Jump host the --target machine is reached through, e.g. ssh://user@bastion:22. Repeat the flag to chain jump hosts, in order. Jump hosts authenticate with the ssh configuration and agent.",
+			},
+			&cli.StringFlag{
+				Name:  "install-config",
+				Usage: "Path to a file with the installation settings, as saved by --interactive. Flags take precedence over the file.",
+			},
 			&cli.StringFlag{
 				Name:   "overrides",
-				Usage:  "File with an EmbeddedClusterConfig object to override the default configuration",
+				Usage:  "File with an EmbeddedClusterConfig object to override the default configuration. Files encrypted with sops are decrypted using the age key in SOPS_AGE_KEY or SOPS_AGE_KEY_FILE",
 				Hidden: true,
 			},
 			&cli.BoolFlag{
@@ -654,40 +1507,105 @@ var installCommand = &cli.Command{
 				Usage: "Path to a trusted private CA certificate file",
 			},
 			getAdminColsolePortFlag(),
+			getAdminConsoleAuthFlag(),
 			getLocalArtifactMirrorPortFlag(),
+			getLocalArtifactMirrorDiskQuotaFlag(),
+			getFIPSFlag(),
+			getHardeningFlag(),
+			getExcludeHostCollectorsFlag(),
+			getDiskBenchmarkFlag(),
+			getConfigureFirewallFlag(),
+			getEnableChronyFlag(),
+			getInstallPrereqsFlag(),
+			getIgnoreUnsupportedOSFlag(),
+			getNodeReadyTimeoutFlag(),
+			getTimeoutFlag(),
+			getOutputFlag(),
+			&cli.BoolFlag{
+				Name:  "force-reconcile",
+				Usage: "Complete the installation found on this machine instead of refusing to run. The phases already completed are detected and the host is converged to the desired state.",
+			},
 		},
-	)),
-	Action: func(c *cli.Context) error {
-		var err error
+	))))))),
+	Action: withRemoteInstall(withResultOutput(withTimeout(withInstallUI(func(c *cli.Context) error {
+		phases, err := getInstallPhases(c)
+		if err != nil {
+			return err
+		}
+		// the phases skipped by the user, the installation is only partial. The phases
+		// reconciling skips are already complete.
+		skipped := phases.skipped()
+		if len(skipped) > 0 {
+			logrus.Warnf("Skipping the %s installation phases, this installation is not supported.", strings.Join(skipped, ", "))
+		}
+		var reconcile *installState
+		if phases.runs(installPhaseK0s) {
+			logrus.Debugf("checking if %s is already installed", binName)
+			if installed, err := isAlreadyInstalled(); err != nil {
+				return err
+			} else if installed && c.Bool("force-reconcile") {
+				state, err := detectInstallState(c.Context)
+				if err != nil {
+					return err
+				}
+				logrus.Infof("An installation has been detected on this machine (%s), reconciling it.", state)
+				phases, reconcile = state.reconcile(phases), &state
+			} else if installed {
+				logrus.Errorf("An installation has been detected on this machine.")
+				logrus.Infof("If you want to reinstall, you need to remove the existing installation first.")
+				logrus.Infof("You can do this by running the following command:")
+				logrus.Infof("\n  sudo ./%s reset\n", binName)
+				logrus.Infof("To complete a partial installation instead, run the installation again with --force-reconcile.")
+				return ErrNothingElseToAdd
+			}
+		}
+		if err := maybeApplyInstallConfig(c); err != nil {
+			return err
+		}
+
 		proxy := getProxySpecFromFlags(c)
 		proxy, err = includeLocalIPInNoProxy(c, proxy)
 		if err != nil {
+			err = ecerrors.WithKind(ecerrors.Network, err)
 			metrics.ReportApplyFinished(c, err)
 			return err
 		}
 		setProxyEnv(proxy)
 
-		logrus.Debugf("checking if %s is already installed", binName)
-		if installed, err := isAlreadyInstalled(); err != nil {
+		metrics.ReportApplyStarted(c)
+		if c.Bool("fips") {
+			if err := fips.EnsureSupported(); err != nil {
+				err = ecerrors.WithKind(ecerrors.HostConfig, err)
+				metrics.ReportApplyFinished(c, err)
+				return err
+			}
+		}
+		if err := hardening.Validate(c.String("hardening")); err != nil {
+			metrics.ReportApplyFinished(c, err)
+			return err
+		}
+		if _, _, _, err := getAdminConsoleTLSFromFlags(c); err != nil {
+			metrics.ReportApplyFinished(c, err)
+			return err
+		}
+		if err := validateAdminConsoleIdentity(c); err != nil {
+			metrics.ReportApplyFinished(c, err)
+			return err
+		}
+		if err := validateNodePlacement(c); err != nil {
+			metrics.ReportApplyFinished(c, err)
 			return err
-		} else if installed {
-			logrus.Errorf("An installation has been detected on this machine.")
-			logrus.Infof("If you want to reinstall, you need to remove the existing installation first.")
-			logrus.Infof("You can do this by running the following command:")
-			logrus.Infof("\n  sudo ./%s reset\n", binName)
-			return ErrNothingElseToAdd
 		}
-		metrics.ReportApplyStarted(c)
 		logrus.Debugf("configuring network manager")
 		if err := configureNetworkManager(c); err != nil {
-			return fmt.Errorf("unable to configure network manager: %w", err)
+			return ecerrors.Errorf(ecerrors.HostConfig, "unable to configure network manager: %w", err)
 		}
 		logrus.Debugf("checking license matches")
 		license, err := getLicenseFromFilepath(c.String("license"))
 		if err != nil {
-			metricErr := fmt.Errorf("unable to get license: %w", err)
+			metricErr := ecerrors.Errorf(ecerrors.License, "unable to get license: %w", err)
 			metrics.ReportApplyFinished(c, metricErr)
-			return err // do not return the metricErr, as we want the user to see the error message without a prefix
+			return ecerrors.WithKind(ecerrors.License, err) // do not return the metricErr, as we want the user to see the error message without a prefix
 		}
 		isAirgap := c.String("airgap-bundle") != ""
 		if isAirgap {
@@ -700,23 +1618,60 @@ var installCommand = &cli.Command{
 			metrics.ReportApplyFinished(c, err)
 			return err
 		}
-		adminConsolePwd, err := maybeAskAdminConsolePassword(c)
-		if err != nil {
+		if err := config.CheckArchitecture(runtime.GOARCH, runtime.GOARCH); err != nil {
 			metrics.ReportApplyFinished(c, err)
 			return err
 		}
+		var adminConsolePwd string
+		if phases.runs(installPhaseAddons) {
+			if adminConsolePwd, err = maybeAskAdminConsolePassword(c); err != nil {
+				metrics.ReportApplyFinished(c, err)
+				return err
+			}
+		}
 
-		logrus.Debugf("materializing binaries")
-		if err := materializeFiles(c); err != nil {
+		if err := writeExcludedHostCollectors(c.StringSlice("exclude-host-collectors")); err != nil {
 			metrics.ReportApplyFinished(c, err)
 			return err
 		}
-		applier, err := getAddonsApplier(c, adminConsolePwd, proxy)
+		storage, err := getStorageSpecFromFlags(c)
+		if err != nil {
+			metrics.ReportApplyFinished(c, err)
+			return err
+		}
+		if err := writeStorageSpec(storage); err != nil {
+			metrics.ReportApplyFinished(c, err)
+			return err
+		}
+
+		if phases.runs(installPhaseMaterialize) {
+			logrus.Debugf("materializing binaries")
+			if err := materializeFiles(c, c.String("airgap-registry") == ""); err != nil {
+				metrics.ReportApplyFinished(c, err)
+				return err
+			}
+			if err := pushAirgapImages(c); err != nil {
+				err = ecerrors.WithKind(ecerrors.Network, err)
+				metrics.ReportApplyFinished(c, err)
+				return err
+			}
+			if isAirgap {
+				logrus.Debugf("validating vendor chart images")
+				if err := validateVendorChartImages(c); err != nil {
+					metrics.ReportApplyFinished(c, err)
+					return err
+				}
+			}
+		}
+		var applierOpts []addons.Option
+		if reconcile != nil {
+			applierOpts = append(applierOpts, addons.WithReconcile())
+		}
+		applier, err := getAddonsApplier(c, adminConsolePwd, proxy, applierOpts...)
 		if err != nil {
 			metrics.ReportApplyFinished(c, err)
 			return err
 		}
-		logrus.Debugf("running host preflights")
 		var replicatedAPIURL, proxyRegistryURL string
 		if license != nil {
 			replicatedAPIURL = license.Spec.Endpoint
@@ -732,30 +1687,168 @@ var installCommand = &cli.Command{
 		if err != nil {
 			return fmt.Errorf("unable to parse local artifact mirror port: %w", err)
 		}
+		if _, err := artifactmirror.ParseQuota(c.String("local-artifact-mirror-disk-quota")); err != nil {
+			return fmt.Errorf("unable to parse local artifact mirror disk quota: %w", err)
+		}
+
+		if _, err := getEtcdSnapshotConfig(c); err != nil {
+			return fmt.Errorf("unable to parse etcd snapshot flags: %w", err)
+		}
+
+		if _, err := getRegistryMirrors(c); err != nil {
+			return err
+		}
 
-		if err := RunHostPreflights(c, applier, replicatedAPIURL, proxyRegistryURL, isAirgap, proxy, adminConsolePort, localArtifactMirrorPort); err != nil {
+		if _, err := getImagePullSecrets(c); err != nil {
+			return err
+		}
+
+		if err := maybeInstallPrereqs(c, isAirgap); err != nil {
+			err = ecerrors.WithKind(ecerrors.HostConfig, err)
 			metrics.ReportApplyFinished(c, err)
-			if err == ErrPreflightsHaveFail {
-				return ErrNothingElseToAdd
+			return err
+		}
+
+		if err := maybeEnableChrony(c); err != nil {
+			err = ecerrors.WithKind(ecerrors.HostConfig, err)
+			metrics.ReportApplyFinished(c, err)
+			return err
+		}
+
+		if phases.runs(installPhasePreflights) {
+			resultFromContext(c.Context).startPhase(installPhasePreflights)
+			k0sCfg, err := preflightK0sConfig(c)
+			if err != nil {
+				metrics.ReportApplyFinished(c, err)
+				return err
+			}
+			logrus.Debugf("running host preflights")
+			warnings, err := RunHostPreflights(c, applier, replicatedAPIURL, proxyRegistryURL, isAirgap, c.Bool("fips"), proxy, adminConsolePort, localArtifactMirrorPort, nil, k0sCfg)
+			if err != nil {
+				err = ecerrors.WithKind(ecerrors.Preflight, err)
+				metrics.ReportApplyFinished(c, err)
+				if errors.Is(err, ErrPreflightsHaveFail) {
+					return errPreflightsReported
+				}
+				return err
+			}
+			if len(warnings) > 0 {
+				// the warnings are recorded in the installation, support needs to know the
+				// environment did not conform from the start.
+				applier, err = getAddonsApplier(c, adminConsolePwd, proxy, append(applierOpts, addons.WithOverriddenPreflightWarnings(warnings))...)
+				if err != nil {
+					metrics.ReportApplyFinished(c, err)
+					return err
+				}
+				metrics.ReportPreflightWarningsOverridden(c.Context, metrics.BaseURL(metrics.License(c)), metrics.ClusterID(), warnings)
+			}
+		}
+
+		if phases.verifiesSignatures() {
+			logrus.Debugf("verifying image signatures")
+			if err := verifyImageSignatures(c, applier); err != nil {
+				metrics.ReportApplyFinished(c, err)
+				return err
 			}
+		}
+
+		if err := checkInterrupted(c.Context); err != nil {
+			metrics.ReportApplyFinished(c, err)
 			return err
 		}
+		if phases.runs(installPhaseHostConfig) {
+			logrus.Debugf("configuring firewall")
+			if err := configureFirewall(c, adminConsolePort, localArtifactMirrorPort, false); err != nil {
+				err = ecerrors.Errorf(ecerrors.HostConfig, "unable to configure firewall: %w", err)
+				metrics.ReportApplyFinished(c, err)
+				return err
+			}
 
-		cfg, err := installAndWaitForK0s(c, applier, proxy)
-		if err != nil {
+			logrus.Debugf("configuring selinux")
+			if err := configureSELinux(); err != nil {
+				err = ecerrors.WithKind(ecerrors.HostConfig, err)
+				metrics.ReportApplyFinished(c, err)
+				return err
+			}
+		}
+
+		if err := checkInterrupted(c.Context); err != nil {
+			metrics.ReportApplyFinished(c, err)
 			return err
 		}
+		installStart := time.Now()
+		if phases.runs(installPhaseAddons) && (!phases.runs(installPhaseK0s) || reconcile != nil && reconcile.K0sReady) {
+			// the cluster of a previous run is up, conflicts are resolved before its
+			// configuration is applied again and the add-ons are installed on top of it.
+			if err := scanAddonConflicts(c, reconcile != nil, installStart); err != nil {
+				metrics.ReportApplyFinished(c, err)
+				return err
+			}
+		}
+		var cfg *k0sconfig.ClusterConfig
+		if phases.runs(installPhaseK0s) {
+			resultFromContext(c.Context).startPhase(installPhaseK0s)
+			if reconcile != nil {
+				if cfg, err = reconcileK0s(c, applier, proxy, *reconcile); err != nil {
+					return err
+				}
+			} else if cfg, err = installAndWaitForK0s(c, applier, proxy); err != nil {
+				return err
+			}
+			logrus.Debugf("configuring etcd snapshots")
+			if err := configureEtcdSnapshots(c); err != nil {
+				err = ecerrors.Errorf(ecerrors.HostConfig, "unable to configure etcd snapshots: %w", err)
+				metrics.ReportApplyFinished(c, err)
+				return err
+			}
+			if embcfg, err := release.GetEmbeddedClusterConfig(); err != nil {
+				logrus.Warnf("Unable to read the embedded cluster config, the watchdog is not configured: %v", err)
+			} else if embcfg != nil {
+				configureWatchdog(&embcfg.Spec)
+			}
+		} else if phases.runs(installPhaseAddons) {
+			// the addons are installed in the cluster of a previous run.
+			if cfg, err = getK0sConfigFromDisk(); err != nil {
+				metrics.ReportApplyFinished(c, err)
+				return err
+			}
+		}
+
+		if !phases.runs(installPhaseAddons) {
+			reportInstallFinished(c, skipped)
+			return nil
+		}
+		if err := checkInterrupted(c.Context); err != nil {
+			metrics.ReportApplyFinished(c, err)
+			return err
+		}
+		resultFromContext(c.Context).startPhase(installPhaseAddons)
 		logrus.Debugf("running outro")
 		if err := runOutro(c, applier, cfg); err != nil {
+			err = ecerrors.WithKind(ecerrors.Addon, err)
 			metrics.ReportApplyFinished(c, err)
 			return err
 		}
-		metrics.ReportApplyFinished(c, nil)
+		recordRenderSnapshot(c, cfg)
+		logrus.Debugf("validating storage")
+		if err := validateStorage(c, cfg); err != nil {
+			metrics.ReportApplyFinished(c, err)
+			return err
+		}
+		if err := recordInstallResult(c, applier); err != nil {
+			return err
+		}
+		if !isAirgap {
+			cacheChannelMetadata(c.Context, license)
+		}
+		reportInstallFinished(c, skipped)
 		return nil
-	},
+	})))),
 }
 
-func getAddonsApplier(c *cli.Context, adminConsolePwd string, proxy *ecv1beta1.ProxySpec) (*addons.Applier, error) {
+// getAddonsApplier returns the applier configured by the flags, the extra options are
+// applied last.
+func getAddonsApplier(c *cli.Context, adminConsolePwd string, proxy *ecv1beta1.ProxySpec, extra ...addons.Option) (*addons.Applier, error) {
 	opts := []addons.Option{}
 	if c.Bool("no-prompt") {
 		opts = append(opts, addons.WithoutPrompt())
@@ -766,6 +1859,43 @@ func getAddonsApplier(c *cli.Context, adminConsolePwd string, proxy *ecv1beta1.P
 	if ab := c.String("airgap-bundle"); ab != "" {
 		opts = append(opts, addons.WithAirgapBundle(ab))
 	}
+	reg, err := getAirgapRegistry(c)
+	if err != nil {
+		return nil, err
+	}
+	if reg != nil {
+		opts = append(opts, addons.WithAirgapRegistry(*reg))
+	}
+	if c.Bool("fips") {
+		opts = append(opts, addons.WithFIPS())
+	}
+	if profile := c.String("hardening"); profile != "" {
+		opts = append(opts, addons.WithHardening(profile))
+	}
+	if excluded := c.StringSlice("exclude-host-collectors"); len(excluded) > 0 {
+		opts = append(opts, addons.WithExcludedHostCollectors(excluded))
+	}
+	mirrors, err := getRegistryMirrors(c)
+	if err != nil {
+		return nil, err
+	}
+	if len(mirrors) > 0 {
+		opts = append(opts, addons.WithRegistryMirrors(mirrors))
+	}
+	pullSecrets, err := getImagePullSecrets(c)
+	if err != nil {
+		return nil, err
+	}
+	if len(pullSecrets) > 0 {
+		opts = append(opts, addons.WithImagePullSecrets(pullSecrets))
+	}
+	cert, key, hostname, err := getAdminConsoleTLSFromFlags(c)
+	if err != nil {
+		return nil, err
+	}
+	if len(cert) > 0 {
+		opts = append(opts, addons.WithAdminConsoleTLS(cert, key, hostname))
+	}
 	if proxy != nil {
 		opts = append(opts, addons.WithProxy(proxy.HTTPProxy, proxy.HTTPSProxy, proxy.NoProxy))
 	}
@@ -794,16 +1924,25 @@ func getAddonsApplier(c *cli.Context, adminConsolePwd string, proxy *ecv1beta1.P
 		return nil, err
 	}
 	opts = append(opts, addons.WithAdminConsolePort(adminConsolePort))
+	opts = append(opts, addons.WithAdminConsoleAuthMode(c.String("admin-console-auth")))
 
 	localArtifactMirrorPort, err := getLocalArtifactMirrorPortFromFlag(c)
 	if err != nil {
 		return nil, err
 	}
 	opts = append(opts, addons.WithLocalArtifactMirrorPort(localArtifactMirrorPort))
+	opts = append(opts, addons.WithLocalArtifactMirrorDiskQuota(c.String("local-artifact-mirror-disk-quota")))
+
+	storage, err := getStorageSpecFromFlags(c)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, addons.WithStorage(storage))
 
 	if adminConsolePwd != "" {
 		opts = append(opts, addons.WithAdminConsolePassword(adminConsolePwd))
 	}
+	opts = append(opts, extra...)
 	return addons.NewApplier(opts...), nil
 }
 
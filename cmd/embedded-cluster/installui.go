@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	k8snet "k8s.io/utils/net"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/installui"
+	"github.com/replicatedhq/embedded-cluster/pkg/netutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/release"
+	"github.com/replicatedhq/embedded-cluster/pkg/spinner"
+)
+
+// withInstallUI wraps the install action to serve the installation web interface when
+// --ui is set. The interface collects the installation settings, see
+// maybeApplyInstallConfig, and streams the installation progress until it finishes.
+func withInstallUI(action cli.ActionFunc) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		if !c.Bool("ui") {
+			return action(c)
+		}
+		srv, err := startInstallUI(c)
+		if err != nil {
+			return err
+		}
+		logrus.Infof("Open the following url in a browser to continue the installation:\n\n  %s\n", srv.URL())
+		logrus.AddHook(srv)
+		spinner.SetDefaultOptions(spinner.WithObserver(srv.Progress))
+		c.Context = installui.NewContext(c.Context, srv)
+		err = action(c)
+		if errors.Is(err, ErrNothingElseToAdd) {
+			srv.Finish(fmt.Errorf("installation failed, see the messages above"))
+		} else {
+			srv.Finish(err)
+		}
+		return err
+	}
+}
+
+// startInstallUI starts serving the installation web interface on --ui-address.
+func startInstallUI(c *cli.Context) (*installui.Server, error) {
+	address, err := resolveUIAddress(c.String("ui-address"))
+	if err != nil {
+		return nil, err
+	}
+	rel, err := release.GetChannelRelease()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get release from binary: %w", err)
+	}
+	interfaces, err := netutils.ListValidInterfaceNames()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list network interfaces: %w", err)
+	}
+	adminConsolePort, err := getAdminConsolePortFromFlag(c)
+	if err != nil {
+		return nil, err
+	}
+	localArtifactMirrorPort, err := getLocalArtifactMirrorPortFromFlag(c)
+	if err != nil {
+		return nil, err
+	}
+	opts := installui.Options{
+		AppName: binName,
+		Defaults: installui.Settings{
+			AdminConsolePort:        adminConsolePort,
+			LocalArtifactMirrorPort: localArtifactMirrorPort,
+			NetworkInterface:        c.String("network-interface"),
+			License:                 c.String("license"),
+			HTTPProxy:               c.String("http-proxy"),
+			HTTPSProxy:              c.String("https-proxy"),
+			NoProxy:                 c.String("no-proxy"),
+		},
+		NetworkInterfaces: interfaces,
+		Licenses:          findLicenseFiles("."),
+		LicenseRequired:   rel != nil,
+		Validate:          validateUISettings,
+	}
+	if rel != nil {
+		opts.AppName = rel.AppSlug
+	}
+	srv, err := installui.New(address, opts)
+	if err != nil {
+		return nil, err
+	}
+	srv.Start()
+	return srv, nil
+}
+
+// resolveUIAddress returns the address to listen on. The host can be the name of a
+// network interface, the interface address is used in that case.
+func resolveUIAddress(address string) (string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", fmt.Errorf("invalid ui address %s: %w", address, err)
+	}
+	if host == "" || host == "localhost" || net.ParseIP(host) != nil {
+		return address, nil
+	}
+	ip, err := netutils.FirstValidAddress(host)
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve the ui address: %w", err)
+	}
+	return net.JoinHostPort(ip, port), nil
+}
+
+// validateUISettings validates the settings submitted through the installation web
+// interface, errors are shown to the operator in the form.
+func validateUISettings(settings installui.Settings) error {
+	if len(settings.AdminConsolePassword) < minAdminPasswordLength {
+		return fmt.Errorf("the Admin Console password must have at least %d characters", minAdminPasswordLength)
+	}
+	if _, err := k8snet.ParsePort(fmt.Sprint(settings.AdminConsolePort), false); err != nil {
+		return fmt.Errorf("invalid admin console port: %w", err)
+	}
+	if _, err := k8snet.ParsePort(fmt.Sprint(settings.LocalArtifactMirrorPort), false); err != nil {
+		return fmt.Errorf("invalid local artifact mirror port: %w", err)
+	}
+	if settings.AdminConsolePort == settings.LocalArtifactMirrorPort {
+		return fmt.Errorf("local artifact mirror port cannot be the same as admin console port")
+	}
+	if _, err := getLicenseFromFilepath(settings.License); err != nil {
+		return err
+	}
+	return nil
+}
+
+// applyUISettings sets the install flags to the settings submitted through the
+// installation web interface. Prompts are disabled as nobody watches the terminal.
+func applyUISettings(c *cli.Context, settings installui.Settings) error {
+	cfg := installConfig{
+		AdminConsolePort:        settings.AdminConsolePort,
+		LocalArtifactMirrorPort: settings.LocalArtifactMirrorPort,
+		NetworkInterface:        settings.NetworkInterface,
+		License:                 settings.License,
+		HTTPProxy:               settings.HTTPProxy,
+		HTTPSProxy:              settings.HTTPSProxy,
+		NoProxy:                 settings.NoProxy,
+	}
+	flags := cfg.flags()
+	flags["admin-console-password"] = settings.AdminConsolePassword
+	flags["no-prompt"] = "true"
+	for name, value := range flags {
+		if err := c.Set(name, value); err != nil {
+			return fmt.Errorf("unable to set %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/installui"
+)
+
+func TestResolveUIAddress(t *testing.T) {
+	address, err := resolveUIAddress("127.0.0.1:8800")
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:8800", address)
+
+	address, err = resolveUIAddress(":8800")
+	require.NoError(t, err)
+	assert.Equal(t, ":8800", address)
+
+	_, err = resolveUIAddress("8800")
+	assert.Error(t, err)
+
+	_, err = resolveUIAddress("does-not-exist0:8800")
+	assert.Error(t, err)
+}
+
+func TestValidateUISettings(t *testing.T) {
+	valid := installui.Settings{AdminConsolePassword: "password", AdminConsolePort: 30000, LocalArtifactMirrorPort: 50000}
+	// the license is checked against the release embedded in the binary, if any.
+	if err := validateUISettings(valid); err != nil {
+		assert.ErrorContains(t, err, "license")
+	}
+
+	short := valid
+	short.AdminConsolePassword = "pass"
+	assert.ErrorContains(t, validateUISettings(short), "at least 6 characters")
+
+	samePorts := valid
+	samePorts.LocalArtifactMirrorPort = 30000
+	assert.ErrorContains(t, validateUISettings(samePorts), "cannot be the same")
+
+	invalidPort := valid
+	invalidPort.AdminConsolePort = 70000
+	assert.ErrorContains(t, validateUISettings(invalidPort), "invalid admin console port")
+}
+
+func TestApplyUISettings(t *testing.T) {
+	c := newInstallTestContext(t, map[string]string{"admin-console-port": "31000"})
+	require.NoError(t, applyUISettings(c, installui.Settings{
+		AdminConsolePassword:    "password",
+		AdminConsolePort:        32000,
+		LocalArtifactMirrorPort: 50000,
+		NetworkInterface:        "eth1",
+	}))
+	assert.Equal(t, "32000", c.String("admin-console-port"), "settings entered in the browser take precedence")
+	assert.Equal(t, "eth1", c.String("network-interface"))
+	assert.Equal(t, "password", c.String("admin-console-password"))
+	assert.True(t, c.Bool("no-prompt"))
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	ecerrors "github.com/replicatedhq/embedded-cluster/pkg/errors"
+)
+
+// withTimeout wraps the action to stop it once the duration of the --timeout flag has
+// elapsed. Errors returned once the command was interrupted, by its timeout or by the
+// user, are classified as interruptions so the user is told how to clean up the host.
+func withTimeout(action cli.ActionFunc) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		if timeout := c.Duration("timeout"); timeout > 0 {
+			ctx, cancel := context.WithTimeoutCause(c.Context, timeout, fmt.Errorf("timed out after %s", timeout))
+			defer cancel()
+			c.Context = ctx
+		}
+		err := action(c)
+		if err == nil || c.Context.Err() == nil || ecerrors.KindOf(err) == ecerrors.Interrupted {
+			return err
+		}
+		return ecerrors.WithKind(ecerrors.Interrupted, err)
+	}
+}
+
+// checkInterrupted returns an error if the command was interrupted. It is called between
+// the steps configuring the host, the steps themselves are not interrupted so systemd
+// units and configuration files are never left half written.
+func checkInterrupted(ctx context.Context) error {
+	if ctx.Err() == nil {
+		return nil
+	}
+	return ecerrors.Errorf(ecerrors.Interrupted, "interrupted: %w", context.Cause(ctx))
+}
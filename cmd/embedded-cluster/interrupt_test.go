@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+
+	ecerrors "github.com/replicatedhq/embedded-cluster/pkg/errors"
+)
+
+func TestWithTimeout(t *testing.T) {
+	newContext := func(timeout string) *cli.Context {
+		flagSet := flag.NewFlagSet("test", 0)
+		require.NoError(t, getTimeoutFlag().Apply(flagSet))
+		require.NoError(t, flagSet.Set("timeout", timeout))
+		c := cli.NewContext(cli.NewApp(), flagSet, nil)
+		c.Context = context.Background()
+		return c
+	}
+
+	// the steps after the timeout are not run and the failure is an interruption.
+	steps := 0
+	err := withTimeout(func(c *cli.Context) error {
+		for i := 0; i < 3; i++ {
+			if err := checkInterrupted(c.Context); err != nil {
+				return err
+			}
+			steps++
+			<-c.Context.Done()
+		}
+		return nil
+	})(newContext("50ms"))
+	assert.Equal(t, 1, steps)
+	assert.Equal(t, ecerrors.Interrupted, ecerrors.KindOf(err))
+	assert.ErrorContains(t, err, "timed out after 50ms")
+
+	// failures while interrupted are interruptions whatever their kind.
+	err = withTimeout(func(c *cli.Context) error {
+		<-c.Context.Done()
+		return ecerrors.Errorf(ecerrors.K0s, "unable to wait for node: %w", c.Context.Err())
+	})(newContext("10ms"))
+	assert.Equal(t, ecerrors.Interrupted, ecerrors.KindOf(err))
+	assert.Equal(t, 10, ecerrors.ExitCode(err))
+
+	// failures of commands not interrupted keep their kind, no timeout by default.
+	err = withTimeout(func(c *cli.Context) error {
+		_, ok := c.Context.Deadline()
+		assert.False(t, ok)
+		return ecerrors.Errorf(ecerrors.K0s, "unable to start: %w", fmt.Errorf("boom"))
+	})(newContext("0s"))
+	assert.Equal(t, ecerrors.K0s, ecerrors.KindOf(err))
+
+	assert.NoError(t, withTimeout(func(c *cli.Context) error { return nil })(newContext(time.Minute.String())))
+}
@@ -4,9 +4,13 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -25,24 +29,45 @@ import (
 	"github.com/replicatedhq/embedded-cluster/pkg/airgap"
 	"github.com/replicatedhq/embedded-cluster/pkg/config"
 	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/encryption"
+	ecerrors "github.com/replicatedhq/embedded-cluster/pkg/errors"
+	"github.com/replicatedhq/embedded-cluster/pkg/fips"
+	"github.com/replicatedhq/embedded-cluster/pkg/goods"
 	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
 	"github.com/replicatedhq/embedded-cluster/pkg/highavailability"
+	"github.com/replicatedhq/embedded-cluster/pkg/hostconfig"
+	"github.com/replicatedhq/embedded-cluster/pkg/joincheck"
 	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
 	"github.com/replicatedhq/embedded-cluster/pkg/metrics"
+	"github.com/replicatedhq/embedded-cluster/pkg/netcheck"
 	"github.com/replicatedhq/embedded-cluster/pkg/netutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/nodeconfig"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
 	"github.com/replicatedhq/embedded-cluster/pkg/prompts"
 	"github.com/replicatedhq/embedded-cluster/pkg/spinner"
+	"github.com/replicatedhq/embedded-cluster/pkg/storageplan"
 	"github.com/replicatedhq/embedded-cluster/pkg/versions"
 )
 
 // JoinCommandResponse is the response from the kots api we use to fetch the k0s join token.
 type JoinCommandResponse struct {
-	K0sJoinCommand         string                     `json:"k0sJoinCommand"`
-	K0sToken               string                     `json:"k0sToken"`
-	ClusterID              uuid.UUID                  `json:"clusterID"`
-	EmbeddedClusterVersion string                     `json:"embeddedClusterVersion"`
-	AirgapRegistryAddress  string                     `json:"airgapRegistryAddress"`
-	InstallationSpec       ecv1beta1.InstallationSpec `json:"installationSpec,omitempty"`
+	K0sJoinCommand         string    `json:"k0sJoinCommand"`
+	K0sToken               string    `json:"k0sToken"`
+	ClusterID              uuid.UUID `json:"clusterID"`
+	EmbeddedClusterVersion string    `json:"embeddedClusterVersion"`
+	AirgapRegistryAddress  string    `json:"airgapRegistryAddress"`
+	// InstallationSpec is the spec of the latest installation, the passwords of the registry
+	// mirrors are read from the registry mirrors secret it references them in.
+	InstallationSpec ecv1beta1.InstallationSpec `json:"installationSpec,omitempty"`
+	// EncryptionConfig is the encryption at rest configuration shared by the controllers,
+	// as stored in the cluster. Only returned to joining controllers.
+	EncryptionConfig string `json:"encryptionConfig,omitempty"`
+	// ControllerAddresses are the internal addresses of the controller nodes, the round
+	// trip time to the kubernetes api of each of them is measured before joining.
+	ControllerAddresses []string `json:"controllerAddresses,omitempty"`
+	// ClockSkew is the difference between the clock of this node and the clock of the
+	// node serving the join request. It is not part of the response body.
+	ClockSkew time.Duration `json:"-"`
 }
 
 // extractK0sConfigOverridePatch parses the provided override and returns a dig.Mapping that
@@ -75,6 +100,22 @@ func (j JoinCommandResponse) EmbeddedOverrides() (dig.Mapping, error) {
 	return j.extractK0sConfigOverridePatch([]byte(j.InstallationSpec.Config.UnsupportedOverrides.K0s))
 }
 
+// PreflightK0sConfig returns the k0s configuration of the cluster being joined, as far
+// as the host preflights are concerned.
+func (j JoinCommandResponse) PreflightK0sConfig() (*k0sconfig.ClusterConfig, error) {
+	cfg := config.RenderK0sConfig()
+	var err error
+	if j.InstallationSpec.Config != nil {
+		if cfg, err = config.PatchK0sConfig(cfg, j.InstallationSpec.Config.UnsupportedOverrides.K0s); err != nil {
+			return nil, fmt.Errorf("unable to patch k0s config: %w", err)
+		}
+	}
+	if cfg, err = config.PatchK0sConfig(cfg, j.InstallationSpec.EndUserK0sConfigOverrides); err != nil {
+		return nil, fmt.Errorf("unable to apply overrides: %w", err)
+	}
+	return cfg, nil
+}
+
 // getJoinToken issues a request to the kots api to get the actual join command
 // based on the short token provided by the user.
 func getJoinToken(ctx context.Context, baseURL, shortToken string) (*JoinCommandResponse, error) {
@@ -88,10 +129,12 @@ func getJoinToken(ctx context.Context, baseURL, shortToken string) (*JoinCommand
 
 	// this will generally be a self-signed certificate created by kurl-proxy
 	insecureClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	start := time.Now()
 	resp, err := insecureClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get join token: %w", err)
 	}
+	end := time.Now()
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
@@ -100,9 +143,42 @@ func getJoinToken(ctx context.Context, baseURL, shortToken string) (*JoinCommand
 	if err := json.NewDecoder(resp.Body).Decode(&command); err != nil {
 		return nil, fmt.Errorf("unable to decode response: %w", err)
 	}
+	if skew, err := clockSkewFromDate(start, end, resp.Header.Get("Date")); err != nil {
+		logrus.Debugf("unable to determine clock skew with the cluster: %v", err)
+	} else {
+		command.ClockSkew = skew
+	}
 	return &command, nil
 }
 
+// clockSkewFromDate returns the difference between the local clock and the clock of the
+// server that answered a request sent at start and answered by end, based on the Date
+// header of the response. The header has a one second resolution, the server time is
+// assumed to be in the middle of that second and the answer to be sent in the middle of
+// the request.
+func clockSkewFromDate(start, end time.Time, date string) (time.Duration, error) {
+	if date == "" {
+		return 0, fmt.Errorf("no date header in response")
+	}
+	serverTime, err := http.ParseTime(date)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse date header: %w", err)
+	}
+	serverTime = serverTime.Add(500 * time.Millisecond)
+	localTime := start.Add(end.Sub(start) / 2)
+	return localTime.Sub(serverTime), nil
+}
+
+// installEncryptionConfig writes the encryption configuration shared by the controllers.
+// The configuration provided by the cluster in the join response takes precedence over
+// the one provided with the --encryption-config flag.
+func installEncryptionConfig(c *cli.Context, jcmd *JoinCommandResponse) error {
+	if jcmd.EncryptionConfig != "" {
+		return encryption.InstallConfigData([]byte(jcmd.EncryptionConfig))
+	}
+	return encryption.InstallConfig(c.String("encryption-config"))
+}
+
 // startAndWaitForK0s starts the k0s service and waits for the node to be ready.
 func startAndWaitForK0s(c *cli.Context, jcmd *JoinCommandResponse) error {
 	loading := spinner.Start()
@@ -110,17 +186,13 @@ func startAndWaitForK0s(c *cli.Context, jcmd *JoinCommandResponse) error {
 	loading.Infof("Installing %s node", binName)
 	logrus.Debugf("starting %s service", binName)
 	if err := startK0sService(); err != nil {
-		err := fmt.Errorf("unable to start service: %w", err)
-		metrics.ReportJoinFailed(c.Context, jcmd.InstallationSpec.MetricsBaseURL, jcmd.ClusterID, err)
-		return err
+		return ecerrors.Errorf(ecerrors.K0s, "unable to start service: %w", err)
 	}
 
 	loading.Infof("Waiting for %s node to be ready", binName)
 	logrus.Debugf("waiting for k0s to be ready")
-	if err := waitForK0s(); err != nil {
-		err := fmt.Errorf("unable to wait for node: %w", err)
-		metrics.ReportJoinFailed(c.Context, jcmd.InstallationSpec.MetricsBaseURL, jcmd.ClusterID, err)
-		return err
+	if err := waitForK0s(c, strings.Contains(jcmd.K0sJoinCommand, "controller")); err != nil {
+		return ecerrors.Errorf(ecerrors.K0s, "unable to wait for node: %w", err)
 	}
 
 	loading.Infof("Node installation finished!")
@@ -130,11 +202,11 @@ func startAndWaitForK0s(c *cli.Context, jcmd *JoinCommandResponse) error {
 var joinCommand = &cli.Command{
 	Name:      "join",
 	Usage:     fmt.Sprintf("Join the current node to a %s cluster", binName),
-	ArgsUsage: "<url> <token>",
+	ArgsUsage: "<url> <token> | <join token>",
 	Subcommands: []*cli.Command{
 		joinRunPreflightsCommand,
 	},
-	Flags: []cli.Flag{
+	Flags: withJoinRoleFlags(withTopologyFlags([]cli.Flag{
 		&cli.StringFlag{
 			Name:   "airgap-bundle",
 			Usage:  "Path to the air gap bundle. If set, the installation will complete without internet access.",
@@ -160,18 +232,57 @@ var joinCommand = &cli.Command{
 			Usage: "Skip host preflight checks. This is not recommended.",
 			Value: false,
 		},
-	},
+		&cli.StringFlag{
+			Name:  "encryption-config",
+			Usage: "Path to a copy of the encryption configuration of an existing controller. Only needed when the admin console does not provide it when joining controllers.",
+		},
+		&cli.StringSliceFlag{
+			Name:  "ephemeral-disk-path",
+			Usage: "Mount point of a disk that is reimaged when the host is patched. The join fails if the etcd or volume data would be stored in it. Can be specified multiple times.",
+		},
+		getConfigureFirewallFlag(),
+		getEnableChronyFlag(),
+		getInstallPrereqsFlag(),
+		getDiskBenchmarkFlag(),
+		getIgnoreUnsupportedOSFlag(),
+		getNodeReadyTimeoutFlag(),
+		getTimeoutFlag(),
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Validate the join and print the changes it would make to this host without making them.",
+		},
+		&cli.StringFlag{
+			Name:  "artifact-mirror",
+			Usage: "Address (host:port) of the artifact mirror the binaries are fetched from by agent builds and windows workers. Defaults to the mirror of the controller the join command points to.",
+		},
+		getOutputFlag(),
+	})),
 	Before: func(c *cli.Context) error {
-		if os.Getuid() != 0 {
-			return fmt.Errorf("join command must be run as root")
+		if err := validateJoinRole(c); err != nil {
+			return err
+		}
+		if !isWindowsWorkerJoin(c) {
+			if err := privileges.Check("join", hostAdminPrivileges()...); err != nil {
+				return err
+			}
+		}
+		if _, err := getTopologyLabels(c); err != nil {
+			return err
 		}
 		if c.String("airgap-bundle") != "" {
 			metrics.DisableMetrics()
 		}
+		if err := validateOutputFlag(c); err != nil {
+			return err
+		}
 		os.Setenv("KUBECONFIG", defaults.PathToKubeConfig())
 		return nil
 	},
-	Action: func(c *cli.Context) error {
+	Action: withResultOutput(withTimeout(func(c *cli.Context) error {
+		if isWindowsWorkerJoin(c) {
+			return joinWindowsWorker(c)
+		}
+
 		logrus.Debugf("checking if %s is already installed", binName)
 		if installed, err := isAlreadyInstalled(); err != nil {
 			return err
@@ -183,14 +294,18 @@ var joinCommand = &cli.Command{
 			return ErrNothingElseToAdd
 		}
 
-		if c.Args().Len() != 2 {
-			return fmt.Errorf("usage: %s join <url> <token>", binName)
+		target, err := parseJoinArgs(c, fmt.Sprintf("%s join <url> <token>", binName))
+		if err != nil {
+			return err
 		}
 
 		logrus.Debugf("fetching join token remotely")
-		jcmd, err := getJoinToken(c.Context, c.Args().Get(0), c.Args().Get(1))
+		jcmd, err := getJoinToken(c.Context, target.URL, target.Token)
 		if err != nil {
-			return fmt.Errorf("unable to get join token: %w", err)
+			return ecerrors.Errorf(ecerrors.Network, "unable to get join token: %w", err)
+		}
+		if err := target.scope(jcmd); err != nil {
+			return err
 		}
 
 		// check to make sure the version returned by the join token is the same as the one we are running
@@ -207,8 +322,27 @@ var joinCommand = &cli.Command{
 			return fmt.Errorf("no-proxy config %q does not allow access to local IP %q", jcmd.InstallationSpec.Proxy.NoProxy, localIP)
 		}
 
+		if jcmd.InstallationSpec.FIPS {
+			if err := fips.EnsureSupported(); err != nil {
+				return fmt.Errorf("the cluster runs in FIPS mode: %w", err)
+			}
+		}
+
+		isController := strings.Contains(jcmd.K0sJoinCommand, "controller")
+		if jcmd.InstallationSpec.EncryptionAtRest && isController && jcmd.EncryptionConfig == "" && c.String("encryption-config") == "" {
+			return fmt.Errorf(
+				"the cluster encrypts secrets at rest, copy %s from an existing controller and provide it with --encryption-config",
+				defaults.PathToEncryptionConfig(),
+			)
+		}
+
 		isAirgap := c.String("airgap-bundle") != ""
 
+		logrus.Debugf("checking the architecture of the node")
+		if err := checkJoinArchitecture(jcmd, runtime.GOARCH); err != nil {
+			return err
+		}
+
 		if isAirgap {
 			logrus.Debugf("checking airgap bundle matches binary")
 			if err := checkAirgapMatches(c); err != nil {
@@ -216,141 +350,214 @@ var joinCommand = &cli.Command{
 			}
 		}
 
-		metrics.ReportJoinStarted(c.Context, jcmd.InstallationSpec.MetricsBaseURL, jcmd.ClusterID)
-		logrus.Debugf("materializing %s binaries", binName)
-		if err := materializeFiles(c); err != nil {
-			metrics.ReportJoinFailed(c.Context, jcmd.InstallationSpec.MetricsBaseURL, jcmd.ClusterID, err)
-			return err
+		logrus.Debugf("validating connectivity to the cluster")
+		if err := checkJoinConnectivity(c, jcmd); err != nil {
+			return ecerrors.WithKind(ecerrors.Network, err)
 		}
 
-		applier, err := getAddonsApplier(c, "", jcmd.InstallationSpec.Proxy)
+		host, err := newJoinHost(c, jcmd, target.URL, isAirgap)
 		if err != nil {
-			metrics.ReportJoinFailed(c.Context, jcmd.InstallationSpec.MetricsBaseURL, jcmd.ClusterID, err)
 			return err
 		}
-
-		// jcmd.InstallationSpec.MetricsBaseURL is the replicated.app endpoint url
-		replicatedAPIURL := jcmd.InstallationSpec.MetricsBaseURL
-		proxyRegistryURL := fmt.Sprintf("https://%s", defaults.ProxyRegistryAddress)
-
-		urlSlices := strings.Split(c.Args().Get(0), ":")
-		if len(urlSlices) != 2 {
-			return fmt.Errorf("unable to get port from url %s", c.Args().Get(0))
-		}
-		adminConsolePort, err := strconv.Atoi(urlSlices[1])
-		if err != nil {
-			return fmt.Errorf("unable to convert port to int: %w", err)
+		if c.Bool("dry-run") {
+			return runJoinDryRun(host)
 		}
 
-		localArtifactMirrorPort := defaults.LocalArtifactMirrorPort
-		if jcmd.InstallationSpec.LocalArtifactMirror != nil {
-			localArtifactMirrorPort = jcmd.InstallationSpec.LocalArtifactMirror.Port
-		}
-
-		if err := RunHostPreflights(c, applier, replicatedAPIURL, proxyRegistryURL, isAirgap, jcmd.InstallationSpec.Proxy, adminConsolePort, localArtifactMirrorPort); err != nil {
-			metrics.ReportJoinFailed(c.Context, jcmd.InstallationSpec.MetricsBaseURL, jcmd.ClusterID, err)
-			if err == ErrPreflightsHaveFail {
-				return ErrNothingElseToAdd
+		// controllers change the etcd membership, the lock is held before anything is
+		// changed so two controllers or an update and a controller never run at once.
+		if isController {
+			logrus.Debugf("holding the cluster lock")
+			if host.joinLock, err = holdJoinLock(c, jcmd); err != nil {
+				return err
 			}
-			return err
+			defer host.joinLock.stop()
 		}
 
-		logrus.Debugf("configuring network manager")
-		if err := configureNetworkManager(c); err != nil {
-			return fmt.Errorf("unable to configure network manager: %w", err)
+		metrics.ReportJoinStarted(c.Context, jcmd.InstallationSpec.MetricsBaseURL, jcmd.ClusterID)
+		if err := runJoinSteps(host, host.preflightSteps()); err != nil {
+			return err
 		}
 
-		logrus.Debugf("saving token to disk")
-		if err := saveTokenToDisk(jcmd.K0sToken); err != nil {
-			err := fmt.Errorf("unable to save token to disk: %w", err)
+		resultFromContext(c.Context).startPhase("preflights")
+		warnings, err := host.runHostPreflights()
+		if err != nil {
+			err = ecerrors.WithKind(ecerrors.Preflight, err)
 			metrics.ReportJoinFailed(c.Context, jcmd.InstallationSpec.MetricsBaseURL, jcmd.ClusterID, err)
+			if errors.Is(err, ErrPreflightsHaveFail) {
+				return errPreflightsReported
+			}
 			return err
 		}
+		if len(warnings) > 0 {
+			metrics.ReportPreflightWarningsOverridden(c.Context, jcmd.InstallationSpec.MetricsBaseURL, jcmd.ClusterID, warnings)
+		}
 
-		logrus.Debugf("installing %s binaries", binName)
-		if err := installK0sBinary(); err != nil {
-			err := fmt.Errorf("unable to install k0s binary: %w", err)
-			metrics.ReportJoinFailed(c.Context, jcmd.InstallationSpec.MetricsBaseURL, jcmd.ClusterID, err)
+		if err := runJoinSteps(host, host.hostSteps()); err != nil {
 			return err
 		}
 
-		if jcmd.AirgapRegistryAddress != "" {
-			if err := airgap.AddInsecureRegistry(jcmd.AirgapRegistryAddress); err != nil {
-				err := fmt.Errorf("unable to add insecure registry: %w", err)
-				metrics.ReportJoinFailed(c.Context, jcmd.InstallationSpec.MetricsBaseURL, jcmd.ClusterID, err)
-				return err
-			}
-		}
+		metrics.ReportJoinSucceeded(c.Context, jcmd.InstallationSpec.MetricsBaseURL, jcmd.ClusterID)
+		logrus.Debugf("node join finished")
+		return nil
+	})),
+}
 
-		logrus.Debugf("creating systemd unit files")
+// checkJoinConnectivity validates, before any change is made to the host, that the clock
+// of this node agrees with the cluster clock, that the cluster CA is valid, that the
+// kubernetes API can be reached over TLS and that the artifact mirror the node fetches
+// its artifacts from can be reached.
+func checkJoinConnectivity(c *cli.Context, jcmd *JoinCommandResponse) error {
+	addr, err := artifactMirrorAddress(c, jcmd)
+	if err != nil {
+		return fmt.Errorf("unable to get the artifact mirror address: %w", err)
+	}
+	in := joincheck.Input{Token: jcmd.K0sToken, ClockSkew: jcmd.ClockSkew, ArtifactsURL: fmt.Sprintf("http://%s", addr)}
+	if err := joincheck.Run(c.Context, in); err != nil {
+		return fmt.Errorf("unable to validate the join, %w", err)
+	}
+	return nil
+}
 
-		// both controller and worker nodes will have 'worker' in the join command
-		if err := createSystemdUnitFiles(!strings.Contains(jcmd.K0sJoinCommand, "controller"), jcmd.InstallationSpec.Proxy, localArtifactMirrorPort); err != nil {
-			err := fmt.Errorf("unable to create systemd unit files: %w", err)
-			metrics.ReportJoinFailed(c.Context, jcmd.InstallationSpec.MetricsBaseURL, jcmd.ClusterID, err)
-			return err
-		}
+// checkJoinArchitecture makes sure a node of the architecture can run the images of the
+// cluster. Clusters installed before the architecture was recorded are assumed to run on
+// the architecture of the node.
+func checkJoinArchitecture(jcmd *JoinCommandResponse, arch string) error {
+	clusterArch := jcmd.InstallationSpec.Architecture
+	if clusterArch == "" {
+		clusterArch = arch
+	}
+	if err := config.CheckArchitecture(arch, clusterArch); err != nil {
+		return err
+	}
+	if clusterArch != arch && jcmd.InstallationSpec.AirgapRegistry != "" {
+		return fmt.Errorf(
+			"%s nodes can not join this cluster, its airgap registry %s only holds the images for %s nodes",
+			arch, jcmd.InstallationSpec.AirgapRegistry, clusterArch,
+		)
+	}
+	if clusterArch != arch {
+		logrus.Infof("Joining a %s node to a cluster installed on %s nodes.", arch, clusterArch)
+	}
+	return nil
+}
 
-		logrus.Debugf("overriding network configuration")
-		if err := applyNetworkConfiguration(c, jcmd); err != nil {
-			err := fmt.Errorf("unable to apply network configuration: %w", err)
-			metrics.ReportJoinFailed(c.Context, jcmd.InstallationSpec.MetricsBaseURL, jcmd.ClusterID, err)
-		}
+// useArtifactMirror makes agent builds, embedding no binaries, fetch them from the
+// artifact mirror set with --artifact-mirror or else from the mirror of the controller
+// the join token points to.
+func useArtifactMirror(c *cli.Context, jcmd *JoinCommandResponse) error {
+	addr, err := artifactMirrorAddress(c, jcmd)
+	if err != nil {
+		return err
+	}
+	token, err := joincheck.DecodeToken(jcmd.K0sToken)
+	if err != nil {
+		return fmt.Errorf("unable to read join token: %w", err)
+	}
+	logrus.Debugf("fetching binaries from the artifact mirror at %s", addr)
+	goods.UseArtifactMirror(fmt.Sprintf("http://%s", addr), token.BearerToken)
+	return nil
+}
 
-		logrus.Debugf("applying configuration overrides")
-		if err := applyJoinConfigurationOverrides(jcmd); err != nil {
-			err := fmt.Errorf("unable to apply configuration overrides: %w", err)
-			metrics.ReportJoinFailed(c.Context, jcmd.InstallationSpec.MetricsBaseURL, jcmd.ClusterID, err)
-			return err
-		}
+// artifactMirrorAddress returns the address of the artifact mirror set with
+// --artifact-mirror or else of the mirror of the controller the join token points to.
+func artifactMirrorAddress(c *cli.Context, jcmd *JoinCommandResponse) (string, error) {
+	if addr := c.String("artifact-mirror"); addr != "" {
+		return addr, nil
+	}
+	server, err := joinTokenServer(jcmd)
+	if err != nil {
+		return "", err
+	}
+	port := defaults.LocalArtifactMirrorPort
+	if jcmd.InstallationSpec.LocalArtifactMirror != nil && jcmd.InstallationSpec.LocalArtifactMirror.Port != 0 {
+		port = jcmd.InstallationSpec.LocalArtifactMirror.Port
+	}
+	return net.JoinHostPort(server.Hostname(), strconv.Itoa(port)), nil
+}
 
-		logrus.Debugf("joining node to cluster")
-		if err := runK0sInstallCommand(c, jcmd.K0sJoinCommand); err != nil {
-			err := fmt.Errorf("unable to join node to cluster: %w", err)
-			metrics.ReportJoinFailed(c.Context, jcmd.InstallationSpec.MetricsBaseURL, jcmd.ClusterID, err)
-			return err
-		}
+// joinTokenServer returns the address of the kubernetes api the join token points to.
+func joinTokenServer(jcmd *JoinCommandResponse) (*url.URL, error) {
+	token, err := joincheck.DecodeToken(jcmd.K0sToken)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read join token: %w", err)
+	}
+	server, err := url.Parse(token.Server)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse kubernetes api address %q: %w", token.Server, err)
+	}
+	return server, nil
+}
 
-		if err := startAndWaitForK0s(c, jcmd); err != nil {
-			return err
-		}
+// checkJoinNetwork measures the round trip time to the kubernetes api of every controller
+// listed in the join response, to the kubernetes api the join token points to and to the
+// admin console the node joins through, and the throughput from the artifact mirror. Fails when they are below the thresholds set
+// with --max-network-latency and --min-network-throughput.
+func checkJoinNetwork(c *cli.Context, target *joinTarget, jcmd *JoinCommandResponse) error {
+	server, err := joinTokenServer(jcmd)
+	if err != nil {
+		return err
+	}
+	api := server.Host
+	if server.Port() == "" {
+		api = net.JoinHostPort(server.Hostname(), "443")
+	}
+	controllers := joinNetworkTargets(api, target.URL, jcmd.ControllerAddresses)
+	mirror, err := artifactMirrorAddress(c, jcmd)
+	if err != nil {
+		return err
+	}
+	token, err := joincheck.DecodeToken(jcmd.K0sToken)
+	if err != nil {
+		return fmt.Errorf("unable to read join token: %w", err)
+	}
 
-		if !strings.Contains(jcmd.K0sJoinCommand, "controller") {
-			metrics.ReportJoinSucceeded(c.Context, jcmd.InstallationSpec.MetricsBaseURL, jcmd.ClusterID)
-			logrus.Debugf("worker node join finished")
-			return nil
+	measures, err := netcheck.Run(c.Context, netcheck.Input{
+		Controllers:         controllers,
+		ArtifactMirror:      mirror,
+		ArtifactMirrorToken: token.BearerToken,
+		Thresholds: netcheck.Thresholds{
+			MaxLatency:        c.Duration("max-network-latency"),
+			MinThroughputMbps: c.Int64("min-network-throughput"),
+		},
+	})
+	for _, m := range measures {
+		if m.ThroughputMbps > 0 {
+			logrus.Debugf("round trip time to %s is %s, throughput is %.1f Mbit/s", m.Target, m.Latency, m.ThroughputMbps)
+			continue
 		}
+		logrus.Debugf("round trip time to %s is %s", m.Target, m.Latency)
+	}
+	if err != nil {
+		return fmt.Errorf("the network between this node and the cluster is too slow, nodes must be in the same network as the controllers:\n%w", err)
+	}
+	return nil
+}
 
-		kcli, err := kubeutils.KubeClient()
-		if err != nil {
-			err := fmt.Errorf("unable to get kube client: %w", err)
-			metrics.ReportJoinFailed(c.Context, jcmd.InstallationSpec.MetricsBaseURL, jcmd.ClusterID, err)
-			return err
-		}
-		hostname, err := os.Hostname()
-		if err != nil {
-			err := fmt.Errorf("unable to get hostname: %w", err)
-			metrics.ReportJoinFailed(c.Context, jcmd.InstallationSpec.MetricsBaseURL, jcmd.ClusterID, err)
-			return err
-		}
-		if err := waitForNode(c.Context, kcli, hostname); err != nil {
-			err := fmt.Errorf("unable to wait for node: %w", err)
-			metrics.ReportJoinFailed(c.Context, jcmd.InstallationSpec.MetricsBaseURL, jcmd.ClusterID, err)
-			return err
-		}
+// joinNetworkTargets returns the addresses the round trip time is measured to before
+// joining, without duplicates: the kubernetes api the join token points to, the kubernetes
+// api on each of the controller addresses, on the port of the former, and the admin
+// console the node joins through.
+func joinNetworkTargets(api, adminConsole string, controllerAddresses []string) []string {
+	_, port, err := net.SplitHostPort(api)
+	if err != nil {
+		port = "6443"
+	}
+	targets := []string{api}
+	for _, addr := range controllerAddresses {
+		targets = append(targets, net.JoinHostPort(addr, port))
+	}
+	targets = append(targets, adminConsole)
 
-		if c.Bool("enable-ha") {
-			if err := maybeEnableHA(c.Context, kcli); err != nil {
-				err := fmt.Errorf("unable to enable high availability: %w", err)
-				metrics.ReportJoinFailed(c.Context, jcmd.InstallationSpec.MetricsBaseURL, jcmd.ClusterID, err)
-				return err
-			}
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, target := range targets {
+		if target == "" || seen[target] {
+			continue
 		}
-
-		metrics.ReportJoinSucceeded(c.Context, jcmd.InstallationSpec.MetricsBaseURL, jcmd.ClusterID)
-		logrus.Debugf("controller node join finished")
-		return nil
-	},
+		seen[target] = true
+		unique = append(unique, target)
+	}
+	return unique
 }
 
 func applyNetworkConfiguration(c *cli.Context, jcmd *JoinCommandResponse) error {
@@ -372,6 +579,20 @@ func applyNetworkConfiguration(c *cli.Context, jcmd *JoinCommandResponse) error
 			}
 			clusterSpec.Spec.API.ExtraArgs["service-node-port-range"] = jcmd.InstallationSpec.Network.NodePortRange
 		}
+		if jcmd.InstallationSpec.FIPS {
+			if err := config.ApplyFIPSSettings(clusterSpec); err != nil {
+				return fmt.Errorf("unable to apply fips settings: %w", err)
+			}
+		}
+		if jcmd.InstallationSpec.EncryptionAtRest {
+			config.ApplyEncryption(clusterSpec)
+		}
+		if err := config.ApplyHardening(clusterSpec, jcmd.InstallationSpec.Hardening); err != nil {
+			return fmt.Errorf("unable to apply hardening profile: %w", err)
+		}
+		if jcmd.InstallationSpec.AirgapRegistry != "" {
+			airgap.RewriteK0sImages(clusterSpec, jcmd.InstallationSpec.AirgapRegistry)
+		}
 		clusterSpecYaml, err := k8syaml.Marshal(clusterSpec)
 
 		if err != nil {
@@ -496,28 +717,62 @@ func startK0sService() error {
 }
 
 func systemdUnitFileName() string {
-	return fmt.Sprintf("/etc/systemd/system/%s.service", defaults.BinaryName())
+	return hostconfig.BinaryUnitPath(defaults.BinaryName())
 }
 
 // runK0sInstallCommand runs the k0s install command as provided by the kots
-// adm api.
-func runK0sInstallCommand(c *cli.Context, fullcmd string) error {
+// adm api. The provided kubelet flags are passed to the kubelet, and controllers are
+// installed without the disabled components.
+func runK0sInstallCommand(c *cli.Context, fullcmd string, labels map[string]string, kubeletArgs []string, disabledComponents []string) error {
 	args := strings.Split(fullcmd, " ")
 	args = append(args, "--token-file", "/etc/k0s/join-token")
 	if strings.Contains(fullcmd, "controller") {
-		args = append(args, "--disable-components", "konnectivity-server", "--enable-dynamic-config")
+		args = append(args, "--disable-components", strings.Join(disabledComponents, ","), "--enable-dynamic-config")
+	}
+	for k, v := range labels {
+		args = append(args, "--labels", fmt.Sprintf("%s=%s", k, v))
 	}
 
 	nodeIP, err := netutils.FirstValidAddress(c.String("network-interface"))
 	if err != nil {
 		return fmt.Errorf("unable to find first valid address: %w", err)
 	}
-	args = append(args, "--kubelet-extra-args", fmt.Sprintf(`"--node-ip=%s"`, nodeIP))
+	args = append(args, "--kubelet-extra-args", config.KubeletExtraArgs(nodeIP, kubeletArgs))
+	args = append(args, nodeconfig.ProfileFlag())
 
 	if _, err := helpers.RunCommand(args[0], args[1:]...); err != nil {
 		return err
 	}
-	return nil
+	return writeDefaultNodeConfigDropIn()
+}
+
+// ephemeralDiskLabels makes sure none of the directories holding persistent data (volumes
+// and etcd) live in one of the disks the user declared as ephemeral, the data would be
+// lost when the host is reimaged. Returns the labels to be set on the node so the
+// seaweedfs and registry add-ons keep their data off it.
+func ephemeralDiskLabels(c *cli.Context, storage *ecv1beta1.StorageSpec) (map[string]string, error) {
+	mounts := c.StringSlice("ephemeral-disk-path")
+	if len(mounts) == 0 {
+		return nil, nil
+	}
+	var conflicts []string
+	for _, mount := range mounts {
+		if _, err := os.Stat(mount); err != nil {
+			return nil, fmt.Errorf("unable to read ephemeral disk path %s: %w", mount, err)
+		}
+		for _, dir := range []string{storageplan.DataDir(storage), defaults.K0sDataDir} {
+			same, err := helpers.SameFilesystem(dir, mount)
+			if err != nil {
+				return nil, fmt.Errorf("unable to compare %s with %s: %w", dir, mount, err)
+			} else if same {
+				conflicts = append(conflicts, fmt.Sprintf("%s is in the ephemeral disk mounted at %s", dir, mount))
+			}
+		}
+	}
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("persistent data would be lost when the host is reimaged, %s: mount a persistent disk at these locations", strings.Join(conflicts, ", "))
+	}
+	return map[string]string{defaults.EphemeralDiskLabel: "true"}, nil
 }
 
 func waitForNode(ctx context.Context, kcli client.Client, hostname string) error {
@@ -542,6 +797,13 @@ func maybeEnableHA(ctx context.Context, kcli client.Client) error {
 	logrus.Info("")
 	logrus.Info("When adding a third controller node, you have the option to enable high availability. This will migrate the data so that it is replicated across cluster nodes. Once enabled, you must maintain at least three controller nodes.")
 	logrus.Info("")
+	if zones, err := highavailability.ControlPlaneZones(ctx, kcli); err != nil {
+		return fmt.Errorf("unable to get controller zones: %w", err)
+	} else if len(zones) > 0 && len(zones) < 3 {
+		logrus.Warnf("Controller nodes are spread across %d zone(s): %s.", len(zones), strings.Join(zones, ", "))
+		logrus.Warn("Spread controller nodes across at least three zones to tolerate the loss of a zone.")
+		logrus.Info("")
+	}
 	shouldEnableHA := prompts.New().Confirm("Do you want to enable high availability?", false)
 	if !shouldEnableHA {
 		return nil
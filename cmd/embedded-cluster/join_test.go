@@ -2,18 +2,23 @@ package main
 
 import (
 	"embed"
+	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/k0sproject/dig"
 	k0sconfig "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
 	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
 	embeddedclusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
 	"gopkg.in/yaml.v3"
 	k8syaml "sigs.k8s.io/yaml"
 )
@@ -132,3 +137,93 @@ func TestJoinCommandResponseOverrides(t *testing.T) {
 		})
 	}
 }
+
+func TestJoinCommandResponsePreflightK0sConfig(t *testing.T) {
+	join := JoinCommandResponse{
+		InstallationSpec: ecv1beta1.InstallationSpec{
+			Config: &ecv1beta1.ConfigSpec{
+				UnsupportedOverrides: ecv1beta1.UnsupportedOverrides{
+					K0s: "config:\n  spec:\n    network:\n      kubeProxy:\n        mode: ipvs\n",
+				},
+			},
+			EndUserK0sConfigOverrides: "config:\n  spec:\n    network:\n      calico:\n        wireguard: true\n",
+		},
+	}
+	cfg, err := join.PreflightK0sConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "ipvs", cfg.Spec.Network.KubeProxy.Mode)
+	assert.True(t, cfg.Spec.Network.Calico.EnableWireguard)
+}
+
+func TestClockSkewFromDate(t *testing.T) {
+	server := time.Date(2024, 9, 1, 10, 0, 0, 0, time.UTC)
+	date := server.Format(http.TimeFormat)
+
+	start := server.Add(400 * time.Millisecond)
+	skew, err := clockSkewFromDate(start, start.Add(200*time.Millisecond), date)
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), skew)
+
+	start = server.Add(-10 * time.Second)
+	skew, err = clockSkewFromDate(start, start.Add(time.Second), date)
+	require.NoError(t, err)
+	assert.Equal(t, -10*time.Second, skew)
+
+	_, err = clockSkewFromDate(start, start, "")
+	assert.Error(t, err)
+	_, err = clockSkewFromDate(start, start, "yesterday")
+	assert.Error(t, err)
+}
+
+func TestCheckJoinArchitecture(t *testing.T) {
+	jcmd := &JoinCommandResponse{}
+	// clusters installed before the architecture was recorded.
+	assert.NoError(t, checkJoinArchitecture(jcmd, "arm64"))
+
+	jcmd.InstallationSpec.Architecture = "arm64"
+	assert.NoError(t, checkJoinArchitecture(jcmd, "arm64"))
+
+	// the images embedded in the binary are referenced separately for each architecture.
+	err := checkJoinArchitecture(jcmd, "amd64")
+	assert.ErrorContains(t, err, "amd64 nodes can not join a cluster installed on arm64 nodes")
+}
+
+func TestJoinNetworkTargets(t *testing.T) {
+	// clusters whose join response does not list the controllers.
+	targets := joinNetworkTargets("10.0.0.1:6443", "10.0.0.1:30000", nil)
+	assert.Equal(t, []string{"10.0.0.1:6443", "10.0.0.1:30000"}, targets)
+
+	targets = joinNetworkTargets("10.0.0.1:6443", "10.0.0.1:30000", []string{"10.0.0.1", "10.0.0.2", "fd00::3"})
+	assert.Equal(t, []string{"10.0.0.1:6443", "10.0.0.2:6443", "[fd00::3]:6443", "10.0.0.1:30000"}, targets)
+
+	// the admin console may be reached on the kubernetes api address.
+	targets = joinNetworkTargets("api.example.com:7443", "10.0.0.2:7443", []string{"10.0.0.2"})
+	assert.Equal(t, []string{"api.example.com:7443", "10.0.0.2:7443"}, targets)
+}
+
+func TestEphemeralDiskLabels(t *testing.T) {
+	dataDir := t.TempDir()
+	storage := &ecv1beta1.StorageSpec{OpenEBSDataDir: dataDir}
+	flagsContext := func(mounts ...string) *cli.Context {
+		set := flag.NewFlagSet("test", 0)
+		for _, f := range joinCommand.Flags {
+			require.NoError(t, f.Apply(set))
+		}
+		for _, mount := range mounts {
+			require.NoError(t, set.Set("ephemeral-disk-path", mount))
+		}
+		return cli.NewContext(cli.NewApp(), set, nil)
+	}
+
+	labels, err := ephemeralDiskLabels(flagsContext(), storage)
+	require.NoError(t, err)
+	assert.Nil(t, labels)
+
+	// procfs never holds the data directories.
+	labels, err = ephemeralDiskLabels(flagsContext("/proc"), storage)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{defaults.EphemeralDiskLabel: "true"}, labels)
+
+	_, err = ephemeralDiskLabels(flagsContext(t.TempDir()), storage)
+	assert.ErrorContains(t, err, "persistent data would be lost when the host is reimaged, "+dataDir+" is in the ephemeral disk mounted at")
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/airgap"
+	"github.com/replicatedhq/embedded-cluster/pkg/config"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	ecerrors "github.com/replicatedhq/embedded-cluster/pkg/errors"
+	"github.com/replicatedhq/embedded-cluster/pkg/firewall"
+	"github.com/replicatedhq/embedded-cluster/pkg/goods"
+	"github.com/replicatedhq/embedded-cluster/pkg/hardening"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/metrics"
+	"github.com/replicatedhq/embedded-cluster/pkg/netutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/prereqs"
+	"github.com/replicatedhq/embedded-cluster/pkg/registrymirror"
+)
+
+// joinStep is a change the join command makes to the host. The join command runs the
+// steps in order, the dry run prints their descriptions without running them.
+type joinStep struct {
+	Description string
+	Run         func() error
+}
+
+// joinHost holds what the join steps need to know about the cluster and the host.
+type joinHost struct {
+	c                       *cli.Context
+	jcmd                    *JoinCommandResponse
+	state                   joinHostState
+	isAirgap                bool
+	adminConsolePort        int
+	localArtifactMirrorPort int
+	// nodeLabels are set on the node when it joins the cluster.
+	nodeLabels map[string]string
+	// kubeletArgs are passed to the kubelet, they are set once image pulls are tuned.
+	kubeletArgs []string
+	// joinLock holds the cluster lock while a controller joins, until it takes it over.
+	joinLock *joinLock
+}
+
+// newJoinHost inspects the host and validates the node labels requested by the user.
+// Nothing is changed on the host.
+func newJoinHost(c *cli.Context, jcmd *JoinCommandResponse, adminConsoleURL string, isAirgap bool) (*joinHost, error) {
+	urlSlices := strings.Split(adminConsoleURL, ":")
+	if len(urlSlices) != 2 {
+		return nil, fmt.Errorf("unable to get port from url %s", adminConsoleURL)
+	}
+	adminConsolePort, err := strconv.Atoi(urlSlices[1])
+	if err != nil {
+		return nil, fmt.Errorf("unable to convert port to int: %w", err)
+	}
+	localArtifactMirrorPort := defaults.LocalArtifactMirrorPort
+	if jcmd.InstallationSpec.LocalArtifactMirror != nil {
+		localArtifactMirrorPort = jcmd.InstallationSpec.LocalArtifactMirror.Port
+	}
+
+	logrus.Debugf("checking ephemeral disks")
+	nodeLabels, err := ephemeralDiskLabels(c, jcmd.InstallationSpec.Storage)
+	if err != nil {
+		return nil, err
+	}
+	topologyLabels, err := getTopologyLabels(c)
+	if err != nil {
+		return nil, err
+	}
+	if nodeLabels == nil {
+		nodeLabels = map[string]string{}
+	}
+	for k, v := range topologyLabels {
+		nodeLabels[k] = v
+	}
+
+	return &joinHost{
+		c:                       c,
+		jcmd:                    jcmd,
+		state:                   detectJoinHostState(c),
+		isAirgap:                isAirgap,
+		adminConsolePort:        adminConsolePort,
+		localArtifactMirrorPort: localArtifactMirrorPort,
+		nodeLabels:              nodeLabels,
+	}, nil
+}
+
+// isController returns true if the node joins the cluster as a controller.
+func (h *joinHost) isController() bool {
+	return strings.Contains(h.jcmd.K0sJoinCommand, "controller")
+}
+
+// k0sUnit returns the name of the k0s service of the node.
+func (h *joinHost) k0sUnit() string {
+	if h.isController() {
+		return "k0scontroller"
+	}
+	return "k0sworker"
+}
+
+// materializeFiles writes the files needed to run the host preflights: the binaries,
+// the support files and the storage plan of the node. The airgap image bundle is only
+// written if airgapImages is true.
+func (h *joinHost) materializeFiles(airgapImages bool) error {
+	if err := writeExcludedHostCollectors(h.jcmd.InstallationSpec.ExcludedHostCollectors); err != nil {
+		return err
+	}
+	if err := writeStorageSpec(h.jcmd.InstallationSpec.Storage); err != nil {
+		return err
+	}
+	if goods.Agent {
+		if err := useArtifactMirror(h.c, h.jcmd); err != nil {
+			return err
+		}
+	}
+	logrus.Debugf("materializing %s binaries", binName)
+	return materializeFiles(h.c, airgapImages)
+}
+
+// runHostPreflights runs the host preflights of the cluster the node joins.
+func (h *joinHost) runHostPreflights() ([]string, error) {
+	applier, err := getAddonsApplier(h.c, "", h.jcmd.InstallationSpec.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	// jcmd.InstallationSpec.MetricsBaseURL is the replicated.app endpoint url
+	replicatedAPIURL := h.jcmd.InstallationSpec.MetricsBaseURL
+	proxyRegistryURL := fmt.Sprintf("https://%s", defaults.ProxyRegistryAddress)
+	k0sCfg, err := h.jcmd.PreflightK0sConfig()
+	if err != nil {
+		return nil, err
+	}
+	return RunHostPreflights(
+		h.c, applier, replicatedAPIURL, proxyRegistryURL, h.isAirgap, h.jcmd.InstallationSpec.FIPS,
+		h.jcmd.InstallationSpec.Proxy, h.adminConsolePort, h.localArtifactMirrorPort, &h.jcmd.ClockSkew, k0sCfg,
+	)
+}
+
+// preflightSteps returns the steps run before the host preflights.
+func (h *joinHost) preflightSteps() []joinStep {
+	c, jcmd, state := h.c, h.jcmd, h.state
+	steps := []joinStep{{
+		Description: fmt.Sprintf("Materialize binaries and support files in %s", defaults.EmbeddedClusterHomeDirectory()),
+		Run: func() error {
+			return h.materializeFiles(jcmd.InstallationSpec.AirgapRegistry == "")
+		},
+	}}
+	if h.isAirgap && jcmd.InstallationSpec.AirgapRegistry == "" {
+		steps[0].Description += fmt.Sprintf(", and the air gap images from %s", c.String("airgap-bundle"))
+	}
+	if len(state.MissingPrereqs) > 0 && c.Bool("install-prereqs") {
+		steps = append(steps, joinStep{
+			Description: fmt.Sprintf("Install missing packages: %s", prereqs.InstallCommand(state.Distro, state.MissingPrereqs)),
+			Run: func() error {
+				return ecerrors.WithKind(ecerrors.HostConfig, maybeInstallPrereqs(c, h.isAirgap))
+			},
+		})
+	}
+	if c.Bool("enable-chrony") && state.TimeSyncService == "" {
+		steps = append(steps, joinStep{
+			Description: "Enable and start chrony to synchronize the clock",
+			Run: func() error {
+				return ecerrors.WithKind(ecerrors.HostConfig, maybeEnableChrony(c))
+			},
+		})
+	}
+	return steps
+}
+
+// hostSteps returns the steps run once the host preflights passed, from the configuration
+// of the host to the node joining the cluster.
+func (h *joinHost) hostSteps() []joinStep {
+	c, jcmd, state := h.c, h.jcmd, h.state
+	isController := h.isController()
+	unit := h.k0sUnit()
+
+	steps := []joinStep{{
+		Description: "Write the zone and rack of the node for the storage pods",
+		Run: func() error {
+			return writeTopologyFiles(c)
+		},
+	}}
+	if state.NetworkManager {
+		steps = append(steps, joinStep{
+			Description: "Configure NetworkManager to ignore the Calico interfaces and restart it",
+			Run: func() error {
+				if err := configureNetworkManager(c); err != nil {
+					return ecerrors.Errorf(ecerrors.HostConfig, "unable to configure network manager: %w", err)
+				}
+				return nil
+			},
+		})
+	}
+	if c.Bool("configure-firewall") {
+		description := "Skip firewall configuration, no supported firewall (firewalld, ufw or nftables) found"
+		if state.Firewall != firewall.None {
+			var ports []string
+			for _, port := range firewall.RequiredPorts(h.adminConsolePort, h.localArtifactMirrorPort) {
+				ports = append(ports, port.String())
+			}
+			description = fmt.Sprintf("Open ports %s using %s", strings.Join(ports, ", "), state.Firewall)
+		}
+		steps = append(steps, joinStep{
+			Description: description,
+			Run: func() error {
+				if err := configureFirewall(c, h.adminConsolePort, h.localArtifactMirrorPort, !isController); err != nil {
+					return ecerrors.Errorf(ecerrors.HostConfig, "unable to configure firewall: %w", err)
+				}
+				return nil
+			},
+		})
+	}
+	if state.SELinuxEnforcing {
+		steps = append(steps, joinStep{
+			Description: "Install the SELinux policy module and file contexts",
+			Run: func() error {
+				return ecerrors.WithKind(ecerrors.HostConfig, configureSELinux())
+			},
+		})
+	}
+	steps = append(steps, joinStep{
+		Description: "Write the join token to /etc/k0s/join-token",
+		Run: func() error {
+			if err := saveTokenToDisk(jcmd.K0sToken); err != nil {
+				return fmt.Errorf("unable to save token to disk: %w", err)
+			}
+			return nil
+		},
+	}, joinStep{
+		Description: fmt.Sprintf("Install the k0s binary to %s", defaults.K0sBinaryPath()),
+		Run: func() error {
+			if err := installK0sBinary(); err != nil {
+				return ecerrors.Errorf(ecerrors.K0s, "unable to install k0s binary: %w", err)
+			}
+			return nil
+		},
+	})
+	// the embedded registry is not installed when the images are hosted in an existing
+	// registry.
+	if jcmd.AirgapRegistryAddress != "" && jcmd.InstallationSpec.AirgapRegistry == "" {
+		steps = append(steps, joinStep{
+			Description: fmt.Sprintf("Allow insecure access to the registry %s in containerd", jcmd.AirgapRegistryAddress),
+			Run: func() error {
+				if err := airgap.AddInsecureRegistry(jcmd.AirgapRegistryAddress); err != nil {
+					return fmt.Errorf("unable to add insecure registry: %w", err)
+				}
+				return nil
+			},
+		})
+	}
+
+	description := fmt.Sprintf("Link %s to the %s service", systemdUnitFileName(), unit)
+	if jcmd.InstallationSpec.Proxy != nil {
+		description += ", configure its proxy"
+	}
+	description += fmt.Sprintf(", and install and start the local artifact mirror service on port %d", h.localArtifactMirrorPort)
+	steps = append(steps, joinStep{
+		Description: description,
+		Run: func() error {
+			localArtifactMirror := ecv1beta1.LocalArtifactMirrorSpec{Port: h.localArtifactMirrorPort}
+			if jcmd.InstallationSpec.LocalArtifactMirror != nil {
+				localArtifactMirror.DiskQuota = jcmd.InstallationSpec.LocalArtifactMirror.DiskQuota
+			}
+			nodeIP, err := netutils.FirstValidAddress(c.String("network-interface"))
+			if err != nil {
+				return ecerrors.Errorf(ecerrors.HostConfig, "unable to find first valid address: %w", err)
+			}
+			logrus.Debugf("creating systemd unit files")
+			if err := createSystemdUnitFiles(!isController, nodeIP, jcmd.InstallationSpec.Proxy, localArtifactMirror); err != nil {
+				return ecerrors.Errorf(ecerrors.HostConfig, "unable to create systemd unit files: %w", err)
+			}
+			return nil
+		},
+	})
+
+	if jcmd.InstallationSpec.EncryptionAtRest && isController {
+		source := c.String("encryption-config")
+		if jcmd.EncryptionConfig != "" {
+			source = "the cluster encryption configuration"
+		}
+		steps = append(steps, joinStep{
+			Description: fmt.Sprintf("Copy %s to %s", source, defaults.PathToEncryptionConfig()),
+			Run: func() error {
+				if err := installEncryptionConfig(c, jcmd); err != nil {
+					return fmt.Errorf("unable to install encryption config: %w", err)
+				}
+				return nil
+			},
+		})
+	}
+	if jcmd.InstallationSpec.Hardening != "" && isController {
+		steps = append(steps, joinStep{
+			Description: fmt.Sprintf("Write the kube-apiserver audit policy to %s", hardening.AuditPolicyPath),
+			Run: func() error {
+				if err := hardening.WriteAuditPolicy(); err != nil {
+					return fmt.Errorf("unable to write audit policy: %w", err)
+				}
+				return nil
+			},
+		})
+	}
+
+	steps = append(steps, joinStep{
+		Description: fmt.Sprintf("Write the k0s configuration to %s", defaults.PathToK0sConfig()),
+		Run: func() error {
+			logrus.Debugf("overriding network configuration")
+			if err := applyNetworkConfiguration(c, jcmd); err != nil {
+				return fmt.Errorf("unable to apply network configuration: %w", err)
+			}
+			logrus.Debugf("applying configuration overrides")
+			if err := applyJoinConfigurationOverrides(jcmd); err != nil {
+				return fmt.Errorf("unable to apply configuration overrides: %w", err)
+			}
+			return nil
+		},
+	}, joinStep{
+		Description: fmt.Sprintf("Write the containerd image pull configuration to %s", defaults.PathToK0sContainerdConfig()),
+		Run: func() error {
+			logrus.Debugf("tuning image pulls")
+			var imagePull *ecv1beta1.ImagePull
+			if jcmd.InstallationSpec.Config != nil {
+				imagePull = jcmd.InstallationSpec.Config.ImagePull
+			}
+			kubeletArgs, err := configureImagePull(c, imagePull)
+			if err != nil {
+				return err
+			}
+			h.kubeletArgs = append(kubeletArgs, containerHostKubeletArgs()...)
+			return nil
+		},
+	})
+	if len(jcmd.InstallationSpec.RegistryMirrors) > 0 {
+		steps = append(steps, joinStep{
+			Description: fmt.Sprintf("Write the registry mirrors configuration to %s", registrymirror.HostsDir()),
+			Run: func() error {
+				// the join response carries the passwords read from the registry mirrors
+				// secret, the installation only references them.
+				if err := registrymirror.Validate(jcmd.InstallationSpec.RegistryMirrors); err != nil {
+					return fmt.Errorf("invalid registry mirrors in the join response: %w", err)
+				}
+				if err := registrymirror.Write(jcmd.InstallationSpec.RegistryMirrors); err != nil {
+					return fmt.Errorf("unable to configure registry mirrors: %w", err)
+				}
+				return nil
+			},
+		})
+	}
+	steps = append(steps, joinStep{
+		Description: "Size the connection tracking table",
+		Run: func() error {
+			configureConntrack(jcmd.InstallationSpec.Config)
+			return nil
+		},
+	})
+
+	role := "worker"
+	if isController {
+		role = "controller"
+	}
+	steps = append(steps, joinStep{
+		Description: fmt.Sprintf("Install and start the %s service, joining the node as a %s", unit, role),
+		Run: func() error {
+			resultFromContext(c.Context).startPhase("k0s")
+			logrus.Debugf("joining node to cluster")
+			if err := runK0sInstallCommand(c, jcmd.K0sJoinCommand, h.nodeLabels, h.kubeletArgs, config.DisabledComponents(jcmd.InstallationSpec.Config)); err != nil {
+				return ecerrors.Errorf(ecerrors.K0s, "unable to join node to cluster: %w", err)
+			}
+			if err := startAndWaitForK0s(c, jcmd); err != nil {
+				return err
+			}
+			configureWatchdog(jcmd.InstallationSpec.Config)
+			return recordNodeResult(c, isController)
+		},
+	})
+	if !isController {
+		return steps
+	}
+
+	description = "Wait for the node to be ready"
+	if c.Bool("enable-ha") {
+		description += ", and offer to enable high availability if this is the third controller"
+	}
+	return append(steps, joinStep{
+		Description: description,
+		Run: func() error {
+			return finishControllerJoin(c, h.joinLock)
+		},
+	})
+}
+
+// finishControllerJoin waits for the controller node to be ready and, if requested,
+// offers to enable high availability.
+func finishControllerJoin(c *cli.Context, held *joinLock) error {
+	kcli, err := kubeutils.KubeClient()
+	if err != nil {
+		return fmt.Errorf("unable to get kube client: %w", err)
+	}
+	// the node now holds the credentials of the cluster and takes over the lock held for
+	// it while it joined. It keeps two controllers from enabling high availability at the
+	// same time and updates from running while this controller finishes joining.
+	lock, err := acquireClusterLock(c.Context, kcli, "join")
+	held.stop()
+	if err != nil {
+		return err
+	}
+	defer releaseClusterLock(lock)
+	hostname, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("unable to get hostname: %w", err)
+	}
+	resultFromContext(c.Context).startPhase("node-ready")
+	if err := waitForNode(c.Context, kcli, hostname); err != nil {
+		return ecerrors.Errorf(ecerrors.K0s, "unable to wait for node: %w", err)
+	}
+	if c.Bool("enable-ha") {
+		if err := maybeEnableHA(c.Context, kcli); err != nil {
+			return fmt.Errorf("unable to enable high availability: %w", err)
+		}
+	}
+	return nil
+}
+
+// runJoinSteps runs the steps in order. The join is reported as failed on the first step
+// that fails or if the command is interrupted.
+func runJoinSteps(h *joinHost, steps []joinStep) error {
+	for _, step := range steps {
+		err := checkInterrupted(h.c.Context)
+		if err == nil {
+			logrus.Debugf("join step: %s", step.Description)
+			err = step.Run()
+		}
+		if err != nil {
+			metrics.ReportJoinFailed(h.c.Context, h.jcmd.InstallationSpec.MetricsBaseURL, h.jcmd.ClusterID, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// joinStepDescriptions returns the descriptions of the steps, in order.
+func joinStepDescriptions(steps ...[]joinStep) []string {
+	var descriptions []string
+	for _, list := range steps {
+		for _, step := range list {
+			descriptions = append(descriptions, step.Description)
+		}
+	}
+	return descriptions
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/jointoken"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
+)
+
+// joinTarget is the admin console a node joins through and the short token it joins
+// with. Role and BootstrapToken are set when the join was given a scoped join token.
+type joinTarget struct {
+	URL            string
+	Token          string
+	Role           string
+	BootstrapToken string
+}
+
+// parseJoinArgs returns the join target from the arguments, either an admin console
+// address followed by a short token or a single join token printed by node join-command.
+func parseJoinArgs(c *cli.Context, usage string) (*joinTarget, error) {
+	switch {
+	case c.Args().Len() == 1 && jointoken.IsToken(c.Args().Get(0)):
+		tok, err := jointoken.Decode(c.Args().Get(0), time.Now())
+		if err != nil {
+			return nil, err
+		}
+		return &joinTarget{URL: tok.URL, Token: tok.Token, Role: tok.Role, BootstrapToken: tok.BootstrapToken}, nil
+	case c.Args().Len() == 2:
+		return &joinTarget{URL: c.Args().Get(0), Token: c.Args().Get(1)}, nil
+	}
+	return nil, fmt.Errorf("usage: %s", usage)
+}
+
+// scope makes sure the join command fetched with the target joins a node with the role
+// the join token is scoped to, and makes the node join the cluster with the bootstrap
+// token of the join token so the cluster enforces its role and expiry.
+func (t *joinTarget) scope(jcmd *JoinCommandResponse) error {
+	if t.Role == "" {
+		return nil
+	}
+	tok := jointoken.Token{Role: t.Role}
+	if err := tok.CheckRole(strings.Contains(jcmd.K0sJoinCommand, "controller")); err != nil {
+		return err
+	}
+	k0sToken, err := jointoken.ReplaceBootstrapToken(jcmd.K0sToken, t.BootstrapToken)
+	if err != nil {
+		return fmt.Errorf("unable to scope the join token: %w", err)
+	}
+	jcmd.K0sToken = k0sToken
+	return nil
+}
+
+var nodeJoinCommandCommand = &cli.Command{
+	Name:      "join-command",
+	Usage:     "Print a join command scoped to a role and an expiry, optionally as a QR code. Must be run on a controller node",
+	ArgsUsage: "<url> <token>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "role",
+			Usage:    fmt.Sprintf("Role of the joining nodes, %s or %s. It must match the role the token was generated for.", jointoken.RoleController, jointoken.RoleWorker),
+			Required: true,
+		},
+		&cli.DurationFlag{
+			Name:  "expiry",
+			Usage: "How long the join command can be used for",
+			Value: 24 * time.Hour,
+		},
+		&cli.BoolFlag{
+			Name:  "qr",
+			Usage: "Print the join command as a QR code as well",
+		},
+	},
+	Before: func(c *cli.Context) error {
+		if c.Args().Len() != 2 {
+			return fmt.Errorf("usage: %s node join-command --role <role> <url> <token>, with the url and the token of a join command generated by the Admin Console", binName)
+		}
+		if err := privileges.Check("node join-command", hostPrivileges()...); err != nil {
+			return err
+		}
+		if _, err := os.Stat(defaults.PathToKubeConfig()); err != nil {
+			return fmt.Errorf("node join-command must be run on a controller node")
+		}
+		os.Setenv("KUBECONFIG", defaults.PathToKubeConfig())
+		return nil
+	},
+	Action: func(c *cli.Context) error {
+		tok, err := jointoken.New(c.Args().Get(0), c.Args().Get(1), c.String("role"), c.Duration("expiry"), time.Now())
+		if err != nil {
+			return err
+		}
+		kcli, err := kubeutils.KubeClient()
+		if err != nil {
+			return fmt.Errorf("unable to create kube client: %w", err)
+		}
+		tok.BootstrapToken, err = jointoken.CreateBootstrapToken(c.Context, kcli, tok.Role, tok.Expiry())
+		if err != nil {
+			return err
+		}
+		encoded, err := tok.Encode()
+		if err != nil {
+			return err
+		}
+		command := fmt.Sprintf("sudo ./%s join %s", binName, encoded)
+		fmt.Fprintf(os.Stdout, "Join %s nodes until %s with:\n\n  %s\n\n", tok.Role, tok.Expiry().Format(time.RFC1123), command)
+		if !c.Bool("qr") {
+			return nil
+		}
+		code, err := jointoken.QRCode(command)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(os.Stdout, code)
+		return nil
+	},
+}
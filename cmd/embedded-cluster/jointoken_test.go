@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/pem"
+	"flag"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/joincheck"
+	"github.com/replicatedhq/embedded-cluster/pkg/jointoken"
+)
+
+func TestParseJoinArgs(t *testing.T) {
+	tok, err := jointoken.New("10.0.0.1:30000", "abcdef", jointoken.RoleController, time.Hour, time.Now())
+	require.NoError(t, err)
+	tok.BootstrapToken = "abcdef.0123456789abcdef"
+	encoded, err := tok.Encode()
+	require.NoError(t, err)
+	expired, err := jointoken.New("10.0.0.1:30000", "abcdef", jointoken.RoleController, time.Hour, time.Now().Add(-2*time.Hour))
+	require.NoError(t, err)
+	expired.BootstrapToken = "abcdef.0123456789abcdef"
+	encodedExpired, err := expired.Encode()
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		name    string
+		args    []string
+		want    *joinTarget
+		wantErr string
+	}{
+		{
+			name: "url and token",
+			args: []string{"10.0.0.1:30000", "abcdef"},
+			want: &joinTarget{URL: "10.0.0.1:30000", Token: "abcdef"},
+		},
+		{
+			name: "join token",
+			args: []string{encoded},
+			want: &joinTarget{URL: "10.0.0.1:30000", Token: "abcdef", Role: jointoken.RoleController, BootstrapToken: "abcdef.0123456789abcdef"},
+		},
+		{
+			name:    "expired join token",
+			args:    []string{encodedExpired},
+			wantErr: "the join token expired at",
+		},
+		{
+			name:    "short token only",
+			args:    []string{"abcdef"},
+			wantErr: "usage: join <url> <token>",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			flagSet := flag.NewFlagSet("test", 0)
+			require.NoError(t, flagSet.Parse(tt.args))
+			c := cli.NewContext(cli.NewApp(), flagSet, nil)
+			target, err := parseJoinArgs(c, "join <url> <token>")
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, target)
+		})
+	}
+}
+
+func TestJoinTargetScope(t *testing.T) {
+	k0sToken := testK0sToken(t, "aaaaaa.aaaaaaaaaaaaaaaa")
+	worker := &JoinCommandResponse{K0sJoinCommand: "/usr/local/bin/k0s install worker --token-file /etc/k0s/join-token", K0sToken: k0sToken}
+	controller := &JoinCommandResponse{K0sJoinCommand: "/usr/local/bin/k0s install controller --enable-worker --no-taints", K0sToken: k0sToken}
+
+	target := &joinTarget{URL: "10.0.0.1:30000", Token: "abcdef"}
+	assert.NoError(t, target.scope(worker))
+	assert.NoError(t, target.scope(controller))
+	assert.Equal(t, k0sToken, worker.K0sToken, "unscoped joins keep the token of the admin console")
+
+	target.Role = jointoken.RoleWorker
+	target.BootstrapToken = "abcdef.0123456789abcdef"
+	assert.EqualError(t, target.scope(controller), "the join token is scoped to worker nodes but the join command joins a controller")
+	require.NoError(t, target.scope(worker))
+	token, err := joincheck.DecodeToken(worker.K0sToken)
+	require.NoError(t, err)
+	assert.Equal(t, "abcdef.0123456789abcdef", token.BearerToken, "scoped joins authenticate with the bootstrap token")
+}
+
+// testK0sToken returns a k0s join token authenticating with the bootstrap token.
+func testK0sToken(t *testing.T, bootstrapToken string) string {
+	srv := httptest.NewTLSServer(nil)
+	defer srv.Close()
+	config := clientcmdapi.NewConfig()
+	config.Clusters["k0s"] = &clientcmdapi.Cluster{
+		Server:                   srv.URL,
+		CertificateAuthorityData: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}),
+	}
+	config.AuthInfos["kubelet-bootstrap"] = &clientcmdapi.AuthInfo{Token: bootstrapToken}
+	data, err := clientcmd.Write(*config)
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	_, err = gz.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
+)
+
+var kubectlCommand = &cli.Command{
+	Name:      "kubectl",
+	Usage:     "Run the embedded kubectl against the cluster",
+	ArgsUsage: "-- <kubectl arguments>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "as",
+			Usage: "Username to impersonate for the operation",
+		},
+		&cli.StringSliceFlag{
+			Name:  "as-group",
+			Usage: "Group to impersonate for the operation, can be repeated",
+		},
+	},
+	Before: func(c *cli.Context) error {
+		if err := privileges.Check("kubectl", clusterPrivileges()...); err != nil {
+			return err
+		}
+		return nil
+	},
+	Action: func(c *cli.Context) error {
+		cfgpath := defaults.PathToKubeConfig()
+		if _, err := os.Stat(cfgpath); err != nil {
+			return fmt.Errorf("kubeconfig not found at %s", cfgpath)
+		}
+		binpath := defaults.PathToEmbeddedClusterBinary("kubectl")
+		if _, err := os.Stat(binpath); err != nil {
+			return fmt.Errorf("kubectl not found at %s", binpath)
+		}
+
+		// kubectl replaces this process so its output and exit code are passed
+		// through to the caller untouched.
+		argv := append([]string{"kubectl"}, kubectlArgs(c, cfgpath)...)
+		if err := syscall.Exec(binpath, argv, os.Environ()); err != nil {
+			return fmt.Errorf("unable to run kubectl: %w", err)
+		}
+		return nil
+	},
+}
+
+// kubectlArgs returns the arguments to call kubectl with: the kubeconfig and the
+// impersonation flags followed by the arguments provided by the user.
+func kubectlArgs(c *cli.Context, cfgpath string) []string {
+	args := []string{"--kubeconfig", cfgpath}
+	if as := c.String("as"); as != "" {
+		args = append(args, "--as", as)
+	}
+	for _, group := range c.StringSlice("as-group") {
+		args = append(args, "--as-group", group)
+	}
+	return append(args, c.Args().Slice()...)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func Test_kubectlArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{
+			name: "no impersonation",
+			args: []string{"--", "get", "pods", "-A"},
+			want: []string{"--kubeconfig", "/kubeconfig", "get", "pods", "-A"},
+		},
+		{
+			name: "impersonate user and groups",
+			args: []string{"--as", "jane", "--as-group", "dev", "--as-group", "ops", "--", "get", "nodes"},
+			want: []string{
+				"--kubeconfig", "/kubeconfig", "--as", "jane", "--as-group", "dev", "--as-group", "ops", "get", "nodes",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flagSet := flag.NewFlagSet("test", 0)
+			for _, flag := range kubectlCommand.Flags {
+				require.NoError(t, flag.Apply(flagSet))
+			}
+			require.NoError(t, flagSet.Parse(tt.args))
+			c := cli.NewContext(cli.NewApp(), flagSet, nil)
+			assert.Equal(t, tt.want, kubectlArgs(c, "/kubeconfig"))
+		})
+	}
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"fmt"
 
-	"github.com/replicatedhq/embedded-cluster/pkg/config"
 	"github.com/urfave/cli/v2"
 )
 
@@ -12,9 +11,12 @@ var listImagesCommand = &cli.Command{
 	Usage:  "List images embedded in the cluster",
 	Hidden: true,
 	Action: func(c *cli.Context) error {
-		k0sCfg := config.RenderK0sConfig()
+		k0sCfg, disabled, err := renderReleaseK0sConfig()
+		if err != nil {
+			return err
+		}
 
-		metadata, err := gatherVersionMetadata(k0sCfg)
+		metadata, err := gatherVersionMetadata(k0sCfg, disabled)
 		if err != nil {
 			return fmt.Errorf("failed to gather version metadata: %w", err)
 		}
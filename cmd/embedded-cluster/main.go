@@ -11,35 +11,52 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 
+	ecerrors "github.com/replicatedhq/embedded-cluster/pkg/errors"
 	"github.com/replicatedhq/embedded-cluster/pkg/logging"
 )
 
 func main() {
-	ctx, cancel := signal.NotifyContext(
-		context.Background(),
-		syscall.SIGINT,
-		syscall.SIGTERM,
-	)
-	defer cancel()
+	ctx, cancel := interruptContext()
+	defer cancel(nil)
 	logging.SetupLogging()
 	name := path.Base(os.Args[0])
 	var app = &cli.App{
 		Name:    name,
 		Usage:   fmt.Sprintf("Install and manage %s", name),
 		Suggest: true,
-		Commands: []*cli.Command{
-			installCommand,
-			shellCommand,
-			nodeCommands,
-			versionCommand,
-			joinCommand,
-			resetCommand,
-			materializeCommand,
-			updateCommand,
-			restoreCommand,
-		},
+		// completion scripts rely on the --generate-bash-completion flag for all shells.
+		EnableBashCompletion: true,
+		Commands:             commands(),
 	}
-	if err := app.RunContext(ctx, os.Args); err != nil {
-		logrus.Fatal(err)
+	// commands not built in are looked up as plugins, running one does not return.
+	err := runPlugin(app, os.Args[1:])
+	if err == nil {
+		err = app.RunContext(ctx, os.Args)
 	}
+	if err != nil {
+		logrus.Error(err)
+		if hint := ecerrors.Hint(err); hint != "" {
+			logrus.Info(hint)
+		}
+		os.Exit(ecerrors.ExitCode(err))
+	}
+}
+
+// interruptContext returns a context cancelled on the first SIGINT or SIGTERM. Commands
+// stop after the step in progress, a second signal terminates the process right away.
+func interruptContext() (context.Context, context.CancelCauseFunc) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-sigs:
+			signal.Stop(sigs)
+			logrus.Warnf("Received %s, stopping after the current step. Interrupt again to stop immediately.", sig)
+			cancel(fmt.Errorf("received %s", sig))
+		case <-ctx.Done():
+			signal.Stop(sigs)
+		}
+	}()
+	return ctx, cancel
 }
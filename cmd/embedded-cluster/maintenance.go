@@ -0,0 +1,616 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	autopilot "github.com/k0sproject/k0s/pkg/apis/autopilot/v1beta2"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/drainhooks"
+	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
+	"github.com/replicatedhq/embedded-cluster/pkg/prompts"
+)
+
+// maintenanceState records what node drain did on this host so node uncordon can undo it
+// in reverse, even while the kubernetes api is unavailable.
+type maintenanceState struct {
+	Node       string `json:"node"`
+	K0sStopped bool   `json:"k0sStopped"`
+	// K0sUnit is the k0s service stopped by node drain.
+	K0sUnit   string    `json:"k0sUnit,omitempty"`
+	DrainedAt time.Time `json:"drainedAt"`
+}
+
+func maintenanceStatePath() string {
+	return filepath.Join(defaults.EmbeddedClusterHomeDirectory(), "maintenance.json")
+}
+
+func readMaintenanceState(path string) (*maintenanceState, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read maintenance state: %w", err)
+	}
+	var state maintenanceState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("unable to parse maintenance state: %w", err)
+	}
+	return &state, nil
+}
+
+func writeMaintenanceState(path string, state maintenanceState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("unable to marshal maintenance state: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("unable to write maintenance state: %w", err)
+	}
+	return nil
+}
+
+// kubectlDrainArgs returns the arguments of the k0s command draining the node. Pods are
+// evicted through the eviction api so pod disruption budgets are honored, the drain is
+// retried until the timeout if a budget does not allow an eviction yet.
+func kubectlDrainArgs(node string, timeout time.Duration) []string {
+	return []string{
+		"kubectl",
+		"drain",
+		"--ignore-daemonsets",
+		"--delete-emptydir-data",
+		"--timeout", timeout.String(),
+		node,
+	}
+}
+
+// nodeK0sUnit returns the k0s service running the node, controllers run the workloads
+// in the controller service as well.
+func nodeK0sUnit(node corev1.Node) string {
+	if node.Labels["node-role.kubernetes.io/control-plane"] == "true" {
+		return "k0scontroller"
+	}
+	return "k0sworker"
+}
+
+// maintenanceNode returns the node the command acts on, the one provided as argument or
+// this host, and whether it is this host.
+func maintenanceNode(c *cli.Context) (string, bool, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", false, fmt.Errorf("unable to get hostname: %w", err)
+	}
+	if c.Args().Len() > 1 {
+		return "", false, fmt.Errorf("only one node can be provided")
+	}
+	if node := c.Args().First(); node != "" && node != hostname {
+		return node, false, nil
+	}
+	return hostname, true, nil
+}
+
+func beforeMaintenance(c *cli.Context) error {
+	if err := privileges.Check("node "+c.Command.Name, hostPrivileges()...); err != nil {
+		return err
+	}
+	// the admin kubeconfig is needed to cordon and evict pods, it only exists on
+	// controllers. workers are drained from a controller.
+	if _, err := os.Stat(defaults.PathToKubeConfig()); err != nil {
+		return fmt.Errorf("node %s command must be run on a controller node", c.Command.Name)
+	}
+	os.Setenv("KUBECONFIG", defaults.PathToKubeConfig())
+	return nil
+}
+
+var nodeDrainCommand = &cli.Command{
+	Name:         "drain",
+	Usage:        "Cordon a node and evict its pods for maintenance, this node by default",
+	ArgsUsage:    "[node]",
+	BashComplete: completeArgs(completeNodeNames),
+	Flags: []cli.Flag{
+		&cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "How long to wait for the pods to be evicted",
+			Value: 10 * time.Minute,
+		},
+		&cli.BoolFlag{
+			Name:  "stop-k0s",
+			Usage: "Stop the cluster services on this node once drained, they are started again by node uncordon",
+		},
+		&cli.BoolFlag{
+			Name:  "no-prompt",
+			Usage: "Do not prompt user when it is not necessary",
+			Value: false,
+		},
+	},
+	Before: beforeMaintenance,
+	Action: func(c *cli.Context) error {
+		node, local, err := maintenanceNode(c)
+		if err != nil {
+			return err
+		}
+		if c.Bool("stop-k0s") && !local {
+			return fmt.Errorf("--stop-k0s can only be used when draining this node")
+		}
+		kcli, err := kubeutils.KubeClient()
+		if err != nil {
+			return fmt.Errorf("unable to create kube client: %w", err)
+		}
+		var nodeObj corev1.Node
+		if err := kcli.Get(c.Context, client.ObjectKey{Name: node}, &nodeObj); err != nil {
+			return fmt.Errorf("unable to get node %s: %w", node, err)
+		}
+
+		if nodeObj.Labels["node-role.kubernetes.io/control-plane"] == "true" && !c.Bool("no-prompt") {
+			ncps, err := kubeutils.NumOfControlPlaneNodes(c.Context, kcli)
+			if err != nil {
+				return fmt.Errorf("unable to count controller nodes: %w", err)
+			}
+			if ncps == 1 {
+				logrus.Warn("This is the only controller node, the application and the cluster addons will be unavailable until the node is uncordoned.")
+				if !prompts.New().Confirm("Do you want to continue?", false) {
+					return ErrNothingElseToAdd
+				}
+			}
+		}
+
+		in, err := kubeutils.GetLatestInstallation(c.Context, kcli)
+		if err != nil {
+			return fmt.Errorf("unable to get latest installation: %w", err)
+		}
+		if err := drainhooks.Run(c.Context, kcli, in.Spec.Config, drainhooks.PreDrain, node); err != nil {
+			return err
+		}
+		logrus.Infof("Draining node %s...", node)
+		if out, err := exec.Command(k0s, kubectlDrainArgs(node, c.Duration("timeout"))...).CombinedOutput(); err != nil {
+			return fmt.Errorf("could not drain node: %w, %s", err, out)
+		}
+		if err := drainhooks.Run(c.Context, kcli, in.Spec.Config, drainhooks.PostDrain, node); err != nil {
+			return err
+		}
+
+		if local {
+			state := maintenanceState{Node: node, DrainedAt: time.Now().UTC()}
+			if c.Bool("stop-k0s") {
+				unit := nodeK0sUnit(nodeObj)
+				logrus.Info("Stopping the cluster services...")
+				if _, err := helpers.RunCommand("systemctl", "stop", unit); err != nil {
+					return fmt.Errorf("unable to stop %s: %w", unit, err)
+				}
+				state.K0sStopped, state.K0sUnit = true, unit
+			}
+			if err := writeMaintenanceState(maintenanceStatePath(), state); err != nil {
+				return err
+			}
+		}
+		logrus.Infof("Node %s is drained, run node uncordon once the maintenance is over.", node)
+		return nil
+	},
+}
+
+var nodeUncordonCommand = &cli.Command{
+	Name:         "uncordon",
+	Usage:        "Bring a node back from maintenance, this node by default",
+	ArgsUsage:    "[node]",
+	BashComplete: completeArgs(completeNodeNames),
+	Flags: []cli.Flag{
+		&cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "How long to wait for the node to become ready",
+			Value: 5 * time.Minute,
+		},
+	},
+	Before: beforeMaintenance,
+	Action: func(c *cli.Context) error {
+		node, local, err := maintenanceNode(c)
+		if err != nil {
+			return err
+		}
+		var state *maintenanceState
+		if local {
+			if state, err = readMaintenanceState(maintenanceStatePath()); err != nil {
+				return err
+			}
+		}
+
+		if state != nil && state.K0sStopped {
+			unit := state.K0sUnit
+			if unit == "" {
+				unit = k0sUnit()
+			}
+			logrus.Info("Starting the cluster services...")
+			if _, err := helpers.RunCommand("systemctl", "start", unit); err != nil {
+				return fmt.Errorf("unable to start %s: %w", unit, err)
+			}
+		}
+		logrus.Infof("Waiting for node %s to be ready...", node)
+		if err := waitForNodeReady(c.Context, node, c.Duration("timeout")); err != nil {
+			return err
+		}
+		if out, err := exec.Command(k0s, "kubectl", "uncordon", node).CombinedOutput(); err != nil {
+			return fmt.Errorf("could not uncordon node: %w, %s", err, out)
+		}
+		if state != nil {
+			if err := os.Remove(maintenanceStatePath()); err != nil {
+				return fmt.Errorf("unable to remove maintenance state: %w", err)
+			}
+		}
+		logrus.Infof("Node %s is schedulable again.", node)
+		return nil
+	},
+}
+
+// waitForNodeReady waits for the node to report ready. A new client is created on every
+// attempt as the kubernetes api may still be starting.
+func waitForNodeReady(ctx context.Context, name string, timeout time.Duration) error {
+	if err := wait.PollUntilContextTimeout(ctx, 2*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		kcli, err := kubeutils.KubeClient()
+		if err != nil {
+			return false, nil
+		}
+		var node corev1.Node
+		if err := kcli.Get(ctx, client.ObjectKey{Name: name}, &node); err != nil {
+			return false, nil
+		}
+		return newNodeInfo(node, 0).Ready, nil
+	}); err != nil {
+		return fmt.Errorf("timed out waiting for node %s to be ready: %w", name, err)
+	}
+	return nil
+}
+
+var nodeRemoveCommand = &cli.Command{
+	Name:         "remove",
+	Usage:        "Drain a node and remove it from the cluster, including its etcd membership",
+	ArgsUsage:    "<node>",
+	BashComplete: completeArgs(completeNodeNames),
+	Flags: []cli.Flag{
+		&cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "How long to wait for the pods to be evicted",
+			Value: 10 * time.Minute,
+		},
+		&cli.BoolFlag{
+			Name:  "no-prompt",
+			Usage: "Do not prompt user when it is not necessary",
+			Value: false,
+		},
+	},
+	Before: func(c *cli.Context) error {
+		if c.Args().Len() != 1 {
+			return fmt.Errorf("node remove requires the name of the node to remove")
+		}
+		return beforeMaintenance(c)
+	},
+	Action: func(c *cli.Context) error {
+		node, local, err := maintenanceNode(c)
+		if err != nil {
+			return err
+		}
+		if local {
+			return fmt.Errorf("this node can not remove itself, run %s reset on it instead", binName)
+		}
+		kcli, err := kubeutils.KubeClient()
+		if err != nil {
+			return fmt.Errorf("unable to create kube client: %w", err)
+		}
+
+		// the node object may already be gone while its etcd member is still registered,
+		// removing the member is then all that is left to do.
+		var nodeObj corev1.Node
+		found := true
+		if err := kcli.Get(c.Context, client.ObjectKey{Name: node}, &nodeObj); k8serrors.IsNotFound(err) {
+			found = false
+		} else if err != nil {
+			return fmt.Errorf("unable to get node %s: %w", node, err)
+		}
+		members, err := etcdMemberList()
+		if err != nil {
+			return err
+		}
+		peerURL, member := members.Members[node]
+		if !found && !member {
+			return fmt.Errorf("node %s not found", node)
+		}
+		controller := member || nodeObj.Labels["node-role.kubernetes.io/control-plane"] == "true"
+
+		if !c.Bool("no-prompt") {
+			if controller {
+				ncps, err := kubeutils.NumOfControlPlaneNodes(c.Context, kcli)
+				if err != nil {
+					return fmt.Errorf("unable to count controller nodes: %w", err)
+				}
+				if ncps == 3 {
+					logrus.Warn(haWarningMessage)
+				}
+			}
+			logrus.Warnf("Node %s will be removed from the cluster, it has to be reset before it can join again.", node)
+			if !prompts.New().Confirm("Do you want to continue?", false) {
+				return ErrNothingElseToAdd
+			}
+		}
+
+		if found && newNodeInfo(nodeObj, 0).Ready {
+			in, err := kubeutils.GetLatestInstallation(c.Context, kcli)
+			if err != nil {
+				return fmt.Errorf("unable to get latest installation: %w", err)
+			}
+			if err := drainhooks.Run(c.Context, kcli, in.Spec.Config, drainhooks.PreDrain, node); err != nil {
+				return err
+			}
+			logrus.Infof("Draining node %s...", node)
+			if out, err := exec.Command(k0s, kubectlDrainArgs(node, c.Duration("timeout"))...).CombinedOutput(); err != nil {
+				return fmt.Errorf("could not drain node: %w, %s", err, out)
+			}
+			if err := drainhooks.Run(c.Context, kcli, in.Spec.Config, drainhooks.PostDrain, node); err != nil {
+				return err
+			}
+		} else if found {
+			// the pods of an unreachable node can not be evicted, they are garbage
+			// collected once the node is deleted.
+			logrus.Warnf("Node %s is not ready, skipping the drain.", node)
+		}
+
+		logrus.Infof("Removing node %s...", node)
+		if err := deleteNodeObjects(c.Context, kcli, node); err != nil {
+			return err
+		}
+		if member {
+			if err := leaveEtcdMember(node, peerURL); err != nil {
+				return err
+			}
+		}
+		if controller {
+			n, err := invalidateJoinTokens(c.Context, kcli)
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				logrus.Infof("Invalidated %d outstanding join tokens, new ones have to be generated to add nodes.", n)
+			}
+		}
+		logrus.Infof("Node %s removed from the cluster.", node)
+		return nil
+	},
+}
+
+// etcdMemberList returns the members of the etcd cluster as reported by k0s.
+func etcdMemberList() (*etcdMembers, error) {
+	out, err := exec.Command(k0s, "etcd", "member-list").Output()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list etcd members: %w", err)
+	}
+	members := etcdMembers{}
+	if err := json.Unmarshal(out, &members); err != nil {
+		return nil, fmt.Errorf("unable to parse etcd members: %w", err)
+	}
+	return &members, nil
+}
+
+// etcdPeerAddress returns the address of an etcd member from its peer url.
+func etcdPeerAddress(peerURL string) (string, error) {
+	u, err := url.Parse(peerURL)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse etcd peer url %s: %w", peerURL, err)
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("invalid etcd peer url %s", peerURL)
+	}
+	return u.Hostname(), nil
+}
+
+// leaveEtcdMember removes another controller from the etcd cluster. A member left behind
+// by a lost controller counts toward the quorum and can make the cluster unavailable.
+func leaveEtcdMember(node, peerURL string) error {
+	addr, err := etcdPeerAddress(peerURL)
+	if err != nil {
+		return err
+	}
+	if out, err := exec.Command(k0s, "etcd", "leave", "--peer-address", addr).CombinedOutput(); err != nil {
+		return fmt.Errorf("unable to remove node %s from the etcd cluster: %w, %s", node, err, out)
+	}
+	return nil
+}
+
+// deleteNodeObjects deletes the node and, for controllers, its autopilot control node.
+func deleteNodeObjects(ctx context.Context, kcli client.Client, name string) error {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if err := kcli.Delete(ctx, node); err != nil && !k8serrors.IsNotFound(err) {
+		return fmt.Errorf("unable to delete node %s: %w", name, err)
+	}
+	controlNode := &autopilot.ControlNode{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if err := kcli.Delete(ctx, controlNode); err != nil && !k8serrors.IsNotFound(err) {
+		return fmt.Errorf("unable to delete control node %s: %w", name, err)
+	}
+	return nil
+}
+
+// k0sJoinTokenDescription ends the description k0s stores in the bootstrap tokens it issues
+// for nodes to join, tokens created by other tooling do not carry it.
+const k0sJoinTokenDescription = "bootstrap token generated by k0s"
+
+// invalidateJoinTokens deletes the outstanding k0s join tokens. The tokens embed the
+// address of the controller that issued them and that controller can not be told apart,
+// so they are all invalidated when a controller is removed. Bootstrap tokens not issued
+// by k0s are left alone.
+func invalidateJoinTokens(ctx context.Context, kcli client.Client) (int, error) {
+	var secrets corev1.SecretList
+	if err := kcli.List(ctx, &secrets, client.InNamespace(metav1.NamespaceSystem)); err != nil {
+		return 0, fmt.Errorf("unable to list join tokens: %w", err)
+	}
+	var count int
+	for i := range secrets.Items {
+		if secrets.Items[i].Type != corev1.SecretTypeBootstrapToken {
+			continue
+		}
+		if !strings.HasSuffix(string(secrets.Items[i].Data["description"]), k0sJoinTokenDescription) {
+			continue
+		}
+		if err := kcli.Delete(ctx, &secrets.Items[i]); err != nil && !k8serrors.IsNotFound(err) {
+			return count, fmt.Errorf("unable to invalidate join token %s: %w", secrets.Items[i].Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+var nodeRejoinCommand = &cli.Command{
+	Name:         "rejoin",
+	Usage:        "Prepare the cluster for a controller whose disk was wiped to join again",
+	ArgsUsage:    "<node name or address>",
+	BashComplete: completeArgs(completeNodeNames),
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "replace",
+			Usage: "Remove the etcd member and the node objects left by the previous incarnation of the node",
+		},
+		&cli.BoolFlag{
+			Name:  "no-prompt",
+			Usage: "Do not prompt user when it is not necessary",
+			Value: false,
+		},
+	},
+	Before: func(c *cli.Context) error {
+		if c.Args().Len() != 1 {
+			return fmt.Errorf("node rejoin requires the name or the address of the node")
+		}
+		return beforeMaintenance(c)
+	},
+	Action: func(c *cli.Context) error {
+		node, local, err := maintenanceNode(c)
+		if err != nil {
+			return err
+		}
+		if local {
+			return fmt.Errorf("node rejoin must be run from another controller")
+		}
+		kcli, err := kubeutils.KubeClient()
+		if err != nil {
+			return fmt.Errorf("unable to create kube client: %w", err)
+		}
+
+		// the node is looked up by name, or by address if the name is an ip.
+		var nodeObj *corev1.Node
+		addrs := []string{}
+		if ip := net.ParseIP(node); ip != nil {
+			addrs = append(addrs, ip.String())
+			if nodeObj, err = findNodeByAddress(c.Context, kcli, ip.String()); err != nil {
+				return err
+			}
+		} else {
+			var obj corev1.Node
+			if err := kcli.Get(c.Context, client.ObjectKey{Name: node}, &obj); err == nil {
+				nodeObj = &obj
+			} else if !k8serrors.IsNotFound(err) {
+				return fmt.Errorf("unable to get node %s: %w", node, err)
+			}
+		}
+		name := node
+		if nodeObj != nil {
+			name = nodeObj.Name
+			addrs = append(addrs, nodeAddresses(*nodeObj)...)
+			if newNodeInfo(*nodeObj, 0).Ready {
+				return fmt.Errorf("node %s is ready, only nodes that are down can be replaced", name)
+			}
+		}
+
+		members, err := etcdMemberList()
+		if err != nil {
+			return err
+		}
+		member, peerURL, found := findEtcdMember(members.Members, name, addrs)
+		if !found && nodeObj == nil {
+			logrus.Infof("No etcd member or node left for %s, it can join the cluster.", node)
+			return nil
+		}
+		if !c.Bool("replace") {
+			if found {
+				logrus.Warnf("The etcd member %s (%s) is left by the previous incarnation of the node.", member, peerURL)
+			}
+			return fmt.Errorf("node %s is still registered in the cluster, rerun with --replace to replace it", name)
+		}
+
+		if !c.Bool("no-prompt") {
+			logrus.Warnf("The etcd member and the node objects of %s will be removed so the node can join again.", name)
+			if !prompts.New().Confirm("Do you want to continue?", false) {
+				return ErrNothingElseToAdd
+			}
+		}
+		if found {
+			logrus.Infof("Removing the stale etcd member %s (%s)...", member, peerURL)
+			if err := leaveEtcdMember(member, peerURL); err != nil {
+				return err
+			}
+		}
+		if err := deleteNodeObjects(c.Context, kcli, name); err != nil {
+			return err
+		}
+		logrus.Infof("Node %s can now join the cluster again, run the controller join command from the Admin Console on it.", name)
+		return nil
+	},
+}
+
+// findNodeByAddress returns the node with the address, nil if there is none.
+func findNodeByAddress(ctx context.Context, kcli client.Client, addr string) (*corev1.Node, error) {
+	var nodes corev1.NodeList
+	if err := kcli.List(ctx, &nodes); err != nil {
+		return nil, fmt.Errorf("unable to list nodes: %w", err)
+	}
+	for i := range nodes.Items {
+		for _, a := range nodeAddresses(nodes.Items[i]) {
+			if a == addr {
+				return &nodes.Items[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// nodeAddresses returns the internal addresses of the node, the ones etcd peers use.
+func nodeAddresses(node corev1.Node) []string {
+	var addrs []string
+	for _, addr := range node.Status.Addresses {
+		if addr.Type == corev1.NodeInternalIP {
+			addrs = append(addrs, addr.Address)
+		}
+	}
+	return addrs
+}
+
+// findEtcdMember returns the etcd member of a node, matched by peer url first as the
+// address of a node survives a reinstall while its name may not, then by name.
+func findEtcdMember(members map[string]string, name string, addrs []string) (string, string, bool) {
+	for member, peerURL := range members {
+		addr, err := etcdPeerAddress(peerURL)
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if net.ParseIP(a).Equal(net.ParseIP(addr)) {
+				return member, peerURL, true
+			}
+		}
+	}
+	if peerURL, ok := members[name]; ok {
+		return name, peerURL, true
+	}
+	return "", "", false
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	autopilot "github.com/k0sproject/k0s/pkg/apis/autopilot/v1beta2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestMaintenanceState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "maintenance.json")
+	state, err := readMaintenanceState(path)
+	require.NoError(t, err)
+	assert.Nil(t, state)
+
+	drainedAt := time.Date(2024, 10, 17, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, writeMaintenanceState(path, maintenanceState{Node: "node-1", K0sStopped: true, K0sUnit: "k0sworker", DrainedAt: drainedAt}))
+	state, err = readMaintenanceState(path)
+	require.NoError(t, err)
+	assert.Equal(t, &maintenanceState{Node: "node-1", K0sStopped: true, K0sUnit: "k0sworker", DrainedAt: drainedAt}, state)
+}
+
+func TestNodeK0sUnit(t *testing.T) {
+	controller := corev1.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"node-role.kubernetes.io/control-plane": "true"}}}
+	assert.Equal(t, "k0scontroller", nodeK0sUnit(controller))
+	assert.Equal(t, "k0sworker", nodeK0sUnit(corev1.Node{}))
+}
+
+func TestKubectlDrainArgs(t *testing.T) {
+	assert.Equal(t,
+		[]string{"kubectl", "drain", "--ignore-daemonsets", "--delete-emptydir-data", "--timeout", "10m0s", "node-1"},
+		kubectlDrainArgs("node-1", 10*time.Minute),
+	)
+}
+
+func TestEtcdPeerAddress(t *testing.T) {
+	addr, err := etcdPeerAddress("https://10.0.0.2:2380")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.2", addr)
+	addr, err = etcdPeerAddress("https://[fd00::2]:2380")
+	require.NoError(t, err)
+	assert.Equal(t, "fd00::2", addr)
+	_, err = etcdPeerAddress("10.0.0.2")
+	assert.Error(t, err)
+}
+
+func TestDeleteNodeObjects(t *testing.T) {
+	kcli := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		testNode("controller-2", true, "v1.30.1+k0s"),
+		&autopilot.ControlNode{ObjectMeta: metav1.ObjectMeta{Name: "controller-2"}},
+		testNode("worker-1", false, "v1.30.1+k0s"),
+	).Build()
+
+	require.NoError(t, deleteNodeObjects(context.Background(), kcli, "controller-2"))
+	err := kcli.Get(context.Background(), client.ObjectKey{Name: "controller-2"}, &corev1.Node{})
+	assert.True(t, k8serrors.IsNotFound(err))
+	err = kcli.Get(context.Background(), client.ObjectKey{Name: "controller-2"}, &autopilot.ControlNode{})
+	assert.True(t, k8serrors.IsNotFound(err))
+
+	// workers have no control node and nodes may already be gone.
+	require.NoError(t, deleteNodeObjects(context.Background(), kcli, "worker-1"))
+	require.NoError(t, deleteNodeObjects(context.Background(), kcli, "worker-1"))
+}
+
+func TestInvalidateJoinTokens(t *testing.T) {
+	kcli := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "bootstrap-token-abcdef", Namespace: metav1.NamespaceSystem},
+			Type:       corev1.SecretTypeBootstrapToken,
+			Data:       map[string][]byte{"description": []byte("Controller bootstrap token generated by k0s")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "bootstrap-token-ghijkl", Namespace: metav1.NamespaceSystem},
+			Type:       corev1.SecretTypeBootstrapToken,
+			Data:       map[string][]byte{"description": []byte("Worker bootstrap token generated by k0s")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "bootstrap-token-mnopqr", Namespace: metav1.NamespaceSystem},
+			Type:       corev1.SecretTypeBootstrapToken,
+			Data:       map[string][]byte{"description": []byte("created by an operator")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: metav1.NamespaceSystem},
+			Type:       corev1.SecretTypeOpaque,
+		},
+	).Build()
+
+	n, err := invalidateJoinTokens(context.Background(), kcli)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	var secrets corev1.SecretList
+	require.NoError(t, kcli.List(context.Background(), &secrets, client.InNamespace(metav1.NamespaceSystem)))
+	var names []string
+	for _, secret := range secrets.Items {
+		names = append(names, secret.Name)
+	}
+	assert.ElementsMatch(t, []string{"bootstrap-token-mnopqr", "other"}, names)
+}
+
+func TestFindEtcdMember(t *testing.T) {
+	members := map[string]string{
+		"controller-1": "https://10.0.0.1:2380",
+		"controller-2": "https://10.0.0.2:2380",
+	}
+
+	// the address wins over the name as the host may have been renamed.
+	member, peerURL, found := findEtcdMember(members, "controller-3", []string{"10.0.0.2"})
+	assert.True(t, found)
+	assert.Equal(t, "controller-2", member)
+	assert.Equal(t, "https://10.0.0.2:2380", peerURL)
+
+	member, _, found = findEtcdMember(members, "controller-1", nil)
+	assert.True(t, found)
+	assert.Equal(t, "controller-1", member)
+
+	_, _, found = findEtcdMember(members, "controller-3", []string{"10.0.0.3"})
+	assert.False(t, found)
+}
+
+func TestFindNodeByAddress(t *testing.T) {
+	node := testNode("controller-2", true, "v1.30.1+k0s")
+	node.Status.Addresses = []corev1.NodeAddress{
+		{Type: corev1.NodeHostName, Address: "controller-2"},
+		{Type: corev1.NodeInternalIP, Address: "10.0.0.2"},
+	}
+	kcli := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		testNode("controller-1", true, "v1.30.1+k0s"), node,
+	).Build()
+
+	found, err := findNodeByAddress(context.Background(), kcli, "10.0.0.2")
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, "controller-2", found.Name)
+
+	found, err = findNodeByAddress(context.Background(), kcli, "10.0.0.3")
+	require.NoError(t, err)
+	assert.Nil(t, found)
+}
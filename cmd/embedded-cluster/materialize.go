@@ -2,11 +2,11 @@ package main
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/urfave/cli/v2"
 
 	"github.com/replicatedhq/embedded-cluster/pkg/goods"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
 )
 
 var materializeCommand = &cli.Command{
@@ -21,8 +21,8 @@ var materializeCommand = &cli.Command{
 		},
 	},
 	Before: func(c *cli.Context) error {
-		if os.Getuid() != 0 {
-			return fmt.Errorf("materialize command must be run as root")
+		if err := privileges.Check("materialize", hostPrivileges()...); err != nil {
+			return err
 		}
 		return nil
 	},
@@ -18,6 +18,7 @@ import (
 	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
 	"github.com/replicatedhq/embedded-cluster/pkg/goods"
 	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+	"github.com/replicatedhq/embedded-cluster/pkg/osmatrix"
 	"github.com/replicatedhq/embedded-cluster/pkg/release"
 	"github.com/replicatedhq/embedded-cluster/pkg/versions"
 )
@@ -27,8 +28,11 @@ var metadataCommand = &cli.Command{
 	Usage:  "Print metadata about this release",
 	Hidden: true,
 	Action: func(c *cli.Context) error {
-		k0sCfg := config.RenderK0sConfig()
-		metadata, err := gatherVersionMetadata(k0sCfg)
+		k0sCfg, disabled, err := renderReleaseK0sConfig()
+		if err != nil {
+			return err
+		}
+		metadata, err := gatherVersionMetadata(k0sCfg, disabled)
 		if err != nil {
 			return fmt.Errorf("failed to gather version metadata: %w", err)
 		}
@@ -41,11 +45,32 @@ var metadataCommand = &cli.Command{
 	},
 }
 
+// renderReleaseK0sConfig renders the k0s configuration with the overrides and the
+// component toggles of the release applied, and returns it along with the k0s components
+// disabled by the release. The images listed from them are the ones the cluster deploys.
+func renderReleaseK0sConfig() (*k0sconfig.ClusterConfig, []string, error) {
+	cfg, err := applyReleaseOverrides(config.RenderK0sConfig())
+	if err != nil {
+		return nil, nil, err
+	}
+	embcfg, err := release.GetEmbeddedClusterConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to get embedded cluster config: %w", err)
+	}
+	if embcfg == nil {
+		return cfg, config.DisabledComponents(nil), nil
+	}
+	if err := config.ApplyComponents(cfg, &embcfg.Spec); err != nil {
+		return nil, nil, err
+	}
+	return cfg, config.DisabledComponents(&embcfg.Spec), nil
+}
+
 // gatherVersionMetadata returns the release metadata for this version of
 // embedded cluster. Release metadata involves the default versions of the
 // components that are included in the release plus the default values used
-// when deploying them.
-func gatherVersionMetadata(k0sCfg *k0sconfig.ClusterConfig) (*types.ReleaseMetadata, error) {
+// when deploying them. The images of the disabled k0s components are not listed.
+func gatherVersionMetadata(k0sCfg *k0sconfig.ClusterConfig, disabled []string) (*types.ReleaseMetadata, error) {
 	applier := addons.NewApplier(
 		addons.WithoutPrompt(),
 		addons.OnlyDefaults(),
@@ -87,9 +112,10 @@ func gatherVersionMetadata(k0sCfg *k0sconfig.ClusterConfig) (*types.ReleaseMetad
 	}
 
 	meta := types.ReleaseMetadata{
-		Versions:  versionsMap,
-		K0sSHA:    sha,
-		Artifacts: artifacts,
+		Versions:    versionsMap,
+		K0sSHA:      sha,
+		Artifacts:   artifacts,
+		SupportedOS: osmatrix.Supported,
 	}
 
 	chtconfig, repconfig, err := applier.GenerateHelmConfigs(
@@ -120,7 +146,7 @@ func gatherVersionMetadata(k0sCfg *k0sconfig.ClusterConfig) (*types.ReleaseMetad
 	}
 	meta.BuiltinConfigs = builtinCharts
 
-	meta.K0sImages = config.ListK0sImages(k0sCfg)
+	meta.K0sImages = config.ListK0sImages(k0sCfg, disabled...)
 
 	additionalImages, err := applier.GetAdditionalImages()
 	if err != nil {
@@ -131,7 +157,7 @@ func gatherVersionMetadata(k0sCfg *k0sconfig.ClusterConfig) (*types.ReleaseMetad
 	meta.K0sImages = helpers.UniqueStringSlice(meta.K0sImages)
 	sort.Strings(meta.K0sImages)
 
-	meta.Images = config.ListK0sImages(k0sCfg)
+	meta.Images = config.ListK0sImages(k0sCfg, disabled...)
 
 	images, err := applier.GetImages()
 	if err != nil {
@@ -1,15 +1,295 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/urfave/cli/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
+	"github.com/replicatedhq/embedded-cluster/pkg/versions"
 )
 
 var nodeCommands = &cli.Command{
-	Name:   "node",
-	Usage:  "Manage cluster nodes",
-	Hidden: true, // this has been replaced by top-level commands
+	Name:  "node",
+	Usage: "Manage cluster nodes",
 	Subcommands: []*cli.Command{
-		joinCommand,
-		resetCommand,
+		nodeListCommand,
+		nodeStatusCommand,
+		nodeDrainCommand,
+		nodeUncordonCommand,
+		nodeRemoveCommand,
+		nodeRejoinCommand,
+		nodeApplyConfigCommand,
+		nodeJoinCommandCommand,
+		// these have been replaced by top-level commands
+		hiddenCommand(joinCommand),
+		hiddenCommand(resetCommand),
 	},
 }
+
+// hiddenCommand returns a copy of the command hidden from the help output.
+func hiddenCommand(cmd *cli.Command) *cli.Command {
+	hidden := *cmd
+	hidden.Hidden = true
+	return &hidden
+}
+
+// podPressureThreshold is the share of the pods a node can run above which the node is
+// reported under pod pressure.
+const podPressureThreshold = 0.9
+
+// nodeInfo is the overview of a node.
+type nodeInfo struct {
+	Name           string    `json:"name"`
+	Role           string    `json:"role"`
+	Ready          bool      `json:"ready"`
+	KubeletVersion string    `json:"kubeletVersion"`
+	Pods           int       `json:"pods"`
+	PodCapacity    int64     `json:"podCapacity"`
+	Pressure       []string  `json:"pressure,omitempty"`
+	VersionSkew    bool      `json:"versionSkew"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// clusterNodesStatus is the overview of the health of the cluster nodes.
+type clusterNodesStatus struct {
+	// Version is the embedded cluster version the cluster runs.
+	Version string `json:"version,omitempty"`
+	// BinaryVersion is the version of the binary the command is run with.
+	BinaryVersion string `json:"binaryVersion"`
+	// BinaryVersionSkew is set when the binary and the cluster versions differ.
+	BinaryVersionSkew bool `json:"binaryVersionSkew"`
+	// ControlPlaneVersion is the most recent kubelet version among the controllers,
+	// nodes running another version are skewed.
+	ControlPlaneVersion string     `json:"controlPlaneVersion,omitempty"`
+	ReadyNodes          int        `json:"readyNodes"`
+	Healthy             bool       `json:"healthy"`
+	Nodes               []nodeInfo `json:"nodes"`
+}
+
+var nodeListCommand = &cli.Command{
+	Name:   "list",
+	Usage:  "List the cluster nodes with their role, readiness and version",
+	Flags:  []cli.Flag{nodeOutputFlag()},
+	Before: beforeNodeQuery,
+	Action: func(c *cli.Context) error {
+		st, err := queryNodesStatus(c.Context)
+		if err != nil {
+			return err
+		}
+		if c.String("output") == "json" {
+			return printJSON(st.Nodes)
+		}
+		printNodes(st.Nodes)
+		return nil
+	},
+}
+
+var nodeStatusCommand = &cli.Command{
+	Name:   "status",
+	Usage:  "Show the health of the cluster nodes, exits with a non-zero code if any node is unhealthy",
+	Flags:  []cli.Flag{nodeOutputFlag()},
+	Before: beforeNodeQuery,
+	Action: func(c *cli.Context) error {
+		st, err := queryNodesStatus(c.Context)
+		if err != nil {
+			return err
+		}
+		if c.String("output") == "json" {
+			if err := printJSON(st); err != nil {
+				return err
+			}
+		} else {
+			printNodesStatus(st)
+		}
+		if !st.Healthy {
+			return ErrNothingElseToAdd
+		}
+		return nil
+	},
+}
+
+func nodeOutputFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "output",
+		Aliases: []string{"o"},
+		Usage:   "Output format, one of text or json.",
+		Value:   "text",
+	}
+}
+
+func beforeNodeQuery(c *cli.Context) error {
+	if err := privileges.Check("node "+c.Command.Name, clusterPrivileges()...); err != nil {
+		return err
+	}
+	if err := validateOutputFlag(c); err != nil {
+		return err
+	}
+	os.Setenv("KUBECONFIG", defaults.PathToKubeConfig())
+	return nil
+}
+
+func queryNodesStatus(ctx context.Context) (*clusterNodesStatus, error) {
+	kcli, err := kubeutils.KubeClient()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create kube client: %w", err)
+	}
+	return nodesStatus(ctx, kcli)
+}
+
+// nodesStatus builds the overview of the cluster nodes.
+func nodesStatus(ctx context.Context, kcli client.Client) (*clusterNodesStatus, error) {
+	var nodes corev1.NodeList
+	if err := kcli.List(ctx, &nodes); err != nil {
+		return nil, fmt.Errorf("unable to list nodes: %w", err)
+	}
+	var pods corev1.PodList
+	if err := kcli.List(ctx, &pods); err != nil {
+		return nil, fmt.Errorf("unable to list pods: %w", err)
+	}
+	podsPerNode := map[string]int{}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		podsPerNode[pod.Spec.NodeName]++
+	}
+
+	st := &clusterNodesStatus{
+		BinaryVersion: versions.Version,
+		Healthy:       true,
+	}
+	var controlPlane *semver.Version
+	for _, node := range nodes.Items {
+		info := newNodeInfo(node, podsPerNode[node.Name])
+		if info.Ready {
+			st.ReadyNodes++
+		}
+		if !info.Ready || len(info.Pressure) > 0 {
+			st.Healthy = false
+		}
+		if v, err := semver.NewVersion(info.KubeletVersion); err == nil && info.Role == "controller" {
+			if controlPlane == nil || v.GreaterThan(controlPlane) {
+				controlPlane = v
+				st.ControlPlaneVersion = info.KubeletVersion
+			}
+		}
+		st.Nodes = append(st.Nodes, info)
+	}
+	sort.Slice(st.Nodes, func(i, j int) bool {
+		if st.Nodes[i].Role != st.Nodes[j].Role {
+			return st.Nodes[i].Role == "controller"
+		}
+		return st.Nodes[i].Name < st.Nodes[j].Name
+	})
+	for i := range st.Nodes {
+		if st.ControlPlaneVersion != "" && st.Nodes[i].KubeletVersion != st.ControlPlaneVersion {
+			st.Nodes[i].VersionSkew = true
+		}
+	}
+
+	in, err := kubeutils.GetLatestInstallation(ctx, kcli)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get installation: %w", err)
+	}
+	if in.Spec.Config != nil {
+		st.Version = in.Spec.Config.Version
+		st.BinaryVersionSkew = strings.TrimPrefix(st.Version, "v") != strings.TrimPrefix(st.BinaryVersion, "v")
+	}
+	return st, nil
+}
+
+func newNodeInfo(node corev1.Node, pods int) nodeInfo {
+	info := nodeInfo{
+		Name:           node.Name,
+		Role:           "worker",
+		KubeletVersion: node.Status.NodeInfo.KubeletVersion,
+		Pods:           pods,
+		PodCapacity:    node.Status.Allocatable.Pods().Value(),
+		CreatedAt:      node.CreationTimestamp.Time,
+	}
+	if node.Labels["node-role.kubernetes.io/control-plane"] == "true" {
+		info.Role = "controller"
+	}
+	for _, cond := range node.Status.Conditions {
+		switch cond.Type {
+		case corev1.NodeReady:
+			info.Ready = cond.Status == corev1.ConditionTrue
+		case corev1.NodeMemoryPressure, corev1.NodeDiskPressure, corev1.NodePIDPressure:
+			if cond.Status == corev1.ConditionTrue {
+				info.Pressure = append(info.Pressure, string(cond.Type))
+			}
+		}
+	}
+	if info.PodCapacity > 0 && float64(pods) >= podPressureThreshold*float64(info.PodCapacity) {
+		info.Pressure = append(info.Pressure, "PodPressure")
+	}
+	return info
+}
+
+func printJSON(v interface{}) error {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal output: %w", err)
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+// printNodes prints a table with the nodes.
+func printNodes(nodes []nodeInfo) {
+	writer := table.NewWriter()
+	writer.AppendHeader(table.Row{"name", "role", "status", "version", "pods", "age"})
+	for _, node := range nodes {
+		status := "NotReady"
+		if node.Ready {
+			status = "Ready"
+		}
+		if len(node.Pressure) > 0 {
+			status = fmt.Sprintf("%s,%s", status, strings.Join(node.Pressure, ","))
+		}
+		version := node.KubeletVersion
+		if node.VersionSkew {
+			version += " (skewed)"
+		}
+		writer.AppendRow(table.Row{
+			node.Name,
+			node.Role,
+			status,
+			version,
+			fmt.Sprintf("%d/%d", node.Pods, node.PodCapacity),
+			duration.HumanDuration(time.Since(node.CreatedAt)),
+		})
+	}
+	fmt.Printf("%s\n", writer.Render())
+}
+
+// printNodesStatus prints the health of the nodes in a human readable format.
+func printNodesStatus(st *clusterNodesStatus) {
+	fmt.Printf("Healthy:       %t\n", st.Healthy)
+	fmt.Printf("Version:       %s\n", st.Version)
+	fmt.Printf("Control plane: %s\n", st.ControlPlaneVersion)
+	fmt.Printf("Ready nodes:   %d/%d\n", st.ReadyNodes, len(st.Nodes))
+	printNodes(st.Nodes)
+	if st.BinaryVersionSkew {
+		fmt.Printf("This binary is version %s, the cluster runs version %s.\n", st.BinaryVersion, st.Version)
+	}
+	for _, node := range st.Nodes {
+		if node.VersionSkew {
+			fmt.Printf("Node %s runs kubelet %s, the control plane runs %s.\n", node.Name, node.KubeletVersion, st.ControlPlaneVersion)
+		}
+	}
+}
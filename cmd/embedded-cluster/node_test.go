@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/versions"
+)
+
+func testNode(name string, controller bool, kubelet string, conditions ...corev1.NodeCondition) *corev1.Node {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{}},
+		Status: corev1.NodeStatus{
+			NodeInfo:    corev1.NodeSystemInfo{KubeletVersion: kubelet},
+			Allocatable: corev1.ResourceList{corev1.ResourcePods: resource.MustParse("10")},
+			Conditions:  conditions,
+		},
+	}
+	if controller {
+		node.Labels["node-role.kubernetes.io/control-plane"] = "true"
+	}
+	return node
+}
+
+func TestNodesStatus(t *testing.T) {
+	ready := corev1.NodeCondition{Type: corev1.NodeReady, Status: corev1.ConditionTrue}
+	notReady := corev1.NodeCondition{Type: corev1.NodeReady, Status: corev1.ConditionFalse}
+	diskPressure := corev1.NodeCondition{Type: corev1.NodeDiskPressure, Status: corev1.ConditionTrue}
+
+	objects := []client.Object{
+		testNode("worker-1", false, "v1.29.5+k0s", ready),
+		testNode("controller-2", true, "v1.29.5+k0s", ready),
+		testNode("controller-1", true, "v1.30.1+k0s", ready, diskPressure),
+		testNode("worker-2", false, "v1.30.1+k0s", notReady),
+		&ecv1beta1.Installation{
+			ObjectMeta: metav1.ObjectMeta{Name: "20241017000000"},
+			Spec:       ecv1beta1.InstallationSpec{Config: &ecv1beta1.ConfigSpec{Version: "1.12.1+k8s-1.30"}},
+		},
+	}
+	for i := 0; i < 9; i++ {
+		objects = append(objects, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("pod-%d", i), Namespace: "default"},
+			Spec:       corev1.PodSpec{NodeName: "worker-1"},
+		})
+	}
+	objects = append(objects, &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "completed", Namespace: "default"},
+		Spec:       corev1.PodSpec{NodeName: "worker-2"},
+		Status:     corev1.PodStatus{Phase: corev1.PodSucceeded},
+	})
+	kcli := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objects...).Build()
+
+	st, err := nodesStatus(context.Background(), kcli)
+	require.NoError(t, err)
+	assert.False(t, st.Healthy)
+	assert.Equal(t, 3, st.ReadyNodes)
+	assert.Equal(t, "1.12.1+k8s-1.30", st.Version)
+	assert.Equal(t, versions.Version, st.BinaryVersion)
+	assert.True(t, st.BinaryVersionSkew)
+	assert.Equal(t, "v1.30.1+k0s", st.ControlPlaneVersion)
+
+	var names []string
+	for _, node := range st.Nodes {
+		names = append(names, node.Name)
+	}
+	assert.Equal(t, []string{"controller-1", "controller-2", "worker-1", "worker-2"}, names)
+
+	assert.Equal(t, "controller", st.Nodes[0].Role)
+	assert.Equal(t, []string{"DiskPressure"}, st.Nodes[0].Pressure)
+	assert.False(t, st.Nodes[0].VersionSkew)
+	assert.True(t, st.Nodes[1].VersionSkew)
+	assert.Equal(t, "worker", st.Nodes[2].Role)
+	assert.Equal(t, 9, st.Nodes[2].Pods)
+	assert.Equal(t, int64(10), st.Nodes[2].PodCapacity)
+	assert.Equal(t, []string{"PodPressure"}, st.Nodes[2].Pressure)
+	assert.False(t, st.Nodes[3].Ready)
+	assert.Equal(t, 0, st.Nodes[3].Pods)
+}
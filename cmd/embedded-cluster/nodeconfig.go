@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/nodeconfig"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
+	"github.com/replicatedhq/embedded-cluster/pkg/prompts"
+)
+
+// kubeletKubeConfig holds the kubelet credentials, workers reach the cluster with them.
+const kubeletKubeConfig = "/var/lib/k0s/kubelet.conf"
+
+// nodeConfigDropInPath returns the path of the drop-in selecting the worker profile of the
+// k0s unit.
+func nodeConfigDropInPath(unit string) string {
+	return filepath.Join("/etc/systemd/system", unit+".service.d", nodeconfig.DropInFile)
+}
+
+// writeNodeConfigDropIn writes the drop-in setting the worker profile the k0s unit starts
+// with, an empty profile selects the default one. The unit must read the profile from its
+// environment.
+func writeNodeConfigDropIn(unitPath, dropInPath, profile string) error {
+	data, err := os.ReadFile(unitPath)
+	if err != nil {
+		return fmt.Errorf("unable to read k0s unit: %w", err)
+	}
+	if !nodeconfig.ReadsProfile(string(data)) {
+		return fmt.Errorf("%s does not read the worker profile from %s, the node must be joined again", unitPath, nodeconfig.ProfileEnv)
+	}
+	if err := os.MkdirAll(filepath.Dir(dropInPath), 0755); err != nil {
+		return fmt.Errorf("unable to create directory: %w", err)
+	}
+	if err := os.WriteFile(dropInPath, []byte(nodeconfig.DropIn(profile)), 0644); err != nil {
+		return fmt.Errorf("unable to write %s: %w", dropInPath, err)
+	}
+	return nil
+}
+
+// writeDefaultNodeConfigDropIn writes the drop-in starting the installed k0s unit with the
+// default worker profile.
+func writeDefaultNodeConfigDropIn() error {
+	unit := k0sUnit()
+	unitPath := filepath.Join("/etc/systemd/system", unit+".service")
+	return writeNodeConfigDropIn(unitPath, nodeConfigDropInPath(unit), "")
+}
+
+var nodeApplyConfigCommand = &cli.Command{
+	Name:  "apply-config",
+	Usage: "Restart this node with the kubelet configuration of the NodeConfig selecting it. Nodes are not restarted by the operator, run it on each selected node one at a time",
+	Flags: []cli.Flag{
+		&cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "How long to wait for the pods to be evicted and for the node to become ready",
+			Value: 10 * time.Minute,
+		},
+		&cli.BoolFlag{
+			Name:  "no-prompt",
+			Usage: "Do not prompt user when it is not necessary",
+			Value: false,
+		},
+	},
+	Before: func(c *cli.Context) error {
+		if err := privileges.Check("node apply-config", hostPrivileges()...); err != nil {
+			return err
+		}
+		// controllers drain themselves with the admin credentials, workers can only read
+		// and annotate their own node with the kubelet ones.
+		for _, kubeconfig := range []string{defaults.PathToKubeConfig(), kubeletKubeConfig} {
+			if _, err := os.Stat(kubeconfig); err == nil {
+				os.Setenv("KUBECONFIG", kubeconfig)
+				return nil
+			}
+		}
+		return fmt.Errorf("node apply-config must be run on a node that joined the cluster")
+	},
+	Action: func(c *cli.Context) error {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("unable to get hostname: %w", err)
+		}
+		kcli, err := kubeutils.KubeClient()
+		if err != nil {
+			return fmt.Errorf("unable to create kube client: %w", err)
+		}
+		var node corev1.Node
+		if err := kcli.Get(c.Context, client.ObjectKey{Name: hostname}, &node); err != nil {
+			return fmt.Errorf("unable to get node %s: %w", hostname, err)
+		}
+
+		desired := node.Annotations[nodeconfig.DesiredAnnotation]
+		if desired == node.Annotations[nodeconfig.AppliedAnnotation] {
+			logrus.Infof("Node %s already runs with its configuration.", hostname)
+			return nil
+		}
+		profile := nodeconfig.ProfileFromAnnotation(desired)
+		admin := os.Getenv("KUBECONFIG") == defaults.PathToKubeConfig()
+		if !admin && !node.Spec.Unschedulable {
+			return fmt.Errorf("node %s must be drained first, run node drain %s on a controller node", hostname, hostname)
+		}
+
+		if !c.Bool("no-prompt") {
+			if profile == "" {
+				logrus.Infof("Node %s is going to be restarted with the default kubelet configuration.", hostname)
+			} else {
+				logrus.Infof("Node %s is going to be restarted with the worker profile %s.", hostname, profile)
+			}
+			if !prompts.New().Confirm("Do you want to continue?", false) {
+				return ErrNothingElseToAdd
+			}
+		}
+
+		if admin && !node.Spec.Unschedulable {
+			logrus.Infof("Draining node %s...", hostname)
+			if out, err := exec.Command(k0s, kubectlDrainArgs(hostname, c.Duration("timeout"))...).CombinedOutput(); err != nil {
+				return fmt.Errorf("could not drain node: %w, %s", err, out)
+			}
+		}
+
+		unit := k0sUnit()
+		unitPath := filepath.Join("/etc/systemd/system", unit+".service")
+		if err := writeNodeConfigDropIn(unitPath, nodeConfigDropInPath(unit), profile); err != nil {
+			return err
+		}
+		logrus.Info("Restarting the cluster services of this node...")
+		if _, err := helpers.RunCommand("systemctl", "daemon-reload"); err != nil {
+			return fmt.Errorf("unable to reload systemctl daemon: %w", err)
+		}
+		if _, err := helpers.RunCommand("systemctl", "restart", unit); err != nil {
+			return fmt.Errorf("unable to restart %s: %w", unit, err)
+		}
+		logrus.Infof("Waiting for node %s to be ready...", hostname)
+		if err := waitForNodeReady(c.Context, hostname, c.Duration("timeout")); err != nil {
+			return err
+		}
+
+		// the api may have restarted along with k0s, a new client is created.
+		if kcli, err = kubeutils.KubeClient(); err != nil {
+			return fmt.Errorf("unable to create kube client: %w", err)
+		}
+		if err := kcli.Get(c.Context, client.ObjectKey{Name: hostname}, &node); err != nil {
+			return fmt.Errorf("unable to get node %s: %w", hostname, err)
+		}
+		patch := client.MergeFrom(node.DeepCopy())
+		if desired == "" {
+			delete(node.Annotations, nodeconfig.AppliedAnnotation)
+		} else {
+			node.Annotations[nodeconfig.AppliedAnnotation] = desired
+		}
+		if err := kcli.Patch(c.Context, &node, patch); err != nil {
+			return fmt.Errorf("unable to record the configuration on node %s: %w", hostname, err)
+		}
+
+		if !admin {
+			logrus.Infof("Node %s runs with its configuration, run node uncordon %s on a controller node to make it schedulable again.", hostname, hostname)
+			return nil
+		}
+		if out, err := exec.Command(k0s, "kubectl", "uncordon", hostname).CombinedOutput(); err != nil {
+			return fmt.Errorf("could not uncordon node: %w, %s", err, out)
+		}
+		logrus.Infof("Node %s runs with its configuration and is schedulable again.", hostname)
+		return nil
+	},
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_writeNodeConfigDropIn(t *testing.T) {
+	dir := t.TempDir()
+	unitPath := filepath.Join(dir, "k0sworker.service")
+	dropInPath := filepath.Join(dir, "k0sworker.service.d", "node-config.conf")
+	unit := "[Service]\nExecStart=/usr/local/bin/k0s worker \"--token-file=/etc/k0s/k0stoken\" \"--profile=${K0S_WORKER_PROFILE}\"\nRestart=always\n"
+	require.NoError(t, os.WriteFile(unitPath, []byte(unit), 0644))
+
+	require.NoError(t, writeNodeConfigDropIn(unitPath, dropInPath, "nodeconfig-gpu"))
+	data, err := os.ReadFile(dropInPath)
+	require.NoError(t, err)
+	assert.Equal(t, "[Service]\nEnvironment=K0S_WORKER_PROFILE=nodeconfig-gpu\n", string(data))
+
+	// going back to the default profile selects it in the drop-in.
+	require.NoError(t, writeNodeConfigDropIn(unitPath, dropInPath, ""))
+	data, err = os.ReadFile(dropInPath)
+	require.NoError(t, err)
+	assert.Equal(t, "[Service]\nEnvironment=K0S_WORKER_PROFILE=default\n", string(data))
+
+	// units installed without the profile flag are refused.
+	require.NoError(t, os.WriteFile(unitPath, []byte("[Service]\nExecStart=/usr/local/bin/k0s worker\n"), 0644))
+	assert.Error(t, writeNodeConfigDropIn(unitPath, dropInPath, "nodeconfig-gpu"))
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/addons"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	ecerrors "github.com/replicatedhq/embedded-cluster/pkg/errors"
+)
+
+// commandResult is the machine readable document printed once install, join or reset
+// finishes when --output json is set, for provisioning tools like Terraform or Ansible.
+type commandResult struct {
+	Command        string              `json:"command"`
+	Success        bool                `json:"success"`
+	Error          string              `json:"error,omitempty"`
+	ErrorKind      string              `json:"errorKind,omitempty"`
+	ExitCode       int                 `json:"exitCode"`
+	NodeName       string              `json:"nodeName,omitempty"`
+	KubeconfigPath string              `json:"kubeconfigPath,omitempty"`
+	AdminConsole   *adminConsoleResult `json:"adminConsole,omitempty"`
+	StartedAt      time.Time           `json:"startedAt"`
+	FinishedAt     time.Time           `json:"finishedAt"`
+	// DurationsSeconds holds the time spent in each phase of the command and in total.
+	DurationsSeconds map[string]float64 `json:"durationsSeconds"`
+
+	out        io.Writer
+	phase      string
+	phaseStart time.Time
+	emitted    bool
+}
+
+// adminConsoleResult tells how to reach the Admin Console. The password is not part of
+// the document, only the secret holding its hash.
+type adminConsoleResult struct {
+	URL            string `json:"url"`
+	PasswordSecret string `json:"passwordSecret,omitempty"`
+}
+
+func newCommandResult(command string, out io.Writer) *commandResult {
+	now := time.Now()
+	return &commandResult{
+		Command:          command,
+		StartedAt:        now,
+		DurationsSeconds: map[string]float64{},
+		out:              out,
+		phase:            "setup",
+		phaseStart:       now,
+	}
+}
+
+// startPhase ends the current phase and starts timing the provided one. It is a no-op
+// when no result is being recorded.
+func (r *commandResult) startPhase(name string) {
+	if r == nil {
+		return
+	}
+	now := time.Now()
+	r.DurationsSeconds[r.phase] += now.Sub(r.phaseStart).Seconds()
+	r.phase, r.phaseStart = name, now
+}
+
+// emit prints the result document for the outcome of the command. Only the first call
+// prints the document, it is a no-op when no result is being recorded.
+func (r *commandResult) emit(err error) error {
+	if r == nil || r.emitted {
+		return nil
+	}
+	r.emitted = true
+	r.startPhase("")
+	delete(r.DurationsSeconds, "")
+	r.FinishedAt = time.Now()
+	r.DurationsSeconds["total"] = r.FinishedAt.Sub(r.StartedAt).Seconds()
+	r.Success = err == nil
+	r.ExitCode = ecerrors.ExitCode(err)
+	if err != nil {
+		r.ErrorKind = string(ecerrors.KindOf(err))
+		r.Error = err.Error()
+		if r.Error == "" {
+			r.Error = fmt.Sprintf("%s failed, see the output above", r.Command)
+		}
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal result: %w", err)
+	}
+	_, err = fmt.Fprintln(r.out, string(data))
+	return err
+}
+
+type commandResultKey struct{}
+
+// resultFromContext returns the result being recorded, nil if --output json is not set.
+func resultFromContext(ctx context.Context) *commandResult {
+	r, _ := ctx.Value(commandResultKey{}).(*commandResult)
+	return r
+}
+
+// validateOutputFlag validates the --output flag.
+func validateOutputFlag(c *cli.Context) error {
+	if output := c.String("output"); output != "text" && output != "json" {
+		return fmt.Errorf("invalid output %q, must be one of text or json", output)
+	}
+	return nil
+}
+
+// withResultOutput wraps the action to print the result document when --output json is
+// set. Everything else the command prints is written to stderr so stdout only holds the
+// document.
+func withResultOutput(action cli.ActionFunc) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		if c.String("output") != "json" {
+			return action(c)
+		}
+		stdout := os.Stdout
+		os.Stdout = os.Stderr
+		defer func() { os.Stdout = stdout }()
+
+		result := newCommandResult(c.Command.Name, stdout)
+		c.Context = context.WithValue(c.Context, commandResultKey{}, result)
+		err := action(c)
+		if emitErr := result.emit(err); emitErr != nil && err == nil {
+			return emitErr
+		}
+		return err
+	}
+}
+
+// recordNodeResult records the name of the node and, on controllers, the path to the
+// kubeconfig in the result document.
+func recordNodeResult(c *cli.Context, controller bool) error {
+	result := resultFromContext(c.Context)
+	if result == nil {
+		return nil
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("unable to get hostname: %w", err)
+	}
+	result.NodeName = hostname
+	if controller {
+		result.KubeconfigPath = defaults.PathToKubeConfig()
+	}
+	return nil
+}
+
+// recordInstallResult records the details of the installation in the result document.
+func recordInstallResult(c *cli.Context, applier *addons.Applier) error {
+	result := resultFromContext(c.Context)
+	if result == nil {
+		return nil
+	}
+	if err := recordNodeResult(c, true); err != nil {
+		return err
+	}
+	switch applier.GetAdminConsoleAuthMode() {
+	case ecv1beta1.AdminConsoleAuthModeDisabled:
+		// the Admin Console UI is not served, there is nothing to reach.
+	case ecv1beta1.AdminConsoleAuthModeIdentityProvider:
+		result.AdminConsole = &adminConsoleResult{URL: applier.AdminConsoleURL(c.String("network-interface"))}
+	default:
+		result.AdminConsole = &adminConsoleResult{
+			URL:            applier.AdminConsoleURL(c.String("network-interface")),
+			PasswordSecret: fmt.Sprintf("%s/kotsadm-password", defaults.KotsadmNamespace),
+		}
+	}
+	return nil
+}
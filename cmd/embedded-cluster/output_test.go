@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+// runWithResultOutput runs the action wrapped by withResultOutput and returns what was
+// written to stdout and to stderr.
+func runWithResultOutput(t *testing.T, output string, action cli.ActionFunc) (string, string, error) {
+	dir := t.TempDir()
+	stdout, err := os.Create(filepath.Join(dir, "stdout"))
+	require.NoError(t, err)
+	stderr, err := os.Create(filepath.Join(dir, "stderr"))
+	require.NoError(t, err)
+	origStdout, origStderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = stdout, stderr
+	defer func() { os.Stdout, os.Stderr = origStdout, origStderr }()
+
+	flagSet := flag.NewFlagSet("test", 0)
+	require.NoError(t, getOutputFlag().Apply(flagSet))
+	require.NoError(t, flagSet.Set("output", output))
+	c := cli.NewContext(cli.NewApp(), flagSet, nil)
+	c.Command = &cli.Command{Name: "join"}
+	runErr := withResultOutput(action)(c)
+
+	outData, err := os.ReadFile(stdout.Name())
+	require.NoError(t, err)
+	errData, err := os.ReadFile(stderr.Name())
+	require.NoError(t, err)
+	return string(outData), string(errData), runErr
+}
+
+func TestWithResultOutput(t *testing.T) {
+	stdout, stderr, err := runWithResultOutput(t, "json", func(c *cli.Context) error {
+		fmt.Println("progress message")
+		resultFromContext(c.Context).startPhase("k0s")
+		return recordNodeResult(c, true)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "progress message\n", stderr)
+
+	var result commandResult
+	require.NoError(t, json.Unmarshal([]byte(stdout), &result))
+	assert.Equal(t, "join", result.Command)
+	assert.True(t, result.Success)
+	assert.Empty(t, result.Error)
+	assert.NotEmpty(t, result.NodeName)
+	assert.NotEmpty(t, result.KubeconfigPath)
+	assert.Contains(t, result.DurationsSeconds, "setup")
+	assert.Contains(t, result.DurationsSeconds, "k0s")
+	assert.Contains(t, result.DurationsSeconds, "total")
+	assert.False(t, result.FinishedAt.Before(result.StartedAt))
+}
+
+func TestWithResultOutputFailure(t *testing.T) {
+	stdout, _, err := runWithResultOutput(t, "json", func(c *cli.Context) error {
+		return ErrNothingElseToAdd
+	})
+	assert.ErrorIs(t, err, ErrNothingElseToAdd)
+
+	var result commandResult
+	require.NoError(t, json.Unmarshal([]byte(stdout), &result))
+	assert.False(t, result.Success)
+	assert.Equal(t, "join failed, see the output above", result.Error)
+	assert.Empty(t, result.ErrorKind)
+	assert.Equal(t, 1, result.ExitCode)
+}
+
+func TestWithResultOutputClassifiedFailure(t *testing.T) {
+	stdout, _, err := runWithResultOutput(t, "json", func(c *cli.Context) error {
+		return errPreflightsReported
+	})
+	assert.ErrorIs(t, err, ErrNothingElseToAdd)
+
+	var result commandResult
+	require.NoError(t, json.Unmarshal([]byte(stdout), &result))
+	assert.False(t, result.Success)
+	assert.Equal(t, "Preflight", result.ErrorKind)
+	assert.Equal(t, 3, result.ExitCode)
+}
+
+func TestWithResultOutputEmittedOnce(t *testing.T) {
+	stdout, _, err := runWithResultOutput(t, "json", func(c *cli.Context) error {
+		require.NoError(t, resultFromContext(c.Context).emit(nil))
+		return fmt.Errorf("reboot failed")
+	})
+	assert.EqualError(t, err, "reboot failed")
+
+	var result commandResult
+	require.NoError(t, json.Unmarshal([]byte(stdout), &result))
+	assert.True(t, result.Success)
+}
+
+func TestWithResultOutputText(t *testing.T) {
+	stdout, _, err := runWithResultOutput(t, "text", func(c *cli.Context) error {
+		assert.Nil(t, resultFromContext(c.Context))
+		// recording is a no-op without a result.
+		resultFromContext(c.Context).startPhase("k0s")
+		fmt.Println("progress message")
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "progress message\n", stdout)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/metrics"
+)
+
+// The phases of an installation, in the order they run.
+const (
+	installPhaseMaterialize = "materialize"
+	installPhasePreflights  = "preflights"
+	installPhaseHostConfig  = "host-config"
+	installPhaseK0s         = "k0s"
+	installPhaseAddons      = "addons"
+)
+
+var installPhases = []string{
+	installPhaseMaterialize,
+	installPhasePreflights,
+	installPhaseHostConfig,
+	installPhaseK0s,
+	installPhaseAddons,
+}
+
+func withInstallPhaseFlags(flags []cli.Flag) []cli.Flag {
+	names := strings.Join(installPhases, ", ")
+	return append(flags,
+		&cli.StringSliceFlag{
+			Name:  "only",
+			Usage: fmt.Sprintf("Only run these installation phases, one or more of %s. Requires --allow-unsupported-phases.", names),
+		},
+		&cli.StringSliceFlag{
+			Name:  "skip",
+			Usage: fmt.Sprintf("Skip these installation phases, one or more of %s. Requires --allow-unsupported-phases.", names),
+		},
+		&cli.BoolFlag{
+			Name:  "allow-unsupported-phases",
+			Usage: "Acknowledge that installations with skipped phases are not supported. Only meant to recover from a failed installation or for debugging.",
+		},
+	)
+}
+
+// installPhaseSelection tells which phases of the installation run.
+type installPhaseSelection map[string]bool
+
+// getInstallPhases returns the installation phases selected with --only or --skip, all of
+// them if none of the flags is set.
+func getInstallPhases(c *cli.Context) (installPhaseSelection, error) {
+	only, skip := c.StringSlice("only"), c.StringSlice("skip")
+	selection := installPhaseSelection{}
+	for _, phase := range installPhases {
+		selection[phase] = len(only) == 0
+	}
+	if len(only) == 0 && len(skip) == 0 {
+		return selection, nil
+	}
+	if len(only) > 0 && len(skip) > 0 {
+		return nil, fmt.Errorf("--only and --skip cannot be used together")
+	}
+	if !c.Bool("allow-unsupported-phases") {
+		return nil, fmt.Errorf("installations with skipped phases are not supported, use --allow-unsupported-phases to continue anyway")
+	}
+	for _, phase := range append(only, skip...) {
+		if !slices.Contains(installPhases, phase) {
+			return nil, fmt.Errorf("unknown installation phase %q, must be one of %s", phase, strings.Join(installPhases, ", "))
+		}
+		selection[phase] = len(only) > 0
+	}
+	return selection, nil
+}
+
+// runs returns true if the phase runs.
+func (s installPhaseSelection) runs(phase string) bool {
+	return s[phase]
+}
+
+// verifiesSignatures returns true if the image signatures are verified. They are verified
+// whenever the k0s or the addons phase deploys images, skipping the preflights does not
+// skip the verification.
+func (s installPhaseSelection) verifiesSignatures() bool {
+	return s.runs(installPhaseK0s) || s.runs(installPhaseAddons)
+}
+
+// skipped returns the phases that do not run, in the order they would run.
+func (s installPhaseSelection) skipped() []string {
+	var skipped []string
+	for _, phase := range installPhases {
+		if !s[phase] {
+			skipped = append(skipped, phase)
+		}
+	}
+	return skipped
+}
+
+// reportInstallFinished reports the installation succeeded or, when phases were skipped
+// with --only or --skip, that it only partially ran.
+func reportInstallFinished(c *cli.Context, skipped []string) {
+	if len(skipped) > 0 {
+		metrics.ReportApplyPartial(c, skipped)
+		return
+	}
+	metrics.ReportApplyFinished(c, nil)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestGetInstallPhases(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		skipped  []string
+		verifies bool
+		wantErr  string
+	}{
+		{
+			name:     "all phases",
+			verifies: true,
+		},
+		{
+			name:     "only addons",
+			args:     []string{"--only", "addons", "--allow-unsupported-phases"},
+			skipped:  []string{"materialize", "preflights", "host-config", "k0s"},
+			verifies: true,
+		},
+		{
+			name:     "skip preflights and host config",
+			args:     []string{"--skip", "preflights", "--skip", "host-config", "--allow-unsupported-phases"},
+			skipped:  []string{"preflights", "host-config"},
+			verifies: true,
+		},
+		{
+			name:     "skip preflights",
+			args:     []string{"--skip", "preflights", "--allow-unsupported-phases"},
+			skipped:  []string{"preflights"},
+			verifies: true,
+		},
+		{
+			name:    "only materialize and host config",
+			args:    []string{"--only", "materialize", "--only", "host-config", "--allow-unsupported-phases"},
+			skipped: []string{"preflights", "k0s", "addons"},
+		},
+		{
+			name:    "not acknowledged",
+			args:    []string{"--skip", "preflights"},
+			wantErr: "installations with skipped phases are not supported, use --allow-unsupported-phases to continue anyway",
+		},
+		{
+			name:    "only and skip",
+			args:    []string{"--only", "k0s", "--skip", "addons", "--allow-unsupported-phases"},
+			wantErr: "--only and --skip cannot be used together",
+		},
+		{
+			name:    "unknown phase",
+			args:    []string{"--only", "kots", "--allow-unsupported-phases"},
+			wantErr: `unknown installation phase "kots", must be one of materialize, preflights, host-config, k0s, addons`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flagSet := flag.NewFlagSet("test", 0)
+			for _, flag := range withInstallPhaseFlags(nil) {
+				require.NoError(t, flag.Apply(flagSet))
+			}
+			require.NoError(t, flagSet.Parse(tt.args))
+			c := cli.NewContext(cli.NewApp(), flagSet, nil)
+
+			phases, err := getInstallPhases(c)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.skipped, phases.skipped())
+			assert.Equal(t, tt.verifies, phases.verifiesSignatures(), "image signatures verified")
+			for _, phase := range installPhases {
+				assert.Equal(t, !slices.Contains(tt.skipped, phase), phases.runs(phase), phase)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/plugins"
+)
+
+var pluginCommands = &cli.Command{
+	Name:  "plugin",
+	Usage: "Manage the plugins extending the commands of this binary",
+	Description: fmt.Sprintf(`Plugins are executables named %[1]s-<command> on PATH, or shipped in the release
+by the vendor. Running "%[1]s app reindex" runs the %[1]s-app-reindex plugin, or
+%[1]s-app with reindex as first argument. Plugins cannot replace the built-in commands.`, binName),
+	Subcommands: []*cli.Command{
+		pluginListCommand,
+	},
+}
+
+var pluginListCommand = &cli.Command{
+	Name:  "list",
+	Usage: "List the plugins found, in the order they are looked up in",
+	Flags: []cli.Flag{getOutputFlag()},
+	Before: func(c *cli.Context) error {
+		return validateOutputFlag(c)
+	},
+	Action: func(c *cli.Context) error {
+		found, err := newPluginFinder().List()
+		if err != nil {
+			return err
+		}
+		builtin := builtinCommand(c.App)
+		entries := make([]pluginListEntry, 0, len(found))
+		for _, plugin := range found {
+			builtin := builtin(strings.Split(plugin.Name, "-"))
+			entries = append(entries, pluginListEntry{Plugin: plugin, Builtin: builtin})
+		}
+		if c.String("output") == "json" {
+			return printJSON(entries)
+		}
+		if len(entries) == 0 {
+			logrus.Info("No plugins found.")
+			return nil
+		}
+		writer := table.NewWriter()
+		writer.AppendHeader(table.Row{"command", "source", "path", "status"})
+		for _, entry := range entries {
+			writer.AppendRow(table.Row{entry.Command(), entry.source(), entry.Path, entry.status()})
+		}
+		fmt.Printf("%s\n", writer.Render())
+		return nil
+	},
+}
+
+// pluginListEntry is a plugin as listed by the plugin list command.
+type pluginListEntry struct {
+	plugins.Plugin
+	// Builtin tells if a built-in command takes precedence over the plugin.
+	Builtin bool `json:"builtin"`
+}
+
+func (e pluginListEntry) source() string {
+	if e.Vendor {
+		return "release"
+	}
+	return "PATH"
+}
+
+func (e pluginListEntry) status() string {
+	switch {
+	case e.Builtin:
+		return "shadowed by a built-in command"
+	case e.Shadowed:
+		return "shadowed by a plugin above"
+	default:
+		return "active"
+	}
+}
+
+func newPluginFinder() *plugins.Finder {
+	return plugins.NewFinder(binName, defaults.EmbeddedClusterPluginsSubDir())
+}
+
+// runPlugin replaces this process with the plugin providing the command in args, the
+// arguments following it are passed through. Returns nil without doing anything when the
+// command is built-in or no plugin provides it.
+func runPlugin(app *cli.App, args []string) error {
+	var words []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			break
+		}
+		words = append(words, arg)
+	}
+	app.Setup()
+	path, used, ok := newPluginFinder().Resolve(words, builtinCommand(app))
+	if !ok {
+		return nil
+	}
+	argv := append([]string{path}, args[used:]...)
+	if err := syscall.Exec(path, argv, pluginEnv()); err != nil {
+		return fmt.Errorf("unable to run plugin %s: %w", path, err)
+	}
+	return nil
+}
+
+// pluginEnv returns the environment plugins run with: the environment of this process and
+// where to find this binary, its files and the kubeconfig of the cluster.
+func pluginEnv() []string {
+	env := os.Environ()
+	if exe, err := os.Executable(); err == nil {
+		env = append(env, fmt.Sprintf("%s=%s", plugins.BinaryEnv, exe))
+	}
+	env = append(env, fmt.Sprintf("%s=%s", plugins.HomeEnv, defaults.EmbeddedClusterHomeDirectory()))
+	if _, ok := os.LookupEnv("KUBECONFIG"); !ok {
+		if _, err := os.Stat(defaults.PathToKubeConfig()); err == nil {
+			env = append(env, fmt.Sprintf("KUBECONFIG=%s", defaults.PathToKubeConfig()))
+		}
+	}
+	return env
+}
+
+// builtinCommand returns a function telling if the words are handled by a command of the
+// app: they name a command, or a command without subcommands followed by its arguments.
+func builtinCommand(app *cli.App) func([]string) bool {
+	return func(words []string) bool {
+		commands := app.Commands
+		for _, word := range words {
+			var found *cli.Command
+			for _, cmd := range commands {
+				if cmd.HasName(word) {
+					found = cmd
+					break
+				}
+			}
+			if found == nil {
+				return false
+			}
+			if len(found.Subcommands) == 0 {
+				return true
+			}
+			commands = found.Subcommands
+		}
+		return true
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+)
+
+func TestBuiltinCommand(t *testing.T) {
+	app := &cli.App{Commands: []*cli.Command{
+		{Name: "install"},
+		{Name: "app", Subcommands: []*cli.Command{{Name: "export", Aliases: []string{"exp"}}}},
+	}}
+	builtin := builtinCommand(app)
+	assert.True(t, builtin([]string{"install"}))
+	assert.True(t, builtin([]string{"install", "extra"}), "arguments of a command")
+	assert.True(t, builtin([]string{"app"}))
+	assert.True(t, builtin([]string{"app", "exp", "archive.tar"}))
+	assert.False(t, builtin([]string{"app", "reindex"}))
+	assert.False(t, builtin([]string{"foo"}))
+}
@@ -1,23 +1,142 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
 
 	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/hostcollectors"
+	"github.com/replicatedhq/embedded-cluster/pkg/netcheck"
+	"github.com/replicatedhq/embedded-cluster/pkg/preflights"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
 	"github.com/replicatedhq/embedded-cluster/pkg/versions"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
+	"sigs.k8s.io/yaml"
 )
 
+var preflightsCommands = &cli.Command{
+	Name:  "preflights",
+	Usage: "Inspect the host preflights run during installation",
+	Subcommands: []*cli.Command{
+		preflightsExportSpecCommand,
+	},
+}
+
+// preflightsExportSpecCommand writes the host preflight spec that would be run during
+// installation, built-in and vendor provided, so it can be reviewed beforehand.
+var preflightsExportSpecCommand = &cli.Command{
+	Name:  "export-spec",
+	Usage: "Export the host preflight spec run during installation for review",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "license",
+			Aliases: []string{"l"},
+			Usage:   "Path to the license file.",
+		},
+		&cli.BoolFlag{
+			Name:  "airgap",
+			Usage: "Export the spec used for air gap installations.",
+			Value: false,
+		},
+		&cli.StringFlag{
+			Name:    "output",
+			Aliases: []string{"o"},
+			Usage:   "Path to the file where the spec is written. Defaults to stdout.",
+		},
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "Output format, one of yaml or json.",
+			Value: "yaml",
+		},
+		getAdminColsolePortFlag(),
+		getLocalArtifactMirrorPortFlag(),
+		getFIPSFlag(),
+		getExcludeHostCollectorsFlag(),
+		getDiskBenchmarkFlag(),
+	},
+	Before: func(c *cli.Context) error {
+		if format := c.String("format"); format != "yaml" && format != "json" {
+			return fmt.Errorf("invalid format %q, must be one of yaml or json", format)
+		}
+		return nil
+	},
+	Action: func(c *cli.Context) error {
+		license, err := getLicenseFromFilepath(c.String("license"))
+		if err != nil {
+			return err
+		}
+
+		applier, err := getAddonsApplier(c, "", nil)
+		if err != nil {
+			return err
+		}
+
+		var replicatedAPIURL, proxyRegistryURL string
+		if license != nil {
+			replicatedAPIURL = license.Spec.Endpoint
+			proxyRegistryURL = fmt.Sprintf("https://%s", defaults.ProxyRegistryAddress)
+		}
+
+		adminConsolePort, err := getAdminConsolePortFromFlag(c)
+		if err != nil {
+			return fmt.Errorf("unable to parse admin console port: %w", err)
+		}
+
+		localArtifactMirrorPort, err := getLocalArtifactMirrorPortFromFlag(c)
+		if err != nil {
+			return fmt.Errorf("unable to parse local artifact mirror port: %w", err)
+		}
+
+		k0sCfg, err := preflightK0sConfig(c)
+		if err != nil {
+			return err
+		}
+		hpf, err := getHostPreflightSpec(c, applier, replicatedAPIURL, proxyRegistryURL, c.Bool("airgap"), c.Bool("fips"), adminConsolePort, localArtifactMirrorPort, nil, k0sCfg)
+		if err != nil {
+			return err
+		}
+
+		// collectors excluded when this node was installed are excluded as well.
+		excluded, err := hostcollectors.ReadExcluded(defaults.PathToExcludedHostCollectors())
+		if err != nil {
+			return fmt.Errorf("unable to read excluded host collectors: %w", err)
+		}
+		excluded = append(excluded, c.StringSlice("exclude-host-collectors")...)
+		hostcollectors.FilterHostPreflightSpec(hpf, excluded)
+
+		data, err := preflights.ExportSpec(hpf)
+		if err != nil {
+			return fmt.Errorf("unable to serialize host preflight spec: %w", err)
+		}
+		if c.String("format") == "json" {
+			if data, err = yaml.YAMLToJSON(data); err != nil {
+				return fmt.Errorf("unable to convert host preflight spec to json: %w", err)
+			}
+			data = append(data, '\n')
+		}
+
+		if output := c.String("output"); output != "" {
+			if err := os.WriteFile(output, data, 0644); err != nil {
+				return fmt.Errorf("unable to write host preflight spec: %w", err)
+			}
+			logrus.Infof("Host preflight spec written to %s", output)
+			return nil
+		}
+		fmt.Print(string(data))
+		return nil
+	},
+}
+
 // installRunPreflightsCommand runs install host preflights.
 var installRunPreflightsCommand = &cli.Command{
 	Name:   "run-preflights",
 	Hidden: true,
 	Usage:  "Run install host preflights",
-	Flags: withProxyFlags(withSubnetCIDRFlags(
+	Flags: withProxyFlags(withSubnetCIDRFlags(withStorageFlags(
 		[]cli.Flag{
 			&cli.StringFlag{
 				Name:   "airgap-bundle",
@@ -37,11 +156,15 @@ var installRunPreflightsCommand = &cli.Command{
 			},
 			getAdminColsolePortFlag(),
 			getLocalArtifactMirrorPortFlag(),
+			getFIPSFlag(),
+			getExcludeHostCollectorsFlag(),
+			getDiskBenchmarkFlag(),
+			getIgnoreUnsupportedOSFlag(),
 		},
-	)),
+	))),
 	Before: func(c *cli.Context) error {
-		if os.Getuid() != 0 {
-			return fmt.Errorf("run-preflights command must be run as root")
+		if err := privileges.Check("run-preflights", hostPrivileges()...); err != nil {
+			return err
 		}
 		return nil
 	},
@@ -61,8 +184,19 @@ var installRunPreflightsCommand = &cli.Command{
 
 		isAirgap := c.String("airgap-bundle") != ""
 
+		if err := writeExcludedHostCollectors(c.StringSlice("exclude-host-collectors")); err != nil {
+			return err
+		}
+		storage, err := getStorageSpecFromFlags(c)
+		if err != nil {
+			return err
+		}
+		if err := writeStorageSpec(storage); err != nil {
+			return err
+		}
+
 		logrus.Debugf("materializing binaries")
-		if err := materializeFiles(c); err != nil {
+		if err := materializeFiles(c, true); err != nil {
 			return err
 		}
 
@@ -88,9 +222,13 @@ var installRunPreflightsCommand = &cli.Command{
 			return fmt.Errorf("unable to parse local artifact mirror port: %w", err)
 		}
 
-		if err := RunHostPreflights(c, applier, replicatedAPIURL, proxyRegistryURL, isAirgap, proxy, adminConsolePort, localArtifactMirrorPort); err != nil {
-			if err == ErrPreflightsHaveFail {
-				return ErrNothingElseToAdd
+		k0sCfg, err := preflightK0sConfig(c)
+		if err != nil {
+			return err
+		}
+		if _, err := RunHostPreflights(c, applier, replicatedAPIURL, proxyRegistryURL, isAirgap, c.Bool("fips"), proxy, adminConsolePort, localArtifactMirrorPort, nil, k0sCfg); err != nil {
+			if errors.Is(err, ErrPreflightsHaveFail) {
+				return errPreflightsReported
 			}
 			return err
 		}
@@ -123,23 +261,39 @@ var joinRunPreflightsCommand = &cli.Command{
 			Usage: "Disable interactive prompts.",
 			Value: false,
 		},
+		&cli.DurationFlag{
+			Name:  "max-network-latency",
+			Usage: "Largest round trip time to the controllers and the artifact mirror. 0 disables the check.",
+			Value: netcheck.DefaultMaxLatency,
+		},
+		&cli.Int64Flag{
+			Name:  "min-network-throughput",
+			Usage: "Lowest throughput from the artifact mirror, in Mbit/s. 0 disables the check.",
+			Value: netcheck.DefaultMinThroughputMbps,
+		},
+		getDiskBenchmarkFlag(),
+		getIgnoreUnsupportedOSFlag(),
 	},
 	Before: func(c *cli.Context) error {
-		if os.Getuid() != 0 {
-			return fmt.Errorf("run-preflights command must be run as root")
+		if err := privileges.Check("run-preflights", hostPrivileges()...); err != nil {
+			return err
 		}
 		return nil
 	},
 	Action: func(c *cli.Context) error {
-		if c.Args().Len() != 2 {
-			return fmt.Errorf("usage: %s join preflights <url> <token>", binName)
+		target, err := parseJoinArgs(c, fmt.Sprintf("%s join preflights <url> <token>", binName))
+		if err != nil {
+			return err
 		}
 
 		logrus.Debugf("fetching join token remotely")
-		jcmd, err := getJoinToken(c.Context, c.Args().Get(0), c.Args().Get(1))
+		jcmd, err := getJoinToken(c.Context, target.URL, target.Token)
 		if err != nil {
 			return fmt.Errorf("unable to get join token: %w", err)
 		}
+		if err := target.scope(jcmd); err != nil {
+			return err
+		}
 
 		// check to make sure the version returned by the join token is the same as the one we are running
 		if jcmd.EmbeddedClusterVersion != versions.Version {
@@ -157,8 +311,25 @@ var joinRunPreflightsCommand = &cli.Command{
 
 		isAirgap := c.String("airgap-bundle") != ""
 
+		logrus.Debugf("validating connectivity to the cluster")
+		if err := checkJoinConnectivity(c, jcmd); err != nil {
+			return err
+		}
+
+		logrus.Debugf("measuring the network to the cluster")
+		if err := checkJoinNetwork(c, target, jcmd); err != nil {
+			return err
+		}
+
+		if err := writeExcludedHostCollectors(jcmd.InstallationSpec.ExcludedHostCollectors); err != nil {
+			return err
+		}
+		if err := writeStorageSpec(jcmd.InstallationSpec.Storage); err != nil {
+			return err
+		}
+
 		logrus.Debugf("materializing binaries")
-		if err := materializeFiles(c); err != nil {
+		if err := materializeFiles(c, jcmd.InstallationSpec.AirgapRegistry == ""); err != nil {
 			return err
 		}
 
@@ -171,9 +342,9 @@ var joinRunPreflightsCommand = &cli.Command{
 		replicatedAPIURL := jcmd.InstallationSpec.MetricsBaseURL
 		proxyRegistryURL := fmt.Sprintf("https://%s", defaults.ProxyRegistryAddress)
 
-		urlSlices := strings.Split(c.Args().Get(0), ":")
+		urlSlices := strings.Split(target.URL, ":")
 		if len(urlSlices) != 2 {
-			return fmt.Errorf("unable to get port from url %s", c.Args().Get(0))
+			return fmt.Errorf("unable to get port from url %s", target.URL)
 		}
 		adminConsolePort, err := strconv.Atoi(urlSlices[1])
 		if err != nil {
@@ -185,9 +356,13 @@ var joinRunPreflightsCommand = &cli.Command{
 			localArtifactMirrorPort = jcmd.InstallationSpec.LocalArtifactMirror.Port
 		}
 
-		if err := RunHostPreflights(c, applier, replicatedAPIURL, proxyRegistryURL, isAirgap, jcmd.InstallationSpec.Proxy, adminConsolePort, localArtifactMirrorPort); err != nil {
-			if err == ErrPreflightsHaveFail {
-				return ErrNothingElseToAdd
+		k0sCfg, err := jcmd.PreflightK0sConfig()
+		if err != nil {
+			return err
+		}
+		if _, err := RunHostPreflights(c, applier, replicatedAPIURL, proxyRegistryURL, isAirgap, jcmd.InstallationSpec.FIPS, jcmd.InstallationSpec.Proxy, adminConsolePort, localArtifactMirrorPort, &jcmd.ClockSkew, k0sCfg); err != nil {
+			if errors.Is(err, ErrPreflightsHaveFail) {
+				return errPreflightsReported
 			}
 			return err
 		}
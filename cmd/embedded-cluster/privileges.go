@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
+)
+
+// hostAdminPrivileges are needed by the commands that set up or tear down the node: they
+// install files and units, load kernel modules, configure the network and mount volumes.
+func hostAdminPrivileges() []privileges.Requirement {
+	return []privileges.Requirement{
+		privileges.Root(),
+		privileges.Capabilities(
+			privileges.CapChown,
+			privileges.CapDACOverride,
+			privileges.CapNetAdmin,
+			privileges.CapSysModule,
+			privileges.CapSysAdmin,
+		),
+	}
+}
+
+// hostPrivileges are needed by the commands that read or change the files of the
+// installation on the node, owned by root.
+func hostPrivileges() []privileges.Requirement {
+	return []privileges.Requirement{
+		privileges.Root(),
+		privileges.Capabilities(privileges.CapDACOverride),
+	}
+}
+
+// clusterPrivileges are needed by the commands that only talk to the cluster. They run
+// without sudo for users that were given read access to the admin kubeconfig.
+func clusterPrivileges() []privileges.Requirement {
+	return []privileges.Requirement{
+		privileges.Readable(defaults.PathToKubeConfig()),
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/download"
+	"github.com/replicatedhq/embedded-cluster/pkg/metrics"
+	"github.com/replicatedhq/embedded-cluster/pkg/release"
+	"github.com/replicatedhq/embedded-cluster/pkg/spinner"
+)
+
+var pullCommand = &cli.Command{
+	Name:  "pull",
+	Usage: "Download the airgap bundle matching this binary",
+	Description: "Downloads the airgap bundle of the release embedded in the binary. The archive " +
+		"holding the bundle is downloaded in parallel chunks and verified once complete, run the " +
+		"command again to resume an interrupted download.",
+	Flags: withProxyFlags([]cli.Flag{
+		&cli.StringFlag{
+			Name:     "license",
+			Aliases:  []string{"l"},
+			Usage:    "Path to the license file",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "airgap-bundle",
+			Usage: "Path the airgap bundle is written to. Defaults to <binary name>.airgap in the current directory.",
+		},
+		&cli.IntFlag{
+			Name:  "chunks",
+			Usage: "Number of chunks downloaded in parallel",
+			Value: download.DefaultChunks,
+		},
+		&cli.StringFlag{
+			Name:  "checksum",
+			Usage: "Expected sha256 checksum of the downloaded archive holding the airgap bundle. If not provided, the checksum advertised by the server, if any, is verified.",
+		},
+		&cli.StringFlag{
+			Name:   "url",
+			Usage:  "Download the archive holding the airgap bundle from this url instead",
+			Hidden: true,
+		},
+	}),
+	Before: func(c *cli.Context) error {
+		if c.Int("chunks") < 1 {
+			return fmt.Errorf("--chunks must be at least 1")
+		}
+		if c.String("airgap-bundle") == "" {
+			if err := c.Set("airgap-bundle", defaults.BinaryName()+".airgap"); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Action: func(c *cli.Context) error {
+		rel, err := release.GetChannelRelease()
+		if err != nil {
+			return fmt.Errorf("unable to get release from binary: %w", err)
+		}
+		if rel == nil {
+			return fmt.Errorf("no release is embedded in the binary, there is no airgap bundle to download")
+		}
+		license, err := getLicenseFromFilepath(c.String("license"))
+		if err != nil {
+			return err
+		}
+		if !license.Spec.IsAirgapSupported {
+			return fmt.Errorf("license does not allow airgap installations")
+		}
+		setProxyEnv(getProxySpecFromFlags(c))
+
+		bundleURL := c.String("url")
+		if bundleURL == "" {
+			bundleURL = airgapBundleURL(metrics.BaseURL(license), rel)
+		}
+		dst := c.String("airgap-bundle")
+		// the archive is kept until the bundle is extracted so an interrupted download
+		// resumes.
+		archive := dst + ".tgz"
+
+		loading := spinner.Start()
+		loading.Infof("Downloading airgap bundle")
+		var percent int64 = -1
+		result, err := download.File(c.Context, bundleURL, archive, download.Options{
+			Header: http.Header{"Authorization": []string{license.Spec.LicenseID}},
+			Chunks: c.Int("chunks"),
+			SHA256: c.String("checksum"),
+			Progress: func(done, total int64) {
+				if total <= 0 {
+					return
+				}
+				if p := done * 100 / total; p != percent {
+					percent = p
+					loading.Infof("Downloading airgap bundle %d%%", p)
+				}
+			},
+		})
+		if err != nil {
+			loading.CloseWithError()
+			return fmt.Errorf("unable to download airgap bundle: %w", err)
+		}
+		loading.Infof("Extracting airgap bundle")
+		if err := extractAirgapBundle(archive, dst); err != nil {
+			loading.CloseWithError()
+			return err
+		}
+		if err := os.Remove(archive); err != nil {
+			loading.CloseWithError()
+			return fmt.Errorf("unable to remove airgap bundle archive: %w", err)
+		}
+		loading.Infof("Verifying airgap bundle")
+		if err := checkAirgapMatches(c); err != nil {
+			loading.CloseWithError()
+			return err
+		}
+		checksum := "sha256 " + result.SHA256
+		if result.Verified {
+			checksum += ", verified"
+		}
+		loading.Infof("Airgap bundle downloaded to %s (%s)", dst, checksum)
+		loading.Close()
+		return nil
+	},
+}
+
+// airgapBundleURL returns the url the airgap bundle of the release is downloaded from, a
+// tgz archive holding the bundle.
+func airgapBundleURL(endpoint string, rel *release.ChannelRelease) string {
+	return fmt.Sprintf(
+		"%s/embedded/%s/%s/%s?airgap=true",
+		strings.TrimSuffix(endpoint, "/"),
+		url.PathEscape(rel.AppSlug),
+		url.PathEscape(rel.ChannelSlug),
+		url.PathEscape(rel.VersionLabel),
+	)
+}
+
+// extractAirgapBundle writes the .airgap file found in the tgz archive to dst. The bundle
+// is written to a temporary file renamed once complete.
+func extractAirgapBundle(archive, dst string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return fmt.Errorf("unable to open airgap bundle archive: %w", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("unable to decompress airgap bundle archive: %w", err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("no airgap bundle found in the downloaded archive")
+		} else if err != nil {
+			return fmt.Errorf("unable to read airgap bundle archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg || !strings.HasSuffix(hdr.Name, ".airgap") {
+			continue
+		}
+		tmp := dst + ".tmp"
+		out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return fmt.Errorf("unable to create airgap bundle: %w", err)
+		}
+		defer os.Remove(tmp)
+		if _, err := io.Copy(out, tr); err != nil {
+			out.Close()
+			return fmt.Errorf("unable to extract airgap bundle: %w", err)
+		}
+		if err := out.Close(); err != nil {
+			return fmt.Errorf("unable to extract airgap bundle: %w", err)
+		}
+		if err := os.Rename(tmp, dst); err != nil {
+			return fmt.Errorf("unable to rename airgap bundle: %w", err)
+		}
+		return nil
+	}
+}
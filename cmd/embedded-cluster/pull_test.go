@@ -0,0 +1,54 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/release"
+)
+
+func TestAirgapBundleURL(t *testing.T) {
+	rel := &release.ChannelRelease{AppSlug: "app", ChannelSlug: "stable", VersionLabel: "1.0.0+build 1"}
+	assert.Equal(t,
+		"https://replicated.app/embedded/app/stable/1.0.0+build%201?airgap=true",
+		airgapBundleURL("https://replicated.app/", rel),
+	)
+}
+
+func TestExtractAirgapBundle(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "app.airgap.tgz")
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range map[string]string{"README": "readme", "app-stable.airgap": "bundle"} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	require.NoError(t, os.WriteFile(archive, buf.Bytes(), 0644))
+
+	dst := filepath.Join(dir, "app.airgap")
+	require.NoError(t, extractAirgapBundle(archive, dst))
+	data, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, "bundle", string(data))
+	_, err = os.Stat(dst + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+
+	empty := &bytes.Buffer{}
+	gz = gzip.NewWriter(empty)
+	require.NoError(t, tar.NewWriter(gz).Close())
+	require.NoError(t, gz.Close())
+	require.NoError(t, os.WriteFile(archive, empty.Bytes(), 0644))
+	assert.EqualError(t, extractAirgapBundle(archive, dst), "no airgap bundle found in the downloaded archive")
+}
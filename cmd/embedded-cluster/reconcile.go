@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	k0sconfig "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/addons"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	ecerrors "github.com/replicatedhq/embedded-cluster/pkg/errors"
+	"github.com/replicatedhq/embedded-cluster/pkg/k0sready"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/metrics"
+	"github.com/replicatedhq/embedded-cluster/pkg/spinner"
+)
+
+// installState is what a previous installation left on the host. It tells which phases
+// a reconciling installation goes through again.
+type installState struct {
+	// K0sConfigured is set once the k0s configuration file has been written.
+	K0sConfigured bool
+	// K0sServiceInstalled is set once the k0s controller service has been installed.
+	K0sServiceInstalled bool
+	// K0sReady is set when the k0s controller is running and ready.
+	K0sReady bool
+}
+
+// detectInstallState looks for what a previous installation left on the host.
+func detectInstallState(ctx context.Context) (installState, error) {
+	var state installState
+	var err error
+	if state.K0sConfigured, err = isAlreadyInstalled(); err != nil {
+		return state, err
+	}
+	if _, err := os.Stat(k0sServiceUnitPath()); err == nil {
+		state.K0sServiceInstalled = true
+	} else if !os.IsNotExist(err) {
+		return state, fmt.Errorf("unable to check if the k0s service is installed: %w", err)
+	}
+	if state.K0sServiceInstalled {
+		if err := k0sready.Ready(ctx, true); err != nil {
+			logrus.Debugf("k0s is not ready: %v", err)
+		} else {
+			state.K0sReady = true
+		}
+	}
+	return state, nil
+}
+
+// k0sServiceUnitPath returns the path of the systemd unit of the k0s controller service.
+func k0sServiceUnitPath() string {
+	return fmt.Sprintf("/etc/systemd/system/%s.service", k0sready.Unit(true))
+}
+
+// reconcile returns the phases that run to converge the host from the state. The host
+// preflights are skipped once k0s has been configured, as the ports and files they check
+// are then in use by the installation itself. The k0s and addons phases are kept so the
+// image signatures are still verified before the add-ons are applied again.
+func (s installState) reconcile(phases installPhaseSelection) installPhaseSelection {
+	selection := installPhaseSelection{}
+	for phase, runs := range phases {
+		selection[phase] = runs
+	}
+	if s.K0sConfigured {
+		selection[installPhasePreflights] = false
+	}
+	return selection
+}
+
+func (s installState) String() string {
+	switch {
+	case s.K0sReady:
+		return "k0s is running"
+	case s.K0sServiceInstalled:
+		return "k0s is installed but not ready"
+	default:
+		return "k0s is configured but not installed"
+	}
+}
+
+// reconcileK0s converges the k0s installation of a previous run: the service is installed
+// if it is missing and started if it is not ready. The configuration of the previous run
+// is kept.
+func reconcileK0s(c *cli.Context, applier *addons.Applier, proxy *ecv1beta1.ProxySpec, state installState) (*k0sconfig.ClusterConfig, error) {
+	loading := spinner.Start()
+	defer loading.Close()
+	loading.Infof("Reconciling %s node", defaults.BinaryName())
+	cfg, err := getK0sConfigFromDisk()
+	if err != nil {
+		err = ecerrors.WithKind(ecerrors.K0s, err)
+		metrics.ReportApplyFinished(c, err)
+		return nil, err
+	}
+	logrus.Debugf("creating systemd unit files")
+	if err := createSystemdUnitFiles(false, k0sNodeIP(cfg), proxy, applier.GetLocalArtifactMirror()); err != nil {
+		err := ecerrors.Errorf(ecerrors.HostConfig, "unable to create systemd unit files: %w", err)
+		metrics.ReportApplyFinished(c, err)
+		return nil, err
+	}
+	if !state.K0sServiceInstalled {
+		logrus.Debugf("installing k0s")
+		if err := installK0s(c); err != nil {
+			err := ecerrors.Errorf(ecerrors.K0s, "unable update cluster: %w", err)
+			metrics.ReportApplyFinished(c, err)
+			return nil, err
+		}
+	} else if !state.K0sReady {
+		logrus.Debugf("starting k0s")
+		if err := startK0sService(); err != nil {
+			err := ecerrors.WithKind(ecerrors.K0s, err)
+			metrics.ReportApplyFinished(c, err)
+			return nil, err
+		}
+	}
+	loading.Infof("Waiting for %s node to be ready", defaults.BinaryName())
+	if err := waitForK0s(c, true); err != nil {
+		err := ecerrors.Errorf(ecerrors.K0s, "unable to wait for node: %w", err)
+		metrics.ReportApplyFinished(c, err)
+		return nil, err
+	}
+	loading.Infof("Node reconciliation finished!")
+	return cfg, nil
+}
+
+// installationCreated returns true if a previous run created the installation object, the
+// add-on charts were then applied by that run. The add-ons that run after the operator may
+// still not be installed.
+func installationCreated(ctx context.Context) (bool, error) {
+	os.Setenv("KUBECONFIG", defaults.PathToKubeConfig())
+	kcli, err := kubeutils.KubeClient()
+	if err != nil {
+		return false, fmt.Errorf("unable to create kube client: %w", err)
+	}
+	_, err = kubeutils.GetLatestInstallation(ctx, kcli)
+	if errors.Is(err, kubeutils.ErrNoInstallations{}) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("unable to get latest installation: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstallStateReconcile(t *testing.T) {
+	all := installPhaseSelection{}
+	for _, phase := range installPhases {
+		all[phase] = true
+	}
+
+	phases := installState{K0sConfigured: true, K0sServiceInstalled: true}.reconcile(all)
+	assert.Equal(t, []string{installPhasePreflights}, phases.skipped())
+	assert.Empty(t, all.skipped(), "the selection provided is not modified")
+	assert.True(t, phases.verifiesSignatures(), "image signatures are verified when reconciling")
+
+	// phases skipped by the user stay skipped.
+	all[installPhaseHostConfig] = false
+	phases = installState{K0sConfigured: true}.reconcile(all)
+	assert.Equal(t, []string{installPhasePreflights, installPhaseHostConfig}, phases.skipped())
+}
+
+func TestInstallStateString(t *testing.T) {
+	assert.Equal(t, "k0s is running", installState{K0sConfigured: true, K0sServiceInstalled: true, K0sReady: true}.String())
+	assert.Equal(t, "k0s is installed but not ready", installState{K0sConfigured: true, K0sServiceInstalled: true}.String())
+	assert.Equal(t, "k0s is configured but not installed", installState{K0sConfigured: true}.String())
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/remote"
+)
+
+// remoteInstallDir is where the binary and the files referenced by flags are copied to
+// on the target, relative to the home directory of the ssh user.
+var remoteInstallDir = fmt.Sprintf("%s-install", binName)
+
+// remotePasswordFile is the file the Admin Console password is copied to on the target,
+// in the remote install directory. It is removed once the installation finishes.
+const remotePasswordFile = ".admin-console-password"
+
+// remoteFileFlags are the install flags holding paths to local files. The files are
+// copied to the target and the flags rewritten to point to the copies.
+var remoteFileFlags = map[string]bool{
+	"airgap-bundle":  true,
+	"license":        true,
+	"overrides":      true,
+	"install-config": true,
+	"private-ca":     true,
+	"tls-cert":       true,
+	"tls-key":        true,
+}
+
+// withRemoteInstall wraps the install action to run the installation on the machine
+// provided with --target instead of the local one.
+func withRemoteInstall(action cli.ActionFunc) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		if c.String("target") == "" {
+			return action(c)
+		}
+		return remoteInstall(c)
+	}
+}
+
+// remoteInstall copies the binary and the files referenced by flags to the target and
+// runs the installation there with the same flags, streaming its output back.
+func remoteInstall(c *cli.Context) error {
+	target, err := remote.ParseTarget(c.String("target"))
+	if err != nil {
+		return err
+	}
+	jumps, err := remote.ParseJumpHosts(c.StringSlice("ssh-jump"))
+	if err != nil {
+		return err
+	}
+	client := &remote.Client{
+		Target:    *target,
+		Identity:  c.String("ssh-identity"),
+		JumpHosts: jumps,
+		// a terminal merges the remote stderr into stdout, it is not allocated when a
+		// result document is expected on stdout.
+		TTY:    term.IsTerminal(int(os.Stdin.Fd())) && c.String("output") != "json",
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+	if c.String("output") == "json" {
+		// only the result document printed by the target is written to stdout.
+		stdout := os.Stdout
+		os.Stdout = os.Stderr
+		defer func() { os.Stdout = stdout }()
+	}
+
+	// secrets are written to files copied to the target, they would be visible to any
+	// user of the target in the remote command line.
+	tmpdir, err := os.MkdirTemp("", "embedded-cluster-remote-")
+	if err != nil {
+		return fmt.Errorf("unable to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpdir)
+	args, files, err := remoteInstallArgs(c, tmpdir)
+	if err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("unable to find the %s binary: %w", binName, err)
+	}
+	files[exe] = binName
+
+	logrus.Infof("Copying %s to %s", binName, target)
+	if err := client.Run(c.Context, remote.Join("mkdir", "-p", remoteInstallDir)); err != nil {
+		return fmt.Errorf("unable to create %s on %s: %w", remoteInstallDir, target, err)
+	}
+	for local, name := range files {
+		if err := client.Copy(c.Context, local, path.Join(remoteInstallDir, name)); err != nil {
+			return err
+		}
+	}
+
+	logrus.Infof("Running the installation on %s", target)
+	command := append([]string{"./" + binName, "install"}, args...)
+	if target.User != "root" {
+		command = append([]string{"sudo"}, command...)
+	}
+	script := fmt.Sprintf(
+		"cd %s && { %s; status=$?; rm -f %s; exit $status; }",
+		remote.Quote(remoteInstallDir), remote.Join(command...), remotePasswordFile,
+	)
+	if err := client.Run(c.Context, script); err != nil {
+		return fmt.Errorf("installation on %s failed: %w", target, err)
+	}
+	return nil
+}
+
+// remoteInstallArgs returns the install flags to run the installation with on the
+// target and the local files to copy along, indexed by their local path. Flags holding
+// file paths are rewritten to the name of the copy in the remote install directory. The
+// Admin Console password is written to a file in tmpdir and passed as a file as well.
+func remoteInstallArgs(c *cli.Context, tmpdir string) ([]string, map[string]string, error) {
+	files := map[string]string{}
+	names := map[string]bool{binName: true}
+	copyFile := func(local string) (string, error) {
+		if _, err := os.Stat(local); err != nil {
+			return "", fmt.Errorf("unable to read %s: %w", local, err)
+		}
+		if name, ok := files[local]; ok {
+			return name, nil
+		}
+		name := filepath.Base(local)
+		for i := 1; names[name]; i++ {
+			name = fmt.Sprintf("%d-%s", i, filepath.Base(local))
+		}
+		names[name] = true
+		files[local] = name
+		return name, nil
+	}
+
+	var args []string
+	for _, flag := range c.Command.Flags {
+		name := flag.Names()[0]
+		if name == "target" || name == "ssh-identity" || name == "ssh-jump" || !c.IsSet(name) {
+			continue
+		}
+		if name == "admin-console-password" || name == "admin-console-password-file" {
+			continue
+		}
+		var values []string
+		switch flag.(type) {
+		case *cli.StringSliceFlag:
+			values = c.StringSlice(name)
+		case *cli.BoolFlag:
+			values = []string{strconv.FormatBool(c.Bool(name))}
+		case *cli.StringFlag:
+			values = []string{c.String(name)}
+		default:
+			values = []string{fmt.Sprint(c.Value(name))}
+		}
+		for _, value := range values {
+			if remoteFileFlags[name] && value != "" {
+				copied, err := copyFile(value)
+				if err != nil {
+					return nil, nil, fmt.Errorf("unable to copy --%s: %w", name, err)
+				}
+				value = copied
+			}
+			args = append(args, fmt.Sprintf("--%s=%s", name, value))
+		}
+	}
+
+	password, err := adminConsolePassword(c)
+	if err != nil {
+		return nil, nil, err
+	} else if password != "" {
+		local := filepath.Join(tmpdir, remotePasswordFile)
+		if err := os.WriteFile(local, []byte(password), 0600); err != nil {
+			return nil, nil, fmt.Errorf("unable to write the Admin Console password: %w", err)
+		}
+		files[local] = remotePasswordFile
+		args = append(args, fmt.Sprintf("--admin-console-password-file=%s", remotePasswordFile))
+	}
+	return args, files, nil
+}
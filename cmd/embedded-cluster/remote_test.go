@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteInstallArgs(t *testing.T) {
+	dir := t.TempDir()
+	license := filepath.Join(dir, "license.yaml")
+	ca1 := filepath.Join(dir, "a", "ca.crt")
+	ca2 := filepath.Join(dir, "b", "ca.crt")
+	for _, file := range []string{license, ca1, ca2} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		require.NoError(t, os.WriteFile(file, []byte("test"), 0644))
+	}
+
+	c := newInstallTestContext(t, map[string]string{
+		"target":                 "ssh://admin@edge-01",
+		"ssh-identity":           "/keys/id",
+		"ssh-jump":               "ssh://bastion",
+		"license":                license,
+		"private-ca":             ca1,
+		"no-prompt":              "true",
+		"admin-console-port":     "31000",
+		"node-ready-timeout":     "10m",
+		"admin-console-password": "it's a secret",
+	})
+	require.NoError(t, c.Set("private-ca", ca2))
+	c.Command = installCommand
+
+	tmpdir := t.TempDir()
+	args, files, err := remoteInstallArgs(c, tmpdir)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"--license=license.yaml",
+		"--private-ca=ca.crt",
+		"--private-ca=1-ca.crt",
+		"--no-prompt=true",
+		"--admin-console-port=31000",
+		"--node-ready-timeout=10m0s",
+		"--admin-console-password-file=.admin-console-password",
+	}, args)
+	password := filepath.Join(tmpdir, ".admin-console-password")
+	assert.Equal(t, map[string]string{
+		license:  "license.yaml",
+		ca1:      "ca.crt",
+		ca2:      "1-ca.crt",
+		password: ".admin-console-password",
+	}, files)
+	data, err := os.ReadFile(password)
+	require.NoError(t, err)
+	assert.Equal(t, "it's a secret", string(data))
+}
+
+func TestRemoteInstallArgsMissingFile(t *testing.T) {
+	c := newInstallTestContext(t, map[string]string{
+		"target":  "ssh://edge-01",
+		"license": filepath.Join(t.TempDir(), "missing.yaml"),
+	})
+	c.Command = installCommand
+
+	_, _, err := remoteInstallArgs(c, t.TempDir())
+	assert.ErrorContains(t, err, "unable to copy --license")
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	k0sconfig "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	"github.com/urfave/cli/v2"
+	k8syaml "sigs.k8s.io/yaml"
+)
+
+var renderCommand = &cli.Command{
+	Name:  "render",
+	Usage: "Print the k0s configuration and the helm values an installation would use, without installing",
+	Flags: withSubnetCIDRFlags(withStorageFlags([]cli.Flag{
+		&cli.StringFlag{
+			Name:    "license",
+			Aliases: []string{"l"},
+			Usage:   "Path to the license file",
+		},
+		&cli.StringFlag{
+			Name:  "overrides",
+			Usage: "File with an EmbeddedClusterConfig object to override the default configuration",
+		},
+		&cli.StringFlag{
+			Name:  "airgap-bundle",
+			Usage: "Path to the air gap bundle, renders the configuration of an air gap installation",
+		},
+		&cli.StringFlag{
+			Name:  "network-interface",
+			Usage: "The network interface the configuration is rendered for",
+		},
+		getAdminColsolePortFlag(),
+		getLocalArtifactMirrorPortFlag(),
+		getFIPSFlag(),
+		getHardeningFlag(),
+		&cli.StringFlag{
+			Name:  "output-dir",
+			Usage: "Directory k0s.yaml and the values of each chart, under values/, are written to instead of stdout",
+		},
+	})),
+	Action: func(c *cli.Context) error {
+		applier, err := getAddonsApplier(c, "", nil)
+		if err != nil {
+			return err
+		}
+		cfg, err := renderInstallK0sConfig(c, applier)
+		if err != nil {
+			return err
+		}
+		if dir := c.String("output-dir"); dir != "" {
+			return writeRenderedConfig(dir, cfg)
+		}
+		return printRenderedConfig(os.Stdout, cfg)
+	},
+}
+
+// splitChartValues returns a copy of the configuration without the values of the helm
+// charts, and the values of each chart, so the values are read as yaml documents of
+// their own instead of strings embedded in the configuration.
+func splitChartValues(cfg *k0sconfig.ClusterConfig) (*k0sconfig.ClusterConfig, []k0sconfig.Chart) {
+	cfg = cfg.DeepCopy()
+	if cfg.Spec.Extensions == nil || cfg.Spec.Extensions.Helm == nil {
+		return cfg, nil
+	}
+	charts := make([]k0sconfig.Chart, len(cfg.Spec.Extensions.Helm.Charts))
+	copy(charts, cfg.Spec.Extensions.Helm.Charts)
+	for i := range cfg.Spec.Extensions.Helm.Charts {
+		cfg.Spec.Extensions.Helm.Charts[i].Values = ""
+	}
+	return cfg, charts
+}
+
+// printRenderedConfig prints the configuration followed by the values of each chart, as
+// a multi document yaml.
+func printRenderedConfig(w io.Writer, cfg *k0sconfig.ClusterConfig) error {
+	cfg, charts := splitChartValues(cfg)
+	data, err := k8syaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("unable to marshal config: %w", err)
+	}
+	fmt.Fprintf(w, "# k0s configuration, the values of the charts follow\n%s", data)
+	for _, chart := range charts {
+		fmt.Fprintf(w, "---\n# values of chart %s (%s %s) in namespace %s\n", chart.Name, chart.ChartName, chart.Version, chart.TargetNS)
+		values := strings.TrimSpace(chart.Values)
+		if values == "" {
+			values = "{}"
+		}
+		fmt.Fprintf(w, "%s\n", values)
+	}
+	return nil
+}
+
+// writeRenderedConfig writes the configuration to k0s.yaml and the values of each chart
+// to values/<chart name>.yaml in the directory.
+func writeRenderedConfig(dir string, cfg *k0sconfig.ClusterConfig) error {
+	cfg, charts := splitChartValues(cfg)
+	if err := os.MkdirAll(filepath.Join(dir, "values"), 0755); err != nil {
+		return fmt.Errorf("unable to create directory: %w", err)
+	}
+	data, err := k8syaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("unable to marshal config: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "k0s.yaml"), data, 0644); err != nil {
+		return fmt.Errorf("unable to write k0s configuration: %w", err)
+	}
+	for _, chart := range charts {
+		fpath := filepath.Join(dir, "values", fmt.Sprintf("%s.yaml", chart.Name))
+		if err := os.WriteFile(fpath, []byte(chart.Values), 0644); err != nil {
+			return fmt.Errorf("unable to write values of chart %s: %w", chart.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	k0sconfig "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func renderTestConfig() *k0sconfig.ClusterConfig {
+	cfg := k0sconfig.DefaultClusterConfig()
+	cfg.Spec.Extensions.Helm = &k0sconfig.HelmExtensions{
+		Charts: k0sconfig.ChartsSettings{
+			{Name: "openebs", ChartName: "openebs/openebs", Version: "4.1.0", TargetNS: "openebs", Values: "engines:\n  local:\n    lvm:\n      enabled: false\n"},
+			{Name: "app", ChartName: "oci://registry/app", Version: "1.0.0", TargetNS: "app"},
+		},
+	}
+	return cfg
+}
+
+func TestPrintRenderedConfig(t *testing.T) {
+	cfg := renderTestConfig()
+	buf := &bytes.Buffer{}
+	require.NoError(t, printRenderedConfig(buf, cfg))
+
+	out := buf.String()
+	assert.Contains(t, out, "# k0s configuration, the values of the charts follow\n")
+	assert.Contains(t, out, "---\n# values of chart openebs (openebs/openebs 4.1.0) in namespace openebs\nengines:\n  local:\n    lvm:\n      enabled: false\n")
+	assert.Contains(t, out, "---\n# values of chart app (oci://registry/app 1.0.0) in namespace app\n{}\n")
+	assert.NotContains(t, out, "values: |", "the values are not embedded in the configuration")
+	assert.NotEmpty(t, cfg.Spec.Extensions.Helm.Charts[0].Values, "the configuration is left untouched")
+}
+
+func TestWriteRenderedConfig(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, writeRenderedConfig(dir, renderTestConfig()))
+
+	data, err := os.ReadFile(filepath.Join(dir, "k0s.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "chartname: openebs/openebs")
+	data, err = os.ReadFile(filepath.Join(dir, "values", "openebs.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "engines:\n  local:\n    lvm:\n      enabled: false\n", string(data))
+	assert.FileExists(t, filepath.Join(dir, "values", "app.yaml"))
+}
@@ -8,6 +8,8 @@ import (
 	"os"
 	"os/exec"
 	"regexp"
+	"sort"
+	"strings"
 	"time"
 
 	autopilot "github.com/k0sproject/k0s/pkg/apis/autopilot/v1beta2"
@@ -19,10 +21,21 @@ import (
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	"github.com/replicatedhq/embedded-cluster/pkg/conntrack"
 	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/drainhooks"
+	"github.com/replicatedhq/embedded-cluster/pkg/etcdsnapshot"
+	"github.com/replicatedhq/embedded-cluster/pkg/firewall"
+	"github.com/replicatedhq/embedded-cluster/pkg/hardening"
 	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+	"github.com/replicatedhq/embedded-cluster/pkg/hostconfig"
+	"github.com/replicatedhq/embedded-cluster/pkg/kotscli"
 	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/localvolumes"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
 	"github.com/replicatedhq/embedded-cluster/pkg/prompts"
+	"github.com/replicatedhq/embedded-cluster/pkg/storageplan"
+	"github.com/replicatedhq/embedded-cluster/pkg/watchdog"
 )
 
 type etcdMembers struct {
@@ -48,6 +61,7 @@ type k0sStatus struct {
 }
 
 type k0sVars struct {
+	DataDir               string `json:"DataDir"`
 	KubeletAuthConfigPath string `json:"KubeletAuthConfigPath"`
 	CertRootDir           string `json:"CertRootDir"`
 	EtcdCertDir           string `json:"EtcdCertDir"`
@@ -58,6 +72,9 @@ var (
 	k0s     = "/usr/local/bin/k0s"
 )
 
+// localArtifactMirrorUnitPath is the systemd unit of the local artifact mirror.
+const localArtifactMirrorUnitPath = "/etc/systemd/system/local-artifact-mirror.service"
+
 var haWarningMessage = "WARNING: High-availability clusters must maintain at least three controller nodes, but resetting this node will leave only two. This can lead to a loss of functionality and non-recoverable failures. You should re-add a third node as soon as possible."
 
 // deleteNode removes the node from the cluster
@@ -109,15 +126,7 @@ var (
 // drainNode uses k0s to initiate a node drain
 func (h *hostInfo) drainNode() error {
 	os.Setenv("KUBECONFIG", h.Status.Vars.KubeletAuthConfigPath)
-	drainArgList := []string{
-		"kubectl",
-		"drain",
-		"--ignore-daemonsets",
-		"--delete-emptydir-data",
-		"--timeout", "60s",
-		h.Hostname,
-	}
-	out, err := exec.Command(k0s, drainArgList...).CombinedOutput()
+	out, err := exec.Command(k0s, kubectlDrainArgs(h.Hostname, time.Minute)...).CombinedOutput()
 	if err != nil {
 		if notFoundRegex.Match(out) {
 			return nil
@@ -127,6 +136,19 @@ func (h *hostInfo) drainNode() error {
 	return nil
 }
 
+// runDrainHooks runs the vendor provided drain hooks for the phase. Nothing is done if we
+// could not reach the cluster.
+func (h *hostInfo) runDrainHooks(ctx context.Context, phase drainhooks.Phase) error {
+	if h.KclientError != nil {
+		return nil
+	}
+	in, err := kubeutils.GetLatestInstallation(ctx, h.Kclient)
+	if err != nil {
+		return fmt.Errorf("unable to get latest installation: %w", err)
+	}
+	return drainhooks.Run(ctx, h.Kclient, in.Spec.Config, phase, h.Hostname)
+}
+
 // configureKubernetesClient optimistically sets up a client to use for kubernetes api calls
 // it stores any errors in h.KclientError
 func (h *hostInfo) configureKubernetesClient() {
@@ -194,6 +216,10 @@ func (h *hostInfo) checkResetSafety(c *cli.Context) (bool, string, error) {
 	if etcdClient.Health(c.Context) != nil {
 		return false, "Etcd is not ready. Please wait up to 5 minutes and try again.", nil
 	}
+	members, err := etcdClient.ListMembers(c.Context)
+	if err != nil {
+		return false, "", fmt.Errorf("unable to list etcd members: %w", err)
+	}
 
 	// get a rough picture of the cluster topology
 	workers := []string{}
@@ -203,10 +229,12 @@ func (h *hostInfo) checkResetSafety(c *cli.Context) (bool, string, error) {
 	if err != nil {
 		return false, "", fmt.Errorf("unable to list Nodes: %w", err)
 	}
+	ready := map[string]bool{}
 	for _, node := range nodeList.Items {
 		labels := node.GetLabels()
 		if labels["node-role.kubernetes.io/control-plane"] == "true" {
 			controllers = append(controllers, node.Name)
+			ready[node.Name] = newNodeInfo(node, 0).Ready
 		} else {
 			workers = append(workers, node.Name)
 		}
@@ -215,19 +243,98 @@ func (h *hostInfo) checkResetSafety(c *cli.Context) (bool, string, error) {
 		message := fmt.Sprintf("Cannot reset the last %s node when there are other nodes in the cluster.", h.RoleName)
 		return false, message, nil
 	}
+	if reason := etcdQuorumAfterLeave(members, ready, h.Hostname); reason != "" {
+		return false, reason, nil
+	}
 	return true, "", nil
 }
 
+// etcdQuorumAfterLeave returns why the etcd cluster would lose its quorum once the leaving
+// member is removed, or an empty string if it keeps it. A member is counted as healthy
+// when the node of the same name is Ready.
+func etcdQuorumAfterLeave(members map[string]string, ready map[string]bool, leaving string) string {
+	var remaining, unhealthy []string
+	for name := range members {
+		if name == leaving {
+			continue
+		}
+		remaining = append(remaining, name)
+		if !ready[name] {
+			unhealthy = append(unhealthy, name)
+		}
+	}
+	if len(remaining) == 0 {
+		return ""
+	}
+	quorum := len(remaining)/2 + 1
+	if healthy := len(remaining) - len(unhealthy); healthy < quorum {
+		sort.Strings(unhealthy)
+		return fmt.Sprintf(
+			"Resetting this node would leave %d healthy etcd members out of %d, %d are needed for quorum. Unhealthy members: %s.",
+			healthy, len(remaining), quorum, strings.Join(unhealthy, ", "),
+		)
+	}
+	return ""
+}
+
+// localVolumesOnNode returns the persistent volumes whose only copy is stored on this node,
+// described from the cluster when it can be reached.
+func (h *hostInfo) localVolumesOnNode(ctx context.Context) ([]localvolumes.Volume, error) {
+	volumes, err := localvolumes.OnHost(localvolumes.BaseDir())
+	if err != nil || len(volumes) == 0 {
+		return volumes, err
+	}
+	// the kubelet is not allowed to read the volumes, the admin kubeconfig is only
+	// found on controllers.
+	if _, err := os.Stat(defaults.PathToKubeConfig()); err == nil {
+		os.Setenv("KUBECONFIG", defaults.PathToKubeConfig())
+		if kcli, err := kubeutils.KubeClient(); err == nil {
+			localvolumes.Describe(ctx, kcli, volumes)
+		}
+	} else if h.KclientError == nil {
+		localvolumes.Describe(ctx, h.Kclient, volumes)
+	}
+	return volumes, nil
+}
+
+// checkLocalVolumes keeps the only copy of the data of the volumes stored on this node from
+// being deleted by accident: a backup is created first when requested, the user confirms
+// the data is to be deleted otherwise.
+func checkLocalVolumes(c *cli.Context, volumes []localvolumes.Volume) error {
+	if len(volumes) == 0 {
+		return nil
+	}
+	if c.Bool("backup") {
+		if _, err := os.Stat(defaults.PathToKubeConfig()); err != nil {
+			return fmt.Errorf("Backups can only be created from a controller node. Create one from the Admin Console and run reset command with --force.")
+		}
+		os.Setenv("KUBECONFIG", defaults.PathToKubeConfig())
+		return kotscli.Backup(c.Context, kotscli.BackupOptions{Namespace: defaults.KotsadmNamespace})
+	}
+
+	logrus.Warnf("This node holds the only copy of the data of %d persistent volumes:", len(volumes))
+	for _, volume := range volumes {
+		logrus.Warnf("  - %s", volume)
+	}
+	logrus.Warn("Resetting this node deletes this data permanently.")
+	if c.Bool("force") {
+		return nil
+	}
+	if c.Bool("no-prompt") {
+		return fmt.Errorf("Refusing to delete the only copy of the data.\nRun reset command with --backup to create a backup first, or with --force to ignore this.")
+	}
+	logrus.Info("Run reset command with --backup to create a backup with Velero first.")
+	if !prompts.New().Confirm("Do you want to delete this data?", false) {
+		return fmt.Errorf("Aborting")
+	}
+	return nil
+}
+
 // leaveEtcdcluster uses k0s to attempt to leave the etcd cluster
 func (h *hostInfo) leaveEtcdcluster() error {
 
 	// if we're the only etcd member we don't need to leave the cluster
-	out, err := exec.Command(k0s, "etcd", "member-list").Output()
-	if err != nil {
-		return err
-	}
-	memberlist := etcdMembers{}
-	err = json.Unmarshal(out, &memberlist)
+	memberlist, err := etcdMemberList()
 	if err != nil {
 		return err
 	}
@@ -235,13 +342,32 @@ func (h *hostInfo) leaveEtcdcluster() error {
 		return nil
 	}
 
-	out, err = exec.Command(k0s, "etcd", "leave").CombinedOutput()
+	out, err := exec.Command(k0s, "etcd", "leave").CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("unable to leave etcd cluster: %w, %s", err, string(out))
 	}
 	return nil
 }
 
+// resetPaths returns the files and directories a reset removes from the host once k0s has
+// been reset, in the order they are removed.
+func resetPaths() []string {
+	return []string{
+		defaults.PathToK0sConfig(),
+		hardening.AuditPolicyPath,
+		localArtifactMirrorUnitPath,
+		hostconfig.LocalArtifactMirrorProxyDropInPath,
+		"/etc/systemd/system/k0scontroller.service.d",
+		"/etc/systemd/system/k0sworker.service.d",
+		defaults.EmbeddedClusterHomeDirectory(),
+		defaults.PathToK0sContainerdConfig(),
+		systemdUnitFileName(),
+		storageplan.HostDataDir(),
+		"/etc/NetworkManager/conf.d/embedded-cluster.conf",
+		defaults.K0sBinaryPath(),
+	}
+}
+
 // stopK0s attempts to stop the k0s service
 func stopAndResetK0s() error {
 	out, err := exec.Command(k0s, "stop").CombinedOutput()
@@ -347,10 +473,10 @@ func maybePrintHAWarning(c *cli.Context) error {
 var resetCommand = &cli.Command{
 	Name: "reset",
 	Before: func(c *cli.Context) error {
-		if os.Getuid() != 0 {
-			return fmt.Errorf("reset command must be run as root")
+		if err := privileges.Check("reset", hostAdminPrivileges()...); err != nil {
+			return err
 		}
-		return nil
+		return validateOutputFlag(c)
 	},
 	Args: false,
 	Flags: []cli.Flag{
@@ -365,13 +491,27 @@ var resetCommand = &cli.Command{
 			Usage: "Disable interactive prompts",
 			Value: false,
 		},
+		&cli.BoolFlag{
+			Name:  "backup",
+			Usage: "Create a backup with Velero before resetting a node that holds the only copy of persistent volumes",
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Run the safety checks and print what the reset would remove from this node without removing it.",
+		},
+		getTimeoutFlag(),
+		getOutputFlag(),
 	},
 	Usage: fmt.Sprintf("Remove %s from the current node", binName),
-	Action: func(c *cli.Context) error {
+	Action: withResultOutput(withTimeout(func(c *cli.Context) error {
 		if err := maybePrintHAWarning(c); err != nil && !c.Bool("force") {
 			return err
 		}
 
+		if c.Bool("dry-run") {
+			return runResetDryRun(c)
+		}
+
 		logrus.Info("This will remove this node from the cluster and completely reset it, removing all data stored on the node.")
 		logrus.Info("This node will also reboot. Do not reset another node until this is complete.")
 		if !c.Bool("force") && !c.Bool("no-prompt") && !prompts.New().Confirm("Do you want to continue?", false) {
@@ -395,6 +535,14 @@ var resetCommand = &cli.Command{
 			}
 		}
 
+		volumes, err := currentHost.localVolumesOnNode(c.Context)
+		if !checkErrPrompt(c, err) {
+			return err
+		}
+		if err := checkLocalVolumes(c, volumes); err != nil {
+			return err
+		}
+
 		var numControllerNodes int
 		if currentHost.KclientError == nil {
 			numControllerNodes, _ = kubeutils.NumOfControlPlaneNodes(c.Context, currentHost.Kclient)
@@ -402,12 +550,23 @@ var resetCommand = &cli.Command{
 		// do not drain node if this is the only controller node in the cluster
 		// if there is an error (numControllerNodes == 0), drain anyway to be safe
 		if currentHost.Status.Role != "controller" || numControllerNodes != 1 {
+			resultFromContext(c.Context).startPhase("drain")
+			err = currentHost.runDrainHooks(c.Context, drainhooks.PreDrain)
+			if !checkErrPrompt(c, err) {
+				return err
+			}
+
 			logrus.Info("Draining node...")
 			err = currentHost.drainNode()
 			if !checkErrPrompt(c, err) {
 				return err
 			}
 
+			err = currentHost.runDrainHooks(c.Context, drainhooks.PostDrain)
+			if !checkErrPrompt(c, err) {
+				return err
+			}
+
 			// remove node from cluster
 			logrus.Info("Removing node from cluster...")
 			removeCtx, removeCancel := context.WithTimeout(c.Context, time.Minute)
@@ -438,58 +597,47 @@ var resetCommand = &cli.Command{
 		}
 
 		// reset
+		resultFromContext(c.Context).startPhase("reset")
 		logrus.Infof("Resetting node...")
 		err = stopAndResetK0s()
 		if !checkErrPrompt(c, err) {
 			return err
 		}
 
-		if err := helpers.RemoveAll(defaults.PathToK0sConfig()); err != nil {
-			return fmt.Errorf("failed to remove k0s config: %w", err)
-		}
-
-		lamPath := "/etc/systemd/system/local-artifact-mirror.service"
-		if _, err := os.Stat(lamPath); err == nil {
+		if _, err := os.Stat(localArtifactMirrorUnitPath); err == nil {
 			if _, err := helpers.RunCommand("systemctl", "stop", "local-artifact-mirror"); err != nil {
 				return err
 			}
 		}
-		if err := helpers.RemoveAll(lamPath); err != nil {
-			return fmt.Errorf("failed to remove local-artifact-mirror path: %w", err)
-		}
 
-		proxyControllerPath := "/etc/systemd/system/k0scontroller.service.d"
-		if err := helpers.RemoveAll(proxyControllerPath); err != nil {
-			return fmt.Errorf("failed to remove proxy controller path: %w", err)
+		if err := conntrack.Remove(); err != nil {
+			return fmt.Errorf("failed to remove conntrack config: %w", err)
 		}
 
-		proxyWorkerPath := "/etc/systemd/system/k0sworker.service.d"
-		if err := helpers.RemoveAll(proxyWorkerPath); err != nil {
-			return fmt.Errorf("failed to remove proxy worker path: %w", err)
+		if err := etcdsnapshot.RemoveTimer(); err != nil {
+			return fmt.Errorf("failed to remove etcd snapshot timer: %w", err)
 		}
 
-		if err := helpers.RemoveAll(defaults.EmbeddedClusterHomeDirectory()); err != nil {
-			return fmt.Errorf("failed to remove embedded cluster directory: %w", err)
+		if err := watchdog.Remove(); err != nil {
+			return fmt.Errorf("failed to remove watchdog: %w", err)
 		}
 
-		if err := helpers.RemoveAll(defaults.PathToK0sContainerdConfig()); err != nil {
-			return fmt.Errorf("failed to remove containerd config: %w", err)
+		if err := firewall.Reset(c.Context); err != nil {
+			return fmt.Errorf("failed to reset firewall: %w", err)
 		}
 
-		if err := helpers.RemoveAll(systemdUnitFileName()); err != nil {
-			return fmt.Errorf("failed to remove systemd unit file: %w", err)
-		}
-
-		if err := helpers.RemoveAll("/var/openebs"); err != nil {
-			return fmt.Errorf("failed to remove openebs storage: %w", err)
+		for _, path := range resetPaths() {
+			if err := helpers.RemoveAll(path); err != nil {
+				return fmt.Errorf("failed to remove %s: %w", path, err)
+			}
 		}
 
-		if err := helpers.RemoveAll("/etc/NetworkManager/conf.d/embedded-cluster.conf"); err != nil {
-			return fmt.Errorf("failed to remove NetworkManager configuration: %w", err)
+		// the result is printed before rebooting as the process does not outlive the reboot.
+		if err := recordNodeResult(c, false); err != nil {
+			return err
 		}
-
-		if err := helpers.RemoveAll("/usr/local/bin/k0s"); err != nil {
-			return fmt.Errorf("failed to remove k0s binary: %w", err)
+		if err := resultFromContext(c.Context).emit(nil); err != nil {
+			return err
 		}
 
 		if _, err := exec.Command("reboot").Output(); err != nil {
@@ -497,5 +645,5 @@ var resetCommand = &cli.Command{
 		}
 
 		return nil
-	},
+	})),
 }
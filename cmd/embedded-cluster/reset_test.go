@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEtcdQuorumAfterLeave(t *testing.T) {
+	members := map[string]string{
+		"node1": "https://10.0.0.1:2380",
+		"node2": "https://10.0.0.2:2380",
+		"node3": "https://10.0.0.3:2380",
+	}
+	for _, tt := range []struct {
+		name    string
+		members map[string]string
+		ready   map[string]bool
+		leaving string
+		want    string
+	}{
+		{
+			name:    "all healthy",
+			members: members,
+			ready:   map[string]bool{"node1": true, "node2": true, "node3": true},
+			leaving: "node1",
+		},
+		{
+			name:    "leaving the unhealthy member",
+			members: members,
+			ready:   map[string]bool{"node2": true, "node3": true},
+			leaving: "node1",
+		},
+		{
+			name:    "another member is unhealthy",
+			members: members,
+			ready:   map[string]bool{"node1": true, "node2": true},
+			leaving: "node1",
+			want:    "Resetting this node would leave 1 healthy etcd members out of 2, 2 are needed for quorum. Unhealthy members: node3.",
+		},
+		{
+			name:    "last member",
+			members: map[string]string{"node1": "https://10.0.0.1:2380"},
+			leaving: "node1",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, etcdQuorumAfterLeave(tt.members, tt.ready, tt.leaving))
+		})
+	}
+}
@@ -24,9 +24,11 @@ import (
 	"github.com/replicatedhq/embedded-cluster/pkg/config"
 	"github.com/replicatedhq/embedded-cluster/pkg/constants"
 	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/encryption"
 	"github.com/replicatedhq/embedded-cluster/pkg/kotscli"
 	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
 	"github.com/replicatedhq/embedded-cluster/pkg/netutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
 	"github.com/replicatedhq/embedded-cluster/pkg/prompts"
 	"github.com/replicatedhq/embedded-cluster/pkg/release"
 	"github.com/replicatedhq/embedded-cluster/pkg/spinner"
@@ -114,25 +116,50 @@ func (e *invalidBackupsError) Error() string {
 	return fmt.Sprintf("\nFound %d backups, but none are restorable:\n%s\n", len(e.invalidBackups), strings.Join(reasons, "\n"))
 }
 
-// getECRestoreState returns the current restore state.
-func getECRestoreState(ctx context.Context) ecRestoreState {
-	kcli, err := kubeutils.KubeClient()
-	if err != nil {
-		return ecRestoreStateNew
+// restoreCheckpoint is the restore state as saved on this host. It mirrors the state kept
+// in the cluster so an interrupted restore can be resumed even if the kubernetes api is not
+// reachable yet when the restore command is run again.
+type restoreCheckpoint struct {
+	State      ecRestoreState `json:"state"`
+	BackupName string         `json:"backupName,omitempty"`
+	UpdatedAt  time.Time      `json:"updatedAt"`
+}
+
+// restoreAPITimeout is how long the restore waits for the kubernetes api to come back before
+// giving up when it becomes unreachable.
+var restoreAPITimeout = 5 * time.Minute
+
+func restoreCheckpointPath() string {
+	return filepath.Join(defaults.EmbeddedClusterHomeDirectory(), "restore-state.json")
+}
+
+func readRestoreCheckpoint(path string) (*restoreCheckpoint, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read restore checkpoint: %w", err)
 	}
-	cm := &corev1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Namespace: "embedded-cluster",
-			Name:      constants.EcRestoreStateCMName,
-		},
+	var checkpoint restoreCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("unable to parse restore checkpoint: %w", err)
 	}
-	if err := kcli.Get(ctx, types.NamespacedName{Namespace: cm.Namespace, Name: cm.Name}, cm); err != nil {
-		return ecRestoreStateNew
+	return &checkpoint, nil
+}
+
+func writeRestoreCheckpoint(path string, checkpoint restoreCheckpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("unable to marshal restore checkpoint: %w", err)
 	}
-	state, ok := cm.Data["state"]
-	if !ok {
-		return ecRestoreStateNew
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("unable to write restore checkpoint: %w", err)
 	}
+	return nil
+}
+
+// parseECRestoreState returns the restore state matching the string, new if none does.
+func parseECRestoreState(state string) ecRestoreState {
 	for _, s := range ecRestoreStates {
 		if s == ecRestoreState(state) {
 			return s
@@ -141,6 +168,56 @@ func getECRestoreState(ctx context.Context) ecRestoreState {
 	return ecRestoreStateNew
 }
 
+// getRestoreStateConfigMap reads the restore state from the cluster. When a checkpoint says
+// a restore is in progress the cluster is expected to come back, the read is then retried
+// until restoreAPITimeout.
+func getRestoreStateConfigMap(ctx context.Context, checkpoint *restoreCheckpoint) (*corev1.ConfigMap, error) {
+	deadline := time.Now().Add(restoreAPITimeout)
+	for {
+		cm, err := readRestoreStateConfigMap(ctx)
+		if err == nil || errors.IsNotFound(err) || checkpoint == nil || time.Now().After(deadline) {
+			return cm, err
+		}
+		logrus.Debugf("unable to read restore state from the cluster, retrying: %v", err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func readRestoreStateConfigMap(ctx context.Context) (*corev1.ConfigMap, error) {
+	kcli, err := kubeutils.KubeClient()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create kube client: %w", err)
+	}
+	cm := &corev1.ConfigMap{}
+	nsn := types.NamespacedName{Namespace: "embedded-cluster", Name: constants.EcRestoreStateCMName}
+	if err := kcli.Get(ctx, nsn, cm); err != nil {
+		return nil, err
+	}
+	return cm, nil
+}
+
+// getECRestoreState returns the current restore state. The state kept in the cluster wins,
+// the checkpoint on this host is used when the cluster can not be reached.
+func getECRestoreState(ctx context.Context) ecRestoreState {
+	checkpoint, err := readRestoreCheckpoint(restoreCheckpointPath())
+	if err != nil {
+		logrus.Debugf("unable to read restore checkpoint: %v", err)
+	}
+	cm, err := getRestoreStateConfigMap(ctx, checkpoint)
+	if err == nil {
+		return parseECRestoreState(cm.Data["state"])
+	}
+	if checkpoint != nil && !errors.IsNotFound(err) {
+		logrus.Debugf("using the restore checkpoint, the cluster is unreachable: %v", err)
+		return parseECRestoreState(string(checkpoint.State))
+	}
+	return ecRestoreStateNew
+}
+
 // setECRestoreState sets the current restore state.
 func setECRestoreState(ctx context.Context, state ecRestoreState, backupName string) error {
 	kcli, err := kubeutils.KubeClient()
@@ -176,6 +253,10 @@ func setECRestoreState(ctx context.Context, state ecRestoreState, backupName str
 			return fmt.Errorf("unable to update config map: %w", err)
 		}
 	}
+	checkpoint := restoreCheckpoint{State: state, BackupName: backupName, UpdatedAt: time.Now().UTC()}
+	if err := writeRestoreCheckpoint(restoreCheckpointPath(), checkpoint); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -194,6 +275,9 @@ func resetECRestoreState(ctx context.Context) error {
 	if err := kcli.Delete(ctx, cm); err != nil && !errors.IsNotFound(err) {
 		return fmt.Errorf("unable to delete config map: %w", err)
 	}
+	if err := os.Remove(restoreCheckpointPath()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove restore checkpoint: %w", err)
+	}
 	return nil
 }
 
@@ -203,21 +287,16 @@ func resetECRestoreState(ctx context.Context) error {
 //   - is not found by Velero anymore.
 //   - is not restorable by the current binary.
 func getBackupFromRestoreState(ctx context.Context, isAirgap bool) (*velerov1.Backup, error) {
-	kcli, err := kubeutils.KubeClient()
+	checkpoint, err := readRestoreCheckpoint(restoreCheckpointPath())
 	if err != nil {
-		return nil, fmt.Errorf("unable to create kube client: %w", err)
-	}
-	cm := &corev1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Namespace: "embedded-cluster",
-			Name:      constants.EcRestoreStateCMName,
-		},
+		logrus.Debugf("unable to read restore checkpoint: %v", err)
 	}
-	if err := kcli.Get(ctx, types.NamespacedName{Namespace: cm.Namespace, Name: cm.Name}, cm); err != nil {
+	cm, err := getRestoreStateConfigMap(ctx, checkpoint)
+	if err != nil && (checkpoint == nil || checkpoint.BackupName == "") {
 		return nil, fmt.Errorf("unable to get restore state: %w", err)
 	}
-	backupName, ok := cm.Data["backup-name"]
-	if !ok || backupName == "" {
+	backupName := restoreBackupName(cm, checkpoint)
+	if backupName == "" {
 		return nil, nil
 	}
 	cfg, err := k8sconfig.GetConfig()
@@ -250,6 +329,23 @@ func getBackupFromRestoreState(ctx context.Context, isAirgap bool) (*velerov1.Ba
 	return backup, nil
 }
 
+// restoreBackupName returns the backup a resumed restore continues with. The backup saved in
+// the checkpoint of this host when the restore started is pinned, the restore state in the
+// cluster is only used when the checkpoint does not name one.
+func restoreBackupName(cm *corev1.ConfigMap, checkpoint *restoreCheckpoint) string {
+	var fromCluster string
+	if cm != nil {
+		fromCluster = cm.Data["backup-name"]
+	}
+	if checkpoint == nil || checkpoint.BackupName == "" {
+		return fromCluster
+	}
+	if fromCluster != "" && fromCluster != checkpoint.BackupName {
+		logrus.Warnf("The restore state in the cluster names backup %q, resuming from backup %q the restore started with.", fromCluster, checkpoint.BackupName)
+	}
+	return checkpoint.BackupName
+}
+
 // newS3BackupStore prompts the user for S3 backup store configuration.
 func newS3BackupStore() *s3BackupStore {
 	store := &s3BackupStore{}
@@ -310,7 +406,8 @@ func RunHostPreflightsForRestore(c *cli.Context, applier *addons.Applier, proxy
 	if err != nil {
 		return fmt.Errorf("unable to read host preflights: %w", err)
 	}
-	return runHostPreflights(c, hpf, proxy)
+	_, err = runHostPreflights(c, hpf, proxy)
+	return err
 }
 
 // ensureK0sConfigForRestore creates a new k0s.yaml configuration file for restore operations.
@@ -333,6 +430,9 @@ func ensureK0sConfigForRestore(c *cli.Context, applier *addons.Applier) (*k0sv1b
 	cfg.Spec.Storage.Etcd.PeerAddress = address
 	cfg.Spec.Network.PodCIDR = c.String("pod-cidr")
 	cfg.Spec.Network.ServiceCIDR = c.String("service-cidr")
+	if err := applyEncryptionAtRest(cfg); err != nil {
+		return nil, err
+	}
 	if err := config.UpdateHelmConfigsForRestore(applier, cfg); err != nil {
 		return nil, fmt.Errorf("unable to update helm configs: %w", err)
 	}
@@ -463,7 +563,11 @@ func waitForBackups(ctx context.Context, isAirgap bool) ([]velerov1.Backup, erro
 	}
 
 	for i := 0; i < 30; i++ {
-		time.Sleep(5 * time.Second)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("cancelled waiting for backups: %w", ctx.Err())
+		case <-time.After(5 * time.Second):
+		}
 
 		backupList, err := veleroClient.Backups(defaults.VeleroNamespace).List(ctx, metav1.ListOptions{})
 		if err != nil {
@@ -522,6 +626,17 @@ func pickBackupToRestore(backups []velerov1.Backup) *velerov1.Backup {
 	return latestBackup
 }
 
+// findBackupToRestore returns the backup with the provided name, nil if none of the
+// provided backups has it.
+func findBackupToRestore(backups []velerov1.Backup, name string) *velerov1.Backup {
+	for i := range backups {
+		if backups[i].Name == name {
+			return &backups[i]
+		}
+	}
+	return nil
+}
+
 // getK0sConfigFromDisk reads and returns the k0s config from disk.
 func getK0sConfigFromDisk() (*k0sv1beta1.ClusterConfig, error) {
 	cfgBytes, err := os.ReadFile(defaults.PathToK0sConfig())
@@ -549,11 +664,20 @@ func waitForVeleroRestoreCompleted(ctx context.Context, restoreName string) (*ve
 		return nil, fmt.Errorf("unable to create velero client: %w", err)
 	}
 
+	// restores of large volumes take hours, the api becoming unreachable for a moment
+	// must not abort them.
+	lastSeen := time.Now()
 	for {
 		restore, err := veleroClient.Restores(defaults.VeleroNamespace).Get(ctx, restoreName, metav1.GetOptions{})
 		if err != nil {
-			return nil, fmt.Errorf("unable to get restore: %w", err)
+			if errors.IsNotFound(err) || time.Since(lastSeen) > restoreAPITimeout {
+				return nil, fmt.Errorf("unable to get restore: %w", err)
+			}
+			logrus.Debugf("unable to get restore %s, retrying: %v", restoreName, err)
+			time.Sleep(5 * time.Second)
+			continue
 		}
+		lastSeen = time.Now()
 
 		switch restore.Status.Phase {
 		case velerov1.RestorePhaseCompleted:
@@ -746,11 +870,19 @@ func restoreFromBackup(ctx context.Context, backup *velerov1.Backup, drComponent
 
 	restoreName := fmt.Sprintf("%s.%s", backup.Name, string(drComponent))
 
-	// check if a restore object already exists
-	_, err = veleroClient.Restores(defaults.VeleroNamespace).Get(ctx, restoreName, metav1.GetOptions{})
+	// check if a restore object already exists. velero marks the restores it was running
+	// as failed when it restarts, these are started again when the restore is resumed.
+	existing, err := veleroClient.Restores(defaults.VeleroNamespace).Get(ctx, restoreName, metav1.GetOptions{})
 	if err != nil && !errors.IsNotFound(err) {
 		return fmt.Errorf("unable to get restore: %w", err)
 	}
+	if err == nil && existing.Status.Phase == velerov1.RestorePhaseFailed {
+		logrus.Debugf("deleting failed restore %s to start it again", restoreName)
+		if err := deleteVeleroRestore(ctx, veleroClient, restoreName); err != nil {
+			return err
+		}
+		err = errors.NewNotFound(velerov1.Resource("restore"), restoreName)
+	}
 
 	// create a new restore object if it doesn't exist
 	if errors.IsNotFound(err) {
@@ -805,6 +937,22 @@ func restoreFromBackup(ctx context.Context, backup *velerov1.Backup, drComponent
 	return waitForDRComponent(ctx, drComponent, restoreName)
 }
 
+// deleteVeleroRestore deletes a restore object and waits for it to be gone.
+func deleteVeleroRestore(ctx context.Context, veleroClient veleroclientv1.VeleroV1Interface, name string) error {
+	err := veleroClient.Restores(defaults.VeleroNamespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("unable to delete restore: %w", err)
+	}
+	for i := 0; i < 60; i++ {
+		_, err := veleroClient.Restores(defaults.VeleroNamespace).Get(ctx, name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		time.Sleep(time.Second)
+	}
+	return fmt.Errorf("timed out waiting for restore %s to be deleted", name)
+}
+
 // waitForAdditionalNodes waits for for user to add additional nodes to the cluster.
 func waitForAdditionalNodes(ctx context.Context, highAvailability bool, networkInterface string) error {
 	kcli, err := kubeutils.KubeClient()
@@ -870,7 +1018,7 @@ func installAndWaitForRestoredK0sNode(c *cli.Context, applier *addons.Applier) (
 	}
 	proxy := getProxySpecFromFlags(c)
 	logrus.Debugf("creating systemd unit files")
-	if err := createSystemdUnitFiles(false, proxy, applier.GetLocalArtifactMirrorPort()); err != nil {
+	if err := createSystemdUnitFiles(false, k0sNodeIP(cfg), proxy, applier.GetLocalArtifactMirror()); err != nil {
 		return nil, fmt.Errorf("unable to create systemd unit files: %w", err)
 	}
 	logrus.Debugf("installing k0s")
@@ -879,7 +1027,7 @@ func installAndWaitForRestoredK0sNode(c *cli.Context, applier *addons.Applier) (
 	}
 	loading.Infof("Waiting for %s node to be ready", binName)
 	logrus.Debugf("waiting for k0s to be ready")
-	if err := waitForK0s(); err != nil {
+	if err := waitForK0s(c, true); err != nil {
 		return nil, fmt.Errorf("unable to wait for node: %w", err)
 	}
 	loading.Infof("Node installation finished!")
@@ -923,16 +1071,24 @@ var restoreCommand = &cli.Command{
 				// DefaultText: strconv.Itoa(defaults.LocalArtifactMirrorPort),
 				Hidden: false,
 			},
+			&cli.StringFlag{
+				Name:  "backup",
+				Usage: "Name of the backup to restore. If left empty, the most recent restorable backup is used.",
+			},
+			getIgnoreUnsupportedOSFlag(),
+			getNodeReadyTimeoutFlag(),
+			getTimeoutFlag(),
 		},
 	)),
+	BashComplete: completeFlagValue("backup", completeBackupNames),
 	Before: func(c *cli.Context) error {
-		if os.Getuid() != 0 {
-			return fmt.Errorf("restore command must be run as root")
+		if err := privileges.Check("restore", hostAdminPrivileges()...); err != nil {
+			return err
 		}
 		os.Setenv("KUBECONFIG", defaults.PathToKubeConfig())
 		return nil
 	},
-	Action: func(c *cli.Context) error {
+	Action: withTimeout(func(c *cli.Context) error {
 		proxy := getProxySpecFromFlags(c)
 		setProxyEnv(proxy)
 
@@ -1003,13 +1159,17 @@ var restoreCommand = &cli.Command{
 				return fmt.Errorf("unable to configure network manager: %w", err)
 			}
 			logrus.Debugf("materializing binaries")
-			if err := materializeFiles(c); err != nil {
+			if err := materializeFiles(c, true); err != nil {
 				return fmt.Errorf("unable to materialize binaries: %w", err)
 			}
 			logrus.Debugf("running host preflights")
 			if err := RunHostPreflightsForRestore(c, applier, proxy); err != nil {
 				return fmt.Errorf("unable to finish preflight checks: %w", err)
 			}
+			logrus.Debugf("configuring selinux")
+			if err := configureSELinux(); err != nil {
+				return err
+			}
 
 			cfg, err := installAndWaitForRestoredK0sNode(c, applier)
 			if err != nil {
@@ -1060,7 +1220,14 @@ var restoreCommand = &cli.Command{
 			}
 
 			logrus.Debugf("picking backup to restore")
-			backupToRestore = pickBackupToRestore(backups)
+			if name := c.String("backup"); name != "" {
+				backupToRestore = findBackupToRestore(backups, name)
+				if backupToRestore == nil {
+					return fmt.Errorf("backup %q not found or not restorable", name)
+				}
+			} else {
+				backupToRestore = pickBackupToRestore(backups)
+			}
 
 			logrus.Info("")
 			completionTimestamp := backupToRestore.Status.CompletionTimestamp.Time.Format("2006-01-02 15:04:05 UTC")
@@ -1085,6 +1252,10 @@ var restoreCommand = &cli.Command{
 			if err := restoreReconcileLocalArtifactMirrorPort(c, backupToRestore); err != nil {
 				return fmt.Errorf("unable to update local artifact mirror port: %w", err)
 			}
+			logrus.Debugf("enabling encryption at rest on the restored installation")
+			if err := restoreReconcileEncryptionAtRest(c); err != nil {
+				return fmt.Errorf("unable to update encryption at rest: %w", err)
+			}
 			fallthrough
 
 		case ecRestoreStateRestoreAdminConsole:
@@ -1183,7 +1354,7 @@ var restoreCommand = &cli.Command{
 		}
 
 		return nil
-	},
+	}),
 }
 
 // restoreReconcileLocalArtifactMirrorPort will set the local artifact mirror port in the
@@ -1236,6 +1407,32 @@ func restoreReconcileLocalArtifactMirrorPortFromFlag(c *cli.Context) error {
 	return nil
 }
 
+// restoreReconcileEncryptionAtRest flags the restored installation as encrypting secrets
+// at rest and stores the encryption configuration of the new cluster for joining
+// controllers. The backup may have been taken from a cluster installed before encryption
+// at rest was enabled by default.
+func restoreReconcileEncryptionAtRest(c *cli.Context) error {
+	kcli, err := kubeutils.KubeClient()
+	if err != nil {
+		return fmt.Errorf("create kube client: %w", err)
+	}
+	if err := encryption.StoreConfig(c.Context, kcli, "embedded-cluster"); err != nil {
+		return fmt.Errorf("store encryption config: %w", err)
+	}
+	in, err := kubeutils.GetLatestInstallation(c.Context, kcli)
+	if err != nil {
+		return fmt.Errorf("get latest installation: %w", err)
+	}
+	if in.Spec.EncryptionAtRest {
+		return nil
+	}
+	in.Spec.EncryptionAtRest = true
+	if err := kcli.Update(c.Context, in); err != nil {
+		return fmt.Errorf("update installation: %w", err)
+	}
+	return nil
+}
+
 // restoreReconcileLocalArtifactMirrorPortFromBackup will update the service to use the port from
 // the installation.
 func restoreReconcileLocalArtifactMirrorPortFromBackup(backup *velerov1.Backup) error {
@@ -1248,7 +1445,7 @@ func restoreReconcileLocalArtifactMirrorPortFromBackup(backup *velerov1.Backup)
 		return fmt.Errorf("unable to parse local artifact mirror port from backup: %w", err)
 	}
 	logrus.Debugf("updating local artifact mirror port from backup to %d", port)
-	if err := updateLocalArtifactMirrorService(port); err != nil {
+	if err := updateLocalArtifactMirrorService(ecv1beta1.LocalArtifactMirrorSpec{Port: port}); err != nil {
 		return fmt.Errorf("unable to update local artifact mirror service: %w", err)
 	}
 	return nil
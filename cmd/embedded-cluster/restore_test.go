@@ -0,0 +1,53 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFindBackupToRestore(t *testing.T) {
+	backups := []velerov1.Backup{
+		{ObjectMeta: metav1.ObjectMeta{Name: "backup-1"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "backup-2"}},
+	}
+	backup := findBackupToRestore(backups, "backup-2")
+	require.NotNil(t, backup)
+	assert.Equal(t, "backup-2", backup.Name)
+	assert.Nil(t, findBackupToRestore(backups, "backup-3"))
+}
+
+func TestRestoreCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "restore-state.json")
+	checkpoint, err := readRestoreCheckpoint(path)
+	require.NoError(t, err)
+	assert.Nil(t, checkpoint)
+
+	updatedAt := time.Date(2024, 10, 17, 12, 0, 0, 0, time.UTC)
+	want := restoreCheckpoint{State: ecRestoreStateRestoreApp, BackupName: "backup-1", UpdatedAt: updatedAt}
+	require.NoError(t, writeRestoreCheckpoint(path, want))
+	checkpoint, err = readRestoreCheckpoint(path)
+	require.NoError(t, err)
+	assert.Equal(t, &want, checkpoint)
+}
+
+func TestRestoreBackupName(t *testing.T) {
+	cm := &corev1.ConfigMap{Data: map[string]string{"backup-name": "backup-2"}}
+	assert.Equal(t, "backup-2", restoreBackupName(cm, nil))
+	assert.Equal(t, "backup-2", restoreBackupName(cm, &restoreCheckpoint{State: ecRestoreStateConfirmBackup}))
+	assert.Equal(t, "backup-1", restoreBackupName(cm, &restoreCheckpoint{BackupName: "backup-1"}))
+	assert.Equal(t, "backup-1", restoreBackupName(nil, &restoreCheckpoint{BackupName: "backup-1"}))
+	assert.Equal(t, "", restoreBackupName(&corev1.ConfigMap{}, nil))
+}
+
+func TestParseECRestoreState(t *testing.T) {
+	assert.Equal(t, ecRestoreStateRestoreSeaweedFS, parseECRestoreState("restore-seaweedfs"))
+	assert.Equal(t, ecRestoreStateNew, parseECRestoreState("unknown"))
+	assert.Equal(t, ecRestoreStateNew, parseECRestoreState(""))
+}
@@ -15,6 +15,7 @@ import (
 	"golang.org/x/term"
 
 	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
 )
 
 const welcome = `
@@ -26,6 +27,24 @@ const welcome = `
  ~~~~~~~~~~~
 `
 
+// shellAliases are the aliases configured in the shell to make it easier to
+// inspect the cluster.
+var shellAliases = []string{
+	"k=kubectl",
+	"kgp='kubectl get pods'",
+	"kgpa='kubectl get pods --all-namespaces'",
+	"kgn='kubectl get nodes -o wide'",
+	"kinstallation='kubectl get installations.embeddedcluster.replicated.com'",
+}
+
+// writeShellCommand writes a command to the shell and discards its echo so it is
+// not displayed to the user.
+func writeShellCommand(tty *os.File, command string) {
+	command = fmt.Sprintf("%s\n", command)
+	_, _ = tty.WriteString(command)
+	_, _ = io.CopyN(io.Discard, tty, int64(len(command)+1))
+}
+
 // handleResize is a helper function to handle pty resizes.
 func handleResize(ch chan os.Signal, tty *os.File) {
 	for range ch {
@@ -39,8 +58,8 @@ var shellCommand = &cli.Command{
 	Name:  "shell",
 	Usage: "Start a shell with access to the cluster",
 	Before: func(c *cli.Context) error {
-		if os.Getuid() != 0 {
-			return fmt.Errorf("shell command must be run as root")
+		if err := privileges.Check("shell", clusterPrivileges()...); err != nil {
+			return err
 		}
 		return nil
 	},
@@ -88,29 +107,26 @@ var shellCommand = &cli.Command{
 		}()
 
 		kcpath := defaults.PathToKubeConfig()
-		config := fmt.Sprintf("export KUBECONFIG=%q\n", kcpath)
-		_, _ = shellpty.WriteString(config)
-		_, _ = io.CopyN(io.Discard, shellpty, int64(len(config)+1))
+		writeShellCommand(shellpty, fmt.Sprintf("export KUBECONFIG=%q", kcpath))
 
 		bindir := defaults.EmbeddedClusterBinsSubDir()
-		config = fmt.Sprintf("export PATH=\"$PATH:%s\"\n", bindir)
-		_, _ = shellpty.WriteString(config)
-		_, _ = io.CopyN(io.Discard, shellpty, int64(len(config)+1))
+		writeShellCommand(shellpty, fmt.Sprintf("export PATH=\"$PATH:%s\"", bindir))
+
+		for _, alias := range shellAliases {
+			writeShellCommand(shellpty, fmt.Sprintf("alias %s", alias))
+		}
 
 		// if /etc/bash_completion is present enable kubectl auto completion.
 		if _, err := os.Stat("/etc/bash_completion"); err == nil {
-			config = fmt.Sprintf("source <(k0s completion %s)\n", filepath.Base(shpath))
-			_, _ = shellpty.WriteString(config)
-			_, _ = io.CopyN(io.Discard, shellpty, int64(len(config)+1))
+			writeShellCommand(shellpty, fmt.Sprintf("source <(k0s completion %s)", filepath.Base(shpath)))
 
 			comppath := defaults.PathToEmbeddedClusterBinary("kubectl_completion_bash.sh")
-			config = fmt.Sprintf("source <(cat %s)\n", comppath)
-			_, _ = shellpty.WriteString(config)
-			_, _ = io.CopyN(io.Discard, shellpty, int64(len(config)+1))
+			writeShellCommand(shellpty, fmt.Sprintf("source <(cat %s)", comppath))
+
+			writeShellCommand(shellpty, "source /etc/bash_completion")
 
-			config = "source /etc/bash_completion\n"
-			_, _ = shellpty.WriteString(config)
-			_, _ = io.CopyN(io.Discard, shellpty, int64(len(config)+1))
+			// make the completion work for the kubectl alias as well.
+			writeShellCommand(shellpty, "complete -o default -F __start_kubectl k")
 		}
 
 		go func() { _, _ = io.Copy(shellpty, os.Stdin) }()
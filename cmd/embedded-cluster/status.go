@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	kotsv1beta1 "github.com/replicatedhq/kotskinds/apis/kots/v1beta1"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/status"
+	"github.com/replicatedhq/embedded-cluster/pkg/clusterlock"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/metrics"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
+	"github.com/replicatedhq/embedded-cluster/pkg/release"
+	"github.com/replicatedhq/embedded-cluster/pkg/versions"
+)
+
+const (
+	operatorNamespace     = "embedded-cluster"
+	operatorStatusService = "embedded-cluster-operator-status"
+
+	// channelRefreshTimeout is how long status waits for the channel releases before
+	// falling back to the cached ones.
+	channelRefreshTimeout = 10 * time.Second
+)
+
+// statusOutput is the status of the operator along with the releases available in the
+// channel of the installation and the operation holding the cluster lock, if any.
+type statusOutput struct {
+	status.Status
+	Channel *channelStatus      `json:"channel,omitempty"`
+	Lock    *clusterlock.Holder `json:"lock,omitempty"`
+}
+
+// channelStatus holds the last-known releases of the channel. Offline is set when they
+// could not be fetched again and are read from the cache. The available releases are
+// unknown, and not set, when the installed version is.
+type channelStatus struct {
+	CurrentVersion string                     `json:"currentVersion"`
+	Available      []release.AvailableRelease `json:"available"`
+	Upgrade        *upgradeCheck              `json:"upgrade,omitempty"`
+	CheckedAt      time.Time                  `json:"checkedAt"`
+	Stale          bool                       `json:"stale"`
+	Offline        bool                       `json:"offline"`
+	LastError      string                     `json:"lastError,omitempty"`
+}
+
+// upgradeCheck tells if the installed version can be upgraded to Version according to the
+// last-known releases of the channel, and the required releases to install first.
+type upgradeCheck struct {
+	Version   string                     `json:"version"`
+	Available bool                       `json:"available"`
+	Required  []release.AvailableRelease `json:"required,omitempty"`
+}
+
+// Allowed returns true if the version is available and no required release is skipped.
+func (u *upgradeCheck) Allowed() bool {
+	return u.Available && len(u.Required) == 0
+}
+
+var statusCommand = &cli.Command{
+	Name:  "status",
+	Usage: "Show the state of the cluster as reported by the operator",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "output",
+			Aliases: []string{"o"},
+			Usage:   "Output format, one of text or json.",
+			Value:   "text",
+		},
+		&cli.BoolFlag{
+			Name:  "offline",
+			Usage: "Show the cached releases of the channel without fetching them again",
+		},
+		&cli.StringFlag{
+			Name:  "upgrade-to",
+			Usage: "Check the upgrade to this version against the releases of the channel, fails if it is not available or required releases must be installed first",
+		},
+	},
+	Before: func(c *cli.Context) error {
+		if err := privileges.Check("status", clusterPrivileges()...); err != nil {
+			return err
+		}
+		if output := c.String("output"); output != "text" && output != "json" {
+			return fmt.Errorf("invalid output %q, must be one of text or json", output)
+		}
+		os.Setenv("KUBECONFIG", defaults.PathToKubeConfig())
+		return nil
+	},
+	Action: func(c *cli.Context) error {
+		cfg, err := config.GetConfig()
+		if err != nil {
+			return fmt.Errorf("unable to process kubernetes config: %w", err)
+		}
+		clientset, err := kubernetes.NewForConfig(cfg)
+		if err != nil {
+			return fmt.Errorf("unable to create kubernetes client: %w", err)
+		}
+
+		// the status api is reached through the kubernetes api server service proxy.
+		data, err := clientset.CoreV1().Services(operatorNamespace).
+			ProxyGet("http", operatorStatusService, "status", status.Path, nil).
+			DoRaw(c.Context)
+		if err != nil {
+			return fmt.Errorf("unable to get status from the operator: %w", err)
+		}
+		var st status.Status
+		if err := json.Unmarshal(data, &st); err != nil {
+			return fmt.Errorf("unable to parse operator status: %w", err)
+		}
+
+		out := statusOutput{Status: st}
+		kcli, err := kubeutils.KubeClient()
+		if err != nil {
+			return fmt.Errorf("unable to create kube client: %w", err)
+		}
+		current, target := installedVersion(c.Context, kcli), c.String("upgrade-to")
+		out.Channel = getChannelStatus(c.Context, defaults.PathToChannelMetadataCache(), current, target, !c.Bool("offline"), time.Now())
+		out.Lock = getClusterLock(c.Context, kcli)
+		if target != "" && (out.Channel == nil || out.Channel.Upgrade == nil) {
+			return fmt.Errorf("unable to check the upgrade to %s, the installed version or the releases of the channel are unknown", target)
+		}
+
+		if c.String("output") == "json" {
+			data, err := json.MarshalIndent(out, "", "  ")
+			if err != nil {
+				return fmt.Errorf("unable to marshal status: %w", err)
+			}
+			fmt.Println(string(data))
+		} else {
+			printStatus(out)
+		}
+
+		if !st.Ready || (out.Channel != nil && out.Channel.Upgrade != nil && !out.Channel.Upgrade.Allowed()) {
+			return ErrNothingElseToAdd
+		}
+		return nil
+	},
+}
+
+// getChannelStatus returns the releases of the channel available after the current
+// version, fetching them again if refresh is set, and checks the upgrade to the target
+// version if set. The cached releases are returned when they can not be fetched. Returns
+// nil if no releases have ever been cached, as in air gap installations.
+func getChannelStatus(ctx context.Context, path, current, target string, refresh bool, now time.Time) *channelStatus {
+	var meta *release.ChannelMetadata
+	var fetchErr error
+	if refresh {
+		ctx, cancel := context.WithTimeout(ctx, channelRefreshTimeout)
+		defer cancel()
+		meta, fetchErr = release.RefreshChannelMetadata(ctx, path)
+	} else {
+		meta, fetchErr = release.ReadChannelMetadata(path)
+	}
+	if meta == nil {
+		if fetchErr != nil {
+			logrus.Debugf("unable to read channel releases: %v", fetchErr)
+		}
+		return nil
+	}
+	cs := &channelStatus{
+		CurrentVersion: current,
+		CheckedAt:      meta.FetchedAt,
+		Stale:          meta.IsStale(now),
+		Offline:        !refresh || fetchErr != nil,
+	}
+	if current != "" {
+		cs.Available = meta.Available(current)
+		if target != "" {
+			required, ok := meta.RequiredBefore(current, target)
+			cs.Upgrade = &upgradeCheck{Version: target, Available: ok, Required: required}
+		}
+	}
+	if fetchErr != nil {
+		cs.LastError = fetchErr.Error()
+	}
+	return cs
+}
+
+// installedVersion returns the version label of the release installed in the cluster. The
+// release of this binary is only the installed one if the latest installation runs the
+// embedded cluster version of this binary, it is not after an upgrade made with another
+// binary. Returns an empty string when the installed version is unknown.
+func installedVersion(ctx context.Context, kcli client.Client) string {
+	rel, err := release.GetChannelRelease()
+	if err != nil || rel == nil {
+		return ""
+	}
+	in, err := kubeutils.GetLatestInstallation(ctx, kcli)
+	if err != nil {
+		logrus.Debugf("unable to get latest installation: %v", err)
+		return ""
+	}
+	if in.Spec.Config == nil || in.Spec.Config.Version != versions.Version {
+		logrus.Debugf("the cluster runs another version than this binary, the installed release is unknown")
+		return ""
+	}
+	return rel.VersionLabel
+}
+
+// getClusterLock returns who holds the cluster lock. Failures are only logged, the status
+// of the operator is shown regardless.
+func getClusterLock(ctx context.Context, kcli client.Client) *clusterlock.Holder {
+	holder, err := clusterlock.Get(ctx, kcli)
+	if err != nil {
+		logrus.Debugf("unable to get cluster lock: %v", err)
+		return nil
+	}
+	return holder
+}
+
+// cacheChannelMetadata fetches the releases of the channel and caches them, so status can
+// show them later on even while offline. Failures are only logged, the releases are
+// fetched again by status.
+func cacheChannelMetadata(ctx context.Context, license *kotsv1beta1.License) {
+	rel, err := release.GetChannelRelease()
+	if err != nil || rel == nil || license == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, channelRefreshTimeout)
+	defer cancel()
+	meta, err := release.FetchChannelMetadata(ctx, metrics.BaseURL(license), license.Spec.LicenseID, rel)
+	if err != nil {
+		logrus.Debugf("unable to fetch channel releases: %v", err)
+		return
+	}
+	if err := release.WriteChannelMetadata(defaults.PathToChannelMetadataCache(), meta); err != nil {
+		logrus.Debugf("unable to cache channel releases: %v", err)
+	}
+}
+
+// printStatus prints the operator status in a human readable format.
+func printStatus(out statusOutput) {
+	st := out.Status
+	fmt.Printf("Ready:        %t\n", st.Ready)
+	fmt.Printf("Installation: %s\n", st.Installation)
+	fmt.Printf("Version:      %s\n", st.Version)
+	fmt.Printf("State:        %s\n", st.State)
+	if st.Reason != "" {
+		fmt.Printf("Reason:       %s\n", st.Reason)
+	}
+	if st.LastReconcile != nil {
+		fmt.Printf("Last update:  %s\n", st.LastReconcile.UTC().Format(time.RFC3339))
+	}
+	if st.LastError != "" {
+		fmt.Printf("Last error:   %s\n", st.LastError)
+	}
+	if out.Lock != nil {
+		printClusterLock(out.Lock, time.Now())
+	}
+	if out.Channel != nil {
+		printChannelStatus(out.Channel, time.Now())
+	}
+	if len(st.Conditions) == 0 {
+		return
+	}
+	writer := table.NewWriter()
+	writer.AppendHeader(table.Row{"condition", "status", "reason", "message"})
+	for _, cond := range st.Conditions {
+		writer.AppendRow(table.Row{cond.Type, cond.Status, cond.Reason, cond.Message})
+	}
+	fmt.Printf("%s\n", writer.Render())
+}
+
+// printClusterLock prints the operation holding the cluster lock and since when.
+func printClusterLock(holder *clusterlock.Holder, now time.Time) {
+	fmt.Printf(
+		"Locked by:    %s running %s since %s (%s ago)\n",
+		holder.Identity, holder.Operation, holder.AcquiredAt.UTC().Format(time.RFC3339),
+		now.Sub(holder.AcquiredAt).Round(time.Second),
+	)
+}
+
+// printChannelStatus prints the available releases, the upgrade check and how fresh they
+// are.
+func printChannelStatus(cs *channelStatus, now time.Time) {
+	available := "none, up to date"
+	if cs.CurrentVersion == "" {
+		available = "unknown, the cluster runs another version than this binary"
+	} else if len(cs.Available) > 0 {
+		labels := []string{}
+		for _, rel := range cs.Available {
+			label := rel.VersionLabel
+			if rel.IsRequired {
+				label += " (required)"
+			}
+			labels = append(labels, label)
+		}
+		available = strings.Join(labels, ", ")
+	}
+	fmt.Printf("Available:    %s\n", available)
+	if cs.Upgrade != nil {
+		printUpgradeCheck(cs.Upgrade)
+	}
+
+	checked := fmt.Sprintf("%s (%s ago)", cs.CheckedAt.UTC().Format(time.RFC3339), now.Sub(cs.CheckedAt).Round(time.Minute))
+	if cs.Offline {
+		checked += ", offline"
+	}
+	if cs.Stale {
+		checked += ", stale"
+	}
+	fmt.Printf("Checked:      %s\n", checked)
+}
+
+// printUpgradeCheck prints if the upgrade is possible, or what prevents it.
+func printUpgradeCheck(check *upgradeCheck) {
+	switch {
+	case !check.Available:
+		fmt.Printf("Upgrade:      %s is not available in the channel\n", check.Version)
+	case len(check.Required) > 0:
+		labels := []string{}
+		for _, rel := range check.Required {
+			labels = append(labels, rel.VersionLabel)
+		}
+		fmt.Printf("Upgrade:      %s requires installing %s first\n", check.Version, strings.Join(labels, ", "))
+	default:
+		fmt.Printf("Upgrade:      %s is available\n", check.Version)
+	}
+}
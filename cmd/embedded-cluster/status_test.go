@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/release"
+)
+
+func TestGetChannelStatus(t *testing.T) {
+	now := time.Now()
+	path := filepath.Join(t.TempDir(), "channel-metadata.json")
+	assert.Nil(t, getChannelStatus(context.Background(), path, "1.0.0", "", false, now), "nothing cached")
+
+	require.NoError(t, release.WriteChannelMetadata(path, &release.ChannelMetadata{
+		FetchedAt: now.Add(-48 * time.Hour),
+		Releases: []release.AvailableRelease{
+			{VersionLabel: "1.0.0"},
+			{VersionLabel: "1.1.0", IsRequired: true},
+			{VersionLabel: "1.2.0"},
+		},
+	}))
+
+	cs := getChannelStatus(context.Background(), path, "1.1.0", "", false, now)
+	require.NotNil(t, cs)
+	assert.Equal(t, []release.AvailableRelease{{VersionLabel: "1.2.0"}}, cs.Available, "follows the installed version")
+	assert.True(t, cs.Stale)
+	assert.True(t, cs.Offline)
+	assert.Nil(t, cs.Upgrade)
+
+	cs = getChannelStatus(context.Background(), path, "", "1.2.0", false, now)
+	assert.Empty(t, cs.Available, "unknown installed version")
+	assert.Nil(t, cs.Upgrade)
+
+	cs = getChannelStatus(context.Background(), path, "1.0.0", "1.2.0", false, now)
+	require.NotNil(t, cs.Upgrade)
+	assert.True(t, cs.Upgrade.Available)
+	assert.False(t, cs.Upgrade.Allowed(), "skips a required release")
+	assert.Equal(t, []release.AvailableRelease{{VersionLabel: "1.1.0", IsRequired: true}}, cs.Upgrade.Required)
+
+	cs = getChannelStatus(context.Background(), path, "1.0.0", "1.1.0", false, now)
+	assert.True(t, cs.Upgrade.Allowed())
+
+	cs = getChannelStatus(context.Background(), path, "1.0.0", "2.0.0", false, now)
+	assert.False(t, cs.Upgrade.Available)
+	assert.False(t, cs.Upgrade.Allowed())
+}
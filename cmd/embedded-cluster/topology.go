@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+)
+
+func withTopologyFlags(flags []cli.Flag) []cli.Flag {
+	return append(flags,
+		&cli.StringFlag{
+			Name:  "zone",
+			Usage: "Failure domain (zone) the node belongs to. Workloads and storage replicas are spread across zones.",
+		},
+		&cli.StringFlag{
+			Name:  "rack",
+			Usage: "Rack the node belongs to within its zone.",
+		},
+	)
+}
+
+// getTopologyLabels returns the topology labels to be set on the node based on the zone
+// and rack provided by the user.
+func getTopologyLabels(c *cli.Context) (map[string]string, error) {
+	labels := map[string]string{}
+	for flag, label := range map[string]string{
+		"zone": defaults.ZoneLabel,
+		"rack": defaults.RackLabel,
+	} {
+		value := c.String(flag)
+		if value == "" {
+			continue
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid --%s %q: %s", flag, value, strings.Join(errs, ", "))
+		}
+		labels[label] = value
+	}
+	return labels, nil
+}
+
+// writeTopologyFiles stores the zone and rack assigned to the node so the storage pods
+// scheduled on it can register their data center and rack. Files of topology values not
+// provided by the user are removed.
+func writeTopologyFiles(c *cli.Context) error {
+	for _, flag := range []string{"zone", "rack"} {
+		path := defaults.PathToTopologyFile(flag)
+		value := c.String(flag)
+		if value == "" {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("unable to remove %s: %w", path, err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("unable to create topology directory: %w", err)
+		}
+		if err := os.WriteFile(path, []byte(value), 0644); err != nil {
+			return fmt.Errorf("unable to write %s: %w", path, err)
+		}
+	}
+	return nil
+}
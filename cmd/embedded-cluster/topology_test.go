@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+)
+
+func Test_getTopologyLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "no flags",
+			want: map[string]string{},
+		},
+		{
+			name: "zone and rack",
+			args: []string{"--zone", "us-east-1a", "--rack", "rack-2"},
+			want: map[string]string{
+				"topology.kubernetes.io/zone":   "us-east-1a",
+				"kots.io/embedded-cluster-rack": "rack-2",
+			},
+		},
+		{
+			name: "zone only",
+			args: []string{"--zone", "dc1"},
+			want: map[string]string{"topology.kubernetes.io/zone": "dc1"},
+		},
+		{
+			name:    "invalid zone",
+			args:    []string{"--zone", "zone a"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := withTopologyFlags([]cli.Flag{})
+			flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+			for _, f := range flags {
+				require.NoError(t, f.Apply(flagSet))
+			}
+			require.NoError(t, flagSet.Parse(tt.args))
+			c := cli.NewContext(cli.NewApp(), flagSet, nil)
+
+			got, err := getTopologyLabels(c)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_writeTopologyFiles(t *testing.T) {
+	original := defaults.DefaultProvider
+	defaults.DefaultProvider = defaults.NewProvider(t.TempDir())
+	t.Cleanup(func() { defaults.DefaultProvider = original })
+
+	context := func(args ...string) *cli.Context {
+		flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+		for _, f := range withTopologyFlags([]cli.Flag{}) {
+			require.NoError(t, f.Apply(flagSet))
+		}
+		require.NoError(t, flagSet.Parse(args))
+		return cli.NewContext(cli.NewApp(), flagSet, nil)
+	}
+
+	require.NoError(t, writeTopologyFiles(context("--zone", "dc1", "--rack", "rack-2")))
+	data, err := os.ReadFile(defaults.PathToTopologyFile("zone"))
+	require.NoError(t, err)
+	assert.Equal(t, "dc1", string(data))
+	data, err = os.ReadFile(defaults.PathToTopologyFile("rack"))
+	require.NoError(t, err)
+	assert.Equal(t, "rack-2", string(data))
+
+	require.NoError(t, writeTopologyFiles(context("--zone", "dc2")))
+	data, err = os.ReadFile(defaults.PathToTopologyFile("zone"))
+	require.NoError(t, err)
+	assert.Equal(t, "dc2", string(data))
+	assert.NoFileExists(t, defaults.PathToTopologyFile("rack"))
+}
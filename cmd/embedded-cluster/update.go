@@ -9,6 +9,8 @@ import (
 
 	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
 	"github.com/replicatedhq/embedded-cluster/pkg/kotscli"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
 	"github.com/replicatedhq/embedded-cluster/pkg/release"
 )
 
@@ -24,8 +26,8 @@ var updateCommand = &cli.Command{
 		},
 	},
 	Before: func(c *cli.Context) error {
-		if os.Getuid() != 0 {
-			return fmt.Errorf("update command must be run as root")
+		if err := privileges.Check("update", hostAdminPrivileges()...); err != nil {
+			return err
 		}
 		os.Setenv("KUBECONFIG", defaults.PathToKubeConfig())
 		return nil
@@ -38,6 +40,11 @@ var updateCommand = &cli.Command{
 			}
 		}
 
+		logrus.Debugf("verifying image signatures")
+		if err := verifyUpdateImageSignatures(c); err != nil {
+			return err
+		}
+
 		rel, err := release.GetChannelRelease()
 		if err != nil {
 			return fmt.Errorf("unable to get channel release: %w", err)
@@ -46,6 +53,18 @@ var updateCommand = &cli.Command{
 			return fmt.Errorf("no channel release found")
 		}
 
+		kcli, err := kubeutils.KubeClient()
+		if err != nil {
+			return fmt.Errorf("unable to create kube client: %w", err)
+		}
+		// the lock is held while the bundle is uploaded, the operator holds it again for the
+		// upgrade itself once the Admin Console deploys the new version.
+		lock, err := acquireClusterLock(c.Context, kcli, "update")
+		if err != nil {
+			return err
+		}
+		defer releaseClusterLock(lock)
+
 		if err := kotscli.AirgapUpdate(kotscli.AirgapUpdateOptions{
 			AppSlug:      rel.AppSlug,
 			Namespace:    defaults.KotsadmNamespace,
@@ -57,3 +76,25 @@ var updateCommand = &cli.Command{
 		return nil
 	},
 }
+
+// verifyUpdateImageSignatures verifies the signatures shipped in the airgap bundle for the
+// images of the release the cluster is updated to, this binary. The operator can not read
+// the bundle, air gapped upgrades are only verified here.
+func verifyUpdateImageSignatures(c *cli.Context) error {
+	embcfg, err := release.GetEmbeddedClusterConfig()
+	if err != nil {
+		return fmt.Errorf("unable to get embedded cluster config: %w", err)
+	}
+	if embcfg == nil || embcfg.Spec.ImageVerification == nil {
+		return nil
+	}
+	k0sCfg, disabled, err := renderReleaseK0sConfig()
+	if err != nil {
+		return err
+	}
+	meta, err := gatherVersionMetadata(k0sCfg, disabled)
+	if err != nil {
+		return fmt.Errorf("unable to list the release images: %w", err)
+	}
+	return verifyImages(*embcfg.Spec.ImageVerification, meta.Images, c.String("airgap-bundle"))
+}
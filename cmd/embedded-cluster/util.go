@@ -5,26 +5,26 @@ import (
 	"os"
 	"path/filepath"
 
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
 	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
 	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+	"github.com/replicatedhq/embedded-cluster/pkg/hostconfig"
 	"github.com/sirupsen/logrus"
 )
 
 // createSystemdUnitFiles links the k0s systemd unit file. this also creates a new
-// systemd unit file for the local artifact mirror service.
-func createSystemdUnitFiles(isWorker bool, proxy *ecv1beta1.ProxySpec, localArtifactMirrorPort int) error {
+// systemd unit file for the local artifact mirror service, controllers serve the other
+// nodes on their node address.
+func createSystemdUnitFiles(isWorker bool, nodeIP string, proxy *ecv1beta1.ProxySpec, localArtifactMirror ecv1beta1.LocalArtifactMirrorSpec) error {
 	dst := systemdUnitFileName()
 	if _, err := os.Lstat(dst); err == nil {
 		if err := os.Remove(dst); err != nil {
 			return err
 		}
 	}
-	src := "/etc/systemd/system/k0scontroller.service"
-	if isWorker {
-		src = "/etc/systemd/system/k0sworker.service"
-	}
+	src := hostconfig.K0sUnitPath(!isWorker)
 	if proxy != nil {
-		if err := ensureProxyConfig(fmt.Sprintf("%s.d", src), proxy.HTTPProxy, proxy.HTTPSProxy, proxy.NoProxy); err != nil {
+		if err := ensureProxyConfig(fmt.Sprintf("%s.d", src), proxy); err != nil {
 			return fmt.Errorf("unable to create proxy config: %w", err)
 		}
 	}
@@ -36,7 +36,11 @@ func createSystemdUnitFiles(isWorker bool, proxy *ecv1beta1.ProxySpec, localArti
 	if _, err := helpers.RunCommand("systemctl", "daemon-reload"); err != nil {
 		return fmt.Errorf("unable to get reload systemctl daemon: %w", err)
 	}
-	if err := installAndEnableLocalArtifactMirror(localArtifactMirrorPort); err != nil {
+	listenAddress := nodeIP
+	if isWorker {
+		listenAddress = ""
+	}
+	if err := installAndEnableLocalArtifactMirror(localArtifactMirror, listenAddress); err != nil {
 		return fmt.Errorf("unable to install and enable local artifact mirror: %w", err)
 	}
 	return nil
@@ -44,7 +48,7 @@ func createSystemdUnitFiles(isWorker bool, proxy *ecv1beta1.ProxySpec, localArti
 
 // ensureProxyConfig creates a new http-proxy.conf configuration file. The file is saved in the
 // systemd directory (/etc/systemd/system/k0scontroller.service.d/).
-func ensureProxyConfig(servicePath string, httpProxy string, httpsProxy string, noProxy string) error {
+func ensureProxyConfig(servicePath string, proxy *ecv1beta1.ProxySpec) error {
 	// create the directory
 	if err := os.MkdirAll(servicePath, 0755); err != nil {
 		return fmt.Errorf("unable to create directory: %w", err)
@@ -58,13 +62,17 @@ func ensureProxyConfig(servicePath string, httpProxy string, httpsProxy string,
 	defer fp.Close()
 
 	// write the file
-	if _, err := fp.WriteString(fmt.Sprintf(`[Service]
-Environment="HTTP_PROXY=%s"
-Environment="HTTPS_PROXY=%s"
-Environment="NO_PROXY=%s"`,
-		httpProxy, httpsProxy, noProxy)); err != nil {
+	if _, err := fp.WriteString(hostconfig.ProxyDropIn(proxy)); err != nil {
 		return fmt.Errorf("unable to write proxy file: %w", err)
 	}
 
 	return nil
 }
+
+// k0sNodeIP returns the address of the node in the k0s configuration.
+func k0sNodeIP(cfg *k0sv1beta1.ClusterConfig) string {
+	if cfg == nil || cfg.Spec == nil || cfg.Spec.API == nil {
+		return ""
+	}
+	return cfg.Spec.API.Address
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/config"
+	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+)
+
+var validateConfigCommand = &cli.Command{
+	Name:      "validate-config",
+	Usage:     "Validate an overrides file against the schema and the configuration it is applied to",
+	ArgsUsage: "<file>",
+	Before: func(c *cli.Context) error {
+		if c.Args().Len() != 1 {
+			return fmt.Errorf("usage: %s validate-config <file>", binName)
+		}
+		return nil
+	},
+	Action: func(c *cli.Context) error {
+		data, err := helpers.ReadEndUserConfig(c.Args().First())
+		if err != nil {
+			return err
+		}
+		applier, err := getAddonsApplier(c, "", nil)
+		if err != nil {
+			return err
+		}
+		cfg := config.RenderK0sConfig()
+		if err := config.UpdateHelmConfigs(applier, cfg); err != nil {
+			return fmt.Errorf("unable to update helm configs: %w", err)
+		}
+		if cfg, err = applyReleaseOverrides(cfg); err != nil {
+			return err
+		}
+		protected, err := applier.ProtectedFields()
+		if err != nil {
+			return fmt.Errorf("unable to get protected fields: %w", err)
+		}
+		allowed, err := allowedK0sOverrideFields()
+		if err != nil {
+			return err
+		}
+		findings := config.ValidateOverrides(data, cfg, protected, allowed)
+		printFindings(os.Stdout, c.Args().First(), findings)
+		if config.HasErrors(findings) {
+			return ErrNothingElseToAdd
+		}
+		return nil
+	},
+}
+
+// printFindings prints the findings of the validation of the file.
+func printFindings(w io.Writer, file string, findings []config.Finding) {
+	if len(findings) == 0 {
+		fmt.Fprintf(w, "%s is valid\n", file)
+		return
+	}
+	for _, f := range findings {
+		fmt.Fprintf(w, "%s: %s\n", file, f)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/urfave/cli/v2"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/release"
+	"github.com/replicatedhq/embedded-cluster/pkg/versions"
+)
+
+// verifyResult is the document printed by the verify command.
+type verifyResult struct {
+	*release.Verification
+	InstallerVersion  string `json:"installerVersion"`
+	KubernetesVersion string `json:"kubernetesVersion"`
+}
+
+var verifyCommand = &cli.Command{
+	Name:  "verify",
+	Usage: fmt.Sprintf("Verify the integrity and provenance of the %s binary", defaults.BinaryName()),
+	Description: "Checks the release embedded in the binary is intact and, when it is signed, that it was " +
+		"signed by a trusted key, then prints the app, channel and version the binary was built for. " +
+		"Run it before installing to confirm the right artifact was downloaded.",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "require-signature",
+			Usage: "Fail if the embedded release is not signed.",
+		},
+		&cli.StringFlag{
+			Name:    "output",
+			Aliases: []string{"o"},
+			Usage:   "Output format, one of text or json.",
+			Value:   "text",
+		},
+	},
+	Before: func(c *cli.Context) error {
+		if output := c.String("output"); output != "text" && output != "json" {
+			return fmt.Errorf("invalid output %q, must be one of text or json", output)
+		}
+		return nil
+	},
+	Action: func(c *cli.Context) error {
+		exe, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("unable to get executable path: %w", err)
+		}
+		keys, err := release.ParseSigningKeys(release.SigningKeys)
+		if err != nil {
+			return fmt.Errorf("unable to parse trusted signing keys: %w", err)
+		}
+		verification, err := release.VerifyBinary(exe, keys)
+		if err != nil {
+			return fmt.Errorf("verification of %s failed: %w", exe, err)
+		}
+		if verification.PayloadSHA256 == "" {
+			return fmt.Errorf("verification of %s failed: no release is embedded in the binary", exe)
+		}
+
+		result := verifyResult{
+			Verification:      verification,
+			InstallerVersion:  versions.Version,
+			KubernetesVersion: versions.K0sVersion,
+		}
+		if c.String("output") == "json" {
+			data, err := json.MarshalIndent(result, "", "  ")
+			if err != nil {
+				return fmt.Errorf("unable to encode verification: %w", err)
+			}
+			fmt.Println(string(data))
+		} else {
+			fmt.Println(renderVerification(result))
+		}
+
+		if c.Bool("require-signature") && !verification.Signed {
+			return fmt.Errorf("the embedded release is not signed")
+		}
+		return nil
+	},
+}
+
+// renderVerification renders the verification result as a table.
+func renderVerification(result verifyResult) string {
+	writer := table.NewWriter()
+	writer.AppendRow(table.Row{"Binary", result.BinaryPath})
+	writer.AppendRow(table.Row{"Binary SHA256", result.BinarySHA256})
+	if rel := result.Release; rel != nil {
+		writer.AppendRow(table.Row{"App", rel.AppSlug})
+		writer.AppendRow(table.Row{"Channel", fmt.Sprintf("%s (%s)", rel.ChannelSlug, rel.ChannelID)})
+		writer.AppendRow(table.Row{"Version", rel.VersionLabel})
+	}
+	writer.AppendRow(table.Row{"Installer", result.InstallerVersion})
+	writer.AppendRow(table.Row{"Kubernetes", result.KubernetesVersion})
+	writer.AppendRow(table.Row{"Release payload", fmt.Sprintf("intact (sha256 %s)", result.PayloadSHA256)})
+	if result.Signed {
+		writer.AppendRow(table.Row{"Signature", fmt.Sprintf("valid, signed by %s", result.KeyFingerprint)})
+	} else {
+		writer.AppendRow(table.Row{"Signature", "not signed"})
+	}
+	return writer.Render()
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/release"
+)
+
+func TestRenderVerification(t *testing.T) {
+	result := verifyResult{
+		Verification: &release.Verification{
+			BinaryPath:    "/tmp/app",
+			BinarySHA256:  "abc",
+			PayloadSHA256: "def",
+			Release:       &release.ChannelRelease{AppSlug: "app", ChannelSlug: "stable", ChannelID: "123", VersionLabel: "1.0.0"},
+		},
+		InstallerVersion:  "v1.2.0",
+		KubernetesVersion: "v1.29.9+k0s.0",
+	}
+	out := renderVerification(result)
+	assert.Contains(t, out, "stable (123)")
+	assert.Contains(t, out, "intact (sha256 def)")
+	assert.Contains(t, out, "not signed")
+
+	result.Signed, result.KeyFingerprint = true, "SHA256:xyz"
+	assert.Contains(t, renderVerification(result), "valid, signed by SHA256:xyz")
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+	"github.com/replicatedhq/embedded-cluster/pkg/k0sready"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/metrics"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
+	"github.com/replicatedhq/embedded-cluster/pkg/watchdog"
+)
+
+// bootIDPath changes every time the host boots.
+const bootIDPath = "/proc/sys/kernel/random/boot_id"
+
+var adminWatchdogCommand = &cli.Command{
+	Name:  "watchdog",
+	Usage: "Recover this node when it stops responding",
+	Before: func(c *cli.Context) error {
+		if err := privileges.Check("watchdog", hostPrivileges()...); err != nil {
+			return err
+		}
+		return nil
+	},
+	Subcommands: []*cli.Command{
+		adminWatchdogCheckCommand,
+	},
+}
+
+var adminWatchdogCheckCommand = &cli.Command{
+	Name:  "check",
+	Usage: "Check the health of k0s on this node and restart it, or reboot the host, when it keeps failing. Run every minute by a systemd timer.",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  "failure-threshold",
+			Usage: "Number of consecutive failed checks after which k0s is restarted, the host is rebooted after as many again",
+			Value: watchdog.DefaultFailureThreshold,
+		},
+	},
+	Action: func(c *cli.Context) error {
+		path := watchdogStatePath()
+		state, err := watchdog.ReadState(path)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if bootID, err := os.ReadFile(bootIDPath); err != nil {
+			logrus.Warnf("Unable to read the boot id: %v", err)
+		} else {
+			state.Boot(strings.TrimSpace(string(bootID)), watchdog.HostReset(), now)
+		}
+
+		// node drain --stop-k0s and ha verify stop k0s on purpose, the checks start over
+		// once the maintenance is over.
+		maintenance, err := readMaintenanceState(maintenanceStatePath())
+		if err != nil {
+			return err
+		}
+		if maintenance != nil && maintenance.K0sStopped {
+			logrus.Infof("k0s was stopped for maintenance at %s, skipping the health check.", maintenance.DrainedAt.Format(time.RFC3339))
+			state.Pause()
+			return watchdog.WriteState(path, state)
+		}
+
+		// only the health of the node itself is checked. The checks going through the
+		// cluster fail on every node when the controllers lose the quorum or the api
+		// server, restarting the nodes would only make the outage worse.
+		unit := k0sUnit()
+		ctx, cancel := context.WithTimeout(c.Context, 30*time.Second)
+		healthErr := k0sready.LocalReady(ctx, unit == "k0scontroller")
+		cancel()
+		var reason string
+		if healthErr != nil {
+			reason = healthErr.Error()
+			logrus.Warnf("k0s is not healthy: %v", healthErr)
+		}
+
+		action := state.Next(healthErr == nil, reason, c.Int("failure-threshold"), now)
+		if healthErr == nil && len(state.Pending) > 0 {
+			reportWatchdogRecoveries(c.Context, &state)
+		}
+		// the state is saved before acting, the host may not come back from the reboot.
+		if err := watchdog.WriteState(path, state); err != nil {
+			return err
+		}
+
+		switch action {
+		case watchdog.ActionRestartK0s:
+			logrus.Warnf("k0s failed %d consecutive health checks, restarting %s.", c.Int("failure-threshold"), unit)
+			if _, err := helpers.RunCommand("systemctl", "restart", unit); err != nil {
+				return fmt.Errorf("unable to restart %s: %w", unit, err)
+			}
+		case watchdog.ActionReboot:
+			logrus.Warn("k0s is still not healthy after being restarted, rebooting the host.")
+			if _, err := helpers.RunCommand("systemctl", "reboot"); err != nil {
+				return fmt.Errorf("unable to reboot: %w", err)
+			}
+		default:
+			if healthErr != nil && state.RebootLimitReached() {
+				logrus.Warn("k0s is not healthy but the host was rebooted too many times in the last day, leaving it as it is.")
+			}
+		}
+		return nil
+	},
+}
+
+// reportWatchdogRecoveries records the pending recoveries in the events of the
+// installation and reports them to the vendor, the ones reported are removed from the
+// state. Only controllers have access to the installation, workers log their recoveries.
+func reportWatchdogRecoveries(ctx context.Context, state *watchdog.State) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		logrus.Warnf("Unable to get hostname: %v", err)
+		return
+	}
+	if _, err := os.Stat(defaults.PathToKubeConfig()); err != nil {
+		for _, rec := range state.Pending {
+			logrus.Infof("Node recovered at %s: %s %s", rec.Time.Format(time.RFC3339), rec.Action, rec.Reason)
+		}
+		state.Pending = nil
+		return
+	}
+	kcli, err := kubeutils.KubeClient()
+	if err != nil {
+		logrus.Warnf("Unable to create kube client: %v", err)
+		return
+	}
+	in, err := kubeutils.GetLatestInstallation(ctx, kcli)
+	if err != nil {
+		logrus.Warnf("Unable to get the installation: %v", err)
+		return
+	}
+	if in.Spec.AirGap {
+		metrics.DisableMetrics()
+	}
+	clusterID, err := uuid.Parse(in.Spec.ClusterID)
+	if err != nil {
+		logrus.Debugf("unable to parse cluster id %q: %v", in.Spec.ClusterID, err)
+	}
+	for len(state.Pending) > 0 {
+		rec := state.Pending[0]
+		if err := watchdog.RecordRecovery(ctx, kcli, in, hostname, rec); err != nil {
+			logrus.Warnf("Unable to record the recovery: %v", err)
+			return
+		}
+		metrics.ReportUnattendedRecovery(ctx, in.Spec.MetricsBaseURL, clusterID, string(rec.Action), rec.Reason, rec.Time)
+		state.Pending = state.Pending[1:]
+	}
+}
+
+// configureWatchdog arms the watchdog of this node when the configuration enables it.
+// Failing to do so does not stop the installation, the node only misses the unattended
+// recovery.
+func configureWatchdog(cfg *ecv1beta1.ConfigSpec) {
+	wcfg := watchdog.ConfigFrom(cfg)
+	if wcfg == nil {
+		return
+	}
+	logrus.Debugf("arming the watchdog, runtime timeout %s", wcfg.RuntimeTimeout)
+	binary := defaults.PathToEmbeddedClusterBinary(binName)
+	if err := watchdog.Configure(binary, *wcfg); err != nil {
+		logrus.Warnf("Unable to configure the watchdog: %v", err)
+	}
+}
+
+// watchdogStatePath returns where the state of the health checks is kept.
+func watchdogStatePath() string {
+	return filepath.Join(defaults.EmbeddedClusterHomeDirectory(), "watchdog", "state.json")
+}
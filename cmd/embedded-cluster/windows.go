@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+
+	ecerrors "github.com/replicatedhq/embedded-cluster/pkg/errors"
+	"github.com/replicatedhq/embedded-cluster/pkg/joincheck"
+	"github.com/replicatedhq/embedded-cluster/pkg/versions"
+	"github.com/replicatedhq/embedded-cluster/pkg/windowsworker"
+)
+
+// roleWindowsWorker is the join role writing the artifacts that join a Windows Server
+// host instead of joining the current node.
+const roleWindowsWorker = "windows-worker"
+
+func withJoinRoleFlags(flags []cli.Flag) []cli.Flag {
+	return append(flags,
+		&cli.StringFlag{
+			Name:  "role",
+			Usage: fmt.Sprintf("Role of the joining node. Set to %s to write the artifacts that join a Windows Server host as a worker instead of joining this node.", roleWindowsWorker),
+		},
+		&cli.StringFlag{
+			Name:  "windows-output-dir",
+			Usage: fmt.Sprintf("Directory the %s artifacts are written to.", roleWindowsWorker),
+			Value: "windows-worker",
+		},
+	)
+}
+
+// validateJoinRole makes sure the role is known. The role of linux nodes comes from the
+// join command, the flag only selects the windows workers.
+func validateJoinRole(c *cli.Context) error {
+	if role := c.String("role"); role != "" && role != roleWindowsWorker {
+		return fmt.Errorf("unknown role %q, only %s can be set", role, roleWindowsWorker)
+	}
+	return nil
+}
+
+// isWindowsWorkerJoin returns true if the join writes the windows worker artifacts.
+func isWindowsWorkerJoin(c *cli.Context) bool {
+	return c.String("role") == roleWindowsWorker
+}
+
+// joinWindowsWorker fetches the join command and writes the windows worker artifacts
+// with it. Nothing is changed on the current node.
+func joinWindowsWorker(c *cli.Context) error {
+	target, err := parseJoinArgs(c, fmt.Sprintf("%s join --role %s <url> <token>", binName, roleWindowsWorker))
+	if err != nil {
+		return err
+	}
+	logrus.Debugf("fetching join token remotely")
+	jcmd, err := getJoinToken(c.Context, target.URL, target.Token)
+	if err != nil {
+		return ecerrors.Errorf(ecerrors.Network, "unable to get join token: %w", err)
+	}
+	if err := target.scope(jcmd); err != nil {
+		return err
+	}
+	if jcmd.EmbeddedClusterVersion != versions.Version {
+		return fmt.Errorf("embedded cluster version mismatch - this binary is version %q, but the cluster is running version %q", versions.Version, jcmd.EmbeddedClusterVersion)
+	}
+	return writeWindowsWorkerArtifacts(c, jcmd)
+}
+
+// writeWindowsWorkerArtifacts writes the artifacts that join a Windows Server host with
+// the join command. Windows hosts download their binaries, k0s from the local artifact
+// mirror of a controller, air gap installations are not supported.
+func writeWindowsWorkerArtifacts(c *cli.Context, jcmd *JoinCommandResponse) error {
+	if strings.Contains(jcmd.K0sJoinCommand, "controller") {
+		return fmt.Errorf("windows hosts can only join as workers, generate a join command for a worker node")
+	}
+	if jcmd.InstallationSpec.AirGap {
+		return fmt.Errorf("windows workers are not supported in air gap installations")
+	}
+	token, err := joincheck.DecodeToken(jcmd.K0sToken)
+	if err != nil {
+		return fmt.Errorf("unable to read join token: %w", err)
+	}
+	mirror, err := artifactMirrorAddress(c, jcmd)
+	if err != nil {
+		return err
+	}
+	labels, err := getTopologyLabels(c)
+	if err != nil {
+		return err
+	}
+	dir := c.String("windows-output-dir")
+	opts := windowsworker.Options{
+		K0sVersion:          versions.K0sVersion,
+		Token:               jcmd.K0sToken,
+		Server:              token.Server,
+		ArtifactMirror:      mirror,
+		ArtifactMirrorToken: token.BearerToken,
+		Network:             jcmd.InstallationSpec.Network,
+		Proxy:               jcmd.InstallationSpec.Proxy,
+		Labels:              labels,
+	}
+	if err := windowsworker.Write(dir, opts); err != nil {
+		return fmt.Errorf("unable to write windows worker artifacts: %w", err)
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+	logrus.Infof("Windows worker artifacts written to %s.", abs)
+	logrus.Infof("Copy the directory to the Windows Server host and run install.ps1 from it in an elevated PowerShell session.")
+	logrus.Infof("Windows nodes are tainted with os=windows:NoSchedule, only workloads tolerating it are scheduled on them.")
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestWriteWindowsWorkerArtifacts(t *testing.T) {
+	token := testK0sToken(t, "abcdef.0123456789abcdef")
+
+	tests := []struct {
+		name    string
+		args    []string
+		jcmd    JoinCommandResponse
+		wantErr string
+	}{
+		{
+			name: "worker",
+			jcmd: JoinCommandResponse{K0sJoinCommand: "/usr/local/bin/k0s install worker", K0sToken: token},
+		},
+		{
+			name:    "unknown role",
+			args:    []string{"--role", "windows"},
+			wantErr: `unknown role "windows", only windows-worker can be set`,
+		},
+		{
+			name:    "controller",
+			jcmd:    JoinCommandResponse{K0sJoinCommand: "/usr/local/bin/k0s install controller", K0sToken: token},
+			wantErr: "windows hosts can only join as workers, generate a join command for a worker node",
+		},
+		{
+			name: "airgap",
+			jcmd: JoinCommandResponse{
+				K0sJoinCommand:   "/usr/local/bin/k0s install worker",
+				K0sToken:         token,
+				InstallationSpec: ecv1beta1.InstallationSpec{AirGap: true},
+			},
+			wantErr: "windows workers are not supported in air gap installations",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "windows-worker")
+			flagSet := flag.NewFlagSet("test", 0)
+			for _, flag := range withJoinRoleFlags(withTopologyFlags(nil)) {
+				require.NoError(t, flag.Apply(flagSet))
+			}
+			args := tt.args
+			if args == nil {
+				args = []string{"--role", roleWindowsWorker}
+			}
+			require.NoError(t, flagSet.Parse(append(args, "--windows-output-dir", dir)))
+			c := cli.NewContext(cli.NewApp(), flagSet, nil)
+
+			err := validateJoinRole(c)
+			if err == nil {
+				assert.True(t, isWindowsWorkerJoin(c))
+				err = writeWindowsWorkerArtifacts(c, &tt.jcmd)
+			}
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.NoDirExists(t, dir)
+				return
+			}
+			require.NoError(t, err)
+			install, err := os.ReadFile(filepath.Join(dir, "install.ps1"))
+			require.NoError(t, err)
+			assert.Contains(t, string(install), fmt.Sprintf("http://127.0.0.1:%d/bin/k0s.exe", defaults.LocalArtifactMirrorPort))
+			assert.FileExists(t, filepath.Join(dir, "k0s-token"))
+			mirrorToken, err := os.ReadFile(filepath.Join(dir, "artifact-mirror-token"))
+			require.NoError(t, err)
+			assert.Equal(t, "abcdef.0123456789abcdef", string(mirrorToken))
+		})
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
+	"k8s.io/apimachinery/pkg/api/resource"
+	k8snet "k8s.io/utils/net"
+	"sigs.k8s.io/yaml"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+	"github.com/replicatedhq/embedded-cluster/pkg/installui"
+	"github.com/replicatedhq/embedded-cluster/pkg/netutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/prompts"
+	"github.com/replicatedhq/embedded-cluster/pkg/pullsecrets"
+	"github.com/replicatedhq/embedded-cluster/pkg/release"
+	"github.com/replicatedhq/embedded-cluster/pkg/storageplan"
+)
+
+// installConfig holds the answers gathered by the install wizard. It is saved as a file
+// that can be provided to the install command with --install-config for repeatable,
+// non-interactive installs. Values provided through flags take precedence. Registry
+// mirrors and image pull secrets can only be configured through the file.
+type installConfig struct {
+	AdminConsolePort        int    `json:"adminConsolePort,omitempty"`
+	LocalArtifactMirrorPort int    `json:"localArtifactMirrorPort,omitempty"`
+	NetworkInterface        string `json:"networkInterface,omitempty"`
+	License                 string `json:"license,omitempty"`
+	HTTPProxy               string `json:"httpProxy,omitempty"`
+	HTTPSProxy              string `json:"httpsProxy,omitempty"`
+	NoProxy                 string `json:"noProxy,omitempty"`
+	OpenEBSDataDir          string `json:"openEBSDataDir,omitempty"`
+	OpenEBSReservation      string `json:"openEBSStorageReservation,omitempty"`
+	RegistryStorageSize     string `json:"registryStorageSize,omitempty"`
+
+	RegistryMirrors  []ecv1beta1.RegistryMirror `json:"registryMirrors,omitempty"`
+	ImagePullSecrets []pullsecrets.Credential   `json:"imagePullSecrets,omitempty"`
+}
+
+// flags returns the install flags set by the configuration, indexed by flag name.
+func (i installConfig) flags() map[string]string {
+	flags := map[string]string{}
+	if i.AdminConsolePort != 0 {
+		flags["admin-console-port"] = strconv.Itoa(i.AdminConsolePort)
+	}
+	if i.LocalArtifactMirrorPort != 0 {
+		flags["local-artifact-mirror-port"] = strconv.Itoa(i.LocalArtifactMirrorPort)
+	}
+	values := map[string]string{
+		"network-interface":           i.NetworkInterface,
+		"license":                     i.License,
+		"http-proxy":                  i.HTTPProxy,
+		"https-proxy":                 i.HTTPSProxy,
+		"no-proxy":                    i.NoProxy,
+		"openebs-data-dir":            i.OpenEBSDataDir,
+		"openebs-storage-reservation": i.OpenEBSReservation,
+		"registry-storage-size":       i.RegistryStorageSize,
+	}
+	for name, value := range values {
+		if value != "" {
+			flags[name] = value
+		}
+	}
+	return flags
+}
+
+func readInstallConfig(path string) (*installConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read install config file: %w", err)
+	}
+	var cfg installConfig
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("unable to parse install config file %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+func writeInstallConfig(path string, cfg *installConfig) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("unable to marshal install config: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("unable to write install config file: %w", err)
+	}
+	return nil
+}
+
+// applyInstallConfig sets the flags that were not provided in the command line to the
+// values in the install configuration.
+func applyInstallConfig(c *cli.Context, cfg *installConfig) error {
+	for name, value := range cfg.flags() {
+		if c.IsSet(name) {
+			continue
+		}
+		if err := c.Set(name, value); err != nil {
+			return fmt.Errorf("unable to set %s from the install config: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// maybeApplyInstallConfig applies the install config file provided with --install-config
+// and gathers the settings from the installation web interface when --ui is set or from
+// the install wizard when --interactive is set.
+func maybeApplyInstallConfig(c *cli.Context) error {
+	if path := c.String("install-config"); path != "" {
+		cfg, err := readInstallConfig(path)
+		if err != nil {
+			return err
+		}
+		if err := applyInstallConfig(c, cfg); err != nil {
+			return err
+		}
+	}
+	if srv := installui.FromContext(c.Context); srv != nil {
+		logrus.Info("Waiting for the installation settings to be submitted in the browser")
+		settings, err := srv.WaitForSettings(c.Context)
+		if err != nil {
+			return fmt.Errorf("unable to get the installation settings: %w", err)
+		}
+		return applyUISettings(c, settings)
+	}
+	if !c.Bool("interactive") {
+		return nil
+	}
+	wizard := &installWizard{c: c, prompt: prompts.New(), out: os.Stdout}
+	cfg, err := wizard.run()
+	if err != nil {
+		return err
+	}
+	return applyInstallConfig(c, cfg)
+}
+
+// storageRequirement is the minimum size of the filesystem holding a directory, as
+// enforced by the host preflights.
+type storageRequirement struct {
+	Path     string
+	Required uint64
+}
+
+// storageRequirements returns the requirements of the filesystems the cluster stores data
+// in, the persistent volumes being stored in openEBSDataDir.
+func storageRequirements(openEBSDataDir string) []storageRequirement {
+	hostSize := resource.MustParse(storageplan.MinHostDiskSize)
+	dataSize := resource.MustParse(storageplan.MinDataDiskSize)
+	return []storageRequirement{
+		{Path: defaults.EmbeddedClusterHomeDirectory(), Required: uint64(hostSize.Value())},
+		{Path: defaults.K0sDataDir, Required: uint64(hostSize.Value())},
+		{Path: openEBSDataDir, Required: uint64(dataSize.Value())},
+		{Path: "/tmp", Required: uint64(dataSize.Value())},
+	}
+}
+
+// installWizard walks the user through the install settings one screen at a time.
+type installWizard struct {
+	c      *cli.Context
+	prompt prompts.Prompt
+	out    io.Writer
+	cfg    installConfig
+}
+
+func (w *installWizard) run() (*installConfig, error) {
+	steps := []struct {
+		title string
+		run   func() error
+	}{
+		{"License", w.askLicense},
+		{"Ports", w.askPorts},
+		{"Network interface", w.askNetworkInterface},
+		{"Proxy", w.askProxy},
+		{"Storage", w.checkStorage},
+	}
+	for i, step := range steps {
+		w.screen(fmt.Sprintf("Step %d of %d: %s", i+1, len(steps), step.title))
+		if err := step.run(); err != nil {
+			return nil, err
+		}
+	}
+	w.screen("Summary")
+	if err := w.summary(); err != nil {
+		return nil, err
+	}
+	return &w.cfg, nil
+}
+
+// screen starts a new screen of the wizard. The terminal is cleared unless plain prompts
+// are in use or the output is not a terminal.
+func (w *installWizard) screen(title string) {
+	if f, ok := w.out.(*os.File); ok && term.IsTerminal(int(f.Fd())) && os.Getenv("EMBEDDED_CLUSTER_PLAIN_PROMPTS") != "true" {
+		fmt.Fprint(w.out, "\033[H\033[2J")
+	}
+	fmt.Fprintf(w.out, "%s installation\n\n%s\n\n", binName, title)
+}
+
+func (w *installWizard) askLicense() error {
+	rel, err := release.GetChannelRelease()
+	if err != nil {
+		return fmt.Errorf("failed to get release from binary: %w", err)
+	}
+	if rel == nil {
+		fmt.Fprintln(w.out, "No license is required for this installation.")
+		return nil
+	}
+	const other = "Enter another path"
+	options := append(findLicenseFiles("."), other)
+	for {
+		path := w.prompt.Select("Select the license file:", options, options[0])
+		if path == other {
+			path = w.prompt.Input("Path to the license file:", w.c.String("license"), true)
+		}
+		if _, err := getLicenseFromFilepath(path); err != nil {
+			logrus.Error(err)
+			continue
+		}
+		w.cfg.License = path
+		return nil
+	}
+}
+
+// findLicenseFiles returns the yaml files in the provided directory that hold a license.
+func findLicenseFiles(dir string) []string {
+	var licenses []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+		for _, match := range matches {
+			if _, err := helpers.ParseLicense(match); err == nil {
+				licenses = append(licenses, match)
+			}
+		}
+	}
+	sort.Strings(licenses)
+	return licenses
+}
+
+func (w *installWizard) askPorts() error {
+	w.cfg.AdminConsolePort = w.askPort("Admin Console port:", w.c.String("admin-console-port"), 0)
+	w.cfg.LocalArtifactMirrorPort = w.askPort("Local Artifact Mirror port:", w.c.String("local-artifact-mirror-port"), w.cfg.AdminConsolePort)
+	return nil
+}
+
+// askPort asks for a port until a valid one, different from the taken port, is entered.
+func (w *installWizard) askPort(msg, defvalue string, taken int) int {
+	for {
+		port, err := k8snet.ParsePort(w.prompt.Input(msg, defvalue, true), false)
+		if err != nil {
+			logrus.Errorf("Invalid port: %v", err)
+			continue
+		}
+		if port == taken {
+			logrus.Errorf("Port %d is already used by the Admin Console", port)
+			continue
+		}
+		return port
+	}
+}
+
+func (w *installWizard) askNetworkInterface() error {
+	names, err := netutils.ListValidInterfaceNames()
+	if err != nil {
+		return fmt.Errorf("unable to list network interfaces: %w", err)
+	}
+	switch len(names) {
+	case 0:
+		return fmt.Errorf("no valid network interfaces found on this machine")
+	case 1:
+		fmt.Fprintf(w.out, "Using the only valid network interface, %s.\n", names[0])
+		w.cfg.NetworkInterface = names[0]
+		return nil
+	}
+	defvalue := names[0]
+	if current := w.c.String("network-interface"); current != "" {
+		defvalue = current
+	}
+	w.cfg.NetworkInterface = w.prompt.Select("Select the network interface to use for the cluster:", names, defvalue)
+	return nil
+}
+
+func (w *installWizard) askProxy() error {
+	current := w.c.String("http-proxy") != "" || w.c.String("https-proxy") != ""
+	if !w.prompt.Confirm("Is a proxy required to reach the internet?", current) {
+		return nil
+	}
+	w.cfg.HTTPProxy = w.prompt.Input("HTTP proxy:", w.c.String("http-proxy"), false)
+	httpsProxy := w.c.String("https-proxy")
+	if httpsProxy == "" {
+		httpsProxy = w.cfg.HTTPProxy
+	}
+	w.cfg.HTTPSProxy = w.prompt.Input("HTTPS proxy:", httpsProxy, false)
+	w.cfg.NoProxy = w.prompt.Input("Comma-separated list of hosts for which not to use a proxy:", w.c.String("no-proxy"), false)
+	return nil
+}
+
+// checkStorage shows the size of the filesystems the cluster stores data in and asks for
+// confirmation if any of them is smaller than required by the host preflights. The storage
+// flags are kept in the configuration.
+func (w *installWizard) checkStorage() error {
+	w.cfg.OpenEBSDataDir = w.c.String("openebs-data-dir")
+	w.cfg.OpenEBSReservation = w.c.String("openebs-storage-reservation")
+	w.cfg.RegistryStorageSize = w.c.String("registry-storage-size")
+	openEBSDataDir := w.cfg.OpenEBSDataDir
+	if openEBSDataDir == "" {
+		openEBSDataDir = defaults.OpenEBSDataDir
+	}
+	insufficient := false
+	for _, req := range storageRequirements(openEBSDataDir) {
+		total, available, err := helpers.FilesystemCapacity(req.Path)
+		if err != nil {
+			return fmt.Errorf("unable to check the capacity of %s: %w", req.Path, err)
+		}
+		status := "ok"
+		if total < req.Required {
+			status = "insufficient"
+			insufficient = true
+		}
+		fmt.Fprintf(w.out, "  %-28s %s total, %s available, %s required: %s\n", req.Path, formatGi(total), formatGi(available), formatGi(req.Required), status)
+	}
+	fmt.Fprintln(w.out)
+	if insufficient && !w.prompt.Confirm("Some filesystems are smaller than required and host preflights will fail. Continue?", false) {
+		return ErrNothingElseToAdd
+	}
+	return nil
+}
+
+func formatGi(bytes uint64) string {
+	return fmt.Sprintf("%.1fGi", float64(bytes)/(1<<30))
+}
+
+func (w *installWizard) summary() error {
+	data, err := yaml.Marshal(w.cfg)
+	if err != nil {
+		return fmt.Errorf("unable to marshal install config: %w", err)
+	}
+	fmt.Fprintf(w.out, "%s\n", data)
+	if w.prompt.Confirm("Save these settings to a file for repeatable installs?", true) {
+		path := w.prompt.Input("Path to the install config file:", fmt.Sprintf("%s-install.yaml", binName), true)
+		if err := writeInstallConfig(path, &w.cfg); err != nil {
+			return err
+		}
+		fmt.Fprintf(w.out, "Settings saved. Repeat this installation with:\n\n  sudo ./%s install --install-config %s\n\n", binName, path)
+	}
+	if !w.prompt.Confirm("Proceed with the installation?", true) {
+		return ErrNothingElseToAdd
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+// scriptedPrompt answers the prompts with the provided inputs and confirmations, in order.
+type scriptedPrompt struct {
+	inputs   []string
+	confirms []bool
+}
+
+func (s *scriptedPrompt) Confirm(string, bool) bool {
+	answer := s.confirms[0]
+	s.confirms = s.confirms[1:]
+	return answer
+}
+
+func (s *scriptedPrompt) PressEnter(string) {}
+
+func (s *scriptedPrompt) Password(string) string { return s.next() }
+
+func (s *scriptedPrompt) Select(string, []string, string) string { return s.next() }
+
+func (s *scriptedPrompt) Input(_ string, defvalue string, _ bool) string {
+	if answer := s.next(); answer != "" {
+		return answer
+	}
+	return defvalue
+}
+
+func (s *scriptedPrompt) next() string {
+	answer := s.inputs[0]
+	s.inputs = s.inputs[1:]
+	return answer
+}
+
+func newInstallTestContext(t *testing.T, flags map[string]string) *cli.Context {
+	flagSet := flag.NewFlagSet("test", 0)
+	for _, flag := range installCommand.Flags {
+		require.NoError(t, flag.Apply(flagSet))
+	}
+	for name, value := range flags {
+		require.NoError(t, flagSet.Set(name, value))
+	}
+	return cli.NewContext(cli.NewApp(), flagSet, nil)
+}
+
+func TestApplyInstallConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "install.yaml")
+	cfg := &installConfig{
+		AdminConsolePort: 31000,
+		NetworkInterface: "eth1",
+		License:          "license.yaml",
+		HTTPSProxy:       "http://proxy:3128",
+	}
+	require.NoError(t, writeInstallConfig(path, cfg))
+	read, err := readInstallConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, cfg, read)
+
+	c := newInstallTestContext(t, map[string]string{"license": "other.yaml"})
+	require.NoError(t, applyInstallConfig(c, read))
+	assert.Equal(t, "31000", c.String("admin-console-port"))
+	assert.Equal(t, "50000", c.String("local-artifact-mirror-port"))
+	assert.Equal(t, "eth1", c.String("network-interface"))
+	assert.Equal(t, "other.yaml", c.String("license"), "flags take precedence")
+	assert.Equal(t, "http://proxy:3128", c.String("https-proxy"))
+	assert.False(t, c.IsSet("http-proxy"))
+}
+
+func TestReadInstallConfigUnknownField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "install.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("adminPort: 30000\n"), 0644))
+	_, err := readInstallConfig(path)
+	assert.ErrorContains(t, err, "unknown field")
+}
+
+func TestInstallWizardPortsAndProxy(t *testing.T) {
+	prompt := &scriptedPrompt{
+		// an invalid admin console port, the default one, a local artifact mirror
+		// port matching the admin console one and a valid one.
+		inputs:   []string{"99999", "", "30000", "50001", "http://proxy:3128", "", "10.0.0.0/8"},
+		confirms: []bool{true},
+	}
+	w := &installWizard{c: newInstallTestContext(t, nil), prompt: prompt, out: &bytes.Buffer{}}
+	require.NoError(t, w.askPorts())
+	require.NoError(t, w.askProxy())
+	assert.Equal(t, installConfig{
+		AdminConsolePort:        30000,
+		LocalArtifactMirrorPort: 50001,
+		HTTPProxy:               "http://proxy:3128",
+		HTTPSProxy:              "http://proxy:3128",
+		NoProxy:                 "10.0.0.0/8",
+	}, w.cfg)
+}
+
+func TestInstallWizardSummary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "install.yaml")
+	prompt := &scriptedPrompt{inputs: []string{path}, confirms: []bool{true, false}}
+	out := &bytes.Buffer{}
+	w := &installWizard{c: newInstallTestContext(t, nil), prompt: prompt, out: out, cfg: installConfig{AdminConsolePort: 30000}}
+	assert.ErrorIs(t, w.summary(), ErrNothingElseToAdd)
+	assert.Contains(t, out.String(), "install --install-config "+path)
+	read, err := readInstallConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, 30000, read.AdminConsolePort)
+}
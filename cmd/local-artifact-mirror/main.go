@@ -21,8 +21,8 @@ func main() {
 	name := path.Base(os.Args[0])
 	var app = &cli.App{
 		Name:     name,
-		Usage:    "Run or pull data for the local artifact mirror",
-		Commands: []*cli.Command{serveCommand, pullCommand},
+		Usage:    "Run, pull data for or inspect the local artifact mirror",
+		Commands: []*cli.Command{serveCommand, pullCommand, statusCommand},
 	}
 	if err := app.RunContext(ctx, os.Args); err != nil {
 		fmt.Println(err)
@@ -8,24 +8,27 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 
 	"github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
 	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
 	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
 	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
 	"github.com/replicatedhq/embedded-cluster/pkg/tgzutils"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
-	"k8s.io/apimachinery/pkg/runtime"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-// These constant define the expected names of the files in the registry.
-const (
-	EmbeddedClusterBinaryArtifactName = "embedded-cluster-amd64"
-	ImagesArtifactName                = "images-amd64.tar"
+// These define the expected names of the files in the registry, the binary and the images
+// are those of the architecture of the node.
+var (
+	EmbeddedClusterBinaryArtifactName = fmt.Sprintf("embedded-cluster-%s", runtime.GOARCH)
+	ImagesArtifactName                = fmt.Sprintf("images-%s.tar", runtime.GOARCH)
 	HelmChartsArtifactName            = "charts.tar.gz"
 )
 
@@ -56,8 +59,8 @@ var imagesCommand = &cli.Command{
 	Usage:     "Pull image artifacts for an airgap installation",
 	UsageText: `embedded-cluster-operator pull images <installation-name>`,
 	Before: func(c *cli.Context) error {
-		if os.Getuid() != 0 {
-			return fmt.Errorf("pull images command must be run as root")
+		if err := privileges.Check("pull images", privileges.Root(), privileges.Capabilities(privileges.CapDACOverride)); err != nil {
+			return err
 		}
 		if len(c.Args().Slice()) != 1 {
 			return fmt.Errorf("expected installation name as argument")
@@ -83,6 +86,9 @@ var imagesCommand = &cli.Command{
 
 		dst := filepath.Join(defaults.EmbeddedClusterImagesSubDir(), ImagesArtifactName)
 		src := filepath.Join(location, ImagesArtifactName)
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			return fmt.Errorf("images artifact does not include images for %s nodes", runtime.GOARCH)
+		}
 		logrus.Infof("%s > %s", src, dst)
 		if err := helpers.MoveFile(src, dst); err != nil {
 			return fmt.Errorf("unable to move images bundle: %w", err)
@@ -102,8 +108,8 @@ var helmChartsCommand = &cli.Command{
 	Usage:     "Pull Helm chart artifacts for an airgap installation",
 	UsageText: `embedded-cluster-operator pull helmcharts <installation-name>`,
 	Before: func(c *cli.Context) error {
-		if os.Getuid() != 0 {
-			return fmt.Errorf("pull helmcharts command must be run as root")
+		if err := privileges.Check("pull helmcharts", privileges.Root(), privileges.Capabilities(privileges.CapDACOverride)); err != nil {
+			return err
 		}
 		if len(c.Args().Slice()) != 1 {
 			return fmt.Errorf("expected installation name as argument")
@@ -148,8 +154,8 @@ var binariesCommand = &cli.Command{
 	Usage:     "Pull binaries artifacts for an airgap installation",
 	UsageText: `embedded-cluster-operator pull binaries <installation-name>`,
 	Before: func(c *cli.Context) error {
-		if os.Getuid() != 0 {
-			return fmt.Errorf("pull binaries command must be run as root")
+		if err := privileges.Check("pull binaries", privileges.Root(), privileges.Capabilities(privileges.CapDACOverride)); err != nil {
+			return err
 		}
 		if len(c.Args().Slice()) != 1 {
 			return fmt.Errorf("expected installation name as argument")
@@ -173,6 +179,9 @@ var binariesCommand = &cli.Command{
 			os.RemoveAll(location)
 		}()
 		bin := filepath.Join(location, EmbeddedClusterBinaryArtifactName)
+		if _, err := os.Stat(bin); os.IsNotExist(err) {
+			return fmt.Errorf("binary artifact does not include a binary for %s nodes", runtime.GOARCH)
+		}
 		namedBin := filepath.Join(location, in.Spec.BinaryName)
 		if err := os.Rename(bin, namedBin); err != nil {
 			return fmt.Errorf("unable to rename binary: %w", err)
@@ -241,7 +250,7 @@ func decodeInstallation(ctx context.Context, data string) (*v1beta1.Installation
 		return nil, fmt.Errorf("base64 decode: %w", err)
 	}
 
-	scheme := runtime.NewScheme()
+	scheme := k8sruntime.NewScheme()
 	err = v1beta1.AddToScheme(scheme)
 	if err != nil {
 		return nil, fmt.Errorf("add to scheme: %w", err)
@@ -12,14 +12,29 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/replicatedhq/embedded-cluster/pkg/artifactmirror"
+	"github.com/replicatedhq/embedded-cluster/pkg/clusterlock"
 	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/privileges"
 	"github.com/urfave/cli/v2"
+	"k8s.io/client-go/tools/clientcmd"
 	k8snet "k8s.io/utils/net"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// maintenanceInterval is how often the artifacts are evicted and the peers refreshed.
+	maintenanceInterval = 5 * time.Minute
+	// kubeletKubeConfig is the kubeconfig of the kubelet on nodes running workloads.
+	kubeletKubeConfig = "/var/lib/k0s/kubelet.conf"
 )
 
 // serveCommand starts a http server that serves files from the /var/lib/embedded-cluster
-// directory. This server listen only on localhost and is used to serve files needed by
-// the autopilot during an upgrade.
+// directory. This server is used to serve files needed by the autopilot during an upgrade.
+// Controllers also serve the artifacts, on their node address, to the other nodes of the
+// cluster and to the nodes joining it, the artifacts missing locally are fetched from them,
+// and hold the cluster lock for the joining controllers.
+// Prometheus metrics are exposed on /metrics.
 var serveCommand = &cli.Command{
 	Name:  "serve",
 	Usage: "Serve /var/lib/embedded-cluster files over HTTP",
@@ -30,19 +45,46 @@ var serveCommand = &cli.Command{
 			Value:   strconv.Itoa(defaults.LocalArtifactMirrorPort),
 			EnvVars: []string{"LOCAL_ARTIFACT_MIRROR_PORT"},
 		},
+		&cli.StringFlag{
+			Name:    "listen-address",
+			Usage:   "Node address to listen on in addition to the loopback address, other nodes fetch artifacts from it",
+			Value:   "127.0.0.1",
+			EnvVars: []string{"LOCAL_ARTIFACT_MIRROR_LISTEN_ADDRESS"},
+		},
+		&cli.StringFlag{
+			Name:    "disk-quota",
+			Usage:   "Maximum disk space used by the artifacts (e.g. 20Gi), only the most recent versions are kept if not set",
+			EnvVars: []string{"LOCAL_ARTIFACT_MIRROR_DISK_QUOTA"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "peers",
+			Usage:   "Addresses (host:port) of the mirrors missing artifacts are fetched from, in addition to the discovered controllers",
+			EnvVars: []string{"LOCAL_ARTIFACT_MIRROR_PEERS"},
+		},
 	},
 	Before: func(c *cli.Context) error {
-		if os.Getuid() != 0 {
-			return fmt.Errorf("serve command must be run as root")
+		if err := privileges.Check("serve", privileges.Root(), privileges.Capabilities(privileges.CapDACOverride)); err != nil {
+			return err
 		}
 		return nil
 	},
 	Action: func(c *cli.Context) error {
-		dir := defaults.EmbeddedClusterHomeDirectory()
-
-		fileServer := http.FileServer(http.Dir(dir))
-		loggedFileServer := logAndFilterRequest(fileServer)
-		http.Handle("/", loggedFileServer)
+		quota, err := artifactmirror.ParseQuota(c.String("disk-quota"))
+		if err != nil {
+			return err
+		}
+		staticPeers := c.StringSlice("peers")
+		mirror := &artifactmirror.Server{
+			Cache:   artifactmirror.Cache{Dir: defaults.EmbeddedClusterHomeDirectory(), Quota: quota},
+			Peers:   artifactmirror.NewPeers(staticPeers),
+			Clients: &artifactmirror.Clients{ValidateToken: validateJoinToken},
+			Logf: func(format string, args ...interface{}) {
+				fmt.Printf(format+"\n", args...)
+			},
+			Metrics:      artifactmirror.NewMetrics(),
+			HoldJoinLock: holdJoinLock,
+		}
+		http.Handle("/", logAndFilterRequest(mirror))
 
 		stop := make(chan os.Signal, 1)
 		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
@@ -61,30 +103,142 @@ var serveCommand = &cli.Command{
 			}
 		}
 
-		addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
-		server := &http.Server{Addr: addr}
-		go func() {
-			fmt.Printf("Starting server on %s\n", addr)
-			if err := server.ListenAndServe(); err != nil {
-				if err != http.ErrServerClosed {
-					panic(err)
+		ctx, cancelMaintenance := context.WithCancel(c.Context)
+		defer cancelMaintenance()
+		go maintainMirror(ctx, mirror, staticPeers, port)
+
+		var servers []*http.Server
+		for _, host := range listenHosts(c.String("listen-address")) {
+			addr := net.JoinHostPort(host, strconv.Itoa(port))
+			server := &http.Server{Addr: addr}
+			servers = append(servers, server)
+			go func() {
+				fmt.Printf("Starting server on %s\n", addr)
+				if err := server.ListenAndServe(); err != nil {
+					if err != http.ErrServerClosed {
+						panic(err)
+					}
 				}
-			}
-		}()
+			}()
+		}
 
 		<-stop
 		fmt.Println("Shutting down server...")
 
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
-		if err := server.Shutdown(ctx); err != nil {
-			panic(err)
+		for _, server := range servers {
+			if err := server.Shutdown(ctx); err != nil {
+				panic(err)
+			}
 		}
 		fmt.Println("Server gracefully stopped")
 		return nil
 	},
 }
 
+// listenHosts returns the addresses the mirror listens on: the loopback address, for the
+// node itself, and the node address other nodes reach the mirror on. The mirror never
+// listens on all addresses, an unspecified address only keeps the loopback one.
+func listenHosts(address string) []string {
+	hosts := []string{"127.0.0.1"}
+	ip := net.ParseIP(address)
+	if ip == nil || ip.IsLoopback() || ip.IsUnspecified() {
+		return hosts
+	}
+	return append(hosts, address)
+}
+
+// maintainMirror evicts the artifacts exceeding the disk quota and refreshes the peers
+// of the mirror with the controllers of the cluster and its clients with the nodes of the
+// cluster, once at start and then every maintenanceInterval.
+func maintainMirror(ctx context.Context, mirror *artifactmirror.Server, staticPeers []string, port int) {
+	ticker := time.NewTicker(maintenanceInterval)
+	defer ticker.Stop()
+	for {
+		if err := mirror.Evict(); err != nil {
+			fmt.Println("Unable to evict artifacts:", err)
+		}
+		if discovered, nodes, err := discoverPeers(ctx, port); err != nil {
+			fmt.Println("Unable to discover peers:", err)
+		} else {
+			mirror.Peers.Set(append(append([]string{}, staticPeers...), discovered...))
+			mirror.Clients.SetNodes(nodes)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// discoverPeers returns the addresses of the mirrors of the other controllers and the
+// addresses of the nodes of the cluster. The cluster is reached with the kubelet
+// credentials, or the admin ones on controllers not running workloads. Nothing is returned
+// before the node joined the cluster.
+func discoverPeers(ctx context.Context, port int) ([]string, []string, error) {
+	cli, err := clusterClient(kubeletKubeConfig, defaults.PathToKubeConfig())
+	if err != nil || cli == nil {
+		return nil, nil, err
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to get hostname: %w", err)
+	}
+	peers, err := artifactmirror.DiscoverPeers(ctx, cli, strings.ToLower(hostname), port)
+	if err != nil {
+		return nil, nil, err
+	}
+	nodes, err := artifactmirror.DiscoverNodes(ctx, cli)
+	if err != nil {
+		return nil, nil, err
+	}
+	return peers, nodes, nil
+}
+
+// validateJoinToken validates the join token of a joining node against the bootstrap
+// tokens of the cluster, only readable with the admin credentials of the controllers.
+func validateJoinToken(ctx context.Context, token string) (bool, error) {
+	cli, err := clusterClient(defaults.PathToKubeConfig())
+	if err != nil || cli == nil {
+		return false, err
+	}
+	return artifactmirror.ValidateJoinToken(ctx, cli, token)
+}
+
+// holdJoinLock holds the cluster lock for a joining controller, with the admin credentials
+// of the controllers.
+func holdJoinLock(ctx context.Context, node string) error {
+	cli, err := clusterClient(defaults.PathToKubeConfig())
+	if err != nil {
+		return err
+	} else if cli == nil {
+		return fmt.Errorf("the cluster lock can only be held by the mirror of a controller")
+	}
+	return clusterlock.Hold(ctx, cli, node, "join")
+}
+
+// clusterClient returns a client to the cluster using the first of the kubeconfigs found
+// on the node, nil if there is none.
+func clusterClient(kubeconfigs ...string) (client.Client, error) {
+	for _, kubeconfig := range kubeconfigs {
+		if _, err := os.Stat(kubeconfig); err != nil {
+			continue
+		}
+		cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read kubeconfig %s: %w", kubeconfig, err)
+		}
+		cli, err := client.New(cfg, client.Options{})
+		if err != nil {
+			return nil, fmt.Errorf("unable to create kube client: %w", err)
+		}
+		return cli, nil
+	}
+	return nil, nil
+}
+
 // startBinaryWatcher starts a loop that observes the binary until its modification
 // time changes. When the modification time changes a SIGTERM is send in the provided
 // channel.
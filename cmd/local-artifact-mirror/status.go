@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/urfave/cli/v2"
+	"k8s.io/apimachinery/pkg/api/resource"
+	k8snet "k8s.io/utils/net"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/artifactmirror"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+)
+
+// statusCommand reports the artifacts kept by the local artifact mirror running on this
+// node, its disk usage and the state of its peers.
+var statusCommand = &cli.Command{
+	Name:  "status",
+	Usage: "Show the artifacts, disk usage and peers of the local artifact mirror",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "port",
+			Usage:   "Port the local artifact mirror listens on",
+			Value:   strconv.Itoa(defaults.LocalArtifactMirrorPort),
+			EnvVars: []string{"LOCAL_ARTIFACT_MIRROR_PORT"},
+		},
+		&cli.StringFlag{
+			Name:  "output",
+			Usage: "Output format, one of table or json",
+			Value: "table",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		port, err := k8snet.ParsePort(c.String("port"), false)
+		if err != nil {
+			return fmt.Errorf("unable to parse port: %w", err)
+		}
+		url := fmt.Sprintf("http://%s%s", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), artifactmirror.StatusPath)
+		hcli := &http.Client{Timeout: 10 * time.Second}
+		resp, err := hcli.Get(url)
+		if err != nil {
+			return fmt.Errorf("unable to reach the local artifact mirror: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("unable to read the local artifact mirror status: %s", resp.Status)
+		}
+		var status artifactmirror.Status
+		if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+			return fmt.Errorf("unable to decode the local artifact mirror status: %w", err)
+		}
+		if c.String("output") == "json" {
+			out, err := json.MarshalIndent(status, "", "  ")
+			if err != nil {
+				return fmt.Errorf("unable to encode status: %w", err)
+			}
+			fmt.Println(string(out))
+			return nil
+		}
+		printStatus(status)
+		return nil
+	},
+}
+
+// printStatus prints the disk usage, the artifacts and the peers of the mirror.
+func printStatus(status artifactmirror.Status) {
+	quota := "most recent versions only"
+	if status.Quota > 0 {
+		quota = bytesString(status.Quota)
+	}
+	fmt.Printf("Disk usage: %s (quota: %s)\n\n", bytesString(status.Usage), quota)
+
+	artifacts := table.NewWriter()
+	artifacts.AppendHeader(table.Row{"artifact", "size", "last used"})
+	for _, artifact := range status.Artifacts {
+		artifacts.AppendRow(table.Row{
+			artifact.Path,
+			bytesString(artifact.Size),
+			artifact.LastUsed.Format(time.RFC3339),
+		})
+	}
+	fmt.Printf("%s\n\n", artifacts.Render())
+
+	if len(status.Peers) == 0 {
+		fmt.Println("No peers, missing artifacts are not fetched from other nodes.")
+		return
+	}
+	peers := table.NewWriter()
+	peers.AppendHeader(table.Row{"peer", "healthy", "last error"})
+	for _, peer := range status.Peers {
+		peers.AppendRow(table.Row{peer.Address, peer.Healthy, peer.LastError})
+	}
+	fmt.Printf("%s\n", peers.Render())
+}
+
+// bytesString returns the size in bytes as a kubernetes quantity.
+func bytesString(size int64) string {
+	return resource.NewQuantity(size, resource.BinarySI).String()
+}
@@ -0,0 +1,59 @@
+package v1beta1
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
+)
+
+// TestAPICompatibility decodes objects written against published versions of the module.
+// Every field must still be known and survive a round trip under the same name, renaming
+// or removing a field breaks the objects already stored in the clusters.
+func TestAPICompatibility(t *testing.T) {
+	for _, tt := range []struct {
+		file string
+		obj  interface{}
+	}{
+		{file: "testdata/compat/config.yaml", obj: &Config{}},
+		{file: "testdata/compat/installation.yaml", obj: &Installation{}},
+	} {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := os.ReadFile(tt.file)
+			require.NoError(t, err)
+			require.NoError(t, yaml.UnmarshalStrict(data, tt.obj), "fields were renamed or removed")
+
+			var want interface{}
+			require.NoError(t, yaml.Unmarshal(data, &want))
+			encoded, err := json.Marshal(tt.obj)
+			require.NoError(t, err)
+			var got interface{}
+			require.NoError(t, json.Unmarshal(encoded, &got))
+			assertSubset(t, "", want, got)
+		})
+	}
+}
+
+// assertSubset asserts every value in want is present in got at the same path.
+func assertSubset(t *testing.T, path string, want, got interface{}) {
+	switch w := want.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		require.True(t, ok, "%s is not an object", path)
+		for key, value := range w {
+			assertSubset(t, path+"."+key, value, g[key])
+		}
+	case []interface{}:
+		g, ok := got.([]interface{})
+		require.True(t, ok, "%s is not a list", path)
+		require.Len(t, g, len(w), "%s", path)
+		for i := range w {
+			assertSubset(t, fmt.Sprintf("%s[%d]", path, i), w[i], g[i])
+		}
+	default:
+		require.Equal(t, want, got, "%s", path)
+	}
+}
@@ -35,6 +35,11 @@ type UnsupportedOverrides struct {
 	// layout inside this configuration is very dynamic we have chosen
 	// to use a string here.
 	K0s string `json:"k0s,omitempty"`
+	// AllowedK0sFields restricts the k0s configuration fields end users can
+	// override with the overrides file, as dotted paths like spec.api.sans. A
+	// path allows the field and everything under it. End users can override
+	// any field when it is empty.
+	AllowedK0sFields []string `json:"allowedK0sFields,omitempty"`
 	// BuiltInExtensions holds overrides for the default add-ons we ship
 	// with Embedded Cluster.
 	BuiltInExtensions []BuiltInExtension `json:"builtInExtensions,omitempty"`
@@ -151,6 +156,165 @@ func ConvertFrom(e k0sv1beta1.HelmExtensions, t *Helm) (*Helm, error) {
 	return t, nil
 }
 
+// ImageVerification holds the configuration used to verify the signatures
+// of all images deployed by Embedded Cluster. Either a public key or a
+// keyless identity must be provided.
+type ImageVerification struct {
+	// PublicKey is a PEM encoded cosign public key used to verify the
+	// image signatures.
+	PublicKey string `json:"publicKey,omitempty"`
+	// Keyless holds the identity expected in the signing certificate
+	// when images have been signed without a key.
+	Keyless *KeylessIdentity `json:"keyless,omitempty"`
+}
+
+// KeylessIdentity identifies the signer of an image signed in keyless mode.
+type KeylessIdentity struct {
+	// Issuer is the OIDC issuer that issued the signing certificate.
+	Issuer string `json:"issuer"`
+	// Subject is the identity (email, URI, etc) bound to the certificate.
+	Subject string `json:"subject"`
+}
+
+// DrainHooks holds the hooks executed around node drains. Drains happen when
+// a node is upgraded or reset. Vendors can use these hooks to quiesce their
+// stateful applications before their pods are evicted.
+type DrainHooks struct {
+	// PreDrain hooks run before a node is drained.
+	PreDrain []DrainHook `json:"preDrain,omitempty"`
+	// PostDrain hooks run after a node has been drained (and upgraded).
+	PostDrain []DrainHook `json:"postDrain,omitempty"`
+}
+
+// DrainHook is a Job executed around a node drain. The name of the node being
+// drained is made available to the job through the EC_NODE_NAME environment
+// variable.
+type DrainHook struct {
+	// Name identifies the hook. Used when naming the Job.
+	Name string `json:"name"`
+	// Namespace where the Job is created.
+	Namespace string `json:"namespace"`
+	// Image used by the Job container.
+	Image string `json:"image"`
+	// Command executed by the Job container.
+	Command []string `json:"command,omitempty"`
+	// ServiceAccountName is the service account used by the Job pod.
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// Timeout is how long to wait for the Job to complete. Defaults to 5m.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// IgnoreFailure allows the drain to proceed even if the Job fails.
+	IgnoreFailure bool `json:"ignoreFailure,omitempty"`
+}
+
+// ReplicatedSDK configures the Replicated SDK addon. When enabled the SDK is
+// deployed next to the application and its version follows the Embedded
+// Cluster release.
+type ReplicatedSDK struct {
+	// Enabled deploys the Replicated SDK.
+	Enabled bool `json:"enabled,omitempty"`
+	// ExposeLicenseFields makes the license fields (entitlements) available
+	// through the SDK API.
+	ExposeLicenseFields bool `json:"exposeLicenseFields,omitempty"`
+}
+
+// Identity configures the identity providers users log in to the Admin Console
+// with. When set users can log in with their own accounts instead of the shared
+// Admin Console password.
+type Identity struct {
+	// DisablePasswordAuth disables the login with the shared Admin Console
+	// password. At least one provider must be configured.
+	DisablePasswordAuth bool `json:"disablePasswordAuth,omitempty"`
+	// Providers are the identity providers users can log in with.
+	Providers []IdentityProvider `json:"providers,omitempty"`
+	// Groups maps identity provider groups to Admin Console roles.
+	Groups []IdentityGroup `json:"groups,omitempty"`
+}
+
+// IdentityProvider is an OIDC or LDAP identity provider.
+type IdentityProvider struct {
+	// Type is the provider type, one of oidc or ldap.
+	// +kubebuilder:validation:Enum=oidc;ldap
+	Type string `json:"type"`
+	// ID uniquely identifies the provider.
+	ID string `json:"id"`
+	// Name is the provider name displayed in the login page.
+	Name string `json:"name,omitempty"`
+	// Config holds the provider configuration, in yaml, using the Dex connector
+	// format for the provider type (e.g. issuer, clientID and clientSecret for
+	// oidc).
+	Config string `json:"config"`
+}
+
+// IdentityGroup assigns Admin Console roles to the members of an identity
+// provider group.
+type IdentityGroup struct {
+	// ID is the group id as reported by the identity provider.
+	ID string `json:"id"`
+	// RoleIDs are the Admin Console roles granted to the group members.
+	RoleIDs []string `json:"roleIds"`
+}
+
+// EtcdMaintenance configures the etcd maintenance performed by the operator on
+// the controller nodes. Members are defragmented, one at a time, when their
+// fragmentation exceeds the threshold.
+type EtcdMaintenance struct {
+	// Disabled disables the etcd maintenance.
+	Disabled bool `json:"disabled,omitempty"`
+	// Interval is the time between maintenance runs. Defaults to 24h.
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// DefragThresholdPercent is the percentage of the database size not in
+	// use above which a member is defragmented. Defaults to 50.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	DefragThresholdPercent int `json:"defragThresholdPercent,omitempty"`
+}
+
+// ImagePull configures how nodes pull images. Values left empty are tuned on each
+// node based on the speed of its network interface.
+type ImagePull struct {
+	// MaxConcurrentDownloads is the number of layers containerd downloads in parallel
+	// for each image.
+	// +kubebuilder:validation:Minimum=1
+	MaxConcurrentDownloads int `json:"maxConcurrentDownloads,omitempty"`
+	// RegistryPullQPS is the number of image pulls per second the kubelet issues to
+	// the registries.
+	// +kubebuilder:validation:Minimum=1
+	RegistryPullQPS int `json:"registryPullQPS,omitempty"`
+	// RegistryBurst is the number of image pulls the kubelet issues in a burst, above
+	// the RegistryPullQPS rate. It can't be lower than RegistryPullQPS.
+	// +kubebuilder:validation:Minimum=1
+	RegistryBurst int `json:"registryBurst,omitempty"`
+}
+
+// HostBackup declares the host paths included in and excluded from the disaster
+// recovery backups. Paths are backed up from every node by the host backup agent.
+type HostBackup struct {
+	// Include is the list of host paths, files or directories, to back up. Glob
+	// patterns are supported.
+	Include []string `json:"include,omitempty"`
+	// Exclude is the list of host paths not to back up, even if they are part of an
+	// included directory. Glob patterns are supported.
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// Placement pins the admin console and the registry to a subset of the nodes, for
+// instance the nodes with fast local disks or exposed on the management network.
+type Placement struct {
+	// AdminConsole selects the nodes the admin console runs on.
+	AdminConsole *NodePlacement `json:"adminConsole,omitempty"`
+	// Registry selects the nodes the embedded registry of airgap installations runs on.
+	Registry *NodePlacement `json:"registry,omitempty"`
+}
+
+// NodePlacement selects nodes by name, by labels or both. Nodes must match both when
+// both are set.
+type NodePlacement struct {
+	// Nodes is the list of names of the nodes.
+	Nodes []string `json:"nodes,omitempty"`
+	// NodeSelector holds the labels the nodes must have.
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+}
+
 // ConfigSpec defines the desired state of Config
 type ConfigSpec struct {
 	Version              string               `json:"version,omitempty"`
@@ -159,6 +323,117 @@ type ConfigSpec struct {
 	Roles                Roles                `json:"roles,omitempty"`
 	UnsupportedOverrides UnsupportedOverrides `json:"unsupportedOverrides,omitempty"`
 	Extensions           Extensions           `json:"extensions,omitempty"`
+	ImageVerification    *ImageVerification   `json:"imageVerification,omitempty"`
+	DrainHooks           *DrainHooks          `json:"drainHooks,omitempty"`
+	ReplicatedSDK        *ReplicatedSDK       `json:"replicatedSDK,omitempty"`
+	Identity             *Identity            `json:"identity,omitempty"`
+	EtcdMaintenance      *EtcdMaintenance     `json:"etcdMaintenance,omitempty"`
+	ImagePull            *ImagePull           `json:"imagePull,omitempty"`
+	HostBackup           *HostBackup          `json:"hostBackup,omitempty"`
+	Placement            *Placement           `json:"placement,omitempty"`
+	CPU                  *CPURequirements     `json:"cpu,omitempty"`
+	Conntrack            *Conntrack           `json:"conntrack,omitempty"`
+	Webhooks             []Webhook            `json:"webhooks,omitempty"`
+	Watchdog             *Watchdog            `json:"watchdog,omitempty"`
+	Components           *K0sComponents       `json:"components,omitempty"`
+}
+
+// K0sComponents toggles the optional k0s components. Components not set are enabled.
+type K0sComponents struct {
+	// MetricsServer deploys the metrics server, serving the resource metrics of the pods
+	// and nodes.
+	MetricsServer *bool `json:"metricsServer,omitempty"`
+	// KubeProxy deploys kube-proxy. It can only be disabled when the network provider set
+	// through the unsupported overrides replaces it.
+	KubeProxy *bool `json:"kubeProxy,omitempty"`
+	// Autopilot runs the k0s autopilot controller. Kubernetes can not be upgraded with
+	// autopilot disabled.
+	Autopilot *bool `json:"autopilot,omitempty"`
+}
+
+// CPURequirements holds the CPU features the application needs. They are checked by the
+// host preflights so hosts lacking them fail before the installation instead of the
+// application crashing with an illegal instruction at runtime.
+type CPURequirements struct {
+	// Microarchitecture is the minimum x86-64 microarchitecture level required on amd64
+	// hosts. All releases require x86-64-v2.
+	// +kubebuilder:validation:Enum=x86-64-v2;x86-64-v3;x86-64-v4
+	Microarchitecture string `json:"microarchitecture,omitempty"`
+	// AMD64Features are the CPU flags, as listed in /proc/cpuinfo, required on amd64 hosts,
+	// avx2 or aes for instance.
+	AMD64Features []string `json:"amd64Features,omitempty"`
+	// ARM64Features are the CPU features, as listed in /proc/cpuinfo, required on arm64
+	// hosts, aes, pmull or sha2 for instance.
+	ARM64Features []string `json:"arm64Features,omitempty"`
+}
+
+// Conntrack sizes the connection tracking table of the nodes. Once the table is full the
+// kernel drops the packets of new connections, which shows up as intermittent timeouts.
+// Nodes left with the defaults get the kube-proxy sizing.
+type Conntrack struct {
+	// Profile is the expected workload of the nodes. "high" fits applications holding
+	// many short lived or long lived connections, proxies or message brokers for instance.
+	// +kubebuilder:validation:Enum=standard;high
+	Profile string `json:"profile,omitempty"`
+	// Max is the number of entries of the table, it takes precedence over the profile.
+	// +kubebuilder:validation:Minimum=65536
+	Max int64 `json:"max,omitempty"`
+}
+
+// Webhook is an endpoint of the vendor the operator posts the lifecycle events of the
+// cluster to. Deliveries go through the proxy of the cluster and are retried when they
+// fail.
+type Webhook struct {
+	// Name identifies the webhook in the logs and events.
+	Name string `json:"name"`
+	// URL the events are posted to.
+	// +kubebuilder:validation:Pattern=`^https?://`
+	URL string `json:"url"`
+	// Events the webhook is notified of, all of them when empty.
+	// +kubebuilder:validation:items:Enum=Installed;Upgraded;NodeAdded;NodeRemoved;BackupCompleted
+	Events []string `json:"events,omitempty"`
+	// Secret is the key the requests are signed with. The unix time of the request is sent
+	// in the X-Embedded-Cluster-Timestamp header and the hex encoded HMAC-SHA256 of the
+	// timestamp and the body joined by a dot in the X-Embedded-Cluster-Signature header.
+	// Requests are not signed when empty.
+	Secret string `json:"secret,omitempty"`
+}
+
+// Watchdog arms the hardware watchdog of the nodes and checks the health of k0s every
+// minute, so a wedged node, a single node appliance in particular, recovers without an
+// operator on site. Recoveries are recorded in the events of the installation and
+// reported to the vendor once the node is healthy again.
+type Watchdog struct {
+	// Enabled arms the watchdog on the nodes.
+	Enabled bool `json:"enabled,omitempty"`
+	// RuntimeTimeout is how long the hardware watchdog waits for systemd before it resets
+	// the host. Defaults to 2m.
+	RuntimeTimeout *metav1.Duration `json:"runtimeTimeout,omitempty"`
+	// FailureThreshold is the number of consecutive failed health checks after which k0s
+	// is restarted. The host is rebooted if k0s is still unhealthy after as many checks
+	// again. Defaults to 5.
+	// +kubebuilder:validation:Minimum=1
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+}
+
+// MetricsServerEnabled returns true unless the metrics server has been disabled.
+func (c *ConfigSpec) MetricsServerEnabled() bool {
+	return c == nil || c.Components == nil || c.Components.MetricsServer == nil || *c.Components.MetricsServer
+}
+
+// KubeProxyEnabled returns true unless kube-proxy has been disabled.
+func (c *ConfigSpec) KubeProxyEnabled() bool {
+	return c == nil || c.Components == nil || c.Components.KubeProxy == nil || *c.Components.KubeProxy
+}
+
+// AutopilotEnabled returns true unless autopilot has been disabled.
+func (c *ConfigSpec) AutopilotEnabled() bool {
+	return c == nil || c.Components == nil || c.Components.Autopilot == nil || *c.Components.Autopilot
+}
+
+// ReplicatedSDKEnabled returns true if the Replicated SDK addon has been enabled.
+func (c *ConfigSpec) ReplicatedSDKEnabled() bool {
+	return c != nil && c.ReplicatedSDK != nil && c.ReplicatedSDK.Enabled
 }
 
 // OverrideForBuiltIn returns the override for the built-in extension with the
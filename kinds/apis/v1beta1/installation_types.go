@@ -45,6 +45,10 @@ const (
 // that holds the embedded cluster configuration.
 const ConfigSecretEntryName = "config.yaml"
 
+// RegistryMirrorsSecretName holds the name of the secret, in the embedded cluster
+// namespace, that holds the passwords of the registry mirror endpoints.
+const RegistryMirrorsSecretName = "registry-mirror-credentials"
+
 // NodeStatus is used to keep track of the status of a cluster node, we
 // only hold its name and a hash of the node's status. Whenever the node
 // status change we will be able to capture it and update the hash.
@@ -81,16 +85,117 @@ type NetworkSpec struct {
 	NodePortRange string `json:"nodePortRange,omitempty"`
 }
 
+// Admin console authentication modes.
+const (
+	// AdminConsoleAuthModePassword authenticates users with a shared password.
+	AdminConsoleAuthModePassword string = "password"
+	// AdminConsoleAuthModeIdentityProvider authenticates users with the identity
+	// providers configured in the embedded cluster config. Password login is disabled.
+	AdminConsoleAuthModeIdentityProvider string = "identity-provider"
+	// AdminConsoleAuthModeDisabled does not expose the admin console UI.
+	AdminConsoleAuthModeDisabled string = "disabled"
+)
+
 // AdminConsoleSpec holds the admin console configuration.
 type AdminConsoleSpec struct {
 	// Port holds the port on which the admin console will be served.
 	Port int `json:"port,omitempty"`
+	// AuthMode holds how users authenticate to the admin console. Defaults to
+	// password when empty.
+	// +kubebuilder:validation:Enum=password;identity-provider;disabled
+	AuthMode string `json:"authMode,omitempty"`
+}
+
+// GetAuthMode returns the admin console authentication mode, defaulting to password.
+func (a *AdminConsoleSpec) GetAuthMode() string {
+	if a == nil || a.AuthMode == "" {
+		return AdminConsoleAuthModePassword
+	}
+	return a.AuthMode
 }
 
 // LocalArtifactMirrorSpec holds the local artifact mirror configuration.
 type LocalArtifactMirrorSpec struct {
 	// Port holds the port on which the local artifact mirror will be served.
 	Port int `json:"port,omitempty"`
+	// DiskQuota is the maximum disk space, e.g. 20Gi, used by the artifacts kept by the
+	// local artifact mirror. The least recently used versions of the artifacts are removed
+	// when it is exceeded. Only the most recent versions are kept when it is not set.
+	DiskQuota string `json:"diskQuota,omitempty"`
+}
+
+// StorageSpec places and sizes the storage of the cluster.
+type StorageSpec struct {
+	// OpenEBSDataDir is the directory, on every node, where the OpenEBS local provisioner
+	// stores the persistent volumes. It can be the mount point of a separate filesystem.
+	// Defaults to /var/openebs.
+	OpenEBSDataDir string `json:"openEBSDataDir,omitempty"`
+	// OpenEBSReservation is the free space, e.g. 100Gi, required for the persistent volumes
+	// on the filesystem of the OpenEBS data directory of every node.
+	OpenEBSReservation string `json:"openEBSReservation,omitempty"`
+	// RegistryStorageSize is the size, e.g. 50Gi, of the volume holding the images of the
+	// embedded registry in air gap installations. Defaults to 10Gi.
+	RegistryStorageSize string `json:"registryStorageSize,omitempty"`
+}
+
+// RegistryMirror configures the mirrors, or pull-through caches, containerd pulls the
+// images of a registry through.
+type RegistryMirror struct {
+	// Registry is the host, with an optional port, of the mirrored registry. "docker.io"
+	// for instance, "_default" applies to registries without their own configuration.
+	Registry string `json:"registry"`
+	// Endpoints are the mirrors, tried in order before the registry itself.
+	// +kubebuilder:validation:MinItems=1
+	Endpoints []RegistryMirrorEndpoint `json:"endpoints"`
+}
+
+// RegistryMirrorEndpoint is a mirror of a registry.
+type RegistryMirrorEndpoint struct {
+	// URL is the mirror url, "https://harbor.example.com" for instance. A path is prepended
+	// to the registry api paths, mirrors serving several registries usually need one.
+	URL string `json:"url"`
+	// Username and Password are the basic authentication credentials for the mirror. The
+	// password is only provided in the install config file, installations keep it in the
+	// registry mirrors secret instead.
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// PasswordSecretKey is the entry holding the password in the registry mirrors secret.
+	PasswordSecretKey string `json:"passwordSecretKey,omitempty"`
+	// CA is the PEM encoded certificate authority the mirror certificate is verified
+	// against, the system certificate authorities are used when empty.
+	CA string `json:"ca,omitempty"`
+	// InsecureSkipVerify disables the verification of the mirror certificate.
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+// ImagePullSecret is a registry credential the operator copies to namespaces so their pods
+// can pull images from a private registry. The credential itself is kept in a secret of the
+// embedded cluster namespace, named after it with the image-pull-secret- prefix.
+type ImagePullSecret struct {
+	// Name is the name of the copies of the secret in the target namespaces.
+	Name string `json:"name"`
+	// Namespaces are the namespaces the secret is copied to, "*" copies it to every
+	// namespace but kube-system, kube-public and kube-node-lease, which must be listed
+	// explicitly. Namespaces created later get the secret as well. Copies in namespaces
+	// no longer listed are deleted.
+	// +kubebuilder:validation:MinItems=1
+	Namespaces []string `json:"namespaces"`
+	// ServiceAccounts are the service accounts, in the target namespaces, the secret is
+	// added to the image pull secrets of. Pods running with other service accounts must
+	// reference the secret themselves.
+	ServiceAccounts []string `json:"serviceAccounts,omitempty"`
+}
+
+// PrestageSpec configures the download of the artifacts of the next release ahead of its
+// upgrade so the upgrade itself does not wait on them. Only online installations prestage.
+type PrestageSpec struct {
+	// Version is the embedded cluster version whose artifacts are downloaded, set once an
+	// update is available. Nothing is downloaded when empty.
+	Version string `json:"version,omitempty"`
+	// Window restricts when the downloads start to a daily window in UTC, in the
+	// HH:MM-HH:MM format (e.g. 22:00-06:00). Downloads start at any time when empty.
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]-([01][0-9]|2[0-3]):[0-5][0-9]$`
+	Window string `json:"window,omitempty"`
 }
 
 // LicenseInfo holds information about the license used to install the cluster.
@@ -116,6 +221,23 @@ type InstallationSpec struct {
 	HighAvailability bool `json:"highAvailability,omitempty"`
 	// AirGap indicates if the installation is airgapped.
 	AirGap bool `json:"airGap,omitempty"`
+	// AirgapRegistry holds the address, host and optional namespace, of the registry the
+	// images of an airgap installation are pushed to instead of the embedded registry.
+	AirgapRegistry string `json:"airgapRegistry,omitempty"`
+	// FIPS indicates if the installation runs in FIPS mode. Nodes joining
+	// the cluster must also run a FIPS build on a FIPS enabled kernel.
+	FIPS bool `json:"fips,omitempty"`
+	// Hardening holds the hardening profile (e.g. cis) applied to the
+	// cluster. Nodes joining the cluster apply the same profile.
+	Hardening string `json:"hardening,omitempty"`
+	// EncryptionAtRest indicates if secrets are encrypted at rest. Controllers
+	// joining the cluster must be provided with the encryption configuration
+	// of an existing controller.
+	EncryptionAtRest bool `json:"encryptionAtRest,omitempty"`
+	// ExcludedHostCollectors holds the host collectors, by type or collector name,
+	// excluded from host preflights and support bundles. Nodes joining the cluster
+	// exclude the same collectors.
+	ExcludedHostCollectors []string `json:"excludedHostCollectors,omitempty"`
 	// Artifacts holds the location of the airgap bundle.
 	Artifacts *ArtifactsLocation `json:"artifacts,omitempty"`
 	// Proxy holds the proxy configuration.
@@ -126,14 +248,37 @@ type InstallationSpec struct {
 	AdminConsole *AdminConsoleSpec `json:"adminConsole,omitempty"`
 	// LocalArtifactMirrorPort holds the local artifact mirror configuration.
 	LocalArtifactMirror *LocalArtifactMirrorSpec `json:"localArtifactMirror,omitempty"`
+	// Storage holds where the persistent volumes are stored on the nodes and the space
+	// reserved for them, as chosen at installation time.
+	Storage *StorageSpec `json:"storage,omitempty"`
+	// RegistryMirrors holds the registry mirrors containerd pulls images through on
+	// every node. Nodes joining the cluster use the same mirrors.
+	RegistryMirrors []RegistryMirror `json:"registryMirrors,omitempty"`
+	// ImagePullSecrets holds the registry credentials copied to the namespaces of the
+	// application, needed when some of its images are pulled from a private registry.
+	ImagePullSecrets []ImagePullSecret `json:"imagePullSecrets,omitempty"`
+	// Prestage holds the configuration of the download of the next release artifacts.
+	Prestage *PrestageSpec `json:"prestage,omitempty"`
+	// OverriddenPreflightWarnings holds the titles of the host preflight warnings the
+	// user chose to proceed past at installation time.
+	OverriddenPreflightWarnings []string `json:"overriddenPreflightWarnings,omitempty"`
 	// Config holds the configuration used at installation time.
 	Config *ConfigSpec `json:"config,omitempty"`
 	// EndUserK0sConfigOverrides holds the end user k0s config overrides
 	// used at installation time.
 	EndUserK0sConfigOverrides string `json:"endUserK0sConfigOverrides,omitempty"`
+	// EndUserHostBackup holds the end user host backup rules used at
+	// installation time. They are merged with the ones in Config.
+	EndUserHostBackup *HostBackup `json:"endUserHostBackup,omitempty"`
+	// EndUserPlacement holds the end user admin console and registry placement used
+	// at installation time.
+	EndUserPlacement *Placement `json:"endUserPlacement,omitempty"`
 	// BinaryName holds the name of the binary used to install the cluster.
 	// this will follow the pattern 'appslug-channelslug'
 	BinaryName string `json:"binaryName,omitempty"`
+	// Architecture holds the cpu architecture of the node the cluster was installed on.
+	// Nodes of other architectures can only join if the images of the cluster support it.
+	Architecture string `json:"architecture,omitempty"`
 	// LicenseInfo holds information about the license used to install the cluster.
 	LicenseInfo *LicenseInfo `json:"licenseInfo,omitempty"`
 	// ConfigSecret holds a secret name and namespace. If this is set it means that
@@ -163,6 +308,71 @@ func (i *InstallationSpec) ParseConfigSpecFromSecret(secret corev1.Secret) error
 	return nil
 }
 
+// ExtractRegistryMirrorPasswords moves the passwords of the registry mirror endpoints out
+// of the spec and returns them keyed by the entry the endpoints now reference. The mirrors
+// are copied, the ones the spec was built from keep their passwords.
+func (i *InstallationSpec) ExtractRegistryMirrorPasswords() map[string][]byte {
+	passwords := map[string][]byte{}
+	mirrors := make([]RegistryMirror, len(i.RegistryMirrors))
+	for m := range i.RegistryMirrors {
+		mirror := i.RegistryMirrors[m].DeepCopy()
+		for e := range mirror.Endpoints {
+			endpoint := &mirror.Endpoints[e]
+			if endpoint.Password == "" {
+				continue
+			}
+			key := fmt.Sprintf("mirror-%d-endpoint-%d", m, e)
+			passwords[key] = []byte(endpoint.Password)
+			endpoint.Password, endpoint.PasswordSecretKey = "", key
+		}
+		mirrors[m] = *mirror
+	}
+	i.RegistryMirrors = mirrors
+	return passwords
+}
+
+// HasRegistryMirrorPasswords returns true if a registry mirror endpoint references a
+// password in the registry mirrors secret.
+func (i *InstallationSpec) HasRegistryMirrorPasswords() bool {
+	for _, mirror := range i.RegistryMirrors {
+		for _, endpoint := range mirror.Endpoints {
+			if endpoint.PasswordSecretKey != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParseRegistryMirrorPasswordsFromSecret reads the passwords of the registry mirror
+// endpoints from the registry mirrors secret. This function overrides the RegistryMirrors
+// field in the InstallationSpec but does not save it to the cluster.
+func (i *InstallationSpec) ParseRegistryMirrorPasswordsFromSecret(secret corev1.Secret) error {
+	mirrors := make([]RegistryMirror, len(i.RegistryMirrors))
+	for m := range i.RegistryMirrors {
+		mirror := i.RegistryMirrors[m].DeepCopy()
+		for e := range mirror.Endpoints {
+			endpoint := &mirror.Endpoints[e]
+			if endpoint.PasswordSecretKey == "" {
+				continue
+			}
+			data, ok := secret.Data[endpoint.PasswordSecretKey]
+			if !ok {
+				return fmt.Errorf(
+					"entry %s not found in secret %s/%s",
+					endpoint.PasswordSecretKey,
+					secret.Namespace,
+					secret.Name,
+				)
+			}
+			endpoint.Password = string(data)
+		}
+		mirrors[m] = *mirror
+	}
+	i.RegistryMirrors = mirrors
+	return nil
+}
+
 // InstallationStatus defines the observed state of Installation
 type InstallationStatus struct {
 	// NodesStatus is a list of nodes and their status.
@@ -173,6 +383,9 @@ type InstallationStatus struct {
 	Reason string `json:"reason,omitempty"`
 	// PendingCharts holds the list of charts that are being created or updated.
 	PendingCharts []string `json:"pendingCharts,omitempty"`
+	// Storage holds the capabilities of the default storage class, validated once the
+	// installation finished.
+	Storage *StorageCapabilities `json:"storage,omitempty"`
 
 	// Conditions is an array of current observed installation conditions.
 	// +listType=map
@@ -183,6 +396,23 @@ type InstallationStatus struct {
 	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
 }
 
+// StorageCapabilities holds what the default storage class was validated to support by
+// exercising each capability. The vendor application can rely on these flags.
+type StorageCapabilities struct {
+	// StorageClass is the name of the default storage class.
+	StorageClass string `json:"storageClass,omitempty"`
+	// Provisioning is true if a volume could be provisioned and mounted.
+	Provisioning bool `json:"provisioning"`
+	// Expansion is true if a provisioned volume could be resized.
+	Expansion bool `json:"expansion"`
+	// Snapshots is true if a snapshot of a provisioned volume could be taken.
+	Snapshots bool `json:"snapshots"`
+	// Reason explains why the capabilities not supported failed validation.
+	Reason string `json:"reason,omitempty"`
+	// CheckedAt is when the validation ran.
+	CheckedAt metav1.Time `json:"checkedAt,omitempty"`
+}
+
 // SetState sets the installation state and reason.
 func (s *InstallationStatus) SetState(state string, reason string, pendingCharts []string) {
 	s.State = state
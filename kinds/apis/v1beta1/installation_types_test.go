@@ -35,3 +35,33 @@ func TestParseConfigSpecFromSecret(t *testing.T) {
 		})
 	}
 }
+
+func TestRegistryMirrorPasswords(t *testing.T) {
+	mirrors := []RegistryMirror{
+		{
+			Registry: "docker.io",
+			Endpoints: []RegistryMirrorEndpoint{
+				{URL: "https://harbor.example.com", Username: "user", Password: "secret"},
+				{URL: "https://cache.example.com"},
+			},
+		},
+	}
+	spec := InstallationSpec{RegistryMirrors: mirrors}
+	require.False(t, spec.HasRegistryMirrorPasswords())
+
+	passwords := spec.ExtractRegistryMirrorPasswords()
+	require.Equal(t, map[string][]byte{"mirror-0-endpoint-0": []byte("secret")}, passwords)
+	require.Equal(t, "", spec.RegistryMirrors[0].Endpoints[0].Password)
+	require.Equal(t, "mirror-0-endpoint-0", spec.RegistryMirrors[0].Endpoints[0].PasswordSecretKey)
+	require.Equal(t, "secret", mirrors[0].Endpoints[0].Password, "the original mirrors are left untouched")
+	require.True(t, spec.HasRegistryMirrorPasswords())
+
+	secret := v1.Secret{Data: passwords}
+	secret.Name, secret.Namespace = RegistryMirrorsSecretName, "embedded-cluster"
+	require.NoError(t, spec.ParseRegistryMirrorPasswordsFromSecret(secret))
+	require.Equal(t, "secret", spec.RegistryMirrors[0].Endpoints[0].Password)
+	require.Equal(t, "", spec.RegistryMirrors[0].Endpoints[1].Password)
+
+	err := spec.ParseRegistryMirrorPasswordsFromSecret(v1.Secret{})
+	require.ErrorContains(t, err, "entry mirror-0-endpoint-0 not found")
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NodeConfigSpec defines the kubelet settings of a set of nodes. The operator does not
+// restart the nodes, node apply-config must be run on each of the selected nodes, one node
+// at a time, to drain it and restart it with the settings. The Applied condition lists the
+// nodes still to be restarted.
+type NodeConfigSpec struct {
+	// NodeSelector selects the nodes the configuration applies to by their labels. An
+	// empty selector selects every node.
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Kubelet holds the kubelet settings overridden on the selected nodes.
+	Kubelet KubeletOverrides `json:"kubelet"`
+}
+
+// KubeletOverrides holds the kubelet settings that can be overridden per node. The
+// settings not set keep the values of the cluster.
+type KubeletOverrides struct {
+	// MaxPods is the number of pods that can run on the node.
+	// +kubebuilder:validation:Minimum=1
+	MaxPods *int32 `json:"maxPods,omitempty"`
+	// EvictionHard is a map of signal names to quantities that defines hard eviction
+	// thresholds, for example {"memory.available": "300Mi"}.
+	EvictionHard map[string]string `json:"evictionHard,omitempty"`
+	// EvictionSoft is a map of signal names to quantities that defines soft eviction
+	// thresholds.
+	EvictionSoft map[string]string `json:"evictionSoft,omitempty"`
+	// EvictionSoftGracePeriod is a map of signal names to the durations a soft eviction
+	// threshold must be held for before evicting pods.
+	EvictionSoftGracePeriod map[string]string `json:"evictionSoftGracePeriod,omitempty"`
+	// TopologyManagerPolicy is the topology manager policy of the node.
+	// +kubebuilder:validation:Enum=none;best-effort;restricted;single-numa-node
+	TopologyManagerPolicy string `json:"topologyManagerPolicy,omitempty"`
+}
+
+// NodeConfigStatus defines the observed state of NodeConfig
+type NodeConfigStatus struct {
+	// Profile is the name of the k0s worker profile the configuration is rendered to.
+	Profile string `json:"profile,omitempty"`
+	// Hash identifies the rendered configuration, nodes record the hash they run with.
+	Hash string `json:"hash,omitempty"`
+	// Nodes lists the nodes selected by the configuration.
+	Nodes []NodeConfigNodeStatus `json:"nodes,omitempty"`
+
+	// Conditions is an array of current observed node configuration conditions.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// NodeConfigNodeStatus reports if a selected node runs with the configuration.
+type NodeConfigNodeStatus struct {
+	// Name is the name of the node.
+	Name string `json:"name"`
+	// Applied is true once the node has been restarted with the configuration.
+	Applied bool `json:"applied"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Profile",type="string",JSONPath=".status.profile",description="Worker profile of the configuration"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="Age of the resource"
+
+// NodeConfig is the Schema for the nodeconfigs API
+type NodeConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   NodeConfigSpec   `json:"spec,omitempty"`
+	Status NodeConfigStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// NodeConfigList contains a list of NodeConfig
+type NodeConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NodeConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&NodeConfig{}, &NodeConfigList{})
+}
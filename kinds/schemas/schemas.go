@@ -0,0 +1,12 @@
+// Package schemas holds the JSON schemas of the kinds vendors write by hand, generated
+// from the custom resource definitions by `make -C operator schemas`.
+package schemas
+
+import (
+	_ "embed"
+)
+
+// ConfigV1Beta1 is the JSON schema of the embeddedcluster.replicated.com/v1beta1 Config.
+//
+//go:embed config-embeddedcluster-v1beta1.json
+var ConfigV1Beta1 []byte
@@ -0,0 +1,18 @@
+package schemas
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigV1Beta1(t *testing.T) {
+	var schema struct {
+		Type       string                     `json:"type"`
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	require.NoError(t, json.Unmarshal(ConfigV1Beta1, &schema))
+	require.Equal(t, "object", schema.Type)
+	require.Contains(t, schema.Properties, "spec")
+}
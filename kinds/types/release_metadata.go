@@ -17,6 +17,7 @@ type ReleaseMetadata struct {
 	Configs        v1beta1.Helm            // always applied
 	BuiltinConfigs map[string]v1beta1.Helm // applied if the relevant builtin addon is enabled
 	Protected      map[string][]string
+	SupportedOS    []SupportedOS // operating systems the release can be installed on
 
 	// Deprecated: AirgapConfigs exists for historical compatibility and should not
 	// be used. This field has been replaced by the BuiltinConfigs field.
@@ -0,0 +1,17 @@
+package types
+
+// SupportedOS is an operating system release the cluster can be installed on.
+type SupportedOS struct {
+	// ID is the distribution identifier as found in the ID field of /etc/os-release.
+	ID string `json:"id"`
+	// Name is the distribution name shown to users.
+	Name string `json:"name"`
+	// MinVersion is the oldest supported release, as found in the VERSION_ID field.
+	MinVersion string `json:"minVersion"`
+	// MaxVersion is the newest supported release. Empty means there is no upper bound.
+	MaxVersion string `json:"maxVersion,omitempty"`
+	// MinKernel is the oldest supported kernel version.
+	MinKernel string `json:"minKernel,omitempty"`
+	// CgroupVersions holds the supported cgroup versions. Empty means all of them.
+	CgroupVersions []int `json:"cgroupVersions,omitempty"`
+}
@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/pullsecrets"
+)
+
+// ImagePullSecretReconciler copies the registry credentials provided by the end user from
+// the embedded cluster namespace to the namespaces they target, and adds them to the image
+// pull secrets of the target service accounts. Namespaces and service accounts created
+// after the installation get them as well. Copies no image pull secret of the installation
+// selects anymore are deleted. Secrets with the same name not created by the operator are
+// left untouched. Only the secrets of the embedded cluster namespace are cached, the copies
+// are read from the api.
+type ImagePullSecretReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;create;update;delete
+//+kubebuilder:rbac:groups="",namespace=embedded-cluster,resources=secrets,verbs=list;watch
+//+kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch;patch
+
+// Reconcile copies the image pull secrets targeting the namespace and deletes the copies
+// no longer targeting it.
+func (r *ImagePullSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	var ns corev1.Namespace
+	if err := r.Get(ctx, req.NamespacedName, &ns); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if ns.DeletionTimestamp != nil || ns.Name == ecNamespace {
+		return ctrl.Result{}, nil
+	}
+	in, err := kubeutils.GetLatestInstallation(ctx, r.Client)
+	if errors.As(err, &kubeutils.ErrNoInstallations{}) {
+		return ctrl.Result{}, nil
+	} else if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to get latest installation: %w", err)
+	}
+	for _, spec := range in.Spec.ImagePullSecrets {
+		if !pullsecrets.Selects(spec, ns.Name) {
+			continue
+		}
+		if err := r.reconcileImagePullSecret(ctx, spec, ns.Name); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if err := r.deleteUnselected(ctx, in.Spec.ImagePullSecrets, ns.Name); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// deleteUnselected deletes the copies in the namespace of the image pull secrets removed
+// from the installation or no longer targeting the namespace, and removes them from the
+// image pull secrets of the service accounts of the namespace.
+func (r *ImagePullSecretReconciler) deleteUnselected(ctx context.Context, specs []v1beta1.ImagePullSecret, namespace string) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	var secrets corev1.SecretList
+	if err := r.List(ctx, &secrets, client.InNamespace(namespace), client.MatchingLabels{pullsecrets.ManagedLabel: "true"}); err != nil {
+		return fmt.Errorf("failed to list image pull secrets in %s: %w", namespace, err)
+	}
+	var deleted []string
+	for _, secret := range secrets.Items {
+		selected := slices.ContainsFunc(specs, func(spec v1beta1.ImagePullSecret) bool {
+			return spec.Name == secret.Name && pullsecrets.Selects(spec, namespace)
+		})
+		if selected {
+			continue
+		}
+		if err := r.Delete(ctx, &secret); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to delete image pull secret %s/%s: %w", namespace, secret.Name, err)
+		}
+		log.Info("Image pull secret deleted", "namespace", namespace, "secret", secret.Name)
+		deleted = append(deleted, secret.Name)
+	}
+	if len(deleted) == 0 {
+		return nil
+	}
+
+	var accounts corev1.ServiceAccountList
+	if err := r.List(ctx, &accounts, client.InNamespace(namespace)); err != nil {
+		return fmt.Errorf("failed to list service accounts in %s: %w", namespace, err)
+	}
+	for _, sa := range accounts.Items {
+		patch := client.MergeFrom(sa.DeepCopy())
+		changed := false
+		for _, name := range deleted {
+			if pullsecrets.RemoveFromServiceAccount(&sa, name) {
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		if err := r.Patch(ctx, &sa, patch); err != nil {
+			return fmt.Errorf("failed to remove image pull secrets from service account %s/%s: %w", namespace, sa.Name, err)
+		}
+		log.Info("Image pull secrets removed from service account", "namespace", namespace, "serviceaccount", sa.Name, "secrets", deleted)
+	}
+	return nil
+}
+
+// reconcileImagePullSecret copies the source secret to the namespace and adds it to the
+// target service accounts existing in the namespace.
+func (r *ImagePullSecretReconciler) reconcileImagePullSecret(ctx context.Context, spec v1beta1.ImagePullSecret, namespace string) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	var source corev1.Secret
+	sourceName := pullsecrets.SourceName(spec.Name)
+	if err := r.Get(ctx, client.ObjectKey{Namespace: ecNamespace, Name: sourceName}, &source); err != nil {
+		if k8serrors.IsNotFound(err) {
+			log.Info("Image pull secret source not found", "secret", sourceName)
+			return nil
+		}
+		return fmt.Errorf("failed to get image pull secret %s: %w", sourceName, err)
+	}
+
+	desired := pullsecrets.Copy(source, spec.Name, namespace)
+	var existing corev1.Secret
+	err := r.Get(ctx, client.ObjectKeyFromObject(desired), &existing)
+	switch {
+	case k8serrors.IsNotFound(err):
+		if err := r.Create(ctx, desired); err != nil {
+			return fmt.Errorf("failed to create image pull secret %s/%s: %w", namespace, spec.Name, err)
+		}
+		log.Info("Image pull secret created", "namespace", namespace, "secret", spec.Name)
+	case err != nil:
+		return fmt.Errorf("failed to get image pull secret %s/%s: %w", namespace, spec.Name, err)
+	case existing.Labels[pullsecrets.ManagedLabel] != "true":
+		log.Info("Secret not managed by the operator, not overwritten", "namespace", namespace, "secret", spec.Name)
+	case existing.Type != desired.Type || !secretDataEqual(existing.Data, desired.Data):
+		existing.Type = desired.Type
+		existing.Data = desired.Data
+		if err := r.Update(ctx, &existing); err != nil {
+			return fmt.Errorf("failed to update image pull secret %s/%s: %w", namespace, spec.Name, err)
+		}
+		log.Info("Image pull secret updated", "namespace", namespace, "secret", spec.Name)
+	}
+
+	for _, name := range spec.ServiceAccounts {
+		var sa corev1.ServiceAccount
+		if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &sa); err != nil {
+			if k8serrors.IsNotFound(err) {
+				// the service account gets the secret once it is created.
+				continue
+			}
+			return fmt.Errorf("failed to get service account %s/%s: %w", namespace, name, err)
+		}
+		patch := client.MergeFrom(sa.DeepCopy())
+		if !pullsecrets.AddToServiceAccount(&sa, spec.Name) {
+			continue
+		}
+		if err := r.Patch(ctx, &sa, patch); err != nil {
+			return fmt.Errorf("failed to add image pull secret to service account %s/%s: %w", namespace, name, err)
+		}
+		log.Info("Image pull secret added to service account", "namespace", namespace, "serviceaccount", name, "secret", spec.Name)
+	}
+	return nil
+}
+
+// secretDataEqual returns true if both secrets hold the same data.
+func secretDataEqual(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if other, ok := b[k]; !ok || !bytes.Equal(v, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// allNamespaces enqueues every namespace, the secrets they get depend on the installation
+// and on the source secrets.
+func (r *ImagePullSecretReconciler) allNamespaces(ctx context.Context, _ client.Object) []reconcile.Request {
+	var namespaces corev1.NamespaceList
+	if err := r.List(ctx, &namespaces); err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "Failed to list namespaces")
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for _, ns := range namespaces.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&ns)})
+	}
+	return requests
+}
+
+// sourceSecretNamespaces enqueues every namespace when the source of an image pull secret
+// changes.
+func (r *ImagePullSecretReconciler) sourceSecretNamespaces(ctx context.Context, obj client.Object) []reconcile.Request {
+	if obj.GetNamespace() != ecNamespace || !strings.HasPrefix(obj.GetName(), pullsecrets.SourcePrefix) {
+		return nil
+	}
+	return r.allNamespaces(ctx, obj)
+}
+
+// serviceAccountNamespace enqueues the namespace of a service account.
+func serviceAccountNamespace(_ context.Context, obj client.Object) []reconcile.Request {
+	return []reconcile.Request{{NamespacedName: client.ObjectKey{Name: obj.GetNamespace()}}}
+}
+
+// SecretCacheOptions restricts the cache of the secrets to the embedded cluster namespace,
+// where the sources of the image pull secrets are, and returns the client options reading
+// the secrets of the other namespaces from the api. The operator does not watch the secrets
+// of the whole cluster.
+func SecretCacheOptions() (map[client.Object]cache.ByObject, *client.CacheOptions) {
+	byObject := map[client.Object]cache.ByObject{
+		&corev1.Secret{}: {Namespaces: map[string]cache.Config{ecNamespace: {}}},
+	}
+	return byObject, &client.CacheOptions{DisableFor: []client.Object{&corev1.Secret{}}}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ImagePullSecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("imagepullsecret").
+		For(&corev1.Namespace{}).
+		Watches(&v1beta1.Installation{}, handler.EnqueueRequestsFromMapFunc(r.allNamespaces)).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.sourceSecretNamespaces)).
+		Watches(&corev1.ServiceAccount{}, handler.EnqueueRequestsFromMapFunc(serviceAccountNamespace)).
+		Complete(r)
+}
@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/k8sutil"
+	"github.com/replicatedhq/embedded-cluster/pkg/pullsecrets"
+)
+
+func TestImagePullSecretReconciler_Reconcile(t *testing.T) {
+	ctx := context.Background()
+	in := &v1beta1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Name: "20241010120000"},
+		Spec: v1beta1.InstallationSpec{
+			ImagePullSecrets: []v1beta1.ImagePullSecret{
+				{Name: "corp-registry", Namespaces: []string{"my-app"}, ServiceAccounts: []string{"default", "later"}},
+				{Name: "user-managed", Namespaces: []string{"*"}},
+			},
+		},
+	}
+	source := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "image-pull-secret-corp-registry", Namespace: ecNamespace},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{}}`)},
+	}
+	userSource := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "image-pull-secret-user-managed", Namespace: ecNamespace},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{"a":{}}}`)},
+	}
+	// a secret with the same name created by the user is not overwritten.
+	userSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "user-managed", Namespace: "my-app"},
+		Data:       map[string][]byte{"key": []byte("value")},
+	}
+	objects := []client.Object{
+		in, source, userSource, userSecret,
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "my-app"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}},
+		&corev1.ServiceAccount{
+			ObjectMeta:       metav1.ObjectMeta{Name: "default", Namespace: "my-app"},
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "existing"}},
+		},
+	}
+	cli := fake.NewClientBuilder().WithScheme(k8sutil.Scheme()).WithObjects(objects...).Build()
+	r := &ImagePullSecretReconciler{Client: cli}
+
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKey{Name: "my-app"}})
+	require.NoError(t, err)
+
+	var secret corev1.Secret
+	require.NoError(t, cli.Get(ctx, client.ObjectKey{Namespace: "my-app", Name: "corp-registry"}, &secret))
+	assert.Equal(t, source.Data, secret.Data)
+	assert.Equal(t, corev1.SecretTypeDockerConfigJson, secret.Type)
+	assert.Equal(t, "true", secret.Labels[pullsecrets.ManagedLabel])
+
+	require.NoError(t, cli.Get(ctx, client.ObjectKey{Namespace: "my-app", Name: "user-managed"}, &secret))
+	assert.Equal(t, userSecret.Data, secret.Data)
+
+	var sa corev1.ServiceAccount
+	require.NoError(t, cli.Get(ctx, client.ObjectKey{Namespace: "my-app", Name: "default"}, &sa))
+	assert.Equal(t, []corev1.LocalObjectReference{{Name: "existing"}, {Name: "corp-registry"}}, sa.ImagePullSecrets)
+
+	// only the secret targeting every namespace is copied to other namespaces.
+	_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKey{Name: "other"}})
+	require.NoError(t, err)
+	require.NoError(t, cli.Get(ctx, client.ObjectKey{Namespace: "other", Name: "user-managed"}, &secret))
+	assert.Equal(t, userSource.Data, secret.Data)
+	err = cli.Get(ctx, client.ObjectKey{Namespace: "other", Name: "corp-registry"}, &secret)
+	assert.True(t, k8serrors.IsNotFound(err))
+
+	// rotated credentials are propagated to the copies.
+	require.NoError(t, cli.Get(ctx, client.ObjectKeyFromObject(source), source))
+	source.Data[corev1.DockerConfigJsonKey] = []byte(`{"auths":{"rotated":{}}}`)
+	require.NoError(t, cli.Update(ctx, source))
+	_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKey{Name: "my-app"}})
+	require.NoError(t, err)
+	require.NoError(t, cli.Get(ctx, client.ObjectKey{Namespace: "my-app", Name: "corp-registry"}, &secret))
+	assert.Equal(t, source.Data, secret.Data)
+
+	// system namespaces are not selected by "*".
+	_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKey{Name: "kube-system"}})
+	require.NoError(t, err)
+	err = cli.Get(ctx, client.ObjectKey{Namespace: "kube-system", Name: "user-managed"}, &secret)
+	assert.True(t, k8serrors.IsNotFound(err))
+
+	// copies no longer selected are deleted and removed from the service accounts, the
+	// secrets not created by the operator are kept.
+	require.NoError(t, cli.Get(ctx, client.ObjectKeyFromObject(in), in))
+	in.Spec.ImagePullSecrets = []v1beta1.ImagePullSecret{{Name: "user-managed", Namespaces: []string{"other"}}}
+	require.NoError(t, cli.Update(ctx, in))
+	_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKey{Name: "my-app"}})
+	require.NoError(t, err)
+	err = cli.Get(ctx, client.ObjectKey{Namespace: "my-app", Name: "corp-registry"}, &secret)
+	assert.True(t, k8serrors.IsNotFound(err))
+	require.NoError(t, cli.Get(ctx, client.ObjectKey{Namespace: "my-app", Name: "user-managed"}, &secret))
+	assert.Equal(t, userSecret.Data, secret.Data)
+	require.NoError(t, cli.Get(ctx, client.ObjectKey{Namespace: "my-app", Name: "default"}, &sa))
+	assert.Equal(t, []corev1.LocalObjectReference{{Name: "existing"}}, sa.ImagePullSecrets)
+
+	_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKey{Name: "other"}})
+	require.NoError(t, err)
+	require.NoError(t, cli.Get(ctx, client.ObjectKey{Namespace: "other", Name: "user-managed"}, &secret))
+
+	// only the sources of the image pull secrets enqueue the namespaces.
+	assert.NotEmpty(t, r.sourceSecretNamespaces(ctx, source))
+	other := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "corp-registry", Namespace: ecNamespace}}
+	assert.Empty(t, r.sourceSecretNamespaces(ctx, other))
+}
@@ -32,10 +32,12 @@ import (
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -46,18 +48,49 @@ import (
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/artifacts"
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/autopilot"
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/charts"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/dynamicconfig"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/hostbackup"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/hostrepair"
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/k8sutil"
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/metadata"
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/metrics"
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/openebs"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/prestage"
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/registry"
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/release"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/status"
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/upgrade"
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/util"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/windowsstack"
+	"github.com/replicatedhq/embedded-cluster/pkg/certs"
 )
 
 const HAConditionType = "HighAvailability"
 
+// K0sDynamicConfigConditionType is the condition reporting if the k0s overrides present in
+// the installation have been fully applied through the k0s dynamic config.
+const K0sDynamicConfigConditionType = "K0sDynamicConfig"
+
+// CertificateExpiryConditionType is the condition reporting if any of the cluster
+// certificates is about to expire.
+const CertificateExpiryConditionType = "CertificateExpiry"
+
+// HostConfigRepairConditionType is the condition reporting if the agent running on the
+// nodes had to restore host configuration files that went missing.
+const HostConfigRepairConditionType = "HostConfigRepair"
+
+// ConntrackSaturationConditionType is the condition reporting if the connection tracking
+// table of any node is nearly full.
+const ConntrackSaturationConditionType = "ConntrackSaturation"
+
+// ArtifactsPrestagedConditionType is the condition reporting the download of the artifacts
+// of the next release on the nodes, ahead of its upgrade.
+const ArtifactsPrestagedConditionType = "ArtifactsPrestaged"
+
+// certificateCheckInterval is how often we inspect the cluster certificates. Reaching
+// every node is not something we want to do on every reconcile.
+var certificateCheckInterval = time.Hour
+
 // requeueAfter is our default interval for requeueing. If nothing has changed with the
 // cluster nodes or the Installation object we will reconcile once every requeueAfter
 // interval.
@@ -140,6 +173,13 @@ type InstallationReconciler struct {
 	client.Client
 	Discovery discovery.DiscoveryInterface
 	Scheme    *runtime.Scheme
+	// StatusTracker, if set, keeps the outcome of the last reconcile so it can be
+	// served by the status API.
+	StatusTracker *status.Tracker
+	// Recorder, if set, records events for the changes in the installation lifecycle.
+	Recorder record.EventRecorder
+
+	lastCertificateCheck time.Time
 }
 
 // NodeHasChanged returns true if the node configuration has changed when compared to
@@ -440,6 +480,101 @@ func isAutopilotUpgradeToVersion(plan *apv1b2.Plan, version string) bool {
 	return false
 }
 
+// ReconcileK0sDynamicConfig applies the cluster wide portion of the k0s overrides present in
+// the installation to the k0s ClusterConfig object. k0s propagates these changes to all nodes
+// by itself. Node local fields (api, storage, etc) can't be changed this way, if the overrides
+// contain any of them a condition is set in the installation status. The api SANs are the
+// exception, the host repair agents add them to the k0s.yaml of the controllers.
+func (r *InstallationReconciler) ReconcileK0sDynamicConfig(ctx context.Context, in *v1beta1.Installation) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	var clusterConfig k0sv1beta1.ClusterConfig
+	if err := r.Get(ctx, client.ObjectKey{Name: "k0s", Namespace: "kube-system"}, &clusterConfig); err != nil {
+		return fmt.Errorf("failed to get cluster config: %w", err)
+	}
+
+	res, err := dynamicconfig.Apply(&clusterConfig, in)
+	if err != nil {
+		in.Status.SetCondition(metav1.Condition{
+			Type:               K0sDynamicConfigConditionType,
+			Status:             metav1.ConditionFalse,
+			Reason:             "InvalidOverrides",
+			Message:            err.Error(),
+			ObservedGeneration: in.Generation,
+		})
+		return nil
+	}
+
+	if res.Changed {
+		log.Info("Updating k0s dynamic config")
+		if err := r.Update(ctx, res.Config); err != nil {
+			return fmt.Errorf("failed to update cluster config: %w", err)
+		}
+	}
+
+	if len(res.IgnoredFields) > 0 {
+		in.Status.SetCondition(metav1.Condition{
+			Type:               K0sDynamicConfigConditionType,
+			Status:             metav1.ConditionFalse,
+			Reason:             "StaticFieldsIgnored",
+			Message:            fmt.Sprintf("Fields can only be changed in the nodes k0s.yaml: %s", strings.Join(res.IgnoredFields, ", ")),
+			ObservedGeneration: in.Generation,
+		})
+		return nil
+	}
+
+	in.Status.SetCondition(metav1.Condition{
+		Type:               K0sDynamicConfigConditionType,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Applied",
+		ObservedGeneration: in.Generation,
+	})
+	return nil
+}
+
+// ReconcileCertificates inspects the expiration of the cluster CA and of the certificates
+// served by the kube-apiservers and the kubelets. A condition is set in the installation
+// if any of them expires soon.
+func (r *InstallationReconciler) ReconcileCertificates(ctx context.Context, in *v1beta1.Installation) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	checked := meta.FindStatusCondition(in.Status.Conditions, CertificateExpiryConditionType) != nil
+	if checked && time.Since(r.lastCertificateCheck) < certificateCheckInterval {
+		return nil
+	}
+	r.lastCertificateCheck = time.Now()
+
+	found, errs := certs.FromCluster(ctx, r.Client)
+	for _, err := range errs {
+		log.Info("Unable to inspect certificate", "error", err.Error())
+	}
+
+	expiring := certs.Expiring(found, time.Now(), certs.ExpiryWarningThreshold)
+	if len(expiring) == 0 {
+		in.Status.SetCondition(metav1.Condition{
+			Type:               CertificateExpiryConditionType,
+			Status:             metav1.ConditionTrue,
+			Reason:             "CertificatesValid",
+			ObservedGeneration: in.Generation,
+		})
+		return nil
+	}
+
+	var names []string
+	for _, cert := range expiring {
+		names = append(names, cert.String())
+	}
+	log.Info("Certificates expiring soon", "certificates", names)
+	in.Status.SetCondition(metav1.Condition{
+		Type:               CertificateExpiryConditionType,
+		Status:             metav1.ConditionFalse,
+		Reason:             "CertificatesExpiringSoon",
+		Message:            fmt.Sprintf("Certificates expiring soon: %s", strings.Join(names, ", ")),
+		ObservedGeneration: in.Generation,
+	})
+	return nil
+}
+
 func (r *InstallationReconciler) ReconcileOpenebs(ctx context.Context, in *v1beta1.Installation) error {
 	log := ctrl.LoggerFrom(ctx)
 
@@ -455,6 +590,64 @@ func (r *InstallationReconciler) ReconcileOpenebs(ctx context.Context, in *v1bet
 	return nil
 }
 
+// ReconcileHostBackup deploys the host backup agent, running the operator image, when the
+// vendor or the end user include host paths in the disaster recovery backups.
+func (r *InstallationReconciler) ReconcileHostBackup(ctx context.Context, in *v1beta1.Installation) error {
+	return hostbackup.Reconcile(ctx, r.Client, in, os.Getenv("EMBEDDEDCLUSTER_IMAGE"))
+}
+
+// ReconcileHostRepair deploys the agent restoring the host configuration files missing on
+// the nodes and reports the last repair recorded on each node. The nodes whose connection
+// tracking table is nearly full are reported as well, with a warning event when it
+// changes so it is noticed before packets are dropped. kube-proxy is configured with the
+// conntrack sizing of the installation so it does not size the tables differently.
+func (r *InstallationReconciler) ReconcileHostRepair(ctx context.Context, in *v1beta1.Installation) error {
+	if err := hostrepair.Reconcile(ctx, r.Client, os.Getenv("EMBEDDEDCLUSTER_IMAGE")); err != nil {
+		return err
+	}
+	var nodes corev1.NodeList
+	if err := r.List(ctx, &nodes); err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+	in.Status.SetCondition(hostrepair.Condition(HostConfigRepairConditionType, nodes.Items, in.Generation))
+
+	cond := hostrepair.ConntrackCondition(ConntrackSaturationConditionType, nodes.Items, in.Generation)
+	prev := meta.FindStatusCondition(in.Status.Conditions, ConntrackSaturationConditionType)
+	changed := prev == nil || prev.Status != cond.Status || prev.Message != cond.Message
+	if changed && cond.Status == metav1.ConditionTrue {
+		ctrl.LoggerFrom(ctx).Info("Connection tracking table nearly full", "message", cond.Message)
+		if r.Recorder != nil {
+			r.Recorder.Event(in, corev1.EventTypeWarning, cond.Reason, cond.Message)
+		}
+	}
+	in.Status.SetCondition(cond)
+
+	var cfg *v1beta1.Conntrack
+	if in.Spec.Config != nil {
+		cfg = in.Spec.Config.Conntrack
+	}
+	if err := hostrepair.ReconcileKubeProxyConntrack(ctx, r.Client, cfg); err != nil {
+		return fmt.Errorf("failed to reconcile kube-proxy conntrack sizing: %w", err)
+	}
+	return nil
+}
+
+// ReconcileWindowsStack deploys the pod network of the Windows workers.
+func (r *InstallationReconciler) ReconcileWindowsStack(ctx context.Context, in *v1beta1.Installation) error {
+	return windowsstack.Reconcile(ctx, r.Client, in)
+}
+
+// ReconcilePrestage downloads the artifacts of the next release on the nodes of online
+// installations, during the configured window.
+func (r *InstallationReconciler) ReconcilePrestage(ctx context.Context, in *v1beta1.Installation) error {
+	cond, err := prestage.Reconcile(ctx, r.Client, in, os.Getenv("EMBEDDEDCLUSTER_IMAGE"), time.Now(), ArtifactsPrestagedConditionType)
+	if err != nil {
+		return err
+	}
+	in.Status.SetCondition(cond)
+	return nil
+}
+
 // ReconcileRegistry reconciles registry components, ensuring that the necessary secrets are
 // created as well as rebalancing stateful pods when nodes are removed from the cluster.
 func (r *InstallationReconciler) ReconcileRegistry(ctx context.Context, in *v1beta1.Installation) error {
@@ -637,6 +830,11 @@ func (r *InstallationReconciler) CoalesceInstallations(
 	sort.SliceStable(items, func(i, j int) bool {
 		return items[j].Name < items[i].Name
 	})
+	// the storage capabilities are validated at install time only, they are carried
+	// over to the installation objects created by upgrades.
+	for i := 1; i < len(items) && items[0].Status.Storage == nil; i++ {
+		items[0].Status.Storage = items[i].Status.Storage
+	}
 	if len(items) == 1 || len(items[0].Status.NodesStatus) > 0 {
 		return &items[0]
 	}
@@ -735,19 +933,27 @@ func constructHostPreflightResultsJob(nodeName, installationName string) *batchv
 	return job
 }
 
-//+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
-//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch;patch
+//+kubebuilder:rbac:groups="",resources=persistentvolumes,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
 //+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=daemonsets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=embeddedcluster.replicated.com,resources=installations,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=embeddedcluster.replicated.com,resources=installations/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=embeddedcluster.replicated.com,resources=installations/finalizers,verbs=update
 //+kubebuilder:rbac:groups=autopilot.k0sproject.io,resources=plans,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=k0s.k0sproject.io,resources=clusterconfigs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=helm.k0sproject.io,resources=charts,verbs=get;list;watch
+//+kubebuilder:rbac:groups=velero.io,resources=backups,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile reconcile the installation object.
-func (r *InstallationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *InstallationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, err error) {
+	// keep track of the outcome of this reconcile for the status api.
+	var in *v1beta1.Installation
+	defer func() { r.StatusTracker.Record(in, err) }()
+
 	// we start by fetching all installation objects and coalescing them. we
 	// are going to operate only on the newest one (sorting by installation
 	// name).
@@ -768,7 +974,7 @@ func (r *InstallationReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		log.Info("No active installations found, reconciliation ended")
 		return ctrl.Result{}, nil
 	}
-	in := r.CoalesceInstallations(ctx, items)
+	in = r.CoalesceInstallations(ctx, items)
 
 	// if the embedded cluster version has changed we should not reconcile with the old version
 	if r.needsUpgrade(ctx, in) {
@@ -820,20 +1026,54 @@ func (r *InstallationReconciler) Reconcile(ctx context.Context, req ctrl.Request
 	// if the k0s upgrade is still in progress this will wait until the upgrade is finished before
 	// moving on to the next steps.
 	if in.Status.State != v1beta1.InstallationStateKubernetesInstalled {
+		if err := r.ReconcileLifecycleConditions(ctx, in, len(installs) > 1); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to reconcile lifecycle conditions: %w", err)
+		}
 		if err := r.Status().Update(ctx, in.DeepCopy()); err != nil {
 			if errors.IsConflict(err) {
 				return ctrl.Result{}, fmt.Errorf("failed to update status: conflict")
 			}
 			return ctrl.Result{}, fmt.Errorf("failed to update installation status: %w", err)
 		}
+		r.RecordLifecycleEvents(before, in)
 		return ctrl.Result{}, nil
 	}
 
+	// apply the cluster wide k0s overrides through the k0s dynamic config.
+	if err := r.ReconcileK0sDynamicConfig(ctx, in); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to reconcile k0s dynamic config: %w", err)
+	}
+
+	// warn about certificates close to their expiration date.
+	if err := r.ReconcileCertificates(ctx, in); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to reconcile certificates: %w", err)
+	}
+
 	// cleanup openebs stateful pods
 	if err := r.ReconcileOpenebs(ctx, in); err != nil {
 		return ctrl.Result{}, fmt.Errorf("failed to reconcile openebs: %w", err)
 	}
 
+	// deploy the agent backing up host paths as part of the disaster recovery backups.
+	if err := r.ReconcileHostBackup(ctx, in); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to reconcile host backup: %w", err)
+	}
+
+	// restore the host configuration files missing on the nodes.
+	if err := r.ReconcileHostRepair(ctx, in); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to reconcile host repair: %w", err)
+	}
+
+	// deploy calico and kube-proxy on the windows workers.
+	if err := r.ReconcileWindowsStack(ctx, in); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to reconcile windows stack: %w", err)
+	}
+
+	// download the artifacts of the next release ahead of its upgrade.
+	if err := r.ReconcilePrestage(ctx, in); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to reconcile prestage: %w", err)
+	}
+
 	// reconcile helm chart dependencies including secrets.
 	if err := r.ReconcileRegistry(ctx, in); err != nil {
 		return ctrl.Result{}, fmt.Errorf("failed to pre-reconcile helm charts: %w", err)
@@ -849,6 +1089,11 @@ func (r *InstallationReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		return ctrl.Result{}, fmt.Errorf("failed to reconcile HA status: %w", err)
 	}
 
+	// summarize the lifecycle of the installation in its conditions.
+	if err := r.ReconcileLifecycleConditions(ctx, in, len(installs) > 1); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to reconcile lifecycle conditions: %w", err)
+	}
+
 	// save the installation status. nothing more to do with it.
 	if err := r.Status().Update(ctx, in.DeepCopy()); err != nil {
 		if errors.IsConflict(err) {
@@ -861,6 +1106,11 @@ func (r *InstallationReconciler) Reconcile(ctx context.Context, req ctrl.Request
 	// objects as obsolete. these are not necessary anymore and are kept only
 	// for historic reasons.
 	r.DisableOldInstallations(ctx, items)
+	r.RecordLifecycleEvents(before, in)
+
+	// the webhooks of the vendor may live on the local network, they are notified in
+	// airgap environments as well.
+	r.NotifyWebhooks(ctx, before, in, len(installs) > 1, events)
 
 	// if we are not in an airgap environment this is the time to call back to
 	// replicated and inform the status of this installation.
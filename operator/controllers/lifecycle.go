@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/preflights"
+)
+
+// PreflightsPassedConditionType is the condition reporting if the host preflights of all
+// nodes passed when they were installed or joined.
+const PreflightsPassedConditionType = "PreflightsPassed"
+
+// AddonsReadyConditionType is the condition reporting if all the add-ons of the
+// installation have been deployed.
+const AddonsReadyConditionType = "AddonsReady"
+
+// HAReadyConditionType is the condition reporting if the cluster has been fully migrated
+// to high availability. It mirrors the HighAvailability condition.
+const HAReadyConditionType = "HAReady"
+
+// UpgradeInProgressConditionType is the condition reporting if the installation is
+// upgrading a previous one and has not finished yet.
+const UpgradeInProgressConditionType = "UpgradeInProgress"
+
+// hostPreflightResultLabel labels the config maps holding the host preflight results of
+// each node, its value is the node name.
+const hostPreflightResultLabel = "embedded-cluster/host-preflight-result"
+
+// lifecycleConditionTypes are the conditions events are recorded for when they change.
+var lifecycleConditionTypes = []string{
+	PreflightsPassedConditionType,
+	AddonsReadyConditionType,
+	HAReadyConditionType,
+	UpgradeInProgressConditionType,
+}
+
+// ReconcileLifecycleConditions sets the conditions summarizing the lifecycle of the
+// installation, so it can be followed without reading the installer logs. upgrade tells
+// if the installation replaces a previous one.
+func (r *InstallationReconciler) ReconcileLifecycleConditions(ctx context.Context, in *v1beta1.Installation, upgrade bool) error {
+	var cms corev1.ConfigMapList
+	if err := r.List(ctx, &cms, client.InNamespace(ecNamespace), client.HasLabels{hostPreflightResultLabel}); err != nil {
+		return fmt.Errorf("failed to list host preflight results: %w", err)
+	}
+	in.Status.SetCondition(preflightsCondition(cms.Items, in.Generation))
+	in.Status.SetCondition(addonsReadyCondition(in))
+	if ha := meta.FindStatusCondition(in.Status.Conditions, HAConditionType); ha != nil {
+		in.Status.SetCondition(metav1.Condition{
+			Type:               HAReadyConditionType,
+			Status:             ha.Status,
+			Reason:             ha.Reason,
+			Message:            ha.Message,
+			ObservedGeneration: in.Generation,
+		})
+	}
+	in.Status.SetCondition(upgradeInProgressCondition(in, upgrade))
+	return nil
+}
+
+// preflightsCondition summarizes the host preflight results of the nodes.
+func preflightsCondition(cms []corev1.ConfigMap, generation int64) metav1.Condition {
+	cond := metav1.Condition{
+		Type:               PreflightsPassedConditionType,
+		ObservedGeneration: generation,
+	}
+	if len(cms) == 0 {
+		cond.Status = metav1.ConditionUnknown
+		cond.Reason = "NoResults"
+		cond.Message = "No host preflight results have been collected from the nodes"
+		return cond
+	}
+
+	failed, warned := []string{}, []string{}
+	for _, cm := range cms {
+		node := cm.Labels[hostPreflightResultLabel]
+		output, err := preflights.OutputFromReader(strings.NewReader(cm.Data["results.json"]))
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: unreadable results", node))
+			continue
+		}
+		if output.HasFail() {
+			titles := []string{}
+			for _, record := range output.Fail {
+				titles = append(titles, record.Title)
+			}
+			failed = append(failed, fmt.Sprintf("%s: %s", node, strings.Join(titles, ", ")))
+		} else if output.HasWarn() {
+			warned = append(warned, fmt.Sprintf("%s: %s", node, strings.Join(output.WarnTitles(), ", ")))
+		}
+	}
+	sort.Strings(failed)
+	sort.Strings(warned)
+
+	switch {
+	case len(failed) > 0:
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = "HostPreflightsFailed"
+		cond.Message = strings.Join(failed, "; ")
+	case len(warned) > 0:
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = "HostPreflightsPassedWithWarnings"
+		cond.Message = strings.Join(warned, "; ")
+	default:
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = "HostPreflightsPassed"
+	}
+	return cond
+}
+
+// addonsReadyCondition reports the add-ons as ready once the installation is installed,
+// the reason is the installation state otherwise.
+func addonsReadyCondition(in *v1beta1.Installation) metav1.Condition {
+	cond := metav1.Condition{
+		Type:               AddonsReadyConditionType,
+		Status:             metav1.ConditionFalse,
+		Reason:             stateReason(in.Status.State),
+		Message:            in.Status.Reason,
+		ObservedGeneration: in.Generation,
+	}
+	if in.Status.State == v1beta1.InstallationStateInstalled {
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = "AddonsReady"
+		cond.Message = ""
+	}
+	return cond
+}
+
+// upgradeInProgressCondition reports an upgrade in progress until the installation
+// replacing a previous one reaches a final state.
+func upgradeInProgressCondition(in *v1beta1.Installation, upgrade bool) metav1.Condition {
+	cond := metav1.Condition{
+		Type:               UpgradeInProgressConditionType,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: in.Generation,
+	}
+	switch {
+	case !upgrade:
+		cond.Reason = "InitialInstallation"
+	case in.Status.State == v1beta1.InstallationStateInstalled:
+		cond.Reason = "UpgradeCompleted"
+	case isFailedState(in.Status.State):
+		cond.Reason = "UpgradeFailed"
+		cond.Message = in.Status.Reason
+	default:
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = stateReason(in.Status.State)
+		cond.Message = in.Status.Reason
+	}
+	return cond
+}
+
+// stateReason returns the installation state as a condition reason, which can not be empty.
+func stateReason(state string) string {
+	if state == "" {
+		return v1beta1.InstallationStateUnknown
+	}
+	return state
+}
+
+// RecordLifecycleEvents records an event for the installation when its state or any of its
+// lifecycle conditions changed during the reconcile.
+func (r *InstallationReconciler) RecordLifecycleEvents(before, after *v1beta1.Installation) {
+	if r.Recorder == nil {
+		return
+	}
+	if before.Status.State != after.Status.State && after.Status.State != "" {
+		eventType := corev1.EventTypeNormal
+		if isFailedState(after.Status.State) {
+			eventType = corev1.EventTypeWarning
+		}
+		message := fmt.Sprintf("Installation state changed to %s", after.Status.State)
+		if after.Status.Reason != "" {
+			message = fmt.Sprintf("%s: %s", message, after.Status.Reason)
+		}
+		r.Recorder.Event(after, eventType, after.Status.State, message)
+	}
+
+	for _, condType := range lifecycleConditionTypes {
+		cond := meta.FindStatusCondition(after.Status.Conditions, condType)
+		if cond == nil {
+			continue
+		}
+		prev := meta.FindStatusCondition(before.Status.Conditions, condType)
+		if prev != nil && prev.Status == cond.Status && prev.Reason == cond.Reason {
+			continue
+		}
+		eventType := corev1.EventTypeNormal
+		if cond.Type == PreflightsPassedConditionType && cond.Status == metav1.ConditionFalse ||
+			cond.Type == UpgradeInProgressConditionType && cond.Reason == "UpgradeFailed" {
+			eventType = corev1.EventTypeWarning
+		}
+		message := fmt.Sprintf("%s is %s", cond.Type, cond.Status)
+		if cond.Message != "" {
+			message = fmt.Sprintf("%s: %s", message, cond.Message)
+		}
+		r.Recorder.Event(after, eventType, cond.Reason, message)
+	}
+}
+
+// isFailedState returns true if the installation state is a failure.
+func isFailedState(state string) bool {
+	return state == v1beta1.InstallationStateFailed || state == v1beta1.InstallationStateHelmChartUpdateFailure
+}
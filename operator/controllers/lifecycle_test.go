@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+func preflightResults(node, results string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      node + "-host-preflight-results",
+			Namespace: ecNamespace,
+			Labels:    map[string]string{hostPreflightResultLabel: node},
+		},
+		Data: map[string]string{"results.json": results},
+	}
+}
+
+func Test_preflightsCondition(t *testing.T) {
+	cond := preflightsCondition(nil, 1)
+	assert.Equal(t, metav1.ConditionUnknown, cond.Status)
+	assert.Equal(t, "NoResults", cond.Reason)
+
+	passed := *preflightResults("node-1", `{"pass":[{"title":"CPU"}]}`)
+	warned := *preflightResults("node-2", `{"warn":[{"title":"Disk Speed"}],"pass":[{"title":"CPU"}]}`)
+	failed := *preflightResults("node-3", `{"fail":[{"title":"Memory"},{"title":"Port 6443"}]}`)
+
+	cond = preflightsCondition([]corev1.ConfigMap{passed}, 1)
+	assert.Equal(t, metav1.ConditionTrue, cond.Status)
+	assert.Equal(t, "HostPreflightsPassed", cond.Reason)
+
+	cond = preflightsCondition([]corev1.ConfigMap{passed, warned}, 1)
+	assert.Equal(t, metav1.ConditionTrue, cond.Status)
+	assert.Equal(t, "HostPreflightsPassedWithWarnings", cond.Reason)
+	assert.Equal(t, "node-2: Disk Speed", cond.Message)
+
+	cond = preflightsCondition([]corev1.ConfigMap{passed, warned, failed}, 1)
+	assert.Equal(t, metav1.ConditionFalse, cond.Status)
+	assert.Equal(t, "HostPreflightsFailed", cond.Reason)
+	assert.Equal(t, "node-3: Memory, Port 6443", cond.Message)
+}
+
+func Test_upgradeInProgressCondition(t *testing.T) {
+	in := &v1beta1.Installation{}
+	in.Status.SetState(v1beta1.InstallationStateAddonsInstalling, "Installing addons", nil)
+
+	cond := upgradeInProgressCondition(in, false)
+	assert.Equal(t, metav1.ConditionFalse, cond.Status)
+	assert.Equal(t, "InitialInstallation", cond.Reason)
+
+	cond = upgradeInProgressCondition(in, true)
+	assert.Equal(t, metav1.ConditionTrue, cond.Status)
+	assert.Equal(t, v1beta1.InstallationStateAddonsInstalling, cond.Reason)
+	assert.Equal(t, "Installing addons", cond.Message)
+
+	in.Status.SetState(v1beta1.InstallationStateHelmChartUpdateFailure, "chart failed", nil)
+	cond = upgradeInProgressCondition(in, true)
+	assert.Equal(t, metav1.ConditionFalse, cond.Status)
+	assert.Equal(t, "UpgradeFailed", cond.Reason)
+
+	in.Status.SetState(v1beta1.InstallationStateInstalled, "", nil)
+	cond = upgradeInProgressCondition(in, true)
+	assert.Equal(t, metav1.ConditionFalse, cond.Status)
+	assert.Equal(t, "UpgradeCompleted", cond.Reason)
+}
+
+func TestInstallationReconciler_ReconcileLifecycleConditions(t *testing.T) {
+	kcli := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(preflightResults("node-1", `{"pass":[{"title":"CPU"}]}`)).
+		Build()
+	recorder := record.NewFakeRecorder(10)
+	r := &InstallationReconciler{Client: kcli, Recorder: recorder}
+
+	in := &v1beta1.Installation{ObjectMeta: metav1.ObjectMeta{Name: "20240101000000"}}
+	in.Status.SetState(v1beta1.InstallationStateAddonsInstalling, "", nil)
+	before := in.DeepCopy()
+	require.NoError(t, r.ReconcileLifecycleConditions(context.Background(), in, false))
+	assert.True(t, meta.IsStatusConditionTrue(in.Status.Conditions, PreflightsPassedConditionType))
+	assert.True(t, meta.IsStatusConditionFalse(in.Status.Conditions, AddonsReadyConditionType))
+	assert.True(t, meta.IsStatusConditionFalse(in.Status.Conditions, UpgradeInProgressConditionType))
+	assert.Nil(t, meta.FindStatusCondition(in.Status.Conditions, HAReadyConditionType))
+
+	r.RecordLifecycleEvents(before, in)
+	assert.Len(t, recorder.Events, 3)
+	assert.Equal(t, "Normal HostPreflightsPassed PreflightsPassed is True", <-recorder.Events)
+
+	// only the state and the conditions that changed are recorded.
+	before = in.DeepCopy()
+	in.Status.SetCondition(metav1.Condition{Type: HAConditionType, Status: metav1.ConditionTrue, Reason: "HAReady"})
+	in.Status.SetState(v1beta1.InstallationStateInstalled, "", nil)
+	require.NoError(t, r.ReconcileLifecycleConditions(context.Background(), in, false))
+	assert.True(t, meta.IsStatusConditionTrue(in.Status.Conditions, AddonsReadyConditionType))
+	assert.True(t, meta.IsStatusConditionTrue(in.Status.Conditions, HAReadyConditionType))
+
+	for len(recorder.Events) > 0 {
+		<-recorder.Events
+	}
+	r.RecordLifecycleEvents(before, in)
+	assert.Equal(t, "Normal Installed Installation state changed to Installed", <-recorder.Events)
+	assert.Equal(t, "Normal AddonsReady AddonsReady is True", <-recorder.Events)
+	assert.Equal(t, "Normal HAReady HAReady is True", <-recorder.Events)
+	assert.Empty(t, recorder.Events)
+}
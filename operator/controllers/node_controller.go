@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/hostrepair"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+)
+
+const (
+	// NodeVersionLabel holds the embedded cluster version the node converged to.
+	NodeVersionLabel = "embeddedcluster.replicated.com/version"
+	// controllerRoleNameLabel holds the name of the controller role, as set by installs
+	// and joins.
+	controllerRoleNameLabel = "kots.io/embedded-cluster-role-0"
+	// controllerRoleLabel holds the number of roles of a controller.
+	controllerRoleLabel = "kots.io/embedded-cluster-role"
+)
+
+// NodeReconciler converges the nodes to the embedded cluster configuration, including the
+// ones joined out-of-band or recovered from a snapshot. Controllers get the role labels
+// installs and joins set and every node is labeled with the version it runs once the
+// installation is installed. The host configuration files are restored by the host repair
+// agent.
+type NodeReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch;patch
+
+// Reconcile adds the labels missing or outdated on the node.
+func (r *NodeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	var node corev1.Node
+	if err := r.Get(ctx, req.NamespacedName, &node); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	in, err := kubeutils.GetLatestInstallation(ctx, r.Client)
+	if errors.As(err, &kubeutils.ErrNoInstallations{}) {
+		return ctrl.Result{}, nil
+	} else if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to get latest installation: %w", err)
+	}
+
+	labels := NodeLabels(in, node)
+	if len(labels) == 0 {
+		return ctrl.Result{}, nil
+	}
+	patch := client.MergeFrom(node.DeepCopy())
+	if node.Labels == nil {
+		node.Labels = map[string]string{}
+	}
+	for k, v := range labels {
+		node.Labels[k] = v
+	}
+	if err := r.Patch(ctx, &node, patch); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to label node %s: %w", node.Name, err)
+	}
+	log.Info("Node labels reconciled", "node", node.Name, "labels", labels)
+	return ctrl.Result{}, nil
+}
+
+// NodeLabels returns the labels missing or outdated on the node. Role labels are only
+// added when missing, they may have been changed on purpose.
+func NodeLabels(in *v1beta1.Installation, node corev1.Node) map[string]string {
+	labels := map[string]string{}
+	if hostrepair.IsController(node) {
+		if _, ok := node.Labels[controllerRoleNameLabel]; !ok {
+			role := v1beta1.NodeRole{}
+			if in.Spec.Config != nil {
+				role = in.Spec.Config.Roles.Controller
+			}
+			labels[controllerRoleNameLabel] = "controller"
+			if role.Name != "" {
+				labels[controllerRoleNameLabel] = role.Name
+			}
+			labels[controllerRoleLabel] = "total-1"
+			for k, v := range role.Labels {
+				if _, ok := node.Labels[k]; !ok {
+					labels[k] = v
+				}
+			}
+		}
+	}
+
+	if in.Status.State == v1beta1.InstallationStateInstalled && in.Spec.Config != nil && in.Spec.Config.Version != "" {
+		if version := versionLabelValue(in.Spec.Config.Version); node.Labels[NodeVersionLabel] != version {
+			labels[NodeVersionLabel] = version
+		}
+	}
+	return labels
+}
+
+// versionLabelValue returns the version as a valid label value, characters not allowed in
+// label values, like the '+' of the version metadata, are replaced by '_'.
+func versionLabelValue(version string) string {
+	value := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.', r == '_':
+			return r
+		}
+		return '_'
+	}, version)
+	if len(value) > 63 {
+		value = value[:63]
+	}
+	return strings.Trim(value, "-._")
+}
+
+// allNodes enqueues every node, the labels of all of them depend on the installation.
+func (r *NodeReconciler) allNodes(ctx context.Context, _ client.Object) []reconcile.Request {
+	var nodes corev1.NodeList
+	if err := r.List(ctx, &nodes); err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "Failed to list nodes")
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for _, node := range nodes.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&node)})
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *NodeReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("node").
+		For(&corev1.Node{}).
+		Watches(&v1beta1.Installation{}, handler.EnqueueRequestsFromMapFunc(r.allNodes)).
+		Complete(r)
+}
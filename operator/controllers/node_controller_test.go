@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/k8sutil"
+)
+
+func TestNodeLabels(t *testing.T) {
+	in := &v1beta1.Installation{
+		Spec: v1beta1.InstallationSpec{
+			Config: &v1beta1.ConfigSpec{
+				Version: "1.12.0+k8s-1.29",
+				Roles: v1beta1.Roles{
+					Controller: v1beta1.NodeRole{Name: "management", Labels: map[string]string{"tier": "mgmt"}},
+				},
+			},
+		},
+	}
+	controller := corev1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   "node-1",
+		Labels: map[string]string{"node-role.kubernetes.io/control-plane": "true", "tier": "custom"},
+	}}
+	worker := corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}}
+
+	// the version is only set once the installation is installed.
+	assert.Equal(t, map[string]string{
+		controllerRoleNameLabel: "management",
+		controllerRoleLabel:     "total-1",
+	}, NodeLabels(in, controller))
+	assert.Empty(t, NodeLabels(in, worker))
+
+	in.Status.SetState(v1beta1.InstallationStateInstalled, "", nil)
+	assert.Equal(t, map[string]string{NodeVersionLabel: "1.12.0_k8s-1.29"}, NodeLabels(in, worker))
+
+	controller.Labels[controllerRoleNameLabel] = "renamed"
+	controller.Labels[NodeVersionLabel] = "1.12.0_k8s-1.29"
+	assert.Empty(t, NodeLabels(in, controller))
+}
+
+func Test_versionLabelValue(t *testing.T) {
+	assert.Equal(t, "1.12.0_k8s-1.29", versionLabelValue("1.12.0+k8s-1.29"))
+	assert.Equal(t, "1.12.0", versionLabelValue("+1.12.0+"))
+	assert.Len(t, versionLabelValue(string(make([]byte, 100))), 0)
+}
+
+func TestNodeReconciler_Reconcile(t *testing.T) {
+	ctx := context.Background()
+	in := &v1beta1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Name: "20241010120000"},
+		Spec:       v1beta1.InstallationSpec{Config: &v1beta1.ConfigSpec{Version: "1.12.0"}},
+		Status:     v1beta1.InstallationStatus{State: v1beta1.InstallationStateInstalled},
+	}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   "node-1",
+		Labels: map[string]string{"node-role.kubernetes.io/control-plane": "true"},
+	}}
+	cli := fake.NewClientBuilder().WithScheme(k8sutil.Scheme()).WithObjects(node).Build()
+	r := &NodeReconciler{Client: cli}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(node)}
+
+	// nothing is done without an installation.
+	_, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.NoError(t, cli.Get(ctx, req.NamespacedName, node))
+	assert.NotContains(t, node.Labels, controllerRoleNameLabel)
+
+	require.NoError(t, cli.Create(ctx, in))
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.NoError(t, cli.Get(ctx, req.NamespacedName, node))
+	assert.Equal(t, "controller", node.Labels[controllerRoleNameLabel])
+	assert.Equal(t, "1.12.0", node.Labels[NodeVersionLabel])
+	assert.Equal(t, "true", node.Labels["node-role.kubernetes.io/control-plane"])
+
+	// removed nodes are ignored.
+	_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKey{Name: "node-2"}})
+	require.NoError(t, err)
+}
@@ -0,0 +1,268 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/nodeconfig"
+)
+
+// NodeConfigFinalizer keeps a NodeConfig, and its worker profile, until no node runs with
+// the profile anymore. Removing the profile earlier would break the restart of the nodes
+// still using it.
+const NodeConfigFinalizer = "embeddedcluster.replicated.com/node-config"
+
+// NodeConfigAppliedConditionType is the condition reporting if all the nodes selected by a
+// NodeConfig run with its configuration.
+const NodeConfigAppliedConditionType = "Applied"
+
+// NodeConfigReconciler renders the NodeConfigs into k0s worker profiles and records on the
+// nodes the profile they should run with. Nodes are not restarted by the operator, the
+// node apply-config command drains the node, restarts k0s with the profile and records it
+// as applied on the node.
+type NodeConfigReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=embeddedcluster.replicated.com,resources=nodeconfigs,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=embeddedcluster.replicated.com,resources=nodeconfigs/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=embeddedcluster.replicated.com,resources=nodeconfigs/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch;patch
+
+// Reconcile converges all the NodeConfigs at once, the profile of a node depends on all of
+// them.
+func (r *NodeConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	var configs v1beta1.NodeConfigList
+	if err := r.List(ctx, &configs); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to list node configs: %w", err)
+	}
+	var nodes corev1.NodeList
+	if err := r.List(ctx, &nodes); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	for i := range configs.Items {
+		nc := &configs.Items[i]
+		if nc.DeletionTimestamp != nil || controllerutil.ContainsFinalizer(nc, NodeConfigFinalizer) {
+			continue
+		}
+		controllerutil.AddFinalizer(nc, NodeConfigFinalizer)
+		if err := r.Update(ctx, nc); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to add finalizer to node config %s: %w", nc.Name, err)
+		}
+	}
+
+	hashes, err := r.reconcileProfiles(ctx, configs.Items, nodes.Items)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	conflicts := map[string]string{}
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		nc, err := nodeconfig.ForNode(configs.Items, *node)
+		if err != nil {
+			// the node keeps the profile it has until the conflict is solved.
+			conflicts[node.Name] = err.Error()
+			continue
+		}
+		desired := ""
+		if nc != nil {
+			desired = nodeconfig.AnnotationValue(nodeconfig.ProfileName(*nc), hashes[nc.Name])
+		}
+		if node.Annotations[nodeconfig.DesiredAnnotation] == desired {
+			continue
+		}
+		patch := client.MergeFrom(node.DeepCopy())
+		if desired == "" {
+			delete(node.Annotations, nodeconfig.DesiredAnnotation)
+		} else {
+			if node.Annotations == nil {
+				node.Annotations = map[string]string{}
+			}
+			node.Annotations[nodeconfig.DesiredAnnotation] = desired
+		}
+		if err := r.Patch(ctx, node, patch); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to annotate node %s: %w", node.Name, err)
+		}
+		log.Info("Node configuration changed, node apply-config must be run on the node", "node", node.Name, "profile", desired)
+	}
+
+	for i := range configs.Items {
+		nc := &configs.Items[i]
+		if nc.DeletionTimestamp != nil {
+			if err := r.finalize(ctx, nc, nodes.Items); err != nil {
+				return ctrl.Result{}, err
+			}
+			continue
+		}
+		original := nc.Status.DeepCopy()
+		NodeConfigStatus(nc, hashes[nc.Name], nodes.Items, conflicts)
+		if equality.Semantic.DeepEqual(original, &nc.Status) {
+			continue
+		}
+		if err := r.Status().Update(ctx, nc); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to update node config %s status: %w", nc.Name, err)
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+// reconcileProfiles renders the worker profiles of the NodeConfigs into the k0s cluster
+// config, k0s distributes them to the nodes. The profiles of the NodeConfigs being deleted
+// are kept while nodes still run with them. The hash of each rendered profile is returned.
+func (r *NodeConfigReconciler) reconcileProfiles(ctx context.Context, configs []v1beta1.NodeConfig, nodes []corev1.Node) (map[string]string, error) {
+	var clusterConfig k0sv1beta1.ClusterConfig
+	if err := r.Get(ctx, client.ObjectKey{Name: "k0s", Namespace: "kube-system"}, &clusterConfig); err != nil {
+		return nil, fmt.Errorf("failed to get cluster config: %w", err)
+	}
+	existing := map[string]k0sv1beta1.WorkerProfile{}
+	for _, profile := range clusterConfig.Spec.WorkerProfiles {
+		existing[profile.Name] = profile
+	}
+
+	hashes := map[string]string{}
+	profiles := []k0sv1beta1.WorkerProfile{}
+	for _, nc := range configs {
+		if nc.DeletionTimestamp != nil {
+			if profile, ok := existing[nodeconfig.ProfileName(nc)]; ok && len(nodesRunning(nodeconfig.ProfileName(nc), nodes)) > 0 {
+				profiles = append(profiles, profile)
+			}
+			continue
+		}
+		profile, hash, err := nodeconfig.RenderProfile(&clusterConfig, nc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render node config %s: %w", nc.Name, err)
+		}
+		profiles = append(profiles, profile)
+		hashes[nc.Name] = hash
+	}
+
+	if nodeconfig.SetProfiles(&clusterConfig, profiles) {
+		ctrl.LoggerFrom(ctx).Info("Updating k0s worker profiles")
+		if err := r.Update(ctx, &clusterConfig); err != nil {
+			return nil, fmt.Errorf("failed to update cluster config: %w", err)
+		}
+	}
+	return hashes, nil
+}
+
+// finalize removes the finalizer of a NodeConfig being deleted once no node runs with its
+// profile anymore.
+func (r *NodeConfigReconciler) finalize(ctx context.Context, nc *v1beta1.NodeConfig, nodes []corev1.Node) error {
+	if !controllerutil.ContainsFinalizer(nc, NodeConfigFinalizer) {
+		return nil
+	}
+	if running := nodesRunning(nodeconfig.ProfileName(*nc), nodes); len(running) > 0 {
+		ctrl.LoggerFrom(ctx).Info("Node config still in use", "nodeconfig", nc.Name, "nodes", running)
+		return nil
+	}
+	controllerutil.RemoveFinalizer(nc, NodeConfigFinalizer)
+	if err := r.Update(ctx, nc); err != nil {
+		return fmt.Errorf("failed to remove finalizer from node config %s: %w", nc.Name, err)
+	}
+	return nil
+}
+
+// nodesRunning returns the names of the nodes last restarted with the profile.
+func nodesRunning(profile string, nodes []corev1.Node) []string {
+	names := []string{}
+	for _, node := range nodes {
+		if nodeconfig.ProfileFromAnnotation(node.Annotations[nodeconfig.AppliedAnnotation]) == profile {
+			names = append(names, node.Name)
+		}
+	}
+	return names
+}
+
+// NodeConfigStatus sets the status of the NodeConfig out of the nodes it selects. A node is
+// applied once it has been restarted with the current hash of the profile. conflicts holds
+// the nodes selected by more than one NodeConfig.
+func NodeConfigStatus(nc *v1beta1.NodeConfig, hash string, nodes []corev1.Node, conflicts map[string]string) {
+	profile := nodeconfig.ProfileName(*nc)
+	nc.Status.Profile = profile
+	nc.Status.Hash = hash
+	nc.Status.Nodes = nil
+
+	desired := nodeconfig.AnnotationValue(profile, hash)
+	pending, conflicting := []string{}, []string{}
+	for _, node := range nodes {
+		if !nodeconfig.Selects(*nc, node) {
+			continue
+		}
+		if msg, ok := conflicts[node.Name]; ok {
+			conflicting = append(conflicting, msg)
+			continue
+		}
+		applied := node.Annotations[nodeconfig.AppliedAnnotation] == desired
+		nc.Status.Nodes = append(nc.Status.Nodes, v1beta1.NodeConfigNodeStatus{Name: node.Name, Applied: applied})
+		if !applied {
+			pending = append(pending, node.Name)
+		}
+	}
+	sort.Slice(nc.Status.Nodes, func(i, j int) bool { return nc.Status.Nodes[i].Name < nc.Status.Nodes[j].Name })
+	sort.Strings(pending)
+	sort.Strings(conflicting)
+
+	cond := metav1.Condition{
+		Type:               NodeConfigAppliedConditionType,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Applied",
+		ObservedGeneration: nc.Generation,
+	}
+	switch {
+	case len(conflicting) > 0:
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = "ConflictingNodeConfigs"
+		cond.Message = strings.Join(conflicting, "; ")
+	case len(pending) > 0:
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = "RestartPending"
+		cond.Message = fmt.Sprintf("Run node apply-config on the nodes, one at a time, to restart them with the configuration: %s", strings.Join(pending, ", "))
+	case len(nc.Status.Nodes) == 0:
+		cond.Reason = "NoNodesSelected"
+	}
+	meta.SetStatusCondition(&nc.Status.Conditions, cond)
+}
+
+// allNodeConfigs enqueues every NodeConfig, they all depend on the nodes and the cluster
+// config.
+func (r *NodeConfigReconciler) allNodeConfigs(ctx context.Context, _ client.Object) []reconcile.Request {
+	var configs v1beta1.NodeConfigList
+	if err := r.List(ctx, &configs); err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "Failed to list node configs")
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for _, nc := range configs.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&nc)})
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *NodeConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1beta1.NodeConfig{}).
+		Watches(&corev1.Node{}, handler.EnqueueRequestsFromMapFunc(r.allNodeConfigs)).
+		Watches(&k0sv1beta1.ClusterConfig{}, handler.EnqueueRequestsFromMapFunc(r.allNodeConfigs)).
+		Complete(r)
+}
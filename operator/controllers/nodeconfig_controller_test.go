@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/k8sutil"
+	"github.com/replicatedhq/embedded-cluster/pkg/nodeconfig"
+)
+
+func TestNodeConfigReconciler_Reconcile(t *testing.T) {
+	ctx := context.Background()
+	gpu := &v1beta1.NodeConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "gpu"},
+		Spec: v1beta1.NodeConfigSpec{
+			NodeSelector: map[string]string{"pool": "gpu"},
+			Kubelet:      v1beta1.KubeletOverrides{MaxPods: ptr.To[int32](250)},
+		},
+	}
+	clusterConfig := &k0sv1beta1.ClusterConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "k0s", Namespace: "kube-system"},
+		Spec:       &k0sv1beta1.ClusterSpec{},
+	}
+	node1 := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{"pool": "gpu"}}}
+	node2 := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}}
+
+	kcli := fake.NewClientBuilder().
+		WithScheme(k8sutil.Scheme()).
+		WithStatusSubresource(&v1beta1.NodeConfig{}).
+		WithObjects(gpu, clusterConfig, node1, node2).
+		Build()
+	r := &NodeConfigReconciler{Client: kcli}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(gpu)}
+
+	_, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	require.NoError(t, kcli.Get(ctx, client.ObjectKeyFromObject(clusterConfig), clusterConfig))
+	require.Len(t, clusterConfig.Spec.WorkerProfiles, 1)
+	assert.Equal(t, "nodeconfig-gpu", clusterConfig.Spec.WorkerProfiles[0].Name)
+	assert.JSONEq(t, `{"maxPods":250}`, string(clusterConfig.Spec.WorkerProfiles[0].Config.Raw))
+
+	require.NoError(t, kcli.Get(ctx, client.ObjectKeyFromObject(gpu), gpu))
+	assert.Contains(t, gpu.Finalizers, NodeConfigFinalizer)
+	assert.Equal(t, "nodeconfig-gpu", gpu.Status.Profile)
+	assert.Equal(t, []v1beta1.NodeConfigNodeStatus{{Name: "node-1", Applied: false}}, gpu.Status.Nodes)
+	cond := meta.FindStatusCondition(gpu.Status.Conditions, NodeConfigAppliedConditionType)
+	require.NotNil(t, cond)
+	assert.Equal(t, "RestartPending", cond.Reason)
+
+	desired := nodeconfig.AnnotationValue("nodeconfig-gpu", gpu.Status.Hash)
+	require.NoError(t, kcli.Get(ctx, client.ObjectKeyFromObject(node1), node1))
+	assert.Equal(t, desired, node1.Annotations[nodeconfig.DesiredAnnotation])
+	require.NoError(t, kcli.Get(ctx, client.ObjectKeyFromObject(node2), node2))
+	assert.NotContains(t, node2.Annotations, nodeconfig.DesiredAnnotation)
+
+	// the node is restarted with the profile.
+	node1.Annotations[nodeconfig.AppliedAnnotation] = desired
+	require.NoError(t, kcli.Update(ctx, node1))
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.NoError(t, kcli.Get(ctx, client.ObjectKeyFromObject(gpu), gpu))
+	assert.True(t, meta.IsStatusConditionTrue(gpu.Status.Conditions, NodeConfigAppliedConditionType))
+
+	// the profile is kept while the node runs with it.
+	require.NoError(t, kcli.Delete(ctx, gpu))
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.NoError(t, kcli.Get(ctx, client.ObjectKeyFromObject(gpu), gpu))
+	require.NoError(t, kcli.Get(ctx, client.ObjectKeyFromObject(clusterConfig), clusterConfig))
+	assert.Len(t, clusterConfig.Spec.WorkerProfiles, 1)
+	require.NoError(t, kcli.Get(ctx, client.ObjectKeyFromObject(node1), node1))
+	assert.NotContains(t, node1.Annotations, nodeconfig.DesiredAnnotation)
+
+	// the node is restarted without the profile.
+	delete(node1.Annotations, nodeconfig.AppliedAnnotation)
+	require.NoError(t, kcli.Update(ctx, node1))
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	err = kcli.Get(ctx, client.ObjectKeyFromObject(gpu), gpu)
+	assert.True(t, errors.IsNotFound(err), "the node config must be gone")
+	require.NoError(t, kcli.Get(ctx, client.ObjectKeyFromObject(clusterConfig), clusterConfig))
+	assert.Empty(t, clusterConfig.Spec.WorkerProfiles)
+}
+
+func TestNodeConfigStatus_Conflict(t *testing.T) {
+	nc := &v1beta1.NodeConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "all"},
+	}
+	nodes := []corev1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}}
+	conflicts := map[string]string{"node-1": "node node-1 is selected by multiple node configs: all, gpu"}
+
+	NodeConfigStatus(nc, "abc", nodes, conflicts)
+	assert.Empty(t, nc.Status.Nodes)
+	cond := meta.FindStatusCondition(nc.Status.Conditions, NodeConfigAppliedConditionType)
+	require.NotNil(t, cond)
+	assert.Equal(t, metav1.ConditionFalse, cond.Status)
+	assert.Equal(t, "ConflictingNodeConfigs", cond.Reason)
+	assert.Equal(t, conflicts["node-1"], cond.Message)
+}
@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"context"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/webhooks"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+)
+
+// NotifyWebhooks queues the lifecycle events of the installation for the webhooks of the
+// vendor: the installation or the upgrade finishing, the nodes added and removed and the
+// disaster recovery backups completed. Backups are noticed on the next reconcile after they
+// complete. upgrade tells if the installation replaces a previous one. The events are
+// delivered by the webhooks dispatcher, failures to queue them are only logged.
+func (r *InstallationReconciler) NotifyWebhooks(ctx context.Context, before, after *v1beta1.Installation, upgrade bool, batch *NodeEventsBatch) {
+	if after.Spec.Config == nil || len(after.Spec.Config.Webhooks) == 0 {
+		return
+	}
+	hooks := after.Spec.Config.Webhooks
+	lifecycle := lifecycleWebhookEvents(before, after, upgrade, batch)
+	backups := len(webhooks.Subscribed(hooks, webhooks.EventBackupCompleted)) > 0
+	if len(lifecycle) == 0 && !backups {
+		return
+	}
+	err := retry.OnError(retry.DefaultRetry, isStateConflict, func() error {
+		state, err := webhooks.LoadState(ctx, r.Client, ecNamespace)
+		if err != nil {
+			return err
+		}
+		events := lifecycle
+		if backups {
+			completed, err := webhooks.CompletedBackups(ctx, r.Client, state, defaults.VeleroNamespace)
+			if err != nil {
+				return err
+			}
+			for _, backup := range completed {
+				events = append(events, webhooks.NewEvent(after, webhooks.EventBackupCompleted, backup))
+			}
+		}
+		state.Enqueue(hooks, events...)
+		return state.Save(ctx, r.Client)
+	})
+	if err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "Failed to queue webhook events")
+	}
+}
+
+// isStateConflict returns true if the webhooks state changed while it was updated.
+func isStateConflict(err error) bool {
+	return k8serrors.IsConflict(err) || k8serrors.IsAlreadyExists(err)
+}
+
+// lifecycleWebhookEvents returns the events for the changes between the installation
+// before and after the reconcile and for the node changes of the batch.
+func lifecycleWebhookEvents(before, after *v1beta1.Installation, upgrade bool, batch *NodeEventsBatch) []webhooks.Event {
+	var events []webhooks.Event
+	if before.Status.State != v1beta1.InstallationStateInstalled && after.Status.State == v1beta1.InstallationStateInstalled {
+		eventType := webhooks.EventInstalled
+		if upgrade {
+			eventType = webhooks.EventUpgraded
+		}
+		events = append(events, webhooks.NewEvent(after, eventType, nil))
+	}
+	if batch == nil {
+		return events
+	}
+	for _, ev := range batch.NodesAdded {
+		events = append(events, webhooks.NewEvent(after, webhooks.EventNodeAdded, ev))
+	}
+	for _, ev := range batch.NodesRemoved {
+		events = append(events, webhooks.NewEvent(after, webhooks.EventNodeRemoved, ev))
+	}
+	return events
+}
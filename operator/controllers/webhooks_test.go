@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/metrics"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/webhooks"
+)
+
+func TestLifecycleWebhookEvents(t *testing.T) {
+	types := func(events []webhooks.Event) []string {
+		var names []string
+		for _, ev := range events {
+			names = append(names, ev.Type)
+		}
+		return names
+	}
+	in := func(state string) *v1beta1.Installation {
+		return &v1beta1.Installation{
+			Spec:   v1beta1.InstallationSpec{ClusterID: "cluster-1", Config: &v1beta1.ConfigSpec{Version: "1.2.0"}},
+			Status: v1beta1.InstallationStatus{State: state},
+		}
+	}
+	batch := &NodeEventsBatch{
+		NodesAdded:   []metrics.NodeEvent{{NodeName: "node-2"}},
+		NodesUpdated: []metrics.NodeEvent{{NodeName: "node-1"}},
+		NodesRemoved: []metrics.NodeRemovedEvent{{NodeName: "node-3"}},
+	}
+
+	events := lifecycleWebhookEvents(in(v1beta1.InstallationStateAddonsInstalling), in(v1beta1.InstallationStateInstalled), false, nil)
+	assert.Equal(t, []string{webhooks.EventInstalled}, types(events))
+	assert.Equal(t, "cluster-1", events[0].ClusterID)
+	assert.Equal(t, "1.2.0", events[0].Version)
+
+	events = lifecycleWebhookEvents(in(v1beta1.InstallationStateAddonsInstalling), in(v1beta1.InstallationStateInstalled), true, batch)
+	assert.Equal(t, []string{webhooks.EventUpgraded, webhooks.EventNodeAdded, webhooks.EventNodeRemoved}, types(events))
+
+	events = lifecycleWebhookEvents(in(v1beta1.InstallationStateInstalled), in(v1beta1.InstallationStateInstalled), true, &NodeEventsBatch{})
+	assert.Empty(t, events)
+}
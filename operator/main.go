@@ -20,11 +20,12 @@ import (
 	"os"
 
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/cli"
+	ecerrors "github.com/replicatedhq/embedded-cluster/pkg/errors"
 )
 
 func main() {
 	err := cli.RootCmd().Execute()
 	if err != nil {
-		os.Exit(1)
+		os.Exit(ecerrors.ExitCode(err))
 	}
 }
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"runtime"
+	"slices"
 
 	autopilotv1beta2 "github.com/k0sproject/k0s/pkg/apis/autopilot/v1beta2"
 	clusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
@@ -73,6 +74,8 @@ var copyArtifactsJob = &batchv1.Job{
 								ReadOnly:  false,
 							},
 						},
+						// the image bundles of the previous installations are evicted by the
+						// local artifact mirror according to its disk quota.
 						Command: []string{
 							"/bin/sh",
 							"-ex",
@@ -81,9 +84,8 @@ var copyArtifactsJob = &batchv1.Job{
 								"/usr/local/bin/local-artifact-mirror pull images $INSTALLATION_DATA\n" +
 								"/usr/local/bin/local-artifact-mirror pull helmcharts $INSTALLATION_DATA\n" +
 								"mv /var/lib/embedded-cluster/bin/k0s /var/lib/embedded-cluster/bin/k0s-upgrade\n" +
-								"rm /var/lib/embedded-cluster/images/images-amd64-* || true\n" +
 								"cd /var/lib/embedded-cluster/images/\n" +
-								"mv images-amd64.tar images-amd64-${INSTALLATION}.tar\n" +
+								"mv images-${ARCH}.tar images-${ARCH}-${INSTALLATION}.tar\n" +
 								"echo 'done'",
 						},
 					},
@@ -223,6 +225,7 @@ func getArtifactJobForNode(ctx context.Context, cli client.Client, in *clusterv1
 		job.Spec.Template.Spec.Containers[0].Env,
 		corev1.EnvVar{Name: "INSTALLATION", Value: in.Name},
 		corev1.EnvVar{Name: "INSTALLATION_DATA", Value: inDataEncoded},
+		corev1.EnvVar{Name: "ARCH", Value: NodeArchitecture(node)},
 	)
 
 	job.Spec.Template.Spec.Containers[0].Image = localArtifactMirrorImage
@@ -260,16 +263,18 @@ func CreateAutopilotAirgapPlanCommand(ctx context.Context, cli client.Client, in
 	if in.Spec.LocalArtifactMirror != nil && in.Spec.LocalArtifactMirror.Port > 0 {
 		port = in.Spec.LocalArtifactMirror.Port
 	}
-	imageURL := fmt.Sprintf("http://127.0.0.1:%d/images/images-amd64-%s.tar", port, in.Name)
+	// every node imports the image bundle of its own architecture.
+	platforms := map[string]autopilotv1beta2.PlanResourceURL{}
+	for _, arch := range NodeArchitectures(nodes.Items) {
+		platforms[fmt.Sprintf("%s-%s", runtime.GOOS, arch)] = autopilotv1beta2.PlanResourceURL{
+			URL: fmt.Sprintf("http://127.0.0.1:%d/images/images-%s-%s.tar", port, arch, in.Name),
+		}
+	}
 
 	return &autopilotv1beta2.PlanCommand{
 		AirgapUpdate: &autopilotv1beta2.PlanCommandAirgapUpdate{
-			Version: meta.Versions["Kubernetes"],
-			Platforms: map[string]autopilotv1beta2.PlanResourceURL{
-				fmt.Sprintf("%s-%s", runtime.GOOS, runtime.GOARCH): {
-					URL: imageURL,
-				},
-			},
+			Version:   meta.Versions["Kubernetes"],
+			Platforms: platforms,
 			Workers: autopilotv1beta2.PlanCommandTarget{
 				Discovery: autopilotv1beta2.PlanCommandTargetDiscovery{
 					Static: &autopilotv1beta2.PlanCommandTargetDiscoveryStatic{
@@ -281,6 +286,27 @@ func CreateAutopilotAirgapPlanCommand(ctx context.Context, cli client.Client, in
 	}, nil
 }
 
+// NodeArchitecture returns the cpu architecture of the node. Nodes that did not report it
+// yet are assumed to run on the architecture of the operator.
+func NodeArchitecture(node corev1.Node) string {
+	if arch := node.Status.NodeInfo.Architecture; arch != "" {
+		return arch
+	}
+	return runtime.GOARCH
+}
+
+// NodeArchitectures returns the sorted cpu architectures of the nodes.
+func NodeArchitectures(nodes []corev1.Node) []string {
+	var archs []string
+	for _, node := range nodes {
+		if arch := NodeArchitecture(node); !slices.Contains(archs, arch) {
+			archs = append(archs, arch)
+		}
+	}
+	slices.Sort(archs)
+	return archs
+}
+
 func applyArtifactsJobAnnotations(annotations map[string]string, in *clusterv1beta1.Installation, hash string) map[string]string {
 	if annotations == nil {
 		annotations = make(map[string]string)
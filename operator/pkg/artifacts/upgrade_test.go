@@ -2,6 +2,7 @@ package artifacts
 
 import (
 	"context"
+	"runtime"
 	"sync"
 	"testing"
 	"time"
@@ -416,3 +417,11 @@ func TestListArtifactsJobForNodes(t *testing.T) {
 		})
 	}
 }
+
+func TestNodeArchitectures(t *testing.T) {
+	node := func(arch string) corev1.Node {
+		return corev1.Node{Status: corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{Architecture: arch}}}
+	}
+	assert.Equal(t, []string{"amd64", "arm64"}, NodeArchitectures([]corev1.Node{node("arm64"), node("amd64"), node("arm64")}))
+	assert.Equal(t, []string{runtime.GOARCH}, NodeArchitectures([]corev1.Node{node("")}))
+}
@@ -16,7 +16,10 @@ import (
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/k8sutil"
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/registry"
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/util"
+	"github.com/replicatedhq/embedded-cluster/pkg/airgap"
 	"github.com/replicatedhq/embedded-cluster/pkg/helm"
+	"github.com/replicatedhq/embedded-cluster/pkg/placement"
+	"github.com/replicatedhq/embedded-cluster/pkg/storageplan"
 )
 
 const (
@@ -76,7 +79,8 @@ func mergeHelmConfigs(ctx context.Context, meta *ectypes.ReleaseMetadata, in *cl
 		combinedConfigs.Repositories = append(combinedConfigs.Repositories, in.Spec.Config.Extensions.Helm.Repositories...)
 	}
 
-	if in != nil && in.Spec.AirGap {
+	// the embedded registry is not deployed when the images are hosted in an existing registry.
+	if in != nil && in.Spec.AirGap && in.Spec.AirgapRegistry == "" {
 		if in.Spec.HighAvailability {
 			seaweedfsConfig, ok := meta.BuiltinConfigs["seaweedfs"]
 			if ok {
@@ -101,6 +105,14 @@ func mergeHelmConfigs(ctx context.Context, meta *ectypes.ReleaseMetadata, in *cl
 		}
 	}
 
+	if in != nil && in.Spec.Config.ReplicatedSDKEnabled() {
+		config, ok := meta.BuiltinConfigs["replicated-sdk"]
+		if ok {
+			combinedConfigs.Charts = append(combinedConfigs.Charts, config.Charts...)
+			combinedConfigs.Repositories = append(combinedConfigs.Repositories, config.Repositories...)
+		}
+	}
+
 	if in != nil && in.Spec.LicenseInfo != nil && in.Spec.LicenseInfo.IsDisasterRecoverySupported {
 		config, ok := meta.BuiltinConfigs["velero"]
 		if ok {
@@ -125,6 +137,16 @@ func mergeHelmConfigs(ctx context.Context, meta *ectypes.ReleaseMetadata, in *cl
 	return combinedConfigs, nil
 }
 
+// installPlacement returns the admin console and registry placement of the installation,
+// the end user placement takes precedence over the one in the config.
+func installPlacement(in *v1beta1.Installation) *v1beta1.Placement {
+	var cfgPlacement *v1beta1.Placement
+	if in.Spec.Config != nil {
+		cfgPlacement = in.Spec.Config.Placement
+	}
+	return placement.Merge(cfgPlacement, in.Spec.EndUserPlacement)
+}
+
 // updateInfraChartsFromInstall updates the infrastructure charts with dynamic values from the installation spec
 func updateInfraChartsFromInstall(in *v1beta1.Installation, clusterConfig *k0sv1beta1.ClusterConfig, charts []v1beta1.Chart) ([]v1beta1.Chart, error) {
 	for i, chart := range charts {
@@ -133,6 +155,7 @@ func updateInfraChartsFromInstall(in *v1beta1.Installation, clusterConfig *k0sv1
 			"docker-registry",
 			"embedded-cluster-operator",
 			"openebs",
+			"replicated",
 			"seaweedfs",
 			"velero",
 		}
@@ -141,6 +164,33 @@ func updateInfraChartsFromInstall(in *v1beta1.Installation, clusterConfig *k0sv1
 			charts[i].ForceUpgrade = ptr.To(false)
 		}
 
+		if slices.Contains(ecCharts, chart.Name) && in.Spec.AirgapRegistry != "" {
+			// the images were pushed to the airgap registry instead of the embedded one.
+			values, err := airgap.RewriteChartValues(chart.Values, in.Spec.AirgapRegistry)
+			if err != nil {
+				return nil, fmt.Errorf("rewrite %s images: %w", chart.Name, err)
+			}
+			charts[i].Values, chart.Values = values, values
+		}
+
+		if chart.Name == placement.AdminConsoleChart || chart.Name == placement.RegistryChart {
+			// the admin console and the registry may be pinned to a subset of the nodes.
+			values, err := placement.ChartValues(chart.Name, chart.Values, installPlacement(in))
+			if err != nil {
+				return nil, fmt.Errorf("set %s placement: %w", chart.Name, err)
+			}
+			charts[i].Values, chart.Values = values, values
+		}
+
+		if chart.Name == storageplan.OpenEBSChart || chart.Name == storageplan.RegistryChart {
+			// the volumes are kept where they were placed at install time.
+			values, err := storageplan.ChartValues(chart.Name, chart.Values, in.Spec.Storage)
+			if err != nil {
+				return nil, fmt.Errorf("set %s storage: %w", chart.Name, err)
+			}
+			charts[i].Values, chart.Values = values, values
+		}
+
 		if chart.Name == "admin-console" {
 			newVals, err := helm.UnmarshalValues(chart.Values)
 			if err != nil {
@@ -178,6 +228,12 @@ func updateInfraChartsFromInstall(in *v1beta1.Installation, clusterConfig *k0sv1
 				}
 			}
 
+			uiEnabled := in.Spec.AdminConsole.GetAuthMode() != v1beta1.AdminConsoleAuthModeDisabled
+			newVals, err = helm.SetValue(newVals, "kurlProxy.enabled", uiEnabled)
+			if err != nil {
+				return nil, fmt.Errorf("set helm values admin-console.kurlProxy.enabled: %w", err)
+			}
+
 			charts[i].Values, err = helm.MarshalValues(newVals)
 			if err != nil {
 				return nil, fmt.Errorf("marshal admin-console.values: %w", err)
@@ -279,10 +335,63 @@ func updateInfraChartsFromInstall(in *v1beta1.Installation, clusterConfig *k0sv1
 				}
 			}
 		}
+		if chart.Name == "replicated" {
+			newVals, err := helm.UnmarshalValues(chart.Values)
+			if err != nil {
+				return nil, fmt.Errorf("unmarshal replicated.values: %w", err)
+			}
+
+			// the license is only available at install time so we carry the license
+			// related values over from the currently deployed chart.
+			previous, err := deployedChartValues(clusterConfig, chart.Name)
+			if err != nil {
+				return nil, fmt.Errorf("get deployed replicated.values: %w", err)
+			}
+			for _, key := range replicatedSDKLicenseValues {
+				if value, ok := previous[key]; ok {
+					newVals[key] = value
+				}
+			}
+
+			newVals, err = helm.SetValue(newVals, "isAirgap", in.Spec.AirGap)
+			if err != nil {
+				return nil, fmt.Errorf("set helm values replicated.isAirgap: %w", err)
+			}
+
+			charts[i].Values, err = helm.MarshalValues(newVals)
+			if err != nil {
+				return nil, fmt.Errorf("marshal replicated.values: %w", err)
+			}
+		}
 	}
 	return charts, nil
 }
 
+// replicatedSDKLicenseValues are the Replicated SDK values set from the license
+// during the installation.
+var replicatedSDKLicenseValues = []string{
+	"license",
+	"licenseFields",
+	"appName",
+	"channelID",
+	"channelName",
+	"replicatedAppEndpoint",
+}
+
+// deployedChartValues returns the values of the chart with the given name as found
+// in the cluster config. Returns nil if the chart is not deployed.
+func deployedChartValues(clusterConfig *k0sv1beta1.ClusterConfig, name string) (map[string]interface{}, error) {
+	if clusterConfig == nil || clusterConfig.Spec == nil || clusterConfig.Spec.Extensions == nil || clusterConfig.Spec.Extensions.Helm == nil {
+		return nil, nil
+	}
+	for _, chart := range clusterConfig.Spec.Extensions.Helm.Charts {
+		if chart.Name == name {
+			return helm.UnmarshalValues(chart.Values)
+		}
+	}
+	return nil, nil
+}
+
 // applyUserProvidedAddonOverrides applies user-provided overrides to the HelmExtensions spec.
 func applyUserProvidedAddonOverrides(in *clusterv1beta1.Installation, combinedConfigs *v1beta1.Helm) (*v1beta1.Helm, error) {
 	if in == nil || in.Spec.Config == nil {
@@ -908,6 +908,117 @@ secrets:
 				},
 			},
 		},
+		{
+			name: "replicated sdk keeps license values",
+			args: args{
+				in: &v1beta1.Installation{
+					Spec: v1beta1.InstallationSpec{
+						AirGap: true,
+					},
+				},
+				clusterConfig: k0sv1beta1.ClusterConfig{
+					Spec: &k0sv1beta1.ClusterSpec{
+						Extensions: &k0sv1beta1.ClusterExtensions{
+							Helm: &k0sv1beta1.HelmExtensions{
+								Charts: []k0sv1beta1.Chart{
+									{
+										Name:   "replicated",
+										Values: "appName: app\nisAirgap: false\nlicense: license-data\n",
+									},
+								},
+							},
+						},
+					},
+				},
+				charts: []v1beta1.Chart{
+					{
+						Name:   "replicated",
+						Values: "images:\n  replicated-sdk: sdk:new\nisAirgap: false\n",
+					},
+				},
+			},
+			want: []v1beta1.Chart{
+				{
+					Name:         "replicated",
+					Values:       "appName: app\nimages:\n  replicated-sdk: sdk:new\nisAirgap: true\nlicense: license-data\n",
+					ForceUpgrade: ptr.To(false),
+				},
+			},
+		},
+		{
+			name: "images hosted in an airgap registry",
+			args: args{
+				in: &v1beta1.Installation{
+					Spec: v1beta1.InstallationSpec{
+						AirGap:         true,
+						AirgapRegistry: "harbor.example.com/ec",
+					},
+				},
+				charts: []v1beta1.Chart{
+					{
+						Name:   "openebs",
+						Values: "image:\n  registry: proxy.replicated.com/anonymous/\n  repository: replicated/ec-openebs\n",
+					},
+					{
+						Name:   "test",
+						Values: "image: proxy.replicated.com/anonymous/vendor/app:1.0\n",
+					},
+				},
+			},
+			want: []v1beta1.Chart{
+				{
+					Name:         "openebs",
+					Values:       "image:\n  registry: harbor.example.com/ec/anonymous/\n  repository: replicated/ec-openebs\n",
+					ForceUpgrade: ptr.To(false),
+				},
+				{
+					Name:   "test",
+					Values: "image: proxy.replicated.com/anonymous/vendor/app:1.0\n",
+				},
+			},
+		},
+		{
+			name: "admin console and registry placement",
+			args: args{
+				in: &v1beta1.Installation{
+					Spec: v1beta1.InstallationSpec{
+						ClusterID: "testid",
+						AirGap:    true,
+						Config: &v1beta1.ConfigSpec{
+							Placement: &v1beta1.Placement{
+								AdminConsole: &v1beta1.NodePlacement{Nodes: []string{"node-1"}},
+								Registry:     &v1beta1.NodePlacement{Nodes: []string{"node-2"}},
+							},
+						},
+						EndUserPlacement: &v1beta1.Placement{
+							AdminConsole: &v1beta1.NodePlacement{NodeSelector: map[string]string{"disk": "ssd"}},
+						},
+					},
+				},
+				charts: []v1beta1.Chart{
+					{
+						Name:   "admin-console",
+						Values: "abc: xyz",
+					},
+					{
+						Name:   "docker-registry",
+						Values: "this: that",
+					},
+				},
+			},
+			want: []v1beta1.Chart{
+				{
+					Name:         "admin-console",
+					Values:       "abc: xyz\nembeddedClusterID: testid\nisAirgap: \"true\"\nisHA: false\nnodeSelector:\n  disk: ssd\n",
+					ForceUpgrade: ptr.To(false),
+				},
+				{
+					Name:         "docker-registry",
+					Values:       "affinity:\n  nodeAffinity:\n    requiredDuringSchedulingIgnoredDuringExecution:\n      nodeSelectorTerms:\n      - matchExpressions:\n        - key: kubernetes.io/hostname\n          operator: In\n          values:\n          - node-2\nthis: that\n",
+					ForceUpgrade: ptr.To(false),
+				},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
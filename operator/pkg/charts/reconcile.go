@@ -9,6 +9,8 @@ import (
 	v1beta2 "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
 	"github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/release"
+	"github.com/replicatedhq/embedded-cluster/pkg/rendersnapshot"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -55,6 +57,9 @@ func ReconcileHelmCharts(ctx context.Context, cli client.Client, in *v1beta1.Ins
 	if err != nil {
 		return fmt.Errorf("failed to get helm charts from installation: %w", err)
 	}
+	if err := updateSeaweedfsReplication(ctx, cli, combinedConfigs.Charts); err != nil {
+		return fmt.Errorf("failed to update seaweedfs replication: %w", err)
+	}
 
 	cfgs := &v1beta2.HelmExtensions{}
 	cfgs, err = v1beta1.ConvertTo(*combinedConfigs, cfgs)
@@ -122,6 +127,20 @@ func ReconcileHelmCharts(ctx context.Context, cli client.Client, in *v1beta1.Ins
 		return nil
 	}
 
+	// keep track of the values rendered so support can reproduce them, this must not
+	// block the upgrade.
+	snap := rendersnapshot.Snapshot{
+		Time:         metav1.Now(),
+		Source:       rendersnapshot.SourceUpgrade,
+		Version:      in.Spec.Config.Version,
+		Installation: in.Name,
+		Overrides:    in.Spec.EndUserK0sConfigOverrides,
+		ValuesHashes: rendersnapshot.ValuesHashes(cfgs.Charts),
+	}
+	if err := rendersnapshot.Record(ctx, cli, snap); err != nil {
+		log.Error(err, "Failed to record the rendered helm values")
+	}
+
 	// Replace the current chart configs with the new chart configs
 	clusterConfig.Spec.Extensions.Helm = cfgs
 	in.Status.SetState(v1beta1.InstallationStateAddonsInstalling, "Installing addons", nil)
@@ -9,7 +9,9 @@ import (
 	"github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
 	ectypes "github.com/replicatedhq/embedded-cluster/kinds/types"
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/release"
+	"github.com/replicatedhq/embedded-cluster/pkg/rendersnapshot"
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/discovery"
@@ -887,6 +889,7 @@ password: original`,
 			sch := runtime.NewScheme()
 			req.NoError(k0sv1beta1.AddToScheme(sch))
 			req.NoError(k0shelmv1beta1.AddToScheme(sch))
+			req.NoError(corev1.AddToScheme(sch))
 			fakeCli := fake.NewClientBuilder().WithScheme(sch).WithRuntimeObjects(tt.fields.State...).Build()
 
 			err := ReconcileHelmCharts(context.Background(), fakeCli, &tt.in)
@@ -899,6 +902,12 @@ password: original`,
 				req.NoError(err)
 				req.ElementsMatch(tt.updatedHelm.Charts, gotCluster.Spec.Extensions.Helm.Charts)
 				req.ElementsMatch(tt.updatedHelm.Repositories, gotCluster.Spec.Extensions.Helm.Repositories)
+
+				snapshots, err := rendersnapshot.List(context.Background(), fakeCli)
+				req.NoError(err)
+				req.Len(snapshots, 1)
+				req.Equal(rendersnapshot.SourceUpgrade, snapshots[0].Source)
+				req.Equal(rendersnapshot.ValuesHashes(gotCluster.Spec.Extensions.Helm.Charts), snapshots[0].ValuesHashes)
 			}
 		})
 	}
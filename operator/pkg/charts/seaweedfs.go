@@ -0,0 +1,58 @@
+package charts
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/ohler55/ojg/jp"
+	"github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/helm"
+	"github.com/replicatedhq/embedded-cluster/pkg/highavailability"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// seaweedfsReplicationScript matches the replication set by the seaweedfs master
+// maintenance scripts.
+var seaweedfsReplicationScript = regexp.MustCompile(`-replication \d{3}`)
+
+// updateSeaweedfsReplication spreads the copies of the seaweedfs data across the zones,
+// or racks, the controllers were assigned to.
+func updateSeaweedfsReplication(ctx context.Context, cli client.Client, charts []v1beta1.Chart) error {
+	for i, chart := range charts {
+		if chart.Name != "seaweedfs" {
+			continue
+		}
+		replication, err := highavailability.StorageReplication(ctx, cli)
+		if err != nil {
+			return fmt.Errorf("determine seaweedfs replication: %w", err)
+		}
+		values, err := seaweedfsReplicationValues(chart.Values, replication)
+		if err != nil {
+			return fmt.Errorf("set seaweedfs replication: %w", err)
+		}
+		charts[i].Values = values
+	}
+	return nil
+}
+
+// seaweedfsReplicationValues sets the replication of new volumes and the one the master
+// maintenance scripts apply to the existing volumes.
+func seaweedfsReplicationValues(values string, replication string) (string, error) {
+	vals, err := helm.UnmarshalValues(values)
+	if err != nil {
+		return "", fmt.Errorf("unmarshal seaweedfs.values: %w", err)
+	}
+	vals, err = helm.SetValue(vals, "global.replicationPlacment", replication)
+	if err != nil {
+		return "", fmt.Errorf("set helm values seaweedfs.global.replicationPlacment: %w", err)
+	}
+	if config, ok := jp.C("master").C("config").First(vals).(string); ok {
+		config = seaweedfsReplicationScript.ReplaceAllString(config, "-replication "+replication)
+		vals, err = helm.SetValue(vals, "master.config", config)
+		if err != nil {
+			return "", fmt.Errorf("set helm values seaweedfs.master.config: %w", err)
+		}
+	}
+	return helm.MarshalValues(vals)
+}
@@ -0,0 +1,30 @@
+package charts
+
+import (
+	"testing"
+
+	"github.com/ohler55/ojg/jp"
+	"github.com/replicatedhq/embedded-cluster/pkg/helm"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_seaweedfsReplicationValues(t *testing.T) {
+	values := `global:
+  replicationPlacment: "001"
+master:
+  config: |-
+    scripts = """
+      volume.configure.replication -replication 001 -collectionPattern *
+      volume.fix.replication
+    """
+`
+	got, err := seaweedfsReplicationValues(values, "100")
+	require.NoError(t, err)
+
+	vals, err := helm.UnmarshalValues(got)
+	require.NoError(t, err)
+	require.Equal(t, "100", jp.C("global").C("replicationPlacment").First(vals))
+	config := jp.C("master").C("config").First(vals).(string)
+	require.Contains(t, config, "volume.configure.replication -replication 100 -collectionPattern *")
+	require.NotContains(t, config, "001")
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/etcd"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/k8sutil"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// EtcdMaintenanceCmd returns a cobra command running the maintenance of the etcd member
+// of the node it runs on. It is run by the operator in a job scheduled on each
+// controller node.
+func EtcdMaintenanceCmd() *cobra.Command {
+	var nodeName, endpoint, pkiDir string
+	var thresholdPercent int
+
+	cmd := &cobra.Command{
+		Use:          "etcd-maintenance",
+		Short:        "Defragment the local etcd member and report its state",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if nodeName == "" {
+				return fmt.Errorf("node name is required")
+			}
+
+			kcli, err := k8sutil.KubeClient()
+			if err != nil {
+				return fmt.Errorf("failed to create kubernetes client: %w", err)
+			}
+
+			ecli, err := etcd.NewClient(endpoint, pkiDir)
+			if err != nil {
+				return fmt.Errorf("failed to create etcd client: %w", err)
+			}
+			defer ecli.Close()
+
+			result := etcd.Maintain(cmd.Context(), ecli, endpoint, nodeName, thresholdPercent)
+			if err := etcd.RecordResult(cmd.Context(), kcli, result); err != nil {
+				return fmt.Errorf("failed to record result: %w", err)
+			}
+
+			size := resource.NewQuantity(result.DBSize, resource.BinarySI)
+			fmt.Printf("Database size %s, fragmentation %.1f%%\n", size, result.Fragmentation)
+			if result.Defragmented {
+				reclaimed := resource.NewQuantity(result.Reclaimed, resource.BinarySI)
+				fmt.Printf("Defragmented member, reclaimed %s\n", reclaimed)
+			}
+			fmt.Printf("%d revisions since last compaction\n", result.RevisionsSinceCompaction())
+			if result.Error != "" {
+				return fmt.Errorf("maintenance failed: %s", result.Error)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&nodeName, "node-name", os.Getenv("NODE_NAME"), "Name of the node the etcd member runs on")
+	cmd.Flags().StringVar(&endpoint, "endpoint", etcd.DefaultEndpoint, "Address of the etcd member")
+	cmd.Flags().StringVar(&pkiDir, "pki-dir", etcd.DefaultPKIDir, "Directory holding the k0s certificates")
+	cmd.Flags().IntVar(&thresholdPercent, "defrag-threshold", etcd.DefaultDefragThresholdPercent, "Fragmentation percentage above which the member is defragmented")
+
+	return cmd
+}
@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	clusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/hostbackup"
+)
+
+// HostBackupCmd returns the cobra command run by the host backup agent. The agent runs
+// on every node and Velero hooks execute the stage and restore subcommands in it.
+func HostBackupCmd() *cobra.Command {
+	var hostRoot, stagingDir string
+
+	cmd := &cobra.Command{
+		Use:          "host-backup",
+		Short:        "Back up and restore host paths as part of the disaster recovery backups",
+		SilenceUsage: true,
+	}
+
+	agent := &cobra.Command{
+		Use:          "agent",
+		Short:        "Wait for Velero to run the backup and restore hooks",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rules, err := hostBackupRules()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Including %v, excluding %v\n", rules.Include, rules.Exclude)
+			sig := make(chan os.Signal, 1)
+			signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+			<-sig
+			return nil
+		},
+	}
+
+	stage := &cobra.Command{
+		Use:          "stage",
+		Short:        "Copy the included host paths to the staging directory",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rules, err := hostBackupRules()
+			if err != nil {
+				return err
+			}
+			count, err := hostbackup.Stage(hostRoot, stagingDir, rules)
+			if err != nil {
+				return fmt.Errorf("failed to stage host paths: %w", err)
+			}
+			fmt.Printf("Staged %d files for backup\n", count)
+			return nil
+		},
+	}
+
+	restore := &cobra.Command{
+		Use:          "restore",
+		Short:        "Copy the staged host paths back to the host",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			count, err := hostbackup.Restore(stagingDir, hostRoot)
+			if err != nil {
+				return fmt.Errorf("failed to restore host paths: %w", err)
+			}
+			fmt.Printf("Restored %d files to the host\n", count)
+			return nil
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&hostRoot, "host-root", hostbackup.HostRoot, "Directory the host filesystem is mounted at")
+	cmd.PersistentFlags().StringVar(&stagingDir, "staging-dir", hostbackup.StagingDir, "Directory the host paths are staged in for Velero")
+	cmd.AddCommand(agent, stage, restore)
+	return cmd
+}
+
+// hostBackupRules reads the host backup rules set by the operator in the agent
+// environment.
+func hostBackupRules() (clusterv1beta1.HostBackup, error) {
+	var rules clusterv1beta1.HostBackup
+	if err := json.Unmarshal([]byte(os.Getenv(hostbackup.RulesEnv)), &rules); err != nil {
+		return rules, fmt.Errorf("failed to parse %s: %w", hostbackup.RulesEnv, err)
+	}
+	return rules, nil
+}
@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/hostrepair"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/k8sutil"
+	"github.com/replicatedhq/embedded-cluster/pkg/conntrack"
+)
+
+// HostRepairCmd returns the cobra command run by the host repair agent on every node.
+func HostRepairCmd() *cobra.Command {
+	var nodeName, hostRoot string
+	var interval, conntrackInterval time.Duration
+
+	cmd := &cobra.Command{
+		Use:          "host-repair",
+		Short:        "Restore the host configuration files missing on the nodes and converge their systemd units",
+		SilenceUsage: true,
+	}
+
+	agent := &cobra.Command{
+		Use:          "agent",
+		Short:        "Periodically restore the missing host configuration files and watch the conntrack table",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if nodeName == "" {
+				return fmt.Errorf("node name is required")
+			}
+
+			kcli, err := k8sutil.KubeClient()
+			if err != nil {
+				return fmt.Errorf("failed to create kubernetes client: %w", err)
+			}
+
+			sd := hostrepair.NewSystemd()
+			ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM)
+			defer stop()
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			// the conntrack table fills up much faster than files go missing.
+			conntrackTicker := time.NewTicker(conntrackInterval)
+			defer conntrackTicker.Stop()
+			repair, monitor := true, true
+			for {
+				if repair {
+					repaired, err := hostrepair.Repair(ctx, kcli, sd, nodeName, hostRoot)
+					for _, repair := range repaired {
+						fmt.Printf("Repaired %s\n", repair)
+					}
+					if err != nil {
+						fmt.Printf("Failed to repair host configuration: %v\n", err)
+					}
+					added, err := hostrepair.ConvergeAPISANs(ctx, kcli, sd, nodeName, hostRoot)
+					if len(added) > 0 {
+						fmt.Printf("Restarted k0s with the api SANs %s\n", strings.Join(added, ", "))
+					}
+					if err != nil {
+						fmt.Printf("Failed to converge api SANs: %v\n", err)
+					}
+					restarted, err := hostrepair.ConvergeEncryptionConfig(ctx, kcli, sd, nodeName, hostRoot)
+					if restarted {
+						fmt.Printf("Restarted k0s with the encryption config of the cluster\n")
+					}
+					if err != nil {
+						fmt.Printf("Failed to converge encryption config: %v\n", err)
+					}
+				}
+				if monitor {
+					usage, err := hostrepair.MonitorConntrack(ctx, kcli, nodeName, "/proc")
+					if err != nil {
+						fmt.Printf("Failed to check conntrack table: %v\n", err)
+					} else if usage.Level() != conntrack.LevelOK {
+						fmt.Printf("Conntrack table nearly full: %s\n", usage)
+					}
+				}
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-ticker.C:
+					repair, monitor = true, false
+				case <-conntrackTicker.C:
+					repair, monitor = false, true
+				}
+			}
+		},
+	}
+
+	agent.Flags().StringVar(&nodeName, "node-name", os.Getenv(hostrepair.NodeNameEnv), "Name of the node the agent runs on")
+	agent.Flags().DurationVar(&interval, "interval", 5*time.Minute, "How often the host configuration is checked")
+	agent.Flags().DurationVar(&conntrackInterval, "conntrack-interval", 30*time.Second, "How often the usage of the conntrack table is checked")
+	cmd.PersistentFlags().StringVar(&hostRoot, "host-root", hostrepair.HostRoot, "Directory the host filesystem is mounted at")
+	cmd.AddCommand(agent)
+	return cmd
+}
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/k8sutil"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/prestage"
+)
+
+// PrestageCmd returns the cobra command run by the jobs downloading the artifacts of the
+// next release on every node.
+func PrestageCmd() *cobra.Command {
+	var opts prestage.Options
+
+	cmd := &cobra.Command{
+		Use:          "prestage",
+		Short:        "Download the artifacts of the next release ahead of its upgrade",
+		SilenceUsage: true,
+	}
+
+	run := &cobra.Command{
+		Use:          "run",
+		Short:        "Download the k0s binary and pull the images of a release on this node",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.Version == "" {
+				return fmt.Errorf("version is required")
+			}
+
+			kcli, err := k8sutil.KubeClient()
+			if err != nil {
+				return fmt.Errorf("failed to create kubernetes client: %w", err)
+			}
+
+			opts.Logf = func(format string, args ...interface{}) {
+				fmt.Printf(format+"\n", args...)
+			}
+			if err := prestage.Run(cmd.Context(), kcli, opts); err != nil {
+				return fmt.Errorf("failed to prestage version %s: %w", opts.Version, err)
+			}
+			fmt.Printf("Artifacts of version %s staged\n", opts.Version)
+			return nil
+		},
+	}
+
+	run.Flags().StringVar(&opts.Version, "version", "", "Embedded cluster version whose artifacts are downloaded")
+	run.Flags().StringVar(&opts.DataDir, "data-dir", prestage.DataDir, "Directory the host embedded cluster directory is mounted at")
+	run.Flags().StringVar(&opts.ContainerdAddress, "containerd-address", prestage.ContainerdAddress, "Address of the containerd the images are pulled into")
+	run.Flags().StringVar(&opts.HostsDir, "hosts-dir", "", "Containerd registry hosts directory the images are pulled through")
+	cmd.AddCommand(run)
+	return cmd
+}
@@ -1,20 +1,28 @@
 package cli
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"os"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"k8s.io/client-go/discovery"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	"github.com/replicatedhq/embedded-cluster/operator/controllers"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/etcd"
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/k8sutil"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/status"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/webhooks"
 )
 
 var (
@@ -26,6 +34,7 @@ func RootCmd() *cobra.Command {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var statusAddr string
 
 	cmd := &cobra.Command{
 		Use:          "manager",
@@ -46,8 +55,11 @@ func RootCmd() *cobra.Command {
 			zaplog := zap.New(zap.UseDevMode(true))
 			ctrl.SetLogger(zaplog)
 
+			secretsByObject, secretsClient := controllers.SecretCacheOptions()
 			mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 				Scheme: k8sutil.Scheme(),
+				Cache:  cache.Options{ByObject: secretsByObject},
+				Client: client.Options{Cache: secretsClient},
 				Metrics: metricsserver.Options{
 					BindAddress: metricsAddr,
 				},
@@ -62,24 +74,66 @@ func RootCmd() *cobra.Command {
 				os.Exit(1)
 			}
 
+			tracker := status.NewTracker()
 			if err = (&controllers.InstallationReconciler{
-				Client:    mgr.GetClient(),
-				Scheme:    mgr.GetScheme(),
-				Discovery: discovery.NewDiscoveryClientForConfigOrDie(ctrl.GetConfigOrDie()),
+				Client:        mgr.GetClient(),
+				Scheme:        mgr.GetScheme(),
+				Discovery:     discovery.NewDiscoveryClientForConfigOrDie(ctrl.GetConfigOrDie()),
+				StatusTracker: tracker,
+				Recorder:      mgr.GetEventRecorderFor("embedded-cluster-operator"),
 			}).SetupWithManager(mgr); err != nil {
 				setupLog.Error(err, "unable to create controller", "controller", "Installation")
 				os.Exit(1)
 			}
+			if err = (&controllers.NodeReconciler{
+				Client: mgr.GetClient(),
+				Scheme: mgr.GetScheme(),
+			}).SetupWithManager(mgr); err != nil {
+				setupLog.Error(err, "unable to create controller", "controller", "Node")
+				os.Exit(1)
+			}
+			if err = (&controllers.NodeConfigReconciler{
+				Client: mgr.GetClient(),
+				Scheme: mgr.GetScheme(),
+			}).SetupWithManager(mgr); err != nil {
+				setupLog.Error(err, "unable to create controller", "controller", "NodeConfig")
+				os.Exit(1)
+			}
+			if err = (&controllers.ImagePullSecretReconciler{
+				Client: mgr.GetClient(),
+				Scheme: mgr.GetScheme(),
+			}).SetupWithManager(mgr); err != nil {
+				setupLog.Error(err, "unable to create controller", "controller", "ImagePullSecret")
+				os.Exit(1)
+			}
 
 			if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 				setupLog.Error(err, "unable to set up health check")
 				os.Exit(1)
 			}
-			if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+			if err := mgr.AddReadyzCheck("readyz", cacheSyncedCheck(mgr)); err != nil {
 				setupLog.Error(err, "unable to set up ready check")
 				os.Exit(1)
 			}
 
+			if statusAddr != "0" {
+				if err := mgr.Add(status.NewServer(statusAddr, tracker)); err != nil {
+					setupLog.Error(err, "unable to set up status server")
+					os.Exit(1)
+				}
+			}
+
+			image := os.Getenv("EMBEDDEDCLUSTER_IMAGE")
+			if err := mgr.Add(etcd.NewMaintainer(mgr.GetClient(), image)); err != nil {
+				setupLog.Error(err, "unable to set up etcd maintenance")
+				os.Exit(1)
+			}
+
+			if err := mgr.Add(webhooks.NewDispatcher(mgr.GetClient())); err != nil {
+				setupLog.Error(err, "unable to set up webhooks dispatcher")
+				os.Exit(1)
+			}
+
 			setupLog.Info("Starting manager")
 			if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
 				setupLog.Error(err, "problem running manager")
@@ -94,6 +148,7 @@ func RootCmd() *cobra.Command {
 
 	cmd.Flags().StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	cmd.Flags().StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	cmd.Flags().StringVar(&statusAddr, "status-bind-address", ":8082", "The address the status api binds to. Use 0 to disable it.")
 	cmd.Flags().BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
@@ -101,6 +156,19 @@ func RootCmd() *cobra.Command {
 	return cmd
 }
 
+// cacheSyncedCheck returns a readiness check that fails until the manager caches have
+// been synced, i.e. until the operator is able to reconcile.
+func cacheSyncedCheck(mgr ctrl.Manager) healthz.Checker {
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), time.Second)
+		defer cancel()
+		if !mgr.GetCache().WaitForCacheSync(ctx) {
+			return fmt.Errorf("caches not synced")
+		}
+		return nil
+	}
+}
+
 func setupCLILog(cmd *cobra.Command, level logrus.Level) error {
 	log, err := NewLogger(level)
 	if err != nil {
@@ -116,5 +184,9 @@ func addSubcommands(cmd *cobra.Command) {
 		MigrateCmd(),
 		UpgradeCmd(),
 		UpgradeJobCmd(),
+		EtcdMaintenanceCmd(),
+		HostBackupCmd(),
+		HostRepairCmd(),
+		PrestageCmd(),
 	)
 }
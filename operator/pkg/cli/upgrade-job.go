@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -8,6 +9,7 @@ import (
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/k8sutil"
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/metrics"
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/upgrade"
+	ecerrors "github.com/replicatedhq/embedded-cluster/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
@@ -42,6 +44,16 @@ func UpgradeJobCmd() *cobra.Command {
 
 			fmt.Printf("Upgrading to installation %s (version %s)\n", in.Name, in.Spec.Config.Version)
 
+			lock, err := upgrade.AcquireLock(cmd.Context(), cli, in)
+			if err != nil {
+				return fmt.Errorf("acquire cluster lock: %w", err)
+			}
+			defer func() {
+				if err := lock.Release(context.Background()); err != nil {
+					fmt.Printf("Failed to release the cluster lock: %v\n", err)
+				}
+			}()
+
 			i := 0
 			allErrors := []string{}
 			sleepDuration := time.Second * 5
@@ -52,17 +64,18 @@ func UpgradeJobCmd() *cobra.Command {
 					allErrors = append(allErrors, err.Error())
 					if i >= 10 {
 						if !in.Spec.AirGap {
-							err = metrics.NotifyUpgradeFailed(cmd.Context(), in.Spec.MetricsBaseURL, metrics.UpgradeFailedEvent{
+							notifyErr := metrics.NotifyUpgradeFailed(cmd.Context(), in.Spec.MetricsBaseURL, metrics.UpgradeFailedEvent{
 								ClusterID:      in.Spec.ClusterID,
 								TargetVersion:  in.Spec.Config.Version,
 								InitialVersion: previousInstallationVersion,
 								Reason:         strings.Join(allErrors, ", "),
+								ErrorKind:      string(ecerrors.KindOf(err)),
 							})
-							if err != nil {
-								fmt.Printf("failed to report that the upgrade was started: %v\n", err)
+							if notifyErr != nil {
+								fmt.Printf("failed to report that the upgrade was started: %v\n", notifyErr)
 							}
 						}
-						return fmt.Errorf("failed to upgrade after %s", (sleepDuration * time.Duration(i)).String())
+						return fmt.Errorf("failed to upgrade after %s: %w", (sleepDuration * time.Duration(i)).String(), err)
 					}
 
 					time.Sleep(sleepDuration)
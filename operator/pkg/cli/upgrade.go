@@ -44,6 +44,12 @@ func UpgradeCmd() *cobra.Command {
 
 			fmt.Printf("Preparing upgrade to installation %s (k0s version %s)\n", in.Name, in.Spec.Config.Version)
 
+			// nodes joining and updates run from the nodes hold the cluster lock, the upgrade
+			// is refused while they run.
+			if err := upgrade.HoldLock(cmd.Context(), cli, in); err != nil {
+				return fmt.Errorf("hold cluster lock: %w", err)
+			}
+
 			// create the installation object so that kotsadm can immediately find it and watch it for the upgrade process
 			err = upgrade.CreateInstallation(cmd.Context(), cli, in)
 			if err != nil {
@@ -0,0 +1,222 @@
+// Package dynamicconfig computes the cluster wide portion of the k0s configuration out of
+// the overrides present in an Installation object. k0s runs with --enable-dynamic-config,
+// this means the ClusterConfig object in the kube-system namespace is the source of truth
+// for everything but the node local settings (api, storage, etc). Of these, the api SANs
+// are added to the k0s.yaml of the controllers by the host repair agents.
+package dynamicconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/k0sproject/dig"
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/nodeconfig"
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// staticFields holds the spec paths that k0s does not read from the dynamic config. These
+// are read from the k0s.yaml file present on each of the controller nodes. Extensions are
+// also dynamic but they are managed by the charts reconciler.
+var staticFields = [][]string{
+	{"api"},
+	{"storage"},
+	{"install"},
+	{"network", "serviceCIDR"},
+	{"network", "clusterDomain"},
+}
+
+// Result is the outcome of applying the installation overrides to a cluster config.
+type Result struct {
+	// Config is the patched cluster configuration.
+	Config *k0sv1beta1.ClusterConfig
+	// Changed indicates if the patched configuration differs from the original.
+	Changed bool
+	// IgnoredFields holds the static fields present in the overrides. These can't
+	// be applied through the dynamic config.
+	IgnoredFields []string
+}
+
+// Apply applies the cluster wide portion of the vendor and end user k0s overrides found in
+// the installation on top of the provided cluster configuration. The vendor overrides are
+// applied first, followed by the end user ones.
+func Apply(current *k0sv1beta1.ClusterConfig, in *v1beta1.Installation) (*Result, error) {
+	overrides := []string{}
+	if in.Spec.Config != nil {
+		overrides = append(overrides, in.Spec.Config.UnsupportedOverrides.K0s)
+	}
+	overrides = append(overrides, in.Spec.EndUserK0sConfigOverrides)
+
+	original, err := json.Marshal(current)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal cluster config: %w", err)
+	}
+
+	result := &Result{}
+	patched := original
+	for _, override := range overrides {
+		patch, ignored, err := ExtractDynamicPatch(override)
+		if err != nil {
+			return nil, fmt.Errorf("unable to extract dynamic config patch: %w", err)
+		}
+		result.IgnoredFields = append(result.IgnoredFields, ignored...)
+		// a merge patch replaces whole arrays, the worker profiles are merged by name
+		// instead so the ones the override does not mention are kept.
+		profiles, hasProfiles := patch["workerProfiles"]
+		delete(patch, "workerProfiles")
+		if len(patch) > 0 {
+			data, err := json.Marshal(dig.Mapping{"spec": patch})
+			if err != nil {
+				return nil, fmt.Errorf("unable to marshal patch: %w", err)
+			}
+			if patched, err = jsonpatch.MergePatch(patched, data); err != nil {
+				return nil, fmt.Errorf("unable to patch cluster config: %w", err)
+			}
+		}
+		if hasProfiles {
+			if patched, err = mergeWorkerProfiles(patched, profiles); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var cfg k0sv1beta1.ClusterConfig
+	if err := json.Unmarshal(patched, &cfg); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal patched cluster config: %w", err)
+	}
+	result.Config = &cfg
+	result.Changed = !jsonpatch.Equal(original, patched)
+	sort.Strings(result.IgnoredFields)
+	return result, nil
+}
+
+// mergeWorkerProfiles merges the worker profiles of an override into the ones of the
+// cluster config by name, the values of a profile present in both are merged. Profiles the
+// override does not mention are kept, the default one may hold the hardening settings of
+// the installation. The profiles rendered out of NodeConfigs are owned by the NodeConfig
+// controller and never overridden.
+func mergeWorkerProfiles(config []byte, override interface{}) ([]byte, error) {
+	data, err := json.Marshal(override)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal worker profiles override: %w", err)
+	}
+	var profiles []k0sv1beta1.WorkerProfile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal worker profiles override: %w", err)
+	}
+	var cfg k0sv1beta1.ClusterConfig
+	if err := json.Unmarshal(config, &cfg); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal cluster config: %w", err)
+	}
+	for _, profile := range profiles {
+		if strings.HasPrefix(profile.Name, nodeconfig.ProfilePrefix) {
+			continue
+		}
+		idx := slices.IndexFunc(cfg.Spec.WorkerProfiles, func(p k0sv1beta1.WorkerProfile) bool {
+			return p.Name == profile.Name
+		})
+		if idx < 0 {
+			cfg.Spec.WorkerProfiles = append(cfg.Spec.WorkerProfiles, profile)
+			continue
+		}
+		existing := cfg.Spec.WorkerProfiles[idx]
+		switch {
+		case profile.Config == nil || len(profile.Config.Raw) == 0:
+			profile.Config = existing.Config
+		case existing.Config != nil && len(existing.Config.Raw) > 0:
+			values, err := jsonpatch.MergePatch(existing.Config.Raw, profile.Config.Raw)
+			if err != nil {
+				return nil, fmt.Errorf("unable to merge worker profile %s: %w", profile.Name, err)
+			}
+			profile.Config = &runtime.RawExtension{Raw: values}
+		}
+		cfg.Spec.WorkerProfiles[idx] = profile
+	}
+	return json.Marshal(&cfg)
+}
+
+// ExtractDynamicPatch parses the provided override (a yaml with the k0s config under the
+// `config` property) and returns its spec without the fields that can't be changed by
+// means of the dynamic config. The removed fields are returned as well.
+func ExtractDynamicPatch(override string) (dig.Mapping, []string, error) {
+	if override == "" {
+		return nil, nil, nil
+	}
+	config := dig.Mapping{}
+	if err := yaml.Unmarshal([]byte(override), &config); err != nil {
+		return nil, nil, fmt.Errorf("unable to unmarshal override: %w", err)
+	}
+	spec := config.DigMapping("config", "spec")
+	delete(spec, "extensions")
+	// the api SANs are applied by the host repair agents, see APISANs.
+	api := spec.DigMapping("api")
+	delete(api, "sans")
+	if len(api) == 0 {
+		delete(spec, "api")
+	}
+
+	var ignored []string
+	for _, path := range staticFields {
+		parent := spec
+		if len(path) > 1 {
+			parent = spec.DigMapping(path[:len(path)-1]...)
+		}
+		key := path[len(path)-1]
+		if _, ok := parent[key]; !ok {
+			continue
+		}
+		delete(parent, key)
+		ignored = append(ignored, fmt.Sprintf("spec.%s", strings.Join(path, ".")))
+	}
+
+	// removing nested fields may have left empty mappings behind.
+	if network := spec.DigMapping("network"); len(network) == 0 {
+		delete(spec, "network")
+	}
+	return spec, ignored, nil
+}
+
+// APISANs returns the api SANs of the k0s overrides of the installation, the end user ones
+// replacing the vendor ones. They are node local settings the dynamic config can not
+// change, the host repair agents add them to the k0s.yaml of the controllers instead.
+func APISANs(in *v1beta1.Installation) ([]string, error) {
+	overrides := []string{}
+	if in.Spec.Config != nil {
+		overrides = append(overrides, in.Spec.Config.UnsupportedOverrides.K0s)
+	}
+	overrides = append(overrides, in.Spec.EndUserK0sConfigOverrides)
+
+	var sans []string
+	for _, override := range overrides {
+		if override == "" {
+			continue
+		}
+		config := dig.Mapping{}
+		if err := yaml.Unmarshal([]byte(override), &config); err != nil {
+			return nil, fmt.Errorf("unable to unmarshal override: %w", err)
+		}
+		value, ok := config.DigMapping("config", "spec", "api")["sans"]
+		if !ok {
+			continue
+		}
+		list, ok := value.([]interface{})
+		if !ok && value != nil {
+			return nil, fmt.Errorf("spec.api.sans must be a list")
+		}
+		sans = []string{}
+		for _, item := range list {
+			san, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("spec.api.sans must be a list of strings")
+			}
+			sans = append(sans, san)
+		}
+	}
+	return sans, nil
+}
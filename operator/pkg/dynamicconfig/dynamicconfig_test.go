@@ -0,0 +1,151 @@
+package dynamicconfig
+
+import (
+	"testing"
+
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+func TestExtractDynamicPatch(t *testing.T) {
+	override := `
+config:
+  spec:
+    api:
+      sans:
+        - my.host.name
+    network:
+      serviceCIDR: 10.1.0.0/16
+      calico:
+        mode: ipip
+    featureGates:
+      - name: CronJobTimeZone
+        enabled: true
+    extensions:
+      helm:
+        charts: []
+`
+	patch, ignored, err := ExtractDynamicPatch(override)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"spec.network.serviceCIDR"}, ignored, "the api SANs are applied by the host repair agents")
+	assert.NotContains(t, patch, "api")
+	assert.NotContains(t, patch, "extensions")
+	assert.Equal(t, "ipip", patch.DigString("network", "calico", "mode"))
+	assert.Contains(t, patch, "featureGates")
+
+	patch, ignored, err = ExtractDynamicPatch(`
+config:
+  spec:
+    network:
+      clusterDomain: cluster.local
+`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"spec.network.clusterDomain"}, ignored)
+	assert.Empty(t, patch)
+
+	patch, ignored, err = ExtractDynamicPatch("")
+	require.NoError(t, err)
+	assert.Empty(t, ignored)
+	assert.Empty(t, patch)
+}
+
+func TestAPISANs(t *testing.T) {
+	in := &v1beta1.Installation{}
+	sans, err := APISANs(in)
+	require.NoError(t, err)
+	assert.Empty(t, sans)
+
+	in.Spec.Config = &v1beta1.ConfigSpec{
+		UnsupportedOverrides: v1beta1.UnsupportedOverrides{
+			K0s: "config:\n  spec:\n    api:\n      sans:\n        - vendor.example.com\n",
+		},
+	}
+	sans, err = APISANs(in)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"vendor.example.com"}, sans)
+
+	in.Spec.EndUserK0sConfigOverrides = "config:\n  spec:\n    api:\n      sans:\n        - api.example.com\n        - 10.0.0.100\n"
+	sans, err = APISANs(in)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"api.example.com", "10.0.0.100"}, sans)
+
+	in.Spec.EndUserK0sConfigOverrides = "config:\n  spec:\n    api:\n      sans: api.example.com\n"
+	_, err = APISANs(in)
+	assert.EqualError(t, err, "spec.api.sans must be a list")
+}
+
+func TestApply(t *testing.T) {
+	current := k0sv1beta1.DefaultClusterConfig()
+	current.Spec.Network.Provider = "calico"
+
+	t.Run("no overrides", func(t *testing.T) {
+		res, err := Apply(current, &v1beta1.Installation{})
+		require.NoError(t, err)
+		assert.False(t, res.Changed)
+		assert.Empty(t, res.IgnoredFields)
+	})
+
+	t.Run("end user overrides win over vendor ones", func(t *testing.T) {
+		in := &v1beta1.Installation{
+			Spec: v1beta1.InstallationSpec{
+				Config: &v1beta1.ConfigSpec{
+					UnsupportedOverrides: v1beta1.UnsupportedOverrides{
+						K0s: "config:\n  spec:\n    telemetry:\n      enabled: true\n    api:\n      port: 7443\n",
+					},
+				},
+				EndUserK0sConfigOverrides: "config:\n  spec:\n    telemetry:\n      enabled: false\n    workerProfiles:\n      - name: custom\n",
+			},
+		}
+		res, err := Apply(current, in)
+		require.NoError(t, err)
+		assert.True(t, res.Changed)
+		assert.Equal(t, []string{"spec.api"}, res.IgnoredFields)
+		assert.False(t, res.Config.Spec.Telemetry.Enabled)
+		assert.Equal(t, current.Spec.API.Port, res.Config.Spec.API.Port)
+		require.Len(t, res.Config.Spec.WorkerProfiles, 1)
+		assert.Equal(t, "custom", res.Config.Spec.WorkerProfiles[0].Name)
+	})
+	t.Run("worker profiles are merged by name", func(t *testing.T) {
+		current := current.DeepCopy()
+		current.Spec.WorkerProfiles = []k0sv1beta1.WorkerProfile{
+			{Name: "default", Config: &runtime.RawExtension{Raw: []byte(`{"protectKernelDefaults":true,"maxPods":110}`)}},
+			{Name: "nodeconfig-gpu", Config: &runtime.RawExtension{Raw: []byte(`{"maxPods":50}`)}},
+		}
+		in := &v1beta1.Installation{
+			Spec: v1beta1.InstallationSpec{
+				EndUserK0sConfigOverrides: `
+config:
+  spec:
+    workerProfiles:
+      - name: default
+        values:
+          maxPods: 200
+      - name: nodeconfig-gpu
+        values:
+          maxPods: 10
+      - name: custom
+        values:
+          maxPods: 30
+`,
+			},
+		}
+		res, err := Apply(current, in)
+		require.NoError(t, err)
+		assert.True(t, res.Changed)
+		require.Len(t, res.Config.Spec.WorkerProfiles, 3)
+		assert.Equal(t, "default", res.Config.Spec.WorkerProfiles[0].Name)
+		assert.JSONEq(t, `{"protectKernelDefaults":true,"maxPods":200}`, string(res.Config.Spec.WorkerProfiles[0].Config.Raw))
+		assert.Equal(t, "nodeconfig-gpu", res.Config.Spec.WorkerProfiles[1].Name)
+		assert.JSONEq(t, `{"maxPods":50}`, string(res.Config.Spec.WorkerProfiles[1].Config.Raw))
+		assert.Equal(t, "custom", res.Config.Spec.WorkerProfiles[2].Name)
+
+		// applying the same overrides again does not change anything.
+		res, err = Apply(res.Config, in)
+		require.NoError(t, err)
+		assert.False(t, res.Changed)
+	})
+}
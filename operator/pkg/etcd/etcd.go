@@ -0,0 +1,213 @@
+// Package etcd implements the maintenance of the etcd members running on the controller
+// nodes. Members are defragmented when the space not in use by the database exceeds a
+// threshold and the compaction performed by the api server is monitored. Maintenance
+// runs in a job scheduled on each controller node, results are stored in a ConfigMap and
+// exposed by the operator as metrics.
+package etcd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// DefaultEndpoint is the address the local etcd member listens on.
+	DefaultEndpoint = "https://127.0.0.1:2379"
+	// DefaultPKIDir is the directory holding the k0s certificates.
+	DefaultPKIDir = "/var/lib/k0s/pki"
+	// DefaultDefragThresholdPercent is the fragmentation above which members are defragmented.
+	DefaultDefragThresholdPercent = 50
+	// DefaultInterval is the time between maintenance runs.
+	DefaultInterval = 24 * time.Hour
+
+	// minDefragSize is the database size under which members are never defragmented as
+	// the space to be reclaimed is not worth blocking the member.
+	minDefragSize = 64 << 20
+	// compactRevKey is the key the kubernetes api server keeps the last compacted
+	// revision in.
+	compactRevKey = "compact_rev_key"
+)
+
+// Client is the subset of the etcd client used for maintenance.
+type Client interface {
+	Status(ctx context.Context, endpoint string) (*clientv3.StatusResponse, error)
+	Defragment(ctx context.Context, endpoint string) (*clientv3.DefragmentResponse, error)
+	AlarmList(ctx context.Context) (*clientv3.AlarmResponse, error)
+	AlarmDisarm(ctx context.Context, m *clientv3.AlarmMember) (*clientv3.AlarmResponse, error)
+	Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error)
+}
+
+// Result is the outcome of the maintenance of a member.
+type Result struct {
+	// Node is the node the member runs on.
+	Node string `json:"node"`
+	// DBSize is the size of the database, in bytes, after the maintenance.
+	DBSize int64 `json:"dbSize"`
+	// DBSizeInUse is the size of the database, in bytes, in use.
+	DBSizeInUse int64 `json:"dbSizeInUse"`
+	// Fragmentation is the percentage of the database size not in use before the
+	// maintenance.
+	Fragmentation float64 `json:"fragmentation"`
+	// Defragmented indicates the member has been defragmented.
+	Defragmented bool `json:"defragmented"`
+	// Reclaimed is the space, in bytes, reclaimed by the defragmentation.
+	Reclaimed int64 `json:"reclaimed,omitempty"`
+	// Revision is the current revision of the database.
+	Revision int64 `json:"revision"`
+	// CompactRevision is the last revision compacted by the api server.
+	CompactRevision int64 `json:"compactRevision"`
+	// NoSpaceAlarm indicates the member raised a NOSPACE alarm that could not be
+	// cleared.
+	NoSpaceAlarm bool `json:"noSpaceAlarm,omitempty"`
+	// LastDefragmentation is when the member was last defragmented.
+	LastDefragmentation *metav1.Time `json:"lastDefragmentation,omitempty"`
+	// Time is when the maintenance finished.
+	Time metav1.Time `json:"time"`
+	// Error holds the maintenance error, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// RevisionsSinceCompaction returns the number of revisions not yet compacted.
+func (r Result) RevisionsSinceCompaction() int64 {
+	if r.CompactRevision == 0 || r.Revision < r.CompactRevision {
+		return 0
+	}
+	return r.Revision - r.CompactRevision
+}
+
+// NewClient returns an etcd client for the provided endpoint using the api server etcd
+// client certificate found in the k0s pki directory.
+func NewClient(endpoint, pkiDir string) (*clientv3.Client, error) {
+	cert, err := tls.LoadX509KeyPair(
+		filepath.Join(pkiDir, "apiserver-etcd-client.crt"),
+		filepath.Join(pkiDir, "apiserver-etcd-client.key"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load etcd client certificate: %w", err)
+	}
+	ca, err := os.ReadFile(filepath.Join(pkiDir, "etcd", "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read etcd ca: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("unable to parse etcd ca")
+	}
+	return clientv3.New(clientv3.Config{
+		Endpoints:   []string{endpoint},
+		DialTimeout: 10 * time.Second,
+		TLS: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			RootCAs:      pool,
+			MinVersion:   tls.VersionTLS12,
+		},
+	})
+}
+
+// Fragmentation returns the percentage of the database size not in use.
+func Fragmentation(dbSize, dbSizeInUse int64) float64 {
+	if dbSize <= 0 || dbSizeInUse >= dbSize {
+		return 0
+	}
+	return float64(dbSize-dbSizeInUse) * 100 / float64(dbSize)
+}
+
+// Maintain defragments the member serving the endpoint if its fragmentation exceeds the
+// threshold and reports its state. NOSPACE alarms raised by the member are cleared once
+// space has been reclaimed.
+func Maintain(ctx context.Context, cli Client, endpoint, node string, thresholdPercent int) Result {
+	result := Result{Node: node}
+	if err := maintain(ctx, cli, endpoint, thresholdPercent, &result); err != nil {
+		result.Error = err.Error()
+	}
+	result.Time = metav1.Now()
+	return result
+}
+
+func maintain(ctx context.Context, cli Client, endpoint string, thresholdPercent int, result *Result) error {
+	status, err := cli.Status(ctx, endpoint)
+	if err != nil {
+		return fmt.Errorf("unable to get member status: %w", err)
+	}
+	result.DBSize, result.DBSizeInUse = status.DbSize, status.DbSizeInUse
+	result.Fragmentation = Fragmentation(status.DbSize, status.DbSizeInUse)
+	if status.Header != nil {
+		result.Revision = status.Header.Revision
+	}
+
+	if result.CompactRevision, err = compactRevision(ctx, cli); err != nil {
+		return err
+	}
+
+	alarm, err := noSpaceAlarm(ctx, cli, status.Header)
+	if err != nil {
+		return err
+	}
+
+	if alarm == nil && (status.DbSize < minDefragSize || result.Fragmentation < float64(thresholdPercent)) {
+		return nil
+	}
+
+	if _, err := cli.Defragment(ctx, endpoint); err != nil {
+		return fmt.Errorf("unable to defragment member: %w", err)
+	}
+	result.Defragmented = true
+	if status, err = cli.Status(ctx, endpoint); err != nil {
+		return fmt.Errorf("unable to get member status after defragmentation: %w", err)
+	}
+	result.Reclaimed = result.DBSize - status.DbSize
+	result.DBSize, result.DBSizeInUse = status.DbSize, status.DbSizeInUse
+
+	if alarm == nil {
+		return nil
+	}
+	if _, err := cli.AlarmDisarm(ctx, &clientv3.AlarmMember{MemberID: alarm.MemberID, Alarm: alarm.Alarm}); err != nil {
+		result.NoSpaceAlarm = true
+		return fmt.Errorf("unable to disarm nospace alarm: %w", err)
+	}
+	return nil
+}
+
+// compactRevision returns the last revision compacted by the api server. Returns 0 if
+// no compaction happened yet.
+func compactRevision(ctx context.Context, cli Client) (int64, error) {
+	resp, err := cli.Get(ctx, compactRevKey)
+	if err != nil {
+		return 0, fmt.Errorf("unable to get last compaction: %w", err)
+	}
+	if len(resp.Kvs) == 0 {
+		return 0, nil
+	}
+	rev, err := strconv.ParseInt(string(resp.Kvs[0].Value), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse last compaction revision: %w", err)
+	}
+	return rev, nil
+}
+
+// noSpaceAlarm returns the NOSPACE alarm raised by the member, if any.
+func noSpaceAlarm(ctx context.Context, cli Client, header *etcdserverpb.ResponseHeader) (*etcdserverpb.AlarmMember, error) {
+	resp, err := cli.AlarmList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list alarms: %w", err)
+	}
+	for _, alarm := range resp.Alarms {
+		if alarm.Alarm != etcdserverpb.AlarmType_NOSPACE {
+			continue
+		}
+		if header == nil || alarm.MemberID == header.MemberId {
+			return alarm, nil
+		}
+	}
+	return nil, nil
+}
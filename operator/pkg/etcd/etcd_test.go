@@ -0,0 +1,195 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	clusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+type fakeClient struct {
+	dbSize, dbSizeInUse int64
+	compactRev          string
+	alarms              []*etcdserverpb.AlarmMember
+	disarmErr           error
+	defragmented        bool
+	disarmed            bool
+}
+
+func (f *fakeClient) Status(ctx context.Context, endpoint string) (*clientv3.StatusResponse, error) {
+	return &clientv3.StatusResponse{
+		Header:      &etcdserverpb.ResponseHeader{MemberId: 1, Revision: 1000},
+		DbSize:      f.dbSize,
+		DbSizeInUse: f.dbSizeInUse,
+	}, nil
+}
+
+func (f *fakeClient) Defragment(ctx context.Context, endpoint string) (*clientv3.DefragmentResponse, error) {
+	f.defragmented = true
+	f.dbSize = f.dbSizeInUse
+	return &clientv3.DefragmentResponse{}, nil
+}
+
+func (f *fakeClient) AlarmList(ctx context.Context) (*clientv3.AlarmResponse, error) {
+	return &clientv3.AlarmResponse{Alarms: f.alarms}, nil
+}
+
+func (f *fakeClient) AlarmDisarm(ctx context.Context, m *clientv3.AlarmMember) (*clientv3.AlarmResponse, error) {
+	if f.disarmErr != nil {
+		return nil, f.disarmErr
+	}
+	f.disarmed = true
+	return &clientv3.AlarmResponse{}, nil
+}
+
+func (f *fakeClient) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	resp := &clientv3.GetResponse{}
+	if f.compactRev != "" {
+		resp.Kvs = []*mvccpb.KeyValue{{Key: []byte(key), Value: []byte(f.compactRev)}}
+	}
+	return resp, nil
+}
+
+func TestMaintain(t *testing.T) {
+	noSpace := &etcdserverpb.AlarmMember{MemberID: 1, Alarm: etcdserverpb.AlarmType_NOSPACE}
+	for _, tt := range []struct {
+		name             string
+		client           *fakeClient
+		wantDefrag       bool
+		wantDisarm       bool
+		wantReclaimed    int64
+		wantCompactRev   int64
+		wantNoSpaceAlarm bool
+		wantErr          bool
+	}{
+		{
+			name:           "fragmentation under threshold",
+			client:         &fakeClient{dbSize: 200 << 20, dbSizeInUse: 150 << 20, compactRev: "900"},
+			wantCompactRev: 900,
+		},
+		{
+			name:          "fragmentation over threshold",
+			client:        &fakeClient{dbSize: 200 << 20, dbSizeInUse: 50 << 20},
+			wantDefrag:    true,
+			wantReclaimed: 150 << 20,
+		},
+		{
+			name:   "small database is not defragmented",
+			client: &fakeClient{dbSize: 10 << 20, dbSizeInUse: 1 << 20},
+		},
+		{
+			name:          "nospace alarm is disarmed",
+			client:        &fakeClient{dbSize: 10 << 20, dbSizeInUse: 9 << 20, alarms: []*etcdserverpb.AlarmMember{noSpace}},
+			wantDefrag:    true,
+			wantDisarm:    true,
+			wantReclaimed: 1 << 20,
+		},
+		{
+			name: "alarm of another member is ignored",
+			client: &fakeClient{dbSize: 10 << 20, dbSizeInUse: 9 << 20, alarms: []*etcdserverpb.AlarmMember{
+				{MemberID: 2, Alarm: etcdserverpb.AlarmType_NOSPACE},
+			}},
+		},
+		{
+			name: "disarm failure",
+			client: &fakeClient{
+				dbSize: 10 << 20, dbSizeInUse: 9 << 20,
+				alarms:    []*etcdserverpb.AlarmMember{noSpace},
+				disarmErr: fmt.Errorf("boom"),
+			},
+			wantDefrag:       true,
+			wantReclaimed:    1 << 20,
+			wantNoSpaceAlarm: true,
+			wantErr:          true,
+		},
+		{
+			name:    "invalid compact revision",
+			client:  &fakeClient{dbSize: 10 << 20, dbSizeInUse: 9 << 20, compactRev: "abc"},
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Maintain(context.Background(), tt.client, DefaultEndpoint, "node-1", 50)
+			assert.Equal(t, "node-1", result.Node)
+			assert.Equal(t, tt.wantDefrag, tt.client.defragmented)
+			assert.Equal(t, tt.wantDefrag, result.Defragmented)
+			assert.Equal(t, tt.wantDisarm, tt.client.disarmed)
+			assert.Equal(t, tt.wantReclaimed, result.Reclaimed)
+			assert.Equal(t, tt.wantCompactRev, result.CompactRevision)
+			assert.Equal(t, tt.wantNoSpaceAlarm, result.NoSpaceAlarm)
+			assert.Equal(t, tt.wantErr, result.Error != "")
+			assert.False(t, result.Time.IsZero())
+		})
+	}
+}
+
+func TestRevisionsSinceCompaction(t *testing.T) {
+	assert.Equal(t, int64(100), Result{Revision: 1000, CompactRevision: 900}.RevisionsSinceCompaction())
+	assert.Equal(t, int64(0), Result{Revision: 1000}.RevisionsSinceCompaction())
+	assert.Equal(t, int64(0), Result{Revision: 800, CompactRevision: 900}.RevisionsSinceCompaction())
+}
+
+func TestRecordResult(t *testing.T) {
+	ctx := context.Background()
+	cli := fake.NewClientBuilder().Build()
+
+	defragTime := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+	err := RecordResult(ctx, cli, Result{Node: "node-b", Defragmented: true, Time: defragTime})
+	require.NoError(t, err)
+	err = RecordResult(ctx, cli, Result{Node: "node-a", Time: defragTime})
+	require.NoError(t, err)
+
+	now := metav1.NewTime(time.Now().Truncate(time.Second))
+	err = RecordResult(ctx, cli, Result{Node: "node-b", DBSize: 100, Time: now})
+	require.NoError(t, err)
+
+	results, err := ListResults(ctx, cli)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, "node-a", results[0].Node)
+	assert.Nil(t, results[0].LastDefragmentation)
+	assert.Equal(t, "node-b", results[1].Node)
+	assert.Equal(t, int64(100), results[1].DBSize)
+	require.NotNil(t, results[1].LastDefragmentation)
+	assert.True(t, defragTime.Equal(results[1].LastDefragmentation))
+}
+
+func TestDue(t *testing.T) {
+	now := time.Now()
+	recent := Result{Time: metav1.NewTime(now.Add(-time.Hour))}
+	old := Result{Time: metav1.NewTime(now.Add(-48 * time.Hour))}
+	assert.True(t, due(nil, DefaultInterval, now))
+	assert.False(t, due([]Result{recent}, DefaultInterval, now))
+	assert.True(t, due([]Result{recent, old}, DefaultInterval, now))
+}
+
+func TestConfig(t *testing.T) {
+	cfg := Config(nil)
+	assert.False(t, cfg.Disabled)
+	assert.Equal(t, DefaultInterval, cfg.Interval.Duration)
+	assert.Equal(t, DefaultDefragThresholdPercent, cfg.DefragThresholdPercent)
+
+	in := &clusterv1beta1.Installation{
+		Spec: clusterv1beta1.InstallationSpec{
+			Config: &clusterv1beta1.ConfigSpec{
+				EtcdMaintenance: &clusterv1beta1.EtcdMaintenance{
+					Interval:               &metav1.Duration{Duration: time.Hour},
+					DefragThresholdPercent: 30,
+				},
+			},
+		},
+	}
+	cfg = Config(in)
+	assert.Equal(t, time.Hour, cfg.Interval.Duration)
+	assert.Equal(t, 30, cfg.DefragThresholdPercent)
+}
@@ -0,0 +1,257 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	clusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/util"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+)
+
+const (
+	jobPrefix = "etcd-maintenance-"
+	// checkInterval is how often the maintainer checks if a maintenance run is due.
+	checkInterval = 10 * time.Minute
+	// jobTimeout is how long the maintainer waits for the maintenance of a member.
+	jobTimeout = 15 * time.Minute
+)
+
+// Maintainer runs the etcd maintenance on every controller node, one node at a time, on
+// a schedule. It implements the controller-runtime Runnable interface so it can be added
+// to the manager.
+type Maintainer struct {
+	cli   client.Client
+	image string
+}
+
+// NewMaintainer returns a new Maintainer. The maintenance jobs run the provided image,
+// expected to be the operator image.
+func NewMaintainer(cli client.Client, image string) *Maintainer {
+	return &Maintainer{cli: cli, image: image}
+}
+
+// NeedLeaderElection returns true so the maintenance is only run by the leader.
+func (m *Maintainer) NeedLeaderElection() bool {
+	return true
+}
+
+// Start checks periodically if a maintenance run is due until the context is cancelled.
+func (m *Maintainer) Start(ctx context.Context) error {
+	log := ctrl.LoggerFrom(ctx).WithName("etcd-maintenance")
+	if results, err := ListResults(ctx, m.cli); err != nil {
+		log.Error(err, "Unable to read previous maintenance results")
+	} else {
+		UpdateMetrics(results)
+	}
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		if err := m.maybeRun(ctx); err != nil {
+			log.Error(err, "Etcd maintenance failed")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// maybeRun runs the maintenance on all controller nodes if it is enabled and the
+// configured interval has elapsed since the last run.
+func (m *Maintainer) maybeRun(ctx context.Context) error {
+	in, err := kubeutils.GetLatestInstallation(ctx, m.cli)
+	if err != nil {
+		return fmt.Errorf("unable to get latest installation: %w", err)
+	}
+	cfg := Config(in)
+	if cfg.Disabled {
+		return nil
+	}
+	results, err := ListResults(ctx, m.cli)
+	if err != nil {
+		return err
+	}
+	if !due(results, cfg.Interval.Duration, time.Now()) {
+		return nil
+	}
+
+	var nodes corev1.NodeList
+	labels := client.MatchingLabels{"node-role.kubernetes.io/control-plane": "true"}
+	if err := m.cli.List(ctx, &nodes, labels); err != nil {
+		return fmt.Errorf("unable to list controller nodes: %w", err)
+	}
+	log := ctrl.LoggerFrom(ctx).WithName("etcd-maintenance")
+	for _, node := range nodes.Items {
+		log.Info("Running etcd maintenance", "node", node.Name)
+		if err := m.runJob(ctx, node.Name, cfg.DefragThresholdPercent); err != nil {
+			log.Error(err, "Etcd maintenance job failed", "node", node.Name)
+		}
+	}
+
+	if results, err = ListResults(ctx, m.cli); err != nil {
+		return err
+	}
+	UpdateMetrics(results)
+	return nil
+}
+
+// Config returns the etcd maintenance configuration of the installation with the
+// defaults applied.
+func Config(in *clusterv1beta1.Installation) clusterv1beta1.EtcdMaintenance {
+	cfg := clusterv1beta1.EtcdMaintenance{}
+	if in != nil && in.Spec.Config != nil && in.Spec.Config.EtcdMaintenance != nil {
+		cfg = *in.Spec.Config.EtcdMaintenance
+	}
+	if cfg.Interval == nil || cfg.Interval.Duration <= 0 {
+		cfg.Interval = &metav1.Duration{Duration: DefaultInterval}
+	}
+	if cfg.DefragThresholdPercent <= 0 {
+		cfg.DefragThresholdPercent = DefaultDefragThresholdPercent
+	}
+	return cfg
+}
+
+// due returns true if no maintenance ran in the last interval.
+func due(results []Result, interval time.Duration, now time.Time) bool {
+	if len(results) == 0 {
+		return true
+	}
+	for _, result := range results {
+		if now.Sub(result.Time.Time) >= interval {
+			return true
+		}
+	}
+	return false
+}
+
+// runJob runs the maintenance job on the provided node and waits for it to finish. Jobs
+// from previous runs are removed first.
+func (m *Maintainer) runJob(ctx context.Context, node string, thresholdPercent int) error {
+	job := newJob(node, m.image, thresholdPercent)
+	err := m.cli.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationForeground))
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return fmt.Errorf("unable to delete previous job: %w", err)
+	}
+	if err := waitForDeletion(ctx, m.cli, job); err != nil {
+		return err
+	}
+	if err := m.cli.Create(ctx, job); err != nil {
+		return fmt.Errorf("unable to create job: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, jobTimeout)
+	defer cancel()
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timeout waiting for job: %w", ctx.Err())
+		case <-time.After(10 * time.Second):
+		}
+		if err := m.cli.Get(ctx, client.ObjectKeyFromObject(job), job); err != nil {
+			return fmt.Errorf("unable to get job: %w", err)
+		}
+		if job.Status.Succeeded > 0 {
+			return nil
+		}
+		for _, cond := range job.Status.Conditions {
+			if cond.Type == batchv1.JobFailed && cond.Status == corev1.ConditionTrue {
+				return fmt.Errorf("job failed: %s", cond.Message)
+			}
+		}
+	}
+}
+
+func waitForDeletion(ctx context.Context, cli client.Client, job *batchv1.Job) error {
+	for i := 0; i < 30; i++ {
+		err := cli.Get(ctx, client.ObjectKeyFromObject(job), &batchv1.Job{})
+		if k8serrors.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("unable to get previous job: %w", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+	return fmt.Errorf("timeout waiting for previous job to be deleted")
+}
+
+// newJob returns the job running the maintenance of the etcd member of the provided
+// node. The job runs in the host network to reach the member and reads the api server
+// etcd client certificate from the host.
+func newJob(node, image string, thresholdPercent int) *batchv1.Job {
+	return &batchv1.Job{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "batch/v1",
+			Kind:       "Job",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      util.NameWithLengthLimit(jobPrefix, node),
+			Namespace: Namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/component":  "etcd-maintenance",
+				"app.kubernetes.io/part-of":    "embedded-cluster",
+				"app.kubernetes.io/managed-by": "embedded-cluster-operator",
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: ptr.To[int32](1),
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					NodeName:           node,
+					HostNetwork:        true,
+					RestartPolicy:      corev1.RestartPolicyNever,
+					ServiceAccountName: "embedded-cluster-operator",
+					Volumes: []corev1.Volume{
+						{
+							Name: "pki",
+							VolumeSource: corev1.VolumeSource{
+								HostPath: &corev1.HostPathVolumeSource{
+									Path: DefaultPKIDir,
+									Type: ptr.To(corev1.HostPathDirectory),
+								},
+							},
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:    "etcd-maintenance",
+							Image:   image,
+							Command: []string{"/manager"},
+							Args: []string{
+								"etcd-maintenance",
+								fmt.Sprintf("--node-name=%s", node),
+								fmt.Sprintf("--defrag-threshold=%d", thresholdPercent),
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "pki",
+									MountPath: DefaultPKIDir,
+									ReadOnly:  true,
+								},
+							},
+							SecurityContext: &corev1.SecurityContext{
+								// the certificates are only readable by root.
+								RunAsUser: ptr.To[int64](0),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,85 @@
+package etcd
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	dbSizeGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "embedded_cluster_etcd_db_size_bytes",
+		Help: "Size of the etcd member database.",
+	}, []string{"node"})
+	dbSizeInUseGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "embedded_cluster_etcd_db_size_in_use_bytes",
+		Help: "Size of the etcd member database in use.",
+	}, []string{"node"})
+	fragmentationGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "embedded_cluster_etcd_fragmentation_percent",
+		Help: "Percentage of the etcd member database not in use, measured before the last maintenance.",
+	}, []string{"node"})
+	revisionsSinceCompactionGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "embedded_cluster_etcd_revisions_since_compaction",
+		Help: "Number of etcd revisions created since the last compaction.",
+	}, []string{"node"})
+	lastDefragmentationGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "embedded_cluster_etcd_last_defragmentation_timestamp_seconds",
+		Help: "Time the etcd member was last defragmented.",
+	}, []string{"node"})
+	lastMaintenanceGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "embedded_cluster_etcd_last_maintenance_timestamp_seconds",
+		Help: "Time the last maintenance of the etcd member finished.",
+	}, []string{"node"})
+	maintenanceFailedGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "embedded_cluster_etcd_maintenance_failed",
+		Help: "Whether the last maintenance of the etcd member failed.",
+	}, []string{"node"})
+	noSpaceAlarmGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "embedded_cluster_etcd_nospace_alarm",
+		Help: "Whether the etcd member has a NOSPACE alarm that could not be cleared.",
+	}, []string{"node"})
+
+	gauges = []*prometheus.GaugeVec{
+		dbSizeGauge,
+		dbSizeInUseGauge,
+		fragmentationGauge,
+		revisionsSinceCompactionGauge,
+		lastDefragmentationGauge,
+		lastMaintenanceGauge,
+		maintenanceFailedGauge,
+		noSpaceAlarmGauge,
+	}
+)
+
+func init() {
+	for _, gauge := range gauges {
+		ctrlmetrics.Registry.MustRegister(gauge)
+	}
+}
+
+// UpdateMetrics exposes the provided maintenance results as metrics. Metrics for nodes
+// not present in the results are removed.
+func UpdateMetrics(results []Result) {
+	for _, gauge := range gauges {
+		gauge.Reset()
+	}
+	for _, result := range results {
+		dbSizeGauge.WithLabelValues(result.Node).Set(float64(result.DBSize))
+		dbSizeInUseGauge.WithLabelValues(result.Node).Set(float64(result.DBSizeInUse))
+		fragmentationGauge.WithLabelValues(result.Node).Set(result.Fragmentation)
+		revisionsSinceCompactionGauge.WithLabelValues(result.Node).Set(float64(result.RevisionsSinceCompaction()))
+		if result.LastDefragmentation != nil {
+			lastDefragmentationGauge.WithLabelValues(result.Node).Set(float64(result.LastDefragmentation.Unix()))
+		}
+		lastMaintenanceGauge.WithLabelValues(result.Node).Set(float64(result.Time.Unix()))
+		maintenanceFailedGauge.WithLabelValues(result.Node).Set(boolToFloat(result.Error != ""))
+		noSpaceAlarmGauge.WithLabelValues(result.Node).Set(boolToFloat(result.NoSpaceAlarm))
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
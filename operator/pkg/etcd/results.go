@@ -0,0 +1,92 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Namespace is where the maintenance jobs and results live.
+	Namespace = "embedded-cluster"
+	// ResultsConfigMapName is the name of the ConfigMap holding the last maintenance
+	// result of each member, keyed by node name.
+	ResultsConfigMapName = "etcd-maintenance"
+)
+
+// RecordResult stores the result of the maintenance of a member, replacing the previous
+// result for the same node.
+func RecordResult(ctx context.Context, cli client.Client, result Result) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var cm corev1.ConfigMap
+		key := client.ObjectKey{Namespace: Namespace, Name: ResultsConfigMapName}
+		err := cli.Get(ctx, key, &cm)
+		if k8serrors.IsNotFound(err) {
+			cm = corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      ResultsConfigMapName,
+					Namespace: Namespace,
+					Labels: map[string]string{
+						"app.kubernetes.io/component":  "etcd-maintenance",
+						"app.kubernetes.io/part-of":    "embedded-cluster",
+						"app.kubernetes.io/managed-by": "embedded-cluster-operator",
+					},
+				},
+			}
+		} else if err != nil {
+			return fmt.Errorf("unable to get results configmap: %w", err)
+		}
+
+		if !result.Defragmented {
+			var previous Result
+			if data, ok := cm.Data[result.Node]; ok && json.Unmarshal([]byte(data), &previous) == nil {
+				result.LastDefragmentation = previous.LastDefragmentation
+			}
+		} else {
+			result.LastDefragmentation = result.Time.DeepCopy()
+		}
+		data, err := json.Marshal(result)
+		if err != nil {
+			return fmt.Errorf("unable to marshal result: %w", err)
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[result.Node] = string(data)
+
+		if cm.ResourceVersion == "" {
+			return cli.Create(ctx, &cm)
+		}
+		return cli.Update(ctx, &cm)
+	})
+}
+
+// ListResults returns the last maintenance result of each member, sorted by node name.
+func ListResults(ctx context.Context, cli client.Client) ([]Result, error) {
+	var cm corev1.ConfigMap
+	key := client.ObjectKey{Namespace: Namespace, Name: ResultsConfigMapName}
+	if err := cli.Get(ctx, key, &cm); k8serrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to get results configmap: %w", err)
+	}
+	var results []Result
+	for node, data := range cm.Data {
+		var result Result
+		if err := json.Unmarshal([]byte(data), &result); err != nil {
+			return nil, fmt.Errorf("unable to unmarshal result for node %s: %w", node, err)
+		}
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Node < results[j].Node
+	})
+	return results, nil
+}
@@ -0,0 +1,175 @@
+package hostbackup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	clusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+const (
+	// Name is the name of the daemonset running the host backup agent.
+	Name = "host-backup"
+	// Namespace is where the host backup agent runs.
+	Namespace = "embedded-cluster"
+	// HostRoot is where the host filesystem is mounted in the agent container.
+	HostRoot = "/host"
+	// StagingDir is where the agent stages the host paths backed up by Velero.
+	StagingDir = "/backup"
+	// RulesEnv is the environment variable holding the json encoded rules.
+	RulesEnv = "HOST_BACKUP_RULES"
+	// stagingVolume is the name of the volume backed up by Velero.
+	stagingVolume = "host-backup"
+)
+
+// Reconcile deploys the host backup agent, running the provided image, on every node
+// when the installation includes host paths in the backups and removes it otherwise.
+func Reconcile(ctx context.Context, cli client.Client, in *clusterv1beta1.Installation, image string) error {
+	rules := Rules(in)
+	desired, err := NewDaemonSet(image, rules)
+	if err != nil {
+		return err
+	}
+
+	var existing appsv1.DaemonSet
+	err = cli.Get(ctx, client.ObjectKeyFromObject(desired), &existing)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return fmt.Errorf("unable to get host backup daemonset: %w", err)
+	}
+	found := err == nil
+
+	if len(rules.Include) == 0 {
+		if !found {
+			return nil
+		}
+		if err := cli.Delete(ctx, &existing); err != nil && !k8serrors.IsNotFound(err) {
+			return fmt.Errorf("unable to delete host backup daemonset: %w", err)
+		}
+		return nil
+	}
+
+	if err := Validate(rules); err != nil {
+		return err
+	}
+	if !found {
+		if err := cli.Create(ctx, desired); err != nil {
+			return fmt.Errorf("unable to create host backup daemonset: %w", err)
+		}
+		return nil
+	}
+	existing.Labels = desired.Labels
+	existing.Spec.Template = desired.Spec.Template
+	if err := cli.Update(ctx, &existing); err != nil {
+		return fmt.Errorf("unable to update host backup daemonset: %w", err)
+	}
+	return nil
+}
+
+// NewDaemonSet returns the daemonset running the host backup agent. The agent pods
+// mount the host filesystem and a staging volume backed up by Velero with the file
+// system backup. Velero hooks stage the host paths before the backup and copy them back
+// to the host after the restore.
+func NewDaemonSet(image string, rules clusterv1beta1.HostBackup) (*appsv1.DaemonSet, error) {
+	encoded, err := json.Marshal(rules)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode host backup rules: %w", err)
+	}
+	labels := map[string]string{
+		"app.kubernetes.io/component":      Name,
+		"app.kubernetes.io/part-of":        "embedded-cluster",
+		"app.kubernetes.io/managed-by":     "embedded-cluster-operator",
+		"replicated.com/disaster-recovery": "infra",
+	}
+	selector := map[string]string{
+		"app.kubernetes.io/component": Name,
+		"app.kubernetes.io/part-of":   "embedded-cluster",
+	}
+	command := func(sub string) string {
+		data, _ := json.Marshal([]string{"/manager", "host-backup", sub})
+		return string(data)
+	}
+	return &appsv1.DaemonSet{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "apps/v1",
+			Kind:       "DaemonSet",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      Name,
+			Namespace: Namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: selector},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+					Annotations: map[string]string{
+						"backup.velero.io/backup-volumes":          stagingVolume,
+						"pre.hook.backup.velero.io/container":      Name,
+						"pre.hook.backup.velero.io/command":        command("stage"),
+						"pre.hook.backup.velero.io/timeout":        "30m",
+						"post.hook.restore.velero.io/container":    Name,
+						"post.hook.restore.velero.io/command":      command("restore"),
+						"post.hook.restore.velero.io/exec-timeout": "30m",
+					},
+				},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: "embedded-cluster-operator",
+					Tolerations: []corev1.Toleration{
+						{Operator: corev1.TolerationOpExists},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "host",
+							VolumeSource: corev1.VolumeSource{
+								HostPath: &corev1.HostPathVolumeSource{
+									Path: "/",
+									Type: ptr.To(corev1.HostPathDirectory),
+								},
+							},
+						},
+						{
+							Name: stagingVolume,
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{},
+							},
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:    Name,
+							Image:   image,
+							Command: []string{"/manager"},
+							Args:    []string{"host-backup", "agent"},
+							Env: []corev1.EnvVar{
+								{Name: RulesEnv, Value: string(encoded)},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "host",
+									MountPath: HostRoot,
+								},
+								{
+									Name:      stagingVolume,
+									MountPath: StagingDir,
+								},
+							},
+							SecurityContext: &corev1.SecurityContext{
+								// host paths are usually only readable by root.
+								RunAsUser: ptr.To[int64](0),
+							},
+						},
+					},
+				},
+			},
+		},
+	}, nil
+}
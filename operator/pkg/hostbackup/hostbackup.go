@@ -0,0 +1,238 @@
+// Package hostbackup backs up host paths declared by the vendor and the end user as
+// part of the disaster recovery backups. An agent runs on every node and participates
+// in the Velero backups through hooks: before a backup the included paths are staged
+// in a volume backed up by Velero, after a restore they are copied back to the host.
+package hostbackup
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	clusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+// Rules returns the host backup rules of the installation, the vendor rules merged with
+// the end user ones.
+func Rules(in *clusterv1beta1.Installation) clusterv1beta1.HostBackup {
+	rules := clusterv1beta1.HostBackup{}
+	if in == nil {
+		return rules
+	}
+	var sources []*clusterv1beta1.HostBackup
+	if in.Spec.Config != nil {
+		sources = append(sources, in.Spec.Config.HostBackup)
+	}
+	sources = append(sources, in.Spec.EndUserHostBackup)
+	for _, source := range sources {
+		if source == nil {
+			continue
+		}
+		rules.Include = appendUnique(rules.Include, source.Include...)
+		rules.Exclude = appendUnique(rules.Exclude, source.Exclude...)
+	}
+	return rules
+}
+
+func appendUnique(list []string, paths ...string) []string {
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		found := false
+		for _, existing := range list {
+			if existing == path {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, path)
+		}
+	}
+	return list
+}
+
+// Validate verifies all rules are absolute paths and valid glob patterns.
+func Validate(rules clusterv1beta1.HostBackup) error {
+	for _, path := range append(append([]string{}, rules.Include...), rules.Exclude...) {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("host backup path %s is not absolute", path)
+		}
+		if _, err := filepath.Match(path, "/"); err != nil {
+			return fmt.Errorf("invalid host backup path %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// Excluded returns true if the host path, or any of its parent directories, matches one
+// of the exclusion rules.
+func Excluded(rules clusterv1beta1.HostBackup, path string) bool {
+	for dir := path; ; dir = filepath.Dir(dir) {
+		for _, pattern := range rules.Exclude {
+			if ok, _ := filepath.Match(pattern, dir); ok {
+				return true
+			}
+		}
+		if dir == "/" || dir == "." {
+			return false
+		}
+	}
+}
+
+// Stage copies the included host paths, minus the excluded ones, from the host
+// filesystem mounted at hostRoot to the staging directory. Content staged by previous
+// backups is removed first. Returns the number of files staged.
+func Stage(hostRoot, stagingDir string, rules clusterv1beta1.HostBackup) (int, error) {
+	if err := Validate(rules); err != nil {
+		return 0, err
+	}
+	if err := clearDir(stagingDir); err != nil {
+		return 0, fmt.Errorf("unable to clear staging directory: %w", err)
+	}
+	count := 0
+	for _, pattern := range rules.Include {
+		matches, err := filepath.Glob(filepath.Join(hostRoot, pattern))
+		if err != nil {
+			return count, fmt.Errorf("invalid host backup path %s: %w", pattern, err)
+		}
+		for _, match := range matches {
+			n, err := copyTree(match, hostRoot, stagingDir, func(path string) bool {
+				return Excluded(rules, path)
+			})
+			count += n
+			if err != nil {
+				return count, fmt.Errorf("unable to stage %s: %w", match, err)
+			}
+		}
+	}
+	return count, nil
+}
+
+// Restore copies the staged paths back to the host filesystem mounted at hostRoot.
+// Returns the number of files restored.
+func Restore(stagingDir, hostRoot string) (int, error) {
+	entries, err := os.ReadDir(stagingDir)
+	if err != nil {
+		return 0, fmt.Errorf("unable to read staging directory: %w", err)
+	}
+	count := 0
+	for _, entry := range entries {
+		n, err := copyTree(filepath.Join(stagingDir, entry.Name()), stagingDir, hostRoot, nil)
+		count += n
+		if err != nil {
+			return count, fmt.Errorf("unable to restore %s: %w", entry.Name(), err)
+		}
+	}
+	return count, nil
+}
+
+func clearDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyTree copies src, a path below srcRoot, to the same relative path below dstRoot.
+// Paths for which skip returns true, given their path relative to srcRoot as an absolute
+// path, are not copied. Parent directories are created as needed. Returns the number of
+// files copied.
+func copyTree(src, srcRoot, dstRoot string, skip func(string) bool) (int, error) {
+	count := 0
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(srcRoot, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return fmt.Errorf("path %s is outside %s", path, srcRoot)
+		}
+		if skip != nil && skip(filepath.Join("/", rel)) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		dst := filepath.Join(dstRoot, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			if err := os.MkdirAll(dst, info.Mode().Perm()); err != nil {
+				return err
+			}
+			if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+				return err
+			}
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if err := os.RemoveAll(dst); err != nil {
+				return err
+			}
+			if err := os.Symlink(target, dst); err != nil {
+				return err
+			}
+			count++
+		case info.Mode().IsRegular():
+			if err := copyFile(path, dst, info.Mode().Perm()); err != nil {
+				return err
+			}
+			count++
+		default:
+			// sockets, devices and pipes are not backed up.
+			return nil
+		}
+		preserveOwner(dst, info)
+		return nil
+	})
+	return count, err
+}
+
+func copyFile(src, dst string, mode fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(dst, mode)
+}
+
+// preserveOwner sets the owner of dst to the owner of the source file. This is best
+// effort, it only succeeds when running as root.
+func preserveOwner(dst string, info fs.FileInfo) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		_ = os.Lchown(dst, int(st.Uid), int(st.Gid))
+	}
+}
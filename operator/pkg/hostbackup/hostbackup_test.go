@@ -0,0 +1,158 @@
+package hostbackup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	clusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/k8sutil"
+)
+
+func TestRules(t *testing.T) {
+	in := &clusterv1beta1.Installation{
+		Spec: clusterv1beta1.InstallationSpec{
+			Config: &clusterv1beta1.ConfigSpec{
+				HostBackup: &clusterv1beta1.HostBackup{
+					Include: []string{"/var/lib/app", "/etc/app/"},
+					Exclude: []string{"/var/lib/app/cache"},
+				},
+			},
+			EndUserHostBackup: &clusterv1beta1.HostBackup{
+				Include: []string{"/etc/app", "/opt/data"},
+				Exclude: []string{"*.tmp"},
+			},
+		},
+	}
+	rules := Rules(in)
+	assert.Equal(t, []string{"/var/lib/app", "/etc/app", "/opt/data"}, rules.Include)
+	assert.Equal(t, []string{"/var/lib/app/cache", "*.tmp"}, rules.Exclude)
+
+	assert.Empty(t, Rules(nil).Include)
+	assert.Empty(t, Rules(&clusterv1beta1.Installation{}).Include)
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(clusterv1beta1.HostBackup{Include: []string{"/var/lib/*"}, Exclude: []string{"/var/lib/*/cache"}}))
+	assert.ErrorContains(t, Validate(clusterv1beta1.HostBackup{Include: []string{"var/lib"}}), "not absolute")
+	assert.ErrorContains(t, Validate(clusterv1beta1.HostBackup{Exclude: []string{"/var/[lib"}}), "invalid host backup path")
+}
+
+func TestExcluded(t *testing.T) {
+	rules := clusterv1beta1.HostBackup{Exclude: []string{"/var/lib/app/cache", "/var/lib/app/*.tmp"}}
+	assert.True(t, Excluded(rules, "/var/lib/app/cache"))
+	assert.True(t, Excluded(rules, "/var/lib/app/cache/a/b"))
+	assert.True(t, Excluded(rules, "/var/lib/app/upload.tmp"))
+	assert.False(t, Excluded(rules, "/var/lib/app/data"))
+	assert.False(t, Excluded(rules, "/var/lib/app"))
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0640))
+}
+
+func TestStageAndRestore(t *testing.T) {
+	host := t.TempDir()
+	writeFile(t, filepath.Join(host, "var/lib/app/data/db"), "db")
+	writeFile(t, filepath.Join(host, "var/lib/app/cache/blob"), "cache")
+	writeFile(t, filepath.Join(host, "var/lib/app/upload.tmp"), "tmp")
+	writeFile(t, filepath.Join(host, "etc/app/app.conf"), "conf")
+	writeFile(t, filepath.Join(host, "etc/other.conf"), "other")
+	require.NoError(t, os.Symlink("data/db", filepath.Join(host, "var/lib/app/current")))
+
+	staging := t.TempDir()
+	writeFile(t, filepath.Join(staging, "stale"), "stale")
+
+	rules := clusterv1beta1.HostBackup{
+		Include: []string{"/var/lib/app", "/etc/app/*.conf", "/does/not/exist"},
+		Exclude: []string{"/var/lib/app/cache", "/var/lib/app/*.tmp"},
+	}
+	count, err := Stage(host, staging, rules)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	assert.NoFileExists(t, filepath.Join(staging, "stale"))
+	assert.FileExists(t, filepath.Join(staging, "var/lib/app/data/db"))
+	assert.FileExists(t, filepath.Join(staging, "etc/app/app.conf"))
+	assert.NoDirExists(t, filepath.Join(staging, "var/lib/app/cache"))
+	assert.NoFileExists(t, filepath.Join(staging, "var/lib/app/upload.tmp"))
+	assert.NoFileExists(t, filepath.Join(staging, "etc/other.conf"))
+	target, err := os.Readlink(filepath.Join(staging, "var/lib/app/current"))
+	require.NoError(t, err)
+	assert.Equal(t, "data/db", target)
+
+	restored := t.TempDir()
+	count, err = Restore(staging, restored)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	data, err := os.ReadFile(filepath.Join(restored, "var/lib/app/data/db"))
+	require.NoError(t, err)
+	assert.Equal(t, "db", string(data))
+	info, err := os.Stat(filepath.Join(restored, "etc/app/app.conf"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+}
+
+func TestStageInvalidRules(t *testing.T) {
+	_, err := Stage(t.TempDir(), t.TempDir(), clusterv1beta1.HostBackup{Include: []string{"relative"}})
+	assert.ErrorContains(t, err, "not absolute")
+}
+
+func TestNewDaemonSet(t *testing.T) {
+	ds, err := NewDaemonSet("operator:1.0", clusterv1beta1.HostBackup{Include: []string{"/var/lib/app"}})
+	require.NoError(t, err)
+	assert.Equal(t, "infra", ds.Labels["replicated.com/disaster-recovery"])
+
+	tmpl := ds.Spec.Template
+	assert.Equal(t, "infra", tmpl.Labels["replicated.com/disaster-recovery"])
+	assert.Equal(t, "host-backup", tmpl.Annotations["backup.velero.io/backup-volumes"])
+	assert.Equal(t, `["/manager","host-backup","stage"]`, tmpl.Annotations["pre.hook.backup.velero.io/command"])
+	assert.Equal(t, `["/manager","host-backup","restore"]`, tmpl.Annotations["post.hook.restore.velero.io/command"])
+
+	container := tmpl.Spec.Containers[0]
+	assert.Equal(t, "operator:1.0", container.Image)
+	assert.Equal(t, RulesEnv, container.Env[0].Name)
+	assert.JSONEq(t, `{"include":["/var/lib/app"]}`, container.Env[0].Value)
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	cli := fake.NewClientBuilder().WithScheme(k8sutil.Scheme()).Build()
+	key := client.ObjectKey{Namespace: Namespace, Name: Name}
+
+	// nothing is deployed without included paths.
+	require.NoError(t, Reconcile(ctx, cli, &clusterv1beta1.Installation{}, "operator:1.0"))
+	err := cli.Get(ctx, key, &appsv1.DaemonSet{})
+	assert.True(t, k8serrors.IsNotFound(err))
+
+	in := &clusterv1beta1.Installation{
+		Spec: clusterv1beta1.InstallationSpec{
+			EndUserHostBackup: &clusterv1beta1.HostBackup{Include: []string{"/var/lib/app"}},
+		},
+	}
+	require.NoError(t, Reconcile(ctx, cli, in, "operator:1.0"))
+	var ds appsv1.DaemonSet
+	require.NoError(t, cli.Get(ctx, key, &ds))
+	assert.Equal(t, "operator:1.0", ds.Spec.Template.Spec.Containers[0].Image)
+
+	// the agent follows the operator image.
+	require.NoError(t, Reconcile(ctx, cli, in, "operator:2.0"))
+	require.NoError(t, cli.Get(ctx, key, &ds))
+	assert.Equal(t, "operator:2.0", ds.Spec.Template.Spec.Containers[0].Image)
+
+	// the agent is removed once no path is included anymore.
+	require.NoError(t, Reconcile(ctx, cli, &clusterv1beta1.Installation{}, "operator:2.0"))
+	err = cli.Get(ctx, key, &appsv1.DaemonSet{})
+	assert.True(t, k8serrors.IsNotFound(err))
+}
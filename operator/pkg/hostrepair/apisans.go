@@ -0,0 +1,214 @@
+package hostrepair
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	k8syaml "sigs.k8s.io/yaml"
+
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/dynamicconfig"
+	"github.com/replicatedhq/embedded-cluster/pkg/clusterlock"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/hostconfig"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+)
+
+const (
+	// apiSANsOperation is the operation the cluster lock is held for while a controller
+	// restarts with new api SANs.
+	apiSANsOperation = "api SANs update"
+	// apiRestartTimeout bounds the wait for the api server of a restarted controller.
+	apiRestartTimeout = 10 * time.Minute
+)
+
+// servesAPISANs returns true if the api server listening on the port of the host serves a
+// certificate valid for all the SANs, any certificate when there are none. Replaced in
+// tests.
+var servesAPISANs = func(ctx context.Context, port int, sans []string) bool {
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: 5 * time.Second},
+		// only the names in the certificate are looked at, it is not trusted.
+		Config: &tls.Config{InsecureSkipVerify: true},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return false
+	}
+	for _, san := range sans {
+		if certs[0].VerifyHostname(san) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// ConvergeAPISANs adds the api SANs of the k0s overrides of the latest installation missing
+// from the k0s configuration of a controller, under the host root, and restarts k0s so the
+// api server certificate is issued again with them. SANs are only ever added. Controllers
+// restart one at a time: the restart holds the cluster lock until the api server serves
+// the new certificate, and only starts when all the controllers are ready. Returns the
+// SANs added, none when the node is not a controller or has to wait for its turn.
+func ConvergeAPISANs(ctx context.Context, cli client.Client, sd Systemd, nodeName, hostRoot string) ([]string, error) {
+	in, err := kubeutils.GetLatestInstallation(ctx, cli)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get latest installation: %w", err)
+	}
+	desired, err := dynamicconfig.APISANs(in)
+	if err != nil || len(desired) == 0 {
+		return nil, err
+	}
+	var nodes corev1.NodeList
+	if err := cli.List(ctx, &nodes); err != nil {
+		return nil, fmt.Errorf("unable to list nodes: %w", err)
+	}
+	idx := slices.IndexFunc(nodes.Items, func(node corev1.Node) bool { return node.Name == nodeName })
+	if idx < 0 {
+		return nil, fmt.Errorf("node %s not found", nodeName)
+	}
+	if !IsController(nodes.Items[idx]) {
+		return nil, nil
+	}
+
+	path := filepath.Join(hostRoot, defaults.PathToK0sConfig())
+	config, sans, err := readK0sConfigSANs(path)
+	if err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, san := range desired {
+		if !slices.Contains(sans, san) {
+			missing = append(missing, san)
+		}
+	}
+	if len(missing) == 0 {
+		return nil, nil
+	}
+	if !controllersReady(nodes.Items) {
+		return nil, nil
+	}
+	lock, err := clusterlock.AcquireAs(ctx, cli, nodeName, apiSANsOperation)
+	var held *clusterlock.HeldError
+	if errors.As(err, &held) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer lock.Release(ctx)
+
+	if err := writeK0sConfigSANs(path, config, append(sans, missing...)); err != nil {
+		return nil, err
+	}
+	unit := filepath.Base(hostconfig.K0sUnitPath(true))
+	if err := sd.Restart(ctx, unit); err != nil {
+		return nil, fmt.Errorf("unable to restart %s: %w", unit, err)
+	}
+	report := Report{Time: metav1.Now(), Files: []string{defaults.PathToK0sConfig()}, Units: []string{fmt.Sprintf("%s restarted", unit)}}
+	if err := record(ctx, cli, nodeName, report); err != nil {
+		return missing, err
+	}
+	port := apiPort(config)
+	err = wait.PollUntilContextTimeout(ctx, 5*time.Second, apiRestartTimeout, true, func(ctx context.Context) (bool, error) {
+		return servesAPISANs(ctx, port, desired), nil
+	})
+	if err != nil {
+		return missing, fmt.Errorf("api server did not serve a certificate with the new SANs: %w", err)
+	}
+	return missing, nil
+}
+
+// readK0sConfigSANs reads the k0s configuration file and returns it with its api SANs.
+// The file is kept as a map so the fields this package does not know about are preserved.
+func readK0sConfigSANs(path string) (map[string]interface{}, []string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read k0s config: %w", err)
+	}
+	config := map[string]interface{}{}
+	if err := k8syaml.Unmarshal(data, &config); err != nil {
+		return nil, nil, fmt.Errorf("unable to parse k0s config: %w", err)
+	}
+	var sans []string
+	api, _ := nestedMap(config, "spec", "api")
+	list, _ := api["sans"].([]interface{})
+	for _, item := range list {
+		if san, ok := item.(string); ok {
+			sans = append(sans, san)
+		}
+	}
+	return config, sans, nil
+}
+
+// writeK0sConfigSANs writes the k0s configuration file with the api SANs.
+func writeK0sConfigSANs(path string, config map[string]interface{}, sans []string) error {
+	api, ok := nestedMap(config, "spec", "api")
+	if !ok {
+		return fmt.Errorf("no api section found in k0s config")
+	}
+	api["sans"] = sans
+	data, err := k8syaml.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("unable to marshal k0s config: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("unable to write k0s config: %w", err)
+	}
+	return nil
+}
+
+// apiPort returns the port of the api server in the k0s configuration, 6443 if not set.
+func apiPort(config map[string]interface{}) int {
+	api, _ := nestedMap(config, "spec", "api")
+	if port, ok := api["port"].(float64); ok && port > 0 {
+		return int(port)
+	}
+	return 6443
+}
+
+func nestedMap(m map[string]interface{}, keys ...string) (map[string]interface{}, bool) {
+	for _, key := range keys {
+		next, ok := m[key].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		m = next
+	}
+	return m, true
+}
+
+// controllersReady returns true if all the controllers are ready, one restarting with a
+// new configuration waits for the others.
+func controllersReady(nodes []corev1.Node) bool {
+	for _, node := range nodes {
+		if IsController(node) && !nodeReady(node) {
+			return false
+		}
+	}
+	return true
+}
+
+// nodeReady returns true if the Ready condition of the node is true.
+func nodeReady(node corev1.Node) bool {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
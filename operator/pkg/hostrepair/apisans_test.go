@@ -0,0 +1,136 @@
+package hostrepair
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	clusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/k8sutil"
+	"github.com/replicatedhq/embedded-cluster/pkg/clusterlock"
+)
+
+func controllerNode(name string, ready bool) *corev1.Node {
+	status := corev1.ConditionTrue
+	if !ready {
+		status = corev1.ConditionFalse
+	}
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{"node-role.kubernetes.io/control-plane": "true"},
+		},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: status}},
+		},
+	}
+}
+
+func TestConvergeAPISANs(t *testing.T) {
+	ctx := context.Background()
+	var checked []string
+	original := servesAPISANs
+	servesAPISANs = func(ctx context.Context, port int, sans []string) bool {
+		assert.Equal(t, 7443, port)
+		checked = sans
+		return true
+	}
+	t.Cleanup(func() {
+		servesAPISANs = original
+	})
+
+	in := &clusterv1beta1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Name: "20241010120000"},
+		Spec: clusterv1beta1.InstallationSpec{
+			EndUserK0sConfigOverrides: "config:\n  spec:\n    api:\n      sans:\n        - api.example.com\n        - 10.0.0.1\n",
+		},
+	}
+	root := t.TempDir()
+	path := filepath.Join(root, "etc", "k0s", "k0s.yaml")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(`apiVersion: k0s.k0sproject.io/v1beta1
+kind: ClusterConfig
+spec:
+  api:
+    address: 10.0.0.1
+    port: 7443
+    sans:
+    - 10.0.0.1
+  storage:
+    type: etcd
+`), 0644))
+
+	t.Run("waits for the other controllers to be ready", func(t *testing.T) {
+		cli := fake.NewClientBuilder().WithScheme(k8sutil.Scheme()).
+			WithObjects(in, controllerNode("controller-1", true), controllerNode("controller-2", false)).Build()
+		sd := newFakeSystemd()
+		added, err := ConvergeAPISANs(ctx, cli, sd, "controller-1", root)
+		require.NoError(t, err)
+		assert.Empty(t, added)
+		assert.Empty(t, sd.restarts)
+	})
+
+	t.Run("waits for the cluster lock", func(t *testing.T) {
+		cli := fake.NewClientBuilder().WithScheme(k8sutil.Scheme()).
+			WithObjects(in, controllerNode("controller-1", true), controllerNode("controller-2", true)).Build()
+		require.NoError(t, clusterlock.Hold(ctx, cli, "controller-2", "api SANs update"))
+		sd := newFakeSystemd()
+		added, err := ConvergeAPISANs(ctx, cli, sd, "controller-1", root)
+		require.NoError(t, err)
+		assert.Empty(t, added)
+		assert.Empty(t, sd.restarts)
+	})
+
+	t.Run("workers are left alone", func(t *testing.T) {
+		worker := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}}
+		cli := fake.NewClientBuilder().WithScheme(k8sutil.Scheme()).WithObjects(in, worker).Build()
+		sd := newFakeSystemd()
+		added, err := ConvergeAPISANs(ctx, cli, sd, "worker-1", root)
+		require.NoError(t, err)
+		assert.Empty(t, added)
+		assert.Empty(t, sd.restarts)
+	})
+
+	t.Run("restarts k0s with the missing SANs", func(t *testing.T) {
+		cli := fake.NewClientBuilder().WithScheme(k8sutil.Scheme()).
+			WithObjects(in, controllerNode("controller-1", true), controllerNode("controller-2", true)).Build()
+		sd := newFakeSystemd()
+		added, err := ConvergeAPISANs(ctx, cli, sd, "controller-1", root)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"api.example.com"}, added)
+		assert.Equal(t, []string{"k0scontroller.service"}, sd.restarts)
+		assert.Equal(t, []string{"api.example.com", "10.0.0.1"}, checked)
+
+		config, sans, err := readK0sConfigSANs(path)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"10.0.0.1", "api.example.com"}, sans)
+		storage, _ := nestedMap(config, "spec", "storage")
+		assert.Equal(t, "etcd", storage["type"], "the other fields are kept")
+
+		// the lock is released once the api server serves the new certificate.
+		var lease coordinationv1.Lease
+		require.NoError(t, cli.Get(ctx, client.ObjectKey{Namespace: clusterlock.Namespace, Name: clusterlock.Name}, &lease))
+		holder, err := clusterlock.Get(ctx, cli)
+		require.NoError(t, err)
+		assert.Nil(t, holder)
+
+		var node corev1.Node
+		require.NoError(t, cli.Get(ctx, client.ObjectKey{Name: "controller-1"}, &node))
+		assert.Contains(t, node.Annotations[ReportAnnotation], "k0scontroller.service restarted")
+
+		// nothing is left to do.
+		added, err = ConvergeAPISANs(ctx, cli, sd, "controller-1", root)
+		require.NoError(t, err)
+		assert.Empty(t, added)
+		assert.Len(t, sd.restarts, 1)
+	})
+}
@@ -0,0 +1,169 @@
+package hostrepair
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	clusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/conntrack"
+)
+
+// KubeProxyConntrackAnnotation is the annotation of the kube-proxy pod template holding the
+// conntrack sizing its pods were started with.
+const KubeProxyConntrackAnnotation = "embedded-cluster/conntrack"
+
+// ConntrackAnnotation is the node annotation holding the usage of the connection tracking
+// table of its host the last time its level changed.
+const ConntrackAnnotation = "replicated.com/conntrack-usage"
+
+// ConntrackReport records the usage of the connection tracking table of a host.
+type ConntrackReport struct {
+	Time  metav1.Time     `json:"time"`
+	Level string          `json:"level"`
+	Usage conntrack.Usage `json:"usage"`
+}
+
+// MonitorConntrack reads the usage of the connection tracking table under procRoot and
+// records it on the node when its level changed since the last time it was recorded, so
+// the node is not patched on every check. The agent runs in the host network namespace,
+// the table read is the one of the host. The usage read is returned.
+func MonitorConntrack(ctx context.Context, cli client.Client, nodeName, procRoot string) (conntrack.Usage, error) {
+	usage, err := conntrack.Read(procRoot)
+	if err != nil {
+		return usage, err
+	}
+	var node corev1.Node
+	if err := cli.Get(ctx, client.ObjectKey{Name: nodeName}, &node); err != nil {
+		return usage, fmt.Errorf("unable to get node %s: %w", nodeName, err)
+	}
+	level := usage.Level()
+	if last, ok := conntrackReport(node); ok && last.Level == level {
+		return usage, nil
+	} else if !ok && level == conntrack.LevelOK {
+		return usage, nil
+	}
+
+	data, err := json.Marshal(ConntrackReport{Time: metav1.Now(), Level: level, Usage: usage})
+	if err != nil {
+		return usage, fmt.Errorf("unable to encode conntrack report: %w", err)
+	}
+	patch := client.MergeFrom(node.DeepCopy())
+	if node.Annotations == nil {
+		node.Annotations = map[string]string{}
+	}
+	node.Annotations[ConntrackAnnotation] = string(data)
+	if err := cli.Patch(ctx, &node, patch); err != nil {
+		return usage, fmt.Errorf("unable to record conntrack usage on node %s: %w", nodeName, err)
+	}
+	return usage, nil
+}
+
+// conntrackReport returns the report recorded on the node, if any can be parsed.
+func conntrackReport(node corev1.Node) (ConntrackReport, bool) {
+	data, ok := node.Annotations[ConntrackAnnotation]
+	if !ok {
+		return ConntrackReport{}, false
+	}
+	var report ConntrackReport
+	if err := json.Unmarshal([]byte(data), &report); err != nil {
+		return ConntrackReport{}, false
+	}
+	return report, true
+}
+
+// ConntrackCondition returns the condition reporting the nodes whose connection tracking
+// table is nearly full. Packets of new connections are dropped once it is full.
+func ConntrackCondition(conditionType string, nodes []corev1.Node, generation int64) metav1.Condition {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+	var saturated []string
+	for _, node := range nodes {
+		report, ok := conntrackReport(node)
+		if !ok || report.Level == conntrack.LevelOK {
+			continue
+		}
+		saturated = append(saturated, fmt.Sprintf("%s (%s, %s)", node.Name, report.Usage, strings.ToLower(report.Level)))
+	}
+	if len(saturated) == 0 {
+		return metav1.Condition{
+			Type:               conditionType,
+			Status:             metav1.ConditionFalse,
+			Reason:             "ConntrackTableAvailable",
+			ObservedGeneration: generation,
+		}
+	}
+	return metav1.Condition{
+		Type:   conditionType,
+		Status: metav1.ConditionTrue,
+		Reason: "ConntrackTableNearlyFull",
+		Message: fmt.Sprintf(
+			"Connection tracking table nearly full on %s, packets of new connections are dropped once it is full. "+
+				"Raise net.netfilter.nf_conntrack_max on these nodes or set the conntrack profile of the cluster configuration",
+			strings.Join(saturated, "; "),
+		),
+		ObservedGeneration: generation,
+	}
+}
+
+// ReconcileKubeProxyConntrack renders the sizing of the connection tracking table in the
+// kube-proxy configuration deployed by k0s, kube-proxy sets the table of the nodes itself
+// when it starts. k0s renders the configuration again when a controller restarts, it is
+// rendered back on the next reconcile. The kube-proxy pods are rolled out, one node at a
+// time, when the sizing they were started with changes. Nothing is done when kube-proxy
+// is not deployed.
+func ReconcileKubeProxyConntrack(ctx context.Context, cli client.Client, cfg *clusterv1beta1.Conntrack) error {
+	var cm corev1.ConfigMap
+	if err := cli.Get(ctx, client.ObjectKey{Namespace: "kube-system", Name: "kube-proxy"}, &cm); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("unable to get kube-proxy config: %w", err)
+	}
+	current, ok := cm.Data["config.conf"]
+	if !ok {
+		return fmt.Errorf("no config.conf found in the kube-proxy config")
+	}
+	config, err := conntrack.RenderKubeProxyConfig(current, cfg)
+	if err != nil {
+		return err
+	}
+	if config != current {
+		patch := client.MergeFrom(cm.DeepCopy())
+		cm.Data["config.conf"] = config
+		if err := cli.Patch(ctx, &cm, patch); err != nil {
+			return fmt.Errorf("unable to update kube-proxy config: %w", err)
+		}
+	}
+
+	var ds appsv1.DaemonSet
+	if err := cli.Get(ctx, client.ObjectKey{Namespace: "kube-system", Name: "kube-proxy"}, &ds); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("unable to get kube-proxy daemonset: %w", err)
+	}
+	perCPU, minimum := conntrack.KubeProxy(cfg)
+	sizing := fmt.Sprintf("%d/%d", perCPU, minimum)
+	if ds.Spec.Template.Annotations[KubeProxyConntrackAnnotation] == sizing {
+		return nil
+	}
+	patch := client.MergeFrom(ds.DeepCopy())
+	if ds.Spec.Template.Annotations == nil {
+		ds.Spec.Template.Annotations = map[string]string{}
+	}
+	ds.Spec.Template.Annotations[KubeProxyConntrackAnnotation] = sizing
+	if err := cli.Patch(ctx, &ds, patch); err != nil {
+		return fmt.Errorf("unable to restart kube-proxy: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package hostrepair
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	clusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/k8sutil"
+	"github.com/replicatedhq/embedded-cluster/pkg/conntrack"
+)
+
+func TestMonitorConntrack(t *testing.T) {
+	ctx := context.Background()
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}}
+	cli := fake.NewClientBuilder().WithScheme(k8sutil.Scheme()).WithObjects(node).Build()
+
+	procRoot := t.TempDir()
+	setUsage := func(count, max string) {
+		dir := filepath.Join(procRoot, "sys/net/netfilter")
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "nf_conntrack_count"), []byte(count), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "nf_conntrack_max"), []byte(max), 0644))
+	}
+	report := func() (ConntrackReport, bool) {
+		require.NoError(t, cli.Get(ctx, client.ObjectKeyFromObject(node), node))
+		return conntrackReport(*node)
+	}
+
+	// nothing is recorded while the table has room.
+	setUsage("1000\n", "131072\n")
+	_, err := MonitorConntrack(ctx, cli, "worker-1", procRoot)
+	require.NoError(t, err)
+	_, ok := report()
+	assert.False(t, ok)
+
+	setUsage("100000\n", "131072\n")
+	usage, err := MonitorConntrack(ctx, cli, "worker-1", procRoot)
+	require.NoError(t, err)
+	assert.Equal(t, conntrack.Usage{Count: 100000, Max: 131072}, usage)
+	got, ok := report()
+	require.True(t, ok)
+	assert.Equal(t, conntrack.LevelWarning, got.Level)
+	assert.Equal(t, usage, got.Usage)
+
+	// the node is only patched when the level changes.
+	setUsage("101000\n", "131072\n")
+	_, err = MonitorConntrack(ctx, cli, "worker-1", procRoot)
+	require.NoError(t, err)
+	got, _ = report()
+	assert.Equal(t, int64(100000), got.Usage.Count)
+
+	// going back under the threshold is recorded as well.
+	setUsage("1000\n", "131072\n")
+	_, err = MonitorConntrack(ctx, cli, "worker-1", procRoot)
+	require.NoError(t, err)
+	got, _ = report()
+	assert.Equal(t, conntrack.LevelOK, got.Level)
+}
+
+func TestConntrackCondition(t *testing.T) {
+	critical, err := json.Marshal(ConntrackReport{Level: conntrack.LevelCritical, Usage: conntrack.Usage{Count: 125000, Max: 131072}})
+	require.NoError(t, err)
+	ok, err := json.Marshal(ConntrackReport{Level: conntrack.LevelOK, Usage: conntrack.Usage{Count: 10, Max: 131072}})
+	require.NoError(t, err)
+	nodes := []corev1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "worker-2", Annotations: map[string]string{ConntrackAnnotation: string(ok)}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "worker-1", Annotations: map[string]string{ConntrackAnnotation: string(critical)}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "controller-1", Annotations: map[string]string{ConntrackAnnotation: "invalid"}}},
+	}
+
+	cond := ConntrackCondition("ConntrackSaturation", nodes, 3)
+	assert.Equal(t, metav1.ConditionTrue, cond.Status)
+	assert.Equal(t, "ConntrackTableNearlyFull", cond.Reason)
+	assert.Equal(t, int64(3), cond.ObservedGeneration)
+	assert.Contains(t, cond.Message, "worker-1 (125000/131072 entries (95%), critical)")
+	assert.NotContains(t, cond.Message, "worker-2")
+
+	cond = ConntrackCondition("ConntrackSaturation", []corev1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "worker-3"}}}, 3)
+	assert.Equal(t, metav1.ConditionFalse, cond.Status)
+	assert.Equal(t, "ConntrackTableAvailable", cond.Reason)
+}
+
+func TestReconcileKubeProxyConntrack(t *testing.T) {
+	ctx := context.Background()
+
+	// kube-proxy is not deployed.
+	cli := fake.NewClientBuilder().WithScheme(k8sutil.Scheme()).Build()
+	require.NoError(t, ReconcileKubeProxyConntrack(ctx, cli, nil))
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "kube-proxy"},
+		Data: map[string]string{
+			"config.conf":     "apiVersion: kubeproxy.config.k8s.io/v1alpha1\nkind: KubeProxyConfiguration\nconntrack:\n  maxPerCore: 0\n  min: null\n",
+			"kubeconfig.conf": "apiVersion: v1\nkind: Config\n",
+		},
+	}
+	ds := &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "kube-proxy"}}
+	cli = fake.NewClientBuilder().WithScheme(k8sutil.Scheme()).WithObjects(cm, ds).Build()
+	cfg := &clusterv1beta1.Conntrack{Profile: conntrack.ProfileHigh}
+	require.NoError(t, ReconcileKubeProxyConntrack(ctx, cli, cfg))
+
+	require.NoError(t, cli.Get(ctx, client.ObjectKeyFromObject(cm), cm))
+	assert.Equal(t, "apiVersion: kubeproxy.config.k8s.io/v1alpha1\nconntrack:\n  maxPerCore: 131072\n  min: 524288\nkind: KubeProxyConfiguration\n", cm.Data["config.conf"])
+	assert.Equal(t, "apiVersion: v1\nkind: Config\n", cm.Data["kubeconfig.conf"])
+	require.NoError(t, cli.Get(ctx, client.ObjectKeyFromObject(ds), ds))
+	assert.Equal(t, "131072/524288", ds.Spec.Template.Annotations[KubeProxyConntrackAnnotation])
+
+	// nothing changes, kube-proxy is not restarted again.
+	version := ds.ResourceVersion
+	require.NoError(t, ReconcileKubeProxyConntrack(ctx, cli, cfg))
+	require.NoError(t, cli.Get(ctx, client.ObjectKeyFromObject(ds), ds))
+	assert.Equal(t, version, ds.ResourceVersion)
+
+	// the size set in the configuration.
+	require.NoError(t, ReconcileKubeProxyConntrack(ctx, cli, &clusterv1beta1.Conntrack{Max: 200000}))
+	require.NoError(t, cli.Get(ctx, client.ObjectKeyFromObject(cm), cm))
+	assert.Contains(t, cm.Data["config.conf"], "maxPerCore: 1\n  min: 200000\n")
+	require.NoError(t, cli.Get(ctx, client.ObjectKeyFromObject(ds), ds))
+	assert.Equal(t, "1/200000", ds.Spec.Template.Annotations[KubeProxyConntrackAnnotation])
+}
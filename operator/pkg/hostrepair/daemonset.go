@@ -0,0 +1,164 @@
+package hostrepair
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+)
+
+const (
+	// Name is the name of the daemonset running the host repair agent.
+	Name = "host-repair"
+	// Namespace is where the host repair agent runs.
+	Namespace = "embedded-cluster"
+	// HostRoot is where the host /etc directory and the directory of the encryption
+	// configuration are mounted, under their host path, in the agent container.
+	HostRoot = "/host"
+	// NodeNameEnv is the environment variable holding the name of the agent node.
+	NodeNameEnv = "NODE_NAME"
+)
+
+// Reconcile deploys the host repair agent, running the provided image, on every node.
+func Reconcile(ctx context.Context, cli client.Client, image string) error {
+	desired := NewDaemonSet(image)
+
+	var existing appsv1.DaemonSet
+	err := cli.Get(ctx, client.ObjectKeyFromObject(desired), &existing)
+	if k8serrors.IsNotFound(err) {
+		if err := cli.Create(ctx, desired); err != nil {
+			return fmt.Errorf("unable to create host repair daemonset: %w", err)
+		}
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("unable to get host repair daemonset: %w", err)
+	}
+	existing.Labels = desired.Labels
+	existing.Spec.Template = desired.Spec.Template
+	if err := cli.Update(ctx, &existing); err != nil {
+		return fmt.Errorf("unable to update host repair daemonset: %w", err)
+	}
+	return nil
+}
+
+// NewDaemonSet returns the daemonset running the host repair agent. The agent pods run on
+// every node and mount the host /etc directory, where all the repaired files live, and the
+// host /run/systemd directory holding the socket the units are managed through. They run
+// in the host network namespace to read the connection tracking table of the host.
+func NewDaemonSet(image string) *appsv1.DaemonSet {
+	labels := map[string]string{
+		"app.kubernetes.io/component":  Name,
+		"app.kubernetes.io/part-of":    "embedded-cluster",
+		"app.kubernetes.io/managed-by": "embedded-cluster-operator",
+	}
+	selector := map[string]string{
+		"app.kubernetes.io/component": Name,
+		"app.kubernetes.io/part-of":   "embedded-cluster",
+	}
+	return &appsv1.DaemonSet{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "apps/v1",
+			Kind:       "DaemonSet",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      Name,
+			Namespace: Namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: selector},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: "embedded-cluster-operator",
+					HostNetwork:        true,
+					DNSPolicy:          corev1.DNSClusterFirstWithHostNet,
+					Tolerations: []corev1.Toleration{
+						{Operator: corev1.TolerationOpExists},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "host-etc",
+							VolumeSource: corev1.VolumeSource{
+								HostPath: &corev1.HostPathVolumeSource{
+									Path: "/etc",
+									Type: ptr.To(corev1.HostPathDirectory),
+								},
+							},
+						},
+						{
+							Name: "host-systemd",
+							VolumeSource: corev1.VolumeSource{
+								HostPath: &corev1.HostPathVolumeSource{
+									Path: "/run/systemd",
+									Type: ptr.To(corev1.HostPathDirectory),
+								},
+							},
+						},
+						{
+							// the encryption configuration of the controllers, installed
+							// again on all of them when the keys are rotated.
+							Name: "host-encryption",
+							VolumeSource: corev1.VolumeSource{
+								HostPath: &corev1.HostPathVolumeSource{
+									Path: encryptionDir(),
+									Type: ptr.To(corev1.HostPathDirectoryOrCreate),
+								},
+							},
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:    Name,
+							Image:   image,
+							Command: []string{"/manager"},
+							Args:    []string{"host-repair", "agent"},
+							Env: []corev1.EnvVar{
+								{
+									Name: NodeNameEnv,
+									ValueFrom: &corev1.EnvVarSource{
+										FieldRef: &corev1.ObjectFieldSelector{FieldPath: "spec.nodeName"},
+									},
+								},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "host-etc",
+									MountPath: HostRoot + "/etc",
+								},
+								{
+									Name:      "host-systemd",
+									MountPath: "/run/systemd",
+								},
+								{
+									Name:      "host-encryption",
+									MountPath: HostRoot + encryptionDir(),
+								},
+							},
+							SecurityContext: &corev1.SecurityContext{
+								// the repaired files are owned by root, and only root can
+								// reach the systemd private socket.
+								RunAsUser: ptr.To[int64](0),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// encryptionDir returns the directory of the encryption configuration on the hosts.
+func encryptionDir() string {
+	return filepath.Dir(defaults.PathToEncryptionConfig())
+}
@@ -0,0 +1,138 @@
+package hostrepair
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/clusterlock"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/encryption"
+	"github.com/replicatedhq/embedded-cluster/pkg/hostconfig"
+)
+
+// encryptionOperation is the operation the cluster lock is held for while a controller
+// restarts with a new encryption configuration.
+const encryptionOperation = "encryption config update"
+
+// ConvergeEncryptionConfig installs the encryption configuration of the cluster, stored by
+// the encryption key rotation, on a controller whose configuration under the host root
+// differs and restarts k0s so the api server uses the new keys. Controllers restart one at
+// a time, as they do for new api SANs. The hash of the configuration the api server runs
+// with is recorded on the node so the rotation can wait for all the controllers. Returns
+// true if k0s was restarted. Nothing is done on workers and on clusters not encrypting
+// secrets at rest.
+func ConvergeEncryptionConfig(ctx context.Context, cli client.Client, sd Systemd, nodeName, hostRoot string) (bool, error) {
+	var nodes corev1.NodeList
+	if err := cli.List(ctx, &nodes); err != nil {
+		return false, fmt.Errorf("unable to list nodes: %w", err)
+	}
+	var node *corev1.Node
+	for i := range nodes.Items {
+		if nodes.Items[i].Name == nodeName {
+			node = &nodes.Items[i]
+		}
+	}
+	if node == nil {
+		return false, fmt.Errorf("node %s not found", nodeName)
+	} else if !IsController(*node) {
+		return false, nil
+	}
+
+	path := filepath.Join(hostRoot, defaults.PathToEncryptionConfig())
+	current, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("unable to read encryption config: %w", err)
+	}
+	var secret corev1.Secret
+	if err := cli.Get(ctx, client.ObjectKey{Namespace: Namespace, Name: encryption.SecretName}, &secret); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("unable to get encryption config secret: %w", err)
+	}
+	desired := secret.Data[encryption.SecretKey]
+	desiredHash, err := encryption.Hash(desired)
+	if err != nil {
+		return false, err
+	}
+	currentHash, err := encryption.Hash(current)
+	if err != nil {
+		return false, err
+	}
+
+	recorded := node.Annotations[encryption.ConfigAnnotation]
+	if currentHash == desiredHash {
+		if recorded == desiredHash {
+			return false, nil
+		}
+		// nodes installed before the configuration was recorded run with the one on disk,
+		// a different hash means k0s was not restarted after it was written.
+		if recorded == "" {
+			return false, recordEncryptionConfig(ctx, cli, nodeName, desiredHash)
+		}
+	}
+	if !controllersReady(nodes.Items) {
+		return false, nil
+	}
+	lock, err := clusterlock.AcquireAs(ctx, cli, nodeName, encryptionOperation)
+	var held *clusterlock.HeldError
+	if errors.As(err, &held) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer lock.Release(ctx)
+
+	if err := encryption.WriteConfigFile(path, desired); err != nil {
+		return false, err
+	}
+	unit := filepath.Base(hostconfig.K0sUnitPath(true))
+	if err := sd.Restart(ctx, unit); err != nil {
+		return false, fmt.Errorf("unable to restart %s: %w", unit, err)
+	}
+	report := Report{Time: metav1.Now(), Files: []string{defaults.PathToEncryptionConfig()}, Units: []string{fmt.Sprintf("%s restarted", unit)}}
+	if err := record(ctx, cli, nodeName, report); err != nil {
+		return true, err
+	}
+	port := 6443
+	if config, _, err := readK0sConfigSANs(filepath.Join(hostRoot, defaults.PathToK0sConfig())); err == nil {
+		port = apiPort(config)
+	}
+	err = wait.PollUntilContextTimeout(ctx, 5*time.Second, apiRestartTimeout, true, func(ctx context.Context) (bool, error) {
+		return servesAPISANs(ctx, port, nil), nil
+	})
+	if err != nil {
+		return true, fmt.Errorf("api server did not come back after the restart: %w", err)
+	}
+	return true, recordEncryptionConfig(ctx, cli, nodeName, desiredHash)
+}
+
+// recordEncryptionConfig records on the node the hash of the encryption configuration its
+// api server runs with.
+func recordEncryptionConfig(ctx context.Context, cli client.Client, nodeName, hash string) error {
+	var node corev1.Node
+	if err := cli.Get(ctx, client.ObjectKey{Name: nodeName}, &node); err != nil {
+		return fmt.Errorf("unable to get node %s: %w", nodeName, err)
+	}
+	patch := client.MergeFrom(node.DeepCopy())
+	if node.Annotations == nil {
+		node.Annotations = map[string]string{}
+	}
+	node.Annotations[encryption.ConfigAnnotation] = hash
+	if err := cli.Patch(ctx, &node, patch); err != nil {
+		return fmt.Errorf("unable to record encryption config on node %s: %w", nodeName, err)
+	}
+	return nil
+}
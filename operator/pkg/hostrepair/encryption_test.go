@@ -0,0 +1,162 @@
+package hostrepair
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/k8sutil"
+	"github.com/replicatedhq/embedded-cluster/pkg/clusterlock"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/encryption"
+)
+
+const (
+	encryptionConfigV1 = `apiVersion: apiserver.config.k8s.io/v1
+kind: EncryptionConfiguration
+resources:
+- providers:
+  - secretbox:
+      keys:
+      - name: key-1
+        secret: c2VjcmV0LTE=
+  - identity: {}
+  resources:
+  - secrets
+`
+	encryptionConfigV2 = `apiVersion: apiserver.config.k8s.io/v1
+kind: EncryptionConfiguration
+resources:
+- providers:
+  - secretbox:
+      keys:
+      - name: key-1
+        secret: c2VjcmV0LTE=
+      - name: key-2
+        secret: c2VjcmV0LTI=
+  - identity: {}
+  resources:
+  - secrets
+`
+)
+
+func TestConvergeEncryptionConfig(t *testing.T) {
+	ctx := context.Background()
+	original := servesAPISANs
+	servesAPISANs = func(ctx context.Context, port int, sans []string) bool {
+		assert.Equal(t, 6443, port)
+		assert.Empty(t, sans)
+		return true
+	}
+	t.Cleanup(func() {
+		servesAPISANs = original
+	})
+
+	root := t.TempDir()
+	path := filepath.Join(root, defaults.PathToEncryptionConfig())
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	require.NoError(t, os.WriteFile(path, []byte(encryptionConfigV1), 0600))
+	secret := func(config string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: Namespace, Name: encryption.SecretName},
+			Data:       map[string][]byte{encryption.SecretKey: []byte(config)},
+		}
+	}
+	v1, err := encryption.Hash([]byte(encryptionConfigV1))
+	require.NoError(t, err)
+	v2, err := encryption.Hash([]byte(encryptionConfigV2))
+	require.NoError(t, err)
+	annotation := func(cli client.Client, name string) string {
+		var node corev1.Node
+		require.NoError(t, cli.Get(ctx, client.ObjectKey{Name: name}, &node))
+		return node.Annotations[encryption.ConfigAnnotation]
+	}
+
+	t.Run("workers are left alone", func(t *testing.T) {
+		worker := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}}
+		cli := fake.NewClientBuilder().WithScheme(k8sutil.Scheme()).WithObjects(worker, secret(encryptionConfigV2)).Build()
+		sd := newFakeSystemd()
+		restarted, err := ConvergeEncryptionConfig(ctx, cli, sd, "worker-1", root)
+		require.NoError(t, err)
+		assert.False(t, restarted)
+		assert.Empty(t, annotation(cli, "worker-1"))
+	})
+
+	t.Run("the configuration running is recorded", func(t *testing.T) {
+		cli := fake.NewClientBuilder().WithScheme(k8sutil.Scheme()).
+			WithObjects(controllerNode("controller-1", true), secret(encryptionConfigV1)).Build()
+		sd := newFakeSystemd()
+		restarted, err := ConvergeEncryptionConfig(ctx, cli, sd, "controller-1", root)
+		require.NoError(t, err)
+		assert.False(t, restarted)
+		assert.Empty(t, sd.restarts)
+		assert.Equal(t, v1, annotation(cli, "controller-1"))
+	})
+
+	t.Run("waits for the other controllers to be ready", func(t *testing.T) {
+		cli := fake.NewClientBuilder().WithScheme(k8sutil.Scheme()).
+			WithObjects(controllerNode("controller-1", true), controllerNode("controller-2", false), secret(encryptionConfigV2)).Build()
+		sd := newFakeSystemd()
+		restarted, err := ConvergeEncryptionConfig(ctx, cli, sd, "controller-1", root)
+		require.NoError(t, err)
+		assert.False(t, restarted)
+		assert.Empty(t, sd.restarts)
+	})
+
+	t.Run("waits for the cluster lock", func(t *testing.T) {
+		cli := fake.NewClientBuilder().WithScheme(k8sutil.Scheme()).
+			WithObjects(controllerNode("controller-1", true), controllerNode("controller-2", true), secret(encryptionConfigV2)).Build()
+		require.NoError(t, clusterlock.Hold(ctx, cli, "controller-2", "encryption config update"))
+		sd := newFakeSystemd()
+		restarted, err := ConvergeEncryptionConfig(ctx, cli, sd, "controller-1", root)
+		require.NoError(t, err)
+		assert.False(t, restarted)
+		assert.Empty(t, sd.restarts)
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, encryptionConfigV1, string(data))
+	})
+
+	t.Run("restarts k0s with the configuration of the cluster", func(t *testing.T) {
+		cli := fake.NewClientBuilder().WithScheme(k8sutil.Scheme()).
+			WithObjects(controllerNode("controller-1", true), controllerNode("controller-2", true), secret(encryptionConfigV2)).Build()
+		sd := newFakeSystemd()
+		restarted, err := ConvergeEncryptionConfig(ctx, cli, sd, "controller-1", root)
+		require.NoError(t, err)
+		assert.True(t, restarted)
+		assert.Equal(t, []string{"k0scontroller.service"}, sd.restarts)
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, encryptionConfigV2, string(data))
+		assert.Equal(t, v2, annotation(cli, "controller-1"))
+		holder, err := clusterlock.Get(ctx, cli)
+		require.NoError(t, err)
+		assert.Nil(t, holder)
+
+		// nothing is left to do.
+		restarted, err = ConvergeEncryptionConfig(ctx, cli, sd, "controller-1", root)
+		require.NoError(t, err)
+		assert.False(t, restarted)
+		assert.Len(t, sd.restarts, 1)
+	})
+
+	t.Run("restarts k0s when the configuration was written but not applied", func(t *testing.T) {
+		node := controllerNode("controller-1", true)
+		node.Annotations = map[string]string{encryption.ConfigAnnotation: v1}
+		cli := fake.NewClientBuilder().WithScheme(k8sutil.Scheme()).WithObjects(node, secret(encryptionConfigV2)).Build()
+		sd := newFakeSystemd()
+		restarted, err := ConvergeEncryptionConfig(ctx, cli, sd, "controller-1", root)
+		require.NoError(t, err)
+		assert.True(t, restarted)
+		assert.Equal(t, []string{"k0scontroller.service"}, sd.restarts)
+		assert.Equal(t, v2, annotation(cli, "controller-1"))
+	})
+}
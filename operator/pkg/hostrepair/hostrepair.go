@@ -0,0 +1,165 @@
+// Package hostrepair restores the configuration files written by installs and joins on
+// the nodes, the containerd registry mirrors, the local artifact mirror unit and the
+// systemd drop-ins, when they go missing from the hosts. It also converges the systemd
+// units: the unit named after the binary links to the k0s unit of the node role, and the
+// k0s and local artifact mirror units are enabled and the mirror running. An agent running
+// on every node makes the repairs and records them on its node, the operator reports them
+// in the installation status. The agent also watches the connection tracking table of its
+// host, which is reported the same way. On controllers it adds the api SANs of the k0s
+// overrides to the k0s configuration and installs the encryption configuration of rotated
+// keys, restarting the controllers one at a time.
+package hostrepair
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	clusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/hostconfig"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+)
+
+// ReportAnnotation is the node annotation holding the last repair of its host.
+const ReportAnnotation = "replicated.com/host-config-repair"
+
+// Report records the files restored and the units changed on a host.
+type Report struct {
+	Time  metav1.Time `json:"time"`
+	Files []string    `json:"files"`
+	Units []string    `json:"units,omitempty"`
+}
+
+// Repair restores the configuration files of the latest installation missing under the
+// host root, converges the systemd units of the host and records the repairs on the node.
+// The k0s drop-ins are restored for the unit of the node role, k0scontroller or k0sworker.
+// Systemd drop-ins take effect the next time the service restarts. The restored files
+// followed by the changed units are returned.
+func Repair(ctx context.Context, cli client.Client, sd Systemd, nodeName, hostRoot string) ([]string, error) {
+	in, err := kubeutils.GetLatestInstallation(ctx, cli)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get latest installation: %w", err)
+	}
+	if err := readRegistryMirrorPasswords(ctx, cli, &in.Spec); err != nil {
+		return nil, err
+	}
+	var node corev1.Node
+	if err := cli.Get(ctx, client.ObjectKey{Name: nodeName}, &node); err != nil {
+		return nil, fmt.Errorf("unable to get node %s: %w", nodeName, err)
+	}
+	controller := IsController(node)
+	files := hostconfig.WorkerFiles(in.Spec)
+	if controller {
+		files = hostconfig.ControllerFiles(in.Spec, internalIP(node))
+	}
+	restored, err := hostconfig.Restore(hostRoot, files)
+	var units []string
+	if err == nil {
+		units, err = convergeUnits(ctx, sd, hostRoot, in.Spec.BinaryName, controller, len(restored) > 0)
+	}
+	if len(restored) == 0 && len(units) == 0 {
+		return nil, err
+	}
+	if rerr := record(ctx, cli, nodeName, Report{Time: metav1.Now(), Files: restored, Units: units}); rerr != nil {
+		return append(restored, units...), rerr
+	}
+	return append(restored, units...), err
+}
+
+// readRegistryMirrorPasswords reads the passwords of the registry mirrors, the installation
+// only references them, so the containerd configuration is restored with its credentials.
+func readRegistryMirrorPasswords(ctx context.Context, cli client.Client, spec *clusterv1beta1.InstallationSpec) error {
+	if !spec.HasRegistryMirrorPasswords() {
+		return nil
+	}
+	var secret corev1.Secret
+	key := client.ObjectKey{Namespace: Namespace, Name: clusterv1beta1.RegistryMirrorsSecretName}
+	if err := cli.Get(ctx, key, &secret); err != nil {
+		return fmt.Errorf("unable to get registry mirrors secret: %w", err)
+	}
+	if err := spec.ParseRegistryMirrorPasswordsFromSecret(secret); err != nil {
+		return fmt.Errorf("unable to parse registry mirror passwords: %w", err)
+	}
+	return nil
+}
+
+// internalIP returns the internal address of the node, empty if it has none.
+func internalIP(node corev1.Node) string {
+	for _, addr := range node.Status.Addresses {
+		if addr.Type == corev1.NodeInternalIP {
+			return addr.Address
+		}
+	}
+	return ""
+}
+
+// IsController returns true if the node runs the k0s controller.
+func IsController(node corev1.Node) bool {
+	return node.Labels["node-role.kubernetes.io/control-plane"] == "true"
+}
+
+// record stores the report in the node annotation.
+func record(ctx context.Context, cli client.Client, nodeName string, report Report) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("unable to encode repair report: %w", err)
+	}
+	var node corev1.Node
+	if err := cli.Get(ctx, client.ObjectKey{Name: nodeName}, &node); err != nil {
+		return fmt.Errorf("unable to get node %s: %w", nodeName, err)
+	}
+	patch := client.MergeFrom(node.DeepCopy())
+	if node.Annotations == nil {
+		node.Annotations = map[string]string{}
+	}
+	node.Annotations[ReportAnnotation] = string(data)
+	if err := cli.Patch(ctx, &node, patch); err != nil {
+		return fmt.Errorf("unable to record repair on node %s: %w", nodeName, err)
+	}
+	return nil
+}
+
+// Condition returns the condition reporting the last repair recorded on each node.
+// Annotations that can not be parsed are ignored.
+func Condition(conditionType string, nodes []corev1.Node, generation int64) metav1.Condition {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+	var repairs []string
+	for _, node := range nodes {
+		data, ok := node.Annotations[ReportAnnotation]
+		if !ok {
+			continue
+		}
+		var report Report
+		if err := json.Unmarshal([]byte(data), &report); err != nil || len(report.Files)+len(report.Units) == 0 {
+			continue
+		}
+		repairs = append(repairs, fmt.Sprintf(
+			"%s at %s: %s", node.Name, report.Time.UTC().Format(time.RFC3339),
+			strings.Join(append(report.Files, report.Units...), ", "),
+		))
+	}
+	if len(repairs) == 0 {
+		return metav1.Condition{
+			Type:               conditionType,
+			Status:             metav1.ConditionFalse,
+			Reason:             "NoDriftDetected",
+			ObservedGeneration: generation,
+		}
+	}
+	return metav1.Condition{
+		Type:               conditionType,
+		Status:             metav1.ConditionTrue,
+		Reason:             "MissingFilesRestored",
+		Message:            fmt.Sprintf("Missing host configuration restored on %s", strings.Join(repairs, "; ")),
+		ObservedGeneration: generation,
+	}
+}
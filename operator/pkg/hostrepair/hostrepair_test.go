@@ -0,0 +1,180 @@
+package hostrepair
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	clusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/k8sutil"
+	"github.com/replicatedhq/embedded-cluster/pkg/hostconfig"
+)
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	cli := fake.NewClientBuilder().WithScheme(k8sutil.Scheme()).Build()
+	key := client.ObjectKey{Namespace: Namespace, Name: Name}
+
+	require.NoError(t, Reconcile(ctx, cli, "operator:1.0"))
+	var ds appsv1.DaemonSet
+	require.NoError(t, cli.Get(ctx, key, &ds))
+	spec := ds.Spec.Template.Spec
+	assert.Equal(t, "operator:1.0", spec.Containers[0].Image)
+	assert.Equal(t, []string{"host-repair", "agent"}, spec.Containers[0].Args)
+	assert.Equal(t, "/etc", spec.Volumes[0].HostPath.Path)
+	assert.Equal(t, "/host/etc", spec.Containers[0].VolumeMounts[0].MountPath)
+	assert.Nil(t, spec.Affinity, "the agent runs on controllers and workers")
+	assert.True(t, spec.HostNetwork, "the agent reads the conntrack table of the host")
+
+	// the agent follows the operator image.
+	require.NoError(t, Reconcile(ctx, cli, "operator:2.0"))
+	require.NoError(t, cli.Get(ctx, key, &ds))
+	assert.Equal(t, "operator:2.0", ds.Spec.Template.Spec.Containers[0].Image)
+}
+
+func TestRepair(t *testing.T) {
+	ctx := context.Background()
+	in := &clusterv1beta1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Name: "20241010120000"},
+		Spec: clusterv1beta1.InstallationSpec{
+			Proxy: &clusterv1beta1.ProxySpec{HTTPProxy: "http://proxy:3128"},
+		},
+	}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}}
+	cli := fake.NewClientBuilder().WithScheme(k8sutil.Scheme()).WithObjects(in, node).Build()
+
+	root := t.TempDir()
+	dropIn := filepath.Join(root, hostconfig.LocalArtifactMirrorDropInPath)
+	require.NoError(t, os.MkdirAll(filepath.Dir(dropIn), 0755))
+	require.NoError(t, os.WriteFile(dropIn, []byte("[Service]\n"), 0644))
+
+	sd := newFakeSystemd()
+	restored, err := Repair(ctx, cli, sd, "worker-1", root)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		hostconfig.WorkerProxyDropInPath,
+		hostconfig.LocalArtifactMirrorUnitPath,
+		"k0sworker.service enabled",
+		"local-artifact-mirror.service enabled",
+		"local-artifact-mirror.service started",
+	}, restored)
+	assert.FileExists(t, filepath.Join(root, hostconfig.WorkerProxyDropInPath))
+	assert.Equal(t, 1, sd.reloads, "systemd is reloaded after restoring the unit")
+
+	require.NoError(t, cli.Get(ctx, client.ObjectKeyFromObject(node), node))
+	var report Report
+	require.NoError(t, json.Unmarshal([]byte(node.Annotations[ReportAnnotation]), &report))
+	assert.Equal(t, []string{hostconfig.WorkerProxyDropInPath, hostconfig.LocalArtifactMirrorUnitPath}, report.Files)
+	assert.Len(t, report.Units, 3)
+
+	// nothing is recorded when nothing is missing.
+	node.Annotations = nil
+	require.NoError(t, cli.Update(ctx, node))
+	restored, err = Repair(ctx, cli, sd, "worker-1", root)
+	require.NoError(t, err)
+	assert.Empty(t, restored)
+	require.NoError(t, cli.Get(ctx, client.ObjectKeyFromObject(node), node))
+	assert.Empty(t, node.Annotations)
+}
+
+func TestCondition(t *testing.T) {
+	report, err := json.Marshal(Report{
+		Time:  metav1.NewTime(time.Date(2024, 10, 10, 12, 0, 0, 0, time.UTC)),
+		Files: []string{"/etc/k0s/containerd.d/hosts.d/docker.io/hosts.toml", hostconfig.WorkerProxyDropInPath},
+	})
+	require.NoError(t, err)
+	nodes := []corev1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "worker-2", Annotations: map[string]string{ReportAnnotation: "invalid"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "worker-1", Annotations: map[string]string{ReportAnnotation: string(report)}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "controller-1"}},
+	}
+
+	cond := Condition("HostConfigRepair", nodes, 3)
+	assert.Equal(t, metav1.ConditionTrue, cond.Status)
+	assert.Equal(t, "MissingFilesRestored", cond.Reason)
+	assert.Equal(t, int64(3), cond.ObservedGeneration)
+	assert.Equal(t, "Missing host configuration restored on worker-1 at 2024-10-10T12:00:00Z: "+
+		"/etc/k0s/containerd.d/hosts.d/docker.io/hosts.toml, /etc/systemd/system/k0sworker.service.d/http-proxy.conf", cond.Message)
+
+	cond = Condition("HostConfigRepair", nodes[2:], 3)
+	assert.Equal(t, metav1.ConditionFalse, cond.Status)
+	assert.Equal(t, "NoDriftDetected", cond.Reason)
+}
+
+func TestRepairController(t *testing.T) {
+	ctx := context.Background()
+	in := &clusterv1beta1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Name: "20241010120000"},
+		Spec: clusterv1beta1.InstallationSpec{
+			Proxy: &clusterv1beta1.ProxySpec{HTTPProxy: "http://proxy:3128"},
+		},
+	}
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "controller-1",
+			Labels: map[string]string{"node-role.kubernetes.io/control-plane": "true"},
+		},
+		Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.1"}}},
+	}
+	cli := fake.NewClientBuilder().WithScheme(k8sutil.Scheme()).WithObjects(in, node).Build()
+
+	root := t.TempDir()
+	sd := newFakeSystemd()
+	sd.enabled[LocalArtifactMirrorUnit], sd.active[LocalArtifactMirrorUnit] = true, true
+	sd.enabled["k0scontroller.service"] = true
+	restored, err := Repair(ctx, cli, sd, "controller-1", root)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		hostconfig.ControllerProxyDropInPath,
+		hostconfig.LocalArtifactMirrorUnitPath,
+		hostconfig.LocalArtifactMirrorDropInPath,
+	}, restored)
+	data, err := os.ReadFile(filepath.Join(root, hostconfig.LocalArtifactMirrorDropInPath))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "LOCAL_ARTIFACT_MIRROR_LISTEN_ADDRESS=10.0.0.1")
+}
+
+func TestRepairRegistryMirrorPasswords(t *testing.T) {
+	ctx := context.Background()
+	in := &clusterv1beta1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Name: "20241010120000"},
+		Spec: clusterv1beta1.InstallationSpec{
+			RegistryMirrors: []clusterv1beta1.RegistryMirror{{
+				Registry: "docker.io",
+				Endpoints: []clusterv1beta1.RegistryMirrorEndpoint{
+					{URL: "https://harbor.example.com", Username: "user", PasswordSecretKey: "mirror-0-endpoint-0"},
+				},
+			}},
+		},
+	}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}}
+	cli := fake.NewClientBuilder().WithScheme(k8sutil.Scheme()).WithObjects(in, node).Build()
+
+	// the passwords are only in the registry mirrors secret.
+	_, err := Repair(ctx, cli, newFakeSystemd(), "worker-1", t.TempDir())
+	require.ErrorContains(t, err, "unable to get registry mirrors secret")
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: clusterv1beta1.RegistryMirrorsSecretName, Namespace: Namespace},
+		Data:       map[string][]byte{"mirror-0-endpoint-0": []byte("secret")},
+	}
+	require.NoError(t, cli.Create(ctx, secret))
+	root := t.TempDir()
+	restored, err := Repair(ctx, cli, newFakeSystemd(), "worker-1", root)
+	require.NoError(t, err)
+	require.NotEmpty(t, restored)
+	data, err := os.ReadFile(filepath.Join(root, restored[0]))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "Basic dXNlcjpzZWNyZXQ=")
+}
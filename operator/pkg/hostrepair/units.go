@@ -0,0 +1,167 @@
+package hostrepair
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/hostconfig"
+)
+
+// LocalArtifactMirrorUnit is the name of the systemd unit of the local artifact mirror.
+const LocalArtifactMirrorUnit = "local-artifact-mirror.service"
+
+// Systemd manages the units of the host.
+type Systemd interface {
+	Reload(ctx context.Context) error
+	IsEnabled(ctx context.Context, unit string) (bool, error)
+	Enable(ctx context.Context, unit string) error
+	IsActive(ctx context.Context, unit string) (bool, error)
+	Start(ctx context.Context, unit string) error
+	Restart(ctx context.Context, unit string) error
+}
+
+// convergeUnits links the unit named after the binary to the k0s unit of the node role,
+// and enables the k0s and the local artifact mirror units and starts the local artifact
+// mirror if they are not. The k0s unit is never started, the agent only runs while k0s
+// does. Systemd is reloaded first if unit files were restored. Returns the units changed.
+func convergeUnits(ctx context.Context, sd Systemd, hostRoot, binaryName string, controller, reload bool) ([]string, error) {
+	var changed []string
+	k0sUnit := hostconfig.K0sUnitPath(controller)
+	if binaryName != "" {
+		link := hostconfig.BinaryUnitPath(binaryName)
+		linked, err := hostconfig.RestoreLink(hostRoot, link, k0sUnit)
+		if err != nil {
+			return nil, err
+		}
+		if linked {
+			changed = append(changed, fmt.Sprintf("%s linked", filepath.Base(link)))
+			reload = true
+		}
+	}
+	if reload {
+		if err := sd.Reload(ctx); err != nil {
+			return changed, fmt.Errorf("unable to reload systemd: %w", err)
+		}
+	}
+	for _, unit := range []string{filepath.Base(k0sUnit), LocalArtifactMirrorUnit} {
+		enabled, err := sd.IsEnabled(ctx, unit)
+		if err != nil {
+			return changed, fmt.Errorf("unable to get the state of %s: %w", unit, err)
+		}
+		if !enabled {
+			if err := sd.Enable(ctx, unit); err != nil {
+				return changed, fmt.Errorf("unable to enable %s: %w", unit, err)
+			}
+			changed = append(changed, fmt.Sprintf("%s enabled", unit))
+		}
+	}
+	active, err := sd.IsActive(ctx, LocalArtifactMirrorUnit)
+	if err != nil {
+		return changed, fmt.Errorf("unable to get the state of %s: %w", LocalArtifactMirrorUnit, err)
+	}
+	if !active {
+		if err := sd.Start(ctx, LocalArtifactMirrorUnit); err != nil {
+			return changed, fmt.Errorf("unable to start %s: %w", LocalArtifactMirrorUnit, err)
+		}
+		changed = append(changed, fmt.Sprintf("%s started", LocalArtifactMirrorUnit))
+	}
+	return changed, nil
+}
+
+// NewSystemd returns the systemd of the host, reached through its private socket under
+// the host /run/systemd directory mounted in the agent container.
+func NewSystemd() Systemd {
+	return hostSystemd{}
+}
+
+type hostSystemd struct{}
+
+func (hostSystemd) Reload(ctx context.Context) error {
+	conn, err := dbus.NewSystemdConnectionContext(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to connect to systemd: %w", err)
+	}
+	defer conn.Close()
+	return conn.ReloadContext(ctx)
+}
+
+func (hostSystemd) IsEnabled(ctx context.Context, unit string) (bool, error) {
+	conn, err := dbus.NewSystemdConnectionContext(ctx)
+	if err != nil {
+		return false, fmt.Errorf("unable to connect to systemd: %w", err)
+	}
+	defer conn.Close()
+	prop, err := conn.GetUnitPropertyContext(ctx, unit, "UnitFileState")
+	if err != nil {
+		return false, err
+	}
+	return prop.Value.String() == `"enabled"`, nil
+}
+
+func (hostSystemd) Enable(ctx context.Context, unit string) error {
+	conn, err := dbus.NewSystemdConnectionContext(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to connect to systemd: %w", err)
+	}
+	defer conn.Close()
+	_, _, err = conn.EnableUnitFilesContext(ctx, []string{unit}, false, false)
+	return err
+}
+
+func (hostSystemd) IsActive(ctx context.Context, unit string) (bool, error) {
+	conn, err := dbus.NewSystemdConnectionContext(ctx)
+	if err != nil {
+		return false, fmt.Errorf("unable to connect to systemd: %w", err)
+	}
+	defer conn.Close()
+	prop, err := conn.GetUnitPropertyContext(ctx, unit, "ActiveState")
+	if err != nil {
+		return false, err
+	}
+	return prop.Value.String() == `"active"`, nil
+}
+
+func (hostSystemd) Start(ctx context.Context, unit string) error {
+	conn, err := dbus.NewSystemdConnectionContext(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to connect to systemd: %w", err)
+	}
+	defer conn.Close()
+	done := make(chan string, 1)
+	if _, err := conn.StartUnitContext(ctx, unit, "replace", done); err != nil {
+		return err
+	}
+	select {
+	case result := <-done:
+		if result != "done" {
+			return fmt.Errorf("start job %s", result)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (hostSystemd) Restart(ctx context.Context, unit string) error {
+	conn, err := dbus.NewSystemdConnectionContext(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to connect to systemd: %w", err)
+	}
+	defer conn.Close()
+	done := make(chan string, 1)
+	if _, err := conn.RestartUnitContext(ctx, unit, "replace", done); err != nil {
+		return err
+	}
+	select {
+	case result := <-done:
+		if result != "done" {
+			return fmt.Errorf("restart job %s", result)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,81 @@
+package hostrepair
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/hostconfig"
+)
+
+type fakeSystemd struct {
+	reloads  int
+	enabled  map[string]bool
+	active   map[string]bool
+	restarts []string
+}
+
+func newFakeSystemd() *fakeSystemd {
+	return &fakeSystemd{enabled: map[string]bool{}, active: map[string]bool{}}
+}
+
+func (f *fakeSystemd) Reload(ctx context.Context) error {
+	f.reloads++
+	return nil
+}
+
+func (f *fakeSystemd) IsEnabled(ctx context.Context, unit string) (bool, error) {
+	return f.enabled[unit], nil
+}
+
+func (f *fakeSystemd) Enable(ctx context.Context, unit string) error {
+	f.enabled[unit] = true
+	return nil
+}
+
+func (f *fakeSystemd) IsActive(ctx context.Context, unit string) (bool, error) {
+	return f.active[unit], nil
+}
+
+func (f *fakeSystemd) Start(ctx context.Context, unit string) error {
+	f.active[unit] = true
+	return nil
+}
+
+func (f *fakeSystemd) Restart(ctx context.Context, unit string) error {
+	f.restarts = append(f.restarts, unit)
+	return nil
+}
+
+func TestConvergeUnits(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	k0sUnit := filepath.Join(root, hostconfig.K0sUnitPath(true))
+	require.NoError(t, os.MkdirAll(filepath.Dir(k0sUnit), 0755))
+	require.NoError(t, os.WriteFile(k0sUnit, []byte("[Unit]\n"), 0644))
+
+	sd := newFakeSystemd()
+	sd.enabled["k0scontroller.service"] = true
+	changed, err := convergeUnits(ctx, sd, root, "my-app", true, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"my-app.service linked",
+		"local-artifact-mirror.service enabled",
+		"local-artifact-mirror.service started",
+	}, changed)
+	assert.Equal(t, 1, sd.reloads, "systemd is reloaded after linking the unit")
+	target, err := os.Readlink(filepath.Join(root, hostconfig.BinaryUnitPath("my-app")))
+	require.NoError(t, err)
+	assert.Equal(t, hostconfig.K0sUnitPath(true), target)
+	assert.False(t, sd.active["k0scontroller.service"], "k0s is never started by the agent")
+
+	// nothing changes once converged.
+	changed, err = convergeUnits(ctx, sd, root, "my-app", true, false)
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+	assert.Equal(t, 1, sd.reloads)
+}
@@ -11,6 +11,7 @@ import (
 	k0shelm "github.com/k0sproject/k0s/pkg/apis/helm/v1beta1"
 	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
 	embeddedclusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -29,6 +30,7 @@ func init() {
 	utilruntime.Must(autopilotv1beta2.AddToScheme(newScheme))
 	utilruntime.Must(k0sv1beta1.AddToScheme(newScheme))
 	utilruntime.Must(k0shelm.AddToScheme(newScheme))
+	utilruntime.Must(velerov1.AddToScheme(newScheme))
 }
 
 func Scheme() *runtime.Scheme {
@@ -52,6 +52,7 @@ type UpgradeFailedEvent struct {
 	TargetVersion  string `json:"targetVersion"`
 	InitialVersion string `json:"initialVersion"`
 	Reason         string `json:"reason"`
+	ErrorKind      string `json:"errorKind,omitempty"`
 }
 
 // UpgradeSucceededEvent event is send back home when the upgrade succeeds.
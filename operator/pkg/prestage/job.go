@@ -0,0 +1,314 @@
+package prestage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	clusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/util"
+	"github.com/replicatedhq/embedded-cluster/pkg/registrymirror"
+)
+
+const (
+	// Namespace is where the prestage jobs run.
+	Namespace = "embedded-cluster"
+	// VersionAnnotation is the job annotation holding the version it downloads.
+	VersionAnnotation = "embedded-cluster.replicated.com/prestage-version"
+	// jobPrefix prefixes the name of the job of each node.
+	jobPrefix = "prestage-"
+)
+
+// jobLabels returns the labels identifying the prestage jobs.
+func jobLabels() map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/component":  "prestage",
+		"app.kubernetes.io/part-of":    "embedded-cluster",
+		"app.kubernetes.io/managed-by": "embedded-cluster-operator",
+	}
+}
+
+// Reconcile starts, during the window, a job downloading the artifacts of the requested
+// version on each node and returns the condition reporting their progress. The jobs of
+// other versions are removed, except the ones of the installed version an upgrade may
+// still read from, and failed jobs are started again on a later reconcile.
+// Nothing is downloaded for airgap installations, they copy the artifacts of the airgap
+// bundle to the nodes instead.
+func Reconcile(ctx context.Context, cli client.Client, in *clusterv1beta1.Installation, image string, now time.Time, conditionType string) (metav1.Condition, error) {
+	cond := metav1.Condition{Type: conditionType, Status: metav1.ConditionFalse, ObservedGeneration: in.Generation}
+	var version, installed string
+	if in.Spec.Prestage != nil {
+		version = in.Spec.Prestage.Version
+	}
+	if in.Spec.Config != nil {
+		installed = in.Spec.Config.Version
+	}
+	switch {
+	case in.Spec.AirGap:
+		cond.Reason, cond.Message = "AirgapInstallation", "Artifacts are only prestaged for online installations"
+		version = ""
+	case version == "":
+		cond.Reason = "NotRequested"
+	case sameVersion(version, installed):
+		cond.Reason, cond.Message = "AlreadyInstalled", fmt.Sprintf("Version %s is already installed", version)
+		version = ""
+	}
+
+	jobs, err := listJobs(ctx, cli)
+	if err != nil {
+		return cond, err
+	}
+	if version == "" {
+		for _, job := range jobs {
+			// the upgrade to the installed version may still read its artifacts.
+			if sameVersion(job.Annotations[VersionAnnotation], installed) {
+				continue
+			}
+			if err := deleteJob(ctx, cli, job); err != nil {
+				return cond, err
+			}
+		}
+		return cond, nil
+	}
+
+	window, err := ParseWindow(in.Spec.Prestage.Window)
+	if err != nil {
+		cond.Reason, cond.Message = "InvalidWindow", err.Error()
+		return cond, nil
+	}
+	open := window.Contains(now)
+
+	var nodes corev1.NodeList
+	if err := cli.List(ctx, &nodes); err != nil {
+		return cond, fmt.Errorf("unable to list nodes: %w", err)
+	}
+	var staged, waiting int
+	var failed []string
+	for _, node := range nodes.Items {
+		job, ok := jobs[node.Name]
+		delete(jobs, node.Name)
+		if ok && !sameVersion(job.Annotations[VersionAnnotation], version) {
+			if err := deleteJob(ctx, cli, job); err != nil {
+				return cond, err
+			}
+			ok = false
+		}
+		switch {
+		case !ok && open:
+			if err := cli.Create(ctx, NewJob(in, node.Name, version, image)); err != nil {
+				return cond, fmt.Errorf("unable to create prestage job for node %s: %w", node.Name, err)
+			}
+		case !ok:
+			waiting++
+		case job.Status.Succeeded > 0:
+			staged++
+		case isFailed(job):
+			failed = append(failed, node.Name)
+			if open {
+				if err := deleteJob(ctx, cli, job); err != nil {
+					return cond, err
+				}
+			}
+		}
+	}
+	// the nodes left the cluster.
+	for _, job := range jobs {
+		if err := deleteJob(ctx, cli, job); err != nil {
+			return cond, err
+		}
+	}
+
+	switch {
+	case len(nodes.Items) > 0 && staged == len(nodes.Items):
+		cond.Status, cond.Reason = metav1.ConditionTrue, "Staged"
+		cond.Message = fmt.Sprintf("Artifacts of version %s are staged on all nodes", version)
+	case len(failed) > 0:
+		sort.Strings(failed)
+		cond.Reason = "Failed"
+		cond.Message = fmt.Sprintf("Failed to stage the artifacts of version %s on %s", version, strings.Join(failed, ", "))
+	case waiting == len(nodes.Items)-staged && !open:
+		cond.Reason = "OutsideWindow"
+		cond.Message = fmt.Sprintf("Artifacts of version %s are staged on %d of %d nodes, waiting for the %s window", version, staged, len(nodes.Items), in.Spec.Prestage.Window)
+	default:
+		cond.Reason = "InProgress"
+		cond.Message = fmt.Sprintf("Artifacts of version %s are staged on %d of %d nodes", version, staged, len(nodes.Items))
+	}
+	return cond, nil
+}
+
+// Staged returns true if the artifacts of the version were downloaded on every node.
+func Staged(ctx context.Context, cli client.Client, version string) (bool, error) {
+	jobs, err := listJobs(ctx, cli)
+	if err != nil {
+		return false, err
+	}
+	var nodes corev1.NodeList
+	if err := cli.List(ctx, &nodes); err != nil {
+		return false, fmt.Errorf("unable to list nodes: %w", err)
+	}
+	if len(nodes.Items) == 0 {
+		return false, nil
+	}
+	for _, node := range nodes.Items {
+		job, ok := jobs[node.Name]
+		if !ok || !sameVersion(job.Annotations[VersionAnnotation], version) || job.Status.Succeeded == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// sameVersion returns true if both versions are the same, with or without the v prefix.
+func sameVersion(a, b string) bool {
+	return a != "" && strings.TrimPrefix(a, "v") == strings.TrimPrefix(b, "v")
+}
+
+// listJobs returns the prestage jobs by node name.
+func listJobs(ctx context.Context, cli client.Client) (map[string]*batchv1.Job, error) {
+	var list batchv1.JobList
+	if err := cli.List(ctx, &list, client.InNamespace(Namespace), client.MatchingLabels(jobLabels())); err != nil {
+		return nil, fmt.Errorf("unable to list prestage jobs: %w", err)
+	}
+	jobs := map[string]*batchv1.Job{}
+	for i, job := range list.Items {
+		jobs[job.Spec.Template.Spec.NodeName] = &list.Items[i]
+	}
+	return jobs, nil
+}
+
+func deleteJob(ctx context.Context, cli client.Client, job *batchv1.Job) error {
+	err := cli.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground))
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return fmt.Errorf("unable to delete prestage job %s: %w", job.Name, err)
+	}
+	return nil
+}
+
+func isFailed(job *batchv1.Job) bool {
+	for _, cond := range job.Status.Conditions {
+		if cond.Type == batchv1.JobFailed && cond.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// NewJob returns the job downloading the artifacts of the version on the node. The job
+// runs the operator image and mounts the embedded cluster directory, where the k0s binary
+// is stored, and the k0s containerd socket the images are pulled into.
+func NewJob(in *clusterv1beta1.Installation, nodeName, version, image string) *batchv1.Job {
+	args := []string{"prestage", "run", "--version", version}
+	env := []corev1.EnvVar{
+		{Name: "SSL_CERT_DIR", Value: "/certs"},
+	}
+	if in.Spec.Proxy != nil {
+		env = append(env,
+			corev1.EnvVar{Name: "HTTP_PROXY", Value: in.Spec.Proxy.HTTPProxy},
+			corev1.EnvVar{Name: "HTTPS_PROXY", Value: in.Spec.Proxy.HTTPSProxy},
+			corev1.EnvVar{Name: "NO_PROXY", Value: in.Spec.Proxy.NoProxy},
+		)
+	}
+	volumes := []corev1.Volume{
+		{
+			Name: "data",
+			VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{
+					Path: DataDir,
+					Type: ptr.To(corev1.HostPathDirectory),
+				},
+			},
+		},
+		{
+			Name: "containerd",
+			VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{
+					Path: ContainerdAddress,
+					Type: ptr.To(corev1.HostPathSocket),
+				},
+			},
+		},
+		{
+			Name: "private-cas",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "private-cas"},
+					Optional:             ptr.To(true),
+				},
+			},
+		},
+	}
+	mounts := []corev1.VolumeMount{
+		{Name: "data", MountPath: DataDir},
+		{Name: "containerd", MountPath: ContainerdAddress},
+		{Name: "private-cas", MountPath: "/certs"},
+	}
+	if len(in.Spec.RegistryMirrors) > 0 {
+		// the images are pulled through the same mirrors containerd uses.
+		hostsDir := registrymirror.HostsDir()
+		args = append(args, "--hosts-dir", hostsDir)
+		volumes = append(volumes, corev1.Volume{
+			Name: "hosts-dir",
+			VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{
+					Path: hostsDir,
+					Type: ptr.To(corev1.HostPathDirectory),
+				},
+			},
+		})
+		mounts = append(mounts, corev1.VolumeMount{Name: "hosts-dir", MountPath: hostsDir, ReadOnly: true})
+	}
+
+	return &batchv1.Job{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "batch/v1",
+			Kind:       "Job",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        util.NameWithLengthLimit(jobPrefix, nodeName),
+			Namespace:   Namespace,
+			Labels:      jobLabels(),
+			Annotations: map[string]string{VersionAnnotation: version},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: ptr.To[int32](2),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: jobLabels(),
+				},
+				Spec: corev1.PodSpec{
+					NodeName:           nodeName,
+					RestartPolicy:      corev1.RestartPolicyNever,
+					ServiceAccountName: "embedded-cluster-operator",
+					Tolerations: []corev1.Toleration{
+						{Operator: corev1.TolerationOpExists},
+					},
+					Volumes: volumes,
+					Containers: []corev1.Container{
+						{
+							Name:         "prestage",
+							Image:        image,
+							Command:      []string{"/manager"},
+							Args:         args,
+							Env:          env,
+							VolumeMounts: mounts,
+							SecurityContext: &corev1.SecurityContext{
+								// the embedded cluster directory and the containerd socket
+								// are owned by root.
+								RunAsUser: ptr.To[int64](0),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
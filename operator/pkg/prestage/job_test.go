@@ -0,0 +1,144 @@
+package prestage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	clusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/k8sutil"
+)
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	in := &clusterv1beta1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Name: "20241010120000", Generation: 2},
+		Spec: clusterv1beta1.InstallationSpec{
+			Config:   &clusterv1beta1.ConfigSpec{Version: "1.0.0"},
+			Prestage: &clusterv1beta1.PrestageSpec{Version: "1.1.0", Window: "22:00-06:00"},
+		},
+	}
+	nodes := []client.Object{
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}},
+	}
+	cli := fake.NewClientBuilder().WithScheme(k8sutil.Scheme()).WithObjects(nodes...).Build()
+	listJobs := func() []batchv1.Job {
+		var list batchv1.JobList
+		require.NoError(t, cli.List(ctx, &list, client.InNamespace(Namespace)))
+		return list.Items
+	}
+	setStatus := func(name string, status batchv1.JobStatus) {
+		var job batchv1.Job
+		require.NoError(t, cli.Get(ctx, client.ObjectKey{Namespace: Namespace, Name: name}, &job))
+		job.Status = status
+		require.NoError(t, cli.Status().Update(ctx, &job))
+	}
+	noon := time.Date(2024, 10, 10, 12, 0, 0, 0, time.UTC)
+	night := time.Date(2024, 10, 10, 23, 0, 0, 0, time.UTC)
+
+	// nothing starts outside of the window.
+	cond, err := Reconcile(ctx, cli, in, "operator:1.0", noon, "ArtifactsPrestaged")
+	require.NoError(t, err)
+	assert.Equal(t, "OutsideWindow", cond.Reason)
+	assert.Equal(t, int64(2), cond.ObservedGeneration)
+	assert.Empty(t, listJobs())
+
+	cond, err = Reconcile(ctx, cli, in, "operator:1.0", night, "ArtifactsPrestaged")
+	require.NoError(t, err)
+	assert.Equal(t, metav1.ConditionFalse, cond.Status)
+	assert.Equal(t, "InProgress", cond.Reason)
+	jobs := listJobs()
+	require.Len(t, jobs, 2)
+	assert.Equal(t, "1.1.0", jobs[0].Annotations[VersionAnnotation])
+	assert.Equal(t, []string{"prestage", "run", "--version", "1.1.0"}, jobs[0].Spec.Template.Spec.Containers[0].Args)
+
+	// the window closing does not interrupt the downloads already started.
+	setStatus("prestage-node-1", batchv1.JobStatus{Succeeded: 1})
+	cond, err = Reconcile(ctx, cli, in, "operator:1.0", noon, "ArtifactsPrestaged")
+	require.NoError(t, err)
+	assert.Equal(t, "InProgress", cond.Reason)
+	assert.Equal(t, "Artifacts of version 1.1.0 are staged on 1 of 2 nodes", cond.Message)
+	staged, err := Staged(ctx, cli, "1.1.0")
+	require.NoError(t, err)
+	assert.False(t, staged)
+
+	setStatus("prestage-node-2", batchv1.JobStatus{Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}}})
+	cond, err = Reconcile(ctx, cli, in, "operator:1.0", noon, "ArtifactsPrestaged")
+	require.NoError(t, err)
+	assert.Equal(t, "Failed", cond.Reason)
+	assert.Equal(t, "Failed to stage the artifacts of version 1.1.0 on node-2", cond.Message)
+	assert.Len(t, listJobs(), 2, "failed jobs are only retried during the window")
+
+	// failed jobs are removed during the window and started again by the next reconcile.
+	_, err = Reconcile(ctx, cli, in, "operator:1.0", night, "ArtifactsPrestaged")
+	require.NoError(t, err)
+	assert.Len(t, listJobs(), 1)
+	_, err = Reconcile(ctx, cli, in, "operator:1.0", night, "ArtifactsPrestaged")
+	require.NoError(t, err)
+	assert.Len(t, listJobs(), 2)
+
+	setStatus("prestage-node-2", batchv1.JobStatus{Succeeded: 1})
+	cond, err = Reconcile(ctx, cli, in, "operator:1.0", noon, "ArtifactsPrestaged")
+	require.NoError(t, err)
+	assert.Equal(t, metav1.ConditionTrue, cond.Status)
+	assert.Equal(t, "Staged", cond.Reason)
+	staged, err = Staged(ctx, cli, "v1.1.0")
+	require.NoError(t, err)
+	assert.True(t, staged)
+
+	// the jobs are kept once the version is installed, the upgrade reads from them.
+	upgraded := in.DeepCopy()
+	upgraded.Spec.Config.Version = "1.1.0"
+	upgraded.Spec.Prestage = nil
+	cond, err = Reconcile(ctx, cli, upgraded, "operator:1.0", noon, "ArtifactsPrestaged")
+	require.NoError(t, err)
+	assert.Equal(t, "NotRequested", cond.Reason)
+	assert.Len(t, listJobs(), 2)
+
+	// and replaced when the next version is requested.
+	upgraded.Spec.Prestage = &clusterv1beta1.PrestageSpec{Version: "1.2.0"}
+	_, err = Reconcile(ctx, cli, upgraded, "operator:1.0", noon, "ArtifactsPrestaged")
+	require.NoError(t, err)
+	jobs = listJobs()
+	require.Len(t, jobs, 2)
+	assert.Equal(t, "1.2.0", jobs[0].Annotations[VersionAnnotation])
+	staged, err = Staged(ctx, cli, "1.1.0")
+	require.NoError(t, err)
+	assert.False(t, staged)
+
+	// airgap installations never prestage.
+	upgraded.Spec.AirGap = true
+	cond, err = Reconcile(ctx, cli, upgraded, "operator:1.0", noon, "ArtifactsPrestaged")
+	require.NoError(t, err)
+	assert.Equal(t, "AirgapInstallation", cond.Reason)
+	assert.Empty(t, listJobs())
+}
+
+func TestNewJob(t *testing.T) {
+	in := &clusterv1beta1.Installation{
+		Spec: clusterv1beta1.InstallationSpec{
+			Proxy: &clusterv1beta1.ProxySpec{HTTPSProxy: "http://proxy:3128"},
+			RegistryMirrors: []clusterv1beta1.RegistryMirror{
+				{Registry: "docker.io", Endpoints: []clusterv1beta1.RegistryMirrorEndpoint{{URL: "https://harbor.example.com"}}},
+			},
+		},
+	}
+	job := NewJob(in, "node-1", "1.1.0", "operator:1.0")
+	spec := job.Spec.Template.Spec
+	assert.Equal(t, "node-1", spec.NodeName)
+	assert.Equal(t, "operator:1.0", spec.Containers[0].Image)
+	assert.Contains(t, spec.Containers[0].Env, corev1.EnvVar{Name: "HTTPS_PROXY", Value: "http://proxy:3128"})
+	args := spec.Containers[0].Args
+	assert.Equal(t, "--hosts-dir", args[len(args)-2])
+	assert.Equal(t, args[len(args)-1], spec.Volumes[len(spec.Volumes)-1].HostPath.Path)
+	assert.Equal(t, ContainerdAddress, spec.Volumes[1].HostPath.Path)
+}
@@ -0,0 +1,161 @@
+// Package prestage downloads the artifacts of the next release of an online installation
+// on every node ahead of its upgrade, so the upgrade window is not spent downloading them.
+// A job per node, started during the configured window, stores the k0s binary in the
+// directory served by the local artifact mirror and pulls the images into containerd.
+// The upgrade then has autopilot read the k0s binary from the mirror.
+package prestage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/release"
+	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+)
+
+const (
+	// DataDir is the embedded cluster directory of the hosts, the local artifact mirror
+	// serves its bin directory.
+	DataDir = "/var/lib/embedded-cluster"
+	// ContainerdAddress is the socket of the k0s containerd on the hosts.
+	ContainerdAddress = "/run/k0s/containerd.sock"
+	// k0sBinaryPrefix prefixes the name of the prestaged k0s binaries.
+	k0sBinaryPrefix = "k0s-prestaged-"
+)
+
+// K0sBinaryName returns the name, in the bin directory, of the prestaged k0s binary with
+// the provided checksum.
+func K0sBinaryName(sha string) string {
+	if len(sha) > 12 {
+		sha = sha[:12]
+	}
+	return k0sBinaryPrefix + sha
+}
+
+// Options configures the download of the artifacts on a node.
+type Options struct {
+	// Version is the embedded cluster version whose artifacts are downloaded.
+	Version string
+	// DataDir is where the host embedded cluster directory is mounted.
+	DataDir string
+	// ContainerdAddress is the containerd socket the images are pulled into.
+	ContainerdAddress string
+	// HostsDir is the containerd registry hosts directory, the images are pulled through
+	// the registry mirrors it configures. Optional.
+	HostsDir string
+	// Logf logs the progress.
+	Logf func(format string, args ...interface{})
+}
+
+// Run downloads the k0s binary and pulls the images of the version on the node.
+func Run(ctx context.Context, cli client.Client, opts Options) error {
+	in, err := kubeutils.GetLatestInstallation(ctx, cli)
+	if err != nil {
+		return fmt.Errorf("unable to get latest installation: %w", err)
+	}
+	meta, err := release.RemoteMetadataFor(ctx, in, opts.Version)
+	if err != nil {
+		return fmt.Errorf("unable to get release metadata: %w", err)
+	}
+	if meta.K0sSHA == "" {
+		return fmt.Errorf("release metadata holds no k0s checksum")
+	}
+
+	bindir := filepath.Join(opts.DataDir, "bin")
+	url := release.K0sBinaryURL(in, meta)
+	opts.Logf("Downloading k0s from %s", url)
+	if err := stageK0s(ctx, url, meta.K0sSHA, bindir); err != nil {
+		return fmt.Errorf("unable to stage k0s: %w", err)
+	}
+
+	k0s := filepath.Join(bindir, "k0s")
+	for _, image := range meta.Images {
+		opts.Logf("Pulling %s", image)
+		args := []string{"ctr", "--address", opts.ContainerdAddress, "--namespace", "k8s.io", "images", "pull"}
+		if opts.HostsDir != "" {
+			args = append(args, "--hosts-dir", opts.HostsDir)
+		}
+		args = append(args, image)
+		if out, err := exec.CommandContext(ctx, k0s, args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("unable to pull %s: %w: %s", image, err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+// stageK0s downloads the k0s binary into the bin directory unless it is already there,
+// verifying its checksum, and removes the binaries prestaged for other versions.
+func stageK0s(ctx context.Context, url, sha, bindir string) error {
+	dst := filepath.Join(bindir, K0sBinaryName(sha))
+	if current, err := helpers.FileSHA256(dst); err != nil || current != sha {
+		if err := download(ctx, url, sha, dst); err != nil {
+			return err
+		}
+	}
+
+	previous, err := filepath.Glob(filepath.Join(bindir, k0sBinaryPrefix+"*"))
+	if err != nil {
+		return fmt.Errorf("unable to list prestaged binaries: %w", err)
+	}
+	for _, path := range previous {
+		if path == dst {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("unable to remove %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// download writes the file at the url to the destination if its checksum matches. The
+// file is written to a temporary file renamed over the destination once verified.
+func download(ctx context.Context, url, sha, dst string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("unable to create request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to download %s: %s", url, resp.Status)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+"-")
+	if err != nil {
+		return fmt.Errorf("unable to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hasher), resp.Body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to download %s: %w", url, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to write %s: %w", dst, err)
+	}
+	if actual := hex.EncodeToString(hasher.Sum(nil)); actual != sha {
+		return fmt.Errorf("downloaded checksum %s does not match %s", actual, sha)
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return fmt.Errorf("unable to set %s permissions: %w", dst, err)
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return fmt.Errorf("unable to move %s into place: %w", dst, err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package prestage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStageK0s(t *testing.T) {
+	const sha = "2b7bb4d64d416013eb5b4015dabe1d7cad590fd3ce7ce411f3a4489ae32f49b2" // sha256("k0s")
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		w.Write([]byte("k0s"))
+	}))
+	defer server.Close()
+
+	bindir := t.TempDir()
+	previous := filepath.Join(bindir, K0sBinaryName("0123456789abcdef"))
+	require.NoError(t, os.WriteFile(previous, []byte("old k0s"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(bindir, "k0s"), []byte("installed k0s"), 0755))
+
+	require.NoError(t, stageK0s(context.Background(), server.URL, sha, bindir))
+	dst := filepath.Join(bindir, "k0s-prestaged-2b7bb4d64d41")
+	data, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, "k0s", string(data))
+	info, err := os.Stat(dst)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	assert.NoFileExists(t, previous)
+	assert.FileExists(t, filepath.Join(bindir, "k0s"))
+
+	// the binary is not downloaded again.
+	require.NoError(t, stageK0s(context.Background(), server.URL, sha, bindir))
+	assert.Equal(t, 1, downloads)
+
+	// a binary not matching the checksum is never stored.
+	err = stageK0s(context.Background(), server.URL, "0123456789abcdef", bindir)
+	assert.ErrorContains(t, err, "does not match")
+	assert.NoFileExists(t, previous)
+	entries, err := os.ReadDir(bindir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "temporary files were left behind")
+}
@@ -0,0 +1,46 @@
+package prestage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindow(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 10, 10, hour, minute, 0, 0, time.UTC)
+	}
+
+	for _, tt := range []struct {
+		window string
+		open   []time.Time
+		closed []time.Time
+	}{
+		{window: "", open: []time.Time{at(0, 0), at(12, 0), at(23, 59)}},
+		{window: "02:00-04:30", open: []time.Time{at(2, 0), at(4, 29)}, closed: []time.Time{at(1, 59), at(4, 30), at(12, 0)}},
+		{window: "22:00-06:00", open: []time.Time{at(22, 0), at(23, 59), at(0, 0), at(5, 59)}, closed: []time.Time{at(6, 0), at(21, 59)}},
+	} {
+		t.Run(tt.window, func(t *testing.T) {
+			w, err := ParseWindow(tt.window)
+			require.NoError(t, err)
+			for _, now := range tt.open {
+				assert.True(t, w.Contains(now), "%s", now)
+			}
+			for _, now := range tt.closed {
+				assert.False(t, w.Contains(now), "%s", now)
+			}
+		})
+	}
+
+	// windows are in utc.
+	w, err := ParseWindow("02:00-04:00")
+	require.NoError(t, err)
+	assert.True(t, w.Contains(time.Date(2024, 10, 10, 5, 0, 0, 0, time.FixedZone("CET", 2*60*60))))
+
+	for _, invalid := range []string{"22:00", "25:00-06:00", "22:00-6pm"} {
+		_, err := ParseWindow(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
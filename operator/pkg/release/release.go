@@ -64,7 +64,13 @@ func MetadataFor(ctx context.Context, in *v1beta1.Installation, cli client.Clien
 	if in.Spec.AirGap {
 		return localMetadataFor(ctx, cli, in.Spec.Config.Version)
 	}
-	return remoteMetadataFor(ctx, in)
+	return remoteMetadataFor(ctx, in, in.Spec.Config.Version)
+}
+
+// RemoteMetadataFor reads from replicated.app the metadata of another version of the
+// embedded cluster, for example the next release of an online installation.
+func RemoteMetadataFor(ctx context.Context, in *v1beta1.Installation, version string) (*ectypes.ReleaseMetadata, error) {
+	return remoteMetadataFor(ctx, in, version)
 }
 
 // localMetadataFor reads metadata for a given release. Attempts to read a local config map.
@@ -126,19 +132,22 @@ func localMetadataFor(ctx context.Context, cli client.Client, version string) (*
 }
 
 // remoteMetadataFor reads metadata for a given release. Goes to replicated.app and reads release metadata file
-func remoteMetadataFor(ctx context.Context, in *v1beta1.Installation) (*ectypes.ReleaseMetadata, error) {
+func remoteMetadataFor(ctx context.Context, in *v1beta1.Installation, version string) (*ectypes.ReleaseMetadata, error) {
 	mutex.Lock()
 	defer mutex.Unlock()
 
+	// the override url only points to the metadata of the installed version.
+	override := in.Spec.Config.MetadataOverrideURL != "" && version == in.Spec.Config.Version
+
 	// trim the leading 'v' from the version as this allows both v1.0.0 and 1.0.0 to work
-	version := strings.TrimPrefix(in.Spec.Config.Version, "v")
+	version = strings.TrimPrefix(version, "v")
 
 	if _, ok := cache[version]; ok {
 		return metaFromCache(version)
 	}
 
 	var metadataURL string
-	if in.Spec.Config.MetadataOverrideURL != "" {
+	if override {
 		metadataURL = in.Spec.Config.MetadataOverrideURL
 	} else {
 		metadataURL = fmt.Sprintf(
@@ -172,6 +181,36 @@ func remoteMetadataFor(ctx context.Context, in *v1beta1.Installation) (*ectypes.
 	return metaFromCache(version)
 }
 
+// K0sBinaryURL returns the url online installations download the k0s binary of a release
+// from.
+func K0sBinaryURL(in *v1beta1.Installation, meta *ectypes.ReleaseMetadata) string {
+	artifact := meta.Artifacts["k0s"]
+	if strings.HasPrefix(artifact, "https://") || strings.HasPrefix(artifact, "http://") {
+		// for dev and e2e tests we allow the url to be overridden
+		return artifact
+	}
+	return fmt.Sprintf("%s/embedded-cluster-public-files/%s", in.Spec.MetricsBaseURL, artifact)
+}
+
+// K0sBinaryURLForArch returns the url of the k0s binary for nodes of the architecture and its
+// sha256, empty when it is not known. The release metadata describes the binary of the
+// architecture it was generated on, the binaries of the other architectures are published
+// alongside it with the architecture as suffix.
+func K0sBinaryURLForArch(in *v1beta1.Installation, meta *ectypes.ReleaseMetadata, arch string) (string, string) {
+	url := K0sBinaryURL(in, meta)
+	idx := strings.LastIndex(url, "-")
+	if idx < 0 {
+		return url, meta.K0sSHA
+	}
+	switch metaArch := url[idx+1:]; metaArch {
+	case arch:
+		return url, meta.K0sSHA
+	case "amd64", "arm64":
+		return url[:idx+1] + arch, ""
+	}
+	return url, meta.K0sSHA
+}
+
 // CacheMeta caches a given meta for a given version. It is intended for unit testing.
 func CacheMeta(version string, meta ectypes.ReleaseMetadata) {
 	mutex.Lock()
@@ -9,6 +9,7 @@ import (
 
 	"github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
 	ectypes "github.com/replicatedhq/embedded-cluster/kinds/types"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -151,3 +152,25 @@ func Test_localMetadataFor(t *testing.T) {
 		})
 	}
 }
+
+func TestK0sBinaryURLForArch(t *testing.T) {
+	in := &v1beta1.Installation{Spec: v1beta1.InstallationSpec{MetricsBaseURL: "https://replicated.app"}}
+	meta := &ectypes.ReleaseMetadata{
+		Artifacts: map[string]string{"k0s": "k0s-binaries/v1.30.5+k0s.0-amd64"},
+		K0sSHA:    "abc",
+	}
+
+	url, sha := K0sBinaryURLForArch(in, meta, "amd64")
+	assert.Equal(t, "https://replicated.app/embedded-cluster-public-files/k0s-binaries/v1.30.5+k0s.0-amd64", url)
+	assert.Equal(t, "abc", sha)
+
+	url, sha = K0sBinaryURLForArch(in, meta, "arm64")
+	assert.Equal(t, "https://replicated.app/embedded-cluster-public-files/k0s-binaries/v1.30.5+k0s.0-arm64", url)
+	assert.Empty(t, sha)
+
+	// overridden urls are used as they are.
+	meta.Artifacts["k0s"] = "https://example.com/k0s"
+	url, sha = K0sBinaryURLForArch(in, meta, "arm64")
+	assert.Equal(t, "https://example.com/k0s", url)
+	assert.Equal(t, "abc", sha)
+}
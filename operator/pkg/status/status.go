@@ -0,0 +1,159 @@
+// Package status exposes the operator view of the installation lifecycle through a small
+// REST API. External orchestrators and the embedded-cluster status command use it instead
+// of inferring the state from the Installation custom resource fields.
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// Path is the path the status is served on.
+const Path = "/status"
+
+// Status is the lifecycle state reported by the operator.
+type Status struct {
+	// Ready indicates the operator has finished its last reconcile of an installation
+	// without errors and the installation has not failed.
+	Ready bool `json:"ready"`
+	// Installation is the name of the installation being reconciled.
+	Installation string `json:"installation,omitempty"`
+	// State is the state of the installation.
+	State string `json:"state,omitempty"`
+	// Reason holds the reason for the installation state.
+	Reason string `json:"reason,omitempty"`
+	// Version is the embedded cluster version the installation targets.
+	Version string `json:"version,omitempty"`
+	// Conditions are the conditions of the installation.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// LastReconcile is the time the last reconcile finished.
+	LastReconcile *metav1.Time `json:"lastReconcile,omitempty"`
+	// LastError holds the error returned by the last reconcile, if any.
+	LastError string `json:"lastError,omitempty"`
+}
+
+// Tracker keeps the outcome of the last reconcile. All methods are safe to be called
+// on a nil Tracker.
+type Tracker struct {
+	mtx    sync.Mutex
+	status Status
+}
+
+// NewTracker returns a new Tracker.
+func NewTracker() *Tracker {
+	return &Tracker{}
+}
+
+// Record stores the outcome of a reconcile of the provided installation. The
+// installation may be nil if the reconcile failed before reading it.
+func (t *Tracker) Record(in *v1beta1.Installation, err error) {
+	if t == nil {
+		return
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	now := metav1.NewTime(time.Now())
+	t.status.LastReconcile = &now
+	t.status.LastError = ""
+	if err != nil {
+		t.status.LastError = err.Error()
+	}
+	if in != nil {
+		t.status.Installation = in.Name
+		t.status.State = in.Status.State
+		t.status.Reason = in.Status.Reason
+		t.status.Conditions = append([]metav1.Condition{}, in.Status.Conditions...)
+		t.status.Version = ""
+		if in.Spec.Config != nil {
+			t.status.Version = in.Spec.Config.Version
+		}
+	}
+	t.status.Ready = err == nil && t.status.Installation != "" && t.status.State != v1beta1.InstallationStateFailed
+}
+
+// Status returns the outcome of the last reconcile.
+func (t *Tracker) Status() Status {
+	if t == nil {
+		return Status{}
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	status := t.status
+	status.Conditions = append([]metav1.Condition{}, t.status.Conditions...)
+	return status
+}
+
+// Handler returns an http handler serving the status as json.
+func Handler(tracker *Tracker) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(Path, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(tracker.Status()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+	return mux
+}
+
+// Server serves the status API. It implements the controller-runtime Runnable
+// interface so it can be added to the manager.
+type Server struct {
+	addr    string
+	tracker *Tracker
+}
+
+// NewServer returns a server serving the status kept by the tracker on addr.
+func NewServer(addr string, tracker *Tracker) *Server {
+	return &Server{addr: addr, tracker: tracker}
+}
+
+// NeedLeaderElection returns false so the status is served by all replicas.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+// Start serves the status API until the context is cancelled.
+func (s *Server) Start(ctx context.Context) error {
+	log := ctrl.LoggerFrom(ctx)
+	srv := &http.Server{
+		Addr:              s.addr,
+		Handler:           Handler(s.tracker),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		log.Info("Starting status server", "address", s.addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- fmt.Errorf("unable to serve status: %w", err)
+		}
+		close(errCh)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("unable to shutdown status server: %w", err)
+	}
+	return nil
+}
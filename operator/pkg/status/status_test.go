@@ -0,0 +1,77 @@
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTracker(t *testing.T) {
+	var nilTracker *Tracker
+	nilTracker.Record(nil, nil)
+	assert.Equal(t, Status{}, nilTracker.Status())
+
+	tracker := NewTracker()
+	tracker.Record(nil, nil)
+	assert.False(t, tracker.Status().Ready, "not ready until an installation is reconciled")
+
+	in := &v1beta1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Name: "20240101000000"},
+		Spec:       v1beta1.InstallationSpec{Config: &v1beta1.ConfigSpec{Version: "1.0.0"}},
+		Status: v1beta1.InstallationStatus{
+			State:      v1beta1.InstallationStateInstalled,
+			Reason:     "Installed",
+			Conditions: []metav1.Condition{{Type: "CertificateExpiry", Status: metav1.ConditionFalse}},
+		},
+	}
+	tracker.Record(in, nil)
+	st := tracker.Status()
+	assert.True(t, st.Ready)
+	assert.Equal(t, "20240101000000", st.Installation)
+	assert.Equal(t, v1beta1.InstallationStateInstalled, st.State)
+	assert.Equal(t, "1.0.0", st.Version)
+	assert.Len(t, st.Conditions, 1)
+	assert.NotNil(t, st.LastReconcile)
+
+	// a failed reconcile keeps the last known installation state.
+	tracker.Record(nil, fmt.Errorf("boom"))
+	st = tracker.Status()
+	assert.False(t, st.Ready)
+	assert.Equal(t, "boom", st.LastError)
+	assert.Equal(t, "20240101000000", st.Installation)
+
+	in.Status.State = v1beta1.InstallationStateFailed
+	tracker.Record(in, nil)
+	assert.False(t, tracker.Status().Ready)
+}
+
+func TestHandler(t *testing.T) {
+	tracker := NewTracker()
+	tracker.Record(&v1beta1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Name: "install"},
+		Status:     v1beta1.InstallationStatus{State: v1beta1.InstallationStateInstalled},
+	}, nil)
+	server := httptest.NewServer(Handler(tracker))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + Path)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var st Status
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&st))
+	assert.True(t, st.Ready)
+	assert.Equal(t, "install", st.Installation)
+
+	resp, err = http.Post(server.URL+Path, "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
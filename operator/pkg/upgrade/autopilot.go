@@ -4,29 +4,40 @@ import (
 	"context"
 	"fmt"
 	"runtime"
-	"strings"
 
 	"github.com/google/uuid"
 	apv1b2 "github.com/k0sproject/k0s/pkg/apis/autopilot/v1beta2"
 	"github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
 	ectypes "github.com/replicatedhq/embedded-cluster/kinds/types"
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/artifacts"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/prestage"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/release"
 	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/drainhooks"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// NodePlanAnnotation is set on autopilot plans upgrading a single node. It holds
+// the name of the node being upgraded.
+const NodePlanAnnotation = "embedded-cluster.replicated.com/node"
+
 // DetermineUpgradeTargets makes sure that we are listing all the nodes in the autopilot plan.
 func DetermineUpgradeTargets(ctx context.Context, cli client.Client) (apv1b2.PlanCommandTargets, error) {
 	var nodes corev1.NodeList
 	if err := cli.List(ctx, &nodes); err != nil {
 		return apv1b2.PlanCommandTargets{}, fmt.Errorf("failed to list nodes: %w", err)
 	}
+	return upgradeTargets(nodes.Items), nil
+}
+
+// upgradeTargets returns the autopilot plan targets for the provided nodes.
+func upgradeTargets(nodes []corev1.Node) apv1b2.PlanCommandTargets {
 	controllers := []string{}
 	workers := []string{}
-	for _, node := range nodes.Items {
-		if _, ok := node.Labels["node-role.kubernetes.io/control-plane"]; ok {
+	for _, node := range nodes {
+		if isController(node) {
 			controllers = append(controllers, node.Name)
 			continue
 		}
@@ -43,7 +54,32 @@ func DetermineUpgradeTargets(ctx context.Context, cli client.Client) (apv1b2.Pla
 				Static: &apv1b2.PlanCommandTargetDiscoveryStatic{Nodes: workers},
 			},
 		},
-	}, nil
+	}
+}
+
+func isController(node corev1.Node) bool {
+	_, ok := node.Labels["node-role.kubernetes.io/control-plane"]
+	return ok
+}
+
+// NextNodeToUpgrade returns the first node not yet running the provided kubernetes
+// version. Controllers are returned before workers. Returns nil if all nodes have
+// been upgraded.
+func NextNodeToUpgrade(ctx context.Context, cli client.Client, version string) (*corev1.Node, error) {
+	var nodes corev1.NodeList
+	if err := cli.List(ctx, &nodes); err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	var next *corev1.Node
+	for i, node := range nodes.Items {
+		if node.Status.NodeInfo.KubeletVersion == version {
+			continue
+		}
+		if next == nil || (isController(node) && !isController(*next)) {
+			next = &nodes.Items[i]
+		}
+	}
+	return next, nil
 }
 
 // StartAutopilotUpgrade creates an autopilot plan to upgrade to version specified in spec.config.version.
@@ -52,37 +88,67 @@ func StartAutopilotUpgrade(ctx context.Context, cli client.Client, in *v1beta1.I
 	if err != nil {
 		return fmt.Errorf("failed to determine upgrade targets: %w", err)
 	}
+	return startAutopilotUpgrade(ctx, cli, in, meta, targets, nil)
+}
+
+// StartNodeAutopilotUpgrade creates an autopilot plan to upgrade a single node to the
+// version specified in spec.config.version. The pre-drain hooks for the node are run
+// before the plan is created, as autopilot drains the node while upgrading it.
+func StartNodeAutopilotUpgrade(ctx context.Context, cli client.Client, in *v1beta1.Installation, meta *ectypes.ReleaseMetadata, node corev1.Node) error {
+	fmt.Printf("Running %s hooks for node %s\n", drainhooks.PreDrain, node.Name)
+	if err := drainhooks.Run(ctx, cli, in.Spec.Config, drainhooks.PreDrain, node.Name); err != nil {
+		return fmt.Errorf("node %s: %w", node.Name, err)
+	}
+	targets := upgradeTargets([]corev1.Node{node})
+	annotations := map[string]string{NodePlanAnnotation: node.Name}
+	return startAutopilotUpgrade(ctx, cli, in, meta, targets, annotations)
+}
+
+func startAutopilotUpgrade(ctx context.Context, cli client.Client, in *v1beta1.Installation, meta *ectypes.ReleaseMetadata, targets apv1b2.PlanCommandTargets, annotations map[string]string) error {
+	port := defaults.LocalArtifactMirrorPort
+	if in.Spec.LocalArtifactMirror != nil && in.Spec.LocalArtifactMirror.Port > 0 {
+		port = in.Spec.LocalArtifactMirror.Port
+	}
+
+	var nodes corev1.NodeList
+	if err := cli.List(ctx, &nodes); err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
 
-	var k0surl string
-	if in.Spec.AirGap {
-		// if we are running in an airgap environment all assets are already present in the
-		// node and are served by the local-artifact-mirror binary listening on localhost
-		// port 50000. we just need to get autopilot to fetch the k0s binary from there.
-		port := defaults.LocalArtifactMirrorPort
-		if in.Spec.LocalArtifactMirror != nil && in.Spec.LocalArtifactMirror.Port > 0 {
-			port = in.Spec.LocalArtifactMirror.Port
+	// the k0s binary of each architecture in the cluster is needed.
+	platforms := apv1b2.PlanPlatformResourceURLMap{}
+	for _, arch := range artifacts.NodeArchitectures(nodes.Items) {
+		k0surl, sha := release.K0sBinaryURLForArch(in, meta, arch)
+		if in.Spec.AirGap {
+			// if we are running in an airgap environment all assets are already present in the
+			// node and are served by the local-artifact-mirror binary listening on localhost
+			// port 50000. we just need to get autopilot to fetch the k0s binary from there.
+			platforms[fmt.Sprintf("%s-%s", runtime.GOOS, arch)] = apv1b2.PlanResourceURL{
+				URL:    fmt.Sprintf("http://127.0.0.1:%d/bin/k0s-upgrade", port),
+				Sha256: sha,
+			}
+			continue
 		}
-		k0surl = fmt.Sprintf("http://127.0.0.1:%d/bin/k0s-upgrade", port)
-	} else {
-		artifact := meta.Artifacts["k0s"]
-		if strings.HasPrefix(artifact, "https://") || strings.HasPrefix(artifact, "http://") {
-			// for dev and e2e tests we allow the url to be overridden
-			k0surl = artifact
-		} else {
-			k0surl = fmt.Sprintf(
-				"%s/embedded-cluster-public-files/%s",
-				in.Spec.MetricsBaseURL,
-				artifact,
-			)
+		// the k0s binary may have been downloaded to the nodes ahead of the upgrade, the
+		// local artifact mirror serves it from there.
+		staged, err := prestage.Staged(ctx, cli, in.Spec.Config.Version)
+		if err != nil {
+			return fmt.Errorf("failed to check prestaged artifacts: %w", err)
 		}
+		if staged && sha != "" {
+			k0surl = fmt.Sprintf("http://127.0.0.1:%d/bin/%s", port, prestage.K0sBinaryName(sha))
+		}
+		platforms[fmt.Sprintf("%s-%s", runtime.GOOS, arch)] = apv1b2.PlanResourceURL{URL: k0surl, Sha256: sha}
 	}
 
+	planAnnotations := map[string]string{artifacts.InstallationNameAnnotation: in.Name}
+	for k, v := range annotations {
+		planAnnotations[k] = v
+	}
 	plan := apv1b2.Plan{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: "autopilot", // this is a fixed name and should not be changed
-			Annotations: map[string]string{
-				artifacts.InstallationNameAnnotation: in.Name,
-			},
+			Name:        "autopilot", // this is a fixed name and should not be changed
+			Annotations: planAnnotations,
 		},
 		Spec: apv1b2.PlanSpec{
 			Timestamp: "now",
@@ -90,11 +156,9 @@ func StartAutopilotUpgrade(ctx context.Context, cli client.Client, in *v1beta1.I
 			Commands: []apv1b2.PlanCommand{
 				{
 					K0sUpdate: &apv1b2.PlanCommandK0sUpdate{
-						Version: meta.Versions["Kubernetes"],
-						Targets: targets,
-						Platforms: apv1b2.PlanPlatformResourceURLMap{
-							fmt.Sprintf("%s-%s", runtime.GOOS, runtime.GOARCH): {URL: k0surl, Sha256: meta.K0sSHA},
-						},
+						Version:   meta.Versions["Kubernetes"],
+						Targets:   targets,
+						Platforms: platforms,
 					},
 				},
 			},
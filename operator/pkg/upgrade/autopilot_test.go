@@ -0,0 +1,45 @@
+package upgrade
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestNextNodeToUpgrade(t *testing.T) {
+	node := func(name, version string, controller bool) *corev1.Node {
+		n := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{}}}
+		if controller {
+			n.Labels["node-role.kubernetes.io/control-plane"] = "true"
+		}
+		n.Status.NodeInfo.KubeletVersion = version
+		return n
+	}
+
+	cli := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		node("worker-0", "v1.29.0", false),
+		node("controller-0", "v1.30.0", true),
+		node("controller-1", "v1.29.0", true),
+	).Build()
+
+	next, err := NextNodeToUpgrade(context.Background(), cli, "v1.30.0")
+	require.NoError(t, err)
+	require.NotNil(t, next)
+	require.Equal(t, "controller-1", next.Name)
+
+	next, err = NextNodeToUpgrade(context.Background(), cli, "v1.29.0")
+	require.NoError(t, err)
+	require.Equal(t, "controller-0", next.Name)
+
+	cli = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		node("controller-0", "v1.30.0", true),
+	).Build()
+	next, err = NextNodeToUpgrade(context.Background(), cli, "v1.30.0")
+	require.NoError(t, err)
+	require.Nil(t, next)
+}
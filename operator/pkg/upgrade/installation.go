@@ -25,6 +25,8 @@ func CreateInstallation(ctx context.Context, cli client.Client, original *cluste
 	}
 	log.Info(fmt.Sprintf("Creating installation %s", in.Name))
 
+	preserveEndUserSettings(ctx, cli, in)
+
 	err := cli.Create(ctx, in)
 	if err != nil {
 		return fmt.Errorf("create installation: %w", err)
@@ -40,6 +42,39 @@ func CreateInstallation(ctx context.Context, cli client.Client, original *cluste
 	return nil
 }
 
+// preserveEndUserSettings copies the settings provided by the end user at install time
+// from the previous installation when they are missing from the new one, this happens when
+// the new installation is built by a tool that does not know about them yet.
+func preserveEndUserSettings(ctx context.Context, cli client.Client, in *clusterv1beta1.Installation) {
+	log := controllerruntime.LoggerFrom(ctx)
+	previous, err := GetPreviousInstallation(ctx, cli, in)
+	if err != nil {
+		log.Info(fmt.Sprintf("Unable to get previous installation, end user settings are not preserved: %v", err))
+		return
+	}
+	if len(in.Spec.RegistryMirrors) == 0 && len(previous.Spec.RegistryMirrors) > 0 {
+		log.Info("Preserving registry mirrors from the previous installation")
+		in.Spec.RegistryMirrors = previous.DeepCopy().Spec.RegistryMirrors
+	}
+	if len(in.Spec.ImagePullSecrets) == 0 && len(previous.Spec.ImagePullSecrets) > 0 {
+		log.Info("Preserving image pull secrets from the previous installation")
+		in.Spec.ImagePullSecrets = previous.DeepCopy().Spec.ImagePullSecrets
+	}
+	// the prestaged version is the one being installed, only the window carries over.
+	if in.Spec.Prestage == nil && previous.Spec.Prestage != nil && previous.Spec.Prestage.Window != "" {
+		log.Info("Preserving the prestage window from the previous installation")
+		in.Spec.Prestage = &clusterv1beta1.PrestageSpec{Window: previous.Spec.Prestage.Window}
+	}
+	if len(in.Spec.OverriddenPreflightWarnings) == 0 && len(previous.Spec.OverriddenPreflightWarnings) > 0 {
+		log.Info("Preserving the overridden preflight warnings from the previous installation")
+		in.Spec.OverriddenPreflightWarnings = previous.DeepCopy().Spec.OverriddenPreflightWarnings
+	}
+	if in.Spec.Architecture == "" && previous.Spec.Architecture != "" {
+		log.Info("Preserving the architecture from the previous installation")
+		in.Spec.Architecture = previous.Spec.Architecture
+	}
+}
+
 // setInstallationState gets the installation object of the given name and sets the state to the given state.
 func setInstallationState(ctx context.Context, cli client.Client, name string, state string, reason string, pendingCharts ...string) error {
 	existingInstallation := &clusterv1beta1.Installation{}
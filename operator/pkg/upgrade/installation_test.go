@@ -0,0 +1,198 @@
+package upgrade
+
+import (
+	"context"
+	"testing"
+
+	clusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCreateInstallationPreservesRegistryMirrors(t *testing.T) {
+	scheme := scheme.Scheme
+	clusterv1beta1.AddToScheme(scheme)
+
+	mirrors := []clusterv1beta1.RegistryMirror{
+		{
+			Registry:  "docker.io",
+			Endpoints: []clusterv1beta1.RegistryMirrorEndpoint{{URL: "https://harbor.example.com"}},
+		},
+	}
+	previous := &clusterv1beta1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Name: "20241002205018"},
+		Spec:       clusterv1beta1.InstallationSpec{RegistryMirrors: mirrors},
+	}
+
+	tests := []struct {
+		name string
+		in   *clusterv1beta1.Installation
+		want []clusterv1beta1.RegistryMirror
+	}{
+		{
+			name: "mirrors missing from the new installation",
+			in: &clusterv1beta1.Installation{
+				ObjectMeta: metav1.ObjectMeta{Name: "20241003205018"},
+			},
+			want: mirrors,
+		},
+		{
+			name: "mirrors set in the new installation",
+			in: &clusterv1beta1.Installation{
+				ObjectMeta: metav1.ObjectMeta{Name: "20241003205018"},
+				Spec: clusterv1beta1.InstallationSpec{
+					RegistryMirrors: []clusterv1beta1.RegistryMirror{
+						{
+							Registry:  "quay.io",
+							Endpoints: []clusterv1beta1.RegistryMirrorEndpoint{{URL: "https://artifactory.example.com/quay"}},
+						},
+					},
+				},
+			},
+			want: []clusterv1beta1.RegistryMirror{
+				{
+					Registry:  "quay.io",
+					Endpoints: []clusterv1beta1.RegistryMirrorEndpoint{{URL: "https://artifactory.example.com/quay"}},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := require.New(t)
+			cli := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithStatusSubresource(&clusterv1beta1.Installation{}).
+				WithObjects(previous.DeepCopy()).
+				Build()
+
+			req.NoError(CreateInstallation(context.Background(), cli, tt.in))
+
+			var got clusterv1beta1.Installation
+			req.NoError(cli.Get(context.Background(), client.ObjectKey{Name: tt.in.Name}, &got))
+			req.Equal(tt.want, got.Spec.RegistryMirrors)
+		})
+	}
+}
+
+func TestCreateInstallationPreservesPrestageWindow(t *testing.T) {
+	scheme := scheme.Scheme
+	clusterv1beta1.AddToScheme(scheme)
+
+	previous := &clusterv1beta1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Name: "20241002205018"},
+		Spec: clusterv1beta1.InstallationSpec{
+			Prestage: &clusterv1beta1.PrestageSpec{Version: "1.1.0", Window: "22:00-06:00"},
+		},
+	}
+	in := &clusterv1beta1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Name: "20241003205018"},
+		Spec: clusterv1beta1.InstallationSpec{
+			Config: &clusterv1beta1.ConfigSpec{Version: "1.1.0"},
+		},
+	}
+	cli := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithStatusSubresource(&clusterv1beta1.Installation{}).
+		WithObjects(previous).
+		Build()
+
+	req := require.New(t)
+	req.NoError(CreateInstallation(context.Background(), cli, in))
+
+	var got clusterv1beta1.Installation
+	req.NoError(cli.Get(context.Background(), client.ObjectKey{Name: in.Name}, &got))
+	req.Equal(&clusterv1beta1.PrestageSpec{Window: "22:00-06:00"}, got.Spec.Prestage)
+}
+
+func TestCreateInstallationPreservesOverriddenPreflightWarnings(t *testing.T) {
+	scheme := scheme.Scheme
+	clusterv1beta1.AddToScheme(scheme)
+
+	previous := &clusterv1beta1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Name: "20241002205018"},
+		Spec: clusterv1beta1.InstallationSpec{
+			OverriddenPreflightWarnings: []string{"Time Synchronization"},
+		},
+	}
+	in := &clusterv1beta1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Name: "20241003205018"},
+		Spec: clusterv1beta1.InstallationSpec{
+			Config: &clusterv1beta1.ConfigSpec{Version: "1.1.0"},
+		},
+	}
+	cli := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithStatusSubresource(&clusterv1beta1.Installation{}).
+		WithObjects(previous).
+		Build()
+
+	req := require.New(t)
+	req.NoError(CreateInstallation(context.Background(), cli, in))
+
+	var got clusterv1beta1.Installation
+	req.NoError(cli.Get(context.Background(), client.ObjectKey{Name: in.Name}, &got))
+	req.Equal([]string{"Time Synchronization"}, got.Spec.OverriddenPreflightWarnings)
+}
+
+func TestCreateInstallationPreservesArchitecture(t *testing.T) {
+	scheme := scheme.Scheme
+	clusterv1beta1.AddToScheme(scheme)
+
+	previous := &clusterv1beta1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Name: "20241002205018"},
+		Spec:       clusterv1beta1.InstallationSpec{Architecture: "arm64"},
+	}
+	in := &clusterv1beta1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Name: "20241003205018"},
+		Spec: clusterv1beta1.InstallationSpec{
+			Config: &clusterv1beta1.ConfigSpec{Version: "1.1.0"},
+		},
+	}
+	cli := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithStatusSubresource(&clusterv1beta1.Installation{}).
+		WithObjects(previous).
+		Build()
+
+	req := require.New(t)
+	req.NoError(CreateInstallation(context.Background(), cli, in))
+
+	var got clusterv1beta1.Installation
+	req.NoError(cli.Get(context.Background(), client.ObjectKey{Name: in.Name}, &got))
+	req.Equal("arm64", got.Spec.Architecture)
+}
+
+func TestCreateInstallationPreservesImagePullSecrets(t *testing.T) {
+	scheme := scheme.Scheme
+	clusterv1beta1.AddToScheme(scheme)
+
+	secrets := []clusterv1beta1.ImagePullSecret{
+		{Name: "corp-registry", Namespaces: []string{"my-app"}, ServiceAccounts: []string{"default"}},
+	}
+	previous := &clusterv1beta1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Name: "20241002205018"},
+		Spec:       clusterv1beta1.InstallationSpec{ImagePullSecrets: secrets},
+	}
+	in := &clusterv1beta1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Name: "20241003205018"},
+		Spec: clusterv1beta1.InstallationSpec{
+			Config: &clusterv1beta1.ConfigSpec{Version: "1.1.0"},
+		},
+	}
+	cli := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithStatusSubresource(&clusterv1beta1.Installation{}).
+		WithObjects(previous).
+		Build()
+
+	req := require.New(t)
+	req.NoError(CreateInstallation(context.Background(), cli, in))
+
+	var got clusterv1beta1.Installation
+	req.NoError(cli.Get(context.Background(), client.ObjectKey{Name: in.Name}, &got))
+	req.Equal(secrets, got.Spec.ImagePullSecrets)
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/k8sutil"
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/metadata"
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/release"
+	ecerrors "github.com/replicatedhq/embedded-cluster/pkg/errors"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
@@ -53,7 +54,15 @@ func CreateUpgradeJob(ctx context.Context, cli client.Client, in *clusterv1beta1
 		if err != nil {
 			return fmt.Errorf("copy version metadata to cluster: %w", err)
 		}
+	}
+
+	// releases skipping kubernetes minor versions can not be upgraded to, fail before
+	// spending time distributing the artifacts.
+	if err := CheckPath(ctx, cli, in); err != nil {
+		return ecerrors.Errorf(ecerrors.Preflight, "check upgrade path: %w", err)
+	}
 
+	if in.Spec.AirGap {
 		err = airgapDistributeArtifacts(ctx, cli, in, localArtifactMirrorImage)
 		if err != nil {
 			return fmt.Errorf("airgap distribute artifacts: %w", err)
@@ -0,0 +1,57 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	clusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/clusterlock"
+)
+
+// LockIdentity is who holds the cluster lock while the operator upgrades the cluster. The
+// upgrade command takes the lock for the upgrade job, which holds it until the upgrade
+// finished.
+const LockIdentity = "embedded-cluster-operator"
+
+// lockRetryInterval is how often the upgrade job tries to take the lock while another
+// operation holds it.
+const lockRetryInterval = 10 * time.Second
+
+// lockOperation returns the operation recorded in the cluster lock while upgrading to the
+// installation.
+func lockOperation(in *clusterv1beta1.Installation) string {
+	if in.Spec.Config == nil || in.Spec.Config.Version == "" {
+		return fmt.Sprintf("upgrade to installation %s", in.Name)
+	}
+	return fmt.Sprintf("upgrade to %s", in.Spec.Config.Version)
+}
+
+// HoldLock takes the cluster lock for the upgrade to the installation. It is not renewed,
+// the upgrade job takes it over once started. A clusterlock.HeldError is returned if a
+// controller is joining or another operation is running.
+func HoldLock(ctx context.Context, cli client.Client, in *clusterv1beta1.Installation) error {
+	return clusterlock.Hold(ctx, cli, LockIdentity, lockOperation(in))
+}
+
+// AcquireLock acquires the cluster lock for the upgrade to the installation and renews it
+// until released. The lock may have expired and been taken by another operation before the
+// job started, the upgrade then waits for the operation to finish.
+func AcquireLock(ctx context.Context, cli client.Client, in *clusterv1beta1.Installation) (*clusterlock.Lock, error) {
+	for {
+		lock, err := clusterlock.AcquireAs(ctx, cli, LockIdentity, lockOperation(in))
+		var held *clusterlock.HeldError
+		if !errors.As(err, &held) {
+			return lock, err
+		}
+		fmt.Printf("Waiting for the cluster lock: %v\n", err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package upgrade
+
+import (
+	"context"
+	"testing"
+
+	clusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/clusterlock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	cli := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	in := &clusterv1beta1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Name: "20241002205018"},
+		Spec:       clusterv1beta1.InstallationSpec{Config: &clusterv1beta1.ConfigSpec{Version: "1.2.3+k8s-1.30"}},
+	}
+
+	// the upgrade is refused while a controller joins.
+	require.NoError(t, clusterlock.Hold(ctx, cli, "node-2", "join"))
+	var held *clusterlock.HeldError
+	require.ErrorAs(t, HoldLock(ctx, cli, in), &held)
+	assert.Equal(t, "node-2", held.Holder.Identity)
+
+	lock, err := clusterlock.AcquireAs(ctx, cli, "node-2", "join")
+	require.NoError(t, err)
+	require.NoError(t, lock.Release(ctx))
+
+	// the upgrade job takes over the lock taken by the upgrade command.
+	require.NoError(t, HoldLock(ctx, cli, in))
+	lock, err = AcquireLock(ctx, cli, in)
+	require.NoError(t, err)
+	holder, err := clusterlock.Get(ctx, cli)
+	require.NoError(t, err)
+	require.NotNil(t, holder)
+	assert.Equal(t, LockIdentity, holder.Identity)
+	assert.Equal(t, "upgrade to 1.2.3+k8s-1.30", holder.Operation)
+	require.ErrorAs(t, clusterlock.Hold(ctx, cli, "node-3", "join"), &held)
+	require.NoError(t, lock.Release(ctx))
+}
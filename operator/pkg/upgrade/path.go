@@ -0,0 +1,92 @@
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	clusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/k8sutil"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/release"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PathError is returned when the cluster can not be upgraded to the desired kubernetes
+// version in a single step. Path holds the kubernetes minor versions, in order, of the
+// releases the cluster has to be upgraded to, the last one being the desired version.
+type PathError struct {
+	Current string
+	Desired string
+	Path    []string
+}
+
+func (e *PathError) Error() string {
+	if len(e.Path) == 0 {
+		return fmt.Sprintf("kubernetes can not be downgraded from %s to %s", e.Current, e.Desired)
+	}
+	return fmt.Sprintf(
+		"kubernetes can only be upgraded one minor version at a time, to upgrade from %s to %s upgrade to releases running kubernetes %s in this order",
+		e.Current, e.Desired, strings.Join(e.Path, ", then "),
+	)
+}
+
+// Path returns the kubernetes minor versions the cluster goes through to be upgraded from
+// the current to the desired version, one per upgrade. An empty path is returned when the
+// minor version does not change.
+func Path(current, desired *semver.Version) ([]string, error) {
+	if current.Major() != desired.Major() {
+		return nil, fmt.Errorf("kubernetes can not be upgraded across major versions, from %s to %s", current, desired)
+	}
+	if desired.Minor() < current.Minor() {
+		return nil, &PathError{Current: current.Original(), Desired: desired.Original()}
+	}
+	var path []string
+	for minor := current.Minor() + 1; minor <= desired.Minor(); minor++ {
+		path = append(path, fmt.Sprintf("%d.%d", current.Major(), minor))
+	}
+	return path, nil
+}
+
+// CheckPath verifies the cluster can be upgraded to the kubernetes version of the
+// installation in a single step. If releases were skipped the error lists the kubernetes
+// versions of the releases to upgrade to first. The current version is the oldest one
+// among the nodes, nodes may be on different versions if a previous upgrade failed.
+func CheckPath(ctx context.Context, cli client.Client, in *clusterv1beta1.Installation) error {
+	meta, err := release.MetadataFor(ctx, in, cli)
+	if err != nil {
+		return fmt.Errorf("failed to get release metadata: %w", err)
+	}
+	desired, err := semver.NewVersion(k8sutil.K0sVersionFromMetadata(meta))
+	if err != nil {
+		return fmt.Errorf("parse desired kubernetes version: %w", err)
+	}
+
+	var nodes corev1.NodeList
+	if err := cli.List(ctx, &nodes); err != nil {
+		return fmt.Errorf("list nodes: %w", err)
+	}
+	var current *semver.Version
+	for _, node := range nodes.Items {
+		v, err := semver.NewVersion(node.Status.NodeInfo.KubeletVersion)
+		if err != nil {
+			return fmt.Errorf("parse node %s kubelet version: %w", node.Name, err)
+		}
+		if current == nil || v.LessThan(current) {
+			current = v
+		}
+	}
+	if current == nil {
+		return nil
+	}
+
+	path, err := Path(current, desired)
+	if err != nil {
+		return err
+	}
+	if len(path) > 1 {
+		return &PathError{Current: current.Original(), Desired: desired.Original(), Path: path}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package upgrade
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+	clusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/kinds/types"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/release"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		desired string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:    "patch upgrade",
+			current: "v1.29.5+k0s",
+			desired: "v1.29.9+k0s",
+			want:    nil,
+		},
+		{
+			name:    "minor upgrade",
+			current: "v1.29.5+k0s",
+			desired: "v1.30.4+k0s",
+			want:    []string{"1.30"},
+		},
+		{
+			name:    "skipped minor versions",
+			current: "v1.28.11+k0s",
+			desired: "v1.31.1+k0s",
+			want:    []string{"1.29", "1.30", "1.31"},
+		},
+		{
+			name:    "downgrade",
+			current: "v1.30.4+k0s",
+			desired: "v1.29.9+k0s",
+			wantErr: "kubernetes can not be downgraded from v1.30.4+k0s to v1.29.9+k0s",
+		},
+		{
+			name:    "major upgrade",
+			current: "v1.30.4+k0s",
+			desired: "v2.0.0+k0s",
+			wantErr: "kubernetes can not be upgraded across major versions",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Path(semver.MustParse(tt.current), semver.MustParse(tt.desired))
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCheckPath(t *testing.T) {
+	release.CacheMeta("1.14.0+k8s-1.31", types.ReleaseMetadata{
+		Versions: map[string]string{"Kubernetes": "v1.31.1+k0s.0"},
+	})
+	release.CacheMeta("1.13.0+k8s-1.30", types.ReleaseMetadata{
+		Versions: map[string]string{"Kubernetes": "v1.30.4+k0s.0"},
+	})
+	node := func(name, version string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status:     corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{KubeletVersion: version}},
+		}
+	}
+	installation := func(version string) *clusterv1beta1.Installation {
+		return &clusterv1beta1.Installation{
+			ObjectMeta: metav1.ObjectMeta{Name: "20241017000000"},
+			Spec:       clusterv1beta1.InstallationSpec{Config: &clusterv1beta1.ConfigSpec{Version: version}},
+		}
+	}
+
+	// the oldest node determines the current version.
+	cli := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		node("node-1", "v1.30.4+k0s"),
+		node("node-2", "v1.29.9+k0s"),
+	).Build()
+
+	err := CheckPath(context.Background(), cli, installation("1.14.0+k8s-1.31"))
+	var pathErr *PathError
+	require.ErrorAs(t, err, &pathErr)
+	assert.Equal(t, "v1.29.9+k0s", pathErr.Current)
+	assert.Equal(t, []string{"1.30", "1.31"}, pathErr.Path)
+	assert.Contains(t, err.Error(), "upgrade to releases running kubernetes 1.30, then 1.31 in this order")
+
+	require.NoError(t, CheckPath(context.Background(), cli, installation("1.13.0+k8s-1.30")))
+}
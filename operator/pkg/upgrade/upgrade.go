@@ -12,6 +12,10 @@ import (
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/charts"
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/k8sutil"
 	"github.com/replicatedhq/embedded-cluster/operator/pkg/release"
+	"github.com/replicatedhq/embedded-cluster/pkg/certs"
+	"github.com/replicatedhq/embedded-cluster/pkg/drainhooks"
+	ecerrors "github.com/replicatedhq/embedded-cluster/pkg/errors"
+	"github.com/replicatedhq/embedded-cluster/pkg/signatures"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -26,20 +30,27 @@ const (
 // Upgrade upgrades the embedded cluster to the version specified in the installation.
 // First the k0s cluster is upgraded, then addon charts are upgraded, and finally the installation is unlocked.
 func Upgrade(ctx context.Context, cli client.Client, in *clusterv1beta1.Installation) error {
-	err := k0sUpgrade(ctx, cli, in)
+	err := verifyImageSignatures(ctx, cli, in)
 	if err != nil {
-		return fmt.Errorf("k0s upgrade: %w", err)
+		return ecerrors.Errorf(ecerrors.Preflight, "verify image signatures: %w", err)
+	}
+
+	warnExpiringCertificates(ctx, cli)
+
+	err = k0sUpgrade(ctx, cli, in)
+	if err != nil {
+		return ecerrors.Errorf(ecerrors.K0s, "k0s upgrade: %w", err)
 	}
 
 	err = chartUpgrade(ctx, cli, in)
 	if err != nil {
-		return fmt.Errorf("chart upgrade: %w", err)
+		return ecerrors.Errorf(ecerrors.Addon, "chart upgrade: %w", err)
 	}
 
 	// wait for the operator chart to be ready
 	err = waitForOperatorChart(ctx, cli, in.Spec.Config.Version)
 	if err != nil {
-		return fmt.Errorf("wait for operator chart: %w", err)
+		return ecerrors.Errorf(ecerrors.Addon, "wait for operator chart: %w", err)
 	}
 
 	err = reApplyInstallation(ctx, cli, in)
@@ -50,6 +61,49 @@ func Upgrade(ctx context.Context, cli client.Client, in *clusterv1beta1.Installa
 	return nil
 }
 
+// verifyImageSignatures verifies the signatures of all images in the target release
+// metadata. Nothing is verified if the installation config does not request it.
+func verifyImageSignatures(ctx context.Context, cli client.Client, in *clusterv1beta1.Installation) error {
+	if in.Spec.Config == nil || in.Spec.Config.ImageVerification == nil {
+		return nil
+	}
+	if in.Spec.AirGap {
+		// the registries can not be reached, the update command verifies the signatures
+		// shipped in the airgap bundle before uploading it.
+		fmt.Println("Image signatures of air gap releases are verified by the update command")
+		return nil
+	}
+
+	meta, err := release.MetadataFor(ctx, in, cli)
+	if err != nil {
+		return fmt.Errorf("failed to get release metadata: %w", err)
+	}
+
+	fmt.Printf("Verifying signatures for %d images\n", len(meta.Images))
+	verifier := signatures.NewVerifier("cosign", *in.Spec.Config.ImageVerification, false)
+	return verifier.VerifyImages(meta.Images)
+}
+
+// warnExpiringCertificates warns about cluster certificates close to their expiration
+// date. Certificates expiring in the middle of an upgrade leave the cluster in a state
+// that is hard to recover from so we want to make this visible before starting.
+func warnExpiringCertificates(ctx context.Context, cli client.Client) {
+	found, errs := certs.FromCluster(ctx, cli)
+	for _, err := range errs {
+		fmt.Printf("Unable to inspect certificate: %v\n", err)
+	}
+	for _, cert := range certs.Expiring(found, time.Now(), certs.ExpiryWarningThreshold) {
+		fmt.Printf("WARNING: certificate %s is about to expire, rotate the certificates with the \"admin rotate-certs\" command before upgrading\n", cert)
+	}
+}
+
+// hasDrainHooks returns true if the installation declares drain hooks. Nodes are then
+// upgraded one by one so the hooks run around the drain of each node.
+func hasDrainHooks(in *clusterv1beta1.Installation) bool {
+	return len(drainhooks.HooksFor(in.Spec.Config, drainhooks.PreDrain)) > 0 ||
+		len(drainhooks.HooksFor(in.Spec.Config, drainhooks.PostDrain)) > 0
+}
+
 func k0sUpgrade(ctx context.Context, cli client.Client, in *clusterv1beta1.Installation) error {
 	meta, err := release.MetadataFor(ctx, in, cli)
 	if err != nil {
@@ -67,6 +121,9 @@ func k0sUpgrade(ctx context.Context, cli client.Client, in *clusterv1beta1.Insta
 	if match {
 		return nil
 	}
+	if !in.Spec.Config.AutopilotEnabled() {
+		return fmt.Errorf("kubernetes must be upgraded to %s but autopilot is disabled", desiredVersion)
+	}
 
 	// create an autopilot upgrade plan if one does not yet exist
 	var plan apv1b2.Plan
@@ -74,14 +131,28 @@ func k0sUpgrade(ctx context.Context, cli client.Client, in *clusterv1beta1.Insta
 	if err := cli.Get(ctx, okey, &plan); err != nil && !errors.IsNotFound(err) {
 		return fmt.Errorf("failed to get upgrade plan: %w", err)
 	} else if errors.IsNotFound(err) {
-		// if the kubernetes version has changed we create an upgrade command
-		fmt.Printf("Starting k0s autopilot upgrade plan to version %s\n", desiredVersion)
-
 		// there is no autopilot plan in the cluster so we are free to
 		// start our own plan. here we link the plan to the installation
 		// by its name.
-		if err := StartAutopilotUpgrade(ctx, cli, in, meta); err != nil {
-			return fmt.Errorf("failed to start upgrade: %w", err)
+		if !hasDrainHooks(in) {
+			// if the kubernetes version has changed we create an upgrade command
+			fmt.Printf("Starting k0s autopilot upgrade plan to version %s\n", desiredVersion)
+			if err := StartAutopilotUpgrade(ctx, cli, in, meta); err != nil {
+				return fmt.Errorf("failed to start upgrade: %w", err)
+			}
+		} else {
+			// autopilot drains the nodes while upgrading them, the vendor hooks
+			// must run around each drain so we upgrade one node per plan.
+			node, err := NextNodeToUpgrade(ctx, cli, desiredVersion)
+			if err != nil {
+				return fmt.Errorf("determine next node to upgrade: %w", err)
+			} else if node == nil {
+				return fmt.Errorf("no node left to upgrade to version %s", desiredVersion)
+			}
+			fmt.Printf("Starting k0s autopilot upgrade plan for node %s to version %s\n", node.Name, desiredVersion)
+			if err := StartNodeAutopilotUpgrade(ctx, cli, in, meta, *node); err != nil {
+				return fmt.Errorf("failed to start upgrade: %w", err)
+			}
 		}
 	}
 
@@ -114,19 +185,38 @@ func k0sUpgrade(ctx context.Context, cli client.Client, in *clusterv1beta1.Insta
 		return k0sUpgrade(ctx, cli, in)
 	}
 
-	match, err = k8sutil.ClusterNodesMatchVersion(ctx, cli, desiredVersion)
-	if err != nil {
-		return fmt.Errorf("check cluster nodes match version after plan completion: %w", err)
-	}
-	if !match {
-		return fmt.Errorf("cluster nodes did not match version after upgrade")
+	// plans upgrading a single node are followed by the post-drain hooks for
+	// that node, then we move on to the next node.
+	if node := plan.Annotations[NodePlanAnnotation]; node != "" {
+		fmt.Printf("Running %s hooks for node %s\n", drainhooks.PostDrain, node)
+		if err := drainhooks.Run(ctx, cli, in.Spec.Config, drainhooks.PostDrain, node); err != nil {
+			return fmt.Errorf("run post-drain hooks for node %s: %w", node, err)
+		}
+		if err := cli.Delete(ctx, &plan); err != nil {
+			return fmt.Errorf("failed to delete node upgrade plan: %w", err)
+		}
+		match, err = k8sutil.ClusterNodesMatchVersion(ctx, cli, desiredVersion)
+		if err != nil {
+			return fmt.Errorf("check cluster nodes match version after plan completion: %w", err)
+		}
+		if !match {
+			return k0sUpgrade(ctx, cli, in)
+		}
+	} else {
+		match, err = k8sutil.ClusterNodesMatchVersion(ctx, cli, desiredVersion)
+		if err != nil {
+			return fmt.Errorf("check cluster nodes match version after plan completion: %w", err)
+		}
+		if !match {
+			return fmt.Errorf("cluster nodes did not match version after upgrade")
+		}
+		if err := cli.Delete(ctx, &plan); err != nil {
+			return fmt.Errorf("failed to delete successful upgrade plan: %w", err)
+		}
 	}
 
 	// the plan has been completed, so we can move on - kubernetes is now upgraded
 	fmt.Printf("Upgrade to %s completed successfully\n", desiredVersion)
-	if err := cli.Delete(ctx, &plan); err != nil {
-		return fmt.Errorf("failed to delete successful upgrade plan: %w", err)
-	}
 
 	err = setInstallationState(ctx, cli, in.Name, v1beta1.InstallationStateKubernetesInstalled, "Kubernetes upgraded")
 	if err != nil {
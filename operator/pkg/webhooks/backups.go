@@ -0,0 +1,74 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// BackupEvent is the data of the BackupCompleted events.
+type BackupEvent struct {
+	Name        string    `json:"name"`
+	Phase       string    `json:"phase"`
+	StartedAt   time.Time `json:"startedAt"`
+	CompletedAt time.Time `json:"completedAt"`
+	Errors      int       `json:"errors"`
+	Warnings    int       `json:"warnings"`
+}
+
+// CompletedBackups returns the Velero backups in veleroNamespace completed since the
+// backup cursor of the state, oldest first, and advances the cursor. The events are to be
+// queued in the state before it is saved, the cursor then only moves along with them.
+// Without a cursor it is only set, backups taken before the webhooks were registered are
+// not reported. Returns nothing if Velero is not installed.
+func CompletedBackups(ctx context.Context, cli client.Client, state *State, veleroNamespace string) ([]BackupEvent, error) {
+	var backups velerov1.BackupList
+	if err := cli.List(ctx, &backups, client.InNamespace(veleroNamespace)); meta.IsNoMatchError(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to list backups: %w", err)
+	}
+
+	first := state.LastBackup.IsZero()
+	var events []BackupEvent
+	newest := state.LastBackup
+	if first {
+		newest = time.Now().UTC().Truncate(time.Second)
+	}
+	for _, backup := range backups.Items {
+		if backup.Status.CompletionTimestamp == nil {
+			continue
+		}
+		if backup.Status.Phase != velerov1.BackupPhaseCompleted && backup.Status.Phase != velerov1.BackupPhasePartiallyFailed {
+			continue
+		}
+		completed := backup.Status.CompletionTimestamp.Time.UTC().Truncate(time.Second)
+		if first || !completed.After(state.LastBackup) {
+			continue
+		}
+		if completed.After(newest) {
+			newest = completed
+		}
+		ev := BackupEvent{
+			Name:        backup.Name,
+			Phase:       string(backup.Status.Phase),
+			CompletedAt: completed,
+			Errors:      backup.Status.Errors,
+			Warnings:    backup.Status.Warnings,
+		}
+		if backup.Status.StartTimestamp != nil {
+			ev.StartedAt = backup.Status.StartTimestamp.Time.UTC()
+		}
+		events = append(events, ev)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].CompletedAt.Before(events[j].CompletedAt)
+	})
+	state.LastBackup = newest
+	return events, nil
+}
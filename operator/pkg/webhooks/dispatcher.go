@@ -0,0 +1,160 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+)
+
+const (
+	// Namespace is where the operator keeps the state config map.
+	Namespace = "embedded-cluster"
+	// dispatchInterval is how often the pending deliveries are looked at.
+	dispatchInterval = 15 * time.Second
+	// maxRetryDelay caps the delay between the attempts of a failing delivery.
+	maxRetryDelay = time.Hour
+	// maxDeliveryAge is how long an event is retried for before it is dropped.
+	maxDeliveryAge = 24 * time.Hour
+)
+
+// Dispatcher delivers the events queued in the state config map. The queue outlives the
+// operator so deliveries resume after a restart, events are delivered at least once and
+// receivers discard duplicates by their delivery id. It implements the controller-runtime
+// Runnable interface so it can be added to the manager.
+type Dispatcher struct {
+	cli       client.Client
+	namespace string
+}
+
+// NewDispatcher returns a Dispatcher for the state config map of the operator namespace.
+func NewDispatcher(cli client.Client) *Dispatcher {
+	return &Dispatcher{cli: cli, namespace: Namespace}
+}
+
+// NeedLeaderElection returns true so the events are only delivered by the leader.
+func (d *Dispatcher) NeedLeaderElection() bool {
+	return true
+}
+
+// Start delivers the pending events periodically until the context is cancelled.
+func (d *Dispatcher) Start(ctx context.Context) error {
+	log := ctrl.LoggerFrom(ctx).WithName("webhooks")
+	ticker := time.NewTicker(dispatchInterval)
+	defer ticker.Stop()
+	for {
+		if err := d.Dispatch(ctx); err != nil {
+			log.Error(err, "Failed to deliver webhook events")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Dispatch makes an attempt at each pending delivery due. Delivered events are removed
+// from the queue, failed ones are attempted again later with a backoff until they are too
+// old. Deliveries to webhooks no longer registered are dropped.
+func (d *Dispatcher) Dispatch(ctx context.Context) error {
+	log := ctrl.LoggerFrom(ctx).WithName("webhooks")
+	state, err := LoadState(ctx, d.cli, d.namespace)
+	if err != nil {
+		return err
+	}
+	if len(state.Pending) == 0 {
+		return nil
+	}
+	in, err := kubeutils.GetLatestInstallation(ctx, d.cli)
+	if err != nil {
+		return fmt.Errorf("unable to get latest installation: %w", err)
+	}
+	hooks := map[string]v1beta1.Webhook{}
+	if in.Spec.Config != nil {
+		for _, hook := range in.Spec.Config.Webhooks {
+			hooks[hook.Name] = hook
+		}
+	}
+
+	sender := NewSender(in.Spec.Proxy)
+	now := time.Now()
+	done := map[string]bool{}
+	retries := map[string]Delivery{}
+	for _, delivery := range state.Pending {
+		key := delivery.key()
+		hook, ok := hooks[delivery.Webhook]
+		if !ok {
+			done[key] = true
+			continue
+		}
+		if now.Before(delivery.NextAttempt) {
+			continue
+		}
+		retryable, err := sender.Deliver(ctx, hook, delivery.Event)
+		if err == nil {
+			log.Info("Webhook event delivered", "webhook", hook.Name, "event", delivery.Event.Type, "id", delivery.Event.ID)
+			done[key] = true
+			continue
+		}
+		if errors.Is(err, context.Canceled) {
+			break
+		}
+		if !retryable || now.Sub(delivery.Event.Time) > maxDeliveryAge {
+			log.Error(err, "Failed to deliver webhook event, dropping it", "webhook", hook.Name, "event", delivery.Event.Type, "id", delivery.Event.ID)
+			done[key] = true
+			continue
+		}
+		log.Error(err, "Failed to deliver webhook event, retrying later", "webhook", hook.Name, "event", delivery.Event.Type, "id", delivery.Event.ID)
+		delivery.Attempts++
+		delivery.NextAttempt = now.Add(retryDelay(delivery.Attempts))
+		retries[key] = delivery
+	}
+	if len(done) == 0 && len(retries) == 0 {
+		return nil
+	}
+
+	// events may have been queued while delivering, the outcome is applied to the
+	// latest state.
+	return retry.OnError(retry.DefaultRetry, k8serrors.IsConflict, func() error {
+		if state, err = LoadState(ctx, d.cli, d.namespace); err != nil {
+			return err
+		}
+		pending := state.Pending[:0]
+		for _, delivery := range state.Pending {
+			key := delivery.key()
+			if done[key] {
+				continue
+			}
+			if retried, ok := retries[key]; ok {
+				delivery = retried
+			}
+			pending = append(pending, delivery)
+		}
+		state.Pending = pending
+		return state.Save(ctx, d.cli)
+	})
+}
+
+// key identifies the delivery in the queue.
+func (d Delivery) key() string {
+	return d.Webhook + "/" + d.Event.ID
+}
+
+// retryDelay returns the delay before a delivery that failed attempts times is attempted
+// again, doubling from the dispatch interval.
+func retryDelay(attempts int) time.Duration {
+	delay := dispatchInterval
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
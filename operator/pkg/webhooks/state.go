@@ -0,0 +1,116 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+const (
+	// StateConfigMap is the config map holding the events not delivered yet and keeping
+	// track of the backups already reported.
+	StateConfigMap = "embedded-cluster-webhooks"
+	// pendingKey holds the deliveries not made yet.
+	pendingKey = "pendingDeliveries"
+	// lastBackupKey holds the completion time of the newest backup reported.
+	lastBackupKey = "lastBackupCompletion"
+	// maxPending is how many deliveries are kept, the oldest are dropped past it so an
+	// endpoint down for long does not grow the config map without bounds.
+	maxPending = 200
+)
+
+// Delivery is an event waiting to be delivered to a webhook.
+type Delivery struct {
+	// Webhook is the name of the webhook, its url and secret are read from the
+	// installation when delivering.
+	Webhook string `json:"webhook"`
+	Event   Event  `json:"event"`
+	// Attempts is how many deliveries failed so far.
+	Attempts int `json:"attempts,omitempty"`
+	// NextAttempt is when the delivery is attempted again after a failure.
+	NextAttempt time.Time `json:"nextAttempt,omitempty"`
+}
+
+// State is the content of the state config map. Events are queued and the backup cursor
+// advanced in the same write, so events noticed are never lost.
+type State struct {
+	Pending    []Delivery
+	LastBackup time.Time
+
+	namespace string
+	configmap *corev1.ConfigMap
+}
+
+// LoadState reads the state from the config map in namespace. The state is empty if the
+// config map does not exist.
+func LoadState(ctx context.Context, cli client.Client, namespace string) (*State, error) {
+	state := &State{namespace: namespace}
+	var cm corev1.ConfigMap
+	err := cli.Get(ctx, client.ObjectKey{Namespace: namespace, Name: StateConfigMap}, &cm)
+	if errors.IsNotFound(err) {
+		return state, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to get webhooks state: %w", err)
+	}
+	state.configmap = &cm
+	if value := cm.Data[lastBackupKey]; value != "" {
+		if state.LastBackup, err = time.Parse(time.RFC3339, value); err != nil {
+			return nil, fmt.Errorf("unable to parse last backup completion: %w", err)
+		}
+	}
+	if value := cm.Data[pendingKey]; value != "" {
+		if err := json.Unmarshal([]byte(value), &state.Pending); err != nil {
+			return nil, fmt.Errorf("unable to parse pending deliveries: %w", err)
+		}
+	}
+	return state, nil
+}
+
+// Enqueue queues the delivery of the events to the webhooks subscribed to them.
+func (s *State) Enqueue(hooks []v1beta1.Webhook, events ...Event) {
+	for _, ev := range events {
+		for _, hook := range Subscribed(hooks, ev.Type) {
+			s.Pending = append(s.Pending, Delivery{Webhook: hook.Name, Event: ev})
+		}
+	}
+	if len(s.Pending) > maxPending {
+		s.Pending = s.Pending[len(s.Pending)-maxPending:]
+	}
+}
+
+// Save writes the state to the config map. The config map must not have changed since
+// the state was loaded, a conflict error is returned otherwise.
+func (s *State) Save(ctx context.Context, cli client.Client) error {
+	pending, err := json.Marshal(s.Pending)
+	if err != nil {
+		return fmt.Errorf("unable to encode pending deliveries: %w", err)
+	}
+	data := map[string]string{pendingKey: string(pending)}
+	if !s.LastBackup.IsZero() {
+		data[lastBackupKey] = s.LastBackup.Format(time.RFC3339)
+	}
+	if s.configmap == nil {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: s.namespace, Name: StateConfigMap},
+			Data:       data,
+		}
+		if err := cli.Create(ctx, cm); err != nil {
+			return fmt.Errorf("unable to create webhooks state: %w", err)
+		}
+		s.configmap = cm
+		return nil
+	}
+	s.configmap.Data = data
+	if err := cli.Update(ctx, s.configmap); err != nil {
+		return fmt.Errorf("unable to update webhooks state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+// Package webhooks delivers the lifecycle events of the cluster to the webhooks the vendor
+// registered in the release, so fleets can be automated beyond what the metrics report.
+// Events are queued in a config map and delivered by the leader operator, failed
+// deliveries are retried with a backoff across restarts. Requests are signed with the
+// secret of the webhook and go through the proxy of the cluster.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+	"k8s.io/apimachinery/pkg/util/uuid"
+
+	"github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+// The lifecycle events webhooks can be notified of.
+const (
+	EventInstalled       = "Installed"
+	EventUpgraded        = "Upgraded"
+	EventNodeAdded       = "NodeAdded"
+	EventNodeRemoved     = "NodeRemoved"
+	EventBackupCompleted = "BackupCompleted"
+)
+
+const (
+	// EventHeader holds the type of the event delivered.
+	EventHeader = "X-Embedded-Cluster-Event"
+	// DeliveryHeader holds the id of the event, it is the same across retries so
+	// receivers can discard duplicates.
+	DeliveryHeader = "X-Embedded-Cluster-Delivery"
+	// TimestampHeader holds the unix time the request was signed at. Receivers reject
+	// requests signed too long ago so they can not be replayed.
+	TimestampHeader = "X-Embedded-Cluster-Timestamp"
+	// SignatureHeader holds the hex encoded HMAC-SHA256 of the timestamp and the body
+	// joined by a dot, keyed with the secret of the webhook.
+	SignatureHeader = "X-Embedded-Cluster-Signature"
+)
+
+// requestTimeout is how long a single delivery attempt can take.
+const requestTimeout = 10 * time.Second
+
+// Event is the body posted to the webhooks.
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	ClusterID string      `json:"clusterID"`
+	Version   string      `json:"version,omitempty"`
+	Time      time.Time   `json:"time"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// NewEvent returns a new event of the provided type for the installation.
+func NewEvent(in *v1beta1.Installation, eventType string, data interface{}) Event {
+	ev := Event{
+		ID:        string(uuid.NewUUID()),
+		Type:      eventType,
+		ClusterID: in.Spec.ClusterID,
+		Time:      time.Now().UTC(),
+		Data:      data,
+	}
+	if in.Spec.Config != nil {
+		ev.Version = in.Spec.Config.Version
+	}
+	return ev
+}
+
+// Subscribed returns the webhooks notified of the event type. Webhooks without events
+// are notified of all of them.
+func Subscribed(hooks []v1beta1.Webhook, eventType string) []v1beta1.Webhook {
+	var subscribed []v1beta1.Webhook
+	for _, hook := range hooks {
+		if len(hook.Events) == 0 || slices.Contains(hook.Events, eventType) {
+			subscribed = append(subscribed, hook)
+		}
+	}
+	return subscribed
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the timestamp and the body joined by a dot,
+// keyed with the secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sender delivers events to webhooks.
+type Sender struct {
+	client *http.Client
+}
+
+// NewSender returns a Sender going through the provided proxy, if any.
+func NewSender(proxy *v1beta1.ProxySpec) *Sender {
+	// events are few and far between, connections are not kept around.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = true
+	if proxy != nil {
+		cfg := httpproxy.Config{
+			HTTPProxy:  proxy.HTTPProxy,
+			HTTPSProxy: proxy.HTTPSProxy,
+			NoProxy:    proxy.NoProxy,
+		}
+		proxyFunc := cfg.ProxyFunc()
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxyFunc(req.URL)
+		}
+	}
+	return &Sender{
+		client: &http.Client{Transport: transport, Timeout: requestTimeout},
+	}
+}
+
+// Deliver makes a single attempt to post the event to the webhook. Returns whether the
+// attempt can be retried when it fails: network errors, throttled requests and server
+// errors are, other responses fail the delivery for good.
+func (s *Sender) Deliver(ctx context.Context, hook v1beta1.Webhook, ev Event) (bool, error) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return false, fmt.Errorf("unable to encode event: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("unable to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, ev.Type)
+	req.Header.Set(DeliveryHeader, ev.ID)
+	if hook.Secret != "" {
+		timestamp := time.Now().Unix()
+		req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+		req.Header.Set(SignatureHeader, Sign(hook.Secret, timestamp, body))
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("unable to post event: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("unexpected status: %s", resp.Status)
+	default:
+		return false, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+}
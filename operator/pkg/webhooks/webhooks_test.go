@@ -0,0 +1,209 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/k8sutil"
+)
+
+func TestSubscribed(t *testing.T) {
+	hooks := []v1beta1.Webhook{
+		{Name: "all"},
+		{Name: "nodes", Events: []string{EventNodeAdded, EventNodeRemoved}},
+	}
+	assert.Len(t, Subscribed(hooks, EventNodeAdded), 2)
+	got := Subscribed(hooks, EventUpgraded)
+	require.Len(t, got, 1)
+	assert.Equal(t, "all", got[0].Name)
+}
+
+func TestDeliver(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		timestamp, err := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now(), time.Unix(timestamp, 0), time.Minute)
+		assert.Equal(t, Sign("s3cr3t", timestamp, body), r.Header.Get(SignatureHeader))
+		assert.Equal(t, EventUpgraded, r.Header.Get(EventHeader))
+		assert.Equal(t, "delivery-1", r.Header.Get(DeliveryHeader))
+
+		var ev Event
+		require.NoError(t, json.Unmarshal(body, &ev))
+		assert.Equal(t, "cluster-1", ev.ClusterID)
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sender := NewSender(nil)
+	hook := v1beta1.Webhook{Name: "fleet", URL: server.URL, Secret: "s3cr3t"}
+	ev := Event{ID: "delivery-1", Type: EventUpgraded, ClusterID: "cluster-1"}
+	retryable, err := sender.Deliver(context.Background(), hook, ev)
+	assert.ErrorContains(t, err, "unexpected status: 503 Service Unavailable")
+	assert.True(t, retryable, "server errors are retried")
+	retryable, err = sender.Deliver(context.Background(), hook, ev)
+	require.NoError(t, err)
+	assert.False(t, retryable)
+}
+
+func TestDeliverRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get(SignatureHeader))
+		assert.Empty(t, r.Header.Get(TimestampHeader))
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	hook := v1beta1.Webhook{Name: "fleet", URL: server.URL}
+	retryable, err := NewSender(nil).Deliver(context.Background(), hook, Event{Type: EventInstalled})
+	assert.ErrorContains(t, err, "unexpected status: 400 Bad Request")
+	assert.False(t, retryable, "client errors are not retried")
+}
+
+func TestSign(t *testing.T) {
+	signature := Sign("key", 1700000000, []byte("{}"))
+	assert.Len(t, signature, 64)
+	assert.NotEqual(t, signature, Sign("other", 1700000000, []byte("{}")))
+	assert.NotEqual(t, signature, Sign("key", 1700000001, []byte("{}")), "the timestamp is signed")
+}
+
+func TestDispatch(t *testing.T) {
+	ctx := context.Background()
+	var fail atomic.Bool
+	var delivered atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/rejected":
+			w.WriteHeader(http.StatusBadRequest)
+		case fail.Load():
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			delivered.Add(1)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	hooks := []v1beta1.Webhook{
+		{Name: "fleet", URL: server.URL},
+		{Name: "rejected", URL: server.URL + "/rejected"},
+	}
+	in := &v1beta1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Name: "20241002205018"},
+		Spec: v1beta1.InstallationSpec{
+			ClusterID: "cluster-1",
+			Config:    &v1beta1.ConfigSpec{Webhooks: hooks},
+		},
+	}
+	cli := fake.NewClientBuilder().WithScheme(k8sutil.Scheme()).WithObjects(in).Build()
+
+	state, err := LoadState(ctx, cli, Namespace)
+	require.NoError(t, err)
+	state.Enqueue(append(hooks, v1beta1.Webhook{Name: "removed"}), NewEvent(in, EventInstalled, nil))
+	require.Len(t, state.Pending, 3)
+	require.NoError(t, state.Save(ctx, cli))
+
+	// the failed delivery is kept for later, the rejected one and the one to the webhook
+	// no longer registered are dropped.
+	fail.Store(true)
+	dispatcher := NewDispatcher(cli)
+	require.NoError(t, dispatcher.Dispatch(ctx))
+	state, err = LoadState(ctx, cli, Namespace)
+	require.NoError(t, err)
+	require.Len(t, state.Pending, 1)
+	assert.Equal(t, "fleet", state.Pending[0].Webhook)
+	assert.Equal(t, 1, state.Pending[0].Attempts)
+	assert.True(t, state.Pending[0].NextAttempt.After(time.Now()))
+
+	// the delivery is not attempted before it is due.
+	fail.Store(false)
+	require.NoError(t, dispatcher.Dispatch(ctx))
+	assert.Equal(t, int32(0), delivered.Load())
+
+	state.Pending[0].NextAttempt = time.Time{}
+	require.NoError(t, state.Save(ctx, cli))
+	require.NoError(t, dispatcher.Dispatch(ctx))
+	assert.Equal(t, int32(1), delivered.Load())
+	state, err = LoadState(ctx, cli, Namespace)
+	require.NoError(t, err)
+	assert.Empty(t, state.Pending)
+}
+
+func TestCompletedBackups(t *testing.T) {
+	ctx := context.Background()
+	backup := func(name string, phase velerov1.BackupPhase, completed time.Time) *velerov1.Backup {
+		return &velerov1.Backup{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: name},
+			Status: velerov1.BackupStatus{
+				Phase:               phase,
+				StartTimestamp:      &metav1.Time{Time: completed.Add(-time.Minute)},
+				CompletionTimestamp: &metav1.Time{Time: completed},
+			},
+		}
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	cli := fake.NewClientBuilder().WithScheme(k8sutil.Scheme()).WithObjects(
+		backup("old", velerov1.BackupPhaseCompleted, now.Add(-time.Hour)),
+	).Build()
+
+	// backups taken before the first call are not reported.
+	state, err := LoadState(ctx, cli, "embedded-cluster")
+	require.NoError(t, err)
+	events, err := CompletedBackups(ctx, cli, state, "velero")
+	require.NoError(t, err)
+	assert.Empty(t, events)
+	require.NoError(t, state.Save(ctx, cli))
+
+	later := state.LastBackup.Add(time.Minute)
+	require.NoError(t, cli.Create(ctx, backup("failed", velerov1.BackupPhaseFailed, later)))
+	require.NoError(t, cli.Create(ctx, backup("second", velerov1.BackupPhasePartiallyFailed, later.Add(time.Minute))))
+	require.NoError(t, cli.Create(ctx, backup("first", velerov1.BackupPhaseCompleted, later)))
+
+	// the cursor only moves when the state is saved.
+	state, err = LoadState(ctx, cli, "embedded-cluster")
+	require.NoError(t, err)
+	events, err = CompletedBackups(ctx, cli, state, "velero")
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	state, err = LoadState(ctx, cli, "embedded-cluster")
+	require.NoError(t, err)
+	events, err = CompletedBackups(ctx, cli, state, "velero")
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "first", events[0].Name)
+	assert.Equal(t, "second", events[1].Name)
+	assert.Equal(t, "PartiallyFailed", events[1].Phase)
+	require.NoError(t, state.Save(ctx, cli))
+
+	state, err = LoadState(ctx, cli, "embedded-cluster")
+	require.NoError(t, err)
+	events, err = CompletedBackups(ctx, cli, state, "velero")
+	require.NoError(t, err)
+	assert.Empty(t, events)
+
+	var cm corev1.ConfigMap
+	require.NoError(t, cli.Get(ctx, client.ObjectKey{Namespace: "embedded-cluster", Name: StateConfigMap}, &cm))
+	assert.Equal(t, later.Add(time.Minute).Format(time.RFC3339), cm.Data[lastBackupKey])
+}
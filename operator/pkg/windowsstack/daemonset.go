@@ -0,0 +1,179 @@
+package windowsstack
+
+import (
+	"fmt"
+
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	"github.com/k0sproject/k0s/pkg/constant"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// ConfigMapName holds the Calico configuration of the Windows nodes.
+	ConfigMapName = "calico-windows-config"
+	// CalicoName and KubeProxyName are the names of the daemonsets.
+	CalicoName    = "calico-node-windows"
+	KubeProxyName = "kube-proxy-windows"
+	// CalicoImage and KubeProxyImage are the host process images, tagged with the
+	// Calico release and the kubernetes version respectively.
+	CalicoImage    = "docker.io/calico/node-windows"
+	KubeProxyImage = "docker.io/sigwindowstools/kube-proxy"
+)
+
+// NewConfigMap returns the configuration of Calico on the Windows nodes. Host process
+// containers can not reach the kubernetes service before kube-proxy runs, so the api is
+// reached through its address.
+func NewConfigMap(spec *k0sv1beta1.ClusterSpec) (*corev1.ConfigMap, error) {
+	if spec.API == nil || spec.API.Address == "" {
+		return nil, fmt.Errorf("cluster config has no api address")
+	}
+	dns, err := spec.Network.DNSAddress()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get cluster dns address: %w", err)
+	}
+	mode := "vxlan"
+	if spec.Network.Calico != nil && spec.Network.Calico.Mode != "" {
+		mode = spec.Network.Calico.Mode
+	}
+	return &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ConfigMapName,
+			Namespace: Namespace,
+			Labels:    labels(CalicoName),
+		},
+		Data: map[string]string{
+			"CALICO_NETWORKING_BACKEND": mode,
+			"CALICO_DATASTORE_TYPE":     "kubernetes",
+			"KUBERNETES_SERVICE_HOST":   spec.API.Address,
+			"KUBERNETES_SERVICE_PORT":   apiPort(spec),
+			"K8S_SERVICE_CIDR":          spec.Network.ServiceCIDR,
+			"DNS_NAME_SERVERS":          dns,
+			"CNI_BIN_DIR":               CNIBinDir,
+			"CNI_CONF_DIR":              CNIConfDir,
+			"KUBE_NETWORK":              "Calico.*",
+			"FELIX_HEALTHENABLED":       "true",
+		},
+	}, nil
+}
+
+// NewCalicoDaemonSet returns the daemonset running calico-node and felix on the Windows
+// nodes, with the service account of the linux calico-node pods.
+func NewCalicoDaemonSet() *appsv1.DaemonSet {
+	container := func(name string) corev1.Container {
+		return corev1.Container{
+			Name:       name,
+			Image:      fmt.Sprintf("%s:%s", CalicoImage, calicoVersion()),
+			Args:       []string{fmt.Sprintf(`.\%s\%s-service.ps1`, name, name)},
+			WorkingDir: "$env:CONTAINER_SANDBOX_MOUNT_POINT/CalicoWindows/",
+			EnvFrom: []corev1.EnvFromSource{
+				{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: ConfigMapName}}},
+			},
+			Env: []corev1.EnvVar{nodeNameEnv("NODENAME")},
+		}
+	}
+	felix := container("felix")
+	felix.ReadinessProbe = &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			Exec: &corev1.ExecAction{Command: []string{`c:\CalicoWindows\calico-node.exe`, "-felix-ready"}},
+		},
+		PeriodSeconds:  10,
+		TimeoutSeconds: 10,
+	}
+	return newDaemonSet(CalicoName, "calico-node", nil, container("node"), felix)
+}
+
+// NewKubeProxyDaemonSet returns the daemonset running kube-proxy on the Windows nodes. It
+// reads the configuration k0s deploys for the linux kube-proxy pods.
+func NewKubeProxyDaemonSet() *appsv1.DaemonSet {
+	container := corev1.Container{
+		Name:       "kube-proxy",
+		Image:      fmt.Sprintf("%s:%s-calico-hostprocess", KubeProxyImage, constant.KubeProxyImageVersion),
+		Args:       []string{"$env:CONTAINER_SANDBOX_MOUNT_POINT/kube-proxy/start.ps1"},
+		WorkingDir: "$env:CONTAINER_SANDBOX_MOUNT_POINT/kube-proxy/",
+		Env: []corev1.EnvVar{
+			nodeNameEnv("NODE_NAME"),
+			{
+				Name: "POD_IP",
+				ValueFrom: &corev1.EnvVarSource{
+					FieldRef: &corev1.ObjectFieldSelector{FieldPath: "status.podIP"},
+				},
+			},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: "kube-proxy", MountPath: "/var/lib/kube-proxy"},
+		},
+	}
+	volumes := []corev1.Volume{
+		{
+			Name: "kube-proxy",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "kube-proxy"}},
+			},
+		},
+	}
+	return newDaemonSet(KubeProxyName, "kube-proxy", volumes, container)
+}
+
+// newDaemonSet returns a daemonset running the containers as host processes on every
+// Windows node, the nodes are tainted so all taints are tolerated.
+func newDaemonSet(name, serviceAccount string, volumes []corev1.Volume, containers ...corev1.Container) *appsv1.DaemonSet {
+	return &appsv1.DaemonSet{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "apps/v1",
+			Kind:       "DaemonSet",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: Namespace,
+			Labels:    labels(name),
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"k8s-app": name}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels(name),
+				},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: serviceAccount,
+					HostNetwork:        true,
+					SecurityContext: &corev1.PodSecurityContext{
+						WindowsOptions: &corev1.WindowsSecurityContextOptions{
+							HostProcess:   ptr.To(true),
+							RunAsUserName: ptr.To(`NT AUTHORITY\system`),
+						},
+					},
+					NodeSelector: map[string]string{corev1.LabelOSStable: "windows"},
+					Tolerations: []corev1.Toleration{
+						{Operator: corev1.TolerationOpExists},
+					},
+					Volumes:    volumes,
+					Containers: containers,
+				},
+			},
+		},
+	}
+}
+
+func labels(name string) map[string]string {
+	return map[string]string{
+		"k8s-app":                      name,
+		"app.kubernetes.io/part-of":    "embedded-cluster",
+		"app.kubernetes.io/managed-by": "embedded-cluster-operator",
+	}
+}
+
+func nodeNameEnv(name string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			FieldRef: &corev1.ObjectFieldSelector{FieldPath: "spec.nodeName"},
+		},
+	}
+}
@@ -0,0 +1,104 @@
+// Package windowsstack deploys the pod network of the Windows workers, Calico and
+// kube-proxy running as host process containers. k0s only deploys them on the linux
+// nodes, its own Windows stack is disabled as its images lag behind the cluster versions.
+// The CNI plugins and their configuration are installed on the hosts by install.ps1,
+// written by join --role windows-worker.
+package windowsstack
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	"github.com/k0sproject/k0s/pkg/constant"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	clusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+const (
+	// Namespace is where the windows stack runs, along with its linux counterpart.
+	Namespace = "kube-system"
+	// CNIBinDir and CNIConfDir are where install.ps1 writes the CNI plugins and their
+	// configuration on the Windows hosts.
+	CNIBinDir  = `C:\opt\cni\bin`
+	CNIConfDir = `C:\etc\cni\net.d`
+)
+
+// Reconcile deploys the Calico and kube-proxy daemonsets on the Windows workers, once
+// there are any. Windows workers are only supported in online installations using the
+// Calico network provider.
+func Reconcile(ctx context.Context, cli client.Client, in *clusterv1beta1.Installation) error {
+	if in == nil || in.Spec.AirGap {
+		return nil
+	}
+	var nodes corev1.NodeList
+	if err := cli.List(ctx, &nodes, client.MatchingLabels{corev1.LabelOSStable: "windows"}); err != nil {
+		return fmt.Errorf("unable to list windows nodes: %w", err)
+	}
+	if len(nodes.Items) == 0 {
+		return nil
+	}
+
+	var cfg k0sv1beta1.ClusterConfig
+	if err := cli.Get(ctx, client.ObjectKey{Name: "k0s", Namespace: "kube-system"}, &cfg); err != nil {
+		return fmt.Errorf("unable to get cluster config: %w", err)
+	}
+	if cfg.Spec == nil || cfg.Spec.Network == nil || cfg.Spec.Network.Provider != constant.CNIProviderCalico {
+		return nil
+	}
+	config, err := NewConfigMap(cfg.Spec)
+	if err != nil {
+		return err
+	}
+	if err := apply(ctx, cli, config); err != nil {
+		return err
+	}
+	if err := apply(ctx, cli, NewCalicoDaemonSet()); err != nil {
+		return err
+	}
+	if cfg.Spec.Network.KubeProxy != nil && cfg.Spec.Network.KubeProxy.Disabled {
+		return nil
+	}
+	return apply(ctx, cli, NewKubeProxyDaemonSet())
+}
+
+// apply creates the object or replaces the existing one.
+func apply(ctx context.Context, cli client.Client, desired client.Object) error {
+	kind := strings.ToLower(desired.GetObjectKind().GroupVersionKind().Kind)
+	existing := desired.DeepCopyObject().(client.Object)
+	err := cli.Get(ctx, client.ObjectKeyFromObject(desired), existing)
+	if k8serrors.IsNotFound(err) {
+		if err := cli.Create(ctx, desired); err != nil {
+			return fmt.Errorf("unable to create %s %s: %w", kind, desired.GetName(), err)
+		}
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("unable to get %s %s: %w", kind, desired.GetName(), err)
+	}
+	desired.SetResourceVersion(existing.GetResourceVersion())
+	if err := cli.Update(ctx, desired); err != nil {
+		return fmt.Errorf("unable to update %s %s: %w", kind, desired.GetName(), err)
+	}
+	return nil
+}
+
+// calicoVersion returns the Calico release matching the images k0s deploys on the linux
+// nodes, the images are tagged with the release and a k0s build suffix.
+func calicoVersion() string {
+	version, _, _ := strings.Cut(constant.CalicoComponentImagesVersion, "-")
+	return version
+}
+
+// apiPort returns the port of the kubernetes api as a string.
+func apiPort(spec *k0sv1beta1.ClusterSpec) string {
+	port := 6443
+	if spec.API != nil && spec.API.Port != 0 {
+		port = spec.API.Port
+	}
+	return strconv.Itoa(port)
+}
@@ -0,0 +1,98 @@
+package windowsstack
+
+import (
+	"context"
+	"testing"
+
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	clusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/operator/pkg/k8sutil"
+)
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	in := &clusterv1beta1.Installation{ObjectMeta: metav1.ObjectMeta{Name: "20241010120000"}}
+	cfg := &k0sv1beta1.ClusterConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "k0s", Namespace: "kube-system"},
+		Spec:       k0sv1beta1.DefaultClusterSpec(),
+	}
+	cfg.Spec.API.Address = "10.0.0.1"
+	cfg.Spec.Network.Provider = "calico"
+	linux := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "linux", Labels: map[string]string{corev1.LabelOSStable: "linux"}},
+	}
+	cli := fake.NewClientBuilder().WithScheme(k8sutil.Scheme()).WithObjects(cfg, linux).Build()
+
+	// nothing is deployed until a windows node joins.
+	require.NoError(t, Reconcile(ctx, cli, in))
+	var ds appsv1.DaemonSet
+	err := cli.Get(ctx, client.ObjectKey{Namespace: Namespace, Name: CalicoName}, &ds)
+	assert.True(t, k8serrors.IsNotFound(err), "unexpected error: %v", err)
+
+	windows := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "windows", Labels: map[string]string{corev1.LabelOSStable: "windows"}},
+	}
+	require.NoError(t, cli.Create(ctx, windows))
+	require.NoError(t, Reconcile(ctx, cli, in))
+
+	var config corev1.ConfigMap
+	require.NoError(t, cli.Get(ctx, client.ObjectKey{Namespace: Namespace, Name: ConfigMapName}, &config))
+	assert.Equal(t, "10.0.0.1", config.Data["KUBERNETES_SERVICE_HOST"])
+	assert.Equal(t, "6443", config.Data["KUBERNETES_SERVICE_PORT"])
+	assert.Equal(t, "10.96.0.10", config.Data["DNS_NAME_SERVERS"])
+	assert.Equal(t, CNIBinDir, config.Data["CNI_BIN_DIR"])
+
+	for _, name := range []string{CalicoName, KubeProxyName} {
+		require.NoError(t, cli.Get(ctx, client.ObjectKey{Namespace: Namespace, Name: name}, &ds))
+		spec := ds.Spec.Template.Spec
+		assert.Equal(t, "windows", spec.NodeSelector[corev1.LabelOSStable])
+		assert.True(t, *spec.SecurityContext.WindowsOptions.HostProcess)
+		assert.True(t, spec.HostNetwork)
+	}
+	assert.Equal(t, "docker.io/sigwindowstools/kube-proxy:v1.29.9-calico-hostprocess", ds.Spec.Template.Spec.Containers[0].Image)
+
+	// the configuration follows the cluster config.
+	cfg.Spec.API.Port = 7443
+	require.NoError(t, cli.Update(ctx, cfg))
+	require.NoError(t, Reconcile(ctx, cli, in))
+	require.NoError(t, cli.Get(ctx, client.ObjectKey{Namespace: Namespace, Name: ConfigMapName}, &config))
+	assert.Equal(t, "7443", config.Data["KUBERNETES_SERVICE_PORT"])
+}
+
+func TestReconcileSkipped(t *testing.T) {
+	ctx := context.Background()
+	windows := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "windows", Labels: map[string]string{corev1.LabelOSStable: "windows"}},
+	}
+	cfg := &k0sv1beta1.ClusterConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "k0s", Namespace: "kube-system"},
+		Spec:       k0sv1beta1.DefaultClusterSpec(),
+	}
+	cfg.Spec.API.Address = "10.0.0.1"
+	cfg.Spec.Network.Provider = "custom"
+
+	for name, in := range map[string]*clusterv1beta1.Installation{
+		"airgap": {
+			ObjectMeta: metav1.ObjectMeta{Name: "20241010120000"},
+			Spec:       clusterv1beta1.InstallationSpec{AirGap: true},
+		},
+		"custom network provider": {ObjectMeta: metav1.ObjectMeta{Name: "20241010120000"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cli := fake.NewClientBuilder().WithScheme(k8sutil.Scheme()).WithObjects(windows, cfg).Build()
+			require.NoError(t, Reconcile(ctx, cli, in))
+			var list appsv1.DaemonSetList
+			require.NoError(t, cli.List(ctx, &list))
+			assert.Empty(t, list.Items)
+		})
+	}
+}
@@ -4,6 +4,8 @@ package adminconsole
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	_ "embed"
 	"encoding/base64"
 	"fmt"
@@ -23,6 +25,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/replicatedhq/embedded-cluster/pkg/addons/registry"
+	"github.com/replicatedhq/embedded-cluster/pkg/airgap"
 	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
 	"github.com/replicatedhq/embedded-cluster/pkg/helm"
 	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
@@ -84,13 +87,19 @@ func init() {
 
 // AdminConsole manages the admin console helm chart installation.
 type AdminConsole struct {
-	namespace    string
-	password     string
-	licenseFile  string
-	airgapBundle string
-	proxyEnv     map[string]string
-	privateCAs   map[string]string
-	port         int
+	namespace      string
+	password       string
+	licenseFile    string
+	airgapBundle   string
+	airgapRegistry *airgap.Registry
+	proxyEnv       map[string]string
+	privateCAs     map[string]string
+	port           int
+	tlsCert        []byte
+	tlsKey         []byte
+	hostname       string
+	authMode       string
+	reconcile      bool
 }
 
 // Version returns the embedded admin console version.
@@ -141,6 +150,11 @@ func (a *AdminConsole) GenerateHelmConfig(k0sCfg *k0sv1beta1.ClusterConfig, only
 		return nil, nil, fmt.Errorf("set helm values admin-console.kurlProxy.nodePort: %w", err)
 	}
 
+	helmValues, err = helm.SetValue(helmValues, "kurlProxy.enabled", a.authMode != ecv1beta1.AdminConsoleAuthModeDisabled)
+	if err != nil {
+		return nil, nil, fmt.Errorf("set helm values admin-console.kurlProxy.enabled: %w", err)
+	}
+
 	values, err := helm.MarshalValues(helmValues)
 	if err != nil {
 		return nil, nil, fmt.Errorf("unable to marshal helm values: %w", err)
@@ -181,7 +195,13 @@ func (a *AdminConsole) Outro(ctx context.Context, cli client.Client, k0sCfg *k0s
 	loading.Infof("Waiting for the Admin Console to deploy")
 	defer loading.Close()
 
-	if err := createKotsPasswordSecret(ctx, cli, a.namespace, a.password); err != nil {
+	password := a.password
+	if a.authMode != ecv1beta1.AdminConsoleAuthModePassword {
+		// the admin console requires a password, one nobody knows is used when users
+		// do not authenticate with a password.
+		password = helpers.RandString(32)
+	}
+	if err := createKotsPasswordSecret(ctx, cli, a.namespace, password); err != nil {
 		return fmt.Errorf("unable to create kots password secret: %w", err)
 	}
 
@@ -189,8 +209,19 @@ func (a *AdminConsole) Outro(ctx context.Context, cli client.Client, k0sCfg *k0s
 		return fmt.Errorf("unable to create kots CA configmap: %w", err)
 	}
 
+	if len(a.tlsCert) > 0 {
+		if err := createTLSSecret(ctx, cli, a.namespace, a.tlsCert, a.tlsKey, a.hostname); err != nil {
+			return fmt.Errorf("unable to create kotsadm tls secret: %w", err)
+		}
+	}
+
 	if a.airgapBundle != "" {
-		err := createRegistrySecret(ctx, cli, a.namespace)
+		host := fmt.Sprintf("%s:5000", registry.GetRegistryClusterIP())
+		username, password := "embedded-cluster", registry.GetRegistryPassword()
+		if a.airgapRegistry != nil {
+			host, username, password = a.airgapRegistry.Host(), a.airgapRegistry.Username, a.airgapRegistry.Password
+		}
+		err := createRegistrySecret(ctx, cli, a.namespace, host, username, password)
 		if err != nil {
 			return fmt.Errorf("error creating registry secret: %v", err)
 		}
@@ -205,13 +236,24 @@ func (a *AdminConsole) Outro(ctx context.Context, cli client.Client, k0sCfg *k0s
 		if err != nil {
 			return fmt.Errorf("unable to parse license: %w", err)
 		}
+		// a reconciled installation may have failed after the application was installed.
+		if a.reconcile {
+			installed, err := kotscli.AppInstalled(ctx, license.Spec.AppSlug, a.namespace)
+			if err != nil {
+				return err
+			}
+			if installed {
+				loading.Infof("Admin Console is ready!")
+				return nil
+			}
+		}
 		installOpts := kotscli.InstallOptions{
 			AppSlug:      license.Spec.AppSlug,
 			LicenseFile:  a.licenseFile,
 			Namespace:    a.namespace,
 			AirgapBundle: a.airgapBundle,
 		}
-		if err := kotscli.Install(installOpts, loading); err != nil {
+		if err := kotscli.Install(ctx, installOpts, loading); err != nil {
 			return err
 		}
 	}
@@ -227,21 +269,76 @@ func New(
 	password string,
 	licenseFile string,
 	airgapBundle string,
+	airgapRegistry *airgap.Registry,
 	proxyEnv map[string]string,
 	privateCAs map[string]string,
 	port int,
+	tlsCert []byte,
+	tlsKey []byte,
+	hostname string,
+	authMode string,
+	reconcile bool,
 ) (*AdminConsole, error) {
+	if authMode == "" {
+		authMode = ecv1beta1.AdminConsoleAuthModePassword
+	}
 	return &AdminConsole{
-		namespace:    namespace,
-		password:     password,
-		licenseFile:  licenseFile,
-		airgapBundle: airgapBundle,
-		proxyEnv:     proxyEnv,
-		privateCAs:   privateCAs,
-		port:         GetPort(port),
+		namespace:      namespace,
+		password:       password,
+		licenseFile:    licenseFile,
+		airgapBundle:   airgapBundle,
+		airgapRegistry: airgapRegistry,
+		proxyEnv:       proxyEnv,
+		privateCAs:     privateCAs,
+		port:           GetPort(port),
+		tlsCert:        tlsCert,
+		tlsKey:         tlsKey,
+		hostname:       hostname,
+		authMode:       authMode,
+		reconcile:      reconcile,
 	}, nil
 }
 
+// ValidateAuthMode verifies the authentication mode is supported and, for the identity
+// provider mode, that at least one identity provider is configured.
+func ValidateAuthMode(mode string, identity *ecv1beta1.Identity) error {
+	switch mode {
+	case "", ecv1beta1.AdminConsoleAuthModePassword, ecv1beta1.AdminConsoleAuthModeDisabled:
+		return nil
+	case ecv1beta1.AdminConsoleAuthModeIdentityProvider:
+		if identity == nil || len(identity.Providers) == 0 {
+			return fmt.Errorf("admin console authentication mode %s requires an identity provider", mode)
+		}
+		return nil
+	}
+	return fmt.Errorf(
+		"unsupported admin console authentication mode %q, must be one of %s, %s or %s", mode,
+		ecv1beta1.AdminConsoleAuthModePassword,
+		ecv1beta1.AdminConsoleAuthModeIdentityProvider,
+		ecv1beta1.AdminConsoleAuthModeDisabled,
+	)
+}
+
+// ValidateTLS verifies the provided certificate and key form a valid pair and, if a
+// hostname is provided, that the certificate is valid for it.
+func ValidateTLS(cert, key []byte, hostname string) error {
+	pair, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		return fmt.Errorf("invalid tls certificate or key: %w", err)
+	}
+	if hostname == "" {
+		return nil
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("unable to parse tls certificate: %w", err)
+	}
+	if err := leaf.VerifyHostname(hostname); err != nil {
+		return fmt.Errorf("tls certificate is not valid for hostname %s: %w", hostname, err)
+	}
+	return nil
+}
+
 // WaitForReady waits for the admin console to be ready.
 func WaitForReady(ctx context.Context, cli client.Client, ns string, writer *spinner.MessageWriter) error {
 	backoff := wait.Backoff{Steps: 60, Duration: 5 * time.Second, Factor: 1.0, Jitter: 0.1}
@@ -269,10 +366,7 @@ func WaitForReady(ctx context.Context, cli client.Client, ns string, writer *spi
 		}
 		return count == 2, nil
 	}); err != nil {
-		if lasterr == nil {
-			lasterr = err
-		}
-		return fmt.Errorf("error waiting for admin console: %v", lasterr)
+		return kubeutils.WaitError(ctx, "admin console", err, lasterr)
 	}
 	return nil
 }
@@ -291,6 +385,12 @@ func GetURL(networkInterface string, port int) string {
 	return fmt.Sprintf("http://%s:%v", ipaddr, GetPort(port))
 }
 
+// GetHostnameURL returns the URL to the admin console when it is served with a user
+// provided certificate for the given hostname.
+func GetHostnameURL(hostname string, port int) string {
+	return fmt.Sprintf("https://%s:%v", hostname, GetPort(port))
+}
+
 // GetURL returns the URL to the admin console.
 func GetPort(port int) int {
 	if port <= 0 {
@@ -299,13 +399,16 @@ func GetPort(port int) int {
 	return port
 }
 
-func createRegistrySecret(ctx context.Context, cli client.Client, namespace string) error {
+// createRegistrySecret creates the secret holding the credentials of the registry the
+// application images are pushed to, either the embedded registry or the one provided by
+// the user.
+func createRegistrySecret(ctx context.Context, cli client.Client, namespace, host, username, password string) error {
 	if err := kubeutils.WaitForNamespace(ctx, cli, namespace); err != nil {
 		return err
 	}
 
-	authString := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("embedded-cluster:%s", registry.GetRegistryPassword())))
-	authConfig := fmt.Sprintf(`{"auths":{"%s:5000":{"username": "embedded-cluster", "password": "%s", "auth": "%s"}}}`, registry.GetRegistryClusterIP(), registry.GetRegistryPassword(), authString)
+	authString := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", username, password)))
+	authConfig := fmt.Sprintf(`{"auths":{"%s":{"username": "%s", "password": "%s", "auth": "%s"}}}`, host, username, password, authString)
 
 	registryCreds := corev1.Secret{
 		TypeMeta: metav1.TypeMeta{
@@ -327,7 +430,7 @@ func createRegistrySecret(ctx context.Context, cli client.Client, namespace stri
 		Type: "kubernetes.io/dockerconfigjson",
 	}
 
-	err := cli.Create(ctx, &registryCreds)
+	err := kubeutils.CreateOrUpdateWithRetry(ctx, cli, &registryCreds)
 	if err != nil {
 		return fmt.Errorf("unable to create registry-auth secret: %w", err)
 	}
@@ -364,7 +467,7 @@ func createKotsPasswordSecret(ctx context.Context, cli client.Client, namespace
 		},
 	}
 
-	err = cli.Create(ctx, &kotsPasswordSecret)
+	err = kubeutils.CreateOrUpdateWithRetry(ctx, cli, &kotsPasswordSecret)
 	if err != nil {
 		return fmt.Errorf("unable to create kotsadm-password secret: %w", err)
 	}
@@ -390,10 +493,48 @@ func createKotsCAConfigmap(ctx context.Context, cli client.Client, namespace str
 		Data: cas,
 	}
 
-	err := cli.Create(ctx, &kotsCAConfigmap)
+	err := kubeutils.CreateOrUpdateWithRetry(ctx, cli, &kotsCAConfigmap)
 	if err != nil {
 		return fmt.Errorf("unable to create kotsadm-private-cas configmap: %w", err)
 	}
 
 	return nil
 }
+
+// createTLSSecret stores the user provided certificate used by the admin console. The
+// annotation disables the flow asking users to upload a certificate on first access.
+func createTLSSecret(ctx context.Context, cli client.Client, namespace string, cert, key []byte, hostname string) error {
+	tlsSecret := corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "kotsadm-tls",
+			Namespace: namespace,
+			Labels: map[string]string{
+				"kots.io/kotsadm":                        "true",
+				"replicated.com/disaster-recovery":       "infra",
+				"replicated.com/disaster-recovery-chart": "admin-console",
+			},
+			Annotations: map[string]string{
+				"acceptAnonymousUploads": "0",
+			},
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			"tls.crt": cert,
+			"tls.key": key,
+		},
+	}
+	if hostname != "" {
+		tlsSecret.Data["hostname"] = []byte(hostname)
+	}
+
+	err := kubeutils.CreateOrUpdateWithRetry(ctx, cli, &tlsSecret)
+	if err != nil {
+		return fmt.Errorf("unable to create kotsadm-tls secret: %w", err)
+	}
+
+	return nil
+}
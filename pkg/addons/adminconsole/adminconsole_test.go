@@ -0,0 +1,86 @@
+package adminconsole
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/certs"
+)
+
+func TestValidateTLS(t *testing.T) {
+	builder, err := certs.NewBuilder()
+	require.NoError(t, err)
+	cert, key, err := builder.Generate()
+	require.NoError(t, err)
+	other, err := certs.NewBuilder()
+	require.NoError(t, err)
+	_, otherKey, err := other.Generate()
+	require.NoError(t, err)
+
+	assert.NoError(t, ValidateTLS([]byte(cert), []byte(key), ""))
+	assert.NoError(t, ValidateTLS([]byte(cert), []byte(key), "localhost"))
+	assert.Error(t, ValidateTLS([]byte(cert), []byte(key), "admin.example.com"))
+	assert.Error(t, ValidateTLS([]byte(cert), []byte(otherKey), ""))
+	assert.Error(t, ValidateTLS([]byte("invalid"), []byte(key), ""))
+}
+
+func TestCreateTLSSecret(t *testing.T) {
+	cli := fake.NewClientBuilder().Build()
+	err := createTLSSecret(context.Background(), cli, "kotsadm", []byte("crt"), []byte("key"), "admin.example.com")
+	require.NoError(t, err)
+
+	var secret corev1.Secret
+	require.NoError(t, cli.Get(context.Background(), types.NamespacedName{Namespace: "kotsadm", Name: "kotsadm-tls"}, &secret))
+	assert.Equal(t, corev1.SecretTypeTLS, secret.Type)
+	assert.Equal(t, "0", secret.Annotations["acceptAnonymousUploads"])
+	assert.Equal(t, "infra", secret.Labels["replicated.com/disaster-recovery"])
+	assert.Equal(t, map[string][]byte{
+		"tls.crt":  []byte("crt"),
+		"tls.key":  []byte("key"),
+		"hostname": []byte("admin.example.com"),
+	}, secret.Data)
+}
+
+func TestValidateAuthMode(t *testing.T) {
+	identity := &ecv1beta1.Identity{
+		Providers: []ecv1beta1.IdentityProvider{{Type: "oidc", ID: "okta", Config: "issuer: https://example.okta.com"}},
+	}
+	assert.NoError(t, ValidateAuthMode("", nil))
+	assert.NoError(t, ValidateAuthMode(ecv1beta1.AdminConsoleAuthModePassword, nil))
+	assert.NoError(t, ValidateAuthMode(ecv1beta1.AdminConsoleAuthModeDisabled, nil))
+	assert.NoError(t, ValidateAuthMode(ecv1beta1.AdminConsoleAuthModeIdentityProvider, identity))
+	assert.Error(t, ValidateAuthMode(ecv1beta1.AdminConsoleAuthModeIdentityProvider, nil))
+	assert.Error(t, ValidateAuthMode(ecv1beta1.AdminConsoleAuthModeIdentityProvider, &ecv1beta1.Identity{}))
+	assert.Error(t, ValidateAuthMode("saml", identity))
+}
+
+func TestGenerateHelmConfigAuthMode(t *testing.T) {
+	for mode, enabled := range map[string]bool{
+		ecv1beta1.AdminConsoleAuthModePassword:         true,
+		ecv1beta1.AdminConsoleAuthModeIdentityProvider: true,
+		ecv1beta1.AdminConsoleAuthModeDisabled:         false,
+	} {
+		t.Run(mode, func(t *testing.T) {
+			a, err := New("kotsadm", "", "", "", nil, nil, nil, 0, nil, nil, "", mode, false)
+			require.NoError(t, err)
+			charts, _, err := a.GenerateHelmConfig(nil, true)
+			require.NoError(t, err)
+			require.Len(t, charts, 1)
+			var values struct {
+				KurlProxy struct {
+					Enabled bool `json:"enabled"`
+				} `json:"kurlProxy"`
+			}
+			require.NoError(t, yaml.Unmarshal([]byte(charts[0].Values), &values))
+			assert.Equal(t, enabled, values.KurlProxy.Enabled)
+		})
+	}
+}
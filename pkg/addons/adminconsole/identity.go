@@ -0,0 +1,151 @@
+package adminconsole
+
+import (
+	"context"
+	"fmt"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	kotsv1beta1 "github.com/replicatedhq/kotskinds/apis/kots/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+)
+
+const (
+	// identityConfigSecretName is the name of the secret the admin console reads its
+	// identity configuration from.
+	identityConfigSecretName = "kotsadm-identity-config"
+	// identityConfigSecretKey is the secret key holding the identity configuration.
+	identityConfigSecretKey = "identity.yaml"
+)
+
+// ValidateIdentity verifies the provided identity configuration is complete.
+func ValidateIdentity(identity *ecv1beta1.Identity) error {
+	if identity == nil {
+		return nil
+	}
+	if identity.DisablePasswordAuth && len(identity.Providers) == 0 {
+		return fmt.Errorf("password authentication cannot be disabled without an identity provider")
+	}
+	ids := map[string]bool{}
+	for _, provider := range identity.Providers {
+		if provider.Type != "oidc" && provider.Type != "ldap" {
+			return fmt.Errorf("identity provider %q has unsupported type %q, must be one of oidc or ldap", provider.ID, provider.Type)
+		}
+		if provider.ID == "" {
+			return fmt.Errorf("identity provider of type %s has no id", provider.Type)
+		}
+		if ids[provider.ID] {
+			return fmt.Errorf("duplicate identity provider id %q", provider.ID)
+		}
+		ids[provider.ID] = true
+		var config map[string]interface{}
+		if err := yaml.Unmarshal([]byte(provider.Config), &config); err != nil {
+			return fmt.Errorf("unable to parse identity provider %q config: %w", provider.ID, err)
+		} else if len(config) == 0 {
+			return fmt.Errorf("identity provider %q has no config", provider.ID)
+		}
+	}
+	for _, group := range identity.Groups {
+		if group.ID == "" {
+			return fmt.Errorf("identity group has no id")
+		}
+	}
+	return nil
+}
+
+// identityConfig returns the admin console identity configuration for the provided
+// identity. The identity service is served by the admin console under /dex.
+func identityConfig(identity *ecv1beta1.Identity, adminConsoleURL string) (*kotsv1beta1.IdentityConfig, error) {
+	if err := ValidateIdentity(identity); err != nil {
+		return nil, err
+	}
+	var connectors []kotsv1beta1.DexConnector
+	for _, provider := range identity.Providers {
+		config, err := yaml.YAMLToJSON([]byte(provider.Config))
+		if err != nil {
+			return nil, fmt.Errorf("unable to convert identity provider %q config: %w", provider.ID, err)
+		}
+		name := provider.Name
+		if name == "" {
+			name = provider.ID
+		}
+		connectors = append(connectors, kotsv1beta1.DexConnector{
+			Type:   provider.Type,
+			ID:     provider.ID,
+			Name:   name,
+			Config: runtime.RawExtension{Raw: config},
+		})
+	}
+	var groups []kotsv1beta1.IdentityConfigGroup
+	for _, group := range identity.Groups {
+		groups = append(groups, kotsv1beta1.IdentityConfigGroup{ID: group.ID, RoleIDs: group.RoleIDs})
+	}
+	return &kotsv1beta1.IdentityConfig{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "kots.io/v1beta1",
+			Kind:       "IdentityConfig",
+		},
+		Spec: kotsv1beta1.IdentityConfigSpec{
+			Enabled:                len(connectors) > 0,
+			DisablePasswordAuth:    identity.DisablePasswordAuth,
+			Groups:                 groups,
+			AdminConsoleAddress:    adminConsoleURL,
+			IdentityServiceAddress: fmt.Sprintf("%s/dex", adminConsoleURL),
+			DexConnectors:          kotsv1beta1.DexConnectors{Value: connectors},
+		},
+	}, nil
+}
+
+// ConfigureIdentity stores the identity configuration read by the admin console. The
+// admin console serves the identity service and authenticates users against the
+// configured providers.
+func ConfigureIdentity(ctx context.Context, cli client.Client, namespace string, identity *ecv1beta1.Identity, adminConsoleURL string) error {
+	config, err := identityConfig(identity, adminConsoleURL)
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("unable to marshal identity config: %w", err)
+	}
+
+	secret := corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      identityConfigSecretName,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"kots.io/kotsadm":                        "true",
+				"replicated.com/disaster-recovery":       "infra",
+				"replicated.com/disaster-recovery-chart": "admin-console",
+			},
+		},
+		Data: map[string][]byte{identityConfigSecretKey: data},
+	}
+
+	err = kubeutils.Retry(ctx, kubeutils.DefaultRetryBackoff, func(ctx context.Context) error {
+		err := cli.Create(ctx, secret.DeepCopy())
+		if !k8serrors.IsAlreadyExists(err) {
+			return err
+		}
+		var existing corev1.Secret
+		if err := cli.Get(ctx, client.ObjectKeyFromObject(&secret), &existing); err != nil {
+			return fmt.Errorf("unable to get %s secret: %w", identityConfigSecretName, err)
+		}
+		existing.Data = secret.Data
+		return cli.Update(ctx, &existing)
+	})
+	if err != nil {
+		return fmt.Errorf("unable to write %s secret: %w", identityConfigSecretName, err)
+	}
+	return nil
+}
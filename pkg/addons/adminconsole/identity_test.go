@@ -0,0 +1,110 @@
+package adminconsole
+
+import (
+	"context"
+	"testing"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	kotsv1beta1 "github.com/replicatedhq/kotskinds/apis/kots/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+)
+
+func TestValidateIdentity(t *testing.T) {
+	oidc := ecv1beta1.IdentityProvider{
+		Type:   "oidc",
+		ID:     "okta",
+		Config: "issuer: https://example.okta.com\nclientID: abc\nclientSecret: def\n",
+	}
+	tests := []struct {
+		name     string
+		identity *ecv1beta1.Identity
+		wantErr  bool
+	}{
+		{
+			name: "no identity",
+		},
+		{
+			name:     "oidc provider",
+			identity: &ecv1beta1.Identity{DisablePasswordAuth: true, Providers: []ecv1beta1.IdentityProvider{oidc}},
+		},
+		{
+			name:     "password auth disabled without providers",
+			identity: &ecv1beta1.Identity{DisablePasswordAuth: true},
+			wantErr:  true,
+		},
+		{
+			name: "unsupported type",
+			identity: &ecv1beta1.Identity{Providers: []ecv1beta1.IdentityProvider{
+				{Type: "saml", ID: "saml", Config: "ssoURL: https://example.com"},
+			}},
+			wantErr: true,
+		},
+		{
+			name:     "duplicate ids",
+			identity: &ecv1beta1.Identity{Providers: []ecv1beta1.IdentityProvider{oidc, oidc}},
+			wantErr:  true,
+		},
+		{
+			name: "empty config",
+			identity: &ecv1beta1.Identity{Providers: []ecv1beta1.IdentityProvider{
+				{Type: "ldap", ID: "ldap"},
+			}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateIdentity(tt.identity)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestConfigureIdentity(t *testing.T) {
+	identity := &ecv1beta1.Identity{
+		DisablePasswordAuth: true,
+		Providers: []ecv1beta1.IdentityProvider{
+			{
+				Type:   "ldap",
+				ID:     "corp",
+				Name:   "Corporate LDAP",
+				Config: "host: ldap.example.com:636\nbindDN: cn=admin\n",
+			},
+		},
+		Groups: []ecv1beta1.IdentityGroup{{ID: "admins", RoleIDs: []string{"cluster-admin"}}},
+	}
+
+	cli := fake.NewClientBuilder().Build()
+	for i := 0; i < 2; i++ {
+		err := ConfigureIdentity(context.Background(), cli, "kotsadm", identity, "https://admin.example.com:30000")
+		require.NoError(t, err)
+	}
+
+	var secret corev1.Secret
+	require.NoError(t, cli.Get(context.Background(), types.NamespacedName{Namespace: "kotsadm", Name: "kotsadm-identity-config"}, &secret))
+	assert.Equal(t, "infra", secret.Labels["replicated.com/disaster-recovery"])
+
+	var config kotsv1beta1.IdentityConfig
+	require.NoError(t, yaml.Unmarshal(secret.Data["identity.yaml"], &config))
+	assert.Equal(t, "IdentityConfig", config.Kind)
+	assert.True(t, config.Spec.Enabled)
+	assert.True(t, config.Spec.DisablePasswordAuth)
+	assert.Equal(t, "https://admin.example.com:30000", config.Spec.AdminConsoleAddress)
+	assert.Equal(t, "https://admin.example.com:30000/dex", config.Spec.IdentityServiceAddress)
+	assert.Equal(t, []kotsv1beta1.IdentityConfigGroup{{ID: "admins", RoleIDs: []string{"cluster-admin"}}}, config.Spec.Groups)
+	require.Len(t, config.Spec.DexConnectors.Value, 1)
+	connector := config.Spec.DexConnectors.Value[0]
+	assert.Equal(t, "ldap", connector.Type)
+	assert.Equal(t, "corp", connector.ID)
+	assert.Equal(t, "Corporate LDAP", connector.Name)
+	assert.JSONEq(t, `{"host":"ldap.example.com:636","bindDN":"cn=admin"}`, string(connector.Config.Raw))
+}
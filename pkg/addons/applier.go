@@ -13,18 +13,26 @@ import (
 	kotsv1beta1 "github.com/replicatedhq/kotskinds/apis/kots/v1beta1"
 	"github.com/replicatedhq/troubleshoot/pkg/apis/troubleshoot/v1beta2"
 	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/replicatedhq/embedded-cluster/pkg/addons/adminconsole"
 	"github.com/replicatedhq/embedded-cluster/pkg/addons/embeddedclusteroperator"
 	"github.com/replicatedhq/embedded-cluster/pkg/addons/openebs"
 	"github.com/replicatedhq/embedded-cluster/pkg/addons/registry"
+	"github.com/replicatedhq/embedded-cluster/pkg/addons/replicatedsdk"
 	"github.com/replicatedhq/embedded-cluster/pkg/addons/seaweedfs"
 	"github.com/replicatedhq/embedded-cluster/pkg/addons/velero"
+	"github.com/replicatedhq/embedded-cluster/pkg/airgap"
 	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	ecerrors "github.com/replicatedhq/embedded-cluster/pkg/errors"
 	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
 	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/placement"
+	"github.com/replicatedhq/embedded-cluster/pkg/pullsecrets"
+	"github.com/replicatedhq/embedded-cluster/pkg/release"
 	"github.com/replicatedhq/embedded-cluster/pkg/spinner"
+	"github.com/replicatedhq/embedded-cluster/pkg/storageplan"
 )
 
 // AddOn is the interface that all addons must implement.
@@ -41,17 +49,31 @@ type AddOn interface {
 
 // Applier is an entity that applies (installs and updates) addons in the cluster.
 type Applier struct {
-	prompt                  bool
-	verbose                 bool
-	adminConsolePwd         string // admin console password
-	licenseFile             string
-	onlyDefaults            bool
-	endUserConfig           *ecv1beta1.Config
-	airgapBundle            string
-	proxyEnv                map[string]string
-	privateCAs              map[string]string
-	adminConsolePort        int
-	localArtifactMirrorPort int
+	prompt                       bool
+	verbose                      bool
+	adminConsolePwd              string // admin console password
+	licenseFile                  string
+	onlyDefaults                 bool
+	endUserConfig                *ecv1beta1.Config
+	airgapBundle                 string
+	airgapRegistry               *airgap.Registry
+	proxyEnv                     map[string]string
+	privateCAs                   map[string]string
+	adminConsolePort             int
+	localArtifactMirrorPort      int
+	localArtifactMirrorDiskQuota string
+	storage                      *ecv1beta1.StorageSpec
+	fips                         bool
+	hardening                    string
+	excludedHostCollectors       []string
+	overriddenPreflightWarnings  []string
+	registryMirrors              []ecv1beta1.RegistryMirror
+	imagePullSecrets             []pullsecrets.Credential
+	adminConsoleTLSCert          []byte
+	adminConsoleTLSKey           []byte
+	adminConsoleHostname         string
+	adminConsoleAuthMode         string
+	reconcile                    bool
 }
 
 // Outro runs the outro in all enabled add-ons.
@@ -73,15 +95,37 @@ func (a *Applier) Outro(ctx context.Context, k0sCfg *k0sv1beta1.ClusterConfig, e
 		}
 	}()
 
+	if err := a.checkNodePlacement(ctx, kcli, endUserCfg); err != nil {
+		return err
+	}
 	for _, addon := range addons {
 		if err := addon.Outro(ctx, kcli, k0sCfg, releaseMetadata); err != nil {
 			return err
 		}
 	}
+	identity, err := AdminConsoleIdentity(endUserCfg)
+	if err != nil {
+		return err
+	}
+	authMode := a.GetAdminConsoleAuthMode()
+	if identity != nil && authMode != ecv1beta1.AdminConsoleAuthModeDisabled {
+		if authMode == ecv1beta1.AdminConsoleAuthModeIdentityProvider {
+			identity = identity.DeepCopy()
+			identity.DisablePasswordAuth = true
+		}
+		url := adminConsoleURL(networkInterface, a.GetAdminConsolePort(), a.adminConsoleHostname)
+		if err := adminconsole.ConfigureIdentity(ctx, kcli, defaults.KotsadmNamespace, identity, url); err != nil {
+			return fmt.Errorf("unable to configure admin console identity: %w", err)
+		}
+	}
 	if err := spinForInstallation(ctx, kcli); err != nil {
 		return err
 	}
-	if err := printKotsadmLinkMessage(a.licenseFile, networkInterface, a.GetAdminConsolePort()); err != nil {
+	if authMode == ecv1beta1.AdminConsoleAuthModeDisabled {
+		logrus.Info("The Admin Console UI is disabled, the application is managed through the command line.")
+		return nil
+	}
+	if err := printKotsadmLinkMessage(a.licenseFile, networkInterface, a.GetAdminConsolePort(), a.adminConsoleHostname); err != nil {
 		return fmt.Errorf("unable to print success message: %w", err)
 	}
 	return nil
@@ -123,6 +167,15 @@ func (a *Applier) GenerateHelmConfigs(k0sCfg *k0sv1beta1.ClusterConfig, addition
 		charts = append(charts, addonChartConfig...)
 		repositories = append(repositories, addonRepositoryConfig...)
 	}
+	if err := a.rewriteChartImages(charts); err != nil {
+		return nil, nil, err
+	}
+	if err := a.placeCharts(charts); err != nil {
+		return nil, nil, err
+	}
+	if err := a.planChartStorage(charts); err != nil {
+		return nil, nil, err
+	}
 
 	// charts required by the application
 	charts = append(charts, additionalCharts...)
@@ -131,6 +184,94 @@ func (a *Applier) GenerateHelmConfigs(k0sCfg *k0sv1beta1.ClusterConfig, addition
 	return charts, repositories, nil
 }
 
+// rewriteChartImages points the images of the embedded charts to the airgap registry, if
+// one was provided. The images were pushed there from the airgap bundle.
+func (a *Applier) rewriteChartImages(charts []ecv1beta1.Chart) error {
+	if a.airgapRegistry == nil {
+		return nil
+	}
+	for i, chart := range charts {
+		values, err := airgap.RewriteChartValues(chart.Values, a.airgapRegistry.Address)
+		if err != nil {
+			return fmt.Errorf("unable to rewrite images for %s: %w", chart.Name, err)
+		}
+		charts[i].Values = values
+	}
+	return nil
+}
+
+// placeCharts pins the admin console and the registry charts to the nodes selected in the
+// embedded cluster config or in the end user config.
+func (a *Applier) placeCharts(charts []ecv1beta1.Chart) error {
+	p, err := NodePlacement(a.endUserConfig)
+	if err != nil {
+		return err
+	}
+	for i, chart := range charts {
+		values, err := placement.ChartValues(chart.Name, chart.Values, p)
+		if err != nil {
+			return fmt.Errorf("unable to set placement for %s: %w", chart.Name, err)
+		}
+		charts[i].Values = values
+	}
+	return nil
+}
+
+// planChartStorage places the persistent volumes in the data directory chosen at install
+// time and sizes the volume of the embedded registry.
+func (a *Applier) planChartStorage(charts []ecv1beta1.Chart) error {
+	for i, chart := range charts {
+		values, err := storageplan.ChartValues(chart.Name, chart.Values, a.storage)
+		if err != nil {
+			return fmt.Errorf("unable to plan storage for %s: %w", chart.Name, err)
+		}
+		charts[i].Values = values
+	}
+	return nil
+}
+
+// checkNodePlacement verifies a node of the cluster can run the admin console and, when
+// the embedded registry is deployed, the registry. Otherwise the installation would wait
+// for pods that can't be scheduled.
+func (a *Applier) checkNodePlacement(ctx context.Context, kcli client.Client, endUserCfg *ecv1beta1.Config) error {
+	p, err := NodePlacement(endUserCfg)
+	if err != nil || p == nil {
+		return err
+	}
+	var nodes corev1.NodeList
+	if err := kubeutils.Retry(ctx, kubeutils.DefaultRetryBackoff, func(ctx context.Context) error {
+		return kcli.List(ctx, &nodes)
+	}); err != nil {
+		return fmt.Errorf("unable to list nodes: %w", err)
+	}
+	components := map[string]*ecv1beta1.NodePlacement{"admin console": p.AdminConsole}
+	if a.airgapBundle != "" && a.airgapRegistry == nil {
+		components["registry"] = p.Registry
+	}
+	for component, np := range components {
+		matched := false
+		for _, node := range nodes.Items {
+			if placement.Matches(np, node) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return ecerrors.Errorf(ecerrors.Addon, "no node matches the %s placement", component)
+		}
+	}
+	return nil
+}
+
+// airgapRegistryAddress returns the address of the airgap registry, empty if the images
+// are hosted in the embedded registry.
+func (a *Applier) airgapRegistryAddress() string {
+	if a.airgapRegistry == nil {
+		return ""
+	}
+	return a.airgapRegistry.Address
+}
+
 // GenerateHelmConfigsForRestore generates the helm config for the embedded charts required for a restore operation.
 func (a *Applier) GenerateHelmConfigsForRestore(k0sCfg *k0sv1beta1.ClusterConfig) ([]ecv1beta1.Chart, []ecv1beta1.Repository, error) {
 	charts := []ecv1beta1.Chart{}
@@ -259,6 +400,15 @@ func (a *Applier) GetAdminConsolePort() int {
 	return a.adminConsolePort
 }
 
+// GetAdminConsoleAuthMode returns how users authenticate to the admin console,
+// defaulting to password.
+func (a *Applier) GetAdminConsoleAuthMode() string {
+	if a.adminConsoleAuthMode == "" {
+		return ecv1beta1.AdminConsoleAuthModePassword
+	}
+	return a.adminConsoleAuthMode
+}
+
 func (a *Applier) GetLocalArtifactMirrorPort() int {
 	if a.localArtifactMirrorPort <= 0 {
 		return defaults.LocalArtifactMirrorPort
@@ -266,6 +416,20 @@ func (a *Applier) GetLocalArtifactMirrorPort() int {
 	return a.localArtifactMirrorPort
 }
 
+// GetStorage returns where the persistent volumes are stored and the space reserved for
+// them, nil when the defaults apply.
+func (a *Applier) GetStorage() *ecv1beta1.StorageSpec {
+	return a.storage
+}
+
+// GetLocalArtifactMirror returns the configuration of the local artifact mirror.
+func (a *Applier) GetLocalArtifactMirror() ecv1beta1.LocalArtifactMirrorSpec {
+	return ecv1beta1.LocalArtifactMirrorSpec{
+		Port:      a.GetLocalArtifactMirrorPort(),
+		DiskQuota: a.localArtifactMirrorDiskQuota,
+	}
+}
+
 func (a *Applier) hostPreflights(addons []AddOn) (*v1beta2.HostPreflightSpec, error) {
 	allpf := &v1beta2.HostPreflightSpec{}
 	for _, addon := range addons {
@@ -290,7 +454,8 @@ func (a *Applier) load() ([]AddOn, error) {
 	}
 	addons = append(addons, obs)
 
-	reg, err := registry.New(defaults.RegistryNamespace, a.airgapBundle != "", false)
+	// the embedded registry is not needed when the images are hosted in an existing one.
+	reg, err := registry.New(defaults.RegistryNamespace, a.airgapBundle != "" && a.airgapRegistry == nil, false)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create registry addon: %w", err)
 	}
@@ -300,10 +465,19 @@ func (a *Applier) load() ([]AddOn, error) {
 		a.endUserConfig,
 		a.licenseFile,
 		a.airgapBundle != "",
+		a.airgapRegistryAddress(),
+		a.fips,
+		a.hardening,
+		a.excludedHostCollectors,
+		a.overriddenPreflightWarnings,
+		a.registryMirrors,
+		a.imagePullSecrets,
 		a.proxyEnv,
 		a.privateCAs,
 		a.GetAdminConsolePort(),
-		a.GetLocalArtifactMirrorPort(),
+		a.GetAdminConsoleAuthMode(),
+		a.GetLocalArtifactMirror(),
+		a.storage,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create embedded cluster operator addon: %w", err)
@@ -320,14 +494,26 @@ func (a *Applier) load() ([]AddOn, error) {
 	}
 	addons = append(addons, vel)
 
+	sdk, err := a.replicatedSDK()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create replicated sdk addon: %w", err)
+	}
+	addons = append(addons, sdk)
+
 	aconsole, err := adminconsole.New(
 		defaults.KotsadmNamespace,
 		a.adminConsolePwd,
 		a.licenseFile,
 		a.airgapBundle,
+		a.airgapRegistry,
 		a.proxyEnv,
 		a.privateCAs,
 		a.GetAdminConsolePort(),
+		a.adminConsoleTLSCert,
+		a.adminConsoleTLSKey,
+		a.adminConsoleHostname,
+		a.GetAdminConsoleAuthMode(),
+		a.reconcile,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create admin console addon: %w", err)
@@ -364,9 +550,35 @@ func (a *Applier) loadBuiltIn() (map[string]AddOn, error) {
 	}
 	addons["seaweedfs"] = seaweed
 
+	sdk, err := replicatedsdk.New(defaults.KotsadmNamespace, true, "", false, false)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create replicated sdk addon: %w", err)
+	}
+	addons["replicated-sdk"] = sdk
+
 	return addons, nil
 }
 
+// replicatedSDK returns the Replicated SDK addon. The addon is only enabled if the
+// vendor has enabled it in the embedded cluster config.
+func (a *Applier) replicatedSDK() (*replicatedsdk.ReplicatedSDK, error) {
+	cfg, err := release.GetEmbeddedClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get embedded cluster config: %w", err)
+	}
+	var sdkcfg ecv1beta1.ReplicatedSDK
+	if cfg != nil && cfg.Spec.ReplicatedSDK != nil {
+		sdkcfg = *cfg.Spec.ReplicatedSDK
+	}
+	return replicatedsdk.New(
+		defaults.KotsadmNamespace,
+		sdkcfg.Enabled,
+		a.licenseFile,
+		a.airgapBundle != "",
+		sdkcfg.ExposeLicenseFields,
+	)
+}
+
 // loadForRestore instantiates and returns addon appliers for restore operations.
 func (a *Applier) loadForRestore() ([]AddOn, error) {
 	addons := []AddOn{}
@@ -422,8 +634,64 @@ func spinForInstallation(ctx context.Context, cli client.Client) error {
 	return nil
 }
 
+// AdminConsoleIdentity returns the identity configuration of the Admin Console. The
+// configuration provided by the end user takes precedence over the one provided in the
+// embedded cluster config. Returns nil if none has been provided.
+func AdminConsoleIdentity(endUserCfg *ecv1beta1.Config) (*ecv1beta1.Identity, error) {
+	var identity *ecv1beta1.Identity
+	cfg, err := release.GetEmbeddedClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get embedded cluster config: %w", err)
+	}
+	if cfg != nil && cfg.Spec.Identity != nil {
+		identity = cfg.Spec.Identity
+	}
+	if endUserCfg != nil && endUserCfg.Spec.Identity != nil {
+		identity = endUserCfg.Spec.Identity
+	}
+	if err := adminconsole.ValidateIdentity(identity); err != nil {
+		return nil, fmt.Errorf("invalid admin console identity config: %w", err)
+	}
+	return identity, nil
+}
+
+// NodePlacement returns the placement of the admin console and the registry. The
+// placement of each component provided by the end user takes precedence over the one
+// provided in the embedded cluster config. Returns nil if none has been provided.
+func NodePlacement(endUserCfg *ecv1beta1.Config) (*ecv1beta1.Placement, error) {
+	cfg, err := release.GetEmbeddedClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get embedded cluster config: %w", err)
+	}
+	var sources []*ecv1beta1.Placement
+	if cfg != nil {
+		sources = append(sources, cfg.Spec.Placement)
+	}
+	if endUserCfg != nil {
+		sources = append(sources, endUserCfg.Spec.Placement)
+	}
+	p := placement.Merge(sources...)
+	if err := placement.Validate(p); err != nil {
+		return nil, fmt.Errorf("invalid node placement config: %w", err)
+	}
+	return p, nil
+}
+
+// AdminConsoleURL returns the URL users access the admin console with.
+func (a *Applier) AdminConsoleURL(networkInterface string) string {
+	return adminConsoleURL(networkInterface, a.GetAdminConsolePort(), a.adminConsoleHostname)
+}
+
+// adminConsoleURL returns the URL users access the admin console with.
+func adminConsoleURL(networkInterface string, adminConsolePort int, hostname string) string {
+	if hostname != "" {
+		return adminconsole.GetHostnameURL(hostname, adminConsolePort)
+	}
+	return adminconsole.GetURL(networkInterface, adminConsolePort)
+}
+
 // printKotsadmLinkMessage prints the success message when the admin console is online.
-func printKotsadmLinkMessage(licenseFile string, networkInterface string, adminConsolePort int) error {
+func printKotsadmLinkMessage(licenseFile string, networkInterface string, adminConsolePort int, hostname string) error {
 	var err error
 	license := &kotsv1beta1.License{}
 	if licenseFile != "" {
@@ -433,7 +701,7 @@ func printKotsadmLinkMessage(licenseFile string, networkInterface string, adminC
 		}
 	}
 
-	adminConsoleURL := adminconsole.GetURL(networkInterface, adminConsolePort)
+	adminConsoleURL := adminConsoleURL(networkInterface, adminConsolePort, hostname)
 
 	successColor := "\033[32m"
 	colorReset := "\033[0m"
@@ -0,0 +1,228 @@
+package addons
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+)
+
+const (
+	helmReleaseNameAnnotation      = "meta.helm.sh/release-name"
+	helmReleaseNamespaceAnnotation = "meta.helm.sh/release-namespace"
+)
+
+// Conflict is an object left in the cluster by a previous partial install or by other
+// tooling that would make an add-on fail to install.
+type Conflict struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Reason    string
+	// object is removed by CleanupConflicts, it is nil when the conflict can not be
+	// cleaned up automatically.
+	object client.Object
+}
+
+// Cleanable returns whether the conflict is resolved by CleanupConflicts.
+func (c Conflict) Cleanable() bool {
+	return c.object != nil
+}
+
+func (c Conflict) String() string {
+	name := c.Name
+	if c.Namespace != "" {
+		name = fmt.Sprintf("%s/%s", c.Namespace, c.Name)
+	}
+	return fmt.Sprintf("%s %s: %s", c.Kind, name, c.Reason)
+}
+
+// outroObjects are created by the add-ons outros, the creation fails if they already exist.
+func outroObjects() []client.Object {
+	return []client.Object{
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "kotsadm-password", Namespace: defaults.KotsadmNamespace}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "kotsadm-private-cas", Namespace: defaults.KotsadmNamespace}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: ecv1beta1.RegistryMirrorsSecretName, Namespace: "embedded-cluster"}},
+	}
+}
+
+// ScanConflicts looks for objects created before since that would make the installation of
+// the charts fail: namespaces being deleted, helm releases left in a state other than
+// deployed, cluster wide objects owned by a release of the same name in another namespace
+// and objects the add-ons outros create. Objects created after since belong to the
+// installation in progress and are ignored.
+func ScanConflicts(ctx context.Context, kcli client.Client, charts []k0sv1beta1.Chart, since time.Time) ([]Conflict, error) {
+	stale := func(obj client.Object) bool {
+		return obj.GetCreationTimestamp().Time.Before(since)
+	}
+
+	var conflicts []Conflict
+	releases := map[string]string{}
+	for _, chart := range charts {
+		releases[chart.Name] = chart.TargetNS
+
+		var ns corev1.Namespace
+		if err := kcli.Get(ctx, client.ObjectKey{Name: chart.TargetNS}, &ns); err == nil {
+			if ns.DeletionTimestamp != nil {
+				conflicts = append(conflicts, Conflict{
+					Kind:   "Namespace",
+					Name:   ns.Name,
+					Reason: "namespace is being deleted, wait for the deletion to finish",
+				})
+				continue
+			}
+		} else if !k8serrors.IsNotFound(err) {
+			return nil, fmt.Errorf("unable to get namespace %s: %w", chart.TargetNS, err)
+		}
+
+		found, err := staleReleaseSecrets(ctx, kcli, chart, stale)
+		if err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, found...)
+	}
+
+	found, err := foreignReleaseObjects(ctx, kcli, releases, stale)
+	if err != nil {
+		return nil, err
+	}
+	conflicts = append(conflicts, found...)
+
+	for _, obj := range outroObjects() {
+		if err := kcli.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+			if k8serrors.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("unable to get %s: %w", obj.GetName(), err)
+		}
+		if !stale(obj) {
+			continue
+		}
+		kind := "Secret"
+		if _, ok := obj.(*corev1.ConfigMap); ok {
+			kind = "ConfigMap"
+		}
+		conflicts = append(conflicts, Conflict{
+			Kind:      kind,
+			Namespace: obj.GetNamespace(),
+			Name:      obj.GetName(),
+			Reason:    "left by a previous install",
+			object:    obj,
+		})
+	}
+	return conflicts, nil
+}
+
+// staleReleaseSecrets returns the helm release secrets of a release that never reached the
+// deployed state, helm refuses to install over them.
+func staleReleaseSecrets(ctx context.Context, kcli client.Client, chart k0sv1beta1.Chart, stale func(client.Object) bool) ([]Conflict, error) {
+	var secrets corev1.SecretList
+	if err := kcli.List(
+		ctx, &secrets,
+		client.InNamespace(chart.TargetNS),
+		client.MatchingLabels{"owner": "helm", "name": chart.Name},
+	); err != nil {
+		return nil, fmt.Errorf("unable to list release %s secrets: %w", chart.Name, err)
+	}
+	for _, secret := range secrets.Items {
+		if status := secret.Labels["status"]; status == "deployed" || status == "superseded" {
+			// the release has been installed, helm upgrades it.
+			return nil, nil
+		}
+	}
+	var conflicts []Conflict
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if !stale(secret) {
+			continue
+		}
+		status := secret.Labels["status"]
+		conflicts = append(conflicts, Conflict{
+			Kind:      "Secret",
+			Namespace: secret.Namespace,
+			Name:      secret.Name,
+			Reason:    fmt.Sprintf("release %s left in %s state by a previous install", chart.Name, status),
+			object:    secret,
+		})
+	}
+	return conflicts, nil
+}
+
+// foreignReleaseObjects returns the cluster wide objects owned by a release named after one
+// of the charts but installed in another namespace, helm refuses to adopt them.
+func foreignReleaseObjects(ctx context.Context, kcli client.Client, releases map[string]string, stale func(client.Object) bool) ([]Conflict, error) {
+	var objects []client.Object
+	var crds apiextensionsv1.CustomResourceDefinitionList
+	if err := kcli.List(ctx, &crds); err != nil {
+		return nil, fmt.Errorf("unable to list custom resource definitions: %w", err)
+	}
+	for i := range crds.Items {
+		objects = append(objects, &crds.Items[i])
+	}
+	var roles rbacv1.ClusterRoleList
+	if err := kcli.List(ctx, &roles); err != nil {
+		return nil, fmt.Errorf("unable to list cluster roles: %w", err)
+	}
+	for i := range roles.Items {
+		objects = append(objects, &roles.Items[i])
+	}
+	var bindings rbacv1.ClusterRoleBindingList
+	if err := kcli.List(ctx, &bindings); err != nil {
+		return nil, fmt.Errorf("unable to list cluster role bindings: %w", err)
+	}
+	for i := range bindings.Items {
+		objects = append(objects, &bindings.Items[i])
+	}
+
+	var conflicts []Conflict
+	for _, obj := range objects {
+		release := obj.GetAnnotations()[helmReleaseNameAnnotation]
+		namespace, ok := releases[release]
+		if !ok || !stale(obj) {
+			continue
+		}
+		owner := obj.GetAnnotations()[helmReleaseNamespaceAnnotation]
+		if owner == namespace {
+			continue
+		}
+		kind := "ClusterRoleBinding"
+		switch obj.(type) {
+		case *apiextensionsv1.CustomResourceDefinition:
+			kind = "CustomResourceDefinition"
+		case *rbacv1.ClusterRole:
+			kind = "ClusterRole"
+		}
+		conflicts = append(conflicts, Conflict{
+			Kind:   kind,
+			Name:   obj.GetName(),
+			Reason: fmt.Sprintf("owned by release %s in namespace %q instead of %q", release, owner, namespace),
+			object: obj,
+		})
+	}
+	return conflicts, nil
+}
+
+// CleanupConflicts removes the objects behind the conflicts so the add-ons can be installed.
+// The helm releases are retried by the cluster once the objects are gone.
+func CleanupConflicts(ctx context.Context, kcli client.Client, conflicts []Conflict) error {
+	for _, conflict := range conflicts {
+		if !conflict.Cleanable() {
+			return fmt.Errorf("unable to clean up %s", conflict)
+		}
+		err := kcli.Delete(ctx, conflict.object, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return fmt.Errorf("unable to delete %s %s: %w", conflict.Kind, conflict.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package addons
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+)
+
+func TestScanConflicts(t *testing.T) {
+	since := time.Now()
+	old := metav1.NewTime(since.Add(-time.Hour))
+	recent := metav1.NewTime(since.Add(time.Minute))
+
+	releaseSecret := func(name, namespace, release, status string, created metav1.Time) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         namespace,
+			CreationTimestamp: created,
+			Labels:            map[string]string{"owner": "helm", "name": release, "status": status},
+		}}
+	}
+	owned := func(release, namespace string, created metav1.Time) metav1.ObjectMeta {
+		return metav1.ObjectMeta{
+			CreationTimestamp: created,
+			Annotations: map[string]string{
+				helmReleaseNameAnnotation:      release,
+				helmReleaseNamespaceAnnotation: namespace,
+			},
+		}
+	}
+	crd := &apiextensionsv1.CustomResourceDefinition{ObjectMeta: owned("velero", "default", old)}
+	crd.Name = "backups.velero.io"
+	adopted := &apiextensionsv1.CustomResourceDefinition{ObjectMeta: owned("velero", "velero", old)}
+	adopted.Name = "restores.velero.io"
+	role := &rbacv1.ClusterRole{ObjectMeta: owned("seaweedfs", "other", old)}
+	role.Name = "seaweedfs"
+	binding := &rbacv1.ClusterRoleBinding{ObjectMeta: owned("seaweedfs", "other", recent)}
+	binding.Name = "seaweedfs"
+
+	kcli := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:              "openebs",
+			DeletionTimestamp: &old,
+			Finalizers:        []string{"kubernetes"},
+		}},
+		releaseSecret("sh.helm.release.v1.velero.v1", "velero", "velero", "pending-install", old),
+		releaseSecret("sh.helm.release.v1.registry.v1", "registry", "registry", "failed", old),
+		releaseSecret("sh.helm.release.v1.registry.v2", "registry", "registry", "deployed", old),
+		releaseSecret("sh.helm.release.v1.seaweedfs.v1", "seaweedfs", "seaweedfs", "pending-install", recent),
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:              "kotsadm-password",
+			Namespace:         defaults.KotsadmNamespace,
+			CreationTimestamp: old,
+		}},
+		crd, adopted, role, binding,
+	).Build()
+
+	charts := []k0sv1beta1.Chart{
+		{Name: "openebs", TargetNS: "openebs"},
+		{Name: "velero", TargetNS: "velero"},
+		{Name: "registry", TargetNS: "registry"},
+		{Name: "seaweedfs", TargetNS: "seaweedfs"},
+	}
+	conflicts, err := ScanConflicts(context.Background(), kcli, charts, since)
+	require.NoError(t, err)
+
+	var found []string
+	for _, conflict := range conflicts {
+		found = append(found, conflict.String())
+	}
+	assert.ElementsMatch(t, []string{
+		"Namespace openebs: namespace is being deleted, wait for the deletion to finish",
+		"Secret velero/sh.helm.release.v1.velero.v1: release velero left in pending-install state by a previous install",
+		`CustomResourceDefinition backups.velero.io: owned by release velero in namespace "default" instead of "velero"`,
+		`ClusterRole seaweedfs: owned by release seaweedfs in namespace "other" instead of "seaweedfs"`,
+		"Secret kotsadm/kotsadm-password: left by a previous install",
+	}, found)
+
+	var cleanable []Conflict
+	for _, conflict := range conflicts {
+		if conflict.Cleanable() {
+			cleanable = append(cleanable, conflict)
+		}
+	}
+	assert.Len(t, cleanable, 4)
+	assert.Error(t, CleanupConflicts(context.Background(), kcli, conflicts))
+	require.NoError(t, CleanupConflicts(context.Background(), kcli, cleanable))
+
+	err = kcli.Get(context.Background(), client.ObjectKeyFromObject(crd), &apiextensionsv1.CustomResourceDefinition{})
+	assert.True(t, k8serrors.IsNotFound(err))
+	err = kcli.Get(context.Background(), client.ObjectKeyFromObject(adopted), &apiextensionsv1.CustomResourceDefinition{})
+	assert.NoError(t, err)
+
+	conflicts, err = ScanConflicts(context.Background(), kcli, charts[1:], since)
+	require.NoError(t, err)
+	assert.Empty(t, conflicts)
+}
@@ -6,7 +6,9 @@ import (
 	"context"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"runtime"
 	"strings"
 	"time"
 
@@ -16,9 +18,11 @@ import (
 	"github.com/replicatedhq/embedded-cluster/kinds/types"
 	"github.com/replicatedhq/embedded-cluster/pkg/addons/adminconsole"
 	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/encryption"
 	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
 	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
 	"github.com/replicatedhq/embedded-cluster/pkg/metrics"
+	"github.com/replicatedhq/embedded-cluster/pkg/pullsecrets"
 	"github.com/replicatedhq/embedded-cluster/pkg/release"
 	"github.com/replicatedhq/embedded-cluster/pkg/spinner"
 	"github.com/replicatedhq/embedded-cluster/pkg/versions"
@@ -63,15 +67,24 @@ func init() {
 // EmbeddedClusterOperator manages the installation of the embedded cluster operator
 // helm chart.
 type EmbeddedClusterOperator struct {
-	namespace               string
-	deployName              string
-	endUserConfig           *ecv1beta1.Config
-	licenseFile             string
-	airgap                  bool
-	proxyEnv                map[string]string
-	privateCAs              map[string]string
-	adminConsolePort        int
-	localArtifactMirrorPort int
+	namespace              string
+	deployName             string
+	endUserConfig          *ecv1beta1.Config
+	licenseFile            string
+	airgap                 bool
+	airgapRegistry         string
+	fips                   bool
+	hardening              string
+	excludedHostCollectors []string
+	overriddenWarnings     []string
+	registryMirrors        []ecv1beta1.RegistryMirror
+	imagePullSecrets       []pullsecrets.Credential
+	proxyEnv               map[string]string
+	privateCAs             map[string]string
+	adminConsolePort       int
+	adminConsoleAuthMode   string
+	localArtifactMirror    ecv1beta1.LocalArtifactMirrorSpec
+	storage                *ecv1beta1.StorageSpec
 }
 
 // Version returns the version of the embedded cluster operator chart.
@@ -171,7 +184,7 @@ func (e *EmbeddedClusterOperator) createVersionMetadataConfigmap(ctx context.Con
 		},
 	}
 
-	if err := client.Create(ctx, configmap); err != nil {
+	if err := kubeutils.CreateOrUpdateWithRetry(ctx, client, configmap); err != nil {
 		return fmt.Errorf("unable to create version metadata config map: %w", err)
 	}
 	return nil
@@ -193,12 +206,60 @@ func createCAConfigmap(ctx context.Context, cli client.Client, namespace string,
 		},
 		Data: cas,
 	}
-	if err := cli.Create(ctx, &kotsCAConfigmap); err != nil {
+	if err := kubeutils.CreateOrUpdateWithRetry(ctx, cli, &kotsCAConfigmap); err != nil {
 		return fmt.Errorf("unable to create private-cas configmap: %w", err)
 	}
 	return nil
 }
 
+// createImagePullSecrets stores the registry credentials provided by the end user, the
+// operator copies them to the namespaces they target.
+func createImagePullSecrets(ctx context.Context, cli client.Client, namespace string, creds []pullsecrets.Credential) error {
+	for _, cred := range creds {
+		secret, err := pullsecrets.SourceSecret(cred, namespace)
+		if err != nil {
+			return err
+		}
+		secret.Labels = map[string]string{
+			"replicated.com/disaster-recovery":       "infra",
+			"replicated.com/disaster-recovery-chart": "embedded-cluster-operator",
+		}
+		if err := kubeutils.CreateOrUpdateWithRetry(ctx, cli, secret); err != nil {
+			return fmt.Errorf("unable to create %s secret: %w", cred.Name, err)
+		}
+	}
+	return nil
+}
+
+// createRegistryMirrorsSecret stores the passwords of the registry mirror endpoints in the
+// secret the installation references them from. Nothing is created without passwords.
+func createRegistryMirrorsSecret(ctx context.Context, cli client.Client, namespace string, passwords map[string][]byte) error {
+	if len(passwords) == 0 {
+		return nil
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ecv1beta1.RegistryMirrorsSecretName,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"replicated.com/disaster-recovery":       "infra",
+				"replicated.com/disaster-recovery-chart": "embedded-cluster-operator",
+			},
+		},
+		Data: passwords,
+	}
+	return kubeutils.CreateOrUpdateWithRetry(ctx, cli, secret)
+}
+
+// imagePullSecretSpecs returns the installation spec of the registry credentials.
+func imagePullSecretSpecs(creds []pullsecrets.Credential) []ecv1beta1.ImagePullSecret {
+	var specs []ecv1beta1.ImagePullSecret
+	for _, cred := range creds {
+		specs = append(specs, pullsecrets.Spec(cred))
+	}
+	return specs
+}
+
 // Outro is executed after the cluster deployment. Waits for the embedded cluster operator
 // to finish its deployment, creates the version metadata configmap (if in airgap) and
 // the installation object.
@@ -214,6 +275,16 @@ func (e *EmbeddedClusterOperator) Outro(ctx context.Context, cli client.Client,
 		return fmt.Errorf("unable to create CA configmap: %w", err)
 	}
 
+	if err := createImagePullSecrets(ctx, cli, e.namespace, e.imagePullSecrets); err != nil {
+		return fmt.Errorf("unable to create image pull secrets: %w", err)
+	}
+
+	if encryption.Enabled(k0sCfg) {
+		if err := encryption.StoreConfig(ctx, cli, e.namespace); err != nil {
+			return fmt.Errorf("unable to store encryption config: %w", err)
+		}
+	}
+
 	if err := kubeutils.WaitForDeployment(ctx, cli, e.namespace, e.deployName); err != nil {
 		loading.Close()
 		return err
@@ -233,8 +304,12 @@ func (e *EmbeddedClusterOperator) Outro(ctx context.Context, cli client.Client,
 		cfgspec = &cfg.Spec
 	}
 	var euOverrides string
+	var euHostBackup *ecv1beta1.HostBackup
+	var euPlacement *ecv1beta1.Placement
 	if e.endUserConfig != nil {
 		euOverrides = e.endUserConfig.Spec.UnsupportedOverrides.K0s
+		euHostBackup = e.endUserConfig.Spec.HostBackup
+		euPlacement = e.endUserConfig.Spec.Placement
 	}
 	var license *kotsv1beta1.License
 	if e.licenseFile != "" {
@@ -263,26 +338,50 @@ func (e *EmbeddedClusterOperator) Outro(ctx context.Context, cli client.Client,
 			},
 		},
 		Spec: ecv1beta1.InstallationSpec{
-			ClusterID:      metrics.ClusterID().String(),
-			MetricsBaseURL: metrics.BaseURL(license),
-			AirGap:         e.airgap,
-			Proxy:          proxySpec,
-			Network:        k0sConfigToNetworkSpec(k0sCfg),
+			ClusterID:              metrics.ClusterID().String(),
+			MetricsBaseURL:         metrics.BaseURL(license),
+			AirGap:                 e.airgap,
+			AirgapRegistry:         e.airgapRegistry,
+			FIPS:                   e.fips,
+			Hardening:              e.hardening,
+			ExcludedHostCollectors: e.excludedHostCollectors,
+			EncryptionAtRest:       encryption.Enabled(k0sCfg),
+			Proxy:                  proxySpec,
+			Network:                k0sConfigToNetworkSpec(k0sCfg),
 			AdminConsole: &ecv1beta1.AdminConsoleSpec{
-				Port: e.adminConsolePort,
+				Port:     e.adminConsolePort,
+				AuthMode: e.adminConsoleAuthMode,
 			},
-			LocalArtifactMirror: &ecv1beta1.LocalArtifactMirrorSpec{
-				Port: e.localArtifactMirrorPort,
-			},
-			Config:                    cfgspec,
-			EndUserK0sConfigOverrides: euOverrides,
-			BinaryName:                defaults.BinaryName(),
+			LocalArtifactMirror:         &e.localArtifactMirror,
+			Storage:                     e.storage,
+			RegistryMirrors:             e.registryMirrors,
+			ImagePullSecrets:            imagePullSecretSpecs(e.imagePullSecrets),
+			OverriddenPreflightWarnings: e.overriddenWarnings,
+			Config:                      cfgspec,
+			EndUserK0sConfigOverrides:   euOverrides,
+			EndUserHostBackup:           euHostBackup,
+			EndUserPlacement:            euPlacement,
+			BinaryName:                  defaults.BinaryName(),
+			Architecture:                runtime.GOARCH,
 			LicenseInfo: &ecv1beta1.LicenseInfo{
 				IsDisasterRecoverySupported: licenseDisasterRecoverySupported(license),
 			},
 		},
 	}
-	if err := cli.Create(ctx, &installation); err != nil {
+	// the installation of a previous run is kept, the operator has been reconciling it
+	// since and creating another would start an upgrade.
+	if _, err := kubeutils.GetLatestInstallation(ctx, cli); err == nil {
+		return nil
+	} else if !errors.Is(err, kubeutils.ErrNoInstallations{}) {
+		return fmt.Errorf("unable to get latest installation: %w", err)
+	}
+	// anyone allowed to read installations could read the mirror passwords, they are kept
+	// in a secret and the installation only references them.
+	passwords := installation.Spec.ExtractRegistryMirrorPasswords()
+	if err := createRegistryMirrorsSecret(ctx, cli, e.namespace, passwords); err != nil {
+		return fmt.Errorf("unable to create registry mirrors secret: %w", err)
+	}
+	if err := kubeutils.CreateWithRetry(ctx, cli, &installation); err != nil {
 		return fmt.Errorf("unable to create installation: %w", err)
 	}
 	return nil
@@ -293,21 +392,39 @@ func New(
 	endUserConfig *ecv1beta1.Config,
 	licenseFile string,
 	airgapEnabled bool,
+	airgapRegistry string,
+	fipsEnabled bool,
+	hardening string,
+	excludedHostCollectors []string,
+	overriddenWarnings []string,
+	registryMirrors []ecv1beta1.RegistryMirror,
+	imagePullSecrets []pullsecrets.Credential,
 	proxyEnv map[string]string,
 	privateCAs map[string]string,
 	adminConsolePort int,
-	localArtifactMirrorPort int,
+	adminConsoleAuthMode string,
+	localArtifactMirror ecv1beta1.LocalArtifactMirrorSpec,
+	storage *ecv1beta1.StorageSpec,
 ) (*EmbeddedClusterOperator, error) {
 	return &EmbeddedClusterOperator{
-		namespace:               "embedded-cluster",
-		deployName:              "embedded-cluster-operator",
-		endUserConfig:           endUserConfig,
-		licenseFile:             licenseFile,
-		airgap:                  airgapEnabled,
-		proxyEnv:                proxyEnv,
-		privateCAs:              privateCAs,
-		adminConsolePort:        adminConsolePort,
-		localArtifactMirrorPort: localArtifactMirrorPort,
+		namespace:              "embedded-cluster",
+		deployName:             "embedded-cluster-operator",
+		endUserConfig:          endUserConfig,
+		licenseFile:            licenseFile,
+		airgap:                 airgapEnabled,
+		airgapRegistry:         airgapRegistry,
+		fips:                   fipsEnabled,
+		hardening:              hardening,
+		excludedHostCollectors: excludedHostCollectors,
+		overriddenWarnings:     overriddenWarnings,
+		registryMirrors:        registryMirrors,
+		imagePullSecrets:       imagePullSecrets,
+		proxyEnv:               proxyEnv,
+		privateCAs:             privateCAs,
+		adminConsolePort:       adminConsolePort,
+		adminConsoleAuthMode:   adminConsoleAuthMode,
+		localArtifactMirror:    localArtifactMirror,
+		storage:                storage,
 	}, nil
 }
 
@@ -2,6 +2,8 @@ package addons
 
 import (
 	embeddedclusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/airgap"
+	"github.com/replicatedhq/embedded-cluster/pkg/pullsecrets"
 )
 
 // Option sets and option on an Applier reference.
@@ -35,6 +37,20 @@ func WithLocalArtifactMirrorPort(port int) Option {
 	}
 }
 
+// WithLocalArtifactMirrorDiskQuota sets the disk quota of the local artifact mirror.
+func WithLocalArtifactMirrorDiskQuota(quota string) Option {
+	return func(a *Applier) {
+		a.localArtifactMirrorDiskQuota = quota
+	}
+}
+
+// WithStorage sets where the persistent volumes are stored and the space reserved for them.
+func WithStorage(storage *embeddedclusterv1beta1.StorageSpec) Option {
+	return func(a *Applier) {
+		a.storage = storage
+	}
+}
+
 // Quiet disables logging for addons.
 func Quiet() Option {
 	return func(a *Applier) {
@@ -91,3 +107,81 @@ func WithAdminConsolePassword(password string) Option {
 		a.adminConsolePwd = password
 	}
 }
+
+// WithFIPS flags the installation as running in FIPS mode.
+func WithFIPS() Option {
+	return func(a *Applier) {
+		a.fips = true
+	}
+}
+
+// WithHardening sets the hardening profile applied to the installation.
+func WithHardening(profile string) Option {
+	return func(a *Applier) {
+		a.hardening = profile
+	}
+}
+
+// WithAdminConsoleTLS sets the certificate and key, valid for the provided hostname, the
+// admin console is served with.
+func WithAdminConsoleTLS(cert, key []byte, hostname string) Option {
+	return func(a *Applier) {
+		a.adminConsoleTLSCert = cert
+		a.adminConsoleTLSKey = key
+		a.adminConsoleHostname = hostname
+	}
+}
+
+// WithAdminConsoleAuthMode sets how users authenticate to the admin console.
+func WithAdminConsoleAuthMode(mode string) Option {
+	return func(a *Applier) {
+		a.adminConsoleAuthMode = mode
+	}
+}
+
+// WithExcludedHostCollectors sets the host collectors excluded from host preflights
+// and support bundles.
+func WithExcludedHostCollectors(excluded []string) Option {
+	return func(a *Applier) {
+		a.excludedHostCollectors = excluded
+	}
+}
+
+// WithOverriddenPreflightWarnings sets the host preflight warnings the user chose to
+// proceed past, they are recorded in the installation.
+func WithOverriddenPreflightWarnings(warnings []string) Option {
+	return func(a *Applier) {
+		a.overriddenPreflightWarnings = warnings
+	}
+}
+
+// WithAirgapRegistry sets the existing registry the airgap images are pulled from, the
+// embedded registry is not installed.
+func WithAirgapRegistry(registry airgap.Registry) Option {
+	return func(a *Applier) {
+		a.airgapRegistry = &registry
+	}
+}
+
+// WithRegistryMirrors sets the registry mirrors containerd pulls images through.
+func WithRegistryMirrors(mirrors []embeddedclusterv1beta1.RegistryMirror) Option {
+	return func(a *Applier) {
+		a.registryMirrors = mirrors
+	}
+}
+
+// WithImagePullSecrets sets the registry credentials the operator copies to the
+// namespaces of the application.
+func WithImagePullSecrets(creds []pullsecrets.Credential) Option {
+	return func(a *Applier) {
+		a.imagePullSecrets = creds
+	}
+}
+
+// WithReconcile makes the add-ons converge the installation of a previous run, the work
+// that run completed is not done again.
+func WithReconcile() Option {
+	return func(a *Applier) {
+		a.reconcile = true
+	}
+}
@@ -210,7 +210,7 @@ func (o *Registry) generateRegistryMigrationRole(ctx context.Context, cli client
 			},
 		},
 	}
-	err := cli.Create(ctx, &newRole)
+	err := kubeutils.CreateOrUpdateWithRetry(ctx, cli, &newRole)
 	if err != nil {
 		return fmt.Errorf("unable to create registry-data-migration-role: %w", err)
 	}
@@ -225,7 +225,7 @@ func (o *Registry) generateRegistryMigrationRole(ctx context.Context, cli client
 			APIVersion: "v1",
 		},
 	}
-	err = cli.Create(ctx, &newServiceAccount)
+	err = kubeutils.CreateOrUpdateWithRetry(ctx, cli, &newServiceAccount)
 	if err != nil {
 		return fmt.Errorf("unable to create registry-data-migration-serviceaccount: %w", err)
 	}
@@ -253,7 +253,7 @@ func (o *Registry) generateRegistryMigrationRole(ctx context.Context, cli client
 		},
 	}
 
-	err = cli.Create(ctx, &newRoleBinding)
+	err = kubeutils.CreateOrUpdateWithRetry(ctx, cli, &newRoleBinding)
 	if err != nil {
 		return fmt.Errorf("unable to create registry-data-migration-rolebinding: %w", err)
 	}
@@ -303,7 +303,7 @@ func (o *Registry) Outro(ctx context.Context, cli client.Client, k0sCfg *k0sv1be
 		},
 		Type: "Opaque",
 	}
-	err = cli.Create(ctx, &htpasswd)
+	err = kubeutils.CreateOrUpdateWithRetry(ctx, cli, &htpasswd)
 	if err != nil {
 		loading.CloseWithError()
 		return fmt.Errorf("unable to create registry-auth secret: %w", err)
@@ -337,7 +337,7 @@ func (o *Registry) Outro(ctx context.Context, cli client.Client, k0sCfg *k0sv1be
 		StringData: map[string]string{"tls.crt": tlsCert, "tls.key": tlsKey},
 		Type:       "Opaque",
 	}
-	if err := cli.Create(ctx, tlsSecret); err != nil {
+	if err := kubeutils.CreateOrUpdateWithRetry(ctx, cli, tlsSecret); err != nil {
 		loading.CloseWithError()
 		return fmt.Errorf("unable to create %s secret: %w", tlsSecretName, err)
 	}
@@ -0,0 +1,202 @@
+package replicatedsdk
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"os"
+
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	kotsv1beta1 "github.com/replicatedhq/kotskinds/apis/kots/v1beta1"
+	"github.com/replicatedhq/troubleshoot/pkg/apis/troubleshoot/v1beta2"
+	"gopkg.in/yaml.v2"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/kinds/types"
+	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+	"github.com/replicatedhq/embedded-cluster/pkg/kubeutils"
+	"github.com/replicatedhq/embedded-cluster/pkg/release"
+	"github.com/replicatedhq/embedded-cluster/pkg/spinner"
+)
+
+const releaseName = "replicated"
+
+var (
+	//go:embed static/values.tpl.yaml
+	rawvalues []byte
+	// helmValues is the unmarshal version of rawvalues.
+	helmValues map[string]interface{}
+	//go:embed static/metadata.yaml
+	rawmetadata []byte
+	// Metadata is the unmarshal version of rawmetadata.
+	Metadata release.AddonMetadata
+)
+
+func init() {
+	if err := yaml.Unmarshal(rawmetadata, &Metadata); err != nil {
+		panic(fmt.Sprintf("unable to unmarshal metadata: %v", err))
+	}
+	hv, err := release.RenderHelmValues(rawvalues, Metadata)
+	if err != nil {
+		panic(fmt.Sprintf("unable to unmarshal values: %v", err))
+	}
+	helmValues = hv
+}
+
+// ReplicatedSDK manages the installation of the Replicated SDK helm chart.
+type ReplicatedSDK struct {
+	namespace           string
+	isEnabled           bool
+	licenseFile         string
+	airgap              bool
+	exposeLicenseFields bool
+}
+
+// Version returns the version of the Replicated SDK chart.
+func (r *ReplicatedSDK) Version() (map[string]string, error) {
+	if !r.isEnabled {
+		return nil, nil
+	}
+	return map[string]string{"ReplicatedSDK": "v" + Metadata.Version}, nil
+}
+
+func (r *ReplicatedSDK) Name() string {
+	return "ReplicatedSDK"
+}
+
+// HostPreflights returns the host preflight objects found inside the Replicated
+// SDK Helm Chart, this is empty as there is no host preflight on there.
+func (r *ReplicatedSDK) HostPreflights() (*v1beta2.HostPreflightSpec, error) {
+	return nil, nil
+}
+
+// GetProtectedFields returns the protected fields for the embedded charts. These
+// are set from the license and the installation and can't be overridden.
+func (r *ReplicatedSDK) GetProtectedFields() map[string][]string {
+	protectedFields := []string{"isAirgap", "license", "licenseFields"}
+	return map[string][]string{releaseName: protectedFields}
+}
+
+// GenerateHelmConfig generates the helm config for the Replicated SDK chart.
+func (r *ReplicatedSDK) GenerateHelmConfig(k0sCfg *k0sv1beta1.ClusterConfig, onlyDefaults bool) ([]ecv1beta1.Chart, []ecv1beta1.Repository, error) {
+	if !r.isEnabled {
+		return nil, nil, nil
+	}
+
+	chartConfig := ecv1beta1.Chart{
+		Name:         releaseName,
+		ChartName:    Metadata.Location,
+		Version:      Metadata.Version,
+		TargetNS:     r.namespace,
+		ForceUpgrade: ptr.To(false),
+		Order:        5,
+	}
+
+	values := map[string]interface{}{}
+	for k, v := range helmValues {
+		values[k] = v
+	}
+
+	if !onlyDefaults {
+		values["isAirgap"] = r.airgap
+		if err := r.setLicenseValues(values); err != nil {
+			return nil, nil, fmt.Errorf("unable to set license values: %w", err)
+		}
+	}
+
+	valuesStringData, err := yaml.Marshal(values)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to marshal helm values: %w", err)
+	}
+	chartConfig.Values = string(valuesStringData)
+
+	return []ecv1beta1.Chart{chartConfig}, nil, nil
+}
+
+// setLicenseValues reads the license file and sets the license related values.
+// License fields are only included if the vendor opted into exposing them.
+func (r *ReplicatedSDK) setLicenseValues(values map[string]interface{}) error {
+	if r.licenseFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(r.licenseFile)
+	if err != nil {
+		return fmt.Errorf("unable to read license file: %w", err)
+	}
+	license, err := helpers.ParseLicense(r.licenseFile)
+	if err != nil {
+		return fmt.Errorf("unable to parse license: %w", err)
+	}
+
+	values["license"] = string(data)
+	values["appName"] = license.Spec.AppSlug
+	values["channelID"] = license.Spec.ChannelID
+	values["channelName"] = license.Spec.ChannelName
+	if license.Spec.Endpoint != "" {
+		values["replicatedAppEndpoint"] = license.Spec.Endpoint
+	}
+	if r.exposeLicenseFields {
+		values["licenseFields"] = LicenseFields(license)
+	}
+	return nil
+}
+
+// LicenseFields returns the license entitlements in the format expected by the
+// Replicated SDK. Hidden entitlements are not exposed.
+func LicenseFields(license *kotsv1beta1.License) map[string]interface{} {
+	fields := map[string]interface{}{}
+	for name, entitlement := range license.Spec.Entitlements {
+		if entitlement.IsHidden {
+			continue
+		}
+		fields[name] = map[string]interface{}{
+			"name":        name,
+			"title":       entitlement.Title,
+			"description": entitlement.Description,
+			"value":       entitlement.Value.Value(),
+			"valueType":   entitlement.ValueType,
+		}
+	}
+	return fields
+}
+
+func (r *ReplicatedSDK) GetImages() []string {
+	var images []string
+	for _, image := range Metadata.Images {
+		images = append(images, image.String())
+	}
+	return images
+}
+
+func (r *ReplicatedSDK) GetAdditionalImages() []string {
+	return nil
+}
+
+// Outro is executed after the cluster deployment.
+func (r *ReplicatedSDK) Outro(ctx context.Context, cli client.Client, k0sCfg *k0sv1beta1.ClusterConfig, releaseMetadata *types.ReleaseMetadata) error {
+	if !r.isEnabled {
+		return nil
+	}
+
+	loading := spinner.Start()
+	loading.Infof("Waiting for the Replicated SDK to be ready")
+	if err := kubeutils.WaitForDeployment(ctx, cli, r.namespace, releaseName); err != nil {
+		loading.Close()
+		return fmt.Errorf("timed out waiting for the Replicated SDK to deploy: %v", err)
+	}
+	loading.Closef("Replicated SDK is ready!")
+	return nil
+}
+
+// New creates a new Replicated SDK addon.
+func New(namespace string, isEnabled bool, licenseFile string, airgap bool, exposeLicenseFields bool) (*ReplicatedSDK, error) {
+	return &ReplicatedSDK{
+		namespace:           namespace,
+		isEnabled:           isEnabled,
+		licenseFile:         licenseFile,
+		airgap:              airgap,
+		exposeLicenseFields: exposeLicenseFields,
+	}, nil
+}
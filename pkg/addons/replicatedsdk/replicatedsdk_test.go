@@ -0,0 +1,70 @@
+package replicatedsdk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+const license = `apiVersion: kots.io/v1beta1
+kind: License
+spec:
+  appSlug: my-app
+  channelID: channel-id
+  channelName: Stable
+  entitlements:
+    seats:
+      title: Seats
+      value: 10
+      valueType: Integer
+    secret:
+      title: Secret
+      value: hidden
+      valueType: String
+      isHidden: true
+`
+
+func TestGenerateHelmConfig(t *testing.T) {
+	licenseFile := filepath.Join(t.TempDir(), "license.yaml")
+	require.NoError(t, os.WriteFile(licenseFile, []byte(license), 0644))
+
+	sdk, err := New("kotsadm", false, licenseFile, true, true)
+	require.NoError(t, err)
+	charts, _, err := sdk.GenerateHelmConfig(nil, false)
+	require.NoError(t, err)
+	assert.Empty(t, charts)
+
+	sdk, err = New("kotsadm", true, licenseFile, true, false)
+	require.NoError(t, err)
+	charts, _, err = sdk.GenerateHelmConfig(nil, false)
+	require.NoError(t, err)
+	require.Len(t, charts, 1)
+	assert.Equal(t, Metadata.Version, charts[0].Version)
+
+	values := map[string]interface{}{}
+	require.NoError(t, yaml.Unmarshal([]byte(charts[0].Values), &values))
+	assert.Equal(t, true, values["isAirgap"])
+	assert.Equal(t, license, values["license"])
+	assert.Equal(t, "my-app", values["appName"])
+	assert.NotContains(t, values, "licenseFields")
+
+	sdk, err = New("kotsadm", true, licenseFile, false, true)
+	require.NoError(t, err)
+	charts, _, err = sdk.GenerateHelmConfig(nil, false)
+	require.NoError(t, err)
+	require.NoError(t, yaml.Unmarshal([]byte(charts[0].Values), &values))
+	fields, ok := values["licenseFields"].(map[interface{}]interface{})
+	require.True(t, ok)
+	assert.Contains(t, fields, "seats")
+	assert.NotContains(t, fields, "secret")
+
+	charts, _, err = sdk.GenerateHelmConfig(nil, true)
+	require.NoError(t, err)
+	values = map[string]interface{}{}
+	require.NoError(t, yaml.Unmarshal([]byte(charts[0].Values), &values))
+	assert.NotContains(t, values, "license")
+}
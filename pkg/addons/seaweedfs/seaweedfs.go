@@ -154,10 +154,7 @@ func WaitForReady(ctx context.Context, cli client.Client, ns string, writer *spi
 		}
 		return count == 3, nil
 	}); err != nil {
-		if lasterr == nil {
-			lasterr = err
-		}
-		return fmt.Errorf("error waiting for admin console: %v", lasterr)
+		return kubeutils.WaitError(ctx, "seaweedfs", err, lasterr)
 	}
 	return nil
 }
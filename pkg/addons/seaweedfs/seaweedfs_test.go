@@ -4,9 +4,19 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
 )
 
 func Test_init(t *testing.T) {
 	// init will panic if it fails to unmarshal the helm values
 	assert.True(t, true)
 }
+
+func TestEphemeralDiskAffinity(t *testing.T) {
+	// the data is kept off the nodes joined with an ephemeral disk.
+	for _, component := range []string{"master", "volume", "filer"} {
+		affinity, _ := helmValues[component].(map[string]interface{})["affinity"].(string)
+		assert.Contains(t, affinity, "- key: "+defaults.EphemeralDiskLabel+"\n", component)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/replicatedhq/troubleshoot/pkg/apis/troubleshoot/v1beta2"
 	"gopkg.in/yaml.v2"
 	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -154,7 +155,9 @@ func (o *Velero) Outro(ctx context.Context, cli client.Client, k0sCfg *k0sv1beta
 		},
 		Type: "Opaque",
 	}
-	if err := cli.Create(ctx, &credentialsSecret); err != nil {
+	// the credentials are configured later through the admin console, the secret of a
+	// previous run is kept as is.
+	if err := kubeutils.CreateWithRetry(ctx, cli, &credentialsSecret); err != nil && !k8serrors.IsAlreadyExists(err) {
 		loading.Close()
 		return fmt.Errorf("unable to create %s secret: %w", credentialsSecretName, err)
 	}
@@ -0,0 +1,92 @@
+package airgap
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/time/rate"
+)
+
+// copyChunkSize is the size of the reads of CopyBundle, and the largest burst of a rate
+// limited copy.
+const copyChunkSize = 1 << 20
+
+// CopyOptions configure CopyBundle.
+type CopyOptions struct {
+	// RateLimit is the maximum number of bytes read from the source per second, the copy
+	// is not throttled when it is zero.
+	RateLimit int64
+	// Progress is called after each chunk with the bytes copied so far and the size of
+	// the source.
+	Progress func(copied, total int64)
+}
+
+// CopyBundle copies the bundle at src to dst and returns the sha256 checksum of its
+// content. Bundles are read from removable or network storage shared with other
+// workloads, the copy is throttled to opts.RateLimit so it does not saturate the link.
+// The destination is written to a temporary file renamed once the copy completes.
+func CopyBundle(ctx context.Context, dst, src string, opts CopyOptions) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", fmt.Errorf("unable to open bundle: %w", err)
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return "", fmt.Errorf("unable to stat bundle: %w", err)
+	}
+
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return "", fmt.Errorf("unable to create %s: %w", tmp, err)
+	}
+	defer os.Remove(tmp)
+	defer out.Close()
+
+	chunk := int64(copyChunkSize)
+	var limiter *rate.Limiter
+	if opts.RateLimit > 0 {
+		chunk = min(chunk, opts.RateLimit)
+		limiter = rate.NewLimiter(rate.Limit(opts.RateLimit), int(chunk))
+	}
+
+	hash := sha256.New()
+	w := io.MultiWriter(out, hash)
+	buf := make([]byte, chunk)
+	var copied int64
+	for {
+		if limiter != nil {
+			if err := limiter.WaitN(ctx, len(buf)); err != nil {
+				return "", fmt.Errorf("unable to copy bundle: %w", err)
+			}
+		}
+		n, rerr := in.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return "", fmt.Errorf("unable to write %s: %w", tmp, err)
+			}
+			copied += int64(n)
+			if opts.Progress != nil {
+				opts.Progress(copied, info.Size())
+			}
+		}
+		if rerr == io.EOF {
+			break
+		} else if rerr != nil {
+			return "", fmt.Errorf("unable to read bundle: %w", rerr)
+		}
+	}
+
+	if err := out.Close(); err != nil {
+		return "", fmt.Errorf("unable to close %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return "", fmt.Errorf("unable to rename %s: %w", tmp, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
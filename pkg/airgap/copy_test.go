@@ -0,0 +1,62 @@
+package airgap
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyBundle(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "bundle.airgap")
+	content := make([]byte, 3*copyChunkSize/2)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	require.NoError(t, os.WriteFile(src, content, 0644))
+	sum := sha256.Sum256(content)
+
+	var calls []int64
+	dst := filepath.Join(dir, "copy.airgap")
+	checksum, err := CopyBundle(context.Background(), dst, src, CopyOptions{
+		Progress: func(copied, total int64) {
+			assert.Equal(t, int64(len(content)), total)
+			calls = append(calls, copied)
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(sum[:]), checksum)
+	assert.Equal(t, []int64{copyChunkSize, int64(len(content))}, calls)
+	data, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, content, data)
+	_, err = os.Stat(dst + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCopyBundleRateLimit(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "bundle.airgap")
+	require.NoError(t, os.WriteFile(src, make([]byte, 3000), 0644))
+
+	// the first second worth of bytes is the burst, the rest waits for the limiter.
+	start := time.Now()
+	_, err := CopyBundle(context.Background(), filepath.Join(dir, "copy.airgap"), src, CopyOptions{RateLimit: 2000})
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	dst := filepath.Join(dir, "cancelled.airgap")
+	_, err = CopyBundle(ctx, dst, src, CopyOptions{RateLimit: 2000})
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = os.Stat(dst)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,86 @@
+package airgap
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/distribution/reference"
+
+	embeddedclusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/helm"
+	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+)
+
+// SavedImages returns the list of images saved in the airgap bundle.
+func SavedImages(reader io.Reader) ([]string, error) {
+	airgapInfo, err := readAirgapYaml(reader)
+	if err != nil {
+		return nil, err
+	}
+	return airgapInfo.Spec.SavedImages, nil
+}
+
+// VendorChartImages renders the provided vendor charts and returns the images they
+// reference. Charts are read from the charts directory so this must be called after
+// the airgap bundle has been materialized.
+func VendorChartImages(charts []embeddedclusterv1beta1.Chart) ([]string, error) {
+	if len(charts) == 0 {
+		return nil, nil
+	}
+
+	hcli, err := helm.NewHelm(helm.HelmOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create helm client: %w", err)
+	}
+	defer hcli.Close()
+
+	var images []string
+	for _, chart := range charts {
+		values, err := helm.UnmarshalValues(chart.Values)
+		if err != nil {
+			return nil, fmt.Errorf("unable to unmarshal values for chart %s: %w", chart.Name, err)
+		}
+		path := chartHostPath(chart.Name, chart.Version)
+		chartImages, err := helm.ExtractImagesFromLocalChart(hcli, chart.Name, path, values)
+		if err != nil {
+			return nil, fmt.Errorf("unable to extract images from chart %s: %w", chart.Name, err)
+		}
+		images = append(images, chartImages...)
+	}
+	images = helpers.UniqueStringSlice(images)
+	sort.Strings(images)
+	return images, nil
+}
+
+// MissingImages returns the required images that are not present in the list of saved
+// images. Images hosted in the proxy registry are not considered missing as they are
+// rewritten during the installation.
+func MissingImages(required, saved []string, proxyRegistry string) []string {
+	available := map[string]bool{}
+	for _, image := range saved {
+		available[normalizeImage(image)] = true
+	}
+
+	var missing []string
+	for _, image := range required {
+		if proxyRegistry != "" && strings.HasPrefix(image, proxyRegistry+"/") {
+			continue
+		}
+		if !available[normalizeImage(image)] {
+			missing = append(missing, image)
+		}
+	}
+	return missing
+}
+
+// normalizeImage returns the fully qualified form of an image reference (registry and
+// tag included). References that can't be parsed are returned as is.
+func normalizeImage(image string) string {
+	ref, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return image
+	}
+	return reference.TagNameOnly(ref).String()
+}
@@ -0,0 +1,38 @@
+package airgap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSavedImages(t *testing.T) {
+	req := require.New(t)
+	airgapYaml := []byte(`apiVersion: kots.io/v1beta1
+kind: Airgap
+spec:
+  savedImages:
+    - nginx:1.25
+    - quay.io/org/app:v1
+`)
+	reader := createTarballFromDir(t.TempDir(), map[string][]byte{"airgap.yaml": airgapYaml})
+	images, err := SavedImages(reader)
+	req.NoError(err)
+	req.Equal([]string{"nginx:1.25", "quay.io/org/app:v1"}, images)
+}
+
+func TestMissingImages(t *testing.T) {
+	saved := []string{"nginx:1.25", "quay.io/org/app:v1", "docker.io/library/redis"}
+	required := []string{
+		"docker.io/library/nginx:1.25",
+		"redis:latest",
+		"quay.io/org/app:v2",
+		"proxy.replicated.com/proxy/app/quay.io/org/worker:v1",
+		"ghcr.io/org/sidecar:v1",
+	}
+	missing := MissingImages(required, saved, "proxy.replicated.com")
+	require.Equal(t, []string{"quay.io/org/app:v2", "ghcr.io/org/sidecar:v1"}, missing)
+
+	missing = MissingImages(required, saved, "")
+	require.Len(t, missing, 3)
+}
@@ -6,17 +6,28 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"strings"
 
 	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
 )
 
-const K0sImagePath = "/var/lib/k0s/images/images-amd64.tar"
+// K0sImagePath is where the image bundle of the host architecture is imported by k0s from.
+var K0sImagePath = filepath.Join("/var/lib/k0s/images", ImagesFileName(runtime.GOARCH))
+
+// ImagesFileName returns the name of the image bundle of the architecture.
+func ImagesFileName(arch string) string {
+	return fmt.Sprintf("images-%s.tar", arch)
+}
 
 // MaterializeAirgap places the airgap image bundle for k0s and the embedded cluster charts on disk.
-// - image bundle should be located at 'images-amd64.tar' within the embedded-cluster directory within the airgap bundle.
+// - image bundle should be located at 'images-<arch>.tar' within the embedded-cluster directory within the airgap bundle.
 // - charts should be located at 'charts.tar.gz' within the embedded-cluster directory within the airgap bundle.
-func MaterializeAirgap(airgapReader io.Reader) error {
+// Files are streamed out of the airgap bundle, nothing else is extracted. The image bundle is
+// skipped if withImages is false, when the images are pulled from a registry.
+func MaterializeAirgap(airgapReader io.Reader, withImages bool) error {
 	// decompress tarball
 	ungzip, err := gzip.NewReader(airgapReader)
 	if err != nil {
@@ -25,18 +36,25 @@ func MaterializeAirgap(airgapReader io.Reader) error {
 
 	// iterate through tarball
 	tarreader := tar.NewReader(ungzip)
-	foundCharts, foundImages := false, false
+	foundCharts, foundImages := false, !withImages
+	var otherArchs []string
 	var nextFile *tar.Header
 	for {
 		nextFile, err = tarreader.Next()
 		if err != nil {
-			if err == io.EOF {
+			if err == io.EOF && foundCharts {
+				return missingArchError(runtime.GOARCH, otherArchs)
+			} else if err == io.EOF {
 				return fmt.Errorf("embedded-cluster.tar.gz not found in airgap file")
 			}
 			return fmt.Errorf("failed to read airgap file: %w", err)
 		}
 
-		if nextFile.Name == "embedded-cluster/images-amd64.tar" {
+		if arch, ok := imagesArch(nextFile.Name); ok && arch != runtime.GOARCH {
+			otherArchs = append(otherArchs, arch)
+		}
+
+		if nextFile.Name == path.Join("embedded-cluster", ImagesFileName(runtime.GOARCH)) && withImages {
 			err = writeOneFile(tarreader, K0sImagePath, nextFile.Mode)
 			if err != nil {
 				return fmt.Errorf("failed to write k0s images file: %w", err)
@@ -58,6 +76,32 @@ func MaterializeAirgap(airgapReader io.Reader) error {
 	}
 }
 
+// imagesArch returns the architecture of the image bundle at the path of the airgap
+// bundle, false if the path is not an image bundle.
+func imagesArch(name string) (string, bool) {
+	dir, file := path.Split(name)
+	if dir != "embedded-cluster/" {
+		return "", false
+	}
+	arch, ok := strings.CutPrefix(file, "images-")
+	if !ok {
+		return "", false
+	}
+	arch, ok = strings.CutSuffix(arch, ".tar")
+	return arch, ok && arch != ""
+}
+
+// missingArchError tells the airgap bundle has no images for the architecture of the host.
+func missingArchError(arch string, otherArchs []string) error {
+	if len(otherArchs) == 0 {
+		return fmt.Errorf("airgap bundle does not include images for %s hosts", arch)
+	}
+	return fmt.Errorf(
+		"airgap bundle does not include images for %s hosts, it includes images for %s: download the airgap bundle for %s",
+		arch, strings.Join(otherArchs, ", "), arch,
+	)
+}
+
 func writeOneFile(reader io.Reader, path string, mode int64) error {
 	// setup destination
 	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
@@ -0,0 +1,28 @@
+package airgap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImagesArch(t *testing.T) {
+	for name, want := range map[string]string{
+		"embedded-cluster/images-amd64.tar": "amd64",
+		"embedded-cluster/images-arm64.tar": "arm64",
+		"embedded-cluster/charts.tar.gz":    "",
+		"images/images-arm64.tar":           "",
+	} {
+		arch, ok := imagesArch(name)
+		assert.Equal(t, want != "", ok, name)
+		assert.Equal(t, want, arch, name)
+	}
+}
+
+func TestMissingArchError(t *testing.T) {
+	assert.EqualError(t, missingArchError("arm64", nil), "airgap bundle does not include images for arm64 hosts")
+	assert.EqualError(t,
+		missingArchError("arm64", []string{"amd64"}),
+		"airgap bundle does not include images for arm64 hosts, it includes images for amd64: download the airgap bundle for arm64",
+	)
+}
@@ -0,0 +1,533 @@
+package airgap
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/distribution/reference"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// imageNameAnnotations hold the name of the images in an OCI layout, in order of preference.
+var imageNameAnnotations = []string{"io.containerd.image.name", "org.opencontainers.image.ref.name"}
+
+// ImagesOpener opens the image bundle, an uncompressed tar file, for reading from its start.
+type ImagesOpener func() (io.ReadCloser, error)
+
+// AirgapBundleImages returns an opener streaming the image bundle of the architecture out
+// of the airgap bundle, nothing is extracted on disk.
+func AirgapBundleImages(airgapBundle, arch string) ImagesOpener {
+	return func() (io.ReadCloser, error) {
+		f, err := os.Open(airgapBundle)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open airgap bundle: %w", err)
+		}
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("unable to decompress airgap bundle: %w", err)
+		}
+		tr := tar.NewReader(gz)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				f.Close()
+				return nil, fmt.Errorf("airgap bundle does not include images for %s hosts", arch)
+			} else if err != nil {
+				f.Close()
+				return nil, fmt.Errorf("unable to read airgap bundle: %w", err)
+			}
+			if hdr.Name == path.Join("embedded-cluster", ImagesFileName(arch)) {
+				return struct {
+					io.Reader
+					io.Closer
+				}{tr, f}, nil
+			}
+		}
+	}
+}
+
+// PushImages pushes the images of the image bundle to the registry, under the names
+// returned by RewriteImage. Bundles in the OCI layout are pushed as they are so the image
+// digests are kept, the images of docker archives are pushed with an OCI manifest built
+// from the layers of the archive. The bundle is read twice, as a stream, nothing is
+// extracted on disk: the first read collects the manifests and the checksum of the
+// blobs, the second one streams the blobs to the registry. The progress function is
+// called with the name of the image the next blobs are pushed for.
+func PushImages(ctx context.Context, images ImagesOpener, reg Registry, progress func(string)) error {
+	opts := []remote.Option{remote.WithContext(ctx)}
+	if reg.Username != "" {
+		opts = append(opts, remote.WithAuth(authn.FromConfig(authn.AuthConfig{
+			Username: reg.Username, Password: reg.Password,
+		})))
+	}
+
+	files, err := indexBundle(images)
+	if err != nil {
+		return fmt.Errorf("unable to read image bundle: %w", err)
+	}
+	plan := &pushPlan{files: files, blobs: map[string]*pushBlob{}}
+	if _, ok := files["index.json"]; ok {
+		err = plan.addLayout(reg.Address)
+	} else {
+		err = plan.addArchive(reg.Address)
+	}
+	if err != nil {
+		return err
+	}
+	if err := plan.pushBlobs(images, progress, opts); err != nil {
+		return err
+	}
+	for _, m := range plan.manifests {
+		if err := remote.Put(m.ref, rawManifest{raw: m.raw, mediaType: m.mediaType}, opts...); err != nil {
+			return fmt.Errorf("unable to push image %s: %w", m.image, err)
+		}
+	}
+	return nil
+}
+
+// maxManifestSize is the largest manifest, index or config file kept in memory, the size
+// registries accept manifests up to.
+const maxManifestSize = 4 << 20
+
+// bundleFile is a regular file of the image bundle.
+type bundleFile struct {
+	size    int64
+	digest  v1.Hash
+	gzipped bool
+	// data is the content of the json files, manifests, indexes and configs.
+	data []byte
+}
+
+// indexBundle reads the image bundle and returns its regular files by path. Only the
+// content of the json files is kept.
+func indexBundle(images ImagesOpener) (map[string]*bundleFile, error) {
+	rc, err := images()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	files := map[string]*bundleFile{}
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		f, err := readBundleFile(tr, hdr.Size)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %w", hdr.Name, err)
+		}
+		files[bundlePath(hdr.Name)] = f
+	}
+}
+
+// readBundleFile computes the checksum of the file, json files are kept in memory.
+func readBundleFile(r io.Reader, size int64) (*bundleFile, error) {
+	f := &bundleFile{size: size}
+	var head [2]byte
+	n, err := io.ReadFull(r, head[:])
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	f.gzipped = n == 2 && head[0] == 0x1f && head[1] == 0x8b
+	r = io.MultiReader(bytes.NewReader(head[:n]), r)
+	if n > 0 && (head[0] == '{' || head[0] == '[') && size <= maxManifestSize {
+		if f.data, err = io.ReadAll(r); err != nil {
+			return nil, err
+		}
+		f.digest, _, err = v1.SHA256(bytes.NewReader(f.data))
+		return f, err
+	}
+	f.digest, _, err = v1.SHA256(r)
+	return f, err
+}
+
+// bundlePath returns the clean path of a file of the image bundle.
+func bundlePath(name string) string {
+	return path.Clean("/" + name)[1:]
+}
+
+// blobPath returns the path of a blob in an OCI layout.
+func blobPath(h v1.Hash) string {
+	return path.Join("blobs", h.Algorithm, h.Hex)
+}
+
+// pushPlan holds the blobs and the manifests pushed to the registry.
+type pushPlan struct {
+	files map[string]*bundleFile
+	// blobs are the files pushed as blobs, by path, with the repositories they are
+	// pushed to.
+	blobs map[string]*pushBlob
+	// manifests are pushed in order once the blobs are, children before their index.
+	manifests []pushManifest
+}
+
+type pushBlob struct {
+	image string
+	desc  v1.Descriptor
+	repos map[string]name.Repository
+}
+
+type pushManifest struct {
+	image     string
+	ref       name.Reference
+	raw       []byte
+	mediaType types.MediaType
+}
+
+// addLayout plans the push of the named images and image indexes of an OCI layout.
+func (p *pushPlan) addLayout(address string) error {
+	index, err := p.json("index.json")
+	if err != nil {
+		return err
+	}
+	manifest, err := v1.ParseIndexManifest(bytes.NewReader(index))
+	if err != nil {
+		return fmt.Errorf("unable to read image index: %w", err)
+	}
+	for _, desc := range manifest.Manifests {
+		image := imageName(desc)
+		if image == "" {
+			continue
+		}
+		ref, err := pushReference(image, address)
+		if err != nil {
+			return err
+		}
+		if err := p.addLayoutManifest(image, ref, desc); err != nil {
+			return fmt.Errorf("unable to read image %s: %w", image, err)
+		}
+	}
+	return nil
+}
+
+// addLayoutManifest plans the push of a manifest of the layout, along with the manifests
+// and blobs it references.
+func (p *pushPlan) addLayoutManifest(image string, ref name.Reference, desc v1.Descriptor) error {
+	fpath := blobPath(desc.Digest)
+	if err := p.verify(fpath, desc.Digest); err != nil {
+		return err
+	}
+	raw, err := p.json(fpath)
+	if err != nil {
+		return err
+	}
+	switch {
+	case desc.MediaType.IsIndex():
+		index, err := v1.ParseIndexManifest(bytes.NewReader(raw))
+		if err != nil {
+			return fmt.Errorf("unable to parse index %s: %w", desc.Digest, err)
+		}
+		for _, child := range index.Manifests {
+			if err := p.addLayoutManifest(image, ref.Context().Digest(child.Digest.String()), child); err != nil {
+				return err
+			}
+		}
+	case desc.MediaType.IsImage():
+		manifest, err := v1.ParseManifest(bytes.NewReader(raw))
+		if err != nil {
+			return fmt.Errorf("unable to parse manifest %s: %w", desc.Digest, err)
+		}
+		for _, blob := range append([]v1.Descriptor{manifest.Config}, manifest.Layers...) {
+			fpath := blobPath(blob.Digest)
+			if err := p.verify(fpath, blob.Digest); err != nil {
+				return err
+			}
+			p.addBlob(fpath, image, blob, ref.Context())
+		}
+	default:
+		return fmt.Errorf("unexpected media type for %s: %s", desc.Digest, desc.MediaType)
+	}
+	p.manifests = append(p.manifests, pushManifest{image: image, ref: ref, raw: raw, mediaType: desc.MediaType})
+	return nil
+}
+
+// addArchive plans the push of the tagged images of a docker archive. The layers are
+// pushed as they are stored in the archive, compressed or not, so the manifests are
+// built rather than read.
+func (p *pushPlan) addArchive(address string) error {
+	data, err := p.json("manifest.json")
+	if err != nil {
+		return fmt.Errorf("image bundle is neither an OCI layout nor a docker archive: %w", err)
+	}
+	var archive tarball.Manifest
+	if err := json.Unmarshal(data, &archive); err != nil {
+		return fmt.Errorf("unable to read image bundle manifest: %w", err)
+	}
+	for _, desc := range archive {
+		blobs := map[string]v1.Descriptor{}
+		config, err := p.archiveDescriptor(desc.Config, types.OCIConfigJSON)
+		if err != nil {
+			return err
+		}
+		blobs[bundlePath(desc.Config)] = config
+		manifest := v1.Manifest{SchemaVersion: 2, MediaType: types.OCIManifestSchema1, Config: config}
+		for _, layer := range desc.Layers {
+			mediaType := types.OCIUncompressedLayer
+			if f, ok := p.files[bundlePath(layer)]; ok && f.gzipped {
+				mediaType = types.OCILayer
+			}
+			ldesc, err := p.archiveDescriptor(layer, mediaType)
+			if err != nil {
+				return err
+			}
+			blobs[bundlePath(layer)] = ldesc
+			manifest.Layers = append(manifest.Layers, ldesc)
+		}
+		raw, err := json.Marshal(manifest)
+		if err != nil {
+			return fmt.Errorf("unable to encode manifest: %w", err)
+		}
+		for _, image := range desc.RepoTags {
+			ref, err := pushReference(image, address)
+			if err != nil {
+				return err
+			}
+			for fpath, blob := range blobs {
+				p.addBlob(fpath, image, blob, ref.Context())
+			}
+			p.manifests = append(p.manifests, pushManifest{image: image, ref: ref, raw: raw, mediaType: manifest.MediaType})
+		}
+	}
+	return nil
+}
+
+// archiveDescriptor returns the descriptor of a file of a docker archive.
+func (p *pushPlan) archiveDescriptor(fpath string, mediaType types.MediaType) (v1.Descriptor, error) {
+	f, ok := p.files[bundlePath(fpath)]
+	if !ok {
+		return v1.Descriptor{}, fmt.Errorf("%s not found in image bundle", fpath)
+	}
+	return v1.Descriptor{MediaType: mediaType, Size: f.size, Digest: f.digest}, nil
+}
+
+// json returns the content of a json file of the bundle.
+func (p *pushPlan) json(fpath string) ([]byte, error) {
+	f, ok := p.files[fpath]
+	if !ok {
+		return nil, fmt.Errorf("%s not found in image bundle", fpath)
+	}
+	if f.data == nil {
+		return nil, fmt.Errorf("%s is not a json file of at most %d bytes", fpath, maxManifestSize)
+	}
+	return f.data, nil
+}
+
+// verify returns an error if the file of the layout does not match its digest.
+func (p *pushPlan) verify(fpath string, digest v1.Hash) error {
+	f, ok := p.files[fpath]
+	if !ok {
+		return fmt.Errorf("%s not found in image bundle", fpath)
+	}
+	if f.digest != digest {
+		return fmt.Errorf("%s checksum %s does not match its digest", fpath, f.digest)
+	}
+	return nil
+}
+
+func (p *pushPlan) addBlob(fpath, image string, desc v1.Descriptor, repo name.Repository) {
+	blob, ok := p.blobs[fpath]
+	if !ok {
+		blob = &pushBlob{image: image, desc: desc, repos: map[string]name.Repository{}}
+		p.blobs[fpath] = blob
+	}
+	blob.repos[repo.String()] = repo
+}
+
+// pushBlobs reads the image bundle again and streams each blob to the repositories of
+// the images using it.
+func (p *pushPlan) pushBlobs(images ImagesOpener, progress func(string), opts []remote.Option) error {
+	rc, err := images()
+	if err != nil {
+		return fmt.Errorf("unable to read image bundle: %w", err)
+	}
+	defer rc.Close()
+	remaining := make(map[string]*pushBlob, len(p.blobs))
+	for fpath, blob := range p.blobs {
+		remaining[fpath] = blob
+	}
+	var last string
+	tr := tar.NewReader(rc)
+	for len(remaining) > 0 {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("image bundle changed while pushing, %d blobs are missing", len(remaining))
+		} else if err != nil {
+			return fmt.Errorf("unable to read image bundle: %w", err)
+		}
+		blob, ok := remaining[bundlePath(hdr.Name)]
+		if !ok || hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		delete(remaining, bundlePath(hdr.Name))
+		if blob.image != last {
+			progress(blob.image)
+			last = blob.image
+		}
+		if err := pushBlobStream(tr, blob, opts); err != nil {
+			return fmt.Errorf("unable to push image %s: %w", blob.image, err)
+		}
+	}
+	return nil
+}
+
+// errBlobDone stops the copy of a blob to a repository that no longer reads it, the
+// push finished or the registry already has the blob.
+var errBlobDone = errors.New("blob push done")
+
+// pushBlobStream pushes the blob read from r to all its repositories at once.
+func pushBlobStream(r io.Reader, blob *pushBlob, opts []remote.Option) error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []error
+	out := &fanOut{}
+	for _, repo := range blob.repos {
+		pr, pw := io.Pipe()
+		out.writers = append(out.writers, pw)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := remote.WriteLayer(repo, &streamedBlob{desc: blob.desc, reader: pr}, opts...)
+			pr.CloseWithError(errBlobDone)
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", repo, err))
+				mu.Unlock()
+			}
+		}()
+	}
+	_, err := io.Copy(out, r)
+	for _, pw := range out.writers {
+		pw.CloseWithError(err)
+	}
+	wg.Wait()
+	if err != nil {
+		return fmt.Errorf("unable to read blob %s: %w", blob.desc.Digest, err)
+	}
+	return errors.Join(errs...)
+}
+
+// fanOut writes to all the writers, the ones failing are no longer written to.
+type fanOut struct {
+	writers []*io.PipeWriter
+	failed  map[int]bool
+}
+
+func (f *fanOut) Write(b []byte) (int, error) {
+	for i, w := range f.writers {
+		if f.failed[i] {
+			continue
+		}
+		if _, err := w.Write(b); err != nil {
+			if f.failed == nil {
+				f.failed = map[int]bool{}
+			}
+			f.failed[i] = true
+		}
+	}
+	return len(b), nil
+}
+
+// streamedBlob is a blob of the image bundle read once, as it is streamed to the registry.
+type streamedBlob struct {
+	desc   v1.Descriptor
+	mu     sync.Mutex
+	reader io.ReadCloser
+}
+
+var _ v1.Layer = (*streamedBlob)(nil)
+
+func (b *streamedBlob) Digest() (v1.Hash, error) {
+	return b.desc.Digest, nil
+}
+
+func (b *streamedBlob) DiffID() (v1.Hash, error) {
+	return v1.Hash{}, fmt.Errorf("diff id of blob %s is unknown", b.desc.Digest)
+}
+
+func (b *streamedBlob) Compressed() (io.ReadCloser, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.reader == nil {
+		return nil, fmt.Errorf("blob %s was already read from the image bundle", b.desc.Digest)
+	}
+	r := b.reader
+	b.reader = nil
+	return r, nil
+}
+
+func (b *streamedBlob) Uncompressed() (io.ReadCloser, error) {
+	return nil, fmt.Errorf("blob %s can only be read as it is stored", b.desc.Digest)
+}
+
+func (b *streamedBlob) Size() (int64, error) {
+	return b.desc.Size, nil
+}
+
+func (b *streamedBlob) MediaType() (types.MediaType, error) {
+	return b.desc.MediaType, nil
+}
+
+// rawManifest is a manifest pushed as it is.
+type rawManifest struct {
+	raw       []byte
+	mediaType types.MediaType
+}
+
+func (m rawManifest) RawManifest() ([]byte, error) {
+	return m.raw, nil
+}
+
+func (m rawManifest) MediaType() (types.MediaType, error) {
+	return m.mediaType, nil
+}
+
+// imageName returns the name of the image described in an OCI layout index. Names that
+// are only a tag are ignored as the repository is unknown.
+func imageName(desc v1.Descriptor) string {
+	for _, annotation := range imageNameAnnotations {
+		if image := desc.Annotations[annotation]; image != "" && strings.ContainsAny(image, "/:") {
+			return image
+		}
+	}
+	return ""
+}
+
+// pushReference returns the reference an image is pushed to: the rewritten image by tag,
+// or by digest if the image has no tag.
+func pushReference(image, address string) (name.Reference, error) {
+	named, err := reference.ParseNormalizedNamed(RewriteImage(image, address))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse image %s: %w", image, err)
+	}
+	target := named.String()
+	if tagged, ok := named.(reference.Tagged); ok {
+		target = reference.TrimNamed(named).String() + ":" + tagged.Tag()
+	}
+	ref, err := name.ParseReference(target)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse image %s: %w", target, err)
+	}
+	return ref, nil
+}
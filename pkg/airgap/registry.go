@@ -0,0 +1,193 @@
+package airgap
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/helm"
+)
+
+// Registry is an existing registry airgap installations push their images to and pull them
+// from instead of the embedded registry.
+type Registry struct {
+	// Address is the host of the registry, with an optional port, followed by an optional
+	// namespace the images are pushed under. e.g. harbor.example.com/embedded-cluster.
+	Address  string
+	Username string
+	Password string
+}
+
+// Host returns the host, and port, of the registry.
+func (r Registry) Host() string {
+	host, _, _ := strings.Cut(r.Address, "/")
+	return host
+}
+
+// Mirror returns the containerd configuration authenticating image pulls from the registry.
+// Nothing is returned if the registry does not require authentication. Like the passwords
+// of the other mirrors, the password is kept in the registry mirrors secret and not in the
+// installation.
+func (r Registry) Mirror() *ecv1beta1.RegistryMirror {
+	if r.Username == "" {
+		return nil
+	}
+	return &ecv1beta1.RegistryMirror{
+		Registry: r.Host(),
+		Endpoints: []ecv1beta1.RegistryMirrorEndpoint{
+			{URL: "https://" + r.Host(), Username: r.Username, Password: r.Password},
+		},
+	}
+}
+
+// ValidateRegistryAddress verifies the address is a registry host with an optional port
+// and namespace.
+func ValidateRegistryAddress(address string) error {
+	if address == "" {
+		return fmt.Errorf("registry address is empty")
+	}
+	if strings.Contains(address, "://") {
+		return fmt.Errorf("registry address %q must not have a scheme", address)
+	}
+	// a repository under the address must be a valid, fully qualified, image reference.
+	named, err := reference.ParseNamed(strings.TrimSuffix(address, "/") + "/image")
+	if err != nil {
+		return fmt.Errorf("invalid registry address %q: %w", address, err)
+	}
+	if host := reference.Domain(named); !strings.ContainsAny(host, ".:") && host != "localhost" {
+		return fmt.Errorf("registry address %q must start with a registry host", address)
+	}
+	return nil
+}
+
+// dockerConfig is the subset of a docker config.json holding registry credentials.
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth     string `json:"auth"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"auths"`
+}
+
+// ReadRegistryAuth reads the credentials of the registry host from a docker config.json
+// file. An error is returned if the file holds no credentials for the host.
+func ReadRegistryAuth(path, host string) (string, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to read registry auth file: %w", err)
+	}
+	var cfg dockerConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return "", "", fmt.Errorf("unable to parse registry auth file: %w", err)
+	}
+	for key, entry := range cfg.Auths {
+		key = strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+		if strings.TrimSuffix(key, "/") != host {
+			continue
+		}
+		if entry.Username != "" {
+			return entry.Username, entry.Password, nil
+		}
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			return "", "", fmt.Errorf("unable to decode %s auth: %w", host, err)
+		}
+		username, password, ok := strings.Cut(string(decoded), ":")
+		if !ok || username == "" {
+			return "", "", fmt.Errorf("%s auth is not in the username:password form", host)
+		}
+		return username, password, nil
+	}
+	return "", "", fmt.Errorf("registry auth file has no credentials for %s", host)
+}
+
+// RewriteImage moves the image under the registry address, the path of the image in its
+// original registry, its tag and its digest are kept. References that can't be parsed are
+// returned as is.
+func RewriteImage(image, address string) string {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return image
+	}
+	rewritten := strings.TrimSuffix(address, "/") + "/" + reference.Path(named)
+	if tagged, ok := named.(reference.Tagged); ok {
+		rewritten += ":" + tagged.Tag()
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		rewritten += "@" + digested.Digest().String()
+	}
+	return rewritten
+}
+
+// RewriteK0sImages points the images of the k0s components to the registry address. The
+// images are pulled as they are not imported under these names.
+func RewriteK0sImages(cfg *v1beta1.ClusterConfig, address string) {
+	if cfg.Spec.Images == nil {
+		cfg.Spec.Images = &v1beta1.ClusterImages{}
+	}
+	images := cfg.Spec.Images
+	for _, image := range []*v1beta1.ImageSpec{
+		&images.CoreDNS,
+		&images.Calico.Node,
+		&images.Calico.CNI,
+		&images.Calico.KubeControllers,
+		&images.MetricsServer,
+		&images.KubeProxy,
+		&images.Pause,
+	} {
+		if image.Image != "" {
+			image.Image = RewriteImage(image.Image, address)
+		}
+	}
+	images.DefaultPullPolicy = "IfNotPresent"
+}
+
+// RewriteChartValues points the images hosted in the proxy registry referenced by the
+// chart values to the registry address. Images are referenced either in full or split in
+// registry and repository values, both start with the proxy registry host.
+func RewriteChartValues(values, address string) (string, error) {
+	if values == "" {
+		return values, nil
+	}
+	parsed, err := helm.UnmarshalValues(values)
+	if err != nil {
+		return "", fmt.Errorf("unable to unmarshal values: %w", err)
+	}
+	prefix := defaults.ProxyRegistryAddress + "/"
+	target := strings.TrimSuffix(address, "/") + "/"
+	rewritten := rewriteStrings(parsed, func(s string) string {
+		if strings.HasPrefix(s, prefix) {
+			return target + strings.TrimPrefix(s, prefix)
+		}
+		return s
+	})
+	return helm.MarshalValues(rewritten.(map[string]interface{}))
+}
+
+// rewriteStrings applies the function to all the strings found in the value, recursively.
+func rewriteStrings(value interface{}, fn func(string) string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return fn(v)
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = rewriteStrings(item, fn)
+		}
+	case map[interface{}]interface{}:
+		for key, item := range v {
+			v[key] = rewriteStrings(item, fn)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = rewriteStrings(item, fn)
+		}
+	}
+	return value
+}
@@ -0,0 +1,334 @@
+package airgap
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+)
+
+func TestValidateRegistryAddress(t *testing.T) {
+	for _, address := range []string{"harbor.example.com", "harbor.example.com:8443/ec", "10.0.0.1:5000/team/ec", "localhost:5000"} {
+		assert.NoError(t, ValidateRegistryAddress(address), address)
+	}
+	for _, address := range []string{"", "https://harbor.example.com", "harbor", "harbor.example.com/UPPER"} {
+		assert.Error(t, ValidateRegistryAddress(address), address)
+	}
+}
+
+func TestReadRegistryAuth(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(path, []byte(`{"auths": {
+		"https://harbor.example.com": {"auth": "cm9ib3Q6c2VjcmV0"},
+		"registry.example.com:5000": {"username": "admin", "password": "pass"}
+	}}`), 0600)
+	require.NoError(t, err)
+
+	username, password, err := ReadRegistryAuth(path, "harbor.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "robot", username)
+	assert.Equal(t, "secret", password)
+
+	username, password, err = ReadRegistryAuth(path, "registry.example.com:5000")
+	require.NoError(t, err)
+	assert.Equal(t, "admin", username)
+	assert.Equal(t, "pass", password)
+
+	_, _, err = ReadRegistryAuth(path, "quay.io")
+	assert.ErrorContains(t, err, "no credentials for quay.io")
+}
+
+func TestRewriteImage(t *testing.T) {
+	for _, tt := range []struct {
+		image   string
+		address string
+		want    string
+	}{
+		{
+			image:   "proxy.replicated.com/anonymous/replicated/ec-calico-cni:3.28.2-r0-amd64@sha256:9e2e1aae3c963ae98715cba8e39a64eeff3271335652ff1504551fe27a4d6b99",
+			address: "harbor.example.com/ec",
+			want:    "harbor.example.com/ec/anonymous/replicated/ec-calico-cni:3.28.2-r0-amd64@sha256:9e2e1aae3c963ae98715cba8e39a64eeff3271335652ff1504551fe27a4d6b99",
+		},
+		{
+			image:   "nginx",
+			address: "10.0.0.1:5000/",
+			want:    "10.0.0.1:5000/library/nginx",
+		},
+		{
+			image:   "quay.io/org/app:1.0",
+			address: "harbor.example.com",
+			want:    "harbor.example.com/org/app:1.0",
+		},
+		{
+			image:   "Not An Image",
+			address: "harbor.example.com",
+			want:    "Not An Image",
+		},
+	} {
+		assert.Equal(t, tt.want, RewriteImage(tt.image, tt.address), tt.image)
+	}
+}
+
+func TestRewriteK0sImages(t *testing.T) {
+	cfg := &v1beta1.ClusterConfig{Spec: &v1beta1.ClusterSpec{Images: &v1beta1.ClusterImages{
+		CoreDNS: v1beta1.ImageSpec{Image: "proxy.replicated.com/anonymous/replicated/ec-coredns", Version: "1.11.3"},
+	}}}
+	RewriteK0sImages(cfg, "harbor.example.com")
+	assert.Equal(t, "harbor.example.com/anonymous/replicated/ec-coredns", cfg.Spec.Images.CoreDNS.Image)
+	assert.Equal(t, "1.11.3", cfg.Spec.Images.CoreDNS.Version)
+	assert.Equal(t, "", cfg.Spec.Images.KubeProxy.Image)
+	assert.Equal(t, "IfNotPresent", cfg.Spec.Images.DefaultPullPolicy)
+}
+
+func TestRewriteChartValues(t *testing.T) {
+	values := `image:
+  registry: proxy.replicated.com/anonymous/
+  repository: replicated/ec-openebs
+initContainers:
+- image: proxy.replicated.com/anonymous/replicated/ec-velero-plugin:1.0
+- image: docker.io/library/busybox
+`
+	got, err := RewriteChartValues(values, "harbor.example.com/ec")
+	require.NoError(t, err)
+	assert.Equal(t, `image:
+  registry: harbor.example.com/ec/anonymous/
+  repository: replicated/ec-openebs
+initContainers:
+- image: harbor.example.com/ec/anonymous/replicated/ec-velero-plugin:1.0
+- image: docker.io/library/busybox
+`, got)
+}
+
+func TestPushImages(t *testing.T) {
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://") + "/ec"
+	original := defaults.DefaultProvider
+	defaults.DefaultProvider = defaults.NewProvider(t.TempDir())
+	t.Cleanup(func() { defaults.DefaultProvider = original })
+
+	img, err := random.Image(256, 1)
+	require.NoError(t, err)
+	digest, err := img.Digest()
+	require.NoError(t, err)
+
+	t.Run("docker archive", func(t *testing.T) {
+		refs := map[name.Reference]v1.Image{}
+		for _, image := range []string{"proxy.replicated.com/anonymous/replicated/app:1.0", "proxy.replicated.com/anonymous/replicated/other:1.0"} {
+			tag, err := name.NewTag(image)
+			require.NoError(t, err)
+			refs[tag] = img
+		}
+		bundle := filepath.Join(t.TempDir(), "images.tar")
+		require.NoError(t, tarball.MultiRefWriteToFile(bundle, refs))
+
+		var pushed []string
+		err = PushImages(context.Background(), fileImages(bundle), Registry{Address: address}, func(image string) {
+			pushed = append(pushed, image)
+		})
+		require.NoError(t, err)
+		assert.NotEmpty(t, pushed)
+
+		// the layers shared by both images are streamed to both repositories.
+		wantLayers, err := img.Layers()
+		require.NoError(t, err)
+		for _, repo := range []string{"app", "other"} {
+			ref, err := name.ParseReference(address + "/anonymous/replicated/" + repo + ":1.0")
+			require.NoError(t, err)
+			got, err := remote.Image(ref)
+			require.NoError(t, err)
+			layers, err := got.Layers()
+			require.NoError(t, err)
+			require.Len(t, layers, len(wantLayers))
+			for i, layer := range layers {
+				want, err := wantLayers[i].DiffID()
+				require.NoError(t, err)
+				diffID, err := layer.DiffID()
+				require.NoError(t, err)
+				assert.Equal(t, want, diffID)
+			}
+		}
+	})
+
+	t.Run("airgap bundle", func(t *testing.T) {
+		dir := t.TempDir()
+		path, err := layout.Write(dir, empty.Index)
+		require.NoError(t, err)
+		image := "proxy.replicated.com/anonymous/replicated/streamed:4.0"
+		require.NoError(t, path.AppendImage(img, layout.WithAnnotations(map[string]string{
+			"io.containerd.image.name": image,
+		})))
+		images := filepath.Join(t.TempDir(), "images.tar")
+		require.NoError(t, tarDirectory(dir, images))
+		bundle := filepath.Join(t.TempDir(), "app.airgap")
+		require.NoError(t, writeAirgapBundle(bundle, map[string]string{
+			"airgap.yaml": "",
+			"embedded-cluster/images-" + runtime.GOARCH + ".tar": images,
+		}))
+
+		err = PushImages(context.Background(), AirgapBundleImages(bundle, "other"), Registry{Address: address}, func(string) {})
+		assert.EqualError(t, err, "unable to read image bundle: airgap bundle does not include images for other hosts")
+
+		err = PushImages(context.Background(), AirgapBundleImages(bundle, runtime.GOARCH), Registry{Address: address}, func(string) {})
+		require.NoError(t, err)
+		ref, err := name.ParseReference(RewriteImage(image, address))
+		require.NoError(t, err)
+		got, err := remote.Image(ref)
+		require.NoError(t, err)
+		gotDigest, err := got.Digest()
+		require.NoError(t, err)
+		assert.Equal(t, digest, gotDigest)
+	})
+
+	t.Run("oci layout keeps digests", func(t *testing.T) {
+		dir := t.TempDir()
+		path, err := layout.Write(dir, empty.Index)
+		require.NoError(t, err)
+		image := "proxy.replicated.com/anonymous/replicated/layout:2.0@" + digest.String()
+		require.NoError(t, path.AppendImage(img, layout.WithAnnotations(map[string]string{
+			"io.containerd.image.name": image,
+		})))
+		bundle := filepath.Join(t.TempDir(), "images.tar")
+		require.NoError(t, tarDirectory(dir, bundle))
+
+		err = PushImages(context.Background(), fileImages(bundle), Registry{Address: address}, func(string) {})
+		require.NoError(t, err)
+
+		ref, err := name.ParseReference(RewriteImage(image, address))
+		require.NoError(t, err)
+		pushed, err := remote.Image(ref)
+		require.NoError(t, err)
+		got, err := pushed.Digest()
+		require.NoError(t, err)
+		assert.Equal(t, digest, got)
+
+		// images are read from the bundle, nothing is extracted on disk.
+		_, err = os.Stat(defaults.EmbeddedClusterHomeDirectory())
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("oci layout with image index", func(t *testing.T) {
+		idx, err := random.Index(128, 1, 2)
+		require.NoError(t, err)
+		idxDigest, err := idx.Digest()
+		require.NoError(t, err)
+		dir := t.TempDir()
+		path, err := layout.Write(dir, empty.Index)
+		require.NoError(t, err)
+		image := "proxy.replicated.com/anonymous/replicated/multiarch:3.0"
+		require.NoError(t, path.AppendIndex(idx, layout.WithAnnotations(map[string]string{
+			"org.opencontainers.image.ref.name": image,
+		})))
+		bundle := filepath.Join(t.TempDir(), "images.tar")
+		require.NoError(t, tarDirectory(dir, bundle))
+
+		var pushed []string
+		err = PushImages(context.Background(), fileImages(bundle), Registry{Address: address}, func(image string) {
+			pushed = append(pushed, image)
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{image}, pushed)
+
+		ref, err := name.ParseReference(RewriteImage(image, address))
+		require.NoError(t, err)
+		got, err := remote.Index(ref)
+		require.NoError(t, err)
+		gotDigest, err := got.Digest()
+		require.NoError(t, err)
+		assert.Equal(t, idxDigest, gotDigest)
+	})
+}
+
+// fileImages opens the image bundle at the path.
+func fileImages(path string) ImagesOpener {
+	return func() (io.ReadCloser, error) { return os.Open(path) }
+}
+
+// writeAirgapBundle writes a gzipped tar file holding, at each path, the file at the
+// source path or nothing when the source is empty.
+func writeAirgapBundle(dst string, files map[string]string) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+	for name, src := range files {
+		var data []byte
+		if src != "" {
+			if data, err = os.ReadFile(src); err != nil {
+				return err
+			}
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// tarDirectory writes the regular files of the directory to a tar file.
+func tarDirectory(dir, dst string) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	tw := tar.NewWriter(out)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
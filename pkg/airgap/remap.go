@@ -22,5 +22,11 @@ func RemapHelm(cfg *v1beta1.ClusterConfig) {
 }
 
 func helmChartHostPath(chart v1beta1.Chart) string {
-	return filepath.Join(defaults.EmbeddedClusterChartsSubDir(), fmt.Sprintf("%s-%s.tgz", chart.Name, chart.Version))
+	return chartHostPath(chart.Name, chart.Version)
+}
+
+// chartHostPath returns the path on the host where the chart with the provided name and
+// version is found after the airgap bundle has been materialized.
+func chartHostPath(name, version string) string {
+	return filepath.Join(defaults.EmbeddedClusterChartsSubDir(), fmt.Sprintf("%s-%s.tgz", name, version))
 }
@@ -0,0 +1,69 @@
+package airgap
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// SignaturesFileName is the path, within the airgap bundle, of the image signatures. It is
+// a gzipped tarball of the OCI layouts written by 'cosign save', one directory per image
+// named after signatures.LayoutName.
+const SignaturesFileName = "embedded-cluster/signatures.tar.gz"
+
+// MaterializeSignatures extracts the image signatures shipped in the airgap bundle into
+// dir. Returns false if the bundle does not ship any.
+func MaterializeSignatures(airgapReader io.Reader, dir string) (bool, error) {
+	ungzip, err := gzip.NewReader(airgapReader)
+	if err != nil {
+		return false, fmt.Errorf("failed to decompress airgap file: %w", err)
+	}
+
+	tarreader := tar.NewReader(ungzip)
+	for {
+		nextFile, err := tarreader.Next()
+		if err == io.EOF {
+			return false, nil
+		} else if err != nil {
+			return false, fmt.Errorf("failed to read airgap file: %w", err)
+		}
+		if nextFile.Name != SignaturesFileName {
+			continue
+		}
+		if err := writeSignatureFiles(tarreader, dir); err != nil {
+			return false, fmt.Errorf("failed to write signature files: %w", err)
+		}
+		return true, nil
+	}
+}
+
+// writeSignatureFiles writes the files of the signatures tarball read from reader into dir.
+func writeSignatureFiles(reader io.Reader, dir string) error {
+	ungzip, err := gzip.NewReader(reader)
+	if err != nil {
+		return fmt.Errorf("failed to decompress signatures file: %w", err)
+	}
+
+	tarreader := tar.NewReader(ungzip)
+	for {
+		nextFile, err := tarreader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read signatures file: %w", err)
+		}
+		if nextFile.Typeflag != tar.TypeReg {
+			continue
+		}
+		dst := filepath.Join(dir, filepath.Clean("/"+nextFile.Name))
+		if !strings.HasPrefix(dst, filepath.Clean(dir)+string(filepath.Separator)) {
+			return fmt.Errorf("invalid file name %q", nextFile.Name)
+		}
+		if err := writeOneFile(tarreader, dst, 0644); err != nil {
+			return err
+		}
+	}
+}
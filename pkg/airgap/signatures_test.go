@@ -0,0 +1,52 @@
+package airgap
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tgz(t *testing.T, files map[string][]byte) []byte {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	for name, data := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestMaterializeSignatures(t *testing.T) {
+	signatures := tgz(t, map[string][]byte{
+		"registry_image_1/index.json":    []byte("{}"),
+		"../registry_image_2/oci-layout": []byte("{}"),
+	})
+	bundle := tgz(t, map[string][]byte{
+		"embedded-cluster/charts.tar.gz": []byte("charts"),
+		SignaturesFileName:               signatures,
+	})
+
+	dir := t.TempDir()
+	found, err := MaterializeSignatures(bytes.NewReader(bundle), dir)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.FileExists(t, filepath.Join(dir, "registry_image_1/index.json"))
+	// names escaping the directory are kept inside it.
+	assert.FileExists(t, filepath.Join(dir, "registry_image_2/oci-layout"))
+	_, err = os.Stat(filepath.Join(filepath.Dir(dir), "registry_image_2"))
+	assert.True(t, os.IsNotExist(err))
+
+	found, err = MaterializeSignatures(bytes.NewReader(tgz(t, map[string][]byte{"embedded-cluster/charts.tar.gz": nil})), t.TempDir())
+	require.NoError(t, err)
+	assert.False(t, found)
+}
@@ -12,46 +12,47 @@ import (
 
 // ChannelReleaseMetadata returns the appSlug, channelID, and versionLabel of the airgap bundle
 func ChannelReleaseMetadata(reader io.Reader) (appSlug, channelID, versionLabel string, err error) {
+	airgapInfo, err := readAirgapYaml(reader)
+	if err != nil {
+		return
+	}
+	appSlug = airgapInfo.Spec.AppSlug
+	channelID = airgapInfo.Spec.ChannelID
+	versionLabel = airgapInfo.Spec.VersionLabel
+	return
+}
 
+// readAirgapYaml finds and parses the airgap.yaml file in the airgap bundle.
+func readAirgapYaml(reader io.Reader) (kotsv1beta1.Airgap, error) {
 	// decompress tarball
 	ungzip, err := gzip.NewReader(reader)
 	if err != nil {
-		err = fmt.Errorf("failed to decompress airgap file: %w", err)
-		return
+		return kotsv1beta1.Airgap{}, fmt.Errorf("failed to decompress airgap file: %w", err)
 	}
 
 	// iterate through tarball
 	tarreader := tar.NewReader(ungzip)
-	var nextFile *tar.Header
 	for {
-		nextFile, err = tarreader.Next()
+		nextFile, err := tarreader.Next()
 		if err != nil {
 			if err == io.EOF {
-				err = fmt.Errorf("app release not found in airgap file")
-				return
+				return kotsv1beta1.Airgap{}, fmt.Errorf("app release not found in airgap file")
 			}
-			err = fmt.Errorf("failed to read airgap file: %w", err)
-			return
+			return kotsv1beta1.Airgap{}, fmt.Errorf("failed to read airgap file: %w", err)
 		}
 
-		if nextFile.Name == "airgap.yaml" {
-			var contents []byte
-			contents, err = io.ReadAll(tarreader)
-			if err != nil {
-				err = fmt.Errorf("failed to read airgap.yaml file within airgap file: %w", err)
-				return
-			}
-			var airgapInfo kotsv1beta1.Airgap
-			airgapInfo, err = airgapYamlVersions(contents)
-			if err != nil {
-				err = fmt.Errorf("failed to parse airgap.yaml: %w", err)
-				return
-			}
-			appSlug = airgapInfo.Spec.AppSlug
-			channelID = airgapInfo.Spec.ChannelID
-			versionLabel = airgapInfo.Spec.VersionLabel
-			return
+		if nextFile.Name != "airgap.yaml" {
+			continue
+		}
+		contents, err := io.ReadAll(tarreader)
+		if err != nil {
+			return kotsv1beta1.Airgap{}, fmt.Errorf("failed to read airgap.yaml file within airgap file: %w", err)
+		}
+		airgapInfo, err := airgapYamlVersions(contents)
+		if err != nil {
+			return kotsv1beta1.Airgap{}, fmt.Errorf("failed to parse airgap.yaml: %w", err)
 		}
+		return airgapInfo, nil
 	}
 }
 
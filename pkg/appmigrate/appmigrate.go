@@ -0,0 +1,368 @@
+// Package appmigrate moves the state of the application (secrets, config maps and
+// the data in its persistent volumes) from one embedded cluster to another through
+// an archive, without requiring the disaster recovery infrastructure.
+package appmigrate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ArchiveVersion is the version of the archive layout written by Export.
+const ArchiveVersion = 1
+
+const manifestFile = "manifest.json"
+
+// Manifest describes the content of an archive. It is the first file in the archive.
+type Manifest struct {
+	Version    int       `json:"version"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Namespaces []string  `json:"namespaces"`
+	Resources  int       `json:"resources"`
+	Volumes    []Volume  `json:"volumes"`
+}
+
+// Volume is a persistent volume claim whose data is part of the archive.
+type Volume struct {
+	Namespace string `json:"namespace"`
+	Claim     string `json:"claim"`
+}
+
+// Migrator exports the application state from a cluster and imports it into another.
+type Migrator struct {
+	Client client.Client
+	// Exec runs commands in the helper pods used to read and write volume data.
+	Exec ExecFunc
+	// Image is the image of the helper pods, it must provide sh, find and tar.
+	Image string
+	// TempDir is where volume data is staged while exporting, defaults to the system
+	// temporary directory.
+	TempDir string
+}
+
+// Export writes the secrets, config maps and persistent volume claims of the provided
+// namespaces, and the data in the claims, to out. Workloads mounting the claims are
+// scaled down while their data is read so it is consistent, and scaled back up after.
+func (m *Migrator) Export(ctx context.Context, namespaces []string, out io.Writer) (*Manifest, error) {
+	manifest := &Manifest{
+		Version:    ArchiveVersion,
+		CreatedAt:  time.Now().UTC(),
+		Namespaces: namespaces,
+	}
+	var objects []client.Object
+	for _, ns := range namespaces {
+		nsObjects, err := m.listObjects(ctx, ns)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, nsObjects...)
+	}
+	for _, obj := range objects {
+		if pvc, ok := obj.(*corev1.PersistentVolumeClaim); ok {
+			manifest.Volumes = append(manifest.Volumes, Volume{Namespace: pvc.Namespace, Claim: pvc.Name})
+		}
+	}
+	manifest.Resources = len(objects)
+
+	w := newArchiveWriter(out)
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal manifest: %w", err)
+	}
+	if err := w.writeFile(manifestFile, data); err != nil {
+		return nil, err
+	}
+	for _, obj := range objects {
+		data, err := json.Marshal(obj)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal %s: %w", objectName(obj), err)
+		}
+		if err := w.writeFile(resourceFile(obj), data); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(manifest.Volumes) > 0 {
+		scaleUp, err := m.scaleDown(ctx, manifest.Volumes)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err := scaleUp(context.Background()); err != nil {
+				logrus.Warnf("Unable to scale the application back up: %v", err)
+			}
+		}()
+	}
+	for _, vol := range manifest.Volumes {
+		logrus.Infof("Exporting the data in %s/%s", vol.Namespace, vol.Claim)
+		if err := m.exportVolume(ctx, vol, w); err != nil {
+			return nil, fmt.Errorf("unable to export volume %s/%s: %w", vol.Namespace, vol.Claim, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("unable to close archive: %w", err)
+	}
+	return manifest, nil
+}
+
+// exportVolume stages the data in the claim to a temporary file, the size of an entry
+// must be known before it is written to the archive.
+func (m *Migrator) exportVolume(ctx context.Context, vol Volume, w *archiveWriter) error {
+	tmp, err := os.CreateTemp(m.TempDir, "app-export-*.tar")
+	if err != nil {
+		return fmt.Errorf("unable to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	err = m.withHelperPod(ctx, vol, true, func(pod string) error {
+		return m.Exec(ctx, vol.Namespace, pod, []string{"tar", "-C", helperMountPath, "-cf", "-", "."}, nil, tmp)
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("unable to rewind temporary file: %w", err)
+	}
+	return w.writeFrom(volumeFile(vol), tmp)
+}
+
+// Import creates or updates the resources in the archive read from in and replaces the
+// data in the claims with the data in the archive. Workloads mounting the claims are
+// scaled down while their data is replaced and scaled back up after.
+func (m *Migrator) Import(ctx context.Context, in io.Reader) (*Manifest, error) {
+	r, err := newArchiveReader(in)
+	if err != nil {
+		return nil, err
+	}
+	name, data, err := r.next()
+	if err != nil {
+		return nil, err
+	} else if name != manifestFile {
+		return nil, fmt.Errorf("archive does not start with %s", manifestFile)
+	}
+	manifest := &Manifest{}
+	if err := readAll(data, manifest); err != nil {
+		return nil, fmt.Errorf("unable to read manifest: %w", err)
+	}
+	if manifest.Version != ArchiveVersion {
+		return nil, fmt.Errorf("unsupported archive version %d", manifest.Version)
+	}
+	for _, ns := range manifest.Namespaces {
+		if err := m.ensureNamespace(ctx, ns); err != nil {
+			return nil, err
+		}
+	}
+
+	var scaleUp func(context.Context) error
+	defer func() {
+		if scaleUp == nil {
+			return
+		}
+		if err := scaleUp(context.Background()); err != nil {
+			logrus.Warnf("Unable to scale the application back up: %v", err)
+		}
+	}()
+	for {
+		name, data, err := r.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		switch {
+		case strings.HasPrefix(name, resourcesDir+"/"):
+			obj, err := newObject(name)
+			if err != nil {
+				return nil, err
+			}
+			if err := readAll(data, obj); err != nil {
+				return nil, fmt.Errorf("unable to read %s: %w", name, err)
+			}
+			if err := m.applyObject(ctx, obj); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(name, volumesDir+"/"):
+			vol, err := parseVolumeFile(name)
+			if err != nil {
+				return nil, err
+			}
+			if scaleUp == nil {
+				if scaleUp, err = m.scaleDown(ctx, manifest.Volumes); err != nil {
+					return nil, err
+				}
+			}
+			logrus.Infof("Importing the data in %s/%s", vol.Namespace, vol.Claim)
+			err = m.withHelperPod(ctx, vol, false, func(pod string) error {
+				script := fmt.Sprintf("find %[1]s -mindepth 1 -delete && tar -C %[1]s -xf -", helperMountPath)
+				return m.Exec(ctx, vol.Namespace, pod, []string{"sh", "-c", script}, data, io.Discard)
+			})
+			if err != nil {
+				return nil, fmt.Errorf("unable to import volume %s/%s: %w", vol.Namespace, vol.Claim, err)
+			}
+		default:
+			return nil, fmt.Errorf("unexpected file %s in archive", name)
+		}
+	}
+	return manifest, nil
+}
+
+// listObjects returns the objects holding the application state in the namespace,
+// ready to be created in another cluster.
+func (m *Migrator) listObjects(ctx context.Context, ns string) ([]client.Object, error) {
+	var objects []client.Object
+
+	secrets := &corev1.SecretList{}
+	if err := m.Client.List(ctx, secrets, client.InNamespace(ns)); err != nil {
+		return nil, fmt.Errorf("unable to list secrets in %s: %w", ns, err)
+	}
+	for i := range secrets.Items {
+		if secret := &secrets.Items[i]; includeSecret(secret) {
+			objects = append(objects, sanitize(secret))
+		}
+	}
+
+	configmaps := &corev1.ConfigMapList{}
+	if err := m.Client.List(ctx, configmaps, client.InNamespace(ns)); err != nil {
+		return nil, fmt.Errorf("unable to list config maps in %s: %w", ns, err)
+	}
+	for i := range configmaps.Items {
+		if cm := &configmaps.Items[i]; includeConfigMap(cm) {
+			objects = append(objects, sanitize(cm))
+		}
+	}
+
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	if err := m.Client.List(ctx, pvcs, client.InNamespace(ns)); err != nil {
+		return nil, fmt.Errorf("unable to list persistent volume claims in %s: %w", ns, err)
+	}
+	for i := range pvcs.Items {
+		if pvc := &pvcs.Items[i]; includeObject(pvc) && pvc.Status.Phase == corev1.ClaimBound {
+			objects = append(objects, sanitize(pvc))
+		}
+	}
+
+	sort.SliceStable(objects, func(i, j int) bool {
+		return resourceFile(objects[i]) < resourceFile(objects[j])
+	})
+	return objects, nil
+}
+
+// applyObject creates the object or, if it already exists, replaces its content. Claims
+// already present are left as they are, their data is replaced instead.
+func (m *Migrator) applyObject(ctx context.Context, obj client.Object) error {
+	err := m.Client.Create(ctx, obj)
+	if err == nil || !errors.IsAlreadyExists(err) {
+		if err != nil {
+			return fmt.Errorf("unable to create %s: %w", objectName(obj), err)
+		}
+		return nil
+	}
+	if _, ok := obj.(*corev1.PersistentVolumeClaim); ok {
+		return nil
+	}
+	existing, _ := newObject(resourceFile(obj))
+	if err := m.Client.Get(ctx, client.ObjectKeyFromObject(obj), existing); err != nil {
+		return fmt.Errorf("unable to get %s: %w", objectName(obj), err)
+	}
+	if secret, ok := obj.(*corev1.Secret); ok && secret.Type != existing.(*corev1.Secret).Type {
+		// the type of a secret is immutable.
+		if err := m.Client.Delete(ctx, existing); err != nil {
+			return fmt.Errorf("unable to delete %s: %w", objectName(obj), err)
+		}
+		if err := m.Client.Create(ctx, obj); err != nil {
+			return fmt.Errorf("unable to create %s: %w", objectName(obj), err)
+		}
+		return nil
+	}
+	obj.SetResourceVersion(existing.GetResourceVersion())
+	if err := m.Client.Update(ctx, obj); err != nil {
+		return fmt.Errorf("unable to update %s: %w", objectName(obj), err)
+	}
+	return nil
+}
+
+func (m *Migrator) ensureNamespace(ctx context.Context, ns string) error {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}}
+	if err := m.Client.Create(ctx, namespace); err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("unable to create namespace %s: %w", ns, err)
+	}
+	return nil
+}
+
+// includeObject returns false for the objects owned by the embedded cluster itself,
+// they are recreated by the installation of the destination cluster.
+func includeObject(obj client.Object) bool {
+	return obj.GetLabels()["replicated.com/disaster-recovery"] != "infra"
+}
+
+// includeSecret returns false for the secrets bound to the source cluster: service
+// account tokens, bootstrap tokens and helm releases, the application is deployed again
+// in the destination cluster.
+func includeSecret(secret *corev1.Secret) bool {
+	switch secret.Type {
+	case corev1.SecretTypeServiceAccountToken, corev1.SecretTypeBootstrapToken, "helm.sh/release.v1":
+		return false
+	}
+	return includeObject(secret)
+}
+
+// includeConfigMap returns false for the config maps published by kubernetes in every
+// namespace.
+func includeConfigMap(cm *corev1.ConfigMap) bool {
+	if cm.Name == "kube-root-ca.crt" || strings.HasPrefix(cm.Name, "sh.helm.release.") {
+		return false
+	}
+	return includeObject(cm)
+}
+
+// boundAnnotationPrefixes are the prefixes of the annotations kubernetes sets on claims
+// once they are bound to a volume in the source cluster.
+var boundAnnotationPrefixes = []string{"pv.kubernetes.io/", "volume.kubernetes.io/", "volume.beta.kubernetes.io/"}
+
+// sanitize strips the fields set by the source cluster from the object so it can be
+// created in another cluster.
+func sanitize(obj client.Object) client.Object {
+	obj.SetUID("")
+	obj.SetResourceVersion("")
+	obj.SetGeneration(0)
+	obj.SetCreationTimestamp(metav1.Time{})
+	obj.SetManagedFields(nil)
+	obj.SetOwnerReferences(nil)
+	obj.SetFinalizers(nil)
+	switch o := obj.(type) {
+	case *corev1.Secret:
+		o.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"}
+	case *corev1.ConfigMap:
+		o.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"}
+	case *corev1.PersistentVolumeClaim:
+		o.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "PersistentVolumeClaim"}
+		o.Spec.VolumeName = ""
+		o.Status = corev1.PersistentVolumeClaimStatus{}
+		for key := range o.Annotations {
+			for _, prefix := range boundAnnotationPrefixes {
+				if strings.HasPrefix(key, prefix) {
+					delete(o.Annotations, key)
+				}
+			}
+		}
+	}
+	return obj
+}
+
+func objectName(obj client.Object) string {
+	return path.Join(resourceKind(obj), obj.GetNamespace(), obj.GetName())
+}
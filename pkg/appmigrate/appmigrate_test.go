@@ -0,0 +1,170 @@
+package appmigrate
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// newFakeClient returns a client whose pods are running as soon as they are created.
+func newFakeClient(objects ...client.Object) client.Client {
+	return fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(objects...).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Create: func(ctx context.Context, cli client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				if pod, ok := obj.(*corev1.Pod); ok {
+					pod.Status.Phase = corev1.PodRunning
+				}
+				return cli.Create(ctx, obj, opts...)
+			},
+		}).
+		Build()
+}
+
+func TestExportImport(t *testing.T) {
+	meta := func(name string, labels map[string]string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: "kotsadm", Labels: labels, UID: "uid", ResourceVersion: "10"}
+	}
+	source := newFakeClient(
+		&corev1.Secret{ObjectMeta: meta("kotsadm-encryption", nil), Data: map[string][]byte{"key": []byte("source")}},
+		&corev1.Secret{ObjectMeta: meta("token", nil), Type: corev1.SecretTypeServiceAccountToken},
+		&corev1.Secret{ObjectMeta: meta("sh.helm.release.v1.app.v1", nil), Type: "helm.sh/release.v1"},
+		&corev1.Secret{ObjectMeta: meta("registry-creds", map[string]string{"replicated.com/disaster-recovery": "infra"})},
+		&corev1.ConfigMap{ObjectMeta: meta("kube-root-ca.crt", nil)},
+		&corev1.ConfigMap{ObjectMeta: meta("app-config", nil), Data: map[string]string{"hostname": "app.example.com"}},
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "data",
+				Namespace:   "kotsadm",
+				Annotations: map[string]string{"pv.kubernetes.io/bind-completed": "yes", "app": "keep"},
+				Finalizers:  []string{"kubernetes.io/pvc-protection"},
+			},
+			Spec:   corev1.PersistentVolumeClaimSpec{VolumeName: "pvc-1234"},
+			Status: corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimBound},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "kotsadm"},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: ptr.To(int32(2)),
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Volumes: []corev1.Volume{{
+							Name:         "data",
+							VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "data"}},
+						}},
+					},
+				},
+			},
+		},
+	)
+
+	exporter := &Migrator{
+		Client:  source,
+		TempDir: t.TempDir(),
+		Image:   "utils",
+		Exec: func(ctx context.Context, namespace, pod string, command []string, stdin io.Reader, stdout io.Writer) error {
+			// the application is scaled down while its data is read.
+			deploy := &appsv1.Deployment{}
+			require.NoError(t, source.Get(ctx, client.ObjectKey{Namespace: "kotsadm", Name: "app"}, deploy))
+			assert.Equal(t, int32(0), *deploy.Spec.Replicas)
+			assert.Equal(t, []string{"tar", "-C", "/data", "-cf", "-", "."}, command)
+			_, err := stdout.Write([]byte("volume data"))
+			return err
+		},
+	}
+	archive := &bytes.Buffer{}
+	manifest, err := exporter.Export(context.Background(), []string{"kotsadm"}, archive)
+	require.NoError(t, err)
+	assert.Equal(t, 3, manifest.Resources)
+	assert.Equal(t, []Volume{{Namespace: "kotsadm", Claim: "data"}}, manifest.Volumes)
+
+	deploy := &appsv1.Deployment{}
+	require.NoError(t, source.Get(context.Background(), client.ObjectKey{Namespace: "kotsadm", Name: "app"}, deploy))
+	assert.Equal(t, int32(2), *deploy.Spec.Replicas)
+	pods := &corev1.PodList{}
+	require.NoError(t, source.List(context.Background(), pods))
+	assert.Empty(t, pods.Items, "helper pods must be deleted")
+
+	destination := newFakeClient(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "kotsadm-encryption", Namespace: "kotsadm"},
+			Data:       map[string][]byte{"key": []byte("destination")},
+		},
+	)
+	var imported bytes.Buffer
+	importer := &Migrator{
+		Client: destination,
+		Image:  "utils",
+		Exec: func(ctx context.Context, namespace, pod string, command []string, stdin io.Reader, stdout io.Writer) error {
+			assert.Equal(t, []string{"sh", "-c", "find /data -mindepth 1 -delete && tar -C /data -xf -"}, command)
+			_, err := io.Copy(&imported, stdin)
+			return err
+		},
+	}
+	manifest, err = importer.Import(context.Background(), archive)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kotsadm"}, manifest.Namespaces)
+	assert.Equal(t, "volume data", imported.String())
+
+	secret := &corev1.Secret{}
+	require.NoError(t, destination.Get(context.Background(), client.ObjectKey{Namespace: "kotsadm", Name: "kotsadm-encryption"}, secret))
+	assert.Equal(t, "source", string(secret.Data["key"]))
+	cm := &corev1.ConfigMap{}
+	require.NoError(t, destination.Get(context.Background(), client.ObjectKey{Namespace: "kotsadm", Name: "app-config"}, cm))
+	assert.Equal(t, "app.example.com", cm.Data["hostname"])
+	pvc := &corev1.PersistentVolumeClaim{}
+	require.NoError(t, destination.Get(context.Background(), client.ObjectKey{Namespace: "kotsadm", Name: "data"}, pvc))
+	assert.Empty(t, pvc.Spec.VolumeName)
+	assert.Equal(t, map[string]string{"app": "keep"}, pvc.Annotations)
+	for _, name := range []string{"token", "registry-creds"} {
+		err := destination.Get(context.Background(), client.ObjectKey{Namespace: "kotsadm", Name: name}, &corev1.Secret{})
+		assert.Error(t, err, name)
+	}
+}
+
+func TestImportInvalidArchive(t *testing.T) {
+	archive := &bytes.Buffer{}
+	w := newArchiveWriter(archive)
+	require.NoError(t, w.writeFile(manifestFile, []byte(`{"version": 2}`)))
+	require.NoError(t, w.Close())
+
+	_, err := (&Migrator{Client: newFakeClient()}).Import(context.Background(), archive)
+	assert.EqualError(t, err, "unsupported archive version 2")
+
+	_, err = (&Migrator{Client: newFakeClient()}).Import(context.Background(), bytes.NewBufferString("not an archive"))
+	assert.ErrorContains(t, err, "unable to read archive")
+}
+
+func TestOwnsClaim(t *testing.T) {
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "kotsadm-rqlite"},
+		Spec: appsv1.StatefulSetSpec{
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{ObjectMeta: metav1.ObjectMeta{Name: "kotsadm-rqlite"}}},
+		},
+	}
+	assert.True(t, ownsClaim(sts, map[string]bool{"kotsadm-rqlite-kotsadm-rqlite-0": true}))
+	assert.False(t, ownsClaim(sts, map[string]bool{"data": true}))
+}
+
+func TestParseVolumeFile(t *testing.T) {
+	vol := Volume{Namespace: "kotsadm", Claim: "data"}
+	parsed, err := parseVolumeFile(volumeFile(vol))
+	require.NoError(t, err)
+	assert.Equal(t, vol, parsed)
+
+	_, err = parseVolumeFile("volumes/data.tar")
+	assert.Error(t, err)
+}
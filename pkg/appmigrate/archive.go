@@ -0,0 +1,163 @@
+package appmigrate
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// the archive holds the manifest, then the resources under resources/<namespace>/<kind>/
+// and finally the volume data under volumes/<namespace>/<claim>.tar.
+const (
+	resourcesDir = "resources"
+	volumesDir   = "volumes"
+)
+
+// resourceKinds maps the directories resources are stored in to their type.
+var resourceKinds = map[string]func() client.Object{
+	"secrets":                func() client.Object { return &corev1.Secret{} },
+	"configmaps":             func() client.Object { return &corev1.ConfigMap{} },
+	"persistentvolumeclaims": func() client.Object { return &corev1.PersistentVolumeClaim{} },
+}
+
+func resourceKind(obj client.Object) string {
+	switch obj.(type) {
+	case *corev1.Secret:
+		return "secrets"
+	case *corev1.ConfigMap:
+		return "configmaps"
+	case *corev1.PersistentVolumeClaim:
+		return "persistentvolumeclaims"
+	}
+	return "unknown"
+}
+
+// resourceFile returns the path to the object in the archive.
+func resourceFile(obj client.Object) string {
+	return path.Join(resourcesDir, obj.GetNamespace(), resourceKind(obj), obj.GetName()+".json")
+}
+
+// newObject returns an empty object of the kind stored at the provided path.
+func newObject(name string) (client.Object, error) {
+	parts := strings.Split(name, "/")
+	if len(parts) != 4 || parts[0] != resourcesDir {
+		return nil, fmt.Errorf("invalid resource path %s", name)
+	}
+	newFn, ok := resourceKinds[parts[2]]
+	if !ok {
+		return nil, fmt.Errorf("unsupported resource kind %s", parts[2])
+	}
+	return newFn(), nil
+}
+
+func volumeFile(vol Volume) string {
+	return path.Join(volumesDir, vol.Namespace, vol.Claim+".tar")
+}
+
+func parseVolumeFile(name string) (Volume, error) {
+	parts := strings.Split(name, "/")
+	if len(parts) != 3 || parts[0] != volumesDir || !strings.HasSuffix(parts[2], ".tar") {
+		return Volume{}, fmt.Errorf("invalid volume path %s", name)
+	}
+	return Volume{Namespace: parts[1], Claim: strings.TrimSuffix(parts[2], ".tar")}, nil
+}
+
+type archiveWriter struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func newArchiveWriter(out io.Writer) *archiveWriter {
+	gz := gzip.NewWriter(out)
+	return &archiveWriter{gz: gz, tw: tar.NewWriter(gz)}
+}
+
+func (w *archiveWriter) writeHeader(name string, size int64) error {
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0600,
+		ModTime:  time.Now(),
+	}
+	if err := w.tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("unable to write %s header: %w", name, err)
+	}
+	return nil
+}
+
+func (w *archiveWriter) writeFile(name string, data []byte) error {
+	if err := w.writeHeader(name, int64(len(data))); err != nil {
+		return err
+	}
+	if _, err := w.tw.Write(data); err != nil {
+		return fmt.Errorf("unable to write %s: %w", name, err)
+	}
+	return nil
+}
+
+func (w *archiveWriter) writeFrom(name string, f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("unable to stat %s: %w", f.Name(), err)
+	}
+	if err := w.writeHeader(name, info.Size()); err != nil {
+		return err
+	}
+	if _, err := io.Copy(w.tw, f); err != nil {
+		return fmt.Errorf("unable to write %s: %w", name, err)
+	}
+	return nil
+}
+
+func (w *archiveWriter) Close() error {
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	return w.gz.Close()
+}
+
+type archiveReader struct {
+	tr *tar.Reader
+}
+
+func newArchiveReader(in io.Reader) (*archiveReader, error) {
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read archive: %w", err)
+	}
+	return &archiveReader{tr: tar.NewReader(gz)}, nil
+}
+
+// next returns the name of the next file in the archive and a reader for its content,
+// valid until next is called again. It returns io.EOF once all files have been read.
+func (r *archiveReader) next() (string, io.Reader, error) {
+	for {
+		header, err := r.tr.Next()
+		if err == io.EOF {
+			return "", nil, io.EOF
+		} else if err != nil {
+			return "", nil, fmt.Errorf("unable to read archive: %w", err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			return header.Name, r.tr, nil
+		}
+	}
+}
+
+func readAll(in io.Reader, v interface{}) error {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
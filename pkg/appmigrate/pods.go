@@ -0,0 +1,135 @@
+package appmigrate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// helperLabel is set on the pods mounting the claims to read or write their data.
+	helperLabel     = "replicated.com/app-migrate"
+	helperMountPath = "/data"
+	// helperTimeout is how long we wait for a helper pod to start, the claim may need
+	// to be provisioned first.
+	helperTimeout = 5 * time.Minute
+)
+
+// ExecFunc runs the command in the pod, streaming stdin to it and its output to stdout.
+type ExecFunc func(ctx context.Context, namespace, pod string, command []string, stdin io.Reader, stdout io.Writer) error
+
+// NewExecFunc returns an ExecFunc running commands through the kubernetes api server.
+func NewExecFunc(cfg *rest.Config) (ExecFunc, error) {
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create kubernetes client: %w", err)
+	}
+	return func(ctx context.Context, namespace, pod string, command []string, stdin io.Reader, stdout io.Writer) error {
+		req := clientset.CoreV1().RESTClient().Post().
+			Resource("pods").Namespace(namespace).Name(pod).SubResource("exec").
+			VersionedParams(&corev1.PodExecOptions{
+				Command: command,
+				Stdin:   stdin != nil,
+				Stdout:  true,
+				Stderr:  true,
+			}, scheme.ParameterCodec)
+		executor, err := remotecommand.NewSPDYExecutor(cfg, "POST", req.URL())
+		if err != nil {
+			return fmt.Errorf("unable to create executor: %w", err)
+		}
+		stderr := &bytes.Buffer{}
+		err = executor.StreamWithContext(ctx, remotecommand.StreamOptions{Stdin: stdin, Stdout: stdout, Stderr: stderr})
+		if err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return fmt.Errorf("%w: %s", err, msg)
+			}
+			return err
+		}
+		return nil
+	}, nil
+}
+
+// withHelperPod runs fn with the name of a pod mounting the claim at helperMountPath,
+// once it is running. The pod is deleted when fn returns.
+func (m *Migrator) withHelperPod(ctx context.Context, vol Volume, readOnly bool, fn func(pod string) error) error {
+	pod := newHelperPod(vol, m.Image, readOnly)
+	if err := m.Client.Create(ctx, pod); err != nil {
+		return fmt.Errorf("unable to create helper pod: %w", err)
+	}
+	defer func() {
+		_ = m.Client.Delete(context.Background(), pod, client.GracePeriodSeconds(0))
+	}()
+
+	backoff := wait.Backoff{Steps: int(helperTimeout / (2 * time.Second)), Duration: 2 * time.Second, Factor: 1}
+	err := wait.ExponentialBackoffWithContext(ctx, backoff, func(ctx context.Context) (bool, error) {
+		if err := m.Client.Get(ctx, client.ObjectKeyFromObject(pod), pod); err != nil {
+			return false, fmt.Errorf("unable to get helper pod: %w", err)
+		}
+		switch pod.Status.Phase {
+		case corev1.PodRunning:
+			return true, nil
+		case corev1.PodFailed, corev1.PodSucceeded:
+			return false, fmt.Errorf("helper pod %s terminated", pod.Name)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("helper pod %s did not start: %w", pod.Name, err)
+	}
+	return fn(pod.Name)
+}
+
+func newHelperPod(vol Volume, image string, readOnly bool) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "app-migrate-",
+			Namespace:    vol.Namespace,
+			Labels: map[string]string{
+				helperLabel:                    vol.Claim,
+				"app.kubernetes.io/managed-by": "embedded-cluster",
+			},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			// the helper must run wherever the volume is, whatever the taints.
+			Tolerations: []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+			SecurityContext: &corev1.PodSecurityContext{
+				RunAsUser: ptr.To(int64(0)),
+			},
+			Containers: []corev1.Container{
+				{
+					Name:    "helper",
+					Image:   image,
+					Command: []string{"sleep", "86400"},
+					VolumeMounts: []corev1.VolumeMount{
+						{Name: "data", MountPath: helperMountPath, ReadOnly: readOnly},
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: "data",
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+							ClaimName: vol.Claim,
+							ReadOnly:  readOnly,
+						},
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,152 @@
+package appmigrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// scaleDownTimeout is how long we wait for the pods mounting the claims to go away.
+const scaleDownTimeout = 5 * time.Minute
+
+// scaleDown scales to zero the deployments and statefulsets mounting the claims and
+// waits for their pods to terminate. It returns a function scaling them back up.
+func (m *Migrator) scaleDown(ctx context.Context, volumes []Volume) (func(context.Context) error, error) {
+	claims := claimsByNamespace(volumes)
+	var scaled []client.Object
+	replicas := map[client.Object]int32{}
+	scaleUp := func(ctx context.Context) error {
+		for _, obj := range scaled {
+			if err := m.scale(ctx, obj, replicas[obj]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for ns, nsClaims := range claims {
+		workloads, err := m.workloadsMounting(ctx, ns, nsClaims)
+		if err != nil {
+			return nil, err
+		}
+		for obj, count := range workloads {
+			if count == 0 {
+				continue
+			}
+			logrus.Infof("Scaling down %s", objectName(obj))
+			if err := m.scale(ctx, obj, 0); err != nil {
+				_ = scaleUp(ctx)
+				return nil, err
+			}
+			scaled = append(scaled, obj)
+			replicas[obj] = count
+		}
+	}
+
+	backoff := wait.Backoff{Steps: int(scaleDownTimeout / (5 * time.Second)), Duration: 5 * time.Second, Factor: 1}
+	err := wait.ExponentialBackoffWithContext(ctx, backoff, func(ctx context.Context) (bool, error) {
+		for ns, nsClaims := range claims {
+			pods := &corev1.PodList{}
+			if err := m.Client.List(ctx, pods, client.InNamespace(ns)); err != nil {
+				return false, fmt.Errorf("unable to list pods in %s: %w", ns, err)
+			}
+			for _, pod := range pods.Items {
+				if pod.Labels[helperLabel] == "" && mountsClaim(pod.Spec, nsClaims) {
+					return false, nil
+				}
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		_ = scaleUp(ctx)
+		return nil, fmt.Errorf("timed out waiting for the pods mounting the volumes to terminate: %w", err)
+	}
+	return scaleUp, nil
+}
+
+// workloadsMounting returns the deployments and statefulsets in the namespace whose pods
+// mount any of the claims, along with their number of replicas.
+func (m *Migrator) workloadsMounting(ctx context.Context, ns string, claims map[string]bool) (map[client.Object]int32, error) {
+	workloads := map[client.Object]int32{}
+
+	deployments := &appsv1.DeploymentList{}
+	if err := m.Client.List(ctx, deployments, client.InNamespace(ns)); err != nil {
+		return nil, fmt.Errorf("unable to list deployments in %s: %w", ns, err)
+	}
+	for i := range deployments.Items {
+		deploy := &deployments.Items[i]
+		if mountsClaim(deploy.Spec.Template.Spec, claims) {
+			workloads[deploy] = ptr.Deref(deploy.Spec.Replicas, 1)
+		}
+	}
+
+	statefulsets := &appsv1.StatefulSetList{}
+	if err := m.Client.List(ctx, statefulsets, client.InNamespace(ns)); err != nil {
+		return nil, fmt.Errorf("unable to list statefulsets in %s: %w", ns, err)
+	}
+	for i := range statefulsets.Items {
+		sts := &statefulsets.Items[i]
+		if mountsClaim(sts.Spec.Template.Spec, claims) || ownsClaim(sts, claims) {
+			workloads[sts] = ptr.Deref(sts.Spec.Replicas, 1)
+		}
+	}
+	return workloads, nil
+}
+
+func (m *Migrator) scale(ctx context.Context, obj client.Object, replicas int32) error {
+	patch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		o.Spec.Replicas = ptr.To(replicas)
+	case *appsv1.StatefulSet:
+		o.Spec.Replicas = ptr.To(replicas)
+	}
+	if err := m.Client.Patch(ctx, obj, patch); err != nil {
+		return fmt.Errorf("unable to scale %s: %w", objectName(obj), err)
+	}
+	return nil
+}
+
+// mountsClaim returns true if the pod mounts any of the claims.
+func mountsClaim(spec corev1.PodSpec, claims map[string]bool) bool {
+	for _, vol := range spec.Volumes {
+		if vol.PersistentVolumeClaim != nil && claims[vol.PersistentVolumeClaim.ClaimName] {
+			return true
+		}
+	}
+	return false
+}
+
+// ownsClaim returns true if any of the claims has been created from the volume claim
+// templates of the statefulset, they are named <template>-<statefulset>-<ordinal>.
+func ownsClaim(sts *appsv1.StatefulSet, claims map[string]bool) bool {
+	for _, tpl := range sts.Spec.VolumeClaimTemplates {
+		prefix := fmt.Sprintf("%s-%s-", tpl.Name, sts.Name)
+		for claim := range claims {
+			if strings.HasPrefix(claim, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func claimsByNamespace(volumes []Volume) map[string]map[string]bool {
+	claims := map[string]map[string]bool{}
+	for _, vol := range volumes {
+		if claims[vol.Namespace] == nil {
+			claims[vol.Namespace] = map[string]bool{}
+		}
+		claims[vol.Namespace][vol.Claim] = true
+	}
+	return claims
+}
@@ -0,0 +1,151 @@
+// Package artifactmirror implements the local artifact mirror served on every node. The
+// mirror serves the binaries, charts and images of the embedded cluster directory, keeps
+// the versioned artifacts within a disk quota and fetches the artifacts missing locally
+// from the mirrors of the controllers.
+package artifactmirror
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Dirs are the directories of the embedded cluster directory served by the mirror.
+var Dirs = []string{"bin", "charts", "images"}
+
+// versionedArtifact matches the artifacts with one version per installation, the image
+// bundles of the node architecture copied to the nodes during airgap upgrades.
+const versionedArtifact = "images/images-*-*.tar"
+
+// Artifact is a versioned artifact kept by the mirror.
+type Artifact struct {
+	// Path is the path of the artifact relative to the mirror directory.
+	Path string `json:"path"`
+	// Size is the size of the artifact in bytes.
+	Size int64 `json:"size"`
+	// LastUsed is the last time the artifact was stored or served.
+	LastUsed time.Time `json:"lastUsed"`
+}
+
+// Cache keeps the versioned artifacts of the mirror directory within the disk quota.
+type Cache struct {
+	// Dir is the embedded cluster directory the mirror serves.
+	Dir string
+	// Quota is the maximum disk space used by the mirror, in bytes. Only the most recent
+	// versions of the artifacts are kept when it is zero.
+	Quota int64
+}
+
+// ParseQuota parses a disk quota expressed as a kubernetes quantity, e.g. 20Gi. Zero is
+// returned for an empty quota.
+func ParseQuota(quota string) (int64, error) {
+	if quota == "" {
+		return 0, nil
+	}
+	q, err := resource.ParseQuantity(quota)
+	if err != nil {
+		return 0, fmt.Errorf("invalid disk quota %q: %w", quota, err)
+	}
+	if q.Sign() <= 0 {
+		return 0, fmt.Errorf("invalid disk quota %q: must be positive", quota)
+	}
+	return q.Value(), nil
+}
+
+// IsVersioned returns true if the path, relative to the mirror directory, is a versioned
+// artifact the cache may evict.
+func IsVersioned(path string) bool {
+	matched, _ := filepath.Match(versionedArtifact, strings.TrimPrefix(path, "/"))
+	return matched
+}
+
+// Artifacts returns the versioned artifacts, most recently used first.
+func (c Cache) Artifacts() ([]Artifact, error) {
+	matches, err := filepath.Glob(filepath.Join(c.Dir, versionedArtifact))
+	if err != nil {
+		return nil, err
+	}
+	artifacts := []Artifact{}
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil {
+			return nil, fmt.Errorf("unable to stat %s: %w", match, err)
+		}
+		rel, err := filepath.Rel(c.Dir, match)
+		if err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, Artifact{Path: rel, Size: info.Size(), LastUsed: info.ModTime()})
+	}
+	sort.SliceStable(artifacts, func(i, j int) bool {
+		return artifacts[i].LastUsed.After(artifacts[j].LastUsed)
+	})
+	return artifacts, nil
+}
+
+// Usage returns the disk space, in bytes, used by the files the mirror serves.
+func (c Cache) Usage() (int64, error) {
+	var usage int64
+	for _, dir := range Dirs {
+		err := filepath.WalkDir(filepath.Join(c.Dir, dir), func(path string, d fs.DirEntry, err error) error {
+			if os.IsNotExist(err) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			usage += info.Size()
+			return nil
+		})
+		if err != nil {
+			return 0, fmt.Errorf("unable to read %s: %w", dir, err)
+		}
+	}
+	return usage, nil
+}
+
+// Touch marks the artifact, relative to the mirror directory, as used now. Artifacts
+// are ordered by modification time as access times are often not recorded.
+func (c Cache) Touch(path string) error {
+	now := time.Now()
+	return os.Chtimes(filepath.Join(c.Dir, path), now, now)
+}
+
+// Evict removes the least recently used versioned artifacts until the disk usage is
+// within the quota, the most recently used artifact is always kept. Without a quota all
+// the artifacts but the most recently used are removed. The removed artifacts are
+// returned.
+func (c Cache) Evict() ([]Artifact, error) {
+	artifacts, err := c.Artifacts()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list artifacts: %w", err)
+	}
+	usage, err := c.Usage()
+	if err != nil {
+		return nil, fmt.Errorf("unable to compute disk usage: %w", err)
+	}
+	evicted := []Artifact{}
+	for i := len(artifacts) - 1; i > 0; i-- {
+		if c.Quota > 0 && usage <= c.Quota {
+			break
+		}
+		if err := os.Remove(filepath.Join(c.Dir, artifacts[i].Path)); err != nil {
+			return evicted, fmt.Errorf("unable to remove %s: %w", artifacts[i].Path, err)
+		}
+		usage -= artifacts[i].Size
+		evicted = append(evicted, artifacts[i])
+	}
+	return evicted, nil
+}
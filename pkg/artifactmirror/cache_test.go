@@ -0,0 +1,120 @@
+package artifactmirror
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeArtifact writes a file of the size, relative to the directory, last used at the
+// time.
+func writeArtifact(t *testing.T, dir, path string, size int, used time.Time) {
+	fpath := filepath.Join(dir, path)
+	require.NoError(t, os.MkdirAll(filepath.Dir(fpath), 0755))
+	require.NoError(t, os.WriteFile(fpath, make([]byte, size), 0644))
+	require.NoError(t, os.Chtimes(fpath, used, used))
+}
+
+func TestParseQuota(t *testing.T) {
+	quota, err := ParseQuota("20Gi")
+	require.NoError(t, err)
+	assert.Equal(t, int64(20<<30), quota)
+
+	quota, err = ParseQuota("")
+	require.NoError(t, err)
+	assert.Zero(t, quota)
+
+	_, err = ParseQuota("lots")
+	assert.ErrorContains(t, err, `invalid disk quota "lots"`)
+	_, err = ParseQuota("-1Gi")
+	assert.ErrorContains(t, err, "must be positive")
+}
+
+func TestIsVersioned(t *testing.T) {
+	assert.True(t, IsVersioned("/images/images-amd64-20241010120000.tar"))
+	assert.True(t, IsVersioned("images/images-amd64-20241010120000.tar"))
+	assert.True(t, IsVersioned("images/images-arm64-20241010120000.tar"))
+	assert.False(t, IsVersioned("/images/images-amd64.tar"))
+	assert.False(t, IsVersioned("/images/images-arm64.tar"))
+	assert.False(t, IsVersioned("/bin/k0s"))
+}
+
+func TestCacheEvict(t *testing.T) {
+	now := time.Now()
+	for _, tt := range []struct {
+		name      string
+		quota     int64
+		wantKept  []string
+		wantGone  []string
+		wantUsage int64
+	}{
+		{
+			name:      "within quota",
+			quota:     1000,
+			wantKept:  []string{"images/images-amd64-1.tar", "images/images-amd64-2.tar", "images/images-amd64-3.tar"},
+			wantUsage: 650,
+		},
+		{
+			name:      "least recently used evicted first",
+			quota:     500,
+			wantKept:  []string{"images/images-amd64-1.tar", "images/images-amd64-3.tar"},
+			wantGone:  []string{"images/images-amd64-2.tar"},
+			wantUsage: 450,
+		},
+		{
+			name:      "most recently used kept over quota",
+			quota:     10,
+			wantKept:  []string{"images/images-amd64-3.tar"},
+			wantGone:  []string{"images/images-amd64-1.tar", "images/images-amd64-2.tar"},
+			wantUsage: 150,
+		},
+		{
+			name:      "only the most recent version kept without quota",
+			wantKept:  []string{"images/images-amd64-3.tar"},
+			wantGone:  []string{"images/images-amd64-1.tar", "images/images-amd64-2.tar"},
+			wantUsage: 150,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeArtifact(t, dir, "bin/k0s", 50, now)
+			writeArtifact(t, dir, "images/images-amd64-1.tar", 300, now.Add(-2*time.Hour))
+			writeArtifact(t, dir, "images/images-amd64-2.tar", 200, now.Add(-3*time.Hour))
+			writeArtifact(t, dir, "images/images-amd64-3.tar", 100, now.Add(-time.Hour))
+			writeArtifact(t, dir, "logs/install.log", 1000, now)
+
+			cache := Cache{Dir: dir, Quota: tt.quota}
+			evicted, err := cache.Evict()
+			require.NoError(t, err)
+			assert.Len(t, evicted, len(tt.wantGone))
+			for _, path := range tt.wantKept {
+				assert.FileExists(t, filepath.Join(dir, path))
+			}
+			for _, path := range tt.wantGone {
+				assert.NoFileExists(t, filepath.Join(dir, path))
+			}
+			usage, err := cache.Usage()
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantUsage, usage)
+		})
+	}
+}
+
+func TestCacheTouch(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	writeArtifact(t, dir, "images/images-amd64-1.tar", 10, now.Add(-2*time.Hour))
+	writeArtifact(t, dir, "images/images-amd64-2.tar", 10, now.Add(-time.Hour))
+
+	cache := Cache{Dir: dir}
+	require.NoError(t, cache.Touch("images/images-amd64-1.tar"))
+	artifacts, err := cache.Artifacts()
+	require.NoError(t, err)
+	require.Len(t, artifacts, 2)
+	assert.Equal(t, "images/images-amd64-1.tar", artifacts[0].Path)
+	assert.Equal(t, int64(10), artifacts[0].Size)
+}
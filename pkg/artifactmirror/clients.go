@@ -0,0 +1,106 @@
+package artifactmirror
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Clients restricts the remote clients of the mirror to the nodes of the cluster and to the
+// nodes joining it, which present their join token as a bearer token. No remote client is
+// served before the nodes are first set.
+type Clients struct {
+	mu    sync.RWMutex
+	nodes map[string]bool
+	// ValidateToken returns true if the token is a valid join token, joining nodes are not
+	// served if nil.
+	ValidateToken func(ctx context.Context, token string) (bool, error)
+}
+
+// SetNodes replaces the addresses of the nodes of the cluster.
+func (c *Clients) SetNodes(addresses []string) {
+	nodes := map[string]bool{}
+	for _, addr := range addresses {
+		nodes[addr] = true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nodes = nodes
+}
+
+// Allowed returns true if the request comes from a node of the cluster or carries a valid
+// join token.
+func (c *Clients) Allowed(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	c.mu.RLock()
+	node := c.nodes[host]
+	c.mu.RUnlock()
+	if node {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" || c.ValidateToken == nil {
+		return false
+	}
+	valid, err := c.ValidateToken(r.Context(), token)
+	return err == nil && valid
+}
+
+// DiscoverNodes returns the internal addresses of the nodes of the cluster.
+func DiscoverNodes(ctx context.Context, cli client.Client) ([]string, error) {
+	var nodes corev1.NodeList
+	if err := cli.List(ctx, &nodes); err != nil {
+		return nil, fmt.Errorf("unable to list nodes: %w", err)
+	}
+	addresses := []string{}
+	for _, node := range nodes.Items {
+		for _, addr := range node.Status.Addresses {
+			if addr.Type == corev1.NodeInternalIP {
+				addresses = append(addresses, addr.Address)
+			}
+		}
+	}
+	return addresses, nil
+}
+
+// ValidateJoinToken returns true if the token, in the id.secret form, matches a bootstrap
+// token of the cluster that has not expired.
+func ValidateJoinToken(ctx context.Context, cli client.Client, token string) (bool, error) {
+	id, secret, ok := strings.Cut(token, ".")
+	if !ok || id == "" || secret == "" {
+		return false, nil
+	}
+	var bootstrap corev1.Secret
+	key := client.ObjectKey{Namespace: metav1.NamespaceSystem, Name: "bootstrap-token-" + id}
+	if err := cli.Get(ctx, key, &bootstrap); k8serrors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("unable to get bootstrap token %s: %w", id, err)
+	}
+	if bootstrap.Type != corev1.SecretTypeBootstrapToken {
+		return false, nil
+	}
+	if subtle.ConstantTimeCompare(bootstrap.Data["token-secret"], []byte(secret)) != 1 {
+		return false, nil
+	}
+	if expiration := string(bootstrap.Data["expiration"]); expiration != "" {
+		expires, err := time.Parse(time.RFC3339, expiration)
+		if err != nil || time.Now().After(expires) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,98 @@
+package artifactmirror
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestServerClients(t *testing.T) {
+	dir := t.TempDir()
+	writeArtifact(t, dir, "bin/k0s", 10, time.Now())
+	clients := &Clients{
+		ValidateToken: func(_ context.Context, token string) (bool, error) {
+			return token == "abcdef.0123456789abcdef", nil
+		},
+	}
+	s := &Server{Cache: Cache{Dir: dir}, Clients: clients}
+
+	// nothing but the node itself is served before the nodes are known.
+	assert.Equal(t, http.StatusForbidden, get(s, "/bin/k0s", "10.0.0.2:4321").Code)
+	assert.Equal(t, http.StatusOK, get(s, "/bin/k0s", "127.0.0.1:4321").Code)
+
+	clients.SetNodes([]string{"10.0.0.2"})
+	assert.Equal(t, http.StatusOK, get(s, "/bin/k0s", "10.0.0.2:4321").Code)
+	assert.Equal(t, http.StatusForbidden, get(s, "/bin/k0s", "192.168.0.9:4321").Code)
+
+	// joining nodes present their join token.
+	for token, want := range map[string]int{
+		"abcdef.0123456789abcdef": http.StatusOK,
+		"abcdef.wrong":            http.StatusForbidden,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/bin/k0s", nil)
+		req.RemoteAddr = "192.168.0.9:4321"
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		assert.Equal(t, want, rec.Code, token)
+	}
+}
+
+func TestDiscoverNodes(t *testing.T) {
+	cli := fake.NewClientBuilder().WithObjects(
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "controller-1"},
+			Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: "controller-1"},
+				{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+			}},
+		},
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "worker-1"},
+			Status:     corev1.NodeStatus{Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.2"}}},
+		},
+	).Build()
+	addresses, err := DiscoverNodes(context.Background(), cli)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"10.0.0.1", "10.0.0.2"}, addresses)
+}
+
+func TestValidateJoinToken(t *testing.T) {
+	token := func(id, expiration string) *corev1.Secret {
+		data := map[string][]byte{"token-id": []byte(id), "token-secret": []byte("0123456789abcdef")}
+		if expiration != "" {
+			data["expiration"] = []byte(expiration)
+		}
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "bootstrap-token-" + id, Namespace: metav1.NamespaceSystem},
+			Type:       corev1.SecretTypeBootstrapToken,
+			Data:       data,
+		}
+	}
+	cli := fake.NewClientBuilder().WithObjects(
+		token("abcdef", ""),
+		token("ghijkl", time.Now().Add(time.Hour).Format(time.RFC3339)),
+		token("mnopqr", time.Now().Add(-time.Hour).Format(time.RFC3339)),
+	).Build()
+
+	for tok, want := range map[string]bool{
+		"abcdef.0123456789abcdef": true,
+		"ghijkl.0123456789abcdef": true,
+		"mnopqr.0123456789abcdef": false,
+		"abcdef.fedcba9876543210": false,
+		"stuvwx.0123456789abcdef": false,
+		"invalid":                 false,
+	} {
+		valid, err := ValidateJoinToken(context.Background(), cli, tok)
+		require.NoError(t, err)
+		assert.Equal(t, want, valid, tok)
+	}
+}
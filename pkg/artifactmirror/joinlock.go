@@ -0,0 +1,86 @@
+package artifactmirror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/clusterlock"
+)
+
+// JoinLockPath is the path joining controllers hold the cluster lock through. They can not
+// reach the cluster before they joined it, the mirror holds the lock on their behalf.
+const JoinLockPath = "/.join-lock"
+
+// serveJoinLock holds the cluster lock for the node named in the request. A conflict with
+// the holder of the lock is returned if another node or operation holds it.
+func (s *Server) serveJoinLock(w http.ResponseWriter, r *http.Request, local bool) {
+	if s.HoldJoinLock == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !local && s.Clients != nil && !s.Clients.Allowed(r) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	node := r.URL.Query().Get("node")
+	if node == "" {
+		http.Error(w, "node is required", http.StatusBadRequest)
+		return
+	}
+	err := s.HoldJoinLock(r.Context(), node)
+	var held *clusterlock.HeldError
+	if errors.As(err, &held) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(held.Holder)
+		return
+	} else if err != nil {
+		s.logf("unable to hold the cluster lock for %s: %v", node, err)
+		s.Metrics.error("join-lock")
+		http.Error(w, fmt.Sprintf("unable to hold the cluster lock: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HoldJoinLock asks the mirror at the address to hold the cluster lock for the joining
+// node, authenticated with its join token. The node asks again before the lock expires.
+// A clusterlock.HeldError is returned if another node or operation holds it.
+func HoldJoinLock(ctx context.Context, mirrorURL, token, node string) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	u := fmt.Sprintf("%s%s?node=%s", strings.TrimSuffix(mirrorURL, "/"), JoinLockPath, url.QueryEscape(node))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, nil)
+	if err != nil {
+		return fmt.Errorf("unable to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to reach the artifact mirror: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusConflict:
+		var holder clusterlock.Holder
+		if err := json.NewDecoder(resp.Body).Decode(&holder); err != nil {
+			return fmt.Errorf("unable to decode the holder of the cluster lock: %w", err)
+		}
+		return &clusterlock.HeldError{Holder: holder}
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("unable to hold the cluster lock, status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,116 @@
+package artifactmirror
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// MetricsPath is the path the mirror exposes its prometheus metrics on, to all clients.
+const MetricsPath = "/metrics"
+
+// Metrics counts the requests served by the mirror, how many were served from the local
+// artifacts and how many required fetching the artifact from a peer.
+type Metrics struct {
+	handler       http.Handler
+	requests      *prometheus.CounterVec
+	servedBytes   *prometheus.CounterVec
+	cacheRequests *prometheus.CounterVec
+	peerFetches   *prometheus.CounterVec
+	evictions     prometheus.Counter
+	errors        *prometheus.CounterVec
+}
+
+// NewMetrics returns the metrics of a mirror, registered in their own registry along
+// with the go runtime and process metrics.
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "embedded_cluster_local_artifact_mirror_requests_total",
+			Help: "Number of requests served, by client (local or peer) and status code.",
+		}, []string{"client", "code"}),
+		servedBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "embedded_cluster_local_artifact_mirror_served_bytes_total",
+			Help: "Number of bytes served, by client (local or peer).",
+		}, []string{"client"}),
+		cacheRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "embedded_cluster_local_artifact_mirror_cache_requests_total",
+			Help: "Number of requests for binaries, charts and images, by result (hit or miss).",
+		}, []string{"result"}),
+		peerFetches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "embedded_cluster_local_artifact_mirror_peer_fetches_total",
+			Help: "Number of artifacts missing locally fetched from the peers, by result (success or failure).",
+		}, []string{"result"}),
+		evictions: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "embedded_cluster_local_artifact_mirror_evictions_total",
+			Help: "Number of artifacts evicted to keep the mirror within its disk quota.",
+		}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "embedded_cluster_local_artifact_mirror_errors_total",
+			Help: "Number of errors, by operation (fetch, evict, touch or status).",
+		}, []string{"operation"}),
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		m.requests, m.servedBytes, m.cacheRequests, m.peerFetches, m.evictions, m.errors,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	m.handler = promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	return m
+}
+
+// Handler returns the handler exposing the metrics.
+func (m *Metrics) Handler() http.Handler {
+	return m.handler
+}
+
+// The methods below are no-ops on nil metrics so the server works without them.
+
+func (m *Metrics) request(client string, code int, bytes int64) {
+	if m == nil {
+		return
+	}
+	m.requests.WithLabelValues(client, strconv.Itoa(code)).Inc()
+	m.servedBytes.WithLabelValues(client).Add(float64(bytes))
+}
+
+func (m *Metrics) cacheRequest(hit bool) {
+	if m == nil {
+		return
+	}
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cacheRequests.WithLabelValues(result).Inc()
+}
+
+func (m *Metrics) peerFetch(err error) {
+	if m == nil {
+		return
+	}
+	if err != nil {
+		m.peerFetches.WithLabelValues("failure").Inc()
+		m.errors.WithLabelValues("fetch").Inc()
+		return
+	}
+	m.peerFetches.WithLabelValues("success").Inc()
+}
+
+func (m *Metrics) evicted(count int) {
+	if m == nil {
+		return
+	}
+	m.evictions.Add(float64(count))
+}
+
+func (m *Metrics) error(operation string) {
+	if m == nil {
+		return
+	}
+	m.errors.WithLabelValues(operation).Inc()
+}
@@ -0,0 +1,179 @@
+package artifactmirror
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// peerBackoff is how long a peer that failed to serve an artifact is tried last.
+const peerBackoff = time.Minute
+
+// controlPlaneLabel is the label of the controller nodes.
+const controlPlaneLabel = "node-role.kubernetes.io/control-plane"
+
+// PeerStatus reports the address of a peer and when it last failed.
+type PeerStatus struct {
+	Address    string    `json:"address"`
+	Healthy    bool      `json:"healthy"`
+	LastError  string    `json:"lastError,omitempty"`
+	LastFailed time.Time `json:"lastFailed,omitempty"`
+}
+
+// Peers fetches the artifacts missing locally from the mirrors of the controllers. Peers
+// are tried in order, the ones that failed recently are tried last.
+type Peers struct {
+	mu        sync.Mutex
+	addresses []string
+	failures  map[string]PeerStatus
+	client    *http.Client
+}
+
+// NewPeers returns the peers at the addresses, host and port of their mirrors.
+func NewPeers(addresses []string) *Peers {
+	p := &Peers{failures: map[string]PeerStatus{}, client: &http.Client{}}
+	p.Set(addresses)
+	return p
+}
+
+// Set replaces the addresses of the peers.
+func (p *Peers) Set(addresses []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.addresses = append([]string{}, addresses...)
+}
+
+// Status returns the status of the peers, in order.
+func (p *Peers) Status() []PeerStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	statuses := []PeerStatus{}
+	for _, addr := range p.addresses {
+		status, failed := p.failures[addr]
+		if !failed || time.Since(status.LastFailed) > peerBackoff {
+			status.Healthy = true
+		}
+		status.Address = addr
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// ordered returns the addresses of the peers, the ones that failed recently last.
+func (p *Peers) ordered() []string {
+	statuses := p.Status()
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return statuses[i].Healthy && !statuses[j].Healthy
+	})
+	addresses := []string{}
+	for _, status := range statuses {
+		addresses = append(addresses, status.Address)
+	}
+	return addresses
+}
+
+// record records the result of a fetch from the peer.
+func (p *Peers) record(addr string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil {
+		delete(p.failures, addr)
+		return
+	}
+	p.failures[addr] = PeerStatus{LastError: err.Error(), LastFailed: time.Now()}
+}
+
+// Fetch downloads the artifact at the path, relative to the mirror directory, from the
+// first peer serving it and stores it in the directory. The artifact is written to a
+// temporary file first so a partial download is never served. The address of the peer
+// is returned.
+func (p *Peers) Fetch(ctx context.Context, path, dir string) (string, error) {
+	addresses := p.ordered()
+	if len(addresses) == 0 {
+		return "", fmt.Errorf("no peers")
+	}
+	var lastErr error
+	for _, addr := range addresses {
+		err := p.fetchFrom(ctx, addr, path, dir)
+		p.record(addr, err)
+		if err == nil {
+			return addr, nil
+		}
+		lastErr = fmt.Errorf("%s: %w", addr, err)
+	}
+	return "", fmt.Errorf("unable to fetch %s from peers: %w", path, lastErr)
+}
+
+// fetchFrom downloads the artifact from the peer.
+func (p *Peers) fetchFrom(ctx context.Context, addr, path, dir string) error {
+	url := fmt.Sprintf("http://%s/%s", addr, filepath.ToSlash(path))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	dst := filepath.Join(dir, path)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("unable to create directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+"-")
+	if err != nil {
+		return fmt.Errorf("unable to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to download: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to write: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("unable to change permissions: %w", err)
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// DiscoverPeers returns the addresses of the mirrors of the controller nodes, other than
+// the node named self. All the mirrors are served on the same port.
+func DiscoverPeers(ctx context.Context, cli client.Client, self string, port int) ([]string, error) {
+	var nodes corev1.NodeList
+	if err := cli.List(ctx, &nodes, client.HasLabels{controlPlaneLabel}); err != nil {
+		return nil, fmt.Errorf("unable to list controller nodes: %w", err)
+	}
+	sort.Slice(nodes.Items, func(i, j int) bool {
+		return nodes.Items[i].Name < nodes.Items[j].Name
+	})
+	addresses := []string{}
+	for _, node := range nodes.Items {
+		if node.Name == self {
+			continue
+		}
+		for _, addr := range node.Status.Addresses {
+			if addr.Type == corev1.NodeInternalIP {
+				addresses = append(addresses, net.JoinHostPort(addr.Address, strconv.Itoa(port)))
+				break
+			}
+		}
+	}
+	return addresses, nil
+}
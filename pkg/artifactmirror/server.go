@@ -0,0 +1,218 @@
+package artifactmirror
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// StatusPath is the path the mirror reports its status on, to local clients only.
+const StatusPath = "/.status"
+
+// Status reports the artifacts kept by the mirror, its disk usage and its peers.
+type Status struct {
+	Usage     int64        `json:"usage"`
+	Quota     int64        `json:"quota"`
+	Artifacts []Artifact   `json:"artifacts"`
+	Peers     []PeerStatus `json:"peers"`
+}
+
+// Server serves the mirror directory. Local clients are served the whole directory and
+// the files missing locally are fetched from the peers. Other nodes, the peers of this
+// mirror, are only served the binaries, charts and images and nothing is fetched for
+// them so requests never bounce between mirrors. The metrics are served to all clients.
+type Server struct {
+	Cache Cache
+	// Peers are the mirrors the missing artifacts are fetched from, may be nil.
+	Peers *Peers
+	// Clients restricts the remote clients served, all are served if nil.
+	Clients *Clients
+	// Logf logs the fetches and the evictions.
+	Logf func(format string, args ...interface{})
+	// Metrics counts the requests and the fetches, may be nil.
+	Metrics *Metrics
+	// HoldJoinLock holds the cluster lock for a joining node, the join lock is not served
+	// if nil.
+	HoldJoinLock func(ctx context.Context, node string) error
+
+	fetchMu sync.Mutex
+}
+
+// Status returns the status of the mirror.
+func (s *Server) Status() (Status, error) {
+	usage, err := s.Cache.Usage()
+	if err != nil {
+		return Status{}, err
+	}
+	artifacts, err := s.Cache.Artifacts()
+	if err != nil {
+		return Status{}, err
+	}
+	status := Status{Usage: usage, Quota: s.Cache.Quota, Artifacts: artifacts, Peers: []PeerStatus{}}
+	if s.Peers != nil {
+		status.Peers = s.Peers.Status()
+	}
+	return status, nil
+}
+
+// Evict evicts the least recently used artifacts exceeding the quota.
+func (s *Server) Evict() error {
+	evicted, err := s.Cache.Evict()
+	for _, artifact := range evicted {
+		s.logf("evicted %s (%d bytes)", artifact.Path, artifact.Size)
+	}
+	s.Metrics.evicted(len(evicted))
+	if err != nil {
+		s.Metrics.error("evict")
+	}
+	return err
+}
+
+// ServeHTTP serves the mirror directory and its metrics, scrapes are not counted as
+// requests.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Metrics != nil && path.Clean("/"+r.URL.Path) == MetricsPath {
+		s.Metrics.Handler().ServeHTTP(w, r)
+		return
+	}
+	local := isLoopback(r.RemoteAddr)
+	client := "peer"
+	if local {
+		client = "local"
+	}
+	rec := &responseRecorder{ResponseWriter: w, code: http.StatusOK}
+	defer func() {
+		s.Metrics.request(client, rec.code, rec.bytes)
+	}()
+	s.serve(rec, r, local)
+}
+
+// serve serves the request, local is true if it comes from the node itself.
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, local bool) {
+	upath := path.Clean("/" + r.URL.Path)
+	if upath == StatusPath {
+		if !local {
+			http.NotFound(w, r)
+			return
+		}
+		s.serveStatus(w)
+		return
+	}
+	if upath == JoinLockPath {
+		s.serveJoinLock(w, r, local)
+		return
+	}
+	if !local && (!isServedPath(upath) || (r.Method != http.MethodGet && r.Method != http.MethodHead)) {
+		http.NotFound(w, r)
+		return
+	}
+	if !local && s.Clients != nil && !s.Clients.Allowed(r) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	fpath := filepath.Join(s.Cache.Dir, filepath.FromSlash(upath))
+	if isServedPath(upath) {
+		_, err := os.Stat(fpath)
+		s.Metrics.cacheRequest(err == nil)
+		if os.IsNotExist(err) && local {
+			s.fetch(upath, fpath, r)
+		}
+	}
+	if IsVersioned(upath) {
+		if err := s.Cache.Touch(upath); err != nil && !os.IsNotExist(err) {
+			s.logf("unable to mark %s as used: %v", upath, err)
+			s.Metrics.error("touch")
+		}
+	}
+	http.FileServer(http.Dir(s.Cache.Dir)).ServeHTTP(w, r)
+}
+
+// fetch fetches the missing artifact from the peers, one artifact at a time so the same
+// artifact is not downloaded twice. Failures are logged and the request is served as if
+// the artifact had never existed.
+func (s *Server) fetch(upath, fpath string, r *http.Request) {
+	if s.Peers == nil {
+		return
+	}
+	s.fetchMu.Lock()
+	defer s.fetchMu.Unlock()
+	if _, err := os.Stat(fpath); err == nil {
+		return
+	}
+	rel := strings.TrimPrefix(upath, "/")
+	peer, err := s.Peers.Fetch(r.Context(), rel, s.Cache.Dir)
+	s.Metrics.peerFetch(err)
+	if err != nil {
+		s.logf("unable to fetch missing %s: %v", rel, err)
+		return
+	}
+	s.logf("fetched missing %s from %s", rel, peer)
+	if err := s.Evict(); err != nil {
+		s.logf("unable to evict artifacts: %v", err)
+	}
+}
+
+// serveStatus writes the status of the mirror as json.
+func (s *Server) serveStatus(w http.ResponseWriter) {
+	status, err := s.Status()
+	if err != nil {
+		s.Metrics.error("status")
+		http.Error(w, fmt.Sprintf("unable to read status: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+// responseRecorder records the status code and the number of bytes of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	code  int
+	bytes int64
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(data)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
+
+// isServedPath returns true if the path is a file in one of the directories served to
+// the peers.
+func isServedPath(upath string) bool {
+	for _, dir := range Dirs {
+		if strings.HasPrefix(upath, "/"+dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// isLoopback returns true if the remote address of a request is a loopback address.
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
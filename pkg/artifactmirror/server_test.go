@@ -0,0 +1,170 @@
+package artifactmirror
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// get serves a GET request for the path from the remote address.
+func get(s *Server, path, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = remoteAddr
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestServerFailover(t *testing.T) {
+	now := time.Now()
+	peerDir := t.TempDir()
+	writeArtifact(t, peerDir, "images/images-amd64-2.tar", 100, now)
+	peer := httptest.NewServer(&Server{Cache: Cache{Dir: peerDir}})
+	defer peer.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	dir := t.TempDir()
+	writeArtifact(t, dir, "images/images-amd64-1.tar", 100, now.Add(-time.Hour))
+	peers := NewPeers([]string{strings.TrimPrefix(down.URL, "http://"), strings.TrimPrefix(peer.URL, "http://")})
+	s := &Server{Cache: Cache{Dir: dir, Quota: 150}, Peers: peers}
+
+	rec := get(s, "/images/images-amd64-2.tar", "127.0.0.1:4321")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 100, rec.Body.Len())
+	assert.FileExists(t, filepath.Join(dir, "images/images-amd64-2.tar"))
+	// the previous version is evicted to keep the mirror within the quota.
+	assert.NoFileExists(t, filepath.Join(dir, "images/images-amd64-1.tar"))
+
+	statuses := peers.Status()
+	require.Len(t, statuses, 2)
+	assert.False(t, statuses[0].Healthy)
+	assert.NotEmpty(t, statuses[0].LastError)
+	assert.True(t, statuses[1].Healthy)
+	// the failed peer is tried last.
+	assert.Equal(t, []string{statuses[1].Address, statuses[0].Address}, peers.ordered())
+
+	rec = get(s, "/images/images-amd64-3.tar", "127.0.0.1:4321")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestServerRemoteClients(t *testing.T) {
+	dir := t.TempDir()
+	writeArtifact(t, dir, "bin/k0s", 10, time.Now())
+	writeArtifact(t, dir, "support/host-support-bundle.yaml", 10, time.Now())
+	s := &Server{Cache: Cache{Dir: dir}, Peers: NewPeers([]string{"10.0.0.3:50000"})}
+
+	assert.Equal(t, http.StatusOK, get(s, "/bin/k0s", "10.0.0.2:4321").Code)
+	assert.Equal(t, http.StatusNotFound, get(s, "/support/host-support-bundle.yaml", "10.0.0.2:4321").Code)
+	assert.Equal(t, http.StatusNotFound, get(s, StatusPath, "10.0.0.2:4321").Code)
+	// missing artifacts are not fetched for other mirrors.
+	assert.Equal(t, http.StatusNotFound, get(s, "/bin/missing", "10.0.0.2:4321").Code)
+	assert.Empty(t, s.Peers.Status()[0].LastError)
+
+	assert.Equal(t, http.StatusOK, get(s, "/support/host-support-bundle.yaml", "127.0.0.1:4321").Code)
+}
+
+func TestServerStatus(t *testing.T) {
+	dir := t.TempDir()
+	writeArtifact(t, dir, "bin/k0s", 10, time.Now())
+	writeArtifact(t, dir, "images/images-amd64-1.tar", 20, time.Now())
+	s := &Server{Cache: Cache{Dir: dir, Quota: 1 << 30}, Peers: NewPeers([]string{"10.0.0.3:50000"})}
+
+	rec := get(s, StatusPath, "[::1]:4321")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var status Status
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	assert.Equal(t, int64(30), status.Usage)
+	assert.Equal(t, int64(1<<30), status.Quota)
+	require.Len(t, status.Artifacts, 1)
+	assert.Equal(t, "images/images-amd64-1.tar", status.Artifacts[0].Path)
+	require.Len(t, status.Peers, 1)
+	assert.Equal(t, "10.0.0.3:50000", status.Peers[0].Address)
+	assert.True(t, status.Peers[0].Healthy)
+}
+
+func TestDiscoverPeers(t *testing.T) {
+	node := func(name, ip string, controller bool) *corev1.Node {
+		n := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{}},
+			Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: name},
+				{Type: corev1.NodeInternalIP, Address: ip},
+			}},
+		}
+		if controller {
+			n.Labels[controlPlaneLabel] = "true"
+		}
+		return n
+	}
+	cli := fake.NewClientBuilder().WithObjects(
+		node("controller-2", "10.0.0.2", true),
+		node("controller-1", "10.0.0.1", true),
+		node("controller-3", "fd00::3", true),
+		node("worker-1", "10.0.0.4", false),
+	).Build()
+
+	peers, err := DiscoverPeers(context.Background(), cli, "controller-2", 50000)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1:50000", "[fd00::3]:50000"}, peers)
+}
+
+func TestPeersFetchKeepsPartialDownloadsHidden(t *testing.T) {
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		_, _ = w.Write([]byte("truncated"))
+	}))
+	defer peer.Close()
+
+	dir := t.TempDir()
+	_, err := NewPeers([]string{strings.TrimPrefix(peer.URL, "http://")}).Fetch(context.Background(), "bin/k0s", dir)
+	assert.Error(t, err)
+	entries, err := os.ReadDir(filepath.Join(dir, "bin"))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestServerMetrics(t *testing.T) {
+	peerDir := t.TempDir()
+	writeArtifact(t, peerDir, "bin/k0s", 100, time.Now())
+	peer := httptest.NewServer(&Server{Cache: Cache{Dir: peerDir}})
+	defer peer.Close()
+
+	dir := t.TempDir()
+	writeArtifact(t, dir, "charts/admin-console.tgz", 10, time.Now())
+	metrics := NewMetrics()
+	s := &Server{Cache: Cache{Dir: dir}, Peers: NewPeers([]string{strings.TrimPrefix(peer.URL, "http://")}), Metrics: metrics}
+
+	assert.Equal(t, http.StatusOK, get(s, "/charts/admin-console.tgz", "10.0.0.2:4321").Code)
+	assert.Equal(t, http.StatusOK, get(s, "/bin/k0s", "127.0.0.1:4321").Code)
+	assert.Equal(t, http.StatusNotFound, get(s, "/bin/missing", "127.0.0.1:4321").Code)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.requests.WithLabelValues("peer", "200")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.requests.WithLabelValues("local", "200")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.requests.WithLabelValues("local", "404")))
+	assert.Equal(t, float64(10), testutil.ToFloat64(metrics.servedBytes.WithLabelValues("peer")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.cacheRequests.WithLabelValues("hit")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.cacheRequests.WithLabelValues("miss")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.peerFetches.WithLabelValues("success")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.peerFetches.WithLabelValues("failure")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.errors.WithLabelValues("fetch")))
+
+	// scrapes are served to peers and not counted as requests.
+	rec := get(s, MetricsPath, "10.0.0.2:4321")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `embedded_cluster_local_artifact_mirror_cache_requests_total{result="hit"} 1`)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.requests.WithLabelValues("peer", "200")))
+}
@@ -0,0 +1,212 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PKIDir is the directory where k0s stores the cluster certificates on controllers.
+const PKIDir = "/var/lib/k0s/pki"
+
+// ExpiryWarningThreshold is how close to the expiration date a certificate must be
+// before we warn about it.
+const ExpiryWarningThreshold = 30 * 24 * time.Hour
+
+// Certificate holds the expiration information of a certificate.
+type Certificate struct {
+	// Name identifies where the certificate comes from (a file or an endpoint).
+	Name     string
+	Subject  string
+	NotAfter time.Time
+	IsCA     bool
+}
+
+// ExpiresWithin returns true if the certificate expires within the provided duration
+// from now (or if it has already expired).
+func (c Certificate) ExpiresWithin(now time.Time, d time.Duration) bool {
+	return c.NotAfter.Before(now.Add(d))
+}
+
+// String returns a human readable description of the certificate expiration.
+func (c Certificate) String() string {
+	return fmt.Sprintf("%s (expires %s)", c.Name, c.NotAfter.UTC().Format(time.RFC3339))
+}
+
+// Expiring returns the certificates that expire within the provided duration from now.
+func Expiring(certs []Certificate, now time.Time, d time.Duration) []Certificate {
+	var expiring []Certificate
+	for _, cert := range certs {
+		if cert.ExpiresWithin(now, d) {
+			expiring = append(expiring, cert)
+		}
+	}
+	return expiring
+}
+
+// FromDir reads all the certificates (*.crt files) found in the provided directory and
+// its subdirectories.
+func FromDir(dir string) ([]Certificate, error) {
+	var certs []Certificate
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".crt" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("unable to read %s: %w", path, err)
+		}
+		cert, err := parsePEM(data)
+		if err != nil {
+			return fmt.Errorf("unable to parse %s: %w", path, err)
+		}
+		certs = append(certs, newCertificate(path, cert))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
+
+// dialTLS returns the certificate served on the provided address. The certificate is
+// not verified, we are only interested in its expiration.
+var dialTLS = func(ctx context.Context, addr string) (*x509.Certificate, error) {
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: 5 * time.Second},
+		Config:    &tls.Config{InsecureSkipVerify: true},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	peers := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("no certificate served")
+	}
+	return peers[0], nil
+}
+
+// FromCluster returns the cluster CA certificate and the certificates served by the
+// kube-apiservers and the kubelets. Endpoints that can't be reached are reported in the
+// returned errors but do not prevent the other certificates from being returned.
+func FromCluster(ctx context.Context, cli client.Client) ([]Certificate, []error) {
+	var certs []Certificate
+	var errs []error
+
+	var cm corev1.ConfigMap
+	nsn := client.ObjectKey{Namespace: "kube-system", Name: "kube-root-ca.crt"}
+	if err := cli.Get(ctx, nsn, &cm); err != nil {
+		errs = append(errs, fmt.Errorf("unable to get cluster ca: %w", err))
+	} else if cert, err := parsePEM([]byte(cm.Data["ca.crt"])); err != nil {
+		errs = append(errs, fmt.Errorf("unable to parse cluster ca: %w", err))
+	} else {
+		certs = append(certs, newCertificate("cluster ca", cert))
+	}
+
+	var nodes corev1.NodeList
+	if err := cli.List(ctx, &nodes); err != nil {
+		return certs, append(errs, fmt.Errorf("unable to list nodes: %w", err))
+	}
+	for _, node := range nodes.Items {
+		address := nodeAddress(node)
+		if address == "" {
+			continue
+		}
+		endpoints := map[string]string{
+			fmt.Sprintf("kubelet %s", node.Name): net.JoinHostPort(address, "10250"),
+		}
+		if node.Labels["node-role.kubernetes.io/control-plane"] == "true" {
+			endpoints[fmt.Sprintf("kube-apiserver %s", node.Name)] = net.JoinHostPort(address, "6443")
+		}
+		for name, addr := range endpoints {
+			cert, err := dialTLS(ctx, addr)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("unable to get %s certificate: %w", name, err))
+				continue
+			}
+			certs = append(certs, newCertificate(name, cert))
+		}
+	}
+
+	sort.Slice(certs, func(i, j int) bool { return certs[i].Name < certs[j].Name })
+	return certs, errs
+}
+
+// BackupLeafCertificates moves all certificates that are not certificate authorities,
+// and their keys, from the pki directory into the backup directory. k0s generates new
+// certificates, signed by the existing authorities, for the missing ones on start.
+func BackupLeafCertificates(pkiDir, backupDir string) ([]string, error) {
+	certs, err := FromDir(pkiDir)
+	if err != nil {
+		return nil, err
+	}
+	var moved []string
+	for _, cert := range certs {
+		if cert.IsCA {
+			continue
+		}
+		crt, err := filepath.Rel(pkiDir, cert.Name)
+		if err != nil {
+			return moved, fmt.Errorf("unable to get relative path for %s: %w", cert.Name, err)
+		}
+		key := strings.TrimSuffix(crt, ".crt") + ".key"
+		for _, name := range []string{crt, key} {
+			src := filepath.Join(pkiDir, name)
+			if _, err := os.Stat(src); err != nil {
+				continue
+			}
+			dst := filepath.Join(backupDir, name)
+			if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+				return moved, fmt.Errorf("unable to create backup directory: %w", err)
+			}
+			if err := os.Rename(src, dst); err != nil {
+				return moved, fmt.Errorf("unable to move %s: %w", src, err)
+			}
+		}
+		moved = append(moved, crt)
+	}
+	return moved, nil
+}
+
+func nodeAddress(node corev1.Node) string {
+	for _, addr := range node.Status.Addresses {
+		if addr.Type == corev1.NodeInternalIP {
+			return addr.Address
+		}
+	}
+	return ""
+}
+
+func parsePEM(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func newCertificate(name string, cert *x509.Certificate) Certificate {
+	return Certificate{
+		Name:     name,
+		Subject:  cert.Subject.CommonName,
+		NotAfter: cert.NotAfter,
+		IsCA:     cert.IsCA,
+	}
+}
@@ -0,0 +1,138 @@
+package certs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func writeCert(t *testing.T, path string, d time.Duration) {
+	builder, err := NewBuilder(WithDuration(d))
+	require.NoError(t, err)
+	crt, key, err := builder.Generate()
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(crt), 0644))
+	require.NoError(t, os.WriteFile(path[:len(path)-len(".crt")]+".key", []byte(key), 0600))
+}
+
+func writeCA(t *testing.T, path string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tpl := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(10 * 365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tpl, &tpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, data, 0644))
+}
+
+func TestFromDir(t *testing.T) {
+	dir := t.TempDir()
+	writeCA(t, filepath.Join(dir, "ca.crt"))
+	writeCert(t, filepath.Join(dir, "server.crt"), 365*24*time.Hour)
+	writeCert(t, filepath.Join(dir, "etcd", "peer.crt"), 10*24*time.Hour)
+
+	found, err := FromDir(dir)
+	require.NoError(t, err)
+	require.Len(t, found, 3)
+
+	expiring := Expiring(found, time.Now(), ExpiryWarningThreshold)
+	require.Len(t, expiring, 1)
+	assert.Equal(t, filepath.Join(dir, "etcd", "peer.crt"), expiring[0].Name)
+	assert.False(t, expiring[0].IsCA)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "invalid.crt"), []byte("invalid"), 0644))
+	_, err = FromDir(dir)
+	assert.Error(t, err)
+}
+
+func TestBackupLeafCertificates(t *testing.T) {
+	dir := t.TempDir()
+	backup := filepath.Join(t.TempDir(), "backup")
+	writeCA(t, filepath.Join(dir, "ca.crt"))
+	writeCert(t, filepath.Join(dir, "server.crt"), time.Hour)
+	writeCert(t, filepath.Join(dir, "etcd", "peer.crt"), time.Hour)
+
+	moved, err := BackupLeafCertificates(dir, backup)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"server.crt", filepath.Join("etcd", "peer.crt")}, moved)
+
+	assert.FileExists(t, filepath.Join(dir, "ca.crt"))
+	for _, name := range []string{"server.crt", "server.key", "etcd/peer.crt", "etcd/peer.key"} {
+		assert.NoFileExists(t, filepath.Join(dir, name))
+		assert.FileExists(t, filepath.Join(backup, name))
+	}
+}
+
+func TestFromCluster(t *testing.T) {
+	builder, err := NewBuilder(WithDuration(24 * time.Hour))
+	require.NoError(t, err)
+	crt, _, err := builder.Generate()
+	require.NoError(t, err)
+	cert, err := parsePEM([]byte(crt))
+	require.NoError(t, err)
+
+	original := dialTLS
+	defer func() { dialTLS = original }()
+	var dialed []string
+	dialTLS = func(ctx context.Context, addr string) (*x509.Certificate, error) {
+		dialed = append(dialed, addr)
+		return cert, nil
+	}
+
+	cli := fake.NewClientBuilder().WithObjects(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "kube-root-ca.crt", Namespace: "kube-system"},
+			Data:       map[string]string{"ca.crt": crt},
+		},
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "controller",
+				Labels: map[string]string{"node-role.kubernetes.io/control-plane": "true"},
+			},
+			Status: corev1.NodeStatus{
+				Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.1"}},
+			},
+		},
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "worker"},
+			Status: corev1.NodeStatus{
+				Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.2"}},
+			},
+		},
+	).Build()
+
+	found, errs := FromCluster(context.Background(), cli)
+	assert.Empty(t, errs)
+	assert.ElementsMatch(t, []string{"10.0.0.1:10250", "10.0.0.1:6443", "10.0.0.2:10250"}, dialed)
+
+	var names []string
+	for _, cert := range found {
+		names = append(names, cert.Name)
+	}
+	assert.Equal(t, []string{"cluster ca", "kube-apiserver controller", "kubelet controller", "kubelet worker"}, names)
+	assert.Len(t, Expiring(found, time.Now(), ExpiryWarningThreshold), 4)
+}
@@ -0,0 +1,229 @@
+// Package clusterlock guards the operations changing the cluster as a whole, as upgrades
+// and controller joins, so they are not run from two nodes at the same time. The lock is a
+// Lease renewed while the operation runs, a lock left behind by a command that crashed
+// expires on its own.
+package clusterlock
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Namespace and Name identify the lease used as the lock.
+	Namespace = "kube-system"
+	Name      = "embedded-cluster-operation"
+	// OperationAnnotation is the lease annotation holding the operation being run.
+	OperationAnnotation = "replicated.com/operation"
+	// DefaultDuration is how long the lock is held for without being renewed. It is
+	// renewed every third of it.
+	DefaultDuration = time.Minute
+)
+
+// Holder describes who holds the lock.
+type Holder struct {
+	Identity   string    `json:"identity"`
+	Operation  string    `json:"operation"`
+	AcquiredAt time.Time `json:"acquiredAt"`
+	RenewedAt  time.Time `json:"renewedAt"`
+}
+
+// HeldError is returned when the lock is held by another node.
+type HeldError struct {
+	Holder Holder
+}
+
+func (e *HeldError) Error() string {
+	return fmt.Sprintf(
+		"%s is running %s on the cluster since %s, wait for it to finish and try again",
+		e.Holder.Identity, e.Holder.Operation, e.Holder.AcquiredAt.UTC().Format(time.RFC3339),
+	)
+}
+
+// Lock is a lock held on the cluster. It is renewed in the background until released.
+type Lock struct {
+	cli      client.Client
+	identity string
+	duration time.Duration
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// Acquire acquires the lock for the operation on behalf of this host. The lock is taken
+// over once expired, and acquired again if this host already holds it, as when a command
+// is run again after crashing or when a joining controller takes over the lock held for it
+// while it joined. A HeldError is returned if another host holds it.
+func Acquire(ctx context.Context, cli client.Client, operation string) (*Lock, error) {
+	identity, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get hostname: %w", err)
+	}
+	return AcquireAs(ctx, cli, identity, operation)
+}
+
+// AcquireAs acquires the lock for the operation on behalf of the identity, as Acquire does
+// for hosts. Operations not run from a host, as the upgrades run by the operator, are
+// identified by name.
+func AcquireAs(ctx context.Context, cli client.Client, identity, operation string) (*Lock, error) {
+	return acquire(ctx, cli, identity, operation, DefaultDuration, time.Now())
+}
+
+// Hold acquires the lock for the operation on behalf of the identity, or renews it if the
+// identity already holds it, without renewing it in the background. Nodes joining the
+// cluster can not reach it yet, the artifact mirror holds the lock for them and they ask
+// for it again before it expires. A HeldError is returned if another identity holds it.
+func Hold(ctx context.Context, cli client.Client, identity, operation string) error {
+	return take(ctx, cli, identity, operation, DefaultDuration, time.Now())
+}
+
+func acquire(ctx context.Context, cli client.Client, identity, operation string, duration time.Duration, now time.Time) (*Lock, error) {
+	if err := take(ctx, cli, identity, operation, duration, now); err != nil {
+		return nil, err
+	}
+	lock := &Lock{cli: cli, identity: identity, duration: duration}
+	renewCtx, cancel := context.WithCancel(context.Background())
+	lock.cancel = cancel
+	lock.wg.Add(1)
+	go lock.renew(renewCtx)
+	return lock, nil
+}
+
+// take writes the lease on behalf of the identity. The acquire time is kept if the
+// identity already holds it.
+func take(ctx context.Context, cli client.Client, identity, operation string, duration time.Duration, now time.Time) error {
+	var lease coordinationv1.Lease
+	err := cli.Get(ctx, client.ObjectKey{Namespace: Namespace, Name: Name}, &lease)
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("unable to get lock: %w", err)
+	}
+	exists := err == nil
+	acquired := now
+	if holder, ok := holderOf(lease, now); exists && ok {
+		if holder.Identity != identity {
+			return &HeldError{Holder: holder}
+		}
+		if !holder.AcquiredAt.IsZero() {
+			acquired = holder.AcquiredAt
+		}
+	}
+
+	lease.Namespace, lease.Name = Namespace, Name
+	if lease.Annotations == nil {
+		lease.Annotations = map[string]string{}
+	}
+	lease.Annotations[OperationAnnotation] = operation
+	lease.Spec = coordinationv1.LeaseSpec{
+		HolderIdentity:       ptr.To(identity),
+		LeaseDurationSeconds: ptr.To(int32(duration.Seconds())),
+		AcquireTime:          &metav1.MicroTime{Time: acquired},
+		RenewTime:            &metav1.MicroTime{Time: now},
+	}
+	// updates are rejected if the lease changed since it was read, so two hosts can not
+	// both take over an expired lock.
+	if exists {
+		err = cli.Update(ctx, &lease)
+	} else {
+		err = cli.Create(ctx, &lease)
+	}
+	if errors.IsConflict(err) || errors.IsAlreadyExists(err) {
+		return fmt.Errorf("unable to acquire lock, another host acquired it first: %w", err)
+	} else if err != nil {
+		return fmt.Errorf("unable to acquire lock: %w", err)
+	}
+	return nil
+}
+
+// renew renews the lock until the context is cancelled. Failures are only logged, the
+// lock expires if it can not be renewed for long enough.
+func (l *Lock) renew(ctx context.Context) {
+	defer l.wg.Done()
+	ticker := time.NewTicker(l.duration / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := l.update(ctx, func(lease *coordinationv1.Lease) {
+			lease.Spec.RenewTime = &metav1.MicroTime{Time: time.Now()}
+		}); err != nil {
+			logrus.Debugf("unable to renew cluster lock: %v", err)
+		}
+	}
+}
+
+// Release stops renewing the lock and releases it. Releasing a nil Lock is a no-op.
+func (l *Lock) Release(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	l.cancel()
+	l.wg.Wait()
+	if err := l.update(ctx, func(lease *coordinationv1.Lease) {
+		lease.Spec.HolderIdentity = nil
+		delete(lease.Annotations, OperationAnnotation)
+	}); err != nil {
+		return fmt.Errorf("unable to release lock: %w", err)
+	}
+	return nil
+}
+
+// update applies the mutation to the lease, provided it is still held by this host.
+func (l *Lock) update(ctx context.Context, mutate func(*coordinationv1.Lease)) error {
+	var lease coordinationv1.Lease
+	if err := l.cli.Get(ctx, client.ObjectKey{Namespace: Namespace, Name: Name}, &lease); err != nil {
+		return fmt.Errorf("unable to get lock: %w", err)
+	}
+	if ptr.Deref(lease.Spec.HolderIdentity, "") != l.identity {
+		return fmt.Errorf("lock no longer held by %s", l.identity)
+	}
+	mutate(&lease)
+	return l.cli.Update(ctx, &lease)
+}
+
+// Get returns who holds the lock. Returns nil if the lock is free or has expired.
+func Get(ctx context.Context, cli client.Client) (*Holder, error) {
+	var lease coordinationv1.Lease
+	if err := cli.Get(ctx, client.ObjectKey{Namespace: Namespace, Name: Name}, &lease); errors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to get lock: %w", err)
+	}
+	holder, ok := holderOf(lease, time.Now())
+	if !ok {
+		return nil, nil
+	}
+	return &holder, nil
+}
+
+// holderOf returns who holds the lease, false if it is free or has expired at now.
+func holderOf(lease coordinationv1.Lease, now time.Time) (Holder, bool) {
+	identity := ptr.Deref(lease.Spec.HolderIdentity, "")
+	if identity == "" || lease.Spec.RenewTime == nil {
+		return Holder{}, false
+	}
+	duration := time.Duration(ptr.Deref(lease.Spec.LeaseDurationSeconds, 0)) * time.Second
+	if now.After(lease.Spec.RenewTime.Add(duration)) {
+		return Holder{}, false
+	}
+	holder := Holder{
+		Identity:  identity,
+		Operation: lease.Annotations[OperationAnnotation],
+		RenewedAt: lease.Spec.RenewTime.Time,
+	}
+	if lease.Spec.AcquireTime != nil {
+		holder.AcquiredAt = lease.Spec.AcquireTime.Time
+	}
+	return holder, true
+}
@@ -0,0 +1,112 @@
+package clusterlock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestAcquire(t *testing.T) {
+	ctx := context.Background()
+	cli := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	now := time.Now()
+
+	lock, err := acquire(ctx, cli, "node-1", "update", time.Minute, now)
+	require.NoError(t, err)
+
+	holder, err := Get(ctx, cli)
+	require.NoError(t, err)
+	require.NotNil(t, holder)
+	assert.Equal(t, "node-1", holder.Identity)
+	assert.Equal(t, "update", holder.Operation)
+	assert.WithinDuration(t, now, holder.AcquiredAt, time.Second)
+
+	// another host is refused while the lock is held.
+	_, err = acquire(ctx, cli, "node-2", "join", time.Minute, now)
+	var held *HeldError
+	require.ErrorAs(t, err, &held)
+	assert.Equal(t, "node-1", held.Holder.Identity)
+	assert.Contains(t, err.Error(), "node-1 is running update on the cluster since")
+
+	// the same host acquires it again.
+	again, err := acquire(ctx, cli, "node-1", "join", time.Minute, now)
+	require.NoError(t, err)
+	require.NoError(t, again.Release(ctx))
+	require.Error(t, lock.Release(ctx))
+
+	holder, err = Get(ctx, cli)
+	require.NoError(t, err)
+	assert.Nil(t, holder)
+
+	lock, err = acquire(ctx, cli, "node-2", "join", time.Minute, now)
+	require.NoError(t, err)
+	require.NoError(t, lock.Release(ctx))
+}
+
+func TestAcquireExpired(t *testing.T) {
+	ctx := context.Background()
+	renewed := time.Now().Add(-2 * time.Minute)
+	lease := &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   Namespace,
+			Name:        Name,
+			Annotations: map[string]string{OperationAnnotation: "update"},
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       ptr.To("node-1"),
+			LeaseDurationSeconds: ptr.To(int32(60)),
+			AcquireTime:          &metav1.MicroTime{Time: renewed},
+			RenewTime:            &metav1.MicroTime{Time: renewed},
+		},
+	}
+	cli := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(lease).Build()
+
+	holder, err := Get(ctx, cli)
+	require.NoError(t, err)
+	assert.Nil(t, holder)
+
+	lock, err := acquire(ctx, cli, "node-2", "join", time.Minute, time.Now())
+	require.NoError(t, err)
+	holder, err = Get(ctx, cli)
+	require.NoError(t, err)
+	require.NotNil(t, holder)
+	assert.Equal(t, "node-2", holder.Identity)
+	require.NoError(t, lock.Release(ctx))
+}
+
+func TestHold(t *testing.T) {
+	ctx := context.Background()
+	cli := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	now := time.Now()
+
+	require.NoError(t, take(ctx, cli, "node-3", "join", time.Minute, now))
+	// holding it again renews it, it is still held since the first time.
+	require.NoError(t, take(ctx, cli, "node-3", "join", time.Minute, now.Add(20*time.Second)))
+	holder, err := Get(ctx, cli)
+	require.NoError(t, err)
+	require.NotNil(t, holder)
+	assert.WithinDuration(t, now, holder.AcquiredAt, time.Second)
+	assert.WithinDuration(t, now.Add(20*time.Second), holder.RenewedAt, time.Second)
+
+	var held *HeldError
+	require.ErrorAs(t, Hold(ctx, cli, "node-1", "update"), &held)
+	assert.Equal(t, "node-3", held.Holder.Identity)
+
+	// the joined node takes over the lock held for it.
+	lock, err := AcquireAs(ctx, cli, "node-3", "join")
+	require.NoError(t, err)
+	require.NoError(t, lock.Release(ctx))
+}
+
+func TestRelease(t *testing.T) {
+	var lock *Lock
+	assert.NoError(t, lock.Release(context.Background()))
+}
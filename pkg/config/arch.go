@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/addons/adminconsole"
+	"github.com/replicatedhq/embedded-cluster/pkg/addons/embeddedclusteroperator"
+	"github.com/replicatedhq/embedded-cluster/pkg/addons/openebs"
+	"github.com/replicatedhq/embedded-cluster/pkg/addons/registry"
+	"github.com/replicatedhq/embedded-cluster/pkg/addons/replicatedsdk"
+	"github.com/replicatedhq/embedded-cluster/pkg/addons/seaweedfs"
+	"github.com/replicatedhq/embedded-cluster/pkg/addons/velero"
+	"github.com/replicatedhq/embedded-cluster/pkg/release"
+)
+
+// imageSets returns the images of the cluster by component, k0s and the add-ons.
+func imageSets() map[string]map[string]release.AddonImage {
+	return map[string]map[string]release.AddonImage{
+		"k0s":                     Metadata.Images,
+		"adminconsole":            adminconsole.Metadata.Images,
+		"embeddedclusteroperator": embeddedclusteroperator.Metadata.Images,
+		"openebs":                 openebs.Metadata.Images,
+		"registry":                registry.Metadata.Images,
+		"replicatedsdk":           replicatedsdk.Metadata.Images,
+		"seaweedfs":               seaweedfs.Metadata.Images,
+		"velero":                  velero.Metadata.Images,
+	}
+}
+
+// CheckArchitecture makes sure the images of the cluster run on nodes of the architecture,
+// in a cluster installed on a node of clusterArch. The images are referenced once for the
+// whole cluster, nodes of another architecture can only join if the references resolve to
+// images of their own architecture too.
+func CheckArchitecture(arch, clusterArch string) error {
+	return checkArchitecture(imageSets(), arch, clusterArch)
+}
+
+func checkArchitecture(sets map[string]map[string]release.AddonImage, arch, clusterArch string) error {
+	var missing, differing []string
+	for component, images := range sets {
+		for name, image := range images {
+			tag := image.Tag[arch]
+			if tag == "" {
+				missing = append(missing, fmt.Sprintf("%s/%s", component, name))
+			} else if tag != image.Tag[clusterArch] {
+				differing = append(differing, fmt.Sprintf("%s/%s", component, name))
+			}
+		}
+	}
+	slices.Sort(missing)
+	slices.Sort(differing)
+	if len(missing) > 0 {
+		return fmt.Errorf("the images of this release do not support %s nodes, %s images are missing for %s", arch, arch, strings.Join(missing, ", "))
+	}
+	if len(differing) > 0 {
+		return fmt.Errorf(
+			"%s nodes can not join a cluster installed on %s nodes, the images of this release are referenced separately for each architecture: %s",
+			arch, clusterArch, strings.Join(differing, ", "),
+		)
+	}
+	return nil
+}
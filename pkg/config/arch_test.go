@@ -0,0 +1,64 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/release"
+)
+
+func TestCheckArchitecture(t *testing.T) {
+	multiArch := release.AddonImage{Repo: "kotsadm", Tag: map[string]string{"amd64": "1.0@sha256:index", "arm64": "1.0@sha256:index"}}
+	perArch := release.AddonImage{Repo: "coredns", Tag: map[string]string{"amd64": "1.0-amd64@sha256:a", "arm64": "1.0-arm64@sha256:b"}}
+	amd64Only := release.AddonImage{Repo: "velero", Tag: map[string]string{"amd64": "1.0@sha256:c"}}
+
+	for _, tt := range []struct {
+		name        string
+		sets        map[string]map[string]release.AddonImage
+		arch        string
+		clusterArch string
+		wantErr     string
+	}{
+		{
+			name:        "same architecture",
+			sets:        map[string]map[string]release.AddonImage{"k0s": {"coredns": perArch}},
+			arch:        "arm64",
+			clusterArch: "arm64",
+		},
+		{
+			name:        "multi-arch images",
+			sets:        map[string]map[string]release.AddonImage{"adminconsole": {"kotsadm": multiArch}},
+			arch:        "arm64",
+			clusterArch: "amd64",
+		},
+		{
+			name:        "missing architecture",
+			sets:        map[string]map[string]release.AddonImage{"velero": {"velero": amd64Only}, "k0s": {"coredns": perArch}},
+			arch:        "arm64",
+			clusterArch: "arm64",
+			wantErr:     "the images of this release do not support arm64 nodes, arm64 images are missing for velero/velero",
+		},
+		{
+			name:        "images referenced per architecture",
+			sets:        map[string]map[string]release.AddonImage{"k0s": {"coredns": perArch}, "adminconsole": {"kotsadm": multiArch}},
+			arch:        "arm64",
+			clusterArch: "amd64",
+			wantErr:     "arm64 nodes can not join a cluster installed on amd64 nodes, the images of this release are referenced separately for each architecture: k0s/coredns",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkArchitecture(tt.sets, tt.arch, tt.clusterArch)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+
+	// the images embedded in the binary support both architectures.
+	for _, arch := range []string{"amd64", "arm64"} {
+		assert.NoError(t, CheckArchitecture(arch, arch), arch)
+	}
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"fmt"
+
+	k0sconfig "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	embeddedclusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+// Names of the k0s components, as accepted by the k0s --disable-components flag.
+const (
+	ComponentKonnectivity  = "konnectivity-server"
+	ComponentMetricsServer = "metrics-server"
+	ComponentAutopilot     = "autopilot"
+	ComponentWindowsNode   = "windows-node-role"
+)
+
+// DisabledComponents returns the k0s components controllers are installed without.
+// Konnectivity is never deployed, and neither is the k0s Windows stack, the operator
+// deploys one matching the cluster versions.
+func DisabledComponents(spec *embeddedclusterv1beta1.ConfigSpec) []string {
+	disabled := []string{ComponentKonnectivity, ComponentWindowsNode}
+	if !spec.MetricsServerEnabled() {
+		disabled = append(disabled, ComponentMetricsServer)
+	}
+	if !spec.AutopilotEnabled() {
+		disabled = append(disabled, ComponentAutopilot)
+	}
+	return disabled
+}
+
+// ApplyComponents disables kube-proxy in the cluster configuration if it has been disabled
+// in the embedded cluster config. It must be called after the unsupported overrides are
+// applied, as kube-proxy can only be disabled when they replace the network provider.
+func ApplyComponents(cfg *k0sconfig.ClusterConfig, spec *embeddedclusterv1beta1.ConfigSpec) error {
+	if spec.KubeProxyEnabled() {
+		return nil
+	}
+	if cfg.Spec.Network == nil || cfg.Spec.Network.Provider != "custom" {
+		return fmt.Errorf("kube-proxy can only be disabled with a custom network provider replacing it")
+	}
+	if cfg.Spec.Network.KubeProxy == nil {
+		cfg.Spec.Network.KubeProxy = k0sconfig.DefaultKubeProxy()
+	}
+	cfg.Spec.Network.KubeProxy.Disabled = true
+	return nil
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"testing"
+
+	embeddedclusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+)
+
+func TestDisabledComponents(t *testing.T) {
+	assert.Equal(t, []string{"konnectivity-server", "windows-node-role"}, DisabledComponents(nil))
+	spec := &embeddedclusterv1beta1.ConfigSpec{
+		Components: &embeddedclusterv1beta1.K0sComponents{
+			MetricsServer: ptr.To(false),
+			KubeProxy:     ptr.To(false),
+			Autopilot:     ptr.To(true),
+		},
+	}
+	assert.Equal(t, []string{"konnectivity-server", "windows-node-role", "metrics-server"}, DisabledComponents(spec))
+	spec.Components.Autopilot = ptr.To(false)
+	assert.Equal(t, []string{"konnectivity-server", "windows-node-role", "metrics-server", "autopilot"}, DisabledComponents(spec))
+}
+
+func TestApplyComponents(t *testing.T) {
+	spec := &embeddedclusterv1beta1.ConfigSpec{
+		Components: &embeddedclusterv1beta1.K0sComponents{KubeProxy: ptr.To(false)},
+	}
+
+	cfg := RenderK0sConfig()
+	assert.EqualError(t, ApplyComponents(cfg, spec), "kube-proxy can only be disabled with a custom network provider replacing it")
+
+	cfg.Spec.Network.Provider = "custom"
+	require.NoError(t, ApplyComponents(cfg, spec))
+	assert.True(t, cfg.Spec.Network.KubeProxy.Disabled)
+
+	cfg = RenderK0sConfig()
+	require.NoError(t, ApplyComponents(cfg, nil))
+	assert.False(t, cfg.Spec.Network.KubeProxy.Disabled)
+}
+
+func TestListK0sImagesDisabledComponents(t *testing.T) {
+	cfg := RenderK0sConfig()
+	all := ListK0sImages(cfg)
+	assert.Contains(t, all, cfg.Spec.Images.MetricsServer.URI())
+	assert.Contains(t, all, cfg.Spec.Images.KubeProxy.URI())
+
+	cfg.Spec.Network.KubeProxy.Disabled = true
+	filtered := ListK0sImages(cfg, ComponentKonnectivity, ComponentMetricsServer)
+	assert.NotContains(t, filtered, cfg.Spec.Images.MetricsServer.URI())
+	assert.NotContains(t, filtered, cfg.Spec.Images.KubeProxy.URI())
+	assert.Len(t, filtered, len(all)-2)
+}
@@ -4,6 +4,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 
 	jsonpatch "github.com/evanphx/json-patch"
@@ -16,6 +17,7 @@ import (
 
 	"github.com/replicatedhq/embedded-cluster/pkg/addons"
 	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/nodeconfig"
 	"github.com/replicatedhq/embedded-cluster/pkg/release"
 )
 
@@ -131,17 +133,52 @@ func ApplyBuiltInExtensionsOverrides(cfg *k0sconfig.ClusterConfig, releaseConfig
 	return cfg, nil
 }
 
+// PatchOption configures PatchK0sConfig.
+type PatchOption func(*patchOptions)
+
+type patchOptions struct {
+	allowedFields []string
+}
+
+// WithAllowedFields restricts the fields the patch can set to the dotted paths, a path
+// allows the field and everything under it. Any field can be set when fields is empty.
+func WithAllowedFields(fields []string) PatchOption {
+	return func(o *patchOptions) {
+		o.allowedFields = fields
+	}
+}
+
+// DisallowedFieldsError is returned by PatchK0sConfig when the patch sets fields that are
+// not allowed.
+type DisallowedFieldsError struct {
+	// Paths are the dotted paths of the fields, sorted.
+	Paths []string
+}
+
+func (e *DisallowedFieldsError) Error() string {
+	return fmt.Sprintf("the overrides set fields that can not be overridden: %s", strings.Join(e.Paths, ", "))
+}
+
 // PatchK0sConfig patches a K0s config with the provided patch. Returns the patched config,
 // patch is expected to be a YAML encoded k0s configuration. We marshal the original config
 // and the patch into JSON and apply the latter as a merge patch to the former.
-func PatchK0sConfig(config *k0sconfig.ClusterConfig, patch string) (*k0sconfig.ClusterConfig, error) {
+func PatchK0sConfig(config *k0sconfig.ClusterConfig, patch string, opts ...PatchOption) (*k0sconfig.ClusterConfig, error) {
 	if patch == "" {
 		return config, nil
 	}
+	var options patchOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
 	patch, err := extractK0sConfigPatch(patch)
 	if err != nil {
 		return nil, fmt.Errorf("unable to extract k0s config patch: %w", err)
 	}
+	if len(options.allowedFields) > 0 {
+		if err := checkAllowedFields(patch, options.allowedFields); err != nil {
+			return nil, err
+		}
+	}
 	originalYAML, err := k8syaml.Marshal(config)
 	if err != nil {
 		return nil, fmt.Errorf("unable to marshal original config: %w", err)
@@ -169,21 +206,72 @@ func PatchK0sConfig(config *k0sconfig.ClusterConfig, patch string) (*k0sconfig.C
 	return &patched, nil
 }
 
+// checkAllowedFields returns a DisallowedFieldsError if the patch sets fields outside of
+// the allowed paths. Lists are set as a whole, their path must be allowed.
+func checkAllowedFields(patch string, allowed []string) error {
+	var body map[string]interface{}
+	if err := k8syaml.Unmarshal([]byte(patch), &body); err != nil {
+		return fmt.Errorf("unable to unmarshal patch: %w", err)
+	}
+	var disallowed []string
+	var walk func(path string, value interface{})
+	walk = func(path string, value interface{}) {
+		if isAllowedField(path, allowed) {
+			return
+		}
+		if m, ok := value.(map[string]interface{}); ok && len(m) > 0 {
+			for key, sub := range m {
+				walk(path+"."+key, sub)
+			}
+			return
+		}
+		disallowed = append(disallowed, path)
+	}
+	for key, value := range body {
+		walk(key, value)
+	}
+	if len(disallowed) == 0 {
+		return nil
+	}
+	sort.Strings(disallowed)
+	return &DisallowedFieldsError{Paths: disallowed}
+}
+
+// isAllowedField returns true if the path is one of the allowed paths or under one.
+func isAllowedField(path string, allowed []string) bool {
+	for _, a := range allowed {
+		if path == a || strings.HasPrefix(path, a+".") {
+			return true
+		}
+	}
+	return false
+}
+
 // InstallFlags returns a list of default flags to be used when bootstrapping a k0s cluster.
-func InstallFlags(nodeIP string) []string {
+// The provided kubelet flags are passed to the kubelet along with the node ip, and the
+// components are not deployed.
+func InstallFlags(nodeIP string, labels map[string]string, kubeletArgs []string, disabledComponents []string) []string {
 	return []string{
 		"install",
 		"controller",
-		"--disable-components", "konnectivity-server",
-		"--labels", strings.Join(nodeLabels(), ","),
+		"--disable-components", strings.Join(disabledComponents, ","),
+		"--labels", strings.Join(nodeLabels(labels), ","),
 		"--enable-worker",
 		"--no-taints",
 		"--enable-dynamic-config",
-		"--kubelet-extra-args", fmt.Sprintf(`"--node-ip=%s"`, nodeIP),
+		"--kubelet-extra-args", KubeletExtraArgs(nodeIP, kubeletArgs),
+		nodeconfig.ProfileFlag(),
 		"-c", defaults.PathToK0sConfig(),
 	}
 }
 
+// KubeletExtraArgs returns the value of the k0s --kubelet-extra-args flag setting the
+// node ip and the provided kubelet flags.
+func KubeletExtraArgs(nodeIP string, kubeletArgs []string) string {
+	args := append([]string{fmt.Sprintf("--node-ip=%s", nodeIP)}, kubeletArgs...)
+	return fmt.Sprintf(`"%s"`, strings.Join(args, " "))
+}
+
 func ControllerLabels() map[string]string {
 	lmap := additionalControllerLabels()
 	lmap["kots.io/embedded-cluster-role-0"] = getControllerRoleName()
@@ -192,10 +280,14 @@ func ControllerLabels() map[string]string {
 }
 
 // nodeLabels return a slice of string with labels (key=value format) for the node where we
-// are installing the k0s.
-func nodeLabels() []string {
+// are installing the k0s. The provided labels are added to the controller labels.
+func nodeLabels(extra map[string]string) []string {
+	lmap := ControllerLabels()
+	for k, v := range extra {
+		lmap[k] = v
+	}
 	labels := []string{}
-	for k, v := range ControllerLabels() {
+	for k, v := range lmap {
 		labels = append(labels, fmt.Sprintf("%s=%s", k, v))
 	}
 	return labels
@@ -98,6 +98,49 @@ func TestPatchK0sConfig(t *testing.T) {
 	}
 }
 
+func TestPatchK0sConfigAllowedFields(t *testing.T) {
+	patch := `config:
+  spec:
+    api:
+      sans:
+      - api.example.com
+      extraArgs:
+        audit-log-maxage: "30"
+    network:
+      podCIDR: 10.0.0.0/16
+`
+	for _, tt := range []struct {
+		name    string
+		allowed []string
+		wantErr string
+	}{
+		{name: "no allowlist"},
+		{name: "all allowed", allowed: []string{"spec.api", "spec.network.podCIDR"}},
+		{
+			name:    "some disallowed",
+			allowed: []string{"spec.api.sans", "spec.network.serviceCIDR"},
+			wantErr: "the overrides set fields that can not be overridden: spec.api.extraArgs.audit-log-maxage, spec.network.podCIDR",
+		},
+		{
+			name:    "prefix of a field name",
+			allowed: []string{"spec.api.extra", "spec.network"},
+			wantErr: "the overrides set fields that can not be overridden: spec.api.extraArgs.audit-log-maxage, spec.api.sans",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := PatchK0sConfig(RenderK0sConfig(), patch, WithAllowedFields(tt.allowed))
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				assert.Equal(t, []string{"api.example.com"}, result.Spec.API.SANs)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+			var derr *DisallowedFieldsError
+			assert.ErrorAs(t, err, &derr)
+		})
+	}
+}
+
 func Test_extractK0sConfigPatch(t *testing.T) {
 	type test struct {
 		Name     string
@@ -124,3 +167,49 @@ func Test_extractK0sConfigPatch(t *testing.T) {
 		})
 	}
 }
+
+func TestApplyFIPSSettings(t *testing.T) {
+	cfg := RenderK0sConfig()
+	cfg.Spec.WorkerProfiles = []k0sconfig.WorkerProfile{{Name: "default"}, {Name: "custom"}}
+	err := ApplyFIPSSettings(cfg)
+	require.NoError(t, err)
+
+	assert.Equal(t, "VersionTLS12", cfg.Spec.API.ExtraArgs["tls-min-version"])
+	assert.Contains(t, cfg.Spec.API.ExtraArgs["tls-cipher-suites"], "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256")
+	assert.Equal(t, DefaultServiceNodePortRange, cfg.Spec.API.ExtraArgs["service-node-port-range"])
+	assert.Equal(t, "VersionTLS12", cfg.Spec.ControllerManager.ExtraArgs["tls-min-version"])
+	assert.Equal(t, "VersionTLS12", cfg.Spec.Scheduler.ExtraArgs["tls-min-version"])
+
+	require.Len(t, cfg.Spec.WorkerProfiles, 2)
+	assert.Equal(t, "custom", cfg.Spec.WorkerProfiles[0].Name)
+	assert.Equal(t, "default", cfg.Spec.WorkerProfiles[1].Name)
+	assert.Contains(t, string(cfg.Spec.WorkerProfiles[1].Config.Raw), `"tlsMinVersion":"VersionTLS12"`)
+}
+
+func TestApplyHardening(t *testing.T) {
+	cfg := RenderK0sConfig()
+	require.NoError(t, ApplyHardening(cfg, ""))
+	assert.Empty(t, cfg.Spec.WorkerProfiles)
+
+	assert.Error(t, ApplyHardening(cfg, "stig"))
+
+	require.NoError(t, ApplyFIPSSettings(cfg))
+	require.NoError(t, ApplyHardening(cfg, "cis"))
+	assert.Equal(t, "false", cfg.Spec.API.ExtraArgs["profiling"])
+	assert.Equal(t, "/etc/k0s/audit-policy.yaml", cfg.Spec.API.ExtraArgs["audit-policy-file"])
+	assert.Equal(t, "VersionTLS12", cfg.Spec.API.ExtraArgs["tls-min-version"])
+	assert.Equal(t, "false", cfg.Spec.ControllerManager.ExtraArgs["profiling"])
+	assert.Equal(t, "false", cfg.Spec.Scheduler.ExtraArgs["profiling"])
+
+	// fips and hardening settings are merged into the same worker profile.
+	require.Len(t, cfg.Spec.WorkerProfiles, 1)
+	profile := string(cfg.Spec.WorkerProfiles[0].Config.Raw)
+	assert.Contains(t, profile, `"tlsMinVersion":"VersionTLS12"`)
+	assert.Contains(t, profile, `"readOnlyPort":0`)
+}
+
+func TestApplyEncryption(t *testing.T) {
+	cfg := RenderK0sConfig()
+	ApplyEncryption(cfg)
+	assert.Equal(t, "/var/lib/embedded-cluster/encryption/config.yaml", cfg.Spec.API.ExtraArgs["encryption-provider-config"])
+}
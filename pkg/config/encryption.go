@@ -0,0 +1,18 @@
+package config
+
+import (
+	k0sconfig "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/encryption"
+)
+
+// ApplyEncryption configures the kube-apiserver to encrypt secrets at rest. The
+// encryption configuration referenced by the settings must be written separately.
+func ApplyEncryption(cfg *k0sconfig.ClusterConfig) {
+	if cfg.Spec.API.ExtraArgs == nil {
+		cfg.Spec.API.ExtraArgs = map[string]string{}
+	}
+	for k, v := range encryption.APIServerArgs() {
+		cfg.Spec.API.ExtraArgs[k] = v
+	}
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	k0sconfig "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/fips"
+)
+
+// ApplyFIPSSettings restricts the TLS settings used by the kubernetes control plane
+// components and by the kubelet to FIPS approved versions and cipher suites. The
+// kubelet settings are set on the "default" worker profile so they are part of the
+// cluster wide config and are picked up by all nodes.
+func ApplyFIPSSettings(cfg *k0sconfig.ClusterConfig) error {
+	ciphers := strings.Join(fips.TLSCipherSuites, ",")
+
+	if cfg.Spec.API.ExtraArgs == nil {
+		cfg.Spec.API.ExtraArgs = map[string]string{}
+	}
+	cfg.Spec.API.ExtraArgs["tls-cipher-suites"] = ciphers
+	cfg.Spec.API.ExtraArgs["tls-min-version"] = fips.TLSMinVersion
+
+	if cfg.Spec.ControllerManager == nil {
+		cfg.Spec.ControllerManager = k0sconfig.DefaultControllerManagerSpec()
+	}
+	if cfg.Spec.ControllerManager.ExtraArgs == nil {
+		cfg.Spec.ControllerManager.ExtraArgs = map[string]string{}
+	}
+	cfg.Spec.ControllerManager.ExtraArgs["tls-cipher-suites"] = ciphers
+	cfg.Spec.ControllerManager.ExtraArgs["tls-min-version"] = fips.TLSMinVersion
+
+	if cfg.Spec.Scheduler == nil {
+		cfg.Spec.Scheduler = k0sconfig.DefaultSchedulerSpec()
+	}
+	if cfg.Spec.Scheduler.ExtraArgs == nil {
+		cfg.Spec.Scheduler.ExtraArgs = map[string]string{}
+	}
+	cfg.Spec.Scheduler.ExtraArgs["tls-cipher-suites"] = ciphers
+	cfg.Spec.Scheduler.ExtraArgs["tls-min-version"] = fips.TLSMinVersion
+
+	values := map[string]interface{}{
+		"tlsCipherSuites": fips.TLSCipherSuites,
+		"tlsMinVersion":   fips.TLSMinVersion,
+	}
+	if err := mergeDefaultWorkerProfile(cfg, values); err != nil {
+		return fmt.Errorf("unable to set kubelet tls settings: %w", err)
+	}
+	return nil
+}
+
+// mergeDefaultWorkerProfile merges the provided kubelet configuration values into the
+// "default" worker profile, creating it if necessary. Values already present in the
+// profile are kept unless overwritten.
+func mergeDefaultWorkerProfile(cfg *k0sconfig.ClusterConfig, values map[string]interface{}) error {
+	merged := map[string]interface{}{}
+	for i, profile := range cfg.Spec.WorkerProfiles {
+		if profile.Name != "default" {
+			continue
+		}
+		if profile.Config != nil && len(profile.Config.Raw) > 0 {
+			if err := json.Unmarshal(profile.Config.Raw, &merged); err != nil {
+				return fmt.Errorf("unable to unmarshal default worker profile: %w", err)
+			}
+		}
+		cfg.Spec.WorkerProfiles = append(cfg.Spec.WorkerProfiles[:i], cfg.Spec.WorkerProfiles[i+1:]...)
+		break
+	}
+	for k, v := range values {
+		merged[k] = v
+	}
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return fmt.Errorf("unable to marshal default worker profile: %w", err)
+	}
+	cfg.Spec.WorkerProfiles = append(cfg.Spec.WorkerProfiles, k0sconfig.WorkerProfile{
+		Name:   "default",
+		Config: &runtime.RawExtension{Raw: data},
+	})
+	return nil
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+
+	k0sconfig "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/hardening"
+)
+
+// ApplyHardening applies the settings required by the provided hardening profile to
+// the control plane components and to the kubelet. The kubelet settings are set on the
+// "default" worker profile so they are picked up by all nodes. Files referenced by the
+// settings (audit policy, encryption config) must be written separately.
+func ApplyHardening(cfg *k0sconfig.ClusterConfig, profile string) error {
+	if err := hardening.Validate(profile); err != nil {
+		return err
+	} else if profile == "" {
+		return nil
+	}
+
+	if cfg.Spec.API.ExtraArgs == nil {
+		cfg.Spec.API.ExtraArgs = map[string]string{}
+	}
+	for k, v := range hardening.APIServerArgs() {
+		cfg.Spec.API.ExtraArgs[k] = v
+	}
+
+	if cfg.Spec.ControllerManager == nil {
+		cfg.Spec.ControllerManager = k0sconfig.DefaultControllerManagerSpec()
+	}
+	if cfg.Spec.ControllerManager.ExtraArgs == nil {
+		cfg.Spec.ControllerManager.ExtraArgs = map[string]string{}
+	}
+	for k, v := range hardening.ControllerManagerArgs() {
+		cfg.Spec.ControllerManager.ExtraArgs[k] = v
+	}
+
+	if cfg.Spec.Scheduler == nil {
+		cfg.Spec.Scheduler = k0sconfig.DefaultSchedulerSpec()
+	}
+	if cfg.Spec.Scheduler.ExtraArgs == nil {
+		cfg.Spec.Scheduler.ExtraArgs = map[string]string{}
+	}
+	for k, v := range hardening.SchedulerArgs() {
+		cfg.Spec.Scheduler.ExtraArgs[k] = v
+	}
+
+	if err := mergeDefaultWorkerProfile(cfg, hardening.KubeletConfig()); err != nil {
+		return fmt.Errorf("unable to set kubelet settings: %w", err)
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	_ "embed"
 	"fmt"
 	"runtime"
+	"slices"
 	"strings"
 
 	"github.com/k0sproject/k0s/pkg/airgap"
@@ -27,15 +28,20 @@ func init() {
 	}
 }
 
-func ListK0sImages(cfg *k0sconfig.ClusterConfig) []string {
+// ListK0sImages returns the images of the k0s components deployed with the cluster
+// configuration. The images of the disabled components, as returned by
+// DisabledComponents, are not included.
+func ListK0sImages(cfg *k0sconfig.ClusterConfig, disabled ...string) []string {
 	var images []string
 	for _, image := range airgap.GetImageURIs(cfg.Spec, true) {
-		switch image {
+		switch {
 		// skip these images
-		case cfg.Spec.Images.KubeRouter.CNI.URI(),
-			cfg.Spec.Images.KubeRouter.CNIInstaller.URI(),
-			cfg.Spec.Images.Konnectivity.URI(),
-			cfg.Spec.Network.NodeLocalLoadBalancing.EnvoyProxy.Image.URI():
+		case image == cfg.Spec.Images.KubeRouter.CNI.URI(),
+			image == cfg.Spec.Images.KubeRouter.CNIInstaller.URI(),
+			image == cfg.Spec.Images.Konnectivity.URI(),
+			image == cfg.Spec.Network.NodeLocalLoadBalancing.EnvoyProxy.Image.URI():
+		case image == cfg.Spec.Images.MetricsServer.URI() && slices.Contains(disabled, ComponentMetricsServer):
+		case image == cfg.Spec.Images.KubeProxy.URI() && cfg.Spec.Network.KubeProxy != nil && cfg.Spec.Network.KubeProxy.Disabled:
 		default:
 			if strings.Contains(image, constant.KubePauseContainerImage) {
 				// there's a bug in GetImageURIs where it always returns the original pause image
@@ -0,0 +1,236 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	k0sconfig "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	embeddedclusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	k8syaml "sigs.k8s.io/yaml"
+)
+
+// Severities of the findings of ValidateOverrides.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// managedK0sFields are the k0s configuration fields the installer sets, overriding them
+// conflicts with the flags and the addons of the installation.
+var managedK0sFields = map[string]string{
+	"spec.api.address":              "the installer sets it to the address of the node",
+	"spec.storage.etcd.peerAddress": "the installer sets it to the address of the node",
+	"spec.network.podCIDR":          "set it with the --pod-cidr or --cidr flags instead",
+	"spec.network.serviceCIDR":      "set it with the --service-cidr or --cidr flags instead",
+	"spec.extensions":               "the installer manages the helm charts, override their values with unsupportedOverrides.builtInExtensions instead",
+}
+
+// Finding is an issue found in an overrides file.
+type Finding struct {
+	Severity string `json:"severity"`
+	// Path is the path of the field the finding is about.
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s: %s", f.Severity, f.Path, f.Message)
+}
+
+// HasErrors returns true if any of the findings is an error.
+func HasErrors(findings []Finding) bool {
+	for _, f := range findings {
+		if f.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateOverrides validates an EmbeddedClusterConfig or end user overrides file against
+// the schema and applies its overrides on top of the rendered configuration. Unknown
+// fields, usually typos, and overrides that can not be applied are reported as errors,
+// overrides of fields managed by the installer, or of the protected helm values of the
+// charts, as warnings. The k0s fields outside of the allowed ones, when set, are reported
+// as errors.
+func ValidateOverrides(data []byte, rendered *k0sconfig.ClusterConfig, protected map[string][]string, allowed []string) []Finding {
+	var findings []Finding
+	add := func(severity, path, format string, args ...interface{}) {
+		findings = append(findings, Finding{Severity: severity, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	var cfg embeddedclusterv1beta1.Config
+	if err := k8syaml.UnmarshalStrict(data, &cfg); err != nil {
+		add(SeverityError, ".", "%v", err)
+		if err := k8syaml.Unmarshal(data, &cfg); err != nil {
+			return findings
+		}
+	}
+	if cfg.APIVersion != embeddedclusterv1beta1.GroupVersion.String() || cfg.Kind != "Config" {
+		add(SeverityError, ".", "expected a Config of %s, got a %s of %q", embeddedclusterv1beta1.GroupVersion, cfg.Kind, cfg.APIVersion)
+	}
+
+	if raw := cfg.Spec.UnsupportedOverrides.K0s; raw != "" {
+		findings = append(findings, validateK0sOverrides(raw)...)
+	}
+
+	charts := map[string]bool{}
+	if rendered.Spec != nil && rendered.Spec.Extensions != nil && rendered.Spec.Extensions.Helm != nil {
+		for _, chart := range rendered.Spec.Extensions.Helm.Charts {
+			charts[chart.Name] = true
+		}
+	}
+	for i, ext := range cfg.Spec.UnsupportedOverrides.BuiltInExtensions {
+		path := fmt.Sprintf("spec.unsupportedOverrides.builtInExtensions[%d]", i)
+		if !charts[ext.Name] {
+			add(SeverityError, path+".name", "unknown chart %q, must be one of %s", ext.Name, strings.Join(sortedKeys(charts), ", "))
+			continue
+		}
+		var values map[string]interface{}
+		if err := k8syaml.Unmarshal([]byte(ext.Values), &values); err != nil {
+			add(SeverityError, path+".values", "invalid helm values: %v", err)
+			continue
+		}
+		for _, field := range protected[ext.Name] {
+			if hasPath(values, strings.Split(field, ".")) {
+				add(SeverityWarning, path+".values", "%s is set by the installer, the override is lost on upgrades", field)
+			}
+		}
+	}
+
+	if HasErrors(findings) {
+		return findings
+	}
+	patched, err := PatchK0sConfig(rendered.DeepCopy(), cfg.Spec.UnsupportedOverrides.K0s, WithAllowedFields(allowed))
+	var derr *DisallowedFieldsError
+	if errors.As(err, &derr) {
+		for _, field := range derr.Paths {
+			add(SeverityError, "spec.unsupportedOverrides.k0s.config."+field, "the release does not allow overriding this field")
+		}
+		return findings
+	} else if err != nil {
+		add(SeverityError, "spec.unsupportedOverrides.k0s", "unable to apply overrides: %v", err)
+		return findings
+	}
+	if _, err := ApplyBuiltInExtensionsOverrides(patched, &cfg); err != nil {
+		add(SeverityError, "spec.unsupportedOverrides.builtInExtensions", "unable to apply overrides: %v", err)
+	}
+	return findings
+}
+
+// validateK0sOverrides validates the k0s overrides against the k0s configuration schema
+// and reports the fields managed by the installer they set.
+func validateK0sOverrides(raw string) []Finding {
+	const path = "spec.unsupportedOverrides.k0s"
+	var body map[string]interface{}
+	if err := k8syaml.Unmarshal([]byte(raw), &body); err != nil {
+		return []Finding{{Severity: SeverityError, Path: path, Message: fmt.Sprintf("invalid yaml: %v", err)}}
+	}
+	patch, ok := body["config"].(map[string]interface{})
+	if !ok {
+		return []Finding{{Severity: SeverityError, Path: path, Message: "the overrides must be under a config key, nothing would be applied"}}
+	}
+
+	var findings []Finding
+	data, err := k8syaml.Marshal(patch)
+	if err != nil {
+		return []Finding{{Severity: SeverityError, Path: path, Message: fmt.Sprintf("unable to marshal overrides: %v", err)}}
+	}
+	// the k0s types decode themselves and ignore unknown fields, the fields dropped by a
+	// round trip through them are the unknown ones.
+	var k0scfg k0sconfig.ClusterConfig
+	if err := k8syaml.Unmarshal(data, &k0scfg); err != nil {
+		return []Finding{{Severity: SeverityError, Path: path, Message: fmt.Sprintf("invalid k0s configuration: %v", err)}}
+	}
+	if data, err = k8syaml.Marshal(k0scfg); err != nil {
+		return []Finding{{Severity: SeverityError, Path: path, Message: fmt.Sprintf("unable to marshal k0s configuration: %v", err)}}
+	}
+	var known map[string]interface{}
+	if err := k8syaml.Unmarshal(data, &known); err != nil {
+		return []Finding{{Severity: SeverityError, Path: path, Message: fmt.Sprintf("unable to unmarshal k0s configuration: %v", err)}}
+	}
+	for _, field := range unknownFields(patch, known, "") {
+		findings = append(findings, Finding{
+			Severity: SeverityError,
+			Path:     fmt.Sprintf("%s.config.%s", path, field),
+			Message:  "unknown field",
+		})
+	}
+	for _, field := range sortedKeys(managedK0sFields) {
+		if hasPath(patch, strings.Split(field, ".")) {
+			findings = append(findings, Finding{
+				Severity: SeverityWarning,
+				Path:     fmt.Sprintf("%s.config.%s", path, field),
+				Message:  fmt.Sprintf("overrides a field managed by the installer, %s", managedK0sFields[field]),
+			})
+		}
+	}
+	return findings
+}
+
+// unknownFields returns the paths of the fields of m missing from known, sorted. Fields
+// set to their zero value are skipped, they are dropped by the round trip when omitempty.
+func unknownFields(m, known map[string]interface{}, prefix string) []string {
+	var fields []string
+	for _, key := range sortedKeys(m) {
+		value, ok := known[key]
+		if !ok {
+			if !isZero(m[key]) {
+				fields = append(fields, prefix+key)
+			}
+			continue
+		}
+		sub, ok := m[key].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if knownSub, ok := value.(map[string]interface{}); ok {
+			fields = append(fields, unknownFields(sub, knownSub, prefix+key+".")...)
+		}
+	}
+	return fields
+}
+
+// isZero returns true for the zero values of the yaml scalars and for empty maps and
+// lists.
+func isZero(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case bool:
+		return !v
+	case float64:
+		return v == 0
+	case string:
+		return v == ""
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// hasPath returns true if the nested maps hold a value at the path.
+func hasPath(m map[string]interface{}, path []string) bool {
+	value, ok := m[path[0]]
+	if !ok {
+		return false
+	}
+	if len(path) == 1 {
+		return true
+	}
+	next, ok := value.(map[string]interface{})
+	return ok && hasPath(next, path[1:])
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
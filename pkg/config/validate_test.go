@@ -0,0 +1,150 @@
+package config
+
+import (
+	"testing"
+
+	k0sconfig "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateOverrides(t *testing.T) {
+	rendered := RenderK0sConfig()
+	rendered.Spec.Extensions = &k0sconfig.ClusterExtensions{
+		Helm: &k0sconfig.HelmExtensions{
+			Charts: k0sconfig.ChartsSettings{
+				{Name: "admin-console", Values: "isAirgap: false\nlabels: {}\n"},
+				{Name: "openebs", Values: "engines: {}\n"},
+			},
+		},
+	}
+	protected := map[string][]string{"admin-console": {"automation", "isAirgap"}}
+
+	for _, tt := range []struct {
+		name    string
+		data    string
+		allowed []string
+		want    []Finding
+	}{
+		{
+			name: "valid",
+			data: `apiVersion: embeddedcluster.replicated.com/v1beta1
+kind: Config
+spec:
+  unsupportedOverrides:
+    k0s: |
+      config:
+        spec:
+          telemetry:
+            enabled: false
+    builtInExtensions:
+    - name: admin-console
+      values: |
+        labels:
+          team: edge
+`,
+		},
+		{
+			name: "typos",
+			data: `apiVersion: embeddedcluster.replicated.com/v1beta1
+kind: Config
+spec:
+  unsuportedOverrides: {}
+`,
+			want: []Finding{
+				{Severity: SeverityError, Path: ".", Message: `error unmarshaling JSON: while decoding JSON: json: unknown field "unsuportedOverrides"`},
+			},
+		},
+		{
+			name: "wrong kind",
+			data: `apiVersion: v1
+kind: ConfigMap
+`,
+			want: []Finding{
+				{Severity: SeverityError, Path: ".", Message: `expected a Config of embeddedcluster.replicated.com/v1beta1, got a ConfigMap of "v1"`},
+			},
+		},
+		{
+			name: "k0s overrides",
+			data: `apiVersion: embeddedcluster.replicated.com/v1beta1
+kind: Config
+spec:
+  unsupportedOverrides:
+    k0s: |
+      config:
+        spec:
+          api:
+            address: 10.0.0.1
+          network:
+            podCIDRs: 10.0.0.0/16
+            kubeProxy:
+              disabled: false
+`,
+			want: []Finding{
+				{Severity: SeverityError, Path: "spec.unsupportedOverrides.k0s.config.spec.network.podCIDRs", Message: "unknown field"},
+				{Severity: SeverityWarning, Path: "spec.unsupportedOverrides.k0s.config.spec.api.address", Message: "overrides a field managed by the installer, the installer sets it to the address of the node"},
+			},
+		},
+		{
+			name: "k0s overrides not allowed",
+			data: `apiVersion: embeddedcluster.replicated.com/v1beta1
+kind: Config
+spec:
+  unsupportedOverrides:
+    k0s: |
+      config:
+        spec:
+          api:
+            sans:
+            - api.example.com
+          telemetry:
+            enabled: false
+`,
+			allowed: []string{"spec.api.sans"},
+			want: []Finding{
+				{Severity: SeverityError, Path: "spec.unsupportedOverrides.k0s.config.spec.telemetry.enabled", Message: "the release does not allow overriding this field"},
+			},
+		},
+		{
+			name: "k0s overrides without config",
+			data: `apiVersion: embeddedcluster.replicated.com/v1beta1
+kind: Config
+spec:
+  unsupportedOverrides:
+    k0s: |
+      spec:
+        telemetry:
+          enabled: false
+`,
+			want: []Finding{
+				{Severity: SeverityError, Path: "spec.unsupportedOverrides.k0s", Message: "the overrides must be under a config key, nothing would be applied"},
+			},
+		},
+		{
+			name: "built in extensions",
+			data: `apiVersion: embeddedcluster.replicated.com/v1beta1
+kind: Config
+spec:
+  unsupportedOverrides:
+    builtInExtensions:
+    - name: adminconsole
+      values: "{}"
+    - name: openebs
+      values: "engines: ["
+    - name: admin-console
+      values: |
+        isAirgap: true
+`,
+			want: []Finding{
+				{Severity: SeverityError, Path: "spec.unsupportedOverrides.builtInExtensions[0].name", Message: `unknown chart "adminconsole", must be one of admin-console, openebs`},
+				{Severity: SeverityError, Path: "spec.unsupportedOverrides.builtInExtensions[1].values", Message: "invalid helm values: error converting YAML to JSON: yaml: line 1: did not find expected node content"},
+				{Severity: SeverityWarning, Path: "spec.unsupportedOverrides.builtInExtensions[2].values", Message: "isAirgap is set by the installer, the override is lost on upgrades"},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ValidateOverrides([]byte(tt.data), rendered, protected, tt.allowed)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, len(tt.want) > 0 && tt.want[0].Severity == SeverityError, HasErrors(got))
+		})
+	}
+}
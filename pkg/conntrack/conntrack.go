@@ -0,0 +1,262 @@
+// Package conntrack sizes the connection tracking table of the nodes and reads its usage.
+// Once the table is full the kernel drops the packets of new connections, the
+// applications see intermittent timeouts and nothing in the cluster points at the cause.
+// Installs and joins size the table for the workload profile of the vendor, the operator
+// renders the same sizing in the kube-proxy configuration, the preflights check it can be
+// sized and the host repair agent reports nodes about to run out of entries.
+package conntrack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	k8syaml "sigs.k8s.io/yaml"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+)
+
+const (
+	// ProfileStandard sizes the table as kube-proxy does.
+	ProfileStandard = "standard"
+	// ProfileHigh sizes the table for applications holding many connections.
+	ProfileHigh = "high"
+)
+
+const (
+	// SysctlPath sets the size of the table when the host boots.
+	SysctlPath = "/etc/sysctl.d/99-embedded-cluster-conntrack.conf"
+	// ModprobePath sets the number of buckets of the table when the module is loaded.
+	ModprobePath = "/etc/modprobe.d/embedded-cluster-conntrack.conf"
+	// ModulesLoadPath loads the module when the host boots, the sysctl setting does not
+	// exist until it is loaded.
+	ModulesLoadPath = "/etc/modules-load.d/embedded-cluster-conntrack.conf"
+)
+
+const (
+	// WarningThreshold is the share of the table in use nodes are reported at.
+	WarningThreshold = 0.75
+	// CriticalThreshold is the share of the table in use past which packets are about to
+	// be dropped.
+	CriticalThreshold = 0.9
+)
+
+// Usage levels, from the share of the table in use.
+const (
+	LevelOK       = "OK"
+	LevelWarning  = "Warning"
+	LevelCritical = "Critical"
+)
+
+// procDir is the directory, relative to /proc, holding the conntrack settings.
+const procDir = "sys/net/netfilter"
+
+// hashsizePath is the number of buckets of the loaded module.
+const hashsizePath = "/sys/module/nf_conntrack/parameters/hashsize"
+
+// sizing holds the entries per cpu and the minimum size of a profile.
+type sizing struct {
+	perCPU int64
+	min    int64
+}
+
+// profiles holds the sizing of each profile, the standard one matches kube-proxy.
+var profiles = map[string]sizing{
+	ProfileStandard: {perCPU: 32768, min: 131072},
+	ProfileHigh:     {perCPU: 131072, min: 524288},
+}
+
+// loadModule loads the conntrack module, it is replaced in tests.
+var loadModule = func() error {
+	_, err := helpers.RunCommand("modprobe", "nf_conntrack")
+	return err
+}
+
+// Max returns the size of the table for a host with the provided number of cpus. The
+// size set in the configuration takes precedence over the profile, hosts get the
+// standard profile by default.
+func Max(cfg *ecv1beta1.Conntrack, cpus int) int64 {
+	profile := ProfileStandard
+	if cfg != nil {
+		if cfg.Max > 0 {
+			return cfg.Max
+		}
+		if cfg.Profile != "" {
+			profile = cfg.Profile
+		}
+	}
+	size, ok := profiles[profile]
+	if !ok {
+		size = profiles[ProfileStandard]
+	}
+	if cpus < 1 {
+		cpus = 1
+	}
+	return max(size.perCPU*int64(cpus), size.min)
+}
+
+// KubeProxy returns the conntrack maxPerCore and min settings of kube-proxy sizing the table
+// as Max does, kube-proxy sets the table of each node to the largest of maxPerCore times
+// its cpus and min. A size set in the configuration is used as the minimum with a single
+// entry per cpu.
+func KubeProxy(cfg *ecv1beta1.Conntrack) (int64, int64) {
+	if cfg != nil && cfg.Max > 0 {
+		return 1, cfg.Max
+	}
+	size := profiles[ProfileStandard]
+	if cfg != nil {
+		if s, ok := profiles[cfg.Profile]; ok {
+			size = s
+		}
+	}
+	return size.perCPU, size.min
+}
+
+// RenderKubeProxyConfig returns the kube-proxy configuration, a KubeProxyConfiguration
+// document, with its conntrack settings sizing the table as Max does. kube-proxy sets the
+// table itself when it starts, with the settings rendered by k0s it would leave it alone
+// or size it for the standard profile. The other settings are kept.
+func RenderKubeProxyConfig(config string, cfg *ecv1beta1.Conntrack) (string, error) {
+	doc := map[string]interface{}{}
+	if err := k8syaml.Unmarshal([]byte(config), &doc); err != nil {
+		return "", fmt.Errorf("unable to parse kube-proxy config: %w", err)
+	}
+	ct, _ := doc["conntrack"].(map[string]interface{})
+	if ct == nil {
+		ct = map[string]interface{}{}
+	}
+	perCPU, minimum := KubeProxy(cfg)
+	ct["maxPerCore"] = perCPU
+	ct["min"] = minimum
+	doc["conntrack"] = ct
+	data, err := k8syaml.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal kube-proxy config: %w", err)
+	}
+	return string(data), nil
+}
+
+// Hashsize returns the number of buckets of the table, a quarter of its entries as
+// kube-proxy does.
+func Hashsize(max int64) int64 {
+	return max / 4
+}
+
+// Configure sizes the table of this host to hold at least max entries, both right away
+// and after the host reboots. Tables already larger, sized by the administrator for
+// instance, are left as they are.
+func Configure(max int64) error {
+	return configure("/", "/proc", max)
+}
+
+// configure sizes the table, the files are written under root and the settings read and
+// written under procRoot.
+func configure(root, procRoot string, size int64) error {
+	if err := loadModule(); err != nil {
+		return fmt.Errorf("unable to load the nf_conntrack module: %w", err)
+	}
+	maxPath := filepath.Join(procRoot, procDir, "nf_conntrack_max")
+	current, err := readInt(maxPath)
+	if err != nil {
+		return err
+	}
+	size = max(size, current)
+
+	files := map[string]string{
+		ModulesLoadPath: "nf_conntrack\n",
+		ModprobePath:    fmt.Sprintf("options nf_conntrack hashsize=%d\n", Hashsize(size)),
+		SysctlPath:      fmt.Sprintf("net.netfilter.nf_conntrack_max = %d\n", size),
+	}
+	for path, data := range files {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("unable to create directory for %s: %w", path, err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			return fmt.Errorf("unable to write %s: %w", path, err)
+		}
+	}
+
+	if size > current {
+		if err := os.WriteFile(maxPath, []byte(strconv.FormatInt(size, 10)), 0644); err != nil {
+			return fmt.Errorf("unable to set nf_conntrack_max: %w", err)
+		}
+	}
+	// the buckets can only be resized by root in the initial network namespace, the
+	// module option applies them on the next boot otherwise.
+	hashPath := filepath.Join(root, hashsizePath)
+	if buckets, err := readInt(hashPath); err == nil && buckets < Hashsize(size) {
+		_ = os.WriteFile(hashPath, []byte(strconv.FormatInt(Hashsize(size), 10)), 0644)
+	}
+	return nil
+}
+
+// Remove removes the files written by Configure, the running table is left as it is.
+func Remove() error {
+	for _, path := range []string{SysctlPath, ModprobePath, ModulesLoadPath} {
+		if err := helpers.RemoveAll(path); err != nil {
+			return fmt.Errorf("unable to remove %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// Usage is the number of entries in the table and its size.
+type Usage struct {
+	Count int64 `json:"count"`
+	Max   int64 `json:"max"`
+}
+
+// Ratio returns the share of the table in use.
+func (u Usage) Ratio() float64 {
+	if u.Max <= 0 {
+		return 0
+	}
+	return float64(u.Count) / float64(u.Max)
+}
+
+// Level returns the level of the usage, LevelOK, LevelWarning or LevelCritical.
+func (u Usage) Level() string {
+	switch ratio := u.Ratio(); {
+	case ratio >= CriticalThreshold:
+		return LevelCritical
+	case ratio >= WarningThreshold:
+		return LevelWarning
+	}
+	return LevelOK
+}
+
+// String returns the usage in a human readable form.
+func (u Usage) String() string {
+	return fmt.Sprintf("%d/%d entries (%.0f%%)", u.Count, u.Max, u.Ratio()*100)
+}
+
+// Read returns the usage of the table of the network namespace the process runs in, read
+// under procRoot. An error is returned if the module is not loaded.
+func Read(procRoot string) (Usage, error) {
+	count, err := readInt(filepath.Join(procRoot, procDir, "nf_conntrack_count"))
+	if err != nil {
+		return Usage{}, err
+	}
+	size, err := readInt(filepath.Join(procRoot, procDir, "nf_conntrack_max"))
+	if err != nil {
+		return Usage{}, err
+	}
+	return Usage{Count: count, Max: size}, nil
+}
+
+// readInt reads the integer held in the file.
+func readInt(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("unable to read %s: %w", path, err)
+	}
+	value, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse %s: %w", path, err)
+	}
+	return value, nil
+}
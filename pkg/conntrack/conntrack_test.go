@@ -0,0 +1,138 @@
+package conntrack
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+func TestMax(t *testing.T) {
+	for name, tt := range map[string]struct {
+		cfg  *ecv1beta1.Conntrack
+		cpus int
+		want int64
+	}{
+		"default small host":  {cfg: nil, cpus: 2, want: 131072},
+		"default large host":  {cfg: nil, cpus: 16, want: 524288},
+		"high small host":     {cfg: &ecv1beta1.Conntrack{Profile: ProfileHigh}, cpus: 2, want: 524288},
+		"high large host":     {cfg: &ecv1beta1.Conntrack{Profile: ProfileHigh}, cpus: 16, want: 2097152},
+		"explicit size":       {cfg: &ecv1beta1.Conntrack{Profile: ProfileHigh, Max: 100000}, cpus: 16, want: 100000},
+		"unknown cpu count":   {cfg: &ecv1beta1.Conntrack{Profile: ProfileStandard}, cpus: 0, want: 131072},
+		"unknown profile":     {cfg: &ecv1beta1.Conntrack{Profile: "extreme"}, cpus: 8, want: 262144},
+		"standard large host": {cfg: &ecv1beta1.Conntrack{Profile: ProfileStandard}, cpus: 8, want: 262144},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Max(tt.cfg, tt.cpus))
+
+			// kube-proxy sizes the table the same way.
+			perCPU, minimum := KubeProxy(tt.cfg)
+			assert.Equal(t, tt.want, max(perCPU*int64(max(tt.cpus, 1)), minimum))
+		})
+	}
+}
+
+func TestRenderKubeProxyConfig(t *testing.T) {
+	// as rendered by k0s.
+	config := `apiVersion: kubeproxy.config.k8s.io/v1alpha1
+bindAddress: 0.0.0.0
+clusterCIDR: 10.244.0.0/16
+mode: "iptables"
+conntrack:
+  maxPerCore: 0
+  min: null
+  tcpCloseWaitTimeout: null
+  tcpEstablishedTimeout: null
+kind: KubeProxyConfiguration
+`
+	out, err := RenderKubeProxyConfig(config, &ecv1beta1.Conntrack{Profile: ProfileHigh})
+	require.NoError(t, err)
+	assert.Equal(t, `apiVersion: kubeproxy.config.k8s.io/v1alpha1
+bindAddress: 0.0.0.0
+clusterCIDR: 10.244.0.0/16
+conntrack:
+  maxPerCore: 131072
+  min: 524288
+  tcpCloseWaitTimeout: null
+  tcpEstablishedTimeout: null
+kind: KubeProxyConfiguration
+mode: iptables
+`, out)
+
+	out, err = RenderKubeProxyConfig(out, &ecv1beta1.Conntrack{Max: 100000})
+	require.NoError(t, err)
+	assert.Contains(t, out, "conntrack:\n  maxPerCore: 1\n  min: 100000\n")
+
+	out, err = RenderKubeProxyConfig("kind: KubeProxyConfiguration\n", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "conntrack:\n  maxPerCore: 32768\n  min: 131072\nkind: KubeProxyConfiguration\n", out)
+
+	_, err = RenderKubeProxyConfig("conntrack: [", nil)
+	assert.Error(t, err)
+}
+
+func TestConfigure(t *testing.T) {
+	orig := loadModule
+	loadModule = func() error { return nil }
+	t.Cleanup(func() { loadModule = orig })
+
+	root, procRoot := t.TempDir(), t.TempDir()
+	writeProc(t, procRoot, "nf_conntrack_max", "131072\n")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, filepath.Dir(hashsizePath)), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, hashsizePath), []byte("32768\n"), 0644))
+
+	require.NoError(t, configure(root, procRoot, 524288))
+	data, err := os.ReadFile(filepath.Join(root, SysctlPath))
+	require.NoError(t, err)
+	assert.Equal(t, "net.netfilter.nf_conntrack_max = 524288\n", string(data))
+	data, err = os.ReadFile(filepath.Join(root, ModprobePath))
+	require.NoError(t, err)
+	assert.Equal(t, "options nf_conntrack hashsize=131072\n", string(data))
+	assert.FileExists(t, filepath.Join(root, ModulesLoadPath))
+	assert.Equal(t, "524288", readProc(t, procRoot, "nf_conntrack_max"))
+	data, err = os.ReadFile(filepath.Join(root, hashsizePath))
+	require.NoError(t, err)
+	assert.Equal(t, "131072", string(data))
+
+	// a larger table is never shrunk.
+	writeProc(t, procRoot, "nf_conntrack_max", "1048576\n")
+	require.NoError(t, configure(root, procRoot, 524288))
+	data, err = os.ReadFile(filepath.Join(root, SysctlPath))
+	require.NoError(t, err)
+	assert.Equal(t, "net.netfilter.nf_conntrack_max = 1048576\n", string(data))
+	assert.Equal(t, "1048576\n", readProc(t, procRoot, "nf_conntrack_max"))
+}
+
+func TestRead(t *testing.T) {
+	procRoot := t.TempDir()
+	_, err := Read(procRoot)
+	assert.Error(t, err)
+
+	writeProc(t, procRoot, "nf_conntrack_count", "98304\n")
+	writeProc(t, procRoot, "nf_conntrack_max", "131072\n")
+	usage, err := Read(procRoot)
+	require.NoError(t, err)
+	assert.Equal(t, Usage{Count: 98304, Max: 131072}, usage)
+	assert.Equal(t, LevelWarning, usage.Level())
+	assert.Equal(t, "98304/131072 entries (75%)", usage.String())
+
+	assert.Equal(t, LevelOK, Usage{Count: 10, Max: 131072}.Level())
+	assert.Equal(t, LevelCritical, Usage{Count: 125000, Max: 131072}.Level())
+	assert.Equal(t, LevelOK, Usage{}.Level())
+}
+
+func writeProc(t *testing.T, procRoot, name, data string) {
+	dir := filepath.Join(procRoot, procDir)
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0644))
+}
+
+func readProc(t *testing.T, procRoot, name string) string {
+	data, err := os.ReadFile(filepath.Join(procRoot, procDir, name))
+	require.NoError(t, err)
+	return string(data)
+}
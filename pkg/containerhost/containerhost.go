@@ -0,0 +1,85 @@
+// Package containerhost detects hosts that are themselves containers, LXC containers as
+// run by Proxmox or systemd-nspawn machines. Kubernetes runs in those containers only when
+// they are privileged enough, see the host preflights, and the kubelet has to be told it
+// can not own the whole kernel.
+package containerhost
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strings"
+)
+
+const (
+	// LXC is the container technology of LXC and Proxmox containers.
+	LXC = "lxc"
+	// Nspawn is the container technology of systemd-nspawn machines.
+	Nspawn = "systemd-nspawn"
+)
+
+var (
+	// ContainerPath is where systemd records the container technology it runs in.
+	ContainerPath = "/run/systemd/container"
+	// InitEnvironPath holds the environment of the init process, container managers set
+	// the container variable in it.
+	InitEnvironPath = "/proc/1/environ"
+	// UIDMapPath holds the user namespace mapping of the process.
+	UIDMapPath = "/proc/self/uid_map"
+)
+
+// Detect returns the container technology the host runs in, for example LXC, Nspawn or
+// docker. An empty string is returned when the host is not a container.
+func Detect() string {
+	if data, err := os.ReadFile(ContainerPath); err == nil {
+		if container := strings.TrimSpace(string(data)); container != "" {
+			return container
+		}
+	}
+	data, err := os.ReadFile(InitEnvironPath)
+	if err != nil {
+		return ""
+	}
+	for _, env := range bytes.Split(data, []byte{0}) {
+		if container, ok := strings.CutPrefix(string(env), "container="); ok {
+			return container
+		}
+	}
+	return ""
+}
+
+// Supported returns true if kubernetes can run in containers of the technology.
+func Supported(container string) bool {
+	return container == LXC || container == Nspawn
+}
+
+// InUserNamespace returns true if the root user of the host is mapped to an unprivileged
+// user, as in unprivileged LXC containers.
+func InUserNamespace() bool {
+	f, err := os.Open(UIDMapPath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.Join(strings.Fields(scanner.Text()), " ") == "0 0 4294967295" {
+			return false
+		}
+	}
+	return true
+}
+
+// KubeletArgs returns the kubelet flags needed on hosts running in a container of the
+// technology, none if the host is not a container. The swap of the container is the swap
+// of its host, it can not be turned off from the container.
+func KubeletArgs(container string, userns bool) []string {
+	if container == "" {
+		return nil
+	}
+	args := []string{"--fail-swap-on=false"}
+	if userns {
+		args = append(args, "--feature-gates=KubeletInUserNamespace=true")
+	}
+	return args
+}
@@ -0,0 +1,50 @@
+package containerhost
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetect(t *testing.T) {
+	dir := t.TempDir()
+	ContainerPath = filepath.Join(dir, "container")
+	InitEnvironPath = filepath.Join(dir, "environ")
+	t.Cleanup(func() {
+		ContainerPath = "/run/systemd/container"
+		InitEnvironPath = "/proc/1/environ"
+	})
+
+	assert.Equal(t, "", Detect())
+
+	require.NoError(t, os.WriteFile(InitEnvironPath, []byte("PATH=/usr/bin\x00HOME=/root\x00"), 0644))
+	assert.Equal(t, "", Detect())
+
+	require.NoError(t, os.WriteFile(InitEnvironPath, []byte("PATH=/usr/bin\x00container=lxc\x00"), 0644))
+	assert.Equal(t, LXC, Detect())
+
+	require.NoError(t, os.WriteFile(ContainerPath, []byte("systemd-nspawn\n"), 0644))
+	assert.Equal(t, Nspawn, Detect())
+}
+
+func TestInUserNamespace(t *testing.T) {
+	UIDMapPath = filepath.Join(t.TempDir(), "uid_map")
+	t.Cleanup(func() { UIDMapPath = "/proc/self/uid_map" })
+
+	assert.False(t, InUserNamespace())
+
+	require.NoError(t, os.WriteFile(UIDMapPath, []byte("         0          0 4294967295\n"), 0644))
+	assert.False(t, InUserNamespace())
+
+	require.NoError(t, os.WriteFile(UIDMapPath, []byte("         0     100000      65536\n"), 0644))
+	assert.True(t, InUserNamespace())
+}
+
+func TestKubeletArgs(t *testing.T) {
+	assert.Empty(t, KubeletArgs("", false))
+	assert.Equal(t, []string{"--fail-swap-on=false"}, KubeletArgs(LXC, false))
+	assert.Equal(t, []string{"--fail-swap-on=false", "--feature-gates=KubeletInUserNamespace=true"}, KubeletArgs(LXC, true))
+}
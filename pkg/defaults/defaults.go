@@ -21,6 +21,23 @@ const VeleroNamespace = "velero"
 const AdminConsolePort = 30000
 const LocalArtifactMirrorPort = 50000
 
+// K0sDataDir is where k0s stores the cluster state, etcd included.
+const K0sDataDir = "/var/lib/k0s"
+
+// OpenEBSDataDir is where the OpenEBS local provisioner stores persistent volumes.
+const OpenEBSDataDir = "/var/openebs"
+
+// EphemeralDiskLabel is set on nodes that declared, during join, that one of their
+// disks is ephemeral (reimaged when the host is patched). The seaweedfs and registry
+// add-ons keep their data off these nodes through node affinity.
+const EphemeralDiskLabel = "kots.io/embedded-cluster-ephemeral-disk"
+
+// ZoneLabel holds the failure domain (zone) a node was assigned to during install or join.
+const ZoneLabel = "topology.kubernetes.io/zone"
+
+// RackLabel holds the rack, within its zone, a node was assigned to during install or join.
+const RackLabel = "kots.io/embedded-cluster-rack"
+
 // BinaryName calls BinaryName on the default provider.
 func BinaryName() string {
 	return DefaultProvider.BinaryName()
@@ -36,6 +53,11 @@ func EmbeddedClusterChartsSubDir() string {
 	return DefaultProvider.EmbeddedClusterChartsSubDir()
 }
 
+// EmbeddedClusterPluginsSubDir calls EmbeddedClusterPluginsSubDir on the default provider.
+func EmbeddedClusterPluginsSubDir() string {
+	return DefaultProvider.EmbeddedClusterPluginsSubDir()
+}
+
 // EmbeddedClusterImagesSubDir calls EmbeddedClusterImagesSubDir on the default provider.
 func EmbeddedClusterImagesSubDir() string {
 	return DefaultProvider.EmbeddedClusterImagesSubDir()
@@ -81,6 +103,31 @@ func PathToK0sStatusSocket() string {
 	return DefaultProvider.PathToK0sStatusSocket()
 }
 
+// PathToEncryptionConfig calls PathToEncryptionConfig on the default provider.
+func PathToEncryptionConfig() string {
+	return DefaultProvider.PathToEncryptionConfig()
+}
+
+// PathToTopologyFile calls PathToTopologyFile on the default provider.
+func PathToTopologyFile(name string) string {
+	return DefaultProvider.PathToTopologyFile(name)
+}
+
+// PathToExcludedHostCollectors calls PathToExcludedHostCollectors on the default provider.
+func PathToExcludedHostCollectors() string {
+	return DefaultProvider.PathToExcludedHostCollectors()
+}
+
+// PathToStorageSpec calls PathToStorageSpec on the default provider.
+func PathToStorageSpec() string {
+	return DefaultProvider.PathToStorageSpec()
+}
+
+// PathToChannelMetadataCache calls PathToChannelMetadataCache on the default provider.
+func PathToChannelMetadataCache() string {
+	return DefaultProvider.PathToChannelMetadataCache()
+}
+
 func PathToK0sContainerdConfig() string {
 	return DefaultProvider.PathToK0sContainerdConfig()
 }
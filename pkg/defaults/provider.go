@@ -82,6 +82,13 @@ func (d *Provider) EmbeddedClusterChartsSubDir() string {
 	return path
 }
 
+// EmbeddedClusterPluginsSubDir returns the path to the directory where the plugins shipped
+// in the release are stored. The directory is only created when the plugins are
+// materialized, commands run by unprivileged users look it up.
+func (d *Provider) EmbeddedClusterPluginsSubDir() string {
+	return filepath.Join(d.EmbeddedClusterHomeDirectory(), "plugins")
+}
+
 // EmbeddedClusterImagesSubDir returns the path to the directory where docker images are stored.
 func (d *Provider) EmbeddedClusterImagesSubDir() string {
 	path := filepath.Join(d.EmbeddedClusterHomeDirectory(), "images")
@@ -167,6 +174,36 @@ func (d *Provider) PathToK0sConfig() string {
 	return "/etc/k0s/k0s.yaml"
 }
 
+// PathToEncryptionConfig returns the full path to the kube-apiserver encryption at rest
+// configuration. The file holds the encryption keys and must only be readable by root.
+func (d *Provider) PathToEncryptionConfig() string {
+	return filepath.Join(d.EmbeddedClusterHomeDirectory(), "encryption", "config.yaml")
+}
+
+// PathToExcludedHostCollectors returns the full path to the file holding the host
+// collectors excluded from host preflights and support bundles on this node.
+func (d *Provider) PathToExcludedHostCollectors() string {
+	return filepath.Join(d.EmbeddedClusterHomeDirectory(), "excluded-host-collectors.yaml")
+}
+
+// PathToStorageSpec returns the full path to the file holding where the persistent
+// volumes are stored on this node and the space reserved for them.
+func (d *Provider) PathToStorageSpec() string {
+	return filepath.Join(d.EmbeddedClusterHomeDirectory(), "storage.yaml")
+}
+
+// PathToTopologyFile returns the full path to the file holding the zone or rack this
+// node was assigned to. The files are read by the storage pods scheduled on the node.
+func (d *Provider) PathToTopologyFile(name string) string {
+	return filepath.Join(d.EmbeddedClusterHomeDirectory(), "topology", name)
+}
+
+// PathToChannelMetadataCache returns the full path to the file caching the releases of
+// the channel, as last fetched from the replicated.app endpoint.
+func (d *Provider) PathToChannelMetadataCache() string {
+	return filepath.Join(d.EmbeddedClusterHomeDirectory(), "channel-metadata.json")
+}
+
 // PathToK0sContainerdConfig returns the full path to the k0s containerd configuration directory
 func (d *Provider) PathToK0sContainerdConfig() string {
 	return "/etc/k0s/containerd.d/"
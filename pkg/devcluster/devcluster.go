@@ -0,0 +1,147 @@
+// Package devcluster runs throwaway single node clusters in privileged docker or podman
+// containers, the way kind does, so releases can be tested on laptops. Nothing is
+// installed on the host itself: the cluster, its systemd units and its data live in the
+// container and are gone once it is removed. Rootless podman runs the container in a
+// user namespace.
+package devcluster
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+)
+
+// DefaultImage is the image of the container, it runs systemd as the nodes of the
+// cluster do.
+const DefaultImage = "replicated/ec-distro:debian-bookworm"
+
+// runtimes are the container runtimes looked for, in order.
+var runtimes = []string{"docker", "podman"}
+
+// licensePath is where the license is mounted in the container.
+const licensePath = "/ec/license.yaml"
+
+// Options holds the configuration of a dev cluster.
+type Options struct {
+	// Name is the name of the container, and the hostname of the node.
+	Name string
+	// Image is the image of the container.
+	Image string
+	// Binary is the path to the installer binary, mounted in the container under the
+	// same name as the name of the installation depends on it.
+	Binary string
+	// License is the path to the license file.
+	License string
+	// AdminConsolePort is published on the host.
+	AdminConsolePort int
+	// InstallArgs are passed to the install command on top of the ones set here.
+	InstallArgs []string
+}
+
+// Runtime is the container runtime running the dev clusters.
+type Runtime struct {
+	// Bin is the docker or podman binary.
+	Bin string
+}
+
+// FindRuntime returns the runtime with the name, the first of docker or podman found in
+// the path if name is empty.
+func FindRuntime(name string) (*Runtime, error) {
+	candidates := runtimes
+	if name != "" {
+		candidates = []string{name}
+	}
+	for _, candidate := range candidates {
+		if bin, err := exec.LookPath(candidate); err == nil {
+			return &Runtime{Bin: bin}, nil
+		}
+	}
+	if name != "" {
+		return nil, fmt.Errorf("container runtime %s not found", name)
+	}
+	return nil, fmt.Errorf("no container runtime found, install docker or podman")
+}
+
+// Exists returns true if the container of the dev cluster exists.
+func (r *Runtime) Exists(name string) bool {
+	_, err := helpers.RunCommand(r.Bin, "container", "inspect", name)
+	return err == nil
+}
+
+// Up starts the container and installs the cluster in it. The output of the install
+// command is written to stdout.
+func (r *Runtime) Up(opts Options) error {
+	if r.Exists(opts.Name) {
+		return fmt.Errorf("dev cluster %s already exists, remove it with dev down first", opts.Name)
+	}
+	args, err := runArgs(opts)
+	if err != nil {
+		return err
+	}
+	if _, err := helpers.RunCommand(r.Bin, args...); err != nil {
+		return fmt.Errorf("unable to start container %s: %w", opts.Name, err)
+	}
+	install := helpers.RunCommandOptions{Writer: os.Stdout}
+	if err := helpers.RunCommandWithOptions(install, r.Bin, installArgs(opts)...); err != nil {
+		return fmt.Errorf("unable to install the cluster: %w", err)
+	}
+	return nil
+}
+
+// Down removes the container of the dev cluster and its volumes, everything installed
+// goes with them.
+func (r *Runtime) Down(name string) error {
+	if !r.Exists(name) {
+		return fmt.Errorf("dev cluster %s not found", name)
+	}
+	if _, err := helpers.RunCommand(r.Bin, "rm", "--force", "--volumes", name); err != nil {
+		return fmt.Errorf("unable to remove container %s: %w", name, err)
+	}
+	return nil
+}
+
+// runArgs returns the arguments starting the container. The k0s data directory is a
+// volume as overlay filesystems can not hold the containerd snapshots.
+func runArgs(opts Options) ([]string, error) {
+	binary, err := filepath.Abs(opts.Binary)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get binary path: %w", err)
+	}
+	license, err := filepath.Abs(opts.License)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get license path: %w", err)
+	}
+	port := strconv.Itoa(opts.AdminConsolePort)
+	return []string{
+		"run", "--detach",
+		"--name", opts.Name,
+		"--hostname", opts.Name,
+		"--privileged",
+		"--cgroupns=host",
+		"--volume", "/var/lib/k0s",
+		"--volume", fmt.Sprintf("%s:%s:ro", binary, containerBinaryPath(opts)),
+		"--volume", fmt.Sprintf("%s:%s:ro", license, licensePath),
+		"--publish", fmt.Sprintf("%s:%s", port, port),
+		opts.Image,
+	}, nil
+}
+
+// installArgs returns the arguments installing the cluster in the container.
+func installArgs(opts Options) []string {
+	args := []string{
+		"exec", opts.Name,
+		containerBinaryPath(opts), "install",
+		"--license", licensePath,
+		"--admin-console-port", strconv.Itoa(opts.AdminConsolePort),
+		"--no-prompt",
+	}
+	return append(args, opts.InstallArgs...)
+}
+
+func containerBinaryPath(opts Options) string {
+	return filepath.Join("/ec/bin", filepath.Base(opts.Binary))
+}
@@ -0,0 +1,60 @@
+package devcluster
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArgs(t *testing.T) {
+	opts := Options{
+		Name:             "my-app-dev",
+		Image:            DefaultImage,
+		Binary:           "/home/dev/my-app",
+		License:          "/home/dev/license.yaml",
+		AdminConsolePort: 30000,
+		InstallArgs:      []string{"--skip-host-preflights"},
+	}
+	args, err := runArgs(opts)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"run", "--detach",
+		"--name", "my-app-dev",
+		"--hostname", "my-app-dev",
+		"--privileged",
+		"--cgroupns=host",
+		"--volume", "/var/lib/k0s",
+		"--volume", "/home/dev/my-app:/ec/bin/my-app:ro",
+		"--volume", "/home/dev/license.yaml:/ec/license.yaml:ro",
+		"--publish", "30000:30000",
+		"replicated/ec-distro:debian-bookworm",
+	}, args)
+
+	assert.Equal(t, []string{
+		"exec", "my-app-dev",
+		"/ec/bin/my-app", "install",
+		"--license", "/ec/license.yaml",
+		"--admin-console-port", "30000",
+		"--no-prompt",
+		"--skip-host-preflights",
+	}, installArgs(opts))
+}
+
+func TestFindRuntime(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+
+	_, err := FindRuntime("")
+	assert.EqualError(t, err, "no container runtime found, install docker or podman")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "podman"), []byte("#!/bin/sh\n"), 0755))
+	rt, err := FindRuntime("")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "podman"), rt.Bin)
+
+	_, err = FindRuntime("docker")
+	assert.EqualError(t, err, "container runtime docker not found")
+}
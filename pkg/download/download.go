@@ -0,0 +1,410 @@
+// Package download downloads large files over http in parallel chunks. Interrupted
+// downloads resume where they stopped.
+package download
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// DefaultChunks is the number of chunks downloaded in parallel by default.
+	DefaultChunks = 4
+	// chunkRetries is the number of times a chunk is requested again after a failure.
+	chunkRetries = 5
+	// stateInterval is how often the download state is saved.
+	stateInterval = time.Second
+)
+
+// Options configures a download.
+type Options struct {
+	// Header holds the headers sent with every request, e.g. the authorization.
+	Header http.Header
+	// Chunks is the number of chunks downloaded in parallel. Defaults to DefaultChunks.
+	Chunks int
+	// SHA256 is the expected checksum of the file, hex encoded. If empty, the checksum
+	// advertised by the server in a Digest or Repr-Digest header is verified, if any.
+	SHA256 string
+	// Client is the http client. Defaults to a client honoring the proxy environment.
+	Client *http.Client
+	// Progress, if set, is called with the number of bytes downloaded and the total size.
+	// The total size is -1 if the server does not report it. Calls are not concurrent.
+	Progress func(done, total int64)
+}
+
+// Result describes a completed download.
+type Result struct {
+	Size   int64
+	SHA256 string
+	// Verified indicates the checksum was checked against an expected value.
+	Verified bool
+}
+
+// state is persisted next to the partial file so an interrupted download resumes.
+type state struct {
+	URL    string   `json:"url"`
+	Size   int64    `json:"size"`
+	ETag   string   `json:"etag,omitempty"`
+	Chunks []*chunk `json:"chunks"`
+}
+
+// chunk is a byte range of the file, End is inclusive.
+type chunk struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	Done  int64 `json:"done"`
+}
+
+func (c *chunk) remaining() int64 {
+	return c.End - c.Start + 1 - c.Done
+}
+
+// File downloads the url to dst. The file is downloaded to dst with a .part suffix and
+// renamed once complete and verified. The chunks downloaded so far are recorded in a
+// state file so calling File again after an interruption resumes the download, as long
+// as the file on the server did not change. Servers not supporting range requests are
+// downloaded in one go, from the start.
+func File(ctx context.Context, url, dst string, opts Options) (*Result, error) {
+	if opts.Chunks <= 0 {
+		opts.Chunks = DefaultChunks
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment}}
+	}
+	if opts.Progress == nil {
+		opts.Progress = func(int64, int64) {}
+	}
+	part, statePath := dst+".part", dst+".part.json"
+
+	// a single byte is requested to learn the size of the file and whether the server
+	// supports range requests.
+	resp, err := get(ctx, opts, url, "bytes=0-0")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	expected := strings.ToLower(opts.SHA256)
+	if expected == "" {
+		expected = advertisedSHA256(resp.Header)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := stream(resp, part, opts.Progress); err != nil {
+			return nil, err
+		}
+	case http.StatusPartialContent:
+		size, err := contentRangeSize(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		st := loadState(statePath, part, url, size, resp.Header.Get("ETag"))
+		if st == nil {
+			st, err = newState(part, url, size, resp.Header.Get("ETag"), opts.Chunks)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := fetchChunks(ctx, opts, st, part, statePath); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, statusError(resp)
+	}
+
+	result, err := checksum(part)
+	if err != nil {
+		return nil, fmt.Errorf("unable to compute checksum: %w", err)
+	}
+	if expected != "" {
+		if result.SHA256 != expected {
+			// the content is not trusted, nothing is kept to resume from.
+			os.Remove(part)
+			os.Remove(statePath)
+			return nil, fmt.Errorf("checksum mismatch: expected sha256 %s, got %s", expected, result.SHA256)
+		}
+		result.Verified = true
+	}
+	if err := os.Rename(part, dst); err != nil {
+		return nil, fmt.Errorf("unable to rename downloaded file: %w", err)
+	}
+	os.Remove(statePath)
+	return result, nil
+}
+
+// get sends a get request for the url, with the range if not empty.
+func get(ctx context.Context, opts Options, url, byteRange string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request: %w", err)
+	}
+	for name, values := range opts.Header {
+		req.Header[name] = values
+	}
+	if byteRange != "" {
+		req.Header.Set("Range", byteRange)
+	}
+	resp, err := opts.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to request %s: %w", req.URL.Redacted(), err)
+	}
+	return resp, nil
+}
+
+func statusError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	msg := strings.TrimSpace(string(body))
+	if msg == "" {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, msg)
+}
+
+// stream writes the response body to the file, used when the server does not support
+// range requests.
+func stream(resp *http.Response, path string, progress func(int64, int64)) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to create file: %w", err)
+	}
+	defer f.Close()
+	var done int64
+	w := &progressWriter{w: f, written: func(n int64) {
+		done += n
+		progress(done, resp.ContentLength)
+	}}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("unable to download: %w", err)
+	}
+	return f.Close()
+}
+
+// contentRangeSize returns the complete length from a "bytes 0-0/1234" content range.
+func contentRangeSize(header string) (int64, error) {
+	_, total, ok := strings.Cut(header, "/")
+	if !ok || total == "*" {
+		return 0, fmt.Errorf("unable to get size from content range %q", header)
+	}
+	size, err := strconv.ParseInt(total, 10, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("unable to get size from content range %q", header)
+	}
+	return size, nil
+}
+
+// advertisedSHA256 returns the hex encoded sha256 the server advertises in a Digest
+// (RFC 3230) or Repr-Digest (RFC 9530) header, empty if none.
+func advertisedSHA256(header http.Header) string {
+	for _, value := range []string{header.Get("Repr-Digest"), header.Get("Digest")} {
+		for _, entry := range strings.Split(value, ",") {
+			alg, encoded, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			if !ok || !strings.EqualFold(alg, "sha-256") {
+				continue
+			}
+			// Repr-Digest values are structured field byte sequences, wrapped in colons.
+			sum, err := base64.StdEncoding.DecodeString(strings.Trim(encoded, ":"))
+			if err != nil || len(sum) != sha256.Size {
+				continue
+			}
+			return hex.EncodeToString(sum)
+		}
+	}
+	return ""
+}
+
+// loadState returns the saved state of a previous download of the same file, nil if there
+// is none or it can't be resumed.
+func loadState(statePath, part, url string, size int64, etag string) *state {
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		return nil
+	}
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil
+	}
+	if st.URL != url || st.Size != size || st.ETag != etag || len(st.Chunks) == 0 {
+		return nil
+	}
+	if info, err := os.Stat(part); err != nil || info.Size() != size {
+		return nil
+	}
+	return &st
+}
+
+// newState splits the file in chunks and allocates the partial file.
+func newState(part, url string, size int64, etag string, chunks int) (*state, error) {
+	f, err := os.Create(part)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create file: %w", err)
+	}
+	defer f.Close()
+	if err := f.Truncate(size); err != nil {
+		return nil, fmt.Errorf("unable to allocate file: %w", err)
+	}
+	if int64(chunks) > size {
+		chunks = int(size)
+	}
+	st := &state{URL: url, Size: size, ETag: etag}
+	length := size / int64(chunks)
+	for i := 0; i < chunks; i++ {
+		start := int64(i) * length
+		end := start + length - 1
+		if i == chunks-1 {
+			end = size - 1
+		}
+		st.Chunks = append(st.Chunks, &chunk{Start: start, End: end})
+	}
+	return st, nil
+}
+
+// fetchChunks downloads the remaining bytes of every chunk in parallel. The state is
+// saved regularly, and when returning, so the download can resume.
+func fetchChunks(ctx context.Context, opts Options, st *state, part, statePath string) error {
+	f, err := os.OpenFile(part, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("unable to open file: %w", err)
+	}
+	defer f.Close()
+
+	var mu sync.Mutex
+	save := func() {
+		mu.Lock()
+		data, err := json.Marshal(st)
+		mu.Unlock()
+		if err == nil {
+			_ = os.WriteFile(statePath, data, 0600)
+		}
+	}
+	done := func() int64 {
+		var total int64
+		for _, c := range st.Chunks {
+			total += c.Done
+		}
+		return total
+	}
+
+	stop := make(chan struct{})
+	defer func() {
+		close(stop)
+		save()
+	}()
+	go func() {
+		ticker := time.NewTicker(stateInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				save()
+			}
+		}
+	}()
+
+	opts.Progress(done(), st.Size)
+	g, gctx := errgroup.WithContext(ctx)
+	for _, c := range st.Chunks {
+		if c.remaining() == 0 {
+			continue
+		}
+		g.Go(func() error {
+			advance := func(n int64) {
+				mu.Lock()
+				defer mu.Unlock()
+				c.Done += n
+				opts.Progress(done(), st.Size)
+			}
+			var err error
+			for attempt := 0; attempt <= chunkRetries; attempt++ {
+				if attempt > 0 {
+					select {
+					case <-gctx.Done():
+						return gctx.Err()
+					case <-time.After(time.Duration(attempt) * time.Second):
+					}
+				}
+				if err = fetchChunk(gctx, opts, st.URL, c, f, advance); err == nil {
+					return nil
+				}
+				if gctx.Err() != nil {
+					return gctx.Err()
+				}
+			}
+			return err
+		})
+	}
+	return g.Wait()
+}
+
+// fetchChunk downloads the remaining bytes of the chunk into the file.
+func fetchChunk(ctx context.Context, opts Options, url string, c *chunk, f *os.File, advance func(int64)) error {
+	offset := c.Start + c.Done
+	resp, err := get(ctx, opts, url, fmt.Sprintf("bytes=%d-%d", offset, c.End))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return statusError(resp)
+	}
+	remaining := c.remaining()
+	w := &progressWriter{w: io.NewOffsetWriter(f, offset), limit: remaining, written: advance}
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return fmt.Errorf("unable to download bytes %d-%d: %w", offset, c.End, err)
+	}
+	if n != remaining {
+		return fmt.Errorf("unable to download bytes %d-%d: %w", offset, c.End, io.ErrUnexpectedEOF)
+	}
+	return nil
+}
+
+// progressWriter reports the number of bytes of every write. Writes beyond the limit, if
+// set, are refused.
+type progressWriter struct {
+	w       io.Writer
+	limit   int64
+	total   int64
+	written func(int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	if p.limit > 0 && p.total+int64(len(b)) > p.limit {
+		return 0, errors.New("server sent more bytes than requested")
+	}
+	n, err := p.w.Write(b)
+	p.total += int64(n)
+	p.written(int64(n))
+	return n, err
+}
+
+// checksum returns the size and sha256 of the file.
+func checksum(path string) (*Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
@@ -0,0 +1,202 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testContent(t *testing.T, size int) ([]byte, string) {
+	content := make([]byte, size)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+	sum := sha256.Sum256(content)
+	return content, hex.EncodeToString(sum[:])
+}
+
+// rangeServer serves the content with range support and counts the bytes sent.
+func rangeServer(t *testing.T, content []byte, sent *atomic.Int64) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "license-id", r.Header.Get("Authorization"))
+		w.Header().Set("ETag", `"v1"`)
+		cw := &countingWriter{ResponseWriter: w, sent: sent}
+		http.ServeContent(cw, r, "bundle.airgap", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	sent *atomic.Int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	c.sent.Add(int64(len(b)))
+	return c.ResponseWriter.Write(b)
+}
+
+func TestFile(t *testing.T) {
+	content, sum := testContent(t, 1<<20+7)
+	var sent atomic.Int64
+	server := rangeServer(t, content, &sent)
+
+	dst := filepath.Join(t.TempDir(), "bundle.airgap")
+	var last int64
+	result, err := File(context.Background(), server.URL, dst, Options{
+		Header:   http.Header{"Authorization": []string{"license-id"}},
+		Chunks:   3,
+		SHA256:   sum,
+		Progress: func(done, total int64) { last = done },
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &Result{Size: int64(len(content)), SHA256: sum, Verified: true}, result)
+	assert.Equal(t, int64(len(content)), last)
+
+	got, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+	_, err = os.Stat(dst + ".part")
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(dst + ".part.json")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFileResumes(t *testing.T) {
+	content, sum := testContent(t, 1<<20)
+	var sent atomic.Int64
+	server := rangeServer(t, content, &sent)
+
+	// the first half of both chunks was downloaded before the interruption.
+	dst := filepath.Join(t.TempDir(), "bundle.airgap")
+	half, quarter := int64(len(content)/2), int64(len(content)/4)
+	part := make([]byte, len(content))
+	copy(part[:quarter], content[:quarter])
+	copy(part[half:half+quarter], content[half:half+quarter])
+	require.NoError(t, os.WriteFile(dst+".part", part, 0600))
+	data, err := json.Marshal(state{
+		URL:  server.URL,
+		Size: int64(len(content)),
+		ETag: `"v1"`,
+		Chunks: []*chunk{
+			{Start: 0, End: half - 1, Done: quarter},
+			{Start: half, End: int64(len(content)) - 1, Done: quarter},
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(dst+".part.json", data, 0600))
+
+	result, err := File(context.Background(), server.URL, dst, Options{
+		Header: http.Header{"Authorization": []string{"license-id"}},
+		SHA256: sum,
+	})
+	require.NoError(t, err)
+	assert.True(t, result.Verified)
+	got, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+	// only the missing halves, and the probe byte, were downloaded.
+	assert.Equal(t, 2*quarter+1, sent.Load())
+}
+
+func TestFileRestartsWhenChanged(t *testing.T) {
+	content, sum := testContent(t, 4096)
+	var sent atomic.Int64
+	server := rangeServer(t, content, &sent)
+
+	dst := filepath.Join(t.TempDir(), "bundle.airgap")
+	require.NoError(t, os.WriteFile(dst+".part", make([]byte, len(content)), 0600))
+	data, err := json.Marshal(state{
+		URL: server.URL, Size: int64(len(content)), ETag: `"v0"`,
+		Chunks: []*chunk{{Start: 0, End: int64(len(content)) - 1, Done: int64(len(content))}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(dst+".part.json", data, 0600))
+
+	_, err = File(context.Background(), server.URL, dst, Options{
+		Header: http.Header{"Authorization": []string{"license-id"}},
+		SHA256: sum,
+	})
+	require.NoError(t, err)
+	got, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+}
+
+func TestFileChecksumMismatch(t *testing.T) {
+	content, _ := testContent(t, 4096)
+	var sent atomic.Int64
+	server := rangeServer(t, content, &sent)
+
+	dst := filepath.Join(t.TempDir(), "bundle.airgap")
+	_, err := File(context.Background(), server.URL, dst, Options{
+		Header: http.Header{"Authorization": []string{"license-id"}},
+		SHA256: strings.Repeat("0", 64),
+	})
+	assert.ErrorContains(t, err, "checksum mismatch")
+	for _, path := range []string{dst, dst + ".part", dst + ".part.json"} {
+		_, err = os.Stat(path)
+		assert.True(t, os.IsNotExist(err), path)
+	}
+}
+
+func TestFileWithoutRangeSupport(t *testing.T) {
+	content, sum := testContent(t, 4096)
+	raw, err := hex.DecodeString(sum)
+	require.NoError(t, err)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Digest", "sha-256="+base64.StdEncoding.EncodeToString(raw))
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	dst := filepath.Join(t.TempDir(), "bundle.airgap")
+	result, err := File(context.Background(), server.URL, dst, Options{})
+	require.NoError(t, err)
+	assert.True(t, result.Verified)
+	assert.Equal(t, sum, result.SHA256)
+}
+
+func TestFileUnauthorized(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "license not found", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	_, err := File(context.Background(), server.URL, filepath.Join(t.TempDir(), "bundle"), Options{})
+	assert.EqualError(t, err, "unexpected status code 401: license not found")
+}
+
+func TestAdvertisedSHA256(t *testing.T) {
+	sum := sha256.Sum256([]byte("bundle"))
+	encoded := base64.StdEncoding.EncodeToString(sum[:])
+	for _, tt := range []struct {
+		name   string
+		header http.Header
+		want   string
+	}{
+		{name: "none", header: http.Header{}},
+		{name: "digest", header: http.Header{"Digest": {"md5=abc, SHA-256=" + encoded}}, want: hex.EncodeToString(sum[:])},
+		{name: "repr digest", header: http.Header{"Repr-Digest": {"sha-256=:" + encoded + ":"}}, want: hex.EncodeToString(sum[:])},
+		{name: "invalid", header: http.Header{"Digest": {"sha-256=notbase64"}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, advertisedSHA256(tt.header))
+		})
+	}
+}
@@ -0,0 +1,207 @@
+// Package drainhooks runs the vendor provided hooks around node drains. Hooks
+// are Jobs created in the cluster, the drain only proceeds once they complete.
+package drainhooks
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	embeddedclusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+// Phase indicates when a hook is executed in relation to the drain.
+type Phase string
+
+const (
+	PreDrain  Phase = "pre-drain"
+	PostDrain Phase = "post-drain"
+)
+
+// DefaultTimeout is how long we wait for a hook to complete if the hook does
+// not specify a timeout.
+const DefaultTimeout = 5 * time.Minute
+
+// Run executes the hooks for the provided phase and node, as configured in the
+// installation config. Hooks run sequentially in the order they have been
+// declared. A Job still running from a previous attempt is waited on instead
+// of being created again, one that finished is replaced. Jobs are deleted once
+// they succeed, failed ones are kept around (for a while) for troubleshooting.
+func Run(ctx context.Context, cli client.Client, cfg *embeddedclusterv1beta1.ConfigSpec, phase Phase, node string) error {
+	for _, hook := range HooksFor(cfg, phase) {
+		logrus.Debugf("running %s hook %s for node %s", phase, hook.Name, node)
+		if err := runHook(ctx, cli, hook, phase, node); err != nil {
+			if hook.IgnoreFailure {
+				logrus.Warnf("Ignoring failed %s hook %s: %v", phase, hook.Name, err)
+				continue
+			}
+			return fmt.Errorf("%s hook %s: %w", phase, hook.Name, err)
+		}
+	}
+	return nil
+}
+
+// HooksFor returns the hooks configured for the provided phase.
+func HooksFor(cfg *embeddedclusterv1beta1.ConfigSpec, phase Phase) []embeddedclusterv1beta1.DrainHook {
+	if cfg == nil || cfg.DrainHooks == nil {
+		return nil
+	}
+	if phase == PreDrain {
+		return cfg.DrainHooks.PreDrain
+	}
+	return cfg.DrainHooks.PostDrain
+}
+
+func runHook(ctx context.Context, cli client.Client, hook embeddedclusterv1beta1.DrainHook, phase Phase, node string) error {
+	timeout := DefaultTimeout
+	if hook.Timeout != nil {
+		timeout = hook.Timeout.Duration
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	job := hookJob(hook, phase, node)
+	if err := createJob(ctx, cli, job); err != nil {
+		return err
+	}
+
+	var lasterr error
+	if err := wait.PollUntilContextCancel(ctx, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		var current batchv1.Job
+		if err := cli.Get(ctx, client.ObjectKeyFromObject(job), &current); err != nil {
+			lasterr = fmt.Errorf("unable to get job: %w", err)
+			return false, nil
+		}
+		for _, cond := range current.Status.Conditions {
+			if cond.Type == batchv1.JobFailed && cond.Status == corev1.ConditionTrue {
+				return false, fmt.Errorf("job %s failed: %s", current.Name, cond.Message)
+			}
+		}
+		return current.Status.Succeeded > 0, nil
+	}); err != nil {
+		if lasterr != nil && wait.Interrupted(err) {
+			return fmt.Errorf("timed out waiting for job %s: %w", job.Name, lasterr)
+		}
+		return err
+	}
+
+	propagation := metav1.DeletePropagationBackground
+	if err := cli.Delete(ctx, job, &client.DeleteOptions{PropagationPolicy: &propagation}); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("unable to delete job: %w", err)
+	}
+	return nil
+}
+
+// createJob creates the Job of a hook. A Job of a previous attempt still running is kept
+// and waited on. One that finished is deleted first, a failed Job would otherwise fail
+// every attempt until it expires.
+func createJob(ctx context.Context, cli client.Client, job *batchv1.Job) error {
+	err := cli.Create(ctx, job)
+	if err == nil {
+		return nil
+	} else if !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("unable to create job: %w", err)
+	}
+
+	var existing batchv1.Job
+	if err := cli.Get(ctx, client.ObjectKeyFromObject(job), &existing); err != nil {
+		return fmt.Errorf("unable to get job: %w", err)
+	}
+	if !jobFinished(existing) {
+		return nil
+	}
+	logrus.Debugf("deleting job %s left by a previous attempt", job.Name)
+	// foreground propagation keeps the job until its pods are gone.
+	propagation := metav1.DeletePropagationForeground
+	if err := cli.Delete(ctx, &existing, &client.DeleteOptions{PropagationPolicy: &propagation}); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("unable to delete job of a previous attempt: %w", err)
+	}
+	if err := wait.PollUntilContextCancel(ctx, time.Second, true, func(ctx context.Context) (bool, error) {
+		err := cli.Get(ctx, client.ObjectKeyFromObject(job), &batchv1.Job{})
+		return errors.IsNotFound(err), nil
+	}); err != nil {
+		return fmt.Errorf("timed out waiting for job %s of a previous attempt to be deleted: %w", job.Name, err)
+	}
+	job.ResourceVersion = ""
+	if err := cli.Create(ctx, job); err != nil {
+		return fmt.Errorf("unable to create job: %w", err)
+	}
+	return nil
+}
+
+// jobFinished returns true if the job succeeded or failed.
+func jobFinished(job batchv1.Job) bool {
+	if job.Status.Succeeded > 0 {
+		return true
+	}
+	for _, cond := range job.Status.Conditions {
+		if (cond.Type == batchv1.JobComplete || cond.Type == batchv1.JobFailed) && cond.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// hookJob returns the Job used to execute the provided hook for a node.
+func hookJob(hook embeddedclusterv1beta1.DrainHook, phase Phase, node string) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      JobName(hook, phase, node),
+			Namespace: hook.Namespace,
+			Labels: map[string]string{
+				"embedded-cluster/drain-hook":  hook.Name,
+				"embedded-cluster/drain-phase": string(phase),
+				"embedded-cluster/drain-node":  truncateName(node),
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            ptr.To[int32](2),
+			TTLSecondsAfterFinished: ptr.To[int32](3600),
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					ServiceAccountName: hook.ServiceAccountName,
+					RestartPolicy:      corev1.RestartPolicyNever,
+					Containers: []corev1.Container{
+						{
+							Name:    "hook",
+							Image:   hook.Image,
+							Command: hook.Command,
+							Env: []corev1.EnvVar{
+								{Name: "EC_NODE_NAME", Value: node},
+								{Name: "EC_DRAIN_PHASE", Value: string(phase)},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// JobName returns the name of the Job used to execute a hook for a node. Names
+// exceeding the kubernetes limits are truncated and suffixed with a hash of the
+// full name so they remain unique across nodes.
+func JobName(hook embeddedclusterv1beta1.DrainHook, phase Phase, node string) string {
+	return truncateName(fmt.Sprintf("%s-%s-%s", hook.Name, phase, node))
+}
+
+// truncateName returns the name fitting in the 63 characters limit of the names and the
+// label values. Longer names are truncated and suffixed with a hash of the full name.
+func truncateName(name string) string {
+	if len(name) <= 63 {
+		return name
+	}
+	sum := fmt.Sprintf("%x", sha256.Sum256([]byte(name)))[:8]
+	return fmt.Sprintf("%s-%s", strings.TrimRight(name[:54], "-."), sum)
+}
@@ -0,0 +1,110 @@
+package drainhooks
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	embeddedclusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+func TestJobName(t *testing.T) {
+	hook := embeddedclusterv1beta1.DrainHook{Name: "quiesce"}
+	assert.Equal(t, "quiesce-pre-drain-node-1", JobName(hook, PreDrain, "node-1"))
+
+	hook.Name = "a-very-long-hook-name-that-is-used-to-quiesce-the-database"
+	name := JobName(hook, PostDrain, "node-1")
+	assert.LessOrEqual(t, len(name), 63)
+	assert.NotRegexp(t, "[-.]$", name)
+	assert.NotEqual(t, name, JobName(hook, PostDrain, "node-2"))
+	assert.Equal(t, name, JobName(hook, PostDrain, "node-1"))
+}
+
+func TestHookJobLabels(t *testing.T) {
+	hook := embeddedclusterv1beta1.DrainHook{Name: "quiesce"}
+	node := "a-very-long-node-name-0123456789.us-east-1.compute.internal.example.com"
+	job := hookJob(hook, PreDrain, node)
+	value := job.Labels["embedded-cluster/drain-node"]
+	assert.LessOrEqual(t, len(value), 63)
+	assert.Empty(t, validation.IsValidLabelValue(value))
+	assert.Equal(t, "node-1", hookJob(hook, PreDrain, "node-1").Labels["embedded-cluster/drain-node"])
+}
+
+func TestHooksFor(t *testing.T) {
+	assert.Empty(t, HooksFor(nil, PreDrain))
+	cfg := &embeddedclusterv1beta1.ConfigSpec{
+		DrainHooks: &embeddedclusterv1beta1.DrainHooks{
+			PreDrain:  []embeddedclusterv1beta1.DrainHook{{Name: "pre"}},
+			PostDrain: []embeddedclusterv1beta1.DrainHook{{Name: "post"}},
+		},
+	}
+	assert.Equal(t, "pre", HooksFor(cfg, PreDrain)[0].Name)
+	assert.Equal(t, "post", HooksFor(cfg, PostDrain)[0].Name)
+}
+
+func TestRun(t *testing.T) {
+	hook := embeddedclusterv1beta1.DrainHook{
+		Name:      "quiesce",
+		Namespace: "kotsadm",
+		Image:     "busybox",
+		Command:   []string{"true"},
+	}
+	cfg := &embeddedclusterv1beta1.ConfigSpec{
+		DrainHooks: &embeddedclusterv1beta1.DrainHooks{
+			PreDrain: []embeddedclusterv1beta1.DrainHook{hook},
+		},
+	}
+
+	// jobs created run to the given status.
+	finish := func(status batchv1.JobStatus) interceptor.Funcs {
+		return interceptor.Funcs{
+			Create: func(ctx context.Context, cli client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				if job, ok := obj.(*batchv1.Job); ok {
+					job.Status = status
+				}
+				return cli.Create(ctx, obj, opts...)
+			},
+		}
+	}
+	succeeded := batchv1.JobStatus{Succeeded: 1}
+	failedStatus := batchv1.JobStatus{
+		Conditions: []batchv1.JobCondition{
+			{Type: batchv1.JobFailed, Status: "True", Message: "BackoffLimitExceeded"},
+		},
+	}
+
+	// succeeded jobs are removed.
+	cli := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithInterceptorFuncs(finish(succeeded)).Build()
+	require.NoError(t, Run(context.Background(), cli, cfg, PreDrain, "node-1"))
+	var job batchv1.Job
+	err := cli.Get(context.Background(), client.ObjectKeyFromObject(hookJob(hook, PreDrain, "node-1")), &job)
+	assert.True(t, errors.IsNotFound(err))
+
+	// a job left failed by a previous attempt is executed again.
+	failed := hookJob(hook, PreDrain, "node-2")
+	failed.Status = failedStatus
+	cli = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(failed).WithInterceptorFuncs(finish(succeeded)).Build()
+	require.NoError(t, Run(context.Background(), cli, cfg, PreDrain, "node-2"))
+	err = cli.Get(context.Background(), client.ObjectKeyFromObject(failed), &job)
+	assert.True(t, errors.IsNotFound(err))
+
+	// failed jobs are reported unless the hook ignores failures.
+	cli = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithInterceptorFuncs(finish(failedStatus)).Build()
+	err = Run(context.Background(), cli, cfg, PreDrain, "node-2")
+	assert.ErrorContains(t, err, "BackoffLimitExceeded")
+
+	cfg.DrainHooks.PreDrain[0].IgnoreFailure = true
+	assert.NoError(t, Run(context.Background(), cli, cfg, PreDrain, "node-2"))
+
+	// no hooks for the phase.
+	assert.NoError(t, Run(context.Background(), cli, cfg, PostDrain, "node-1"))
+}
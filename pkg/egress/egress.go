@@ -0,0 +1,209 @@
+// Package egress reports the endpoints outside of the cluster the cluster components
+// connect to. The report is generated from the cluster configuration so it can be
+// attached to firewall change requests.
+package egress
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+)
+
+// Endpoint is an endpoint outside of the cluster reached by the cluster components.
+type Endpoint struct {
+	// Host is the host name or address of the endpoint.
+	Host string `json:"host"`
+	// Port is the destination port.
+	Port int `json:"port"`
+	// Protocol is the application protocol used, e.g. https.
+	Protocol string `json:"protocol"`
+	// Components holds the cluster components connecting to the endpoint.
+	Components []string `json:"components"`
+	// Purpose describes why the endpoint is reached.
+	Purpose string `json:"purpose"`
+}
+
+// Report holds the endpoints reached by the cluster.
+type Report struct {
+	// AirGap indicates the cluster was installed in air gap mode.
+	AirGap bool `json:"airGap"`
+	// Proxy is the proxy http and https endpoints are reached through, if any.
+	Proxy string `json:"proxy,omitempty"`
+	// NoProxy holds the destinations not reached through the proxy.
+	NoProxy string `json:"noProxy,omitempty"`
+	// Endpoints holds the endpoints, sorted by host and port.
+	Endpoints []Endpoint `json:"endpoints"`
+}
+
+// Generate returns the endpoints reached by the cluster described by the installation.
+// Backups are stored in the provided velero backup storage locations.
+func Generate(in *ecv1beta1.Installation, locations []velerov1.BackupStorageLocation) (*Report, error) {
+	report := &Report{AirGap: in.Spec.AirGap}
+	endpoints := map[string]*Endpoint{}
+	add := func(rawurl, component, purpose string) error {
+		endpoint, err := parseEndpoint(rawurl)
+		if err != nil {
+			return fmt.Errorf("invalid %s endpoint: %w", component, err)
+		}
+		key := fmt.Sprintf("%s:%d", endpoint.Host, endpoint.Port)
+		if existing, ok := endpoints[key]; ok {
+			existing.Components = appendUnique(existing.Components, component)
+			if !strings.Contains(existing.Purpose, purpose) {
+				existing.Purpose = fmt.Sprintf("%s, %s", existing.Purpose, purpose)
+			}
+			return nil
+		}
+		endpoint.Components = []string{component}
+		endpoint.Purpose = purpose
+		endpoints[key] = endpoint
+		return nil
+	}
+
+	if proxy := in.Spec.Proxy; proxy != nil {
+		report.Proxy = proxy.HTTPSProxy
+		if report.Proxy == "" {
+			report.Proxy = proxy.HTTPProxy
+		}
+		report.NoProxy = proxy.NoProxy
+		if report.Proxy != "" {
+			if err := add(report.Proxy, "Proxy", "Proxy for http and https endpoints"); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if !in.Spec.AirGap {
+		if in.Spec.MetricsBaseURL != "" {
+			if err := add(in.Spec.MetricsBaseURL, "Admin Console", "License, updates and metrics"); err != nil {
+				return nil, err
+			}
+			if err := add(in.Spec.MetricsBaseURL, "Replicated SDK", "License, updates and metrics"); err != nil {
+				return nil, err
+			}
+		}
+		registry := fmt.Sprintf("https://%s", defaults.ProxyRegistryAddress)
+		if err := add(registry, "Container runtime", "Application and add-on images"); err != nil {
+			return nil, err
+		}
+		if in.Spec.Config != nil && in.Spec.Config.Extensions.Helm != nil {
+			for _, repo := range in.Spec.Config.Extensions.Helm.Repositories {
+				purpose := fmt.Sprintf("Helm repository %s", repo.Name)
+				if err := add(repo.URL, "Helm extensions", purpose); err != nil {
+					return nil, err
+				}
+			}
+			for _, chart := range in.Spec.Config.Extensions.Helm.Charts {
+				if !strings.HasPrefix(chart.ChartName, "oci://") {
+					continue
+				}
+				purpose := fmt.Sprintf("Helm chart %s", chart.Name)
+				if err := add(chart.ChartName, "Helm extensions", purpose); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	for _, location := range locations {
+		rawurl, err := objectStoreURL(location)
+		if err != nil {
+			return nil, err
+		}
+		if rawurl == "" {
+			continue
+		}
+		purpose := fmt.Sprintf("Backup storage location %s", location.Name)
+		if location.Spec.ObjectStorage != nil && location.Spec.ObjectStorage.Bucket != "" {
+			purpose = fmt.Sprintf("%s (bucket %s)", purpose, location.Spec.ObjectStorage.Bucket)
+		}
+		if err := add(rawurl, "Velero", purpose); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, endpoint := range endpoints {
+		report.Endpoints = append(report.Endpoints, *endpoint)
+	}
+	sort.Slice(report.Endpoints, func(i, j int) bool {
+		if report.Endpoints[i].Host != report.Endpoints[j].Host {
+			return report.Endpoints[i].Host < report.Endpoints[j].Host
+		}
+		return report.Endpoints[i].Port < report.Endpoints[j].Port
+	})
+	return report, nil
+}
+
+// objectStoreURL returns the url of the object store backing the provided backup
+// storage location. Returns an empty string for unknown providers without an url.
+func objectStoreURL(location velerov1.BackupStorageLocation) (string, error) {
+	config := location.Spec.Config
+	if s3url := config["s3Url"]; s3url != "" {
+		return s3url, nil
+	}
+	provider := strings.TrimPrefix(location.Spec.Provider, "velero.io/")
+	switch provider {
+	case "aws":
+		if region := config["region"]; region != "" {
+			return fmt.Sprintf("https://s3.%s.amazonaws.com", region), nil
+		}
+		return "https://s3.amazonaws.com", nil
+	case "gcp":
+		return "https://storage.googleapis.com", nil
+	case "azure":
+		if account := config["storageAccount"]; account != "" {
+			return fmt.Sprintf("https://%s.blob.core.windows.net", account), nil
+		}
+		return "", fmt.Errorf("backup storage location %s has no storage account", location.Name)
+	}
+	return "", nil
+}
+
+// parseEndpoint parses the provided url, defaulting the port based on the scheme. Urls
+// without scheme are assumed to be https.
+func parseEndpoint(rawurl string) (*Endpoint, error) {
+	if !strings.Contains(rawurl, "://") {
+		rawurl = fmt.Sprintf("https://%s", rawurl)
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", rawurl, err)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("no host in %s", rawurl)
+	}
+	protocol := u.Scheme
+	if protocol == "oci" {
+		protocol = "https"
+	}
+	port := 443
+	if protocol == "http" {
+		port = 80
+	}
+	if p := u.Port(); p != "" {
+		if port, err = strconv.Atoi(p); err != nil {
+			return nil, fmt.Errorf("invalid port in %s: %w", rawurl, err)
+		}
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		host = ip.String()
+	}
+	return &Endpoint{Host: host, Port: port, Protocol: protocol}, nil
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
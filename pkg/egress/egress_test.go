@@ -0,0 +1,96 @@
+package egress
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+func TestGenerate(t *testing.T) {
+	in := &ecv1beta1.Installation{
+		Spec: ecv1beta1.InstallationSpec{
+			MetricsBaseURL: "https://replicated.app",
+			Proxy: &ecv1beta1.ProxySpec{
+				HTTPSProxy: "http://10.0.0.1:3128",
+				NoProxy:    "10.0.0.0/8",
+			},
+			Config: &ecv1beta1.ConfigSpec{
+				Extensions: ecv1beta1.Extensions{
+					Helm: &ecv1beta1.Helm{
+						Repositories: []ecv1beta1.Repository{
+							{Name: "vendor", URL: "https://charts.example.com"},
+						},
+						Charts: []ecv1beta1.Chart{
+							{Name: "ingress", ChartName: "oci://registry.example.com:8443/charts/ingress"},
+							{Name: "monitoring", ChartName: "vendor/monitoring"},
+						},
+					},
+				},
+			},
+		},
+	}
+	locations := []velerov1.BackupStorageLocation{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "default"},
+			Spec: velerov1.BackupStorageLocationSpec{
+				Provider: "aws",
+				Config:   map[string]string{"region": "us-east-1"},
+				StorageType: velerov1.StorageType{
+					ObjectStorage: &velerov1.ObjectStorageLocation{Bucket: "backups"},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "minio"},
+			Spec: velerov1.BackupStorageLocationSpec{
+				Provider: "velero.io/aws",
+				Config:   map[string]string{"s3Url": "http://minio.example.com:9000"},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "local"},
+			Spec:       velerov1.BackupStorageLocationSpec{Provider: "replicated.com/pvc"},
+		},
+	}
+
+	report, err := Generate(in, locations)
+	require.NoError(t, err)
+	assert.Equal(t, "http://10.0.0.1:3128", report.Proxy)
+	assert.Equal(t, "10.0.0.0/8", report.NoProxy)
+	assert.Equal(t, []Endpoint{
+		{Host: "10.0.0.1", Port: 3128, Protocol: "http", Components: []string{"Proxy"}, Purpose: "Proxy for http and https endpoints"},
+		{Host: "charts.example.com", Port: 443, Protocol: "https", Components: []string{"Helm extensions"}, Purpose: "Helm repository vendor"},
+		{Host: "minio.example.com", Port: 9000, Protocol: "http", Components: []string{"Velero"}, Purpose: "Backup storage location minio"},
+		{Host: "proxy.replicated.com", Port: 443, Protocol: "https", Components: []string{"Container runtime"}, Purpose: "Application and add-on images"},
+		{Host: "registry.example.com", Port: 8443, Protocol: "https", Components: []string{"Helm extensions"}, Purpose: "Helm chart ingress"},
+		{Host: "replicated.app", Port: 443, Protocol: "https", Components: []string{"Admin Console", "Replicated SDK"}, Purpose: "License, updates and metrics"},
+		{Host: "s3.us-east-1.amazonaws.com", Port: 443, Protocol: "https", Components: []string{"Velero"}, Purpose: "Backup storage location default (bucket backups)"},
+	}, report.Endpoints)
+}
+
+func TestGenerateAirGap(t *testing.T) {
+	in := &ecv1beta1.Installation{
+		Spec: ecv1beta1.InstallationSpec{
+			AirGap:         true,
+			MetricsBaseURL: "https://replicated.app",
+		},
+	}
+	report, err := Generate(in, nil)
+	require.NoError(t, err)
+	assert.True(t, report.AirGap)
+	assert.Empty(t, report.Endpoints)
+
+	locations := []velerov1.BackupStorageLocation{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "default"},
+			Spec:       velerov1.BackupStorageLocationSpec{Provider: "azure"},
+		},
+	}
+	_, err = Generate(in, locations)
+	assert.Error(t, err)
+}
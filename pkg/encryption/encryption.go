@@ -0,0 +1,363 @@
+// Package encryption manages the kube-apiserver encryption at rest configuration.
+// Secrets are encrypted using the secretbox provider. The configuration holds the
+// encryption keys and must be the same on all controllers.
+package encryption
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+)
+
+// SecretName is the name of the Secret holding a copy of the encryption configuration.
+// The admin console returns its content in the join response so joining controllers
+// use the same keys, and the host repair agents install it on the other controllers when
+// the keys are rotated.
+const SecretName = "embedded-cluster-encryption-config"
+
+// SecretKey is the key of the encryption configuration in the Secret.
+const SecretKey = "encryption-config.yaml"
+
+// ConfigAnnotation is the annotation of the controller nodes holding the hash, as returned
+// by Hash, of the encryption configuration their api server was last restarted with. Key
+// rotations wait for all the controllers to run with the new configuration.
+const ConfigAnnotation = "replicated.com/encryption-config"
+
+// Configuration mirrors the kube-apiserver EncryptionConfiguration object. Only the
+// fields we use are present.
+type Configuration struct {
+	APIVersion string                  `json:"apiVersion"`
+	Kind       string                  `json:"kind"`
+	Resources  []ResourceConfiguration `json:"resources"`
+}
+
+// ResourceConfiguration holds the providers used to encrypt a list of resources.
+type ResourceConfiguration struct {
+	Resources []string                `json:"resources"`
+	Providers []ProviderConfiguration `json:"providers"`
+}
+
+// ProviderConfiguration is an encryption provider. Only one of the fields is set.
+type ProviderConfiguration struct {
+	Secretbox *KeysConfiguration `json:"secretbox,omitempty"`
+	Identity  *struct{}          `json:"identity,omitempty"`
+}
+
+// KeysConfiguration holds the keys of a provider. The first key is used to encrypt,
+// all of them are used to decrypt.
+type KeysConfiguration struct {
+	Keys []Key `json:"keys"`
+}
+
+// Key is a named encryption key. The secret is base64 encoded.
+type Key struct {
+	Name   string `json:"name"`
+	Secret string `json:"secret"`
+}
+
+// APIServerArgs returns the kube-apiserver flags enabling encryption at rest.
+func APIServerArgs() map[string]string {
+	return map[string]string{
+		"encryption-provider-config": defaults.PathToEncryptionConfig(),
+	}
+}
+
+// Enabled returns true if the provided k0s config encrypts secrets at rest.
+func Enabled(cfg *k0sv1beta1.ClusterConfig) bool {
+	if cfg == nil || cfg.Spec == nil || cfg.Spec.API == nil {
+		return false
+	}
+	_, ok := cfg.Spec.API.ExtraArgs["encryption-provider-config"]
+	return ok
+}
+
+// WriteConfig generates a new encryption key and writes the encryption configuration.
+// An existing configuration is never overwritten as that would render the data already
+// encrypted with it unreadable.
+func WriteConfig() error {
+	if _, err := os.Stat(defaults.PathToEncryptionConfig()); err == nil {
+		return nil
+	}
+	key, err := newKey()
+	if err != nil {
+		return err
+	}
+	cfg := Configuration{
+		APIVersion: "apiserver.config.k8s.io/v1",
+		Kind:       "EncryptionConfiguration",
+		Resources: []ResourceConfiguration{
+			{
+				Resources: []string{"secrets"},
+				Providers: []ProviderConfiguration{
+					{Secretbox: &KeysConfiguration{Keys: []Key{key}}},
+					{Identity: &struct{}{}},
+				},
+			},
+		},
+	}
+	return writeConfig(&cfg)
+}
+
+// InstallConfig copies an encryption configuration taken from an existing controller
+// into place. Used when joining controllers to the cluster.
+func InstallConfig(src string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("unable to read encryption config: %w", err)
+	}
+	return InstallConfigData(data)
+}
+
+// InstallConfigData writes the provided encryption configuration, as received in the
+// join response, into place.
+func InstallConfigData(data []byte) error {
+	var cfg Configuration
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("unable to unmarshal encryption config: %w", err)
+	}
+	if _, err := secretboxKeys(&cfg); err != nil {
+		return err
+	}
+	return writeConfig(&cfg)
+}
+
+// RotateKey generates a new key and makes it the primary one. Previous keys are kept
+// so existing secrets can still be decrypted until they have been re-encrypted. The
+// kube-apiserver must be restarted for the change to take effect.
+func RotateKey() (string, error) {
+	cfg, err := ReadConfig()
+	if err != nil {
+		return "", err
+	}
+	keys, err := secretboxKeys(cfg)
+	if err != nil {
+		return "", err
+	}
+	key, err := newKey()
+	if err != nil {
+		return "", err
+	}
+	keys.Keys = append([]Key{key}, keys.Keys...)
+	if err := writeConfig(cfg); err != nil {
+		return "", err
+	}
+	return key.Name, nil
+}
+
+// AddKey generates a new key and adds it after the existing ones, it is only used to
+// decrypt until it is promoted with PromoteKey. Clusters with more than one controller
+// need all their api servers to know the key before any of them encrypts with it. The
+// kube-apiserver must be restarted for the change to take effect.
+func AddKey() (string, error) {
+	cfg, err := ReadConfig()
+	if err != nil {
+		return "", err
+	}
+	keys, err := secretboxKeys(cfg)
+	if err != nil {
+		return "", err
+	}
+	key, err := newKey()
+	if err != nil {
+		return "", err
+	}
+	// names are only unique to the second, the key is promoted by name.
+	base := key.Name
+	for i := 1; slices.ContainsFunc(keys.Keys, func(k Key) bool { return k.Name == key.Name }); i++ {
+		key.Name = fmt.Sprintf("%s-%d", base, i)
+	}
+	keys.Keys = append(keys.Keys, key)
+	if err := writeConfig(cfg); err != nil {
+		return "", err
+	}
+	return key.Name, nil
+}
+
+// PromoteKey makes the named key the primary one, the one secrets are encrypted with. The
+// other keys are kept so existing secrets can still be decrypted. The kube-apiserver must
+// be restarted for the change to take effect.
+func PromoteKey(name string) error {
+	cfg, err := ReadConfig()
+	if err != nil {
+		return err
+	}
+	keys, err := secretboxKeys(cfg)
+	if err != nil {
+		return err
+	}
+	idx := slices.IndexFunc(keys.Keys, func(key Key) bool { return key.Name == name })
+	if idx < 0 {
+		return fmt.Errorf("key %s not found in encryption config", name)
+	}
+	key := keys.Keys[idx]
+	keys.Keys = append([]Key{key}, slices.Delete(keys.Keys, idx, idx+1)...)
+	return writeConfig(cfg)
+}
+
+// PruneKeys removes all keys but the primary one. Must only be called once all
+// secrets have been re-encrypted with the primary key.
+func PruneKeys() error {
+	cfg, err := ReadConfig()
+	if err != nil {
+		return err
+	}
+	keys, err := secretboxKeys(cfg)
+	if err != nil {
+		return err
+	}
+	keys.Keys = keys.Keys[:1]
+	return writeConfig(cfg)
+}
+
+// ReencryptSecrets rewrites all secrets in the cluster so they are encrypted with the
+// current primary key. Returns the number of secrets rewritten.
+func ReencryptSecrets(ctx context.Context, cli client.Client) (int, error) {
+	var secrets corev1.SecretList
+	if err := cli.List(ctx, &secrets); err != nil {
+		return 0, fmt.Errorf("unable to list secrets: %w", err)
+	}
+	var count int
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if err := cli.Update(ctx, secret); err != nil {
+			// secrets written after the rotation are already encrypted with the new key.
+			if k8serrors.IsConflict(err) || k8serrors.IsNotFound(err) {
+				continue
+			}
+			return count, fmt.Errorf("unable to update secret %s/%s: %w", secret.Namespace, secret.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// StoreConfig creates or updates the Secret holding a copy of the encryption
+// configuration of this node in the provided namespace.
+func StoreConfig(ctx context.Context, cli client.Client, namespace string) error {
+	data, err := os.ReadFile(defaults.PathToEncryptionConfig())
+	if err != nil {
+		return fmt.Errorf("unable to read encryption config: %w", err)
+	}
+	secret := corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      SecretName,
+			Namespace: namespace,
+		},
+		Data: map[string][]byte{SecretKey: data},
+	}
+	if err := cli.Create(ctx, &secret); err == nil {
+		return nil
+	} else if !k8serrors.IsAlreadyExists(err) {
+		return fmt.Errorf("unable to create encryption config secret: %w", err)
+	}
+	var existing corev1.Secret
+	if err := cli.Get(ctx, client.ObjectKeyFromObject(&secret), &existing); err != nil {
+		return fmt.Errorf("unable to get encryption config secret: %w", err)
+	}
+	existing.Data = secret.Data
+	if err := cli.Update(ctx, &existing); err != nil {
+		return fmt.Errorf("unable to update encryption config secret: %w", err)
+	}
+	return nil
+}
+
+// Hash returns the hash of the provided encryption configuration. Configurations holding
+// the same keys have the same hash however they were serialized.
+func Hash(data []byte) (string, error) {
+	var cfg Configuration
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return "", fmt.Errorf("unable to unmarshal encryption config: %w", err)
+	}
+	normalized, err := yaml.Marshal(cfg)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal encryption config: %w", err)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(normalized))[:16], nil
+}
+
+// WriteConfigFile validates the provided encryption configuration and writes it to the
+// path. Used to install the configuration of the cluster on hosts mounted elsewhere.
+func WriteConfigFile(path string, data []byte) error {
+	var cfg Configuration
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("unable to unmarshal encryption config: %w", err)
+	}
+	if _, err := secretboxKeys(&cfg); err != nil {
+		return err
+	}
+	return writeFile(path, data)
+}
+
+// ReadConfig reads the encryption configuration from disk.
+func ReadConfig() (*Configuration, error) {
+	data, err := os.ReadFile(defaults.PathToEncryptionConfig())
+	if err != nil {
+		return nil, fmt.Errorf("unable to read encryption config: %w", err)
+	}
+	var cfg Configuration
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal encryption config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// secretboxKeys returns the keys of the secretbox provider used to encrypt secrets.
+func secretboxKeys(cfg *Configuration) (*KeysConfiguration, error) {
+	for _, res := range cfg.Resources {
+		for _, provider := range res.Providers {
+			if provider.Secretbox != nil && len(provider.Secretbox.Keys) > 0 {
+				return provider.Secretbox, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no secretbox keys found in encryption config")
+}
+
+func newKey() (Key, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return Key{}, fmt.Errorf("unable to generate encryption key: %w", err)
+	}
+	return Key{
+		Name:   fmt.Sprintf("key-%s", time.Now().UTC().Format("20060102150405")),
+		Secret: base64.StdEncoding.EncodeToString(secret),
+	}, nil
+}
+
+func writeConfig(cfg *Configuration) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("unable to marshal encryption config: %w", err)
+	}
+	return writeFile(defaults.PathToEncryptionConfig(), data)
+}
+
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("unable to create directory: %w", err)
+	}
+	// the file is replaced atomically, losing the keys would make the secrets unreadable.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("unable to write encryption config: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("unable to move encryption config: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package encryption
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+)
+
+func setupProvider(t *testing.T) {
+	original := defaults.DefaultProvider
+	defaults.DefaultProvider = defaults.NewProvider(t.TempDir())
+	t.Cleanup(func() { defaults.DefaultProvider = original })
+}
+
+func TestWriteConfig(t *testing.T) {
+	setupProvider(t)
+
+	require.NoError(t, WriteConfig())
+	info, err := os.Stat(defaults.PathToEncryptionConfig())
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	cfg, err := ReadConfig()
+	require.NoError(t, err)
+	require.Len(t, cfg.Resources, 1)
+	assert.Equal(t, []string{"secrets"}, cfg.Resources[0].Resources)
+	require.Len(t, cfg.Resources[0].Providers, 2)
+	require.Len(t, cfg.Resources[0].Providers[0].Secretbox.Keys, 1)
+	assert.NotNil(t, cfg.Resources[0].Providers[1].Identity)
+	key := cfg.Resources[0].Providers[0].Secretbox.Keys[0]
+
+	// an existing configuration is never overwritten.
+	require.NoError(t, WriteConfig())
+	cfg, err = ReadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, key, cfg.Resources[0].Providers[0].Secretbox.Keys[0])
+}
+
+func TestRotateKey(t *testing.T) {
+	setupProvider(t)
+
+	_, err := RotateKey()
+	assert.Error(t, err)
+
+	require.NoError(t, WriteConfig())
+	cfg, err := ReadConfig()
+	require.NoError(t, err)
+	previous := cfg.Resources[0].Providers[0].Secretbox.Keys[0]
+
+	_, err = RotateKey()
+	require.NoError(t, err)
+	cfg, err = ReadConfig()
+	require.NoError(t, err)
+	keys := cfg.Resources[0].Providers[0].Secretbox.Keys
+	require.Len(t, keys, 2)
+	assert.NotEqual(t, previous.Secret, keys[0].Secret)
+	assert.Equal(t, previous, keys[1])
+
+	require.NoError(t, PruneKeys())
+	cfg, err = ReadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, keys[:1], cfg.Resources[0].Providers[0].Secretbox.Keys)
+}
+
+func TestAddAndPromoteKey(t *testing.T) {
+	setupProvider(t)
+	require.NoError(t, WriteConfig())
+	cfg, err := ReadConfig()
+	require.NoError(t, err)
+	previous := cfg.Resources[0].Providers[0].Secretbox.Keys[0]
+
+	// the new key only decrypts until it is promoted.
+	name, err := AddKey()
+	require.NoError(t, err)
+	cfg, err = ReadConfig()
+	require.NoError(t, err)
+	keys := cfg.Resources[0].Providers[0].Secretbox.Keys
+	require.Len(t, keys, 2)
+	assert.Equal(t, previous, keys[0])
+	assert.Equal(t, name, keys[1].Name)
+
+	require.NoError(t, PromoteKey(name))
+	cfg, err = ReadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, []Key{keys[1], previous}, cfg.Resources[0].Providers[0].Secretbox.Keys)
+
+	assert.Error(t, PromoteKey("unknown"))
+}
+
+func TestHash(t *testing.T) {
+	setupProvider(t)
+	require.NoError(t, WriteConfig())
+	data, err := os.ReadFile(defaults.PathToEncryptionConfig())
+	require.NoError(t, err)
+	hash, err := Hash(data)
+	require.NoError(t, err)
+
+	// the serialization does not matter.
+	cfg, err := ReadConfig()
+	require.NoError(t, err)
+	key := cfg.Resources[0].Providers[0].Secretbox.Keys[0]
+	reordered := fmt.Sprintf(`kind: EncryptionConfiguration
+apiVersion: apiserver.config.k8s.io/v1
+resources:
+- resources: [secrets]
+  providers:
+  - secretbox:
+      keys:
+      - secret: %s
+        name: %s
+  - identity: {}
+`, key.Secret, key.Name)
+	same, err := Hash([]byte(reordered))
+	require.NoError(t, err)
+	assert.Equal(t, hash, same)
+
+	_, err = AddKey()
+	require.NoError(t, err)
+	data, err = os.ReadFile(defaults.PathToEncryptionConfig())
+	require.NoError(t, err)
+	rotated, err := Hash(data)
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, rotated)
+}
+
+func TestWriteConfigFile(t *testing.T) {
+	setupProvider(t)
+	require.NoError(t, WriteConfig())
+	data, err := os.ReadFile(defaults.PathToEncryptionConfig())
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "encryption", "config.yaml")
+	assert.Error(t, WriteConfigFile(path, []byte("resources: []\n")))
+	require.NoError(t, WriteConfigFile(path, data))
+	written, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, data, written)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestInstallConfig(t *testing.T) {
+	setupProvider(t)
+
+	src := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(src, []byte("apiVersion: apiserver.config.k8s.io/v1\nkind: EncryptionConfiguration\nresources: []\n"), 0644))
+	assert.Error(t, InstallConfig(src))
+
+	require.NoError(t, WriteConfig())
+	data, err := os.ReadFile(defaults.PathToEncryptionConfig())
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(src, data, 0644))
+	require.NoError(t, os.Remove(defaults.PathToEncryptionConfig()))
+
+	require.NoError(t, InstallConfig(src))
+	installed, err := os.ReadFile(defaults.PathToEncryptionConfig())
+	require.NoError(t, err)
+	assert.Equal(t, string(data), string(installed))
+}
+
+func TestReencryptSecrets(t *testing.T) {
+	cli := fake.NewClientBuilder().WithObjects(
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "kube-system"}},
+	).Build()
+	count, err := ReencryptSecrets(context.Background(), cli)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestStoreConfig(t *testing.T) {
+	setupProvider(t)
+	require.NoError(t, WriteConfig())
+
+	cli := fake.NewClientBuilder().Build()
+	require.NoError(t, StoreConfig(context.Background(), cli, "embedded-cluster"))
+
+	_, err := RotateKey()
+	require.NoError(t, err)
+	require.NoError(t, StoreConfig(context.Background(), cli, "embedded-cluster"))
+
+	var secret corev1.Secret
+	require.NoError(t, cli.Get(context.Background(), client.ObjectKey{Namespace: "embedded-cluster", Name: SecretName}, &secret))
+	data, err := os.ReadFile(defaults.PathToEncryptionConfig())
+	require.NoError(t, err)
+	assert.Equal(t, data, secret.Data[SecretKey])
+
+	// the stored configuration can be installed on another controller.
+	setupProvider(t)
+	require.NoError(t, InstallConfigData(secret.Data[SecretKey]))
+	installed, err := os.ReadFile(defaults.PathToEncryptionConfig())
+	require.NoError(t, err)
+	assert.Equal(t, data, installed)
+}
+
+func TestEnabled(t *testing.T) {
+	assert.False(t, Enabled(nil))
+	cfg := k0sv1beta1.DefaultClusterConfig()
+	assert.False(t, Enabled(cfg))
+	cfg.Spec.API.ExtraArgs = APIServerArgs()
+	assert.True(t, Enabled(cfg))
+}
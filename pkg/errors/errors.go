@@ -0,0 +1,135 @@
+// Package errors classifies the errors returned by install, join and upgrade so they are
+// reported the same way everywhere: the kind of an error selects the exit code of the
+// command, is sent along with the failure metrics and tells users where to look first.
+// Errors are classified where they happen and keep their message, wrapping them again
+// with fmt.Errorf and %w preserves the kind.
+package errors
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kind is the class of a failure.
+type Kind string
+
+const (
+	// Unknown is the kind of errors that were not classified.
+	Unknown Kind = ""
+	// Preflight is the kind of host preflight failures.
+	Preflight Kind = "Preflight"
+	// HostConfig is the kind of failures to configure the host: packages, firewall,
+	// selinux, systemd units and files on disk.
+	HostConfig Kind = "HostConfig"
+	// K0s is the kind of failures to install, start or reach k0s and the kubernetes
+	// api.
+	K0s Kind = "K0s"
+	// Addon is the kind of failures to install or upgrade the add-ons and their charts.
+	Addon Kind = "Addon"
+	// Network is the kind of failures to reach the network, the cluster or the proxy.
+	Network Kind = "Network"
+	// License is the kind of invalid, expired or mismatching licenses.
+	License Kind = "License"
+	// Privileges is the kind of commands run without the root user, capabilities or file
+	// access they need.
+	Privileges Kind = "Privileges"
+	// Interrupted is the kind of commands interrupted by the user or stopped by their
+	// timeout before they finished.
+	Interrupted Kind = "Interrupted"
+	// Locked is the kind of operations refused because another one is running on the
+	// cluster.
+	Locked Kind = "Locked"
+)
+
+// exitCodes holds the exit code of each kind, 1 is used for unclassified errors and 2 is
+// left for usage errors.
+var exitCodes = map[Kind]int{
+	Preflight:   3,
+	HostConfig:  4,
+	K0s:         5,
+	Addon:       6,
+	Network:     7,
+	License:     8,
+	Privileges:  9,
+	Interrupted: 10,
+	Locked:      11,
+}
+
+// hints tells users where to look first for each kind.
+var hints = map[Kind]string{
+	Preflight:   "Resolve the host preflight failures above and try again.",
+	HostConfig:  "The host could not be configured, check the host has the required packages and permissions.",
+	K0s:         "Kubernetes failed to start, check the k0s service logs with journalctl.",
+	Addon:       "An add-on failed to install, check the pods of the cluster for errors.",
+	Network:     "Check the network connectivity and the proxy settings of the host.",
+	License:     "Check the license is valid and matches this release.",
+	Privileges:  "Run the command with sudo or as a user holding the missing privileges.",
+	Interrupted: "The command stopped before it finished and the host may be partially configured. Run the reset command to clean it up before trying again.",
+	Locked:      "Another operation is running on the cluster, the status command shows which one. Wait for it to finish and try again.",
+}
+
+// Error is an error classified with a kind.
+type Error struct {
+	Kind Kind
+	Err  error
+}
+
+// Error returns the message of the wrapped error, the kind is not part of the message.
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithKind classifies the error with the kind, the message is unchanged. Nil is returned
+// if the error is nil.
+func WithKind(kind Kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// Errorf formats the error as fmt.Errorf does and classifies it with the kind.
+func Errorf(kind Kind, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// KindOf returns the kind of the error. When the error was classified more than once the
+// innermost, most specific, kind is returned, unless the command was interrupted: the
+// interruption explains whatever failed in the middle of it. Unknown is returned if the
+// error was not classified.
+func KindOf(err error) Kind {
+	kind := Unknown
+	for {
+		var e *Error
+		if !errors.As(err, &e) {
+			return kind
+		}
+		if e.Kind == Interrupted {
+			return Interrupted
+		}
+		kind, err = e.Kind, e.Err
+	}
+}
+
+// ExitCode returns the exit code of a command failing with the error, 0 if there is no
+// error.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if code, ok := exitCodes[KindOf(err)]; ok {
+		return code
+	}
+	return 1
+}
+
+// Hint returns what users should look at first when a command fails with the error, an
+// empty string is returned for unclassified errors.
+func Hint(err error) string {
+	return hints[KindOf(err)]
+}
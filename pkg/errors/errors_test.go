@@ -0,0 +1,78 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKindOf(t *testing.T) {
+	base := fmt.Errorf("connection refused")
+	for _, tt := range []struct {
+		name string
+		err  error
+		want Kind
+	}{
+		{
+			name: "not classified",
+			err:  base,
+			want: Unknown,
+		},
+		{
+			name: "classified",
+			err:  WithKind(Network, base),
+			want: Network,
+		},
+		{
+			name: "wrapped after classification",
+			err:  fmt.Errorf("unable to join: %w", Errorf(K0s, "unable to start: %w", base)),
+			want: K0s,
+		},
+		{
+			name: "innermost kind wins",
+			err:  Errorf(Addon, "unable to install chart: %w", WithKind(Network, base)),
+			want: Network,
+		},
+		{
+			name: "interruption wins",
+			err:  WithKind(Interrupted, Errorf(K0s, "unable to wait for node: %w", base)),
+			want: Interrupted,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, KindOf(tt.err))
+		})
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	base := fmt.Errorf("license expired")
+	err := WithKind(License, base)
+	assert.Equal(t, "license expired", err.Error())
+	assert.True(t, errors.Is(err, base))
+
+	err = Errorf(License, "unable to get license: %w", base)
+	assert.Equal(t, "unable to get license: license expired", err.Error())
+	assert.True(t, errors.Is(err, base))
+
+	assert.NoError(t, WithKind(License, nil))
+}
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, 0, ExitCode(nil))
+	assert.Equal(t, 1, ExitCode(fmt.Errorf("boom")))
+	assert.Equal(t, 3, ExitCode(WithKind(Preflight, fmt.Errorf("boom"))))
+	assert.Equal(t, 8, ExitCode(fmt.Errorf("install: %w", WithKind(License, fmt.Errorf("boom")))))
+
+	// every kind has its own exit code.
+	seen := map[int]Kind{}
+	for _, kind := range []Kind{Preflight, HostConfig, K0s, Addon, Network, License, Privileges, Interrupted, Locked} {
+		code := ExitCode(WithKind(kind, fmt.Errorf("boom")))
+		assert.NotContains(t, seen, code, "kind %s", kind)
+		assert.NotEmpty(t, Hint(WithKind(kind, fmt.Errorf("boom"))), "kind %s", kind)
+		seen[code] = kind
+	}
+	assert.Empty(t, Hint(fmt.Errorf("boom")))
+}
@@ -0,0 +1,259 @@
+// Package etcdsnapshot takes scheduled snapshots of the cluster datastore on controllers.
+// Snapshots are k0s backups, holding the etcd database along with the certificates needed
+// to restore it, kept in the data directory and optionally uploaded to an S3 bucket. The
+// number of snapshots kept in each location is bounded by a retention.
+package etcdsnapshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultSchedule is the systemd calendar expression snapshots are taken on.
+	DefaultSchedule = "daily"
+	// DefaultRetention is the number of snapshots kept in each location.
+	DefaultRetention = 7
+
+	namePrefix = "etcd-snapshot-"
+	nameSuffix = ".tar.gz"
+	timeLayout = "20060102T150405Z"
+)
+
+// S3Target is the bucket snapshots are uploaded to.
+type S3Target struct {
+	Bucket          string `json:"bucket"`
+	Prefix          string `json:"prefix,omitempty"`
+	Endpoint        string `json:"endpoint,omitempty"`
+	Region          string `json:"region"`
+	AccessKeyID     string `json:"accessKeyID,omitempty"`
+	SecretAccessKey string `json:"secretAccessKey,omitempty"`
+}
+
+// Config is the snapshot configuration chosen at install time.
+type Config struct {
+	Schedule  string    `json:"schedule"`
+	Retention int       `json:"retention"`
+	S3        *S3Target `json:"s3,omitempty"`
+}
+
+// Snapshot is a snapshot stored locally or in the bucket.
+type Snapshot struct {
+	Name      string    `json:"name"`
+	Location  string    `json:"location"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ParseS3URL parses a target in the s3://bucket/prefix?region=...&endpoint=... form. The
+// credentials are read from the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY variables.
+func ParseS3URL(raw string) (*S3Target, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse s3 url: %w", err)
+	}
+	if u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("s3 url must be in the s3://bucket/prefix form")
+	}
+	target := &S3Target{
+		Bucket:          u.Host,
+		Prefix:          strings.Trim(u.Path, "/"),
+		Endpoint:        u.Query().Get("endpoint"),
+		Region:          u.Query().Get("region"),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+	}
+	if target.Region == "" {
+		target.Region = "us-east-1"
+	}
+	return target, nil
+}
+
+// ReadConfig reads the configuration, nil is returned if snapshots are not configured.
+func ReadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read etcd snapshot config: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("unable to parse etcd snapshot config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// WriteConfig writes the configuration, readable by root only as it may hold credentials.
+func WriteConfig(path string, cfg Config) error {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("unable to marshal etcd snapshot config: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("unable to write etcd snapshot config: %w", err)
+	}
+	return nil
+}
+
+// snapshotName returns the name of a snapshot taken at the time.
+func snapshotName(t time.Time) string {
+	return namePrefix + t.UTC().Format(timeLayout) + nameSuffix
+}
+
+// parseSnapshotName returns the time a snapshot was taken at, false if the name is not the
+// one of a snapshot.
+func parseSnapshotName(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, namePrefix) || !strings.HasSuffix(name, nameSuffix) {
+		return time.Time{}, false
+	}
+	ts := strings.TrimSuffix(strings.TrimPrefix(name, namePrefix), nameSuffix)
+	t, err := time.Parse(timeLayout, ts)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// Manager takes, lists and fetches snapshots.
+type Manager struct {
+	// K0s is the path to the k0s binary.
+	K0s string
+	// Dir is the local directory snapshots are kept in.
+	Dir    string
+	Config Config
+}
+
+func (m *Manager) stores() ([]store, error) {
+	stores := []store{&localStore{dir: m.Dir}}
+	if m.Config.S3 != nil {
+		s3, err := newS3Store(m.Config.S3)
+		if err != nil {
+			return nil, err
+		}
+		stores = append(stores, s3)
+	}
+	return stores, nil
+}
+
+// Take takes a snapshot, stores it in every location and prunes the snapshots above the
+// retention.
+func (m *Manager) Take(ctx context.Context) (*Snapshot, error) {
+	if err := os.MkdirAll(m.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("unable to create snapshot directory: %w", err)
+	}
+	tmpdir, err := os.MkdirTemp(m.Dir, ".snapshot-")
+	if err != nil {
+		return nil, fmt.Errorf("unable to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	if out, err := exec.CommandContext(ctx, m.K0s, "backup", "--save-path", tmpdir).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("unable to back up k0s: %w: %s", err, out)
+	}
+	entries, err := os.ReadDir(tmpdir)
+	if err != nil || len(entries) != 1 {
+		return nil, fmt.Errorf("unable to find the k0s backup in %s", tmpdir)
+	}
+
+	now := time.Now()
+	name := snapshotName(now)
+	stores, err := m.stores()
+	if err != nil {
+		return nil, err
+	}
+	src := filepath.Join(tmpdir, entries[0].Name())
+	for _, s := range stores {
+		if err := s.put(ctx, name, src); err != nil {
+			return nil, fmt.Errorf("unable to store snapshot in %s: %w", s.location(), err)
+		}
+	}
+	if err := m.prune(ctx, stores); err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(filepath.Join(m.Dir, name))
+	if err != nil {
+		return nil, fmt.Errorf("unable to stat snapshot: %w", err)
+	}
+	return &Snapshot{Name: name, Location: "local", Size: info.Size(), CreatedAt: now.UTC().Truncate(time.Second)}, nil
+}
+
+// prune deletes the oldest snapshots of each store above the retention.
+func (m *Manager) prune(ctx context.Context, stores []store) error {
+	retention := m.Config.Retention
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+	for _, s := range stores {
+		snapshots, err := s.list(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to list snapshots in %s: %w", s.location(), err)
+		}
+		for i := retention; i < len(snapshots); i++ {
+			if err := s.delete(ctx, snapshots[i].Name); err != nil {
+				return fmt.Errorf("unable to delete snapshot %s from %s: %w", snapshots[i].Name, s.location(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// List returns the snapshots of every location, the most recent first.
+func (m *Manager) List(ctx context.Context) ([]Snapshot, error) {
+	stores, err := m.stores()
+	if err != nil {
+		return nil, err
+	}
+	var all []Snapshot
+	for _, s := range stores {
+		snapshots, err := s.list(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list snapshots in %s: %w", s.location(), err)
+		}
+		all = append(all, snapshots...)
+	}
+	sortSnapshots(all)
+	return all, nil
+}
+
+// Fetch returns the local path of the snapshot, downloading it from the bucket if it is
+// not kept locally anymore.
+func (m *Manager) Fetch(ctx context.Context, name string) (string, error) {
+	if _, ok := parseSnapshotName(name); !ok {
+		return "", fmt.Errorf("invalid snapshot name %q", name)
+	}
+	path := filepath.Join(m.Dir, name)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	if m.Config.S3 == nil {
+		return "", fmt.Errorf("snapshot %s not found", name)
+	}
+	s3, err := newS3Store(m.Config.S3)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(m.Dir, 0700); err != nil {
+		return "", fmt.Errorf("unable to create snapshot directory: %w", err)
+	}
+	if err := s3.get(ctx, name, path); err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("unable to download snapshot %s: %w", name, err)
+	}
+	return path, nil
+}
+
+func sortSnapshots(snapshots []Snapshot) {
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt)
+	})
+}
@@ -0,0 +1,141 @@
+package etcdsnapshot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseS3URL(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	tests := []struct {
+		name    string
+		raw     string
+		want    *S3Target
+		wantErr bool
+	}{
+		{
+			name: "bucket only",
+			raw:  "s3://backups",
+			want: &S3Target{Bucket: "backups", Region: "us-east-1", AccessKeyID: "key", SecretAccessKey: "secret"},
+		},
+		{
+			name: "prefix region and endpoint",
+			raw:  "s3://backups/cluster/etcd/?region=eu-west-1&endpoint=https://minio.local:9000",
+			want: &S3Target{
+				Bucket:          "backups",
+				Prefix:          "cluster/etcd",
+				Endpoint:        "https://minio.local:9000",
+				Region:          "eu-west-1",
+				AccessKeyID:     "key",
+				SecretAccessKey: "secret",
+			},
+		},
+		{
+			name:    "wrong scheme",
+			raw:     "https://backups/etcd",
+			wantErr: true,
+		},
+		{
+			name:    "no bucket",
+			raw:     "s3:///etcd",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseS3URL(tt.raw)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSnapshotName(t *testing.T) {
+	at := time.Date(2024, 3, 5, 10, 20, 30, 0, time.UTC)
+	name := snapshotName(at)
+	assert.Equal(t, "etcd-snapshot-20240305T102030Z.tar.gz", name)
+
+	got, ok := parseSnapshotName(name)
+	assert.True(t, ok)
+	assert.True(t, at.Equal(got))
+
+	for _, invalid := range []string{"backup.tar.gz", "etcd-snapshot-yesterday.tar.gz", ".etcd-snapshot-20240305T102030Z.tar.gz"} {
+		_, ok := parseSnapshotName(invalid)
+		assert.False(t, ok, invalid)
+	}
+}
+
+func TestConfigRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "etcd-snapshots.json")
+
+	cfg, err := ReadConfig(path)
+	require.NoError(t, err)
+	assert.Nil(t, cfg)
+
+	want := Config{Schedule: "*-*-* 02:00:00", Retention: 3, S3: &S3Target{Bucket: "backups", Region: "us-east-1"}}
+	require.NoError(t, WriteConfig(path, want))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	cfg, err = ReadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, &want, cfg)
+}
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	src := filepath.Join(t.TempDir(), "backup.tar.gz")
+	require.NoError(t, os.WriteFile(src, []byte("snapshot"), 0600))
+
+	local := &localStore{dir: dir}
+	start := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, local.put(ctx, snapshotName(start.Add(time.Duration(i)*time.Hour)), src))
+	}
+	// files that are not snapshots are left alone.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0600))
+
+	mgr := &Manager{Dir: dir, Config: Config{Retention: 2}}
+	require.NoError(t, mgr.prune(ctx, []store{local}))
+
+	snapshots, err := mgr.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, snapshots, 2)
+	assert.Equal(t, snapshotName(start.Add(4*time.Hour)), snapshots[0].Name)
+	assert.Equal(t, snapshotName(start.Add(3*time.Hour)), snapshots[1].Name)
+	assert.Equal(t, "local", snapshots[0].Location)
+	assert.Equal(t, int64(len("snapshot")), snapshots[0].Size)
+	assert.FileExists(t, filepath.Join(dir, "notes.txt"))
+
+	path, err := mgr.Fetch(ctx, snapshots[0].Name)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, snapshots[0].Name), path)
+
+	_, err = mgr.Fetch(ctx, snapshotName(start))
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestUnits(t *testing.T) {
+	service := ServiceUnit("/var/lib/embedded-cluster/bin/embedded-cluster")
+	assert.Contains(t, service, "Type=oneshot")
+	assert.Contains(t, service, "ExecStart=/var/lib/embedded-cluster/bin/embedded-cluster admin etcd-snapshots take")
+
+	timer := TimerUnit("daily")
+	assert.Contains(t, timer, "OnCalendar=daily")
+	assert.Contains(t, timer, "Persistent=true")
+	assert.Contains(t, timer, "WantedBy=timers.target")
+}
@@ -0,0 +1,200 @@
+package etcdsnapshot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// store is a location snapshots are kept in.
+type store interface {
+	location() string
+	// list returns the snapshots, the most recent first.
+	list(ctx context.Context) ([]Snapshot, error)
+	put(ctx context.Context, name, src string) error
+	get(ctx context.Context, name, dst string) error
+	delete(ctx context.Context, name string) error
+}
+
+// localStore keeps the snapshots in a directory of the host.
+type localStore struct {
+	dir string
+}
+
+func (l *localStore) location() string {
+	return "local"
+}
+
+func (l *localStore) list(_ context.Context) ([]Snapshot, error) {
+	entries, err := os.ReadDir(l.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var snapshots []Snapshot
+	for _, entry := range entries {
+		createdAt, ok := parseSnapshotName(entry.Name())
+		if !ok || entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, Snapshot{
+			Name:      entry.Name(),
+			Location:  l.location(),
+			Size:      info.Size(),
+			CreatedAt: createdAt,
+		})
+	}
+	sortSnapshots(snapshots)
+	return snapshots, nil
+}
+
+func (l *localStore) put(_ context.Context, name, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	// the snapshot is written under a temporary name so a partial copy is never listed.
+	tmp := filepath.Join(l.dir, "."+name)
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(l.dir, name))
+}
+
+func (l *localStore) get(_ context.Context, name, dst string) error {
+	return fmt.Errorf("local snapshots are read in place")
+}
+
+func (l *localStore) delete(_ context.Context, name string) error {
+	return os.Remove(filepath.Join(l.dir, name))
+}
+
+// s3Store keeps the snapshots in a bucket.
+type s3Store struct {
+	target *S3Target
+	sess   *session.Session
+}
+
+func newS3Store(target *S3Target) (*s3Store, error) {
+	cfg := &aws.Config{Region: aws.String(target.Region)}
+	if target.Endpoint != "" {
+		u, err := url.Parse(target.Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("parse endpoint: %w", err)
+		}
+		cfg.Endpoint = aws.String(target.Endpoint)
+		cfg.S3ForcePathStyle = aws.Bool(!strings.HasSuffix(u.Hostname(), ".amazonaws.com"))
+	}
+	if target.AccessKeyID != "" {
+		cfg.Credentials = credentials.NewStaticCredentials(target.AccessKeyID, target.SecretAccessKey, "")
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("create s3 session: %w", err)
+	}
+	return &s3Store{target: target, sess: sess}, nil
+}
+
+func (s *s3Store) location() string {
+	return fmt.Sprintf("s3://%s", path.Join(s.target.Bucket, s.target.Prefix))
+}
+
+func (s *s3Store) key(name string) string {
+	return path.Join(s.target.Prefix, name)
+}
+
+func (s *s3Store) list(ctx context.Context) ([]Snapshot, error) {
+	prefix := ""
+	if s.target.Prefix != "" {
+		prefix = s.target.Prefix + "/"
+	}
+	input := &s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.target.Bucket),
+		Prefix:    aws.String(prefix + namePrefix),
+		Delimiter: aws.String("/"),
+	}
+	var snapshots []Snapshot
+	err := s3.New(s.sess).ListObjectsV2PagesWithContext(ctx, input, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, obj := range page.Contents {
+			name := path.Base(aws.StringValue(obj.Key))
+			createdAt, ok := parseSnapshotName(name)
+			if !ok {
+				continue
+			}
+			snapshots = append(snapshots, Snapshot{
+				Name:      name,
+				Location:  s.location(),
+				Size:      aws.Int64Value(obj.Size),
+				CreatedAt: createdAt,
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortSnapshots(snapshots)
+	return snapshots, nil
+}
+
+func (s *s3Store) put(ctx context.Context, name, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	_, err = s3manager.NewUploader(s.sess).UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket: aws.String(s.target.Bucket),
+		Key:    aws.String(s.key(name)),
+		Body:   in,
+	})
+	return err
+}
+
+func (s *s3Store) get(ctx context.Context, name, dst string) error {
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = s3manager.NewDownloader(s.sess).DownloadWithContext(ctx, out, &s3.GetObjectInput{
+		Bucket: aws.String(s.target.Bucket),
+		Key:    aws.String(s.key(name)),
+	})
+	return err
+}
+
+func (s *s3Store) delete(ctx context.Context, name string) error {
+	_, err := s3.New(s.sess).DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.target.Bucket),
+		Key:    aws.String(s.key(name)),
+	})
+	return err
+}
@@ -0,0 +1,96 @@
+package etcdsnapshot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+)
+
+// unitName is the name of the systemd service and timer taking the snapshots.
+const unitName = "etcd-snapshot"
+
+var systemdDir = "/etc/systemd/system"
+
+// ServiceUnit returns the systemd service taking a snapshot with the binary.
+func ServiceUnit(binary string) string {
+	return fmt.Sprintf(`[Unit]
+Description=Embedded Cluster etcd snapshot
+After=k0scontroller.service
+
+[Service]
+Type=oneshot
+ExecStart=%s admin etcd-snapshots take
+`, binary)
+}
+
+// TimerUnit returns the systemd timer starting the service on the schedule, a systemd
+// calendar expression. Missed snapshots are taken when the host boots.
+func TimerUnit(schedule string) string {
+	return fmt.Sprintf(`[Unit]
+Description=Embedded Cluster etcd snapshot schedule
+
+[Timer]
+OnCalendar=%s
+RandomizedDelaySec=5m
+Persistent=true
+
+[Install]
+WantedBy=timers.target
+`, schedule)
+}
+
+// ValidateSchedule verifies the schedule is a calendar expression systemd understands.
+func ValidateSchedule(schedule string) error {
+	if _, err := helpers.RunCommand("systemd-analyze", "calendar", schedule); err != nil {
+		return fmt.Errorf("invalid etcd snapshot schedule %q: %w", schedule, err)
+	}
+	return nil
+}
+
+// InstallTimer writes the systemd units and enables the timer.
+func InstallTimer(binary, schedule string) error {
+	service := filepath.Join(systemdDir, unitName+".service")
+	if err := os.WriteFile(service, []byte(ServiceUnit(binary)), 0644); err != nil {
+		return fmt.Errorf("unable to write etcd snapshot service: %w", err)
+	}
+	timer := filepath.Join(systemdDir, unitName+".timer")
+	if err := os.WriteFile(timer, []byte(TimerUnit(schedule)), 0644); err != nil {
+		return fmt.Errorf("unable to write etcd snapshot timer: %w", err)
+	}
+	if _, err := helpers.RunCommand("systemctl", "daemon-reload"); err != nil {
+		return fmt.Errorf("unable to reload systemctl daemon: %w", err)
+	}
+	if _, err := helpers.RunCommand("systemctl", "enable", "--now", unitName+".timer"); err != nil {
+		return fmt.Errorf("unable to enable etcd snapshot timer: %w", err)
+	}
+	return nil
+}
+
+// TimerInstalled returns true if the timer taking the snapshots is installed.
+func TimerInstalled() bool {
+	_, err := os.Stat(filepath.Join(systemdDir, unitName+".timer"))
+	return err == nil
+}
+
+// RemoveTimer disables the timer and removes the systemd units, nothing is done if they
+// do not exist.
+func RemoveTimer() error {
+	timer := filepath.Join(systemdDir, unitName+".timer")
+	if _, err := os.Stat(timer); os.IsNotExist(err) {
+		return nil
+	}
+	if _, err := helpers.RunCommand("systemctl", "disable", "--now", unitName+".timer"); err != nil {
+		return fmt.Errorf("unable to disable etcd snapshot timer: %w", err)
+	}
+	for _, unit := range []string{timer, filepath.Join(systemdDir, unitName+".service")} {
+		if err := os.Remove(unit); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove %s: %w", unit, err)
+		}
+	}
+	if _, err := helpers.RunCommand("systemctl", "daemon-reload"); err != nil {
+		return fmt.Errorf("unable to reload systemctl daemon: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+// Package fips holds the helpers used when running in FIPS mode. A FIPS build of
+// the binary is produced by compiling it with GOEXPERIMENT=boringcrypto.
+package fips
+
+import (
+	"fmt"
+)
+
+// TLSMinVersion is the minimum TLS version configured for the cluster
+// components when running in FIPS mode.
+const TLSMinVersion = "VersionTLS12"
+
+// TLSCipherSuites holds the FIPS approved cipher suites configured for the
+// cluster components when running in FIPS mode.
+var TLSCipherSuites = []string{
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+}
+
+// EnsureSupported returns an error if the running binary has not been built
+// with FIPS validated cryptography.
+func EnsureSupported() error {
+	if !Enabled() {
+		return fmt.Errorf("this binary has not been built with FIPS validated cryptography, use the FIPS build instead")
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build boringcrypto
+
+package fips
+
+import (
+	"crypto/boring"
+	_ "crypto/tls/fipsonly"
+)
+
+// Enabled returns true if the binary uses FIPS validated cryptography.
+func Enabled() bool {
+	return boring.Enabled()
+}
@@ -0,0 +1,8 @@
+//go:build !boringcrypto
+
+package fips
+
+// Enabled returns true if the binary uses FIPS validated cryptography.
+func Enabled() bool {
+	return false
+}
@@ -0,0 +1,460 @@
+// Package firewall opens, in the host firewall, the ports the cluster needs to be reachable
+// by other nodes. Firewalld, ufw and nftables are supported. The ports are opened in the
+// firewalld zone of the node interface, as ufw rules, or as rules inserted in the nftables
+// input chains of the host. Rules are tagged so they can be removed when the node is reset.
+package firewall
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+)
+
+// Backend is the tool used to manage the host firewall.
+type Backend string
+
+const (
+	// None means no supported firewall was found on the host.
+	None Backend = ""
+	// Firewalld manages the firewall through firewall-cmd.
+	Firewalld Backend = "firewalld"
+	// UFW manages the firewall through ufw.
+	UFW Backend = "ufw"
+	// NFTables manages the firewall through nft.
+	NFTables Backend = "nftables"
+)
+
+// name is used for the firewalld service and as the comment of the ufw and nftables rules.
+// Older versions loaded the nftables rules in a table with this name.
+const name = "embedded-cluster"
+
+var (
+	// FirewalldServicesDir is where custom firewalld services are defined.
+	FirewalldServicesDir = "/etc/firewalld/services"
+	// SystemdDir is where the k0s service drop-ins inserting the nftables rules on boot
+	// are written.
+	SystemdDir = "/etc/systemd/system"
+)
+
+// Port is a port that must be reachable by other nodes.
+type Port struct {
+	Number      int
+	Protocol    string
+	Description string
+}
+
+// String returns the port in the port/protocol format.
+func (p Port) String() string {
+	return fmt.Sprintf("%d/%s", p.Number, p.Protocol)
+}
+
+// RequiredPorts returns the ports that must be reachable for the node to join and
+// serve the cluster.
+func RequiredPorts(adminConsolePort, localArtifactMirrorPort int) []Port {
+	return []Port{
+		{Number: 6443, Protocol: "tcp", Description: "Kubernetes API server"},
+		{Number: 9443, Protocol: "tcp", Description: "k0s API"},
+		{Number: 2380, Protocol: "tcp", Description: "etcd peers"},
+		{Number: 10250, Protocol: "tcp", Description: "Kubelet"},
+		{Number: 4789, Protocol: "udp", Description: "Calico VXLAN"},
+		{Number: adminConsolePort, Protocol: "tcp", Description: "Admin Console"},
+		{Number: localArtifactMirrorPort, Protocol: "tcp", Description: "Local Artifact Mirror"},
+	}
+}
+
+// Detect returns the firewall active on the host. Firewalld and ufw take precedence as
+// they manage nftables themselves when running.
+func Detect(ctx context.Context) Backend {
+	if _, err := exec.LookPath("firewall-cmd"); err == nil {
+		if active, err := helpers.IsSystemdServiceActive(ctx, "firewalld"); err == nil && active {
+			return Firewalld
+		}
+	}
+	if _, err := exec.LookPath("ufw"); err == nil {
+		if out, err := helpers.RunCommand("ufw", "status"); err == nil && strings.HasPrefix(strings.TrimSpace(out), "Status: active") {
+			return UFW
+		}
+	}
+	if _, err := exec.LookPath("nft"); err == nil {
+		return NFTables
+	}
+	return None
+}
+
+// Configure opens the provided ports using the firewall active on the host. The k0s
+// unit is the systemd unit (k0scontroller or k0sworker) the node runs, nftables rules
+// are inserted again every time it starts. With firewalld the ports are opened in the
+// zone of the provided network interface, or the default zone if the interface is not
+// bound to any. Returns the backend used.
+func Configure(ctx context.Context, ports []Port, k0sUnit string, iface string) (Backend, error) {
+	backend := Detect(ctx)
+	switch backend {
+	case Firewalld:
+		if err := configureFirewalld(ports, iface); err != nil {
+			return backend, fmt.Errorf("unable to configure firewalld: %w", err)
+		}
+	case UFW:
+		if err := configureUFW(ports); err != nil {
+			return backend, fmt.Errorf("unable to configure ufw: %w", err)
+		}
+	case NFTables:
+		if err := configureNFTables(ports, k0sUnit); err != nil {
+			return backend, fmt.Errorf("unable to configure nftables: %w", err)
+		}
+	default:
+		logrus.Debugf("no supported firewall found, skipping firewall configuration")
+	}
+	return backend, nil
+}
+
+// Configured returns true if Configure opened the ports on this host, either through
+// firewalld, ufw or nftables. The k0s unit is the systemd unit the node runs.
+func Configured(k0sUnit string) bool {
+	dropin := filepath.Join(SystemdDir, fmt.Sprintf("%s.service.d", k0sUnit))
+	if fileExists(firewalldServicePath()) || fileExists(filepath.Join(dropin, "firewall.sh")) {
+		return true
+	}
+	// older versions loaded a dedicated nftables table.
+	if fileExists(filepath.Join(dropin, "firewall.nft")) {
+		return true
+	}
+	if _, err := exec.LookPath("ufw"); err == nil {
+		rules, err := ufwRules()
+		return err == nil && len(rules) > 0
+	}
+	return false
+}
+
+// Reset removes the rules added by Configure. It is safe to call it when the firewall
+// was not configured.
+func Reset(ctx context.Context) error {
+	if svc := firewalldServicePath(); fileExists(svc) {
+		active, err := helpers.IsSystemdServiceActive(ctx, "firewalld")
+		firewalldActive := err == nil && active
+		if firewalldActive {
+			removeFirewalldService()
+		}
+		if err := helpers.RemoveAll(svc); err != nil {
+			return fmt.Errorf("unable to remove firewalld service: %w", err)
+		}
+		if firewalldActive {
+			if _, err := helpers.RunCommand("firewall-cmd", "--reload"); err != nil {
+				return fmt.Errorf("unable to reload firewalld: %w", err)
+			}
+		}
+	}
+	if _, err := exec.LookPath("ufw"); err == nil {
+		rules, err := ufwRules()
+		if err != nil {
+			logrus.Debugf("unable to list ufw rules: %v", err)
+		}
+		for _, rule := range rules {
+			if _, err := helpers.RunCommand("ufw", "delete", "allow", rule); err != nil {
+				return fmt.Errorf("unable to delete ufw rule %s: %w", rule, err)
+			}
+		}
+	}
+	if nft, err := exec.LookPath("nft"); err == nil {
+		if err := deleteNFTablesRules(nft); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func configureFirewalld(ports []Port, iface string) error {
+	data, err := firewalldService(ports)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(FirewalldServicesDir, 0755); err != nil {
+		return fmt.Errorf("unable to create services directory: %w", err)
+	}
+	if err := os.WriteFile(firewalldServicePath(), data, 0644); err != nil {
+		return fmt.Errorf("unable to write service: %w", err)
+	}
+	// the service must be loaded before it can be added to the zone.
+	if _, err := helpers.RunCommand("firewall-cmd", "--reload"); err != nil {
+		return fmt.Errorf("unable to reload: %w", err)
+	}
+	zone, err := firewalldZone(iface)
+	if err != nil {
+		return err
+	}
+	if _, err := helpers.RunCommand("firewall-cmd", "--permanent", "--zone", zone, "--add-service", name); err != nil {
+		return fmt.Errorf("unable to add service to zone %s: %w", zone, err)
+	}
+	if _, err := helpers.RunCommand("firewall-cmd", "--reload"); err != nil {
+		return fmt.Errorf("unable to reload: %w", err)
+	}
+	return nil
+}
+
+// firewalldZone returns the zone the traffic received on the interface goes through.
+func firewalldZone(iface string) (string, error) {
+	if iface != "" {
+		out, err := helpers.RunCommand("firewall-cmd", "--get-zone-of-interface", iface)
+		if zone := strings.TrimSpace(out); err == nil && zone != "" {
+			return zone, nil
+		}
+	}
+	out, err := helpers.RunCommand("firewall-cmd", "--get-default-zone")
+	if err != nil {
+		return "", fmt.Errorf("unable to get default zone: %w", err)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// removeFirewalldService removes the service from all the zones it was added to.
+func removeFirewalldService() {
+	out, err := helpers.RunCommand("firewall-cmd", "--permanent", "--get-zones")
+	if err != nil {
+		logrus.Debugf("unable to list firewalld zones: %v", err)
+		return
+	}
+	for _, zone := range strings.Fields(out) {
+		if _, err := helpers.RunCommand("firewall-cmd", "--permanent", "--zone", zone, "--query-service", name); err != nil {
+			continue
+		}
+		if _, err := helpers.RunCommand("firewall-cmd", "--permanent", "--zone", zone, "--remove-service", name); err != nil {
+			logrus.Debugf("unable to remove firewalld service from zone %s: %v", zone, err)
+		}
+	}
+}
+
+func configureUFW(ports []Port) error {
+	wanted := map[string]bool{}
+	for _, port := range ports {
+		wanted[port.String()] = true
+		if _, err := helpers.RunCommand("ufw", "allow", port.String(), "comment", name); err != nil {
+			return fmt.Errorf("unable to allow %s: %w", port, err)
+		}
+	}
+	// ports that are no longer required, after a port change, are closed.
+	rules, err := ufwRules()
+	if err != nil {
+		return fmt.Errorf("unable to list rules: %w", err)
+	}
+	for _, rule := range rules {
+		if wanted[rule] {
+			continue
+		}
+		if _, err := helpers.RunCommand("ufw", "delete", "allow", rule); err != nil {
+			return fmt.Errorf("unable to delete rule %s: %w", rule, err)
+		}
+	}
+	return nil
+}
+
+// ufwRules returns the ports (port/protocol) opened by Configure using ufw.
+func ufwRules() ([]string, error) {
+	out, err := helpers.RunCommand("ufw", "show", "added")
+	if err != nil {
+		return nil, err
+	}
+	return parseUFWRules(out), nil
+}
+
+// parseUFWRules returns the ports allowed by the rules tagged with our comment in the
+// output of "ufw show added".
+func parseUFWRules(out string) []string {
+	rules := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 5 || fields[0] != "ufw" || fields[1] != "allow" {
+			continue
+		}
+		if fields[3] == "comment" && strings.Trim(fields[4], "'") == name {
+			rules = append(rules, fields[2])
+		}
+	}
+	return rules
+}
+
+func configureNFTables(ports []Port, k0sUnit string) error {
+	nft, err := exec.LookPath("nft")
+	if err != nil {
+		return fmt.Errorf("unable to find nft: %w", err)
+	}
+	chains, err := nftablesInputChains(nft)
+	if err != nil {
+		return err
+	}
+	data := nftablesScript(nft, chains, ports)
+	dropin := filepath.Join(SystemdDir, fmt.Sprintf("%s.service.d", k0sUnit))
+	if err := os.MkdirAll(dropin, 0755); err != nil {
+		return fmt.Errorf("unable to create drop-in directory: %w", err)
+	}
+	script := filepath.Join(dropin, "firewall.sh")
+	if err := os.WriteFile(script, data, 0755); err != nil {
+		return fmt.Errorf("unable to write script: %w", err)
+	}
+	if err := helpers.RemoveAll(filepath.Join(dropin, "firewall.nft")); err != nil {
+		return fmt.Errorf("unable to remove previous ruleset: %w", err)
+	}
+	// the leading dash makes systemd ignore failures so the node still starts.
+	conf := fmt.Sprintf("[Service]\nExecStartPre=-/bin/sh %s\n", script)
+	if err := os.WriteFile(filepath.Join(dropin, "firewall.conf"), []byte(conf), 0644); err != nil {
+		return fmt.Errorf("unable to write drop-in: %w", err)
+	}
+	// rules for ports that are no longer required, after a port change, are removed.
+	if err := deleteNFTablesRules(nft); err != nil {
+		return err
+	}
+	if _, err := helpers.RunCommand("/bin/sh", script); err != nil {
+		return fmt.Errorf("unable to insert rules: %w", err)
+	}
+	return nil
+}
+
+// nftChain is a chain as reported by "nft -j list chains".
+type nftChain struct {
+	Family string `json:"family"`
+	Table  string `json:"table"`
+	Name   string `json:"name"`
+	Hook   string `json:"hook"`
+}
+
+// nftRule is a rule as reported by "nft -j -a list ruleset".
+type nftRule struct {
+	Family  string `json:"family"`
+	Table   string `json:"table"`
+	Chain   string `json:"chain"`
+	Handle  int    `json:"handle"`
+	Comment string `json:"comment"`
+}
+
+// nftablesInputChains returns the base chains filtering the traffic received by the host.
+// Accepting traffic in a chain does not override drops in other chains hooked at input so
+// the rules are inserted in all of them.
+func nftablesInputChains(nft string) ([]nftChain, error) {
+	out, err := helpers.RunCommand(nft, "-j", "list", "chains")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list chains: %w", err)
+	}
+	return parseNFTablesInputChains([]byte(out))
+}
+
+func parseNFTablesInputChains(data []byte) ([]nftChain, error) {
+	var list struct {
+		Nftables []struct {
+			Chain *nftChain `json:"chain"`
+		} `json:"nftables"`
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("unable to parse chains: %w", err)
+	}
+	chains := []nftChain{}
+	for _, item := range list.Nftables {
+		chain := item.Chain
+		if chain == nil || chain.Hook != "input" || chain.Table == name {
+			continue
+		}
+		switch chain.Family {
+		case "ip", "ip6", "inet":
+			chains = append(chains, *chain)
+		}
+	}
+	return chains, nil
+}
+
+// deleteNFTablesRules removes the rules inserted by Configure and the table older
+// versions loaded.
+func deleteNFTablesRules(nft string) error {
+	if _, err := helpers.RunCommand(nft, "list", "table", "inet", name); err == nil {
+		if _, err := helpers.RunCommand(nft, "delete", "table", "inet", name); err != nil {
+			return fmt.Errorf("unable to delete nftables table: %w", err)
+		}
+	}
+	out, err := helpers.RunCommand(nft, "-j", "-a", "list", "ruleset")
+	if err != nil {
+		return fmt.Errorf("unable to list nftables ruleset: %w", err)
+	}
+	var list struct {
+		Nftables []struct {
+			Rule *nftRule `json:"rule"`
+		} `json:"nftables"`
+	}
+	if err := json.Unmarshal([]byte(out), &list); err != nil {
+		return fmt.Errorf("unable to parse nftables ruleset: %w", err)
+	}
+	for _, item := range list.Nftables {
+		rule := item.Rule
+		if rule == nil || rule.Comment != name {
+			continue
+		}
+		handle := fmt.Sprint(rule.Handle)
+		if _, err := helpers.RunCommand(nft, "delete", "rule", rule.Family, rule.Table, rule.Chain, "handle", handle); err != nil {
+			return fmt.Errorf("unable to delete nftables rule: %w", err)
+		}
+	}
+	return nil
+}
+
+func firewalldServicePath() string {
+	return filepath.Join(FirewalldServicesDir, fmt.Sprintf("%s.xml", name))
+}
+
+var firewalldServiceTmpl = template.Must(template.New("firewalld").Parse(`<?xml version="1.0" encoding="utf-8"?>
+<service>
+  <short>{{ .Name }}</short>
+  <description>Ports required by the {{ .Name }} nodes.</description>
+{{- range .Ports }}
+  <port protocol="{{ .Protocol }}" port="{{ .Number }}"/>
+{{- end }}
+</service>
+`))
+
+// firewalldService returns the firewalld service definition opening the provided ports.
+func firewalldService(ports []Port) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	data := map[string]interface{}{"Name": name, "Ports": ports}
+	if err := firewalldServiceTmpl.Execute(buf, data); err != nil {
+		return nil, fmt.Errorf("unable to render firewalld service: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// nftablesScript returns a script inserting, at the top of the provided chains, rules
+// accepting traffic to the provided ports. Chains already holding the rules are skipped
+// so running the script more than once does not duplicate them.
+func nftablesScript(nft string, chains []nftChain, ports []Port) []byte {
+	byProto := map[string][]string{}
+	for _, port := range ports {
+		byProto[port.Protocol] = append(byProto[port.Protocol], fmt.Sprint(port.Number))
+	}
+	protos := []string{}
+	for proto := range byProto {
+		protos = append(protos, proto)
+	}
+	sort.Strings(protos)
+
+	buf := bytes.NewBuffer(nil)
+	fmt.Fprintf(buf, "#!/bin/sh\n")
+	for _, chain := range chains {
+		ref := fmt.Sprintf("%s %s %s", chain.Family, chain.Table, chain.Name)
+		fmt.Fprintf(buf, "if ! %s list chain %s | grep -q 'comment \"%s\"'; then\n", nft, ref, name)
+		for _, proto := range protos {
+			rule := fmt.Sprintf("%s dport { %s } accept comment \"%s\"", proto, strings.Join(byProto[proto], ", "), name)
+			fmt.Fprintf(buf, "\t%s 'insert rule %s %s'\n", nft, ref, rule)
+		}
+		fmt.Fprintf(buf, "fi\n")
+	}
+	return buf.Bytes()
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,99 @@
+package firewall
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequiredPorts(t *testing.T) {
+	var got []string
+	for _, port := range RequiredPorts(30001, 50001) {
+		got = append(got, port.String())
+	}
+	assert.Equal(t, []string{
+		"6443/tcp", "9443/tcp", "2380/tcp", "10250/tcp", "4789/udp", "30001/tcp", "50001/tcp",
+	}, got)
+}
+
+func TestFirewalldService(t *testing.T) {
+	data, err := firewalldService([]Port{
+		{Number: 6443, Protocol: "tcp"},
+		{Number: 4789, Protocol: "udp"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `<?xml version="1.0" encoding="utf-8"?>
+<service>
+  <short>embedded-cluster</short>
+  <description>Ports required by the embedded-cluster nodes.</description>
+  <port protocol="tcp" port="6443"/>
+  <port protocol="udp" port="4789"/>
+</service>
+`, string(data))
+}
+
+func TestNFTablesScript(t *testing.T) {
+	chains := []nftChain{
+		{Family: "inet", Table: "filter", Name: "input", Hook: "input"},
+		{Family: "ip", Table: "firewall", Name: "INPUT", Hook: "input"},
+	}
+	data := nftablesScript("/usr/sbin/nft", chains, []Port{
+		{Number: 6443, Protocol: "tcp"},
+		{Number: 4789, Protocol: "udp"},
+		{Number: 30000, Protocol: "tcp"},
+	})
+	assert.Equal(t, `#!/bin/sh
+if ! /usr/sbin/nft list chain inet filter input | grep -q 'comment "embedded-cluster"'; then
+	/usr/sbin/nft 'insert rule inet filter input tcp dport { 6443, 30000 } accept comment "embedded-cluster"'
+	/usr/sbin/nft 'insert rule inet filter input udp dport { 4789 } accept comment "embedded-cluster"'
+fi
+if ! /usr/sbin/nft list chain ip firewall INPUT | grep -q 'comment "embedded-cluster"'; then
+	/usr/sbin/nft 'insert rule ip firewall INPUT tcp dport { 6443, 30000 } accept comment "embedded-cluster"'
+	/usr/sbin/nft 'insert rule ip firewall INPUT udp dport { 4789 } accept comment "embedded-cluster"'
+fi
+`, string(data))
+}
+
+func TestParseNFTablesInputChains(t *testing.T) {
+	data := []byte(`{"nftables": [
+		{"metainfo": {"version": "1.0.6", "json_schema_version": 1}},
+		{"chain": {"family": "inet", "table": "filter", "name": "input", "handle": 1, "type": "filter", "hook": "input", "prio": 0, "policy": "drop"}},
+		{"chain": {"family": "inet", "table": "filter", "name": "forward", "handle": 2, "type": "filter", "hook": "forward", "prio": 0, "policy": "drop"}},
+		{"chain": {"family": "inet", "table": "filter", "name": "allowed", "handle": 3}},
+		{"chain": {"family": "inet", "table": "embedded-cluster", "name": "input", "handle": 1, "type": "filter", "hook": "input", "prio": -1, "policy": "accept"}},
+		{"chain": {"family": "netdev", "table": "edge", "name": "ingress", "handle": 1, "type": "filter", "hook": "ingress", "prio": 0}}
+	]}`)
+	chains, err := parseNFTablesInputChains(data)
+	require.NoError(t, err)
+	assert.Equal(t, []nftChain{{Family: "inet", Table: "filter", Name: "input", Hook: "input"}}, chains)
+}
+
+func TestParseUFWRules(t *testing.T) {
+	out := `Added user rules (see 'ufw status' for running firewall):
+ufw allow 22/tcp
+ufw allow 6443/tcp comment 'embedded-cluster'
+ufw allow 4789/udp comment 'embedded-cluster'
+ufw allow 8080/tcp comment 'other'
+`
+	assert.Equal(t, []string{"6443/tcp", "4789/udp"}, parseUFWRules(out))
+	assert.Empty(t, parseUFWRules("Added user rules (see 'ufw status' for running firewall):\n(None)\n"))
+}
+
+func TestConfigured(t *testing.T) {
+	servicesDir, systemdDir := FirewalldServicesDir, SystemdDir
+	defer func() { FirewalldServicesDir, SystemdDir = servicesDir, systemdDir }()
+	FirewalldServicesDir, SystemdDir = t.TempDir(), t.TempDir()
+	assert.False(t, Configured("k0scontroller"))
+
+	dropin := filepath.Join(SystemdDir, "k0scontroller.service.d")
+	require.NoError(t, os.MkdirAll(dropin, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dropin, "firewall.sh"), nftablesScript("nft", nil, nil), 0755))
+	assert.True(t, Configured("k0scontroller"))
+	assert.False(t, Configured("k0sworker"))
+
+	require.NoError(t, os.WriteFile(firewalldServicePath(), nil, 0644))
+	assert.True(t, Configured("k0sworker"))
+}
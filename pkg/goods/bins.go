@@ -0,0 +1,21 @@
+//go:build !agent
+
+package goods
+
+import (
+	"embed"
+)
+
+// Agent is true in the builds without the embedded binaries, distributed to the worker
+// nodes of large fleets. They fetch the binaries from the artifact mirror of a
+// controller instead.
+const Agent = false
+
+var (
+	//go:embed bins/*
+	binfs embed.FS
+	//go:embed internal/bins/*
+	internalBinfs embed.FS
+	// agentfs is empty, full builds embed the binaries themselves.
+	agentfs embed.FS
+)
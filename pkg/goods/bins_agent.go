@@ -0,0 +1,22 @@
+//go:build agent
+
+package goods
+
+import (
+	"embed"
+)
+
+// Agent is true in the builds without the embedded binaries, distributed to the worker
+// nodes of large fleets. They fetch the binaries from the artifact mirror of a
+// controller instead.
+const Agent = true
+
+// binfs and internalBinfs are empty, nothing is embedded in agent builds. The manifest
+// of the binaries of the full build of the same version is embedded instead, the fetched
+// binaries are verified against it.
+var (
+	binfs         embed.FS
+	internalBinfs embed.FS
+	//go:embed agent/*
+	agentfs embed.FS
+)
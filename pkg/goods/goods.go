@@ -4,19 +4,19 @@ package goods
 
 import (
 	"embed"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
 )
 
 var (
 	// materializer is our default instace of the artifact materializer.
 	materializer = NewMaterializer("")
-	//go:embed bins/*
-	binfs embed.FS
 	//go:embed support/*
 	supportfs embed.FS
 	//go:embed systemd/*
 	systemdfs embed.FS
-	//go:embed internal/bins/*
-	internalBinfs embed.FS
+	//go:embed selinux/*
+	selinuxfs embed.FS
 )
 
 // K0sBinarySHA256 returns the SHA256 checksum of the embedded k0s binary.
@@ -39,6 +39,23 @@ func MaterializeLocalArtifactMirrorUnitFile() error {
 	return materializer.LocalArtifactMirrorUnitFile()
 }
 
+// MaterializeSELinuxPolicyModule is a helper function that uses the default materializer.
+func MaterializeSELinuxPolicyModule() (string, error) {
+	return materializer.SELinuxPolicyModule()
+}
+
+// UseArtifactMirror makes the default materializer of agent builds fetch the binaries
+// from the artifact mirror at the url, presenting the token as a bearer token.
+func UseArtifactMirror(url, token string) {
+	materializer.SetArtifactMirror(url, token)
+}
+
+// UseBaseDir makes the default materializer write the assets inside the base directory
+// instead of the root of the host.
+func UseBaseDir(basedir string) {
+	materializer.def = defaults.NewProvider(basedir)
+}
+
 // MaterializeInternalBinary is a helper for the default materializer.
 func MaterializeInternalBinary(name string) (string, error) {
 	return materializer.InternalBinary(name)
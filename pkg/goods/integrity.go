@@ -0,0 +1,154 @@
+package goods
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+	"golang.org/x/sync/errgroup"
+)
+
+// ManifestName is the name of the manifest holding the SHA256 checksums of the embedded
+// binaries of a directory, in the sha256sum format. It is generated by `make static` so
+// development builds may not have it, their binaries are then written unverified.
+const ManifestName = "SHA256SUMS"
+
+// manifest maps the name of each embedded file to its SHA256 checksum.
+type manifest map[string]string
+
+// readManifest reads the manifest of a directory of the embedded filesystem. A nil
+// manifest is returned if the directory has none.
+func readManifest(fsys fs.FS, dir string) (manifest, error) {
+	data, err := fs.ReadFile(fsys, path.Join(dir, ManifestName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read %s manifest: %w", dir, err)
+	}
+	sums := manifest{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || len(fields[0]) != sha256.Size*2 {
+			return nil, fmt.Errorf("invalid %s manifest line %q", dir, line)
+		}
+		// sha256sum prefixes the names with a * in binary mode.
+		sums[path.Base(strings.TrimPrefix(fields[1], "*"))] = fields[0]
+	}
+	return sums, scanner.Err()
+}
+
+// verify returns the checksum of the data, an error is returned if the manifest exists
+// and does not hold the same checksum for the file.
+func (m manifest) verify(name string, data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	actual := hex.EncodeToString(sum[:])
+	if m == nil {
+		return actual, nil
+	}
+	expected, ok := m[name]
+	if !ok {
+		return "", fmt.Errorf("%s is not listed in the manifest", name)
+	}
+	if actual != expected {
+		return "", fmt.Errorf("%s checksum %s does not match the manifest checksum %s", name, actual, expected)
+	}
+	return actual, nil
+}
+
+// writeVerified writes the data to the destination unless it already holds the data with
+// the provided checksum. The data is written to a temporary file, verified, and renamed
+// over the destination so a running binary can be replaced and a partially written file
+// is never left behind. Returns true if the file was written.
+func writeVerified(dst string, data []byte, sum string, mode os.FileMode) (bool, error) {
+	if current, err := helpers.FileSHA256(dst); err == nil && current == sum {
+		if err := os.Chmod(dst, mode); err != nil {
+			return false, fmt.Errorf("unable to set %s permissions: %w", dst, err)
+		}
+		return false, nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+"-")
+	if err != nil {
+		return false, fmt.Errorf("unable to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return false, fmt.Errorf("unable to write %s: %w", dst, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return false, fmt.Errorf("unable to write %s: %w", dst, err)
+	}
+	if written, err := helpers.FileSHA256(tmp.Name()); err != nil {
+		return false, fmt.Errorf("unable to verify %s: %w", dst, err)
+	} else if written != sum {
+		return false, fmt.Errorf("written %s checksum %s does not match %s", dst, written, sum)
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return false, fmt.Errorf("unable to set %s permissions: %w", dst, err)
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return false, fmt.Errorf("unable to move %s into place: %w", dst, err)
+	}
+	return true, nil
+}
+
+// materializeDir writes, in parallel, the files of a directory of the embedded
+// filesystem to the paths returned by dstpath. The files are verified against the
+// directory manifest and the ones already on disk are left untouched. Returns the names
+// of the files written.
+func materializeDir(fsys fs.FS, dir string, dstpath func(string) string, mode os.FileMode) ([]string, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read embedded %s dir: %w", dir, err)
+	}
+	sums, err := readManifest(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var g errgroup.Group
+	g.SetLimit(runtime.NumCPU())
+	written := make([]bool, len(entries))
+	for i, entry := range entries {
+		if entry.IsDir() || entry.Name() == PlaceHolder || entry.Name() == ManifestName {
+			continue
+		}
+		g.Go(func() error {
+			data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+			if err != nil {
+				return fmt.Errorf("unable to read asset: %w", err)
+			}
+			sum, err := sums.verify(entry.Name(), data)
+			if err != nil {
+				return fmt.Errorf("embedded asset is corrupt: %w", err)
+			}
+			written[i], err = writeVerified(dstpath(entry.Name()), data, sum, mode)
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	var names []string
+	for i, entry := range entries {
+		if written[i] {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,96 @@
+package goods
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sha256hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestReadManifest(t *testing.T) {
+	fsys := fstest.MapFS{
+		"bins/SHA256SUMS": {Data: []byte(sha256hex("k0s") + "  k0s\n" + sha256hex("fio") + " *fio\n\n")},
+	}
+	sums, err := readManifest(fsys, "bins")
+	require.NoError(t, err)
+	assert.Equal(t, manifest{"k0s": sha256hex("k0s"), "fio": sha256hex("fio")}, sums)
+
+	sums, err = readManifest(fsys, "internal/bins")
+	require.NoError(t, err)
+	assert.Nil(t, sums)
+
+	fsys["bins/SHA256SUMS"] = &fstest.MapFile{Data: []byte("deadbeef k0s\n")}
+	_, err = readManifest(fsys, "bins")
+	assert.ErrorContains(t, err, "invalid bins manifest line")
+}
+
+func TestManifestVerify(t *testing.T) {
+	sums := manifest{"k0s": sha256hex("k0s")}
+	sum, err := sums.verify("k0s", []byte("k0s"))
+	require.NoError(t, err)
+	assert.Equal(t, sha256hex("k0s"), sum)
+
+	_, err = sums.verify("k0s", []byte("tampered"))
+	assert.ErrorContains(t, err, "does not match the manifest")
+	_, err = sums.verify("fio", []byte("fio"))
+	assert.ErrorContains(t, err, "not listed in the manifest")
+
+	// without a manifest the checksum is only computed.
+	sum, err = manifest(nil).verify("fio", []byte("fio"))
+	require.NoError(t, err)
+	assert.Equal(t, sha256hex("fio"), sum)
+}
+
+func TestMaterializeDir(t *testing.T) {
+	fsys := fstest.MapFS{
+		"bins/.placeholder": {},
+		"bins/k0s":          {Data: []byte("k0s v2")},
+		"bins/fio":          {Data: []byte("fio")},
+		"bins/SHA256SUMS":   {Data: []byte(sha256hex("k0s v2") + "  k0s\n" + sha256hex("fio") + "  fio\n")},
+	}
+	dir := t.TempDir()
+	dstpath := func(name string) string { return filepath.Join(dir, name) }
+
+	// fio is up to date and must not be rewritten, k0s is from a previous version.
+	require.NoError(t, os.WriteFile(dstpath("fio"), []byte("fio"), 0755))
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(dstpath("fio"), old, old))
+	require.NoError(t, os.WriteFile(dstpath("k0s"), []byte("k0s v1"), 0755))
+
+	written, err := materializeDir(fsys, "bins", dstpath, 0755)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"k0s"}, written)
+
+	data, err := os.ReadFile(dstpath("k0s"))
+	require.NoError(t, err)
+	assert.Equal(t, "k0s v2", string(data))
+	info, err := os.Stat(dstpath("k0s"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	info, err = os.Stat(dstpath("fio"))
+	require.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(old))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "placeholder, manifest or temporary files were written")
+
+	// a binary not matching the manifest is never written.
+	fsys["bins/k0s"] = &fstest.MapFile{Data: []byte("tampered")}
+	_, err = materializeDir(fsys, "bins", dstpath, 0755)
+	assert.ErrorContains(t, err, "embedded asset is corrupt")
+	data, err = os.ReadFile(dstpath("k0s"))
+	require.NoError(t, err)
+	assert.Equal(t, "k0s v2", string(data))
+}
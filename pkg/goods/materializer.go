@@ -7,7 +7,13 @@ import (
 	"io"
 	"os"
 
+	"github.com/sirupsen/logrus"
+
 	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/hostcollectors"
+	"github.com/replicatedhq/embedded-cluster/pkg/hostconfig"
+	"github.com/replicatedhq/embedded-cluster/pkg/plugins"
+	"github.com/replicatedhq/embedded-cluster/pkg/release"
 )
 
 // PlaceHolder is a filename we use in some of the directories here so we can
@@ -18,6 +24,10 @@ const PlaceHolder = ".placeholder"
 // Materializer is an entity capable of materialize (write to disk) embedded assets.
 type Materializer struct {
 	def *defaults.Provider
+	// mirror is the url of the artifact mirror agent builds fetch the binaries from.
+	mirror string
+	// mirrorToken is the bearer token presented to the artifact mirror.
+	mirrorToken string
 }
 
 // NewMaterializer returns a new entity capable of materialize (write to disk) embedded
@@ -36,6 +46,13 @@ func (m *Materializer) InternalBinary(name string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("unable to read asset: %w", err)
 	}
+	sums, err := readManifest(internalBinfs, "internal/bins")
+	if err != nil {
+		return "", err
+	}
+	if _, err := sums.verify(name, srcfile); err != nil {
+		return "", fmt.Errorf("embedded asset is corrupt: %w", err)
+	}
 	dstpath, err := os.CreateTemp("", fmt.Sprintf("embedded-cluster-%s-bin-", name))
 	if err != nil {
 		return "", fmt.Errorf("unable to create temp file: %w", err)
@@ -52,12 +69,8 @@ func (m *Materializer) InternalBinary(name string) (string, error) {
 
 // LocalArtifactMirrorUnitFile writes to disk the local-artifact-mirror systemd unit file.
 func (m *Materializer) LocalArtifactMirrorUnitFile() error {
-	content, err := systemdfs.ReadFile("systemd/local-artifact-mirror.service")
-	if err != nil {
-		return fmt.Errorf("unable to open unit file: %w", err)
-	}
-	dstpath := "/etc/systemd/system/local-artifact-mirror.service"
-	if err := os.WriteFile(dstpath, content, 0644); err != nil {
+	dstpath := hostconfig.LocalArtifactMirrorUnitPath
+	if err := os.WriteFile(dstpath, []byte(hostconfig.LocalArtifactMirrorUnit), 0644); err != nil {
 		return fmt.Errorf("unable to write file: %w", err)
 	}
 	return nil
@@ -78,6 +91,20 @@ func (m *Materializer) CalicoNetworkManagerConfig() error {
 	return nil
 }
 
+// SELinuxPolicyModule materializes the SELinux policy module used when SELinux is in
+// enforcing mode. Returns the path to the module file.
+func (m *Materializer) SELinuxPolicyModule() (string, error) {
+	content, err := selinuxfs.ReadFile("selinux/embedded-cluster.cil")
+	if err != nil {
+		return "", fmt.Errorf("unable to open selinux policy module: %w", err)
+	}
+	dstpath := m.def.PathToEmbeddedClusterSupportFile("embedded-cluster.cil")
+	if err := os.WriteFile(dstpath, content, 0644); err != nil {
+		return "", fmt.Errorf("unable to write file: %w", err)
+	}
+	return dstpath, nil
+}
+
 // Materialize writes to disk all embedded assets.
 func (m *Materializer) Materialize() error {
 	if err := m.Binaries(); err != nil {
@@ -89,21 +116,46 @@ func (m *Materializer) Materialize() error {
 	if err := m.SupportFiles(); err != nil {
 		return fmt.Errorf("unable to materialize embedded support files: %w", err)
 	}
+	if err := m.Plugins(); err != nil {
+		return fmt.Errorf("unable to materialize plugins: %w", err)
+	}
 	return nil
 }
 
-// SupportFiles materializes files under the support directory.
+// Plugins materializes the plugins shipped in the release and removes the ones shipped
+// by previous releases. Agent builds do not embed the release and leave them untouched.
+func (m *Materializer) Plugins() error {
+	if Agent {
+		return nil
+	}
+	shipped, err := release.GetPlugins()
+	if err != nil {
+		return fmt.Errorf("unable to read plugins from release: %w", err)
+	}
+	return plugins.Write(m.def.EmbeddedClusterPluginsSubDir(), shipped)
+}
+
+// SupportFiles materializes files under the support directory. Host collectors excluded
+// on this node are removed from the materialized support bundles.
 func (m *Materializer) SupportFiles() error {
 	entries, err := supportfs.ReadDir("support")
 	if err != nil {
 		return fmt.Errorf("unable to read embedded-cluster support dir: %w", err)
 	}
+	excluded, err := hostcollectors.ReadExcluded(m.def.PathToExcludedHostCollectors())
+	if err != nil {
+		return fmt.Errorf("unable to read excluded host collectors: %w", err)
+	}
 	for _, entry := range entries {
 		srcpath := fmt.Sprintf("support/%s", entry.Name())
 		srcfile, err := supportfs.ReadFile(srcpath)
 		if err != nil {
 			return fmt.Errorf("unable to read asset: %w", err)
 		}
+		srcfile, err = hostcollectors.FilterSupportBundle(srcfile, excluded)
+		if err != nil {
+			return fmt.Errorf("unable to exclude host collectors from %s: %w", entry.Name(), err)
+		}
 		dstpath := m.def.PathToEmbeddedClusterSupportFile(entry.Name())
 		if err := os.WriteFile(dstpath, srcfile, 0644); err != nil {
 			return fmt.Errorf("unable to write file: %w", err)
@@ -112,52 +164,28 @@ func (m *Materializer) SupportFiles() error {
 	return nil
 }
 
-// Binaries materializes all binary files from inside bins directory. If the file already
-// exists a copy of it is made first before overwriting it, this is done because we can't
-// overwrite a running binary. Copies are removed. This function also creates a copy of
-// this binary into the PathToEmbeddedClusterBinary() directory.
+// Binaries materializes all binary files from inside bins directory. The binaries are
+// written in parallel and verified against the embedded manifest, the ones already on disk
+// are not rewritten. Agent builds fetch them from the artifact mirror instead. This
+// function also creates a copy of this binary into the PathToEmbeddedClusterBinary()
+// directory.
 func (m *Materializer) Binaries() error {
-	entries, err := binfs.ReadDir("bins")
-	if err != nil {
-		return fmt.Errorf("unable to read embedded-cluster bins dir: %w", err)
-	}
-
 	if err := m.Ourselves(); err != nil {
 		return fmt.Errorf("unable to materialize ourselves: %w", err)
 	}
-
-	var remove []string
-	defer func() {
-		for _, f := range remove {
-			os.Remove(f)
-		}
-	}()
-
-	for _, entry := range entries {
-		if entry.Name() == PlaceHolder {
-			continue
-		}
-
-		srcpath := fmt.Sprintf("bins/%s", entry.Name())
-		srcfile, err := binfs.ReadFile(srcpath)
-		if err != nil {
-			return fmt.Errorf("unable to read asset: %w", err)
-		}
-
-		dstpath := m.def.PathToEmbeddedClusterBinary(entry.Name())
-		if _, err := os.Stat(dstpath); err == nil {
-			tmp := fmt.Sprintf("%s.bkp", dstpath)
-			if err := os.Rename(dstpath, tmp); err != nil {
-				return fmt.Errorf("unable to rename %s to %s: %w", dstpath, tmp, err)
-			}
-			remove = append(remove, tmp)
-		}
-
-		if err := os.WriteFile(dstpath, srcfile, 0755); err != nil {
-			return fmt.Errorf("unable to write file: %w", err)
-		}
+	var written []string
+	var err error
+	if Agent {
+		written, err = m.FetchBinaries()
+	} else {
+		written, err = materializeDir(binfs, "bins", m.def.PathToEmbeddedClusterBinary, 0755)
+	}
+	if err != nil {
+		return err
+	}
+	for _, name := range written {
+		logrus.Debugf("materialized binary %s", name)
 	}
-
 	return nil
 }
 
@@ -189,8 +217,16 @@ func (m *Materializer) Kubectl() error {
 	return nil
 }
 
-// K0sBinarySHA256 returns the SHA256 checksum of the embedded k0s binary.
+// K0sBinarySHA256 returns the SHA256 checksum of the embedded k0s binary, read from the
+// manifest when there is one.
 func (m *Materializer) K0sBinarySHA256() (string, error) {
+	sums, err := readManifest(binfs, "bins")
+	if err != nil {
+		return "", err
+	}
+	if sum, ok := sums["k0s"]; ok {
+		return sum, nil
+	}
 	fp, err := binfs.Open("bins/k0s")
 	if err != nil {
 		return "", fmt.Errorf("unable to open embedded k0s binary: %w", err)
@@ -0,0 +1,119 @@
+package goods
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// MirrorBinaries are the binaries agent builds fetch from the artifact mirror, the ones
+// embedded in the full builds.
+var MirrorBinaries = []string{
+	"k0s",
+	"kubectl-preflight",
+	"kubectl-support_bundle",
+	"cosign",
+	"local-artifact-mirror",
+	"fio",
+}
+
+// mirrorManifestFS holds, in its agent directory, the manifest the binaries fetched from
+// the artifact mirror are verified against. Agent builds embed the manifest of the full
+// build of their version, joins make sure it is the version of the cluster.
+var mirrorManifestFS fs.FS = agentfs
+
+// SetArtifactMirror sets the url of the artifact mirror the binaries are fetched from,
+// the mirror of a controller as the mirrors of the workers only serve their own node.
+// The token, the bearer token of the join token, authorizes a node not yet in the cluster.
+func (m *Materializer) SetArtifactMirror(url, token string) {
+	m.mirror = strings.TrimSuffix(url, "/")
+	m.mirrorToken = token
+}
+
+// FetchBinaries fetches, in parallel, the binaries from the artifact mirror. The mirror is
+// served over plain http, the binaries are only made executable once their checksums
+// match the embedded manifest. Returns the names of the binaries written.
+func (m *Materializer) FetchBinaries() ([]string, error) {
+	if m.mirror == "" {
+		return nil, fmt.Errorf("no artifact mirror to fetch the binaries from")
+	}
+	sums, err := readManifest(mirrorManifestFS, "agent")
+	if err != nil {
+		return nil, err
+	} else if sums == nil {
+		return nil, fmt.Errorf("no manifest to verify the binaries fetched from the artifact mirror against, the agent build must embed one")
+	}
+	var g errgroup.Group
+	g.SetLimit(runtime.NumCPU())
+	for _, name := range MirrorBinaries {
+		g.Go(func() error {
+			sum, ok := sums[name]
+			if !ok {
+				return fmt.Errorf("%s is not listed in the manifest", name)
+			}
+			url := fmt.Sprintf("%s/bin/%s", m.mirror, name)
+			if err := fetchFile(url, m.mirrorToken, sum, m.def.PathToEmbeddedClusterBinary(name), 0755); err != nil {
+				return fmt.Errorf("unable to fetch %s: %w", name, err)
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return MirrorBinaries, nil
+}
+
+// fetchFile downloads the url to a temporary file renamed to dst once complete and
+// verified, so a failed or tampered download never leaves a binary behind. The file only
+// gets its mode once its SHA256 checksum matches the provided one. The token, if any, is
+// sent as a bearer token.
+func fetchFile(url, token, sum, dst string, mode os.FileMode) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("unable to create request: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	tmp := dst + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to create file: %w", err)
+	}
+	defer os.Remove(tmp)
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, hasher), resp.Body); err != nil {
+		f.Close()
+		return fmt.Errorf("unable to write file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("unable to write file: %w", err)
+	}
+	if actual := hex.EncodeToString(hasher.Sum(nil)); actual != sum {
+		return fmt.Errorf("checksum %s does not match the manifest checksum %s", actual, sum)
+	}
+	if err := os.Chmod(tmp, mode); err != nil {
+		return fmt.Errorf("unable to set permissions: %w", err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return fmt.Errorf("unable to rename file: %w", err)
+	}
+	return nil
+}
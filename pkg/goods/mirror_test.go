@@ -0,0 +1,84 @@
+package goods
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchBinaries(t *testing.T) {
+	var manifest strings.Builder
+	for _, name := range MirrorBinaries {
+		sum := sha256.Sum256([]byte("binary " + name))
+		fmt.Fprintf(&manifest, "%s  %s\n", hex.EncodeToString(sum[:]), name)
+	}
+	defer func(fsys fs.FS) { mirrorManifestFS = fsys }(mirrorManifestFS)
+	mirrorManifestFS = fstest.MapFS{}
+
+	missing, tampered := "", ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer abcdef.0123456789abcdef" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, "/bin/")
+		if name == missing {
+			http.NotFound(w, r)
+			return
+		}
+		if name == tampered {
+			w.Write([]byte("malicious " + name))
+			return
+		}
+		w.Write([]byte("binary " + name))
+	}))
+	defer srv.Close()
+
+	m := NewMaterializer(t.TempDir())
+	_, err := m.FetchBinaries()
+	assert.EqualError(t, err, "no artifact mirror to fetch the binaries from")
+
+	m.SetArtifactMirror(srv.URL+"/", "abcdef.0123456789abcdef")
+	_, err = m.FetchBinaries()
+	assert.EqualError(t, err, "no manifest to verify the binaries fetched from the artifact mirror against, the agent build must embed one")
+
+	mirrorManifestFS = fstest.MapFS{"agent/SHA256SUMS": {Data: []byte(manifest.String())}}
+	written, err := m.FetchBinaries()
+	require.NoError(t, err)
+	assert.Equal(t, MirrorBinaries, written)
+	for _, name := range MirrorBinaries {
+		fpath := m.def.PathToEmbeddedClusterBinary(name)
+		data, err := os.ReadFile(fpath)
+		require.NoError(t, err)
+		assert.Equal(t, "binary "+name, string(data))
+		info, err := os.Stat(fpath)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	}
+
+	missing = "fio"
+	_, err = m.FetchBinaries()
+	assert.EqualError(t, err, "unable to fetch fio: unexpected status code 404")
+	data, err := os.ReadFile(m.def.PathToEmbeddedClusterBinary("fio"))
+	require.NoError(t, err)
+	assert.Equal(t, "binary fio", string(data), "the binary of a failed fetch is left untouched")
+	_, err = os.Stat(m.def.PathToEmbeddedClusterBinary("fio") + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+
+	missing, tampered = "", "k0s"
+	require.NoError(t, os.Remove(m.def.PathToEmbeddedClusterBinary("k0s")))
+	_, err = m.FetchBinaries()
+	assert.ErrorContains(t, err, "unable to fetch k0s: checksum")
+	assert.NoFileExists(t, m.def.PathToEmbeddedClusterBinary("k0s"), "a tampered binary is never written")
+	assert.NoFileExists(t, m.def.PathToEmbeddedClusterBinary("k0s")+".tmp")
+}
@@ -0,0 +1,185 @@
+package hardening
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/encryption"
+)
+
+var (
+	// procDir is where we look for the running control plane processes.
+	procDir = "/proc"
+	// kubeletConfigPath is the kubelet configuration file written by k0s.
+	kubeletConfigPath = "/var/lib/k0s/kubelet-config.yaml"
+	// pkiDir is the directory holding the cluster certificates and keys.
+	pkiDir = "/var/lib/k0s/pki"
+)
+
+// Result is the outcome of a single benchmark check.
+type Result struct {
+	ID     string
+	Text   string
+	Pass   bool
+	Reason string
+}
+
+// Check validates the node against the CIS profile. Control plane checks are only run
+// if the control plane components are running on this node.
+func Check() []Result {
+	var results []Result
+	if args, ok := processArgs("kube-apiserver"); ok {
+		expected := APIServerArgs()
+		for k, v := range encryption.APIServerArgs() {
+			expected[k] = v
+		}
+		results = append(results, checkArgs("1.2", "kube-apiserver", args, expected)...)
+		results = append(results, checkFileMode("1.1.a", AuditPolicyPath, 0600))
+		results = append(results, checkFileMode("1.1.b", expected["encryption-provider-config"], 0600))
+		keys, _ := filepath.Glob(filepath.Join(pkiDir, "*.key"))
+		for i, key := range keys {
+			results = append(results, checkFileMode(fmt.Sprintf("1.1.21.%d", i+1), key, 0600))
+		}
+	}
+	if args, ok := processArgs("kube-controller-manager"); ok {
+		results = append(results, checkArgs("1.3", "kube-controller-manager", args, ControllerManagerArgs())...)
+	}
+	if args, ok := processArgs("kube-scheduler"); ok {
+		results = append(results, checkArgs("1.4", "kube-scheduler", args, SchedulerArgs())...)
+	}
+	results = append(results, checkKubeletConfig("4.2")...)
+	return results
+}
+
+// checkArgs compares the flags a component is running with against the expected ones.
+func checkArgs(section, component string, args, expected map[string]string) []Result {
+	var results []Result
+	for i, flag := range sortedKeys(expected) {
+		res := Result{
+			ID:   fmt.Sprintf("%s.%d", section, i+1),
+			Text: fmt.Sprintf("Ensure %s --%s is set to %s", component, flag, expected[flag]),
+		}
+		if value, ok := args[flag]; !ok {
+			res.Reason = "flag not set"
+		} else if value != expected[flag] {
+			res.Reason = fmt.Sprintf("flag set to %s", value)
+		} else {
+			res.Pass = true
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// checkKubeletConfig compares the kubelet configuration file against the expected
+// values.
+func checkKubeletConfig(section string) []Result {
+	expected := KubeletConfig()
+	current := map[string]interface{}{}
+	data, err := os.ReadFile(kubeletConfigPath)
+	if err == nil {
+		err = yaml.Unmarshal(data, &current)
+	}
+
+	var results []Result
+	keys := make([]string, 0, len(expected))
+	for key := range expected {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for i, key := range keys {
+		want := fmt.Sprint(expected[key])
+		res := Result{
+			ID:   fmt.Sprintf("%s.%d", section, i+1),
+			Text: fmt.Sprintf("Ensure kubelet %s is set to %s", key, want),
+		}
+		if err != nil {
+			res.Reason = fmt.Sprintf("unable to read kubelet config: %v", err)
+		} else if value, ok := current[key]; !ok {
+			res.Reason = "not set"
+		} else if got := fmt.Sprint(value); got != want {
+			res.Reason = fmt.Sprintf("set to %s", got)
+		} else {
+			res.Pass = true
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// checkFileMode makes sure the provided file permissions are not more permissive than
+// mode.
+func checkFileMode(id, path string, mode os.FileMode) Result {
+	res := Result{
+		ID:   id,
+		Text: fmt.Sprintf("Ensure %s permissions are set to %o or more restrictive", path, mode),
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		res.Reason = err.Error()
+		return res
+	}
+	if perm := info.Mode().Perm(); perm&^mode != 0 {
+		res.Reason = fmt.Sprintf("permissions are %o", perm)
+		return res
+	}
+	res.Pass = true
+	return res
+}
+
+// processArgs finds a running process by name and returns its flags. Returns false if
+// no process has been found.
+func processArgs(name string) (map[string]string, bool) {
+	entries, err := os.ReadDir(procDir)
+	if err != nil {
+		return nil, false
+	}
+	for _, entry := range entries {
+		cmdline, err := os.ReadFile(filepath.Join(procDir, entry.Name(), "cmdline"))
+		if err != nil || len(cmdline) == 0 {
+			continue
+		}
+		parts := strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00")
+		if filepath.Base(parts[0]) != name {
+			continue
+		}
+		return parseFlags(parts[1:]), true
+	}
+	return nil, false
+}
+
+// parseFlags parses flags in the --name=value or --name value forms.
+func parseFlags(args []string) map[string]string {
+	flags := map[string]string{}
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "--") {
+			continue
+		}
+		name := strings.TrimPrefix(args[i], "--")
+		if key, value, found := strings.Cut(name, "="); found {
+			flags[key] = value
+			continue
+		}
+		if i+1 < len(args) && !strings.HasPrefix(args[i+1], "--") {
+			flags[name] = args[i+1]
+			i++
+			continue
+		}
+		flags[name] = "true"
+	}
+	return flags
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
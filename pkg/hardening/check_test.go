@@ -0,0 +1,100 @@
+package hardening
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(""))
+	assert.NoError(t, Validate(ProfileCIS))
+	assert.Error(t, Validate("stig"))
+}
+
+func Test_parseFlags(t *testing.T) {
+	flags := parseFlags([]string{"--profiling=false", "--audit-log-path", "/var/log/audit.log", "--v", "positional"})
+	assert.Equal(t, map[string]string{
+		"profiling":      "false",
+		"audit-log-path": "/var/log/audit.log",
+		"v":              "positional",
+	}, flags)
+
+	flags = parseFlags([]string{"--enable-foo", "--bar=1"})
+	assert.Equal(t, map[string]string{"enable-foo": "true", "bar": "1"}, flags)
+}
+
+func Test_processArgs(t *testing.T) {
+	original := procDir
+	defer func() { procDir = original }()
+	procDir = t.TempDir()
+
+	cmdline := strings.Join([]string{"/var/lib/k0s/bin/kube-scheduler", "--profiling=false", "--bind-address=127.0.0.1"}, "\x00") + "\x00"
+	require.NoError(t, os.MkdirAll(filepath.Join(procDir, "42"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(procDir, "42", "cmdline"), []byte(cmdline), 0644))
+
+	args, ok := processArgs("kube-scheduler")
+	require.True(t, ok)
+	assert.Equal(t, "false", args["profiling"])
+
+	_, ok = processArgs("kube-apiserver")
+	assert.False(t, ok)
+}
+
+func Test_checkArgs(t *testing.T) {
+	results := checkArgs("1.3", "kube-controller-manager", map[string]string{"profiling": "true"}, ControllerManagerArgs())
+	require.Len(t, results, 2)
+	assert.Equal(t, "1.3.1", results[0].ID)
+	assert.False(t, results[0].Pass)
+	assert.Equal(t, "flag set to true", results[0].Reason)
+	assert.False(t, results[1].Pass)
+	assert.Equal(t, "flag not set", results[1].Reason)
+
+	results = checkArgs("1.4", "kube-scheduler", SchedulerArgs(), SchedulerArgs())
+	require.Len(t, results, 1)
+	assert.True(t, results[0].Pass)
+}
+
+func Test_checkKubeletConfig(t *testing.T) {
+	original := kubeletConfigPath
+	defer func() { kubeletConfigPath = original }()
+	kubeletConfigPath = filepath.Join(t.TempDir(), "kubelet-config.yaml")
+
+	results := checkKubeletConfig("4.2")
+	require.Len(t, results, len(KubeletConfig()))
+	for _, res := range results {
+		assert.False(t, res.Pass)
+	}
+
+	config := `
+readOnlyPort: 0
+makeIPTablesUtilChains: true
+rotateCertificates: true
+streamingConnectionIdleTimeout: 5m
+eventRecordQPS: 50
+`
+	require.NoError(t, os.WriteFile(kubeletConfigPath, []byte(config), 0644))
+	for _, res := range checkKubeletConfig("4.2") {
+		if strings.Contains(res.Text, "eventRecordQPS") {
+			assert.False(t, res.Pass)
+			assert.Equal(t, "set to 50", res.Reason)
+			continue
+		}
+		assert.True(t, res.Pass, res.Text)
+	}
+}
+
+func Test_checkFileMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(path, []byte("data"), 0600))
+	assert.True(t, checkFileMode("1", path, 0600).Pass)
+
+	require.NoError(t, os.Chmod(path, 0644))
+	res := checkFileMode("1", path, 0600)
+	assert.False(t, res.Pass)
+	assert.Equal(t, "permissions are 644", res.Reason)
+}
@@ -0,0 +1,104 @@
+// Package hardening holds the settings applied to the cluster when a hardening profile
+// is requested during installation. For now only the CIS Kubernetes Benchmark profile
+// is supported.
+package hardening
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ProfileCIS is the CIS Kubernetes Benchmark hardening profile.
+const ProfileCIS = "cis"
+
+const (
+	// AuditPolicyPath is where the kube-apiserver audit policy is stored.
+	AuditPolicyPath = "/etc/k0s/audit-policy.yaml"
+	// AuditLogPath is where the kube-apiserver writes the audit logs.
+	AuditLogPath = "/var/log/kubernetes/audit/audit.log"
+)
+
+// auditPolicy logs request metadata for everything, secrets and configmaps included,
+// without storing their content. Read only requests to health endpoints are skipped.
+const auditPolicy = `apiVersion: audit.k8s.io/v1
+kind: Policy
+omitStages:
+  - RequestReceived
+rules:
+  - level: None
+    nonResourceURLs:
+      - /healthz*
+      - /livez*
+      - /readyz*
+      - /version
+  - level: Metadata
+    resources:
+      - group: ""
+        resources: ["secrets", "configmaps"]
+  - level: Metadata
+`
+
+// Validate returns an error if the provided profile is not supported. An empty
+// profile is valid and means no hardening.
+func Validate(profile string) error {
+	if profile == "" || profile == ProfileCIS {
+		return nil
+	}
+	return fmt.Errorf("unsupported hardening profile %q, supported profiles: %s", profile, ProfileCIS)
+}
+
+// APIServerArgs returns the kube-apiserver flags required by the benchmark.
+func APIServerArgs() map[string]string {
+	return map[string]string{
+		"profiling":                "false",
+		"enable-admission-plugins": "NodeRestriction",
+		"audit-policy-file":        AuditPolicyPath,
+		"audit-log-path":           AuditLogPath,
+		"audit-log-maxage":         "30",
+		"audit-log-maxbackup":      "10",
+		"audit-log-maxsize":        "100",
+	}
+}
+
+// ControllerManagerArgs returns the kube-controller-manager flags required by the
+// benchmark.
+func ControllerManagerArgs() map[string]string {
+	return map[string]string{
+		"profiling":                   "false",
+		"terminated-pod-gc-threshold": "10",
+	}
+}
+
+// SchedulerArgs returns the kube-scheduler flags required by the benchmark.
+func SchedulerArgs() map[string]string {
+	return map[string]string{
+		"profiling": "false",
+	}
+}
+
+// KubeletConfig returns the kubelet configuration values required by the benchmark.
+func KubeletConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"readOnlyPort":                   0,
+		"makeIPTablesUtilChains":         true,
+		"rotateCertificates":             true,
+		"streamingConnectionIdleTimeout": "5m",
+		"eventRecordQPS":                 5,
+	}
+}
+
+// WriteAuditPolicy writes the kube-apiserver audit policy and makes sure the audit log
+// directory exists.
+func WriteAuditPolicy() error {
+	if err := os.MkdirAll(filepath.Dir(AuditLogPath), 0700); err != nil {
+		return fmt.Errorf("unable to create audit log directory: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(AuditPolicyPath), 0755); err != nil {
+		return fmt.Errorf("unable to create directory: %w", err)
+	}
+	if err := os.WriteFile(AuditPolicyPath, []byte(auditPolicy), 0600); err != nil {
+		return fmt.Errorf("unable to write audit policy: %w", err)
+	}
+	return nil
+}
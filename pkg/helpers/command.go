@@ -2,19 +2,29 @@ package helpers
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"syscall"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
+// commandWaitDelay is how long a cancelled command has to exit after it was asked to
+// terminate before it is killed.
+const commandWaitDelay = 10 * time.Second
+
 type RunCommandOptions struct {
 	// Writer is an additional io.Writer to write the stdout of the command to.
 	Writer io.Writer
 	// Env is a map of additional environment variables to set for the command.
 	Env map[string]string
+	// Context, if set, terminates the command when it is done. Commands run without a
+	// context are never interrupted.
+	Context context.Context
 }
 
 // RunCommandWithOptions runs a the provided command with the options specified.
@@ -25,6 +35,16 @@ func RunCommandWithOptions(opts RunCommandOptions, bin string, args ...string) e
 	stderr := bytes.NewBuffer(nil)
 	stdout := bytes.NewBuffer(nil)
 	cmd := exec.Command(bin, args...)
+	if opts.Context != nil {
+		cmd = exec.CommandContext(opts.Context, bin, args...)
+		cmd.Cancel = func() error {
+			return cmd.Process.Signal(syscall.SIGTERM)
+		}
+		cmd.WaitDelay = commandWaitDelay
+	}
+	// commands run in their own process group so an interrupt from the terminal only
+	// reaches the caller, which decides when and how to stop them.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 	cmd.Stdout = stdout
 	if opts.Writer != nil {
 		cmd.Stdout = io.MultiWriter(opts.Writer, stdout)
@@ -35,6 +55,9 @@ func RunCommandWithOptions(opts RunCommandOptions, bin string, args ...string) e
 		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
 	}
 	if err := cmd.Run(); err != nil {
+		if opts.Context != nil && opts.Context.Err() != nil {
+			return fmt.Errorf("%s interrupted: %w", bin, context.Cause(opts.Context))
+		}
 		logrus.Debugf("failed to run command:")
 		logrus.Debugf("stdout: %s", stdout.String())
 		logrus.Debugf("stderr: %s", stderr.String())
@@ -55,3 +78,14 @@ func RunCommand(bin string, args ...string) (string, error) {
 	}
 	return stdout.String(), nil
 }
+
+// RunCommandContext runs the command as RunCommand does, the command is terminated when
+// the context is done.
+func RunCommandContext(ctx context.Context, bin string, args ...string) (string, error) {
+	stdout := bytes.NewBuffer(nil)
+	opts := RunCommandOptions{Writer: stdout, Context: ctx}
+	if err := RunCommandWithOptions(opts, bin, args...); err != nil {
+		return "", err
+	}
+	return stdout.String(), nil
+}
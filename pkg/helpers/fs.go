@@ -1,10 +1,13 @@
 package helpers
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"syscall"
 )
 
 // MoveFile moves a file from one location to another, overwriting the destination if it
@@ -76,3 +79,78 @@ func RemoveAll(path string) error {
 	}
 	return nil
 }
+
+// SameFilesystem returns true if both paths live on the same filesystem (device). Paths
+// that do not exist yet are resolved to their closest existing parent directory.
+func SameFilesystem(a, b string) (bool, error) {
+	deva, err := deviceForPath(a)
+	if err != nil {
+		return false, err
+	}
+	devb, err := deviceForPath(b)
+	if err != nil {
+		return false, err
+	}
+	return deva == devb, nil
+}
+
+// deviceForPath returns the device id for the provided path or for its closest
+// existing parent.
+func deviceForPath(path string) (uint64, error) {
+	path = filepath.Clean(path)
+	for {
+		info, err := os.Stat(path)
+		if err == nil {
+			stat, ok := info.Sys().(*syscall.Stat_t)
+			if !ok {
+				return 0, fmt.Errorf("unable to read device for %s", path)
+			}
+			return uint64(stat.Dev), nil
+		}
+		if !os.IsNotExist(err) {
+			return 0, fmt.Errorf("stat %s: %w", path, err)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return 0, fmt.Errorf("no existing parent found for %s", path)
+		}
+		path = parent
+	}
+}
+
+// FilesystemCapacity returns the total and available bytes of the filesystem holding the
+// provided path. Paths that do not exist yet are resolved to their closest existing
+// parent directory.
+func FilesystemCapacity(path string) (uint64, uint64, error) {
+	path = filepath.Clean(path)
+	for {
+		var stat syscall.Statfs_t
+		err := syscall.Statfs(path, &stat)
+		if err == nil {
+			bsize := uint64(stat.Bsize)
+			return stat.Blocks * bsize, stat.Bavail * bsize, nil
+		}
+		if !os.IsNotExist(err) {
+			return 0, 0, fmt.Errorf("statfs %s: %w", path, err)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return 0, 0, fmt.Errorf("no existing parent found for %s", path)
+		}
+		path = parent
+	}
+}
+
+// FileSHA256 returns the hex encoded SHA256 checksum of a file on disk.
+func FileSHA256(path string) (string, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, fp); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
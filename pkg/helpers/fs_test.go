@@ -193,3 +193,38 @@ func TestRemoveAll(t *testing.T) {
 		})
 	}
 }
+
+func TestSameFilesystem(t *testing.T) {
+	dir := t.TempDir()
+	same, err := SameFilesystem(dir, filepath.Join(dir, "does", "not", "exist"))
+	require.NoError(t, err)
+	assert.True(t, same)
+
+	same, err = SameFilesystem("/proc", dir)
+	require.NoError(t, err)
+	assert.False(t, same)
+}
+
+func TestFilesystemCapacity(t *testing.T) {
+	dir := t.TempDir()
+	total, available, err := FilesystemCapacity(dir)
+	require.NoError(t, err)
+	assert.NotZero(t, total)
+	assert.LessOrEqual(t, available, total)
+
+	// paths that do not exist yet are resolved to their parent.
+	mtotal, _, err := FilesystemCapacity(filepath.Join(dir, "does", "not", "exist"))
+	require.NoError(t, err)
+	assert.Equal(t, total, mtotal)
+}
+
+func TestFileSHA256(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(fpath, []byte("hello\n"), 0644))
+	sum, err := FileSHA256(fpath)
+	require.NoError(t, err)
+	assert.Equal(t, "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03", sum)
+
+	_, err = FileSHA256(filepath.Join(t.TempDir(), "missing"))
+	assert.True(t, os.IsNotExist(err))
+}
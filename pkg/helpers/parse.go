@@ -5,18 +5,20 @@ import (
 	"os"
 
 	embeddedclusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/sops"
 	kotsv1beta1 "github.com/replicatedhq/kotskinds/apis/kots/v1beta1"
 	kyaml "sigs.k8s.io/yaml"
 )
 
-// ParseEndUserConfig parses the end user configuration from the given file.
+// ParseEndUserConfig parses the end user configuration from the given file. Files
+// encrypted with sops are decrypted using the age key found in the environment.
 func ParseEndUserConfig(fpath string) (*embeddedclusterv1beta1.Config, error) {
 	if fpath == "" {
 		return nil, nil
 	}
-	data, err := os.ReadFile(fpath)
+	data, err := ReadEndUserConfig(fpath)
 	if err != nil {
-		return nil, fmt.Errorf("unable to read overrides file: %w", err)
+		return nil, err
 	}
 	var cfg embeddedclusterv1beta1.Config
 	if err := kyaml.Unmarshal(data, &cfg); err != nil {
@@ -25,6 +27,21 @@ func ParseEndUserConfig(fpath string) (*embeddedclusterv1beta1.Config, error) {
 	return &cfg, nil
 }
 
+// ReadEndUserConfig reads the end user configuration from the given file, decrypting it
+// if it is encrypted with sops.
+func ReadEndUserConfig(fpath string) ([]byte, error) {
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read overrides file: %w", err)
+	}
+	if sops.IsEncrypted(data) {
+		if data, err = sops.Decrypt(data); err != nil {
+			return nil, fmt.Errorf("unable to decrypt overrides file: %w", err)
+		}
+	}
+	return data, nil
+}
+
 // ParseLicense parses the license from the given file.
 func ParseLicense(fpath string) (*kotsv1beta1.License, error) {
 	data, err := os.ReadFile(fpath)
@@ -196,3 +196,89 @@ func Test_enableHA(t *testing.T) {
 		})
 	}
 }
+
+func TestControlPlaneZones(t *testing.T) {
+	controller := func(name, zone string) *corev1.Node {
+		labels := map[string]string{"node-role.kubernetes.io/control-plane": "true"}
+		if zone != "" {
+			labels["topology.kubernetes.io/zone"] = zone
+		}
+		return &corev1.Node{ObjectMeta: v1.ObjectMeta{Name: name, Labels: labels}}
+	}
+	kcli := fake.NewClientBuilder().WithObjects(
+		controller("node1", "zone-b"),
+		controller("node2", "zone-a"),
+		controller("node3", "zone-b"),
+		controller("node4", ""),
+		&corev1.Node{ObjectMeta: v1.ObjectMeta{Name: "worker", Labels: map[string]string{"topology.kubernetes.io/zone": "zone-c"}}},
+	).Build()
+	zones, err := ControlPlaneZones(context.Background(), kcli)
+	require.NoError(t, err)
+	require.Equal(t, []string{"zone-a", "zone-b"}, zones)
+
+	zones, err = ControlPlaneZones(context.Background(), fake.NewClientBuilder().Build())
+	require.NoError(t, err)
+	require.Empty(t, zones)
+}
+
+func TestStorageReplication(t *testing.T) {
+	controller := func(name, zone, rack string) *corev1.Node {
+		labels := map[string]string{"node-role.kubernetes.io/control-plane": "true"}
+		if zone != "" {
+			labels["topology.kubernetes.io/zone"] = zone
+		}
+		if rack != "" {
+			labels["kots.io/embedded-cluster-rack"] = rack
+		}
+		return &corev1.Node{ObjectMeta: v1.ObjectMeta{Name: name, Labels: labels}}
+	}
+	tests := []struct {
+		name  string
+		nodes []client.Object
+		want  string
+	}{
+		{
+			name: "no topology",
+			nodes: []client.Object{
+				controller("node1", "", ""),
+				controller("node2", "", ""),
+				controller("node3", "", ""),
+			},
+			want: "001",
+		},
+		{
+			name: "multiple racks in a single zone",
+			nodes: []client.Object{
+				controller("node1", "zone-a", "rack-1"),
+				controller("node2", "zone-a", "rack-2"),
+				controller("node3", "zone-a", "rack-2"),
+			},
+			want: "010",
+		},
+		{
+			name: "multiple zones",
+			nodes: []client.Object{
+				controller("node1", "zone-a", "rack-1"),
+				controller("node2", "zone-b", "rack-1"),
+				controller("node3", "zone-b", "rack-1"),
+			},
+			want: "100",
+		},
+		{
+			name: "workers are ignored",
+			nodes: []client.Object{
+				controller("node1", "zone-a", ""),
+				&corev1.Node{ObjectMeta: v1.ObjectMeta{Name: "worker", Labels: map[string]string{"topology.kubernetes.io/zone": "zone-b"}}},
+			},
+			want: "001",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kcli := fake.NewClientBuilder().WithObjects(tt.nodes...).Build()
+			got, err := StorageReplication(context.Background(), kcli)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package highavailability
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+)
+
+// ControlPlaneZones returns the distinct zones the control plane nodes were assigned to.
+// Nodes without a zone are ignored, an empty list is returned if no zone was assigned.
+func ControlPlaneZones(ctx context.Context, kcli client.Client) ([]string, error) {
+	var nodes corev1.NodeList
+	labels := client.MatchingLabels{"node-role.kubernetes.io/control-plane": "true"}
+	if err := kcli.List(ctx, &nodes, labels); err != nil {
+		return nil, fmt.Errorf("unable to list control plane nodes: %w", err)
+	}
+	seen := map[string]bool{}
+	zones := []string{}
+	for _, node := range nodes.Items {
+		zone := node.Labels[defaults.ZoneLabel]
+		if zone == "" || seen[zone] {
+			continue
+		}
+		seen[zone] = true
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+	return zones, nil
+}
+
+// StorageReplication returns the seaweedfs replication setting used to spread the copies
+// of the data across the zones, or racks, the control plane nodes were assigned to. The
+// storage volumes are scheduled on control plane nodes only. Nodes without a zone or rack
+// belong to the seaweedfs default data center or rack.
+func StorageReplication(ctx context.Context, kcli client.Client) (string, error) {
+	var nodes corev1.NodeList
+	labels := client.MatchingLabels{"node-role.kubernetes.io/control-plane": "true"}
+	if err := kcli.List(ctx, &nodes, labels); err != nil {
+		return "", fmt.Errorf("unable to list control plane nodes: %w", err)
+	}
+	zones := map[string]bool{}
+	racks := map[string]bool{}
+	for _, node := range nodes.Items {
+		zone := node.Labels[defaults.ZoneLabel]
+		zones[zone] = true
+		racks[zone+"/"+node.Labels[defaults.RackLabel]] = true
+	}
+	switch {
+	case len(zones) > 1:
+		return "100", nil
+	case len(racks) > 1:
+		return "010", nil
+	default:
+		return "001", nil
+	}
+}
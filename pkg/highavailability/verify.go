@@ -0,0 +1,145 @@
+package highavailability
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Check is a service whose availability is verified while a controller is down.
+type Check struct {
+	Name  string
+	Probe func(ctx context.Context) error
+}
+
+// CheckResult is the availability of a service over the verification.
+type CheckResult struct {
+	Name     string
+	Probes   int
+	Failures int
+	// LongestOutage is the longest time the probes kept failing.
+	LongestOutage time.Duration
+	// LastError is the error of the last failed probe.
+	LastError string
+}
+
+// Passed returns true if the service was never unavailable for longer than maxOutage.
+func (r CheckResult) Passed(maxOutage time.Duration) bool {
+	return r.LongestOutage <= maxOutage
+}
+
+// Monitor probes the checks every interval for the duration and returns their results.
+// An outage lasts from the first failed probe to the next successful one, or to the end
+// of the verification.
+func Monitor(ctx context.Context, checks []Check, interval, duration time.Duration) []CheckResult {
+	results := make([]CheckResult, len(checks))
+	down := make([]time.Time, len(checks))
+	for i, check := range checks {
+		results[i].Name = check.Name
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	deadline := time.Now().Add(duration)
+	for {
+		now := time.Now()
+		for i, check := range checks {
+			pctx, cancel := context.WithTimeout(ctx, interval)
+			err := check.Probe(pctx)
+			cancel()
+			results[i].Probes++
+			if err == nil {
+				down[i] = time.Time{}
+				continue
+			}
+			results[i].Failures++
+			results[i].LastError = err.Error()
+			if down[i].IsZero() {
+				down[i] = now
+			}
+			results[i].LongestOutage = max(results[i].LongestOutage, time.Since(down[i]))
+		}
+		if !time.Now().Before(deadline) {
+			return results
+		}
+		select {
+		case <-ctx.Done():
+			return results
+		case <-ticker.C:
+		}
+	}
+}
+
+// APIProbe returns a probe listing the nodes of the cluster.
+func APIProbe(kcli client.Client) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		var nodes corev1.NodeList
+		return kcli.List(ctx, &nodes, client.Limit(1))
+	}
+}
+
+// RegistryProbe returns a probe requesting the registry service through the kubernetes
+// api proxy of each of the api servers, one of them must reach a registry pod. The api
+// servers proxy to the service endpoints so a registry pod down is noticed right away,
+// unlike the ready replicas of the deployment which are only updated once the lease of
+// the node expires. The registry answers with an authentication challenge, any response
+// carrying the registry api version header counts. The client must authenticate with the
+// api servers.
+func RegistryProbe(hc *http.Client, apiServers []string, namespace, service string, port int) func(ctx context.Context) error {
+	path := fmt.Sprintf("/api/v1/namespaces/%s/services/https:%s:%d/proxy/v2/", namespace, service, port)
+	return func(ctx context.Context) error {
+		errs := []error{}
+		for _, server := range apiServers {
+			url := strings.TrimSuffix(server, "/") + path
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return fmt.Errorf("unable to create request: %w", err)
+			}
+			resp, err := hc.Do(req)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			resp.Body.Close()
+			if resp.Header.Get("Docker-Distribution-Api-Version") != "" {
+				return nil
+			}
+			errs = append(errs, fmt.Errorf("%s: registry not reached, status code %d", server, resp.StatusCode))
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// HTTPProbe returns a probe requesting the urls, one of them must answer without a
+// server error. Certificates are not verified, the admin console serves a self-signed
+// certificate by default.
+func HTTPProbe(urls []string) func(ctx context.Context) error {
+	insecureClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	return func(ctx context.Context) error {
+		errs := []error{}
+		for _, url := range urls {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return fmt.Errorf("unable to create request: %w", err)
+			}
+			resp, err := insecureClient.Do(req)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			resp.Body.Close()
+			if resp.StatusCode < http.StatusInternalServerError {
+				return nil
+			}
+			errs = append(errs, fmt.Errorf("%s: unexpected status code %d", url, resp.StatusCode))
+		}
+		return errors.Join(errs...)
+	}
+}
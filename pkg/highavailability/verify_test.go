@@ -0,0 +1,78 @@
+package highavailability
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonitor(t *testing.T) {
+	// the flaky check fails the second and third probes.
+	flakyProbes := 0
+	checks := []Check{
+		{Name: "stable", Probe: func(ctx context.Context) error { return nil }},
+		{Name: "flaky", Probe: func(ctx context.Context) error {
+			flakyProbes++
+			if flakyProbes == 2 || flakyProbes == 3 {
+				return fmt.Errorf("probe %d failed", flakyProbes)
+			}
+			return nil
+		}},
+	}
+	results := Monitor(context.Background(), checks, 20*time.Millisecond, 100*time.Millisecond)
+	require.Len(t, results, 2)
+
+	assert.Equal(t, "stable", results[0].Name)
+	assert.GreaterOrEqual(t, results[0].Probes, 5)
+	assert.Zero(t, results[0].Failures)
+	assert.True(t, results[0].Passed(0))
+
+	assert.Equal(t, "flaky", results[1].Name)
+	assert.Equal(t, 2, results[1].Failures)
+	assert.Equal(t, "probe 3 failed", results[1].LastError)
+	assert.GreaterOrEqual(t, results[1].LongestOutage, 15*time.Millisecond)
+	assert.False(t, results[1].Passed(time.Millisecond))
+	assert.True(t, results[1].Passed(time.Second))
+}
+
+func TestRegistryProbe(t *testing.T) {
+	var path string
+	// the api server of the peer whose registry pod is down.
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Header().Set("Docker-Distribution-Api-Version", "registry/2.0")
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer up.Close()
+
+	probe := RegistryProbe(http.DefaultClient, []string{down.URL}, "registry", "registry", 5000)
+	assert.ErrorContains(t, probe(context.Background()), "registry not reached, status code 503")
+
+	probe = RegistryProbe(http.DefaultClient, []string{down.URL, up.URL + "/"}, "registry", "registry", 5000)
+	assert.NoError(t, probe(context.Background()))
+	assert.Equal(t, "/api/v1/namespaces/registry/services/https:registry:5000/proxy/v2/", path)
+}
+
+func TestHTTPProbe(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	ok := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer ok.Close()
+
+	assert.ErrorContains(t, HTTPProbe([]string{failing.URL})(context.Background()), "unexpected status code 502")
+	assert.NoError(t, HTTPProbe([]string{failing.URL, ok.URL})(context.Background()))
+}
@@ -0,0 +1,166 @@
+// Package hostcollectors handles the exclusion of host collectors from the host preflights
+// and support bundles. Customers with strict host data policies can exclude collectors
+// either by type (e.g. "run", "copy") or by collector name (e.g. "k8s-api-healthz-6443").
+// Analyzers depending on excluded collectors are excluded as well.
+package hostcollectors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	troubleshootv1beta2 "github.com/replicatedhq/troubleshoot/pkg/apis/troubleshoot/v1beta2"
+	"sigs.k8s.io/yaml"
+)
+
+// description holds the fields we use to match collectors and analyzers.
+type description struct {
+	kind          string
+	CollectorName string `json:"collectorName"`
+	FileName      string `json:"fileName"`
+}
+
+// output returns the name of the collector output file an analyzer reads, without its
+// directory and extension (e.g. "cgroups" for "host-collectors/system/cgroups.json").
+func (d description) output() string {
+	if d.FileName == "" {
+		return ""
+	}
+	base := filepath.Base(d.FileName)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// describe returns the description of a host collector or analyzer. Both are wrapped in
+// a struct with a single populated field, named after its type.
+func describe(obj interface{}) description {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return description{}
+	}
+	var fields map[string]description
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return description{}
+	}
+	for kind, desc := range fields {
+		desc.kind = kind
+		return desc
+	}
+	return description{}
+}
+
+// Exclude returns the provided collectors and analyzers without the ones matching the
+// excluded names. A collector is excluded if its type or collector name is in the list.
+// An analyzer is excluded if its type is in the list or if it analyzes the output of an
+// excluded collector, referenced either by collector name or by output file name.
+func Exclude(
+	collectors []*troubleshootv1beta2.HostCollect,
+	analyzers []*troubleshootv1beta2.HostAnalyze,
+	excluded []string,
+) ([]*troubleshootv1beta2.HostCollect, []*troubleshootv1beta2.HostAnalyze) {
+	if len(excluded) == 0 {
+		return collectors, analyzers
+	}
+	names := map[string]bool{}
+	for _, name := range excluded {
+		names[name] = true
+	}
+
+	// collectors without a name write their output to a file named after their type.
+	removed := map[string]bool{}
+	var keptCollectors []*troubleshootv1beta2.HostCollect
+	for _, collector := range collectors {
+		desc := describe(collector)
+		if names[desc.kind] || names[desc.CollectorName] {
+			if desc.CollectorName != "" {
+				removed[desc.CollectorName] = true
+			} else {
+				removed[desc.kind] = true
+			}
+			continue
+		}
+		keptCollectors = append(keptCollectors, collector)
+	}
+
+	var keptAnalyzers []*troubleshootv1beta2.HostAnalyze
+	for _, analyzer := range analyzers {
+		desc := describe(analyzer)
+		if names[desc.kind] || names[desc.CollectorName] || removed[desc.CollectorName] || removed[desc.output()] {
+			continue
+		}
+		keptAnalyzers = append(keptAnalyzers, analyzer)
+	}
+	return keptCollectors, keptAnalyzers
+}
+
+// FilterHostPreflightSpec removes the excluded collectors, and the analyzers depending on
+// them, from the provided host preflight spec.
+func FilterHostPreflightSpec(spec *troubleshootv1beta2.HostPreflightSpec, excluded []string) {
+	spec.Collectors, spec.Analyzers = Exclude(spec.Collectors, spec.Analyzers, excluded)
+	if len(excluded) > 0 {
+		spec.Uri = ""
+	}
+}
+
+// FilterSupportBundle removes the excluded host collectors, and the host analyzers
+// depending on them, from the provided serialized SupportBundle. The spec uri is removed
+// as well so the spec is not replaced by its upstream version when collecting.
+func FilterSupportBundle(data []byte, excluded []string) ([]byte, error) {
+	if len(excluded) == 0 {
+		return data, nil
+	}
+	var bundle troubleshootv1beta2.SupportBundle
+	if err := yaml.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal support bundle: %w", err)
+	}
+	bundle.Spec.HostCollectors, bundle.Spec.HostAnalyzers = Exclude(
+		bundle.Spec.HostCollectors, bundle.Spec.HostAnalyzers, excluded,
+	)
+	bundle.Spec.Uri = ""
+	out, err := yaml.Marshal(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal support bundle: %w", err)
+	}
+	return out, nil
+}
+
+// WriteExcluded persists the list of excluded collectors to the provided path so it is
+// honoured by later operations on this node (e.g. upgrades). An empty list removes the
+// file.
+func WriteExcluded(path string, excluded []string) error {
+	if len(excluded) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("unable to remove excluded host collectors file: %w", err)
+		}
+		return nil
+	}
+	data, err := yaml.Marshal(excluded)
+	if err != nil {
+		return fmt.Errorf("unable to marshal excluded host collectors: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("unable to create directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("unable to write excluded host collectors file: %w", err)
+	}
+	return nil
+}
+
+// ReadExcluded reads the list of excluded collectors persisted in the provided path. If
+// the file does not exist no collector is excluded.
+func ReadExcluded(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read excluded host collectors file: %w", err)
+	}
+	var excluded []string
+	if err := yaml.Unmarshal(data, &excluded); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal excluded host collectors: %w", err)
+	}
+	return excluded, nil
+}
@@ -0,0 +1,151 @@
+package hostcollectors
+
+import (
+	"path/filepath"
+	"testing"
+
+	troubleshootv1beta2 "github.com/replicatedhq/troubleshoot/pkg/apis/troubleshoot/v1beta2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
+)
+
+const preflightSpec = `
+collectors:
+- cpu: {}
+- cgroups: {}
+- run:
+    collectorName: ip-route-table
+    command: ip
+- run:
+    collectorName: resolv.conf
+    command: cat
+- tcpPortStatus:
+    collectorName: kotsadm
+    port: 30000
+analyzers:
+- cpu:
+    checkName: CPU
+- jsonCompare:
+    checkName: cgroups
+    fileName: host-collectors/system/cgroups.json
+- textAnalyze:
+    checkName: routes
+    fileName: host-collectors/run-host/ip-route-table.txt
+- textAnalyze:
+    checkName: resolv
+    fileName: host-collectors/run-host/resolv.conf.txt
+- tcpPortStatus:
+    checkName: kotsadm port
+    collectorName: kotsadm
+`
+
+func parseSpec(t *testing.T) *troubleshootv1beta2.HostPreflightSpec {
+	var spec troubleshootv1beta2.HostPreflightSpec
+	require.NoError(t, yaml.Unmarshal([]byte(preflightSpec), &spec))
+	return &spec
+}
+
+func checkNames(analyzers []*troubleshootv1beta2.HostAnalyze) []string {
+	var names []string
+	for _, analyzer := range analyzers {
+		data, _ := yaml.Marshal(analyzer)
+		var fields map[string]struct {
+			CheckName string `json:"checkName"`
+		}
+		_ = yaml.Unmarshal(data, &fields)
+		for _, f := range fields {
+			names = append(names, f.CheckName)
+		}
+	}
+	return names
+}
+
+func TestExclude(t *testing.T) {
+	tests := []struct {
+		name           string
+		excluded       []string
+		wantCollectors int
+		wantAnalyzers  []string
+	}{
+		{
+			name:           "nothing excluded",
+			wantCollectors: 5,
+			wantAnalyzers:  []string{"CPU", "cgroups", "routes", "resolv", "kotsadm port"},
+		},
+		{
+			name:           "by type",
+			excluded:       []string{"run"},
+			wantCollectors: 3,
+			wantAnalyzers:  []string{"CPU", "cgroups", "kotsadm port"},
+		},
+		{
+			name:           "by collector name",
+			excluded:       []string{"resolv.conf", "kotsadm"},
+			wantCollectors: 3,
+			wantAnalyzers:  []string{"CPU", "cgroups", "routes"},
+		},
+		{
+			name:           "unnamed collectors",
+			excluded:       []string{"cgroups", "cpu"},
+			wantCollectors: 3,
+			wantAnalyzers:  []string{"routes", "resolv", "kotsadm port"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := parseSpec(t)
+			FilterHostPreflightSpec(spec, tt.excluded)
+			assert.Len(t, spec.Collectors, tt.wantCollectors)
+			assert.Equal(t, tt.wantAnalyzers, checkNames(spec.Analyzers))
+		})
+	}
+}
+
+func TestFilterSupportBundle(t *testing.T) {
+	data := []byte(`apiVersion: troubleshoot.sh/v1beta2
+kind: SupportBundle
+metadata:
+  name: host-support-bundle
+spec:
+  uri: https://example.com/host-support-bundle.yaml
+  hostCollectors:
+  - cpu: {}
+  - run:
+      collectorName: ps
+      command: ps
+  hostAnalyzers:
+  - textAnalyze:
+      checkName: processes
+      fileName: host-collectors/run-host/ps.txt
+`)
+
+	out, err := FilterSupportBundle(data, nil)
+	require.NoError(t, err)
+	assert.Equal(t, data, out)
+
+	out, err = FilterSupportBundle(data, []string{"ps"})
+	require.NoError(t, err)
+	var bundle troubleshootv1beta2.SupportBundle
+	require.NoError(t, yaml.Unmarshal(out, &bundle))
+	assert.Equal(t, "host-support-bundle", bundle.Metadata.Name)
+	assert.Empty(t, bundle.Spec.Uri)
+	assert.Len(t, bundle.Spec.HostCollectors, 1)
+	assert.Empty(t, bundle.Spec.HostAnalyzers)
+}
+
+func TestWriteExcluded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dir", "excluded.yaml")
+
+	excluded, err := ReadExcluded(path)
+	require.NoError(t, err)
+	assert.Empty(t, excluded)
+
+	require.NoError(t, WriteExcluded(path, []string{"run", "copy"}))
+	excluded, err = ReadExcluded(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"run", "copy"}, excluded)
+
+	require.NoError(t, WriteExcluded(path, nil))
+	assert.NoFileExists(t, path)
+}
@@ -0,0 +1,182 @@
+// Package hostconfig holds the configuration files written on the hosts outside of the
+// data directory: the containerd registry mirrors, the local artifact mirror unit and the
+// systemd drop-ins of the k0s and local artifact mirror services. Installs and joins write
+// them and the operator restores the ones that went missing on the nodes.
+package hostconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/registrymirror"
+)
+
+const (
+	// LocalArtifactMirrorUnitPath is the systemd unit of the local artifact mirror.
+	LocalArtifactMirrorUnitPath = "/etc/systemd/system/local-artifact-mirror.service"
+	// LocalArtifactMirrorDropInPath is the drop-in configuring the local artifact mirror.
+	LocalArtifactMirrorDropInPath = "/etc/systemd/system/local-artifact-mirror.service.d/embedded-cluster.conf"
+	// WorkerProxyDropInPath is the drop-in configuring the proxy for k0s on workers.
+	WorkerProxyDropInPath = "/etc/systemd/system/k0sworker.service.d/http-proxy.conf"
+	// ControllerProxyDropInPath is the drop-in configuring the proxy for k0s on controllers.
+	ControllerProxyDropInPath = "/etc/systemd/system/k0scontroller.service.d/http-proxy.conf"
+	// LocalArtifactMirrorProxyDropInPath is the drop-in configuring the proxy for the local
+	// artifact mirror.
+	LocalArtifactMirrorProxyDropInPath = "/etc/systemd/system/local-artifact-mirror.service.d/http-proxy.conf"
+)
+
+// LocalArtifactMirrorUnit is the systemd unit running the local artifact mirror, it is
+// configured through its drop-ins.
+const LocalArtifactMirrorUnit = `[Unit]
+Description=Embedded Cluster Local Artifact Mirror
+
+[Service]
+ExecStart=/var/lib/embedded-cluster/bin/local-artifact-mirror serve
+Restart=always
+RestartSec=5s
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// K0sUnitPath returns the systemd unit k0s installs for the node role.
+func K0sUnitPath(controller bool) string {
+	if controller {
+		return "/etc/systemd/system/k0scontroller.service"
+	}
+	return "/etc/systemd/system/k0sworker.service"
+}
+
+// BinaryUnitPath returns the link, named after the binary, to the k0s unit of the node.
+func BinaryUnitPath(binaryName string) string {
+	return fmt.Sprintf("/etc/systemd/system/%s.service", binaryName)
+}
+
+// File is a configuration file expected on the hosts.
+type File struct {
+	Path string
+	Data string
+	Mode os.FileMode
+}
+
+// ProxyDropIn returns the systemd drop-in configuring the proxy for the k0s service.
+func ProxyDropIn(proxy *ecv1beta1.ProxySpec) string {
+	return fmt.Sprintf(`[Service]
+Environment="HTTP_PROXY=%s"
+Environment="HTTPS_PROXY=%s"
+Environment="NO_PROXY=%s"`,
+		proxy.HTTPProxy, proxy.HTTPSProxy, proxy.NoProxy)
+}
+
+// LocalArtifactMirrorDropIn returns the systemd drop-in configuring the local artifact
+// mirror. Controllers provide their node address, the mirror listens on it so the other
+// nodes can fetch the artifacts they miss from them. Workers provide no address, their
+// mirror only serves the node itself.
+func LocalArtifactMirrorDropIn(spec ecv1beta1.LocalArtifactMirrorSpec, nodeIP string) string {
+	port := spec.Port
+	if port <= 0 {
+		port = defaults.LocalArtifactMirrorPort
+	}
+	contents := fmt.Sprintf("[Service]\nEnvironment=\"LOCAL_ARTIFACT_MIRROR_PORT=%d\"", port)
+	if nodeIP != "" {
+		contents += fmt.Sprintf("\nEnvironment=\"LOCAL_ARTIFACT_MIRROR_LISTEN_ADDRESS=%s\"", nodeIP)
+	}
+	if spec.DiskQuota != "" {
+		contents += fmt.Sprintf("\nEnvironment=\"LOCAL_ARTIFACT_MIRROR_DISK_QUOTA=%s\"", spec.DiskQuota)
+	}
+	return contents
+}
+
+// WorkerFiles returns the configuration files a join writes on a worker of the
+// installation.
+func WorkerFiles(spec ecv1beta1.InstallationSpec) []File {
+	return nodeFiles(spec, WorkerProxyDropInPath, "")
+}
+
+// ControllerFiles returns the configuration files an install or a join writes on a
+// controller of the installation, the local artifact mirror listens on the node address.
+func ControllerFiles(spec ecv1beta1.InstallationSpec, nodeIP string) []File {
+	return nodeFiles(spec, ControllerProxyDropInPath, nodeIP)
+}
+
+// nodeFiles returns the configuration files of a node, the k0s proxy drop-in is written at
+// the provided path as it depends on the name of the k0s unit of the node.
+func nodeFiles(spec ecv1beta1.InstallationSpec, proxyDropInPath string, nodeIP string) []File {
+	var files []File
+	for _, file := range registrymirror.Files(spec.RegistryMirrors) {
+		files = append(files, File{Path: file.Path, Data: file.Data, Mode: file.Mode})
+	}
+	if spec.Proxy != nil {
+		files = append(files, File{Path: proxyDropInPath, Data: ProxyDropIn(spec.Proxy), Mode: 0644})
+	}
+	var mirror ecv1beta1.LocalArtifactMirrorSpec
+	if spec.LocalArtifactMirror != nil {
+		mirror = *spec.LocalArtifactMirror
+	}
+	files = append(files, File{Path: LocalArtifactMirrorUnitPath, Data: LocalArtifactMirrorUnit, Mode: 0644})
+	files = append(files, File{Path: LocalArtifactMirrorDropInPath, Data: LocalArtifactMirrorDropIn(mirror, nodeIP), Mode: 0644})
+	return files
+}
+
+// Restore writes the files missing under the root directory, where the host filesystem is
+// mounted, and returns their paths. Existing files are never overwritten, even if their
+// content differs, as they may have been changed on purpose. Directories are created only
+// accessible by root when the file is only readable by root.
+func Restore(root string, files []File) ([]string, error) {
+	var restored []string
+	for _, file := range files {
+		path := filepath.Join(root, file.Path)
+		if _, err := os.Lstat(path); err == nil {
+			continue
+		} else if !os.IsNotExist(err) {
+			return restored, fmt.Errorf("unable to stat %s: %w", file.Path, err)
+		}
+		dirMode := os.FileMode(0755)
+		if file.Mode&0077 == 0 {
+			dirMode = 0700
+		}
+		if err := os.MkdirAll(filepath.Dir(path), dirMode); err != nil {
+			return restored, fmt.Errorf("unable to create directory for %s: %w", file.Path, err)
+		}
+		fp, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, file.Mode)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		} else if err != nil {
+			return restored, fmt.Errorf("unable to create %s: %w", file.Path, err)
+		}
+		_, err = fp.WriteString(file.Data)
+		if cerr := fp.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return restored, fmt.Errorf("unable to write %s: %w", file.Path, err)
+		}
+		restored = append(restored, file.Path)
+	}
+	return restored, nil
+}
+
+// RestoreLink creates the symbolic link, under the root directory where the host
+// filesystem is mounted, to the target if the link is missing and the target exists. The
+// target is a path on the host. Returns true if the link was created.
+func RestoreLink(root, path, target string) (bool, error) {
+	link := filepath.Join(root, path)
+	if _, err := os.Lstat(link); err == nil {
+		return false, nil
+	} else if !os.IsNotExist(err) {
+		return false, fmt.Errorf("unable to stat %s: %w", path, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, target)); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("unable to stat %s: %w", target, err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		return false, fmt.Errorf("unable to link %s to %s: %w", path, target, err)
+	}
+	return true, nil
+}
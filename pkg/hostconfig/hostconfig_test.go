@@ -0,0 +1,135 @@
+package hostconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+func TestLocalArtifactMirrorDropIn(t *testing.T) {
+	tests := []struct {
+		name   string
+		spec   ecv1beta1.LocalArtifactMirrorSpec
+		nodeIP string
+		want   string
+	}{
+		{
+			name: "worker",
+			spec: ecv1beta1.LocalArtifactMirrorSpec{Port: 50001},
+			want: "[Service]\nEnvironment=\"LOCAL_ARTIFACT_MIRROR_PORT=50001\"",
+		},
+		{
+			name:   "controller with a disk quota",
+			spec:   ecv1beta1.LocalArtifactMirrorSpec{DiskQuota: "20Gi"},
+			nodeIP: "10.0.0.1",
+			want: "[Service]\nEnvironment=\"LOCAL_ARTIFACT_MIRROR_PORT=50000\"\n" +
+				"Environment=\"LOCAL_ARTIFACT_MIRROR_LISTEN_ADDRESS=10.0.0.1\"\n" +
+				"Environment=\"LOCAL_ARTIFACT_MIRROR_DISK_QUOTA=20Gi\"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := require.New(t)
+			req.Equal(tt.want, LocalArtifactMirrorDropIn(tt.spec, tt.nodeIP))
+		})
+	}
+}
+
+func TestWorkerFiles(t *testing.T) {
+	files := WorkerFiles(ecv1beta1.InstallationSpec{
+		RegistryMirrors: []ecv1beta1.RegistryMirror{
+			{Registry: "docker.io", Endpoints: []ecv1beta1.RegistryMirrorEndpoint{{URL: "https://harbor.example.com"}}},
+		},
+		Proxy:               &ecv1beta1.ProxySpec{HTTPProxy: "http://proxy:3128", HTTPSProxy: "http://proxy:3128", NoProxy: "10.0.0.0/8"},
+		LocalArtifactMirror: &ecv1beta1.LocalArtifactMirrorSpec{Port: 50001, DiskQuota: "10Gi"},
+	})
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+	assert.Equal(t, []string{
+		"/etc/k0s/containerd.d/hosts.d/docker.io/hosts.toml",
+		"/etc/k0s/containerd.d/registry-mirrors.toml",
+		WorkerProxyDropInPath,
+		LocalArtifactMirrorUnitPath,
+		LocalArtifactMirrorDropInPath,
+	}, paths)
+	assert.Contains(t, files[2].Data, `Environment="NO_PROXY=10.0.0.0/8"`)
+	assert.Equal(t, LocalArtifactMirrorUnit, files[3].Data)
+	assert.Equal(t, "[Service]\nEnvironment=\"LOCAL_ARTIFACT_MIRROR_PORT=50001\"\n"+
+		"Environment=\"LOCAL_ARTIFACT_MIRROR_DISK_QUOTA=10Gi\"", files[4].Data)
+
+	files = WorkerFiles(ecv1beta1.InstallationSpec{})
+	require.Len(t, files, 2)
+	assert.Equal(t, "[Service]\nEnvironment=\"LOCAL_ARTIFACT_MIRROR_PORT=50000\"", files[1].Data)
+}
+
+func TestControllerFiles(t *testing.T) {
+	files := ControllerFiles(ecv1beta1.InstallationSpec{
+		Proxy: &ecv1beta1.ProxySpec{HTTPProxy: "http://proxy:3128"},
+	}, "10.0.0.1")
+	require.Len(t, files, 3)
+	assert.Equal(t, ControllerProxyDropInPath, files[0].Path)
+	assert.Equal(t, LocalArtifactMirrorUnitPath, files[1].Path)
+	assert.Equal(t, LocalArtifactMirrorDropInPath, files[2].Path)
+	assert.Equal(t, "[Service]\nEnvironment=\"LOCAL_ARTIFACT_MIRROR_PORT=50000\"\n"+
+		"Environment=\"LOCAL_ARTIFACT_MIRROR_LISTEN_ADDRESS=10.0.0.1\"", files[2].Data)
+}
+
+func TestRestore(t *testing.T) {
+	root := t.TempDir()
+	files := []File{
+		{Path: "/etc/k0s/containerd.d/hosts.d/docker.io/hosts.toml", Data: "server = \"https://registry-1.docker.io\"\n", Mode: 0600},
+		{Path: "/etc/systemd/system/k0sworker.service.d/http-proxy.conf", Data: "[Service]\n", Mode: 0644},
+	}
+	changed := filepath.Join(root, files[1].Path)
+	require.NoError(t, os.MkdirAll(filepath.Dir(changed), 0755))
+	require.NoError(t, os.WriteFile(changed, []byte("# changed on purpose\n"), 0644))
+
+	restored, err := Restore(root, files)
+	require.NoError(t, err)
+	assert.Equal(t, []string{files[0].Path}, restored)
+
+	data, err := os.ReadFile(filepath.Join(root, files[0].Path))
+	require.NoError(t, err)
+	assert.Equal(t, files[0].Data, string(data))
+	info, err := os.Stat(filepath.Join(root, "/etc/k0s/containerd.d/hosts.d/docker.io"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+	data, err = os.ReadFile(changed)
+	require.NoError(t, err)
+	assert.Equal(t, "# changed on purpose\n", string(data))
+
+	restored, err = Restore(root, files)
+	require.NoError(t, err)
+	assert.Empty(t, restored)
+}
+
+func TestRestoreLink(t *testing.T) {
+	root := t.TempDir()
+	link := BinaryUnitPath("my-app")
+	target := K0sUnitPath(true)
+
+	restored, err := RestoreLink(root, link, target)
+	require.NoError(t, err)
+	assert.False(t, restored, "the target does not exist")
+
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "/etc/systemd/system"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, target), []byte("[Unit]\n"), 0644))
+	restored, err = RestoreLink(root, link, target)
+	require.NoError(t, err)
+	assert.True(t, restored)
+	dst, err := os.Readlink(filepath.Join(root, link))
+	require.NoError(t, err)
+	assert.Equal(t, target, dst, "the link points to the host path")
+
+	restored, err = RestoreLink(root, link, target)
+	require.NoError(t, err)
+	assert.False(t, restored)
+}
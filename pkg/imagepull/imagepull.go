@@ -0,0 +1,107 @@
+// Package imagepull tunes the parallelism of image pulls on the node. Containerd pulls
+// three layers at a time and the kubelet pulls one image at a time by default, leaving
+// most of the bandwidth of fast links unused when deploying image heavy applications.
+package imagepull
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+)
+
+// SysClassNetPath is where the network interfaces speed is read from.
+var SysClassNetPath = "/sys/class/net"
+
+// containerdConfigTemplate is imported by the containerd configuration generated by k0s.
+const containerdConfigTemplate = `[plugins."io.containerd.grpc.v1.cri"]
+  max_concurrent_downloads = %d
+`
+
+// Settings holds the image pull settings applied to a node.
+type Settings struct {
+	MaxConcurrentDownloads int
+	RegistryPullQPS        int
+	RegistryBurst          int
+}
+
+// Tune returns the settings for a node whose network interface runs at the provided
+// speed, in Mbps. Unknown speeds, reported as zero or less by virtual interfaces, are
+// tuned as gigabit links.
+func Tune(speedMbps int) Settings {
+	switch {
+	case speedMbps >= 10000:
+		return Settings{MaxConcurrentDownloads: 12, RegistryPullQPS: 20, RegistryBurst: 40}
+	case speedMbps > 0 && speedMbps < 1000:
+		return Settings{MaxConcurrentDownloads: 3, RegistryPullQPS: 5, RegistryBurst: 10}
+	}
+	return Settings{MaxConcurrentDownloads: 6, RegistryPullQPS: 10, RegistryBurst: 20}
+}
+
+// Resolve returns the settings for the node, the values set in the configuration take
+// precedence over the ones tuned for the interface speed.
+func Resolve(cfg *ecv1beta1.ImagePull, speedMbps int) Settings {
+	settings := Tune(speedMbps)
+	if cfg == nil {
+		return settings
+	}
+	if cfg.MaxConcurrentDownloads > 0 {
+		settings.MaxConcurrentDownloads = cfg.MaxConcurrentDownloads
+	}
+	if cfg.RegistryPullQPS > 0 {
+		settings.RegistryPullQPS = cfg.RegistryPullQPS
+	}
+	if cfg.RegistryBurst > 0 {
+		settings.RegistryBurst = cfg.RegistryBurst
+	}
+	if settings.RegistryBurst < settings.RegistryPullQPS {
+		settings.RegistryBurst = settings.RegistryPullQPS
+	}
+	return settings
+}
+
+// InterfaceSpeed returns the speed of the provided network interface in Mbps. Returns
+// zero if the speed can't be determined.
+func InterfaceSpeed(iface string) int {
+	data, err := os.ReadFile(filepath.Join(SysClassNetPath, iface, "speed"))
+	if err != nil {
+		logrus.Debugf("unable to read speed of interface %s: %v", iface, err)
+		return 0
+	}
+	speed, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		logrus.Debugf("unable to parse speed of interface %s: %v", iface, err)
+		return 0
+	}
+	return speed
+}
+
+// KubeletArgs returns the kubelet flags applying the settings. Images are pulled in
+// parallel, rate limited by the registry settings.
+func KubeletArgs(settings Settings) []string {
+	return []string{
+		"--serialize-image-pulls=false",
+		fmt.Sprintf("--registry-qps=%d", settings.RegistryPullQPS),
+		fmt.Sprintf("--registry-burst=%d", settings.RegistryBurst),
+	}
+}
+
+// WriteContainerdConfig writes the containerd configuration applying the settings, it is
+// imported by the configuration k0s generates for containerd.
+func WriteContainerdConfig(settings Settings) error {
+	dir := defaults.PathToK0sContainerdConfig()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("unable to create containerd config directory: %w", err)
+	}
+	data := fmt.Sprintf(containerdConfigTemplate, settings.MaxConcurrentDownloads)
+	if err := os.WriteFile(filepath.Join(dir, "image-pull.toml"), []byte(data), 0644); err != nil {
+		return fmt.Errorf("unable to write containerd config: %w", err)
+	}
+	return nil
+}
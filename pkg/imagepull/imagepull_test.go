@@ -0,0 +1,68 @@
+package imagepull
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+func TestResolve(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		cfg   *ecv1beta1.ImagePull
+		speed int
+		want  Settings
+	}{
+		{
+			name:  "unknown speed",
+			speed: 0,
+			want:  Settings{MaxConcurrentDownloads: 6, RegistryPullQPS: 10, RegistryBurst: 20},
+		},
+		{
+			name:  "slow link",
+			speed: 100,
+			want:  Settings{MaxConcurrentDownloads: 3, RegistryPullQPS: 5, RegistryBurst: 10},
+		},
+		{
+			name:  "fast link",
+			speed: 25000,
+			want:  Settings{MaxConcurrentDownloads: 12, RegistryPullQPS: 20, RegistryBurst: 40},
+		},
+		{
+			name:  "configured",
+			cfg:   &ecv1beta1.ImagePull{MaxConcurrentDownloads: 4, RegistryPullQPS: 50},
+			speed: 1000,
+			want:  Settings{MaxConcurrentDownloads: 4, RegistryPullQPS: 50, RegistryBurst: 50},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Resolve(tt.cfg, tt.speed))
+		})
+	}
+}
+
+func TestInterfaceSpeed(t *testing.T) {
+	original := SysClassNetPath
+	defer func() { SysClassNetPath = original }()
+	SysClassNetPath = t.TempDir()
+
+	require.NoError(t, os.MkdirAll(filepath.Join(SysClassNetPath, "eth0"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(SysClassNetPath, "eth0", "speed"), []byte("10000\n"), 0644))
+	assert.Equal(t, 10000, InterfaceSpeed("eth0"))
+
+	require.NoError(t, os.MkdirAll(filepath.Join(SysClassNetPath, "ens3"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(SysClassNetPath, "ens3", "speed"), []byte("-1\n"), 0644))
+	assert.Equal(t, -1, InterfaceSpeed("ens3"))
+
+	assert.Equal(t, 0, InterfaceSpeed("missing"))
+}
+
+func TestKubeletArgs(t *testing.T) {
+	args := KubeletArgs(Settings{MaxConcurrentDownloads: 6, RegistryPullQPS: 10, RegistryBurst: 20})
+	assert.Equal(t, []string{"--serialize-image-pulls=false", "--registry-qps=10", "--registry-burst=20"}, args)
+}
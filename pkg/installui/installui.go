@@ -0,0 +1,298 @@
+// Package installui serves a local web interface guiding the operator through the
+// installation settings and streaming the installation progress, for operators not
+// comfortable with a terminal. The interface is protected by a random token included in
+// the url printed by the installer.
+package installui
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+//go:embed static/*
+var static embed.FS
+
+// shutdownTimeout bounds the time spent waiting for browsers to receive the last events.
+const shutdownTimeout = 10 * time.Second
+
+// Settings are the installation settings entered by the operator.
+type Settings struct {
+	AdminConsolePassword    string `json:"adminConsolePassword"`
+	AdminConsolePort        int    `json:"adminConsolePort"`
+	LocalArtifactMirrorPort int    `json:"localArtifactMirrorPort"`
+	NetworkInterface        string `json:"networkInterface"`
+	License                 string `json:"license"`
+	HTTPProxy               string `json:"httpProxy"`
+	HTTPSProxy              string `json:"httpsProxy"`
+	NoProxy                 string `json:"noProxy"`
+}
+
+// Options configures the interface.
+type Options struct {
+	// AppName is the name of the installed application.
+	AppName string
+	// Defaults are the settings the form is populated with.
+	Defaults Settings
+	// NetworkInterfaces are the network interfaces the operator can choose from.
+	NetworkInterfaces []string
+	// Licenses are license files found on the host.
+	Licenses []string
+	// LicenseRequired indicates the installation requires a license.
+	LicenseRequired bool
+	// Validate validates the settings submitted by the operator.
+	Validate func(Settings) error
+}
+
+// Event is an installation progress event streamed to the browser.
+type Event struct {
+	// Type is one of progress, info, warn, error, done or failed.
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// Server serves the installation interface.
+type Server struct {
+	opts     Options
+	token    string
+	listener net.Listener
+	server   *http.Server
+	settings chan Settings
+
+	mu      sync.Mutex
+	events  []Event
+	updated chan struct{}
+	done    bool
+}
+
+// New returns a server listening on the provided address.
+func New(address string, opts Options) (*Server, error) {
+	token, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on %s: %w", address, err)
+	}
+	s := &Server{
+		opts:     opts,
+		token:    token,
+		listener: listener,
+		settings: make(chan Settings, 1),
+		updated:  make(chan struct{}),
+	}
+	s.server = &http.Server{Handler: s.handler(), ReadHeaderTimeout: 10 * time.Second}
+	return s, nil
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("unable to generate token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// URL returns the url the operator opens in a browser, it includes the access token.
+func (s *Server) URL() string {
+	return fmt.Sprintf("http://%s/?token=%s", s.listener.Addr(), s.token)
+}
+
+// Start serves the interface in the background.
+func (s *Server) Start() {
+	go func() {
+		if err := s.server.Serve(s.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logrus.Debugf("installation ui server failed: %v", err)
+		}
+	}()
+}
+
+// WaitForSettings blocks until the operator submits valid settings.
+func (s *Server) WaitForSettings(ctx context.Context) (Settings, error) {
+	select {
+	case settings := <-s.settings:
+		return settings, nil
+	case <-ctx.Done():
+		return Settings{}, ctx.Err()
+	}
+}
+
+// Progress reports an installation step, it is used as the spinner observer.
+func (s *Server) Progress(message string) {
+	s.publish(Event{Type: "progress", Message: message})
+}
+
+// Finish reports the outcome of the installation and stops the server once browsers
+// received it.
+func (s *Server) Finish(err error) {
+	event := Event{Type: "done", Message: "Installation complete"}
+	if err != nil {
+		event = Event{Type: "failed", Message: err.Error()}
+	}
+	s.publish(event)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		logrus.Debugf("unable to shutdown the installation ui server: %v", err)
+	}
+}
+
+// Levels implements logrus.Hook, log entries shown to the operator are streamed.
+func (s *Server) Levels() []logrus.Level {
+	return []logrus.Level{logrus.InfoLevel, logrus.WarnLevel, logrus.ErrorLevel}
+}
+
+// Fire implements logrus.Hook.
+func (s *Server) Fire(entry *logrus.Entry) error {
+	kind := "info"
+	switch entry.Level {
+	case logrus.WarnLevel:
+		kind = "warn"
+	case logrus.ErrorLevel:
+		kind = "error"
+	}
+	s.publish(Event{Type: kind, Message: entry.Message})
+	return nil
+}
+
+func (s *Server) publish(event Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done {
+		return
+	}
+	s.events = append(s.events, event)
+	s.done = event.Type == "done" || event.Type == "failed"
+	close(s.updated)
+	s.updated = make(chan struct{})
+}
+
+// eventsSince returns the events published after the first n ones, whether the
+// installation finished and a channel closed once new events are published.
+func (s *Server) eventsSince(n int) ([]Event, bool, chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.events[n:], s.done, s.updated
+}
+
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	content, _ := fs.Sub(static, "static")
+	mux.Handle("/", http.FileServer(http.FS(content)))
+	mux.HandleFunc("/api/options", s.authorized(s.handleOptions))
+	mux.HandleFunc("/api/settings", s.authorized(s.handleSettings))
+	mux.HandleFunc("/api/events", s.authorized(s.handleEvents))
+	return mux
+}
+
+// authorized rejects requests without the access token.
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) handleOptions(w http.ResponseWriter, r *http.Request) {
+	defaults := s.opts.Defaults
+	defaults.AdminConsolePassword = ""
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"appName":           s.opts.AppName,
+		"defaults":          defaults,
+		"networkInterfaces": s.opts.NetworkInterfaces,
+		"licenses":          s.opts.Licenses,
+		"licenseRequired":   s.opts.LicenseRequired,
+	})
+}
+
+func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var settings Settings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid settings: %v", err)})
+		return
+	}
+	if s.opts.Validate != nil {
+		if err := s.opts.Validate(settings); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	select {
+	case s.settings <- settings:
+		writeJSON(w, http.StatusAccepted, map[string]string{})
+	default:
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "the installation already started"})
+	}
+}
+
+// handleEvents streams the installation events as server-sent events. Events published
+// before the browser connected are replayed.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	sent := 0
+	for {
+		events, done, updated := s.eventsSince(sent)
+		for _, event := range events {
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+		flusher.Flush()
+		sent += len(events)
+		if done {
+			return
+		}
+		select {
+		case <-updated:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logrus.Debugf("unable to write response: %v", err)
+	}
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the server.
+func NewContext(ctx context.Context, s *Server) context.Context {
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// FromContext returns the server carried by the context, nil if there is none.
+func FromContext(ctx context.Context) *Server {
+	s, _ := ctx.Value(contextKey{}).(*Server)
+	return s
+}
@@ -0,0 +1,124 @@
+package installui
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T, opts Options) (*Server, *httptest.Server) {
+	s, err := New("127.0.0.1:0", opts)
+	require.NoError(t, err)
+	s.listener.Close()
+	ts := httptest.NewServer(s.handler())
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+func TestToken(t *testing.T) {
+	s, ts := newTestServer(t, Options{})
+	resp, err := http.Get(ts.URL + "/api/options?token=invalid")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, err = http.Get(ts.URL + "/api/options?token=" + s.token)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	assert.Contains(t, s.URL(), "/?token="+s.token)
+}
+
+func TestOptionsHidePassword(t *testing.T) {
+	s, ts := newTestServer(t, Options{
+		AppName:           "my-app",
+		Defaults:          Settings{AdminConsolePassword: "secret", AdminConsolePort: 30000},
+		NetworkInterfaces: []string{"eth0", "eth1"},
+	})
+	resp, err := http.Get(ts.URL + "/api/options?token=" + s.token)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var body struct {
+		AppName           string   `json:"appName"`
+		Defaults          Settings `json:"defaults"`
+		NetworkInterfaces []string `json:"networkInterfaces"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "my-app", body.AppName)
+	assert.Equal(t, 30000, body.Defaults.AdminConsolePort)
+	assert.Empty(t, body.Defaults.AdminConsolePassword)
+	assert.Equal(t, []string{"eth0", "eth1"}, body.NetworkInterfaces)
+}
+
+func TestSettings(t *testing.T) {
+	s, ts := newTestServer(t, Options{
+		Validate: func(settings Settings) error {
+			if settings.AdminConsolePort == settings.LocalArtifactMirrorPort {
+				return fmt.Errorf("ports must differ")
+			}
+			return nil
+		},
+	})
+	post := func(body string) *http.Response {
+		resp, err := http.Post(ts.URL+"/api/settings?token="+s.token, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	assert.Equal(t, http.StatusBadRequest, post(`{"adminConsolePort":30000,"localArtifactMirrorPort":30000}`).StatusCode)
+	assert.Equal(t, http.StatusAccepted, post(`{"adminConsolePort":30000,"localArtifactMirrorPort":50000,"adminConsolePassword":"password"}`).StatusCode)
+	assert.Equal(t, http.StatusConflict, post(`{"adminConsolePort":30001,"localArtifactMirrorPort":50000}`).StatusCode)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	settings, err := s.WaitForSettings(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Settings{AdminConsolePassword: "password", AdminConsolePort: 30000, LocalArtifactMirrorPort: 50000}, settings)
+}
+
+func TestEvents(t *testing.T) {
+	s, ts := newTestServer(t, Options{})
+	s.Progress("Installing node")
+	require.NoError(t, s.Fire(&logrus.Entry{Level: logrus.WarnLevel, Message: "slow disk"}))
+
+	resp, err := http.Get(ts.URL + "/api/events?token=" + s.token)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	go func() {
+		s.Progress("Waiting for node")
+		s.publish(Event{Type: "done", Message: "Installation complete"})
+		s.Progress("ignored once finished")
+	}()
+
+	var events []Event
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var event Event
+		require.NoError(t, json.Unmarshal([]byte(data), &event))
+		events = append(events, event)
+	}
+	assert.Equal(t, []Event{
+		{Type: "progress", Message: "Installing node"},
+		{Type: "warn", Message: "slow disk"},
+		{Type: "progress", Message: "Waiting for node"},
+		{Type: "done", Message: "Installation complete"},
+	}, events)
+}
@@ -0,0 +1,223 @@
+// Package joincheck validates, before a node makes any change to the host, that it can
+// join the cluster: its clock must agree with the cluster clock, the cluster CA carried
+// in the join token must be valid, the kubernetes API must be reachable over TLS and the
+// artifact mirror of the cluster must be reachable. Checks run hop by hop and stop at the first failure so the user
+// knows exactly which hop to fix.
+package joincheck
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// MaxClockSkew is the largest clock difference with the cluster a node can join with.
+// It matches the threshold enforced by the host preflights.
+const MaxClockSkew = 30 * time.Second
+
+// dialTimeout bounds each connection attempt.
+const dialTimeout = 10 * time.Second
+
+// Input holds what is needed to validate a join.
+type Input struct {
+	// Token is the k0s join token.
+	Token string
+	// ClockSkew is the difference between the local clock and the cluster clock.
+	ClockSkew time.Duration
+	// ArtifactsURL is the url of the artifact mirror of the cluster, where the node
+	// downloads artifacts from. The hop is not checked if empty.
+	ArtifactsURL string
+	// Now returns the local time, defaults to time.Now.
+	Now func() time.Time
+}
+
+// HopError is returned when a hop fails.
+type HopError struct {
+	Hop    string
+	Target string
+	Err    error
+}
+
+func (e *HopError) Error() string {
+	return fmt.Sprintf("%s (%s): %v", e.Hop, e.Target, e.Err)
+}
+
+func (e *HopError) Unwrap() error {
+	return e.Err
+}
+
+// Token holds the parts of the k0s join token used to reach the cluster.
+type Token struct {
+	Server string
+	CA     []*x509.Certificate
+	// BearerToken is the bootstrap token the node authenticates with, in the id.secret form.
+	BearerToken string
+}
+
+// DecodeToken decodes a k0s join token, a gzipped and base64 encoded kubeconfig.
+func DecodeToken(token string) (*Token, error) {
+	compressed, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode token: %w", err)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decompress token: %w", err)
+	}
+	defer gz.Close()
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decompress token: %w", err)
+	}
+	kubeconfig, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse token kubeconfig: %w", err)
+	}
+	for _, cluster := range kubeconfig.Clusters {
+		certs, err := parseCertificates(cluster.CertificateAuthorityData)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse cluster ca: %w", err)
+		}
+		token := &Token{Server: cluster.Server, CA: certs}
+		for _, auth := range kubeconfig.AuthInfos {
+			token.BearerToken = auth.Token
+		}
+		return token, nil
+	}
+	return nil, fmt.Errorf("no cluster found in token")
+}
+
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for len(data) > 0 {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate found")
+	}
+	return certs, nil
+}
+
+// Run validates the join, hop by hop. Returns a *HopError for the first hop failing.
+func Run(ctx context.Context, in Input) error {
+	now := time.Now
+	if in.Now != nil {
+		now = in.Now
+	}
+
+	logrus.Debugf("checking clock skew with the cluster")
+	if err := checkClockSkew(in.ClockSkew); err != nil {
+		return &HopError{Hop: "clock", Target: "cluster", Err: err}
+	}
+
+	token, err := DecodeToken(in.Token)
+	if err != nil {
+		return &HopError{Hop: "join token", Target: "cluster", Err: err}
+	}
+
+	logrus.Debugf("checking the cluster ca validity")
+	if err := checkCAValidity(token.CA, now()); err != nil {
+		return &HopError{Hop: "cluster CA", Target: token.CA[0].Subject.CommonName, Err: err}
+	}
+
+	logrus.Debugf("checking tls to the kubernetes api at %s", token.Server)
+	pool := x509.NewCertPool()
+	for _, cert := range token.CA {
+		pool.AddCert(cert)
+	}
+	if err := checkTLS(ctx, token.Server, &tls.Config{RootCAs: pool, Time: now, MinVersion: tls.VersionTLS12}); err != nil {
+		return &HopError{Hop: "kubernetes API TLS", Target: token.Server, Err: err}
+	}
+
+	if in.ArtifactsURL == "" {
+		return nil
+	}
+	logrus.Debugf("checking the artifact mirror at %s", in.ArtifactsURL)
+	if err := checkArtifactMirror(ctx, in.ArtifactsURL); err != nil {
+		return &HopError{Hop: "artifact mirror", Target: in.ArtifactsURL, Err: err}
+	}
+	return nil
+}
+
+func checkClockSkew(skew time.Duration) error {
+	if skew.Abs() > MaxClockSkew {
+		return fmt.Errorf("the clock of this node differs from the cluster clock by %s, it must be within %s", skew.Abs().Round(time.Second), MaxClockSkew)
+	}
+	return nil
+}
+
+// checkCAValidity verifies the CA certificates are valid at the local time. A CA not
+// yet valid usually means the local clock is behind.
+func checkCAValidity(certs []*x509.Certificate, now time.Time) error {
+	for _, cert := range certs {
+		if now.Before(cert.NotBefore) {
+			return fmt.Errorf("certificate is not valid before %s, the local time is %s", cert.NotBefore.UTC().Format(time.RFC3339), now.UTC().Format(time.RFC3339))
+		}
+		if now.After(cert.NotAfter) {
+			return fmt.Errorf("certificate expired on %s", cert.NotAfter.UTC().Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// checkTLS connects to the server and verifies its certificate using the provided config.
+func checkTLS(ctx context.Context, server string, config *tls.Config) error {
+	u, err := url.Parse(server)
+	if err != nil {
+		return fmt.Errorf("unable to parse server address: %w", err)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "443")
+	}
+	config.ServerName = u.Hostname()
+	dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: dialTimeout}, Config: config}
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// checkArtifactMirror issues a request to the artifact mirror, honoring the proxy
+// settings. Certificates of https mirrors are verified against the system trust store.
+// Any response means the hop works.
+func checkArtifactMirror(ctx context.Context, artifactsURL string) error {
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, artifactsURL, nil)
+	if err != nil {
+		return fmt.Errorf("unable to create request: %w", err)
+	}
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
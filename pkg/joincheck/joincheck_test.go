@@ -0,0 +1,142 @@
+package joincheck
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func encodeToken(t *testing.T, server string, ca *x509.Certificate) string {
+	config := clientcmdapi.NewConfig()
+	config.Clusters["k0s"] = &clientcmdapi.Cluster{
+		Server:                   server,
+		CertificateAuthorityData: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}),
+	}
+	config.AuthInfos["kubelet-bootstrap"] = &clientcmdapi.AuthInfo{Token: "abcdef.0123456789abcdef"}
+	data, err := clientcmd.Write(*config)
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	_, err = gz.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func newCA(t *testing.T) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "other-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestDecodeToken(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+
+	token, err := DecodeToken(encodeToken(t, server.URL, server.Certificate()))
+	require.NoError(t, err)
+	assert.Equal(t, server.URL, token.Server)
+	require.Len(t, token.CA, 1)
+	assert.Equal(t, server.Certificate().Raw, token.CA[0].Raw)
+	assert.Equal(t, "abcdef.0123456789abcdef", token.BearerToken)
+
+	_, err = DecodeToken("not a token")
+	assert.Error(t, err)
+}
+
+func TestRun(t *testing.T) {
+	api := httptest.NewTLSServer(http.NotFoundHandler())
+	defer api.Close()
+	other := httptest.NewTLSServer(http.NotFoundHandler())
+	defer other.Close()
+	mirror := httptest.NewServer(http.NotFoundHandler())
+	defer mirror.Close()
+	token := encodeToken(t, api.URL, api.Certificate())
+
+	for _, tt := range []struct {
+		name    string
+		in      Input
+		wantHop string
+		wantErr string
+	}{
+		{
+			name: "all hops pass",
+			in:   Input{Token: token, ClockSkew: 2 * time.Second},
+		},
+		{
+			name:    "clock skew",
+			in:      Input{Token: token, ClockSkew: -2 * time.Minute},
+			wantHop: "clock",
+			wantErr: "differs from the cluster clock by 2m0s",
+		},
+		{
+			name:    "invalid token",
+			in:      Input{Token: "invalid"},
+			wantHop: "join token",
+		},
+		{
+			name:    "clock behind the ca",
+			in:      Input{Token: token, Now: func() time.Time { return api.Certificate().NotBefore.Add(-time.Hour) }},
+			wantHop: "cluster CA",
+			wantErr: "is not valid before",
+		},
+		{
+			name:    "api signed by another ca",
+			in:      Input{Token: encodeToken(t, api.URL, newCA(t))},
+			wantHop: "kubernetes API TLS",
+			wantErr: "certificate",
+		},
+		{
+			name: "artifact mirror reachable",
+			in:   Input{Token: token, ArtifactsURL: mirror.URL},
+		},
+		{
+			name:    "untrusted artifact mirror",
+			in:      Input{Token: token, ArtifactsURL: other.URL},
+			wantHop: "artifact mirror",
+			wantErr: "certificate",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Run(context.Background(), tt.in)
+			if tt.wantHop == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var herr *HopError
+			require.ErrorAs(t, err, &herr)
+			assert.Equal(t, tt.wantHop, herr.Hop)
+			assert.Contains(t, herr.Error(), tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package jointoken
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CreateBootstrapToken creates a k0s bootstrap token for the role expiring at the provided
+// time, and returns it in the id.secret form. The role and the expiry are enforced by the
+// cluster: the kubernetes api and the k0s join api only accept the token for the usages of
+// its role, and the token is removed by the token cleaner once expired.
+func CreateBootstrapToken(ctx context.Context, cli client.Client, role string, expiry time.Time) (string, error) {
+	id, err := randomHex(3)
+	if err != nil {
+		return "", err
+	}
+	secret, err := randomHex(8)
+	if err != nil {
+		return "", err
+	}
+	data := map[string]string{
+		"token-id":                 id,
+		"token-secret":             secret,
+		"expiration":               expiry.UTC().Format(time.RFC3339),
+		"usage-bootstrap-api-auth": "true",
+	}
+	switch role {
+	case RoleWorker:
+		data["description"] = "Worker bootstrap token generated by embedded cluster"
+		data["usage-bootstrap-authentication"] = "true"
+		data["usage-bootstrap-api-worker-calls"] = "true"
+	case RoleController:
+		data["description"] = "Controller bootstrap token generated by embedded cluster"
+		data["usage-bootstrap-authentication"] = "false"
+		data["usage-bootstrap-signing"] = "false"
+		data["usage-controller-join"] = "true"
+	default:
+		return "", fmt.Errorf("invalid role %q, must be one of %s or %s", role, RoleController, RoleWorker)
+	}
+	obj := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("bootstrap-token-%s", id),
+			Namespace: "kube-system",
+		},
+		Type:       corev1.SecretTypeBootstrapToken,
+		StringData: data,
+	}
+	if err := cli.Create(ctx, obj); err != nil {
+		return "", fmt.Errorf("unable to create bootstrap token: %w", err)
+	}
+	return fmt.Sprintf("%s.%s", id, secret), nil
+}
+
+// ReplaceBootstrapToken returns the k0s join token, a gzipped and base64 encoded
+// kubeconfig, authenticating with the bootstrap token instead.
+func ReplaceBootstrapToken(k0sToken, bootstrapToken string) (string, error) {
+	compressed, err := base64.StdEncoding.DecodeString(k0sToken)
+	if err != nil {
+		return "", fmt.Errorf("unable to decode k0s token: %w", err)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return "", fmt.Errorf("unable to decompress k0s token: %w", err)
+	}
+	defer gz.Close()
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		return "", fmt.Errorf("unable to decompress k0s token: %w", err)
+	}
+	kubeconfig, err := clientcmd.Load(data)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse k0s token kubeconfig: %w", err)
+	}
+	if len(kubeconfig.AuthInfos) == 0 {
+		return "", fmt.Errorf("no user found in k0s token")
+	}
+	for _, auth := range kubeconfig.AuthInfos {
+		auth.Token = bootstrapToken
+	}
+	if data, err = clientcmd.Write(*kubeconfig); err != nil {
+		return "", fmt.Errorf("unable to write k0s token kubeconfig: %w", err)
+	}
+	buf := &bytes.Buffer{}
+	gzw := gzip.NewWriter(buf)
+	if _, err := gzw.Write(data); err != nil {
+		return "", fmt.Errorf("unable to compress k0s token: %w", err)
+	}
+	if err := gzw.Close(); err != nil {
+		return "", fmt.Errorf("unable to compress k0s token: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("unable to generate bootstrap token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
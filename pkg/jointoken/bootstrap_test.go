@@ -0,0 +1,77 @@
+package jointoken
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/joincheck"
+)
+
+func TestCreateBootstrapToken(t *testing.T) {
+	ctx := context.Background()
+	cli := fake.NewClientBuilder().Build()
+	expiry := time.Date(2024, 10, 1, 13, 0, 0, 0, time.UTC)
+
+	for role, usage := range map[string]string{RoleWorker: "usage-bootstrap-api-worker-calls", RoleController: "usage-controller-join"} {
+		token, err := CreateBootstrapToken(ctx, cli, role, expiry)
+		require.NoError(t, err)
+		id, secret, ok := strings.Cut(token, ".")
+		require.True(t, ok)
+		assert.Len(t, id, 6)
+		assert.Len(t, secret, 16)
+
+		var obj corev1.Secret
+		require.NoError(t, cli.Get(ctx, client.ObjectKey{Namespace: "kube-system", Name: "bootstrap-token-" + id}, &obj))
+		assert.Equal(t, corev1.SecretTypeBootstrapToken, obj.Type)
+		assert.Equal(t, secret, obj.StringData["token-secret"])
+		assert.Equal(t, "2024-10-01T13:00:00Z", obj.StringData["expiration"])
+		assert.Equal(t, "true", obj.StringData[usage])
+	}
+	_, err := CreateBootstrapToken(ctx, cli, "windows-worker", expiry)
+	assert.EqualError(t, err, `invalid role "windows-worker", must be one of controller or worker`)
+}
+
+func TestReplaceBootstrapToken(t *testing.T) {
+	srv := httptest.NewTLSServer(nil)
+	defer srv.Close()
+	config := clientcmdapi.NewConfig()
+	config.Clusters["k0s"] = &clientcmdapi.Cluster{
+		Server:                   srv.URL,
+		CertificateAuthorityData: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}),
+	}
+	config.AuthInfos["kubelet-bootstrap"] = &clientcmdapi.AuthInfo{Token: "aaaaaa.aaaaaaaaaaaaaaaa"}
+	data, err := clientcmd.Write(*config)
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	_, err = gz.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	replaced, err := ReplaceBootstrapToken(base64.StdEncoding.EncodeToString(buf.Bytes()), "abcdef.0123456789abcdef")
+	require.NoError(t, err)
+	token, err := joincheck.DecodeToken(replaced)
+	require.NoError(t, err)
+	assert.Equal(t, srv.URL, token.Server)
+	assert.Len(t, token.CA, 1)
+	assert.Equal(t, "abcdef.0123456789abcdef", token.BearerToken)
+
+	_, err = ReplaceBootstrapToken(fmt.Sprintf("%x", "invalid"), "abcdef.0123456789abcdef")
+	assert.Error(t, err)
+}
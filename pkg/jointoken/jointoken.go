@@ -0,0 +1,120 @@
+// Package jointoken packs the address of the Admin Console and a short join token in a
+// single token, so a join command fits in a QR code field technicians scan from a tablet.
+// The token is scoped to the role of the node and expires. It carries a k0s bootstrap
+// token created with the same role and expiry, the joining node authenticates with it
+// instead of the token returned by the Admin Console, so the cluster refuses the node once
+// the token expired or if it joins with another role. The joining node checks the role
+// and the expiry as well, to fail early with a clear message.
+package jointoken
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// Prefix starts every token, it tells tokens apart from admin console addresses.
+const Prefix = "ecj1."
+
+// Roles are the roles a token can be scoped to.
+const (
+	RoleController = "controller"
+	RoleWorker     = "worker"
+)
+
+// Token is the content of a join token.
+type Token struct {
+	// URL is the address (host:port) of the Admin Console.
+	URL string `json:"u"`
+	// Token is the short join token issued by the Admin Console.
+	Token string `json:"t"`
+	// Role is the role of the nodes joining with the token.
+	Role string `json:"r"`
+	// ExpiresAt is when the token expires, in seconds since the epoch.
+	ExpiresAt int64 `json:"e"`
+	// BootstrapToken is the k0s bootstrap token, in the id.secret form, the node joins
+	// the cluster with. It expires with the token and is scoped to its role.
+	BootstrapToken string `json:"b"`
+}
+
+// New returns a token for the role valid for ttl from now.
+func New(url, token, role string, ttl time.Duration, now time.Time) (*Token, error) {
+	if role != RoleController && role != RoleWorker {
+		return nil, fmt.Errorf("invalid role %q, must be one of %s or %s", role, RoleController, RoleWorker)
+	}
+	if url == "" || token == "" {
+		return nil, fmt.Errorf("the admin console address and the join token are required")
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("the expiry must be positive")
+	}
+	return &Token{URL: url, Token: token, Role: role, ExpiresAt: now.Add(ttl).Unix()}, nil
+}
+
+// Expiry returns when the token expires.
+func (t *Token) Expiry() time.Time {
+	return time.Unix(t.ExpiresAt, 0)
+}
+
+// Encode returns the token as a string.
+func (t *Token) Encode() (string, error) {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal token: %w", err)
+	}
+	return Prefix + base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// IsToken returns true if the string is an encoded token.
+func IsToken(s string) bool {
+	return strings.HasPrefix(s, Prefix)
+}
+
+// Decode parses an encoded token and makes sure it has not expired.
+func Decode(s string, now time.Time) (*Token, error) {
+	if !IsToken(s) {
+		return nil, fmt.Errorf("not a join token")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(s, Prefix))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode token: %w", err)
+	}
+	var t Token
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal token: %w", err)
+	}
+	if t.URL == "" || t.Token == "" || t.BootstrapToken == "" || (t.Role != RoleController && t.Role != RoleWorker) {
+		return nil, fmt.Errorf("incomplete token")
+	}
+	if !now.Before(t.Expiry()) {
+		return nil, fmt.Errorf("the join token expired at %s, generate a new one", t.Expiry().UTC().Format(time.RFC3339))
+	}
+	return &t, nil
+}
+
+// CheckRole makes sure a node joining as a controller, or as a worker when controller
+// is false, can use the token.
+func (t *Token) CheckRole(controller bool) error {
+	role := RoleWorker
+	if controller {
+		role = RoleController
+	}
+	if role != t.Role {
+		return fmt.Errorf("the join token is scoped to %s nodes but the join command joins a %s", t.Role, role)
+	}
+	return nil
+}
+
+// QRCode renders the content as a QR code printable on a terminal, two modules per
+// character.
+func QRCode(content string) (string, error) {
+	code, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return "", fmt.Errorf("unable to create qr code: %w", err)
+	}
+	return code.ToSmallString(false), nil
+}
@@ -0,0 +1,57 @@
+package jointoken
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	tok, err := New("10.0.0.1:30000", "abcdef", RoleWorker, time.Hour, now)
+	require.NoError(t, err)
+	tok.BootstrapToken = "abcdef.0123456789abcdef"
+	encoded, err := tok.Encode()
+	require.NoError(t, err)
+	assert.True(t, IsToken(encoded))
+	assert.False(t, IsToken("10.0.0.1:30000"))
+
+	decoded, err := Decode(encoded, now.Add(59*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, tok, decoded)
+	assert.NoError(t, decoded.CheckRole(false))
+	assert.EqualError(t, decoded.CheckRole(true), "the join token is scoped to worker nodes but the join command joins a controller")
+
+	_, err = Decode(encoded, now.Add(time.Hour))
+	assert.EqualError(t, err, "the join token expired at 2024-10-01T13:00:00Z, generate a new one")
+
+	_, err = Decode(Prefix+"e30", now)
+	assert.EqualError(t, err, "incomplete token")
+	tok.BootstrapToken = ""
+	encoded, err = tok.Encode()
+	require.NoError(t, err)
+	_, err = Decode(encoded, now)
+	assert.EqualError(t, err, "incomplete token", "the cluster can only enforce the scope of tokens with a bootstrap token")
+	_, err = Decode("abcdef", now)
+	assert.EqualError(t, err, "not a join token")
+}
+
+func TestNew(t *testing.T) {
+	now := time.Now()
+	_, err := New("10.0.0.1:30000", "abcdef", "windows-worker", time.Hour, now)
+	assert.EqualError(t, err, `invalid role "windows-worker", must be one of controller or worker`)
+	_, err = New("", "abcdef", RoleController, time.Hour, now)
+	assert.EqualError(t, err, "the admin console address and the join token are required")
+	_, err = New("10.0.0.1:30000", "abcdef", RoleController, 0, now)
+	assert.EqualError(t, err, "the expiry must be positive")
+}
+
+func TestQRCode(t *testing.T) {
+	code, err := QRCode("sudo ./my-app join ecj1.abcdef")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(code), "\n")
+	assert.Greater(t, len(lines), 10)
+}
@@ -0,0 +1,397 @@
+// Package k0sready waits for the k0s services started on the node to become ready. On
+// slow disks etcd and the api server can take minutes to start, readiness is polled with
+// an exponential backoff up to a configurable ceiling and the service journal is
+// included in the error if the node never becomes ready. A node is ready once k0s reports
+// its worker connected to the api server, etcd and the api server are ready on
+// controllers, and the node itself is Ready.
+package k0sready
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+)
+
+const (
+	// DefaultTimeout is the default time to wait for the node to become ready.
+	DefaultTimeout = 5 * time.Minute
+	// etcdHealthURL is the health endpoint of the local etcd member.
+	etcdHealthURL = "https://127.0.0.1:2379/health"
+	// etcdLocalHealthURL is the health endpoint of the local etcd member answered without
+	// the quorum, it only tells the member itself is serving.
+	etcdLocalHealthURL = etcdHealthURL + "?serializable=true"
+	// kubeletHealthzURL is the health endpoint of the kubelet, only bound to localhost.
+	kubeletHealthzURL = "http://127.0.0.1:10248/healthz"
+	// pkiDir is the directory holding the k0s certificates.
+	pkiDir = "/var/lib/k0s/pki"
+	// journalLines is the number of journal lines included in the diagnosis.
+	journalLines = 30
+	// kubeletKubeconfig is the kubeconfig of the kubelet. Both roles have it and it can
+	// read the node object.
+	kubeletKubeconfig = "/var/lib/k0s/kubelet.conf"
+)
+
+// Check is a readiness check of the node.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Backoff is the exponential backoff between readiness polls.
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+// DefaultBackoff starts polling every second, doubling the interval up to 15 seconds.
+var DefaultBackoff = Backoff{Initial: time.Second, Max: 15 * time.Second}
+
+// Error is returned when the node does not become ready in time.
+type Error struct {
+	Check   string
+	Err     error
+	Timeout time.Duration
+	Unit    string
+	Journal string
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("node not ready after %s, %s check failed: %v", e.Timeout, e.Check, e.Err)
+	if e.Journal != "" {
+		msg = fmt.Sprintf("%s\n\nLast log lines of the %s service:\n%s", msg, e.Unit, e.Journal)
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Checks returns the readiness checks for the node. Controllers also check the health of
+// etcd and the api server. The Ready condition of the node is checked last.
+func Checks(controller bool) []Check {
+	checks := []Check{
+		{Name: "k0s status socket", Run: checkStatusSocket},
+		{Name: "k0s status", Run: checkStatus},
+	}
+	if controller {
+		checks = append(checks,
+			Check{Name: "etcd health", Run: checkEtcdHealth},
+			Check{Name: "api server readiness", Run: checkAPIServerReadiness},
+		)
+	}
+	return append(checks, Check{Name: "node ready", Run: checkNodeReady})
+}
+
+// LocalChecks returns the checks of the processes of the node alone: k0s, the kubelet
+// and, on controllers, the local etcd member. None of them goes through the api server or
+// needs the etcd quorum, they tell a node that is wedged apart from an outage of the
+// cluster that restarting the node would not fix.
+func LocalChecks(controller bool) []Check {
+	checks := []Check{
+		{Name: "k0s status socket", Run: checkStatusSocket},
+		{Name: "k0s process", Run: checkProcess},
+		{Name: "kubelet health", Run: checkKubeletHealth},
+	}
+	if controller {
+		checks = append(checks, Check{Name: "local etcd health", Run: checkLocalEtcdHealth})
+	}
+	return checks
+}
+
+// Unit returns the name of the systemd unit running k0s on the node.
+func Unit(controller bool) string {
+	if controller {
+		return "k0scontroller"
+	}
+	return "k0sworker"
+}
+
+// Wait waits for the k0s services on the node to become ready, up to the provided
+// timeout.
+func Wait(ctx context.Context, controller bool, timeout time.Duration) error {
+	err := Poll(ctx, Checks(controller), DefaultBackoff, timeout)
+	var rerr *Error
+	if errors.As(err, &rerr) {
+		rerr.Unit = Unit(controller)
+		rerr.Journal = Journal(rerr.Unit)
+	}
+	return err
+}
+
+// Ready runs the checks of the node once and returns the error of the first one failing.
+func Ready(ctx context.Context, controller bool) error {
+	if failed, err := runChecks(ctx, Checks(controller)); err != nil {
+		return fmt.Errorf("%s check failed: %w", failed, err)
+	}
+	return nil
+}
+
+// LocalReady runs the local checks of the node once and returns the error of the first
+// one failing.
+func LocalReady(ctx context.Context, controller bool) error {
+	if failed, err := runChecks(ctx, LocalChecks(controller)); err != nil {
+		return fmt.Errorf("%s check failed: %w", failed, err)
+	}
+	return nil
+}
+
+// Poll runs the checks, in order, until all of them succeed. Polls are spaced with an
+// exponential backoff. Returns an *Error holding the last failed check once the timeout
+// is reached.
+func Poll(ctx context.Context, checks []Check, backoff Backoff, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	interval := backoff.Initial
+	for {
+		failed, err := runChecks(ctx, checks)
+		if err == nil {
+			return nil
+		}
+		logrus.Debugf("node not ready yet, %s check failed: %v", failed, err)
+		select {
+		case <-ctx.Done():
+			return &Error{Check: failed, Err: err, Timeout: timeout}
+		case <-time.After(interval):
+		}
+		interval *= 2
+		if interval > backoff.Max {
+			interval = backoff.Max
+		}
+	}
+}
+
+// runChecks runs the checks in order and returns the name and error of the first one
+// failing.
+func runChecks(ctx context.Context, checks []Check) (string, error) {
+	for _, check := range checks {
+		if err := check.Run(ctx); err != nil {
+			return check.Name, err
+		}
+	}
+	return "", nil
+}
+
+// Journal returns the last lines logged by the provided systemd unit. Returns an empty
+// string if the journal can't be read.
+func Journal(unit string) string {
+	out, err := helpers.RunCommand("journalctl", "-u", unit, "-n", fmt.Sprint(journalLines), "--no-pager")
+	if err != nil {
+		logrus.Debugf("unable to read the %s journal: %v", unit, err)
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
+
+func checkStatusSocket(_ context.Context) error {
+	if _, err := os.Stat(defaults.PathToK0sStatusSocket()); err != nil {
+		return fmt.Errorf("status socket not found: %w", err)
+	}
+	return nil
+}
+
+func checkStatus(ctx context.Context) error {
+	out, err := helpers.RunCommandContext(ctx, defaults.K0sBinaryPath(), "status", "-o", "json")
+	if err != nil {
+		return fmt.Errorf("unable to get status: %w", err)
+	}
+	return parseStatus([]byte(out))
+}
+
+// checkProcess checks k0s answers on its status socket, whatever the state of its
+// connection to the api server.
+func checkProcess(ctx context.Context) error {
+	out, err := helpers.RunCommandContext(ctx, defaults.K0sBinaryPath(), "status", "-o", "json")
+	if err != nil {
+		return fmt.Errorf("unable to get status: %w", err)
+	}
+	var status struct {
+		Role string
+	}
+	if err := json.Unmarshal([]byte(out), &status); err != nil {
+		return fmt.Errorf("unable to parse status: %w", err)
+	}
+	if status.Role == "" {
+		return fmt.Errorf("no role in status")
+	}
+	return nil
+}
+
+func checkKubeletHealth(ctx context.Context) error {
+	client := &http.Client{Timeout: 5 * time.Second}
+	_, err := get(ctx, client, kubeletHealthzURL)
+	return err
+}
+
+// parseStatus parses the output of k0s status. Nodes running workloads must have their
+// worker connected to the api server.
+func parseStatus(body []byte) error {
+	var status struct {
+		Role                        string
+		Workloads                   bool
+		WorkerToAPIConnectionStatus struct {
+			Message string
+			Success bool
+		}
+	}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return fmt.Errorf("unable to parse status: %w", err)
+	}
+	if status.Role == "" {
+		return fmt.Errorf("no role in status")
+	}
+	if status.Workloads && !status.WorkerToAPIConnectionStatus.Success {
+		msg := status.WorkerToAPIConnectionStatus.Message
+		if msg == "" {
+			msg = "not probed yet"
+		}
+		return fmt.Errorf("worker not connected to the api server: %s", msg)
+	}
+	return nil
+}
+
+func checkEtcdHealth(ctx context.Context) error {
+	return etcdHealth(ctx, etcdHealthURL)
+}
+
+func checkLocalEtcdHealth(ctx context.Context) error {
+	return etcdHealth(ctx, etcdLocalHealthURL)
+}
+
+// etcdHealth gets the health of the local etcd member from the provided endpoint.
+func etcdHealth(ctx context.Context, url string) error {
+	cert, err := tls.LoadX509KeyPair(
+		filepath.Join(pkiDir, "apiserver-etcd-client.crt"),
+		filepath.Join(pkiDir, "apiserver-etcd-client.key"),
+	)
+	if err != nil {
+		return fmt.Errorf("unable to load etcd client certificate: %w", err)
+	}
+	ca, err := os.ReadFile(filepath.Join(pkiDir, "etcd", "ca.crt"))
+	if err != nil {
+		return fmt.Errorf("unable to read etcd ca: %w", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				Certificates: []tls.Certificate{cert},
+				RootCAs:      pool,
+				MinVersion:   tls.VersionTLS12,
+			},
+		},
+	}
+	body, err := get(ctx, client, url)
+	if err != nil {
+		return err
+	}
+	return parseEtcdHealth(body)
+}
+
+// parseEtcdHealth parses the response of the etcd health endpoint.
+func parseEtcdHealth(body []byte) error {
+	var health struct {
+		Health string `json:"health"`
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(body, &health); err != nil {
+		return fmt.Errorf("unable to parse etcd health: %w", err)
+	}
+	if health.Health != "true" {
+		return fmt.Errorf("etcd is not healthy: %s", health.Reason)
+	}
+	return nil
+}
+
+func checkAPIServerReadiness(ctx context.Context) error {
+	cfg, err := clientcmd.BuildConfigFromFlags("", defaults.PathToKubeConfig())
+	if err != nil {
+		return fmt.Errorf("unable to read kubeconfig: %w", err)
+	}
+	cfg.Timeout = 5 * time.Second
+	client, err := rest.HTTPClientFor(cfg)
+	if err != nil {
+		return fmt.Errorf("unable to create http client: %w", err)
+	}
+	_, err = get(ctx, client, strings.TrimSuffix(cfg.Host, "/")+"/readyz")
+	return err
+}
+
+func checkNodeReady(ctx context.Context) error {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("unable to get hostname: %w", err)
+	}
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeletKubeconfig)
+	if err != nil {
+		return fmt.Errorf("unable to read kubelet kubeconfig: %w", err)
+	}
+	cfg.Timeout = 5 * time.Second
+	client, err := rest.HTTPClientFor(cfg)
+	if err != nil {
+		return fmt.Errorf("unable to create http client: %w", err)
+	}
+	body, err := get(ctx, client, strings.TrimSuffix(cfg.Host, "/")+"/api/v1/nodes/"+strings.ToLower(hostname))
+	if err != nil {
+		return err
+	}
+	return parseNodeReady(body)
+}
+
+// parseNodeReady parses the node object and fails unless its Ready condition is true.
+func parseNodeReady(body []byte) error {
+	var node corev1.Node
+	if err := json.Unmarshal(body, &node); err != nil {
+		return fmt.Errorf("unable to parse node: %w", err)
+	}
+	for _, cond := range node.Status.Conditions {
+		if cond.Type != corev1.NodeReady {
+			continue
+		}
+		if cond.Status != corev1.ConditionTrue {
+			return fmt.Errorf("node %s not ready: %s", node.Name, cond.Message)
+		}
+		return nil
+	}
+	return fmt.Errorf("node %s has no ready condition yet", node.Name)
+}
+
+// get returns the body of the provided url, failing if the status is not 200.
+func get(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d from %s: %s", resp.StatusCode, url, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
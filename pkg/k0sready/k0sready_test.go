@@ -0,0 +1,92 @@
+package k0sready
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testBackoff = Backoff{Initial: time.Millisecond, Max: 4 * time.Millisecond}
+
+func TestPoll(t *testing.T) {
+	attempts := 0
+	checks := []Check{
+		{Name: "first", Run: func(context.Context) error { return nil }},
+		{Name: "second", Run: func(context.Context) error {
+			attempts++
+			if attempts < 3 {
+				return errors.New("not yet")
+			}
+			return nil
+		}},
+	}
+	require.NoError(t, Poll(context.Background(), checks, testBackoff, time.Second))
+	assert.Equal(t, 3, attempts)
+}
+
+func TestPollTimeout(t *testing.T) {
+	checks := []Check{
+		{Name: "socket", Run: func(context.Context) error { return nil }},
+		{Name: "etcd health", Run: func(context.Context) error { return errors.New("connection refused") }},
+		{Name: "never", Run: func(context.Context) error {
+			t.Fatal("checks after a failing one must not run")
+			return nil
+		}},
+	}
+	err := Poll(context.Background(), checks, testBackoff, 20*time.Millisecond)
+	var rerr *Error
+	require.ErrorAs(t, err, &rerr)
+	assert.Equal(t, "etcd health", rerr.Check)
+	assert.EqualError(t, rerr.Err, "connection refused")
+}
+
+func TestErrorMessage(t *testing.T) {
+	err := &Error{Check: "api server readiness", Err: errors.New("timeout"), Timeout: 5 * time.Minute}
+	assert.Equal(t, "node not ready after 5m0s, api server readiness check failed: timeout", err.Error())
+
+	err.Unit = "k0scontroller"
+	err.Journal = "etcd: slow fdatasync"
+	assert.Contains(t, err.Error(), "Last log lines of the k0scontroller service:\netcd: slow fdatasync")
+}
+
+func TestChecks(t *testing.T) {
+	names := func(checks []Check) []string {
+		var names []string
+		for _, check := range checks {
+			names = append(names, check.Name)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"k0s status socket", "k0s status", "node ready"}, names(Checks(false)))
+	assert.Equal(t, []string{"k0s status socket", "k0s status", "etcd health", "api server readiness", "node ready"}, names(Checks(true)))
+
+	assert.Equal(t, []string{"k0s status socket", "k0s process", "kubelet health"}, names(LocalChecks(false)))
+	assert.Equal(t, []string{"k0s status socket", "k0s process", "kubelet health", "local etcd health"}, names(LocalChecks(true)))
+}
+
+func TestParseEtcdHealth(t *testing.T) {
+	assert.NoError(t, parseEtcdHealth([]byte(`{"health":"true","reason":""}`)))
+	assert.EqualError(t, parseEtcdHealth([]byte(`{"health":"false","reason":"RAFT NO LEADER"}`)), "etcd is not healthy: RAFT NO LEADER")
+	assert.Error(t, parseEtcdHealth([]byte(`not json`)))
+}
+
+func TestParseStatus(t *testing.T) {
+	assert.NoError(t, parseStatus([]byte(`{"Role":"controller","Workloads":false}`)))
+	assert.NoError(t, parseStatus([]byte(`{"Role":"controller+worker","Workloads":true,"WorkerToAPIConnectionStatus":{"Success":true}}`)))
+	assert.EqualError(t, parseStatus([]byte(`{"Role":"worker","Workloads":true,"WorkerToAPIConnectionStatus":{"Message":"connection refused"}}`)),
+		"worker not connected to the api server: connection refused")
+	assert.EqualError(t, parseStatus([]byte(`{"Role":"worker","Workloads":true}`)), "worker not connected to the api server: not probed yet")
+	assert.EqualError(t, parseStatus([]byte(`{}`)), "no role in status")
+	assert.Error(t, parseStatus([]byte(`Version: v1.29`)))
+}
+
+func TestParseNodeReady(t *testing.T) {
+	assert.NoError(t, parseNodeReady([]byte(`{"metadata":{"name":"node-1"},"status":{"conditions":[{"type":"MemoryPressure","status":"False"},{"type":"Ready","status":"True"}]}}`)))
+	assert.EqualError(t, parseNodeReady([]byte(`{"metadata":{"name":"node-1"},"status":{"conditions":[{"type":"Ready","status":"False","message":"container runtime network not ready"}]}}`)),
+		"node node-1 not ready: container runtime network not ready")
+	assert.EqualError(t, parseNodeReady([]byte(`{"metadata":{"name":"node-1"}}`)), "node node-1 has no ready condition yet")
+}
@@ -1,6 +1,8 @@
 package kotscli
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"regexp"
@@ -24,7 +26,9 @@ type InstallOptions struct {
 	AirgapBundle string
 }
 
-func Install(opts InstallOptions, msg *spinner.MessageWriter) error {
+// Install installs the application with kots, the install is stopped when the context is
+// done.
+func Install(ctx context.Context, opts InstallOptions, msg *spinner.MessageWriter) error {
 	kotsBinPath, err := goods.MaterializeInternalBinary("kubectl-kots")
 	if err != nil {
 		return fmt.Errorf("unable to materialize kubectl-kots binary: %w", err)
@@ -74,6 +78,7 @@ func Install(opts InstallOptions, msg *spinner.MessageWriter) error {
 		Env: map[string]string{
 			"EMBEDDED_CLUSTER_ID": metrics.ClusterID().String(),
 		},
+		Context: ctx,
 	}
 	if err := helpers.RunCommandWithOptions(runCommandOptions, kotsBinPath, installArgs...); err != nil {
 		return fmt.Errorf("unable to install the application: %w", err)
@@ -82,6 +87,39 @@ func Install(opts InstallOptions, msg *spinner.MessageWriter) error {
 	return nil
 }
 
+// AppInstalled returns true if the application is installed in the admin console running
+// in the namespace.
+func AppInstalled(ctx context.Context, appSlug string, namespace string) (bool, error) {
+	kotsBinPath, err := goods.MaterializeInternalBinary("kubectl-kots")
+	if err != nil {
+		return false, fmt.Errorf("unable to materialize kubectl-kots binary: %w", err)
+	}
+	defer os.Remove(kotsBinPath)
+
+	out, err := helpers.RunCommandContext(ctx, kotsBinPath, "get", "apps", "--namespace", namespace, "--output", "json")
+	if err != nil {
+		return false, fmt.Errorf("unable to list the applications: %w", err)
+	}
+	return parseAppInstalled(out, appSlug)
+}
+
+// parseAppInstalled returns true if the application is in the json list of applications
+// printed by kots.
+func parseAppInstalled(out string, appSlug string) (bool, error) {
+	var apps []struct {
+		Slug string `json:"slug"`
+	}
+	if err := json.Unmarshal([]byte(out), &apps); err != nil {
+		return false, fmt.Errorf("unable to parse the applications: %w", err)
+	}
+	for _, app := range apps {
+		if app.Slug == appSlug {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 type AirgapUpdateOptions struct {
 	AppSlug      string
 	Namespace    string
@@ -173,6 +211,39 @@ func VeleroConfigureOtherS3(opts VeleroConfigureOtherS3Options) error {
 	return nil
 }
 
+type BackupOptions struct {
+	Namespace string
+}
+
+// Backup creates a backup of the cluster and the application with Velero and waits for
+// it to complete.
+func Backup(ctx context.Context, opts BackupOptions) error {
+	kotsBinPath, err := goods.MaterializeInternalBinary("kubectl-kots")
+	if err != nil {
+		return fmt.Errorf("unable to materialize kubectl-kots binary: %w", err)
+	}
+	defer os.Remove(kotsBinPath)
+
+	backupArgs := []string{
+		"backup",
+		"--namespace",
+		opts.Namespace,
+		"--wait",
+	}
+
+	loading := spinner.Start()
+	loading.Infof("Creating backup")
+
+	runCommandOptions := helpers.RunCommandOptions{Context: ctx}
+	if err := helpers.RunCommandWithOptions(runCommandOptions, kotsBinPath, backupArgs...); err != nil {
+		loading.CloseWithError()
+		return fmt.Errorf("unable to create backup: %w", err)
+	}
+
+	loading.Closef("Backup created!")
+	return nil
+}
+
 // MaskKotsOutputForOnline masks the kots cli output during online installations. For
 // online installations we only want to print "Finalizing Admin Console" until it is done
 // and then print "Finished!".
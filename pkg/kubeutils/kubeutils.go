@@ -50,11 +50,7 @@ func WaitForNamespace(ctx context.Context, cli client.Client, ns string) error {
 			return ready, nil
 		},
 	); err != nil {
-		if lasterr != nil {
-			return fmt.Errorf("timed out waiting for namespace %s: %v", ns, lasterr)
-		} else {
-			return fmt.Errorf("timed out waiting for namespace %s", ns)
-		}
+		return WaitError(ctx, fmt.Sprintf("namespace %s", ns), err, lasterr)
 	}
 	return nil
 }
@@ -73,11 +69,7 @@ func WaitForDeployment(ctx context.Context, cli client.Client, ns, name string)
 			return ready, nil
 		},
 	); err != nil {
-		if lasterr != nil {
-			return fmt.Errorf("timed out waiting for %s to deploy: %v", name, lasterr)
-		} else {
-			return fmt.Errorf("timed out waiting for %s to deploy", name)
-		}
+		return WaitError(ctx, fmt.Sprintf("%s to deploy", name), err, lasterr)
 	}
 	return nil
 }
@@ -96,11 +88,7 @@ func WaitForDaemonset(ctx context.Context, cli client.Client, ns, name string) e
 			return ready, nil
 		},
 	); err != nil {
-		if lasterr != nil {
-			return fmt.Errorf("timed out waiting for %s to deploy: %v", name, lasterr)
-		} else {
-			return fmt.Errorf("timed out waiting for %s to deploy", name)
-		}
+		return WaitError(ctx, fmt.Sprintf("%s to deploy", name), err, lasterr)
 	}
 	return nil
 }
@@ -119,11 +107,7 @@ func WaitForService(ctx context.Context, cli client.Client, ns, name string) err
 			return svc.Spec.ClusterIP != "", nil
 		},
 	); err != nil {
-		if lasterr != nil {
-			return fmt.Errorf("timed out waiting for service %s to have an IP: %v", name, lasterr)
-		} else {
-			return fmt.Errorf("timed out waiting for service %s to have an IP", name)
-		}
+		return WaitError(ctx, fmt.Sprintf("service %s to have an IP", name), err, lasterr)
 	}
 	return nil
 }
@@ -161,14 +145,7 @@ func WaitForInstallation(ctx context.Context, cli client.Client, writer *spinner
 			return false, nil
 		},
 	); err != nil {
-		if wait.Interrupted(err) {
-			if lasterr != nil {
-				return fmt.Errorf("timed out waiting for the installation to finish: %v", lasterr)
-			} else {
-				return fmt.Errorf("timed out waiting for the installation to finish")
-			}
-		}
-		return fmt.Errorf("error waiting for installation: %v", err)
+		return WaitError(ctx, "the installation to finish", err, lasterr)
 	}
 	return nil
 }
@@ -230,19 +207,18 @@ func writeStatusMessage(writer *spinner.MessageWriter, install *embeddedclusterv
 
 func WaitForHAInstallation(ctx context.Context, cli client.Client) error {
 	for {
+		lastInstall, err := GetLatestInstallation(ctx, cli)
+		if err != nil {
+			return fmt.Errorf("unable to get latest installation: %v", err)
+		}
+		haStatus := CheckConditionStatus(lastInstall.Status, "HighAvailability")
+		if haStatus == metav1.ConditionTrue {
+			return nil
+		}
 		select {
 		case <-ctx.Done():
-			return fmt.Errorf("context cancelled")
-		default:
-			lastInstall, err := GetLatestInstallation(ctx, cli)
-			if err != nil {
-				return fmt.Errorf("unable to get latest installation: %v", err)
-			}
-			haStatus := CheckConditionStatus(lastInstall.Status, "HighAvailability")
-			if haStatus == metav1.ConditionTrue {
-				return nil
-			}
-			time.Sleep(5 * time.Second)
+			return WaitError(ctx, "high availability", ctx.Err(), nil)
+		case <-time.After(5 * time.Second):
 		}
 	}
 }
@@ -278,11 +254,7 @@ func WaitForNodes(ctx context.Context, cli client.Client) error {
 			return readynodes == len(nodes.Items), nil
 		},
 	); err != nil {
-		if lasterr != nil {
-			return fmt.Errorf("timed out waiting for nodes to be ready: %v", lasterr)
-		} else {
-			return fmt.Errorf("timed out waiting for nodes to be ready")
-		}
+		return WaitError(ctx, "nodes to be ready", err, lasterr)
 	}
 	return nil
 }
@@ -309,11 +281,7 @@ func WaitForControllerNode(ctx context.Context, kcli client.Client, name string)
 			return false, nil
 		},
 	); err != nil {
-		if lasterr != nil {
-			return fmt.Errorf("timed out waiting for node %s: %w", name, lasterr)
-		} else {
-			return fmt.Errorf("timed out waiting for node %s", name)
-		}
+		return WaitError(ctx, fmt.Sprintf("node %s", name), err, lasterr)
 	}
 	return nil
 }
@@ -332,11 +300,7 @@ func WaitForJob(ctx context.Context, cli client.Client, ns, name string, maxStep
 			return ready, nil
 		},
 	); err != nil {
-		if lasterr != nil {
-			return fmt.Errorf("timed out waiting for job %s: %w", name, lasterr)
-		} else {
-			return fmt.Errorf("timed out waiting for job %s", name)
-		}
+		return WaitError(ctx, fmt.Sprintf("job %s", name), err, lasterr)
 	}
 	return nil
 }
@@ -0,0 +1,141 @@
+package kubeutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultRetryBackoff is the backoff used when retrying operations against the kubernetes
+// api. It covers around a minute of control plane churn, enough for the api server to
+// restart or for a webhook to become ready.
+var DefaultRetryBackoff = wait.Backoff{Steps: 7, Duration: time.Second, Factor: 2.0, Jitter: 0.1, Cap: 15 * time.Second}
+
+// IsTransientError returns true if the error is likely to go away by itself, as happens
+// when the api server restarts, is overloaded or when the webhook handling the request is
+// not ready yet. Errors caused by the request itself, like validation or conflicts, are
+// not transient.
+func IsTransientError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	switch {
+	case k8serrors.IsServerTimeout(err),
+		k8serrors.IsTimeout(err),
+		k8serrors.IsTooManyRequests(err),
+		k8serrors.IsServiceUnavailable(err),
+		k8serrors.IsInternalError(err),
+		k8serrors.IsUnexpectedServerError(err),
+		meta.IsNoMatchError(err),
+		utilnet.IsConnectionRefused(err),
+		utilnet.IsConnectionReset(err),
+		utilnet.IsProbableEOF(err):
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// Retry runs fn until it succeeds, returns an error that is not transient, the backoff is
+// exhausted or the context is done. The returned error holds the distinct errors seen
+// along the attempts so the reason of each failure is visible.
+func Retry(ctx context.Context, backoff wait.Backoff, fn func(ctx context.Context) error) error {
+	var errs []error
+	seen := map[string]bool{}
+	attempts := 0
+	err := wait.ExponentialBackoffWithContext(ctx, backoff, func(ctx context.Context) (bool, error) {
+		attempts++
+		err := fn(ctx)
+		if err == nil {
+			return true, nil
+		}
+		if !seen[err.Error()] {
+			seen[err.Error()] = true
+			errs = append(errs, err)
+		}
+		if !IsTransientError(err) {
+			return false, err
+		}
+		return false, nil
+	})
+	if err == nil {
+		return nil
+	}
+	if len(errs) == 0 {
+		return err
+	}
+	if !wait.Interrupted(err) {
+		// the last attempt failed with an error that is not transient.
+		if attempts == 1 {
+			return err
+		}
+		return fmt.Errorf("failed after %d attempts: %w", attempts, utilerrors.NewAggregate(errs))
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("cancelled after %d attempts: %w", attempts, utilerrors.NewAggregate(append(errs, ctxErr)))
+	}
+	return fmt.Errorf("failed after %d attempts: %w", attempts, utilerrors.NewAggregate(errs))
+}
+
+// CreateWithRetry creates the object, retrying on transient errors. If an attempt fails
+// after reaching the api server the object may exist already, the object existing is then
+// not reported as an error.
+func CreateWithRetry(ctx context.Context, cli client.Client, obj client.Object) error {
+	attempted := false
+	return Retry(ctx, DefaultRetryBackoff, func(ctx context.Context) error {
+		// a failed attempt may have set the resource version, creates must not have one.
+		obj.SetResourceVersion("")
+		err := cli.Create(ctx, obj)
+		if attempted && k8serrors.IsAlreadyExists(err) {
+			return nil
+		}
+		attempted = true
+		return err
+	})
+}
+
+// CreateOrUpdateWithRetry creates the object or replaces the existing one with it,
+// retrying on transient errors. Objects created this way can be created again, as happens
+// when an installation is run again over the objects of a previous run.
+func CreateOrUpdateWithRetry(ctx context.Context, cli client.Client, obj client.Object) error {
+	return Retry(ctx, DefaultRetryBackoff, func(ctx context.Context) error {
+		obj.SetResourceVersion("")
+		err := cli.Create(ctx, obj)
+		if !k8serrors.IsAlreadyExists(err) {
+			return err
+		}
+		existing := obj.DeepCopyObject().(client.Object)
+		if err := cli.Get(ctx, client.ObjectKeyFromObject(obj), existing); err != nil {
+			return err
+		}
+		obj.SetResourceVersion(existing.GetResourceVersion())
+		return cli.Update(ctx, obj)
+	})
+}
+
+// WaitError returns the error of a wait that did not succeed, lasterr is the last error
+// seen while waiting. The context being done is reported as such instead of as a timeout.
+func WaitError(ctx context.Context, what string, err, lasterr error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		if lasterr != nil {
+			return fmt.Errorf("cancelled waiting for %s: %w: %w", what, ctxErr, lasterr)
+		}
+		return fmt.Errorf("cancelled waiting for %s: %w", what, ctxErr)
+	}
+	if !wait.Interrupted(err) {
+		return fmt.Errorf("error waiting for %s: %w", what, err)
+	}
+	if lasterr != nil {
+		return fmt.Errorf("timed out waiting for %s: %w", what, lasterr)
+	}
+	return fmt.Errorf("timed out waiting for %s", what)
+}
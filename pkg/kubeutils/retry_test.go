@@ -0,0 +1,146 @@
+package kubeutils
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+var testBackoff = wait.Backoff{Steps: 3, Duration: time.Millisecond, Factor: 1.0}
+
+func TestIsTransientError(t *testing.T) {
+	secrets := schema.GroupResource{Resource: "secrets"}
+	for name, tt := range map[string]struct {
+		err  error
+		want bool
+	}{
+		"nil":                {err: nil, want: false},
+		"connection refused": {err: fmt.Errorf("dial tcp: %w", syscall.ECONNREFUSED), want: true},
+		"webhook not ready":  {err: k8serrors.NewInternalError(fmt.Errorf("failed calling webhook")), want: true},
+		"service unavailable": {
+			err:  k8serrors.NewServiceUnavailable("the server is currently unable to handle the request"),
+			want: true,
+		},
+		"too many requests": {err: k8serrors.NewTooManyRequests("slow down", 1), want: true},
+		"already exists":    {err: k8serrors.NewAlreadyExists(secrets, "foo"), want: false},
+		"invalid":           {err: k8serrors.NewBadRequest("invalid"), want: false},
+		"context canceled":  {err: context.Canceled, want: false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsTransientError(tt.err))
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	transient := k8serrors.NewServiceUnavailable("unavailable")
+
+	attempts := 0
+	err := Retry(context.Background(), testBackoff, func(ctx context.Context) error {
+		if attempts++; attempts < 3 {
+			return transient
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+
+	// errors that are not transient are returned as they are.
+	attempts = 0
+	permanent := k8serrors.NewBadRequest("invalid")
+	err = Retry(context.Background(), testBackoff, func(ctx context.Context) error {
+		attempts++
+		return permanent
+	})
+	assert.Equal(t, permanent, err)
+	assert.Equal(t, 1, attempts)
+
+	// the distinct errors of all attempts are reported once the backoff is exhausted.
+	attempts = 0
+	err = Retry(context.Background(), testBackoff, func(ctx context.Context) error {
+		if attempts++; attempts == 1 {
+			return fmt.Errorf("dial tcp: %w", syscall.ECONNREFUSED)
+		}
+		return transient
+	})
+	require.Error(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.ErrorIs(t, err, syscall.ECONNREFUSED)
+	assert.ErrorIs(t, err, transient)
+	assert.Contains(t, err.Error(), "failed after 3 attempts")
+
+	// cancelling the context stops the retries.
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts = 0
+	err = Retry(ctx, wait.Backoff{Steps: 100, Duration: time.Millisecond, Factor: 1.0}, func(ctx context.Context) error {
+		attempts++
+		cancel()
+		return transient
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestCreateWithRetry(t *testing.T) {
+	secret := func() *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "bar"}}
+	}
+
+	// the first attempt creates the object but the response is lost, the object existing
+	// on the second attempt is not an error.
+	attempts := 0
+	cli := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Create: func(ctx context.Context, cli client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				attempts++
+				if err := cli.Create(ctx, obj, opts...); err != nil {
+					return err
+				}
+				if attempts == 1 {
+					return fmt.Errorf("read tcp: %w", syscall.ECONNRESET)
+				}
+				return nil
+			},
+		}).
+		Build()
+	require.NoError(t, CreateWithRetry(context.Background(), cli, secret()))
+	assert.Equal(t, 2, attempts)
+
+	// the object existing before the first attempt is still an error.
+	cli = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(secret()).Build()
+	err := CreateWithRetry(context.Background(), cli, secret())
+	assert.True(t, k8serrors.IsAlreadyExists(err))
+}
+
+func TestCreateOrUpdateWithRetry(t *testing.T) {
+	secret := func(value string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "bar"},
+			Data:       map[string][]byte{"key": []byte(value)},
+		}
+	}
+	ctx := context.Background()
+	cli := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	require.NoError(t, CreateOrUpdateWithRetry(ctx, cli, secret("first")))
+
+	// the existing object is replaced.
+	require.NoError(t, CreateOrUpdateWithRetry(ctx, cli, secret("second")))
+	var got corev1.Secret
+	require.NoError(t, cli.Get(ctx, client.ObjectKey{Namespace: "bar", Name: "foo"}, &got))
+	assert.Equal(t, "second", string(got.Data["key"]))
+}
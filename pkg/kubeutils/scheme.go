@@ -4,6 +4,7 @@ import (
 	autopilotv1beta2 "github.com/k0sproject/k0s/pkg/apis/autopilot/v1beta2"
 	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
 	embeddedclusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
 )
@@ -12,4 +13,5 @@ func init() {
 	utilruntime.Must(autopilotv1beta2.AddToScheme(scheme.Scheme))
 	utilruntime.Must(k0sv1beta1.AddToScheme(scheme.Scheme))
 	utilruntime.Must(embeddedclusterv1beta1.AddToScheme(scheme.Scheme))
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme.Scheme))
 }
@@ -0,0 +1,90 @@
+// Package localvolumes finds the persistent volumes the OpenEBS local provisioner stores on
+// the host. These volumes are not replicated, the host holds the only copy of their data.
+package localvolumes
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/storageplan"
+)
+
+// BaseDir returns where the local provisioner creates the directory of each volume on
+// this node.
+func BaseDir() string {
+	return storageplan.LocalVolumesDir(storageplan.HostSpec())
+}
+
+// Volume is a persistent volume stored on the host.
+type Volume struct {
+	// Name is the name of the PersistentVolume, also the name of its directory.
+	Name string `json:"name"`
+	// Claim is the namespace and name of the claim bound to the volume, empty when the
+	// volume could not be found in the cluster.
+	Claim string `json:"claim,omitempty"`
+	// Capacity is the requested capacity of the volume, empty when unknown.
+	Capacity string `json:"capacity,omitempty"`
+}
+
+// String returns the claim of the volume and its capacity when known, or the name of the
+// volume otherwise.
+func (v Volume) String() string {
+	if v.Claim == "" {
+		return v.Name
+	}
+	if v.Capacity == "" {
+		return v.Claim
+	}
+	return fmt.Sprintf("%s (%s)", v.Claim, v.Capacity)
+}
+
+// OnHost returns the volumes holding data in dir, sorted by name. Empty directories are
+// ignored, the volume has never been written to.
+func OnHost(dir string) ([]Volume, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", dir, err)
+	}
+	var volumes []Volume
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), "pvc-") {
+			continue
+		}
+		content, err := os.ReadDir(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read volume %s: %w", entry.Name(), err)
+		}
+		if len(content) == 0 {
+			continue
+		}
+		volumes = append(volumes, Volume{Name: entry.Name()})
+	}
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].Name < volumes[j].Name })
+	return volumes, nil
+}
+
+// Describe fills in the claims and capacities of the volumes from the cluster. Volumes
+// that can not be read are left as they are, they are still reported by name.
+func Describe(ctx context.Context, kcli client.Client, volumes []Volume) {
+	for i, volume := range volumes {
+		var pv corev1.PersistentVolume
+		if err := kcli.Get(ctx, client.ObjectKey{Name: volume.Name}, &pv); err != nil {
+			continue
+		}
+		if ref := pv.Spec.ClaimRef; ref != nil {
+			volumes[i].Claim = fmt.Sprintf("%s/%s", ref.Namespace, ref.Name)
+		}
+		if capacity, ok := pv.Spec.Capacity[corev1.ResourceStorage]; ok {
+			volumes[i].Capacity = capacity.String()
+		}
+	}
+}
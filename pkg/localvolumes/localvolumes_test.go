@@ -0,0 +1,52 @@
+package localvolumes
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestOnHost(t *testing.T) {
+	volumes, err := OnHost(filepath.Join(t.TempDir(), "missing"))
+	require.NoError(t, err)
+	assert.Empty(t, volumes)
+
+	dir := t.TempDir()
+	for _, name := range []string{"pvc-b", "pvc-a", "pvc-empty", "other"} {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, name), 0755))
+	}
+	for _, name := range []string{"pvc-b", "pvc-a", "other"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name, "data"), []byte("data"), 0644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pvc-file"), []byte("data"), 0644))
+
+	volumes, err = OnHost(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []Volume{{Name: "pvc-a"}, {Name: "pvc-b"}}, volumes)
+}
+
+func TestDescribe(t *testing.T) {
+	pv := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc-a"},
+		Spec: corev1.PersistentVolumeSpec{
+			Capacity: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")},
+			ClaimRef: &corev1.ObjectReference{Namespace: "app", Name: "data-postgres-0"},
+		},
+	}
+	cli := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(pv).Build()
+
+	volumes := []Volume{{Name: "pvc-a"}, {Name: "pvc-b"}}
+	Describe(context.Background(), cli, volumes)
+	assert.Equal(t, []Volume{{Name: "pvc-a", Claim: "app/data-postgres-0", Capacity: "10Gi"}, {Name: "pvc-b"}}, volumes)
+	assert.Equal(t, "app/data-postgres-0 (10Gi)", volumes[0].String())
+	assert.Equal(t, "pvc-b", volumes[1].String())
+}
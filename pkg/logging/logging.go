@@ -69,6 +69,9 @@ func needsFileLogging() bool {
 	if strings.Contains(cmdline, "shell") {
 		return false
 	}
+	if strings.Contains(cmdline, "completion") {
+		return false
+	}
 	return os.Getuid() == 0
 }
 
@@ -1,6 +1,8 @@
 package metrics
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 )
 
@@ -38,11 +40,25 @@ func (e InstallationSucceeded) Title() string {
 	return "InstallationSucceeded"
 }
 
+// InstallationPartial event is send back home when an installation run with skipped
+// phases finishes, the installation may not be complete.
+type InstallationPartial struct {
+	ClusterID     uuid.UUID `json:"clusterID"`
+	Version       string    `json:"version"`
+	SkippedPhases []string  `json:"skippedPhases"`
+}
+
+// Title returns the name of the event.
+func (e InstallationPartial) Title() string {
+	return "InstallationPartial"
+}
+
 // InstallationFailed event is send back home when the installation fails.
 type InstallationFailed struct {
 	ClusterID uuid.UUID `json:"clusterID"`
 	Version   string    `json:"version"`
 	Reason    string    `json:"reason"`
+	ErrorKind string    `json:"errorKind,omitempty"`
 }
 
 // Title returns the name of the event.
@@ -76,9 +92,40 @@ type JoinFailed struct {
 	Version   string    `json:"version"`
 	NodeName  string    `json:"nodeName"`
 	Reason    string    `json:"reason"`
+	ErrorKind string    `json:"errorKind,omitempty"`
 }
 
 // Title returns the name of the event.
 func (e JoinFailed) Title() string {
 	return "JoinFailed"
 }
+
+// PreflightWarningsOverridden event is send back home when the user proceeds with an
+// installation or a join despite host preflight warnings.
+type PreflightWarningsOverridden struct {
+	ClusterID uuid.UUID `json:"clusterID"`
+	Version   string    `json:"version"`
+	NodeName  string    `json:"nodeName"`
+	Warnings  []string  `json:"warnings"`
+}
+
+// Title returns the name of the event.
+func (e PreflightWarningsOverridden) Title() string {
+	return "PreflightWarningsOverridden"
+}
+
+// UnattendedRecovery event is send back home once a node the watchdog recovered, by
+// restarting k0s or rebooting the host, is healthy again.
+type UnattendedRecovery struct {
+	ClusterID   uuid.UUID `json:"clusterID"`
+	Version     string    `json:"version"`
+	NodeName    string    `json:"nodeName"`
+	Action      string    `json:"action"`
+	Reason      string    `json:"reason,omitempty"`
+	RecoveredAt time.Time `json:"recoveredAt"`
+}
+
+// Title returns the name of the event.
+func (e UnattendedRecovery) Title() string {
+	return "UnattendedRecovery"
+}
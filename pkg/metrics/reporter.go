@@ -12,6 +12,7 @@ import (
 	"github.com/urfave/cli/v2"
 
 	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	ecerrors "github.com/replicatedhq/embedded-cluster/pkg/errors"
 	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
 	"github.com/replicatedhq/embedded-cluster/pkg/release"
 	"github.com/replicatedhq/embedded-cluster/pkg/versions"
@@ -58,6 +59,14 @@ func ClusterID() uuid.UUID {
 	return id
 }
 
+// SetClusterID sets the cluster id, used when rendering the configuration of an existing
+// cluster.
+func SetClusterID(id uuid.UUID) {
+	clusterIDMut.Lock()
+	defer clusterIDMut.Unlock()
+	clusterID = &id
+}
+
 // ReportInstallationStarted reports that the installation has started.
 func ReportInstallationStarted(ctx context.Context, license *kotsv1beta1.License) {
 	rel, _ := release.GetChannelRelease()
@@ -84,9 +93,15 @@ func ReportInstallationSucceeded(ctx context.Context, license *kotsv1beta1.Licen
 	Send(ctx, BaseURL(license), InstallationSucceeded{ClusterID: ClusterID(), Version: versions.Version})
 }
 
+// ReportInstallationPartial reports that an installation run with skipped phases has
+// finished.
+func ReportInstallationPartial(ctx context.Context, license *kotsv1beta1.License, skipped []string) {
+	Send(ctx, BaseURL(license), InstallationPartial{ClusterID(), versions.Version, skipped})
+}
+
 // ReportInstallationFailed reports that the installation has failed.
 func ReportInstallationFailed(ctx context.Context, license *kotsv1beta1.License, err error) {
-	Send(ctx, BaseURL(license), InstallationFailed{ClusterID(), versions.Version, err.Error()})
+	Send(ctx, BaseURL(license), InstallationFailed{ClusterID(), versions.Version, err.Error(), string(ecerrors.KindOf(err))})
 }
 
 // ReportJoinStarted reports that a join has started.
@@ -116,7 +131,29 @@ func ReportJoinFailed(ctx context.Context, baseURL string, clusterID uuid.UUID,
 		logrus.Warnf("unable to get hostname: %s", err)
 		hostname = "unknown"
 	}
-	Send(ctx, baseURL, JoinFailed{clusterID, versions.Version, hostname, exterr.Error()})
+	Send(ctx, baseURL, JoinFailed{clusterID, versions.Version, hostname, exterr.Error(), string(ecerrors.KindOf(exterr))})
+}
+
+// ReportPreflightWarningsOverridden reports the titles of the host preflight warnings the
+// user chose to proceed past.
+func ReportPreflightWarningsOverridden(ctx context.Context, baseURL string, clusterID uuid.UUID, warnings []string) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		logrus.Warnf("unable to get hostname: %s", err)
+		hostname = "unknown"
+	}
+	Send(ctx, baseURL, PreflightWarningsOverridden{clusterID, versions.Version, hostname, warnings})
+}
+
+// ReportUnattendedRecovery reports that the watchdog recovered this node at the provided
+// time by taking action.
+func ReportUnattendedRecovery(ctx context.Context, baseURL string, clusterID uuid.UUID, action, reason string, at time.Time) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		logrus.Warnf("unable to get hostname: %s", err)
+		hostname = "unknown"
+	}
+	Send(ctx, baseURL, UnattendedRecovery{clusterID, versions.Version, hostname, action, reason, at})
 }
 
 // ReportApplyStarted reports an InstallationStarted event.
@@ -136,3 +173,11 @@ func ReportApplyFinished(c *cli.Context, err error) {
 	}
 	ReportInstallationSucceeded(ctx, License(c))
 }
+
+// ReportApplyPartial reports an InstallationPartial event, the installation ran without
+// the skipped phases.
+func ReportApplyPartial(c *cli.Context, skipped []string) {
+	ctx, cancel := context.WithTimeout(c.Context, 5*time.Second)
+	defer cancel()
+	ReportInstallationPartial(ctx, License(c), skipped)
+}
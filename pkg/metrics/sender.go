@@ -6,11 +6,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/replicatedhq/embedded-cluster/pkg/versions"
 	"github.com/sirupsen/logrus"
 )
 
+// sendTimeout is the maximum time spent sending an event.
+const sendTimeout = 10 * time.Second
+
 // Send is a helper function that sends an event to the metrics endpoint.
 // Metrics endpoint can be overwritten by the license.spec.endpoint field
 // or by the EMBEDDED_CLUSTER_METRICS_BASEURL environment variable, the latter has
@@ -44,6 +48,10 @@ func (s *Sender) Send(ctx context.Context, ev Event) {
 		return
 	}
 	request.Header.Set("Content-Type", "application/json")
+	// failures are reported when the command was interrupted as well, the event is sent
+	// even if the context is done but it can not hold the command for long.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sendTimeout)
+	defer cancel()
 	response, err := http.DefaultClient.Do(request.WithContext(ctx))
 	if err != nil {
 		logrus.Debugf("unable to send event %s: %s", ev.Title(), err)
@@ -36,6 +36,13 @@ func TestSend(t *testing.T) {
 				ClusterID: uuid.New(),
 			},
 		},
+		{
+			name: "InstallationPartial",
+			event: InstallationPartial{
+				ClusterID:     uuid.New(),
+				SkippedPhases: []string{"preflights"},
+			},
+		},
 		{
 			name: "InstallationFailed",
 			event: InstallationFailed{
@@ -65,6 +72,14 @@ func TestSend(t *testing.T) {
 				Reason:    "bar",
 			},
 		},
+		{
+			name: "PreflightWarningsOverridden",
+			event: PreflightWarningsOverridden{
+				ClusterID: uuid.New(),
+				NodeName:  "foo",
+				Warnings:  []string{"bar", "baz"},
+			},
+		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
 			payload := map[string]interface{}{"event": tt.event, "versions": map[string]string{"EmbeddedCluster": "v0.0.0", "Kubernetes": "0.0.0"}}
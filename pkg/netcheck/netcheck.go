@@ -0,0 +1,190 @@
+// Package netcheck measures the round trip time and the throughput between a joining
+// node and the cluster. Etcd and the kubernetes API degrade on slow links, nodes joined
+// over a WAN are caught before they join by comparing the measures with thresholds.
+package netcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultMaxLatency is the largest round trip time to the cluster a node can join
+	// with by default. Etcd heartbeats every 100ms.
+	DefaultMaxLatency = 50 * time.Millisecond
+	// DefaultMinThroughputMbps is the lowest throughput, in Mbit/s, to the artifact
+	// mirror a node can join with by default.
+	DefaultMinThroughputMbps = 100
+)
+
+const (
+	// latencySamples is the number of connections the round trip time is the median of.
+	latencySamples = 5
+	// dialTimeout bounds each connection attempt.
+	dialTimeout = 5 * time.Second
+	// throughputDuration and throughputBytes bound the download the throughput is
+	// measured with, whichever is reached first.
+	throughputDuration = 10 * time.Second
+	throughputBytes    = 64 << 20
+	// minThroughputBytes is the least data downloaded for the throughput to be meaningful.
+	minThroughputBytes = 1 << 20
+)
+
+// ThroughputPath is the file downloaded from the artifact mirror to measure the
+// throughput, the k0s binary is served by the mirror of every controller.
+const ThroughputPath = "/bin/k0s"
+
+// Thresholds are the limits the measures are checked against. Zero values disable the
+// corresponding check.
+type Thresholds struct {
+	MaxLatency        time.Duration
+	MinThroughputMbps int64
+}
+
+// Input holds the addresses, host and port, measured from the joining node.
+type Input struct {
+	// Controllers are the addresses of the controllers the round trip time is measured to.
+	Controllers []string
+	// ArtifactMirror is the address of the artifact mirror the round trip time and the
+	// throughput are measured to.
+	ArtifactMirror string
+	// ArtifactMirrorToken is the bearer token the artifact mirror authorizes the joining
+	// node with.
+	ArtifactMirrorToken string
+	Thresholds          Thresholds
+}
+
+// Measure is the round trip time and, for the artifact mirror, the throughput to a target.
+type Measure struct {
+	Target         string
+	Latency        time.Duration
+	ThroughputMbps float64
+}
+
+// Run measures the round trip time to the controllers and to the artifact mirror and the
+// throughput from the artifact mirror. Returns the measures and an error listing all the
+// targets below the thresholds.
+func Run(ctx context.Context, in Input) ([]Measure, error) {
+	var measures []Measure
+	var errs []error
+	for _, addr := range in.Controllers {
+		logrus.Debugf("measuring the round trip time to the controller at %s", addr)
+		latency, err := Latency(ctx, addr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("controller %s: %w", addr, err))
+			continue
+		}
+		m := Measure{Target: addr, Latency: latency}
+		measures = append(measures, m)
+		if err := in.Thresholds.check(m, false); err != nil {
+			errs = append(errs, fmt.Errorf("controller %s: %w", addr, err))
+		}
+	}
+
+	if in.ArtifactMirror == "" {
+		return measures, errors.Join(errs...)
+	}
+	logrus.Debugf("measuring the round trip time and the throughput to the artifact mirror at %s", in.ArtifactMirror)
+	latency, err := Latency(ctx, in.ArtifactMirror)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("artifact mirror %s: %w", in.ArtifactMirror, err))
+		return measures, errors.Join(errs...)
+	}
+	m := Measure{Target: in.ArtifactMirror, Latency: latency}
+	if in.Thresholds.MinThroughputMbps > 0 {
+		url := fmt.Sprintf("http://%s%s", in.ArtifactMirror, ThroughputPath)
+		if m.ThroughputMbps, err = ThroughputMbps(ctx, url, in.ArtifactMirrorToken); err != nil {
+			errs = append(errs, fmt.Errorf("artifact mirror %s: %w", in.ArtifactMirror, err))
+			return append(measures, m), errors.Join(errs...)
+		}
+	}
+	measures = append(measures, m)
+	if err := in.Thresholds.check(m, true); err != nil {
+		errs = append(errs, fmt.Errorf("artifact mirror %s: %w", in.ArtifactMirror, err))
+	}
+	return measures, errors.Join(errs...)
+}
+
+// check returns an error if the measure is below the thresholds. The throughput is only
+// checked when it was measured.
+func (t Thresholds) check(m Measure, withThroughput bool) error {
+	if t.MaxLatency > 0 && m.Latency > t.MaxLatency {
+		return fmt.Errorf("round trip time is %s, it must be at most %s", m.Latency.Round(100*time.Microsecond), t.MaxLatency)
+	}
+	if withThroughput && t.MinThroughputMbps > 0 && m.ThroughputMbps < float64(t.MinThroughputMbps) {
+		return fmt.Errorf("throughput is %.1f Mbit/s, it must be at least %d Mbit/s", m.ThroughputMbps, t.MinThroughputMbps)
+	}
+	return nil
+}
+
+// Latency returns the median time a tcp connection to the address takes to establish,
+// one round trip.
+func Latency(ctx context.Context, addr string) (time.Duration, error) {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	samples := make([]time.Duration, 0, latencySamples)
+	for i := 0; i < latencySamples; i++ {
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return 0, fmt.Errorf("unable to connect: %w", err)
+		}
+		samples = append(samples, time.Since(start))
+		conn.Close()
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	return samples[len(samples)/2], nil
+}
+
+// ThroughputMbps downloads the file at the url, for at most throughputDuration or
+// throughputBytes, and returns the throughput in Mbit/s. The time to the first byte is
+// not counted.
+func ThroughputMbps(ctx context.Context, url, token string) (float64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("unable to create request: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	// the mirror is in the cluster network, never reached through a proxy. Only the
+	// connection and the response headers are bounded, the body is read until the timer
+	// below cancels it so a slow download is reported as a low throughput.
+	client := &http.Client{Transport: &http.Transport{
+		DialContext:           (&net.Dialer{Timeout: dialTimeout}).DialContext,
+		ResponseHeaderTimeout: dialTimeout,
+	}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("unable to download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unable to download %s: unexpected status code %d", url, resp.StatusCode)
+	}
+
+	start := time.Now()
+	timer := time.AfterFunc(throughputDuration, cancel)
+	defer timer.Stop()
+	n, err := io.Copy(io.Discard, io.LimitReader(resp.Body, throughputBytes))
+	elapsed := time.Since(start)
+	if err != nil && ctx.Err() == nil {
+		return 0, fmt.Errorf("unable to download %s: %w", url, err)
+	}
+	if n < minThroughputBytes && err != nil {
+		return 0, fmt.Errorf("only %d bytes of %s downloaded in %s", n, url, throughputDuration)
+	}
+	if elapsed <= 0 {
+		elapsed = time.Nanosecond
+	}
+	return float64(n*8) / elapsed.Seconds() / 1e6, nil
+}
@@ -0,0 +1,81 @@
+package netcheck
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMirror(t *testing.T) *httptest.Server {
+	data := bytes.Repeat([]byte("k0s"), 1<<20)
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != ThroughputPath {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(mirror.Close)
+	return mirror
+}
+
+func TestRun(t *testing.T) {
+	mirror := newMirror(t)
+	addr := strings.TrimPrefix(mirror.URL, "http://")
+
+	measures, err := Run(context.Background(), Input{
+		Controllers:    []string{addr},
+		ArtifactMirror: addr,
+		Thresholds:     Thresholds{MaxLatency: time.Second, MinThroughputMbps: 1},
+	})
+	require.NoError(t, err)
+	require.Len(t, measures, 2)
+	assert.Zero(t, measures[0].ThroughputMbps)
+	assert.Positive(t, measures[1].ThroughputMbps)
+
+	_, err = Run(context.Background(), Input{
+		Controllers:    []string{addr},
+		ArtifactMirror: addr,
+		Thresholds:     Thresholds{MaxLatency: time.Nanosecond, MinThroughputMbps: 1 << 40},
+	})
+	assert.ErrorContains(t, err, "controller "+addr+": round trip time is")
+	assert.ErrorContains(t, err, "artifact mirror "+addr+": round trip time is")
+
+	_, err = Run(context.Background(), Input{
+		ArtifactMirror: addr,
+		Thresholds:     Thresholds{MinThroughputMbps: 1 << 40},
+	})
+	assert.ErrorContains(t, err, "throughput is")
+	assert.ErrorContains(t, err, "it must be at least 1099511627776 Mbit/s")
+
+	// disabled checks always pass.
+	_, err = Run(context.Background(), Input{Controllers: []string{addr}, ArtifactMirror: addr})
+	assert.NoError(t, err)
+}
+
+func TestRunUnreachable(t *testing.T) {
+	closed := httptest.NewServer(http.NotFoundHandler())
+	addr := strings.TrimPrefix(closed.URL, "http://")
+	closed.Close()
+
+	_, err := Run(context.Background(), Input{Controllers: []string{addr}, Thresholds: Thresholds{MaxLatency: time.Second}})
+	assert.ErrorContains(t, err, "controller "+addr+": unable to connect")
+}
+
+func TestThroughputMbps(t *testing.T) {
+	mirror := newMirror(t)
+
+	mbps, err := ThroughputMbps(context.Background(), mirror.URL+ThroughputPath, "")
+	require.NoError(t, err)
+	assert.Positive(t, mbps)
+
+	_, err = ThroughputMbps(context.Background(), mirror.URL+"/bin/missing", "")
+	assert.ErrorContains(t, err, "unexpected status code 404")
+}
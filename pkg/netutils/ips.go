@@ -41,6 +41,36 @@ func FirstValidIPNet(networkInterface string) (*net.IPNet, error) {
 	return nil, fmt.Errorf("interface %s not found or is not valid. The following interfaces were detected: %s", networkInterface, strings.Join(ifNames, ", "))
 }
 
+// FirstValidInterface returns the name of the interface FirstValidIPNet reads the
+// address from.
+func FirstValidInterface(networkInterface string) (string, error) {
+	if networkInterface != "" {
+		return networkInterface, nil
+	}
+	ifs, err := listValidInterfaces()
+	if err != nil {
+		return "", fmt.Errorf("list valid network interfaces: %w", err)
+	}
+	if len(ifs) == 0 {
+		return "", fmt.Errorf("no valid network interfaces found on this machine")
+	}
+	return ifs[0].Name, nil
+}
+
+// ListValidInterfaceNames returns the names of the network interfaces that can be used
+// by the cluster.
+func ListValidInterfaceNames() ([]string, error) {
+	ifs, err := listValidInterfaces()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, i := range ifs {
+		names = append(names, i.Name)
+	}
+	return names, nil
+}
+
 // listValidInterfaces returns a list of valid network interfaces for the node.
 func listValidInterfaces() ([]net.Interface, error) {
 	ifs, err := net.Interfaces()
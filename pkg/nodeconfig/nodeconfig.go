@@ -0,0 +1,174 @@
+// Package nodeconfig renders the NodeConfig objects into k0s worker profiles. The operator
+// renders a profile per NodeConfig into the k0s dynamic config and records on each of the
+// selected nodes the profile it should run with, the node apply-config command restarts
+// k0s on the node with that profile.
+package nodeconfig
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+const (
+	// ProfilePrefix prefixes the name of the worker profiles rendered out of NodeConfigs.
+	ProfilePrefix = "nodeconfig-"
+	// DesiredAnnotation is the node annotation holding the worker profile, and the hash
+	// of its configuration, the node should run with. Nodes not selected by any
+	// NodeConfig do not have it.
+	DesiredAnnotation = "embeddedcluster.replicated.com/node-config"
+	// AppliedAnnotation is the node annotation holding the worker profile, and the hash
+	// of its configuration, the node was last restarted with.
+	AppliedAnnotation = "embeddedcluster.replicated.com/node-config-applied"
+	// DropInFile is the name of the k0s systemd drop-in selecting the worker profile.
+	DropInFile = "node-config.conf"
+	// ProfileEnv is the variable of the k0s unit environment holding the worker profile,
+	// the profile changes without touching the command line of the unit.
+	ProfileEnv = "K0S_WORKER_PROFILE"
+	// defaultProfile is the worker profile nodes run with when no profile is selected.
+	defaultProfile = "default"
+)
+
+// ProfileName returns the name of the worker profile of the NodeConfig.
+func ProfileName(nc v1beta1.NodeConfig) string {
+	return ProfilePrefix + nc.Name
+}
+
+// Selects returns true if the NodeConfig applies to the node.
+func Selects(nc v1beta1.NodeConfig, node corev1.Node) bool {
+	return labels.SelectorFromSet(nc.Spec.NodeSelector).Matches(labels.Set(node.Labels))
+}
+
+// ForNode returns the NodeConfig applying to the node, nil if there is none. NodeConfigs
+// being deleted are ignored. An error is returned if more than one NodeConfig selects the
+// node, a node can only run with one worker profile.
+func ForNode(configs []v1beta1.NodeConfig, node corev1.Node) (*v1beta1.NodeConfig, error) {
+	var found []string
+	var selected *v1beta1.NodeConfig
+	for i := range configs {
+		if configs[i].DeletionTimestamp != nil || !Selects(configs[i], node) {
+			continue
+		}
+		found = append(found, configs[i].Name)
+		selected = &configs[i]
+	}
+	if len(found) > 1 {
+		sort.Strings(found)
+		return nil, fmt.Errorf("node %s is selected by multiple node configs: %s", node.Name, strings.Join(found, ", "))
+	}
+	return selected, nil
+}
+
+// KubeletValues returns the kubelet configuration values of the overrides, as named in the
+// kubelet configuration file.
+func KubeletValues(o v1beta1.KubeletOverrides) map[string]interface{} {
+	values := map[string]interface{}{}
+	if o.MaxPods != nil {
+		values["maxPods"] = *o.MaxPods
+	}
+	if len(o.EvictionHard) > 0 {
+		values["evictionHard"] = o.EvictionHard
+	}
+	if len(o.EvictionSoft) > 0 {
+		values["evictionSoft"] = o.EvictionSoft
+	}
+	if len(o.EvictionSoftGracePeriod) > 0 {
+		values["evictionSoftGracePeriod"] = o.EvictionSoftGracePeriod
+	}
+	if o.TopologyManagerPolicy != "" {
+		values["topologyManagerPolicy"] = o.TopologyManagerPolicy
+	}
+	return values
+}
+
+// RenderProfile returns the worker profile of the NodeConfig and the hash of its values.
+// The profile starts from the default worker profile of the cluster config, so settings
+// like the fips ones are kept, with the overrides on top.
+func RenderProfile(cfg *k0sv1beta1.ClusterConfig, nc v1beta1.NodeConfig) (k0sv1beta1.WorkerProfile, string, error) {
+	merged := map[string]interface{}{}
+	for _, profile := range cfg.Spec.WorkerProfiles {
+		if profile.Name != defaultProfile || profile.Config == nil || len(profile.Config.Raw) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(profile.Config.Raw, &merged); err != nil {
+			return k0sv1beta1.WorkerProfile{}, "", fmt.Errorf("unable to unmarshal default worker profile: %w", err)
+		}
+	}
+	for k, v := range KubeletValues(nc.Spec.Kubelet) {
+		merged[k] = v
+	}
+	// map keys are sorted when marshaled, equal values always produce the same hash.
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return k0sv1beta1.WorkerProfile{}, "", fmt.Errorf("unable to marshal worker profile: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	profile := k0sv1beta1.WorkerProfile{
+		Name:   ProfileName(nc),
+		Config: &runtime.RawExtension{Raw: data},
+	}
+	return profile, hex.EncodeToString(sum[:])[:10], nil
+}
+
+// SetProfiles replaces the NodeConfig worker profiles of the cluster config with the
+// provided ones, the other profiles are kept. Returns true if the profiles changed.
+func SetProfiles(cfg *k0sv1beta1.ClusterConfig, profiles []k0sv1beta1.WorkerProfile) bool {
+	result := k0sv1beta1.WorkerProfiles{}
+	for _, profile := range cfg.Spec.WorkerProfiles {
+		if !strings.HasPrefix(profile.Name, ProfilePrefix) {
+			result = append(result, profile)
+		}
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	result = append(result, profiles...)
+
+	before, _ := json.Marshal(cfg.Spec.WorkerProfiles)
+	after, _ := json.Marshal(result)
+	if string(before) == string(after) {
+		return false
+	}
+	cfg.Spec.WorkerProfiles = result
+	return true
+}
+
+// AnnotationValue returns the value of the node annotations for a profile and its hash.
+func AnnotationValue(profile, hash string) string {
+	return fmt.Sprintf("%s@%s", profile, hash)
+}
+
+// ProfileFromAnnotation returns the profile of a node annotation value.
+func ProfileFromAnnotation(value string) string {
+	profile, _, _ := strings.Cut(value, "@")
+	return profile
+}
+
+// ProfileFlag returns the k0s flag reading the worker profile from the environment of
+// the unit, systemd expands the variable when starting k0s.
+func ProfileFlag() string {
+	return fmt.Sprintf("--profile=${%s}", ProfileEnv)
+}
+
+// ReadsProfile returns true if the k0s unit reads the worker profile from the environment.
+// Units installed before the profile flag was added must be reinstalled first.
+func ReadsProfile(unit string) bool {
+	return strings.Contains(unit, fmt.Sprintf("${%s}", ProfileEnv))
+}
+
+// DropIn returns the content of the systemd drop-in setting the worker profile k0s starts
+// with. An empty profile selects the default one.
+func DropIn(profile string) string {
+	if profile == "" {
+		profile = defaultProfile
+	}
+	return fmt.Sprintf("[Service]\nEnvironment=%s=%s\n", ProfileEnv, profile)
+}
@@ -0,0 +1,118 @@
+package nodeconfig
+
+import (
+	"testing"
+
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+
+	"github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+func nodeConfig(name string, selector map[string]string) v1beta1.NodeConfig {
+	return v1beta1.NodeConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       v1beta1.NodeConfigSpec{NodeSelector: selector},
+	}
+}
+
+func TestForNode(t *testing.T) {
+	node := corev1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   "node-1",
+		Labels: map[string]string{"pool": "gpu", "zone": "a"},
+	}}
+
+	nc, err := ForNode([]v1beta1.NodeConfig{nodeConfig("cpu", map[string]string{"pool": "cpu"})}, node)
+	require.NoError(t, err)
+	assert.Nil(t, nc)
+
+	nc, err = ForNode([]v1beta1.NodeConfig{
+		nodeConfig("cpu", map[string]string{"pool": "cpu"}),
+		nodeConfig("gpu", map[string]string{"pool": "gpu"}),
+	}, node)
+	require.NoError(t, err)
+	assert.Equal(t, "gpu", nc.Name)
+
+	_, err = ForNode([]v1beta1.NodeConfig{
+		nodeConfig("zone-a", map[string]string{"zone": "a"}),
+		nodeConfig("gpu", map[string]string{"pool": "gpu"}),
+	}, node)
+	assert.EqualError(t, err, "node node-1 is selected by multiple node configs: gpu, zone-a")
+
+	deleted := nodeConfig("all", nil)
+	deleted.DeletionTimestamp = ptr.To(metav1.Now())
+	nc, err = ForNode([]v1beta1.NodeConfig{deleted, nodeConfig("gpu", map[string]string{"pool": "gpu"})}, node)
+	require.NoError(t, err)
+	assert.Equal(t, "gpu", nc.Name)
+}
+
+func TestRenderProfile(t *testing.T) {
+	cfg := &k0sv1beta1.ClusterConfig{Spec: &k0sv1beta1.ClusterSpec{
+		WorkerProfiles: k0sv1beta1.WorkerProfiles{{
+			Name:   "default",
+			Config: &runtime.RawExtension{Raw: []byte(`{"tlsMinVersion":"VersionTLS12","maxPods":110}`)},
+		}},
+	}}
+	nc := nodeConfig("gpu", nil)
+	nc.Spec.Kubelet = v1beta1.KubeletOverrides{
+		MaxPods:               ptr.To[int32](250),
+		EvictionHard:          map[string]string{"memory.available": "500Mi"},
+		TopologyManagerPolicy: "single-numa-node",
+	}
+
+	profile, hash, err := RenderProfile(cfg, nc)
+	require.NoError(t, err)
+	assert.Equal(t, "nodeconfig-gpu", profile.Name)
+	assert.JSONEq(t, `{
+		"tlsMinVersion": "VersionTLS12",
+		"maxPods": 250,
+		"evictionHard": {"memory.available": "500Mi"},
+		"topologyManagerPolicy": "single-numa-node"
+	}`, string(profile.Config.Raw))
+	assert.Len(t, hash, 10)
+
+	_, again, err := RenderProfile(cfg, nc)
+	require.NoError(t, err)
+	assert.Equal(t, hash, again, "the hash must be stable")
+
+	nc.Spec.Kubelet.MaxPods = ptr.To[int32](200)
+	_, changed, err := RenderProfile(cfg, nc)
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, changed)
+}
+
+func TestSetProfiles(t *testing.T) {
+	cfg := &k0sv1beta1.ClusterConfig{Spec: &k0sv1beta1.ClusterSpec{
+		WorkerProfiles: k0sv1beta1.WorkerProfiles{
+			{Name: "default", Config: &runtime.RawExtension{Raw: []byte(`{"maxPods":110}`)}},
+			{Name: "nodeconfig-stale", Config: &runtime.RawExtension{Raw: []byte(`{}`)}},
+		},
+	}}
+	profiles := []k0sv1beta1.WorkerProfile{
+		{Name: "nodeconfig-gpu", Config: &runtime.RawExtension{Raw: []byte(`{"maxPods":250}`)}},
+		{Name: "nodeconfig-cpu", Config: &runtime.RawExtension{Raw: []byte(`{"maxPods":50}`)}},
+	}
+	assert.True(t, SetProfiles(cfg, profiles))
+	names := []string{}
+	for _, profile := range cfg.Spec.WorkerProfiles {
+		names = append(names, profile.Name)
+	}
+	assert.Equal(t, []string{"default", "nodeconfig-cpu", "nodeconfig-gpu"}, names)
+	assert.False(t, SetProfiles(cfg, profiles))
+}
+
+func TestDropIn(t *testing.T) {
+	assert.Equal(t, "[Service]\nEnvironment=K0S_WORKER_PROFILE=nodeconfig-gpu\n", DropIn("nodeconfig-gpu"))
+	assert.Equal(t, "[Service]\nEnvironment=K0S_WORKER_PROFILE=default\n", DropIn(""))
+
+	unit := `[Service]
+ExecStart=/usr/local/bin/k0s worker "--token-file=/etc/k0s/k0stoken" "--profile=${K0S_WORKER_PROFILE}"
+`
+	assert.True(t, ReadsProfile(unit))
+	assert.False(t, ReadsProfile("[Service]\nExecStart=/usr/local/bin/k0s worker --token-file=/etc/k0s/k0stoken\n"))
+}
@@ -0,0 +1,162 @@
+// Package osmatrix holds the operating systems the cluster can be installed on and
+// checks the host against them. Unsupported hosts fail in obscure ways well into the
+// installation (e.g. containerd refusing to start), checking upfront gives users an
+// actionable message instead.
+package osmatrix
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/replicatedhq/embedded-cluster/kinds/types"
+	"github.com/replicatedhq/embedded-cluster/pkg/prereqs"
+)
+
+var (
+	// KernelReleasePath is the file the kernel release is read from.
+	KernelReleasePath = "/proc/sys/kernel/osrelease"
+	// CgroupControllersPath only exists on hosts using the cgroup v2 unified hierarchy.
+	CgroupControllersPath = "/sys/fs/cgroup/cgroup.controllers"
+)
+
+// Supported holds the operating systems the cluster can be installed on. It is embedded
+// in the release metadata.
+var Supported = []types.SupportedOS{
+	{ID: "ubuntu", Name: "Ubuntu", MinVersion: "20.04", MinKernel: "5.4"},
+	{ID: "debian", Name: "Debian", MinVersion: "11", MinKernel: "5.10"},
+	{ID: "rhel", Name: "Red Hat Enterprise Linux", MinVersion: "8", MinKernel: "4.18"},
+	{ID: "centos", Name: "CentOS Stream", MinVersion: "8", MinKernel: "4.18"},
+	{ID: "rocky", Name: "Rocky Linux", MinVersion: "8", MinKernel: "4.18"},
+	{ID: "almalinux", Name: "AlmaLinux", MinVersion: "8", MinKernel: "4.18"},
+	{ID: "ol", Name: "Oracle Linux", MinVersion: "8", MinKernel: "4.18"},
+	{ID: "amzn", Name: "Amazon Linux", MinVersion: "2023", MinKernel: "6.1", CgroupVersions: []int{2}},
+	{ID: "sles", Name: "SUSE Linux Enterprise Server", MinVersion: "15", MinKernel: "5.3"},
+}
+
+// Host describes the operating system running on the host.
+type Host struct {
+	// ID is the distribution identifier, e.g. ubuntu.
+	ID string
+	// Name is the distribution name as reported by the host.
+	Name string
+	// Version is the distribution release, e.g. 22.04.
+	Version string
+	// Kernel is the kernel release, e.g. 5.15.0-91-generic.
+	Kernel string
+	// CgroupVersion is the cgroup version in use, 1 or 2.
+	CgroupVersion int
+}
+
+// Detect reads the operating system running on the host.
+func Detect() (Host, error) {
+	values, err := prereqs.ReadOSRelease()
+	if err != nil {
+		return Host{}, err
+	}
+	host := Host{ID: values["ID"], Name: values["NAME"], Version: values["VERSION_ID"], CgroupVersion: 1}
+	release, err := os.ReadFile(KernelReleasePath)
+	if err != nil {
+		return Host{}, fmt.Errorf("unable to read kernel release: %w", err)
+	}
+	host.Kernel = strings.TrimSpace(string(release))
+	if _, err := os.Stat(CgroupControllersPath); err == nil {
+		host.CgroupVersion = 2
+	}
+	return host, nil
+}
+
+// Check returns an error describing why the host is not supported, nil if it is.
+func Check(host Host, supported []types.SupportedOS) error {
+	var entry *types.SupportedOS
+	for i := range supported {
+		if supported[i].ID == host.ID {
+			entry = &supported[i]
+			break
+		}
+	}
+	if entry == nil {
+		name := strings.TrimSpace(fmt.Sprintf("%s %s", host.Name, host.Version))
+		if name == "" {
+			name = "The operating system"
+		}
+		return fmt.Errorf("%s is not supported, supported operating systems are %s", name, names(supported))
+	}
+
+	name := fmt.Sprintf("%s %s", entry.Name, host.Version)
+	if compareVersions(host.Version, entry.MinVersion) < 0 {
+		return fmt.Errorf("%s is not supported, minimum is %s", name, entry.MinVersion)
+	}
+	if entry.MaxVersion != "" && compareVersions(host.Version, entry.MaxVersion) > 0 {
+		return fmt.Errorf("%s is not supported, maximum is %s", name, entry.MaxVersion)
+	}
+	if entry.MinKernel != "" && compareVersions(host.Kernel, entry.MinKernel) < 0 {
+		return fmt.Errorf("%s with kernel %s is not supported, minimum kernel is %s", name, host.Kernel, entry.MinKernel)
+	}
+	if len(entry.CgroupVersions) > 0 && !hasInt(entry.CgroupVersions, host.CgroupVersion) {
+		return fmt.Errorf("%s with cgroup v%d is not supported, use cgroup v%d", name, host.CgroupVersion, entry.CgroupVersions[0])
+	}
+	return nil
+}
+
+// compareVersions compares the leading numeric dot separated components of the provided
+// versions, e.g. 5.15.0-91-generic is compared as 5.15.0. Missing components count as
+// zero. Returns -1, 0 or 1 if a is lower, equal or greater than b.
+func compareVersions(a, b string) int {
+	as, bs := numericComponents(a), numericComponents(b)
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+	}
+	return 0
+}
+
+func numericComponents(version string) []int {
+	var components []int
+	for _, part := range strings.Split(version, ".") {
+		end := strings.IndexFunc(part, func(r rune) bool { return r < '0' || r > '9' })
+		if end == 0 {
+			break
+		}
+		if end > 0 {
+			part = part[:end]
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			break
+		}
+		components = append(components, n)
+		if end > 0 {
+			break
+		}
+	}
+	return components
+}
+
+func names(supported []types.SupportedOS) string {
+	var names []string
+	for _, entry := range supported {
+		names = append(names, fmt.Sprintf("%s %s+", entry.Name, entry.MinVersion))
+	}
+	return strings.Join(names, ", ")
+}
+
+func hasInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
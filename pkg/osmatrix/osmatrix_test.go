@@ -0,0 +1,94 @@
+package osmatrix
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/prereqs"
+)
+
+func TestCheck(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		host    Host
+		wantErr string
+	}{
+		{
+			name: "supported",
+			host: Host{ID: "ubuntu", Version: "22.04", Kernel: "5.15.0-91-generic", CgroupVersion: 2},
+		},
+		{
+			name: "supported with cgroup v1",
+			host: Host{ID: "rhel", Version: "8.9", Kernel: "4.18.0-513.5.1.el8_9.x86_64", CgroupVersion: 1},
+		},
+		{
+			name:    "old release",
+			host:    Host{ID: "ubuntu", Version: "18.04", Kernel: "4.15.0-213-generic", CgroupVersion: 1},
+			wantErr: "Ubuntu 18.04 is not supported, minimum is 20.04",
+		},
+		{
+			name:    "old kernel",
+			host:    Host{ID: "ubuntu", Version: "20.04", Kernel: "4.15.0-213-generic", CgroupVersion: 1},
+			wantErr: "Ubuntu 20.04 with kernel 4.15.0-213-generic is not supported, minimum kernel is 5.4",
+		},
+		{
+			name:    "unsupported cgroup version",
+			host:    Host{ID: "amzn", Version: "2023", Kernel: "6.1.61-85.141.amzn2023.x86_64", CgroupVersion: 1},
+			wantErr: "Amazon Linux 2023 with cgroup v1 is not supported, use cgroup v2",
+		},
+		{
+			name:    "unknown distribution",
+			host:    Host{ID: "alpine", Name: "Alpine Linux", Version: "3.19.0", Kernel: "6.6.7", CgroupVersion: 2},
+			wantErr: "Alpine Linux 3.19.0 is not supported, supported operating systems are Ubuntu 20.04+",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check(tt.host, Supported)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, 0, compareVersions("8", "8.0"))
+	assert.Equal(t, -1, compareVersions("8.9", "9"))
+	assert.Equal(t, 1, compareVersions("5.15.0-91-generic", "5.4"))
+	assert.Equal(t, -1, compareVersions("4.18.0-513.el8", "5.3"))
+	assert.Equal(t, 1, compareVersions("2023", "2"))
+	assert.Equal(t, -1, compareVersions("", "20.04"))
+}
+
+func TestDetect(t *testing.T) {
+	originalOSRelease := prereqs.OSReleasePath
+	originalKernel, originalCgroup := KernelReleasePath, CgroupControllersPath
+	defer func() {
+		prereqs.OSReleasePath = originalOSRelease
+		KernelReleasePath, CgroupControllersPath = originalKernel, originalCgroup
+	}()
+
+	dir := t.TempDir()
+	prereqs.OSReleasePath = filepath.Join(dir, "os-release")
+	KernelReleasePath = filepath.Join(dir, "osrelease")
+	CgroupControllersPath = filepath.Join(dir, "cgroup.controllers")
+	osRelease := "NAME=\"Rocky Linux\"\nID=\"rocky\"\nVERSION_ID=\"9.3\"\n"
+	require.NoError(t, os.WriteFile(prereqs.OSReleasePath, []byte(osRelease), 0644))
+	require.NoError(t, os.WriteFile(KernelReleasePath, []byte("5.14.0-362.8.1.el9_3.x86_64\n"), 0644))
+
+	host, err := Detect()
+	require.NoError(t, err)
+	assert.Equal(t, Host{ID: "rocky", Name: "Rocky Linux", Version: "9.3", Kernel: "5.14.0-362.8.1.el9_3.x86_64", CgroupVersion: 1}, host)
+
+	require.NoError(t, os.WriteFile(CgroupControllersPath, []byte("cpu memory"), 0644))
+	host, err = Detect()
+	require.NoError(t, err)
+	assert.Equal(t, 2, host.CgroupVersion)
+}
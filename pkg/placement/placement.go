@@ -0,0 +1,177 @@
+// Package placement pins the admin console and the embedded registry to a subset of the
+// cluster nodes. Nodes are selected by name, by labels or both, and the selection is
+// rendered as the nodeSelector and the node affinity of the charts.
+package placement
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/helm"
+)
+
+const (
+	// AdminConsoleChart is the name of the admin console chart.
+	AdminConsoleChart = "admin-console"
+	// RegistryChart is the name of the embedded registry chart.
+	RegistryChart = "docker-registry"
+)
+
+// Merge merges the placements, the placement of a component in a later placement takes
+// precedence over the ones before it. Nil is returned if no component is placed.
+func Merge(placements ...*ecv1beta1.Placement) *ecv1beta1.Placement {
+	merged := &ecv1beta1.Placement{}
+	for _, p := range placements {
+		if p == nil {
+			continue
+		}
+		if p.AdminConsole != nil {
+			merged.AdminConsole = p.AdminConsole
+		}
+		if p.Registry != nil {
+			merged.Registry = p.Registry
+		}
+	}
+	if merged.AdminConsole == nil && merged.Registry == nil {
+		return nil
+	}
+	return merged
+}
+
+// Validate verifies the node names and the labels of the placement.
+func Validate(p *ecv1beta1.Placement) error {
+	if p == nil {
+		return nil
+	}
+	for component, np := range map[string]*ecv1beta1.NodePlacement{
+		"admin console": p.AdminConsole,
+		"registry":      p.Registry,
+	} {
+		if err := validateNodePlacement(np); err != nil {
+			return fmt.Errorf("invalid %s placement: %w", component, err)
+		}
+	}
+	return nil
+}
+
+// validateNodePlacement verifies the node names are valid kubernetes names and the node
+// selector holds valid label keys and values.
+func validateNodePlacement(np *ecv1beta1.NodePlacement) error {
+	if np == nil {
+		return nil
+	}
+	if len(np.Nodes) == 0 && len(np.NodeSelector) == 0 {
+		return fmt.Errorf("no nodes or node selector")
+	}
+	for _, node := range np.Nodes {
+		if errs := validation.IsDNS1123Subdomain(node); len(errs) > 0 {
+			return fmt.Errorf("invalid node name %q: %s", node, errs[0])
+		}
+	}
+	for key, value := range np.NodeSelector {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid label key %q: %s", key, errs[0])
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return fmt.Errorf("invalid label value %q: %s", value, errs[0])
+		}
+	}
+	return nil
+}
+
+// forChart returns the node placement of the chart, nil if the chart is not placed.
+func forChart(chartName string, p *ecv1beta1.Placement) *ecv1beta1.NodePlacement {
+	if p == nil {
+		return nil
+	}
+	switch chartName {
+	case AdminConsoleChart:
+		return p.AdminConsole
+	case RegistryChart:
+		return p.Registry
+	}
+	return nil
+}
+
+// ChartValues sets the nodeSelector and the node affinity of the chart values from the
+// placement of the chart. Other affinities, like the pod anti-affinity of the registry,
+// are kept. The values are returned as they are if the chart is not placed.
+func ChartValues(chartName, values string, p *ecv1beta1.Placement) (string, error) {
+	np := forChart(chartName, p)
+	if np == nil {
+		return values, nil
+	}
+	parsed, err := helm.UnmarshalValues(values)
+	if err != nil {
+		return "", fmt.Errorf("unable to unmarshal values: %w", err)
+	}
+	if len(np.NodeSelector) > 0 {
+		selector := map[string]interface{}{}
+		for key, value := range np.NodeSelector {
+			selector[key] = value
+		}
+		if parsed, err = helm.SetValue(parsed, "nodeSelector", selector); err != nil {
+			return "", fmt.Errorf("unable to set node selector: %w", err)
+		}
+	}
+	if len(np.Nodes) > 0 {
+		nodes := []interface{}{}
+		for _, node := range np.Nodes {
+			nodes = append(nodes, node)
+		}
+		affinity := map[string]interface{}{
+			"requiredDuringSchedulingIgnoredDuringExecution": map[string]interface{}{
+				"nodeSelectorTerms": []interface{}{
+					map[string]interface{}{
+						"matchExpressions": []interface{}{
+							map[string]interface{}{
+								"key":      corev1.LabelHostname,
+								"operator": string(corev1.NodeSelectorOpIn),
+								"values":   nodes,
+							},
+						},
+					},
+				},
+			},
+		}
+		// paths are only set if their parent exists, other affinities are kept when the
+		// values already have some.
+		path, value := "affinity.nodeAffinity", interface{}(affinity)
+		if _, ok := parsed["affinity"]; !ok {
+			path, value = "affinity", map[string]interface{}{"nodeAffinity": affinity}
+		}
+		if parsed, err = helm.SetValue(parsed, path, value); err != nil {
+			return "", fmt.Errorf("unable to set node affinity: %w", err)
+		}
+	}
+	return helm.MarshalValues(parsed)
+}
+
+// Matches returns true if the node is selected by the node placement. All nodes match a
+// nil node placement.
+func Matches(np *ecv1beta1.NodePlacement, node corev1.Node) bool {
+	if np == nil {
+		return true
+	}
+	if len(np.Nodes) > 0 {
+		found := false
+		for _, name := range np.Nodes {
+			if name == node.Labels[corev1.LabelHostname] || name == node.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for key, value := range np.NodeSelector {
+		if node.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
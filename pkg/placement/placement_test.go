@@ -0,0 +1,146 @@
+package placement
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+func TestMerge(t *testing.T) {
+	vendor := &ecv1beta1.Placement{
+		AdminConsole: &ecv1beta1.NodePlacement{Nodes: []string{"node-1"}},
+		Registry:     &ecv1beta1.NodePlacement{Nodes: []string{"node-2"}},
+	}
+	endUser := &ecv1beta1.Placement{
+		AdminConsole: &ecv1beta1.NodePlacement{NodeSelector: map[string]string{"disk": "ssd"}},
+	}
+	merged := Merge(vendor, nil, endUser)
+	assert.Equal(t, endUser.AdminConsole, merged.AdminConsole)
+	assert.Equal(t, vendor.Registry, merged.Registry)
+	assert.Nil(t, Merge(nil, &ecv1beta1.Placement{}))
+}
+
+func TestValidate(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		placement *ecv1beta1.Placement
+		wantErr   string
+	}{
+		{
+			name: "valid",
+			placement: &ecv1beta1.Placement{
+				AdminConsole: &ecv1beta1.NodePlacement{Nodes: []string{"node-1", "node-2.example.com"}},
+				Registry:     &ecv1beta1.NodePlacement{NodeSelector: map[string]string{"example.com/disk": "ssd"}},
+			},
+		},
+		{
+			name: "nil",
+		},
+		{
+			name:      "empty",
+			placement: &ecv1beta1.Placement{Registry: &ecv1beta1.NodePlacement{}},
+			wantErr:   "invalid registry placement: no nodes or node selector",
+		},
+		{
+			name:      "invalid node name",
+			placement: &ecv1beta1.Placement{AdminConsole: &ecv1beta1.NodePlacement{Nodes: []string{"Node_1"}}},
+			wantErr:   `invalid node name "Node_1"`,
+		},
+		{
+			name:      "invalid label key",
+			placement: &ecv1beta1.Placement{AdminConsole: &ecv1beta1.NodePlacement{NodeSelector: map[string]string{"disk type": "ssd"}}},
+			wantErr:   `invalid label key "disk type"`,
+		},
+		{
+			name:      "invalid label value",
+			placement: &ecv1beta1.Placement{AdminConsole: &ecv1beta1.NodePlacement{NodeSelector: map[string]string{"disk": "fast ssd"}}},
+			wantErr:   `invalid label value "fast ssd"`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.placement)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestChartValues(t *testing.T) {
+	p := &ecv1beta1.Placement{
+		AdminConsole: &ecv1beta1.NodePlacement{NodeSelector: map[string]string{"disk": "ssd"}},
+		Registry:     &ecv1beta1.NodePlacement{Nodes: []string{"node-1", "node-2"}},
+	}
+
+	got, err := ChartValues(AdminConsoleChart, "isHA: false\n", p)
+	require.NoError(t, err)
+	assert.Equal(t, `isHA: false
+nodeSelector:
+  disk: ssd
+`, got)
+
+	got, err = ChartValues(RegistryChart, `affinity:
+  podAntiAffinity:
+    requiredDuringSchedulingIgnoredDuringExecution:
+    - topologyKey: kubernetes.io/hostname
+replicaCount: 2
+`, p)
+	require.NoError(t, err)
+	assert.Equal(t, `affinity:
+  nodeAffinity:
+    requiredDuringSchedulingIgnoredDuringExecution:
+      nodeSelectorTerms:
+      - matchExpressions:
+        - key: kubernetes.io/hostname
+          operator: In
+          values:
+          - node-1
+          - node-2
+  podAntiAffinity:
+    requiredDuringSchedulingIgnoredDuringExecution:
+    - topologyKey: kubernetes.io/hostname
+replicaCount: 2
+`, got)
+
+	got, err = ChartValues(RegistryChart, "replicaCount: 1\n", p)
+	require.NoError(t, err)
+	assert.Equal(t, `affinity:
+  nodeAffinity:
+    requiredDuringSchedulingIgnoredDuringExecution:
+      nodeSelectorTerms:
+      - matchExpressions:
+        - key: kubernetes.io/hostname
+          operator: In
+          values:
+          - node-1
+          - node-2
+replicaCount: 1
+`, got)
+
+	got, err = ChartValues("velero", "a: b\n", p)
+	require.NoError(t, err)
+	assert.Equal(t, "a: b\n", got)
+
+	got, err = ChartValues(AdminConsoleChart, "a: b\n", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "a: b\n", got)
+}
+
+func TestMatches(t *testing.T) {
+	node := corev1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   "node-1",
+		Labels: map[string]string{corev1.LabelHostname: "node-1", "disk": "ssd"},
+	}}
+	assert.True(t, Matches(nil, node))
+	assert.True(t, Matches(&ecv1beta1.NodePlacement{Nodes: []string{"node-2", "node-1"}}, node))
+	assert.True(t, Matches(&ecv1beta1.NodePlacement{Nodes: []string{"node-1"}, NodeSelector: map[string]string{"disk": "ssd"}}, node))
+	assert.False(t, Matches(&ecv1beta1.NodePlacement{Nodes: []string{"node-2"}}, node))
+	assert.False(t, Matches(&ecv1beta1.NodePlacement{Nodes: []string{"node-1"}, NodeSelector: map[string]string{"disk": "hdd"}}, node))
+}
@@ -0,0 +1,172 @@
+// Package plugins finds the executables extending the commands of the installer, the
+// way kubectl plugins work: `<binary> app reindex`, when not a command of the installer,
+// runs the `<binary>-app-reindex` executable or, failing that, `<binary>-app` with
+// reindex as first argument. Plugins shipped in the release are looked up first, in the
+// directory they are materialized to, then the executables on PATH.
+package plugins
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// The environment variables set when running a plugin, in addition to KUBECONFIG when
+// the kubeconfig of the cluster is readable.
+const (
+	// BinaryEnv holds the path to the installer, plugins call it back for the commands
+	// of the installer.
+	BinaryEnv = "EMBEDDED_CLUSTER_BINARY"
+	// HomeEnv holds the directory where the installer stores its files.
+	HomeEnv = "EMBEDDED_CLUSTER_HOME"
+)
+
+// validName matches the names plugins can have. Words of the command are separated by
+// dashes, so names cannot lead anywhere else than the plugin directories.
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Plugin is an executable extending the commands of the installer.
+type Plugin struct {
+	// Name is the name of the plugin without the binary name prefix, dashes separate
+	// the words of the command it provides.
+	Name string `json:"name"`
+	// Path is the path to the executable.
+	Path string `json:"path"`
+	// Vendor tells if the plugin was shipped in the release.
+	Vendor bool `json:"vendor"`
+	// Shadowed tells if a plugin with the same name found earlier takes precedence.
+	Shadowed bool `json:"shadowed"`
+}
+
+// Command returns the command the plugin provides, without the binary name.
+func (p Plugin) Command() string {
+	return strings.ReplaceAll(p.Name, "-", " ")
+}
+
+// Finder looks plugins up.
+type Finder struct {
+	binName string
+	dir     string
+	path    string
+}
+
+// NewFinder returns a Finder for the plugins of binName, looked up in dir, where the
+// plugins of the release are materialized, and on PATH.
+func NewFinder(binName, dir string) *Finder {
+	return &Finder{binName: binName, dir: dir, path: os.Getenv("PATH")}
+}
+
+// Lookup returns the path to the plugin with the provided name.
+func (f *Finder) Lookup(name string) (string, bool) {
+	if !validName.MatchString(name) {
+		return "", false
+	}
+	if path := filepath.Join(f.dir, name); isExecutable(path) {
+		return path, true
+	}
+	for _, dir := range filepath.SplitList(f.path) {
+		if dir == "" {
+			continue
+		}
+		if path := filepath.Join(dir, fmt.Sprintf("%s-%s", f.binName, name)); isExecutable(path) {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// Resolve returns the plugin for the longest run of words, and the number of words it
+// consumed, the remaining ones are arguments of the plugin. builtin tells if the
+// words are handled by a command of the installer, plugins cannot replace them.
+func (f *Finder) Resolve(words []string, builtin func([]string) bool) (string, int, bool) {
+	for i := len(words); i > 0; i-- {
+		if builtin(words[:i]) {
+			return "", 0, false
+		}
+		if path, ok := f.Lookup(strings.Join(words[:i], "-")); ok {
+			return path, i, true
+		}
+	}
+	return "", 0, false
+}
+
+// List returns the plugins found, in the order they are looked up in.
+func (f *Finder) List() ([]Plugin, error) {
+	var found []Plugin
+	seen := map[string]bool{}
+	add := func(name, path string, vendor bool) {
+		if !validName.MatchString(name) || !isExecutable(path) {
+			return
+		}
+		found = append(found, Plugin{Name: name, Path: path, Vendor: vendor, Shadowed: seen[name]})
+		seen[name] = true
+	}
+
+	entries, err := os.ReadDir(f.dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to read plugins dir: %w", err)
+	}
+	for _, entry := range entries {
+		add(entry.Name(), filepath.Join(f.dir, entry.Name()), true)
+	}
+
+	prefix := fmt.Sprintf("%s-", f.binName)
+	for _, dir := range filepath.SplitList(f.path) {
+		if dir == "" {
+			continue
+		}
+		// directories on PATH may not exist or not be readable.
+		entries, _ := os.ReadDir(dir)
+		for _, entry := range entries {
+			if name, ok := strings.CutPrefix(entry.Name(), prefix); ok {
+				add(name, filepath.Join(dir, entry.Name()), false)
+			}
+		}
+	}
+	return found, nil
+}
+
+// Write writes the plugins shipped in the release to dir and removes the ones previous
+// releases shipped.
+func Write(dir string, plugins map[string][]byte) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("unable to create plugins dir: %w", err)
+	}
+	for name, content := range plugins {
+		if !validName.MatchString(name) {
+			return fmt.Errorf("invalid plugin name %q", name)
+		}
+		// written aside and renamed so a plugin running is not modified under its feet.
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path+".tmp", content, 0755); err != nil {
+			return fmt.Errorf("unable to write plugin %s: %w", name, err)
+		}
+		if err := os.Rename(path+".tmp", path); err != nil {
+			return fmt.Errorf("unable to write plugin %s: %w", name, err)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("unable to read plugins dir: %w", err)
+	}
+	for _, entry := range entries {
+		if _, ok := plugins[entry.Name()]; ok {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+			return fmt.Errorf("unable to remove plugin %s: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+// isExecutable tells if path is a regular file executable by someone.
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return info.Mode().IsRegular() && info.Mode().Perm()&0111 != 0
+}
@@ -0,0 +1,84 @@
+package plugins
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeExecutable(t *testing.T, path string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"), 0755))
+}
+
+func newTestFinder(t *testing.T) (*Finder, string, string) {
+	vendor, bin := t.TempDir(), t.TempDir()
+	return &Finder{binName: "myapp", dir: vendor, path: bin}, vendor, bin
+}
+
+func TestResolve(t *testing.T) {
+	finder, vendor, bin := newTestFinder(t)
+	writeExecutable(t, filepath.Join(vendor, "app-reindex"))
+	writeExecutable(t, filepath.Join(bin, "myapp-app-reindex"))
+	writeExecutable(t, filepath.Join(bin, "myapp-foo"))
+	writeExecutable(t, filepath.Join(bin, "myapp-install"))
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "myapp-notexec"), nil, 0644))
+	builtin := func(words []string) bool {
+		return words[0] == "install" || len(words) == 1 && words[0] == "app"
+	}
+
+	for _, tt := range []struct {
+		name     string
+		words    []string
+		wantPath string
+		wantUsed int
+	}{
+		{"vendor plugins come first", []string{"app", "reindex"}, filepath.Join(vendor, "app-reindex"), 2},
+		{"extra words are arguments", []string{"foo", "bar", "baz"}, filepath.Join(bin, "myapp-foo"), 1},
+		{"builtin commands win", []string{"install"}, "", 0},
+		{"builtin parent is not a plugin", []string{"app", "export"}, "", 0},
+		{"not executable", []string{"notexec"}, "", 0},
+		{"no path traversal", []string{"..", "bin"}, "", 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path, used, ok := finder.Resolve(tt.words, builtin)
+			assert.Equal(t, tt.wantPath != "", ok)
+			assert.Equal(t, tt.wantPath, path)
+			assert.Equal(t, tt.wantUsed, used)
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	finder, vendor, bin := newTestFinder(t)
+	writeExecutable(t, filepath.Join(vendor, "app-reindex"))
+	writeExecutable(t, filepath.Join(bin, "myapp-app-reindex"))
+	writeExecutable(t, filepath.Join(bin, "myapp-foo"))
+	writeExecutable(t, filepath.Join(bin, "other-bar"))
+
+	found, err := finder.List()
+	require.NoError(t, err)
+	assert.Equal(t, []Plugin{
+		{Name: "app-reindex", Path: filepath.Join(vendor, "app-reindex"), Vendor: true},
+		{Name: "app-reindex", Path: filepath.Join(bin, "myapp-app-reindex"), Shadowed: true},
+		{Name: "foo", Path: filepath.Join(bin, "myapp-foo")},
+	}, found)
+	assert.Equal(t, "app reindex", found[0].Command())
+}
+
+func TestWrite(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "plugins")
+	require.NoError(t, Write(dir, map[string][]byte{"old": []byte("#!/bin/sh\n")}))
+	require.NoError(t, Write(dir, map[string][]byte{"app-reindex": []byte("#!/bin/sh\n")}))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "app-reindex", entries[0].Name())
+	assert.True(t, isExecutable(filepath.Join(dir, "app-reindex")))
+
+	assert.ErrorContains(t, Write(dir, map[string][]byte{"../escape": nil}), "invalid plugin name")
+}
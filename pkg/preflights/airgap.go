@@ -0,0 +1,21 @@
+package preflights
+
+import (
+	"fmt"
+	"os"
+)
+
+// AirgapImagesDiskSpace returns the free space needed in the k0s directory to import the
+// image bundle found at the path into containerd, as a quantity rounded up to the MiB. An
+// empty string is returned if there is no image bundle to import, e.g. when the images
+// were pushed to a registry.
+func AirgapImagesDiskSpace(path string) (string, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("unable to stat image bundle: %w", err)
+	}
+	mib := (info.Size() + 1<<20 - 1) >> 20
+	return fmt.Sprintf("%dMi", mib), nil
+}
@@ -0,0 +1,24 @@
+package preflights
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAirgapImagesDiskSpace(t *testing.T) {
+	dir := t.TempDir()
+
+	got, err := AirgapImagesDiskSpace(filepath.Join(dir, "images-amd64.tar"))
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	bundle := filepath.Join(dir, "images-amd64.tar")
+	require.NoError(t, os.WriteFile(bundle, make([]byte, 3<<20+1), 0600))
+	got, err = AirgapImagesDiskSpace(bundle)
+	require.NoError(t, err)
+	assert.Equal(t, "4Mi", got)
+}
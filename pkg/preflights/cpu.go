@@ -0,0 +1,42 @@
+package preflights
+
+import (
+	"fmt"
+	"regexp"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+// baseMicroarchitecture is the x86-64 microarchitecture level every release requires, the
+// host preflights always check it on amd64 hosts.
+const baseMicroarchitecture = "x86-64-v2"
+
+// cpuFeatureRegex matches the flag names listed in /proc/cpuinfo. The names end up in a
+// shell command so nothing else is accepted.
+var cpuFeatureRegex = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// RequiredCPUFeatures returns the x86-64 microarchitecture level, on top of the base one,
+// and the CPU features the application declares it needs on hosts of the architecture.
+// An error is returned if a feature name is not a valid /proc/cpuinfo flag.
+func RequiredCPUFeatures(cfg *ecv1beta1.ConfigSpec, arch string) (string, []string, error) {
+	if cfg == nil || cfg.CPU == nil {
+		return "", nil, nil
+	}
+	var microarch string
+	var features []string
+	switch arch {
+	case "amd64":
+		if cfg.CPU.Microarchitecture != baseMicroarchitecture {
+			microarch = cfg.CPU.Microarchitecture
+		}
+		features = cfg.CPU.AMD64Features
+	case "arm64":
+		features = cfg.CPU.ARM64Features
+	}
+	for _, feature := range features {
+		if !cpuFeatureRegex.MatchString(feature) {
+			return "", nil, fmt.Errorf("invalid cpu feature %q", feature)
+		}
+	}
+	return microarch, features, nil
+}
@@ -0,0 +1,45 @@
+package preflights
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+func TestRequiredCPUFeatures(t *testing.T) {
+	cfg := &ecv1beta1.ConfigSpec{
+		CPU: &ecv1beta1.CPURequirements{
+			Microarchitecture: "x86-64-v3",
+			AMD64Features:     []string{"avx2"},
+			ARM64Features:     []string{"aes", "pmull"},
+		},
+	}
+
+	microarch, features, err := RequiredCPUFeatures(cfg, "amd64")
+	require.NoError(t, err)
+	assert.Equal(t, "x86-64-v3", microarch)
+	assert.Equal(t, []string{"avx2"}, features)
+
+	microarch, features, err = RequiredCPUFeatures(cfg, "arm64")
+	require.NoError(t, err)
+	assert.Empty(t, microarch)
+	assert.Equal(t, []string{"aes", "pmull"}, features)
+
+	// the base level is always checked.
+	cfg.CPU.Microarchitecture = "x86-64-v2"
+	microarch, _, err = RequiredCPUFeatures(cfg, "amd64")
+	require.NoError(t, err)
+	assert.Empty(t, microarch)
+
+	microarch, features, err = RequiredCPUFeatures(nil, "amd64")
+	require.NoError(t, err)
+	assert.Empty(t, microarch)
+	assert.Empty(t, features)
+
+	cfg.CPU.AMD64Features = []string{"avx2; reboot"}
+	_, _, err = RequiredCPUFeatures(cfg, "amd64")
+	assert.ErrorContains(t, err, `invalid cpu feature "avx2; reboot"`)
+}
@@ -5,6 +5,8 @@ import (
 	_ "embed"
 	"fmt"
 
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/storageplan"
 	"github.com/replicatedhq/troubleshoot/pkg/apis/troubleshoot/v1beta2"
 	"github.com/replicatedhq/troubleshoot/pkg/loader"
 )
@@ -13,6 +15,15 @@ import (
 var clusterHostPreflightYAML string
 
 func GetClusterHostPreflights(ctx context.Context, data TemplateData) ([]v1beta2.HostPreflight, error) {
+	if data.OpenEBSDataDir == "" {
+		data.OpenEBSDataDir = defaults.OpenEBSDataDir
+	}
+	if data.MinHostDiskSize == "" {
+		data.MinHostDiskSize = storageplan.MinHostDiskSize
+	}
+	if data.MinDataDiskSize == "" {
+		data.MinDataDiskSize = storageplan.MinDataDiskSize
+	}
 	spec, err := renderTemplate(clusterHostPreflightYAML, data)
 	if err != nil {
 		return nil, fmt.Errorf("render host preflight template: %w", err)
@@ -0,0 +1,428 @@
+package preflights
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFirewallRulesAnalyzer(t *testing.T) {
+	hpfs, err := GetClusterHostPreflights(context.Background(), TemplateData{
+		AdminConsolePort:        30000,
+		LocalArtifactMirrorPort: 50000,
+	})
+	require.NoError(t, err)
+
+	var regex string
+	for _, hpf := range hpfs {
+		for _, analyzer := range hpf.Spec.Analyzers {
+			if analyzer.TextAnalyze != nil && analyzer.TextAnalyze.CheckName == "Firewall Rules" {
+				regex = analyzer.TextAnalyze.RegexPattern
+			}
+		}
+	}
+	require.NotEmpty(t, regex, "firewall rules analyzer not found")
+	re, err := regexp.Compile(regex)
+	require.NoError(t, err)
+
+	for _, rule := range []string{
+		"tcp dport 6443 drop",
+		"tcp dport { 22, 30000 } counter packets 0 bytes 0 reject with icmpx admin-prohibited",
+		"udp dport 4789 DROP",
+		"-A INPUT -p tcp -m tcp --dport 10250 -j REJECT --reject-with icmp-port-unreachable",
+		"-A INPUT -p tcp --dport 50000 -j DROP",
+	} {
+		assert.True(t, re.MatchString(rule), rule)
+	}
+	for _, rule := range []string{
+		"tcp dport 64430 drop",
+		"tcp dport { 6443, 9443 } accept",
+		"tcp dport 22 drop",
+		"-A INPUT -p tcp -m tcp --dport 6443 -j ACCEPT",
+		"ct state invalid drop",
+	} {
+		assert.False(t, re.MatchString(rule), rule)
+	}
+}
+
+func TestClockSkewAnalyzer(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		data     TemplateData
+		excluded bool
+	}{
+		{name: "install", data: TemplateData{}, excluded: true},
+		{name: "join", data: TemplateData{IsJoin: true, ClockSkewSeconds: 12}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			hpfs, err := GetClusterHostPreflights(context.Background(), tt.data)
+			require.NoError(t, err)
+
+			var found bool
+			for _, hpf := range hpfs {
+				for _, collector := range hpf.Spec.Collectors {
+					if collector.HostRun == nil || collector.HostRun.CollectorName != "clock-skew" {
+						continue
+					}
+					found = true
+					assert.Equal(t, tt.excluded, collector.HostRun.Exclude.BoolOrDefaultFalse())
+					want := fmt.Sprintf("clock skew with the cluster: %ds", tt.data.ClockSkewSeconds)
+					assert.Contains(t, collector.HostRun.Args[1], want)
+				}
+				for _, analyzer := range hpf.Spec.Analyzers {
+					if analyzer.TextAnalyze == nil || analyzer.TextAnalyze.CheckName != "Clock Skew" {
+						continue
+					}
+					re, err := regexp.Compile(analyzer.TextAnalyze.RegexGroups)
+					require.NoError(t, err)
+					match := re.FindStringSubmatch("clock skew with the cluster: 12s\n")
+					require.Len(t, match, 2)
+					assert.Equal(t, "12", match[1])
+				}
+			}
+			assert.True(t, found, "clock skew collector not found")
+		})
+	}
+}
+
+func TestKernelModulesAnalyzers(t *testing.T) {
+	hpfs, err := GetClusterHostPreflights(context.Background(), TemplateData{
+		KernelModules: []string{"overlay", "vxlan"},
+	})
+	require.NoError(t, err)
+
+	var script string
+	regexes := map[string]string{}
+	for _, hpf := range hpfs {
+		for _, collector := range hpf.Spec.Collectors {
+			if collector.HostRun != nil && collector.HostRun.CollectorName == "kernel-modules" {
+				assert.False(t, collector.HostRun.Exclude.BoolOrDefaultFalse())
+				script = collector.HostRun.Args[1]
+			}
+		}
+		for _, analyzer := range hpf.Spec.Analyzers {
+			if analyzer.TextAnalyze != nil && strings.HasPrefix(analyzer.TextAnalyze.CheckName, "Kernel Module ") {
+				regexes[strings.TrimPrefix(analyzer.TextAnalyze.CheckName, "Kernel Module ")] = analyzer.TextAnalyze.RegexPattern
+			}
+		}
+	}
+	assert.Contains(t, script, "for m in overlay vxlan ;")
+	require.Len(t, regexes, 2)
+
+	output := "missing kernel module: vxlan\nkernel modules checked\n"
+	re, err := regexp.Compile(regexes["vxlan"])
+	require.NoError(t, err)
+	assert.True(t, re.MatchString(output))
+	re, err = regexp.Compile(regexes["overlay"])
+	require.NoError(t, err)
+	assert.False(t, re.MatchString(output))
+
+	// nothing is checked without modules.
+	hpfs, err = GetClusterHostPreflights(context.Background(), TemplateData{})
+	require.NoError(t, err)
+	for _, hpf := range hpfs {
+		for _, collector := range hpf.Spec.Collectors {
+			if collector.HostRun != nil && collector.HostRun.CollectorName == "kernel-modules" {
+				assert.True(t, collector.HostRun.Exclude.BoolOrDefaultFalse())
+			}
+		}
+	}
+}
+
+func TestCPUFeaturesAnalyzers(t *testing.T) {
+	hpfs, err := GetClusterHostPreflights(context.Background(), TemplateData{
+		SystemArchitecture:   "amd64",
+		CPUMicroarchitecture: "x86-64-v3",
+		CPUFeatures:          []string{"avx2", "aes"},
+	})
+	require.NoError(t, err)
+
+	var script string
+	var microarch []string
+	regexes := map[string]string{}
+	for _, hpf := range hpfs {
+		for _, collector := range hpf.Spec.Collectors {
+			if collector.HostRun != nil && collector.HostRun.CollectorName == "cpu-features" {
+				assert.False(t, collector.HostRun.Exclude.BoolOrDefaultFalse())
+				script = collector.HostRun.Args[1]
+			}
+		}
+		for _, analyzer := range hpf.Spec.Analyzers {
+			if analyzer.CPU != nil && analyzer.CPU.CheckName == "CPU Microarchitecture" {
+				microarch = append(microarch, analyzer.CPU.Outcomes[0].Pass.When)
+			}
+			if analyzer.TextAnalyze != nil && strings.HasPrefix(analyzer.TextAnalyze.CheckName, "CPU Feature ") {
+				regexes[strings.TrimPrefix(analyzer.TextAnalyze.CheckName, "CPU Feature ")] = analyzer.TextAnalyze.RegexPattern
+			}
+		}
+	}
+	assert.Contains(t, script, "for f in avx2 aes ;")
+	assert.Equal(t, []string{"supports x86-64-v3"}, microarch)
+	require.Len(t, regexes, 2)
+
+	output := "missing cpu feature: avx2\ncpu features checked\n"
+	re, err := regexp.Compile(regexes["avx2"])
+	require.NoError(t, err)
+	assert.True(t, re.MatchString(output))
+	re, err = regexp.Compile(regexes["aes"])
+	require.NoError(t, err)
+	assert.False(t, re.MatchString(output))
+
+	// nothing more is checked when the application declares no requirement.
+	hpfs, err = GetClusterHostPreflights(context.Background(), TemplateData{SystemArchitecture: "amd64"})
+	require.NoError(t, err)
+	for _, hpf := range hpfs {
+		for _, collector := range hpf.Spec.Collectors {
+			if collector.HostRun != nil && collector.HostRun.CollectorName == "cpu-features" {
+				assert.True(t, collector.HostRun.Exclude.BoolOrDefaultFalse())
+			}
+		}
+		for _, analyzer := range hpf.Spec.Analyzers {
+			if analyzer.CPU != nil {
+				assert.NotEqual(t, "CPU Microarchitecture", analyzer.CPU.CheckName)
+			}
+		}
+	}
+}
+
+func TestPageSizeAnalyzer(t *testing.T) {
+	for _, arch := range []string{"amd64", "arm64"} {
+		hpfs, err := GetClusterHostPreflights(context.Background(), TemplateData{SystemArchitecture: arch})
+		require.NoError(t, err)
+
+		var excluded bool
+		var regex string
+		for _, hpf := range hpfs {
+			for _, collector := range hpf.Spec.Collectors {
+				if collector.HostRun != nil && collector.HostRun.CollectorName == "page-size" {
+					excluded = collector.HostRun.Exclude.BoolOrDefaultFalse()
+				}
+			}
+			for _, analyzer := range hpf.Spec.Analyzers {
+				if analyzer.TextAnalyze != nil && analyzer.TextAnalyze.CheckName == "Kernel Page Size" {
+					regex = analyzer.TextAnalyze.RegexPattern
+				}
+			}
+		}
+		if arch == "amd64" {
+			assert.True(t, excluded)
+			assert.Empty(t, regex)
+			continue
+		}
+		assert.False(t, excluded)
+		re, err := regexp.Compile(regex)
+		require.NoError(t, err)
+		assert.True(t, re.MatchString("4096\n"))
+		assert.False(t, re.MatchString("65536\n"))
+	}
+}
+
+func TestAirgapImagesDiskSpaceAnalyzer(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		space string
+		want  []string
+	}{
+		{name: "images to import", space: "4Mi", want: []string{"available < 4Mi"}},
+		{name: "nothing to import"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			hpfs, err := GetClusterHostPreflights(context.Background(), TemplateData{AirgapImagesDiskSpace: tt.space})
+			require.NoError(t, err)
+			var got []string
+			for _, hpf := range hpfs {
+				for _, analyzer := range hpf.Spec.Analyzers {
+					if analyzer.DiskUsage != nil && analyzer.DiskUsage.CheckName == "Airgap Images Disk Space" {
+						got = append(got, analyzer.DiskUsage.Outcomes[0].Fail.When)
+					}
+				}
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestOpenEBSStorageAnalyzers(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		data     TemplateData
+		wantPath string
+		want     []string
+	}{
+		{name: "default directory", wantPath: "/var/openebs"},
+		{name: "separate filesystem", data: TemplateData{OpenEBSDataDir: "/mnt/volumes"}, wantPath: "/mnt/volumes"},
+		{name: "space reserved", data: TemplateData{OpenEBSRequiredSpace: "150Gi"}, wantPath: "/var/openebs", want: []string{"available < 150Gi"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			hpfs, err := GetClusterHostPreflights(context.Background(), tt.data)
+			require.NoError(t, err)
+			var path string
+			var got []string
+			for _, hpf := range hpfs {
+				for _, collector := range hpf.Spec.Collectors {
+					if collector.DiskUsage != nil && collector.DiskUsage.CollectorName == "openebs-path-usage" {
+						path = collector.DiskUsage.Path
+					}
+				}
+				for _, analyzer := range hpf.Spec.Analyzers {
+					if analyzer.DiskUsage != nil && analyzer.DiskUsage.CheckName == "OpenEBS Storage Reservation" {
+						got = append(got, analyzer.DiskUsage.Outcomes[0].Fail.When)
+					}
+				}
+			}
+			assert.Equal(t, tt.wantPath, path)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestContainerHostAnalyzers(t *testing.T) {
+	for _, tt := range []struct {
+		container   string
+		want        []string
+		unsupported bool
+	}{
+		{container: ""},
+		{container: "lxc", want: []string{"Container Kernel Log", "Container Kernel Settings", "Container AppArmor Profile", "Container Privileges"}},
+		{container: "docker", want: []string{"Container Host", "Container Kernel Log", "Container Kernel Settings", "Container AppArmor Profile", "Container Privileges"}},
+		{container: "openvz", want: []string{"Container Host", "Container Kernel Log", "Container Kernel Settings", "Container AppArmor Profile", "Container Privileges"}, unsupported: true},
+	} {
+		t.Run(tt.container, func(t *testing.T) {
+			hpfs, err := GetClusterHostPreflights(context.Background(), TemplateData{Container: tt.container})
+			require.NoError(t, err)
+
+			var excluded, unsupported bool
+			var checks []string
+			for _, hpf := range hpfs {
+				for _, collector := range hpf.Spec.Collectors {
+					if collector.HostRun != nil && collector.HostRun.CollectorName == "container-host" {
+						excluded = collector.HostRun.Exclude.BoolOrDefaultFalse()
+					}
+				}
+				for _, analyzer := range hpf.Spec.Analyzers {
+					if analyzer.TextAnalyze != nil && analyzer.TextAnalyze.FileName == "host-collectors/run-host/container-host.txt" {
+						checks = append(checks, analyzer.TextAnalyze.CheckName)
+						if analyzer.TextAnalyze.CheckName == "Container Host" {
+							unsupported = analyzer.TextAnalyze.Outcomes[0].Fail != nil
+						}
+						_, err := regexp.Compile(analyzer.TextAnalyze.RegexPattern)
+						assert.NoError(t, err)
+					}
+				}
+			}
+			assert.Equal(t, tt.container == "", excluded)
+			assert.Equal(t, tt.want, checks)
+			assert.Equal(t, tt.unsupported, unsupported)
+		})
+	}
+}
+
+func TestConntrackAnalyzers(t *testing.T) {
+	hpfs, err := GetClusterHostPreflights(context.Background(), TemplateData{ConntrackMax: 262144})
+	require.NoError(t, err)
+
+	var script string
+	regexes := map[string]string{}
+	for _, hpf := range hpfs {
+		for _, collector := range hpf.Spec.Collectors {
+			if collector.HostRun != nil && collector.HostRun.CollectorName == "conntrack" {
+				assert.False(t, collector.HostRun.Exclude.BoolOrDefaultFalse())
+				script = collector.HostRun.Args[1]
+			}
+		}
+		for _, analyzer := range hpf.Spec.Analyzers {
+			if analyzer.TextAnalyze != nil && strings.HasPrefix(analyzer.TextAnalyze.CheckName, "Connection Tracking Table ") {
+				regexes[analyzer.TextAnalyze.CheckName] = analyzer.TextAnalyze.RegexPattern
+			}
+		}
+	}
+	assert.Contains(t, script, `[ "$max" -lt 262144 ]`)
+	require.Len(t, regexes, 2)
+
+	output := "conntrack table nearly full: 200000/262144\nconntrack checked\n"
+	re, err := regexp.Compile(regexes["Connection Tracking Table Usage"])
+	require.NoError(t, err)
+	assert.True(t, re.MatchString(output))
+	re, err = regexp.Compile(regexes["Connection Tracking Table Size"])
+	require.NoError(t, err)
+	assert.False(t, re.MatchString(output))
+	assert.True(t, re.MatchString("conntrack table can not be resized\nconntrack checked\n"))
+
+	// nothing is checked without a size.
+	hpfs, err = GetClusterHostPreflights(context.Background(), TemplateData{})
+	require.NoError(t, err)
+	for _, hpf := range hpfs {
+		for _, collector := range hpf.Spec.Collectors {
+			if collector.HostRun != nil && collector.HostRun.CollectorName == "conntrack" {
+				assert.True(t, collector.HostRun.Exclude.BoolOrDefaultFalse())
+			}
+		}
+		for _, analyzer := range hpf.Spec.Analyzers {
+			if analyzer.TextAnalyze != nil {
+				assert.NotContains(t, analyzer.TextAnalyze.CheckName, "Connection Tracking")
+			}
+		}
+	}
+}
+
+func TestDiskBenchmarkAnalyzers(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		benchmark bool
+		want      []string
+	}{
+		{name: "disabled"},
+		{name: "enabled", benchmark: true, want: []string{"Etcd Disk Latency Under Load", "Etcd Disk IOPS"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			hpfs, err := GetClusterHostPreflights(context.Background(), TemplateData{DiskBenchmark: tt.benchmark})
+			require.NoError(t, err)
+			var collected bool
+			var got []string
+			for _, hpf := range hpfs {
+				for _, collector := range hpf.Spec.Collectors {
+					if fsp := collector.FilesystemPerformance; fsp != nil && fsp.CollectorName == "etcd-disk-benchmark" {
+						collected = fsp.EnableBackgroundIOPS
+					}
+				}
+				for _, analyzer := range hpf.Spec.Analyzers {
+					if fsp := analyzer.FilesystemPerformance; fsp != nil && fsp.CollectorName == "etcd-disk-benchmark" {
+						got = append(got, fsp.CheckName)
+					}
+					if ta := analyzer.TextAnalyze; ta != nil && ta.FileName == "host-collectors/filesystemPerformance/etcd-disk-benchmark.json" {
+						got = append(got, ta.CheckName)
+						// the collector output is the fio result marshaled by troubleshoot.
+						result := `{"jobs":[{"jobname":"fsperf","read":{"slat_ns":{},"iops_min":0},"write":{"io_bytes":23068672,"bw":375,"iops":612.34567,"runtime":16392,"clat_ns":{"min":1000}}}]}`
+						match := regexp.MustCompile(ta.RegexGroups).FindStringSubmatch(result)
+						require.Len(t, match, 2)
+						assert.Equal(t, "612", match[1])
+					}
+				}
+			}
+			assert.Equal(t, tt.benchmark, collected)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDiskSizeAnalyzers(t *testing.T) {
+	hpfs, err := GetClusterHostPreflights(context.Background(), TemplateData{})
+	require.NoError(t, err)
+	got := map[string]string{}
+	for _, hpf := range hpfs {
+		for _, analyzer := range hpf.Spec.Analyzers {
+			if analyzer.DiskUsage != nil {
+				got[analyzer.DiskUsage.CheckName] = analyzer.DiskUsage.Outcomes[0].Fail.When
+			}
+		}
+	}
+	assert.Equal(t, "total < 40Gi", got["Embedded Cluster Disk Space"])
+	assert.Equal(t, "total < 40Gi", got["k0s Disk Space"])
+	assert.Equal(t, "total < 5Gi", got["OpenEBS Disk Space"])
+	assert.Equal(t, "total < 5Gi", got["tmp Disk Space"])
+}
@@ -0,0 +1,53 @@
+package preflights
+
+import (
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+)
+
+// baseKernelModules are required by the container runtime and the kubelet whatever the
+// cluster configuration.
+var baseKernelModules = []string{"overlay", "br_netfilter", "nf_conntrack"}
+
+// RequiredKernelModules returns the kernel modules the node needs for the features
+// selected in the k0s configuration, so the preflights only check those. Modules only
+// needed by features that are not enabled, iscsi for instance as no storage option
+// relies on it, are not required. Storage is provided by the openebs local volumes,
+// which need no module.
+func RequiredKernelModules(cfg *k0sv1beta1.ClusterConfig) []string {
+	modules := append([]string{}, baseKernelModules...)
+	// calico is the network provider of the cluster unless configured otherwise.
+	network := &k0sv1beta1.Network{Provider: "calico"}
+	if cfg != nil && cfg.Spec != nil && cfg.Spec.Network != nil {
+		network = cfg.Spec.Network
+	}
+
+	if proxy := network.KubeProxy; proxy != nil && !proxy.Disabled {
+		switch proxy.Mode {
+		case "ipvs":
+			modules = append(modules, "ip_vs", "ip_vs_rr", "ip_vs_wrr", "ip_vs_sh")
+		case "nftables":
+			modules = append(modules, "nf_tables")
+		}
+	}
+
+	switch network.Provider {
+	case "calico":
+		calico := network.Calico
+		if calico == nil {
+			calico = k0sv1beta1.DefaultCalico()
+		}
+		switch calico.Mode {
+		case "", "vxlan":
+			modules = append(modules, "vxlan")
+		case "ipip":
+			modules = append(modules, "ipip")
+		}
+		if calico.EnableWireguard {
+			modules = append(modules, "wireguard")
+		}
+	case "kuberouter":
+		// the network policies are enforced with ip sets.
+		modules = append(modules, "ip_set")
+	}
+	return modules
+}
@@ -0,0 +1,66 @@
+package preflights
+
+import (
+	"testing"
+
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequiredKernelModules(t *testing.T) {
+	base := []string{"overlay", "br_netfilter", "nf_conntrack"}
+	for _, tt := range []struct {
+		name    string
+		network *k0sv1beta1.Network
+		want    []string
+	}{
+		{
+			name: "no network config",
+			want: append(base, "vxlan"),
+		},
+		{
+			name:    "calico defaults",
+			network: &k0sv1beta1.Network{Provider: "calico"},
+			want:    append(base, "vxlan"),
+		},
+		{
+			name: "calico vxlan with iptables kube-proxy",
+			network: &k0sv1beta1.Network{
+				Provider:  "calico",
+				Calico:    &k0sv1beta1.Calico{Mode: "vxlan"},
+				KubeProxy: &k0sv1beta1.KubeProxy{Mode: "iptables"},
+			},
+			want: append(base, "vxlan"),
+		},
+		{
+			name: "calico ipip with wireguard and ipvs kube-proxy",
+			network: &k0sv1beta1.Network{
+				Provider:  "calico",
+				Calico:    &k0sv1beta1.Calico{Mode: "ipip", EnableWireguard: true},
+				KubeProxy: &k0sv1beta1.KubeProxy{Mode: "ipvs"},
+			},
+			want: append(base, "ip_vs", "ip_vs_rr", "ip_vs_wrr", "ip_vs_sh", "ipip", "wireguard"),
+		},
+		{
+			name: "kube-router with kube-proxy disabled",
+			network: &k0sv1beta1.Network{
+				Provider:  "kuberouter",
+				KubeProxy: &k0sv1beta1.KubeProxy{Mode: "ipvs", Disabled: true},
+			},
+			want: append(base, "ip_set"),
+		},
+		{
+			name: "custom cni with nftables kube-proxy",
+			network: &k0sv1beta1.Network{
+				Provider:  "custom",
+				KubeProxy: &k0sv1beta1.KubeProxy{Mode: "nftables"},
+			},
+			want: append(base, "nf_tables"),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &k0sv1beta1.ClusterConfig{Spec: &k0sv1beta1.ClusterSpec{Network: tt.network}}
+			assert.Equal(t, tt.want, RequiredKernelModules(cfg))
+		})
+	}
+}
@@ -32,6 +32,15 @@ func (o Output) HasWarn() bool {
 	return len(o.Warn) > 0
 }
 
+// WarnTitles returns the titles of the preflight checks that returned a warning.
+func (o Output) WarnTitles() []string {
+	var titles []string
+	for _, record := range o.Warn {
+		titles = append(titles, record.Title)
+	}
+	return titles
+}
+
 // PrintTable prints the preflight output in a table format.
 func (o Output) PrintTable() {
 	o.printTable()
@@ -31,6 +31,15 @@ func SerializeSpec(spec *troubleshootv1beta2.HostPreflightSpec) ([]byte, error)
 	return yaml.Marshal(hpf)
 }
 
+// ExportSpec deduplicates the collectors and analyzers of the provided spec, the same way
+// Run does, and returns it serialized inside a HostPreflight object.
+func ExportSpec(spec *troubleshootv1beta2.HostPreflightSpec) ([]byte, error) {
+	exported := *spec
+	exported.Collectors = dedup(spec.Collectors)
+	exported.Analyzers = dedup(spec.Analyzers)
+	return SerializeSpec(&exported)
+}
+
 // Run runs the provided host preflight spec locally. This function is meant to be
 // used when upgrading a local node.
 func Run(ctx context.Context, spec *troubleshootv1beta2.HostPreflightSpec, proxy *ecv1beta1.ProxySpec) (*Output, string, error) {
@@ -8,7 +8,10 @@ import (
 
 	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
 	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	troubleshootv1beta2 "github.com/replicatedhq/troubleshoot/pkg/apis/troubleshoot/v1beta2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
 )
 
 func Test_proxyEnv(t *testing.T) {
@@ -187,3 +190,21 @@ func Test_pathEnv(t *testing.T) {
 		})
 	}
 }
+
+func TestExportSpec(t *testing.T) {
+	cpu := &troubleshootv1beta2.HostCollect{CPU: &troubleshootv1beta2.CPU{}}
+	memory := &troubleshootv1beta2.HostCollect{Memory: &troubleshootv1beta2.Memory{}}
+	spec := &troubleshootv1beta2.HostPreflightSpec{
+		Collectors: []*troubleshootv1beta2.HostCollect{cpu, memory, cpu},
+	}
+
+	data, err := ExportSpec(spec)
+	require.NoError(t, err)
+	assert.Len(t, spec.Collectors, 3, "the provided spec must not be modified")
+
+	var exported troubleshootv1beta2.HostPreflight
+	require.NoError(t, yaml.Unmarshal(data, &exported))
+	assert.Equal(t, "HostPreflight", exported.Kind)
+	assert.Equal(t, "embedded-cluster", exported.Name)
+	assert.Len(t, exported.Spec.Collectors, 2)
+}
@@ -9,11 +9,48 @@ import (
 
 type TemplateData struct {
 	IsAirgap                bool
+	IsFIPS                  bool
+	IsSELinuxEnforcing      bool
 	ReplicatedAPIURL        string
 	ProxyRegistryURL        string
 	AdminConsolePort        int
 	LocalArtifactMirrorPort int
 	SystemArchitecture      string
+	// Container is the container technology the host runs in, as returned by
+	// containerhost.Detect. Empty if the host is not a container.
+	Container string
+	// IsJoin indicates the node joins an existing cluster.
+	IsJoin bool
+	// ClockSkewSeconds is the difference, in seconds, between the clock of the joining
+	// node and the cluster clock.
+	ClockSkewSeconds int64
+	// KernelModules are the kernel modules required by the cluster configuration, as
+	// returned by RequiredKernelModules.
+	KernelModules []string
+	// CPUMicroarchitecture is the x86-64 microarchitecture level required by the application
+	// on top of the one always checked, and CPUFeatures the CPU flags it requires, as
+	// returned by RequiredCPUFeatures.
+	CPUMicroarchitecture string
+	CPUFeatures          []string
+	// AirgapImagesDiskSpace is the free space needed to import the airgap images into
+	// containerd, as returned by AirgapImagesDiskSpace. Empty if nothing is imported.
+	AirgapImagesDiskSpace string
+	// ConntrackMax is the size the connection tracking table gets at install time, as
+	// returned by conntrack.Max. The usage of the table is checked against it.
+	ConntrackMax int64
+	// OpenEBSDataDir is the directory where the persistent volumes are stored, the default
+	// one is used if empty. OpenEBSRequiredSpace is the free space needed there, as
+	// returned by storageplan.RequiredSpace. Empty if no space is reserved.
+	OpenEBSDataDir       string
+	OpenEBSRequiredSpace string
+	// MinHostDiskSize and MinDataDiskSize are the minimum sizes of the filesystems holding
+	// the cluster data and the persistent volumes, the storage plan defaults are used if
+	// empty.
+	MinHostDiskSize string
+	MinDataDiskSize string
+	// DiskBenchmark enables the benchmark of the etcd disk under load, checking its
+	// fsync latency and IOPS against the etcd recommendations.
+	DiskBenchmark bool
 }
 
 func renderTemplate(spec string, data TemplateData) (string, error) {
@@ -0,0 +1,220 @@
+// Package prereqs detects the operating system packages required by the cluster that
+// are missing on the host and installs them using the system package manager.
+package prereqs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+	"github.com/replicatedhq/embedded-cluster/pkg/selinux"
+)
+
+// OSReleasePath is the file the distribution is read from.
+var OSReleasePath = "/etc/os-release"
+
+// lookPath and packageInstalled are overwritten in tests.
+var (
+	lookPath         = exec.LookPath
+	packageInstalled = func(pkg string) bool {
+		_, err := helpers.RunCommand("rpm", "-q", pkg)
+		return err == nil
+	}
+)
+
+// Family groups distributions sharing the same package manager and package names.
+type Family string
+
+const (
+	// Unsupported is used for distributions whose package manager is not supported.
+	Unsupported Family = ""
+	// Debian covers Debian, Ubuntu and derivatives, packages are installed with apt-get.
+	Debian Family = "debian"
+	// RHEL covers RHEL, CentOS, Rocky, Alma, Oracle, Fedora and Amazon Linux, packages
+	// are installed with dnf or yum.
+	RHEL Family = "rhel"
+	// SUSE covers SLES and openSUSE, packages are installed with zypper.
+	SUSE Family = "suse"
+)
+
+// Distro is the distribution running on the host.
+type Distro struct {
+	ID     string
+	Family Family
+}
+
+// Prereq is an operating system package required by the cluster.
+type Prereq struct {
+	// Name is the name of the package.
+	Name string
+	// Commands holds the commands provided by the package. The prerequisite is met if
+	// any of them is found in PATH. Empty if the package provides no command.
+	Commands []string
+	// Families restricts the prerequisite to some distribution families. Empty means
+	// all of them.
+	Families []Family
+	// SELinux indicates the prerequisite is only required when SELinux is enforcing.
+	SELinux bool
+}
+
+// Prereqs holds the packages required by the cluster.
+var Prereqs = []Prereq{
+	{Name: "curl", Commands: []string{"curl"}},
+	{Name: "tar", Commands: []string{"tar"}},
+	{Name: "iptables", Commands: []string{"iptables", "nft"}},
+	{Name: "container-selinux", Families: []Family{RHEL}, SELinux: true},
+	{Name: "policycoreutils-python-utils", Commands: []string{"semanage"}, Families: []Family{RHEL}, SELinux: true},
+}
+
+// ReadOSRelease returns the key value pairs found in the os release file.
+func ReadOSRelease() (map[string]string, error) {
+	f, err := os.Open(OSReleasePath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read os release: %w", err)
+	}
+	defer f.Close()
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+		values[key] = strings.Trim(value, `"'`)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read os release: %w", err)
+	}
+	return values, nil
+}
+
+// DetectDistro reads the distribution running on the host.
+func DetectDistro() (Distro, error) {
+	values, err := ReadOSRelease()
+	if err != nil {
+		return Distro{}, err
+	}
+
+	distro := Distro{ID: values["ID"]}
+	ids := append([]string{values["ID"]}, strings.Fields(values["ID_LIKE"])...)
+	for _, id := range ids {
+		switch id {
+		case "debian", "ubuntu":
+			distro.Family = Debian
+		case "rhel", "centos", "fedora", "rocky", "almalinux", "ol", "amzn":
+			distro.Family = RHEL
+		case "suse", "sles", "opensuse", "opensuse-leap":
+			distro.Family = SUSE
+		}
+		if distro.Family != Unsupported {
+			break
+		}
+	}
+	return distro, nil
+}
+
+// Missing returns the prerequisites not met on the host.
+func Missing(distro Distro) []Prereq {
+	enforcing := selinux.Enforcing()
+	var missing []Prereq
+	for _, prereq := range Prereqs {
+		if prereq.SELinux && !enforcing {
+			continue
+		}
+		if len(prereq.Families) > 0 && !hasFamily(prereq.Families, distro.Family) {
+			continue
+		}
+		if !met(prereq) {
+			missing = append(missing, prereq)
+		}
+	}
+	return missing
+}
+
+// Install installs the provided prerequisites using the package manager of the
+// distribution.
+func Install(distro Distro, prereqs []Prereq) error {
+	if len(prereqs) == 0 {
+		return nil
+	}
+	manager, args, err := installCommand(distro, prereqs)
+	if err != nil {
+		return err
+	}
+	opts := helpers.RunCommandOptions{}
+	if distro.Family == Debian {
+		opts.Env = map[string]string{"DEBIAN_FRONTEND": "noninteractive"}
+		if err := helpers.RunCommandWithOptions(opts, manager, "update"); err != nil {
+			return fmt.Errorf("unable to update package lists: %w", err)
+		}
+	}
+	if err := helpers.RunCommandWithOptions(opts, manager, args...); err != nil {
+		return fmt.Errorf("unable to install %s: %w", strings.Join(Names(prereqs), ", "), err)
+	}
+	return nil
+}
+
+// InstallCommand returns the command users can run to install the provided
+// prerequisites. A generic message is returned for unsupported distributions.
+func InstallCommand(distro Distro, prereqs []Prereq) string {
+	manager, args, err := installCommand(distro, prereqs)
+	if err != nil {
+		return fmt.Sprintf("install %s using the package manager of your distribution", strings.Join(Names(prereqs), ", "))
+	}
+	return fmt.Sprintf("%s %s", manager, strings.Join(args, " "))
+}
+
+// Names returns the names of the provided prerequisites.
+func Names(prereqs []Prereq) []string {
+	var names []string
+	for _, prereq := range prereqs {
+		names = append(names, prereq.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func installCommand(distro Distro, prereqs []Prereq) (string, []string, error) {
+	names := Names(prereqs)
+	switch distro.Family {
+	case Debian:
+		return "apt-get", append([]string{"install", "-y"}, names...), nil
+	case RHEL:
+		manager := "dnf"
+		if _, err := lookPath("dnf"); err != nil {
+			manager = "yum"
+		}
+		return manager, append([]string{"install", "-y"}, names...), nil
+	case SUSE:
+		return "zypper", append([]string{"--non-interactive", "install"}, names...), nil
+	}
+	return "", nil, fmt.Errorf("unsupported distribution %q", distro.ID)
+}
+
+// met returns true if any of the commands provided by the prerequisite is found in
+// PATH or, for packages providing no command, if the package is installed.
+func met(prereq Prereq) bool {
+	if len(prereq.Commands) == 0 {
+		return packageInstalled(prereq.Name)
+	}
+	for _, command := range prereq.Commands {
+		if _, err := lookPath(command); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func hasFamily(families []Family, family Family) bool {
+	for _, f := range families {
+		if f == family {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package prereqs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/selinux"
+)
+
+func TestDetectDistro(t *testing.T) {
+	original := OSReleasePath
+	defer func() { OSReleasePath = original }()
+
+	for _, tt := range []struct {
+		name      string
+		osRelease string
+		want      Distro
+	}{
+		{
+			name:      "ubuntu",
+			osRelease: "NAME=\"Ubuntu\"\nID=ubuntu\nID_LIKE=debian\nVERSION_ID=\"22.04\"\n",
+			want:      Distro{ID: "ubuntu", Family: Debian},
+		},
+		{
+			name:      "rocky",
+			osRelease: "NAME=\"Rocky Linux\"\nID=\"rocky\"\nID_LIKE=\"rhel centos fedora\"\n",
+			want:      Distro{ID: "rocky", Family: RHEL},
+		},
+		{
+			name:      "derivative",
+			osRelease: "ID=mydistro\nID_LIKE=\"ubuntu debian\"\n",
+			want:      Distro{ID: "mydistro", Family: Debian},
+		},
+		{
+			name:      "sles",
+			osRelease: "ID=\"sles\"\nID_LIKE=\"suse\"\n",
+			want:      Distro{ID: "sles", Family: SUSE},
+		},
+		{
+			name:      "unsupported",
+			osRelease: "ID=alpine\n",
+			want:      Distro{ID: "alpine"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			OSReleasePath = filepath.Join(t.TempDir(), "os-release")
+			require.NoError(t, os.WriteFile(OSReleasePath, []byte(tt.osRelease), 0644))
+			distro, err := DetectDistro()
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, distro)
+		})
+	}
+
+	OSReleasePath = filepath.Join(t.TempDir(), "missing")
+	_, err := DetectDistro()
+	assert.Error(t, err)
+}
+
+func TestMissing(t *testing.T) {
+	originalLookPath, originalInstalled := lookPath, packageInstalled
+	originalEnforce := selinux.EnforcePath
+	defer func() {
+		lookPath, packageInstalled = originalLookPath, originalInstalled
+		selinux.EnforcePath = originalEnforce
+	}()
+
+	available := map[string]bool{"curl": true, "nft": true}
+	lookPath = func(file string) (string, error) {
+		if available[file] {
+			return "/usr/bin/" + file, nil
+		}
+		return "", fmt.Errorf("%s not found", file)
+	}
+	packageInstalled = func(pkg string) bool { return false }
+
+	selinux.EnforcePath = filepath.Join(t.TempDir(), "enforce")
+	missing := Missing(Distro{ID: "rocky", Family: RHEL})
+	assert.Equal(t, []string{"tar"}, Names(missing))
+
+	require.NoError(t, os.WriteFile(selinux.EnforcePath, []byte("1"), 0644))
+	missing = Missing(Distro{ID: "rocky", Family: RHEL})
+	assert.Equal(t, []string{"container-selinux", "policycoreutils-python-utils", "tar"}, Names(missing))
+
+	missing = Missing(Distro{ID: "ubuntu", Family: Debian})
+	assert.Equal(t, []string{"tar"}, Names(missing))
+}
+
+func TestInstallCommand(t *testing.T) {
+	original := lookPath
+	defer func() { lookPath = original }()
+	lookPath = func(file string) (string, error) { return "", fmt.Errorf("not found") }
+
+	prereqs := []Prereq{{Name: "tar"}, {Name: "curl"}}
+	assert.Equal(t, "apt-get install -y curl tar", InstallCommand(Distro{Family: Debian}, prereqs))
+	assert.Equal(t, "yum install -y curl tar", InstallCommand(Distro{Family: RHEL}, prereqs))
+	assert.Equal(t, "zypper --non-interactive install curl tar", InstallCommand(Distro{Family: SUSE}, prereqs))
+	assert.Contains(t, InstallCommand(Distro{ID: "alpine"}, prereqs), "install curl, tar using the package manager")
+}
@@ -0,0 +1,146 @@
+// Package privileges checks the privileges a command needs before it runs, so it fails
+// upfront telling exactly which privilege is missing instead of failing halfway through
+// with a permission error.
+package privileges
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	ecerrors "github.com/replicatedhq/embedded-cluster/pkg/errors"
+)
+
+// Capability is a linux capability, its value is its bit in the capability sets.
+type Capability uint
+
+const (
+	CapChown       Capability = 0
+	CapDACOverride Capability = 1
+	CapNetAdmin    Capability = 12
+	CapSysModule   Capability = 16
+	CapSysAdmin    Capability = 21
+)
+
+var capabilityNames = map[Capability]string{
+	CapChown:       "CAP_CHOWN",
+	CapDACOverride: "CAP_DAC_OVERRIDE",
+	CapNetAdmin:    "CAP_NET_ADMIN",
+	CapSysModule:   "CAP_SYS_MODULE",
+	CapSysAdmin:    "CAP_SYS_ADMIN",
+}
+
+func (c Capability) String() string {
+	if name, ok := capabilityNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("CAP_%d", uint(c))
+}
+
+// procStatusPath is the file the capabilities of the process are read from.
+var procStatusPath = "/proc/self/status"
+
+// Requirement is a privilege a command needs.
+type Requirement struct {
+	// check returns an error describing the missing privilege.
+	check func() error
+}
+
+// Root requires the command to run as root.
+func Root() Requirement {
+	return Requirement{check: func() error {
+		if uid := os.Geteuid(); uid != 0 {
+			return fmt.Errorf("it must run as root but runs as uid %d", uid)
+		}
+		return nil
+	}}
+}
+
+// Capabilities requires the capabilities to be in the effective set of the process. Root
+// does not hold all capabilities in containers or under restricted systemd units.
+func Capabilities(caps ...Capability) Requirement {
+	return Requirement{check: func() error {
+		f, err := os.Open(procStatusPath)
+		if err != nil {
+			return fmt.Errorf("unable to read the capabilities of the process: %w", err)
+		}
+		defer f.Close()
+		effective, err := effectiveCapabilities(f)
+		if err != nil {
+			return fmt.Errorf("unable to read the capabilities of the process: %w", err)
+		}
+		var missing []string
+		for _, c := range caps {
+			if effective&(1<<c) == 0 {
+				missing = append(missing, c.String())
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("it needs the %s capabilities", strings.Join(missing, ", "))
+		}
+		return nil
+	}}
+}
+
+// Readable requires read access to the path. Paths that do not exist are left to the
+// command to report.
+func Readable(path string) Requirement {
+	return access(path, unix.R_OK, "read")
+}
+
+// Writable requires write access to the path. Paths that do not exist are left to the
+// command to report.
+func Writable(path string) Requirement {
+	return access(path, unix.W_OK, "write")
+}
+
+func access(path string, mode uint32, what string) Requirement {
+	return Requirement{check: func() error {
+		err := unix.Faccessat(unix.AT_FDCWD, path, mode, unix.AT_EACCESS)
+		if err == nil || errors.Is(err, unix.ENOENT) {
+			return nil
+		}
+		return fmt.Errorf("it needs %s access to %s: %w", what, path, err)
+	}}
+}
+
+// Check returns an error listing the privileges the command is missing, nil if it holds
+// all of them.
+func Check(command string, reqs ...Requirement) error {
+	var missing []string
+	for _, req := range reqs {
+		if err := req.check(); err != nil {
+			missing = append(missing, err.Error())
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return ecerrors.Errorf(ecerrors.Privileges, "%s command is missing privileges, %s", command, strings.Join(missing, " and "))
+}
+
+// effectiveCapabilities parses the effective capability set out of a proc status file.
+func effectiveCapabilities(r io.Reader) (uint64, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), "CapEff:")
+		if !ok {
+			continue
+		}
+		caps, err := strconv.ParseUint(strings.TrimSpace(value), 16, 64)
+		if err != nil {
+			return 0, fmt.Errorf("unable to parse effective capabilities: %w", err)
+		}
+		return caps, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("effective capabilities not found")
+}
@@ -0,0 +1,52 @@
+package privileges
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	ecerrors "github.com/replicatedhq/embedded-cluster/pkg/errors"
+)
+
+func TestEffectiveCapabilities(t *testing.T) {
+	status := "Name:\tstatus\nCapInh:\t0000000000000000\nCapPrm:\t000001ffffffffff\nCapEff:\t0000000000201000\n"
+	caps, err := effectiveCapabilities(strings.NewReader(status))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1<<CapSysAdmin|1<<CapNetAdmin), caps)
+
+	_, err = effectiveCapabilities(strings.NewReader("Name:\tstatus\n"))
+	assert.EqualError(t, err, "effective capabilities not found")
+}
+
+func TestCapabilities(t *testing.T) {
+	procStatusPath = filepath.Join(t.TempDir(), "status")
+	t.Cleanup(func() { procStatusPath = "/proc/self/status" })
+	require.NoError(t, os.WriteFile(procStatusPath, []byte("CapEff:\t0000000000001001\n"), 0644))
+
+	assert.NoError(t, Check("test", Capabilities(CapChown, CapNetAdmin)))
+
+	err := Check("test", Capabilities(CapChown, CapSysAdmin, CapSysModule))
+	assert.EqualError(t, err, "test command is missing privileges, it needs the CAP_SYS_ADMIN, CAP_SYS_MODULE capabilities")
+	assert.Equal(t, ecerrors.Privileges, ecerrors.KindOf(err))
+}
+
+func TestAccess(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "admin.conf")
+	require.NoError(t, os.WriteFile(path, []byte("kubeconfig"), 0600))
+
+	assert.NoError(t, Check("test", Readable(path), Writable(path)))
+	// missing files are reported by the commands.
+	assert.NoError(t, Check("test", Readable(filepath.Join(dir, "missing"))))
+
+	if os.Geteuid() == 0 {
+		t.Skip("root has access to all files")
+	}
+	require.NoError(t, os.Chmod(path, 0))
+	err := Check("test", Readable(path), Writable(path))
+	assert.EqualError(t, err, "test command is missing privileges, it needs read access to "+path+": permission denied and it needs write access to "+path+": permission denied")
+}
@@ -0,0 +1,194 @@
+// Package pullsecrets propagates registry credentials provided by the end user to the
+// namespaces of the application. The credentials are stored at install time as secrets in
+// the embedded cluster namespace, the operator copies them to the target namespaces and
+// adds them to the image pull secrets of the target service accounts.
+package pullsecrets
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+const (
+	// AllNamespaces selects every namespace but the system ones.
+	AllNamespaces = "*"
+	// ManagedLabel marks the secrets copied by the operator, only those are updated.
+	ManagedLabel = "embeddedcluster.replicated.com/image-pull-secret"
+	// SourcePrefix prefixes the names of the secrets holding the credentials in the
+	// embedded cluster namespace, so they do not collide with the secrets of the cluster.
+	SourcePrefix = "image-pull-secret-"
+)
+
+// SourceName returns the name of the secret holding the credential of the image pull
+// secret in the embedded cluster namespace.
+func SourceName(name string) string {
+	return SourcePrefix + name
+}
+
+// Credential is a registry credential provided in the install config file.
+type Credential struct {
+	// Name is the name of the secret created in each namespace.
+	Name string `json:"name"`
+	// Registry is the host, with an optional port, of the registry.
+	Registry string `json:"registry"`
+	// Username and Password authenticate against the registry.
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Namespaces are the namespaces the secret is created in, "*" for all of them but the
+	// system ones.
+	Namespaces []string `json:"namespaces"`
+	// ServiceAccounts are the service accounts the secret is added to.
+	ServiceAccounts []string `json:"serviceAccounts,omitempty"`
+}
+
+// Validate verifies the credentials can be turned into image pull secrets.
+func Validate(creds []Credential) error {
+	seen := map[string]bool{}
+	for _, cred := range creds {
+		if errs := validation.IsDNS1123Subdomain(cred.Name); len(errs) > 0 {
+			return fmt.Errorf("image pull secret name %q is invalid: %s", cred.Name, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsDNS1123Subdomain(SourceName(cred.Name)); len(errs) > 0 {
+			return fmt.Errorf("image pull secret name %q is too long: %s", cred.Name, strings.Join(errs, ", "))
+		}
+		if seen[cred.Name] {
+			return fmt.Errorf("image pull secret %s is defined more than once", cred.Name)
+		}
+		seen[cred.Name] = true
+		if cred.Registry == "" || strings.ContainsAny(cred.Registry, "/ ") {
+			return fmt.Errorf("image pull secret %s registry %q must be a host with an optional port", cred.Name, cred.Registry)
+		}
+		if cred.Username == "" || cred.Password == "" {
+			return fmt.Errorf("image pull secret %s requires a username and a password", cred.Name)
+		}
+		if len(cred.Namespaces) == 0 {
+			return fmt.Errorf("image pull secret %s has no namespaces", cred.Name)
+		}
+		for _, ns := range cred.Namespaces {
+			if ns == AllNamespaces {
+				continue
+			}
+			if errs := validation.IsDNS1123Label(ns); len(errs) > 0 {
+				return fmt.Errorf("image pull secret %s namespace %q is invalid: %s", cred.Name, ns, strings.Join(errs, ", "))
+			}
+		}
+		for _, sa := range cred.ServiceAccounts {
+			if errs := validation.IsDNS1123Subdomain(sa); len(errs) > 0 {
+				return fmt.Errorf("image pull secret %s service account %q is invalid: %s", cred.Name, sa, strings.Join(errs, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// Spec returns the installation spec of the credential, the credential itself is left out
+// as it is kept in the source secret.
+func Spec(cred Credential) ecv1beta1.ImagePullSecret {
+	return ecv1beta1.ImagePullSecret{
+		Name:            cred.Name,
+		Namespaces:      cred.Namespaces,
+		ServiceAccounts: cred.ServiceAccounts,
+	}
+}
+
+// DockerConfigJSON returns the content of a kubernetes.io/dockerconfigjson secret
+// authenticating against the registry.
+func DockerConfigJSON(registry, username, password string) ([]byte, error) {
+	auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	config := map[string]interface{}{
+		"auths": map[string]interface{}{
+			registry: map[string]string{
+				"username": username,
+				"password": password,
+				"auth":     auth,
+			},
+		},
+	}
+	return json.Marshal(config)
+}
+
+// SourceSecret returns the secret holding the credential in the provided namespace, the
+// operator copies it from there.
+func SourceSecret(cred Credential, namespace string) (*corev1.Secret, error) {
+	data, err := DockerConfigJSON(cred.Registry, cred.Username, cred.Password)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal docker config: %w", err)
+	}
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{Kind: "Secret", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      SourceName(cred.Name),
+			Namespace: namespace,
+		},
+		Type: corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{corev1.DockerConfigJsonKey: data},
+	}, nil
+}
+
+// SystemNamespaces are the namespaces of the kubernetes components, AllNamespaces does not
+// select them. They can still be listed explicitly.
+var SystemNamespaces = []string{"kube-system", "kube-public", "kube-node-lease"}
+
+// Selects returns true if the secret is copied to the namespace.
+func Selects(spec ecv1beta1.ImagePullSecret, namespace string) bool {
+	for _, ns := range spec.Namespaces {
+		if ns == namespace {
+			return true
+		} else if ns == AllNamespaces && !slices.Contains(SystemNamespaces, namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// Copy returns the copy of the source secret in the namespace, named after the image pull
+// secret.
+func Copy(source corev1.Secret, name, namespace string) *corev1.Secret {
+	data := map[string][]byte{}
+	for k, v := range source.Data {
+		data[k] = v
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{ManagedLabel: "true"},
+		},
+		Type: source.Type,
+		Data: data,
+	}
+}
+
+// RemoveFromServiceAccount removes the secret from the image pull secrets of the service
+// account. Returns true if the service account changed.
+func RemoveFromServiceAccount(sa *corev1.ServiceAccount, name string) bool {
+	refs := slices.DeleteFunc(slices.Clone(sa.ImagePullSecrets), func(ref corev1.LocalObjectReference) bool {
+		return ref.Name == name
+	})
+	if len(refs) == len(sa.ImagePullSecrets) {
+		return false
+	}
+	sa.ImagePullSecrets = refs
+	return true
+}
+
+// AddToServiceAccount adds the secret to the image pull secrets of the service account.
+// Returns true if the service account changed.
+func AddToServiceAccount(sa *corev1.ServiceAccount, name string) bool {
+	for _, ref := range sa.ImagePullSecrets {
+		if ref.Name == name {
+			return false
+		}
+	}
+	sa.ImagePullSecrets = append(sa.ImagePullSecrets, corev1.LocalObjectReference{Name: name})
+	return true
+}
@@ -0,0 +1,106 @@
+package pullsecrets
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+func TestValidate(t *testing.T) {
+	valid := func() Credential {
+		return Credential{
+			Name:            "corp-registry",
+			Registry:        "registry.corp.example.com:5000",
+			Username:        "user",
+			Password:        "pass",
+			Namespaces:      []string{"my-app"},
+			ServiceAccounts: []string{"default"},
+		}
+	}
+	for name, tt := range map[string]struct {
+		mutate  func(c *Credential)
+		wantErr string
+	}{
+		"valid":               {mutate: func(c *Credential) {}},
+		"all namespaces":      {mutate: func(c *Credential) { c.Namespaces = []string{"*"} }},
+		"invalid name":        {mutate: func(c *Credential) { c.Name = "Corp_Registry" }, wantErr: "name"},
+		"name too long":       {mutate: func(c *Credential) { c.Name = strings.Repeat("a", 250) }, wantErr: "too long"},
+		"registry with path":  {mutate: func(c *Credential) { c.Registry = "registry.example.com/team" }, wantErr: "must be a host"},
+		"missing password":    {mutate: func(c *Credential) { c.Password = "" }, wantErr: "username and a password"},
+		"no namespaces":       {mutate: func(c *Credential) { c.Namespaces = nil }, wantErr: "no namespaces"},
+		"invalid namespace":   {mutate: func(c *Credential) { c.Namespaces = []string{"my.app"} }, wantErr: "namespace"},
+		"invalid service acc": {mutate: func(c *Credential) { c.ServiceAccounts = []string{"Default"} }, wantErr: "service account"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cred := valid()
+			tt.mutate(&cred)
+			err := Validate([]Credential{cred})
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+
+	err := Validate([]Credential{valid(), valid()})
+	assert.ErrorContains(t, err, "more than once")
+}
+
+func TestSourceSecret(t *testing.T) {
+	cred := Credential{Name: "corp-registry", Registry: "registry.corp.example.com", Username: "user", Password: "pass"}
+	secret, err := SourceSecret(cred, "embedded-cluster")
+	require.NoError(t, err)
+	assert.Equal(t, corev1.SecretTypeDockerConfigJson, secret.Type)
+	assert.Equal(t, "embedded-cluster", secret.Namespace)
+	assert.Equal(t, "image-pull-secret-corp-registry", secret.Name)
+
+	var config struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}
+	require.NoError(t, json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &config))
+	assert.Equal(t, "dXNlcjpwYXNz", config.Auths["registry.corp.example.com"].Auth)
+
+	cp := Copy(*secret, cred.Name, "my-app")
+	assert.Equal(t, "my-app", cp.Namespace)
+	assert.Equal(t, "corp-registry", cp.Name)
+	assert.Equal(t, secret.Data, cp.Data)
+	assert.Equal(t, "true", cp.Labels[ManagedLabel])
+}
+
+func TestSelects(t *testing.T) {
+	spec := ecv1beta1.ImagePullSecret{Name: "corp-registry", Namespaces: []string{"my-app", "other"}}
+	assert.True(t, Selects(spec, "my-app"))
+	assert.False(t, Selects(spec, "kotsadm"))
+	spec.Namespaces = []string{AllNamespaces}
+	assert.True(t, Selects(spec, "kotsadm"))
+
+	// system namespaces must be listed explicitly.
+	assert.False(t, Selects(spec, "kube-system"))
+	assert.False(t, Selects(spec, "kube-public"))
+	spec.Namespaces = []string{AllNamespaces, "kube-system"}
+	assert.True(t, Selects(spec, "kube-system"))
+	assert.False(t, Selects(spec, "kube-public"))
+}
+
+func TestRemoveFromServiceAccount(t *testing.T) {
+	sa := corev1.ServiceAccount{ImagePullSecrets: []corev1.LocalObjectReference{{Name: "other"}, {Name: "corp-registry"}}}
+	assert.True(t, RemoveFromServiceAccount(&sa, "corp-registry"))
+	assert.Equal(t, []corev1.LocalObjectReference{{Name: "other"}}, sa.ImagePullSecrets)
+	assert.False(t, RemoveFromServiceAccount(&sa, "corp-registry"))
+}
+
+func TestAddToServiceAccount(t *testing.T) {
+	sa := corev1.ServiceAccount{ImagePullSecrets: []corev1.LocalObjectReference{{Name: "other"}}}
+	assert.True(t, AddToServiceAccount(&sa, "corp-registry"))
+	assert.False(t, AddToServiceAccount(&sa, "corp-registry"))
+	assert.Equal(t, []corev1.LocalObjectReference{{Name: "other"}, {Name: "corp-registry"}}, sa.ImagePullSecrets)
+}
@@ -0,0 +1,177 @@
+// Package registrymirror configures containerd to pull images through registry mirrors
+// or pull-through caches. Each mirrored registry gets a hosts.toml file, in the hosts.d
+// format understood by containerd, listing its mirrors in order of preference. The
+// registry itself is tried last.
+package registrymirror
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+)
+
+// DefaultRegistry configures the mirrors of the registries without their own configuration.
+const DefaultRegistry = "_default"
+
+// containerdConfigTemplate points containerd to the hosts.d directory, it is imported by
+// the configuration k0s generates for containerd.
+const containerdConfigTemplate = `[plugins."io.containerd.grpc.v1.cri".registry]
+  config_path = %q
+`
+
+// HostsDir returns the directory holding the hosts.toml file of each mirrored registry.
+func HostsDir() string {
+	return filepath.Join(defaults.PathToK0sContainerdConfig(), "hosts.d")
+}
+
+// Validate verifies the mirrors can be turned into a containerd configuration. Passwords
+// kept in the registry mirrors secret must have been read already.
+func Validate(mirrors []ecv1beta1.RegistryMirror) error {
+	seen := map[string]bool{}
+	for _, mirror := range mirrors {
+		if mirror.Registry == "" {
+			return fmt.Errorf("registry mirror without a registry")
+		}
+		if strings.ContainsAny(mirror.Registry, "/ ") {
+			return fmt.Errorf("registry %q must be a host with an optional port", mirror.Registry)
+		}
+		if seen[mirror.Registry] {
+			return fmt.Errorf("registry %s is mirrored more than once", mirror.Registry)
+		}
+		seen[mirror.Registry] = true
+		if len(mirror.Endpoints) == 0 {
+			return fmt.Errorf("registry %s has no mirror endpoints", mirror.Registry)
+		}
+		for _, endpoint := range mirror.Endpoints {
+			u, err := url.Parse(endpoint.URL)
+			if err != nil {
+				return fmt.Errorf("registry %s mirror %q: %w", mirror.Registry, endpoint.URL, err)
+			}
+			if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("registry %s mirror %q must be an http or https url", mirror.Registry, endpoint.URL)
+			}
+			if endpoint.Password != "" && endpoint.Username == "" {
+				return fmt.Errorf("registry %s mirror %s has a password but no username", mirror.Registry, endpoint.URL)
+			}
+			if endpoint.PasswordSecretKey != "" && endpoint.Password == "" {
+				return fmt.Errorf("registry %s mirror %s password was not read from the registry mirrors secret", mirror.Registry, endpoint.URL)
+			}
+			if endpoint.CA != "" {
+				if block, _ := pem.Decode([]byte(endpoint.CA)); block == nil {
+					return fmt.Errorf("registry %s mirror %s ca is not PEM encoded", mirror.Registry, endpoint.URL)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// server returns the upstream url of the registry, nothing is returned for the default
+// registry as the upstream depends on the image.
+func server(registry string) string {
+	switch registry {
+	case DefaultRegistry:
+		return ""
+	case "docker.io":
+		return "https://registry-1.docker.io"
+	}
+	return "https://" + registry
+}
+
+// caPath returns the path to the certificate authority of the endpoint at the index.
+func caPath(dir string, index int) string {
+	return filepath.Join(dir, fmt.Sprintf("mirror-%d-ca.crt", index))
+}
+
+// HostsTOML returns the hosts.toml of the mirror, certificate authorities are referenced
+// from the provided registry directory.
+func HostsTOML(mirror ecv1beta1.RegistryMirror, dir string) string {
+	var sb strings.Builder
+	if srv := server(mirror.Registry); srv != "" {
+		fmt.Fprintf(&sb, "server = %q\n", srv)
+	}
+	for i, endpoint := range mirror.Endpoints {
+		fmt.Fprintf(&sb, "\n[host.%q]\n", endpoint.URL)
+		sb.WriteString("  capabilities = [\"pull\", \"resolve\"]\n")
+		if endpoint.CA != "" {
+			fmt.Fprintf(&sb, "  ca = %q\n", caPath(dir, i))
+		}
+		if endpoint.InsecureSkipVerify {
+			sb.WriteString("  skip_verify = true\n")
+		}
+		if endpoint.Username != "" {
+			auth := base64.StdEncoding.EncodeToString([]byte(endpoint.Username + ":" + endpoint.Password))
+			fmt.Fprintf(&sb, "  [host.%q.header]\n", endpoint.URL)
+			fmt.Fprintf(&sb, "    Authorization = [%q]\n", "Basic "+auth)
+		}
+	}
+	return sb.String()
+}
+
+// File is a file of the containerd configuration.
+type File struct {
+	Path string
+	Data string
+	Mode os.FileMode
+}
+
+// ConfigPath returns the path to the containerd configuration importing the hosts.d
+// directory.
+func ConfigPath() string {
+	return filepath.Join(defaults.PathToK0sContainerdConfig(), "registry-mirrors.toml")
+}
+
+// Files returns the containerd configuration files for the mirrors, none if there are no
+// mirrors. The files may hold credentials and are only readable by root.
+func Files(mirrors []ecv1beta1.RegistryMirror) []File {
+	if len(mirrors) == 0 {
+		return nil
+	}
+	hostsDir := HostsDir()
+	var files []File
+	for _, mirror := range mirrors {
+		dir := filepath.Join(hostsDir, mirror.Registry)
+		for i, endpoint := range mirror.Endpoints {
+			if endpoint.CA == "" {
+				continue
+			}
+			files = append(files, File{Path: caPath(dir, i), Data: endpoint.CA, Mode: 0600})
+		}
+		files = append(files, File{Path: filepath.Join(dir, "hosts.toml"), Data: HostsTOML(mirror, dir), Mode: 0600})
+	}
+	data := fmt.Sprintf(containerdConfigTemplate, hostsDir)
+	return append(files, File{Path: ConfigPath(), Data: data, Mode: 0644})
+}
+
+// Write writes the containerd configuration for the mirrors, replacing the one previously
+// written. Nothing is written if there are no mirrors.
+func Write(mirrors []ecv1beta1.RegistryMirror) error {
+	if err := Validate(mirrors); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(HostsDir()); err != nil {
+		return fmt.Errorf("unable to remove registry mirrors directory: %w", err)
+	}
+	if len(mirrors) == 0 {
+		if err := os.Remove(ConfigPath()); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove registry mirrors config: %w", err)
+		}
+		return nil
+	}
+	for _, file := range Files(mirrors) {
+		if err := os.MkdirAll(filepath.Dir(file.Path), 0700); err != nil {
+			return fmt.Errorf("unable to create directory for %s: %w", file.Path, err)
+		}
+		if err := os.WriteFile(file.Path, []byte(file.Data), file.Mode); err != nil {
+			return fmt.Errorf("unable to write %s: %w", file.Path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package registrymirror
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+const testCA = `-----BEGIN CERTIFICATE-----
+MIIBeTCCAR+gAwIBAgIUTestTestTestTestTestTestTestTestwCgYIKoZIzj0
+-----END CERTIFICATE-----
+`
+
+func TestValidate(t *testing.T) {
+	endpoint := ecv1beta1.RegistryMirrorEndpoint{URL: "https://harbor.example.com"}
+	for _, tt := range []struct {
+		name    string
+		mirrors []ecv1beta1.RegistryMirror
+		wantErr string
+	}{
+		{
+			name: "valid",
+			mirrors: []ecv1beta1.RegistryMirror{
+				{Registry: "docker.io", Endpoints: []ecv1beta1.RegistryMirrorEndpoint{endpoint}},
+				{Registry: "registry.example.com:5000", Endpoints: []ecv1beta1.RegistryMirrorEndpoint{{URL: "http://10.0.0.1:8080", CA: testCA, Username: "user"}}},
+				{Registry: DefaultRegistry, Endpoints: []ecv1beta1.RegistryMirrorEndpoint{endpoint}},
+			},
+		},
+		{
+			name:    "no registry",
+			mirrors: []ecv1beta1.RegistryMirror{{Endpoints: []ecv1beta1.RegistryMirrorEndpoint{endpoint}}},
+			wantErr: "without a registry",
+		},
+		{
+			name:    "registry with a path",
+			mirrors: []ecv1beta1.RegistryMirror{{Registry: "docker.io/library", Endpoints: []ecv1beta1.RegistryMirrorEndpoint{endpoint}}},
+			wantErr: "must be a host",
+		},
+		{
+			name: "duplicate registry",
+			mirrors: []ecv1beta1.RegistryMirror{
+				{Registry: "docker.io", Endpoints: []ecv1beta1.RegistryMirrorEndpoint{endpoint}},
+				{Registry: "docker.io", Endpoints: []ecv1beta1.RegistryMirrorEndpoint{endpoint}},
+			},
+			wantErr: "more than once",
+		},
+		{
+			name:    "no endpoints",
+			mirrors: []ecv1beta1.RegistryMirror{{Registry: "docker.io"}},
+			wantErr: "no mirror endpoints",
+		},
+		{
+			name:    "endpoint without scheme",
+			mirrors: []ecv1beta1.RegistryMirror{{Registry: "docker.io", Endpoints: []ecv1beta1.RegistryMirrorEndpoint{{URL: "harbor.example.com"}}}},
+			wantErr: "must be an http or https url",
+		},
+		{
+			name:    "password without username",
+			mirrors: []ecv1beta1.RegistryMirror{{Registry: "docker.io", Endpoints: []ecv1beta1.RegistryMirrorEndpoint{{URL: "https://harbor.example.com", Password: "secret"}}}},
+			wantErr: "no username",
+		},
+		{
+			name:    "password not read from the secret",
+			mirrors: []ecv1beta1.RegistryMirror{{Registry: "docker.io", Endpoints: []ecv1beta1.RegistryMirrorEndpoint{{URL: "https://harbor.example.com", Username: "user", PasswordSecretKey: "mirror-0-endpoint-0"}}}},
+			wantErr: "was not read from the registry mirrors secret",
+		},
+		{
+			name:    "invalid ca",
+			mirrors: []ecv1beta1.RegistryMirror{{Registry: "docker.io", Endpoints: []ecv1beta1.RegistryMirrorEndpoint{{URL: "https://harbor.example.com", CA: "not a certificate"}}}},
+			wantErr: "not PEM encoded",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.mirrors)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestHostsTOML(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		mirror ecv1beta1.RegistryMirror
+		want   string
+	}{
+		{
+			name: "docker hub through two mirrors",
+			mirror: ecv1beta1.RegistryMirror{
+				Registry: "docker.io",
+				Endpoints: []ecv1beta1.RegistryMirrorEndpoint{
+					{URL: "https://harbor.example.com", Username: "robot", Password: "secret", CA: testCA},
+					{URL: "https://artifactory.example.com/api/docker/docker-remote", InsecureSkipVerify: true},
+				},
+			},
+			want: `server = "https://registry-1.docker.io"
+
+[host."https://harbor.example.com"]
+  capabilities = ["pull", "resolve"]
+  ca = "/hosts.d/docker.io/mirror-0-ca.crt"
+  [host."https://harbor.example.com".header]
+    Authorization = ["Basic cm9ib3Q6c2VjcmV0"]
+
+[host."https://artifactory.example.com/api/docker/docker-remote"]
+  capabilities = ["pull", "resolve"]
+  skip_verify = true
+`,
+		},
+		{
+			name: "default registry",
+			mirror: ecv1beta1.RegistryMirror{
+				Registry:  DefaultRegistry,
+				Endpoints: []ecv1beta1.RegistryMirrorEndpoint{{URL: "http://10.0.0.1:5000"}},
+			},
+			want: `
+[host."http://10.0.0.1:5000"]
+  capabilities = ["pull", "resolve"]
+`,
+		},
+		{
+			name: "registry with a port",
+			mirror: ecv1beta1.RegistryMirror{
+				Registry:  "registry.example.com:5000",
+				Endpoints: []ecv1beta1.RegistryMirrorEndpoint{{URL: "https://cache.example.com"}},
+			},
+			want: `server = "https://registry.example.com:5000"
+
+[host."https://cache.example.com"]
+  capabilities = ["pull", "resolve"]
+`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := HostsTOML(tt.mirror, "/hosts.d/"+tt.mirror.Registry)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFiles(t *testing.T) {
+	assert.Empty(t, Files(nil))
+
+	files := Files([]ecv1beta1.RegistryMirror{
+		{Registry: "docker.io", Endpoints: []ecv1beta1.RegistryMirrorEndpoint{
+			{URL: "https://harbor.example.com"},
+			{URL: "https://cache.example.com", CA: testCA},
+		}},
+	})
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+	assert.Equal(t, []string{
+		"/etc/k0s/containerd.d/hosts.d/docker.io/mirror-1-ca.crt",
+		"/etc/k0s/containerd.d/hosts.d/docker.io/hosts.toml",
+		"/etc/k0s/containerd.d/registry-mirrors.toml",
+	}, paths)
+	assert.Equal(t, testCA, files[0].Data)
+	assert.Equal(t, os.FileMode(0600), files[1].Mode)
+	assert.Contains(t, files[2].Data, `config_path = "/etc/k0s/containerd.d/hosts.d"`)
+	assert.Equal(t, os.FileMode(0644), files[2].Mode)
+}
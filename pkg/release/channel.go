@@ -0,0 +1,184 @@
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ChannelMetadataMaxAge is the age after which the cached channel metadata is reported as
+// stale.
+const ChannelMetadataMaxAge = 24 * time.Hour
+
+// AvailableRelease is a release promoted to the channel of the installation.
+type AvailableRelease struct {
+	VersionLabel    string `json:"versionLabel"`
+	ChannelSequence int64  `json:"channelSequence"`
+	IsRequired      bool   `json:"isRequired,omitempty"`
+	CreatedAt       string `json:"createdAt,omitempty"`
+}
+
+// ChannelMetadata holds the releases of the channel as fetched from the replicated.app
+// endpoint. It is cached on disk so the last-known releases can be shown while offline.
+// The installed version changes with upgrades, it is not cached and is provided by the
+// callers instead.
+type ChannelMetadata struct {
+	FetchedAt   time.Time          `json:"fetchedAt"`
+	Endpoint    string             `json:"endpoint"`
+	LicenseID   string             `json:"licenseID"`
+	AppSlug     string             `json:"appSlug"`
+	ChannelID   string             `json:"channelID"`
+	ChannelSlug string             `json:"channelSlug"`
+	Releases    []AvailableRelease `json:"releases"`
+}
+
+// Age returns how long ago the metadata was fetched.
+func (m *ChannelMetadata) Age(now time.Time) time.Duration {
+	return now.Sub(m.FetchedAt)
+}
+
+// IsStale returns true if the metadata was fetched more than ChannelMetadataMaxAge ago.
+func (m *ChannelMetadata) IsStale(now time.Time) bool {
+	return m.Age(now) > ChannelMetadataMaxAge
+}
+
+// Available returns the releases promoted after the current version. All releases are
+// returned if the current version is not found in the channel.
+func (m *ChannelMetadata) Available(current string) []AvailableRelease {
+	for i := len(m.Releases) - 1; i >= 0; i-- {
+		if m.Releases[i].VersionLabel == current {
+			return m.Releases[i+1:]
+		}
+	}
+	return m.Releases
+}
+
+// RequiredBefore returns the required releases that must be installed before upgrading
+// from the current version to the target one. Returns false if the target is not one of
+// the releases available after the current version.
+func (m *ChannelMetadata) RequiredBefore(current, target string) ([]AvailableRelease, bool) {
+	required := []AvailableRelease{}
+	for _, rel := range m.Available(current) {
+		if rel.VersionLabel == target {
+			return required, true
+		}
+		if rel.IsRequired {
+			required = append(required, rel)
+		}
+	}
+	return nil, false
+}
+
+// FetchChannelMetadata fetches the releases of the channel the release belongs to.
+func FetchChannelMetadata(ctx context.Context, endpoint, licenseID string, rel *ChannelRelease) (*ChannelMetadata, error) {
+	query := url.Values{}
+	query.Set("selectedChannelId", rel.ChannelID)
+	query.Set("channelSequence", "0")
+	query.Set("isSemverSupported", "true")
+	reqURL := fmt.Sprintf(
+		"%s/release/%s/pending?%s",
+		strings.TrimSuffix(endpoint, "/"), url.PathEscape(rel.AppSlug), query.Encode(),
+	)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request: %w", err)
+	}
+	req.SetBasicAuth(licenseID, licenseID)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch channel releases: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to fetch channel releases: unexpected status code %d", resp.StatusCode)
+	}
+	var body struct {
+		ChannelReleases []AvailableRelease `json:"channelReleases"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("unable to decode channel releases: %w", err)
+	}
+	sort.SliceStable(body.ChannelReleases, func(i, j int) bool {
+		return body.ChannelReleases[i].ChannelSequence < body.ChannelReleases[j].ChannelSequence
+	})
+	return &ChannelMetadata{
+		FetchedAt:   time.Now().UTC(),
+		Endpoint:    endpoint,
+		LicenseID:   licenseID,
+		AppSlug:     rel.AppSlug,
+		ChannelID:   rel.ChannelID,
+		ChannelSlug: rel.ChannelSlug,
+		Releases:    body.ChannelReleases,
+	}, nil
+}
+
+// ReadChannelMetadata reads the cached channel metadata. Returns nil and no error if
+// nothing has been cached yet.
+func ReadChannelMetadata(path string) (*ChannelMetadata, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to read channel metadata cache: %w", err)
+	}
+	var meta ChannelMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("unable to parse channel metadata cache: %w", err)
+	}
+	return &meta, nil
+}
+
+// WriteChannelMetadata caches the channel metadata. The cache holds the license id so it
+// is only readable by its owner.
+func WriteChannelMetadata(path string, meta *ChannelMetadata) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal channel metadata: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("unable to create channel metadata cache directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("unable to write channel metadata cache: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("unable to write channel metadata cache: %w", err)
+	}
+	return nil
+}
+
+// RefreshChannelMetadata fetches the channel metadata again using the endpoint and
+// license of the cache and updates it. If the fetch fails the cached metadata is
+// returned along with the fetch error, so callers can show the last-known releases.
+func RefreshChannelMetadata(ctx context.Context, path string) (*ChannelMetadata, error) {
+	cached, err := ReadChannelMetadata(path)
+	if err != nil {
+		return nil, err
+	}
+	if cached == nil {
+		return nil, nil
+	}
+	rel := &ChannelRelease{
+		ChannelID:   cached.ChannelID,
+		ChannelSlug: cached.ChannelSlug,
+		AppSlug:     cached.AppSlug,
+	}
+	meta, err := FetchChannelMetadata(ctx, cached.Endpoint, cached.LicenseID, rel)
+	if err != nil {
+		return cached, err
+	}
+	if err := WriteChannelMetadata(path, meta); err != nil {
+		return meta, err
+	}
+	return meta, nil
+}
@@ -0,0 +1,123 @@
+package release
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchChannelMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "license-id" || pass != "license-id" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "/release/app/pending", r.URL.Path)
+		assert.Equal(t, "channel-id", r.URL.Query().Get("selectedChannelId"))
+		w.Write([]byte(`{"channelReleases": [
+			{"versionLabel": "1.2.0", "channelSequence": 3, "isRequired": true},
+			{"versionLabel": "1.0.0", "channelSequence": 1},
+			{"versionLabel": "1.1.0", "channelSequence": 2}
+		]}`))
+	}))
+	defer server.Close()
+
+	rel := &ChannelRelease{VersionLabel: "1.0.0", ChannelID: "channel-id", ChannelSlug: "stable", AppSlug: "app"}
+	meta, err := FetchChannelMetadata(context.Background(), server.URL, "license-id", rel)
+	require.NoError(t, err)
+	assert.Equal(t, []AvailableRelease{
+		{VersionLabel: "1.1.0", ChannelSequence: 2},
+		{VersionLabel: "1.2.0", ChannelSequence: 3, IsRequired: true},
+	}, meta.Available("1.0.0"))
+
+	_, err = FetchChannelMetadata(context.Background(), server.URL, "invalid", rel)
+	assert.ErrorContains(t, err, "unexpected status code 401")
+}
+
+func TestChannelMetadataAvailable(t *testing.T) {
+	meta := &ChannelMetadata{
+		Releases: []AvailableRelease{{VersionLabel: "1.0.0"}, {VersionLabel: "1.1.0"}},
+	}
+	assert.Len(t, meta.Available("0.9.0"), 2, "unknown current version")
+	assert.Len(t, meta.Available("1.0.0"), 1, "upgraded since the releases were cached")
+	assert.Empty(t, meta.Available("1.1.0"), "up to date")
+}
+
+func TestChannelMetadataRequiredBefore(t *testing.T) {
+	meta := &ChannelMetadata{
+		Releases: []AvailableRelease{
+			{VersionLabel: "1.0.0"},
+			{VersionLabel: "1.1.0", IsRequired: true},
+			{VersionLabel: "1.2.0"},
+			{VersionLabel: "1.3.0", IsRequired: true},
+			{VersionLabel: "1.4.0"},
+		},
+	}
+	required, ok := meta.RequiredBefore("1.0.0", "1.4.0")
+	assert.True(t, ok)
+	assert.Equal(t, []AvailableRelease{
+		{VersionLabel: "1.1.0", IsRequired: true},
+		{VersionLabel: "1.3.0", IsRequired: true},
+	}, required)
+
+	required, ok = meta.RequiredBefore("1.1.0", "1.3.0")
+	assert.True(t, ok)
+	assert.Empty(t, required, "the target itself may be required")
+
+	_, ok = meta.RequiredBefore("1.2.0", "1.1.0")
+	assert.False(t, ok, "downgrade")
+	_, ok = meta.RequiredBefore("1.0.0", "2.0.0")
+	assert.False(t, ok, "unknown target")
+}
+
+func TestChannelMetadataIsStale(t *testing.T) {
+	now := time.Now()
+	meta := &ChannelMetadata{FetchedAt: now.Add(-time.Hour)}
+	assert.False(t, meta.IsStale(now))
+	meta.FetchedAt = now.Add(-ChannelMetadataMaxAge - time.Minute)
+	assert.True(t, meta.IsStale(now))
+}
+
+func TestRefreshChannelMetadata(t *testing.T) {
+	online := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !online {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"channelReleases": [{"versionLabel": "1.1.0", "channelSequence": 2}]}`))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "channel-metadata.json")
+	meta, err := RefreshChannelMetadata(context.Background(), path)
+	require.NoError(t, err)
+	assert.Nil(t, meta, "nothing cached yet")
+
+	cached := &ChannelMetadata{
+		FetchedAt: time.Now().Add(-48 * time.Hour).UTC(),
+		Endpoint:  server.URL,
+		LicenseID: "license-id",
+		AppSlug:   "app",
+		ChannelID: "channel-id",
+	}
+	require.NoError(t, WriteChannelMetadata(path, cached))
+
+	meta, err = RefreshChannelMetadata(context.Background(), path)
+	require.NoError(t, err)
+	assert.False(t, meta.IsStale(time.Now()))
+	assert.Len(t, meta.Available("1.0.0"), 1)
+
+	online = false
+	meta, err = RefreshChannelMetadata(context.Background(), path)
+	assert.ErrorContains(t, err, "unexpected status code 503")
+	require.NotNil(t, meta, "the cached releases are returned while offline")
+	assert.Equal(t, "1.1.0", meta.Available("1.0.0")[0].VersionLabel)
+}
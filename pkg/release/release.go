@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
+	"regexp"
 	"sync"
 
 	embeddedclusterv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
@@ -23,6 +25,19 @@ var (
 	releaseData *ReleaseData
 )
 
+// PluginsDir is the directory of the release the plugins are shipped in. Any file in it
+// is a plugin named after the file, binaries included.
+const PluginsDir = "embedded-cluster-plugins"
+
+var (
+	// pluginName matches the names plugins can have.
+	pluginName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	// pluginHeader matches the header of the scripts shipped as plugins outside of the
+	// plugins directory, the line right after the shebang. Its group is the name of the
+	// plugin.
+	pluginHeader = regexp.MustCompile(`\A#![^\n]*\n# embedded-cluster plugin: ([a-z0-9][a-z0-9_-]*)[ \t\r]*\n`)
+)
+
 // ReleaseData holds the parsed data from a Kots Release.
 type ReleaseData struct {
 	data                  []byte
@@ -30,6 +45,7 @@ type ReleaseData struct {
 	HostPreflights        [][]byte
 	EmbeddedClusterConfig []byte
 	ChannelRelease        []byte
+	Plugins               map[string][]byte
 }
 
 // NewReleaseDataFrom parses the provide slice of bytes and returns a ReleaseData
@@ -149,6 +165,20 @@ func (r *ReleaseData) GetEmbeddedClusterConfig() (*embeddedclusterv1beta1.Config
 	return &cfg, nil
 }
 
+// GetPlugins returns the plugins shipped in the release, indexed by name. Plugins are the
+// files of the plugins directory and the scripts with a plugin header, see pluginNameOf.
+func GetPlugins() (map[string][]byte, error) {
+	if err := parseReleaseDataFromBinary(); err != nil {
+		return nil, fmt.Errorf("failed to parse data from binary: %w", err)
+	}
+	return releaseData.GetPlugins()
+}
+
+// GetPlugins returns the plugins shipped in the release, indexed by name.
+func (r *ReleaseData) GetPlugins() (map[string][]byte, error) {
+	return r.Plugins, nil
+}
+
 // ChannelRelease contains information about a specific app release inside a channel.
 type ChannelRelease struct {
 	VersionLabel string `yaml:"versionLabel"`
@@ -204,6 +234,15 @@ func (r *ReleaseData) parse() error {
 		if _, err := io.Copy(content, tr); err != nil {
 			return fmt.Errorf("unable to copy file out of tar: %w", err)
 		}
+		if name, err := pluginNameOf(header.Name, content.Bytes()); err != nil {
+			return err
+		} else if name != "" {
+			if r.Plugins == nil {
+				r.Plugins = map[string][]byte{}
+			}
+			r.Plugins[name] = content.Bytes()
+			continue
+		}
 		if bytes.Contains(content.Bytes(), []byte("apiVersion: kots.io/v1beta1")) {
 			if bytes.Contains(content.Bytes(), []byte("kind: Application")) {
 				r.Application = content.Bytes()
@@ -234,6 +273,24 @@ func (r *ReleaseData) parse() error {
 	}
 }
 
+// pluginNameOf returns the name of the plugin in the file of the release, nothing if the
+// file is not a plugin. Files in the plugins directory are plugins, so are the scripts
+// starting with a shebang followed by a "# embedded-cluster plugin: <name>" header.
+func pluginNameOf(file string, content []byte) (string, error) {
+	file = path.Clean(file)
+	if path.Base(path.Dir(file)) == PluginsDir {
+		name := path.Base(file)
+		if !pluginName.MatchString(name) {
+			return "", fmt.Errorf("invalid plugin name %q in %s", name, file)
+		}
+		return name, nil
+	}
+	if match := pluginHeader.FindSubmatch(content); match != nil {
+		return string(match[1]), nil
+	}
+	return "", nil
+}
+
 // SetReleaseDataForTests should only be called from tests. It sets the release information based on the supplied data.
 func SetReleaseDataForTests(data map[string][]byte) error {
 	mtx.Lock()
@@ -244,7 +301,8 @@ func SetReleaseDataForTests(data map[string][]byte) error {
 	tw := tar.NewWriter(gw)
 	for name, content := range data {
 		err := tw.WriteHeader(&tar.Header{
-			Name: "name",
+			Name: name,
+			Mode: 0600,
 			Size: int64(len(content)),
 		})
 		if err != nil {
@@ -79,3 +79,40 @@ func TestGetEmbeddedClusterConfig(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, app)
 }
+
+func TestGetPlugins(t *testing.T) {
+	data, err := generateReleaseTGZ()
+	assert.NoError(t, err)
+	release, err := NewReleaseDataFrom(data)
+	assert.NoError(t, err)
+	plugins, err := release.GetPlugins()
+	assert.NoError(t, err)
+	assert.Len(t, plugins, 2, "manifests embedding a plugin header are not plugins")
+	assert.Contains(t, string(plugins["app-reindex"]), "rollout restart")
+	assert.Contains(t, string(plugins["db-dump"]), "pg_dump")
+}
+
+func TestPluginNameOf(t *testing.T) {
+	for _, tt := range []struct {
+		file    string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{file: "embedded-cluster-plugins/db-dump", content: "\x7fELF", want: "db-dump"},
+		{file: "./release/embedded-cluster-plugins/db-dump", want: "db-dump"},
+		{file: "embedded-cluster-plugins/Dump.sh", wantErr: true},
+		{file: "reindex", content: "#!/bin/sh\n# embedded-cluster plugin: reindex\nexec reindex\n", want: "reindex"},
+		{file: "reindex", content: "#!/bin/sh\n\n# embedded-cluster plugin: reindex\n"},
+		{file: "reindex", content: "# embedded-cluster plugin: reindex\n"},
+		{file: "job.yaml", content: "kind: Job\nscript: |\n#!/bin/sh\n# embedded-cluster plugin: reindex\n"},
+	} {
+		got, err := pluginNameOf(tt.file, []byte(tt.content))
+		if tt.wantErr {
+			assert.Error(t, err, tt.file)
+			continue
+		}
+		assert.NoError(t, err, tt.file)
+		assert.Equal(t, tt.want, got, "%s: %q", tt.file, tt.content)
+	}
+}
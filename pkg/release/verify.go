@@ -0,0 +1,137 @@
+package release
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+	"github.com/replicatedhq/embedded-cluster/utils/pkg/embed"
+)
+
+// SigningKeys holds the comma separated, base64 encoded, ed25519 public keys trusted to
+// sign the release data embedded in the binaries. It is set at compile time via ldflags.
+var SigningKeys string
+
+// SignatureAlgorithm is the only algorithm release data signatures are made with.
+const SignatureAlgorithm = "ed25519"
+
+// Signature is the signature of the release data, embedded in the binary along with it.
+type Signature struct {
+	Algorithm string `json:"algorithm"`
+	Signature []byte `json:"signature"`
+}
+
+// Verification is the result of the verification of a binary.
+type Verification struct {
+	BinaryPath   string `json:"binaryPath"`
+	BinarySHA256 string `json:"binarySHA256"`
+	// PayloadSHA256 is the checksum of the embedded release data, empty if there is none.
+	PayloadSHA256 string `json:"payloadSHA256,omitempty"`
+	// Signed is true if the release data is signed. The signature has been verified
+	// against the key with the KeyFingerprint.
+	Signed         bool            `json:"signed"`
+	KeyFingerprint string          `json:"keyFingerprint,omitempty"`
+	Release        *ChannelRelease `json:"release,omitempty"`
+}
+
+// ParseSigningKeys parses a comma separated list of base64 encoded ed25519 public keys.
+func ParseSigningKeys(keys string) ([]ed25519.PublicKey, error) {
+	var parsed []ed25519.PublicKey
+	for _, key := range strings.Split(keys, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode signing key: %w", err)
+		}
+		if len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid signing key size %d", len(raw))
+		}
+		parsed = append(parsed, ed25519.PublicKey(raw))
+	}
+	return parsed, nil
+}
+
+// KeyFingerprint returns the fingerprint of a public key, in the same format ssh uses.
+func KeyFingerprint(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// VerifyBinary verifies the integrity of the release data embedded in the binary and, when
+// it is signed, its signature against the trusted keys. An error is returned if the release
+// data is corrupt or its signature is not made by any of the keys.
+func VerifyBinary(path string, keys []ed25519.PublicKey) (*Verification, error) {
+	sum, err := helpers.FileSHA256(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to checksum binary: %w", err)
+	}
+	result := &Verification{BinaryPath: path, BinarySHA256: sum}
+
+	data, err := embed.ExtractReleaseDataFromBinary(path)
+	if err != nil {
+		return nil, fmt.Errorf("release data is corrupt: %w", err)
+	}
+	if len(data) == 0 {
+		return result, nil
+	}
+	payloadSum := sha256.Sum256(data)
+	result.PayloadSHA256 = hex.EncodeToString(payloadSum[:])
+	if err := checkPayload(data); err != nil {
+		return nil, fmt.Errorf("release data is corrupt: %w", err)
+	}
+	rd, err := NewReleaseDataFrom(data)
+	if err != nil {
+		return nil, fmt.Errorf("release data is corrupt: %w", err)
+	}
+	if result.Release, err = rd.GetChannelRelease(); err != nil {
+		return nil, fmt.Errorf("release data is corrupt: %w", err)
+	}
+
+	encoded, err := embed.ExtractReleaseSignatureFromBinary(path)
+	if err != nil {
+		return nil, fmt.Errorf("release signature is corrupt: %w", err)
+	}
+	if encoded == nil {
+		return result, nil
+	}
+	var signature Signature
+	if err := json.Unmarshal(encoded, &signature); err != nil {
+		return nil, fmt.Errorf("release signature is corrupt: %w", err)
+	}
+	if signature.Algorithm != SignatureAlgorithm {
+		return nil, fmt.Errorf("unsupported release signature algorithm %q", signature.Algorithm)
+	}
+	result.Signed = true
+	for _, key := range keys {
+		if ed25519.Verify(key, data, signature.Signature) {
+			result.KeyFingerprint = KeyFingerprint(key)
+			return result, nil
+		}
+	}
+	return nil, fmt.Errorf("release signature does not match any of the %d trusted keys", len(keys))
+}
+
+// checkPayload reads the whole gzip stream of the release data, which verifies its
+// checksum. The tar archive is only read up to its end by the parser.
+func checkPayload(data []byte) error {
+	gzr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("unable to create gzip reader: %w", err)
+	}
+	defer gzr.Close()
+	if _, err := io.Copy(io.Discard, gzr); err != nil {
+		return fmt.Errorf("unable to decompress: %w", err)
+	}
+	return nil
+}
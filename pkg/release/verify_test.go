@@ -0,0 +1,104 @@
+package release
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicatedhq/embedded-cluster/utils/pkg/embed"
+)
+
+func writeBinary(t *testing.T, data []byte, signature *Signature) string {
+	t.Helper()
+	bin := []byte("binary content")
+	reader, _ := embed.EmbedReleaseDataInBinaryReader(bytes.NewReader(bin), int64(len(bin)), data)
+	if signature != nil {
+		encoded, err := json.Marshal(signature)
+		require.NoError(t, err)
+		reader, _ = embed.EmbedSignedReleaseDataInBinaryReader(bytes.NewReader(bin), int64(len(bin)), data, encoded)
+	}
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "app")
+	require.NoError(t, os.WriteFile(path, content, 0755))
+	return path
+}
+
+func releaseTGZ(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	buf := bytes.NewBuffer(nil)
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+	return buf.Bytes()
+}
+
+func TestVerifyBinary(t *testing.T) {
+	data := releaseTGZ(t, map[string]string{
+		"release.yaml": "# channel release object\nversionLabel: 1.0.0\nchannelID: 2cHXb1RCttzpR0xvnNWyaZCgDBP\nchannelSlug: stable\nappSlug: app-slug\n",
+	})
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	keys, err := ParseSigningKeys(base64.StdEncoding.EncodeToString(otherPub) + "," + base64.StdEncoding.EncodeToString(pub))
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+
+	// unsigned releases are only checked for integrity.
+	result, err := VerifyBinary(writeBinary(t, data, nil), keys)
+	require.NoError(t, err)
+	assert.False(t, result.Signed)
+	assert.NotEmpty(t, result.PayloadSHA256)
+	require.NotNil(t, result.Release)
+	assert.Equal(t, "app-slug", result.Release.AppSlug)
+
+	signature := &Signature{Algorithm: SignatureAlgorithm, Signature: ed25519.Sign(priv, data)}
+	result, err = VerifyBinary(writeBinary(t, data, signature), keys)
+	require.NoError(t, err)
+	assert.True(t, result.Signed)
+	assert.Equal(t, KeyFingerprint(pub), result.KeyFingerprint)
+
+	_, err = VerifyBinary(writeBinary(t, data, signature), keys[:1])
+	assert.ErrorContains(t, err, "does not match any of the 1 trusted keys")
+
+	// the signature covers the whole payload.
+	tampered := append([]byte{}, data...)
+	tampered[len(tampered)-1] ^= 0xff
+	_, err = VerifyBinary(writeBinary(t, tampered, nil), keys)
+	assert.ErrorContains(t, err, "release data is corrupt")
+
+	_, err = VerifyBinary(writeBinary(t, data, &Signature{Algorithm: "rsa", Signature: []byte("x")}), keys)
+	assert.ErrorContains(t, err, "unsupported release signature algorithm")
+
+	// binaries without release data.
+	result, err = VerifyBinary(writeBinary(t, nil, nil), keys)
+	require.NoError(t, err)
+	assert.Empty(t, result.PayloadSHA256)
+}
+
+func TestParseSigningKeys(t *testing.T) {
+	keys, err := ParseSigningKeys("")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+	_, err = ParseSigningKeys("not base64!")
+	assert.Error(t, err)
+	_, err = ParseSigningKeys(base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.ErrorContains(t, err, "invalid signing key size")
+}
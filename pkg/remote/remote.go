@@ -0,0 +1,172 @@
+// Package remote runs commands and copies files to a remote machine over ssh. The ssh
+// and scp binaries of the workstation are used so the operator ssh configuration, keys
+// and agent are honored.
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os/exec"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Target is the remote machine, as provided in a ssh://user@host:port url.
+type Target struct {
+	User string
+	Host string
+	Port string
+}
+
+// ParseTarget parses a ssh://[user@]host[:port] url.
+func ParseTarget(target string) (*Target, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target %s: %w", target, err)
+	}
+	if u.Scheme != "ssh" {
+		return nil, fmt.Errorf("invalid target %s: only ssh://[user@]host[:port] targets are supported", target)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid target %s: missing host", target)
+	}
+	if u.Path != "" && u.Path != "/" {
+		return nil, fmt.Errorf("invalid target %s: paths are not supported", target)
+	}
+	if _, ok := u.User.Password(); ok {
+		return nil, fmt.Errorf("invalid target %s: passwords are not supported, use a key or the ssh agent", target)
+	}
+	return &Target{User: u.User.Username(), Host: u.Hostname(), Port: u.Port()}, nil
+}
+
+// Destination returns the [user@]host ssh destination.
+func (t Target) Destination() string {
+	host := t.Host
+	if strings.Contains(host, ":") {
+		host = fmt.Sprintf("[%s]", host)
+	}
+	if t.User == "" {
+		return host
+	}
+	return fmt.Sprintf("%s@%s", t.User, host)
+}
+
+// Hop returns the [user@]host[:port] form used for ssh jump hosts.
+func (t Target) Hop() string {
+	if t.Port == "" {
+		return t.Destination()
+	}
+	return fmt.Sprintf("%s:%s", t.Destination(), t.Port)
+}
+
+// ParseJumpHosts parses the ssh://[user@]host[:port] urls of the jump hosts the target
+// is reached through, in the order they are traversed.
+func ParseJumpHosts(hosts []string) ([]Target, error) {
+	var jumps []Target
+	for _, host := range hosts {
+		jump, err := ParseTarget(host)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jump host: %w", err)
+		}
+		jumps = append(jumps, *jump)
+	}
+	return jumps, nil
+}
+
+func (t Target) String() string {
+	if t.Port == "" {
+		return fmt.Sprintf("ssh://%s", t.Destination())
+	}
+	return fmt.Sprintf("ssh://%s:%s", t.Destination(), t.Port)
+}
+
+// Client runs commands on a target.
+type Client struct {
+	Target Target
+	// Identity is the private key used to authenticate, optional.
+	Identity string
+	// JumpHosts are the bastions the target is reached through, optional. They
+	// authenticate with the ssh configuration and agent.
+	JumpHosts []Target
+	// TTY allocates a terminal for the commands, needed to answer prompts.
+	TTY    bool
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+func (c *Client) commonArgs(portFlag string) []string {
+	var args []string
+	if c.Target.Port != "" {
+		args = append(args, portFlag, c.Target.Port)
+	}
+	if c.Identity != "" {
+		args = append(args, "-i", c.Identity)
+	}
+	if len(c.JumpHosts) > 0 {
+		hops := make([]string, len(c.JumpHosts))
+		for i, jump := range c.JumpHosts {
+			hops[i] = jump.Hop()
+		}
+		// the option is used instead of -J, scp only supports -J since openssh 8.0.
+		args = append(args, "-o", fmt.Sprintf("ProxyJump=%s", strings.Join(hops, ",")))
+	}
+	return args
+}
+
+// SSHArgs returns the arguments of the ssh command running the command on the target.
+func (c *Client) SSHArgs(command string) []string {
+	args := c.commonArgs("-p")
+	if c.TTY {
+		args = append(args, "-t")
+	}
+	return append(args, c.Target.Destination(), command)
+}
+
+// SCPArgs returns the arguments of the scp command copying the local file to the path
+// on the target. Relative paths are relative to the home directory of the user.
+func (c *Client) SCPArgs(local, path string) []string {
+	args := append(c.commonArgs("-P"), "-q", local)
+	return append(args, fmt.Sprintf("%s:%s", c.Target.Destination(), path))
+}
+
+// Run runs the command on the target, streaming its output.
+func (c *Client) Run(ctx context.Context, command string) error {
+	logrus.Debugf("running %q on %s", command, c.Target)
+	cmd := exec.CommandContext(ctx, "ssh", c.SSHArgs(command)...)
+	cmd.Stdin = c.Stdin
+	cmd.Stdout = c.Stdout
+	cmd.Stderr = c.Stderr
+	return cmd.Run()
+}
+
+// Copy copies the local file to the path on the target.
+func (c *Client) Copy(ctx context.Context, local, path string) error {
+	logrus.Debugf("copying %s to %s on %s", local, path, c.Target)
+	cmd := exec.CommandContext(ctx, "scp", c.SCPArgs(local, path)...)
+	cmd.Stderr = c.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("unable to copy %s to %s: %w", local, c.Target, err)
+	}
+	return nil
+}
+
+// Quote quotes the argument for the remote shell.
+func Quote(arg string) string {
+	if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=./:,@") == "" {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// Join quotes the arguments and joins them in a remote shell command.
+func Join(args ...string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = Quote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
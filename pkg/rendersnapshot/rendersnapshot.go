@@ -0,0 +1,225 @@
+// Package rendersnapshot records, in the cluster, the inputs and a hash of the outputs of
+// every rendering of the k0s configuration and of the values of the addons. Support uses
+// the snapshots to know the exact configuration a cluster runs and to reproduce it.
+package rendersnapshot
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	k8syaml "sigs.k8s.io/yaml"
+)
+
+const (
+	// Namespace is where the snapshots are stored.
+	Namespace = "embedded-cluster"
+	// ConfigMapName is the name of the ConfigMap holding the snapshots, keyed by the time
+	// they were taken.
+	ConfigMapName = "config-render-snapshots"
+	// MaxSnapshots is the number of snapshots kept, the oldest ones are removed.
+	MaxSnapshots = 30
+)
+
+// keyFormat formats the time of a snapshot as a ConfigMap key, sorting chronologically.
+const keyFormat = "20060102T150405.000000000Z"
+
+// Source is the operation that rendered the configuration.
+type Source string
+
+const (
+	// SourceInstall is the installation of the cluster, rendering the k0s configuration
+	// and the values of the addons from the flags and the overrides.
+	SourceInstall Source = "install"
+	// SourceUpgrade is the operator rendering the values of the addons from an
+	// installation object.
+	SourceUpgrade Source = "upgrade"
+)
+
+// Snapshot holds the inputs of a rendering and the hashes of what was rendered.
+type Snapshot struct {
+	Time   metav1.Time `json:"time"`
+	Source Source      `json:"source"`
+	// Version is the version of the release the configuration was rendered for.
+	Version string `json:"version"`
+	// Installation is the name of the installation object the values were rendered
+	// from. Only set on upgrades.
+	Installation string `json:"installation,omitempty"`
+	// Flags are the flags set on the command line, secrets excluded.
+	Flags map[string]string `json:"flags,omitempty"`
+	// Overrides is the content of the file with the end user overrides.
+	Overrides string `json:"overrides,omitempty"`
+	// LicenseChecksum is the checksum of the license file, the license itself is not
+	// stored.
+	LicenseChecksum string `json:"licenseChecksum,omitempty"`
+	// Address is the address the API server was configured to listen on.
+	Address string `json:"address,omitempty"`
+	// ConfigHash is the hash of the k0s configuration, the values of the charts
+	// excluded. Empty when only the values were rendered.
+	ConfigHash string `json:"configHash,omitempty"`
+	// ValuesHashes are the hashes of the values of each chart, by chart name.
+	ValuesHashes map[string]string `json:"valuesHashes,omitempty"`
+}
+
+// Hash returns the hex encoded sha256 hash of the data.
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ValuesHashes returns the hashes of the values of each chart, by chart name.
+func ValuesHashes(charts k0sv1beta1.ChartsSettings) map[string]string {
+	hashes := map[string]string{}
+	for _, chart := range charts {
+		hashes[chart.Name] = Hash([]byte(chart.Values))
+	}
+	return hashes
+}
+
+// SetOutputs sets the hashes of the k0s configuration, the values of the charts excluded,
+// and of the values of each chart.
+func (s *Snapshot) SetOutputs(cfg *k0sv1beta1.ClusterConfig) error {
+	cfg = cfg.DeepCopy()
+	var charts k0sv1beta1.ChartsSettings
+	if cfg.Spec != nil && cfg.Spec.Extensions != nil && cfg.Spec.Extensions.Helm != nil {
+		charts = cfg.Spec.Extensions.Helm.Charts
+		cfg.Spec.Extensions.Helm.Charts = nil
+		for _, chart := range charts {
+			chart.Values = ""
+			cfg.Spec.Extensions.Helm.Charts = append(cfg.Spec.Extensions.Helm.Charts, chart)
+		}
+	}
+	data, err := k8syaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("unable to marshal config: %w", err)
+	}
+	s.ConfigHash = Hash(data)
+	s.ValuesHashes = ValuesHashes(charts)
+	return nil
+}
+
+// Diff returns the outputs of the replay that differ from the ones of the snapshot. The
+// k0s configuration is only compared when both have it.
+func (s Snapshot) Diff(replay Snapshot) []string {
+	var diff []string
+	if s.ConfigHash != "" && replay.ConfigHash != "" && s.ConfigHash != replay.ConfigHash {
+		diff = append(diff, "k0s configuration")
+	}
+	names := map[string]bool{}
+	for name := range s.ValuesHashes {
+		names[name] = true
+	}
+	for name := range replay.ValuesHashes {
+		names[name] = true
+	}
+	var charts []string
+	for name := range names {
+		if s.ValuesHashes[name] != replay.ValuesHashes[name] {
+			charts = append(charts, name)
+		}
+	}
+	sort.Strings(charts)
+	for _, name := range charts {
+		diff = append(diff, fmt.Sprintf("values of chart %s", name))
+	}
+	return diff
+}
+
+// Record stores the snapshot, removing the oldest ones past MaxSnapshots.
+func Record(ctx context.Context, cli client.Client, snap Snapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("unable to marshal snapshot: %w", err)
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var cm corev1.ConfigMap
+		key := client.ObjectKey{Namespace: Namespace, Name: ConfigMapName}
+		err := cli.Get(ctx, key, &cm)
+		if k8serrors.IsNotFound(err) {
+			cm = corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      ConfigMapName,
+					Namespace: Namespace,
+					Labels: map[string]string{
+						"app.kubernetes.io/component": "config-render-snapshots",
+						"app.kubernetes.io/part-of":   "embedded-cluster",
+					},
+				},
+			}
+		} else if err != nil {
+			return fmt.Errorf("unable to get snapshots configmap: %w", err)
+		}
+
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[snap.Time.UTC().Format(keyFormat)] = string(data)
+		keys := make([]string, 0, len(cm.Data))
+		for key := range cm.Data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for len(keys) > MaxSnapshots {
+			delete(cm.Data, keys[0])
+			keys = keys[1:]
+		}
+
+		if cm.ResourceVersion == "" {
+			return cli.Create(ctx, &cm)
+		}
+		return cli.Update(ctx, &cm)
+	})
+}
+
+// List returns the snapshots stored in the cluster, oldest first.
+func List(ctx context.Context, cli client.Client) ([]Snapshot, error) {
+	var cm corev1.ConfigMap
+	key := client.ObjectKey{Namespace: Namespace, Name: ConfigMapName}
+	if err := cli.Get(ctx, key, &cm); k8serrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to get snapshots configmap: %w", err)
+	}
+	// the keys are sorted chronologically with a better precision than the time of the
+	// snapshots.
+	keys := make([]string, 0, len(cm.Data))
+	for key := range cm.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var snapshots []Snapshot
+	for _, key := range keys {
+		var snap Snapshot
+		if err := json.Unmarshal([]byte(cm.Data[key]), &snap); err != nil {
+			return nil, fmt.Errorf("unable to unmarshal snapshot %s: %w", key, err)
+		}
+		snapshots = append(snapshots, snap)
+	}
+	return snapshots, nil
+}
+
+// At returns the snapshot of the configuration in use at the given time: the last one
+// taken at or before it.
+func At(snapshots []Snapshot, at time.Time) (*Snapshot, error) {
+	var found *Snapshot
+	for i := range snapshots {
+		if snapshots[i].Time.Time.After(at) {
+			break
+		}
+		found = &snapshots[i]
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no configuration was rendered at or before %s", at.Format(time.RFC3339))
+	}
+	return found, nil
+}
@@ -0,0 +1,99 @@
+package rendersnapshot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRecordAndList(t *testing.T) {
+	ctx := context.Background()
+	kcli := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+
+	snapshots, err := List(ctx, kcli)
+	require.NoError(t, err)
+	assert.Empty(t, snapshots)
+
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < MaxSnapshots+2; i++ {
+		snap := Snapshot{
+			Time:    metav1.NewTime(start.Add(time.Duration(i) * time.Hour)),
+			Source:  SourceUpgrade,
+			Version: "1.0.0",
+		}
+		require.NoError(t, Record(ctx, kcli, snap))
+	}
+
+	snapshots, err = List(ctx, kcli)
+	require.NoError(t, err)
+	require.Len(t, snapshots, MaxSnapshots)
+	// the two oldest snapshots were removed.
+	assert.Equal(t, start.Add(2*time.Hour), snapshots[0].Time.UTC())
+	assert.Equal(t, start.Add(time.Duration(MaxSnapshots+1)*time.Hour), snapshots[MaxSnapshots-1].Time.UTC())
+}
+
+func TestAt(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	snapshots := []Snapshot{
+		{Time: metav1.NewTime(start), Source: SourceInstall},
+		{Time: metav1.NewTime(start.Add(time.Hour)), Source: SourceUpgrade, Installation: "20240501110000"},
+	}
+
+	_, err := At(snapshots, start.Add(-time.Minute))
+	assert.ErrorContains(t, err, "no configuration was rendered")
+
+	snap, err := At(snapshots, start)
+	require.NoError(t, err)
+	assert.Equal(t, SourceInstall, snap.Source)
+
+	snap, err = At(snapshots, start.Add(59*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, SourceInstall, snap.Source)
+
+	snap, err = At(snapshots, start.Add(24*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, "20240501110000", snap.Installation)
+}
+
+func TestSetOutputsAndDiff(t *testing.T) {
+	cfg := &k0sv1beta1.ClusterConfig{
+		Spec: &k0sv1beta1.ClusterSpec{
+			API: &k0sv1beta1.APISpec{Address: "10.0.0.1"},
+			Extensions: &k0sv1beta1.ClusterExtensions{
+				Helm: &k0sv1beta1.HelmExtensions{
+					Charts: k0sv1beta1.ChartsSettings{
+						{Name: "openebs", Values: "a: b\n"},
+						{Name: "admin-console", Values: "c: d\n"},
+					},
+				},
+			},
+		},
+	}
+	var recorded Snapshot
+	require.NoError(t, recorded.SetOutputs(cfg))
+	assert.Equal(t, Hash([]byte("a: b\n")), recorded.ValuesHashes["openebs"])
+	// the values are not part of the hash of the configuration, nor removed from it.
+	assert.Equal(t, "a: b\n", cfg.Spec.Extensions.Helm.Charts[0].Values)
+
+	var replay Snapshot
+	require.NoError(t, replay.SetOutputs(cfg))
+	assert.Empty(t, recorded.Diff(replay))
+
+	changed := cfg.DeepCopy()
+	changed.Spec.API.Address = "10.0.0.2"
+	changed.Spec.Extensions.Helm.Charts[1].Values = "c: e\n"
+	changed.Spec.Extensions.Helm.Charts = append(changed.Spec.Extensions.Helm.Charts, k0sv1beta1.Chart{Name: "velero"})
+	require.NoError(t, replay.SetOutputs(changed))
+	assert.Equal(t, []string{"k0s configuration", "values of chart admin-console", "values of chart velero"}, recorded.Diff(replay))
+
+	// the configuration is not compared when only the values were rendered.
+	valuesOnly := Snapshot{ValuesHashes: ValuesHashes(cfg.Spec.Extensions.Helm.Charts)}
+	assert.Empty(t, valuesOnly.Diff(Snapshot{ConfigHash: "other", ValuesHashes: recorded.ValuesHashes}))
+}
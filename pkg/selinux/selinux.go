@@ -0,0 +1,111 @@
+// Package selinux prepares hosts running SELinux in enforcing mode. It installs the
+// Embedded Cluster policy module and sets up the file contexts used by k0s, containerd
+// and the data directories.
+package selinux
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+	"github.com/replicatedhq/embedded-cluster/pkg/storageplan"
+)
+
+// EnforcePath is the file exposing the current SELinux mode. It only exists if SELinux
+// is enabled in the kernel.
+var EnforcePath = "/sys/fs/selinux/enforce"
+
+// containerdConfig enables SELinux support in the containerd CRI plugin.
+const containerdConfig = `
+[plugins."io.containerd.grpc.v1.cri"]
+  enable_selinux = true
+`
+
+// FileContext maps a path (regular expression as understood by semanage) to an SELinux
+// type. Dir is the directory relabeled once the mapping is added.
+type FileContext struct {
+	Pattern string
+	Type    string
+	Dir     string
+}
+
+// Enforcing returns true if SELinux is enabled and in enforcing mode.
+func Enforcing() bool {
+	content, err := os.ReadFile(EnforcePath)
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(content)) == "1"
+}
+
+// FileContexts returns the file contexts required by the cluster. These build on top of
+// the types provided by the container-selinux package.
+func FileContexts() []FileContext {
+	bindir := defaults.EmbeddedClusterBinsSubDir()
+	datadir := storageplan.HostDataDir()
+	return []FileContext{
+		{Pattern: "/var/lib/k0s/bin(/.*)?", Type: "container_runtime_exec_t", Dir: "/var/lib/k0s/bin"},
+		{Pattern: "/var/lib/k0s/containerd(/.*)?", Type: "container_var_lib_t", Dir: "/var/lib/k0s/containerd"},
+		{Pattern: "/var/lib/k0s/containerd/[^/]+/snapshots(/.*)?", Type: "container_ro_file_t", Dir: "/var/lib/k0s/containerd"},
+		{Pattern: "/var/lib/k0s/kubelet/pods(/.*)?", Type: "container_file_t", Dir: "/var/lib/k0s/kubelet/pods"},
+		{Pattern: "/run/k0s/containerd(/.*)?", Type: "container_var_run_t", Dir: "/run/k0s/containerd"},
+		{Pattern: fmt.Sprintf("%s(/.*)?", datadir), Type: "container_file_t", Dir: datadir},
+		{Pattern: fmt.Sprintf("%s(/.*)?", bindir), Type: "bin_t", Dir: bindir},
+	}
+}
+
+// Configure installs the provided policy module, sets up the file contexts and enables
+// SELinux support in containerd. Directories are created (and relabeled) upfront so
+// files later written by k0s inherit the right labels.
+func Configure(policyModule string) error {
+	logrus.Debugf("installing selinux policy module %s", policyModule)
+	if _, err := helpers.RunCommand("semodule", "-i", policyModule); err != nil {
+		return fmt.Errorf("unable to install selinux policy module: %w", err)
+	}
+
+	for _, fc := range FileContexts() {
+		if err := addFileContext(fc); err != nil {
+			return fmt.Errorf("unable to add file context for %s: %w", fc.Pattern, err)
+		}
+	}
+
+	relabeled := map[string]bool{}
+	for _, fc := range FileContexts() {
+		if relabeled[fc.Dir] {
+			continue
+		}
+		if err := os.MkdirAll(fc.Dir, 0755); err != nil {
+			return fmt.Errorf("unable to create %s: %w", fc.Dir, err)
+		}
+		if _, err := helpers.RunCommand("restorecon", "-R", fc.Dir); err != nil {
+			return fmt.Errorf("unable to relabel %s: %w", fc.Dir, err)
+		}
+		relabeled[fc.Dir] = true
+	}
+
+	dir := defaults.PathToK0sContainerdConfig()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("unable to ensure containerd directory exists: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "selinux.toml"), []byte(containerdConfig), 0644); err != nil {
+		return fmt.Errorf("unable to write selinux.toml: %w", err)
+	}
+	return nil
+}
+
+// addFileContext adds a file context mapping. If the mapping already exists (e.g. on a
+// reinstall) it is modified instead.
+func addFileContext(fc FileContext) error {
+	if _, err := helpers.RunCommand("semanage", "fcontext", "-a", "-t", fc.Type, fc.Pattern); err == nil {
+		return nil
+	}
+	if _, err := helpers.RunCommand("semanage", "fcontext", "-m", "-t", fc.Type, fc.Pattern); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package selinux
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnforcing(t *testing.T) {
+	original := EnforcePath
+	defer func() { EnforcePath = original }()
+
+	EnforcePath = filepath.Join(t.TempDir(), "enforce")
+	assert.False(t, Enforcing(), "missing file")
+
+	require.NoError(t, os.WriteFile(EnforcePath, []byte("0"), 0644))
+	assert.False(t, Enforcing(), "permissive")
+
+	require.NoError(t, os.WriteFile(EnforcePath, []byte("1\n"), 0644))
+	assert.True(t, Enforcing(), "enforcing")
+}
+
+func TestFileContexts(t *testing.T) {
+	for _, fc := range FileContexts() {
+		_, err := regexp.Compile("^" + fc.Pattern + "$")
+		require.NoError(t, err, fc.Pattern)
+		assert.True(t, strings.HasPrefix(fc.Pattern, fc.Dir), "%s should be under %s", fc.Pattern, fc.Dir)
+		assert.NotEmpty(t, fc.Type)
+	}
+}
@@ -0,0 +1,125 @@
+// Package signatures verifies container image signatures using cosign.
+package signatures
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+)
+
+// Verifier verifies image signatures by means of the cosign binary.
+type Verifier struct {
+	bin      string
+	cfg      ecv1beta1.ImageVerification
+	offline  bool
+	localDir string
+}
+
+// NewVerifier returns a Verifier that uses the cosign binary found at bin. If
+// offline is set no transparency log lookups are attempted, this is meant to
+// be used in air gapped environments.
+func NewVerifier(bin string, cfg ecv1beta1.ImageVerification, offline bool) *Verifier {
+	return &Verifier{bin: bin, cfg: cfg, offline: offline}
+}
+
+// WithLocalImages makes the verifier read the images and their signatures from the OCI
+// layouts in dir, as written by 'cosign save', instead of the registry. Air gapped
+// installations verify the signatures shipped in the airgap bundle this way.
+func (v *Verifier) WithLocalImages(dir string) *Verifier {
+	v.localDir = dir
+	return v
+}
+
+// LayoutName returns the name of the directory holding the OCI layout of the image.
+func LayoutName(image string) string {
+	return strings.NewReplacer("/", "_", ":", "_", "@", "_").Replace(image)
+}
+
+// Validate makes sure the verification configuration is usable. Exactly one of
+// public key or keyless identity must be set.
+func Validate(cfg ecv1beta1.ImageVerification) error {
+	if cfg.PublicKey == "" && cfg.Keyless == nil {
+		return fmt.Errorf("either a public key or a keyless identity must be provided")
+	}
+	if cfg.PublicKey != "" && cfg.Keyless != nil {
+		return fmt.Errorf("public key and keyless identity are mutually exclusive")
+	}
+	if cfg.Keyless != nil && (cfg.Keyless.Issuer == "" || cfg.Keyless.Subject == "") {
+		return fmt.Errorf("keyless identity requires both issuer and subject")
+	}
+	return nil
+}
+
+// VerifyImages verifies the signature of all provided images. An error is
+// returned if any of the images has a missing or invalid signature.
+func (v *Verifier) VerifyImages(images []string) error {
+	if err := Validate(v.cfg); err != nil {
+		return fmt.Errorf("invalid image verification config: %w", err)
+	}
+
+	var keyfile string
+	if v.cfg.PublicKey != "" {
+		fp, err := os.CreateTemp("", "cosign-*.pub")
+		if err != nil {
+			return fmt.Errorf("unable to create public key file: %w", err)
+		}
+		defer os.Remove(fp.Name())
+		if _, err := fp.WriteString(v.cfg.PublicKey); err != nil {
+			fp.Close()
+			return fmt.Errorf("unable to write public key file: %w", err)
+		}
+		if err := fp.Close(); err != nil {
+			return fmt.Errorf("unable to close public key file: %w", err)
+		}
+		keyfile = fp.Name()
+	}
+
+	var failed []string
+	for _, image := range images {
+		logrus.Debugf("verifying signature for image %s", image)
+		ref := image
+		if v.localDir != "" {
+			ref = filepath.Join(v.localDir, LayoutName(image))
+			if _, err := os.Stat(ref); err != nil {
+				logrus.Debugf("no signature shipped for %s: %v", image, err)
+				failed = append(failed, image)
+				continue
+			}
+		}
+		if _, err := helpers.RunCommand(v.bin, v.args(ref, keyfile)...); err != nil {
+			logrus.Debugf("signature verification failed for %s: %v", image, err)
+			failed = append(failed, image)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("missing or invalid signature for images: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// args returns the cosign arguments used to verify the provided image, the path of its
+// OCI layout when reading local images.
+func (v *Verifier) args(image, keyfile string) []string {
+	args := []string{"verify", "--output", "text"}
+	if keyfile != "" {
+		args = append(args, "--key", keyfile)
+	} else if v.cfg.Keyless != nil {
+		args = append(args,
+			"--certificate-identity", v.cfg.Keyless.Subject,
+			"--certificate-oidc-issuer", v.cfg.Keyless.Issuer,
+		)
+	}
+	if v.offline {
+		args = append(args, "--offline")
+	}
+	if v.localDir != "" {
+		return append(args, "--local-image", image)
+	}
+	return append(args, image)
+}
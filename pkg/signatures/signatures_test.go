@@ -0,0 +1,90 @@
+package signatures
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     ecv1beta1.ImageVerification
+		wantErr bool
+	}{
+		{
+			name:    "empty",
+			cfg:     ecv1beta1.ImageVerification{},
+			wantErr: true,
+		},
+		{
+			name: "public key",
+			cfg:  ecv1beta1.ImageVerification{PublicKey: "key"},
+		},
+		{
+			name: "keyless",
+			cfg: ecv1beta1.ImageVerification{
+				Keyless: &ecv1beta1.KeylessIdentity{Issuer: "https://issuer", Subject: "me@example.com"},
+			},
+		},
+		{
+			name: "keyless without subject",
+			cfg: ecv1beta1.ImageVerification{
+				Keyless: &ecv1beta1.KeylessIdentity{Issuer: "https://issuer"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "both",
+			cfg: ecv1beta1.ImageVerification{
+				PublicKey: "key",
+				Keyless:   &ecv1beta1.KeylessIdentity{Issuer: "https://issuer", Subject: "me@example.com"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.cfg)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestVerifierArgs(t *testing.T) {
+	v := NewVerifier("cosign", ecv1beta1.ImageVerification{PublicKey: "key"}, true)
+	assert.Equal(t,
+		[]string{"verify", "--output", "text", "--key", "/tmp/key.pub", "--offline", "registry/image:1"},
+		v.args("registry/image:1", "/tmp/key.pub"),
+	)
+
+	v = NewVerifier("cosign", ecv1beta1.ImageVerification{
+		Keyless: &ecv1beta1.KeylessIdentity{Issuer: "https://issuer", Subject: "me@example.com"},
+	}, false)
+	assert.Equal(t,
+		[]string{
+			"verify", "--output", "text",
+			"--certificate-identity", "me@example.com",
+			"--certificate-oidc-issuer", "https://issuer",
+			"registry/image:1",
+		},
+		v.args("registry/image:1", ""),
+	)
+}
+
+func TestVerifierLocalImages(t *testing.T) {
+	v := NewVerifier("cosign", ecv1beta1.ImageVerification{PublicKey: "key"}, true).WithLocalImages("/tmp/signatures")
+	assert.Equal(t,
+		[]string{"verify", "--output", "text", "--key", "/tmp/key.pub", "--offline", "--local-image", "/tmp/signatures/registry_image_1"},
+		v.args("/tmp/signatures/"+LayoutName("registry/image:1"), "/tmp/key.pub"),
+	)
+
+	err := v.VerifyImages([]string{"registry/image:1"})
+	assert.EqualError(t, err, "missing or invalid signature for images: registry/image:1")
+}
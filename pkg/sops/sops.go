@@ -0,0 +1,301 @@
+// Package sops decrypts yaml documents encrypted with sops (https://getsops.io) using age
+// keys. This allows users to keep sensitive values encrypted in the files they commit to
+// their repositories. Only the age key type is supported. The message authentication code
+// of the document is verified, documents that have been tampered with are refused.
+package sops
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// KeyEnv is the environment variable holding the age private key(s).
+	KeyEnv = "SOPS_AGE_KEY"
+	// KeyFileEnv is the environment variable pointing to a file holding the age private
+	// key(s).
+	KeyFileEnv = "SOPS_AGE_KEY_FILE"
+)
+
+// encryptedValue matches the values encrypted by sops.
+var encryptedValue = regexp.MustCompile(`^ENC\[AES256_GCM,data:(.*),iv:(.+),tag:(.+),type:(.+)\]$`)
+
+// metadata holds the fields of the sops metadata we use.
+type metadata struct {
+	Age []struct {
+		Recipient string `yaml:"recipient"`
+		Enc       string `yaml:"enc"`
+	} `yaml:"age"`
+	LastModified     string `yaml:"lastmodified"`
+	MAC              string `yaml:"mac"`
+	MACOnlyEncrypted bool   `yaml:"mac_only_encrypted"`
+}
+
+// IsEncrypted returns true if the provided yaml document has been encrypted with sops.
+func IsEncrypted(data []byte) bool {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return false
+	}
+	_, ok := doc["sops"]
+	return ok
+}
+
+// Decrypt decrypts a sops encrypted yaml document. The age identities are read from the
+// environment (see KeyEnv and KeyFileEnv) or from the sops default key file location.
+func Decrypt(data []byte) ([]byte, error) {
+	identities, err := Identities()
+	if err != nil {
+		return nil, err
+	}
+	return DecryptWith(data, identities)
+}
+
+// DecryptWith decrypts a sops encrypted yaml document using the provided age identities.
+func DecryptWith(data []byte, identities []age.Identity) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal document: %w", err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("document is not a yaml map")
+	}
+	root := doc.Content[0]
+
+	var meta *metadata
+	content := make([]*yaml.Node, 0, len(root.Content))
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "sops" {
+			content = append(content, root.Content[i], root.Content[i+1])
+			continue
+		}
+		meta = &metadata{}
+		if err := root.Content[i+1].Decode(meta); err != nil {
+			return nil, fmt.Errorf("unable to decode sops metadata: %w", err)
+		}
+	}
+	if meta == nil {
+		return nil, fmt.Errorf("document is not encrypted with sops")
+	}
+	root.Content = content
+
+	key, err := dataKey(meta, identities)
+	if err != nil {
+		return nil, err
+	}
+	mac := sha512.New()
+	if err := decryptNode(root, key, nil, mac, meta.MACOnlyEncrypted); err != nil {
+		return nil, err
+	}
+	if err := verifyMAC(meta, key, mac.Sum(nil)); err != nil {
+		return nil, err
+	}
+
+	out := bytes.NewBuffer(nil)
+	encoder := yaml.NewEncoder(out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, fmt.Errorf("unable to marshal document: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// Identities returns the age identities found in the environment. If none is set the
+// sops default key file is used.
+func Identities() ([]age.Identity, error) {
+	if key := os.Getenv(KeyEnv); key != "" {
+		identities, err := age.ParseIdentities(strings.NewReader(key))
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %w", KeyEnv, err)
+		}
+		return identities, nil
+	}
+	path := os.Getenv(KeyFileEnv)
+	if path == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, fmt.Errorf("no age key found, set %s or %s", KeyEnv, KeyFileEnv)
+		}
+		path = filepath.Join(dir, "sops", "age", "keys.txt")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("no age key found, set %s or %s: %w", KeyEnv, KeyFileEnv, err)
+	}
+	defer f.Close()
+	identities, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse age key file %s: %w", path, err)
+	}
+	return identities, nil
+}
+
+// dataKey decrypts the key used to encrypt the document values using the first age
+// recipient we hold an identity for.
+func dataKey(meta *metadata, identities []age.Identity) ([]byte, error) {
+	if len(meta.Age) == 0 {
+		return nil, fmt.Errorf("document has not been encrypted for any age recipient")
+	}
+	var errs []string
+	for _, recipient := range meta.Age {
+		reader, err := age.Decrypt(armor.NewReader(strings.NewReader(recipient.Enc)), identities...)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", recipient.Recipient, err))
+			continue
+		}
+		key, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read data key: %w", err)
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unable to decrypt data key: %s", strings.Join(errs, ", "))
+}
+
+// verifyMAC compares the message authentication code stored in the metadata with the
+// one computed over the document values. sops encrypts the MAC using the last modified
+// timestamp as authenticated data.
+func verifyMAC(meta *metadata, key []byte, sum []byte) error {
+	if meta.MAC == "" {
+		return fmt.Errorf("document has no message authentication code")
+	}
+	stored, _, err := decryptValue(meta.MAC, key, []byte(meta.LastModified))
+	if err != nil {
+		return fmt.Errorf("unable to decrypt message authentication code: %w", err)
+	}
+	if !strings.EqualFold(stored, fmt.Sprintf("%X", sum)) {
+		return fmt.Errorf("message authentication code mismatch, the document has been tampered with")
+	}
+	return nil
+}
+
+// decryptNode decrypts all encrypted scalar values found under the provided node. The
+// path (map keys leading to the value) is used by sops as authenticated data. The values
+// are added to the MAC in the order they appear in the document, values that are not
+// encrypted are skipped if macOnlyEncrypted is set.
+func decryptNode(node *yaml.Node, key []byte, path []string, mac hash.Hash, macOnlyEncrypted bool) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			subpath := append(append([]string{}, path...), node.Content[i].Value)
+			if err := decryptNode(node.Content[i+1], key, subpath, mac, macOnlyEncrypted); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			if err := decryptNode(item, key, path, mac, macOnlyEncrypted); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		encrypted, err := decryptScalar(node, key, path)
+		if err != nil {
+			return err
+		}
+		if encrypted || !macOnlyEncrypted {
+			mac.Write(macBytes(node))
+		}
+	}
+	return nil
+}
+
+// macBytes returns the representation of a scalar value sops uses when computing the MAC.
+func macBytes(node *yaml.Node) []byte {
+	switch node.ShortTag() {
+	case "!!null":
+		return nil
+	case "!!int":
+		if v, err := strconv.Atoi(node.Value); err == nil {
+			return []byte(strconv.Itoa(v))
+		}
+	case "!!float":
+		if v, err := strconv.ParseFloat(node.Value, 64); err == nil {
+			return []byte(strconv.FormatFloat(v, 'f', -1, 64))
+		}
+	case "!!bool":
+		if v, err := strconv.ParseBool(node.Value); err == nil {
+			if v {
+				return []byte("True")
+			}
+			return []byte("False")
+		}
+	}
+	return []byte(node.Value)
+}
+
+// decryptScalar decrypts a scalar node in place. Values not encrypted are left as is.
+// Returns true if the value was encrypted.
+func decryptScalar(node *yaml.Node, key []byte, path []string) (bool, error) {
+	if !encryptedValue.MatchString(node.Value) {
+		return false, nil
+	}
+	additional := []byte(strings.Join(path, ":") + ":")
+	plain, typ, err := decryptValue(node.Value, key, additional)
+	if err != nil {
+		return false, fmt.Errorf("unable to decrypt value at %s: %w", strings.Join(path, "."), err)
+	}
+
+	node.Value = plain
+	node.Style = 0
+	switch typ {
+	case "int":
+		node.Tag = "!!int"
+	case "float":
+		node.Tag = "!!float"
+	case "bool":
+		node.Tag = "!!bool"
+		node.Value = strings.ToLower(node.Value)
+	default:
+		node.Tag = "!!str"
+	}
+	return true, nil
+}
+
+// decryptValue decrypts a value encrypted by sops. Returns the plain text value and its
+// type.
+func decryptValue(value string, key, additional []byte) (string, string, error) {
+	match := encryptedValue.FindStringSubmatch(value)
+	if match == nil {
+		return "", "", fmt.Errorf("value is not encrypted")
+	}
+
+	var parts [3][]byte
+	for i, encoded := range match[1:4] {
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return "", "", fmt.Errorf("unable to decode value: %w", err)
+		}
+		parts[i] = decoded
+	}
+	data, iv, tag := parts[0], parts[1], parts[2]
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return "", "", fmt.Errorf("unable to create cipher: %w", err)
+	}
+	plain, err := gcm.Open(nil, iv, append(data, tag...), additional)
+	if err != nil {
+		return "", "", err
+	}
+	return string(plain), match[4], nil
+}
@@ -0,0 +1,166 @@
+package sops
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// encryptValue encrypts a value the same way sops does.
+func encryptValue(t *testing.T, key []byte, value, typ string, path ...string) string {
+	return encryptWith(t, key, value, typ, []byte(strings.Join(path, ":")+":"))
+}
+
+// encryptWith encrypts a value using the provided authenticated data.
+func encryptWith(t *testing.T, key []byte, value, typ string, additional []byte) string {
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+	iv := make([]byte, 32)
+	_, err = rand.Read(iv)
+	require.NoError(t, err)
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	require.NoError(t, err)
+	sealed := gcm.Seal(nil, iv, []byte(value), additional)
+	data, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+	enc := base64.StdEncoding.EncodeToString
+	return fmt.Sprintf("ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:%s]", enc(data), enc(iv), enc(tag), typ)
+}
+
+// encryptKey encrypts the data key for the provided age recipient.
+func encryptKey(t *testing.T, key []byte, recipient *age.X25519Recipient) string {
+	buf := bytes.NewBuffer(nil)
+	armored := armor.NewWriter(buf)
+	writer, err := age.Encrypt(armored, recipient)
+	require.NoError(t, err)
+	_, err = writer.Write(key)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	require.NoError(t, armored.Close())
+	return buf.String()
+}
+
+func encryptedDocument(t *testing.T, identity *age.X25519Identity) []byte {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+
+	// the values in the order they appear in the marshaled document.
+	mac := sha512.New()
+	for _, value := range []string{
+		"embeddedcluster.replicated.com/v1beta1",
+		"Config",
+		"True",
+		"3",
+		"config:\n  spec:\n    telemetry:\n      enabled: false\n",
+	} {
+		mac.Write([]byte(value))
+	}
+	lastModified := "2024-01-01T00:00:00Z"
+
+	doc := map[string]interface{}{
+		"apiVersion": "embeddedcluster.replicated.com/v1beta1",
+		"kind":       "Config",
+		"spec": map[string]interface{}{
+			"unsupportedOverrides": map[string]interface{}{
+				"k0s": encryptValue(t, key, "config:\n  spec:\n    telemetry:\n      enabled: false\n", "str", "spec", "unsupportedOverrides", "k0s"),
+			},
+			"replicas": encryptValue(t, key, "3", "int", "spec", "replicas"),
+			"list":     []string{encryptValue(t, key, "true", "bool", "spec", "list")},
+		},
+		"sops": map[string]interface{}{
+			"age": []map[string]string{
+				{
+					"recipient": identity.Recipient().String(),
+					"enc":       encryptKey(t, key, identity.Recipient()),
+				},
+			},
+			"lastmodified": lastModified,
+			"mac":          encryptWith(t, key, fmt.Sprintf("%X", mac.Sum(nil)), "str", []byte(lastModified)),
+			"version":      "3.8.1",
+		},
+	}
+	data, err := yaml.Marshal(doc)
+	require.NoError(t, err)
+	return data
+}
+
+func TestIsEncrypted(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(encryptedDocument(t, identity)))
+	assert.False(t, IsEncrypted([]byte("apiVersion: v1\nkind: Config\n")))
+	assert.False(t, IsEncrypted([]byte("- not a map")))
+}
+
+func TestDecryptWith(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	data := encryptedDocument(t, identity)
+
+	decrypted, err := DecryptWith(data, []age.Identity{identity})
+	require.NoError(t, err)
+	var doc map[string]interface{}
+	require.NoError(t, yaml.Unmarshal(decrypted, &doc))
+	assert.NotContains(t, doc, "sops")
+	assert.Equal(t, "Config", doc["kind"])
+	spec := doc["spec"].(map[string]interface{})
+	assert.Equal(t, 3, spec["replicas"])
+	assert.Equal(t, []interface{}{true}, spec["list"])
+	overrides := spec["unsupportedOverrides"].(map[string]interface{})
+	assert.Equal(t, "config:\n  spec:\n    telemetry:\n      enabled: false\n", overrides["k0s"])
+
+	other, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	_, err = DecryptWith(data, []age.Identity{other})
+	assert.Error(t, err)
+
+	_, err = DecryptWith([]byte("kind: Config\n"), []age.Identity{identity})
+	assert.Error(t, err)
+}
+
+func TestDecryptWithTamperedDocument(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	data := encryptedDocument(t, identity)
+
+	tampered := bytes.Replace(data, []byte("kind: Config"), []byte("kind: Other"), 1)
+	require.NotEqual(t, data, tampered)
+	_, err = DecryptWith(tampered, []age.Identity{identity})
+	assert.ErrorContains(t, err, "message authentication code mismatch")
+
+	var doc map[string]interface{}
+	require.NoError(t, yaml.Unmarshal(data, &doc))
+	delete(doc["sops"].(map[string]interface{}), "mac")
+	withoutMAC, err := yaml.Marshal(doc)
+	require.NoError(t, err)
+	_, err = DecryptWith(withoutMAC, []age.Identity{identity})
+	assert.ErrorContains(t, err, "no message authentication code")
+}
+
+func TestDecrypt(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	data := encryptedDocument(t, identity)
+
+	t.Setenv(KeyEnv, "")
+	t.Setenv(KeyFileEnv, "/does/not/exist")
+	_, err = Decrypt(data)
+	assert.Error(t, err)
+
+	t.Setenv(KeyEnv, identity.String())
+	decrypted, err := Decrypt(data)
+	require.NoError(t, err)
+	assert.False(t, IsEncrypted(decrypted))
+}
@@ -3,6 +3,14 @@ package spinner
 // Option is a function that sets an option on a MessageWriter.
 type Option func(*MessageWriter)
 
+// defaultOptions are applied to every MessageWriter before the options provided to Start.
+var defaultOptions []Option
+
+// SetDefaultOptions sets the options applied to every MessageWriter started afterwards.
+func SetDefaultOptions(opts ...Option) {
+	defaultOptions = opts
+}
+
 // WithWriter sets the WriteFn on the MessageWriter.
 func WithWriter(w WriteFn) Option {
 	return func(m *MessageWriter) {
@@ -35,3 +43,11 @@ func WithMask(mfn MaskFn) Option {
 func (m *MessageWriter) SetMask(mfn MaskFn) {
 	m.mask = mfn
 }
+
+// WithObserver sets a function that receives every message printed by the
+// MessageWriter, after masking.
+func WithObserver(ob ObserverFn) Option {
+	return func(m *MessageWriter) {
+		m.observer = ob
+	}
+}
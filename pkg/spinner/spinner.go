@@ -21,14 +21,18 @@ type LineBreakerFn func(string) (bool, string)
 // returns a string, the returned string is printed to the terminal.
 type MaskFn func(string) string
 
+// ObserverFn is a function that receives every message printed by a MessageWriter.
+type ObserverFn func(string)
+
 // MessageWriter implements io.Writer on top of a channel of strings.
 type MessageWriter struct {
-	ch     chan string
-	end    chan struct{}
-	err    bool
-	printf WriteFn
-	mask   MaskFn
-	lbreak LineBreakerFn
+	ch       chan string
+	end      chan struct{}
+	err      bool
+	printf   WriteFn
+	mask     MaskFn
+	lbreak   LineBreakerFn
+	observer ObserverFn
 }
 
 // Write implements io.Writer for the MessageWriter.
@@ -113,6 +117,10 @@ func (m *MessageWriter) loop() {
 			message = m.mask(message)
 		}
 
+		if m.observer != nil && previous != message && message != "" {
+			m.observer(message)
+		}
+
 		if m.lbreak != nil && previous != message {
 			if lbreak, lcontent := m.lbreak(message); lbreak {
 				if diff := len(previous) - len(lcontent); diff > 0 {
@@ -146,6 +154,9 @@ func Start(opts ...Option) *MessageWriter {
 		end:    make(chan struct{}),
 		printf: fmt.Printf,
 	}
+	for _, opt := range defaultOptions {
+		opt(mw)
+	}
 	for _, opt := range opts {
 		opt(mw)
 	}
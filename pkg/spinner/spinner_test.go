@@ -137,3 +137,17 @@ func TestLineBreak(t *testing.T) {
 	assert.Contains(t, buf.String(), "ping 7")
 	assert.Contains(t, buf.String(), "test 99")
 }
+
+func TestObserver(t *testing.T) {
+	var observed []string
+	pb := Start(
+		WithWriter(WriteTo(bytes.NewBuffer(nil))),
+		WithMask(strings.ToUpper),
+		WithObserver(func(msg string) { observed = append(observed, msg) }),
+	)
+	pb.Infof("installing")
+	pb.Infof("installing")
+	pb.Infof("waiting")
+	pb.Close()
+	assert.Equal(t, []string{"INSTALLING", "WAITING"}, observed)
+}
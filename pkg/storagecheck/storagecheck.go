@@ -0,0 +1,303 @@
+// Package storagecheck validates the default storage class of a cluster by exercising
+// each of its capabilities: a volume claim without a storage class is created, so it is
+// assigned the default one by admission, and mounted by a pod. The volume is then resized
+// and a snapshot of it is taken. The result is reported as capability flags.
+package storagecheck
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+const (
+	// resourceName is the name of the volume claim, pod and snapshot created by the check.
+	resourceName = "embedded-cluster-storage-check"
+	// defaultClassAnnotation marks the default storage class.
+	defaultClassAnnotation = "storageclass.kubernetes.io/is-default-class"
+	// betaDefaultClassAnnotation is the deprecated annotation marking the default
+	// storage class, still honored by the admission plugin.
+	betaDefaultClassAnnotation = "storageclass.beta.kubernetes.io/is-default-class"
+)
+
+var (
+	// volumeSize is the size of the volume provisioned by the check.
+	volumeSize = resource.MustParse("16Mi")
+	// expandedVolumeSize is the size the volume is resized to.
+	expandedVolumeSize = resource.MustParse("32Mi")
+
+	snapshotGVK            = schema.GroupVersionKind{Group: "snapshot.storage.k8s.io", Version: "v1", Kind: "VolumeSnapshot"}
+	snapshotClassListGVK   = schema.GroupVersionKind{Group: "snapshot.storage.k8s.io", Version: "v1", Kind: "VolumeSnapshotClassList"}
+	defaultTimeout         = 2 * time.Minute
+	defaultPollingInterval = 2 * time.Second
+)
+
+// Options configures the check.
+type Options struct {
+	// Namespace is where the check resources are created.
+	Namespace string
+	// Image is the image of the pod mounting the volume, the pause image is enough.
+	Image string
+	// Timeout bounds each step of the check, defaults to 2 minutes.
+	Timeout time.Duration
+}
+
+// Run validates the default storage class and returns its capabilities. Capabilities
+// that could not be validated are false and the reason is reported. The resources
+// created by the check are removed before returning.
+func Run(ctx context.Context, kcli client.Client, opts Options) *ecv1beta1.StorageCapabilities {
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultTimeout
+	}
+	caps := &ecv1beta1.StorageCapabilities{CheckedAt: metav1.Now()}
+
+	sc, err := DefaultStorageClass(ctx, kcli)
+	if err != nil {
+		caps.Reason = err.Error()
+		return caps
+	}
+	caps.StorageClass = sc.Name
+	defer cleanup(context.WithoutCancel(ctx), kcli, opts)
+
+	if err := checkProvisioning(ctx, kcli, sc, opts); err != nil {
+		caps.Reason = fmt.Sprintf("provisioning: %v", err)
+		return caps
+	}
+	caps.Provisioning = true
+
+	reasons := []string{}
+	if err := checkExpansion(ctx, kcli, sc, opts); err != nil {
+		reasons = append(reasons, fmt.Sprintf("expansion: %v", err))
+	} else {
+		caps.Expansion = true
+	}
+	if err := checkSnapshots(ctx, kcli, sc, opts); err != nil {
+		reasons = append(reasons, fmt.Sprintf("snapshots: %v", err))
+	} else {
+		caps.Snapshots = true
+	}
+	caps.Reason = strings.Join(reasons, "; ")
+	return caps
+}
+
+// DefaultStorageClass returns the default storage class. Exactly one storage class must
+// be the default one so volume claims without a storage class are admitted with it
+// regardless of the kubernetes version.
+func DefaultStorageClass(ctx context.Context, kcli client.Client) (*storagev1.StorageClass, error) {
+	var list storagev1.StorageClassList
+	if err := kcli.List(ctx, &list); err != nil {
+		return nil, fmt.Errorf("unable to list storage classes: %w", err)
+	}
+	defaults := []storagev1.StorageClass{}
+	for _, sc := range list.Items {
+		if isDefaultClass(sc) {
+			defaults = append(defaults, sc)
+		}
+	}
+	switch len(defaults) {
+	case 0:
+		return nil, fmt.Errorf("no default storage class")
+	case 1:
+		return &defaults[0], nil
+	}
+	names := []string{}
+	for _, sc := range defaults {
+		names = append(names, sc.Name)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("multiple default storage classes: %s", strings.Join(names, ", "))
+}
+
+func isDefaultClass(sc storagev1.StorageClass) bool {
+	return sc.Annotations[defaultClassAnnotation] == "true" || sc.Annotations[betaDefaultClassAnnotation] == "true"
+}
+
+// checkProvisioning creates a volume claim assigned the default storage class by admission
+// and waits for a pod mounting it to run.
+func checkProvisioning(ctx context.Context, kcli client.Client, sc *storagev1.StorageClass, opts Options) error {
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: opts.Namespace},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: volumeSize},
+			},
+		},
+	}
+	if err := kcli.Create(ctx, pvc); err != nil {
+		return fmt.Errorf("unable to create volume claim: %w", err)
+	}
+	if name := ptr.Deref(pvc.Spec.StorageClassName, ""); name != sc.Name {
+		return fmt.Errorf("volume claim admitted with storage class %q instead of %q", name, sc.Name)
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: opts.Namespace},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:            "check",
+				Image:           opts.Image,
+				ImagePullPolicy: corev1.PullIfNotPresent,
+				VolumeMounts:    []corev1.VolumeMount{{Name: "data", MountPath: "/data"}},
+			}},
+			Volumes: []corev1.Volume{{
+				Name: "data",
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: resourceName},
+				},
+			}},
+			Tolerations:                   []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+			TerminationGracePeriodSeconds: ptr.To[int64](0),
+		},
+	}
+	if err := kcli.Create(ctx, pod); err != nil {
+		return fmt.Errorf("unable to create pod: %w", err)
+	}
+
+	return poll(ctx, opts, "volume to be mounted", func(ctx context.Context) (bool, error) {
+		if err := kcli.Get(ctx, client.ObjectKeyFromObject(pod), pod); err != nil {
+			return false, err
+		}
+		if err := kcli.Get(ctx, client.ObjectKeyFromObject(pvc), pvc); err != nil {
+			return false, err
+		}
+		return pvc.Status.Phase == corev1.ClaimBound && pod.Status.Phase == corev1.PodRunning, nil
+	})
+}
+
+// checkExpansion resizes the volume and waits for its new capacity to be reported.
+func checkExpansion(ctx context.Context, kcli client.Client, sc *storagev1.StorageClass, opts Options) error {
+	if !ptr.Deref(sc.AllowVolumeExpansion, false) {
+		return fmt.Errorf("storage class %s does not allow volume expansion", sc.Name)
+	}
+	pvc := &corev1.PersistentVolumeClaim{}
+	key := client.ObjectKey{Namespace: opts.Namespace, Name: resourceName}
+	if err := kcli.Get(ctx, key, pvc); err != nil {
+		return fmt.Errorf("unable to get volume claim: %w", err)
+	}
+	pvc.Spec.Resources.Requests[corev1.ResourceStorage] = expandedVolumeSize
+	if err := kcli.Update(ctx, pvc); err != nil {
+		return fmt.Errorf("unable to resize volume claim: %w", err)
+	}
+	return poll(ctx, opts, "volume to be resized", func(ctx context.Context) (bool, error) {
+		if err := kcli.Get(ctx, key, pvc); err != nil {
+			return false, err
+		}
+		capacity, ok := pvc.Status.Capacity[corev1.ResourceStorage]
+		return ok && capacity.Cmp(expandedVolumeSize) >= 0, nil
+	})
+}
+
+// checkSnapshots takes a snapshot of the volume with the snapshot class of the storage
+// class provisioner and waits for it to be ready to use.
+func checkSnapshots(ctx context.Context, kcli client.Client, sc *storagev1.StorageClass, opts Options) error {
+	classes := &unstructured.UnstructuredList{}
+	classes.SetGroupVersionKind(snapshotClassListGVK)
+	if err := kcli.List(ctx, classes); err != nil {
+		if meta.IsNoMatchError(err) || k8serrors.IsNotFound(err) {
+			return fmt.Errorf("volume snapshots are not supported by the cluster")
+		}
+		return fmt.Errorf("unable to list volume snapshot classes: %w", err)
+	}
+	class := SnapshotClassFor(classes.Items, sc.Provisioner)
+	if class == "" {
+		return fmt.Errorf("no volume snapshot class for provisioner %s", sc.Provisioner)
+	}
+
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(snapshotGVK)
+	snapshot.SetNamespace(opts.Namespace)
+	snapshot.SetName(resourceName)
+	snapshot.Object["spec"] = map[string]interface{}{
+		"volumeSnapshotClassName": class,
+		"source": map[string]interface{}{
+			"persistentVolumeClaimName": resourceName,
+		},
+	}
+	if err := kcli.Create(ctx, snapshot); err != nil {
+		return fmt.Errorf("unable to create volume snapshot: %w", err)
+	}
+	return poll(ctx, opts, "volume snapshot to be ready", func(ctx context.Context) (bool, error) {
+		if err := kcli.Get(ctx, client.ObjectKeyFromObject(snapshot), snapshot); err != nil {
+			return false, err
+		}
+		if msg, _, _ := unstructured.NestedString(snapshot.Object, "status", "error", "message"); msg != "" {
+			return false, fmt.Errorf("volume snapshot failed: %s", msg)
+		}
+		ready, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse")
+		return ready, nil
+	})
+}
+
+// SnapshotClassFor returns the name of the volume snapshot class of the provided driver,
+// preferring the default one. Returns an empty string if there is none.
+func SnapshotClassFor(classes []unstructured.Unstructured, driver string) string {
+	found := ""
+	for _, class := range classes {
+		if d, _, _ := unstructured.NestedString(class.Object, "driver"); d != driver {
+			continue
+		}
+		if class.GetAnnotations()["snapshot.storage.kubernetes.io/is-default-class"] == "true" {
+			return class.GetName()
+		}
+		if found == "" {
+			found = class.GetName()
+		}
+	}
+	return found
+}
+
+// poll runs the condition until it is met or the step timeout expires. An error returned
+// by the condition is only reported if the condition is never met.
+func poll(ctx context.Context, opts Options, what string, condition func(context.Context) (bool, error)) error {
+	var lasterr error
+	if err := wait.PollUntilContextTimeout(
+		ctx, defaultPollingInterval, opts.Timeout, true, func(ctx context.Context) (bool, error) {
+			done, err := condition(ctx)
+			if err != nil {
+				lasterr = err
+				return false, nil
+			}
+			return done, nil
+		},
+	); err != nil {
+		if lasterr != nil {
+			return fmt.Errorf("timed out waiting for %s: %v", what, lasterr)
+		}
+		return fmt.Errorf("timed out waiting for %s", what)
+	}
+	return nil
+}
+
+// cleanup removes the resources created by the check. Errors are only logged, they do
+// not change the outcome of the check.
+func cleanup(ctx context.Context, kcli client.Client, opts Options) {
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(snapshotGVK)
+	objects := []client.Object{snapshot, &corev1.Pod{}, &corev1.PersistentVolumeClaim{}}
+	for _, obj := range objects {
+		obj.SetNamespace(opts.Namespace)
+		obj.SetName(resourceName)
+		err := kcli.Delete(ctx, obj, client.GracePeriodSeconds(0), client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if err != nil && !k8serrors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+			logrus.Debugf("unable to delete storage check %T: %v", obj, err)
+		}
+	}
+}
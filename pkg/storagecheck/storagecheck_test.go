@@ -0,0 +1,114 @@
+package storagecheck
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func storageClass(name string, isDefault bool) *storagev1.StorageClass {
+	sc := &storagev1.StorageClass{
+		ObjectMeta:  metav1.ObjectMeta{Name: name},
+		Provisioner: "openebs.io/local",
+	}
+	if isDefault {
+		sc.Annotations = map[string]string{defaultClassAnnotation: "true"}
+	}
+	return sc
+}
+
+func TestDefaultStorageClass(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		classes []client.Object
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "no storage class",
+			wantErr: "no default storage class",
+		},
+		{
+			name:    "no default storage class",
+			classes: []client.Object{storageClass("standard", false)},
+			wantErr: "no default storage class",
+		},
+		{
+			name:    "one default storage class",
+			classes: []client.Object{storageClass("standard", false), storageClass("openebs-hostpath", true)},
+			want:    "openebs-hostpath",
+		},
+		{
+			name: "beta annotation",
+			classes: []client.Object{&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{
+				Name:        "legacy",
+				Annotations: map[string]string{betaDefaultClassAnnotation: "true"},
+			}}},
+			want: "legacy",
+		},
+		{
+			name:    "multiple default storage classes",
+			classes: []client.Object{storageClass("standard", true), storageClass("openebs-hostpath", true)},
+			wantErr: "multiple default storage classes: openebs-hostpath, standard",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			kcli := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(tt.classes...).Build()
+			sc, err := DefaultStorageClass(context.Background(), kcli)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, sc.Name)
+		})
+	}
+}
+
+func TestSnapshotClassFor(t *testing.T) {
+	class := func(name, driver string, isDefault bool) unstructured.Unstructured {
+		u := unstructured.Unstructured{Object: map[string]interface{}{"driver": driver}}
+		u.SetName(name)
+		if isDefault {
+			u.SetAnnotations(map[string]string{"snapshot.storage.kubernetes.io/is-default-class": "true"})
+		}
+		return u
+	}
+	classes := []unstructured.Unstructured{
+		class("other", "ebs.csi.aws.com", true),
+		class("first", "rook-ceph.rbd.csi.ceph.com", false),
+		class("default", "rook-ceph.rbd.csi.ceph.com", true),
+	}
+	assert.Equal(t, "default", SnapshotClassFor(classes, "rook-ceph.rbd.csi.ceph.com"))
+	assert.Equal(t, "first", SnapshotClassFor(classes[:2], "rook-ceph.rbd.csi.ceph.com"))
+	assert.Equal(t, "", SnapshotClassFor(classes, "openebs.io/local"))
+}
+
+func TestRun(t *testing.T) {
+	kcli := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	caps := Run(context.Background(), kcli, Options{Namespace: "kube-system", Image: "pause"})
+	assert.False(t, caps.Provisioning)
+	assert.Equal(t, "no default storage class", caps.Reason)
+
+	// the fake client does not run admission, the claim is not assigned the default class.
+	kcli = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(storageClass("openebs-hostpath", true)).Build()
+	caps = Run(context.Background(), kcli, Options{Namespace: "kube-system", Image: "pause"})
+	assert.Equal(t, "openebs-hostpath", caps.StorageClass)
+	assert.False(t, caps.Provisioning)
+	assert.False(t, caps.Expansion)
+	assert.False(t, caps.Snapshots)
+	assert.Equal(t, `provisioning: volume claim admitted with storage class "" instead of "openebs-hostpath"`, caps.Reason)
+
+	err := kcli.Get(context.Background(), client.ObjectKey{Namespace: "kube-system", Name: resourceName}, &corev1.PersistentVolumeClaim{})
+	assert.True(t, errors.IsNotFound(err), "the volume claim must be removed")
+}
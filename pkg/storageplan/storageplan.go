@@ -0,0 +1,184 @@
+// Package storageplan places and sizes the storage of the cluster: the directory where the
+// OpenEBS local provisioner stores the persistent volumes, which can be the mount point of
+// a separate filesystem, the free space reserved for them, and the size of the volume of
+// the embedded registry. The plan is chosen at installation time, kept in the installation
+// and persisted on every node so host operations know where the volumes are.
+package storageplan
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/defaults"
+	"github.com/replicatedhq/embedded-cluster/pkg/helm"
+)
+
+const (
+	// DefaultRegistryStorageSize is the size of the volume of the embedded registry.
+	DefaultRegistryStorageSize = "10Gi"
+	// MinHostDiskSize is the minimum size of the filesystems holding the embedded cluster
+	// home directory and the k0s data directory.
+	MinHostDiskSize = "40Gi"
+	// MinDataDiskSize is the minimum size of the filesystems holding the persistent
+	// volumes and the temporary files.
+	MinDataDiskSize = "5Gi"
+	// OpenEBSChart is the name of the OpenEBS chart.
+	OpenEBSChart = "openebs"
+	// RegistryChart is the name of the embedded registry chart.
+	RegistryChart = "docker-registry"
+)
+
+// DataDir returns the directory where the persistent volumes are stored.
+func DataDir(spec *ecv1beta1.StorageSpec) string {
+	if spec == nil || spec.OpenEBSDataDir == "" {
+		return defaults.OpenEBSDataDir
+	}
+	return spec.OpenEBSDataDir
+}
+
+// LocalVolumesDir returns the directory where the OpenEBS local provisioner creates the
+// directory of each volume.
+func LocalVolumesDir(spec *ecv1beta1.StorageSpec) string {
+	return filepath.Join(DataDir(spec), "local")
+}
+
+// RegistryStorageSize returns the size of the volume of the embedded registry.
+func RegistryStorageSize(spec *ecv1beta1.StorageSpec) string {
+	if spec == nil || spec.RegistryStorageSize == "" {
+		return DefaultRegistryStorageSize
+	}
+	return spec.RegistryStorageSize
+}
+
+// Validate returns an error if the data directory is not an absolute path or if the
+// sizes are not valid quantities.
+func Validate(spec *ecv1beta1.StorageSpec) error {
+	if spec == nil {
+		return nil
+	}
+	if spec.OpenEBSDataDir != "" && !filepath.IsAbs(spec.OpenEBSDataDir) {
+		return fmt.Errorf("openebs data directory %s must be an absolute path", spec.OpenEBSDataDir)
+	}
+	sizes := map[string]string{
+		"openebs storage reservation": spec.OpenEBSReservation,
+		"registry storage size":       spec.RegistryStorageSize,
+	}
+	for name, size := range sizes {
+		if size == "" {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(size)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %w", name, size, err)
+		} else if quantity.Sign() <= 0 {
+			return fmt.Errorf("invalid %s %q: must be positive", name, size)
+		}
+	}
+	return nil
+}
+
+// RequiredSpace returns the free space needed on the filesystem of the data directory:
+// the reservation plus, when the node hosts the volume of the embedded registry, its
+// size. An empty string is returned when no space is reserved.
+func RequiredSpace(spec *ecv1beta1.StorageSpec, withRegistry bool) (string, error) {
+	var required resource.Quantity
+	if spec != nil && spec.OpenEBSReservation != "" {
+		reservation, err := resource.ParseQuantity(spec.OpenEBSReservation)
+		if err != nil {
+			return "", fmt.Errorf("invalid openebs storage reservation: %w", err)
+		}
+		required.Add(reservation)
+	}
+	if withRegistry {
+		size, err := resource.ParseQuantity(RegistryStorageSize(spec))
+		if err != nil {
+			return "", fmt.Errorf("invalid registry storage size: %w", err)
+		}
+		required.Add(size)
+	}
+	if required.IsZero() {
+		return "", nil
+	}
+	return required.String(), nil
+}
+
+// ChartValues places the volumes of the OpenEBS chart in the data directory and sizes the
+// volume of the embedded registry chart. Values of other charts are returned as they are.
+func ChartValues(chartName, values string, spec *ecv1beta1.StorageSpec) (string, error) {
+	var path string
+	var value interface{}
+	switch {
+	case chartName == OpenEBSChart && spec != nil && spec.OpenEBSDataDir != "":
+		path, value = "$['localpv-provisioner'].hostpathClass.basePath", LocalVolumesDir(spec)
+	case chartName == RegistryChart && spec != nil && spec.RegistryStorageSize != "":
+		path, value = "persistence.size", spec.RegistryStorageSize
+	default:
+		return values, nil
+	}
+	parsed, err := helm.UnmarshalValues(values)
+	if err != nil {
+		return "", fmt.Errorf("unable to unmarshal values: %w", err)
+	}
+	if parsed, err = helm.SetValue(parsed, path, value); err != nil {
+		return "", fmt.Errorf("unable to set %s: %w", path, err)
+	}
+	return helm.MarshalValues(parsed)
+}
+
+// Write persists the storage plan of this node at path. The file is removed when there
+// is no plan, the defaults apply.
+func Write(path string, spec *ecv1beta1.StorageSpec) error {
+	if spec == nil {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("unable to remove storage plan file: %w", err)
+		}
+		return nil
+	}
+	data, err := yaml.Marshal(spec)
+	if err != nil {
+		return fmt.Errorf("unable to marshal storage plan: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("unable to create directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("unable to write storage plan file: %w", err)
+	}
+	return nil
+}
+
+// Read reads the storage plan persisted at path, nil is returned if there is none.
+func Read(path string) (*ecv1beta1.StorageSpec, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read storage plan file: %w", err)
+	}
+	var spec ecv1beta1.StorageSpec
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal storage plan: %w", err)
+	}
+	return &spec, nil
+}
+
+// HostSpec returns the storage plan persisted on this node, nil if there is none or it
+// can not be read, the defaults apply.
+func HostSpec() *ecv1beta1.StorageSpec {
+	spec, err := Read(defaults.PathToStorageSpec())
+	if err != nil {
+		return nil
+	}
+	return spec
+}
+
+// HostDataDir returns the directory where the persistent volumes are stored on this node.
+func HostDataDir() string {
+	return DataDir(HostSpec())
+}
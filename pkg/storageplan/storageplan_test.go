@@ -0,0 +1,94 @@
+package storageplan
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+func TestValidate(t *testing.T) {
+	for name, tt := range map[string]struct {
+		spec    *ecv1beta1.StorageSpec
+		wantErr string
+	}{
+		"no plan":       {spec: nil},
+		"valid plan":    {spec: &ecv1beta1.StorageSpec{OpenEBSDataDir: "/mnt/data", OpenEBSReservation: "100Gi", RegistryStorageSize: "50Gi"}},
+		"relative dir":  {spec: &ecv1beta1.StorageSpec{OpenEBSDataDir: "data"}, wantErr: "must be an absolute path"},
+		"invalid size":  {spec: &ecv1beta1.StorageSpec{RegistryStorageSize: "lots"}, wantErr: "invalid registry storage size"},
+		"negative size": {spec: &ecv1beta1.StorageSpec{OpenEBSReservation: "-1Gi"}, wantErr: "must be positive"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := Validate(tt.spec)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestRequiredSpace(t *testing.T) {
+	for name, tt := range map[string]struct {
+		spec         *ecv1beta1.StorageSpec
+		withRegistry bool
+		want         string
+	}{
+		"nothing reserved":          {spec: nil, want: ""},
+		"default registry size":     {spec: nil, withRegistry: true, want: "10Gi"},
+		"reservation":               {spec: &ecv1beta1.StorageSpec{OpenEBSReservation: "100Gi"}, want: "100Gi"},
+		"reservation and registry":  {spec: &ecv1beta1.StorageSpec{OpenEBSReservation: "100Gi", RegistryStorageSize: "50Gi"}, withRegistry: true, want: "150Gi"},
+		"registry on another node":  {spec: &ecv1beta1.StorageSpec{RegistryStorageSize: "50Gi"}, want: ""},
+		"mixed units are converted": {spec: &ecv1beta1.StorageSpec{OpenEBSReservation: "512Mi"}, withRegistry: true, want: "10752Mi"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := RequiredSpace(tt.spec, tt.withRegistry)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestChartValues(t *testing.T) {
+	spec := &ecv1beta1.StorageSpec{OpenEBSDataDir: "/mnt/volumes", RegistryStorageSize: "50Gi"}
+
+	values, err := ChartValues(OpenEBSChart, "localpv-provisioner:\n  hostpathClass:\n    enabled: true\n", spec)
+	require.NoError(t, err)
+	assert.Equal(t, "localpv-provisioner:\n  hostpathClass:\n    basePath: /mnt/volumes/local\n    enabled: true\n", values)
+
+	values, err = ChartValues(RegistryChart, "persistence:\n  size: 10Gi\n", spec)
+	require.NoError(t, err)
+	assert.Contains(t, values, "size: 50Gi")
+
+	// other charts and the defaults leave the values untouched.
+	values, err = ChartValues("admin-console", "a: b\n", spec)
+	require.NoError(t, err)
+	assert.Equal(t, "a: b\n", values)
+	values, err = ChartValues(OpenEBSChart, "a: b\n", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "a: b\n", values)
+}
+
+func TestReadWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage.yaml")
+	spec, err := Read(path)
+	require.NoError(t, err)
+	assert.Nil(t, spec)
+
+	want := &ecv1beta1.StorageSpec{OpenEBSDataDir: "/mnt/volumes", OpenEBSReservation: "100Gi"}
+	require.NoError(t, Write(path, want))
+	spec, err = Read(path)
+	require.NoError(t, err)
+	assert.Equal(t, want, spec)
+	assert.Equal(t, "/mnt/volumes/local", LocalVolumesDir(spec))
+
+	require.NoError(t, Write(path, nil))
+	spec, err = Read(path)
+	require.NoError(t, err)
+	assert.Nil(t, spec)
+	assert.Equal(t, "/var/openebs", DataDir(spec))
+}
@@ -0,0 +1,57 @@
+// Package timesync verifies and configures the service keeping the host clock in sync.
+// Etcd members require their clocks to be in sync, skew between controllers causes
+// leader elections and request timeouts that are hard to diagnose after the fact.
+package timesync
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+)
+
+// Services holds the time synchronization services looked for on the host.
+var Services = []string{"chronyd", "chrony", "ntpd", "ntp", "ntpsec", "systemd-timesyncd"}
+
+// chronyServices holds the names chrony is installed as, depending on the distribution.
+var chronyServices = []string{"chronyd", "chrony"}
+
+// ActiveService returns the time synchronization service active on the host. Returns an
+// empty string if none is active.
+func ActiveService(ctx context.Context) string {
+	for _, svc := range Services {
+		if active, err := helpers.IsSystemdServiceActive(ctx, svc); err == nil && active {
+			return svc
+		}
+	}
+	return ""
+}
+
+// EnableChrony enables and starts chrony and waits for the clock to be synchronized.
+// Nothing is done if a time synchronization service is already active. Chrony must be
+// installed on the host.
+func EnableChrony(ctx context.Context) error {
+	if svc := ActiveService(ctx); svc != "" {
+		logrus.Debugf("time synchronization service %s is already active", svc)
+		return nil
+	}
+	var enabled bool
+	for _, svc := range chronyServices {
+		if _, err := helpers.RunCommand("systemctl", "enable", "--now", svc); err != nil {
+			logrus.Debugf("unable to enable %s: %v", svc, err)
+			continue
+		}
+		enabled = true
+		break
+	}
+	if !enabled {
+		return fmt.Errorf("unable to enable chrony, make sure the chrony package is installed")
+	}
+	// chrony steps the clock on the first updates, wait up to a minute for it.
+	if _, err := helpers.RunCommand("chronyc", "waitsync", "6"); err != nil {
+		logrus.Warnf("Chrony is enabled but the clock is not synchronized yet: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+// RecoveryEventReason is the reason of the events recording the recoveries.
+const RecoveryEventReason = "UnattendedRecovery"
+
+// eventSource is the component the recovery events are reported by.
+const eventSource = "embedded-cluster-watchdog"
+
+// RecordRecovery records the recovery of the node as an event of the installation, next
+// to the other events of its lifecycle.
+func RecordRecovery(ctx context.Context, cli client.Client, in *ecv1beta1.Installation, node string, rec Recovery) error {
+	message := fmt.Sprintf("Node %s recovered: %s", node, recoveryDescription(rec.Action))
+	if rec.Reason != "" {
+		message = fmt.Sprintf("%s after %s", message, rec.Reason)
+	}
+	ev := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			// installations are cluster scoped, their events live in the default namespace.
+			Namespace:    metav1.NamespaceDefault,
+			GenerateName: fmt.Sprintf("%s.", in.Name),
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: ecv1beta1.GroupVersion.String(),
+			Kind:       "Installation",
+			Name:       in.Name,
+			UID:        in.UID,
+		},
+		Reason:         RecoveryEventReason,
+		Message:        message,
+		Type:           corev1.EventTypeWarning,
+		Source:         corev1.EventSource{Component: eventSource, Host: node},
+		FirstTimestamp: metav1.NewTime(rec.Time),
+		LastTimestamp:  metav1.NewTime(rec.Time),
+		Count:          1,
+	}
+	if err := cli.Create(ctx, ev); err != nil {
+		return fmt.Errorf("unable to record recovery event: %w", err)
+	}
+	return nil
+}
+
+// recoveryDescription describes the action taken to recover the node.
+func recoveryDescription(action Action) string {
+	switch action {
+	case ActionRestartK0s:
+		return "k0s was restarted"
+	case ActionReboot:
+		return "the host was rebooted"
+	case ActionHostReset:
+		return "the hardware watchdog reset the host"
+	default:
+		return string(action)
+	}
+}
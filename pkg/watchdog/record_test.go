@@ -0,0 +1,34 @@
+package watchdog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+func TestRecordRecovery(t *testing.T) {
+	cli := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	in := &ecv1beta1.Installation{ObjectMeta: metav1.ObjectMeta{Name: "20240501120000", UID: "uid"}}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	rec := Recovery{Action: ActionReboot, Reason: "etcd is not ready", Time: now}
+	require.NoError(t, RecordRecovery(context.Background(), cli, in, "node1", rec))
+
+	var events corev1.EventList
+	require.NoError(t, cli.List(context.Background(), &events))
+	require.Len(t, events.Items, 1)
+	ev := events.Items[0]
+	assert.Equal(t, RecoveryEventReason, ev.Reason)
+	assert.Equal(t, "Installation", ev.InvolvedObject.Kind)
+	assert.Equal(t, "20240501120000", ev.InvolvedObject.Name)
+	assert.Equal(t, "Node node1 recovered: the host was rebooted after etcd is not ready", ev.Message)
+	assert.Equal(t, corev1.EventTypeWarning, ev.Type)
+}
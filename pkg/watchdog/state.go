@@ -0,0 +1,169 @@
+package watchdog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Action is what a health check does to recover the node.
+type Action string
+
+// The actions taken by the health checks, and the recovery recorded when the hardware
+// watchdog reset the host.
+const (
+	ActionNone       Action = ""
+	ActionRestartK0s Action = "RestartK0s"
+	ActionReboot     Action = "Reboot"
+	ActionHostReset  Action = "HardwareWatchdogReset"
+)
+
+const (
+	// maxRebootsPerDay caps the reboots, a node a reboot does not fix is left as it is so
+	// it can be troubleshot.
+	maxRebootsPerDay = 3
+	// maxPending caps the recoveries kept until they can be reported.
+	maxPending = 20
+)
+
+// bootStatusPath reports, on most drivers, if the last reset was caused by the watchdog.
+var bootStatusPath = "/sys/class/watchdog/watchdog0/bootstatus"
+
+// Recovery is an action taken to recover the node.
+type Recovery struct {
+	Action Action    `json:"action"`
+	Reason string    `json:"reason,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// State is kept on disk between the health checks.
+type State struct {
+	// BootID is the boot the state was last updated in.
+	BootID string `json:"bootID,omitempty"`
+	// Failures is the number of consecutive failed health checks.
+	Failures int `json:"failures"`
+	// Restarted tells if k0s was restarted since the last successful health check.
+	Restarted bool `json:"restarted"`
+	// Reboots holds when the health checks rebooted the host.
+	Reboots []time.Time `json:"reboots,omitempty"`
+	// Pending holds the recoveries not reported yet.
+	Pending []Recovery `json:"pending,omitempty"`
+}
+
+// ReadState reads the state at path, an empty state is returned if there is none.
+func ReadState(path string) (State, error) {
+	var state State
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	} else if err != nil {
+		return state, fmt.Errorf("unable to read watchdog state: %w", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("unable to parse watchdog state: %w", err)
+	}
+	return state, nil
+}
+
+// WriteState writes the state to path.
+func WriteState(path string, state State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("unable to encode watchdog state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("unable to create watchdog state dir: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("unable to write watchdog state: %w", err)
+	}
+	return nil
+}
+
+// HostReset returns true if the hardware watchdog caused the last reset of the host.
+// Drivers not reporting it are assumed not to.
+func HostReset() bool {
+	data, err := os.ReadFile(bootStatusPath)
+	if err != nil {
+		return false
+	}
+	status := strings.TrimSpace(string(data))
+	return status != "" && status != "0"
+}
+
+// Boot starts over the health checks when the host booted since the state was last
+// updated, and records a recovery if the hardware watchdog reset the host.
+func (s *State) Boot(bootID string, hostReset bool, now time.Time) {
+	if s.BootID == bootID {
+		return
+	}
+	if s.BootID != "" && hostReset {
+		s.record(Recovery{Action: ActionHostReset, Reason: "the host stopped responding", Time: now})
+	}
+	s.BootID = bootID
+	s.Failures = 0
+	s.Restarted = false
+}
+
+// Pause starts over the health checks while k0s is stopped on purpose for maintenance,
+// the checks would otherwise restart it and undo the maintenance.
+func (s *State) Pause() {
+	s.Failures = 0
+	s.Restarted = false
+}
+
+// Next records the result of a health check and returns the action to take. k0s is
+// restarted after threshold consecutive failures and the host is rebooted after as many
+// again, unless it was already rebooted maxRebootsPerDay times in the last day. The
+// action is recorded as a pending recovery.
+func (s *State) Next(healthy bool, reason string, threshold int, now time.Time) Action {
+	if healthy {
+		s.Failures = 0
+		s.Restarted = false
+		return ActionNone
+	}
+	s.Failures++
+	if s.Failures < threshold {
+		return ActionNone
+	}
+
+	if !s.Restarted {
+		s.Failures = 0
+		s.Restarted = true
+		s.record(Recovery{Action: ActionRestartK0s, Reason: reason, Time: now})
+		return ActionRestartK0s
+	}
+
+	var recent []time.Time
+	for _, reboot := range s.Reboots {
+		if now.Sub(reboot) < 24*time.Hour {
+			recent = append(recent, reboot)
+		}
+	}
+	s.Reboots = recent
+	if len(s.Reboots) >= maxRebootsPerDay {
+		return ActionNone
+	}
+	s.Failures = 0
+	s.Restarted = false
+	s.Reboots = append(s.Reboots, now)
+	s.record(Recovery{Action: ActionReboot, Reason: reason, Time: now})
+	return ActionReboot
+}
+
+// RebootLimitReached returns true if the host is not rebooted anymore because it was
+// rebooted too many times in the last day.
+func (s *State) RebootLimitReached() bool {
+	return len(s.Reboots) >= maxRebootsPerDay
+}
+
+// record adds a recovery to the pending ones, dropping the oldest above maxPending.
+func (s *State) record(rec Recovery) {
+	s.Pending = append(s.Pending, rec)
+	if len(s.Pending) > maxPending {
+		s.Pending = s.Pending[len(s.Pending)-maxPending:]
+	}
+}
@@ -0,0 +1,118 @@
+package watchdog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateNext(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var state State
+
+	// k0s is restarted after threshold failures.
+	assert.Equal(t, ActionNone, state.Next(false, "etcd is not ready", 2, now))
+	assert.Equal(t, ActionRestartK0s, state.Next(false, "etcd is not ready", 2, now))
+	assert.Equal(t, []Recovery{{Action: ActionRestartK0s, Reason: "etcd is not ready", Time: now}}, state.Pending)
+
+	// a successful check starts over.
+	assert.Equal(t, ActionNone, state.Next(true, "", 2, now))
+	assert.Equal(t, ActionNone, state.Next(false, "timeout", 2, now))
+	assert.Equal(t, ActionRestartK0s, state.Next(false, "timeout", 2, now))
+
+	// the host is rebooted when restarting k0s did not help.
+	assert.Equal(t, ActionNone, state.Next(false, "timeout", 2, now))
+	assert.Equal(t, ActionReboot, state.Next(false, "timeout", 2, now))
+	assert.Len(t, state.Reboots, 1)
+	assert.Len(t, state.Pending, 3)
+}
+
+func TestStatePause(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var state State
+
+	// k0s stopped for maintenance is not restarted however long the maintenance lasts.
+	assert.Equal(t, ActionNone, state.Next(false, "k0s process: not running", 2, now))
+	state.Pause()
+	assert.Equal(t, 0, state.Failures)
+	state.Pause()
+	assert.Equal(t, ActionNone, state.Next(false, "k0s process: not running", 2, now))
+	assert.Empty(t, state.Pending)
+
+	// a restart done before the maintenance started is forgotten, the host is not
+	// rebooted when k0s is slow to come back.
+	state = State{Restarted: true, Failures: 1}
+	state.Pause()
+	assert.Equal(t, ActionNone, state.Next(false, "timeout", 2, now))
+	assert.Equal(t, ActionRestartK0s, state.Next(false, "timeout", 2, now))
+	assert.Empty(t, state.Reboots)
+}
+
+func TestStateNextRebootLimit(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	state := State{
+		Restarted: true,
+		Reboots:   []time.Time{now.Add(-25 * time.Hour), now.Add(-3 * time.Hour), now.Add(-2 * time.Hour), now.Add(-time.Hour)},
+	}
+	assert.Equal(t, ActionNone, state.Next(false, "timeout", 1, now))
+	assert.True(t, state.RebootLimitReached())
+	assert.Len(t, state.Reboots, 3, "reboots older than a day are dropped")
+
+	// a day after the first of them the host is rebooted again.
+	assert.Equal(t, ActionReboot, state.Next(false, "timeout", 1, now.Add(22*time.Hour)))
+}
+
+func TestStateBoot(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	state := State{Failures: 2, Restarted: true}
+
+	// the first boot seen is not a recovery.
+	state.Boot("boot-1", true, now)
+	assert.Equal(t, State{BootID: "boot-1"}, state)
+
+	state.Failures = 3
+	state.Boot("boot-1", true, now)
+	assert.Equal(t, 3, state.Failures)
+
+	state.Boot("boot-2", false, now)
+	assert.Equal(t, 0, state.Failures)
+	assert.Empty(t, state.Pending)
+
+	state.Boot("boot-3", true, now)
+	assert.Equal(t, []Recovery{{Action: ActionHostReset, Reason: "the host stopped responding", Time: now}}, state.Pending)
+}
+
+func TestReadWriteState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watchdog", "state.json")
+	state, err := ReadState(path)
+	require.NoError(t, err)
+	assert.Equal(t, State{}, state)
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	state = State{
+		BootID:   "boot-1",
+		Failures: 1,
+		Reboots:  []time.Time{now},
+		Pending:  []Recovery{{Action: ActionReboot, Reason: "timeout", Time: now}},
+	}
+	require.NoError(t, WriteState(path, state))
+	got, err := ReadState(path)
+	require.NoError(t, err)
+	assert.Equal(t, state, got)
+}
+
+func TestHostReset(t *testing.T) {
+	orig := bootStatusPath
+	t.Cleanup(func() { bootStatusPath = orig })
+
+	bootStatusPath = filepath.Join(t.TempDir(), "bootstatus")
+	assert.False(t, HostReset())
+	require.NoError(t, os.WriteFile(bootStatusPath, []byte("0\n"), 0644))
+	assert.False(t, HostReset())
+	require.NoError(t, os.WriteFile(bootStatusPath, []byte("32\n"), 0644))
+	assert.True(t, HostReset())
+}
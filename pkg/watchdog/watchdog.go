@@ -0,0 +1,180 @@
+// Package watchdog lets a wedged node recover without an operator on site. systemd pings
+// the hardware watchdog, which resets the host when the kernel or systemd hang, and a
+// systemd timer checks the health of k0s on the node every minute: k0s is restarted after
+// a number of failed checks and the host is rebooted when restarting k0s did not help.
+// Only the local processes are checked, an outage of the cluster does not restart its
+// nodes. Recoveries are kept on disk until they can be reported to the cluster and to the
+// vendor.
+package watchdog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/replicatedhq/embedded-cluster/pkg/helpers"
+)
+
+const (
+	// DefaultRuntimeTimeout is how long the hardware watchdog waits for systemd by default.
+	DefaultRuntimeTimeout = 2 * time.Minute
+	// DefaultFailureThreshold is the number of failed health checks before acting by default.
+	DefaultFailureThreshold = 5
+	// rebootTimeout is how long the hardware watchdog waits for a reboot to complete.
+	rebootTimeout = "10min"
+	// unitName is the name of the systemd service and timer checking the health of k0s.
+	unitName = "embedded-cluster-watchdog"
+	// softdogModule is the software watchdog loaded on hosts without a hardware one.
+	softdogModule = "softdog"
+)
+
+var (
+	systemdDir = "/etc/systemd/system"
+	// managerConfigPath configures systemd to ping the hardware watchdog.
+	managerConfigPath = "/etc/systemd/system.conf.d/embedded-cluster-watchdog.conf"
+	// modulesLoadPath loads the software watchdog when the host boots.
+	modulesLoadPath = "/etc/modules-load.d/embedded-cluster-watchdog.conf"
+	// devicePath is the watchdog device systemd pings.
+	devicePath = "/dev/watchdog"
+)
+
+// Config is the watchdog configuration of a node.
+type Config struct {
+	RuntimeTimeout   time.Duration
+	FailureThreshold int
+}
+
+// ConfigFrom returns the watchdog configuration of the nodes, nil if the watchdog is not
+// enabled.
+func ConfigFrom(cfg *ecv1beta1.ConfigSpec) *Config {
+	if cfg == nil || cfg.Watchdog == nil || !cfg.Watchdog.Enabled {
+		return nil
+	}
+	config := &Config{RuntimeTimeout: DefaultRuntimeTimeout, FailureThreshold: DefaultFailureThreshold}
+	if cfg.Watchdog.RuntimeTimeout != nil && cfg.Watchdog.RuntimeTimeout.Duration > 0 {
+		config.RuntimeTimeout = cfg.Watchdog.RuntimeTimeout.Duration
+	}
+	if cfg.Watchdog.FailureThreshold > 0 {
+		config.FailureThreshold = cfg.Watchdog.FailureThreshold
+	}
+	return config
+}
+
+// ManagerConfig returns the systemd manager configuration pinging the hardware watchdog.
+func ManagerConfig(timeout time.Duration) string {
+	return fmt.Sprintf(`[Manager]
+RuntimeWatchdogSec=%d
+RebootWatchdogSec=%s
+`, int(timeout.Seconds()), rebootTimeout)
+}
+
+// ServiceUnit returns the systemd service checking the health of k0s with the binary.
+func ServiceUnit(binary string, threshold int) string {
+	return fmt.Sprintf(`[Unit]
+Description=Embedded Cluster watchdog
+
+[Service]
+Type=oneshot
+ExecStart=%s admin watchdog check --failure-threshold %d
+`, binary, threshold)
+}
+
+// TimerUnit returns the systemd timer starting the health check every minute, once k0s
+// had the time to start after the host booted.
+func TimerUnit() string {
+	return `[Unit]
+Description=Embedded Cluster watchdog schedule
+
+[Timer]
+OnBootSec=5min
+OnUnitActiveSec=1min
+AccuracySec=10s
+
+[Install]
+WantedBy=timers.target
+`
+}
+
+// Configure arms the watchdog of the host and installs the timer checking the health of
+// k0s. The software watchdog is loaded on hosts without a hardware one, it does not help
+// when the kernel hangs but still resets the host when systemd does.
+func Configure(binary string, cfg Config) error {
+	if _, err := os.Stat(devicePath); err != nil {
+		logrus.Debugf("no watchdog device found, loading the %s module", softdogModule)
+		if err := os.WriteFile(modulesLoadPath, []byte(softdogModule+"\n"), 0644); err != nil {
+			return fmt.Errorf("unable to write %s: %w", modulesLoadPath, err)
+		}
+		if _, err := helpers.RunCommand("modprobe", softdogModule); err != nil {
+			return fmt.Errorf("unable to load the %s module: %w", softdogModule, err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(managerConfigPath), 0755); err != nil {
+		return fmt.Errorf("unable to create %s: %w", filepath.Dir(managerConfigPath), err)
+	}
+	if err := os.WriteFile(managerConfigPath, []byte(ManagerConfig(cfg.RuntimeTimeout)), 0644); err != nil {
+		return fmt.Errorf("unable to write systemd watchdog config: %w", err)
+	}
+	// the manager configuration is only read when systemd starts.
+	if _, err := helpers.RunCommand("systemctl", "daemon-reexec"); err != nil {
+		return fmt.Errorf("unable to reexecute systemd: %w", err)
+	}
+
+	service := filepath.Join(systemdDir, unitName+".service")
+	if err := os.WriteFile(service, []byte(ServiceUnit(binary, cfg.FailureThreshold)), 0644); err != nil {
+		return fmt.Errorf("unable to write watchdog service: %w", err)
+	}
+	timer := filepath.Join(systemdDir, unitName+".timer")
+	if err := os.WriteFile(timer, []byte(TimerUnit()), 0644); err != nil {
+		return fmt.Errorf("unable to write watchdog timer: %w", err)
+	}
+	if _, err := helpers.RunCommand("systemctl", "daemon-reload"); err != nil {
+		return fmt.Errorf("unable to reload systemctl daemon: %w", err)
+	}
+	if _, err := helpers.RunCommand("systemctl", "enable", "--now", unitName+".timer"); err != nil {
+		return fmt.Errorf("unable to enable watchdog timer: %w", err)
+	}
+	return nil
+}
+
+// Installed returns true if the timer checking the health of k0s is installed.
+func Installed() bool {
+	_, err := os.Stat(filepath.Join(systemdDir, unitName+".timer"))
+	return err == nil
+}
+
+// Remove disarms the watchdog and removes the timer, nothing is done if the timer is not
+// installed. The software watchdog module stays loaded until the host reboots.
+func Remove() error {
+	if !Installed() {
+		return nil
+	}
+	if _, err := helpers.RunCommand("systemctl", "disable", "--now", unitName+".timer"); err != nil {
+		return fmt.Errorf("unable to disable watchdog timer: %w", err)
+	}
+	paths := []string{
+		filepath.Join(systemdDir, unitName+".timer"),
+		filepath.Join(systemdDir, unitName+".service"),
+		modulesLoadPath,
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove %s: %w", path, err)
+		}
+	}
+	if _, err := os.Stat(managerConfigPath); err == nil {
+		if err := os.Remove(managerConfigPath); err != nil {
+			return fmt.Errorf("unable to remove %s: %w", managerConfigPath, err)
+		}
+		if _, err := helpers.RunCommand("systemctl", "daemon-reexec"); err != nil {
+			return fmt.Errorf("unable to reexecute systemd: %w", err)
+		}
+	}
+	if _, err := helpers.RunCommand("systemctl", "daemon-reload"); err != nil {
+		return fmt.Errorf("unable to reload systemctl daemon: %w", err)
+	}
+	return nil
+}
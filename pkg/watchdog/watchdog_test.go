@@ -0,0 +1,29 @@
+package watchdog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+func TestConfigFrom(t *testing.T) {
+	assert.Nil(t, ConfigFrom(nil))
+	assert.Nil(t, ConfigFrom(&ecv1beta1.ConfigSpec{}))
+	assert.Nil(t, ConfigFrom(&ecv1beta1.ConfigSpec{Watchdog: &ecv1beta1.Watchdog{}}))
+
+	cfg := &ecv1beta1.ConfigSpec{Watchdog: &ecv1beta1.Watchdog{Enabled: true}}
+	assert.Equal(t, &Config{RuntimeTimeout: DefaultRuntimeTimeout, FailureThreshold: DefaultFailureThreshold}, ConfigFrom(cfg))
+
+	cfg.Watchdog.RuntimeTimeout = &metav1.Duration{Duration: 3 * time.Minute}
+	cfg.Watchdog.FailureThreshold = 3
+	assert.Equal(t, &Config{RuntimeTimeout: 3 * time.Minute, FailureThreshold: 3}, ConfigFrom(cfg))
+}
+
+func TestUnits(t *testing.T) {
+	assert.Contains(t, ManagerConfig(3*time.Minute), "RuntimeWatchdogSec=180\n")
+	assert.Contains(t, ServiceUnit("/var/lib/embedded-cluster/bin/app", 3), "ExecStart=/var/lib/embedded-cluster/bin/app admin watchdog check --failure-threshold 3\n")
+}
@@ -0,0 +1,191 @@
+// Package windowsworker writes the artifacts that join a Windows Server host to the
+// cluster as a worker. The embedded cluster binary only runs on linux, so the artifacts
+// are written on a linux host and copied to the Windows host where install.ps1 checks
+// the host, installs containerd, the Calico CNI plugins and k0s, and joins the cluster.
+// The k0s binary is downloaded from the local artifact mirror of a controller, Calico and
+// kube-proxy are deployed on the Windows nodes by the operator. Windows nodes are tainted so only workloads tolerating os=windows:NoSchedule run on
+// them.
+package windowsworker
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	k0sconfig "github.com/k0sproject/k0s/pkg/apis/k0s/v1beta1"
+	"github.com/k0sproject/k0s/pkg/constant"
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+)
+
+const (
+	// ContainerdVersion is the version of containerd installed on Windows hosts.
+	ContainerdVersion = "1.7.22"
+	// K0sBinary is the name of the windows k0s binary served by the local artifact mirror
+	// of the controllers. Only amd64 releases embed it.
+	K0sBinary = "k0s.exe"
+	// MinimumWindowsBuild is the build of Windows Server 2019, the oldest release
+	// supported by Kubernetes.
+	MinimumWindowsBuild = 17763
+)
+
+//go:embed static/*
+var static embed.FS
+
+// artifacts maps the files written to the templates they are rendered from.
+var artifacts = map[string]string{
+	"containerd.toml":    "static/containerd.toml.tmpl",
+	"10-calico.conflist": "static/10-calico.conflist.tmpl",
+	"preflights.ps1":     "static/preflights.ps1.tmpl",
+	"install.ps1":        "static/install.ps1.tmpl",
+}
+
+// Options holds what the artifacts are rendered with.
+type Options struct {
+	// K0sVersion is the version of k0s running in the cluster.
+	K0sVersion string
+	// Token is the k0s worker join token and Server the address of the kubernetes API
+	// it points to.
+	Token  string
+	Server string
+	// ArtifactMirror is the address, host:port, of the local artifact mirror of a
+	// controller and ArtifactMirrorToken the bootstrap token authorizing its downloads.
+	ArtifactMirror      string
+	ArtifactMirrorToken string
+	// Network is the network configuration of the cluster, defaults are used for the
+	// CIDRs it leaves empty.
+	Network *ecv1beta1.NetworkSpec
+	// Proxy is the proxy configuration of the cluster, if any.
+	Proxy *ecv1beta1.ProxySpec
+	// Labels are added to the node.
+	Labels map[string]string
+}
+
+type templateData struct {
+	K0sVersion          string
+	K0sURL              string
+	ArtifactMirrorHost  string
+	ArtifactMirrorPort  string
+	ArtifactMirrorAuth  bool
+	ContainerdVersion   string
+	CalicoVersion       string
+	PauseImage          string
+	MinimumWindowsBuild int
+	APIHost             string
+	APIPort             string
+	PodCIDR             string
+	ServiceCIDR         string
+	DNSAddress          string
+	Proxy               *ecv1beta1.ProxySpec
+	Labels              string
+}
+
+// Write renders the artifacts into the directory, creating it if needed.
+func Write(dir string, opts Options) error {
+	data, err := newTemplateData(opts)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("unable to create directory %s: %w", dir, err)
+	}
+	for name, tmpl := range artifacts {
+		content, err := render(tmpl, data)
+		if err != nil {
+			return fmt.Errorf("unable to render %s: %w", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			return fmt.Errorf("unable to write %s: %w", name, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "k0s-token"), []byte(opts.Token), 0600); err != nil {
+		return fmt.Errorf("unable to write k0s-token: %w", err)
+	}
+	if opts.ArtifactMirrorToken != "" {
+		if err := os.WriteFile(filepath.Join(dir, "artifact-mirror-token"), []byte(opts.ArtifactMirrorToken), 0600); err != nil {
+			return fmt.Errorf("unable to write artifact-mirror-token: %w", err)
+		}
+	}
+	return nil
+}
+
+func newTemplateData(opts Options) (templateData, error) {
+	server, err := url.Parse(opts.Server)
+	if err != nil || server.Hostname() == "" {
+		return templateData{}, fmt.Errorf("invalid kubernetes api address %q", opts.Server)
+	}
+	port := server.Port()
+	if port == "" {
+		port = "443"
+	}
+	mirrorHost, mirrorPort, err := net.SplitHostPort(opts.ArtifactMirror)
+	if err != nil {
+		return templateData{}, fmt.Errorf("invalid local artifact mirror address %q", opts.ArtifactMirror)
+	}
+	k0sURL := url.URL{Scheme: "http", Host: opts.ArtifactMirror, Path: "/bin/" + K0sBinary}
+	network := k0sconfig.DefaultNetwork()
+	if opts.Network != nil {
+		if opts.Network.PodCIDR != "" {
+			network.PodCIDR = opts.Network.PodCIDR
+		}
+		if opts.Network.ServiceCIDR != "" {
+			network.ServiceCIDR = opts.Network.ServiceCIDR
+		}
+	}
+	dns, err := network.DNSAddress()
+	if err != nil {
+		return templateData{}, fmt.Errorf("unable to get cluster dns address: %w", err)
+	}
+	return templateData{
+		K0sVersion:          opts.K0sVersion,
+		K0sURL:              k0sURL.String(),
+		ArtifactMirrorHost:  mirrorHost,
+		ArtifactMirrorPort:  mirrorPort,
+		ArtifactMirrorAuth:  opts.ArtifactMirrorToken != "",
+		ContainerdVersion:   ContainerdVersion,
+		CalicoVersion:       calicoVersion(),
+		PauseImage:          fmt.Sprintf("%s:%s", constant.KubePauseContainerImage, constant.KubePauseContainerImageVersion),
+		MinimumWindowsBuild: MinimumWindowsBuild,
+		APIHost:             server.Hostname(),
+		APIPort:             port,
+		PodCIDR:             network.PodCIDR,
+		ServiceCIDR:         network.ServiceCIDR,
+		DNSAddress:          dns,
+		Proxy:               opts.Proxy,
+		Labels:              formatLabels(opts.Labels),
+	}, nil
+}
+
+// calicoVersion returns the Calico release matching the images k0s deploys on the linux
+// nodes, the images are tagged with the release and a k0s build suffix.
+func calicoVersion() string {
+	version, _, _ := strings.Cut(constant.CalicoComponentImagesVersion, "-")
+	return version
+}
+
+func formatLabels(labels map[string]string) string {
+	var pairs []string
+	for k, v := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func render(name string, data templateData) ([]byte, error) {
+	tmpl, err := template.ParseFS(static, name)
+	if err != nil {
+		return nil, fmt.Errorf("parse template: %w", err)
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := tmpl.Execute(buf, data); err != nil {
+		return nil, fmt.Errorf("execute template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,70 @@
+package windowsworker
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ecv1beta1 "github.com/replicatedhq/embedded-cluster/kinds/apis/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "windows-worker")
+	err := Write(dir, Options{
+		K0sVersion:          "v1.29.9+k0s.0",
+		Token:               "token",
+		Server:              "https://10.0.0.1:6443",
+		ArtifactMirror:      "10.0.0.1:50000",
+		ArtifactMirrorToken: "abcdef.0123456789abcdef",
+		Network:             &ecv1beta1.NetworkSpec{ServiceCIDR: "10.100.0.0/16"},
+		Proxy:               &ecv1beta1.ProxySpec{HTTPSProxy: "http://proxy:3128"},
+		Labels:              map[string]string{"zone": "b", "os": "windows"},
+	})
+	require.NoError(t, err)
+
+	token, err := os.ReadFile(filepath.Join(dir, "k0s-token"))
+	require.NoError(t, err)
+	assert.Equal(t, "token", string(token))
+	mirrorToken, err := os.ReadFile(filepath.Join(dir, "artifact-mirror-token"))
+	require.NoError(t, err)
+	assert.Equal(t, "abcdef.0123456789abcdef", string(mirrorToken))
+
+	conflist, err := os.ReadFile(filepath.Join(dir, "10-calico.conflist"))
+	require.NoError(t, err)
+	var cni map[string]interface{}
+	require.NoError(t, json.Unmarshal(conflist, &cni), "the cni configuration must be valid json")
+	assert.Contains(t, string(conflist), `"Nameservers": ["10.100.0.10"]`)
+	assert.Contains(t, string(conflist), `"ExceptionList": ["10.100.0.0/16", "10.244.0.0/16"]`)
+
+	preflights, err := os.ReadFile(filepath.Join(dir, "preflights.ps1"))
+	require.NoError(t, err)
+	assert.Contains(t, string(preflights), `Test-NetConnection -ComputerName "10.0.0.1" -Port 6443`)
+	assert.Contains(t, string(preflights), `Test-NetConnection -ComputerName "10.0.0.1" -Port 50000`)
+
+	install, err := os.ReadFile(filepath.Join(dir, "install.ps1"))
+	require.NoError(t, err)
+	assert.Contains(t, string(install), `-Uri "http://10.0.0.1:50000/bin/k0s.exe"`)
+	assert.Contains(t, string(install), "Bearer $(Get-Content -Raw artifact-mirror-token)")
+	assert.NotContains(t, string(install), "abcdef.0123456789abcdef", "the token is only written to a private file")
+	assert.NotContains(t, string(install), "github.com/k0sproject")
+	assert.Contains(t, string(install), `--labels "os=windows,zone=b"`)
+	assert.Contains(t, string(install), `$env:HTTPS_PROXY = "http://proxy:3128"`)
+	assert.NotContains(t, string(install), "HTTP_PROXY")
+
+	containerd, err := os.ReadFile(filepath.Join(dir, "containerd.toml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(containerd), `sandbox_image = "registry.k8s.io/pause:3.9"`)
+}
+
+func TestWriteInvalidServer(t *testing.T) {
+	err := Write(t.TempDir(), Options{Server: "10.0.0.1"})
+	assert.EqualError(t, err, `invalid kubernetes api address "10.0.0.1"`)
+}
+
+func TestWriteInvalidArtifactMirror(t *testing.T) {
+	err := Write(t.TempDir(), Options{Server: "https://10.0.0.1:6443", ArtifactMirror: "10.0.0.1"})
+	assert.EqualError(t, err, `invalid local artifact mirror address "10.0.0.1"`)
+}
@@ -10,9 +10,11 @@ import (
 )
 
 const (
-	dashes                = "-----" // this is broken up within the binary to prevent false positives
-	beginReleaseDelimiter = "BEGIN APP RELEASE"
-	endReleaseDelimiter   = "END APP RELEASE"
+	dashes                  = "-----" // this is broken up within the binary to prevent false positives
+	beginReleaseDelimiter   = "BEGIN APP RELEASE"
+	endReleaseDelimiter     = "END APP RELEASE"
+	beginSignatureDelimiter = "BEGIN APP RELEASE SIGNATURE"
+	endSignatureDelimiter   = "END APP RELEASE SIGNATURE"
 )
 
 // EmbedReleaseDataInBinary embeds the release data in the binary at the end of the file and
@@ -29,6 +31,10 @@ func EmbedReleaseDataInBinary(binPath string, releasePath string, outputPath str
 	if bytes.HasSuffix(binContent, delimiterBytes(endReleaseDelimiter)) {
 		start := lastIndexOfDelimiter(binContent, beginReleaseDelimiter)
 		end := lastIndexOfDelimiter(binContent, endReleaseDelimiter)
+		// the signature of the previous release data is removed along with it.
+		if sigStart, _ := signatureBounds(binContent, start); sigStart != -1 {
+			start = sigStart
+		}
 		binContent = append(binContent[:start], binContent[end+lengthOfDelimiter(endReleaseDelimiter):]...)
 	}
 
@@ -76,6 +82,26 @@ func EmbedReleaseDataInBinaryReader(binReader io.Reader, binSize int64, releaseD
 	return newBinReader, newBinSize
 }
 
+// EmbedSignedReleaseDataInBinaryReader embeds the release data and its signature in the
+// binary at the end of the binary reader, and returns a new binary reader with the embedded
+// release data and the new binary size. The signature is placed right before the release
+// data so binaries unaware of signatures still find the release data at the end.
+func EmbedSignedReleaseDataInBinaryReader(binReader io.Reader, binSize int64, releaseData, signature []byte) (io.Reader, int64) {
+	encodedSignature := base64.StdEncoding.EncodeToString(signature)
+
+	sigSize := int64(lengthOfDelimiter(beginSignatureDelimiter))
+	sigSize += int64(len(encodedSignature))
+	sigSize += int64(lengthOfDelimiter(endSignatureDelimiter))
+
+	sigReader := io.MultiReader(
+		binReader,
+		bytes.NewReader(delimiterBytes(beginSignatureDelimiter)),
+		strings.NewReader(encodedSignature),
+		bytes.NewReader(delimiterBytes(endSignatureDelimiter)),
+	)
+	return EmbedReleaseDataInBinaryReader(sigReader, binSize+sigSize, releaseData)
+}
+
 // ExtractReleaseDataFromBinary extracts the release data from the binary.
 func ExtractReleaseDataFromBinary(exe string) ([]byte, error) {
 	binContent, err := os.ReadFile(exe)
@@ -111,6 +137,45 @@ func ExtractReleaseDataFromBinary(exe string) ([]byte, error) {
 	return decoded, nil
 }
 
+// ExtractReleaseSignatureFromBinary extracts the signature of the release data from the
+// binary. Returns nil if the binary holds no signed release data.
+func ExtractReleaseSignatureFromBinary(exe string) ([]byte, error) {
+	binContent, err := os.ReadFile(exe)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read executable: %w", err)
+	}
+
+	release := lastIndexOfDelimiter(binContent, beginReleaseDelimiter)
+	if release == -1 {
+		return nil, nil
+	}
+	start, end := signatureBounds(binContent, release)
+	if start == -1 {
+		return nil, nil
+	}
+
+	encoded := binContent[start+lengthOfDelimiter(beginSignatureDelimiter) : end]
+	decoded, err := base64.StdEncoding.DecodeString(string(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode release signature: %w", err)
+	}
+	return decoded, nil
+}
+
+// signatureBounds returns the indexes of the begin and end delimiters of the signature
+// ending right where the release data starts, -1 is returned if there is none.
+func signatureBounds(binContent []byte, release int) (int, int) {
+	end := release - lengthOfDelimiter(endSignatureDelimiter)
+	if end < 0 || !bytes.Equal(binContent[end:release], delimiterBytes(endSignatureDelimiter)) {
+		return -1, -1
+	}
+	start := lastIndexOfDelimiter(binContent[:end], beginSignatureDelimiter)
+	if start == -1 {
+		return -1, -1
+	}
+	return start, end
+}
+
 // the go compiler will optimize concatenation of bytes as a constant string which will cause
 // ExtractReleaseDataFromBinary to fail because it will find the delimiter in the wrong place.
 // This function is used to create a byte slice that will be used as a delimiter while working
@@ -1,11 +1,15 @@
 package embed
 
 import (
+	"bytes"
 	"encoding/base64"
+	"io"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestEmbedReleaseDataInBinary(t *testing.T) {
@@ -91,3 +95,34 @@ func Test_beginReleaseDelimiterBytes(t *testing.T) {
 func Test_endReleaseDelimiterBytes(t *testing.T) {
 	assert.Equalf(t, []byte("-----END APP RELEASE-----"), delimiterBytes(endReleaseDelimiter), "beginReleaseDelimiterBytes()")
 }
+
+func TestEmbedSignedReleaseDataInBinaryReader(t *testing.T) {
+	dir := t.TempDir()
+	binPath := filepath.Join(dir, "bin")
+	binContent := []byte("test binary content")
+
+	reader, size := EmbedSignedReleaseDataInBinaryReader(bytes.NewReader(binContent), int64(len(binContent)), []byte("test release data"), []byte("test signature"))
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, size, int64(len(content)))
+	require.NoError(t, os.WriteFile(binPath, content, 0755))
+
+	data, err := ExtractReleaseDataFromBinary(binPath)
+	require.NoError(t, err)
+	assert.Equal(t, "test release data", string(data))
+	signature, err := ExtractReleaseSignatureFromBinary(binPath)
+	require.NoError(t, err)
+	assert.Equal(t, "test signature", string(signature))
+
+	// embedding unsigned release data removes the previous signature.
+	releasePath := filepath.Join(dir, "release")
+	require.NoError(t, os.WriteFile(releasePath, []byte("new release data"), 0644))
+	outputPath := filepath.Join(dir, "output")
+	require.NoError(t, EmbedReleaseDataInBinary(binPath, releasePath, outputPath))
+	content, err = os.ReadFile(outputPath)
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(content, append(binContent, delimiterBytes(beginReleaseDelimiter)...)))
+	signature, err = ExtractReleaseSignatureFromBinary(outputPath)
+	require.NoError(t, err)
+	assert.Nil(t, signature)
+}